@@ -22,18 +22,26 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"strings"
+	"time"
 
+	prom "github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	ctrlconfig "sigs.k8s.io/controller-runtime/pkg/client/config"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+	ctrlmanager "sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/manager/signals"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
 	"sigs.k8s.io/vsphere-csi-driver/pkg/common/prometheus"
 	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/common"
 
-	"github.com/kubernetes-csi/csi-lib-utils/leaderelection"
 	cnstypes "github.com/vmware/govmomi/cns/types"
 
 	"sigs.k8s.io/vsphere-csi-driver/pkg/common/config"
 	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/common/commonco"
 	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
-	k8s "sigs.k8s.io/vsphere-csi-driver/pkg/kubernetes"
 	"sigs.k8s.io/vsphere-csi-driver/pkg/syncer"
 	"sigs.k8s.io/vsphere-csi-driver/pkg/syncer/admissionhandler"
 	"sigs.k8s.io/vsphere-csi-driver/pkg/syncer/cnsoperator/manager"
@@ -47,9 +55,19 @@ const operationModeWebHookServer = "WEBHOOK_SERVER"
 // OperationModeWebHookServer starts container for metadata sync
 const operationModeMetaDataSync = "METADATA_SYNC"
 
+// leaderElectionID is the name of the lease used to elect the leader instance
+// of vsphere-syncer
+const leaderElectionID = "vsphere-syncer"
+
 var (
 	enableLeaderElection    = flag.Bool("leader-election", false, "Enable leader election.")
 	leaderElectionNamespace = flag.String("leader-election-namespace", "", "Namespace where the leader election resource lives. Defaults to the pod namespace if not set.")
+	leaseDuration           = flag.Duration("leader-election-lease-duration", 15*time.Second, "Duration non-leader instances wait before trying to acquire the leader election lease.")
+	renewDeadline           = flag.Duration("leader-election-renew-deadline", 10*time.Second, "Duration the leader retries renewing the leader election lease before giving it up.")
+	retryPeriod             = flag.Duration("leader-election-retry-period", 5*time.Second, "Duration instances wait between tries of actions on the leader election lease.")
+	volumeShardCount        = flag.Int("volume-shard-count", 1, "Number of syncer replicas sharing the metadata and health sync of the volumes by volume ID hash. Full sync runs on the leader.")
+	volumeShardIndex        = flag.Int("volume-shard-index", -1, "Index of the volume shard of this replica. Assigned with a lease per shard if not set.")
+	healthProbeBindAddress  = flag.String("health-probe-bind-address", ":2114", "Address the health probe endpoints /healthz and /readyz bind to, \"0\" disables them.")
 	printVersion            = flag.Bool("version", false, "Print syncer version and exit")
 	operationMode           = flag.String("operation-mode", operationModeMetaDataSync, "specify operation mode METADATA_SYNC or WEBHOOK_SERVER")
 
@@ -93,9 +111,41 @@ func main() {
 			log.Errorf("failed to initialize the configInfo. Err: %+v", err)
 			os.Exit(1)
 		}
-		// run will be executed if this instance is elected as the leader
-		// or if leader election is not enabled
-		var run func(ctx context.Context)
+		restConfig, err := ctrlconfig.GetConfig()
+		if err != nil {
+			log.Fatalf("failed to get Kubernetes config. Err: %v", err)
+		}
+		// The manager runs the syncer components, electing the leader instance
+		// of vsphere-syncer if leader election is enabled. Its metrics are
+		// exposed along with the syncer metrics.
+		mgr, err := ctrlmanager.New(restConfig, ctrlmanager.Options{
+			LeaderElection:             *enableLeaderElection,
+			LeaderElectionID:           leaderElectionID,
+			LeaderElectionNamespace:    *leaderElectionNamespace,
+			LeaderElectionResourceLock: resourcelock.LeasesResourceLock,
+			LeaseDuration:              leaseDuration,
+			RenewDeadline:              renewDeadline,
+			RetryPeriod:                retryPeriod,
+			MetricsBindAddress:         "0",
+			HealthProbeBindAddress:     *healthProbeBindAddress,
+		})
+		if err != nil {
+			log.Fatalf("failed to create the manager. Err: %v", err)
+		}
+		// The instance stays the leader until the process exits, as the manager
+		// exits once the leader election lease is lost.
+		prometheus.LeaderElectionIsLeader.WithLabelValues(leaderElectionID).Set(0)
+		go func() {
+			<-mgr.Elected()
+			log.Infof("Elected leader of %q", leaderElectionID)
+			prometheus.LeaderElectionIsLeader.WithLabelValues(leaderElectionID).Set(1)
+		}()
+		if err := mgr.AddHealthzCheck("ping", healthz.Ping); err != nil {
+			log.Fatalf("failed to add health check. Err: %v", err)
+		}
+		if err := mgr.AddReadyzCheck("ping", healthz.Ping); err != nil {
+			log.Fatalf("failed to add ready check. Err: %v", err)
+		}
 
 		// Initialize K8sCloudOperator for every instance of vsphere-syncer in the Supervisor
 		// Cluster, independent of whether leader election is enabled.
@@ -111,9 +161,10 @@ func main() {
 		// Go module to keep the metrics http server running all the time.
 		go func() {
 			prometheus.SyncerInfo.WithLabelValues(syncer.Version).Set(1)
+			gatherers := prom.Gatherers{prom.DefaultGatherer, controllerRuntimeGatherer}
 			for {
 				log.Info("Starting the http server to expose Prometheus metrics..")
-				http.Handle("/metrics", promhttp.Handler())
+				http.Handle("/metrics", promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{}))
 				err = http.ListenAndServe(":2113", nil)
 				if err != nil {
 					log.Warnf("Http server that exposes the Prometheus exited with err: %+v", err)
@@ -122,37 +173,79 @@ func main() {
 			}
 		}()
 
-		// Initialize syncer components that are dependant on the outcome of leader election, if enabled.
-		run = initSyncerComponents(ctx, clusterFlavor, configInfo, &syncer.COInitParams)
-
-		if !*enableLeaderElection {
-			run(context.TODO())
-		} else {
-			k8sClient, err := k8s.NewClient(ctx)
+		shard := syncer.VolumeShard{Index: *volumeShardIndex, Count: *volumeShardCount}
+		if shard.Sharded() && shard.Index < 0 {
+			shard.Index, err = syncer.AcquireVolumeShardIndex(ctx, shard.Count, *leaseDuration, *renewDeadline,
+				*retryPeriod)
 			if err != nil {
-				log.Fatalf("Creating Kubernetes client failed. Err: %v", err)
-			}
-			lockName := "vsphere-syncer"
-			le := leaderelection.NewLeaderElection(k8sClient, lockName, run)
-
-			if *leaderElectionNamespace != "" {
-				le.WithNamespace(*leaderElectionNamespace)
+				log.Fatalf("failed to acquire a volume shard. Err: %v", err)
 			}
+		}
+		if err := shard.Validate(); err != nil {
+			log.Fatalf("invalid volume shard. Err: %v", err)
+		}
 
-			if err := le.Run(); err != nil {
-				log.Fatalf("Error initializing leader election: %v", err)
+		// Initialize syncer components that are dependant on the outcome of leader election, if enabled.
+		err = mgr.Add(ctrlmanager.RunnableFunc(initSyncerComponents(clusterFlavor, configInfo, &syncer.COInitParams, mgr, shard)))
+		if err != nil {
+			log.Fatalf("failed to add syncer components to the manager. Err: %v", err)
+		}
+		if shard.Sharded() {
+			// Every replica syncs the metadata of the volumes in its shard.
+			err = mgr.Add(allReplicasRunnable(initMetadataSyncer(clusterFlavor, configInfo, mgr, shard)))
+			if err != nil {
+				log.Fatalf("failed to add metadata syncer to the manager. Err: %v", err)
 			}
 		}
+		if err := mgr.Start(signals.SetupSignalHandler()); err != nil {
+			log.Fatalf("Error running the manager: %v", err)
+		}
 	} else {
 		log.Fatalf("unsupported operation mode: %v", *operationMode)
 	}
 }
 
+// controllerRuntimeGatherer gathers the metrics of controller-runtime, such as
+// the workqueue metrics, leaving out the Go and process metrics already in
+// the default registry.
+var controllerRuntimeGatherer = prom.GathererFunc(func() ([]*dto.MetricFamily, error) {
+	metricFamilies, err := ctrlmetrics.Registry.Gather()
+	if err != nil {
+		return nil, err
+	}
+	filtered := metricFamilies[:0]
+	for _, metricFamily := range metricFamilies {
+		if strings.HasPrefix(metricFamily.GetName(), "go_") || strings.HasPrefix(metricFamily.GetName(), "process_") {
+			continue
+		}
+		filtered = append(filtered, metricFamily)
+	}
+	return filtered, nil
+})
+
+// allReplicasRunnable is a manager.Runnable running on all the replicas of
+// vsphere-syncer, not only on the leader.
+type allReplicasRunnable ctrlmanager.RunnableFunc
+
+// Start runs the function until ctx is done.
+func (r allReplicasRunnable) Start(ctx context.Context) error {
+	return r(ctx)
+}
+
+// NeedLeaderElection returns false, the runnable runs on all the replicas.
+func (r allReplicasRunnable) NeedLeaderElection() bool {
+	return false
+}
+
 // initSyncerComponents initializes syncer components that are dependant on the leader election algorithm.
 // This function is only called by the leader instance of vsphere-syncer, if enabled.
+// The periodic reconcilers of the syncer are added to the manager. The metadata syncer
+// is initialized on all the replicas instead if the volumes are sharded across them.
 // TODO: Change name from initSyncerComponents to init<Name>Components where <Name> will be the name of this container
-func initSyncerComponents(ctx context.Context, clusterFlavor cnstypes.CnsClusterFlavor, configInfo *config.ConfigurationInfo, coInitParams *interface{}) func(ctx context.Context) {
-	return func(ctx context.Context) {
+func initSyncerComponents(clusterFlavor cnstypes.CnsClusterFlavor, configInfo *config.ConfigurationInfo,
+	coInitParams *interface{}, mgr ctrlmanager.Manager, shard syncer.VolumeShard) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		ctx = logger.NewContextWithLogger(ctx)
 		log := logger.GetLogger(ctx)
 		if err := manager.InitCommonModules(ctx, clusterFlavor, coInitParams); err != nil {
 			log.Errorf("Error initializing common modules for all flavors. Error: %+v", err)
@@ -173,9 +266,24 @@ func initSyncerComponents(ctx context.Context, clusterFlavor cnstypes.CnsCluster
 				os.Exit(1)
 			}
 		}()
-		if err := syncer.InitMetadataSyncer(ctx, clusterFlavor, configInfo); err != nil {
+		if shard.Sharded() {
+			<-ctx.Done()
+			return nil
+		}
+		return initMetadataSyncer(clusterFlavor, configInfo, mgr, shard)(ctx)
+	}
+}
+
+// initMetadataSyncer initializes the metadata syncer of the volumes in the shard.
+func initMetadataSyncer(clusterFlavor cnstypes.CnsClusterFlavor, configInfo *config.ConfigurationInfo,
+	mgr ctrlmanager.Manager, shard syncer.VolumeShard) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		ctx = logger.NewContextWithLogger(ctx)
+		log := logger.GetLogger(ctx)
+		if err := syncer.InitMetadataSyncer(ctx, clusterFlavor, configInfo, mgr, shard); err != nil {
 			log.Errorf("Error initializing Metadata Syncer. Error: %+v", err)
 			os.Exit(1)
 		}
+		return nil
 	}
 }
@@ -50,7 +50,21 @@ else
     read -ra OPTS <<< "-v $GINKGO_OPTS"
 fi
 
-ginkgo -mod=mod "${OPTS[@]}" --focus="$FOCUS" tests/e2e
+# $GINKGO_LABEL_FILTER selects specs by label, e.g. "block && !disruptive".
+# See tests/e2e/labels.go for the list of labels.
+# $E2E_REPORT_DIR is where junit.xml and timing-report.json are written.
+SUITE_OPTS=()
+if [ -n "${GINKGO_LABEL_FILTER-}" ]; then
+    SUITE_OPTS+=("-label-filter=$GINKGO_LABEL_FILTER")
+fi
+if [ -n "${E2E_REPORT_DIR-}" ]; then
+    SUITE_OPTS+=("-report-dir=$E2E_REPORT_DIR")
+fi
+if [ ${#SUITE_OPTS[@]} -gt 0 ]; then
+    SUITE_OPTS=(-- "${SUITE_OPTS[@]}")
+fi
+
+ginkgo -mod=mod "${OPTS[@]}" --focus="$FOCUS" tests/e2e ${SUITE_OPTS[@]+"${SUITE_OPTS[@]}"}
 
 # Checking for test status
 TEST_PASS=$?
@@ -47,6 +47,7 @@ CA_BUNDLE=$(kubectl get configmap -n kube-system extension-apiserver-authenticat
 
 kubectl delete service vsphere-webhook-svc --namespace "${namespace}" 2>/dev/null || true
 kubectl delete validatingwebhookconfiguration.admissionregistration.k8s.io validation.csi.vsphere.vmware.com --namespace "${namespace}" 2>/dev/null || true
+kubectl delete mutatingwebhookconfiguration.admissionregistration.k8s.io mutation.csi.vsphere.vmware.com --namespace "${namespace}" 2>/dev/null || true
 kubectl delete serviceaccount vsphere-csi-webhook --namespace "${namespace}" 2>/dev/null || true
 kubectl delete clusterrole.rbac.authorization.k8s.io vsphere-csi-webhook-role 2>/dev/null || true
 kubectl delete clusterrolebinding.rbac.authorization.k8s.io vsphere-csi-webhook-role-binding --namespace "${namespace}" 2>/dev/null || true
@@ -136,6 +136,8 @@ cat <<eof >"${tmpdir}"/webhook.config
 port = "8443"
 cert-file = "/etc/webhook/cert.pem"
 key-file = "/etc/webhook/key.pem"
+# filesystem type set by the mutating webhook on StorageClasses and PersistentVolumes which don't specify one
+# default-fstype = "ext4"
 eof
 
 
@@ -0,0 +1,98 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CnsStorageQuotaLimit is a budget of capacity for the volumes of the
+// namespace with a storage policy on a datastore.
+// +k8s:openapi-gen=true
+type CnsStorageQuotaLimit struct {
+	// StoragePolicyName is the name of the storage policy of the volumes the
+	// limit applies to. The limit applies to all storage policies if empty.
+	StoragePolicyName string `json:"storagePolicyName,omitempty"`
+
+	// DatastoreURL is the URL of the datastore of the volumes the limit
+	// applies to. The limit applies to all datastores if empty.
+	DatastoreURL string `json:"datastoreURL,omitempty"`
+
+	// LimitInMb is the total capacity of the volumes the limit applies to.
+	LimitInMb int64 `json:"limitInMb"`
+}
+
+// Matches returns whether the limit applies to the volumes with the given
+// storage policy name and datastore URL.
+func (l CnsStorageQuotaLimit) Matches(storagePolicyName string, datastoreURL string) bool {
+	return (l.StoragePolicyName == "" || l.StoragePolicyName == storagePolicyName) &&
+		(l.DatastoreURL == "" || l.DatastoreURL == datastoreURL)
+}
+
+// CnsStorageQuotaSpec defines the desired state of CnsStorageQuota
+// +k8s:openapi-gen=true
+type CnsStorageQuotaSpec struct {
+	// Limits are the budgets of capacity of the volumes of the namespace.
+	Limits []CnsStorageQuotaLimit `json:"limits"`
+}
+
+// CnsStorageQuotaUsage is the capacity used by the volumes of the namespace a
+// limit applies to.
+// +k8s:openapi-gen=true
+type CnsStorageQuotaUsage struct {
+	// StoragePolicyName and DatastoreURL identify the limit.
+	StoragePolicyName string `json:"storagePolicyName,omitempty"`
+	DatastoreURL      string `json:"datastoreURL,omitempty"`
+
+	// UsedInMb is the total capacity of the CNS volumes of the namespace the
+	// limit applies to.
+	UsedInMb int64 `json:"usedInMb"`
+}
+
+// CnsStorageQuotaStatus defines the observed state of CnsStorageQuota
+// +k8s:openapi-gen=true
+type CnsStorageQuotaStatus struct {
+	// LastSyncTime is the time the usage was last computed.
+	LastSyncTime *metav1.Time `json:"lastSyncTime,omitempty"`
+
+	// Usage is the capacity used for each of the limits.
+	Usage []CnsStorageQuotaUsage `json:"usage,omitempty"`
+
+	// Error is the error of the last sync, if any.
+	Error string `json:"error,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// CnsStorageQuota is the Schema for the cnsstoragequotas API
+// +k8s:openapi-gen=true
+type CnsStorageQuota struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CnsStorageQuotaSpec   `json:"spec,omitempty"`
+	Status CnsStorageQuotaStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// CnsStorageQuotaList contains a list of CnsStorageQuota
+type CnsStorageQuotaList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CnsStorageQuota `json:"items"`
+}
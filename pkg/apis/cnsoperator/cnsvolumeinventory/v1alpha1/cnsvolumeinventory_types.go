@@ -0,0 +1,90 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CnsVolumeInventoryCRName is the name of the instance the inventory of the
+// volumes is exported to.
+const CnsVolumeInventoryCRName = "volume-inventory"
+
+// CnsVolumeInventoryEntry is a volume of the inventory.
+// +k8s:openapi-gen=true
+type CnsVolumeInventoryEntry struct {
+	// VolumeID is the ID of the CNS volume, the volume handle of the PV.
+	VolumeID string `json:"volumeID"`
+
+	// VolumeType is the type of the volume, BLOCK or FILE.
+	VolumeType string `json:"volumeType"`
+
+	// PVName is the name of the PV of the volume, if any.
+	PVName string `json:"pvName,omitempty"`
+
+	// Namespace and PVCName are the namespace and the name of the PVC bound to
+	// the PV, if any.
+	Namespace string `json:"namespace,omitempty"`
+	PVCName   string `json:"pvcName,omitempty"`
+
+	// CapacityInMb is the capacity of the volume.
+	CapacityInMb int64 `json:"capacityInMb"`
+
+	// DatastoreURL is the URL of the datastore of the volume.
+	DatastoreURL string `json:"datastoreURL,omitempty"`
+
+	// StoragePolicyID and StoragePolicyName identify the storage policy of the
+	// volume.
+	StoragePolicyID   string `json:"storagePolicyID,omitempty"`
+	StoragePolicyName string `json:"storagePolicyName,omitempty"`
+
+	// HealthStatus is the health status of the volume reported by CNS.
+	HealthStatus string `json:"healthStatus,omitempty"`
+}
+
+// CnsVolumeInventoryStatus defines the observed state of CnsVolumeInventory
+// +k8s:openapi-gen=true
+type CnsVolumeInventoryStatus struct {
+	// LastExportTime is the time the inventory was last exported.
+	LastExportTime *metav1.Time `json:"lastExportTime,omitempty"`
+
+	// Volumes are the volumes of the cluster managed by the driver.
+	Volumes []CnsVolumeInventoryEntry `json:"volumes,omitempty"`
+
+	// Error is the error of the last export, if any.
+	Error string `json:"error,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// CnsVolumeInventory is the Schema for the cnsvolumeinventories API
+// +k8s:openapi-gen=true
+type CnsVolumeInventory struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Status CnsVolumeInventoryStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// CnsVolumeInventoryList contains a list of CnsVolumeInventory
+type CnsVolumeInventoryList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CnsVolumeInventory `json:"items"`
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// ConditionReplicating is True when the volume is in the replication group
+	// of the spec.
+	ConditionReplicating = "Replicating"
+	// ConditionSynced is True when the replication group of the volume reported
+	// no fault at the last check, at least every RPO.
+	ConditionSynced = "Synced"
+
+	// ReplicationStatePrimary is the replication state of the volume at the
+	// source site of its replication group.
+	ReplicationStatePrimary = "Primary"
+	// ReplicationStateSecondary is the replication state of the volume at the
+	// target site of its replication group.
+	ReplicationStateSecondary = "Secondary"
+)
+
+// CnsVolumeReplicationSpec defines the desired state of CnsVolumeReplication
+// +k8s:openapi-gen=true
+type CnsVolumeReplicationSpec struct {
+	// PvcName is the name of the bound PVC, in the namespace of the
+	// CnsVolumeReplication, whose volume is replicated.
+	PvcName string `json:"pvcName"`
+
+	// StoragePolicyName is the name of the replication-capable storage policy
+	// applied to the volume, such as a vVol policy with array-based replication.
+	StoragePolicyName string `json:"storagePolicyName"`
+
+	// TargetSite is the ID of the fault domain of the target site the volume is
+	// replicated to.
+	TargetSite string `json:"targetSite"`
+
+	// ReplicationGroupID is the ID of the replication group of the storage
+	// array the volume is added to, whose RPO and target site must match the
+	// spec. SRM protects the volume with the replication group.
+	ReplicationGroupID string `json:"replicationGroupID"`
+
+	// RPOMinutes is the recovery point objective of the volume, between 5 and
+	// 1440 minutes. The replication state of the volume is checked at least
+	// every RPO.
+	RPOMinutes int `json:"rpoMinutes"`
+
+	// ReplicationState is the desired replication state of the volume at this
+	// site, Primary (default) or Secondary. Demoting a Primary volume prepares
+	// its replication group for a planned failover. Promoting a Secondary
+	// volume fails over its replication group to this site and binds the
+	// recovered disk to the PVC.
+	ReplicationState string `json:"replicationState,omitempty"`
+}
+
+// CnsVolumeReplicationStatus defines the observed state of CnsVolumeReplication
+// +k8s:openapi-gen=true
+type CnsVolumeReplicationStatus struct {
+	// VolumeID is the ID of the FCD of the PVC.
+	VolumeID string `json:"volumeID,omitempty"`
+
+	// ReplicationState is the replication state of the volume at this site.
+	ReplicationState string `json:"replicationState,omitempty"`
+
+	// LastSyncCheckTime is the time the replication state of the volume was
+	// last checked.
+	LastSyncCheckTime *metav1.Time `json:"lastSyncCheckTime,omitempty"`
+
+	// Conditions are the Replicating and Synced conditions of the volume.
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// CnsVolumeReplication is the Schema for the cnsvolumereplications API
+// +k8s:openapi-gen=true
+type CnsVolumeReplication struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CnsVolumeReplicationSpec   `json:"spec,omitempty"`
+	Status CnsVolumeReplicationStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// CnsVolumeReplicationList contains a list of CnsVolumeReplication
+type CnsVolumeReplicationList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CnsVolumeReplication `json:"items"`
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CnsVolumeSourceSpec defines the disk the volumes of the PVCs referencing the
+// CnsVolumeSource in their dataSource are populated from.
+// +k8s:openapi-gen=true
+type CnsVolumeSourceSpec struct {
+	// VolumeID is the ID of the volume of a PV bound to a PVC the populated
+	// volumes are cloned from. The PVC is checked like PersistentVolumeClaim.
+	// Only one of VolumeID, DiskURLPath and PersistentVolumeClaim can be specified.
+	VolumeID string `json:"volumeID,omitempty"`
+
+	// DiskURLPath is the URL path to an existing virtual disk, such as a disk of a
+	// VM exported to an OVA and uploaded to a datastore.
+	// DiskURLPath is not supported, as a virtual disk has no owner to check the
+	// PVCs are allowed to read it: the PVCs referring to it aren't populated.
+	// Only one of VolumeID, DiskURLPath and PersistentVolumeClaim can be specified.
+	// This field must be in the following format:
+	// Format:
+	// https://<vc_ip>/folder/<vm_vmdk_path>?dcPath=<datacenterName>&dsName=<datastoreName>
+	// Ex: https://10.192.255.221/folder/images/ubuntu-disk1.vmdk?dcPath=Datacenter-1&dsName=vsanDatastore
+	// This is for a images/ubuntu-disk1.vmdk
+	// file under datacenter "Datacenter-1" and datastore "vsanDatastore".
+	DiskURLPath string `json:"diskURLPath,omitempty"`
+
+	// PersistentVolumeClaim is a bound PVC, such as a golden image, whose volume
+	// the populated volumes are cloned from.
+	// A PVC in another namespace can only be cloned if a ReferenceGrant in its
+	// namespace allows PersistentVolumeClaims of the namespace of the
+	// CnsVolumeSource to refer to it.
+	// Only one of VolumeID, DiskURLPath and PersistentVolumeClaim can be specified.
+	PersistentVolumeClaim *CnsVolumeSourcePVCReference `json:"persistentVolumeClaim,omitempty"`
+}
+
+// CnsVolumeSourcePVCReference refers to a PVC, possibly in another namespace.
+// +k8s:openapi-gen=true
+type CnsVolumeSourcePVCReference struct {
+	// Name is the name of the PVC.
+	Name string `json:"name"`
+
+	// Namespace is the namespace of the PVC. Defaults to the namespace of the
+	// CnsVolumeSource.
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// CnsVolumeSource is the Schema for the cnsvolumesources API
+// +k8s:openapi-gen=true
+type CnsVolumeSource struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec CnsVolumeSourceSpec `json:"spec,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// CnsVolumeSourceList contains a list of CnsVolumeSource
+type CnsVolumeSourceList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CnsVolumeSource `json:"items"`
+}
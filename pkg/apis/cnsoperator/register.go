@@ -28,7 +28,11 @@ import (
 	cnsfileaccessconfigv1alpha1 "sigs.k8s.io/vsphere-csi-driver/pkg/apis/cnsoperator/cnsfileaccessconfig/v1alpha1"
 	cnsnodevmattachmentv1alpha1 "sigs.k8s.io/vsphere-csi-driver/pkg/apis/cnsoperator/cnsnodevmattachment/v1alpha1"
 	cnsregistervolumev1alpha1 "sigs.k8s.io/vsphere-csi-driver/pkg/apis/cnsoperator/cnsregistervolume/v1alpha1"
+	cnsstoragequotav1alpha1 "sigs.k8s.io/vsphere-csi-driver/pkg/apis/cnsoperator/cnsstoragequota/v1alpha1"
+	cnsvolumeinventoryv1alpha1 "sigs.k8s.io/vsphere-csi-driver/pkg/apis/cnsoperator/cnsvolumeinventory/v1alpha1"
 	cnsvolumemetadatav1alpha1 "sigs.k8s.io/vsphere-csi-driver/pkg/apis/cnsoperator/cnsvolumemetadata/v1alpha1"
+	cnsvolumereplicationv1alpha1 "sigs.k8s.io/vsphere-csi-driver/pkg/apis/cnsoperator/cnsvolumereplication/v1alpha1"
+	cnsvolumesourcev1alpha1 "sigs.k8s.io/vsphere-csi-driver/pkg/apis/cnsoperator/cnsvolumesource/v1alpha1"
 )
 
 // GroupName represents the group for cns operator apis
@@ -52,6 +56,16 @@ var (
 	CnsRegisterVolumePlural = "cnsregistervolumes"
 	// CnsFileAccessConfigPlural is plural of CnsFileAccessConfig
 	CnsFileAccessConfigPlural = "cnsfileaccessconfigs"
+	// CnsVolumeSourcePlural is plural of CnsVolumeSource
+	CnsVolumeSourcePlural = "cnsvolumesources"
+	// CnsVolumeSourceKind is the kind of CnsVolumeSource
+	CnsVolumeSourceKind = "CnsVolumeSource"
+	// CnsVolumeReplicationPlural is plural of CnsVolumeReplication
+	CnsVolumeReplicationPlural = "cnsvolumereplications"
+	// CnsVolumeInventoryPlural is plural of CnsVolumeInventory
+	CnsVolumeInventoryPlural = "cnsvolumeinventories"
+	// CnsStorageQuotaPlural is plural of CnsStorageQuota
+	CnsStorageQuotaPlural = "cnsstoragequotas"
 )
 
 var (
@@ -98,6 +112,30 @@ func addKnownTypes(scheme *runtime.Scheme) error {
 		&cnsnodevmattachmentv1alpha1.CnsNodeVmAttachmentList{},
 	)
 
+	scheme.AddKnownTypes(
+		SchemeGroupVersion,
+		&cnsvolumesourcev1alpha1.CnsVolumeSource{},
+		&cnsvolumesourcev1alpha1.CnsVolumeSourceList{},
+	)
+
+	scheme.AddKnownTypes(
+		SchemeGroupVersion,
+		&cnsvolumereplicationv1alpha1.CnsVolumeReplication{},
+		&cnsvolumereplicationv1alpha1.CnsVolumeReplicationList{},
+	)
+
+	scheme.AddKnownTypes(
+		SchemeGroupVersion,
+		&cnsvolumeinventoryv1alpha1.CnsVolumeInventory{},
+		&cnsvolumeinventoryv1alpha1.CnsVolumeInventoryList{},
+	)
+
+	scheme.AddKnownTypes(
+		SchemeGroupVersion,
+		&cnsstoragequotav1alpha1.CnsStorageQuota{},
+		&cnsstoragequotav1alpha1.CnsStorageQuotaList{},
+	)
+
 	scheme.AddKnownTypes(
 		SchemeGroupVersion,
 		&metav1.Status{},
@@ -0,0 +1,235 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package backup is the API backup plugins, such as Velero plugins, use to back
+// up the block volumes of the vSphere CSI driver natively: it resolves the FCD
+// of a PVC, snapshots the FCD, queries the blocks changed since a previous
+// backup and returns the hooks freezing the filesystem of the volume in the
+// pods using it while the FCD is snapshotted.
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+
+	volumes "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/volume"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/common"
+	csitypes "sigs.k8s.io/vsphere-csi-driver/pkg/csi/types"
+)
+
+// AllChangedBlocks is the change ID to pass to QueryChangedBlocks to get all
+// the allocated blocks of the volume, for full backups.
+const AllChangedBlocks = "*"
+
+// Volume is the FCD of a PVC.
+type Volume struct {
+	// VolumeID is the ID of the FCD, the volume handle of the PV.
+	VolumeID string
+	// PVName is the name of the PV bound to the PVC.
+	PVName string
+	// Block is true if the PVC is a raw block volume.
+	Block bool
+	// FsType is the filesystem of the volume, empty for raw block volumes.
+	FsType string
+}
+
+// Hook is a command to run in a container with the volume mounted, like the
+// exec hooks of Velero.
+type Hook struct {
+	Namespace string
+	Pod       string
+	Container string
+	// Freeze freezes the filesystem of the volume, run it before the snapshot.
+	Freeze []string
+	// Thaw thaws the filesystem of the volume, run it after the snapshot.
+	Thaw []string
+}
+
+// Extent is an area of the volume, in bytes.
+type Extent struct {
+	Offset int64
+	Length int64
+}
+
+// ChangedBlocks are the changed areas of the volume in the area from
+// StartOffset of length Length. Query the next areas from StartOffset+Length
+// while it is less than the capacity of the volume.
+type ChangedBlocks struct {
+	StartOffset int64
+	Length      int64
+	Extents     []Extent
+}
+
+// Manager is the interface backup plugins coordinate with the driver through.
+type Manager interface {
+	// GetVolume returns the FCD of the bound PVC.
+	GetVolume(ctx context.Context, namespace string, pvcName string) (*Volume, error)
+	// GetFreezeHooks returns the hooks freezing the filesystem of the PVC, one
+	// per running pod mounting it read-write.
+	GetFreezeHooks(ctx context.Context, namespace string, pvcName string) ([]Hook, error)
+	// EnableChangedBlockTracking enables changed block tracking on the FCD
+	// volumeID, which QueryChangedBlocks requires. Enable it before taking the
+	// snapshot of the first backup, the blocks changed before are unknown.
+	EnableChangedBlockTracking(ctx context.Context, volumeID string) error
+	// CreateSnapshot snapshots the FCD volumeID and returns the handle of the
+	// snapshot, the same as the snapshot handle of a VolumeSnapshotContent. The
+	// snapshot is described with name, and a retry with the same name returns
+	// the snapshot already created for it.
+	CreateSnapshot(ctx context.Context, volumeID string, name string) (string, error)
+	// DeleteSnapshot deletes the snapshot with the given handle, it succeeds if
+	// the snapshot doesn't exist.
+	DeleteSnapshot(ctx context.Context, snapshotHandle string) error
+	// QueryChangedBlocks returns the areas of the FCD, from startOffset, which
+	// changed between the change ID changeID and the snapshot with the given
+	// handle. Use AllChangedBlocks as changeID for full backups.
+	QueryChangedBlocks(ctx context.Context, snapshotHandle string, startOffset int64,
+		changeID string) (*ChangedBlocks, error)
+}
+
+type defaultManager struct {
+	k8sClient     clientset.Interface
+	volumeManager volumes.Manager
+}
+
+// NewManager returns a Manager reading PVCs with k8sClient and managing the
+// FCDs with volumeManager.
+func NewManager(k8sClient clientset.Interface, volumeManager volumes.Manager) Manager {
+	return &defaultManager{
+		k8sClient:     k8sClient,
+		volumeManager: volumeManager,
+	}
+}
+
+func (m *defaultManager) GetVolume(ctx context.Context, namespace string, pvcName string) (*Volume, error) {
+	pvc, err := m.k8sClient.CoreV1().PersistentVolumeClaims(namespace).Get(ctx, pvcName, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if pvc.Status.Phase != v1.ClaimBound || pvc.Spec.VolumeName == "" {
+		return nil, fmt.Errorf("PVC %s/%s is not bound", namespace, pvcName)
+	}
+	pv, err := m.k8sClient.CoreV1().PersistentVolumes().Get(ctx, pvc.Spec.VolumeName, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != csitypes.Name {
+		return nil, fmt.Errorf("PV %s of PVC %s/%s is not provisioned by %s", pv.Name, namespace, pvcName, csitypes.Name)
+	}
+	if pv.Spec.CSI.VolumeAttributes[common.AttributeDiskType] == common.DiskTypeFileVolume {
+		return nil, fmt.Errorf("PV %s of PVC %s/%s is a file volume, which isn't backed by an FCD",
+			pv.Name, namespace, pvcName)
+	}
+	volume := &Volume{
+		VolumeID: pv.Spec.CSI.VolumeHandle,
+		PVName:   pv.Name,
+		Block:    pv.Spec.VolumeMode != nil && *pv.Spec.VolumeMode == v1.PersistentVolumeBlock,
+	}
+	if !volume.Block {
+		volume.FsType = pv.Spec.CSI.FSType
+	}
+	return volume, nil
+}
+
+func (m *defaultManager) GetFreezeHooks(ctx context.Context, namespace string, pvcName string) ([]Hook, error) {
+	pods, err := m.k8sClient.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	var hooks []Hook
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != v1.PodRunning {
+			continue
+		}
+		for _, volume := range pod.Spec.Volumes {
+			if volume.PersistentVolumeClaim == nil || volume.PersistentVolumeClaim.ClaimName != pvcName {
+				continue
+			}
+			if hook := getFreezeHook(&pod, volume.Name); hook != nil {
+				hooks = append(hooks, *hook)
+			}
+		}
+	}
+	return hooks, nil
+}
+
+// getFreezeHook returns the hook freezing the filesystem of the pod volume
+// volumeName in the first container mounting it read-write, if any. The
+// filesystem is frozen for all the containers of the node at once.
+func getFreezeHook(pod *v1.Pod, volumeName string) *Hook {
+	for _, container := range pod.Spec.Containers {
+		for _, mount := range container.VolumeMounts {
+			if mount.Name != volumeName || mount.ReadOnly {
+				continue
+			}
+			return &Hook{
+				Namespace: pod.Namespace,
+				Pod:       pod.Name,
+				Container: container.Name,
+				Freeze:    []string{"/sbin/fsfreeze", "--freeze", mount.MountPath},
+				Thaw:      []string{"/sbin/fsfreeze", "--unfreeze", mount.MountPath},
+			}
+		}
+	}
+	return nil
+}
+
+func (m *defaultManager) EnableChangedBlockTracking(ctx context.Context, volumeID string) error {
+	return m.volumeManager.EnableChangedBlockTracking(ctx, volumeID)
+}
+
+func (m *defaultManager) CreateSnapshot(ctx context.Context, volumeID string, name string) (string, error) {
+	snapshot, err := m.volumeManager.CreateSnapshot(ctx, volumeID, name)
+	if err != nil {
+		return "", err
+	}
+	return common.NewSnapshotID(volumeID, snapshot.SnapshotID), nil
+}
+
+func (m *defaultManager) DeleteSnapshot(ctx context.Context, snapshotHandle string) error {
+	volumeID, snapshotID, err := common.ParseSnapshotID(snapshotHandle)
+	if err != nil {
+		return err
+	}
+	return m.volumeManager.DeleteSnapshot(ctx, volumeID, snapshotID)
+}
+
+func (m *defaultManager) QueryChangedBlocks(ctx context.Context, snapshotHandle string, startOffset int64,
+	changeID string) (*ChangedBlocks, error) {
+	volumeID, snapshotID, err := common.ParseSnapshotID(snapshotHandle)
+	if err != nil {
+		return nil, err
+	}
+	if changeID == "" {
+		return nil, errors.New("changeID must be specified, use AllChangedBlocks for full backups")
+	}
+	changeInfo, err := m.volumeManager.QueryChangedDiskAreas(ctx, volumeID, snapshotID, startOffset, changeID)
+	if err != nil {
+		return nil, err
+	}
+	changedBlocks := &ChangedBlocks{
+		StartOffset: changeInfo.StartOffset,
+		Length:      changeInfo.Length,
+	}
+	for _, area := range changeInfo.ChangedArea {
+		changedBlocks.Extents = append(changedBlocks.Extents, Extent{Offset: area.Start, Length: area.Length})
+	}
+	return changedBlocks, nil
+}
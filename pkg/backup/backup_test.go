@@ -0,0 +1,165 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backup
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	cnstypes "github.com/vmware/govmomi/cns/types"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"sigs.k8s.io/vsphere-csi-driver/pkg/common/unittestcommon"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/common"
+	csitypes "sigs.k8s.io/vsphere-csi-driver/pkg/csi/types"
+)
+
+// TestSnapshots checks that the snapshot handles are the CSI snapshot IDs,
+// and that the changed blocks are only queried once changed block tracking is
+// enabled.
+func TestSnapshots(t *testing.T) {
+	ctx := context.Background()
+	volumeManager := unittestcommon.NewFakeVolumeManager()
+	volumeInfo, err := volumeManager.CreateVolume(ctx, &cnstypes.CnsVolumeCreateSpec{
+		Name:       "pvc-1",
+		VolumeType: common.BlockVolumeType,
+		BackingObjectDetails: &cnstypes.CnsBlockBackingDetails{
+			CnsBackingObjectDetails: cnstypes.CnsBackingObjectDetails{CapacityInMb: 1},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	volumeID := volumeInfo.VolumeID.Id
+	m := NewManager(fake.NewSimpleClientset(), volumeManager)
+
+	handle, err := m.CreateSnapshot(ctx, volumeID, "backup-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshotVolumeID, _, err := common.ParseSnapshotID(handle); err != nil || snapshotVolumeID != volumeID {
+		t.Fatalf("expected the handle of a snapshot of volume %s, got %q, err: %v", volumeID, handle, err)
+	}
+	if retried, err := m.CreateSnapshot(ctx, volumeID, "backup-1"); err != nil || retried != handle {
+		t.Fatalf("expected the retry to return snapshot %q, got %q, err: %v", handle, retried, err)
+	}
+
+	if _, err := m.QueryChangedBlocks(ctx, handle, 0, AllChangedBlocks); err == nil {
+		t.Fatal("expected an error without changed block tracking")
+	}
+	if err := m.EnableChangedBlockTracking(ctx, volumeID); err != nil {
+		t.Fatal(err)
+	}
+	changedBlocks, err := m.QueryChangedBlocks(ctx, handle, 0, AllChangedBlocks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &ChangedBlocks{Length: common.MbInBytes, Extents: []Extent{{Length: common.MbInBytes}}}
+	if !reflect.DeepEqual(changedBlocks, expected) {
+		t.Fatalf("expected changed blocks %+v, got %+v", expected, changedBlocks)
+	}
+
+	if err := m.DeleteSnapshot(ctx, handle); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.QueryChangedBlocks(ctx, handle, 0, AllChangedBlocks); err == nil {
+		t.Fatal("expected an error for a deleted snapshot")
+	}
+	if err := m.DeleteSnapshot(ctx, "vol-1"); err == nil {
+		t.Fatal("expected an error for an invalid snapshot handle")
+	}
+}
+
+func TestGetVolume(t *testing.T) {
+	ctx := context.Background()
+	pvc := &v1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "data", Namespace: "db"},
+		Spec:       v1.PersistentVolumeClaimSpec{VolumeName: "pvc-1"},
+		Status:     v1.PersistentVolumeClaimStatus{Phase: v1.ClaimBound},
+	}
+	pv := &v1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "pvc-1"},
+		Spec: v1.PersistentVolumeSpec{
+			PersistentVolumeSource: v1.PersistentVolumeSource{
+				CSI: &v1.CSIPersistentVolumeSource{
+					Driver:       csitypes.Name,
+					VolumeHandle: "fcd-1",
+					FSType:       "ext4",
+				},
+			},
+		},
+	}
+	m := NewManager(fake.NewSimpleClientset(pvc, pv), nil)
+	volume, err := m.GetVolume(ctx, "db", "data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := (&Volume{VolumeID: "fcd-1", PVName: "pvc-1", FsType: "ext4"}); !reflect.DeepEqual(volume, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, volume)
+	}
+
+	pv.Spec.CSI.Driver = "other.csi.driver"
+	m = NewManager(fake.NewSimpleClientset(pvc, pv), nil)
+	if _, err := m.GetVolume(ctx, "db", "data"); err == nil {
+		t.Fatal("expected an error for a PV of another driver")
+	}
+}
+
+func TestGetFreezeHooks(t *testing.T) {
+	ctx := context.Background()
+	newPod := func(name string, phase v1.PodPhase, claimName string, readOnly bool) *v1.Pod {
+		return &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "db"},
+			Spec: v1.PodSpec{
+				Volumes: []v1.Volume{{
+					Name: "data",
+					VolumeSource: v1.VolumeSource{
+						PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: claimName},
+					},
+				}},
+				Containers: []v1.Container{
+					{Name: "sidecar"},
+					{Name: "db", VolumeMounts: []v1.VolumeMount{{Name: "data", MountPath: "/var/lib/db", ReadOnly: readOnly}}},
+				},
+			},
+			Status: v1.PodStatus{Phase: phase},
+		}
+	}
+	m := NewManager(fake.NewSimpleClientset(
+		newPod("db-0", v1.PodRunning, "data", false),
+		newPod("db-pending", v1.PodPending, "data", false),
+		newPod("reader", v1.PodRunning, "data", true),
+		newPod("other", v1.PodRunning, "other", false),
+	), nil)
+	hooks, err := m.GetFreezeHooks(ctx, "db", "data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Hook{{
+		Namespace: "db",
+		Pod:       "db-0",
+		Container: "db",
+		Freeze:    []string{"/sbin/fsfreeze", "--freeze", "/var/lib/db"},
+		Thaw:      []string{"/sbin/fsfreeze", "--unfreeze", "/var/lib/db"},
+	}}
+	if !reflect.DeepEqual(hooks, expected) {
+		t.Fatalf("expected hooks %+v, got %+v", expected, hooks)
+	}
+}
@@ -19,10 +19,12 @@ package node
 import (
 	"context"
 	"errors"
+	"strings"
 	"sync"
 
 	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
 
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	clientset "k8s.io/client-go/kubernetes"
 	"sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/vsphere"
 	k8s "sigs.k8s.io/vsphere-csi-driver/pkg/kubernetes"
@@ -54,8 +56,25 @@ type Manager interface {
 	// nodes. If nodes are added or removed concurrently, they may or may not be
 	// reflected in the result of a call to this method.
 	GetAllNodes(ctx context.Context) ([]*vsphere.VirtualMachine, error)
+	// GetAllNodesByName refreshes and returns VirtualMachine for all registered
+	// nodes whose VM is found, keyed by node name.
+	GetAllNodesByName(ctx context.Context) (map[string]*vsphere.VirtualMachine, error)
 	// UnregisterNode unregisters a registered node given its name.
 	UnregisterNode(ctx context.Context, nodeName string) error
+	// SetUUIDStore sets the store mirroring the UUIDs of discovered node VMs,
+	// and loads the UUIDs it holds for nodes not registered yet.
+	SetUUIDStore(ctx context.Context, store UUIDStore) error
+}
+
+// UUIDStore persists the UUIDs of the VMs discovered for nodes, so that they
+// are known without searching vCenter when the node manager starts again.
+type UUIDStore interface {
+	// Load returns the node UUIDs held by the store, keyed by node name.
+	Load(ctx context.Context) (map[string]string, error)
+	// Store records the UUID of the VM discovered for the node.
+	Store(ctx context.Context, nodeName string, nodeUUID string) error
+	// Delete removes the UUID recorded for the node.
+	Delete(ctx context.Context, nodeName string) error
 }
 
 // Metadata represents node metadata.
@@ -89,6 +108,8 @@ type defaultManager struct {
 	nodeNameToUUID sync.Map
 	// k8s client
 	k8sClient clientset.Interface
+	// uuidStore mirrors the UUIDs of discovered node VMs, may be nil.
+	uuidStore UUIDStore
 }
 
 // SetKubernetesClient sets specified kubernetes client to defaultManager.k8sClient
@@ -96,20 +117,116 @@ func (m *defaultManager) SetKubernetesClient(client clientset.Interface) {
 	m.k8sClient = client
 }
 
+// SetUUIDStore sets the store mirroring node UUIDs and loads the UUIDs it
+// holds for nodes not registered yet. The UUIDs of nodes deleted while no
+// node manager was running are deleted from the store instead.
+func (m *defaultManager) SetUUIDStore(ctx context.Context, store UUIDStore) error {
+	log := logger.GetLogger(ctx)
+	m.uuidStore = store
+	nodeUUIDs, err := store.Load(ctx)
+	if err != nil {
+		log.Errorf("failed to load node UUIDs from the store. err: %v", err)
+		return err
+	}
+	if m.k8sClient != nil {
+		nodeList, err := m.k8sClient.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+		if err != nil {
+			log.Warnf("failed to list nodes, not pruning the store. err: %v", err)
+		} else {
+			existingNodes := make(map[string]bool)
+			for _, node := range nodeList.Items {
+				existingNodes[node.Name] = true
+			}
+			for nodeName := range nodeUUIDs {
+				if existingNodes[nodeName] {
+					continue
+				}
+				delete(nodeUUIDs, nodeName)
+				if err := store.Delete(ctx, nodeName); err != nil {
+					log.Warnf("failed to delete nodeUUID of deleted node: %q from the store. err: %v", nodeName, err)
+				} else {
+					log.Infof("Deleted nodeUUID of deleted node: %q from the store", nodeName)
+				}
+			}
+		}
+	}
+	for nodeName, nodeUUID := range nodeUUIDs {
+		if _, loaded := m.nodeNameToUUID.LoadOrStore(nodeName, nodeUUID); !loaded {
+			log.Infof("Loaded nodeUUID %q for node: %q from the store", nodeUUID, nodeName)
+		}
+	}
+	return nil
+}
+
 // RegisterNode registers a node with node manager using its UUID, name.
+// vCenter isn't searched again if the VM of the node was already discovered
+// with the same UUID, e.g. when the node objects are re-listed. If nodeUUID
+// is empty, the UUID previously discovered for the node is used.
 func (m *defaultManager) RegisterNode(ctx context.Context, nodeUUID string, nodeName string) error {
 	log := logger.GetLogger(ctx)
+	nodeUUID = strings.ToLower(nodeUUID)
+	if prevUUIDInf, found := m.nodeNameToUUID.Load(nodeName); found && prevUUIDInf.(string) != "" {
+		prevUUID := prevUUIDInf.(string)
+		if nodeUUID == "" {
+			log.Infof("Empty nodeUUID for the node: %q, using nodeUUID %q registered before", nodeName, prevUUID)
+			nodeUUID = prevUUID
+		}
+		if prevUUID == nodeUUID || prevUUID == swapUUIDByteOrder(nodeUUID) {
+			if _, discovered := m.nodeVMs.Load(prevUUID); discovered {
+				log.Debugf("Node: %q with nodeUUID %q is already discovered", nodeName, prevUUID)
+				return nil
+			}
+		} else {
+			m.nodeVMs.Delete(prevUUID)
+		}
+	}
 	m.nodeNameToUUID.Store(nodeName, nodeUUID)
 	log.Infof("Successfully registered node: %q with nodeUUID %q", nodeName, nodeUUID)
+	if nodeUUID == "" {
+		log.Errorf("failed to discover VM for node: %q with empty nodeUUID", nodeName)
+		return ErrNodeNotFound
+	}
 	err := m.DiscoverNode(ctx, nodeUUID)
+	if err == vsphere.ErrVMNotFound {
+		// The system UUID of VMs with older hardware versions is reported with
+		// the byte order of its first three fields swapped.
+		swappedUUID := swapUUIDByteOrder(nodeUUID)
+		log.Infof("VM with nodeUUID %q wasn't found for node: %q, trying nodeUUID %q", nodeUUID, nodeName, swappedUUID)
+		if err = m.DiscoverNode(ctx, swappedUUID); err == nil {
+			nodeUUID = swappedUUID
+			m.nodeNameToUUID.Store(nodeName, nodeUUID)
+		}
+	}
 	if err != nil {
 		log.Errorf("failed to discover VM with uuid: %q for node: %q", nodeUUID, nodeName)
 		return err
 	}
 	log.Infof("Successfully discovered node: %q with nodeUUID %q", nodeName, nodeUUID)
+	if m.uuidStore != nil {
+		if err := m.uuidStore.Store(ctx, nodeName, nodeUUID); err != nil {
+			log.Warnf("failed to store nodeUUID %q for node: %q. err: %v", nodeUUID, nodeName, err)
+		}
+	}
 	return nil
 }
 
+// swapUUIDByteOrder returns the UUID with the byte order of its first three
+// fields swapped, or the UUID unchanged if it isn't well formed.
+func swapUUIDByteOrder(uuid string) string {
+	fields := strings.Split(uuid, "-")
+	if len(fields) != 5 || len(fields[0]) != 8 || len(fields[1]) != 4 || len(fields[2]) != 4 {
+		return uuid
+	}
+	for i := 0; i < 3; i++ {
+		swapped := make([]byte, 0, len(fields[i]))
+		for j := len(fields[i]); j > 0; j -= 2 {
+			swapped = append(swapped, fields[i][j-2:j]...)
+		}
+		fields[i] = string(swapped)
+	}
+	return strings.Join(fields, "-")
+}
+
 // DiscoverNode discovers a registered node given its UUID from vCenter.
 // If node is not found in the vCenter for the given UUID, for ErrVMNotFound is returned to the caller
 func (m *defaultManager) DiscoverNode(ctx context.Context, nodeUUID string) error {
@@ -188,6 +305,34 @@ func (m *defaultManager) GetNode(ctx context.Context, nodeUUID string, dc *vsphe
 	return vm, nil
 }
 
+// GetAllNodesByName refreshes and returns VirtualMachine for all registered
+// nodes whose VM is found, keyed by node name.
+func (m *defaultManager) GetAllNodesByName(ctx context.Context) (map[string]*vsphere.VirtualMachine, error) {
+	log := logger.GetLogger(ctx)
+	vms := make(map[string]*vsphere.VirtualMachine)
+	var err error
+	m.nodeNameToUUID.Range(func(nodeNameInf, nodeUUIDInf interface{}) bool {
+		nodeName := nodeNameInf.(string)
+		var vm *vsphere.VirtualMachine
+		vm, err = m.GetNodeByName(ctx, nodeName)
+		if err == vsphere.ErrVMNotFound || err == ErrNodeNotFound {
+			log.Warnf("VM of node %q not found, skipping it", nodeName)
+			err = nil
+			return true
+		}
+		if err != nil {
+			log.Errorf("failed to get VM of node %q, aborting get all nodes by name. err: %v", nodeName, err)
+			return false
+		}
+		vms[nodeName] = vm
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return vms, nil
+}
+
 // GetAllNodes refreshes and returns VirtualMachine for all registered nodes.
 func (m *defaultManager) GetAllNodes(ctx context.Context) ([]*vsphere.VirtualMachine, error) {
 	log := logger.GetLogger(ctx)
@@ -256,6 +401,13 @@ func (m *defaultManager) GetAllNodes(ctx context.Context) ([]*vsphere.VirtualMac
 // UnregisterNode unregisters a registered node given its name.
 func (m *defaultManager) UnregisterNode(ctx context.Context, nodeName string) error {
 	log := logger.GetLogger(ctx)
+	// The node may be in the store even if it was never registered, e.g. when
+	// its VM wasn't discovered.
+	if m.uuidStore != nil {
+		if err := m.uuidStore.Delete(ctx, nodeName); err != nil {
+			log.Warnf("failed to delete nodeUUID of node: %q from the store. err: %v", nodeName, err)
+		}
+	}
 	nodeUUID, found := m.nodeNameToUUID.Load(nodeName)
 	if !found {
 		log.Errorf("Node wasn't found, failed to unregister node: %q  err: %v", nodeName)
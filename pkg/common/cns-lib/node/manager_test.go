@@ -0,0 +1,125 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package node
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/vsphere"
+)
+
+// fakeUUIDStore is a UUIDStore keeping node UUIDs in memory.
+type fakeUUIDStore struct {
+	nodeUUIDs map[string]string
+}
+
+func (s *fakeUUIDStore) Load(ctx context.Context) (map[string]string, error) {
+	return s.nodeUUIDs, nil
+}
+
+func (s *fakeUUIDStore) Store(ctx context.Context, nodeName string, nodeUUID string) error {
+	s.nodeUUIDs[nodeName] = nodeUUID
+	return nil
+}
+
+func (s *fakeUUIDStore) Delete(ctx context.Context, nodeName string) error {
+	delete(s.nodeUUIDs, nodeName)
+	return nil
+}
+
+func TestSwapUUIDByteOrder(t *testing.T) {
+	tests := map[string]string{
+		"4237a1b2-c3d4-e5f6-0718-293a4b5c6d7e": "b2a13742-d4c3-f6e5-0718-293a4b5c6d7e",
+		"not-a-uuid":                           "not-a-uuid",
+		"":                                     "",
+	}
+	for uuid, expected := range tests {
+		if swapped := swapUUIDByteOrder(uuid); swapped != expected {
+			t.Errorf("expected %q for %q, got %q", expected, uuid, swapped)
+		}
+	}
+}
+
+func TestRegisterDiscoveredNode(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := &defaultManager{nodeVMs: sync.Map{}}
+	store := &fakeUUIDStore{nodeUUIDs: map[string]string{"node1": "4237a1b2-c3d4-e5f6-0718-293a4b5c6d7e"}}
+	if err := m.SetUUIDStore(ctx, store); err != nil {
+		t.Fatal(err)
+	}
+	// The VM of the node was discovered before, registering the node again
+	// with the same UUID, or without UUID, must not search vCenter.
+	m.nodeVMs.Store("4237a1b2-c3d4-e5f6-0718-293a4b5c6d7e", &vsphere.VirtualMachine{})
+	for _, nodeUUID := range []string{"4237A1B2-C3D4-E5F6-0718-293A4B5C6D7E", "b2a13742-d4c3-f6e5-0718-293a4b5c6d7e", ""} {
+		if err := m.RegisterNode(ctx, nodeUUID, "node1"); err != nil {
+			t.Errorf("failed to register node with nodeUUID %q. err: %v", nodeUUID, err)
+		}
+	}
+	if nodeUUID, _ := m.nodeNameToUUID.Load("node1"); nodeUUID != "4237a1b2-c3d4-e5f6-0718-293a4b5c6d7e" {
+		t.Errorf("expected nodeUUID loaded from the store, got %v", nodeUUID)
+	}
+
+	if err := m.UnregisterNode(ctx, "node1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, found := store.nodeUUIDs["node1"]; found {
+		t.Errorf("expected nodeUUID to be deleted from the store")
+	}
+	if err := m.RegisterNode(ctx, "", "node1"); err != ErrNodeNotFound {
+		t.Errorf("expected ErrNodeNotFound registering node without UUID, got %v", err)
+	}
+}
+
+func TestSetUUIDStorePrunesDeletedNodes(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := &defaultManager{nodeVMs: sync.Map{}}
+	m.SetKubernetesClient(fake.NewSimpleClientset(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}))
+	// node2 was deleted while no node manager was running.
+	store := &fakeUUIDStore{nodeUUIDs: map[string]string{
+		"node1": "4237a1b2-c3d4-e5f6-0718-293a4b5c6d7e",
+		"node2": "42370000-c3d4-e5f6-0718-293a4b5c6d7e",
+	}}
+	if err := m.SetUUIDStore(ctx, store); err != nil {
+		t.Fatal(err)
+	}
+	if _, found := store.nodeUUIDs["node2"]; found {
+		t.Errorf("expected nodeUUID of the deleted node to be deleted from the store")
+	}
+	if _, found := m.nodeNameToUUID.Load("node2"); found {
+		t.Errorf("expected nodeUUID of the deleted node not to be loaded")
+	}
+	if _, found := m.nodeNameToUUID.Load("node1"); !found {
+		t.Errorf("expected nodeUUID of the existing node to be loaded")
+	}
+
+	// The store entry of a node that was never registered is deleted too.
+	store.nodeUUIDs["node3"] = "42371111-c3d4-e5f6-0718-293a4b5c6d7e"
+	if err := m.UnregisterNode(ctx, "node3"); err != ErrNodeNotFound {
+		t.Errorf("expected ErrNodeNotFound unregistering unknown node, got %v", err)
+	}
+	if _, found := store.nodeUUIDs["node3"]; found {
+		t.Errorf("expected nodeUUID of the unregistered node to be deleted from the store")
+	}
+}
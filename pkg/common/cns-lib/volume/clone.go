@@ -0,0 +1,141 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	cnstypes "github.com/vmware/govmomi/cns/types"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/task"
+	"github.com/vmware/govmomi/vim25/soap"
+	vim25types "github.com/vmware/govmomi/vim25/types"
+
+	"sigs.k8s.io/vsphere-csi-driver/pkg/common/prometheus"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
+)
+
+// VolumeCloneError is returned when vCenter fails to clone the FCD of a
+// volume for a reason other than a lack of space on the datastore, which is
+// returned as an InsufficientSpaceError.
+type VolumeCloneError struct {
+	// Volume is the name of the volume to create.
+	Volume string
+	// SourceVolumeID is the ID of the volume being cloned.
+	SourceVolumeID string
+	// SourceNotFound is set when the FCD of the source volume doesn't exist.
+	SourceNotFound bool
+	// Busy is set when the source volume is busy with another task, such as
+	// a snapshot, and the clone is expected to succeed once it completes.
+	Busy bool
+	// Fault is the message of the fault vCenter failed the clone with.
+	Fault string
+}
+
+func (e *VolumeCloneError) Error() string {
+	return fmt.Sprintf("failed to clone volume %q to volume %q. fault: %s", e.SourceVolumeID, e.Volume, e.Fault)
+}
+
+// getCloneError returns the error err of the clone of the volume
+// sourceVolumeID to the volume name of requiredMB as an InsufficientSpaceError
+// or a VolumeCloneError if it is a vCenter fault, or err otherwise.
+func getCloneError(name string, sourceVolumeID string, requiredMB int64, err error) error {
+	var taskErr task.Error
+	if errors.As(err, &taskErr) {
+		return getCloneFaultError(name, sourceVolumeID, requiredMB, taskErr.LocalizedMethodFault)
+	}
+	if soap.IsSoapFault(err) {
+		if _, ok := soap.ToSoapFault(err).VimFault().(vim25types.NotFound); ok {
+			return &VolumeCloneError{Volume: name, SourceVolumeID: sourceVolumeID, SourceNotFound: true,
+				Fault: err.Error()}
+		}
+	}
+	return err
+}
+
+// getCloneFaultError returns the fault the task cloning the volume
+// sourceVolumeID to the volume name of requiredMB failed with as an
+// InsufficientSpaceError or a VolumeCloneError.
+func getCloneFaultError(name string, sourceVolumeID string, requiredMB int64,
+	fault *vim25types.LocalizedMethodFault) error {
+	if isSpaceFault, datastore := isInsufficientSpaceFault(fault); isSpaceFault {
+		return &InsufficientSpaceError{
+			Volume:     name,
+			Datastore:  datastore,
+			RequiredMB: requiredMB,
+			FreeMB:     -1,
+			Fault:      fault.LocalizedMessage,
+		}
+	}
+	cloneErr := &VolumeCloneError{Volume: name, SourceVolumeID: sourceVolumeID}
+	if fault == nil || fault.Fault == nil {
+		return cloneErr
+	}
+	cloneErr.Fault = fault.LocalizedMessage
+	switch fault.Fault.(type) {
+	case *vim25types.NotFound:
+		cloneErr.SourceNotFound = true
+	case *vim25types.TaskInProgress, *vim25types.InvalidState, *vim25types.FileLocked, *vim25types.ResourceInUse:
+		cloneErr.Busy = true
+	}
+	return cloneErr
+}
+
+// CloneVolume creates the block volume of the spec as a clone of the block
+// volume sourceVolumeID: the FCD of the source is cloned, with the storage
+// policy of the spec, registered as the volume and expanded to the capacity of
+// the spec if the source is smaller. The FCD is created on the first
+// datastore of the spec, or on the datastore of the source if it has none.
+// The task cloning the FCD is persisted under the name of the spec, so that a
+// retry registers the FCD already cloned instead of cloning it again.
+func (m *defaultManager) CloneVolume(ctx context.Context, spec *cnstypes.CnsVolumeCreateSpec,
+	sourceVolumeID string) (*CnsVolumeInfo, error) {
+	log := logger.GetLogger(ctx)
+	ds, err := m.getVolumeDatastore(ctx, sourceVolumeID)
+	if err != nil {
+		return nil, getCloneError(spec.Name, sourceVolumeID, 0, err)
+	}
+	target := ds
+	if len(spec.Datastores) > 0 {
+		target = spec.Datastores[0]
+	}
+	err = m.virtualCenter.Connect(ctx)
+	if err != nil {
+		log.Errorf("failed to connect to vCenter %q with err: %v", m.virtualCenter.Config.Host, err)
+		return nil, err
+	}
+	diskID, err := m.createDisk(ctx, prometheus.PrometheusCnsCloneVolumeOpType, spec.Name,
+		fmt.Sprintf("volume %q", sourceVolumeID), func() (*object.Task, error) {
+			return CloneDisk(ctx, m.virtualCenter.Client.Client, ds, sourceVolumeID, target, spec.Name, spec.Profile)
+		})
+	if err != nil {
+		var capacityInMb int64
+		if spec.BackingObjectDetails != nil {
+			capacityInMb = spec.BackingObjectDetails.GetCnsBackingObjectDetails().CapacityInMb
+		}
+		return nil, getCloneError(spec.Name, sourceVolumeID, capacityInMb, err)
+	}
+	volumeInfo, err := m.registerDisk(ctx, spec, diskID)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("CloneVolume: Created volume %q as a clone of volume %q on datastore %v", diskID, sourceVolumeID,
+		target)
+	return volumeInfo, nil
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/vmware/govmomi/task"
+	vim25types "github.com/vmware/govmomi/vim25/types"
+)
+
+func TestGetCloneError(t *testing.T) {
+	taskError := func(fault vim25types.BaseMethodFault) error {
+		return task.Error{LocalizedMethodFault: &vim25types.LocalizedMethodFault{Fault: fault, LocalizedMessage: "fault"}}
+	}
+	otherErr := errors.New("connection refused")
+	tests := []struct {
+		err            error
+		insufficient   bool
+		sourceNotFound bool
+		busy           bool
+		other          bool
+	}{
+		{err: taskError(&vim25types.NoDiskSpace{Datastore: "ds"}), insufficient: true},
+		{err: taskError(&vim25types.InsufficientStorageSpace{}), insufficient: true},
+		{err: taskError(&vim25types.NotFound{}), sourceNotFound: true},
+		{err: taskError(&vim25types.TaskInProgress{}), busy: true},
+		{err: taskError(&vim25types.FileLocked{}), busy: true},
+		{err: taskError(&vim25types.InvalidArgument{})},
+		{err: otherErr, other: true},
+	}
+	for _, test := range tests {
+		err := getCloneError("vol", "source", 1024, test.err)
+		var spaceErr *InsufficientSpaceError
+		var cloneErr *VolumeCloneError
+		switch {
+		case test.insufficient:
+			if !errors.As(err, &spaceErr) || spaceErr.RequiredMB != 1024 {
+				t.Errorf("expected InsufficientSpaceError of 1024 MB for %v, got %v", test.err, err)
+			}
+		case test.other:
+			if err != test.err {
+				t.Errorf("expected %v to be returned unchanged, got %v", test.err, err)
+			}
+		default:
+			if !errors.As(err, &cloneErr) || cloneErr.SourceNotFound != test.sourceNotFound ||
+				cloneErr.Busy != test.busy {
+				t.Errorf("expected VolumeCloneError with SourceNotFound %v and Busy %v for %v, got %+v",
+					test.sourceNotFound, test.busy, test.err, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,187 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"context"
+	"fmt"
+
+	cnstypes "github.com/vmware/govmomi/cns/types"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/units"
+	"github.com/vmware/govmomi/vim25/mo"
+	vim25types "github.com/vmware/govmomi/vim25/types"
+
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
+)
+
+// InsufficientSpaceError is returned when CNS fails to create or expand a
+// volume because its datastore doesn't have enough free space.
+type InsufficientSpaceError struct {
+	// Volume is the name of the volume to create or the ID of the volume to expand.
+	Volume string
+	// Datastore is the name of the datastore, or its URL if the name is unknown.
+	Datastore string
+	// RequiredMB is the space the operation needed on the datastore.
+	RequiredMB int64
+	// FreeMB is the free space of the datastore, or -1 if it is unknown.
+	FreeMB int64
+	// Fault is the message of the fault CNS failed the operation with.
+	Fault string
+}
+
+// ShortfallMB returns how much space the datastore lacks for the operation,
+// or 0 if it is unknown.
+func (e *InsufficientSpaceError) ShortfallMB() int64 {
+	if e.FreeMB < 0 || e.RequiredMB <= e.FreeMB {
+		return 0
+	}
+	return e.RequiredMB - e.FreeMB
+}
+
+func (e *InsufficientSpaceError) Error() string {
+	datastore := e.Datastore
+	if datastore == "" {
+		datastore = "unknown"
+	}
+	if shortfall := e.ShortfallMB(); shortfall > 0 {
+		return fmt.Sprintf("not enough space on datastore %q for volume %q: %d MB required, %d MB free, "+
+			"short of %d MB. fault: %s", datastore, e.Volume, e.RequiredMB, e.FreeMB, shortfall, e.Fault)
+	}
+	return fmt.Sprintf("not enough space on datastore %q for volume %q: %d MB required. fault: %s",
+		datastore, e.Volume, e.RequiredMB, e.Fault)
+}
+
+// isInsufficientSpaceFault returns if the fault reports a datastore running
+// out of space, and the name of the datastore if the fault has it.
+func isInsufficientSpaceFault(fault *vim25types.LocalizedMethodFault) (bool, string) {
+	if fault == nil || fault.Fault == nil {
+		return false, ""
+	}
+	switch f := fault.Fault.(type) {
+	case *vim25types.NoDiskSpace:
+		return true, f.Datastore
+	case *vim25types.InsufficientStorageSpace:
+		return true, ""
+	}
+	return false, ""
+}
+
+// getCreateInsufficientSpaceError returns an InsufficientSpaceError if the
+// create volume task failed for lack of space, or nil otherwise. The datastore
+// is taken from the placement results of the task when CNS reports them.
+func (m *defaultManager) getCreateInsufficientSpaceError(ctx context.Context, volumeName string, requiredMB int64,
+	taskResult cnstypes.BaseCnsVolumeOperationResult) *InsufficientSpaceError {
+	log := logger.GetLogger(ctx)
+	fault := taskResult.GetCnsVolumeOperationResult().Fault
+	isSpaceFault, datastore := isInsufficientSpaceFault(fault)
+	var datastoreRef *vim25types.ManagedObjectReference
+	if createResult, ok := taskResult.(*cnstypes.CnsVolumeCreateResult); ok {
+		for _, placementResult := range createResult.PlacementResults {
+			for _, placementFault := range placementResult.PlacementFaults {
+				if ok, name := isInsufficientSpaceFault(placementFault); ok {
+					isSpaceFault = true
+					if datastore == "" {
+						datastore = name
+					}
+					ref := placementResult.Datastore
+					datastoreRef = &ref
+					break
+				}
+			}
+			if datastoreRef != nil {
+				break
+			}
+		}
+	}
+	if !isSpaceFault {
+		return nil
+	}
+	spaceErr := &InsufficientSpaceError{
+		Volume:     volumeName,
+		Datastore:  datastore,
+		RequiredMB: requiredMB,
+		FreeMB:     -1,
+		Fault:      fault.LocalizedMessage,
+	}
+	if datastoreRef != nil && datastoreRef.Value != "" {
+		var dsMo mo.Datastore
+		pc := property.DefaultCollector(m.virtualCenter.Client.Client)
+		if err := pc.RetrieveOne(ctx, *datastoreRef, []string{"summary"}, &dsMo); err != nil {
+			log.Warnf("failed to retrieve summary of datastore %v to report its free space. err: %v", datastoreRef, err)
+		} else {
+			spaceErr.Datastore = dsMo.Summary.Name
+			spaceErr.FreeMB = dsMo.Summary.FreeSpace / int64(units.MB)
+		}
+	}
+	return spaceErr
+}
+
+// getExpandInsufficientSpaceError returns an InsufficientSpaceError if the
+// extend volume task failed for lack of space, or nil otherwise. The datastore
+// and the current size of the volume are looked up in CNS.
+func (m *defaultManager) getExpandInsufficientSpaceError(ctx context.Context, volumeID string, sizeMB int64,
+	fault *vim25types.LocalizedMethodFault) *InsufficientSpaceError {
+	log := logger.GetLogger(ctx)
+	isSpaceFault, datastore := isInsufficientSpaceFault(fault)
+	if !isSpaceFault {
+		return nil
+	}
+	spaceErr := &InsufficientSpaceError{
+		Volume:     volumeID,
+		Datastore:  datastore,
+		RequiredMB: sizeMB,
+		FreeMB:     -1,
+		Fault:      fault.LocalizedMessage,
+	}
+	queryFilter := cnstypes.CnsQueryFilter{
+		VolumeIds: []cnstypes.CnsVolumeId{{Id: volumeID}},
+	}
+	queryResult, err := m.virtualCenter.CnsClient.QueryVolume(ctx, queryFilter)
+	if err != nil || len(queryResult.Volumes) == 0 {
+		log.Warnf("failed to query volume %q to report the free space of its datastore. err: %v", volumeID, err)
+		return spaceErr
+	}
+	volume := queryResult.Volumes[0]
+	if volume.BackingObjectDetails != nil {
+		// Only the growth of the volume needs free space.
+		spaceErr.RequiredMB = sizeMB - volume.BackingObjectDetails.GetCnsBackingObjectDetails().CapacityInMb
+	}
+	if volume.DatastoreUrl == "" {
+		return spaceErr
+	}
+	if spaceErr.Datastore == "" {
+		spaceErr.Datastore = volume.DatastoreUrl
+	}
+	datacenters, err := m.virtualCenter.GetDatacenters(ctx)
+	if err != nil {
+		log.Warnf("failed to get datacenters to report the free space of datastore %q. err: %v", volume.DatastoreUrl, err)
+		return spaceErr
+	}
+	for _, dc := range datacenters {
+		summaries, err := dc.GetAllDatastoreSummaries(ctx)
+		if err != nil {
+			continue
+		}
+		if summary, ok := summaries[volume.DatastoreUrl]; ok {
+			spaceErr.Datastore = summary.Name
+			spaceErr.FreeMB = summary.FreeSpace / int64(units.MB)
+			break
+		}
+	}
+	return spaceErr
+}
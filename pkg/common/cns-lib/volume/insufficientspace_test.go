@@ -0,0 +1,58 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"strings"
+	"testing"
+
+	vim25types "github.com/vmware/govmomi/vim25/types"
+)
+
+func TestIsInsufficientSpaceFault(t *testing.T) {
+	tests := []struct {
+		fault     *vim25types.LocalizedMethodFault
+		expected  bool
+		datastore string
+	}{
+		{nil, false, ""},
+		{&vim25types.LocalizedMethodFault{Fault: &vim25types.NoDiskSpace{Datastore: "ds1"}}, true, "ds1"},
+		{&vim25types.LocalizedMethodFault{Fault: &vim25types.InsufficientStorageSpace{}}, true, ""},
+		{&vim25types.LocalizedMethodFault{Fault: &vim25types.NotFound{}}, false, ""},
+	}
+	for _, test := range tests {
+		ok, datastore := isInsufficientSpaceFault(test.fault)
+		if ok != test.expected || datastore != test.datastore {
+			t.Errorf("expected %v and datastore %q for fault %+v, got %v and %q",
+				test.expected, test.datastore, test.fault, ok, datastore)
+		}
+	}
+}
+
+func TestInsufficientSpaceError(t *testing.T) {
+	err := &InsufficientSpaceError{Volume: "pvc-1", Datastore: "ds1", RequiredMB: 1024, FreeMB: 256}
+	if err.ShortfallMB() != 768 {
+		t.Errorf("expected shortfall of 768 MB, got %d", err.ShortfallMB())
+	}
+	if !strings.Contains(err.Error(), "short of 768 MB") {
+		t.Errorf("expected error to report the shortfall, got %q", err.Error())
+	}
+	err.FreeMB = -1
+	if err.ShortfallMB() != 0 {
+		t.Errorf("expected unknown shortfall with unknown free space, got %d", err.ShortfallMB())
+	}
+}
@@ -27,7 +27,6 @@ import (
 	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
 
 	"github.com/davecgh/go-spew/spew"
-	"github.com/vmware/govmomi/cns"
 	cnstypes "github.com/vmware/govmomi/cns/types"
 	"github.com/vmware/govmomi/object"
 	"github.com/vmware/govmomi/property"
@@ -36,6 +35,7 @@ import (
 	"github.com/vmware/govmomi/vslm"
 
 	cnsvsphere "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/vsphere"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/internalapis/cnsvolumeoperationrequest"
 )
 
 const (
@@ -85,6 +85,27 @@ type Manager interface {
 	RegisterDisk(ctx context.Context, path string, name string) (string, error)
 	// RetrieveVStorageObject helps in retreiving virtual disk information for a given volume id
 	RetrieveVStorageObject(ctx context.Context, volumeID string) (*vim25types.VStorageObject, error)
+	// SetOperationStore sets the store persisting the CNS tasks invoked to create and attach volumes and to create
+	// snapshots, so that the tasks still running after a restart are waited for instead of being invoked again.
+	SetOperationStore(store cnsvolumeoperationrequest.VolumeOperationRequest)
+	// CreateSnapshot creates a snapshot of the block volume for the request with the given name, or returns the
+	// snapshot already created for it.
+	CreateSnapshot(ctx context.Context, volumeID string, name string) (*CnsSnapshotInfo, error)
+	// DeleteSnapshot deletes a snapshot of the block volume, it succeeds if the snapshot doesn't exist.
+	DeleteSnapshot(ctx context.Context, volumeID string, snapshotID string) error
+	// QuerySnapshots returns the snapshots of the block volume.
+	QuerySnapshots(ctx context.Context, volumeID string) ([]CnsSnapshotInfo, error)
+	// CreateVolumeFromSnapshot creates the block volume of the spec from a snapshot of another block volume.
+	CreateVolumeFromSnapshot(ctx context.Context, spec *cnstypes.CnsVolumeCreateSpec, snapshotVolumeID string,
+		snapshotID string) (*CnsVolumeInfo, error)
+	// EnableChangedBlockTracking enables changed block tracking on the block volume, if it isn't enabled yet.
+	EnableChangedBlockTracking(ctx context.Context, volumeID string) error
+	// QueryChangedDiskAreas returns the areas of the block volume, from startOffset, which changed between the
+	// change ID changeID and a snapshot of the volume. Changed block tracking must be enabled on the volume.
+	QueryChangedDiskAreas(ctx context.Context, volumeID string, snapshotID string, startOffset int64,
+		changeID string) (*vim25types.DiskChangeInfo, error)
+	// CloneVolume creates the block volume of the spec as a clone of another block volume.
+	CloneVolume(ctx context.Context, spec *cnstypes.CnsVolumeCreateSpec, sourceVolumeID string) (*CnsVolumeInfo, error)
 }
 
 // CnsVolumeInfo hold information related to volume created by CNS
@@ -99,6 +120,10 @@ var (
 	// managerInstanceLock is used for mitigating race condition during read/write on manager instance.
 	managerInstanceLock sync.Mutex
 	volumeTaskMap       = make(map[string]*createVolumeTaskDetails)
+	// expandLocks has a mutex per volume ID, held while looking for the task
+	// of an expand in progress and invoking a new one, so that concurrent
+	// expands of a volume don't both invoke a task.
+	expandLocks sync.Map
 )
 
 // createVolumeTaskDetails contains taskInfo object and expiration time
@@ -124,9 +149,34 @@ func GetManager(ctx context.Context, vc *cnsvsphere.VirtualCenter) Manager {
 	return managerInstance
 }
 
+// NewManager returns a Manager of the volumes of vc which, unlike the one returned
+// by GetManager, isn't shared. It is meant for the vCenters other than the one of
+// the singleton, it persists CNS tasks to the operation store of the singleton.
+func NewManager(ctx context.Context, vc *cnsvsphere.VirtualCenter) Manager {
+	log := logger.GetLogger(ctx)
+	managerInstanceLock.Lock()
+	defer managerInstanceLock.Unlock()
+	log.Infof("Initializing new volume.defaultManager for vCenter %q", vc.Config.Host)
+	m := &defaultManager{
+		virtualCenter: vc,
+	}
+	if managerInstance != nil {
+		m.operationStore = managerInstance.operationStore
+	}
+	return m
+}
+
 // DefaultManager provides functionality to manage volumes.
 type defaultManager struct {
 	virtualCenter *cnsvsphere.VirtualCenter
+	// operationStore persists the CNS tasks invoked to create and attach
+	// volumes. Optional.
+	operationStore cnsvolumeoperationrequest.VolumeOperationRequest
+	// queryAsyncLock protects queryAsyncUnsupportedRelease.
+	queryAsyncLock sync.Mutex
+	// queryAsyncUnsupportedRelease is the vCenter release (About.FullName) found to reject
+	// CnsQueryAsync although its version should support it.
+	queryAsyncUnsupportedRelease string
 }
 
 // ClearTaskInfoObjects is a go routine which runs in the background to clean up expired taskInfo objects from volumeTaskMap
@@ -158,7 +208,8 @@ func (m *defaultManager) ResetManager(ctx context.Context, vcenter *cnsvsphere.V
 	if vcenter.Config.Host != managerInstance.virtualCenter.Config.Host {
 		log.Infof("Re-initializing volume.defaultManager")
 		managerInstance = &defaultManager{
-			virtualCenter: vcenter,
+			virtualCenter:  vcenter,
+			operationStore: m.operationStore,
 		}
 	}
 	m.virtualCenter.Config = vcenter.Config
@@ -169,8 +220,14 @@ func (m *defaultManager) ResetManager(ctx context.Context, vcenter *cnsvsphere.V
 	log.Infof("Done resetting volume.defaultManager")
 }
 
+// SetOperationStore sets the store persisting the CNS tasks invoked to create and attach volumes.
+func (m *defaultManager) SetOperationStore(store cnsvolumeoperationrequest.VolumeOperationRequest) {
+	m.operationStore = store
+}
+
 // CreateVolume creates a new volume given its spec.
 func (m *defaultManager) CreateVolume(ctx context.Context, spec *cnstypes.CnsVolumeCreateSpec) (*CnsVolumeInfo, error) {
+	defer InvalidateQueryResultCache(ctx)
 	internalCreateVolume := func() (*CnsVolumeInfo, error) {
 		log := logger.GetLogger(ctx)
 		err := validateManager(ctx, m)
@@ -198,14 +255,57 @@ func (m *defaultManager) CreateVolume(ctx context.Context, spec *cnstypes.CnsVol
 		var cnsCreateSpecList []cnstypes.CnsVolumeCreateSpec
 		var task *object.Task
 		var taskInfo *vim25types.TaskInfo
+		var op *operation
 		// store the volume name passed in by input spec, this name may exceed 80 characters
 		volNameFromInputSpec := spec.Name
+		var isStaticallyProvisionedBlockVolume bool
+		var isStaticallyProvisionedFileVolume bool
+		if spec.VolumeType == string(cnstypes.CnsVolumeTypeBlock) {
+			blockBackingDetails, ok := spec.BackingObjectDetails.(*cnstypes.CnsBlockBackingDetails)
+			if ok && (blockBackingDetails.BackingDiskId != "" || blockBackingDetails.BackingDiskUrlPath != "") {
+				isStaticallyProvisionedBlockVolume = true
+			}
+		}
+		if spec.VolumeType == string(cnstypes.CnsVolumeTypeFile) {
+			fileBackingDetails, ok := spec.BackingObjectDetails.(*cnstypes.CnsVsanFileShareBackingDetails)
+			if ok && fileBackingDetails.BackingFileId != "" {
+				isStaticallyProvisionedFileVolume = true
+			}
+		}
+		// For static volume provisioning we need not track the task as it doesn't result in orphaned volumes
+		isDynamicallyProvisioned := !isStaticallyProvisionedBlockVolume && !isStaticallyProvisionedFileVolume
 		// Call the CNS CreateVolume
 		taskDetailsInMap, ok := volumeTaskMap[volNameFromInputSpec]
 		if ok {
 			task = taskDetailsInMap.task
 			log.Infof("CreateVolume task still pending for VolumeName: %q, with taskInfo: %+v", volNameFromInputSpec, task)
-		} else {
+		} else if isDynamicallyProvisioned {
+			// Look for the task of a CreateVolume invoked before a restart.
+			details := m.getPersistedOperation(ctx, volNameFromInputSpec)
+			if details != nil && details.OperationDetails.TaskStatus == taskInvocationStatusSuccess && details.VolumeID != "" {
+				// The volume may have been deleted since, it is created again then.
+				exists, err := m.volumeExists(ctx, details.VolumeID)
+				if err != nil {
+					log.Errorf("CreateVolume: failed to query volume %q created for %q. err: %v",
+						details.VolumeID, volNameFromInputSpec, err)
+					return nil, err
+				}
+				if exists {
+					log.Infof("CreateVolume: Volume %q was already created with volumeID: %q", volNameFromInputSpec, details.VolumeID)
+					return &CnsVolumeInfo{
+						DatastoreURL: "",
+						VolumeID:     cnstypes.CnsVolumeId{Id: details.VolumeID},
+					}, nil
+				}
+				log.Infof("CreateVolume: Volume %q created with volumeID: %q doesn't exist anymore, creating it again",
+					volNameFromInputSpec, details.VolumeID)
+			}
+			op = m.getInProgressTask(ctx, details)
+			if op != nil {
+				task = op.task
+			}
+		}
+		if task == nil {
 			// truncate the volume name to make sure the name is within 80 characters before calling CNS
 			if len(spec.Name) > maxLengthOfVolumeNameInCNS {
 				volNameAfterTruncate := spec.Name[0 : maxLengthOfVolumeNameInCNS-1]
@@ -216,42 +316,31 @@ func (m *defaultManager) CreateVolume(ctx context.Context, spec *cnstypes.CnsVol
 			cnsCreateSpecList = append(cnsCreateSpecList, *spec)
 			task, err = m.virtualCenter.CnsClient.CreateVolume(ctx, cnsCreateSpecList)
 			if err != nil {
+				countFaultOfError(prometheus.PrometheusCnsCreateVolumeOpType, err)
 				log.Errorf("CNS CreateVolume failed from vCenter %q with err: %v", m.virtualCenter.Config.Host, err)
 				return nil, err
 			}
-			var isStaticallyProvisionedBlockVolume bool
-			var isStaticallyProvisionedFileVolume bool
-			if spec.VolumeType == string(cnstypes.CnsVolumeTypeBlock) {
-				blockBackingDetails, ok := spec.BackingObjectDetails.(*cnstypes.CnsBlockBackingDetails)
-				if ok && (blockBackingDetails.BackingDiskId != "" || blockBackingDetails.BackingDiskUrlPath != "") {
-					isStaticallyProvisionedBlockVolume = true
-				}
-			}
-			if spec.VolumeType == string(cnstypes.CnsVolumeTypeFile) {
-				fileBackingDetails, ok := spec.BackingObjectDetails.(*cnstypes.CnsVsanFileShareBackingDetails)
-				if ok && fileBackingDetails.BackingFileId != "" {
-					isStaticallyProvisionedFileVolume = true
-				}
-			}
-			// Add the task details to volumeTaskMap only for dynamically provisioned volumes.
-			// For static volume provisioning we need not store the taskDetails as it doesn't result in orphaned volumes
-			if !isStaticallyProvisionedBlockVolume && !isStaticallyProvisionedFileVolume {
-				var taskDetails createVolumeTaskDetails
-				// Store the task details and task object expiration time in volumeTaskMap
-				taskDetails.task = task
-				taskDetails.expirationTime = time.Now().Add(time.Hour * time.Duration(defaultOpsExpirationTimeInHours))
-				volumeTaskMap[volNameFromInputSpec] = &taskDetails
+			if isDynamicallyProvisioned {
+				op = m.newOperation(ctx, volNameFromInputSpec, task)
 			}
 		}
+		// Add the task details to volumeTaskMap only for dynamically provisioned volumes.
+		if !ok && isDynamicallyProvisioned {
+			var taskDetails createVolumeTaskDetails
+			// Store the task details and task object expiration time in volumeTaskMap
+			taskDetails.task = task
+			taskDetails.expirationTime = time.Now().Add(time.Hour * time.Duration(defaultOpsExpirationTimeInHours))
+			volumeTaskMap[volNameFromInputSpec] = &taskDetails
+		}
 		// Get the taskInfo
-		taskInfo, err = cns.GetTaskInfo(ctx, task)
+		taskInfo, err = waitForTask(ctx, prometheus.PrometheusCnsCreateVolumeOpType, task)
 		if err != nil || taskInfo == nil {
 			log.Errorf("failed to get taskInfo for CreateVolume task from vCenter %q with err: %v", m.virtualCenter.Config.Host, err)
 			return nil, err
 		}
 		log.Infof("CreateVolume: VolumeName: %q, opId: %q", volNameFromInputSpec, taskInfo.ActivationId)
 		// Get the taskResult
-		taskResult, err := cns.GetTaskResult(ctx, taskInfo)
+		taskResult, err := getTaskResult(ctx, prometheus.PrometheusCnsCreateVolumeOpType, taskInfo)
 
 		if err != nil {
 			log.Errorf("unable to find the task result for CreateVolume task from vCenter %q. taskID: %q, opId: %q createResults: %+v",
@@ -268,6 +357,7 @@ func (m *defaultManager) CreateVolume(ctx context.Context, spec *cnstypes.CnsVol
 			fault, ok := volumeOperationRes.Fault.Fault.(cnstypes.CnsAlreadyRegisteredFault)
 			if ok {
 				log.Infof("CreateVolume: Volume is already registered with CNS. VolumeName: %q, volumeID: %q, opId: %q", spec.Name, fault.VolumeId.Id, taskInfo.ActivationId)
+				m.storeOperation(ctx, op, fault.VolumeId.Id, taskInfo.ActivationId, taskInvocationStatusSuccess, "")
 				return &CnsVolumeInfo{
 					DatastoreURL: "",
 					VolumeID:     fault.VolumeId,
@@ -284,6 +374,15 @@ func (m *defaultManager) CreateVolume(ctx context.Context, spec *cnstypes.CnsVol
 			}
 			msg := fmt.Sprintf("failed to create cns volume %s. createSpec: %q, fault: %q, opId: %q", volNameFromInputSpec, spew.Sdump(spec), spew.Sdump(volumeOperationRes.Fault), taskInfo.ActivationId)
 			log.Error(msg)
+			m.storeOperation(ctx, op, "", taskInfo.ActivationId, taskInvocationStatusError, msg)
+			var capacityInMb int64
+			if spec.BackingObjectDetails != nil {
+				capacityInMb = spec.BackingObjectDetails.GetCnsBackingObjectDetails().CapacityInMb
+			}
+			if spaceErr := m.getCreateInsufficientSpaceError(ctx, volNameFromInputSpec, capacityInMb, taskResult); spaceErr != nil {
+				log.Errorf("CreateVolume: %v", spaceErr)
+				return nil, spaceErr
+			}
 			return nil, errors.New(msg)
 		}
 		var datastoreURL string
@@ -309,6 +408,7 @@ func (m *defaultManager) CreateVolume(ctx context.Context, spec *cnstypes.CnsVol
 		}
 
 		log.Infof("CreateVolume: Volume created successfully. VolumeName: %q, opId: %q, volumeID: %q", volNameFromInputSpec, taskInfo.ActivationId, volumeOperationRes.VolumeId.Id)
+		m.storeOperation(ctx, op, volumeOperationRes.VolumeId.Id, taskInfo.ActivationId, taskInvocationStatusSuccess, "")
 		log.Debugf("CreateVolume volumeId %q is placed on datastore %q", volumeOperationRes.VolumeId.Id, datastoreURL)
 		return &CnsVolumeInfo{
 			DatastoreURL: datastoreURL,
@@ -330,6 +430,7 @@ func (m *defaultManager) CreateVolume(ctx context.Context, spec *cnstypes.CnsVol
 
 // AttachVolume attaches a volume to a virtual machine given the spec.
 func (m *defaultManager) AttachVolume(ctx context.Context, vm *cnsvsphere.VirtualMachine, volumeID string) (string, error) {
+	defer InvalidateQueryResultCache(ctx)
 	internalAttachVolume := func() (string, error) {
 		log := logger.GetLogger(ctx)
 		err := validateManager(ctx, m)
@@ -351,21 +452,34 @@ func (m *defaultManager) AttachVolume(ctx context.Context, vm *cnsvsphere.Virtua
 			Vm: vm.Reference(),
 		}
 		cnsAttachSpecList = append(cnsAttachSpecList, cnsAttachSpec)
-		// Call the CNS AttachVolume
-		task, err := m.virtualCenter.CnsClient.AttachVolume(ctx, cnsAttachSpecList)
-		if err != nil {
-			log.Errorf("CNS AttachVolume failed from vCenter %q with err: %v", m.virtualCenter.Config.Host, err)
-			return "", err
+		// Look for the task of an AttachVolume invoked before a restart.
+		opName := attachOperationName(volumeID, vm)
+		op := m.getInProgressTask(ctx, m.getPersistedOperation(ctx, opName))
+		var task *object.Task
+		if op != nil {
+			task = op.task
+		} else {
+			// Call the CNS AttachVolume
+			task, err = m.virtualCenter.CnsClient.AttachVolume(ctx, cnsAttachSpecList)
+			if err != nil {
+				countFaultOfError(prometheus.PrometheusCnsAttachVolumeOpType, err)
+				log.Errorf("CNS AttachVolume failed from vCenter %q with err: %v", m.virtualCenter.Config.Host, err)
+				if isVMBusyError(err) {
+					return "", &VMBusyError{Operation: "attach", Volume: volumeID, VM: vm.String(), Fault: err.Error()}
+				}
+				return "", err
+			}
+			op = m.newOperation(ctx, opName, task)
 		}
 		// Get the taskInfo
-		taskInfo, err := cns.GetTaskInfo(ctx, task)
+		taskInfo, err := waitForTask(ctx, prometheus.PrometheusCnsAttachVolumeOpType, task)
 		if err != nil || taskInfo == nil {
 			log.Errorf("failed to get taskInfo for AttachVolume task from vCenter %q with err: %v", m.virtualCenter.Config.Host, err)
 			return "", err
 		}
 		log.Infof("AttachVolume: volumeID: %q, vm: %q, opId: %q", volumeID, vm.String(), taskInfo.ActivationId)
 		// Get the taskResult
-		taskResult, err := cns.GetTaskResult(ctx, taskInfo)
+		taskResult, err := getTaskResult(ctx, prometheus.PrometheusCnsAttachVolumeOpType, taskInfo)
 		if err != nil {
 			log.Errorf("unable to find the task result for AttachVolume task from vCenter %q with taskID %s and attachResults %v",
 				m.virtualCenter.Config.Host, taskInfo.Task.Value, taskResult)
@@ -388,15 +502,22 @@ func (m *defaultManager) AttachVolume(ctx context.Context, vm *cnsvsphere.Virtua
 					return "", err
 				}
 				if diskUUID != "" {
+					m.storeOperation(ctx, op, volumeID, taskInfo.ActivationId, taskInvocationStatusSuccess, "")
 					return diskUUID, nil
 				}
 			}
 			msg := fmt.Sprintf("failed to attach cns volume: %q to node vm: %q. fault: %q. opId: %q", volumeID, vm.String(), spew.Sdump(volumeOperationRes.Fault), taskInfo.ActivationId)
 			log.Error(msg)
+			m.storeOperation(ctx, op, volumeID, taskInfo.ActivationId, taskInvocationStatusError, msg)
+			if isVMBusyFault(volumeOperationRes.Fault) {
+				return "", &VMBusyError{Operation: "attach", Volume: volumeID, VM: vm.String(),
+					Fault: volumeOperationRes.Fault.LocalizedMessage}
+			}
 			return "", errors.New(msg)
 		}
 		diskUUID := interface{}(taskResult).(*cnstypes.CnsVolumeAttachResult).DiskUUID
 		log.Infof("AttachVolume: Volume attached successfully. volumeID: %q, opId: %q, vm: %q, diskUUID: %q", volumeID, taskInfo.ActivationId, vm.String(), diskUUID)
+		m.storeOperation(ctx, op, volumeID, taskInfo.ActivationId, taskInvocationStatusSuccess, "")
 		return diskUUID, nil
 	}
 	start := time.Now()
@@ -413,6 +534,7 @@ func (m *defaultManager) AttachVolume(ctx context.Context, vm *cnsvsphere.Virtua
 
 // DetachVolume detaches a volume from the virtual machine given the spec.
 func (m *defaultManager) DetachVolume(ctx context.Context, vm *cnsvsphere.VirtualMachine, volumeID string) error {
+	defer InvalidateQueryResultCache(ctx)
 	internalDetachVolume := func() error {
 		log := logger.GetLogger(ctx)
 		err := validateManager(ctx, m)
@@ -437,6 +559,7 @@ func (m *defaultManager) DetachVolume(ctx context.Context, vm *cnsvsphere.Virtua
 		// Call the CNS DetachVolume
 		task, err := m.virtualCenter.CnsClient.DetachVolume(ctx, cnsDetachSpecList)
 		if err != nil {
+			countFaultOfError(prometheus.PrometheusCnsDetachVolumeOpType, err)
 			if cnsvsphere.IsManagedObjectNotFound(err, cnsDetachSpec.Vm) {
 				// Detach failed with managed object not found, marking detach as successful, as Node VM is deleted and not present in the vCenter inventory
 				log.Infof("Node VM: %v not found on the vCenter. Marking Detach for volume:%q successful. err: %v", vm, volumeID, err)
@@ -446,6 +569,10 @@ func (m *defaultManager) DetachVolume(ctx context.Context, vm *cnsvsphere.Virtua
 				// Detach failed with NotFound error, check if the volume is already detached
 				log.Infof("VolumeID: %q, not found. Checking whether the volume is already detached", volumeID)
 				diskUUID, err := IsDiskAttached(ctx, vm, volumeID)
+				if err != nil && cnsvsphere.IsManagedObjectNotFound(err, vm.Reference()) {
+					log.Infof("DetachVolume: Node VM: %v not found on the vCenter. Marking Detach for volume: %q successful", vm, volumeID)
+					return nil
+				}
 				if err != nil {
 					log.Errorf("DetachVolume: CNS Detach has failed with err: %+v. Unable to check if volume: %q is already detached from vm: %+v",
 						err, volumeID, vm)
@@ -458,17 +585,20 @@ func (m *defaultManager) DetachVolume(ctx context.Context, vm *cnsvsphere.Virtua
 			}
 			msg := fmt.Sprintf("failed to detach cns volume:%q from node vm: %+v. err: %v", volumeID, vm, err)
 			log.Error(msg)
+			if isVMBusyError(err) {
+				return &VMBusyError{Operation: "detach", Volume: volumeID, VM: vm.String(), Fault: err.Error()}
+			}
 			return errors.New(msg)
 		}
 		// Get the taskInfo
-		taskInfo, err := cns.GetTaskInfo(ctx, task)
+		taskInfo, err := waitForTask(ctx, prometheus.PrometheusCnsDetachVolumeOpType, task)
 		if err != nil || taskInfo == nil {
 			log.Errorf("failed to get taskInfo for DetachVolume task from vCenter %q with err: %v", m.virtualCenter.Config.Host, err)
 			return err
 		}
 		log.Infof("DetachVolume: volumeID: %q, vm: %q, opId: %q", volumeID, vm.String(), taskInfo.ActivationId)
 		// Get the task results for the given task
-		taskResult, err := cns.GetTaskResult(ctx, taskInfo)
+		taskResult, err := getTaskResult(ctx, prometheus.PrometheusCnsDetachVolumeOpType, taskInfo)
 		if err != nil {
 			log.Errorf("unable to find the task result for DetachVolume task from vCenter %q with taskID %s and detachResults %v",
 				m.virtualCenter.Config.Host, taskInfo.Task.Value, taskResult)
@@ -480,10 +610,20 @@ func (m *defaultManager) DetachVolume(ctx context.Context, vm *cnsvsphere.Virtua
 		}
 		volumeOperationRes := taskResult.GetCnsVolumeOperationResult()
 		if volumeOperationRes.Fault != nil {
+			if isManagedObjectNotFoundFault(volumeOperationRes.Fault, vm.Reference()) {
+				// The Node VM was deleted while the volume was being detached from it.
+				log.Infof("DetachVolume: Node VM: %v not found on the vCenter. Marking Detach for volume: %q successful. opId: %q",
+					vm, volumeID, taskInfo.ActivationId)
+				return nil
+			}
 			_, isNotFoundFault := volumeOperationRes.Fault.Fault.(*vim25types.NotFound)
 			if isNotFoundFault {
 				// check if volume is already detached from the VM
 				diskUUID, err := IsDiskAttached(ctx, vm, volumeID)
+				if err != nil && cnsvsphere.IsManagedObjectNotFound(err, vm.Reference()) {
+					log.Infof("DetachVolume: Node VM: %v not found on the vCenter. Marking Detach for volume: %q successful", vm, volumeID)
+					return nil
+				}
 				if err != nil {
 					log.Errorf("DetachVolume: CNS Detach has failed with fault: %+v. Unable to check if volume: %q is already detached from vm: %+v",
 						spew.Sdump(volumeOperationRes.Fault), volumeID, vm)
@@ -496,6 +636,10 @@ func (m *defaultManager) DetachVolume(ctx context.Context, vm *cnsvsphere.Virtua
 			}
 			msg := fmt.Sprintf("failed to detach cns volume:%q from node vm: %+v. fault: %+v, opId: %q", volumeID, vm, spew.Sdump(volumeOperationRes.Fault), taskInfo.ActivationId)
 			log.Error(msg)
+			if isVMBusyFault(volumeOperationRes.Fault) {
+				return &VMBusyError{Operation: "detach", Volume: volumeID, VM: vm.String(),
+					Fault: volumeOperationRes.Fault.LocalizedMessage}
+			}
 			return errors.New(msg)
 		}
 		log.Infof("DetachVolume: Volume detached successfully. volumeID: %q, vm: %q, opId: %q", volumeID, taskInfo.ActivationId, vm.String())
@@ -515,6 +659,7 @@ func (m *defaultManager) DetachVolume(ctx context.Context, vm *cnsvsphere.Virtua
 
 // DeleteVolume deletes a volume given its spec.
 func (m *defaultManager) DeleteVolume(ctx context.Context, volumeID string, deleteDisk bool) error {
+	defer InvalidateQueryResultCache(ctx)
 	internalDeleteVolume := func() error {
 		log := logger.GetLogger(ctx)
 		err := validateManager(ctx, m)
@@ -532,26 +677,37 @@ func (m *defaultManager) DeleteVolume(ctx context.Context, volumeID string, dele
 		cnsVolumeID := cnstypes.CnsVolumeId{
 			Id: volumeID,
 		}
-		// Call the CNS DeleteVolume
 		cnsVolumeIDList = append(cnsVolumeIDList, cnsVolumeID)
-		task, err := m.virtualCenter.CnsClient.DeleteVolume(ctx, cnsVolumeIDList, deleteDisk)
-		if err != nil {
-			if cnsvsphere.IsNotFoundError(err) {
-				log.Infof("VolumeID: %q, not found. Returning success for this operation since the volume is not present", volumeID)
-				return nil
+		// Look for the task of a DeleteVolume invoked before a restart.
+		opName := deleteOperationName(volumeID)
+		op := m.getInProgressTask(ctx, m.getPersistedOperation(ctx, opName))
+		var task *object.Task
+		if op != nil {
+			task = op.task
+		} else {
+			// Call the CNS DeleteVolume
+			task, err = m.virtualCenter.CnsClient.DeleteVolume(ctx, cnsVolumeIDList, deleteDisk)
+			if err != nil {
+				countFaultOfError(prometheus.PrometheusCnsDeleteVolumeOpType, err)
+				if cnsvsphere.IsNotFoundError(err) {
+					log.Infof("VolumeID: %q, not found. Returning success for this operation since the volume is not present", volumeID)
+					m.deleteVolumeOperations(ctx, volumeID)
+					return nil
+				}
+				log.Errorf("CNS DeleteVolume failed from the  vCenter %q with err: %v", m.virtualCenter.Config.Host, err)
+				return err
 			}
-			log.Errorf("CNS DeleteVolume failed from the  vCenter %q with err: %v", m.virtualCenter.Config.Host, err)
-			return err
+			op = m.newOperation(ctx, opName, task)
 		}
 		// Get the taskInfo
-		taskInfo, err := cns.GetTaskInfo(ctx, task)
+		taskInfo, err := waitForTask(ctx, prometheus.PrometheusCnsDeleteVolumeOpType, task)
 		if err != nil || taskInfo == nil {
 			log.Errorf("failed to get taskInfo for DeleteVolume task from vCenter %q with err: %v", m.virtualCenter.Config.Host, err)
 			return err
 		}
 		log.Infof("DeleteVolume: volumeID: %q, opId: %q", volumeID, taskInfo.ActivationId)
 		// Get the task results for the given task
-		taskResult, err := cns.GetTaskResult(ctx, taskInfo)
+		taskResult, err := getTaskResult(ctx, prometheus.PrometheusCnsDeleteVolumeOpType, taskInfo)
 		if err != nil {
 			log.Errorf("unable to find the task result for DeleteVolume task from vCenter %q with taskID %s and deleteResults %v",
 				m.virtualCenter.Config.Host, taskInfo.Task.Value, taskResult)
@@ -565,9 +721,12 @@ func (m *defaultManager) DeleteVolume(ctx context.Context, volumeID string, dele
 		if volumeOperationRes.Fault != nil {
 			msg := fmt.Sprintf("failed to delete volume: %q, fault: %q, opID: %q", volumeID, spew.Sdump(volumeOperationRes.Fault), taskInfo.ActivationId)
 			log.Error(msg)
+			m.storeOperation(ctx, op, volumeID, taskInfo.ActivationId, taskInvocationStatusError, msg)
 			return errors.New(msg)
 		}
 		log.Infof("DeleteVolume: Volume deleted successfully. volumeID: %q, opId: %q", volumeID, taskInfo.ActivationId)
+		m.storeOperation(ctx, op, volumeID, taskInfo.ActivationId, taskInvocationStatusSuccess, "")
+		m.deleteVolumeOperations(ctx, volumeID)
 		return nil
 	}
 	start := time.Now()
@@ -584,6 +743,7 @@ func (m *defaultManager) DeleteVolume(ctx context.Context, volumeID string, dele
 
 // UpdateVolume updates a volume given its spec.
 func (m *defaultManager) UpdateVolumeMetadata(ctx context.Context, spec *cnstypes.CnsVolumeMetadataUpdateSpec) error {
+	defer InvalidateQueryResultCache(ctx)
 	internalUpdateVolumeMetadata := func() error {
 		log := logger.GetLogger(ctx)
 		err := validateManager(ctx, m)
@@ -616,18 +776,19 @@ func (m *defaultManager) UpdateVolumeMetadata(ctx context.Context, spec *cnstype
 		cnsUpdateSpecList = append(cnsUpdateSpecList, cnsUpdateSpec)
 		task, err := m.virtualCenter.CnsClient.UpdateVolumeMetadata(ctx, cnsUpdateSpecList)
 		if err != nil {
+			countFaultOfError(prometheus.PrometheusCnsUpdateVolumeMetadataOpType, err)
 			log.Errorf("CNS UpdateVolume failed from vCenter %q with err: %v", m.virtualCenter.Config.Host, err)
 			return err
 		}
 		// Get the taskInfo
-		taskInfo, err := cns.GetTaskInfo(ctx, task)
+		taskInfo, err := waitForTask(ctx, prometheus.PrometheusCnsUpdateVolumeMetadataOpType, task)
 		if err != nil || taskInfo == nil {
 			log.Errorf("failed to get taskInfo for UpdateVolume task from vCenter %q with err: %v", m.virtualCenter.Config.Host, err)
 			return err
 		}
 		log.Infof("UpdateVolumeMetadata: volumeID: %q, opId: %q", spec.VolumeId.Id, taskInfo.ActivationId)
 		// Get the task results for the given task
-		taskResult, err := cns.GetTaskResult(ctx, taskInfo)
+		taskResult, err := getTaskResult(ctx, prometheus.PrometheusCnsUpdateVolumeMetadataOpType, taskInfo)
 		if err != nil {
 			log.Errorf("unable to find the task result for UpdateVolume task from vCenter %q with taskID %q, opId: %q and updateResults %+v",
 				m.virtualCenter.Config.Host, taskInfo.Task.Value, taskInfo.ActivationId, taskResult)
@@ -660,6 +821,7 @@ func (m *defaultManager) UpdateVolumeMetadata(ctx context.Context, spec *cnstype
 
 // ExpandVolume expands a volume given its spec.
 func (m *defaultManager) ExpandVolume(ctx context.Context, volumeID string, size int64) error {
+	defer InvalidateQueryResultCache(ctx)
 	internalExpandVolume := func() error {
 		log := logger.GetLogger(ctx)
 		err := validateManager(ctx, m)
@@ -682,26 +844,47 @@ func (m *defaultManager) ExpandVolume(ctx context.Context, volumeID string, size
 			CapacityInMb: size,
 		}
 		cnsExtendSpecList = append(cnsExtendSpecList, cnsExtendSpec)
-		// Call the CNS ExtendVolume
-		log.Infof("Calling CnsClient.ExtendVolume: VolumeID [%q] Size [%d] cnsExtendSpecList [%#v]", volumeID, size, cnsExtendSpecList)
-		task, err := m.virtualCenter.CnsClient.ExtendVolume(ctx, cnsExtendSpecList)
-		if err != nil {
-			if cnsvsphere.IsNotFoundError(err) {
-				log.Errorf("VolumeID: %q, not found. Cannot expand volume.", volumeID)
-				return errors.New("volume not found")
+		// Look for the task of an ExtendVolume invoked by a concurrent call or
+		// before a restart, holding the lock of the volume until the task of
+		// a new ExtendVolume is persisted.
+		op, err := func() (*operation, error) {
+			lock, _ := expandLocks.LoadOrStore(volumeID, &sync.Mutex{})
+			lock.(*sync.Mutex).Lock()
+			defer lock.(*sync.Mutex).Unlock()
+			op, err := m.getInProgressExpandTask(ctx, volumeID, size)
+			if err != nil {
+				log.Errorf("ExpandVolume: %v", err)
+				return nil, err
+			}
+			if op != nil {
+				return op, nil
+			}
+			// Call the CNS ExtendVolume
+			log.Infof("Calling CnsClient.ExtendVolume: VolumeID [%q] Size [%d] cnsExtendSpecList [%#v]", volumeID, size, cnsExtendSpecList)
+			task, err := m.virtualCenter.CnsClient.ExtendVolume(ctx, cnsExtendSpecList)
+			if err != nil {
+				countFaultOfError(prometheus.PrometheusCnsExpandVolumeOpType, err)
+				if cnsvsphere.IsNotFoundError(err) {
+					log.Errorf("VolumeID: %q, not found. Cannot expand volume.", volumeID)
+					return nil, errors.New("volume not found")
+				}
+				log.Errorf("CNS ExtendVolume failed from the vCenter %q with err: %v", m.virtualCenter.Config.Host, err)
+				return nil, err
 			}
-			log.Errorf("CNS ExtendVolume failed from the vCenter %q with err: %v", m.virtualCenter.Config.Host, err)
+			return m.newExpandOperation(ctx, expandOperationName(volumeID), task, size), nil
+		}()
+		if err != nil {
 			return err
 		}
 		// Get the taskInfo
-		taskInfo, err := cns.GetTaskInfo(ctx, task)
+		taskInfo, err := waitForTask(ctx, prometheus.PrometheusCnsExpandVolumeOpType, op.task)
 		if err != nil || taskInfo == nil {
 			log.Errorf("failed to get taskInfo for ExtendVolume task from vCenter %q with err: %v", m.virtualCenter.Config.Host, err)
 			return err
 		}
 		log.Infof("ExpandVolume: volumeID: %q, opId: %q", volumeID, taskInfo.ActivationId)
 		// Get the task results for the given task
-		taskResult, err := cns.GetTaskResult(ctx, taskInfo)
+		taskResult, err := getTaskResult(ctx, prometheus.PrometheusCnsExpandVolumeOpType, taskInfo)
 		if err != nil {
 			log.Errorf("Unable to find the task result for ExtendVolume task from vCenter %q with taskID %s and extend volume Results %v",
 				m.virtualCenter.Config.Host, taskInfo.Task.Value, taskResult)
@@ -715,9 +898,15 @@ func (m *defaultManager) ExpandVolume(ctx context.Context, volumeID string, size
 		if volumeOperationRes.Fault != nil {
 			msg := fmt.Sprintf("failed to extend volume: %q, fault: %q, opID: %q", volumeID, spew.Sdump(volumeOperationRes.Fault), taskInfo.ActivationId)
 			log.Error(msg)
+			m.storeOperation(ctx, op, volumeID, taskInfo.ActivationId, taskInvocationStatusError, msg)
+			if spaceErr := m.getExpandInsufficientSpaceError(ctx, volumeID, size, volumeOperationRes.Fault); spaceErr != nil {
+				log.Errorf("ExpandVolume: %v", spaceErr)
+				return spaceErr
+			}
 			return errors.New(msg)
 		}
 		log.Infof("ExpandVolume: Volume expanded successfully. volumeID: %q, opId: %q", volumeID, taskInfo.ActivationId)
+		m.storeOperation(ctx, op, volumeID, taskInfo.ActivationId, taskInvocationStatusSuccess, "")
 		return nil
 	}
 	start := time.Now()
@@ -751,6 +940,7 @@ func (m *defaultManager) QueryVolume(ctx context.Context, queryFilter cnstypes.C
 		//Call the CNS QueryVolume
 		res, err := m.virtualCenter.CnsClient.QueryVolume(ctx, queryFilter)
 		if err != nil {
+			countFaultOfError(prometheus.PrometheusCnsQueryVolumeOpType, err)
 			log.Errorf("CNS QueryVolume failed from vCenter %q with err: %v", m.virtualCenter.Config.Host, err)
 			return nil, err
 		}
@@ -786,6 +976,7 @@ func (m *defaultManager) QueryAllVolume(ctx context.Context, queryFilter cnstype
 		//Call the CNS QueryAllVolume
 		res, err := m.virtualCenter.CnsClient.QueryAllVolume(ctx, queryFilter, querySelection)
 		if err != nil {
+			countFaultOfError(prometheus.PrometheusCnsQueryAllVolumeOpType, err)
 			log.Errorf("CNS QueryAllVolume failed from vCenter %q with err: %v", m.virtualCenter.Config.Host, err)
 			return nil, err
 		}
@@ -821,19 +1012,20 @@ func (m *defaultManager) QueryVolumeInfo(ctx context.Context, volumeIDList []cns
 		//Call the CNS QueryVolumeInfo
 		queryVolumeInfoTask, err := m.virtualCenter.CnsClient.QueryVolumeInfo(ctx, volumeIDList)
 		if err != nil {
+			countFaultOfError(prometheus.PrometheusCnsQueryVolumeInfoOpType, err)
 			log.Errorf("CNS QueryAllVolume failed from vCenter %q with err: %v", m.virtualCenter.Config.Host, err)
 			return nil, err
 		}
 
 		// Get the taskInfo
-		taskInfo, err := cns.GetTaskInfo(ctx, queryVolumeInfoTask)
+		taskInfo, err := waitForTask(ctx, prometheus.PrometheusCnsQueryVolumeInfoOpType, queryVolumeInfoTask)
 		if err != nil || taskInfo == nil {
 			log.Errorf("failed to get taskInfo for QueryVolumeInfo task from vCenter %q with err: %v", m.virtualCenter.Config.Host, err)
 			return nil, err
 		}
 		log.Infof("QueryVolumeInfo: volumeIDList: %v, opId: %q", volumeIDList, taskInfo.ActivationId)
 		// Get the task results for the given task
-		taskResult, err := cns.GetTaskResult(ctx, taskInfo)
+		taskResult, err := getTaskResult(ctx, prometheus.PrometheusCnsQueryVolumeInfoOpType, taskInfo)
 		if err != nil {
 			log.Errorf("unable to find the task result for QueryVolumeInfo task from vCenter %q with taskID %s and taskResult %v",
 				m.virtualCenter.Config.Host, taskInfo.Task.Value, taskResult)
@@ -866,6 +1058,7 @@ func (m *defaultManager) QueryVolumeInfo(ctx context.Context, volumeIDList []cns
 }
 
 func (m *defaultManager) RelocateVolume(ctx context.Context, relocateSpecList ...cnstypes.BaseCnsVolumeRelocateSpec) (*object.Task, error) {
+	defer InvalidateQueryResultCache(ctx)
 	internalRelocateVolume := func() (*object.Task, error) {
 		log := logger.GetLogger(ctx)
 		err := validateManager(ctx, m)
@@ -882,6 +1075,7 @@ func (m *defaultManager) RelocateVolume(ctx context.Context, relocateSpecList ..
 		}
 		res, err := m.virtualCenter.CnsClient.RelocateVolume(ctx, relocateSpecList...)
 		if err != nil {
+			countFaultOfError(prometheus.PrometheusCnsRelocateVolumeOpType, err)
 			log.Errorf("CNS RelocateVolume failed from vCenter %q with err: %v", m.virtualCenter.Config.Host, err)
 			return nil, err
 		}
@@ -901,6 +1095,7 @@ func (m *defaultManager) RelocateVolume(ctx context.Context, relocateSpecList ..
 
 // ConfigureVolumeACLs configures net permissions for a given CnsVolumeACLConfigureSpec
 func (m *defaultManager) ConfigureVolumeACLs(ctx context.Context, spec cnstypes.CnsVolumeACLConfigureSpec) error {
+	defer InvalidateQueryResultCache(ctx)
 	internalConfigureVolumeACLs := func() error {
 		log := logger.GetLogger(ctx)
 		err := validateManager(ctx, m)
@@ -919,18 +1114,19 @@ func (m *defaultManager) ConfigureVolumeACLs(ctx context.Context, spec cnstypes.
 
 		task, err = m.virtualCenter.CnsClient.ConfigureVolumeACLs(ctx, spec)
 		if err != nil {
+			countFaultOfError(prometheus.PrometheusCnsConfigureVolumeACLOpType, err)
 			log.Errorf("CNS ConfigureVolumeACLs failed from vCenter %q with err: %v", m.virtualCenter.Config.Host, err)
 			return err
 		}
 
 		// Get the taskInfo
-		taskInfo, err = cns.GetTaskInfo(ctx, task)
+		taskInfo, err = waitForTask(ctx, prometheus.PrometheusCnsConfigureVolumeACLOpType, task)
 		if err != nil {
 			log.Errorf("failed to get taskInfo for ConfigureVolumeACLs task from vCenter %q with err: %v", m.virtualCenter.Config.Host, err)
 			return err
 		}
 		// Get the taskResult
-		taskResult, err := cns.GetTaskResult(ctx, taskInfo)
+		taskResult, err := getTaskResult(ctx, prometheus.PrometheusCnsConfigureVolumeACLOpType, taskInfo)
 		if err != nil {
 			log.Errorf("unable to find the task result for ConfigureVolumeACLs task from vCenter %q. taskID: %q, opId: %q ConfigureVolumeACL results: %+v . Error: %v",
 				m.virtualCenter.Config.Host, taskInfo.Task.Value, taskInfo.ActivationId, taskResult, err)
@@ -1023,43 +1219,110 @@ func (m *defaultManager) RetrieveVStorageObject(ctx context.Context, volumeID st
 
 // QueryVolumeAsync returns volumes matching the given filter by using CnsQueryAsync API. QueryVolumeAsync takes querySelection spec which helps to specify which fields
 // for the query entities to be returned. All volume fields would be returned as part of the CnsQueryResult if the querySelection parameters are not specified
+// If the filter has no cursor, all the pages of the result are queried and returned, otherwise only the page at the cursor is returned.
+// cnsvsphere.ErrNotSupported is returned if the vCenter doesn't support CnsQueryAsync.
 func (m *defaultManager) QueryVolumeAsync(ctx context.Context, queryFilter cnstypes.CnsQueryFilter, querySelection cnstypes.CnsQuerySelection) (*cnstypes.CnsQueryResult, error) {
-	log := logger.GetLogger(ctx)
-	err := validateManager(ctx, m)
-	if err != nil {
-		log.Errorf("validateManager failed with err: %+v", err)
+	internalQueryVolumeAsync := func() (*cnstypes.CnsQueryResult, error) {
+		log := logger.GetLogger(ctx)
+		err := validateManager(ctx, m)
+		if err != nil {
+			log.Errorf("validateManager failed with err: %+v", err)
+			return nil, err
+		}
+		// Set up the VC connection
+		err = m.virtualCenter.ConnectCns(ctx)
+		if err != nil {
+			log.Errorf("ConnectCns failed with err: %+v", err)
+			return nil, err
+		}
+		supported, err := m.isQueryAsyncSupported(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if !supported {
+			return nil, cnsvsphere.ErrNotSupported
+		}
+		if queryFilter.Cursor != nil {
+			return m.queryVolumeAsyncPage(ctx, queryFilter, querySelection)
+		}
+		queryResult := &cnstypes.CnsQueryResult{}
+		for {
+			res, err := m.queryVolumeAsyncPage(ctx, queryFilter, querySelection)
+			if err != nil {
+				return nil, err
+			}
+			queryResult.Volumes = append(queryResult.Volumes, res.Volumes...)
+			queryResult.Cursor = res.Cursor
+			if len(res.Volumes) == 0 || res.Cursor.Offset >= res.Cursor.TotalRecords {
+				return queryResult, nil
+			}
+			log.Debugf("QueryVolumeAsync: %d more volumes to be queried", res.Cursor.TotalRecords-res.Cursor.Offset)
+			queryFilter.Cursor = &cnstypes.CnsCursor{
+				Offset: res.Cursor.Offset,
+				Limit:  res.Cursor.Limit,
+			}
+		}
+	}
+	start := time.Now()
+	resp, err := internalQueryVolumeAsync()
+	if err == cnsvsphere.ErrNotSupported {
 		return nil, err
 	}
-	// Set up the VC connection
-	err = m.virtualCenter.ConnectCns(ctx)
 	if err != nil {
-		log.Errorf("ConnectCns failed with err: %+v", err)
-		return nil, err
+		prometheus.CnsControlOpsHistVec.WithLabelValues(prometheus.PrometheusCnsQueryVolumeAsyncOpType,
+			prometheus.PrometheusFailStatus).Observe(time.Since(start).Seconds())
+	} else {
+		prometheus.CnsControlOpsHistVec.WithLabelValues(prometheus.PrometheusCnsQueryVolumeAsyncOpType,
+			prometheus.PrometheusPassStatus).Observe(time.Since(start).Seconds())
 	}
-	isvSphere70U3orAbove, err := cnsvsphere.IsvSphereVersion70U3orAbove(ctx, m.virtualCenter.Client.ServiceContent.About)
+	return resp, err
+}
+
+// isQueryAsyncSupported returns true if the vCenter supports CnsQueryAsync.
+// Support is detected from the vCenter version, unless the vCenter already
+// rejected CnsQueryAsync at its current version.
+func (m *defaultManager) isQueryAsyncSupported(ctx context.Context) (bool, error) {
+	log := logger.GetLogger(ctx)
+	about := m.virtualCenter.Client.ServiceContent.About
+	isvSphere70U3orAbove, err := cnsvsphere.IsvSphereVersion70U3orAbove(ctx, about)
 	if err != nil {
-		msg := fmt.Sprintf("Error while checking the vSphere Version %q to invoke QueryVolumeAsync, Error= %+v", m.virtualCenter.Client.ServiceContent.About.Version, err)
+		msg := fmt.Sprintf("Error while checking the vSphere Version %q to invoke QueryVolumeAsync, Error= %+v", about.Version, err)
 		log.Errorf(msg)
-		return nil, errors.New(msg)
+		return false, errors.New(msg)
 	}
 	if !isvSphere70U3orAbove {
-		msg := fmt.Sprintf("QueryVolumeAsync is not supported in vSphere Version %q", m.virtualCenter.Client.ServiceContent.About.Version)
-		log.Warnf(msg)
-		return nil, cnsvsphere.ErrNotSupported
+		log.Debugf("QueryVolumeAsync is not supported in vSphere Version %q", about.Version)
+		return false, nil
+	}
+	m.queryAsyncLock.Lock()
+	defer m.queryAsyncLock.Unlock()
+	if m.queryAsyncUnsupportedRelease != "" && m.queryAsyncUnsupportedRelease == about.FullName {
+		log.Debugf("QueryVolumeAsync is not supported in %q", about.FullName)
+		return false, nil
 	}
+	return true, nil
+}
 
+// queryVolumeAsyncPage invokes CnsQueryAsync once and returns its result.
+func (m *defaultManager) queryVolumeAsyncPage(ctx context.Context, queryFilter cnstypes.CnsQueryFilter, querySelection cnstypes.CnsQuerySelection) (*cnstypes.CnsQueryResult, error) {
+	log := logger.GetLogger(ctx)
 	// Call the CNS QueryVolumeAsync
 	queryVolumeAsyncTask, err := m.virtualCenter.CnsClient.QueryVolumeAsync(ctx, queryFilter, querySelection)
 	if err != nil {
+		countFaultOfError(prometheus.PrometheusCnsQueryVolumeAsyncOpType, err)
+		if cnsvsphere.IsMethodNotSupportedError(err) {
+			m.setQueryAsyncUnsupported(ctx)
+			return nil, cnsvsphere.ErrNotSupported
+		}
 		log.Errorf("CNS QueryVolumeAsync failed from vCenter %q with err: %v", m.virtualCenter.Config.Host, err)
 		return nil, err
 	}
-	queryVolumeAsyncTaskInfo, err := cns.GetTaskInfo(ctx, queryVolumeAsyncTask)
+	queryVolumeAsyncTaskInfo, err := waitForTask(ctx, prometheus.PrometheusCnsQueryVolumeAsyncOpType, queryVolumeAsyncTask)
 	if err != nil {
 		log.Errorf("CNS QueryVolumeAsync failed to get TaskInfo with err: %v", err)
 		return nil, err
 	}
-	queryVolumeAsyncTaskResult, err := cns.GetTaskResult(ctx, queryVolumeAsyncTaskInfo)
+	queryVolumeAsyncTaskResult, err := getTaskResult(ctx, prometheus.PrometheusCnsQueryVolumeAsyncOpType, queryVolumeAsyncTaskInfo)
 	if err != nil {
 		log.Errorf("CNS QueryVolumeAsync failed to get TaskResult with err: %v", err)
 		return nil, err
@@ -1070,6 +1333,11 @@ func (m *defaultManager) QueryVolumeAsync(ctx context.Context, queryFilter cnsty
 	}
 	volumeOperationRes := queryVolumeAsyncTaskResult.GetCnsVolumeOperationResult()
 	if volumeOperationRes.Fault != nil {
+		switch volumeOperationRes.Fault.Fault.(type) {
+		case *vim25types.MethodNotFound, *vim25types.NotSupported:
+			m.setQueryAsyncUnsupported(ctx)
+			return nil, cnsvsphere.ErrNotSupported
+		}
 		msg := fmt.Sprintf("failed to query volumes using CnsQueryVolumeAsync, fault: %q, opID: %q", spew.Sdump(volumeOperationRes.Fault), queryVolumeAsyncTaskInfo.ActivationId)
 		log.Error(msg)
 		return nil, errors.New(msg)
@@ -1079,3 +1347,14 @@ func (m *defaultManager) QueryVolumeAsync(ctx context.Context, queryFilter cnsty
 	log.Debugf("QueryVolumeAsync returned CnsQueryResult: %+v", spew.Sdump(queryVolumeAsyncResult.QueryResult))
 	return &queryVolumeAsyncResult.QueryResult, nil
 }
+
+// setQueryAsyncUnsupported records that the vCenter rejected CnsQueryAsync so
+// that queries aren't attempted asynchronously until the vCenter is upgraded.
+func (m *defaultManager) setQueryAsyncUnsupported(ctx context.Context) {
+	log := logger.GetLogger(ctx)
+	about := m.virtualCenter.Client.ServiceContent.About
+	log.Warnf("vCenter %q running %q doesn't support QueryVolumeAsync", m.virtualCenter.Config.Host, about.FullName)
+	m.queryAsyncLock.Lock()
+	defer m.queryAsyncLock.Unlock()
+	m.queryAsyncUnsupportedRelease = about.FullName
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"context"
+	"crypto/tls"
+	"strconv"
+	"testing"
+
+	cnssim "github.com/vmware/govmomi/cns/simulator"
+	cnstypes "github.com/vmware/govmomi/cns/types"
+	"github.com/vmware/govmomi/simulator"
+
+	cnsvsphere "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/vsphere"
+)
+
+// TestQueryVolumeAsyncSupport checks that CnsQueryAsync is only used on
+// vCenters supporting it, and not retried on a release that rejected it.
+func TestQueryVolumeAsyncSupport(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	model := simulator.VPX()
+	defer model.Remove()
+	if err := model.Create(); err != nil {
+		t.Fatal(err)
+	}
+	model.Service.TLS = new(tls.Config)
+	s := model.Service.NewServer()
+	defer s.Close()
+	model.Service.RegisterSDK(cnssim.New())
+
+	port, err := strconv.Atoi(s.URL.Port())
+	if err != nil {
+		t.Fatal(err)
+	}
+	password, _ := s.URL.User.Password()
+	vc := &cnsvsphere.VirtualCenter{
+		Config: &cnsvsphere.VirtualCenterConfig{
+			Host:     s.URL.Hostname(),
+			Port:     port,
+			Username: s.URL.User.Username(),
+			Password: password,
+			Insecure: true,
+		},
+	}
+	if err := vc.ConnectCns(ctx); err != nil {
+		t.Fatal(err)
+	}
+	m := &defaultManager{virtualCenter: vc}
+
+	vc.Client.ServiceContent.About.Version = "7.0.2"
+	if _, err := m.QueryVolumeAsync(ctx, cnstypes.CnsQueryFilter{}, cnstypes.CnsQuerySelection{}); err != cnsvsphere.ErrNotSupported {
+		t.Errorf("expected QueryVolumeAsync to be unsupported on 7.0.2, got err: %v", err)
+	}
+
+	vc.Client.ServiceContent.About.Version = "7.0.3"
+	vc.Client.ServiceContent.About.FullName = "VMware vCenter Server 7.0.3 build-1"
+	if _, err := m.QueryVolumeAsync(ctx, cnstypes.CnsQueryFilter{}, cnstypes.CnsQuerySelection{}); err != nil {
+		t.Errorf("expected QueryVolumeAsync to succeed on 7.0.3, got err: %v", err)
+	}
+
+	m.setQueryAsyncUnsupported(ctx)
+	if _, err := m.QueryVolumeAsync(ctx, cnstypes.CnsQueryFilter{}, cnstypes.CnsQuerySelection{}); err != cnsvsphere.ErrNotSupported {
+		t.Errorf("expected QueryVolumeAsync to be unsupported after being rejected, got err: %v", err)
+	}
+
+	// An upgraded vCenter is probed again.
+	vc.Client.ServiceContent.About.FullName = "VMware vCenter Server 7.0.3 build-2"
+	if _, err := m.QueryVolumeAsync(ctx, cnstypes.CnsQueryFilter{}, cnstypes.CnsQuerySelection{}); err != nil {
+		t.Errorf("expected QueryVolumeAsync to succeed after the upgrade, got err: %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/vmware/govmomi/cns"
+	cnstypes "github.com/vmware/govmomi/cns/types"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/soap"
+	vim25types "github.com/vmware/govmomi/vim25/types"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"sigs.k8s.io/vsphere-csi-driver/pkg/common/prometheus"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/common/tracing"
+)
+
+// waitForTask waits for the task of the CNS operation opType to complete,
+// observing the time waited and counting the fault of a failed task. The
+// wait is traced with a span, parent of the spans of the polling calls.
+func waitForTask(ctx context.Context, opType string, task *object.Task) (*vim25types.TaskInfo, error) {
+	ctx, span := tracing.StartSpan(ctx, "cns.WaitForTask", trace.WithAttributes(
+		attribute.String("cns.optype", opType), attribute.String("vsphere.task", task.Reference().Value)))
+	start := time.Now()
+	taskInfo, err := task.WaitForResult(ctx, nil)
+	status := prometheus.PrometheusPassStatus
+	if err != nil {
+		status = prometheus.PrometheusFailStatus
+		countFaultOfError(opType, err)
+	}
+	prometheus.CnsTaskWaitHistVec.WithLabelValues(opType, status).Observe(time.Since(start).Seconds())
+	if taskInfo != nil {
+		span.SetAttributes(attribute.String("vsphere.opid", taskInfo.ActivationId))
+	}
+	tracing.EndSpan(span, err)
+	return taskInfo, err
+}
+
+// getTaskResult returns the result of the completed task of the CNS operation
+// opType, counting the fault of the volume operation if it failed.
+func getTaskResult(ctx context.Context, opType string, taskInfo *vim25types.TaskInfo) (
+	cnstypes.BaseCnsVolumeOperationResult, error) {
+	taskResult, err := cns.GetTaskResult(ctx, taskInfo)
+	if err == nil && taskResult != nil {
+		if fault := taskResult.GetCnsVolumeOperationResult().Fault; fault != nil {
+			countFault(opType, fault.Fault)
+		}
+	}
+	return taskResult, err
+}
+
+// countFaultOfError counts the vCenter fault of err, the error of a CNS method
+// or of its task, if it has one.
+func countFaultOfError(opType string, err error) {
+	switch {
+	case soap.IsSoapFault(err):
+		countFault(opType, soap.ToSoapFault(err).VimFault())
+	case soap.IsVimFault(err):
+		countFault(opType, soap.ToVimFault(err))
+	default:
+		if f, ok := err.(interface{ Fault() vim25types.BaseMethodFault }); ok {
+			countFault(opType, f.Fault())
+		}
+	}
+}
+
+// countFault counts the fault, a vim25 fault type, by its type name.
+func countFault(opType string, fault interface{}) {
+	if name := faultName(fault); name != "" {
+		prometheus.CnsFaultsTotal.WithLabelValues(opType, name).Inc()
+	}
+}
+
+// faultName returns the type name of the fault, such as "NotFound", or an
+// empty string if it is nil.
+func faultName(fault interface{}) string {
+	if fault == nil {
+		return ""
+	}
+	t := reflect.TypeOf(fault)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Name()
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	cnstypes "github.com/vmware/govmomi/cns/types"
+	"github.com/vmware/govmomi/task"
+	vim25types "github.com/vmware/govmomi/vim25/types"
+
+	"sigs.k8s.io/vsphere-csi-driver/pkg/common/prometheus"
+)
+
+func TestFaultName(t *testing.T) {
+	tests := []struct {
+		fault    interface{}
+		expected string
+	}{
+		{nil, ""},
+		{&vim25types.NotFound{}, "NotFound"},
+		{vim25types.InvalidState{}, "InvalidState"},
+		{&cnstypes.CnsFault{}, "CnsFault"},
+	}
+	for _, test := range tests {
+		if name := faultName(test.fault); name != test.expected {
+			t.Errorf("expected %q for fault %+v, got %q", test.expected, test.fault, name)
+		}
+	}
+}
+
+func TestCountFaultOfError(t *testing.T) {
+	opType := prometheus.PrometheusCnsAttachVolumeOpType
+	counter := prometheus.CnsFaultsTotal.WithLabelValues(opType, "TaskInProgress")
+	count := testutil.ToFloat64(counter)
+
+	taskErr := task.Error{LocalizedMethodFault: &vim25types.LocalizedMethodFault{Fault: &vim25types.TaskInProgress{}}}
+	countFaultOfError(opType, taskErr)
+	// Errors without a vCenter fault aren't counted.
+	countFaultOfError(opType, errors.New("connection refused"))
+
+	if v := testutil.ToFloat64(counter); v-count != 1 {
+		t.Errorf("expected 1 TaskInProgress fault to be counted, got %v", v-count)
+	}
+}
@@ -0,0 +1,261 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	cnstypes "github.com/vmware/govmomi/cns/types"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/mo"
+	vim25types "github.com/vmware/govmomi/vim25/types"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	cnsvsphere "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/vsphere"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/internalapis/cnsvolumeoperationrequest"
+)
+
+const (
+	// taskInvocationStatusInProgress is the status of an operation whose
+	// task is running on vCenter.
+	taskInvocationStatusInProgress = "In Progress"
+	// taskInvocationStatusSuccess is the status of an operation whose task
+	// succeeded.
+	taskInvocationStatusSuccess = "Successful"
+	// taskInvocationStatusError is the status of an operation whose task
+	// failed.
+	taskInvocationStatusError = "Failed"
+)
+
+// operation is a CNS task invoked by the volume manager, persisted in the
+// operation store under name so that the task can be found again after a
+// restart instead of being invoked a second time.
+type operation struct {
+	name      string
+	task      *object.Task
+	invokedAt metav1.Time
+	// capacity is the size in MB requested by an expand operation.
+	capacity int64
+	// state is the state of the task on vCenter when the operation was found
+	// persisted, empty for a task just invoked.
+	state vim25types.TaskInfoState
+}
+
+// ExpandInProgressError is returned when a volume is expanded while an expand
+// of the volume to another size is still queued or running on vCenter.
+type ExpandInProgressError struct {
+	// VolumeID is the ID of the volume being expanded.
+	VolumeID string
+	// CapacityMB is the size the volume is being expanded to.
+	CapacityMB int64
+	// TaskID is the ID of the task of the expand in progress.
+	TaskID string
+}
+
+func (e *ExpandInProgressError) Error() string {
+	return fmt.Sprintf("volume %q is being expanded to %d MB by task %q", e.VolumeID, e.CapacityMB, e.TaskID)
+}
+
+// invalidOperationNameChars matches the characters not allowed in the names
+// of the objects persisting the operations.
+var invalidOperationNameChars = regexp.MustCompile(`[^a-z0-9.-]`)
+
+// operationName returns the name the operation made of parts is persisted
+// under, a valid DNS-1123 subdomain name: the volume IDs of file volumes,
+// such as file:<uuid>, have characters which aren't allowed in it.
+func operationName(parts ...string) string {
+	return invalidOperationNameChars.ReplaceAllString(strings.ToLower(strings.Join(parts, "-")), "-")
+}
+
+// attachOperationName returns the name the attach of volumeID to vm is
+// persisted under.
+func attachOperationName(volumeID string, vm *cnsvsphere.VirtualMachine) string {
+	vmID := vm.UUID
+	if vmID == "" {
+		vmID = vm.Reference().Value
+	}
+	return operationName("attach", volumeID, vmID)
+}
+
+// deleteOperationName returns the name the delete of volumeID is persisted
+// under.
+func deleteOperationName(volumeID string) string {
+	return operationName("delete", volumeID)
+}
+
+// expandOperationName returns the name the expand of volumeID is persisted
+// under.
+func expandOperationName(volumeID string) string {
+	return operationName("expand", volumeID)
+}
+
+// getPersistedOperation returns the details of the operation persisted with
+// the given name, or nil if there is none or the operation store isn't set.
+func (m *defaultManager) getPersistedOperation(ctx context.Context,
+	name string) *cnsvolumeoperationrequest.VolumeOperationRequestDetails {
+	log := logger.GetLogger(ctx)
+	if m.operationStore == nil {
+		return nil
+	}
+	details, err := m.operationStore.GetRequestDetails(ctx, name)
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			log.Warnf("failed to get the persisted details of operation %q. Err: %v", name, err)
+		}
+		return nil
+	}
+	return details
+}
+
+// getInProgressTask returns the task of the operation persisted with the
+// given name if it is still queued or running on vCenter, or has succeeded
+// but its result wasn't persisted yet. Returns nil if the operation has to
+// be invoked again.
+func (m *defaultManager) getInProgressTask(ctx context.Context,
+	details *cnsvolumeoperationrequest.VolumeOperationRequestDetails) *operation {
+	log := logger.GetLogger(ctx)
+	if details == nil || details.OperationDetails.TaskStatus != taskInvocationStatusInProgress ||
+		details.OperationDetails.TaskID == "" {
+		return nil
+	}
+	taskRef := vim25types.ManagedObjectReference{
+		Type:  "Task",
+		Value: details.OperationDetails.TaskID,
+	}
+	var task mo.Task
+	pc := property.DefaultCollector(m.virtualCenter.Client.Client)
+	if err := pc.RetrieveOne(ctx, taskRef, []string{"info.state"}, &task); err != nil {
+		log.Infof("task %q of operation %q isn't available on vCenter %q anymore, invoking the operation again. Err: %v",
+			taskRef.Value, details.Name, m.virtualCenter.Config.Host, err)
+		return nil
+	}
+	if task.Info.State == vim25types.TaskInfoStateError {
+		log.Infof("task %q of operation %q has failed, invoking the operation again", taskRef.Value, details.Name)
+		return nil
+	}
+	log.Infof("Found task %q of operation %q in state %q on vCenter %q, waiting for it instead of invoking the operation again",
+		taskRef.Value, details.Name, task.Info.State, m.virtualCenter.Config.Host)
+	return &operation{
+		name:      details.Name,
+		task:      object.NewTask(m.virtualCenter.Client.Client, taskRef),
+		invokedAt: details.OperationDetails.TaskInvocationTimestamp,
+		capacity:  details.Capacity,
+		state:     task.Info.State,
+	}
+}
+
+// getInProgressExpandTask returns the task of the expand of volumeID to size
+// MB persisted by a previous call or before a restart, if it is still in
+// progress.
+func (m *defaultManager) getInProgressExpandTask(ctx context.Context, volumeID string, size int64) (*operation, error) {
+	return checkInProgressExpand(ctx, m.getInProgressTask(ctx, m.getPersistedOperation(ctx, expandOperationName(volumeID))),
+		volumeID, size)
+}
+
+// checkInProgressExpand returns the operation of the persisted expand of
+// volumeID if it is to size MB. An expand to another size that succeeded is
+// invoked again, while one still queued or running fails the expand with an
+// ExpandInProgressError instead of queuing a second task on vCenter.
+func checkInProgressExpand(ctx context.Context, op *operation, volumeID string, size int64) (*operation, error) {
+	log := logger.GetLogger(ctx)
+	if op == nil || op.capacity == size {
+		return op, nil
+	}
+	if op.state == vim25types.TaskInfoStateSuccess {
+		log.Infof("task %q of operation %q expanded volume %q to %d MB instead of %d MB, invoking the operation again",
+			op.task.Reference().Value, op.name, volumeID, op.capacity, size)
+		return nil, nil
+	}
+	return nil, &ExpandInProgressError{VolumeID: volumeID, CapacityMB: op.capacity, TaskID: op.task.Reference().Value}
+}
+
+// newOperation returns the operation of a task just invoked, after
+// persisting it as in progress.
+func (m *defaultManager) newOperation(ctx context.Context, name string, task *object.Task) *operation {
+	return m.newExpandOperation(ctx, name, task, 0)
+}
+
+// newExpandOperation returns the operation of an expand task just invoked to
+// size MB, after persisting it as in progress.
+func (m *defaultManager) newExpandOperation(ctx context.Context, name string, task *object.Task,
+	size int64) *operation {
+	op := &operation{
+		name:      name,
+		task:      task,
+		invokedAt: metav1.NewTime(time.Now()),
+		capacity:  size,
+	}
+	m.storeOperation(ctx, op, "", "", taskInvocationStatusInProgress, "")
+	return op
+}
+
+// volumeExists returns whether the volume is registered in CNS, querying CNS
+// for it.
+func (m *defaultManager) volumeExists(ctx context.Context, volumeID string) (bool, error) {
+	queryFilter := cnstypes.CnsQueryFilter{
+		VolumeIds: []cnstypes.CnsVolumeId{{Id: volumeID}},
+	}
+	queryResult, err := m.virtualCenter.CnsClient.QueryVolume(ctx, queryFilter)
+	if err != nil {
+		return false, err
+	}
+	return len(queryResult.Volumes) > 0, nil
+}
+
+// deleteVolumeOperations deletes the persisted operations of the deleted
+// volume, so that its create operation isn't mistaken for a volume that
+// still exists. Failures are only logged, volumeExists is checked before
+// reusing a created volume.
+func (m *defaultManager) deleteVolumeOperations(ctx context.Context, volumeID string) {
+	log := logger.GetLogger(ctx)
+	if m.operationStore == nil {
+		return
+	}
+	if err := cnsvolumeoperationrequest.DeleteVolumeRequestDetails(ctx, m.operationStore, volumeID); err != nil {
+		log.Warnf("failed to delete the persisted operations of deleted volume %q. Err: %v", volumeID, err)
+	}
+}
+
+// storeOperation persists the status of the operation. Failures are only
+// logged, the operation store is only needed to recover after a restart.
+func (m *defaultManager) storeOperation(ctx context.Context, op *operation, volumeID string, opID string,
+	status string, errMsg string) {
+	m.storeSnapshotOperation(ctx, op, volumeID, "", opID, status, errMsg)
+}
+
+// storeSnapshotOperation persists the status of the operation, with the ID of
+// the snapshot it created.
+func (m *defaultManager) storeSnapshotOperation(ctx context.Context, op *operation, volumeID string,
+	snapshotID string, opID string, status string, errMsg string) {
+	log := logger.GetLogger(ctx)
+	if m.operationStore == nil || op == nil {
+		return
+	}
+	details := cnsvolumeoperationrequest.CreateVolumeOperationRequestDetails(op.name, volumeID, snapshotID, op.capacity,
+		op.invokedAt, op.task.Reference().Value, opID, status, errMsg)
+	if err := m.operationStore.StoreRequestDetails(ctx, details); err != nil {
+		log.Warnf("failed to persist the status %q of operation %q with task %q. Err: %v",
+			status, op.name, op.task.Reference().Value, err)
+	}
+}
@@ -0,0 +1,198 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/simulator"
+	vim25types "github.com/vmware/govmomi/vim25/types"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	cnsvsphere "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/vsphere"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/internalapis/cnsvolumeoperationrequest"
+)
+
+// fakeOperationStore keeps the latest details of each operation in memory.
+type fakeOperationStore struct {
+	details map[string]*cnsvolumeoperationrequest.VolumeOperationRequestDetails
+}
+
+func (f *fakeOperationStore) GetRequestDetails(ctx context.Context,
+	name string) (*cnsvolumeoperationrequest.VolumeOperationRequestDetails, error) {
+	details, ok := f.details[name]
+	if !ok {
+		return nil, apierrors.NewNotFound(schema.GroupResource{}, name)
+	}
+	return details, nil
+}
+
+func (f *fakeOperationStore) StoreRequestDetails(ctx context.Context,
+	details *cnsvolumeoperationrequest.VolumeOperationRequestDetails) error {
+	f.details[details.Name] = details
+	return nil
+}
+
+// TestGetInProgressTask checks that a persisted task is only waited for while
+// it is known to vCenter and hasn't failed.
+func TestGetInProgressTask(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	model := simulator.VPX()
+	defer model.Remove()
+	if err := model.Create(); err != nil {
+		t.Fatal(err)
+	}
+	model.Service.TLS = new(tls.Config)
+	s := model.Service.NewServer()
+	defer s.Close()
+
+	port, err := strconv.Atoi(s.URL.Port())
+	if err != nil {
+		t.Fatal(err)
+	}
+	password, _ := s.URL.User.Password()
+	vc := &cnsvsphere.VirtualCenter{
+		Config: &cnsvsphere.VirtualCenterConfig{
+			Host:     s.URL.Hostname(),
+			Port:     port,
+			Username: s.URL.User.Username(),
+			Password: password,
+			Insecure: true,
+		},
+	}
+	if err := vc.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	store := &fakeOperationStore{details: make(map[string]*cnsvolumeoperationrequest.VolumeOperationRequestDetails)}
+	m := &defaultManager{virtualCenter: vc}
+	m.SetOperationStore(store)
+
+	finder := find.NewFinder(vc.Client.Client, true)
+	dc, err := finder.DefaultDatacenter(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	finder.SetDatacenter(dc)
+	vm, err := finder.VirtualMachine(ctx, "DC0_H0_VM0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A successful task is waited for to get its result.
+	task, err := vm.PowerOff(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := task.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	m.newOperation(ctx, "op-1", task)
+	op := m.getInProgressTask(ctx, m.getPersistedOperation(ctx, "op-1"))
+	if op == nil || op.task.Reference() != task.Reference() {
+		t.Errorf("expected task %v of op-1 to be waited for, got %+v", task.Reference(), op)
+	}
+
+	// An expand is only waited for if it is to the same size.
+	m.newExpandOperation(ctx, expandOperationName("volume-1"), task, 2048)
+	if op, err := m.getInProgressExpandTask(ctx, "volume-1", 2048); err != nil || op == nil ||
+		op.task.Reference() != task.Reference() {
+		t.Errorf("expected task %v of the expand to be waited for, got %+v, %v", task.Reference(), op, err)
+	}
+	if op, err := m.getInProgressExpandTask(ctx, "volume-1", 4096); err != nil || op != nil {
+		t.Errorf("expected the succeeded expand to another size not to be waited for, got %+v, %v", op, err)
+	}
+
+	// A failed task is invoked again.
+	task, err = vm.PowerOff(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := task.Wait(ctx); err == nil {
+		t.Fatal("expected powering off a powered off VM to fail")
+	}
+	m.newOperation(ctx, "op-2", task)
+	if op := m.getInProgressTask(ctx, m.getPersistedOperation(ctx, "op-2")); op != nil {
+		t.Errorf("expected failed task of op-2 not to be waited for, got %+v", op)
+	}
+
+	// A task unknown to vCenter is invoked again.
+	store.details["op-3"] = cnsvolumeoperationrequest.CreateVolumeOperationRequestDetails("op-3", "", "", 0,
+		store.details["op-1"].OperationDetails.TaskInvocationTimestamp, "task-unknown", "", taskInvocationStatusInProgress, "")
+	if op := m.getInProgressTask(ctx, m.getPersistedOperation(ctx, "op-3")); op != nil {
+		t.Errorf("expected unknown task of op-3 not to be waited for, got %+v", op)
+	}
+
+	// Completed operations aren't waited for.
+	op = &operation{name: "op-1", task: task}
+	m.storeOperation(ctx, op, "", "", taskInvocationStatusSuccess, "")
+	if op := m.getInProgressTask(ctx, m.getPersistedOperation(ctx, "op-1")); op != nil {
+		t.Errorf("expected completed op-1 not to be waited for, got %+v", op)
+	}
+	if details := m.getPersistedOperation(ctx, "op-4"); details != nil {
+		t.Errorf("expected op-4 not to be persisted, got %+v", details)
+	}
+}
+
+// TestCheckInProgressExpand checks that an expand to another size still in
+// progress fails the expand instead of invoking a second task.
+func TestCheckInProgressExpand(t *testing.T) {
+	ctx := context.Background()
+	task := object.NewTask(nil, vim25types.ManagedObjectReference{Type: "Task", Value: "task-1"})
+	for _, state := range []vim25types.TaskInfoState{vim25types.TaskInfoStateQueued, vim25types.TaskInfoStateRunning} {
+		op := &operation{name: expandOperationName("volume-1"), task: task, capacity: 2048, state: state}
+		if found, err := checkInProgressExpand(ctx, op, "volume-1", 2048); err != nil || found != op {
+			t.Errorf("expected the %s expand to the same size to be waited for, got %+v, %v", state, found, err)
+		}
+		found, err := checkInProgressExpand(ctx, op, "volume-1", 4096)
+		var inProgressErr *ExpandInProgressError
+		if found != nil || !errors.As(err, &inProgressErr) {
+			t.Fatalf("expected the %s expand to another size to fail the expand, got %+v, %v", state, found, err)
+		}
+		if inProgressErr.CapacityMB != 2048 || inProgressErr.TaskID != "task-1" {
+			t.Errorf("expected the error to have the expand in progress, got %+v", inProgressErr)
+		}
+	}
+	if found, err := checkInProgressExpand(ctx, nil, "volume-1", 4096); err != nil || found != nil {
+		t.Errorf("expected no expand to be waited for, got %+v, %v", found, err)
+	}
+}
+
+// TestOperationNames checks that the operations of file volumes are persisted
+// under valid object names.
+func TestOperationNames(t *testing.T) {
+	for _, name := range []string{
+		deleteOperationName("file:9AB5F4C2-8E52-4D1A-A2D6-5C8E31B4A1B7"),
+		expandOperationName("file:9ab5f4c2-8e52-4d1a-a2d6-5c8e31b4a1b7"),
+		expandOperationName("7a2f8a6e-4c3b-4f8e-9d1a-0b2c3d4e5f60"),
+	} {
+		if errs := validation.IsDNS1123Subdomain(name); len(errs) != 0 {
+			t.Errorf("expected %q to be a valid object name, got %v", name, errs)
+		}
+	}
+	if name := deleteOperationName("file:9AB5F4C2"); name != "delete-file-9ab5f4c2" {
+		t.Errorf("unexpected operation name %q", name)
+	}
+}
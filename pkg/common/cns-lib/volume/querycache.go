@@ -0,0 +1,94 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	cnstypes "github.com/vmware/govmomi/cns/types"
+
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
+)
+
+// queryResultCacheTTL is how long the result of a CNS volume query is reused
+// by callers reading through the cache.
+var queryResultCacheTTL = 30 * time.Second
+
+// queryResultCacheEntry is a query result cached until expirationTime.
+type queryResultCacheEntry struct {
+	result         *cnstypes.CnsQueryResult
+	expirationTime time.Time
+}
+
+var (
+	// queryResultCache holds the results of CNS volume queries, keyed by
+	// query filter and selection.
+	queryResultCache = make(map[string]queryResultCacheEntry)
+	// queryResultCacheGeneration is incremented on each invalidation, so that
+	// results of queries issued before a volume was mutated aren't cached.
+	queryResultCacheGeneration uint64
+	// queryResultCacheLock protects queryResultCache and queryResultCacheGeneration.
+	queryResultCacheLock = &sync.Mutex{}
+)
+
+// GetCachedQueryResult returns the cached result of the query with the given
+// key, if it hasn't expired yet, along with the current generation of the
+// cache to pass to CacheQueryResult. Cached results are shared, callers must
+// not modify them.
+func GetCachedQueryResult(key string) (*cnstypes.CnsQueryResult, uint64, bool) {
+	queryResultCacheLock.Lock()
+	defer queryResultCacheLock.Unlock()
+	entry, ok := queryResultCache[key]
+	if !ok {
+		return nil, queryResultCacheGeneration, false
+	}
+	if time.Now().After(entry.expirationTime) {
+		delete(queryResultCache, key)
+		return nil, queryResultCacheGeneration, false
+	}
+	return entry.result, queryResultCacheGeneration, true
+}
+
+// CacheQueryResult caches the result of the query with the given key for
+// queryResultCacheTTL, unless the cache was invalidated since generation was
+// returned by GetCachedQueryResult.
+func CacheQueryResult(key string, result *cnstypes.CnsQueryResult, generation uint64) {
+	queryResultCacheLock.Lock()
+	defer queryResultCacheLock.Unlock()
+	if generation != queryResultCacheGeneration {
+		return
+	}
+	queryResultCache[key] = queryResultCacheEntry{
+		result:         result,
+		expirationTime: time.Now().Add(queryResultCacheTTL),
+	}
+}
+
+// InvalidateQueryResultCache drops all cached query results. It is called
+// whenever a volume is mutated.
+func InvalidateQueryResultCache(ctx context.Context) {
+	log := logger.GetLogger(ctx)
+	queryResultCacheLock.Lock()
+	defer queryResultCacheLock.Unlock()
+	queryResultCacheGeneration++
+	if len(queryResultCache) > 0 {
+		log.Debugf("Invalidating %d cached query results", len(queryResultCache))
+		queryResultCache = make(map[string]queryResultCacheEntry)
+	}
+}
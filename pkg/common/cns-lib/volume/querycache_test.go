@@ -0,0 +1,62 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	cnstypes "github.com/vmware/govmomi/cns/types"
+)
+
+func TestQueryResultCache(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	result := &cnstypes.CnsQueryResult{}
+
+	_, generation, found := GetCachedQueryResult("query")
+	if found {
+		t.Fatalf("expected empty cache")
+	}
+	CacheQueryResult("query", result, generation)
+	if cached, _, found := GetCachedQueryResult("query"); !found || cached != result {
+		t.Fatalf("expected cached query result, got %v", cached)
+	}
+
+	// Results of queries issued before an invalidation must not be cached.
+	_, generation, _ = GetCachedQueryResult("other-query")
+	InvalidateQueryResultCache(ctx)
+	if _, _, found := GetCachedQueryResult("query"); found {
+		t.Errorf("expected query result to be invalidated")
+	}
+	CacheQueryResult("other-query", result, generation)
+	if _, _, found := GetCachedQueryResult("other-query"); found {
+		t.Errorf("expected query result issued before invalidation not to be cached")
+	}
+
+	defaultTTL := queryResultCacheTTL
+	defer func() {
+		queryResultCacheTTL = defaultTTL
+	}()
+	queryResultCacheTTL = -time.Second
+	_, generation, _ = GetCachedQueryResult("query")
+	CacheQueryResult("query", result, generation)
+	if _, _, found := GetCachedQueryResult("query"); found {
+		t.Errorf("expected query result to expire")
+	}
+}
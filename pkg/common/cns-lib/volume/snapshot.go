@@ -0,0 +1,435 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	cnstypes "github.com/vmware/govmomi/cns/types"
+	"github.com/vmware/govmomi/object"
+	vim25types "github.com/vmware/govmomi/vim25/types"
+	"github.com/vmware/govmomi/vslm"
+
+	"sigs.k8s.io/vsphere-csi-driver/pkg/common/prometheus"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
+)
+
+// CnsSnapshotInfo describes a snapshot of the FCD of a CNS block volume.
+type CnsSnapshotInfo struct {
+	// SnapshotID is the ID of the FCD snapshot.
+	SnapshotID string
+	// SourceVolumeID is the ID of the volume the snapshot was taken of.
+	SourceVolumeID string
+	// CreationTime is the time the snapshot was taken at.
+	CreationTime time.Time
+	// CapacityInMb is the capacity of the volume when the snapshot was taken,
+	// which a volume restored from it has at least. It is 0 if it isn't known.
+	CapacityInMb int64
+}
+
+// CreateSnapshot creates a snapshot of the block volume, described with the
+// name of the request. The operation is persisted under name, so that a
+// retry of the request returns the snapshot created for it instead of
+// creating another one.
+func (m *defaultManager) CreateSnapshot(ctx context.Context, volumeID string, name string) (*CnsSnapshotInfo, error) {
+	internalCreateSnapshot := func() (*CnsSnapshotInfo, error) {
+		log := logger.GetLogger(ctx)
+		ds, err := m.getVolumeDatastore(ctx, volumeID)
+		if err != nil {
+			return nil, err
+		}
+		err = m.virtualCenter.Connect(ctx)
+		if err != nil {
+			log.Errorf("failed to connect to vCenter %q with err: %v", m.virtualCenter.Config.Host, err)
+			return nil, err
+		}
+		return m.createSnapshot(ctx, ds, volumeID, name)
+	}
+	start := time.Now()
+	resp, err := internalCreateSnapshot()
+	if err != nil {
+		prometheus.CnsControlOpsHistVec.WithLabelValues(prometheus.PrometheusCnsCreateSnapshotOpType,
+			prometheus.PrometheusFailStatus).Observe(time.Since(start).Seconds())
+	} else {
+		prometheus.CnsControlOpsHistVec.WithLabelValues(prometheus.PrometheusCnsCreateSnapshotOpType,
+			prometheus.PrometheusPassStatus).Observe(time.Since(start).Seconds())
+	}
+	return resp, err
+}
+
+// DeleteSnapshot deletes the snapshot snapshotID of the block volume. It
+// succeeds if the snapshot doesn't exist.
+func (m *defaultManager) DeleteSnapshot(ctx context.Context, volumeID string, snapshotID string) error {
+	internalDeleteSnapshot := func() error {
+		log := logger.GetLogger(ctx)
+		ds, err := m.getVolumeDatastore(ctx, volumeID)
+		if err != nil {
+			return err
+		}
+		err = m.virtualCenter.Connect(ctx)
+		if err != nil {
+			log.Errorf("failed to connect to vCenter %q with err: %v", m.virtualCenter.Config.Host, err)
+			return err
+		}
+		return m.deleteSnapshot(ctx, ds, volumeID, snapshotID)
+	}
+	start := time.Now()
+	err := internalDeleteSnapshot()
+	if err != nil {
+		prometheus.CnsControlOpsHistVec.WithLabelValues(prometheus.PrometheusCnsDeleteSnapshotOpType,
+			prometheus.PrometheusFailStatus).Observe(time.Since(start).Seconds())
+	} else {
+		prometheus.CnsControlOpsHistVec.WithLabelValues(prometheus.PrometheusCnsDeleteSnapshotOpType,
+			prometheus.PrometheusPassStatus).Observe(time.Since(start).Seconds())
+	}
+	return err
+}
+
+// QuerySnapshots returns the snapshots of the block volume.
+func (m *defaultManager) QuerySnapshots(ctx context.Context, volumeID string) ([]CnsSnapshotInfo, error) {
+	log := logger.GetLogger(ctx)
+	ds, err := m.getVolumeDatastore(ctx, volumeID)
+	if err != nil {
+		return nil, err
+	}
+	err = m.virtualCenter.Connect(ctx)
+	if err != nil {
+		log.Errorf("failed to connect to vCenter %q with err: %v", m.virtualCenter.Config.Host, err)
+		return nil, err
+	}
+	snapshots, err := m.querySnapshots(ctx, ds, volumeID)
+	if err != nil {
+		return nil, err
+	}
+	snapshotInfos := make([]CnsSnapshotInfo, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		snapshotInfos = append(snapshotInfos, snapshot.CnsSnapshotInfo)
+	}
+	return snapshotInfos, nil
+}
+
+// EnableChangedBlockTracking enables changed block tracking on the FCD of the
+// block volume, unless it is already enabled.
+func (m *defaultManager) EnableChangedBlockTracking(ctx context.Context, volumeID string) error {
+	log := logger.GetLogger(ctx)
+	vStorageObject, err := m.RetrieveVStorageObject(ctx, volumeID)
+	if err != nil {
+		return err
+	}
+	if enabled := vStorageObject.Config.ChangedBlockTrackingEnabled; enabled != nil && *enabled {
+		log.Debugf("Changed block tracking is already enabled on volume %q", volumeID)
+		return nil
+	}
+	backing := vStorageObject.Config.Backing.GetBaseConfigInfoBackingInfo()
+	if backing == nil {
+		return fmt.Errorf("volume %q has no backing datastore", volumeID)
+	}
+	err = m.virtualCenter.Connect(ctx)
+	if err != nil {
+		log.Errorf("failed to connect to vCenter %q with err: %v", m.virtualCenter.Config.Host, err)
+		return err
+	}
+	return EnableChangedBlockTracking(ctx, m.virtualCenter.Client.Client, backing.Datastore, volumeID)
+}
+
+// QueryChangedDiskAreas returns the areas of the FCD of the block volume, from
+// startOffset, which changed between the change ID changeID and the snapshot
+// snapshotID. Use the change ID "*" to get all the allocated areas.
+func (m *defaultManager) QueryChangedDiskAreas(ctx context.Context, volumeID string, snapshotID string,
+	startOffset int64, changeID string) (*vim25types.DiskChangeInfo, error) {
+	log := logger.GetLogger(ctx)
+	ds, err := m.getVolumeDatastore(ctx, volumeID)
+	if err != nil {
+		return nil, err
+	}
+	err = m.virtualCenter.Connect(ctx)
+	if err != nil {
+		log.Errorf("failed to connect to vCenter %q with err: %v", m.virtualCenter.Config.Host, err)
+		return nil, err
+	}
+	return QueryChangedDiskAreas(ctx, m.virtualCenter.Client.Client, ds, volumeID, snapshotID, startOffset,
+		changeID)
+}
+
+// CreateVolumeFromSnapshot creates the block volume of the spec from the
+// snapshot snapshotID of the block volume snapshotVolumeID: an FCD is created
+// from the snapshot, with the storage policy of the spec, registered as the
+// volume and expanded to the capacity of the spec if the snapshot is smaller.
+// The FCD is created on the datastore of the snapshot. The task creating the
+// FCD is persisted under the name of the spec, so that a retry registers the
+// FCD already created instead of creating another one.
+func (m *defaultManager) CreateVolumeFromSnapshot(ctx context.Context, spec *cnstypes.CnsVolumeCreateSpec,
+	snapshotVolumeID string, snapshotID string) (*CnsVolumeInfo, error) {
+	log := logger.GetLogger(ctx)
+	ds, err := m.getVolumeDatastore(ctx, snapshotVolumeID)
+	if err != nil {
+		return nil, err
+	}
+	err = m.virtualCenter.Connect(ctx)
+	if err != nil {
+		log.Errorf("failed to connect to vCenter %q with err: %v", m.virtualCenter.Config.Host, err)
+		return nil, err
+	}
+	diskID, err := m.createDisk(ctx, prometheus.PrometheusCnsCreateVolumeFromSnapshotOpType, spec.Name,
+		fmt.Sprintf("snapshot %q of volume %q", snapshotID, snapshotVolumeID), func() (*object.Task, error) {
+			return CreateDiskFromSnapshot(ctx, m.virtualCenter.Client.Client, ds, snapshotVolumeID, snapshotID,
+				spec.Name, spec.Profile)
+		})
+	if err != nil {
+		return nil, err
+	}
+	volumeInfo, err := m.registerDisk(ctx, spec, diskID)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("CreateVolumeFromSnapshot: Created volume %q from snapshot %q of volume %q", diskID, snapshotID,
+		snapshotVolumeID)
+	return volumeInfo, nil
+}
+
+// registerDisk registers the FCD diskID, created for the volume of the spec,
+// as the volume and expands it to the capacity of the spec if it is smaller.
+// The policy and datastore of the FCD were set when it was created.
+func (m *defaultManager) registerDisk(ctx context.Context, spec *cnstypes.CnsVolumeCreateSpec,
+	diskID string) (*CnsVolumeInfo, error) {
+	log := logger.GetLogger(ctx)
+	var capacityInMb int64
+	if spec.BackingObjectDetails != nil {
+		capacityInMb = spec.BackingObjectDetails.GetCnsBackingObjectDetails().CapacityInMb
+	}
+	registerSpec := *spec
+	registerSpec.Datastores = nil
+	registerSpec.Profile = nil
+	registerSpec.BackingObjectDetails = &cnstypes.CnsBlockBackingDetails{BackingDiskId: diskID}
+	volumeInfo, err := m.CreateVolume(ctx, &registerSpec)
+	if err != nil {
+		log.Errorf("failed to register disk %q as volume %q. err: %v", diskID, spec.Name, err)
+		return nil, err
+	}
+	vStorageObject, err := m.RetrieveVStorageObject(ctx, diskID)
+	if err != nil {
+		return nil, err
+	}
+	if vStorageObject.Config.CapacityInMB < capacityInMb {
+		log.Infof("Expanding volume %q from %d MB to %d MB", diskID, vStorageObject.Config.CapacityInMB, capacityInMb)
+		if err = m.ExpandVolume(ctx, diskID, capacityInMb); err != nil {
+			return nil, err
+		}
+	}
+	return volumeInfo, nil
+}
+
+// getVolumeDatastore returns the datastore of the FCD of the volume, which
+// the vCenter snapshot APIs of the FCD take.
+func (m *defaultManager) getVolumeDatastore(ctx context.Context,
+	volumeID string) (vim25types.ManagedObjectReference, error) {
+	vStorageObject, err := m.RetrieveVStorageObject(ctx, volumeID)
+	if err != nil {
+		return vim25types.ManagedObjectReference{}, err
+	}
+	backing := vStorageObject.Config.Backing.GetBaseConfigInfoBackingInfo()
+	if backing == nil {
+		return vim25types.ManagedObjectReference{}, fmt.Errorf("volume %q has no backing datastore", volumeID)
+	}
+	return backing.Datastore, nil
+}
+
+// createSnapshot creates the snapshot of the FCD of the volume on datastore
+// ds for the request name, unless it was already created: the persisted
+// snapshot of a successful operation is returned if it still exists, the
+// persisted task of an operation in progress is waited for and a snapshot
+// already described with name, whose operation wasn't persisted, is reused.
+func (m *defaultManager) createSnapshot(ctx context.Context, ds vim25types.ManagedObjectReference,
+	volumeID string, name string) (*CnsSnapshotInfo, error) {
+	log := logger.GetLogger(ctx)
+	snapshots, err := m.querySnapshots(ctx, ds, volumeID)
+	if err != nil {
+		return nil, err
+	}
+	details := m.getPersistedOperation(ctx, name)
+	if details != nil && details.OperationDetails.TaskStatus == taskInvocationStatusSuccess &&
+		details.VolumeID == volumeID && details.SnapshotID != "" {
+		if snapshot := findSnapshot(snapshots, details.SnapshotID); snapshot != nil {
+			log.Infof("Snapshot %q of volume %q was already created for %q", snapshot.SnapshotID, volumeID, name)
+			return snapshot, nil
+		}
+	}
+	op := m.getInProgressTask(ctx, details)
+	if op == nil {
+		for i := range snapshots {
+			if snapshots[i].description == name {
+				log.Infof("Found snapshot %q of volume %q described with %q, reusing it",
+					snapshots[i].SnapshotID, volumeID, name)
+				return &snapshots[i].CnsSnapshotInfo, nil
+			}
+		}
+		var task *object.Task
+		task, err = vslm.NewObjectManager(m.virtualCenter.Client.Client).CreateSnapshot(ctx, ds, volumeID, name)
+		if err != nil {
+			log.Errorf("failed to create a snapshot of volume %q from vCenter %q with err: %v", volumeID,
+				m.virtualCenter.Config.Host, err)
+			return nil, err
+		}
+		op = m.newOperation(ctx, name, task)
+	}
+	taskInfo, err := waitForTask(ctx, prometheus.PrometheusCnsCreateSnapshotOpType, op.task)
+	if err != nil {
+		msg := fmt.Sprintf("failed to create a snapshot of volume %q for %q. err: %v", volumeID, name, err)
+		log.Error(msg)
+		if taskInfo != nil {
+			m.storeOperation(ctx, op, volumeID, taskInfo.ActivationId, taskInvocationStatusError, msg)
+		}
+		return nil, err
+	}
+	snapshotID, err := getSnapshotID(taskInfo.Result, volumeID)
+	if err != nil {
+		return nil, err
+	}
+	m.storeSnapshotOperation(ctx, op, volumeID, snapshotID, taskInfo.ActivationId, taskInvocationStatusSuccess, "")
+	log.Infof("CreateSnapshot: Created snapshot %q of volume %q for %q, opId: %q", snapshotID, volumeID, name,
+		taskInfo.ActivationId)
+	snapshot := &CnsSnapshotInfo{
+		SnapshotID:     snapshotID,
+		SourceVolumeID: volumeID,
+		CreationTime:   time.Now(),
+	}
+	if snapshots, err = m.querySnapshots(ctx, ds, volumeID); err == nil {
+		if created := findSnapshot(snapshots, snapshotID); created != nil {
+			snapshot = created
+		}
+	}
+	if snapshot.CapacityInMb == 0 {
+		// vCenter doesn't report the capacity of the snapshot, which is the
+		// capacity of the volume it was just taken of.
+		if vStorageObject, err := m.RetrieveVStorageObject(ctx, volumeID); err == nil {
+			snapshot.CapacityInMb = vStorageObject.Config.CapacityInMB
+		}
+	}
+	return snapshot, nil
+}
+
+// createDisk invokes the task of the CNS operation opType creating the FCD
+// name from source, described in logs and errors, and returns the ID of the
+// FCD, unless it was already created: the FCD of a successful operation is
+// returned and the persisted task of an operation in progress is waited for.
+func (m *defaultManager) createDisk(ctx context.Context, opType string, name string, source string,
+	invoke func() (*object.Task, error)) (string, error) {
+	log := logger.GetLogger(ctx)
+	details := m.getPersistedOperation(ctx, name)
+	if details != nil && details.OperationDetails.TaskStatus == taskInvocationStatusSuccess && details.VolumeID != "" {
+		log.Infof("Disk %q was already created from %s for %q", details.VolumeID, source, name)
+		return details.VolumeID, nil
+	}
+	op := m.getInProgressTask(ctx, details)
+	if op == nil {
+		task, err := invoke()
+		if err != nil {
+			return "", err
+		}
+		op = m.newOperation(ctx, name, task)
+	}
+	taskInfo, err := waitForTask(ctx, opType, op.task)
+	if err != nil {
+		msg := fmt.Sprintf("failed to create disk %q from %s. err: %v", name, source, err)
+		log.Error(msg)
+		if taskInfo != nil {
+			m.storeOperation(ctx, op, "", taskInfo.ActivationId, taskInvocationStatusError, msg)
+		}
+		return "", err
+	}
+	var diskID string
+	switch vStorageObject := taskInfo.Result.(type) {
+	case vim25types.VStorageObject:
+		diskID = vStorageObject.Config.Id.Id
+	case *vim25types.VStorageObject:
+		diskID = vStorageObject.Config.Id.Id
+	default:
+		return "", fmt.Errorf("unexpected result %T of the disk created from %s", taskInfo.Result, source)
+	}
+	m.storeOperation(ctx, op, diskID, taskInfo.ActivationId, taskInvocationStatusSuccess, "")
+	log.Infof("Created disk %q from %s for %q, opId: %q", diskID, source, name, taskInfo.ActivationId)
+	return diskID, nil
+}
+
+// deleteSnapshot deletes the snapshot snapshotID of the FCD of the volume on
+// datastore ds if it exists.
+func (m *defaultManager) deleteSnapshot(ctx context.Context, ds vim25types.ManagedObjectReference,
+	volumeID string, snapshotID string) error {
+	log := logger.GetLogger(ctx)
+	snapshots, err := m.querySnapshots(ctx, ds, volumeID)
+	if err != nil {
+		return err
+	}
+	if findSnapshot(snapshots, snapshotID) == nil {
+		log.Infof("Snapshot %q of volume %q not found, assuming it was deleted", snapshotID, volumeID)
+		return nil
+	}
+	return DeleteSnapshot(ctx, m.virtualCenter.Client.Client, ds, volumeID, snapshotID)
+}
+
+// fcdSnapshot is a snapshot of an FCD with its description.
+type fcdSnapshot struct {
+	CnsSnapshotInfo
+	description string
+}
+
+// querySnapshots returns the snapshots of the FCD of the volume on datastore
+// ds, with their capacity if vCenter reports it.
+func (m *defaultManager) querySnapshots(ctx context.Context, ds vim25types.ManagedObjectReference,
+	volumeID string) ([]fcdSnapshot, error) {
+	log := logger.GetLogger(ctx)
+	info, err := vslm.NewObjectManager(m.virtualCenter.Client.Client).RetrieveSnapshotInfo(ctx, ds, volumeID)
+	if err != nil {
+		log.Errorf("failed to retrieve the snapshots of volume %q from vCenter %q with err: %v", volumeID,
+			m.virtualCenter.Config.Host, err)
+		return nil, err
+	}
+	var snapshots []fcdSnapshot
+	for _, snapshot := range info.Snapshots {
+		if snapshot.Id == nil {
+			continue
+		}
+		capacityInMb, err := RetrieveSnapshotCapacity(ctx, m.virtualCenter.Client.Client, ds, volumeID,
+			snapshot.Id.Id)
+		if err != nil {
+			log.Warnf("Capacity of snapshot %q of volume %q is not known. err: %v", snapshot.Id.Id, volumeID, err)
+		}
+		snapshots = append(snapshots, fcdSnapshot{
+			CnsSnapshotInfo: CnsSnapshotInfo{
+				SnapshotID:     snapshot.Id.Id,
+				SourceVolumeID: volumeID,
+				CreationTime:   snapshot.CreateTime,
+				CapacityInMb:   capacityInMb,
+			},
+			description: snapshot.Description,
+		})
+	}
+	return snapshots, nil
+}
+
+// findSnapshot returns the snapshot with the given ID, or nil if there is
+// none.
+func findSnapshot(snapshots []fcdSnapshot, snapshotID string) *CnsSnapshotInfo {
+	for i := range snapshots {
+		if snapshots[i].SnapshotID == snapshotID {
+			return &snapshots[i].CnsSnapshotInfo
+		}
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"context"
+	"crypto/tls"
+	"strconv"
+	"testing"
+
+	"github.com/vmware/govmomi/simulator"
+	vimtypes "github.com/vmware/govmomi/vim25/types"
+	"github.com/vmware/govmomi/vslm"
+
+	cnsvsphere "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/vsphere"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/internalapis/cnsvolumeoperationrequest"
+)
+
+// TestCreateSnapshot checks that a retried snapshot request returns the
+// snapshot created for it, and that deleting a snapshot is idempotent.
+func TestCreateSnapshot(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	model := simulator.VPX()
+	defer model.Remove()
+	if err := model.Create(); err != nil {
+		t.Fatal(err)
+	}
+	model.Service.TLS = new(tls.Config)
+	s := model.Service.NewServer()
+	defer s.Close()
+
+	port, err := strconv.Atoi(s.URL.Port())
+	if err != nil {
+		t.Fatal(err)
+	}
+	password, _ := s.URL.User.Password()
+	vc := &cnsvsphere.VirtualCenter{
+		Config: &cnsvsphere.VirtualCenterConfig{
+			Host:     s.URL.Hostname(),
+			Port:     port,
+			Username: s.URL.User.Username(),
+			Password: password,
+			Insecure: true,
+		},
+	}
+	if err := vc.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	store := &fakeOperationStore{details: make(map[string]*cnsvolumeoperationrequest.VolumeOperationRequestDetails)}
+	m := &defaultManager{virtualCenter: vc}
+	m.SetOperationStore(store)
+
+	ds := simulator.Map.Any("Datastore").Reference()
+	task, err := vslm.NewObjectManager(vc.Client.Client).CreateDisk(ctx, vimtypes.VslmCreateSpec{
+		Name:         "vol",
+		CapacityInMB: 10,
+		BackingSpec: &vimtypes.VslmCreateSpecDiskFileBackingSpec{
+			VslmCreateSpecBackingSpec: vimtypes.VslmCreateSpecBackingSpec{Datastore: ds},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	taskInfo, err := task.WaitForResult(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	volumeID := taskInfo.Result.(vimtypes.VStorageObject).Config.Id.Id
+
+	snapshot, err := m.createSnapshot(ctx, ds, volumeID, "snapshot-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if details := store.details["snapshot-1"]; details == nil || details.SnapshotID != snapshot.SnapshotID ||
+		details.OperationDetails.TaskStatus != taskInvocationStatusSuccess {
+		t.Errorf("expected snapshot %s of snapshot-1 to be persisted, got %+v", snapshot.SnapshotID, details)
+	}
+	// A retry returns the persisted snapshot.
+	retried, err := m.createSnapshot(ctx, ds, volumeID, "snapshot-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retried.SnapshotID != snapshot.SnapshotID {
+		t.Errorf("expected retry to return snapshot %s, got %s", snapshot.SnapshotID, retried.SnapshotID)
+	}
+	// Without the persisted operation, the snapshot is found by its
+	// description.
+	delete(store.details, "snapshot-1")
+	retried, err = m.createSnapshot(ctx, ds, volumeID, "snapshot-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retried.SnapshotID != snapshot.SnapshotID {
+		t.Errorf("expected retry to return snapshot %s, got %s", snapshot.SnapshotID, retried.SnapshotID)
+	}
+	other, err := m.createSnapshot(ctx, ds, volumeID, "snapshot-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshots, err := m.querySnapshots(ctx, ds, volumeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 2 || other.SnapshotID == snapshot.SnapshotID {
+		t.Fatalf("expected 2 snapshots, got %+v", snapshots)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := m.deleteSnapshot(ctx, ds, volumeID, snapshot.SnapshotID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if snapshots, err = m.querySnapshots(ctx, ds, volumeID); err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 1 || snapshots[0].SnapshotID != other.SnapshotID {
+		t.Errorf("expected only snapshot %s to be left, got %+v", other.SnapshotID, snapshots)
+	}
+}
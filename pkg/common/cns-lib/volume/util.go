@@ -19,9 +19,16 @@ package volume
 import (
 	"context"
 	"errors"
+	"fmt"
 
 	"github.com/vmware/govmomi/cns"
 	cnstypes "github.com/vmware/govmomi/cns/types"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vapi/tags"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/methods"
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vslm"
 
 	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
 
@@ -66,6 +73,536 @@ func IsDiskAttached(ctx context.Context, vm *cnsvsphere.VirtualMachine, volumeID
 	return "", nil
 }
 
+// SetDiskIOAllocation sets the storage I/O allocation of the virtual disk of
+// the volume attached to the VM, unless it is already set.
+func SetDiskIOAllocation(ctx context.Context, vm *cnsvsphere.VirtualMachine, volumeID string,
+	allocation *vimtypes.StorageIOAllocationInfo) error {
+	log := logger.GetLogger(ctx)
+	vmDevices, err := vm.Device(ctx)
+	if err != nil {
+		log.Errorf("failed to get devices from vm: %s", vm.InventoryPath)
+		return err
+	}
+	for _, device := range vmDevices {
+		virtualDisk, ok := device.(*vimtypes.VirtualDisk)
+		if !ok || virtualDisk.VDiskId == nil || virtualDisk.VDiskId.Id != volumeID {
+			continue
+		}
+		current := virtualDisk.StorageIOAllocation
+		if current == nil {
+			current = &vimtypes.StorageIOAllocationInfo{}
+		}
+		limitSet := allocation.Limit == nil || (current.Limit != nil && *current.Limit == *allocation.Limit)
+		sharesSet := allocation.Shares == nil || (current.Shares != nil && current.Shares.Level == allocation.Shares.Level &&
+			(allocation.Shares.Level != vimtypes.SharesLevelCustom || current.Shares.Shares == allocation.Shares.Shares))
+		if limitSet && sharesSet {
+			log.Debugf("Storage I/O allocation of volume %s on vm %s is already set", volumeID, vm.String())
+			return nil
+		}
+		if allocation.Limit != nil {
+			current.Limit = allocation.Limit
+		}
+		if allocation.Shares != nil {
+			current.Shares = allocation.Shares
+		}
+		virtualDisk.StorageIOAllocation = current
+		if err := vm.EditDevice(ctx, virtualDisk); err != nil {
+			log.Errorf("failed to set the storage I/O allocation of volume %s on vm %s. err: %v", volumeID, vm.String(), err)
+			return err
+		}
+		log.Infof("Set the storage I/O allocation of volume %s on vm %s", volumeID, vm.String())
+		return nil
+	}
+	return fmt.Errorf("volume %s is not attached to vm %s", volumeID, vm.String())
+}
+
+// maxSCSIControllersPerVM is the number of SCSI controllers a VM supports.
+const maxSCSIControllersPerVM = 4
+
+// maxDevicesPerSCSIController is the number of devices a SCSI controller
+// supports, unit 7 being reserved for the controller itself.
+const maxDevicesPerSCSIController = 15
+
+// AddSCSIControllerIfFull hot-adds a paravirtual SCSI controller to the VM if
+// all its paravirtual SCSI controllers have the maximum number of devices,
+// unless the VM has the maximum number of SCSI controllers. It returns true if
+// a controller was added.
+func AddSCSIControllerIfFull(ctx context.Context, vm *cnsvsphere.VirtualMachine) (bool, error) {
+	log := logger.GetLogger(ctx)
+	vmDevices, err := vm.Device(ctx)
+	if err != nil {
+		log.Errorf("failed to get devices from vm: %s", vm.InventoryPath)
+		return false, err
+	}
+	controllers := vmDevices.SelectByType((*vimtypes.VirtualSCSIController)(nil))
+	if len(controllers) >= maxSCSIControllersPerVM {
+		log.Debugf("vm %s already has %d SCSI controllers", vm.String(), len(controllers))
+		return false, nil
+	}
+	devicesByController := make(map[int32]int)
+	for _, device := range vmDevices {
+		devicesByController[device.GetVirtualDevice().ControllerKey]++
+	}
+	pvscsiControllers := 0
+	for _, controller := range controllers {
+		if _, ok := controller.(*vimtypes.ParaVirtualSCSIController); !ok {
+			continue
+		}
+		pvscsiControllers++
+		if devicesByController[controller.GetVirtualDevice().Key] < maxDevicesPerSCSIController {
+			return false, nil
+		}
+	}
+	if pvscsiControllers == 0 {
+		return false, nil
+	}
+	controller, err := vmDevices.CreateSCSIController("pvscsi")
+	if err != nil {
+		log.Errorf("failed to create a paravirtual SCSI controller for vm %s. err: %v", vm.String(), err)
+		return false, err
+	}
+	if err = vm.AddDevice(ctx, controller); err != nil {
+		log.Errorf("failed to add a paravirtual SCSI controller to vm %s. err: %v", vm.String(), err)
+		return false, err
+	}
+	log.Infof("Added paravirtual SCSI controller on bus %d to vm %s, its other paravirtual SCSI controllers are full",
+		controller.(vimtypes.BaseVirtualSCSIController).GetVirtualSCSIController().BusNumber, vm.String())
+	return true, nil
+}
+
+// maxNVMeControllersPerVM is the number of NVMe controllers a VM supports.
+const maxNVMeControllersPerVM = 4
+
+// maxDevicesPerNVMeController is the number of disks an NVMe controller
+// supports.
+const maxDevicesPerNVMeController = 15
+
+// AttachVolumeWithPlacement attaches the FCD of the volume on the datastore
+// with the given URL to a controller of the VM of controllerType, pvscsi or
+// nvme, and returns the UUID of its virtual disk. Volumes fill the first
+// controller with a free unit, or go to the controller with the fewest disks
+// if spread is set, and a controller is hot-added when needed. It is a no-op
+// if the volume is already attached to the VM.
+func AttachVolumeWithPlacement(ctx context.Context, vm *cnsvsphere.VirtualMachine, volumeID string,
+	datastoreURL string, controllerType string, spread bool) (string, error) {
+	log := logger.GetLogger(ctx)
+	diskUUID, err := IsDiskAttached(ctx, vm, volumeID)
+	if err != nil || diskUUID != "" {
+		return diskUUID, err
+	}
+	vmDevices, err := vm.Device(ctx)
+	if err != nil {
+		log.Errorf("failed to get devices from vm: %s", vm.InventoryPath)
+		return "", err
+	}
+	controller, unitNumber, addController := selectDiskController(vmDevices, controllerType, spread)
+	if addController {
+		var newController vimtypes.BaseVirtualDevice
+		if controllerType == "nvme" {
+			newController, err = vmDevices.CreateNVMEController()
+		} else {
+			newController, err = vmDevices.CreateSCSIController("pvscsi")
+		}
+		if err != nil {
+			log.Errorf("failed to create a %s controller for vm %s. err: %v", controllerType, vm.String(), err)
+			return "", err
+		}
+		if err = vm.AddDevice(ctx, newController); err != nil {
+			log.Errorf("failed to add a %s controller to vm %s. err: %v", controllerType, vm.String(), err)
+			return "", err
+		}
+		log.Infof("Added %s controller to vm %s to attach volume %s", controllerType, vm.String(), volumeID)
+		if vmDevices, err = vm.Device(ctx); err != nil {
+			log.Errorf("failed to get devices from vm: %s", vm.InventoryPath)
+			return "", err
+		}
+		controller, unitNumber, _ = selectDiskController(vmDevices, controllerType, spread)
+	}
+	if controller == nil {
+		return "", fmt.Errorf("no %s controller of vm %s has a free unit to attach volume %s",
+			controllerType, vm.String(), volumeID)
+	}
+	datastore, err := vm.Datacenter.GetDatastoreByURL(ctx, datastoreURL)
+	if err != nil {
+		log.Errorf("failed to get datastore %s of volume %s. err: %v", datastoreURL, volumeID, err)
+		return "", err
+	}
+	controllerKey := controller.GetVirtualController().Key
+	if err = vm.AttachDisk(ctx, volumeID, datastore.Datastore, controllerKey, unitNumber); err != nil {
+		log.Errorf("failed to attach volume %s to controller %d unit %d of vm %s. err: %v",
+			volumeID, controllerKey, unitNumber, vm.String(), err)
+		return "", err
+	}
+	log.Infof("Attached volume %s to %s controller %d unit %d of vm %s",
+		volumeID, controllerType, controllerKey, unitNumber, vm.String())
+	return IsDiskAttached(ctx, vm, volumeID)
+}
+
+// selectDiskController returns the controller of controllerType among the
+// devices of a VM, and its free unit, a disk is attached to. It returns true
+// instead if a controller should be added first, filling the controllers
+// before adding one, or adding one unless a controller has no disk if spread.
+func selectDiskController(vmDevices object.VirtualDeviceList, controllerType string,
+	spread bool) (vimtypes.BaseVirtualController, int32, bool) {
+	var controllers []vimtypes.BaseVirtualController
+	canAdd := false
+	maxDevices := maxDevicesPerSCSIController
+	if controllerType == "nvme" {
+		for _, device := range vmDevices.SelectByType((*vimtypes.VirtualNVMEController)(nil)) {
+			controllers = append(controllers, device.(vimtypes.BaseVirtualController))
+		}
+		canAdd = len(controllers) < maxNVMeControllersPerVM
+		maxDevices = maxDevicesPerNVMeController
+	} else {
+		scsiControllers := vmDevices.SelectByType((*vimtypes.VirtualSCSIController)(nil))
+		for _, device := range scsiControllers {
+			if controller, ok := device.(*vimtypes.ParaVirtualSCSIController); ok {
+				controllers = append(controllers, controller)
+			}
+		}
+		canAdd = len(scsiControllers) < maxSCSIControllersPerVM
+	}
+	usedUnits := make(map[int32]map[int32]bool)
+	for _, device := range vmDevices {
+		virtualDevice := device.GetVirtualDevice()
+		if virtualDevice.UnitNumber == nil {
+			continue
+		}
+		if usedUnits[virtualDevice.ControllerKey] == nil {
+			usedUnits[virtualDevice.ControllerKey] = make(map[int32]bool)
+		}
+		usedUnits[virtualDevice.ControllerKey][*virtualDevice.UnitNumber] = true
+	}
+	freeUnit := func(controller vimtypes.BaseVirtualController) (int32, bool) {
+		used := usedUnits[controller.GetVirtualController().Key]
+		if len(used) >= maxDevices {
+			return 0, false
+		}
+		units := int32(maxDevices)
+		if controllerType != "nvme" {
+			// Unit 7 of SCSI controllers is the controller itself.
+			units++
+		}
+		for unit := int32(0); unit < units; unit++ {
+			if !used[unit] && (controllerType == "nvme" || unit != 7) {
+				return unit, true
+			}
+		}
+		return 0, false
+	}
+
+	var selected vimtypes.BaseVirtualController
+	for _, controller := range controllers {
+		if _, ok := freeUnit(controller); !ok {
+			continue
+		}
+		if !spread {
+			selected = controller
+			break
+		}
+		if selected == nil || len(usedUnits[controller.GetVirtualController().Key]) <
+			len(usedUnits[selected.GetVirtualController().Key]) {
+			selected = controller
+		}
+	}
+	if selected == nil || (spread && canAdd && len(usedUnits[selected.GetVirtualController().Key]) > 0) {
+		return nil, 0, canAdd
+	}
+	unit, _ := freeUnit(selected)
+	return selected, unit, false
+}
+
+// SetVolumeTags makes the tags of the given categories attached to the FCD of
+// the volume match volumeTags, mapping a category name to the name of the tag
+// to attach in it. Missing categories and tags are created, tags of the given
+// categories not in volumeTags are detached and other tags are left as is.
+func SetVolumeTags(ctx context.Context, client *vim25.Client, tagManager *tags.Manager, volumeID string,
+	categories []string, volumeTags map[string]string) error {
+	log := logger.GetLogger(ctx)
+	objectManager := vslm.NewObjectManager(client)
+	attachedTags, err := objectManager.ListAttachedTags(ctx, volumeID)
+	if err != nil {
+		log.Errorf("failed to list the tags attached to volume %s. err: %v", volumeID, err)
+		return err
+	}
+	attached := make(map[string]string)
+	for _, attachedTag := range attachedTags {
+		attached[attachedTag.ParentCategoryName] = attachedTag.TagName
+	}
+	for _, category := range categories {
+		tagName, wanted := volumeTags[category]
+		attachedTagName, isAttached := attached[category]
+		if isAttached && (!wanted || attachedTagName != tagName) {
+			if err := objectManager.DetachTag(ctx, volumeID, vimtypes.VslmTagEntry{
+				ParentCategoryName: category, TagName: attachedTagName}); err != nil {
+				log.Errorf("failed to detach tag %s:%s from volume %s. err: %v", category, attachedTagName, volumeID, err)
+				return err
+			}
+			log.Infof("Detached tag %s:%s from volume %s", category, attachedTagName, volumeID)
+		}
+		if !wanted || (isAttached && attachedTagName == tagName) {
+			continue
+		}
+		if err := ensureTag(ctx, tagManager, category, tagName); err != nil {
+			return err
+		}
+		if err := objectManager.AttachTag(ctx, volumeID, vimtypes.VslmTagEntry{
+			ParentCategoryName: category, TagName: tagName}); err != nil {
+			log.Errorf("failed to attach tag %s:%s to volume %s. err: %v", category, tagName, volumeID, err)
+			return err
+		}
+		log.Infof("Attached tag %s:%s to volume %s", category, tagName, volumeID)
+	}
+	return nil
+}
+
+// ensureTag creates the tag in the category if it doesn't exist yet, and the
+// category with a single tag per object if it doesn't exist either.
+func ensureTag(ctx context.Context, tagManager *tags.Manager, categoryName string, tagName string) error {
+	log := logger.GetLogger(ctx)
+	// The categories and their tags are listed rather than looked up by name,
+	// as the lookups fail the same way whether the object is missing or the
+	// request failed, and only a missing object has to be created.
+	categories, err := tagManager.GetCategories(ctx)
+	if err != nil {
+		log.Errorf("failed to list the tag categories. err: %v", err)
+		return err
+	}
+	var categoryID string
+	for _, category := range categories {
+		if category.Name == categoryName {
+			categoryID = category.ID
+			break
+		}
+	}
+	if categoryID == "" {
+		log.Infof("Creating tag category %s", categoryName)
+		categoryID, err = tagManager.CreateCategory(ctx, &tags.Category{
+			Name:        categoryName,
+			Description: "Kubernetes volume label " + categoryName,
+			Cardinality: "SINGLE",
+		})
+		if err != nil {
+			log.Errorf("failed to create tag category %s. err: %v", categoryName, err)
+			return err
+		}
+	}
+	categoryTags, err := tagManager.GetTagsForCategory(ctx, categoryID)
+	if err != nil {
+		log.Errorf("failed to list the tags of category %s. err: %v", categoryName, err)
+		return err
+	}
+	for _, tag := range categoryTags {
+		if tag.Name == tagName {
+			return nil
+		}
+	}
+	log.Infof("Creating tag %s:%s", categoryName, tagName)
+	if _, err := tagManager.CreateTag(ctx, &tags.Tag{Name: tagName, CategoryID: categoryID}); err != nil {
+		log.Errorf("failed to create tag %s:%s. err: %v", categoryName, tagName, err)
+		return err
+	}
+	return nil
+}
+
+// getSnapshotID returns the snapshot ID in the result of the task creating a
+// snapshot of the FCD of the volume.
+func getSnapshotID(result vimtypes.AnyType, volumeID string) (string, error) {
+	switch id := result.(type) {
+	case vimtypes.ID:
+		return id.Id, nil
+	case *vimtypes.ID:
+		return id.Id, nil
+	default:
+		return "", fmt.Errorf("unexpected result %T of the snapshot of volume %s", result, volumeID)
+	}
+}
+
+// CreateDiskFromSnapshot invokes the task creating the FCD name, with the
+// storage policy of profile, from the snapshot snapshotID of the FCD of the
+// volume on datastore ds. The result of the task is the VStorageObject of the
+// new FCD.
+func CreateDiskFromSnapshot(ctx context.Context, client *vim25.Client, ds vimtypes.ManagedObjectReference,
+	volumeID string, snapshotID string, name string, profile []vimtypes.BaseVirtualMachineProfileSpec) (
+	*object.Task, error) {
+	log := logger.GetLogger(ctx)
+	req := vimtypes.CreateDiskFromSnapshot_Task{
+		This:       *client.ServiceContent.VStorageObjectManager,
+		Id:         vimtypes.ID{Id: volumeID},
+		Datastore:  ds,
+		SnapshotId: vimtypes.ID{Id: snapshotID},
+		Name:       name,
+		Profile:    profile,
+	}
+	res, err := methods.CreateDiskFromSnapshot_Task(ctx, client, &req)
+	if err != nil {
+		log.Errorf("failed to create disk %s from snapshot %s of volume %s. err: %v", name, snapshotID, volumeID, err)
+		return nil, err
+	}
+	return object.NewTask(client, res.Returnval), nil
+}
+
+// CloneDisk invokes the task creating the FCD name, with the storage policy
+// of profile, on datastore target as a clone of the FCD of the volume on
+// datastore ds. The result of the task is the VStorageObject of the new FCD.
+func CloneDisk(ctx context.Context, client *vim25.Client, ds vimtypes.ManagedObjectReference, volumeID string,
+	target vimtypes.ManagedObjectReference, name string, profile []vimtypes.BaseVirtualMachineProfileSpec) (
+	*object.Task, error) {
+	log := logger.GetLogger(ctx)
+	task, err := vslm.NewObjectManager(client).Clone(ctx, ds, volumeID, vimtypes.VslmCloneSpec{
+		Name: name,
+		VslmMigrateSpec: vimtypes.VslmMigrateSpec{
+			BackingSpec: &vimtypes.VslmCreateSpecDiskFileBackingSpec{
+				VslmCreateSpecBackingSpec: vimtypes.VslmCreateSpecBackingSpec{Datastore: target},
+			},
+			Profile: profile,
+		},
+	})
+	if err != nil {
+		log.Errorf("failed to clone volume %s to disk %s. err: %v", volumeID, name, err)
+		return nil, err
+	}
+	return task, nil
+}
+
+// DeleteSnapshot deletes the snapshot snapshotID of the FCD of the volume on
+// datastore ds.
+func DeleteSnapshot(ctx context.Context, client *vim25.Client, ds vimtypes.ManagedObjectReference, volumeID string,
+	snapshotID string) error {
+	log := logger.GetLogger(ctx)
+	task, err := vslm.NewObjectManager(client).DeleteSnapshot(ctx, ds, volumeID, snapshotID)
+	if err == nil {
+		err = task.Wait(ctx)
+	}
+	if err != nil {
+		log.Errorf("failed to delete snapshot %s of volume %s. err: %v", snapshotID, volumeID, err)
+		return err
+	}
+	log.Infof("Deleted snapshot %s of volume %s", snapshotID, volumeID)
+	return nil
+}
+
+// snapshotDetails are the VStorageObjectSnapshotDetails with the capacity of
+// the snapshot, which vCenter reports from vSphere 7.0U3 on and the vim25
+// types don't decode yet.
+type snapshotDetails struct {
+	vimtypes.VStorageObjectSnapshotDetails
+	CapacityInMB int64 `xml:"capacityInMB,omitempty"`
+}
+
+type retrieveSnapshotDetailsResponse struct {
+	Returnval snapshotDetails `xml:"returnval"`
+}
+
+type retrieveSnapshotDetailsBody struct {
+	Req    *vimtypes.RetrieveSnapshotDetails `xml:"urn:vim25 RetrieveSnapshotDetails,omitempty"`
+	Res    *retrieveSnapshotDetailsResponse  `xml:"RetrieveSnapshotDetailsResponse,omitempty"`
+	Fault_ *soap.Fault                       `xml:"http://schemas.xmlsoap.org/soap/envelope/ Fault,omitempty"`
+}
+
+func (b *retrieveSnapshotDetailsBody) Fault() *soap.Fault { return b.Fault_ }
+
+// RetrieveSnapshotCapacity returns the capacity in MB of the snapshot
+// snapshotID of the FCD of the volume on datastore ds, which is the capacity
+// of the FCD when the snapshot was taken. It is 0 if vCenter doesn't report
+// it.
+func RetrieveSnapshotCapacity(ctx context.Context, client *vim25.Client, ds vimtypes.ManagedObjectReference,
+	volumeID string, snapshotID string) (int64, error) {
+	log := logger.GetLogger(ctx)
+	var reqBody, resBody retrieveSnapshotDetailsBody
+	reqBody.Req = &vimtypes.RetrieveSnapshotDetails{
+		This:       *client.ServiceContent.VStorageObjectManager,
+		Id:         vimtypes.ID{Id: volumeID},
+		Datastore:  ds,
+		SnapshotId: vimtypes.ID{Id: snapshotID},
+	}
+	if err := client.RoundTrip(ctx, &reqBody, &resBody); err != nil {
+		log.Errorf("failed to retrieve the details of snapshot %s of volume %s. err: %v", snapshotID, volumeID, err)
+		return 0, err
+	}
+	if resBody.Res == nil {
+		return 0, fmt.Errorf("no details of snapshot %s of volume %s", snapshotID, volumeID)
+	}
+	return resBody.Res.Returnval.CapacityInMB, nil
+}
+
+// QueryChangedDiskAreas returns the areas of the FCD of the volume on datastore
+// ds, from startOffset, which changed between the change ID changeID and the
+// snapshot snapshotID. Use the change ID "*" to get all the allocated areas.
+// Changed block tracking must be enabled on the FCD.
+func QueryChangedDiskAreas(ctx context.Context, client *vim25.Client, ds vimtypes.ManagedObjectReference,
+	volumeID string, snapshotID string, startOffset int64, changeID string) (*vimtypes.DiskChangeInfo, error) {
+	log := logger.GetLogger(ctx)
+	req := vimtypes.VstorageObjectVCenterQueryChangedDiskAreas{
+		This:        *client.ServiceContent.VStorageObjectManager,
+		Id:          vimtypes.ID{Id: volumeID},
+		Datastore:   ds,
+		SnapshotId:  vimtypes.ID{Id: snapshotID},
+		StartOffset: startOffset,
+		ChangeId:    changeID,
+	}
+	res, err := methods.VstorageObjectVCenterQueryChangedDiskAreas(ctx, client, &req)
+	if err != nil {
+		log.Errorf("failed to query the changed areas of volume %s at snapshot %s. err: %v", volumeID, snapshotID, err)
+		return nil, err
+	}
+	return &res.Returnval, nil
+}
+
+// EnableChangedBlockTracking enables changed block tracking on the FCD of the
+// volume on datastore ds, for its changed areas to be queried.
+func EnableChangedBlockTracking(ctx context.Context, client *vim25.Client, ds vimtypes.ManagedObjectReference,
+	volumeID string) error {
+	log := logger.GetLogger(ctx)
+	req := vimtypes.SetVStorageObjectControlFlags{
+		This:      *client.ServiceContent.VStorageObjectManager,
+		Id:        vimtypes.ID{Id: volumeID},
+		Datastore: ds,
+		ControlFlags: []string{
+			string(vimtypes.VslmVStorageObjectControlFlagEnableChangedBlockTracking),
+		},
+	}
+	if _, err := methods.SetVStorageObjectControlFlags(ctx, client, &req); err != nil {
+		log.Errorf("failed to enable changed block tracking on volume %s. err: %v", volumeID, err)
+		return err
+	}
+	log.Infof("Enabled changed block tracking on volume %s", volumeID)
+	return nil
+}
+
+// SetVolumeReplication applies the storage policy profileID to the FCD of the
+// volume on datastore ds, adding the FCD to the replication group groupID of
+// the policy.
+func SetVolumeReplication(ctx context.Context, client *vim25.Client, ds vimtypes.ManagedObjectReference,
+	volumeID string, profileID string, groupID vimtypes.ReplicationGroupId) error {
+	log := logger.GetLogger(ctx)
+	req := vimtypes.UpdateVStorageObjectPolicy_Task{
+		This:      *client.ServiceContent.VStorageObjectManager,
+		Id:        vimtypes.ID{Id: volumeID},
+		Datastore: ds,
+		Profile: []vimtypes.BaseVirtualMachineProfileSpec{
+			&vimtypes.VirtualMachineDefinedProfileSpec{
+				ProfileId: profileID,
+				ReplicationSpec: &vimtypes.ReplicationSpec{
+					ReplicationGroupId: groupID,
+				},
+			},
+		},
+	}
+	res, err := methods.UpdateVStorageObjectPolicy_Task(ctx, client, &req)
+	if err == nil {
+		err = object.NewTask(client, res.Returnval).Wait(ctx)
+	}
+	if err != nil {
+		log.Errorf("failed to add volume %s to replication group %s of fault domain %s. err: %v",
+			volumeID, groupID.DeviceGroupId.Id, groupID.FaultDomainId.Id, err)
+		return err
+	}
+	log.Infof("Added volume %s to replication group %s of fault domain %s",
+		volumeID, groupID.DeviceGroupId.Id, groupID.FaultDomainId.Id)
+	return nil
+}
+
 // IsDiskAttachedToVMs checks if the volume is attached to any of the input VMs.
 // If the volume is attached to the VM, return disk uuid of the volume, else return empty string
 func IsDiskAttachedToVMs(ctx context.Context, volumeID string, vms []*cnsvsphere.VirtualMachine) (string, error) {
@@ -98,3 +635,13 @@ func updateQueryResult(ctx context.Context, m *defaultManager, res *cnstypes.Cns
 	}
 	return res
 }
+
+// isManagedObjectNotFoundFault returns true if the fault is a ManagedObjectNotFound
+// fault for the given managed object.
+func isManagedObjectNotFoundFault(fault *vimtypes.LocalizedMethodFault, moRef vimtypes.ManagedObjectReference) bool {
+	if fault == nil {
+		return false
+	}
+	notFound, ok := fault.Fault.(*vimtypes.ManagedObjectNotFound)
+	return ok && notFound.Obj.Type == moRef.Type && notFound.Obj.Value == moRef.Value
+}
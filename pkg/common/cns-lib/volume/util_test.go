@@ -0,0 +1,429 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vapi/rest"
+	_ "github.com/vmware/govmomi/vapi/simulator"
+	"github.com/vmware/govmomi/vapi/tags"
+	"github.com/vmware/govmomi/vim25/soap"
+	vimtypes "github.com/vmware/govmomi/vim25/types"
+	"github.com/vmware/govmomi/vslm"
+
+	cnsvsphere "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/vsphere"
+)
+
+func TestIsManagedObjectNotFoundFault(t *testing.T) {
+	vmRef := vimtypes.ManagedObjectReference{Type: "VirtualMachine", Value: "vm-1"}
+	tests := []struct {
+		fault    *vimtypes.LocalizedMethodFault
+		expected bool
+	}{
+		{nil, false},
+		{&vimtypes.LocalizedMethodFault{Fault: &vimtypes.ManagedObjectNotFound{Obj: vmRef}}, true},
+		// Faults for other managed objects aren't about the VM.
+		{&vimtypes.LocalizedMethodFault{Fault: &vimtypes.ManagedObjectNotFound{
+			Obj: vimtypes.ManagedObjectReference{Type: "VirtualMachine", Value: "vm-2"}}}, false},
+		{&vimtypes.LocalizedMethodFault{Fault: &vimtypes.NotFound{}}, false},
+	}
+	for _, test := range tests {
+		if isManagedObjectNotFoundFault(test.fault, vmRef) != test.expected {
+			t.Errorf("expected %v for fault %+v", test.expected, test.fault)
+		}
+	}
+}
+
+// TestSetDiskIOAllocation checks that the allocation is set on the virtual
+// disk of the volume only.
+func TestSetDiskIOAllocation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	model := simulator.VPX()
+	defer model.Remove()
+	if err := model.Create(); err != nil {
+		t.Fatal(err)
+	}
+	s := model.Service.NewServer()
+	defer s.Close()
+	client, err := govmomi.NewClient(ctx, s.URL, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm, err := find.NewFinder(client.Client).VirtualMachine(ctx, "DC0_H0_VM0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cnsVM := &cnsvsphere.VirtualMachine{VirtualMachine: vm}
+
+	// Make the disk of the VM the one of volume vol-1.
+	devices, err := vm.Device(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	disk := devices.SelectByType((*vimtypes.VirtualDisk)(nil))[0].(*vimtypes.VirtualDisk)
+	disk.VDiskId = &vimtypes.ID{Id: "vol-1"}
+	if err := vm.EditDevice(ctx, disk); err != nil {
+		t.Fatal(err)
+	}
+
+	limit := int64(500)
+	allocation := &vimtypes.StorageIOAllocationInfo{
+		Limit:  &limit,
+		Shares: &vimtypes.SharesInfo{Level: vimtypes.SharesLevelHigh},
+	}
+	if err := SetDiskIOAllocation(ctx, cnsVM, "vol-1", allocation); err != nil {
+		t.Fatal(err)
+	}
+	devices, err = vm.Device(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	disk = devices.SelectByType((*vimtypes.VirtualDisk)(nil))[0].(*vimtypes.VirtualDisk)
+	if disk.StorageIOAllocation == nil || disk.StorageIOAllocation.Limit == nil || *disk.StorageIOAllocation.Limit != limit ||
+		disk.StorageIOAllocation.Shares == nil || disk.StorageIOAllocation.Shares.Level != vimtypes.SharesLevelHigh {
+		t.Fatalf("expected the allocation to be set on the disk, got %+v", disk.StorageIOAllocation)
+	}
+
+	if err := SetDiskIOAllocation(ctx, cnsVM, "vol-2", allocation); err == nil {
+		t.Fatalf("expected error for a volume not attached to the vm")
+	}
+}
+
+// TestAddSCSIControllerIfFull checks that a paravirtual SCSI controller is
+// only added once the existing ones are full.
+func TestAddSCSIControllerIfFull(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	model := simulator.VPX()
+	defer model.Remove()
+	if err := model.Create(); err != nil {
+		t.Fatal(err)
+	}
+	s := model.Service.NewServer()
+	defer s.Close()
+	client, err := govmomi.NewClient(ctx, s.URL, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm, err := find.NewFinder(client.Client).VirtualMachine(ctx, "DC0_H0_VM0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cnsVM := &cnsvsphere.VirtualMachine{VirtualMachine: vm}
+	pvscsiControllers := func() []vimtypes.BaseVirtualDevice {
+		devices, err := vm.Device(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return devices.SelectByType((*vimtypes.ParaVirtualSCSIController)(nil))
+	}
+
+	// Replace the controllers of the VM by a paravirtual SCSI controller.
+	devices, err := vm.Device(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.RemoveDevice(ctx, false, devices.SelectByType((*vimtypes.VirtualDisk)(nil))...); err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.RemoveDevice(ctx, false, devices.SelectByType((*vimtypes.VirtualSCSIController)(nil))...); err != nil {
+		t.Fatal(err)
+	}
+	devices, err = vm.Device(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	controller, err := devices.CreateSCSIController("pvscsi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.AddDevice(ctx, controller); err != nil {
+		t.Fatal(err)
+	}
+	controller = pvscsiControllers()[0]
+	if added, err := AddSCSIControllerIfFull(ctx, cnsVM); err != nil || added {
+		t.Fatalf("expected no controller added while the controller has free units, got %v, %v", added, err)
+	}
+
+	devices, err = vm.Device(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds := simulator.Map.Any("Datastore").(*simulator.Datastore)
+	for i := 0; i < maxDevicesPerSCSIController; i++ {
+		disk := devices.CreateDisk(controller.(vimtypes.BaseVirtualController), ds.Reference(),
+			fmt.Sprintf("[%s] %s/disk-%d.vmdk", ds.Name, vm.Name(), i))
+		disk.CapacityInKB = 1024
+		if err := vm.AddDevice(ctx, disk); err != nil {
+			t.Fatal(err)
+		}
+		if devices, err = vm.Device(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if added, err := AddSCSIControllerIfFull(ctx, cnsVM); err != nil || !added {
+		t.Fatalf("expected a controller added once the controller is full, got %v, %v", added, err)
+	}
+	if controllers := pvscsiControllers(); len(controllers) != 2 {
+		t.Fatalf("expected 2 paravirtual SCSI controllers, got %d", len(controllers))
+	}
+}
+
+// TestSelectDiskController checks the controller and unit a disk is attached
+// to with the fill and spread policies.
+func TestSelectDiskController(t *testing.T) {
+	var devices object.VirtualDeviceList
+	addController := func(controllerType string) vimtypes.BaseVirtualController {
+		var controller vimtypes.BaseVirtualDevice
+		var err error
+		if controllerType == "nvme" {
+			controller, err = devices.CreateNVMEController()
+		} else {
+			controller, err = devices.CreateSCSIController(controllerType)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		devices = append(devices, controller)
+		return controller.(vimtypes.BaseVirtualController)
+	}
+	addDisks := func(controller vimtypes.BaseVirtualController, units ...int32) {
+		for _, unit := range units {
+			unit := unit
+			devices = append(devices, &vimtypes.VirtualDisk{VirtualDevice: vimtypes.VirtualDevice{
+				Key: devices.NewKey(), ControllerKey: controller.GetVirtualController().Key, UnitNumber: &unit}})
+		}
+	}
+
+	// The LSI Logic controller is ignored and counts towards the SCSI controllers.
+	addDisks(addController("lsilogic"), 0)
+	first := addController("pvscsi")
+	addDisks(first, 0, 1, 2, 3, 4, 5, 6)
+	second := addController("pvscsi")
+	addDisks(second, 0)
+
+	controller, unit, add := selectDiskController(devices, "pvscsi", false)
+	if controller != first || unit != 8 || add {
+		t.Fatalf("expected unit 8 of the first controller with fill, got %v, %d, %v", controller, unit, add)
+	}
+	if controller, _, add = selectDiskController(devices, "pvscsi", true); controller != nil || !add {
+		t.Fatalf("expected a controller added with spread, got %v, %v", controller, add)
+	}
+	addController("pvscsi")
+	if controller, unit, add = selectDiskController(devices, "pvscsi", true); controller == nil ||
+		controller.GetVirtualController().Key == first.GetVirtualController().Key || unit != 0 || add {
+		t.Fatalf("expected unit 0 of the new controller with spread, got %v, %d, %v", controller, unit, add)
+	}
+	if controller, unit, add = selectDiskController(devices, "nvme", true); controller != nil || !add {
+		t.Fatalf("expected an NVMe controller added, got %v, %d, %v", controller, unit, add)
+	}
+
+	nvme := addController("nvme")
+	addDisks(nvme, 0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14)
+	if controller, _, add = selectDiskController(devices, "nvme", false); controller != nil || !add {
+		t.Fatalf("expected an NVMe controller added once the controller is full, got %v, %v", controller, add)
+	}
+}
+
+// TestSetVolumeTags checks that only the tags of the given categories are
+// synced on the FCD of the volume.
+func TestSetVolumeTags(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	model := simulator.VPX()
+	defer model.Remove()
+	if err := model.Create(); err != nil {
+		t.Fatal(err)
+	}
+	model.Service.RegisterEndpoints = true
+	s := model.Service.NewServer()
+	defer s.Close()
+	client, err := govmomi.NewClient(ctx, s.URL, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restClient := rest.NewClient(client.Client)
+	if err := restClient.Login(ctx, s.URL.User); err != nil {
+		t.Fatal(err)
+	}
+	tagManager := tags.NewManager(restClient)
+
+	// A tag attached by the VI admin.
+	if err := ensureTag(ctx, tagManager, "owner", "vi-admin"); err != nil {
+		t.Fatal(err)
+	}
+	objectManager := vslm.NewObjectManager(client.Client)
+	if err := objectManager.AttachTag(ctx, "vol-1",
+		vimtypes.VslmTagEntry{ParentCategoryName: "owner", TagName: "vi-admin"}); err != nil {
+		t.Fatal(err)
+	}
+
+	categories := []string{"app", "team"}
+	expectTags := func(expected map[string]string) {
+		t.Helper()
+		attachedTags, err := objectManager.ListAttachedTags(ctx, "vol-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		attached := make(map[string]string)
+		for _, attachedTag := range attachedTags {
+			attached[attachedTag.ParentCategoryName] = attachedTag.TagName
+		}
+		if !reflect.DeepEqual(attached, expected) {
+			t.Fatalf("expected tags %v, got %v", expected, attached)
+		}
+	}
+	if err := SetVolumeTags(ctx, client.Client, tagManager, "vol-1", categories,
+		map[string]string{"app": "db", "team": "storage"}); err != nil {
+		t.Fatal(err)
+	}
+	expectTags(map[string]string{"owner": "vi-admin", "app": "db", "team": "storage"})
+
+	if err := SetVolumeTags(ctx, client.Client, tagManager, "vol-1", categories,
+		map[string]string{"app": "web"}); err != nil {
+		t.Fatal(err)
+	}
+	expectTags(map[string]string{"owner": "vi-admin", "app": "web"})
+
+	// The existing tag is reused rather than created again.
+	if err := ensureTag(ctx, tagManager, "owner", "vi-admin"); err != nil {
+		t.Fatal(err)
+	}
+	category, err := tagManager.GetCategory(ctx, "owner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ownerTags, err := tagManager.GetTagsForCategory(ctx, category.ID); err != nil || len(ownerTags) != 1 {
+		t.Fatalf("expected a single tag in category owner, got %v, err: %v", ownerTags, err)
+	}
+	// A failed lookup isn't taken for a missing tag.
+	if err := tagManager.Logout(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := ensureTag(ctx, tagManager, "owner", "vi-admin"); err == nil {
+		t.Fatal("expected an error for a logged out tagManager")
+	}
+}
+
+// snapshotDetailsManager reports the capacity of snapshots in their details
+// like vCenter 7.0U3, which the simulator doesn't implement.
+type snapshotDetailsManager struct {
+	*simulator.VcenterVStorageObjectManager
+	capacityInMB int64
+}
+
+// RetrieveSnapshotDetailsResponse is named after the response element the
+// simulator encodes it as.
+type RetrieveSnapshotDetailsResponse retrieveSnapshotDetailsResponse
+
+type snapshotDetailsBody struct {
+	Res    *RetrieveSnapshotDetailsResponse
+	Fault_ *soap.Fault
+}
+
+func (b *snapshotDetailsBody) Fault() *soap.Fault { return b.Fault_ }
+
+func (m *snapshotDetailsManager) RetrieveSnapshotDetails(req *vimtypes.RetrieveSnapshotDetails) soap.HasFault {
+	return &snapshotDetailsBody{
+		Res: &RetrieveSnapshotDetailsResponse{
+			Returnval: snapshotDetails{CapacityInMB: m.capacityInMB},
+		},
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	model := simulator.VPX()
+	defer model.Remove()
+	if err := model.Create(); err != nil {
+		t.Fatal(err)
+	}
+	s := model.Service.NewServer()
+	defer s.Close()
+	client, err := govmomi.NewClient(ctx, s.URL, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds := simulator.Map.Any("Datastore").Reference()
+	objectManager := vslm.NewObjectManager(client.Client)
+	task, err := objectManager.CreateDisk(ctx, vimtypes.VslmCreateSpec{
+		Name:         "vol",
+		CapacityInMB: 10,
+		BackingSpec: &vimtypes.VslmCreateSpecDiskFileBackingSpec{
+			VslmCreateSpecBackingSpec: vimtypes.VslmCreateSpecBackingSpec{Datastore: ds},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	taskInfo, err := task.WaitForResult(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	volumeID := taskInfo.Result.(vimtypes.VStorageObject).Config.Id.Id
+
+	task, err = objectManager.CreateSnapshot(ctx, ds, volumeID, "backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	taskInfo, err = task.WaitForResult(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshotID, err := getSnapshotID(taskInfo.Result, volumeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshots, err := objectManager.RetrieveSnapshotInfo(ctx, ds, volumeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots.Snapshots) != 1 || snapshots.Snapshots[0].Id.Id != snapshotID ||
+		snapshots.Snapshots[0].Description != "backup" {
+		t.Fatalf("expected snapshot %s, got %+v", snapshotID, snapshots.Snapshots)
+	}
+
+	if _, err := RetrieveSnapshotCapacity(ctx, client.Client, ds, volumeID, snapshotID); err == nil {
+		t.Fatal("expected an error retrieving the snapshot details the simulator doesn't implement")
+	}
+	manager := simulator.Map.Get(*client.ServiceContent.VStorageObjectManager).(*simulator.VcenterVStorageObjectManager)
+	simulator.Map.Put(&snapshotDetailsManager{VcenterVStorageObjectManager: manager, capacityInMB: 10})
+	capacity, err := RetrieveSnapshotCapacity(ctx, client.Client, ds, volumeID, snapshotID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if capacity != 10 {
+		t.Fatalf("expected snapshot %s of 10 MB, got %d MB", snapshotID, capacity)
+	}
+
+	if err := DeleteSnapshot(ctx, client.Client, ds, volumeID, snapshotID); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteSnapshot(ctx, client.Client, ds, volumeID, snapshotID); err == nil {
+		t.Fatal("expected an error deleting a deleted snapshot")
+	}
+}
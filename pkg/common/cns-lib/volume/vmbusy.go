@@ -0,0 +1,69 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"fmt"
+
+	"github.com/vmware/govmomi/vim25/soap"
+	vim25types "github.com/vmware/govmomi/vim25/types"
+)
+
+// VMBusyError is returned when CNS fails to attach or detach a volume because
+// the VM is busy with another task, such as being relocated by vMotion. The
+// operation is expected to succeed once the other task completes.
+type VMBusyError struct {
+	// Operation is the operation that failed, "attach" or "detach".
+	Operation string
+	// Volume is the ID of the volume.
+	Volume string
+	// VM is the VM the volume was attached to or detached from.
+	VM string
+	// Fault is the message of the fault CNS failed the operation with.
+	Fault string
+}
+
+func (e *VMBusyError) Error() string {
+	return fmt.Sprintf("failed to %s volume %q: vm %q is busy with another task. fault: %s",
+		e.Operation, e.Volume, e.VM, e.Fault)
+}
+
+// isVMBusyFault returns if the fault reports the VM busy with another task or
+// in a state not allowing the operation, as it is during a vMotion.
+func isVMBusyFault(fault *vim25types.LocalizedMethodFault) bool {
+	if fault == nil || fault.Fault == nil {
+		return false
+	}
+	switch fault.Fault.(type) {
+	case *vim25types.TaskInProgress, *vim25types.InvalidState:
+		return true
+	}
+	return false
+}
+
+// isVMBusyError returns if err is a SOAP fault reporting the VM busy with
+// another task or in a state not allowing the operation.
+func isVMBusyError(err error) bool {
+	if !soap.IsSoapFault(err) {
+		return false
+	}
+	switch soap.ToSoapFault(err).VimFault().(type) {
+	case vim25types.TaskInProgress, vim25types.InvalidState:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,40 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"testing"
+
+	vim25types "github.com/vmware/govmomi/vim25/types"
+)
+
+func TestIsVMBusyFault(t *testing.T) {
+	tests := []struct {
+		fault    *vim25types.LocalizedMethodFault
+		expected bool
+	}{
+		{nil, false},
+		{&vim25types.LocalizedMethodFault{Fault: &vim25types.TaskInProgress{}}, true},
+		{&vim25types.LocalizedMethodFault{Fault: &vim25types.InvalidState{}}, true},
+		{&vim25types.LocalizedMethodFault{Fault: &vim25types.NotFound{}}, false},
+	}
+	for _, test := range tests {
+		if isVMBusyFault(test.fault) != test.expected {
+			t.Errorf("expected %v for fault %+v", test.expected, test.fault)
+		}
+	}
+}
@@ -32,6 +32,8 @@ func NewCnsClient(ctx context.Context, c *vim25.Client) (*cns.Client, error) {
 		log.Errorf("failed to create a new client for CNS. err: %v", err)
 		return nil, err
 	}
+	useProxyOf(c, cnsClient.Client)
+	cnsClient.RoundTripper = newTracingRoundTripper(cnsClient.RoundTripper, c.URL().Hostname())
 	return cnsClient, nil
 }
 
@@ -223,3 +223,36 @@ func (dc *Datacenter) GetAllDatastores(ctx context.Context) (map[string]*Datasto
 	}
 	return dsURLInfoMap, nil
 }
+
+// GetAllDatastoreSummaries gets the datastore URL to datastore summary map for all the
+// datastores in the datacenter. The summaries hold the capacity and free space of the datastores.
+func (dc *Datacenter) GetAllDatastoreSummaries(ctx context.Context) (map[string]types.DatastoreSummary, error) {
+	log := logger.GetLogger(ctx)
+	finder := find.NewFinder(dc.Client(), false)
+	finder.SetDatacenter(dc.Datacenter)
+	datastores, err := finder.DatastoreList(ctx, "*")
+	if err != nil {
+		if _, ok := err.(*find.NotFoundError); ok {
+			return map[string]types.DatastoreSummary{}, nil
+		}
+		log.Errorf("failed to get all the datastores in the Datacenter %s with error: %v", dc.Datacenter.String(), err)
+		return nil, err
+	}
+	var dsList []types.ManagedObjectReference
+	for _, ds := range datastores {
+		dsList = append(dsList, ds.Reference())
+	}
+	var dsMoList []mo.Datastore
+	pc := property.DefaultCollector(dc.Client())
+	properties := []string{"summary"}
+	err = pc.Retrieve(ctx, dsList, properties, &dsMoList)
+	if err != nil {
+		log.Errorf("failed to get datastore managed objects from datastore objects %v with properties %v: %v", dsList, properties, err)
+		return nil, err
+	}
+	dsURLSummaryMap := make(map[string]types.DatastoreSummary)
+	for _, dsMo := range dsMoList {
+		dsURLSummaryMap[dsMo.Summary.Url] = dsMo.Summary
+	}
+	return dsURLSummaryMap, nil
+}
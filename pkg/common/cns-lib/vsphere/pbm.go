@@ -19,6 +19,7 @@ package vsphere
 import (
 	"context"
 	"fmt"
+	"sync"
 
 	"github.com/vmware/govmomi/pbm"
 	pbmmethods "github.com/vmware/govmomi/pbm/methods"
@@ -51,7 +52,12 @@ type SpbmPolicyContent struct {
 	Profiles []SpbmPolicySubProfile `json:"profiles"`
 }
 
-// ConnectPbm creates a PBM client for the virtual center.
+// pbmClientMutex is used for exclusive PBM client creation, so that requests
+// share the PBM client of the virtual center instead of creating their own.
+var pbmClientMutex sync.Mutex
+
+// ConnectPbm creates a PBM client for the virtual center, or reuses the one
+// created before as long as the vCenter session it shares is the same.
 func (vc *VirtualCenter) ConnectPbm(ctx context.Context) error {
 	log := logger.GetLogger(ctx)
 	var err = vc.Connect(ctx)
@@ -59,39 +65,98 @@ func (vc *VirtualCenter) ConnectPbm(ctx context.Context) error {
 		log.Errorf("failed to connect to Virtual Center %q with err: %v", vc.Config.Host, err)
 		return err
 	}
-	if vc.PbmClient == nil {
-		if vc.PbmClient, err = pbm.NewClient(ctx, vc.Client.Client); err != nil {
-			log.Errorf("failed to create pbm client with err: %v", err)
-			return err
-		}
+	pbmClientMutex.Lock()
+	defer pbmClientMutex.Unlock()
+	if vc.PbmClient == nil || vc.pbmVimClient != vc.Client.Client {
+		return vc.newPbmClient(ctx)
+	}
+	return nil
+}
+
+// newPbmClient creates the PBM client from the current vCenter client. It
+// must be called with pbmClientMutex held.
+func (vc *VirtualCenter) newPbmClient(ctx context.Context) error {
+	log := logger.GetLogger(ctx)
+	// Like pbm.NewClient, with the proxy of the vCenter client.
+	sc := newServiceClient(vc.Client.Client, pbm.Path, pbm.Namespace)
+	res, err := pbmmethods.PbmRetrieveServiceContent(ctx, sc,
+		&pbmtypes.PbmRetrieveServiceContent{This: pbm.ServiceInstance})
+	if err != nil {
+		log.Errorf("failed to create pbm client with err: %v", err)
+		return err
 	}
+	log.Debugf("Created pbm client for vCenter %q", vc.Config.Host)
+	vc.PbmClient = &pbm.Client{Client: sc, ServiceContent: res.Returnval, RoundTripper: sc}
+	vc.pbmVimClient = vc.Client.Client
 	return nil
 }
 
 // DisconnectPbm destroys the PBM client for the virtual center.
 func (vc *VirtualCenter) DisconnectPbm(ctx context.Context) error {
 	log := logger.GetLogger(ctx)
+	pbmClientMutex.Lock()
+	defer pbmClientMutex.Unlock()
 	if vc.PbmClient == nil {
 		log.Info("PbmClient wasn't connected, ignoring")
 	} else {
 		vc.PbmClient = nil
+		vc.pbmVimClient = nil
 	}
 	return nil
 }
 
-// GetStoragePolicyIDByName gets storage policy ID by name.
-func (vc *VirtualCenter) GetStoragePolicyIDByName(ctx context.Context, storagePolicyName string) (string, error) {
+// withPbmClient calls pbmCall with the shared PBM client of the virtual
+// center. If the session of the client is no longer authenticated, e.g. it
+// was terminated on vCenter, a new session is created and the call is retried
+// once.
+func (vc *VirtualCenter) withPbmClient(ctx context.Context, pbmCall func(*pbm.Client) error) error {
 	log := logger.GetLogger(ctx)
-	err := vc.ConnectPbm(ctx)
-	if err != nil {
+	if err := vc.ConnectPbm(ctx); err != nil {
 		log.Errorf("Error occurred while connecting to PBM, err: %+v", err)
-		return "", err
+		return err
+	}
+	err := pbmCall(vc.getPbmClient())
+	if !IsNotAuthenticatedError(err) {
+		return err
+	}
+	log.Warnf("PBM session of vCenter %q is not authenticated, creating a new session. err: %v", vc.Config.Host, err)
+	if err = vc.connect(ctx, true); err != nil {
+		log.Errorf("failed to create a new session with vCenter %q. err: %v", vc.Config.Host, err)
+		return err
+	}
+	if err = vc.ConnectPbm(ctx); err != nil {
+		log.Errorf("Error occurred while connecting to PBM, err: %+v", err)
+		return err
+	}
+	return pbmCall(vc.getPbmClient())
+}
+
+// getPbmClient returns the current PBM client of the virtual center.
+func (vc *VirtualCenter) getPbmClient() *pbm.Client {
+	pbmClientMutex.Lock()
+	defer pbmClientMutex.Unlock()
+	return vc.PbmClient
+}
+
+// GetStoragePolicyIDByName gets storage policy ID by name. IDs are cached for
+// storagePolicyIDCacheTTL, see InvalidateStoragePolicyID.
+func (vc *VirtualCenter) GetStoragePolicyIDByName(ctx context.Context, storagePolicyName string) (string, error) {
+	log := logger.GetLogger(ctx)
+	if storagePolicyID, ok := vc.getCachedStoragePolicyID(storagePolicyName); ok {
+		log.Debugf("Using cached ID %q of storage policy %q", storagePolicyID, storagePolicyName)
+		return storagePolicyID, nil
 	}
-	storagePolicyID, err := vc.PbmClient.ProfileIDByName(ctx, storagePolicyName)
+	var storagePolicyID string
+	err := vc.withPbmClient(ctx, func(pbmClient *pbm.Client) error {
+		var err error
+		storagePolicyID, err = pbmClient.ProfileIDByName(ctx, storagePolicyName)
+		return err
+	})
 	if err != nil {
 		log.Errorf("failed to get StoragePolicyID from StoragePolicyName %s with err: %v", storagePolicyName, err)
 		return "", err
 	}
+	vc.cacheStoragePolicyID(storagePolicyName, storagePolicyID)
 	return storagePolicyID, nil
 }
 
@@ -104,15 +169,19 @@ func (vc *VirtualCenter) PbmCheckCompatibility(ctx context.Context, datastores [
 			HubId:   ds.Value,
 		})
 	}
-	req := pbmtypes.PbmCheckCompatibility{
-		This:         vc.PbmClient.ServiceContent.PlacementSolver,
-		HubsToSearch: hubs,
-		Profile: pbmtypes.PbmProfileId{
-			UniqueId: profileID,
-		},
-	}
-
-	res, err := pbmmethods.PbmCheckCompatibility(ctx, vc.PbmClient, &req)
+	var res *pbmtypes.PbmCheckCompatibilityResponse
+	err := vc.withPbmClient(ctx, func(pbmClient *pbm.Client) error {
+		req := pbmtypes.PbmCheckCompatibility{
+			This:         pbmClient.ServiceContent.PlacementSolver,
+			HubsToSearch: hubs,
+			Profile: pbmtypes.PbmProfileId{
+				UniqueId: profileID,
+			},
+		}
+		var err error
+		res, err = pbmmethods.PbmCheckCompatibility(ctx, pbmClient, &req)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -120,6 +189,38 @@ func (vc *VirtualCenter) PbmCheckCompatibility(ctx context.Context, datastores [
 	return res.Returnval, nil
 }
 
+// PbmQueryReplicationGroup returns the replication group of the FCD volumeID, nil if it
+// isn't replicated, and the fault SPBM reports for the replication group, if any.
+func (vc *VirtualCenter) PbmQueryReplicationGroup(ctx context.Context, volumeID string) (
+	*vimtypes.ReplicationGroupId, *vimtypes.LocalizedMethodFault, error) {
+	var res *pbmtypes.PbmQueryReplicationGroupsResponse
+	err := vc.withPbmClient(ctx, func(pbmClient *pbm.Client) error {
+		if pbmClient.ServiceContent.ReplicationManager == nil {
+			return fmt.Errorf("SPBM of vCenter %q doesn't support replication", vc.Config.Host)
+		}
+		req := pbmtypes.PbmQueryReplicationGroups{
+			This: *pbmClient.ServiceContent.ReplicationManager,
+			Entities: []pbmtypes.PbmServerObjectRef{{
+				ObjectType: string(pbmtypes.PbmObjectTypeVirtualDiskUUID),
+				Key:        volumeID,
+				ServerUuid: vc.Client.ServiceContent.About.InstanceUuid,
+			}},
+		}
+		var err error
+		res, err = pbmmethods.PbmQueryReplicationGroups(ctx, pbmClient, &req)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, result := range res.Returnval {
+		if result.Object.Key == volumeID {
+			return result.ReplicationGroupId, result.Fault, nil
+		}
+	}
+	return nil, nil, nil
+}
+
 // PbmRetrieveContent fetches the policy content of all given policies from SPBM
 func (vc *VirtualCenter) PbmRetrieveContent(ctx context.Context, policyIds []string) ([]SpbmPolicyContent, error) {
 	pbmPolicyIds := make([]pbmtypes.PbmProfileId, 0)
@@ -128,11 +229,41 @@ func (vc *VirtualCenter) PbmRetrieveContent(ctx context.Context, policyIds []str
 			UniqueId: policyID,
 		})
 	}
-	profiles, err := vc.PbmClient.RetrieveContent(ctx, pbmPolicyIds)
+	var profiles []pbmtypes.BasePbmProfile
+	err := vc.withPbmClient(ctx, func(pbmClient *pbm.Client) error {
+		var err error
+		profiles, err = pbmClient.RetrieveContent(ctx, pbmPolicyIds)
+		return err
+	})
 
 	return simplifyProfileStructs(ctx, profiles), err
 }
 
+// PbmRetrievePolicyNames returns the names of the given storage policies by ID.
+func (vc *VirtualCenter) PbmRetrievePolicyNames(ctx context.Context, policyIds []string) (map[string]string, error) {
+	pbmPolicyIds := make([]pbmtypes.PbmProfileId, 0)
+	for _, policyID := range policyIds {
+		pbmPolicyIds = append(pbmPolicyIds, pbmtypes.PbmProfileId{
+			UniqueId: policyID,
+		})
+	}
+	var profiles []pbmtypes.BasePbmProfile
+	err := vc.withPbmClient(ctx, func(pbmClient *pbm.Client) error {
+		var err error
+		profiles, err = pbmClient.RetrieveContent(ctx, pbmPolicyIds)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]string)
+	for _, profile := range profiles {
+		p := profile.GetPbmProfile()
+		names[p.ProfileId.UniqueId] = p.Name
+	}
+	return names, nil
+}
+
 func simplifyProfileStructs(ctx context.Context, profiles []pbmtypes.BasePbmProfile) []SpbmPolicyContent {
 	log := logger.GetLogger(ctx)
 	out := make([]SpbmPolicyContent, 0)
@@ -0,0 +1,96 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vsphere
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"strconv"
+	"testing"
+
+	pbmsim "github.com/vmware/govmomi/pbm/simulator"
+	"github.com/vmware/govmomi/simulator"
+)
+
+// TestPbmClientReuse checks that the PBM client of a virtual center is shared
+// by calls, and recreated when the vCenter session it shares is replaced.
+func TestPbmClientReuse(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	model := simulator.VPX()
+	defer model.Remove()
+	if err := model.Create(); err != nil {
+		t.Fatal(err)
+	}
+	model.Service.TLS = new(tls.Config)
+	s := model.Service.NewServer()
+	defer s.Close()
+	model.Service.RegisterSDK(pbmsim.New())
+
+	port, err := strconv.Atoi(s.URL.Port())
+	if err != nil {
+		t.Fatal(err)
+	}
+	password, _ := s.URL.User.Password()
+	vc := &VirtualCenter{
+		Config: &VirtualCenterConfig{
+			Host:     s.URL.Hostname(),
+			Port:     port,
+			Username: s.URL.User.Username(),
+			Password: password,
+			Insecure: true,
+		},
+	}
+
+	if err := vc.ConnectPbm(ctx); err != nil {
+		t.Fatal(err)
+	}
+	pbmClient := vc.PbmClient
+	if _, err := vc.PbmRetrieveContent(ctx, []string{"aa6d5a82-1c88-45da-85d3-3d74b91a5bad"}); err != nil {
+		t.Fatal(err)
+	}
+	if vc.PbmClient != pbmClient {
+		t.Errorf("expected the PBM client to be reused")
+	}
+
+	// Terminate the session, the next call has to log in again.
+	if err := vc.Client.Logout(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vc.PbmRetrieveContent(ctx, []string{"aa6d5a82-1c88-45da-85d3-3d74b91a5bad"}); err != nil {
+		t.Fatal(err)
+	}
+	if vc.PbmClient == pbmClient {
+		t.Errorf("expected the PBM client to be recreated with the new session")
+	}
+	if vc.pbmVimClient != vc.Client.Client {
+		t.Errorf("expected the PBM client to share the session of the vCenter client")
+	}
+}
+
+func TestIsNotAuthenticatedError(t *testing.T) {
+	if IsNotAuthenticatedError(nil) {
+		t.Errorf("expected nil not to be a NotAuthenticated error")
+	}
+	if !IsNotAuthenticatedError(errors.New("ServerFaultCode: NotAuthenticated")) {
+		t.Errorf("expected NotAuthenticated server fault to be a NotAuthenticated error")
+	}
+	if IsNotAuthenticatedError(errors.New("ServerFaultCode: InvalidArgument")) {
+		t.Errorf("expected InvalidArgument server fault not to be a NotAuthenticated error")
+	}
+}
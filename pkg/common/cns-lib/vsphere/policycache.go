@@ -0,0 +1,98 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vsphere
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
+)
+
+// storagePolicyIDCacheTTL is how long the ID of a storage policy looked up by
+// name is reused before PBM is queried again.
+var storagePolicyIDCacheTTL = 5 * time.Minute
+
+// storagePolicyIDCacheEntry is a storage policy ID cached until expirationTime.
+type storagePolicyIDCacheEntry struct {
+	id             string
+	expirationTime time.Time
+}
+
+var (
+	// storagePolicyIDCache holds the storage policy IDs looked up by name,
+	// keyed by vCenter host and policy name.
+	storagePolicyIDCache = make(map[string]storagePolicyIDCacheEntry)
+	// storagePolicyIDCacheLock protects storagePolicyIDCache.
+	storagePolicyIDCacheLock = &sync.Mutex{}
+)
+
+func storagePolicyIDCacheKey(host string, storagePolicyName string) string {
+	return host + "/" + storagePolicyName
+}
+
+// getCachedStoragePolicyID returns the cached ID of the storage policy, if it
+// hasn't expired yet.
+func (vc *VirtualCenter) getCachedStoragePolicyID(storagePolicyName string) (string, bool) {
+	storagePolicyIDCacheLock.Lock()
+	defer storagePolicyIDCacheLock.Unlock()
+	key := storagePolicyIDCacheKey(vc.Config.Host, storagePolicyName)
+	entry, ok := storagePolicyIDCache[key]
+	if !ok {
+		return "", false
+	}
+	if time.Now().After(entry.expirationTime) {
+		delete(storagePolicyIDCache, key)
+		return "", false
+	}
+	return entry.id, true
+}
+
+// cacheStoragePolicyID caches the ID of the storage policy for storagePolicyIDCacheTTL.
+func (vc *VirtualCenter) cacheStoragePolicyID(storagePolicyName string, storagePolicyID string) {
+	storagePolicyIDCacheLock.Lock()
+	defer storagePolicyIDCacheLock.Unlock()
+	storagePolicyIDCache[storagePolicyIDCacheKey(vc.Config.Host, storagePolicyName)] = storagePolicyIDCacheEntry{
+		id:             storagePolicyID,
+		expirationTime: time.Now().Add(storagePolicyIDCacheTTL),
+	}
+}
+
+// InvalidateStoragePolicyID drops the cached ID of the storage policy, so that
+// the next lookup queries PBM. It is called when vCenter reports the policy as
+// not found, it may have been deleted and created again with the same name.
+func (vc *VirtualCenter) InvalidateStoragePolicyID(ctx context.Context, storagePolicyName string) {
+	log := logger.GetLogger(ctx)
+	storagePolicyIDCacheLock.Lock()
+	defer storagePolicyIDCacheLock.Unlock()
+	key := storagePolicyIDCacheKey(vc.Config.Host, storagePolicyName)
+	if _, ok := storagePolicyIDCache[key]; ok {
+		log.Infof("Invalidating cached ID of storage policy %q on vCenter %q", storagePolicyName, vc.Config.Host)
+		delete(storagePolicyIDCache, key)
+	}
+}
+
+// IsCnsNotFoundError reports whether err is a NotFound fault, or the error of a
+// failed CNS task, which carries the fault as text, reporting one.
+func IsCnsNotFoundError(err error) bool {
+	if err == nil {
+		return false
+	}
+	return IsNotFoundError(err) || strings.Contains(err.Error(), "NotFound")
+}
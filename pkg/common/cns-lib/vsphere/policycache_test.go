@@ -0,0 +1,67 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vsphere
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStoragePolicyIDCache(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// The vCenter isn't connected, lookups only succeed from the cache.
+	vc := &VirtualCenter{Config: &VirtualCenterConfig{Host: "policy-cache-test"}}
+	otherVC := &VirtualCenter{Config: &VirtualCenterConfig{Host: "policy-cache-test-other"}}
+
+	vc.cacheStoragePolicyID("gold", "id-1")
+	if id, err := vc.GetStoragePolicyIDByName(ctx, "gold"); err != nil || id != "id-1" {
+		t.Fatalf("expected cached ID %q, got %q. err: %v", "id-1", id, err)
+	}
+	if _, ok := otherVC.getCachedStoragePolicyID("gold"); ok {
+		t.Errorf("expected IDs to be cached per vCenter")
+	}
+
+	vc.InvalidateStoragePolicyID(ctx, "gold")
+	if _, ok := vc.getCachedStoragePolicyID("gold"); ok {
+		t.Errorf("expected ID to be invalidated")
+	}
+
+	defaultTTL := storagePolicyIDCacheTTL
+	defer func() {
+		storagePolicyIDCacheTTL = defaultTTL
+	}()
+	storagePolicyIDCacheTTL = -time.Second
+	vc.cacheStoragePolicyID("gold", "id-2")
+	if _, ok := vc.getCachedStoragePolicyID("gold"); ok {
+		t.Errorf("expected ID to expire")
+	}
+}
+
+func TestIsCnsNotFoundError(t *testing.T) {
+	if IsCnsNotFoundError(nil) {
+		t.Errorf("expected nil not to be a NotFound error")
+	}
+	if !IsCnsNotFoundError(errors.New(`failed to create cns volume pvc-1. fault: "(*types.LocalizedMethodFault)({ Fault: (types.NotFound) {} })"`)) {
+		t.Errorf("expected CNS task error carrying a NotFound fault to be a NotFound error")
+	}
+	if IsCnsNotFoundError(errors.New("failed to create cns volume pvc-1. fault: InvalidArgument")) {
+		t.Errorf("expected CNS task error carrying an InvalidArgument fault not to be a NotFound error")
+	}
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vsphere
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/soap"
+	"golang.org/x/net/http/httpproxy"
+)
+
+// setProxy routes the connections of client, the soap client of a vCenter,
+// through the proxy at proxyURL, except the ones to the hosts matching
+// noProxy, in the format of the NO_PROXY environment variable. If proxyURL is
+// empty, the proxy of the HTTPS_PROXY and NO_PROXY environment variables
+// client was created with is kept. Only the transport of client is changed,
+// the other HTTP clients of the process aren't proxied.
+func setProxy(client *soap.Client, proxyURL string, noProxy string) error {
+	if proxyURL == "" {
+		return nil
+	}
+	if _, err := url.Parse(proxyURL); err != nil {
+		return err
+	}
+	proxyForURL := (&httpproxy.Config{
+		HTTPProxy:  proxyURL,
+		HTTPSProxy: proxyURL,
+		NoProxy:    noProxy,
+	}).ProxyFunc()
+	client.DefaultTransport().Proxy = func(req *http.Request) (*url.URL, error) {
+		return proxyForURL(req.URL)
+	}
+	return nil
+}
+
+// useProxyOf sets the proxy of c, the client of a vCenter, on sc, the soap
+// client of one of its services. govmomi creates the clients of the CNS, PBM,
+// vSAN and other services with the proxy of http.DefaultTransport instead.
+func useProxyOf(c *vim25.Client, sc *soap.Client) {
+	sc.DefaultTransport().Proxy = c.Client.DefaultTransport().Proxy
+}
+
+// newServiceClient returns the soap client of the service at path of the
+// vCenter of c, with the proxy of c. It is used for the services whose govmomi
+// client calls the service when it is created, before useProxyOf can be
+// called.
+func newServiceClient(c *vim25.Client, path string, namespace string) *soap.Client {
+	sc := c.Client.NewServiceClient(path, namespace)
+	useProxyOf(c, sc)
+	return sc
+}
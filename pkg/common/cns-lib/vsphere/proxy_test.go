@@ -0,0 +1,93 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vsphere
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/soap"
+)
+
+func TestSetProxy(t *testing.T) {
+	proxyURL := "http://proxy.example.com:3128"
+	u, err := url.Parse("https://vc.example.com/sdk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := soap.NewClient(u, true)
+	if err := setProxy(client, proxyURL, "10.0.0.0/8,.internal.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	// The clients of the services of the vCenter use its proxy.
+	serviceClient := newServiceClient(&vim25.Client{Client: client}, "/pbm", "pbm")
+	for host, expected := range map[string]string{
+		"vc.example.com:443":          proxyURL,
+		"10.1.2.3:443":                "",
+		"vc.internal.example.com:443": "",
+		// The simulator of the unit tests isn't proxied.
+		"127.0.0.1:443": "",
+	} {
+		req, err := http.NewRequest(http.MethodPost, "https://"+host+"/sdk", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, transport := range map[string]*http.Transport{
+			"vCenter": client.DefaultTransport(),
+			"service": serviceClient.DefaultTransport(),
+		} {
+			proxy, err := transport.Proxy(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			actual := ""
+			if proxy != nil {
+				actual = proxy.String()
+			}
+			if actual != expected {
+				t.Errorf("expected proxy %q of the %s client for vCenter %s, got %q", expected, name, host, actual)
+			}
+		}
+	}
+
+	// The other HTTP clients of the process aren't proxied.
+	req, err := http.NewRequest(http.MethodPost, "https://vc.example.com/sdk", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy, err := http.DefaultTransport.(*http.Transport).Proxy(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proxy != nil && proxy.String() == proxyURL {
+		t.Errorf("expected proxy %q not to be set on http.DefaultTransport", proxyURL)
+	}
+
+	// Without proxy-url, the proxy of the environment is kept.
+	client = soap.NewClient(u, true)
+	if err := setProxy(client, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if proxy, err = client.DefaultTransport().Proxy(req); err != nil {
+		t.Fatal(err)
+	}
+	if proxy != nil && proxy.String() == proxyURL {
+		t.Errorf("expected proxy %q not to be used without proxy-url", proxyURL)
+	}
+}
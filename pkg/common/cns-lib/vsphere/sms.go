@@ -0,0 +1,222 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vsphere
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	smsmethods "github.com/vmware/govmomi/sms/methods"
+	smstypes "github.com/vmware/govmomi/sms/types"
+	"github.com/vmware/govmomi/vim25/soap"
+	vimtypes "github.com/vmware/govmomi/vim25/types"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
+)
+
+const (
+	smsPath      = "/sms/sdk"
+	smsNamespace = "sms"
+	// smsTaskPollInterval is the interval at which the state of SMS tasks is polled.
+	smsTaskPollInterval = 5 * time.Second
+)
+
+// smsServiceInstance is the service instance of the storage monitoring service
+// (SMS), which manages the VASA providers of the virtual center.
+var smsServiceInstance = vimtypes.ManagedObjectReference{Type: "SmsServiceInstance", Value: "ServiceInstance"}
+
+// RecoveredDisk is a virtual disk recovered by the failover of a replication group.
+type RecoveredDisk struct {
+	// DatastoreURL is the URL of the datastore of the disk.
+	DatastoreURL string
+	// Path is the path of the disk on the datastore.
+	Path string
+}
+
+// newSmsClient creates a SMS client sharing the session of the virtual center.
+func (vc *VirtualCenter) newSmsClient(ctx context.Context) (*soap.Client, error) {
+	log := logger.GetLogger(ctx)
+	if err := vc.Connect(ctx); err != nil {
+		log.Errorf("failed to connect to Virtual Center host %q with err: %v", vc.Config.Host, err)
+		return nil, err
+	}
+	return vc.Client.Client.NewServiceClient(smsPath, smsNamespace), nil
+}
+
+// getReplicationGroupProvider returns the VASA provider managing the replication group groupID.
+func (vc *VirtualCenter) getReplicationGroupProvider(ctx context.Context, smsClient *soap.Client,
+	groupID vimtypes.ReplicationGroupId) (vimtypes.ManagedObjectReference, error) {
+	log := logger.GetLogger(ctx)
+	storageManager, err := smsmethods.QueryStorageManager(ctx, smsClient,
+		&smstypes.QueryStorageManager{This: smsServiceInstance})
+	if err != nil {
+		return vimtypes.ManagedObjectReference{}, err
+	}
+	providers, err := smsmethods.QueryProvider(ctx, smsClient,
+		&smstypes.QueryProvider{This: storageManager.Returnval})
+	if err != nil {
+		return vimtypes.ManagedObjectReference{}, err
+	}
+	for _, provider := range providers.Returnval {
+		res, err := smsmethods.QueryReplicationGroup(ctx, smsClient, &smstypes.QueryReplicationGroup{
+			This:    provider,
+			GroupId: []vimtypes.ReplicationGroupId{groupID},
+		})
+		if err != nil {
+			// Providers which don't support replication fail the query.
+			log.Debugf("failed to query replication group %q on provider %q. err: %v",
+				groupID.DeviceGroupId.Id, provider.Value, err)
+			continue
+		}
+		for _, result := range res.Returnval {
+			if _, isError := result.(*smstypes.GroupErrorResult); !isError {
+				return provider, nil
+			}
+		}
+	}
+	return vimtypes.ManagedObjectReference{}, fmt.Errorf("no VASA provider of vCenter %q manages replication group %q",
+		vc.Config.Host, groupID.DeviceGroupId.Id)
+}
+
+// waitForSmsTask waits for the SMS task to complete and returns its result.
+func waitForSmsTask(ctx context.Context, smsClient *soap.Client, task vimtypes.ManagedObjectReference) (
+	vimtypes.AnyType, error) {
+	for {
+		info, err := smsmethods.QuerySmsTaskInfo(ctx, smsClient, &smstypes.QuerySmsTaskInfo{This: task})
+		if err != nil {
+			return nil, err
+		}
+		switch smstypes.SmsTaskState(info.Returnval.State) {
+		case smstypes.SmsTaskStateSuccess:
+			res, err := smsmethods.QuerySmsTaskResult(ctx, smsClient, &smstypes.QuerySmsTaskResult{This: task})
+			if err != nil {
+				return nil, err
+			}
+			return res.Returnval, nil
+		case smstypes.SmsTaskStateError:
+			if info.Returnval.Error != nil {
+				return nil, fmt.Errorf("SMS task %q failed. fault: %+v", task.Value, info.Returnval.Error.Fault)
+			}
+			return nil, fmt.Errorf("SMS task %q failed", task.Value)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(smsTaskPollInterval):
+		}
+	}
+}
+
+// getGroupOperationErrors returns an error for the group operation results which are errors.
+func getGroupOperationErrors(result vimtypes.AnyType) error {
+	results, ok := result.(smstypes.ArrayOfGroupOperationResult)
+	if !ok {
+		return nil
+	}
+	for _, groupResult := range results.GroupOperationResult {
+		if errorResult, isError := groupResult.(*smstypes.GroupErrorResult); isError {
+			return fmt.Errorf("operation on replication group %q failed. faults: %+v",
+				errorResult.GroupId.DeviceGroupId.Id, errorResult.Error)
+		}
+	}
+	return nil
+}
+
+// PrepareFailoverReplicationGroup prepares the replication group groupID, whose source is on
+// the virtual center, for a planned failover: the devices of the group are synchronized with
+// the target site and made read-only.
+func (vc *VirtualCenter) PrepareFailoverReplicationGroup(ctx context.Context, groupID vimtypes.ReplicationGroupId) error {
+	log := logger.GetLogger(ctx)
+	smsClient, err := vc.newSmsClient(ctx)
+	if err != nil {
+		return err
+	}
+	provider, err := vc.getReplicationGroupProvider(ctx, smsClient, groupID)
+	if err != nil {
+		return err
+	}
+	res, err := smsmethods.PrepareFailoverReplicationGroup_Task(ctx, smsClient,
+		&smstypes.PrepareFailoverReplicationGroup_Task{
+			This:    provider,
+			GroupId: []vimtypes.ReplicationGroupId{groupID},
+		})
+	if err != nil {
+		return err
+	}
+	result, err := waitForSmsTask(ctx, smsClient, res.Returnval)
+	if err != nil {
+		return err
+	}
+	if err = getGroupOperationErrors(result); err != nil {
+		return err
+	}
+	log.Infof("Prepared replication group %q for failover", groupID.DeviceGroupId.Id)
+	return nil
+}
+
+// FailoverReplicationGroup fails over the replication group groupID, whose target is on the
+// virtual center, and returns the disks recovered on the virtual center. The failover is
+// planned if the source of the group was prepared for the failover, otherwise the devices are
+// recovered from the latest point in time replica.
+func (vc *VirtualCenter) FailoverReplicationGroup(ctx context.Context, groupID vimtypes.ReplicationGroupId,
+	planned bool) ([]RecoveredDisk, error) {
+	log := logger.GetLogger(ctx)
+	smsClient, err := vc.newSmsClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	provider, err := vc.getReplicationGroupProvider(ctx, smsClient, groupID)
+	if err != nil {
+		return nil, err
+	}
+	res, err := smsmethods.FailoverReplicationGroup_Task(ctx, smsClient, &smstypes.FailoverReplicationGroup_Task{
+		This: provider,
+		FailoverParam: &smstypes.FailoverParam{
+			IsPlanned:                   planned,
+			ReplicationGroupsToFailover: []smstypes.ReplicationGroupData{{GroupId: groupID}},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	result, err := waitForSmsTask(ctx, smsClient, res.Returnval)
+	if err != nil {
+		return nil, err
+	}
+	if err = getGroupOperationErrors(result); err != nil {
+		return nil, err
+	}
+	var disks []RecoveredDisk
+	results, _ := result.(smstypes.ArrayOfGroupOperationResult)
+	for _, groupResult := range results.GroupOperationResult {
+		successResult, ok := groupResult.(*smstypes.FailoverSuccessResult)
+		if !ok {
+			continue
+		}
+		for _, device := range successResult.RecoveredDeviceInfo {
+			if device.Error != nil {
+				return nil, fmt.Errorf("failed to recover a device of replication group %q. fault: %+v",
+					groupID.DeviceGroupId.Id, device.Error.Fault)
+			}
+			for _, disk := range device.RecoveredDiskInfo {
+				disks = append(disks, RecoveredDisk{DatastoreURL: disk.DsUrl, Path: disk.DiskPath})
+			}
+		}
+	}
+	log.Infof("Failed over replication group %q, recovered disks: %+v", groupID.DeviceGroupId.Id, disks)
+	return disks, nil
+}
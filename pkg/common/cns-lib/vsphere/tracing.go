@@ -0,0 +1,60 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vsphere
+
+import (
+	"context"
+	"reflect"
+	"strings"
+
+	"github.com/vmware/govmomi/vim25/soap"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"sigs.k8s.io/vsphere-csi-driver/pkg/common/tracing"
+)
+
+// tracingRoundTripper starts a span for each vSphere API method called on
+// the vCenter host, such as CnsCreateVolume or WaitForUpdatesEx.
+type tracingRoundTripper struct {
+	soap.RoundTripper
+	host string
+}
+
+// newTracingRoundTripper returns rt starting a span for each method call.
+func newTracingRoundTripper(rt soap.RoundTripper, host string) soap.RoundTripper {
+	return &tracingRoundTripper{RoundTripper: rt, host: host}
+}
+
+// RoundTrip implements soap.RoundTripper.
+func (rt *tracingRoundTripper) RoundTrip(ctx context.Context, req, res soap.HasFault) error {
+	ctx, span := tracing.StartSpan(ctx, "vsphere."+methodName(req), trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("vsphere.host", rt.host)))
+	err := rt.RoundTripper.RoundTrip(ctx, req, res)
+	tracing.EndSpan(span, err)
+	return err
+}
+
+// methodName returns the name of the vSphere API method of the body of a
+// request, such as "CnsCreateVolume" for a *methods.CnsCreateVolumeBody.
+func methodName(req interface{}) string {
+	t := reflect.TypeOf(req)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return strings.TrimSuffix(t.Name(), "Body")
+}
@@ -0,0 +1,39 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vsphere
+
+import (
+	"testing"
+
+	cnsmethods "github.com/vmware/govmomi/cns/methods"
+	"github.com/vmware/govmomi/vim25/methods"
+)
+
+func TestMethodName(t *testing.T) {
+	tests := []struct {
+		req      interface{}
+		expected string
+	}{
+		{&cnsmethods.CnsCreateVolumeBody{}, "CnsCreateVolume"},
+		{&methods.WaitForUpdatesExBody{}, "WaitForUpdatesEx"},
+	}
+	for _, test := range tests {
+		if name := methodName(test.req); name != test.expected {
+			t.Errorf("expected method %q for %T, got %q", test.expected, test.req, name)
+		}
+	}
+}
@@ -8,8 +8,10 @@ import (
 	"fmt"
 	"net/url"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 
 	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
 
@@ -48,6 +50,32 @@ func IsInvalidCredentialsError(err error) bool {
 	return isInvalidCredentialsError
 }
 
+// IsNotAuthenticatedError returns true if error is of type NotAuthenticated, the
+// fault of calls made with a session that expired or was terminated
+func IsNotAuthenticatedError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if soap.IsSoapFault(err) {
+		if _, ok := soap.ToSoapFault(err).VimFault().(types.NotAuthenticated); ok {
+			return true
+		}
+	}
+	return strings.Contains(err.Error(), "NotAuthenticated")
+}
+
+// IsMethodNotSupportedError returns true if err is the MethodNotFound or
+// NotSupported fault vCenter returns for APIs it doesn't implement
+func IsMethodNotSupportedError(err error) bool {
+	if soap.IsSoapFault(err) {
+		switch soap.ToSoapFault(err).VimFault().(type) {
+		case types.MethodNotFound, types.NotSupported:
+			return true
+		}
+	}
+	return false
+}
+
 // IsNotFoundError checks if err is the NotFound fault, if yes then returns true else return false
 func IsNotFoundError(err error) bool {
 	isNotFoundError := false
@@ -132,15 +160,38 @@ func CreateCnsKuberenetesEntityReference(entityType string, entityName string, n
 }
 
 // GetVirtualCenterConfig returns VirtualCenterConfig Object created using vSphere Configuration
-// specified in the argurment.
+// specified in the argurment. When several vCenters are configured, the first one in
+// the order of GetVcenterIPs is returned.
 func GetVirtualCenterConfig(ctx context.Context, cfg *config.Config) (*VirtualCenterConfig, error) {
-	log := logger.GetLogger(ctx)
-	var err error
-	vCenterIPs, err := GetVcenterIPs(cfg) //  make([]string, 0)
+	vCenterIPs, err := GetVcenterIPs(cfg)
 	if err != nil {
 		return nil, err
 	}
-	host := vCenterIPs[0]
+	return getVirtualCenterConfigForHost(ctx, cfg, vCenterIPs[0])
+}
+
+// GetVirtualCenterConfigs returns a VirtualCenterConfig for every VirtualCenter section of
+// the vSphere Configuration, in the order of GetVcenterIPs.
+func GetVirtualCenterConfigs(ctx context.Context, cfg *config.Config) ([]*VirtualCenterConfig, error) {
+	vCenterIPs, err := GetVcenterIPs(cfg)
+	if err != nil {
+		return nil, err
+	}
+	vcConfigs := make([]*VirtualCenterConfig, 0, len(vCenterIPs))
+	for _, host := range vCenterIPs {
+		vcConfig, err := getVirtualCenterConfigForHost(ctx, cfg, host)
+		if err != nil {
+			return nil, err
+		}
+		vcConfigs = append(vcConfigs, vcConfig)
+	}
+	return vcConfigs, nil
+}
+
+// getVirtualCenterConfigForHost returns the VirtualCenterConfig of the VirtualCenter section
+// named host.
+func getVirtualCenterConfigForHost(ctx context.Context, cfg *config.Config, host string) (*VirtualCenterConfig, error) {
+	log := logger.GetLogger(ctx)
 	port, err := strconv.Atoi(cfg.VirtualCenter[host].VCenterPort)
 	if err != nil {
 		return nil, err
@@ -182,6 +233,8 @@ func GetVirtualCenterConfig(ctx context.Context, cfg *config.Config) (*VirtualCe
 		TargetvSANFileShareDatastoreURLs: targetDatastoreUrlsForFile,
 		TargetvSANFileShareClusters:      targetvSANClustersForFile,
 		VCClientTimeout:                  vcClientTimeout,
+		ProxyURL:                         cfg.Global.ProxyURL,
+		NoProxy:                          cfg.Global.NoProxy,
 	}
 
 	if strings.TrimSpace(cfg.VirtualCenter[host].Datacenters) != "" {
@@ -205,7 +258,8 @@ func GetVirtualCenterConfig(ctx context.Context, cfg *config.Config) (*VirtualCe
 	return vcConfig, nil
 }
 
-// GetVcenterIPs returns list of vCenter IPs from VSphereConfig
+// GetVcenterIPs returns list of vCenter IPs from VSphereConfig, sorted so that
+// the first vCenter is the same on every call.
 func GetVcenterIPs(cfg *config.Config) ([]string, error) {
 	var err error
 	vCenterIPs := make([]string, 0)
@@ -215,6 +269,7 @@ func GetVcenterIPs(cfg *config.Config) ([]string, error) {
 	if len(vCenterIPs) == 0 {
 		err = errors.New("unable get vCenter Hosts from VSphereConfig")
 	}
+	sort.Strings(vCenterIPs)
 	return vCenterIPs, err
 }
 
@@ -239,6 +294,19 @@ func CompareKubernetesMetadata(ctx context.Context, k8sMetaData *cnstypes.CnsKub
 	return labelsMatch
 }
 
+// newSTSClient creates the client of the STS service of the vCenter of c,
+// with the proxy of c. The URL of the service is looked up without the proxy
+// of c, if the lookup fails the STS service of the vCenter is used, as with an
+// embedded PSC.
+func newSTSClient(ctx context.Context, c *vim25.Client) (*sts.Client, error) {
+	tokens, err := sts.NewClient(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	useProxyOf(c, tokens.Client)
+	return tokens, nil
+}
+
 // Signer decodes the certificate and private key and returns SAML token needed for authentication
 func signer(ctx context.Context, client *vim25.Client, username string, password string) (*sts.Signer, error) {
 	pemBlock, _ := pem.Decode([]byte(username))
@@ -249,7 +317,7 @@ func signer(ctx context.Context, client *vim25.Client, username string, password
 	if err != nil {
 		return nil, fmt.Errorf("failed to load X509 key pair. Error: %+v", err)
 	}
-	tokens, err := sts.NewClient(ctx, client)
+	tokens, err := newSTSClient(ctx, client)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create STS client. err: %+v", err)
 	}
@@ -271,6 +339,7 @@ func GetTagManager(ctx context.Context, vc *VirtualCenter) (*tags.Manager, error
 		return nil, fmt.Errorf("vCenter not initialized")
 	}
 	restClient := rest.NewClient(vc.Client.Client)
+	useProxyOf(vc.Client.Client, restClient.Client)
 	signer, err := signer(ctx, vc.Client.Client, vc.Config.Username, vc.Config.Password)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create the Signer. Error: %v", err)
@@ -291,6 +360,41 @@ func GetTagManager(ctx context.Context, vc *VirtualCenter) (*tags.Manager, error
 	return tagManager, nil
 }
 
+var (
+	// tagManagers has the tagManagers returned by GetCachedTagManager, by
+	// vCenter host.
+	tagManagers = make(map[string]*tags.Manager)
+	// tagManagersLock guards tagManagers.
+	tagManagersLock sync.Mutex
+)
+
+// GetCachedTagManager returns a tagManager connected to given VirtualCenter,
+// keeping its REST session across calls instead of logging in each time. The
+// session is checked on each call and a new one is created once it expired.
+// Callers must not log it out.
+func GetCachedTagManager(ctx context.Context, vc *VirtualCenter) (*tags.Manager, error) {
+	log := logger.GetLogger(ctx)
+	if vc == nil || vc.Config == nil {
+		return nil, fmt.Errorf("vCenter not initialized")
+	}
+	tagManagersLock.Lock()
+	defer tagManagersLock.Unlock()
+	if tagManager, ok := tagManagers[vc.Config.Host]; ok {
+		session, err := tagManager.Session(ctx)
+		if err == nil && session != nil {
+			return tagManager, nil
+		}
+		log.Infof("Renewing the tagManager session of vCenter %q. err: %v", vc.Config.Host, err)
+		delete(tagManagers, vc.Config.Host)
+	}
+	tagManager, err := GetTagManager(ctx, vc)
+	if err != nil {
+		return nil, err
+	}
+	tagManagers[vc.Config.Host] = tagManager
+	return tagManager, nil
+}
+
 // GetCandidateDatastoresInCluster gets the shared datastores and vSAN-direct managed datastores of given VC cluster
 // The 1st output parameter will be shared datastores
 // The 2nd output parameter will be vSAN-direct managed datastores
@@ -68,6 +68,9 @@ type VirtualCenter struct {
 	VsanClient *vsan.Client
 	// VslmClient represents the Vslm client instance.
 	VslmClient *vslm.Client
+	// pbmVimClient is the vim25 client PbmClient was created from, PbmClient
+	// shares its session and is recreated when the vim25 client is replaced.
+	pbmVimClient *vim25.Client
 }
 
 var (
@@ -116,6 +119,12 @@ type VirtualCenterConfig struct {
 	TargetvSANFileShareClusters []string
 	// VCClientTimeout is the time limit in minutes for requests made by vCenter client
 	VCClientTimeout int
+	// ProxyURL is the URL of the proxy the connections to the virtual center go
+	// through, the proxy of the environment is used if it is empty.
+	ProxyURL string
+	// NoProxy is the list of the hosts, domains and CIDRs reached without going
+	// through ProxyURL.
+	NoProxy string
 }
 
 // clientMutex is used for exclusive connection creation.
@@ -135,6 +144,10 @@ func (vc *VirtualCenter) newClient(ctx context.Context) (*govmomi.Client, error)
 	}
 
 	soapClient := soap.NewClient(url, vc.Config.Insecure)
+	if err = setProxy(soapClient, vc.Config.ProxyURL, vc.Config.NoProxy); err != nil {
+		log.Errorf("failed to set the proxy of vCenter %s with err: %v", vc.Config.Host, err)
+		return nil, err
+	}
 	if len(vc.Config.CAFile) > 0 && !vc.Config.Insecure {
 		if err := soapClient.SetRootCAs(vc.Config.CAFile); err != nil {
 			log.Errorf("failed to load CA file: %v", err)
@@ -178,6 +191,7 @@ func (vc *VirtualCenter) newClient(ctx context.Context) (*govmomi.Client, error)
 		vc.Config.RoundTripperCount = DefaultRoundTripperCount
 	}
 	client.RoundTripper = vim25.Retry(client.RoundTripper, vim25.TemporaryNetworkError(vc.Config.RoundTripperCount))
+	client.RoundTripper = newTracingRoundTripper(client.RoundTripper, vc.Config.Host)
 	return client, nil
 }
 
@@ -198,7 +212,7 @@ func (vc *VirtualCenter) login(ctx context.Context, client *govmomi.Client) erro
 		return err
 	}
 
-	tokens, err := sts.NewClient(ctx, client.Client)
+	tokens, err := newSTSClient(ctx, client.Client)
 	if err != nil {
 		log.Errorf("failed to create STS client with err: %v", err)
 		return err
@@ -273,9 +287,10 @@ func (vc *VirtualCenter) connect(ctx context.Context, requestNewSession bool) er
 		return err
 	}
 	// Recreate PbmClient If created using timed out VC Client
+	pbmClientMutex.Lock()
+	defer pbmClientMutex.Unlock()
 	if vc.PbmClient != nil {
-		if vc.PbmClient, err = pbm.NewClient(ctx, vc.Client.Client); err != nil {
-			log.Errorf("failed to create pbm client with err: %v", err)
+		if err = vc.newPbmClient(ctx); err != nil {
 			return err
 		}
 	}
@@ -295,7 +310,7 @@ func (vc *VirtualCenter) connect(ctx context.Context, requestNewSession bool) er
 	}
 	// Recreate VSAN client if created using timed out VC Client
 	if vc.VsanClient != nil {
-		if vc.VsanClient, err = vsan.NewClient(ctx, vc.Client.Client); err != nil {
+		if vc.VsanClient, err = newVsanClient(ctx, vc.Client.Client); err != nil {
 			log.Errorf("failed to create vsan client with err: %v", err)
 			return err
 		}
@@ -355,6 +370,17 @@ func (vc *VirtualCenter) GetDatacenters(ctx context.Context) ([]*Datacenter, err
 	return vc.ListDatacenters(ctx)
 }
 
+// KeepSessionAlive checks the vCenter session, logging in again and recreating
+// the CNS and PBM clients if it expired. Standby controller replicas call it
+// periodically to have a ready session for failover, instead of logging in on
+// the first call after taking over.
+func (vc *VirtualCenter) KeepSessionAlive(ctx context.Context) error {
+	if err := vc.ConnectCns(ctx); err != nil {
+		return err
+	}
+	return vc.ConnectPbm(ctx)
+}
+
 // Disconnect disconnects the virtual center host connection if connected.
 func (vc *VirtualCenter) Disconnect(ctx context.Context) error {
 	log := logger.GetLogger(ctx)
@@ -0,0 +1,146 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vsphere
+
+import (
+	"context"
+	"crypto/tls"
+	"strconv"
+	"testing"
+
+	pbmsim "github.com/vmware/govmomi/pbm/simulator"
+	"github.com/vmware/govmomi/simulator"
+	_ "github.com/vmware/govmomi/vapi/simulator"
+)
+
+// TestKeepSessionAlive checks that an expired vCenter session is replaced,
+// along with the clients sharing it, before the next call needs it.
+func TestKeepSessionAlive(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	model := simulator.VPX()
+	defer model.Remove()
+	if err := model.Create(); err != nil {
+		t.Fatal(err)
+	}
+	model.Service.TLS = new(tls.Config)
+	s := model.Service.NewServer()
+	defer s.Close()
+	model.Service.RegisterSDK(pbmsim.New())
+
+	port, err := strconv.Atoi(s.URL.Port())
+	if err != nil {
+		t.Fatal(err)
+	}
+	password, _ := s.URL.User.Password()
+	vc := &VirtualCenter{
+		Config: &VirtualCenterConfig{
+			Host:     s.URL.Hostname(),
+			Port:     port,
+			Username: s.URL.User.Username(),
+			Password: password,
+			Insecure: true,
+		},
+	}
+
+	if err := vc.KeepSessionAlive(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if vc.CnsClient == nil || vc.PbmClient == nil {
+		t.Fatalf("expected the CNS and PBM clients to be created")
+	}
+	client := vc.Client
+	if err := vc.KeepSessionAlive(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if vc.Client != client {
+		t.Errorf("expected the active session to be kept")
+	}
+
+	// Terminate the session, it has to be replaced.
+	if err := vc.Client.Logout(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := vc.KeepSessionAlive(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if vc.Client == client {
+		t.Errorf("expected a new session to replace the expired one")
+	}
+	if vc.pbmVimClient != vc.Client.Client {
+		t.Errorf("expected the PBM client to share the new session")
+	}
+}
+
+// TestGetCachedTagManager checks that the REST session of the tagManager is
+// reused by calls, and replaced once it's no longer valid.
+func TestGetCachedTagManager(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	model := simulator.VPX()
+	defer model.Remove()
+	if err := model.Create(); err != nil {
+		t.Fatal(err)
+	}
+	model.Service.RegisterEndpoints = true
+	model.Service.TLS = new(tls.Config)
+	s := model.Service.NewServer()
+	defer s.Close()
+
+	port, err := strconv.Atoi(s.URL.Port())
+	if err != nil {
+		t.Fatal(err)
+	}
+	password, _ := s.URL.User.Password()
+	vc := &VirtualCenter{
+		Config: &VirtualCenterConfig{
+			Host:     s.URL.Hostname(),
+			Port:     port,
+			Username: s.URL.User.Username(),
+			Password: password,
+			Insecure: true,
+		},
+	}
+	if err := vc.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	tagManager, err := GetCachedTagManager(ctx, vc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessionID := tagManager.SessionID()
+	if cached, err := GetCachedTagManager(ctx, vc); err != nil || cached != tagManager ||
+		cached.SessionID() != sessionID {
+		t.Fatalf("expected the tagManager and its session to be reused, err: %v", err)
+	}
+
+	// Terminate the session, a new one has to be created.
+	if err := tagManager.Logout(ctx); err != nil {
+		t.Fatal(err)
+	}
+	renewed, err := GetCachedTagManager(ctx, vc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if renewed == tagManager {
+		t.Errorf("expected a new tagManager to replace the logged out one")
+	}
+	if _, err := renewed.GetCategories(ctx); err != nil {
+		t.Errorf("expected the new tagManager to be logged in, err: %v", err)
+	}
+}
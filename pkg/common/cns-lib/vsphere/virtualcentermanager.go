@@ -56,6 +56,8 @@ type VirtualCenterManager interface {
 	IsExtendVolumeSupported(ctx context.Context, host string) (bool, error)
 	// IsOnlineExtendVolumeSupported checks if online extend volume is supported or not on the vCenter Host
 	IsOnlineExtendVolumeSupported(ctx context.Context, host string) (bool, error)
+	// IsFileVolumeExtendSupported checks if the file share quota of file volumes can be extended on the vCenter Host
+	IsFileVolumeExtendSupported(ctx context.Context, host string) (bool, error)
 }
 
 var (
@@ -192,3 +194,23 @@ func (m *defaultVirtualCenterManager) IsOnlineExtendVolumeSupported(ctx context.
 	log.Infof("Online volume expansion is not supported on vCenter version %q", vCenterVersion)
 	return false, nil
 }
+
+// IsFileVolumeExtendSupported checks if extending the file share quota of file
+// volumes is supported or not, it is from vSphere 7.0 Update 3.
+func (m *defaultVirtualCenterManager) IsFileVolumeExtendSupported(ctx context.Context, host string) (bool, error) {
+	log := logger.GetLogger(ctx)
+	vcenter, err := m.GetVirtualCenter(ctx, host)
+	if err != nil {
+		log.Errorf("Failed to get vCenter. Err: %v", err)
+		return false, err
+	}
+	about := vcenter.Client.ServiceContent.About
+	supported, err := IsvSphereVersion70U3orAbove(ctx, about)
+	if err != nil {
+		return false, err
+	}
+	if !supported {
+		log.Infof("File volume expansion is not supported on vCenter version %q", about.Version)
+	}
+	return supported, nil
+}
@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/vmware/govmomi/vapi/tags"
 	"github.com/vmware/govmomi/vim25/mo"
@@ -34,6 +35,10 @@ import (
 // ErrVMNotFound is returned when a virtual machine isn't found.
 var ErrVMNotFound = errors.New("virtual machine wasn't found")
 
+// ErrDatacenterNotFound is returned when no datacenter is found to search for
+// a virtual machine, in which case it isn't known whether it exists.
+var ErrDatacenterNotFound = errors.New("no datacenter was found")
+
 // VirtualMachine holds details of a virtual machine instance.
 type VirtualMachine struct {
 	// VirtualCenterHost represents the virtual machine's vCenter host.
@@ -130,6 +135,8 @@ func GetVirtualMachineByUUID(ctx context.Context, uuid string, instanceUUID bool
 	var wg sync.WaitGroup
 	var nodeVM *VirtualMachine
 	var poolErr error
+	// dcCount is the number of datacenters searched.
+	var dcCount int32
 
 	for i := 0; i < poolSize; i++ {
 		wg.Add(1)
@@ -162,6 +169,7 @@ func GetVirtualMachineByUUID(ctx context.Context, uuid string, instanceUUID bool
 
 					// Found some Datacenter object.
 					log.Infof("AsyncGetAllDatacenters with uuid %s sent a dc %v", uuid, dc)
+					atomic.AddInt32(&dcCount, 1)
 					if vm, err := dc.GetVirtualMachineByUUID(ctx, uuid, instanceUUID); err != nil {
 						if err == ErrVMNotFound {
 							// Didn't find VM on this DC, so, continue searching on other DCs.
@@ -191,6 +199,9 @@ func GetVirtualMachineByUUID(ctx context.Context, uuid string, instanceUUID bool
 	} else if poolErr != nil {
 		log.Errorf("Returning err: %v for UUID %s", poolErr, uuid)
 		return nil, poolErr
+	} else if atomic.LoadInt32(&dcCount) == 0 {
+		log.Errorf("Returning datacenter not found err for UUID %s", uuid)
+		return nil, ErrDatacenterNotFound
 	} else {
 		log.Errorf("Returning VM not found err for UUID %s", uuid)
 		return nil, ErrVMNotFound
@@ -215,6 +226,73 @@ func (vm *VirtualMachine) GetHostSystem(ctx context.Context) (*object.HostSystem
 	return vmHost, nil
 }
 
+// GetComputeResource returns the compute resource, a cluster or a standalone
+// host, of the host running the virtual machine.
+func (vm *VirtualMachine) GetComputeResource(ctx context.Context) (*object.ComputeResource, error) {
+	log := logger.GetLogger(ctx)
+	vmHost, err := vm.VirtualMachine.HostSystem(ctx)
+	if err != nil {
+		log.Errorf("failed to get host system for vm: %v. err: %+v", vm, err)
+		return nil, err
+	}
+	var oHost mo.HostSystem
+	err = vmHost.Properties(ctx, vmHost.Reference(), []string{"parent"}, &oHost)
+	if err != nil {
+		log.Errorf("failed to get parent of host system %v. err: %+v", vmHost.Reference(), err)
+		return nil, err
+	}
+	if oHost.Parent == nil {
+		return nil, fmt.Errorf("host system %v of vm %v has no compute resource", vmHost.Reference(), vm)
+	}
+	return object.NewComputeResource(vm.Client(), *oHost.Parent), nil
+}
+
+// IsDiskUUIDEnabled returns true if the disk.EnableUUID advanced setting of the
+// virtual machine is TRUE, which exposes the UUIDs of its virtual disks to the
+// guest OS, as the /dev/disk/by-id/wwn-0x<UUID> links on Linux.
+func (vm *VirtualMachine) IsDiskUUIDEnabled(ctx context.Context) (bool, error) {
+	log := logger.GetLogger(ctx)
+	var oVM mo.VirtualMachine
+	err := vm.Properties(ctx, vm.Reference(), []string{"config.extraConfig"}, &oVM)
+	if err != nil {
+		log.Errorf("failed to get extraConfig of vm: %v. err: %+v", vm, err)
+		return false, err
+	}
+	if oVM.Config == nil {
+		return false, nil
+	}
+	for _, option := range oVM.Config.ExtraConfig {
+		value := option.GetOptionValue()
+		if strings.EqualFold(value.Key, "disk.EnableUUID") {
+			enabled, _ := value.Value.(string)
+			return strings.EqualFold(enabled, "TRUE"), nil
+		}
+	}
+	return false, nil
+}
+
+// EnableDiskUUID reconfigures the virtual machine with disk.EnableUUID set to
+// TRUE, which takes effect the next time the virtual machine is powered on.
+func (vm *VirtualMachine) EnableDiskUUID(ctx context.Context) error {
+	log := logger.GetLogger(ctx)
+	spec := types.VirtualMachineConfigSpec{
+		ExtraConfig: []types.BaseOptionValue{
+			&types.OptionValue{Key: "disk.EnableUUID", Value: "TRUE"},
+		},
+	}
+	task, err := vm.Reconfigure(ctx, spec)
+	if err != nil {
+		log.Errorf("failed to reconfigure vm: %v with disk.EnableUUID. err: %+v", vm, err)
+		return err
+	}
+	if err = task.Wait(ctx); err != nil {
+		log.Errorf("failed to set disk.EnableUUID on vm: %v. err: %+v", vm, err)
+		return err
+	}
+	log.Infof("Set disk.EnableUUID to TRUE on vm: %v", vm)
+	return nil
+}
+
 // GetTagManager returns tagManager using vm client
 func (vm *VirtualMachine) GetTagManager(ctx context.Context) (*tags.Manager, error) {
 	log := logger.GetLogger(ctx)
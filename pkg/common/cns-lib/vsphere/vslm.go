@@ -21,18 +21,22 @@ import (
 
 	"github.com/vmware/govmomi/vim25"
 	"github.com/vmware/govmomi/vslm"
+	vslmmethods "github.com/vmware/govmomi/vslm/methods"
+	vslmtypes "github.com/vmware/govmomi/vslm/types"
 	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
 )
 
-// NewVslmClient creates a new Vslm client
+// NewVslmClient creates a new Vslm client, with the proxy of c. Like
+// vslm.NewClient, it retrieves the content of the service.
 func NewVslmClient(ctx context.Context, c *vim25.Client) (*vslm.Client, error) {
 	log := logger.GetLogger(ctx)
-	vslmClient, err := vslm.NewClient(ctx, c)
+	sc := newServiceClient(c, vslm.Path, vslm.Namespace)
+	res, err := vslmmethods.RetrieveContent(ctx, sc, &vslmtypes.RetrieveContent{This: vslm.ServiceInstance})
 	if err != nil {
 		log.Errorf("failed to create a new client for Vslm. err: %v", err)
 		return nil, err
 	}
-	return vslmClient, nil
+	return &vslm.Client{Client: sc, ServiceContent: res.Returnval}, nil
 }
 
 // ConnectVslm creates a Vslm client for the virtual center.
@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
@@ -50,6 +51,11 @@ const (
 	EnvVSphereCSIConfig = "VSPHERE_CSI_CONFIG"
 	// EnvGCConfig contains the path to the CSI GC Config
 	EnvGCConfig = "GC_CONFIG"
+	// EnvVSphereCSIConfigSecret contains the name of the secret with the CSI
+	// vSphere Config, in the namespace of EnvCSINamespace
+	EnvVSphereCSIConfigSecret = "VSPHERE_CSI_CONFIG_SECRET"
+	// EnvCSINamespace contains the namespace of the CSI driver
+	EnvCSINamespace = "CSI_NAMESPACE"
 	// DefaultpvCSIProviderPath is the default path of pvCSI provider config
 	DefaultpvCSIProviderPath = "/etc/cloud/pvcsi-provider"
 	// DefaultSupervisorFSSConfigMapName is the default name of Feature states config map in Supervisor cluster
@@ -67,8 +73,34 @@ const (
 	// interval after which stale CnsVSphereVolumeMigration CRs will be cleaned up.
 	// Current default value is set to 2 hours
 	DefaultVolumeMigrationCRCleanupIntervalInMin = 120
+	// DefaultVolumeOperationRequestCleanupIntervalInMin is the default time
+	// interval after which stale CnsVolumeOperationRequest CRs will be cleaned up.
+	// Current default value is set to 1 hour
+	DefaultVolumeOperationRequestCleanupIntervalInMin = 60
+	// DefaultVolumeOperationRequestTTLInMin is the default time
+	// CnsVolumeOperationRequest CRs are kept after their latest operation.
+	// Current default value is set to 24 hours
+	DefaultVolumeOperationRequestTTLInMin = 1440
+	// VolumeOperationRequestBackendCRD persists the details of the volume
+	// operations in CnsVolumeOperationRequest instances
+	VolumeOperationRequestBackendCRD = "crd"
+	// VolumeOperationRequestBackendConfigMap persists the details of the volume
+	// operations in ConfigMaps
+	VolumeOperationRequestBackendConfigMap = "configmap"
 	// DefaultCSIAuthCheckIntervalInMin is the default time interval to refresh DatastoreMap
 	DefaultCSIAuthCheckIntervalInMin = 5
+	// DefaultDetachPollIntervalInSec is the default interval at which the node VM
+	// is polled after a detach until the volume is removed from it
+	DefaultDetachPollIntervalInSec = 1
+	// DefaultDetachTimeoutInSec is the default time to wait for the volume to be
+	// removed from the node VM after a detach
+	DefaultDetachTimeoutInSec = 60
+	// DefaultVCSessionKeepAliveIntervalInMin is the default interval at which the
+	// controller checks its vCenter session
+	DefaultVCSessionKeepAliveIntervalInMin = 5
+	// DefaultOrphanVolumeMinAgeInMin is the default time a volume stays without
+	// a PV before the orphan volume cleanup deletes it
+	DefaultOrphanVolumeMinAgeInMin = 1440
 )
 
 // Errors
@@ -101,6 +133,18 @@ var (
 
 	// ErrInvalidNetPermission is returned when the value of Permission in NetPermissions is not among the  ones listed
 	ErrInvalidNetPermission = errors.New("invalid value for Permissions under NetPermission Config")
+
+	// ErrInvalidDiskPlacement is returned when the value of disk-controller-type or
+	// disk-placement-policy is not among the ones listed
+	ErrInvalidDiskPlacement = errors.New("invalid value for disk-controller-type or disk-placement-policy under Global Config")
+
+	// ErrInvalidProxyURL is returned when proxy-url isn't the URL of an http,
+	// https or socks5 proxy
+	ErrInvalidProxyURL = errors.New("invalid value for proxy-url under Global Config")
+
+	// ErrInvalidVolumeOperationRequestBackend is returned when
+	// volumeoperationrequest-backend is neither crd nor configmap.
+	ErrInvalidVolumeOperationRequestBackend = errors.New("invalid value for volumeoperationrequest-backend under Global Config")
 )
 
 func getEnvKeyValue(match string, partial bool) (string, string, error) {
@@ -320,15 +364,69 @@ func validateConfig(ctx context.Context, cfg *Config) error {
 		}
 	}
 
+	switch strings.ToLower(cfg.Global.DiskControllerType) {
+	case "", "pvscsi", "nvme":
+	default:
+		log.Errorf("Invalid value %s for disk-controller-type, expected pvscsi or nvme", cfg.Global.DiskControllerType)
+		return ErrInvalidDiskPlacement
+	}
+	switch strings.ToLower(cfg.Global.DiskPlacementPolicy) {
+	case "", "fill", "spread":
+	default:
+		log.Errorf("Invalid value %s for disk-placement-policy, expected fill or spread", cfg.Global.DiskPlacementPolicy)
+		return ErrInvalidDiskPlacement
+	}
+	if cfg.Global.ProxyURL != "" {
+		proxyURL, err := url.Parse(cfg.Global.ProxyURL)
+		if err != nil || proxyURL.Host == "" {
+			log.Errorf("Invalid value %s for proxy-url, expected the URL of a proxy", cfg.Global.ProxyURL)
+			return ErrInvalidProxyURL
+		}
+		switch proxyURL.Scheme {
+		case "http", "https", "socks5":
+		default:
+			log.Errorf("Invalid scheme %s of proxy-url, expected http, https or socks5", proxyURL.Scheme)
+			return ErrInvalidProxyURL
+		}
+	}
+
 	if cfg.Global.CnsRegisterVolumesCleanupIntervalInMin == 0 {
 		cfg.Global.CnsRegisterVolumesCleanupIntervalInMin = DefaultCnsRegisterVolumesCleanupIntervalInMin
 	}
 	if cfg.Global.VolumeMigrationCRCleanupIntervalInMin == 0 {
 		cfg.Global.VolumeMigrationCRCleanupIntervalInMin = DefaultVolumeMigrationCRCleanupIntervalInMin
 	}
+	if cfg.Global.VolumeOperationRequestCleanupIntervalInMin == 0 {
+		cfg.Global.VolumeOperationRequestCleanupIntervalInMin = DefaultVolumeOperationRequestCleanupIntervalInMin
+	}
+	if cfg.Global.VolumeOperationRequestTTLInMin == 0 {
+		cfg.Global.VolumeOperationRequestTTLInMin = DefaultVolumeOperationRequestTTLInMin
+	}
+	switch cfg.Global.VolumeOperationRequestBackend {
+	case "":
+		cfg.Global.VolumeOperationRequestBackend = VolumeOperationRequestBackendCRD
+	case VolumeOperationRequestBackendCRD, VolumeOperationRequestBackendConfigMap:
+	default:
+		log.Errorf("Invalid volumeoperationrequest-backend %q, expected %s or %s",
+			cfg.Global.VolumeOperationRequestBackend, VolumeOperationRequestBackendCRD,
+			VolumeOperationRequestBackendConfigMap)
+		return ErrInvalidVolumeOperationRequestBackend
+	}
 	if cfg.Global.CSIAuthCheckIntervalInMin == 0 {
 		cfg.Global.CSIAuthCheckIntervalInMin = DefaultCSIAuthCheckIntervalInMin
 	}
+	if cfg.Global.DetachPollIntervalInSec <= 0 {
+		cfg.Global.DetachPollIntervalInSec = DefaultDetachPollIntervalInSec
+	}
+	if cfg.Global.DetachTimeoutInSec == 0 {
+		cfg.Global.DetachTimeoutInSec = DefaultDetachTimeoutInSec
+	}
+	if cfg.Global.VCSessionKeepAliveIntervalInMin == 0 {
+		cfg.Global.VCSessionKeepAliveIntervalInMin = DefaultVCSessionKeepAliveIntervalInMin
+	}
+	if cfg.Global.OrphanVolumeMinAgeInMin <= 0 {
+		cfg.Global.OrphanVolumeMinAgeInMin = DefaultOrphanVolumeMinAgeInMin
+	}
 	return nil
 }
 
@@ -380,6 +478,19 @@ func GetCnsconfig(ctx context.Context, cfgPath string) (*Config, error) {
 	return cfg, nil
 }
 
+// VCenterCredentialsChanged returns true if the username or password of a
+// vCenter of oldCfg is different in newCfg. vCenters added to or removed from
+// newCfg aren't credential changes.
+func VCenterCredentialsChanged(oldCfg *Config, newCfg *Config) bool {
+	for host, oldVCConfig := range oldCfg.VirtualCenter {
+		newVCConfig, ok := newCfg.VirtualCenter[host]
+		if ok && (newVCConfig.User != oldVCConfig.User || newVCConfig.Password != oldVCConfig.Password) {
+			return true
+		}
+	}
+	return false
+}
+
 // GetDefaultNetPermission returns the default file share net permission.
 func GetDefaultNetPermission() *NetPermissionConfig {
 	return &NetPermissionConfig{
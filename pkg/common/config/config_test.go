@@ -159,6 +159,78 @@ func TestValidateConfigWithInvalidClusterId(t *testing.T) {
 	}
 }
 
+func TestValidateConfigWithProxyURL(t *testing.T) {
+	for proxyURL, valid := range map[string]bool{
+		"http://proxy.example.com:3128":   true,
+		"https://proxy.example.com":       true,
+		"socks5://10.0.0.1:1080":          true,
+		"ftp://proxy.example.com":         false,
+		"proxy.example.com:3128":          false,
+		"http://%zz":                      false,
+		"http:///no-host-in-the-path/url": false,
+	} {
+		cfg := &Config{
+			VirtualCenter: idealVCConfig,
+		}
+		cfg.Global.ProxyURL = proxyURL
+		err := validateConfig(ctx, cfg)
+		if valid && err != nil {
+			t.Errorf("Expected proxy-url %q to be valid, got error %v", proxyURL, err)
+		}
+		if !valid && err != ErrInvalidProxyURL {
+			t.Errorf("Expected error %v for proxy-url %q, got %v", ErrInvalidProxyURL, proxyURL, err)
+		}
+	}
+}
+
+func TestValidateConfigWithVolumeOperationRequestBackend(t *testing.T) {
+	for backend, expected := range map[string]string{
+		"":          VolumeOperationRequestBackendCRD,
+		"crd":       VolumeOperationRequestBackendCRD,
+		"configmap": VolumeOperationRequestBackendConfigMap,
+		"etcd":      "",
+	} {
+		cfg := &Config{
+			VirtualCenter: idealVCConfig,
+		}
+		cfg.Global.VolumeOperationRequestBackend = backend
+		err := validateConfig(ctx, cfg)
+		if expected == "" {
+			if err != ErrInvalidVolumeOperationRequestBackend {
+				t.Errorf("Expected error %v for volumeoperationrequest-backend %q, got %v",
+					ErrInvalidVolumeOperationRequestBackend, backend, err)
+			}
+			continue
+		}
+		if err != nil || cfg.Global.VolumeOperationRequestBackend != expected {
+			t.Errorf("Expected volumeoperationrequest-backend %q to be %q, got %q and error %v",
+				backend, expected, cfg.Global.VolumeOperationRequestBackend, err)
+		}
+	}
+}
+
+func TestVCenterCredentialsChanged(t *testing.T) {
+	oldCfg := &Config{
+		VirtualCenter: map[string]*VirtualCenterConfig{
+			"1.1.1.1": {User: "Admin", Password: "Password"},
+		},
+	}
+	for _, test := range []struct {
+		virtualCenter map[string]*VirtualCenterConfig
+		expected      bool
+	}{
+		{map[string]*VirtualCenterConfig{"1.1.1.1": {User: "Admin", Password: "Password"}}, false},
+		{map[string]*VirtualCenterConfig{"1.1.1.1": {User: "Admin", Password: "NewPassword"}}, true},
+		{map[string]*VirtualCenterConfig{"1.1.1.1": {User: "NewAdmin", Password: "Password"}}, true},
+		{map[string]*VirtualCenterConfig{"2.2.2.2": {User: "NewAdmin", Password: "NewPassword"}}, false},
+	} {
+		newCfg := &Config{VirtualCenter: test.virtualCenter}
+		if actual := VCenterCredentialsChanged(oldCfg, newCfg); actual != test.expected {
+			t.Errorf("expected credentials changed %t for %+v, got %t", test.expected, test.virtualCenter, actual)
+		}
+	}
+}
+
 func isConfigEqual(actual *Config, expected *Config) bool {
 	// TODO: Compare Global struct
 	// Compare VC Config
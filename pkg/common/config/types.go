@@ -49,6 +49,19 @@ type Config struct {
 		// VolumeMigrationCRCleanupIntervalInMin specifies the interval after which
 		// stale CnsVSphereVolumeMigration CRs will be cleaned up.
 		VolumeMigrationCRCleanupIntervalInMin int `gcfg:"volumemigration-cr-cleanup-intervalinmin"`
+		// VolumeOperationRequestCleanupIntervalInMin specifies the interval after which
+		// stale CnsVolumeOperationRequest CRs will be cleaned up. A negative value
+		// disables the cleanup.
+		VolumeOperationRequestCleanupIntervalInMin int `gcfg:"volumeoperationrequest-cleanup-intervalinmin"`
+		// VolumeOperationRequestTTLInMin specifies how long CnsVolumeOperationRequest CRs
+		// are kept after their latest operation, even if their volume still exists.
+		// A negative value keeps them until their volume is deleted.
+		VolumeOperationRequestTTLInMin int `gcfg:"volumeoperationrequest-ttl-inmin"`
+		// VolumeOperationRequestBackend is where the details of the volume operations are
+		// persisted, "crd" for CnsVolumeOperationRequest instances or "configmap" for
+		// ConfigMaps in the namespace of the driver, for clusters where the driver can't
+		// create CRDs. Defaults to crd.
+		VolumeOperationRequestBackend string `gcfg:"volumeoperationrequest-backend"`
 		// VCClientTimeout specifies a time limit in minutes for requests made by client
 		// If not set, default will be 5 minutes
 		VCClientTimeout int `gcfg:"vc-client-timeout"`
@@ -57,6 +70,64 @@ type Config struct {
 
 		//CSIAuthCheckIntervalInMin specifies the interval that the auth check for datastores will be trigger
 		CSIAuthCheckIntervalInMin int `gcfg:"csi-auth-check-intervalinmin"`
+		// NodeNotReadyForceDetachTimeoutInMin specifies how long a node stays NotReady before
+		// the volumes attached to it are force detached from its VM, if the VM is powered off.
+		// It also enables force detaching the volumes of deleted nodes. Zero, the default,
+		// or a negative value disables force detaching volumes.
+		NodeNotReadyForceDetachTimeoutInMin int `gcfg:"node-notready-force-detach-timeout-inmin"`
+		// DetachPollIntervalInSec specifies the interval at which the node VM is polled
+		// after a detach until the volume is removed from it.
+		DetachPollIntervalInSec int `gcfg:"detach-poll-interval-insec"`
+		// DetachTimeoutInSec specifies how long to wait for the volume to be removed from
+		// the node VM after a detach. A negative value disables waiting.
+		DetachTimeoutInSec int `gcfg:"detach-timeout-insec"`
+		// ForceDetachOnTimeout detaches the volume again when it is still on the node VM
+		// once DetachTimeoutInSec elapses, instead of failing the detach right away. The
+		// detach only succeeds if the volume is removed from the node VM then.
+		ForceDetachOnTimeout bool `gcfg:"force-detach-on-timeout"`
+		// VCSessionKeepAliveIntervalInMin specifies the interval at which the controller
+		// checks its vCenter session, logging in again if it expired, so that standby
+		// replicas are ready to take over. A negative value disables the check.
+		VCSessionKeepAliveIntervalInMin int `gcfg:"vc-session-keepalive-intervalinmin"`
+		// VolumeTagLabels is a comma separated list of PVC and PV label keys mirrored as
+		// vSphere tags on the FCDs of the block volumes, in a tag category named after the
+		// label key. Labels of the PVC take precedence over the ones of the PV.
+		VolumeTagLabels string `gcfg:"volume-tag-labels"`
+		// EnableDiskUUIDRemediation sets disk.EnableUUID to TRUE on the VMs of the nodes
+		// registered without it, so that the guest OS exposes the UUIDs of the disks.
+		EnableDiskUUIDRemediation bool `gcfg:"enable-disk-uuid-remediation"`
+		// DiskControllerType is the type of the controllers, pvscsi or nvme, volumes are
+		// attached to when their StorageClass doesn't set it. Defaults to pvscsi.
+		DiskControllerType string `gcfg:"disk-controller-type"`
+		// DiskPlacementPolicy is how volumes are distributed across the controllers of the
+		// node VMs, fill or spread, when their StorageClass doesn't set it. Defaults to fill.
+		DiskPlacementPolicy string `gcfg:"disk-placement-policy"`
+		// ProxyURL is the URL of the HTTP, HTTPS or SOCKS5 proxy the connections to
+		// vCenter go through, for example "http://proxy.example.com:3128". If not set,
+		// the HTTPS_PROXY and NO_PROXY environment variables are used.
+		ProxyURL string `gcfg:"proxy-url"`
+		// NoProxy is a comma separated list of hosts, domains and CIDRs of the vCenters
+		// reached without going through ProxyURL, in the format of NO_PROXY.
+		NoProxy string `gcfg:"no-proxy"`
+		// VolumeHealthIntervalInMin specifies the interval at which the syncer syncs the
+		// health of the volumes from CNS to the PVCs in Supervisor clusters. A negative value
+		// disables the volume health sync. If not set, the VOLUME_HEALTH_INTERVAL_MINUTES
+		// environment variable is used, or 5 minutes.
+		VolumeHealthIntervalInMin int `gcfg:"volume-health-intervalinmin"`
+		// VolumeHealthIncludeNamespaces is a comma separated list of the namespaces whose PVCs
+		// get the health of their volumes synced. If not set, all namespaces are included.
+		VolumeHealthIncludeNamespaces string `gcfg:"volume-health-include-namespaces"`
+		// VolumeHealthExcludeNamespaces is a comma separated list of the namespaces whose PVCs
+		// don't get the health of their volumes synced. It takes precedence over
+		// VolumeHealthIncludeNamespaces.
+		VolumeHealthExcludeNamespaces string `gcfg:"volume-health-exclude-namespaces"`
+		// DeleteOrphanVolumes deletes the CNS volumes of the cluster, and their FCDs, found
+		// without a PV and without Kubernetes metadata for longer than OrphanVolumeMinAgeInMin.
+		// If not set, they are only reported.
+		DeleteOrphanVolumes bool `gcfg:"delete-orphan-volumes"`
+		// OrphanVolumeMinAgeInMin specifies how long a volume is found without a PV
+		// before the orphan volume cleanup deletes it.
+		OrphanVolumeMinAgeInMin int `gcfg:"orphan-volume-min-age-inmin"`
 	}
 
 	// Multiple sets of Net Permissions applied to all file shares
@@ -41,6 +41,10 @@ const (
 	PrometheusDetachVolumeOpType = "detach-volume"
 	// PrometheusExpandVolumeOpType represents the ExpandVolume operation.
 	PrometheusExpandVolumeOpType = "expand-volume"
+	// PrometheusCreateSnapshotOpType represents the CreateSnapshot operation.
+	PrometheusCreateSnapshotOpType = "create-snapshot"
+	// PrometheusDeleteSnapshotOpType represents the DeleteSnapshot operation.
+	PrometheusDeleteSnapshotOpType = "delete-snapshot"
 
 	// CNS operation types
 
@@ -60,12 +64,40 @@ const (
 	PrometheusCnsQueryVolumeOpType = "query-volume"
 	// PrometheusCnsQueryAllVolumeOpType represents the QueryAllVolume operation.
 	PrometheusCnsQueryAllVolumeOpType = "query-all-volume"
+	// PrometheusCnsQueryVolumeAsyncOpType represents the QueryVolumeAsync operation.
+	PrometheusCnsQueryVolumeAsyncOpType = "query-volume-async"
 	// PrometheusCnsQueryVolumeInfoOpType represents the QueryVolumeInfo operation.
 	PrometheusCnsQueryVolumeInfoOpType = "query-volume-info"
 	// PrometheusCnsRelocateVolumeOpType represents the RelocateVolume operation.
 	PrometheusCnsRelocateVolumeOpType = "relocate-volume"
 	// PrometheusCnsConfigureVolumeACLOpType represents the ConfigureVolumeAcl operation.
 	PrometheusCnsConfigureVolumeACLOpType = "configure-volume-acl"
+	// PrometheusCnsCreateSnapshotOpType represents the CreateSnapshot operation.
+	PrometheusCnsCreateSnapshotOpType = "create-snapshot"
+	// PrometheusCnsDeleteSnapshotOpType represents the DeleteSnapshot operation.
+	PrometheusCnsDeleteSnapshotOpType = "delete-snapshot"
+	// PrometheusCnsCreateVolumeFromSnapshotOpType represents the CreateVolumeFromSnapshot operation.
+	PrometheusCnsCreateVolumeFromSnapshotOpType = "create-volume-from-snapshot"
+	// PrometheusCnsCloneVolumeOpType represents the CloneVolume operation.
+	PrometheusCnsCloneVolumeOpType = "clone-volume"
+
+	// Full sync phases
+
+	// PrometheusFullSyncCreatePhase represents the creation of the volumes missing in CNS.
+	PrometheusFullSyncCreatePhase = "create"
+	// PrometheusFullSyncUpdatePhase represents the update of the metadata of the volumes in CNS.
+	PrometheusFullSyncUpdatePhase = "update"
+	// PrometheusFullSyncDeletePhase represents the deletion of the volumes missing in Kubernetes.
+	PrometheusFullSyncDeletePhase = "delete"
+
+	// Full sync drift types
+
+	// PrometheusMissingDriftType represents volumes of PVs that are not in CNS.
+	PrometheusMissingDriftType = "missing"
+	// PrometheusStaleDriftType represents volumes whose metadata in CNS differs from Kubernetes.
+	PrometheusStaleDriftType = "stale"
+	// PrometheusOrphanedDriftType represents volumes in CNS whose PV is not in Kubernetes.
+	PrometheusOrphanedDriftType = "orphaned"
 
 	// PrometheusPassStatus represents a successful API run.
 	PrometheusPassStatus = "pass"
@@ -86,6 +118,13 @@ var (
 		Help: "Syncer Info",
 	}, []string{"version"})
 
+	// LeaderElectionIsLeader is a gauge metric set to 1 on the instance that is
+	// the leader of the component, and 0 on the other instances.
+	LeaderElectionIsLeader = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "vsphere_leader_election_is_leader",
+		Help: "Whether the instance is the leader of the component",
+	}, []string{"name"})
+
 	// CsiControlOpsHistVec is a histogram vector metric to observe various control
 	// operations in CSI.
 	CsiControlOpsHistVec = promauto.NewHistogramVec(prometheus.HistogramOpts{
@@ -101,6 +140,29 @@ var (
 		// Possible status - "pass", "fail"
 		[]string{"voltype", "optype", "status"})
 
+	// CsiGrpcRequestsTotal is a counter vector metric to observe the CSI gRPC
+	// requests served by the controller and node plugins.
+	CsiGrpcRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "vsphere_csi_grpc_requests_total",
+		Help: "Number of CSI gRPC requests served.",
+	},
+		// Possible method - "CreateVolume", "ControllerPublishVolume", "NodeStageVolume", etc
+		// Possible code - "OK", "InvalidArgument", "Internal", etc
+		[]string{"method", "code"})
+
+	// CsiGrpcRequestsHistVec is a histogram vector metric to observe the latency
+	// of the CSI gRPC requests served by the controller and node plugins.
+	CsiGrpcRequestsHistVec = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "vsphere_csi_grpc_request_duration_seconds",
+		Help: "Histogram vector for the latency of CSI gRPC requests.",
+		// Node and probe requests take milliseconds, controller requests calling
+		// CNS take seconds.
+		Buckets: []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2, 5, 10, 20, 30, 60, 120, 300},
+	},
+		// Possible method - "CreateVolume", "ControllerPublishVolume", "NodeStageVolume", etc
+		// Possible code - "OK", "InvalidArgument", "Internal", etc
+		[]string{"method", "code"})
+
 	// CnsControlOpsHistVec is a histogram vector metric to observe various control
 	// operations on CNS. Note that this captures the time taken by CNS into a bucket
 	// as seen by the client(CSI in this case).
@@ -115,4 +177,147 @@ var (
 		// Possible optype - "create-volume", "delete-volume", "attach-volume", "detach-volume", "expand-volume", etc
 		// Possible status - "pass", "fail"
 		[]string{"optype", "status"})
+
+	// CnsTaskWaitHistVec is a histogram vector metric to observe the time spent
+	// polling the CNS tasks of the operations until they complete.
+	CnsTaskWaitHistVec = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "vsphere_cns_task_wait_histogram",
+		Help:    "Histogram vector for the time spent waiting for CNS tasks to complete.",
+		Buckets: []float64{1, 2, 3, 4, 5, 7, 10, 12, 15, 18, 20, 25, 30, 60, 120, 180, 300},
+	},
+		// Possible optype - "create-volume", "delete-volume", "attach-volume", "detach-volume", "expand-volume", etc
+		// Possible status - "pass", "fail"
+		[]string{"optype", "status"})
+
+	// CnsFaultsTotal is a counter vector metric to observe the faults vCenter
+	// failed the CNS operations with.
+	CnsFaultsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "vsphere_cns_faults_total",
+		Help: "Number of faults vCenter failed CNS operations with.",
+	},
+		// Possible optype - "create-volume", "delete-volume", "attach-volume", "detach-volume", "expand-volume", etc
+		// Possible fault - "NotFound", "InvalidState", "CnsFault", "NotAuthenticated", etc
+		[]string{"optype", "fault"})
+
+	// DatastoreCapacityBytes is a gauge metric to observe the capacity of the
+	// datastores holding volumes of the cluster.
+	DatastoreCapacityBytes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "vsphere_datastore_capacity_bytes",
+		Help: "Capacity of the datastores holding volumes of the cluster.",
+	}, []string{"datastore", "url"})
+
+	// DatastoreFreeSpaceBytes is a gauge metric to observe the free space of the
+	// datastores holding volumes of the cluster.
+	DatastoreFreeSpaceBytes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "vsphere_datastore_free_space_bytes",
+		Help: "Free space of the datastores holding volumes of the cluster.",
+	}, []string{"datastore", "url"})
+
+	// VolumeIOPS is a gauge metric to observe the read and write IOPS of the
+	// volumes bound to PVCs, from the performance stats of their virtual disks.
+	VolumeIOPS = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "vsphere_cns_volume_iops",
+		Help: "Read and write IOPS of the volumes bound to PVCs.",
+	}, []string{"namespace", "pvc", "volume_id", "operation"})
+
+	// VolumeThroughputBytes is a gauge metric to observe the read and write
+	// throughput of the volumes bound to PVCs, from the performance stats of
+	// their virtual disks.
+	VolumeThroughputBytes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "vsphere_cns_volume_throughput_bytes_per_second",
+		Help: "Read and write throughput in bytes per second of the volumes bound to PVCs.",
+	}, []string{"namespace", "pvc", "volume_id", "operation"})
+
+	// NamespaceProvisionedBytes is a gauge metric to observe the capacity of
+	// the volumes bound to the PVCs of a namespace, from CNS.
+	NamespaceProvisionedBytes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "vsphere_cns_namespace_provisioned_bytes",
+		Help: "Capacity of the volumes bound to the PVCs of a namespace.",
+	},
+		// Possible voltype - "unknown", "block", "file"
+		[]string{"namespace", "voltype"})
+
+	// NamespaceUsedBytes is a gauge metric to observe the space used on the
+	// mounted volumes bound to the PVCs of a namespace, as reported by the
+	// kubelets from NodeGetVolumeStats.
+	NamespaceUsedBytes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "vsphere_cns_namespace_used_bytes",
+		Help: "Space used on the mounted volumes bound to the PVCs of a namespace.",
+	},
+		// Possible voltype - "unknown", "block", "file"
+		[]string{"namespace", "voltype"})
+
+	// DetachConvergenceHistVec is a histogram vector metric to observe the time
+	// taken for detached volumes to be removed from the node VMs.
+	DetachConvergenceHistVec = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "vsphere_csi_detach_convergence_histogram",
+		Help:    "Histogram vector for the time taken for detached volumes to be removed from the node VMs.",
+		Buckets: []float64{1, 2, 3, 4, 5, 7, 10, 12, 15, 18, 20, 25, 30, 60, 120, 180, 300},
+	},
+		// Possible status - "pass", "fail"
+		[]string{"status"})
+
+	// DetachConvergenceTimeouts is a counter metric to observe the detached
+	// volumes not removed from the node VMs within the timeout.
+	DetachConvergenceTimeouts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "vsphere_csi_detach_convergence_timeouts_total",
+		Help: "Number of detached volumes not removed from the node VMs within the timeout.",
+	},
+		// Possible forced - "true", "false"
+		[]string{"forced"})
+
+	// FullSyncHistVec is a histogram vector metric to observe the time taken by
+	// the full syncs of the syncer.
+	FullSyncHistVec = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "vsphere_full_sync_duration_seconds",
+		Help:    "Histogram vector for the time taken by full syncs.",
+		Buckets: []float64{1, 5, 10, 30, 60, 120, 300, 600, 900, 1200, 1800, 3600},
+	},
+		// Possible status - "pass", "fail"
+		[]string{"status"})
+
+	// FullSyncPhaseHistVec is a histogram vector metric to observe the time
+	// taken by the phases of the full syncs reconciling the volumes with CNS.
+	FullSyncPhaseHistVec = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "vsphere_full_sync_phase_duration_seconds",
+		Help:    "Histogram vector for the time taken by the phases of full syncs.",
+		Buckets: []float64{1, 5, 10, 30, 60, 120, 300, 600, 900, 1200, 1800, 3600},
+	},
+		// Possible phase - "create", "update", "delete"
+		[]string{"phase"})
+
+	// FullSyncVolumesTotal is a counter vector metric to observe the volumes
+	// reconciled with CNS by full syncs.
+	FullSyncVolumesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "vsphere_full_sync_volumes_total",
+		Help: "Number of volumes reconciled with CNS by full syncs.",
+	},
+		// Possible phase - "create", "update", "delete"
+		// Possible status - "pass", "fail"
+		[]string{"phase", "status"})
+
+	// FullSyncDriftVolumes is a gauge metric to observe the volumes diverging
+	// between Kubernetes and CNS found by the last dry run full sync.
+	FullSyncDriftVolumes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "vsphere_full_sync_drift_volumes",
+		Help: "Volumes diverging between Kubernetes and CNS found by the last dry run full sync.",
+	},
+		// Possible type - "missing", "stale", "orphaned"
+		[]string{"type"})
+
+	// OrphanVolumes is a gauge metric to observe the CNS volumes of the cluster
+	// without a PV found by the last run of the orphan volume cleanup.
+	OrphanVolumes = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "vsphere_orphan_volumes",
+		Help: "CNS volumes of the cluster without a PV found by the last run of the orphan volume cleanup.",
+	})
+
+	// OrphanVolumesDeletedTotal is a counter vector metric to observe the
+	// orphan volumes deleted by the orphan volume cleanup.
+	OrphanVolumesDeletedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "vsphere_orphan_volumes_deleted_total",
+		Help: "Number of orphan volumes deleted by the orphan volume cleanup.",
+	},
+		// Possible status - "pass", "fail"
+		[]string{"status"})
 )
@@ -0,0 +1,105 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+// exportTimeout bounds the time an export request to the endpoint takes.
+const exportTimeout = 10 * time.Second
+
+// httpClient is an OTLP/HTTP client of otlptrace, posting the spans as
+// protobuf. The otlptracehttp client isn't used, the generated collector
+// package it depends on requires a version of gRPC newer than the one the
+// driver is built with.
+type httpClient struct {
+	endpoint string
+	client   *http.Client
+}
+
+// newHTTPClient returns a client exporting the spans to the endpoint. The
+// proxy of the environment is used, not the one of vCenter set on
+// http.DefaultTransport.
+func newHTTPClient(endpoint string) *httpClient {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+	return &httpClient{
+		endpoint: endpoint,
+		client:   &http.Client{Transport: transport, Timeout: exportTimeout},
+	}
+}
+
+// Start implements otlptrace.Client.
+func (c *httpClient) Start(ctx context.Context) error {
+	return nil
+}
+
+// Stop implements otlptrace.Client.
+func (c *httpClient) Stop(ctx context.Context) error {
+	c.client.CloseIdleConnections()
+	return nil
+}
+
+// UploadTraces implements otlptrace.Client.
+func (c *httpClient) UploadTraces(ctx context.Context, protoSpans []*tracepb.ResourceSpans) error {
+	body, err := marshalExportTraceServiceRequest(protoSpans)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("failed to export spans to %q: %s", c.endpoint, resp.Status)
+	}
+	return nil
+}
+
+// marshalExportTraceServiceRequest encodes the ExportTraceServiceRequest of
+// the OTLP trace service with the spans, whose only field is resource_spans
+// with number 1.
+func marshalExportTraceServiceRequest(protoSpans []*tracepb.ResourceSpans) ([]byte, error) {
+	var b []byte
+	for _, rs := range protoSpans {
+		data, err := proto.Marshal(rs)
+		if err != nil {
+			return nil, err
+		}
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, data)
+	}
+	return b, nil
+}
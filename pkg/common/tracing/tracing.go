@@ -0,0 +1,155 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package tracing exports OpenTelemetry spans of the CSI requests, of the
+// vSphere API calls and of the CNS tasks to an OTLP/HTTP endpoint.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
+)
+
+const (
+	// EnvOTLPEndpoint is the base URL, such as "http://otel-collector:4318",
+	// of the OTLP/HTTP endpoint the spans are exported to, at the path
+	// "/v1/traces". Tracing is disabled if it isn't set.
+	EnvOTLPEndpoint = "OTEL_EXPORTER_OTLP_ENDPOINT"
+	// EnvOTLPTracesEndpoint is the full URL the spans are exported to. It
+	// takes precedence over OTEL_EXPORTER_OTLP_ENDPOINT.
+	EnvOTLPTracesEndpoint = "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"
+	// EnvServiceName is the service name of the exported spans, the one
+	// given to Init by default.
+	EnvServiceName = "OTEL_SERVICE_NAME"
+	// EnvSamplerRatio is the ratio, between 0 and 1, of the traces started by
+	// the driver that are sampled, 1 by default. The traces propagated in
+	// the CSI requests are sampled if their parent is.
+	EnvSamplerRatio = "OTEL_TRACES_SAMPLER_ARG"
+
+	// tracerName is the name of the tracer of the driver.
+	tracerName = "sigs.k8s.io/vsphere-csi-driver"
+	// tracesPath is the path of the traces endpoint of OTLP/HTTP.
+	tracesPath = "/v1/traces"
+)
+
+// tracerProvider is the tracer provider created by Init, nil if tracing is
+// disabled.
+var tracerProvider *sdktrace.TracerProvider
+
+// Init exports the spans to the OTLP/HTTP endpoint set with the env
+// variables, with the service name of OTEL_SERVICE_NAME or serviceName. It
+// does nothing if no endpoint is set.
+func Init(ctx context.Context, serviceName string) error {
+	log := logger.GetLogger(ctx)
+	endpoint, err := getTracesEndpoint()
+	if err != nil {
+		log.Errorf("invalid OTLP traces endpoint. err: %v", err)
+		return err
+	}
+	if endpoint == "" {
+		log.Infof("%s isn't set, tracing is disabled", EnvOTLPEndpoint)
+		return nil
+	}
+	if name := os.Getenv(EnvServiceName); name != "" {
+		serviceName = name
+	}
+	ratio := 1.0
+	if v := os.Getenv(EnvSamplerRatio); v != "" {
+		if value, err := strconv.ParseFloat(v, 64); err != nil || value < 0 || value > 1 {
+			log.Warnf("Invalid value set for env variable %s: %v. Using default value.", EnvSamplerRatio, v)
+		} else {
+			ratio = value
+		}
+	}
+	exporter, err := otlptrace.New(ctx, newHTTPClient(endpoint))
+	if err != nil {
+		log.Errorf("failed to create the OTLP trace exporter. err: %v", err)
+		return err
+	}
+	tracerProvider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+			semconv.ServiceNameKey.String(serviceName))),
+	)
+	otel.SetTracerProvider(tracerProvider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	log.Infof("Exporting traces of service %q to %q, sampling ratio %v", serviceName, endpoint, ratio)
+	return nil
+}
+
+// Shutdown exports the spans not exported yet. It does nothing if tracing is
+// disabled.
+func Shutdown(ctx context.Context) {
+	if tracerProvider == nil {
+		return
+	}
+	if err := tracerProvider.Shutdown(ctx); err != nil {
+		logger.GetLogger(ctx).Warnf("failed to export the remaining spans. err: %v", err)
+	}
+}
+
+// getTracesEndpoint returns the URL the spans are exported to, or an empty
+// string if no endpoint is set.
+func getTracesEndpoint() (string, error) {
+	endpoint := os.Getenv(EnvOTLPTracesEndpoint)
+	if endpoint == "" {
+		endpoint = os.Getenv(EnvOTLPEndpoint)
+		if endpoint == "" {
+			return "", nil
+		}
+		endpoint = strings.TrimSuffix(endpoint, "/") + tracesPath
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("endpoint %q must be a http or https URL", endpoint)
+	}
+	return endpoint, nil
+}
+
+// StartSpan starts a span of the driver, child of the span of ctx.
+func StartSpan(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, opts...)
+}
+
+// EndSpan ends the span, recording err as its error status if it isn't nil.
+func EndSpan(span trace.Span, err error, attrs ...attribute.KeyValue) {
+	span.SetAttributes(attrs...)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
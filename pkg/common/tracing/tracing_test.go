@@ -0,0 +1,108 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestGetTracesEndpoint(t *testing.T) {
+	defer os.Unsetenv(EnvOTLPEndpoint)
+	defer os.Unsetenv(EnvOTLPTracesEndpoint)
+	tests := []struct {
+		endpoint       string
+		tracesEndpoint string
+		expected       string
+		fails          bool
+	}{
+		{"", "", "", false},
+		{"http://otel-collector:4318", "", "http://otel-collector:4318/v1/traces", false},
+		{"https://otel-collector:4318/", "", "https://otel-collector:4318/v1/traces", false},
+		{"http://otel-collector:4318", "http://jaeger:4318/api/traces", "http://jaeger:4318/api/traces", false},
+		{"otel-collector:4317", "", "", true},
+		{"grpc://otel-collector:4317", "", "", true},
+	}
+	for _, test := range tests {
+		os.Setenv(EnvOTLPEndpoint, test.endpoint)
+		os.Setenv(EnvOTLPTracesEndpoint, test.tracesEndpoint)
+		endpoint, err := getTracesEndpoint()
+		if (err != nil) != test.fails {
+			t.Errorf("expected failure %v for endpoint %q, got %v", test.fails, test.endpoint, err)
+		} else if endpoint != test.expected {
+			t.Errorf("expected traces endpoint %q for %q, got %q", test.expected, test.endpoint, endpoint)
+		}
+	}
+}
+
+func TestUploadTraces(t *testing.T) {
+	spans := []*tracepb.ResourceSpans{
+		{InstrumentationLibrarySpans: []*tracepb.InstrumentationLibrarySpans{{
+			InstrumentationLibrary: &commonpb.InstrumentationLibrary{Name: tracerName},
+			Spans:                  []*tracepb.Span{{Name: "/csi.v1.Controller/CreateVolume"}},
+		}}},
+		{InstrumentationLibrarySpans: []*tracepb.InstrumentationLibrarySpans{{
+			Spans: []*tracepb.Span{{Name: "vsphere.CnsCreateVolume"}},
+		}}},
+	}
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != tracesPath || r.Header.Get("Content-Type") != "application/x-protobuf" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		for len(body) > 0 {
+			num, typ, n := protowire.ConsumeTag(body)
+			if num != 1 || typ != protowire.BytesType {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			data, m := protowire.ConsumeBytes(body[n:])
+			var rs tracepb.ResourceSpans
+			if m < 0 || proto.Unmarshal(data, &rs) != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			received = append(received, rs.InstrumentationLibrarySpans[0].Spans[0].Name)
+			body = body[n+m:]
+		}
+	}))
+	defer server.Close()
+
+	client := newHTTPClient(server.URL + tracesPath)
+	if err := client.UploadTraces(context.Background(), spans); err != nil {
+		t.Fatal(err)
+	}
+	if len(received) != 2 || received[0] != "/csi.v1.Controller/CreateVolume" ||
+		received[1] != "vsphere.CnsCreateVolume" {
+		t.Errorf("expected the spans to be received, got %v", received)
+	}
+	client = newHTTPClient(server.URL + "/v1/unknown")
+	if err := client.UploadTraces(context.Background(), spans); err == nil {
+		t.Error("expected a failed export to return an error")
+	}
+}
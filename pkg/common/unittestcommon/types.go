@@ -28,6 +28,20 @@ import (
 // FakeK8SOrchestrator is used to mock common K8S Orchestrator instance to store FSS values
 type FakeK8SOrchestrator struct {
 	featureStates map[string]string
+	// pvcAnnotations holds the annotations of PVCs by namespace/name
+	pvcAnnotations map[string]map[string]string
+	// pvcEvents holds the reasons of the events recorded on PVCs by volume ID or namespace/name
+	pvcEvents map[string][]string
+	// volumeSCParams holds the StorageClass parameters of volumes by volume ID
+	volumeSCParams map[string]map[string]string
+	// podsUsingVolumes holds the pods using volumes by volume ID and node name
+	podsUsingVolumes map[string][]string
+	// podsUsingVolumesErr is the error GetPodsUsingVolumeOnNode returns, if set
+	podsUsingVolumesErr error
+	// notReadyNodes holds the names of the nodes that aren't Ready
+	notReadyNodes map[string]bool
+	// nodeEvents holds the reasons of the events recorded on nodes by node name
+	nodeEvents map[string][]string
 }
 
 // volumeMigration holds mocked migrated volume information
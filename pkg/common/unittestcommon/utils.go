@@ -24,6 +24,7 @@ import (
 
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/vsphere-csi-driver/pkg/apis/migration"
 	cnsvolume "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/volume"
 	cnsconfig "sigs.k8s.io/vsphere-csi-driver/pkg/common/config"
@@ -39,10 +40,31 @@ func GetFakeContainerOrchestratorInterface(orchestratorType int) (commonco.COCom
 	if orchestratorType == common.Kubernetes {
 		fakeCO := &FakeK8SOrchestrator{
 			featureStates: map[string]string{
-				"volume-extend": "true",
-				"volume-health": "true",
-				"csi-migration": "true",
-				"file-volume":   "true",
+				"volume-extend":                   "true",
+				"volume-health":                   "true",
+				"csi-migration":                   "true",
+				"file-volume":                     "true",
+				"storageclass-params-validation":  "true",
+				"pvc-mode-validation":             "true",
+				"block-in-tree-volume-creation":   "true",
+				"stale-attachment-reconciliation": "true",
+				"list-volumes":                    "true",
+				"detach-pod-usage-check":          "true",
+				"socket-self-healing":             "true",
+				"volume-perf-metrics":             "true",
+				"volume-populator":                "true",
+				"volume-replication":              "true",
+				"volume-inventory-export":         "true",
+				"namespace-storage-metrics":       "true",
+				"pvc-disk-adoption":               "true",
+				"block-volume-snapshot":           "true",
+				"volume-clone":                    "true",
+				"storage-capacity-tracking":       "true",
+				"volume-condition":                "true",
+				"node-volume-health":              "true",
+				"file-volume-extend":              "true",
+				"namespace-storage-quota":         "true",
+				"orphan-volume-cleanup":           "true",
 			},
 		}
 		return fakeCO, nil
@@ -92,6 +114,102 @@ func (c *FakeK8SOrchestrator) ClearFakeAttached(ctx context.Context, volumeID st
 	return status.Error(codes.Unimplemented, msg)
 }
 
+// GetPVCAnnotations returns the annotations of the PVC set with SetPVCAnnotations
+func (c *FakeK8SOrchestrator) GetPVCAnnotations(ctx context.Context, namespace string, name string) (
+	map[string]string, error) {
+	return c.pvcAnnotations[namespace+"/"+name], nil
+}
+
+// SetPVCAnnotations sets the annotations GetPVCAnnotations returns for the PVC with the given name in the
+// given namespace
+func (c *FakeK8SOrchestrator) SetPVCAnnotations(namespace string, name string, annotations map[string]string) {
+	if c.pvcAnnotations == nil {
+		c.pvcAnnotations = make(map[string]map[string]string)
+	}
+	c.pvcAnnotations[namespace+"/"+name] = annotations
+}
+
+// RecordPVCEvent records the reason of the event for the volume, or for the PVC by namespace/name if volumeID
+// is empty, see GetPVCEvents
+func (c *FakeK8SOrchestrator) RecordPVCEvent(ctx context.Context, volumeID string, pvc types.NamespacedName,
+	eventType string, reason string, message string) {
+	if c.pvcEvents == nil {
+		c.pvcEvents = make(map[string][]string)
+	}
+	key := volumeID
+	if key == "" {
+		key = pvc.String()
+	}
+	c.pvcEvents[key] = append(c.pvcEvents[key], reason)
+}
+
+// GetPVCEvents returns the reasons of the events recorded for the volume with RecordPVCEvent
+func (c *FakeK8SOrchestrator) GetPVCEvents(volumeID string) []string {
+	return c.pvcEvents[volumeID]
+}
+
+// RecordNodeEvent records the reason of the event for the node, see GetNodeEvents
+func (c *FakeK8SOrchestrator) RecordNodeEvent(ctx context.Context, nodeName string, eventType string, reason string,
+	message string) {
+	if c.nodeEvents == nil {
+		c.nodeEvents = make(map[string][]string)
+	}
+	c.nodeEvents[nodeName] = append(c.nodeEvents[nodeName], reason)
+}
+
+// GetNodeEvents returns the reasons of the events recorded for the node with RecordNodeEvent
+func (c *FakeK8SOrchestrator) GetNodeEvents(nodeName string) []string {
+	return c.nodeEvents[nodeName]
+}
+
+// GetVolumeStorageClassParams returns the StorageClass parameters set with SetVolumeStorageClassParams
+func (c *FakeK8SOrchestrator) GetVolumeStorageClassParams(ctx context.Context, volumeID string) (map[string]string, error) {
+	return c.volumeSCParams[volumeID], nil
+}
+
+// SetVolumeStorageClassParams sets the StorageClass parameters GetVolumeStorageClassParams returns for the volume
+func (c *FakeK8SOrchestrator) SetVolumeStorageClassParams(volumeID string, params map[string]string) {
+	if c.volumeSCParams == nil {
+		c.volumeSCParams = make(map[string]map[string]string)
+	}
+	c.volumeSCParams[volumeID] = params
+}
+
+// GetPodsUsingVolumeOnNode returns the pods set with SetPodsUsingVolumeOnNode
+func (c *FakeK8SOrchestrator) GetPodsUsingVolumeOnNode(ctx context.Context, volumeID string, nodeName string) (
+	[]string, error) {
+	if c.podsUsingVolumesErr != nil {
+		return nil, c.podsUsingVolumesErr
+	}
+	return c.podsUsingVolumes[volumeID+"/"+nodeName], nil
+}
+
+// SetPodsUsingVolumeOnNodeError sets the error GetPodsUsingVolumeOnNode returns, nil to clear it
+func (c *FakeK8SOrchestrator) SetPodsUsingVolumeOnNodeError(err error) {
+	c.podsUsingVolumesErr = err
+}
+
+// SetPodsUsingVolumeOnNode sets the pods GetPodsUsingVolumeOnNode returns for the volume and node
+func (c *FakeK8SOrchestrator) SetPodsUsingVolumeOnNode(volumeID string, nodeName string, pods []string) {
+	if c.podsUsingVolumes == nil {
+		c.podsUsingVolumes = make(map[string][]string)
+	}
+	c.podsUsingVolumes[volumeID+"/"+nodeName] = pods
+}
+
+// IsNodeReady returns false for the nodes set NotReady with SetNodeReady, true otherwise
+func (c *FakeK8SOrchestrator) IsNodeReady(ctx context.Context, nodeName string) (bool, error) {
+	return !c.notReadyNodes[nodeName], nil
+}
+
+// SetNodeReady sets whether IsNodeReady returns that the node is Ready
+func (c *FakeK8SOrchestrator) SetNodeReady(nodeName string, ready bool) {
+	if c.notReadyNodes == nil {
+		c.notReadyNodes = make(map[string]bool)
+	}
+	c.notReadyNodes[nodeName] = !ready
+}
+
 // GetFakeVolumeMigrationService returns the mocked VolumeMigrationService
 func GetFakeVolumeMigrationService(ctx context.Context, volumeManager *cnsvolume.Manager, cnsConfig *cnsconfig.Config) (MockVolumeMigrationService, error) {
 	// fakeVolumeMigrationInstance is a mocked instance of volumeMigration
@@ -0,0 +1,651 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package unittestcommon
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	cnstypes "github.com/vmware/govmomi/cns/types"
+	"github.com/vmware/govmomi/object"
+	pbmtypes "github.com/vmware/govmomi/pbm/types"
+	vim25types "github.com/vmware/govmomi/vim25/types"
+
+	cnsvolume "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/volume"
+	cnsvsphere "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/vsphere"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/common"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/internalapis/cnsvolumeoperationrequest"
+)
+
+// Operations of FakeVolumeManager for which an error can be injected.
+const (
+	FakeOpCreateVolume         = "CreateVolume"
+	FakeOpAttachVolume         = "AttachVolume"
+	FakeOpDetachVolume         = "DetachVolume"
+	FakeOpDeleteVolume         = "DeleteVolume"
+	FakeOpUpdateVolumeMetadata = "UpdateVolumeMetadata"
+	FakeOpQueryVolume          = "QueryVolume"
+	FakeOpQueryVolumeInfo      = "QueryVolumeInfo"
+	FakeOpExpandVolume         = "ExpandVolume"
+	FakeOpConfigureVolumeACLs  = "ConfigureVolumeACLs"
+	FakeOpRegisterDisk         = "RegisterDisk"
+	FakeOpCreateSnapshot       = "CreateSnapshot"
+	FakeOpDeleteSnapshot       = "DeleteSnapshot"
+	FakeOpCloneVolume          = "CloneVolume"
+)
+
+// FakeVolumeManager is an in-memory implementation of cnsvolume.Manager.
+// It keeps volumes and their attachments in maps and mimics the behavior of
+// CNS the callers depend on: creating a volume with an existing name returns
+// the existing volume, deleting or detaching an unknown volume succeeds, and
+// attaching a volume attached to another VM fails. Like FCDs, volumes with
+// snapshots can't be deleted and a snapshot is created once per name of the
+// request creating it. Errors can be injected
+// per operation with InjectError to exercise error handling of callers. Like
+// the CNS volume manager, it invalidates cached query results on mutations.
+type FakeVolumeManager struct {
+	lock sync.Mutex
+	// volumes maps volume IDs to volumes.
+	volumes map[string]*cnstypes.CnsVolume
+	// attachments maps volume IDs to the VM they are attached to.
+	attachments map[string]string
+	// snapshots maps volume IDs to their snapshots.
+	snapshots map[string][]fakeSnapshot
+	// changedBlockTracking has the volumes changed block tracking is enabled
+	// on.
+	changedBlockTracking map[string]bool
+	// errors maps operations to the error they return.
+	errors map[string]error
+	// DatastoreURL is reported as the datastore of created volumes.
+	DatastoreURL string
+	// QueryPageSize, if not 0, caps the number of volumes QueryVolume
+	// returns for a cursor, like CNS capping the query limit.
+	QueryPageSize int64
+}
+
+var _ cnsvolume.Manager = &FakeVolumeManager{}
+
+// NewFakeVolumeManager returns an empty FakeVolumeManager.
+func NewFakeVolumeManager() *FakeVolumeManager {
+	return &FakeVolumeManager{
+		volumes:              make(map[string]*cnstypes.CnsVolume),
+		attachments:          make(map[string]string),
+		snapshots:            make(map[string][]fakeSnapshot),
+		changedBlockTracking: make(map[string]bool),
+		errors:               make(map[string]error),
+		DatastoreURL:         "ds:///vmfs/volumes/fake-datastore/",
+	}
+}
+
+// InjectError makes every following call of the given operation fail with
+// err. A nil err clears the injected error.
+func (m *FakeVolumeManager) InjectError(operation string, err error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	// Results cached before the error was injected would hide it.
+	cnsvolume.InvalidateQueryResultCache(context.Background())
+	if err == nil {
+		delete(m.errors, operation)
+		return
+	}
+	m.errors[operation] = err
+}
+
+// GetVolume returns a copy of the volume with the given ID, or nil.
+func (m *FakeVolumeManager) GetVolume(volumeID string) *cnstypes.CnsVolume {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	volume, ok := m.volumes[volumeID]
+	if !ok {
+		return nil
+	}
+	volumeCopy := *volume
+	return &volumeCopy
+}
+
+// SetHealthStatus sets the health status CNS reports for the volume, volumes
+// are created with the green health status.
+func (m *FakeVolumeManager) SetHealthStatus(volumeID string, healthStatus string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if volume, ok := m.volumes[volumeID]; ok {
+		volume.HealthStatus = healthStatus
+	}
+	cnsvolume.InvalidateQueryResultCache(context.Background())
+}
+
+// GetAttachedVM returns the VM the volume is attached to, or an empty string.
+func (m *FakeVolumeManager) GetAttachedVM(volumeID string) string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.attachments[volumeID]
+}
+
+// CreateVolume creates a new volume given its spec.
+func (m *FakeVolumeManager) CreateVolume(ctx context.Context, spec *cnstypes.CnsVolumeCreateSpec) (
+	*cnsvolume.CnsVolumeInfo, error) {
+	defer cnsvolume.InvalidateQueryResultCache(ctx)
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if err := m.errors[FakeOpCreateVolume]; err != nil {
+		return nil, err
+	}
+	// An FCD keeps its ID once registered, and registering it again returns
+	// the volume, as with the CnsAlreadyRegisteredFault of CNS.
+	volumeID := uuid.New().String()
+	if backing, ok := spec.BackingObjectDetails.(*cnstypes.CnsBlockBackingDetails); ok && backing.BackingDiskId != "" {
+		volumeID = backing.BackingDiskId
+		if volume, ok := m.volumes[volumeID]; ok {
+			return &cnsvolume.CnsVolumeInfo{DatastoreURL: volume.DatastoreUrl, VolumeID: volume.VolumeId}, nil
+		}
+	}
+	for _, volume := range m.volumes {
+		if volume.Name == spec.Name {
+			return &cnsvolume.CnsVolumeInfo{DatastoreURL: volume.DatastoreUrl, VolumeID: volume.VolumeId}, nil
+		}
+	}
+	volume := &cnstypes.CnsVolume{
+		VolumeId:             cnstypes.CnsVolumeId{Id: volumeID},
+		DatastoreUrl:         m.DatastoreURL,
+		Name:                 spec.Name,
+		VolumeType:           spec.VolumeType,
+		Metadata:             spec.Metadata,
+		BackingObjectDetails: spec.BackingObjectDetails,
+		HealthStatus:         string(pbmtypes.PbmHealthStatusForEntityGreen),
+	}
+	for _, profile := range spec.Profile {
+		if p, ok := profile.(*vim25types.VirtualMachineDefinedProfileSpec); ok {
+			volume.StoragePolicyId = p.ProfileId
+		}
+	}
+	m.volumes[volume.VolumeId.Id] = volume
+	return &cnsvolume.CnsVolumeInfo{DatastoreURL: volume.DatastoreUrl, VolumeID: volume.VolumeId}, nil
+}
+
+// AttachVolume attaches a volume to a virtual machine and returns the UUID of
+// the disk.
+func (m *FakeVolumeManager) AttachVolume(ctx context.Context, vm *cnsvsphere.VirtualMachine, volumeID string) (
+	string, error) {
+	defer cnsvolume.InvalidateQueryResultCache(ctx)
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if err := m.errors[FakeOpAttachVolume]; err != nil {
+		return "", err
+	}
+	if _, ok := m.volumes[volumeID]; !ok {
+		return "", fmt.Errorf("volume %q not found", volumeID)
+	}
+	vmID := fakeVMID(vm)
+	if attachedVM, ok := m.attachments[volumeID]; ok && attachedVM != vmID {
+		return "", fmt.Errorf("volume %q is already attached to VM %q", volumeID, attachedVM)
+	}
+	m.attachments[volumeID] = vmID
+	return fakeDiskUUID(volumeID), nil
+}
+
+// DetachVolume detaches a volume from the virtual machine.
+func (m *FakeVolumeManager) DetachVolume(ctx context.Context, vm *cnsvsphere.VirtualMachine, volumeID string) error {
+	defer cnsvolume.InvalidateQueryResultCache(ctx)
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if err := m.errors[FakeOpDetachVolume]; err != nil {
+		return err
+	}
+	if m.attachments[volumeID] == fakeVMID(vm) {
+		delete(m.attachments, volumeID)
+	}
+	return nil
+}
+
+// DeleteVolume deletes a volume. Attached volumes can not be deleted.
+func (m *FakeVolumeManager) DeleteVolume(ctx context.Context, volumeID string, deleteDisk bool) error {
+	defer cnsvolume.InvalidateQueryResultCache(ctx)
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if err := m.errors[FakeOpDeleteVolume]; err != nil {
+		return err
+	}
+	if attachedVM, ok := m.attachments[volumeID]; ok {
+		return fmt.Errorf("volume %q is attached to VM %q", volumeID, attachedVM)
+	}
+	if len(m.snapshots[volumeID]) > 0 {
+		return fmt.Errorf("volume %q has %d snapshots", volumeID, len(m.snapshots[volumeID]))
+	}
+	delete(m.volumes, volumeID)
+	return nil
+}
+
+// UpdateVolumeMetadata replaces the entity metadata of a volume.
+func (m *FakeVolumeManager) UpdateVolumeMetadata(ctx context.Context, spec *cnstypes.CnsVolumeMetadataUpdateSpec) error {
+	defer cnsvolume.InvalidateQueryResultCache(ctx)
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if err := m.errors[FakeOpUpdateVolumeMetadata]; err != nil {
+		return err
+	}
+	volume, ok := m.volumes[spec.VolumeId.Id]
+	if !ok {
+		return fmt.Errorf("volume %q not found", spec.VolumeId.Id)
+	}
+	volume.Metadata.EntityMetadata = spec.Metadata.EntityMetadata
+	return nil
+}
+
+// QueryVolumeInfo returns the backing object of the first given block volume.
+func (m *FakeVolumeManager) QueryVolumeInfo(ctx context.Context, volumeIDList []cnstypes.CnsVolumeId) (
+	*cnstypes.CnsQueryVolumeInfoResult, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if err := m.errors[FakeOpQueryVolumeInfo]; err != nil {
+		return nil, err
+	}
+	for _, volumeID := range volumeIDList {
+		volume, ok := m.volumes[volumeID.Id]
+		if !ok {
+			continue
+		}
+		return &cnstypes.CnsQueryVolumeInfoResult{
+			CnsVolumeOperationResult: cnstypes.CnsVolumeOperationResult{VolumeId: volume.VolumeId},
+			VolumeInfo: &cnstypes.CnsBlockVolumeInfo{
+				VStorageObject: fakeVStorageObject(volume),
+			},
+		}, nil
+	}
+	return &cnstypes.CnsQueryVolumeInfoResult{}, nil
+}
+
+// QueryAllVolume returns all volumes matching the given filter. The selection
+// is ignored and all fields are returned.
+func (m *FakeVolumeManager) QueryAllVolume(ctx context.Context, queryFilter cnstypes.CnsQueryFilter,
+	querySelection cnstypes.CnsQuerySelection) (*cnstypes.CnsQueryResult, error) {
+	return m.QueryVolume(ctx, queryFilter)
+}
+
+// QueryVolumeAsync returns all volumes matching the given filter. The
+// selection is ignored and all fields are returned.
+func (m *FakeVolumeManager) QueryVolumeAsync(ctx context.Context, queryFilter cnstypes.CnsQueryFilter,
+	querySelection cnstypes.CnsQuerySelection) (*cnstypes.CnsQueryResult, error) {
+	return m.QueryVolume(ctx, queryFilter)
+}
+
+// QueryVolume returns volumes matching the volume IDs, names and container
+// cluster IDs of the filter. Other filter fields are ignored. With a cursor,
+// the page of the volumes sorted by ID at its offset is returned.
+func (m *FakeVolumeManager) QueryVolume(ctx context.Context, queryFilter cnstypes.CnsQueryFilter) (
+	*cnstypes.CnsQueryResult, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if err := m.errors[FakeOpQueryVolume]; err != nil {
+		return nil, err
+	}
+	result := &cnstypes.CnsQueryResult{}
+	for _, volume := range m.volumes {
+		if matchesQueryFilter(volume, queryFilter) {
+			result.Volumes = append(result.Volumes, *volume)
+		}
+	}
+	total := int64(len(result.Volumes))
+	if cursor := queryFilter.Cursor; cursor != nil {
+		sort.Slice(result.Volumes, func(i, j int) bool {
+			return result.Volumes[i].VolumeId.Id < result.Volumes[j].VolumeId.Id
+		})
+		limit := cursor.Limit
+		if m.QueryPageSize > 0 && m.QueryPageSize < limit {
+			limit = m.QueryPageSize
+		}
+		end := cursor.Offset + limit
+		if end > total {
+			end = total
+		}
+		if cursor.Offset < end {
+			result.Volumes = result.Volumes[cursor.Offset:end]
+		} else {
+			result.Volumes = nil
+		}
+		result.Cursor = cnstypes.CnsCursor{
+			Offset:       cursor.Offset + int64(len(result.Volumes)),
+			Limit:        cursor.Limit,
+			TotalRecords: total,
+		}
+		return result, nil
+	}
+	result.Cursor = cnstypes.CnsCursor{
+		Offset:       total,
+		Limit:        total,
+		TotalRecords: total,
+	}
+	return result, nil
+}
+
+// RelocateVolume is not supported by the fake.
+func (m *FakeVolumeManager) RelocateVolume(ctx context.Context,
+	relocateSpecList ...cnstypes.BaseCnsVolumeRelocateSpec) (*object.Task, error) {
+	defer cnsvolume.InvalidateQueryResultCache(ctx)
+	return nil, fmt.Errorf("RelocateVolume is not supported by FakeVolumeManager")
+}
+
+// ExpandVolume expands a volume to a new size in MB. Shrinking a volume fails.
+func (m *FakeVolumeManager) ExpandVolume(ctx context.Context, volumeID string, size int64) error {
+	defer cnsvolume.InvalidateQueryResultCache(ctx)
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if err := m.errors[FakeOpExpandVolume]; err != nil {
+		return err
+	}
+	volume, ok := m.volumes[volumeID]
+	if !ok {
+		return fmt.Errorf("volume %q not found", volumeID)
+	}
+	backing, ok := volume.BackingObjectDetails.(*cnstypes.CnsBlockBackingDetails)
+	if !ok {
+		return fmt.Errorf("volume %q is not a block volume", volumeID)
+	}
+	if size < backing.CapacityInMb {
+		return fmt.Errorf("cannot shrink volume %q from %d MB to %d MB", volumeID, backing.CapacityInMb, size)
+	}
+	backing.CapacityInMb = size
+	return nil
+}
+
+// ResetManager is a no-op for the fake.
+func (m *FakeVolumeManager) ResetManager(ctx context.Context, vcenter *cnsvsphere.VirtualCenter) {}
+
+// SetOperationStore is a no-op for the fake, operations complete synchronously.
+func (m *FakeVolumeManager) SetOperationStore(store cnsvolumeoperationrequest.VolumeOperationRequest) {
+}
+
+// ConfigureVolumeACLs checks the volume exists, ACLs are not recorded.
+func (m *FakeVolumeManager) ConfigureVolumeACLs(ctx context.Context, spec cnstypes.CnsVolumeACLConfigureSpec) error {
+	defer cnsvolume.InvalidateQueryResultCache(ctx)
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if err := m.errors[FakeOpConfigureVolumeACLs]; err != nil {
+		return err
+	}
+	if _, ok := m.volumes[spec.VolumeId.Id]; !ok {
+		return fmt.Errorf("volume %q not found", spec.VolumeId.Id)
+	}
+	return nil
+}
+
+// RegisterDisk registers the disk at path as a block volume and returns its
+// ID.
+func (m *FakeVolumeManager) RegisterDisk(ctx context.Context, path string, name string) (string, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if err := m.errors[FakeOpRegisterDisk]; err != nil {
+		return "", err
+	}
+	volumeID := uuid.New().String()
+	m.volumes[volumeID] = &cnstypes.CnsVolume{
+		VolumeId:     cnstypes.CnsVolumeId{Id: volumeID},
+		DatastoreUrl: m.DatastoreURL,
+		Name:         name,
+		VolumeType:   "BLOCK",
+		BackingObjectDetails: &cnstypes.CnsBlockBackingDetails{
+			BackingDiskUrlPath: path,
+		},
+	}
+	return volumeID, nil
+}
+
+// RetrieveVStorageObject returns the FCD backing the given volume.
+func (m *FakeVolumeManager) RetrieveVStorageObject(ctx context.Context, volumeID string) (
+	*vim25types.VStorageObject, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	volume, ok := m.volumes[volumeID]
+	if !ok {
+		return nil, fmt.Errorf("volume %q not found", volumeID)
+	}
+	vStorageObject := fakeVStorageObject(volume)
+	changedBlockTracking := m.changedBlockTracking[volumeID]
+	vStorageObject.Config.ChangedBlockTrackingEnabled = &changedBlockTracking
+	return &vStorageObject, nil
+}
+
+// fakeSnapshot is a snapshot of a volume with the name of the request
+// creating it.
+type fakeSnapshot struct {
+	cnsvolume.CnsSnapshotInfo
+	name string
+}
+
+// CreateSnapshot creates a snapshot of the volume, or returns the snapshot
+// already created with the given name.
+func (m *FakeVolumeManager) CreateSnapshot(ctx context.Context, volumeID string, name string) (
+	*cnsvolume.CnsSnapshotInfo, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if err := m.errors[FakeOpCreateSnapshot]; err != nil {
+		return nil, err
+	}
+	volume, ok := m.volumes[volumeID]
+	if !ok {
+		return nil, fmt.Errorf("volume %q not found", volumeID)
+	}
+	for _, snapshot := range m.snapshots[volumeID] {
+		if snapshot.name == name {
+			info := snapshot.CnsSnapshotInfo
+			return &info, nil
+		}
+	}
+	snapshot := fakeSnapshot{
+		CnsSnapshotInfo: cnsvolume.CnsSnapshotInfo{
+			SnapshotID:     uuid.New().String(),
+			SourceVolumeID: volumeID,
+			CreationTime:   time.Now(),
+			CapacityInMb:   volume.BackingObjectDetails.GetCnsBackingObjectDetails().CapacityInMb,
+		},
+		name: name,
+	}
+	m.snapshots[volumeID] = append(m.snapshots[volumeID], snapshot)
+	info := snapshot.CnsSnapshotInfo
+	return &info, nil
+}
+
+// DeleteSnapshot deletes a snapshot of the volume. Deleting an unknown
+// snapshot succeeds.
+func (m *FakeVolumeManager) DeleteSnapshot(ctx context.Context, volumeID string, snapshotID string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if err := m.errors[FakeOpDeleteSnapshot]; err != nil {
+		return err
+	}
+	snapshots := m.snapshots[volumeID]
+	for i := range snapshots {
+		if snapshots[i].SnapshotID == snapshotID {
+			m.snapshots[volumeID] = append(snapshots[:i:i], snapshots[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// QuerySnapshots returns the snapshots of the volume.
+func (m *FakeVolumeManager) QuerySnapshots(ctx context.Context, volumeID string) (
+	[]cnsvolume.CnsSnapshotInfo, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if _, ok := m.volumes[volumeID]; !ok {
+		return nil, fmt.Errorf("volume %q not found", volumeID)
+	}
+	var snapshots []cnsvolume.CnsSnapshotInfo
+	for _, snapshot := range m.snapshots[volumeID] {
+		snapshots = append(snapshots, snapshot.CnsSnapshotInfo)
+	}
+	return snapshots, nil
+}
+
+// EnableChangedBlockTracking enables changed block tracking on the volume.
+func (m *FakeVolumeManager) EnableChangedBlockTracking(ctx context.Context, volumeID string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if _, ok := m.volumes[volumeID]; !ok {
+		return fmt.Errorf("volume %q not found", volumeID)
+	}
+	m.changedBlockTracking[volumeID] = true
+	return nil
+}
+
+// QueryChangedDiskAreas returns the whole volume from startOffset as a single
+// changed area, if changed block tracking is enabled on the volume and the
+// snapshot exists.
+func (m *FakeVolumeManager) QueryChangedDiskAreas(ctx context.Context, volumeID string, snapshotID string,
+	startOffset int64, changeID string) (*vim25types.DiskChangeInfo, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	volume, ok := m.volumes[volumeID]
+	if !ok {
+		return nil, fmt.Errorf("volume %q not found", volumeID)
+	}
+	if !m.changedBlockTracking[volumeID] {
+		return nil, fmt.Errorf("changed block tracking is not enabled on volume %q", volumeID)
+	}
+	found := false
+	for _, snapshot := range m.snapshots[volumeID] {
+		if snapshot.SnapshotID == snapshotID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("snapshot %q of volume %q not found", snapshotID, volumeID)
+	}
+	length := fakeVStorageObject(volume).Config.CapacityInMB*common.MbInBytes - startOffset
+	return &vim25types.DiskChangeInfo{
+		StartOffset: startOffset,
+		Length:      length,
+		ChangedArea: []vim25types.DiskChangeExtent{{Start: startOffset, Length: length}},
+	}, nil
+}
+
+// CreateVolumeFromSnapshot creates the volume of the spec, or returns the
+// volume already created with its name, if the snapshot exists.
+func (m *FakeVolumeManager) CreateVolumeFromSnapshot(ctx context.Context, spec *cnstypes.CnsVolumeCreateSpec,
+	snapshotVolumeID string, snapshotID string) (*cnsvolume.CnsVolumeInfo, error) {
+	m.lock.Lock()
+	found := false
+	for _, snapshot := range m.snapshots[snapshotVolumeID] {
+		if snapshot.SnapshotID == snapshotID {
+			found = true
+			break
+		}
+	}
+	m.lock.Unlock()
+	if !found {
+		return nil, fmt.Errorf("snapshot %q of volume %q not found", snapshotID, snapshotVolumeID)
+	}
+	return m.CreateVolume(ctx, spec)
+}
+
+// CloneVolume creates the volume of the spec, or returns the volume already
+// created with its name, if the source volume exists.
+func (m *FakeVolumeManager) CloneVolume(ctx context.Context, spec *cnstypes.CnsVolumeCreateSpec,
+	sourceVolumeID string) (*cnsvolume.CnsVolumeInfo, error) {
+	m.lock.Lock()
+	err := m.errors[FakeOpCloneVolume]
+	_, found := m.volumes[sourceVolumeID]
+	m.lock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, &cnsvolume.VolumeCloneError{Volume: spec.Name, SourceVolumeID: sourceVolumeID,
+			SourceNotFound: true, Fault: "volume not found"}
+	}
+	return m.CreateVolume(ctx, spec)
+}
+
+func matchesQueryFilter(volume *cnstypes.CnsVolume, queryFilter cnstypes.CnsQueryFilter) bool {
+	if len(queryFilter.VolumeIds) > 0 {
+		found := false
+		for _, volumeID := range queryFilter.VolumeIds {
+			if volumeID.Id == volume.VolumeId.Id {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(queryFilter.Names) > 0 {
+		found := false
+		for _, name := range queryFilter.Names {
+			if name == volume.Name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(queryFilter.ContainerClusterIds) > 0 {
+		found := false
+		for _, clusterID := range queryFilter.ContainerClusterIds {
+			if clusterID == volume.Metadata.ContainerCluster.ClusterId {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func fakeVStorageObject(volume *cnstypes.CnsVolume) vim25types.VStorageObject {
+	vStorageObject := vim25types.VStorageObject{
+		Config: vim25types.VStorageObjectConfigInfo{
+			BaseConfigInfo: vim25types.BaseConfigInfo{
+				Id:   vim25types.ID{Id: volume.VolumeId.Id},
+				Name: volume.Name,
+			},
+		},
+	}
+	if backing, ok := volume.BackingObjectDetails.(*cnstypes.CnsBlockBackingDetails); ok {
+		vStorageObject.Config.CapacityInMB = backing.CapacityInMb
+	}
+	return vStorageObject
+}
+
+// fakeVMID identifies a VM by its UUID, or by its managed object reference
+// when the UUID is not set.
+func fakeVMID(vm *cnsvsphere.VirtualMachine) string {
+	if vm == nil {
+		return ""
+	}
+	if vm.UUID != "" {
+		return vm.UUID
+	}
+	if vm.VirtualMachine != nil {
+		return vm.Reference().Value
+	}
+	return ""
+}
+
+// fakeDiskUUID derives a stable disk UUID from the volume ID.
+func fakeDiskUUID(volumeID string) string {
+	return uuid.NewSHA1(uuid.NameSpaceOID, []byte(volumeID)).String()
+}
@@ -18,6 +18,7 @@ package utils
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 
 	cnstypes "github.com/vmware/govmomi/cns/types"
@@ -28,36 +29,80 @@ import (
 	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
 )
 
-// QueryVolumeUtil helps to invoke query volume API based on the feature state set for using query async volume.
-// If useQueryVolumeAsync is set to true, the function invokes CNS QueryVolumeAsync, otherwise it invokes synchronous QueryVolume API
+// QuerySelection returns a CnsQuerySelection of the given volume fields. CNS
+// returns the IDs of the volumes matching a query along with the selected
+// fields only, callers select the fields they use to keep the payload small.
+// Selecting no fields returns all the fields of the volumes.
+func QuerySelection(fields ...cnstypes.QuerySelectionNameType) cnstypes.CnsQuerySelection {
+	var querySelection cnstypes.CnsQuerySelection
+	for _, field := range fields {
+		querySelection.Names = append(querySelection.Names, string(field))
+	}
+	return querySelection
+}
+
+// VolumeMetadataQuerySelection returns the CnsQuerySelection of queries
+// reading the metadata of the volumes. The metadata can't be selected, CNS
+// returns it along with all the other fields of the volumes when no field is
+// selected, so callers only query the metadata of the volumes they need it of.
+func VolumeMetadataQuerySelection() cnstypes.CnsQuerySelection {
+	return cnstypes.CnsQuerySelection{}
+}
+
+// QueryVolumeUtil helps to invoke query volume API. The function invokes CNS QueryVolumeAsync when the vCenter supports it,
+// otherwise it falls back to the synchronous QueryAllVolume API
 // The function also take volume manager instance, query filters, query selection as params
 // Returns queryResult when query volume succeeds, otherwise returns appropriate errors
-func QueryVolumeUtil(ctx context.Context, m cnsvolume.Manager, queryFilter cnstypes.CnsQueryFilter, querySelection cnstypes.CnsQuerySelection, useQueryVolumeAsync bool) (*cnstypes.CnsQueryResult, error) {
+func QueryVolumeUtil(ctx context.Context, m cnsvolume.Manager, queryFilter cnstypes.CnsQueryFilter, querySelection cnstypes.CnsQuerySelection) (*cnstypes.CnsQueryResult, error) {
 	log := logger.GetLogger(ctx)
-	var queryAsyncNotSupported bool
-	var queryResult *cnstypes.CnsQueryResult
-	var err error
-	if useQueryVolumeAsync {
-		// AsyncQueryVolume feature switch is disabled
-		queryResult, err = m.QueryVolumeAsync(ctx, queryFilter, querySelection)
-		if err != nil {
-			if err.Error() == cnsvsphere.ErrNotSupported.Error() {
-				log.Warn("QueryVolumeAsync is not supported. Invoking QueryVolume API")
-				queryAsyncNotSupported = true
-			} else { // Return for any other failures
-				msg := fmt.Sprintf("QueryVolumeAsync failed for queryFilter: %v. Err=%+v", queryFilter, err.Error())
-				log.Error(msg)
-				return nil, status.Error(codes.Internal, msg)
-			}
-		}
+	queryResult, err := m.QueryVolumeAsync(ctx, queryFilter, querySelection)
+	if err == nil {
+		return queryResult, nil
+	}
+	if err.Error() != cnsvsphere.ErrNotSupported.Error() {
+		msg := fmt.Sprintf("QueryVolumeAsync failed for queryFilter: %v. Err=%+v", queryFilter, err.Error())
+		log.Error(msg)
+		return nil, status.Error(codes.Internal, msg)
+	}
+	log.Debug("QueryVolumeAsync is not supported. Invoking QueryVolume API")
+	queryResult, err = m.QueryAllVolume(ctx, queryFilter, querySelection)
+	if err != nil {
+		msg := fmt.Sprintf("QueryVolume failed for queryFilter: %+v. Err=%+v", queryFilter, err.Error())
+		log.Error(msg)
+		return nil, status.Error(codes.Internal, msg)
+	}
+	return queryResult, nil
+}
+
+// CachedQueryVolumeUtil is QueryVolumeUtil reading through the CNS query result
+// cache, so that consumers issuing the same query within a sync window don't
+// query CNS repeatedly. Cached results expire after the TTL of the cache, and
+// are invalidated whenever a volume is mutated through the volume manager of
+// this process. Volumes mutated by other processes, such as the controller,
+// can be stale until the TTL elapses: paths deleting volumes must use
+// QueryVolumeUtil. The returned result is shared with other callers and must
+// not be modified. Results are cached per volume manager, so that the queries
+// of the CNS of different vCenters don't share results.
+func CachedQueryVolumeUtil(ctx context.Context, m cnsvolume.Manager, queryFilter cnstypes.CnsQueryFilter, querySelection cnstypes.CnsQuerySelection) (*cnstypes.CnsQueryResult, error) {
+	log := logger.GetLogger(ctx)
+	key, err := json.Marshal(struct {
+		Manager   string
+		Filter    cnstypes.CnsQueryFilter
+		Selection cnstypes.CnsQuerySelection
+	}{fmt.Sprintf("%p", m), queryFilter, querySelection})
+	if err != nil {
+		log.Warnf("failed to build cache key for queryFilter: %+v. Err: %v", queryFilter, err)
+		return QueryVolumeUtil(ctx, m, queryFilter, querySelection)
+	}
+	queryResult, generation, found := cnsvolume.GetCachedQueryResult(string(key))
+	if found {
+		log.Debugf("Using cached query result for queryFilter: %+v", queryFilter)
+		return queryResult, nil
 	}
-	if !useQueryVolumeAsync || queryAsyncNotSupported {
-		queryResult, err = m.QueryAllVolume(ctx, queryFilter, querySelection)
-		if err != nil {
-			msg := fmt.Sprintf("QueryVolume failed for queryFilter: %+v. Err=%+v", queryFilter, err.Error())
-			log.Error(msg)
-			return nil, status.Error(codes.Internal, msg)
-		}
+	queryResult, err = QueryVolumeUtil(ctx, m, queryFilter, querySelection)
+	if err != nil {
+		return nil, err
 	}
+	cnsvolume.CacheQueryResult(string(key), queryResult, generation)
 	return queryResult, nil
 }
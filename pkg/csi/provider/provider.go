@@ -18,6 +18,7 @@ package provider
 
 import (
 	"github.com/rexray/gocsi"
+	"google.golang.org/grpc"
 
 	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service"
 )
@@ -33,6 +34,9 @@ func New() gocsi.StoragePluginProvider {
 		Node:        svc,
 		BeforeServe: svc.BeforeServe,
 
+		// Observe and trace the requests rejected by the gocsi interceptors too.
+		Interceptors: []grpc.UnaryServerInterceptor{service.MetricsInterceptor, service.TracingInterceptor},
+
 		EnvVars: []string{
 			// Enable request validation.
 			gocsi.EnvVarSpecReqValidation + "=true",
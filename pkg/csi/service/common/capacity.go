@@ -0,0 +1,94 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common
+
+import (
+	"context"
+
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/mo"
+
+	"sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/vsphere"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
+)
+
+// GetCapacityUtil returns the capacity in bytes available to a block volume
+// created with the StorageClass parameters on one of the shared datastores.
+// A volume is created on a single datastore, so this is the largest free space
+// of the datastores the volume could be created on: the datastore of the
+// StorageClass if it has one, and those compatible with its storage policy.
+// The free space is retrieved from vCenter, not from the cached datastores.
+func GetCapacityUtil(ctx context.Context, manager *Manager, scParams *StorageClassParams,
+	sharedDatastores []*vsphere.DatastoreInfo) (int64, error) {
+	log := logger.GetLogger(ctx)
+	var candidates []*vsphere.DatastoreInfo
+	for _, sharedDatastore := range sharedDatastores {
+		if scParams.DatastoreURL == "" || sharedDatastore.Info.Url == scParams.DatastoreURL {
+			candidates = append(candidates, sharedDatastore)
+		}
+	}
+	if len(candidates) == 0 {
+		return 0, nil
+	}
+	vc, err := GetVCenter(ctx, manager)
+	if err != nil {
+		log.Errorf("failed to get vCenter from Manager, err: %+v", err)
+		return 0, err
+	}
+	refs := getDatastoreMoRefs(candidates)
+	if scParams.StoragePolicyName != "" {
+		storagePolicyID, err := vc.GetStoragePolicyIDByName(ctx, scParams.StoragePolicyName)
+		if err != nil {
+			log.Errorf("Error occurred while getting Profile Id from Profile Name: %s, err: %+v",
+				scParams.StoragePolicyName, err)
+			return 0, err
+		}
+		result, err := vc.PbmCheckCompatibility(ctx, refs, storagePolicyID)
+		if err != nil {
+			log.Errorf("failed to check the compatibility of datastores with storage policy %q. err: %+v",
+				storagePolicyID, err)
+			return 0, err
+		}
+		compatible := make(map[string]bool)
+		for _, hub := range result.CompatibleDatastores() {
+			compatible[hub.HubId] = true
+		}
+		refs = refs[:0]
+		for _, candidate := range candidates {
+			if compatible[candidate.Reference().Value] {
+				refs = append(refs, candidate.Reference())
+			}
+		}
+		if len(refs) == 0 {
+			log.Debugf("no shared datastore is compatible with storage policy %q", scParams.StoragePolicyName)
+			return 0, nil
+		}
+	}
+	var dsMoList []mo.Datastore
+	pc := property.DefaultCollector(vc.Client.Client)
+	if err := pc.Retrieve(ctx, refs, []string{"summary"}, &dsMoList); err != nil {
+		log.Errorf("failed to retrieve the summary of datastores %v. err: %+v", refs, err)
+		return 0, err
+	}
+	var capacity int64
+	for _, dsMo := range dsMoList {
+		if dsMo.Summary.Accessible && dsMo.Summary.FreeSpace > capacity {
+			capacity = dsMo.Summary.FreeSpace
+		}
+	}
+	return capacity, nil
+}
@@ -0,0 +1,223 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common
+
+import (
+	"context"
+	"fmt"
+
+	cnstypes "github.com/vmware/govmomi/cns/types"
+	vim25types "github.com/vmware/govmomi/vim25/types"
+
+	cnsvolume "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/volume"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/vsphere"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/common/utils"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
+)
+
+// CloneSourceNotFoundError is returned when the volume a volume is cloned
+// from doesn't exist.
+type CloneSourceNotFoundError struct {
+	SourceVolumeID string
+}
+
+func (e *CloneSourceNotFoundError) Error() string {
+	return fmt.Sprintf("source volume %q not found", e.SourceVolumeID)
+}
+
+// ClonePlacementError is returned when a volume can't be cloned with the
+// parameters of the request, because the source isn't a block volume or no
+// datastore accessible to the nodes the clone can be used on is compatible
+// with it.
+type ClonePlacementError struct {
+	SourceVolumeID string
+	Reason         string
+}
+
+func (e *ClonePlacementError) Error() string {
+	return fmt.Sprintf("volume %q can't be cloned: %s", e.SourceVolumeID, e.Reason)
+}
+
+// CloneSizeError is returned when the requested size of a volume cloned from
+// another volume is smaller than the source, or its limit is.
+type CloneSizeError struct {
+	SourceVolumeID  string
+	SourceSizeMB    int64
+	RequestedSizeMB int64
+}
+
+func (e *CloneSizeError) Error() string {
+	return fmt.Sprintf("requested size %d Mb of the volume is smaller than the size %d Mb of source volume %q",
+		e.RequestedSizeMB, e.SourceSizeMB, e.SourceVolumeID)
+}
+
+// CloneBlockVolumeUtil creates the CNS block volume of the CreateVolumeSpec as
+// a clone of the block volume sourceVolumeID. The clone has the size of the
+// source if the spec has no capacity, and can't be smaller, nor can the limit
+// of its size in MB unless it is 0. It is created on the datastore of the
+// StorageClass if it has one, or else on the datastore of the source if the
+// nodes the clone can be used on access it, or else on another of the shared
+// datastores; the datastore has to be compatible with the storage policy of
+// the StorageClass. It returns the volume and its capacity in MB.
+func CloneBlockVolumeUtil(ctx context.Context, clusterFlavor cnstypes.CnsClusterFlavor, manager *Manager,
+	spec *CreateVolumeSpec, sourceVolumeID string, limitMB int64, sharedDatastores []*vsphere.DatastoreInfo) (
+	*cnsvolume.CnsVolumeInfo, int64, error) {
+	log := logger.GetLogger(ctx)
+	queryFilter := cnstypes.CnsQueryFilter{
+		VolumeIds: []cnstypes.CnsVolumeId{{Id: sourceVolumeID}},
+	}
+	queryResult, err := utils.QueryVolumeUtil(ctx, manager.VolumeManager, queryFilter, utils.QuerySelection())
+	if err != nil {
+		log.Errorf("failed to query source volume %q. err: %+v", sourceVolumeID, err)
+		return nil, 0, err
+	}
+	if len(queryResult.Volumes) == 0 {
+		return nil, 0, &CloneSourceNotFoundError{SourceVolumeID: sourceVolumeID}
+	}
+	sourceVolume := queryResult.Volumes[0]
+	if sourceVolume.VolumeType != BlockVolumeType {
+		return nil, 0, &ClonePlacementError{SourceVolumeID: sourceVolumeID, Reason: fmt.Sprintf(
+			"it is a %s volume instead of a %s volume", sourceVolume.VolumeType, BlockVolumeType)}
+	}
+	var sourceSizeMB int64
+	if sourceVolume.BackingObjectDetails != nil {
+		sourceSizeMB = sourceVolume.BackingObjectDetails.GetCnsBackingObjectDetails().CapacityInMb
+	}
+	if limitMB != 0 && limitMB < sourceSizeMB {
+		return nil, 0, &CloneSizeError{SourceVolumeID: sourceVolumeID, SourceSizeMB: sourceSizeMB,
+			RequestedSizeMB: limitMB}
+	}
+	if spec.CapacityMB == 0 {
+		spec.CapacityMB = sourceSizeMB
+	} else if spec.CapacityMB < sourceSizeMB {
+		return nil, 0, &CloneSizeError{SourceVolumeID: sourceVolumeID, SourceSizeMB: sourceSizeMB,
+			RequestedSizeMB: spec.CapacityMB}
+	}
+	vc, err := GetVCenter(ctx, manager)
+	if err != nil {
+		log.Errorf("failed to get vCenter from Manager, err: %+v", err)
+		return nil, 0, err
+	}
+	if spec.ScParams.StoragePolicyName != "" {
+		spec.StoragePolicyID, err = vc.GetStoragePolicyIDByName(ctx, spec.ScParams.StoragePolicyName)
+		if err != nil {
+			log.Errorf("Error occurred while getting Profile Id from Profile Name: %s, err: %+v",
+				spec.ScParams.StoragePolicyName, err)
+			return nil, 0, err
+		}
+	}
+	target, err := getCloneDatastore(ctx, vc, spec, &sourceVolume, sharedDatastores)
+	if err != nil {
+		return nil, 0, err
+	}
+	containerCluster := vsphere.GetContainerCluster(manager.CnsConfig.Global.ClusterID,
+		manager.CnsConfig.VirtualCenter[vc.Config.Host].User, clusterFlavor, manager.CnsConfig.Global.ClusterDistribution)
+	createSpec := &cnstypes.CnsVolumeCreateSpec{
+		Name:       spec.Name,
+		VolumeType: spec.VolumeType,
+		Datastores: []vim25types.ManagedObjectReference{target.Reference()},
+		BackingObjectDetails: &cnstypes.CnsBlockBackingDetails{
+			CnsBackingObjectDetails: cnstypes.CnsBackingObjectDetails{
+				CapacityInMb: spec.CapacityMB,
+			},
+		},
+		Metadata: cnstypes.CnsVolumeMetadata{
+			ContainerCluster:      containerCluster,
+			ContainerClusterArray: []cnstypes.CnsContainerCluster{containerCluster},
+		},
+	}
+	if spec.StoragePolicyID != "" {
+		createSpec.Profile = append(createSpec.Profile, &vim25types.VirtualMachineDefinedProfileSpec{
+			ProfileId: spec.StoragePolicyID,
+		})
+	}
+	volumeInfo, err := manager.VolumeManager.CloneVolume(ctx, createSpec, sourceVolumeID)
+	if err != nil {
+		log.Errorf("failed to clone volume %q to volume %s. err: %+v", sourceVolumeID, spec.Name, err)
+		invalidateStoragePolicyID(ctx, vc, spec, err)
+		return nil, 0, err
+	}
+	log.Infof("Cloned volume %q to volume %q of %d MB on datastore %q", sourceVolumeID, volumeInfo.VolumeID.Id,
+		spec.CapacityMB, target.Info.Url)
+	return &cnsvolume.CnsVolumeInfo{
+		DatastoreURL: target.Info.Url,
+		VolumeID:     volumeInfo.VolumeID,
+	}, spec.CapacityMB, nil
+}
+
+// getCloneDatastore returns the datastore to clone the source volume to: the
+// datastore of the StorageClass if it has one, or else the datastore of the
+// source, or else another of the shared datastores, which are the ones the
+// nodes the clone can be used on access. The datastore has to be compatible
+// with the storage policy of the spec.
+func getCloneDatastore(ctx context.Context, vc *vsphere.VirtualCenter, spec *CreateVolumeSpec,
+	sourceVolume *cnstypes.CnsVolume, sharedDatastores []*vsphere.DatastoreInfo) (*vsphere.DatastoreInfo, error) {
+	log := logger.GetLogger(ctx)
+	var candidates []*vsphere.DatastoreInfo
+	if spec.ScParams.DatastoreURL != "" {
+		for _, sharedDatastore := range sharedDatastores {
+			if sharedDatastore.Info.Url == spec.ScParams.DatastoreURL {
+				candidates = append(candidates, sharedDatastore)
+				break
+			}
+		}
+		if len(candidates) == 0 {
+			return nil, &ClonePlacementError{SourceVolumeID: sourceVolume.VolumeId.Id, Reason: fmt.Sprintf(
+				"datastore %q of the StorageClass is not accessible to the nodes the volume can be used on",
+				spec.ScParams.DatastoreURL)}
+		}
+	} else {
+		// The source datastore comes first, a clone on it is the fastest.
+		for _, sharedDatastore := range sharedDatastores {
+			if sharedDatastore.Info.Url == sourceVolume.DatastoreUrl {
+				candidates = append([]*vsphere.DatastoreInfo{sharedDatastore}, candidates...)
+			} else {
+				candidates = append(candidates, sharedDatastore)
+			}
+		}
+		if len(candidates) == 0 {
+			return nil, &ClonePlacementError{SourceVolumeID: sourceVolume.VolumeId.Id,
+				Reason: "no datastore is accessible to the nodes the volume can be used on"}
+		}
+	}
+	if spec.StoragePolicyID == "" {
+		return candidates[0], nil
+	}
+	result, err := vc.PbmCheckCompatibility(ctx, getDatastoreMoRefs(candidates), spec.StoragePolicyID)
+	if err != nil {
+		log.Errorf("failed to check the compatibility of datastores with storage policy %q. err: %+v",
+			spec.StoragePolicyID, err)
+		return nil, err
+	}
+	compatible := make(map[string]bool)
+	for _, hub := range result.CompatibleDatastores() {
+		compatible[hub.HubId] = true
+	}
+	for _, candidate := range candidates {
+		if compatible[candidate.Reference().Value] {
+			return candidate, nil
+		}
+	}
+	if spec.ScParams.DatastoreURL != "" {
+		return nil, &ClonePlacementError{SourceVolumeID: sourceVolume.VolumeId.Id, Reason: fmt.Sprintf(
+			"datastore %q of the StorageClass is not compatible with storage policy %q", spec.ScParams.DatastoreURL,
+			spec.ScParams.StoragePolicyName)}
+	}
+	return nil, &ClonePlacementError{SourceVolumeID: sourceVolume.VolumeId.Id, Reason: fmt.Sprintf(
+		"no datastore accessible to the nodes the volume can be used on is compatible with storage policy %q",
+		spec.ScParams.StoragePolicyName)}
+}
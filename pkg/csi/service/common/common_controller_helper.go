@@ -208,9 +208,11 @@ func UseVslmAPIs(ctx context.Context, aboutInfo vim25types.AboutInfo) (bool, err
 }
 
 // ValidateControllerExpandVolumeRequest is the helper function to validate
-// ControllerExpandVolumeRequest for all block controllers.
+// ControllerExpandVolumeRequest for all block controllers. File volumes are
+// only accepted when isFileVolumeExtendSupported is set.
 // Function returns error if validation fails otherwise returns nil.
-func ValidateControllerExpandVolumeRequest(ctx context.Context, req *csi.ControllerExpandVolumeRequest) error {
+func ValidateControllerExpandVolumeRequest(ctx context.Context, req *csi.ControllerExpandVolumeRequest,
+	isFileVolumeExtendSupported bool) error {
 	log := logger.GetLogger(ctx)
 	// check for required parameters
 	if len(req.GetVolumeId()) == 0 {
@@ -234,8 +236,7 @@ func ValidateControllerExpandVolumeRequest(ctx context.Context, req *csi.Control
 		return status.Error(codes.InvalidArgument, msg)
 	}
 
-	// TODO: Remove this restriction when volume expansion is supported for File Volumes
-	if IsFileVolumeRequest(ctx, []*csi.VolumeCapability{volCaps}) {
+	if !isFileVolumeExtendSupported && IsFileVolumeRequest(ctx, []*csi.VolumeCapability{volCaps}) {
 		msg := "volume expansion is only supported for block volume type"
 		log.Error(msg)
 		return status.Error(codes.Unimplemented, msg)
@@ -262,3 +263,93 @@ func IsOnlineExpansion(ctx context.Context, volumeID string, nodes []*cnsvsphere
 
 	return nil
 }
+
+// CreateVolumeErrorCode returns the gRPC code to fail CreateVolume with for an
+// error of the helper functions creating CNS volumes.
+func CreateVolumeErrorCode(err error) codes.Code {
+	var collisionErr *VolumeNameCollisionError
+	if errors.As(err, &collisionErr) {
+		return codes.AlreadyExists
+	}
+	var diskFormatErr *DiskFormatError
+	if errors.As(err, &diskFormatErr) {
+		return codes.InvalidArgument
+	}
+	var adoptionErr *DiskAdoptionError
+	if errors.As(err, &adoptionErr) {
+		return codes.InvalidArgument
+	}
+	var snapshotNotFoundErr *SnapshotNotFoundError
+	if errors.As(err, &snapshotNotFoundErr) {
+		return codes.NotFound
+	}
+	var restoreErr *SnapshotRestoreError
+	if errors.As(err, &restoreErr) {
+		return codes.InvalidArgument
+	}
+	var snapshotSizeErr *SnapshotSizeError
+	if errors.As(err, &snapshotSizeErr) {
+		return codes.OutOfRange
+	}
+	var cloneSourceNotFoundErr *CloneSourceNotFoundError
+	if errors.As(err, &cloneSourceNotFoundErr) {
+		return codes.NotFound
+	}
+	var clonePlacementErr *ClonePlacementError
+	if errors.As(err, &clonePlacementErr) {
+		return codes.InvalidArgument
+	}
+	var cloneSizeErr *CloneSizeError
+	if errors.As(err, &cloneSizeErr) {
+		return codes.OutOfRange
+	}
+	var cloneErr *cnsvolume.VolumeCloneError
+	if errors.As(err, &cloneErr) {
+		if cloneErr.SourceNotFound {
+			return codes.NotFound
+		}
+		if cloneErr.Busy {
+			return codes.Unavailable
+		}
+		return codes.Internal
+	}
+	var spaceErr *cnsvolume.InsufficientSpaceError
+	if errors.As(err, &spaceErr) {
+		return codes.ResourceExhausted
+	}
+	return codes.Internal
+}
+
+// ExpandVolumeErrorCode returns the gRPC code to fail ControllerExpandVolume
+// with for an error of ExpandVolumeUtil.
+func ExpandVolumeErrorCode(err error) codes.Code {
+	var shrinkErr *VolumeShrinkError
+	if errors.As(err, &shrinkErr) {
+		return codes.OutOfRange
+	}
+	var spaceErr *cnsvolume.InsufficientSpaceError
+	if errors.As(err, &spaceErr) {
+		return codes.ResourceExhausted
+	}
+	var inProgressErr *cnsvolume.ExpandInProgressError
+	if errors.As(err, &inProgressErr) {
+		return codes.Aborted
+	}
+	return codes.Internal
+}
+
+// PVCEventForError returns the reason and message of the warning event to
+// record on the PVC for an error of CreateBlockVolumeUtil,
+// CreateFileVolumeUtil or ExpandVolumeUtil, or false if the error needs no
+// event.
+func PVCEventForError(err error) (string, string, bool) {
+	var shrinkErr *VolumeShrinkError
+	if errors.As(err, &shrinkErr) {
+		return EventReasonVolumeShrinkNotSupported, shrinkErr.Error(), true
+	}
+	var spaceErr *cnsvolume.InsufficientSpaceError
+	if errors.As(err, &spaceErr) {
+		return EventReasonInsufficientDatastoreSpace, spaceErr.Error(), true
+	}
+	return "", "", false
+}
@@ -18,9 +18,16 @@ package common
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"testing"
 
+	"github.com/container-storage-interface/spec/lib/go/csi"
 	vim25types "github.com/vmware/govmomi/vim25/types"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	cnsvolume "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/volume"
 )
 
 // TestUseVslmAPIsFuncForVC67Update3l tests UseVslmAPIs method for VC version 6.7 Update 3l
@@ -174,3 +181,47 @@ func TestUseVslmAPIsFuncForVC70u1(t *testing.T) {
 		t.Fatal("Received error from UseVslmAPIs method")
 	}
 }
+
+// TestValidateControllerExpandFileVolumeRequest checks that file volumes can
+// only be expanded when file volume expansion is supported.
+func TestValidateControllerExpandFileVolumeRequest(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req := &csi.ControllerExpandVolumeRequest{
+		VolumeId:      "file:volume",
+		CapacityRange: &csi.CapacityRange{RequiredBytes: GbInBytes},
+		VolumeCapability: &csi.VolumeCapability{
+			AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{FsType: NfsV4FsType}},
+			AccessMode: &csi.VolumeCapability_AccessMode{
+				Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER,
+			},
+		},
+	}
+	if err := ValidateControllerExpandVolumeRequest(ctx, req, false); status.Code(err) != codes.Unimplemented {
+		t.Fatalf("expected code Unimplemented when file volume expansion is not supported, got %v", err)
+	}
+	if err := ValidateControllerExpandVolumeRequest(ctx, req, true); err != nil {
+		t.Fatalf("expected file volume expansion to be accepted when supported, got %v", err)
+	}
+}
+
+func TestPVCEventForError(t *testing.T) {
+	shrinkErr := &VolumeShrinkError{VolumeID: "vol1", CurrentSizeMB: 2048, RequestedSizeMB: 1024}
+	spaceErr := &cnsvolume.InsufficientSpaceError{Volume: "vol1", Datastore: "ds1", RequiredMB: 2048, FreeMB: 1024}
+	tests := []struct {
+		err     error
+		reason  string
+		message string
+	}{
+		{fmt.Errorf("failed to expand volume: %w", shrinkErr), EventReasonVolumeShrinkNotSupported, shrinkErr.Error()},
+		{fmt.Errorf("failed to create volume: %w", spaceErr), EventReasonInsufficientDatastoreSpace, spaceErr.Error()},
+		{errors.New("failed to create volume"), "", ""},
+	}
+	for _, test := range tests {
+		reason, message, ok := PVCEventForError(test.err)
+		if ok != (test.reason != "") || reason != test.reason || message != test.message {
+			t.Errorf("expected event %q %q for error %v, got %q %q, %t", test.reason, test.message, test.err,
+				reason, message, ok)
+		}
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"fmt"
 
 	cnstypes "github.com/vmware/govmomi/cns/types"
+	"k8s.io/apimachinery/pkg/types"
 	cnsvolume "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/volume"
 
 	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/common"
@@ -43,6 +44,21 @@ type COCommonInterface interface {
 	MarkFakeAttached(ctx context.Context, volumeID string) error
 	// Check if the volume was fake attached, and unmark it as not fake attached.
 	ClearFakeAttached(ctx context.Context, volumeID string) error
+	// GetPVCAnnotations returns the annotations of the PVC with the given name in the given namespace
+	GetPVCAnnotations(ctx context.Context, namespace string, name string) (map[string]string, error)
+	// RecordPVCEvent records an event of the given type and reason on the PVC bound to the volume, or on the
+	// PVC with the name pvc if volumeID is empty, for volumes not created yet
+	RecordPVCEvent(ctx context.Context, volumeID string, pvc types.NamespacedName, eventType string, reason string,
+		message string)
+	// RecordNodeEvent records an event of the given type and reason on the node with the given name
+	RecordNodeEvent(ctx context.Context, nodeName string, eventType string, reason string, message string)
+	// GetVolumeStorageClassParams returns the parameters of the StorageClass the volume was provisioned with
+	GetVolumeStorageClassParams(ctx context.Context, volumeID string) (map[string]string, error)
+	// GetPodsUsingVolumeOnNode returns the namespaced names of the pods on the node, not terminated,
+	// using the PVC bound to the volume
+	GetPodsUsingVolumeOnNode(ctx context.Context, volumeID string, nodeName string) ([]string, error)
+	// IsNodeReady returns whether the node with the given name exists and is Ready
+	IsNodeReady(ctx context.Context, nodeName string) (bool, error)
 }
 
 // GetContainerOrchestratorInterface returns orchestrator object
@@ -30,14 +30,20 @@ import (
 	cnstypes "github.com/vmware/govmomi/cns/types"
 	pbmtypes "github.com/vmware/govmomi/pbm/types"
 	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	apiMeta "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/informers"
 	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	restclient "k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	cnsoperatorv1alpha1 "sigs.k8s.io/vsphere-csi-driver/pkg/apis/cnsoperator"
@@ -109,6 +115,14 @@ type K8sOrchestrator struct {
 	clusterFlavor    cnstypes.CnsClusterFlavor
 	volumeIDToPvcMap *volumeIDToPvcMap
 	k8sClient        clientset.Interface
+	// pvIndexer indexes the PVs of the driver by volume handle, it is nil if
+	// the index could not be added to the PV informer.
+	pvIndexer cache.Indexer
+	// pvSynced returns true once the PV informer has synced.
+	pvSynced cache.InformerSynced
+	// eventRecorder records events on PVCs, it is created on first use.
+	eventRecorder     record.EventRecorder
+	eventRecorderOnce sync.Once
 }
 
 // K8sGuestInitParams lists the set of parameters required to run the init for K8sOrchestrator in Guest cluster
@@ -167,6 +181,17 @@ func Newk8sOrchestrator(ctx context.Context, controllerClusterFlavor cnstypes.Cn
 
 				initVolumeHandleToPvcMap(ctx)
 			}
+			// The PVs of volumes are only looked up by the controller.
+			if serviceMode != "node" {
+				pvInformer, err := k8sOrchestratorInstance.informerManager.AddPVVolumeHandleIndex(csitypes.Name)
+				if err != nil {
+					// The PVs of volumes are looked up in the PV lister instead.
+					log.Warnf("failed to index PVs by volume handle. Error: %v", err)
+				} else {
+					k8sOrchestratorInstance.pvIndexer = pvInformer.GetIndexer()
+				}
+				k8sOrchestratorInstance.pvSynced = pvInformer.HasSynced
+			}
 			k8sOrchestratorInstance.informerManager.Listen()
 			atomic.StoreUint32(&k8sOrchestratorInstanceInitialized, 1)
 			log.Info("k8sOrchestratorInstance initialized")
@@ -826,7 +851,8 @@ func (c *K8sOrchestrator) IsFakeAttachAllowed(ctx context.Context, volumeID stri
 	if val, found := pvcAnn[common.AnnIgnoreInaccessiblePV]; found && val == "yes" {
 		log.Debugf("Found %s annotation on pvc set to yes for volume: %s. Checking volume health on CNS volume.", common.AnnIgnoreInaccessiblePV, volumeID)
 		//Check if volume is inaccessible
-		vol, err := common.QueryVolumeByID(ctx, volumeManager, volumeID)
+		vol, err := common.QueryVolumeFieldsByID(ctx, volumeManager, volumeID,
+			cnstypes.QuerySelectionNameTypeHealthStatus)
 		if err != nil {
 			log.Errorf("failed to query CNS for volume ID %s while checking eligibility for fake attach", volumeID)
 			return false, err
@@ -903,3 +929,154 @@ func (c *K8sOrchestrator) ClearFakeAttached(ctx context.Context, volumeID string
 	}
 	return nil
 }
+
+// GetPVCAnnotations returns the annotations of the PVC with the given name in the given namespace
+func (c *K8sOrchestrator) GetPVCAnnotations(ctx context.Context, namespace string, name string) (
+	map[string]string, error) {
+	log := logger.GetLogger(ctx)
+	pvc, err := c.k8sClient.CoreV1().PersistentVolumeClaims(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		log.Errorf("failed to get pvc: %s in namespace: %s. err=%v", name, namespace, err)
+		return nil, err
+	}
+	return pvc.Annotations, nil
+}
+
+// RecordPVCEvent records an event of the given type and reason on the PVC bound to the volume, or on the PVC
+// with the name pvc if volumeID is empty, for volumes not created yet
+func (c *K8sOrchestrator) RecordPVCEvent(ctx context.Context, volumeID string, pvc types.NamespacedName,
+	eventType string, reason string, message string) {
+	log := logger.GetLogger(ctx)
+	var (
+		claim *v1.PersistentVolumeClaim
+		err   error
+	)
+	if volumeID != "" {
+		claim, err = c.getPVCForVolume(ctx, volumeID)
+	} else if pvc.Name != "" {
+		claim, err = c.k8sClient.CoreV1().PersistentVolumeClaims(pvc.Namespace).Get(ctx, pvc.Name, metav1.GetOptions{})
+	} else {
+		log.Debugf("no pvc to record event %q on", reason)
+		return
+	}
+	if err != nil {
+		log.Warnf("failed to find pvc of volume %q, pvc %q to record event %q. err=%v", volumeID, pvc, reason, err)
+		return
+	}
+	c.recordEvent(claim, eventType, reason, message)
+	log.Debugf("Recorded event %q on pvc %s/%s for volume %q", reason, claim.Namespace, claim.Name, volumeID)
+}
+
+// RecordNodeEvent records an event of the given type and reason on the node with the given name
+func (c *K8sOrchestrator) RecordNodeEvent(ctx context.Context, nodeName string, eventType string, reason string,
+	message string) {
+	log := logger.GetLogger(ctx)
+	// Like the kubelet, refer to the node by name instead of getting it.
+	node := &v1.ObjectReference{
+		Kind: "Node",
+		Name: nodeName,
+		UID:  types.UID(nodeName),
+	}
+	c.recordEvent(node, eventType, reason, message)
+	log.Debugf("Recorded event %q on node %s", reason, nodeName)
+}
+
+// recordEvent records an event on the object, creating the event recorder on first use
+func (c *K8sOrchestrator) recordEvent(object runtime.Object, eventType string, reason string, message string) {
+	c.eventRecorderOnce.Do(func() {
+		eventBroadcaster := record.NewBroadcaster()
+		eventBroadcaster.StartRecordingToSink(
+			&typedcorev1.EventSinkImpl{
+				Interface: c.k8sClient.CoreV1().Events(""),
+			},
+		)
+		c.eventRecorder = eventBroadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: csitypes.Name})
+	})
+	c.eventRecorder.Event(object, eventType, reason, message)
+}
+
+// GetVolumeStorageClassParams returns the parameters of the StorageClass the volume was provisioned with.
+// Statically provisioned volumes without a StorageClass have no parameters.
+func (c *K8sOrchestrator) GetVolumeStorageClassParams(ctx context.Context, volumeID string) (map[string]string, error) {
+	log := logger.GetLogger(ctx)
+	pv, err := c.getPVForVolume(ctx, volumeID)
+	if err != nil {
+		if err == common.ErrNotFound {
+			log.Debugf("could not find pv for volumeID: %s", volumeID)
+			return nil, nil
+		}
+		log.Errorf("failed to find pv for volume %s. err=%v", volumeID, err)
+		return nil, err
+	}
+	if pv.Spec.StorageClassName == "" {
+		return nil, nil
+	}
+	sc, err := c.k8sClient.StorageV1().StorageClasses().Get(ctx, pv.Spec.StorageClassName, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			log.Debugf("StorageClass %s of pv %s is not found", pv.Spec.StorageClassName, pv.Name)
+			return nil, nil
+		}
+		log.Errorf("failed to get StorageClass %s of pv %s. err=%v", pv.Spec.StorageClassName, pv.Name, err)
+		return nil, err
+	}
+	return sc.Parameters, nil
+}
+
+// GetPodsUsingVolumeOnNode returns the namespaced names of the pods on the node, not terminated,
+// using the PVC bound to the volume. Volumes without a bound PVC have no pods using them.
+func (c *K8sOrchestrator) GetPodsUsingVolumeOnNode(ctx context.Context, volumeID string, nodeName string) (
+	[]string, error) {
+	log := logger.GetLogger(ctx)
+	pv, err := c.getPVForVolume(ctx, volumeID)
+	if err != nil {
+		if err == common.ErrNotFound {
+			log.Debugf("could not find pv for volumeID: %s", volumeID)
+			return nil, nil
+		}
+		log.Errorf("failed to find pv for volume %s. err=%v", volumeID, err)
+		return nil, err
+	}
+	if pv.Spec.ClaimRef == nil {
+		return nil, nil
+	}
+	pods, err := c.k8sClient.CoreV1().Pods(pv.Spec.ClaimRef.Namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", nodeName).String(),
+	})
+	if err != nil {
+		log.Errorf("failed to list pods on node %s in namespace %s. err=%v", nodeName, pv.Spec.ClaimRef.Namespace, err)
+		return nil, err
+	}
+	var podNames []string
+	for _, pod := range pods.Items {
+		if pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+			continue
+		}
+		for _, volume := range pod.Spec.Volumes {
+			if volume.PersistentVolumeClaim != nil && volume.PersistentVolumeClaim.ClaimName == pv.Spec.ClaimRef.Name {
+				podNames = append(podNames, pod.Namespace+"/"+pod.Name)
+				break
+			}
+		}
+	}
+	return podNames, nil
+}
+
+// IsNodeReady returns whether the node with the given name exists and is Ready
+func (c *K8sOrchestrator) IsNodeReady(ctx context.Context, nodeName string) (bool, error) {
+	log := logger.GetLogger(ctx)
+	node, err := c.k8sClient.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		log.Errorf("failed to get node %s. err=%v", nodeName, err)
+		return false, err
+	}
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == v1.NodeReady {
+			return condition.Status == v1.ConditionTrue, nil
+		}
+	}
+	return false, nil
+}
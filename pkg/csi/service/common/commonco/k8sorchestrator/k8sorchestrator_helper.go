@@ -25,8 +25,12 @@ import (
 	v1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
 	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/common"
 	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
+	csitypes "sigs.k8s.io/vsphere-csi-driver/pkg/csi/types"
+	k8s "sigs.k8s.io/vsphere-csi-driver/pkg/kubernetes"
 )
 
 // getPVCAnnotations fetches annotations from PVC bound to passed volumeID and returns
@@ -112,3 +116,49 @@ func isFileVolume(pv *v1.PersistentVolume) bool {
 	}
 	return false
 }
+
+// getPVForVolume returns the PV of the given volumeID from the PV informer cache
+func (c *K8sOrchestrator) getPVForVolume(ctx context.Context, volumeID string) (*v1.PersistentVolume, error) {
+	if c.pvSynced != nil && !cache.WaitForCacheSync(ctx.Done(), c.pvSynced) {
+		return nil, fmt.Errorf("PV informer cache did not sync")
+	}
+	if c.pvIndexer != nil {
+		objs, err := c.pvIndexer.ByIndex(k8s.PVVolumeHandleIndex, volumeID)
+		if err != nil {
+			return nil, err
+		}
+		if len(objs) == 0 {
+			return nil, common.ErrNotFound
+		}
+		return objs[0].(*v1.PersistentVolume), nil
+	}
+	pvs, err := c.informerManager.GetPVLister().List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	for _, pv := range pvs {
+		if pv.Spec.CSI != nil && pv.Spec.CSI.Driver == csitypes.Name && pv.Spec.CSI.VolumeHandle == volumeID {
+			return pv, nil
+		}
+	}
+	return nil, common.ErrNotFound
+}
+
+// getPVCForVolume returns the PVC bound to the PV of the given volumeID
+func (c *K8sOrchestrator) getPVCForVolume(ctx context.Context, volumeID string) (*v1.PersistentVolumeClaim, error) {
+	if c.volumeIDToPvcMap != nil {
+		if pvc := c.volumeIDToPvcMap.get(volumeID); pvc != "" {
+			parts := strings.Split(pvc, "/")
+			return c.k8sClient.CoreV1().PersistentVolumeClaims(parts[0]).Get(ctx, parts[1], metav1.GetOptions{})
+		}
+	}
+	pv, err := c.getPVForVolume(ctx, volumeID)
+	if err != nil {
+		return nil, err
+	}
+	if pv.Spec.ClaimRef == nil {
+		return nil, common.ErrNotFound
+	}
+	return c.k8sClient.CoreV1().PersistentVolumeClaims(pv.Spec.ClaimRef.Namespace).Get(ctx,
+		pv.Spec.ClaimRef.Name, metav1.GetOptions{})
+}
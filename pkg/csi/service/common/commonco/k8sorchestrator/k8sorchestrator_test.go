@@ -21,8 +21,15 @@ import (
 	"testing"
 
 	cnstypes "github.com/vmware/govmomi/cns/types"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	testclient "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
 
 	cnsconfig "sigs.k8s.io/vsphere-csi-driver/pkg/common/config"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/common"
+	csitypes "sigs.k8s.io/vsphere-csi-driver/pkg/csi/types"
+	k8s "sigs.k8s.io/vsphere-csi-driver/pkg/kubernetes"
 )
 
 var (
@@ -232,3 +239,88 @@ func TestIsFSSEnabledWithWrongClusterFlavor(t *testing.T) {
 		t.Errorf("volume-extend feature state enabled even when cluster flavor is wrong")
 	}
 }
+
+// TestGetPodsUsingVolumeOnNode tests that only pods not terminated using the PVC of the volume are returned
+func TestGetPodsUsingVolumeOnNode(t *testing.T) {
+	pv := &v1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "pv1"},
+		Spec: v1.PersistentVolumeSpec{
+			PersistentVolumeSource: v1.PersistentVolumeSource{
+				CSI: &v1.CSIPersistentVolumeSource{Driver: csitypes.Name, VolumeHandle: "vol1"},
+			},
+			ClaimRef: &v1.ObjectReference{Namespace: "ns", Name: "pvc1"},
+		},
+	}
+	newPod := func(name string, claimName string, phase v1.PodPhase) *v1.Pod {
+		return &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: name},
+			Spec: v1.PodSpec{
+				NodeName: "node1",
+				Volumes: []v1.Volume{
+					{
+						Name: "data",
+						VolumeSource: v1.VolumeSource{
+							PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: claimName},
+						},
+					},
+				},
+			},
+			Status: v1.PodStatus{Phase: phase},
+		}
+	}
+	k8sOrchestrator := K8sOrchestrator{
+		clusterFlavor: cnstypes.CnsClusterFlavorVanilla,
+		k8sClient: testclient.NewSimpleClientset(pv, newPod("running", "pvc1", v1.PodRunning),
+			newPod("succeeded", "pvc1", v1.PodSucceeded), newPod("other", "pvc2", v1.PodRunning)),
+		pvIndexer: newPVIndexer(t, pv),
+	}
+	pods, err := k8sOrchestrator.GetPodsUsingVolumeOnNode(ctx, "vol1", "node1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pods) != 1 || pods[0] != "ns/running" {
+		t.Errorf("expected only pod ns/running to use volume vol1, got %v", pods)
+	}
+	// Volumes without a PV have no pods using them.
+	pods, err = k8sOrchestrator.GetPodsUsingVolumeOnNode(ctx, "vol2", "node1")
+	if err != nil || len(pods) != 0 {
+		t.Errorf("expected no pods to use volume vol2, got %v, err: %v", pods, err)
+	}
+}
+
+// newPVIndexer returns an indexer of the given PVs by volume handle, like the
+// one of the PV informer.
+func newPVIndexer(t *testing.T, pvs ...*v1.PersistentVolume) cache.Indexer {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc,
+		cache.Indexers{k8s.PVVolumeHandleIndex: k8s.PVVolumeHandleIndexFunc(csitypes.Name)})
+	for _, pv := range pvs {
+		if err := indexer.Add(pv); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return indexer
+}
+
+func TestGetPVForVolume(t *testing.T) {
+	newPV := func(name string, driver string) *v1.PersistentVolume {
+		return &v1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: v1.PersistentVolumeSpec{
+				PersistentVolumeSource: v1.PersistentVolumeSource{
+					CSI: &v1.CSIPersistentVolumeSource{Driver: driver, VolumeHandle: "vol1"},
+				},
+			},
+		}
+	}
+	k8sOrchestrator := K8sOrchestrator{
+		pvIndexer: newPVIndexer(t, newPV("other-driver", "other.csi.example.com"), newPV("pv1", csitypes.Name),
+			&v1.PersistentVolume{ObjectMeta: metav1.ObjectMeta{Name: "in-tree"}}),
+	}
+	pv, err := k8sOrchestrator.getPVForVolume(ctx, "vol1")
+	if err != nil || pv.Name != "pv1" {
+		t.Errorf("expected pv1 for volume vol1, got %v, err: %v", pv, err)
+	}
+	if _, err = k8sOrchestrator.getPVForVolume(ctx, "vol2"); err != common.ErrNotFound {
+		t.Errorf("expected ErrNotFound for volume vol2, got %v", err)
+	}
+}
@@ -0,0 +1,189 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	cnsconfig "sigs.k8s.io/vsphere-csi-driver/pkg/common/config"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
+	k8s "sigs.k8s.io/vsphere-csi-driver/pkg/kubernetes"
+)
+
+// configSecretReloadBackoff is the backoff of the reloads of the config after
+// the vCenter credentials changed in the config secret, while they fail, for
+// example until the new password is set in vCenter. Once the cap is reached
+// the reload is retried at the cap interval, so that rotating credentials
+// doesn't flood vCenter with failing logins.
+var configSecretReloadBackoff = wait.Backoff{
+	Duration: 5 * time.Second,
+	Factor:   2,
+	Jitter:   0.1,
+	Steps:    10,
+	Cap:      5 * time.Minute,
+}
+
+// ReloadConfigurationWithBackoff calls reload until it succeeds, retrying with
+// the backoff of the reloads after a change of the config secret, so that a
+// config file with credentials not valid in vCenter yet doesn't flood vCenter
+// with failing logins.
+func ReloadConfigurationWithBackoff(ctx context.Context, cfgPath string, reload func() error) {
+	log := logger.GetLogger(ctx)
+	backoff := configSecretReloadBackoff
+	for {
+		err := reload()
+		if err == nil {
+			log.Infof("Successfully reloaded configuration from: %q", cfgPath)
+			return
+		}
+		delay := backoff.Step()
+		log.Errorf("failed to reload configuration. will retry again in %v. err: %+v", delay, err)
+		time.Sleep(delay)
+	}
+}
+
+// configSecretWatcher reloads the config when the vCenter credentials change
+// in the config secret.
+type configSecretWatcher struct {
+	// key is the key of the config file in the secret.
+	key string
+	// currentConfig returns the config in use.
+	currentConfig func() *cnsconfig.Config
+	// reload switches to the given config.
+	reload func(ctx context.Context, cfg *cnsconfig.Config) error
+	// lock protects pending.
+	lock sync.Mutex
+	// pending is the latest config of the secret with changed credentials.
+	pending *cnsconfig.Config
+	// changed is signaled when pending is set.
+	changed chan struct{}
+}
+
+// WatchConfigSecret watches the secret named by the VSPHERE_CSI_CONFIG_SECRET
+// environment variable, in the namespace of CSI_NAMESPACE, and calls reload
+// with the config in the secret when its vCenter credentials are different
+// from the ones of currentConfig. Failed reloads are retried with backoff, with
+// the latest config of the secret. The secret is watched in addition to the
+// mounted config file, which the kubelet updates up to a minute later. It does
+// nothing if VSPHERE_CSI_CONFIG_SECRET isn't set.
+func WatchConfigSecret(ctx context.Context, currentConfig func() *cnsconfig.Config,
+	reload func(ctx context.Context, cfg *cnsconfig.Config) error) error {
+	log := logger.GetLogger(ctx)
+	secretName := os.Getenv(cnsconfig.EnvVSphereCSIConfigSecret)
+	if secretName == "" {
+		log.Infof("%s isn't set, vCenter credentials are reloaded from the config file only",
+			cnsconfig.EnvVSphereCSIConfigSecret)
+		return nil
+	}
+	namespace := os.Getenv(cnsconfig.EnvCSINamespace)
+	if namespace == "" {
+		namespace = cnsconfig.DefaultCSINamespace
+	}
+	k8sClient, err := k8s.NewClient(ctx)
+	if err != nil {
+		log.Errorf("failed to create Kubernetes client. Err: %v", err)
+		return err
+	}
+	w := &configSecretWatcher{
+		key:           filepath.Base(GetConfigPath(ctx)),
+		currentConfig: currentConfig,
+		reload:        reload,
+		changed:       make(chan struct{}, 1),
+	}
+	go w.run()
+	log.Infof("Watching secret %s/%s for vCenter credential changes", namespace, secretName)
+	k8s.NewInformer(k8sClient).AddSecretListener(ctx, k8sClient, namespace, secretName,
+		w.secretUpdated,
+		func(oldObj interface{}, newObj interface{}) {
+			w.secretUpdated(newObj)
+		},
+		nil)
+	return nil
+}
+
+// secretUpdated records the config of the secret as pending if its vCenter
+// credentials changed.
+func (w *configSecretWatcher) secretUpdated(obj interface{}) {
+	ctx, log := logger.GetNewContextWithLogger()
+	secret, ok := obj.(*v1.Secret)
+	if secret == nil || !ok {
+		log.Warnf("secretUpdated: unrecognized object %+v", obj)
+		return
+	}
+	data, ok := secret.Data[w.key]
+	if !ok {
+		log.Warnf("secret %s/%s has no key %q", secret.Namespace, secret.Name, w.key)
+		return
+	}
+	cfg, err := cnsconfig.ReadConfig(ctx, bytes.NewReader(data))
+	if err != nil {
+		log.Errorf("failed to parse the config of secret %s/%s. Err: %v", secret.Namespace, secret.Name, err)
+		return
+	}
+	if !cnsconfig.VCenterCredentialsChanged(w.currentConfig(), cfg) {
+		log.Debugf("vCenter credentials of secret %s/%s are unchanged", secret.Namespace, secret.Name)
+		return
+	}
+	log.Infof("vCenter credentials changed in secret %s/%s", secret.Namespace, secret.Name)
+	w.lock.Lock()
+	w.pending = cfg
+	w.lock.Unlock()
+	select {
+	case w.changed <- struct{}{}:
+	default:
+	}
+}
+
+// run reloads the pending config each time it is set, retrying with backoff
+// until the reload succeeds or the config in use has the pending credentials.
+func (w *configSecretWatcher) run() {
+	for range w.changed {
+		backoff := configSecretReloadBackoff
+		for {
+			ctx, log := logger.GetNewContextWithLogger()
+			w.lock.Lock()
+			cfg := w.pending
+			w.lock.Unlock()
+			if !cnsconfig.VCenterCredentialsChanged(w.currentConfig(), cfg) {
+				// Reloaded from the config file meanwhile.
+				break
+			}
+			err := w.reload(ctx, cfg)
+			if err == nil {
+				log.Info("Successfully reloaded configuration with the new vCenter credentials")
+				break
+			}
+			delay := backoff.Step()
+			log.Errorf("failed to reload configuration with the new vCenter credentials. "+
+				"will retry again in %v. err: %+v", delay, err)
+			select {
+			case <-w.changed:
+				// The secret changed again, retry with its config right away.
+				backoff = configSecretReloadBackoff
+			case <-time.After(delay):
+			}
+		}
+	}
+}
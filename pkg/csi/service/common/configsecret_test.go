@@ -0,0 +1,129 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	cnsconfig "sigs.k8s.io/vsphere-csi-driver/pkg/common/config"
+)
+
+func newConfigSecret(t *testing.T, password string) (*v1.Secret, *cnsconfig.Config) {
+	data := fmt.Sprintf("[Global]\ncluster-id = \"test-cluster\"\n\n"+
+		"[VirtualCenter \"1.1.1.1\"]\nuser = \"Admin\"\npassword = \"%s\"\n", password)
+	cfg, err := cnsconfig.ReadConfig(ctx, strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "vsphere-config-secret", Namespace: "vmware-system-csi"},
+		Data:       map[string][]byte{"csi-vsphere.conf": []byte(data)},
+	}, cfg
+}
+
+func TestConfigSecretWatcher(t *testing.T) {
+	savedBackoff := configSecretReloadBackoff
+	defer func() { configSecretReloadBackoff = savedBackoff }()
+	configSecretReloadBackoff = wait.Backoff{Duration: time.Millisecond, Factor: 2, Steps: 3, Cap: 10 * time.Millisecond}
+
+	_, current := newConfigSecret(t, "Password")
+	var lock sync.Mutex
+	failures := 2
+	reloaded := make(chan *cnsconfig.Config, 1)
+	w := &configSecretWatcher{
+		key: "csi-vsphere.conf",
+		currentConfig: func() *cnsconfig.Config {
+			lock.Lock()
+			defer lock.Unlock()
+			return current
+		},
+		reload: func(ctx context.Context, cfg *cnsconfig.Config) error {
+			lock.Lock()
+			defer lock.Unlock()
+			if failures > 0 {
+				failures--
+				return errors.New("incorrect user name or password")
+			}
+			current = cfg
+			reloaded <- cfg
+			return nil
+		},
+		changed: make(chan struct{}, 1),
+	}
+	go w.run()
+
+	// Secrets with the credentials in use don't reload the config.
+	secret, _ := newConfigSecret(t, "Password")
+	w.secretUpdated(secret)
+	w.lock.Lock()
+	if w.pending != nil {
+		t.Errorf("expected no pending config for unchanged credentials, got %+v", w.pending)
+	}
+	w.lock.Unlock()
+
+	// Failed reloads are retried until the new credentials are used.
+	secret, _ = newConfigSecret(t, "NewPassword")
+	w.secretUpdated(secret)
+	select {
+	case cfg := <-reloaded:
+		if cfg.VirtualCenter["1.1.1.1"].Password != "NewPassword" {
+			t.Errorf("expected the config to be reloaded with the new password, got %+v", cfg.VirtualCenter["1.1.1.1"])
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for the config to be reloaded")
+	}
+	lock.Lock()
+	if failures != 0 {
+		t.Errorf("expected the failed reloads to be retried, %d failures left", failures)
+	}
+	lock.Unlock()
+}
+
+func TestReloadConfigurationWithBackoff(t *testing.T) {
+	savedBackoff := configSecretReloadBackoff
+	defer func() { configSecretReloadBackoff = savedBackoff }()
+	configSecretReloadBackoff = wait.Backoff{Duration: time.Millisecond, Factor: 2, Steps: 3, Cap: 10 * time.Millisecond}
+
+	var delays []time.Duration
+	last := time.Now()
+	ReloadConfigurationWithBackoff(context.Background(), "csi-vsphere.conf", func() error {
+		now := time.Now()
+		delays = append(delays, now.Sub(last))
+		last = now
+		if len(delays) < 5 {
+			return errors.New("incorrect user name or password")
+		}
+		return nil
+	})
+	if len(delays) != 5 {
+		t.Fatalf("expected the reload to be retried until it succeeds, got %d reloads", len(delays))
+	}
+	// The delays grow from 1ms up to the 10ms cap.
+	if delays[2] < 2*time.Millisecond || delays[4] < 8*time.Millisecond {
+		t.Errorf("expected the reloads to be retried with backoff, got delays %v", delays)
+	}
+}
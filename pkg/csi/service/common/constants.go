@@ -62,6 +62,62 @@ const (
 	// For example: StoragePool: "storagepool-vsandatastore"
 	AttributeStoragePool = "storagepool"
 
+	// AttributeVolumeNameTemplate represents the template of the CNS volume name in the StorageClass
+	// For Example: VolumeNameTemplate: "${pvc.namespace}-${pvc.name}"
+	AttributeVolumeNameTemplate = "volumenametemplate"
+
+	// AttributePVCName, AttributePVCNamespace and AttributePVName are the parameters the
+	// external-provisioner passes the PVC and PV metadata in when run with --extra-create-metadata
+	AttributePVCName      = "csi.storage.k8s.io/pvc/name"
+	AttributePVCNamespace = "csi.storage.k8s.io/pvc/namespace"
+	AttributePVName       = "csi.storage.k8s.io/pv/name"
+
+	// AttributeOfflineExpansionOnly represents whether volumes of the StorageClass may only
+	// be expanded while detached. For Example: OfflineExpansionOnly: "true"
+	AttributeOfflineExpansionOnly = "offlineexpansiononly"
+
+	// AttributeAllowDiskAdoption represents whether PVCs of the StorageClass may adopt
+	// pre-created disks with the AnnAdoptDisk annotation. For Example: AllowDiskAdoption: "true"
+	AttributeAllowDiskAdoption = "allowdiskadoption"
+
+	// AttributeDatastoreTags represents the vSphere tags datastores volumes of the StorageClass
+	// are placed on have to carry. For Example: DatastoreTags: "tier:gold"
+	AttributeDatastoreTags = "datastoretags"
+
+	// AttributeVCenter represents the vCenter, of the ones in the vsphere config secret, volumes of
+	// the StorageClass are provisioned in. For Example: VCenter: "vc2.example.com"
+	AttributeVCenter = "vcenter"
+
+	// AttributeIOScheduler represents the I/O scheduler set on the block device of volumes
+	// of the StorageClass on the node. For Example: IOScheduler: "mq-deadline"
+	AttributeIOScheduler = "ioscheduler"
+
+	// AttributeReadAheadKB represents the read-ahead in KB set on the block device of volumes
+	// of the StorageClass on the node. For Example: ReadAheadKB: "128"
+	AttributeReadAheadKB = "readaheadkb"
+
+	// AttributeQueueDepth represents the queue depth set on the block device of volumes
+	// of the StorageClass on the node. For Example: QueueDepth: "64"
+	AttributeQueueDepth = "queuedepth"
+
+	// AttributeIOPSLimit represents the IOPS limit set on the virtual disk of volumes of the
+	// StorageClass when they are attached to a node. For Example: IOPSLimit: "1000"
+	AttributeIOPSLimit = "iopslimit"
+
+	// AttributeIOShares represents the shares of storage I/O, low, normal, high or a number,
+	// set on the virtual disk of volumes of the StorageClass when they are attached to a node.
+	// For Example: IOShares: "high"
+	AttributeIOShares = "ioshares"
+
+	// AttributeDiskControllerType represents the type of the controllers, pvscsi or nvme, the
+	// virtual disk of volumes of the StorageClass is attached to. For Example: DiskControllerType: "nvme"
+	AttributeDiskControllerType = "diskcontrollertype"
+
+	// AttributeDiskPlacementPolicy represents how the virtual disks of volumes of the StorageClass
+	// are distributed across the controllers of a node VM, fill or spread.
+	// For Example: DiskPlacementPolicy: "spread"
+	AttributeDiskPlacementPolicy = "diskplacementpolicy"
+
 	// AttributeHostLocal represents the presence of HostLocal functionality in
 	// the given storage policy. For Example: HostLocal: "True"
 	AttributeHostLocal = "hostlocal"
@@ -197,6 +253,10 @@ const (
 	// AnnVolumeHealth is the key for HealthStatus annotation on volume claim
 	AnnVolumeHealth = "volumehealth.storage.kubernetes.io/health"
 
+	// AnnAdoptDisk is the key of the annotation on volume claim referencing a pre-created
+	// disk, by FCD ID or vmdk path, to adopt as its volume
+	AnnAdoptDisk = "csi.vsphere.vmware.com/adopt-disk"
+
 	// AnnFakeAttached is the key for fake attach annotation on volume claim
 	AnnFakeAttached = "csi.vmware.com/fake-attached"
 
@@ -213,6 +273,42 @@ const (
 	// TriggerCsiFullSyncCRName is the instance name of TriggerCsiFullSync
 	// All other names will be rejected by TriggerCsiFullSync controller
 	TriggerCsiFullSyncCRName = "csifullsync"
+
+	// EventReasonVolumeShrinkNotSupported is the reason of the event recorded on a
+	// volume claim requested to be expanded to a size smaller than its volume
+	EventReasonVolumeShrinkNotSupported = "VolumeShrinkNotSupported"
+
+	// EventReasonOfflineExpansionRequired is the reason of the event recorded on a volume
+	// claim whose StorageClass only allows offline expansion while its volume is attached
+	EventReasonOfflineExpansionRequired = "OfflineExpansionRequired"
+
+	// EventReasonInsufficientDatastoreSpace is the reason of the event recorded on a
+	// volume claim whose volume failed to be created or expanded for lack of datastore space
+	EventReasonInsufficientDatastoreSpace = "InsufficientDatastoreSpace"
+
+	// EventReasonExpansionBlockedBySnapshots is the reason of the event recorded on a volume
+	// claim whose volume failed to be expanded because of snapshots of the node VM or disk
+	EventReasonExpansionBlockedBySnapshots = "VolumeExpansionBlockedBySnapshots"
+
+	// EventReasonForcedDetach is the reason of the event recorded on a volume claim whose
+	// volume is detached from a NotReady node although pods on the node still use it
+	EventReasonForcedDetach = "ForcedDetach"
+
+	// EventReasonDiskUUIDEnabled is the reason of the event recorded on a node whose VM
+	// was reconfigured with disk.EnableUUID set to TRUE
+	EventReasonDiskUUIDEnabled = "DiskUUIDEnabled"
+
+	// EventReasonDiskUUIDRemediationFailed is the reason of the event recorded on a node
+	// whose VM misses disk.EnableUUID and failed to be reconfigured with it
+	EventReasonDiskUUIDRemediationFailed = "DiskUUIDRemediationFailed"
+
+	// EventReasonVolumeAbnormal is the reason of the event recorded on a node when a
+	// volume published on it becomes abnormal
+	EventReasonVolumeAbnormal = "VolumeAbnormal"
+
+	// EventReasonVolumeRecovered is the reason of the event recorded on a node when an
+	// abnormal volume published on it is healthy again
+	EventReasonVolumeRecovered = "VolumeRecovered"
 )
 
 // Supported container orchestrators
@@ -234,8 +330,6 @@ const (
 	CSIMigration = "csi-migration"
 	// CSIAuthCheck is feature flag for auth check
 	CSIAuthCheck = "csi-auth-check"
-	// AsyncQueryVolume is feature flag for using async query volume API
-	AsyncQueryVolume = "async-query-volume"
 	// CSISVFeatureStateReplication is feature flag for SV feature state replication feature
 	CSISVFeatureStateReplication = "csi-sv-feature-states-replication"
 	// VSANDirectDiskDecommission is feature flag for vsanD disk decommission
@@ -248,4 +342,70 @@ const (
 	TriggerCsiFullSync = "trigger-csi-fullsync"
 	// CSIVolumeManagerIdempotency is the feature flag for idempotency handling in CSI volume manager
 	CSIVolumeManagerIdempotency = "csi-volume-manager-idempotency"
+	// StorageClassParamsValidation is the feature flag for validating the parameters of
+	// StorageClasses in the admission webhook
+	StorageClassParamsValidation = "storageclass-params-validation"
+	// PVCModeValidation is the feature flag for rejecting PVCs with access modes and volume
+	// modes the driver can't serve in the admission webhook
+	PVCModeValidation = "pvc-mode-validation"
+	// VolumeDefaultsMutation is the feature flag for defaulting the filesystem type and stripping
+	// unsafe mount options of StorageClasses and PersistentVolumes in the admission webhook
+	VolumeDefaultsMutation = "volume-defaults-mutation"
+	// BlockInTreeVolumeCreation is the feature flag for rejecting new in-tree vSphere StorageClasses,
+	// PersistentVolumes and PVCs in the admission webhook once CSI migration is enabled
+	BlockInTreeVolumeCreation = "block-in-tree-volume-creation"
+	// StaleAttachmentReconciliation is the feature flag for detaching volumes during full sync
+	// from node VMs on which neither a VolumeAttachment nor a pod uses them
+	StaleAttachmentReconciliation = "stale-attachment-reconciliation"
+	// ListVolumes is the feature flag for ListVolumes reporting the nodes volumes
+	// are published to, so that the external-attacher reconciles VolumeAttachments
+	ListVolumes = "list-volumes"
+	// DetachPodUsageCheck is the feature flag for refusing to detach volumes still used by
+	// pods on Ready nodes, and recording an event when detaching them from NotReady nodes
+	DetachPodUsageCheck = "detach-pod-usage-check"
+	// SocketSelfHealing is the feature flag for re-creating the CSI socket of the node plugin
+	// and the kubelet registration socket when they become stale
+	SocketSelfHealing = "socket-self-healing"
+	// VolumePerfMetrics is the feature flag for exporting the IOPS and throughput of the volumes
+	// bound to PVCs, collected from the performance stats of vCenter
+	VolumePerfMetrics = "volume-perf-metrics"
+	// VolumePopulator is the feature flag for populating the volumes of PVCs whose dataSource
+	// is a CnsVolumeSource from an existing FCD or virtual disk
+	VolumePopulator = "volume-populator"
+	// VolumeReplication is the feature flag for replicating the volumes of PVCs to a target site
+	// as configured by CnsVolumeReplication instances
+	VolumeReplication = "volume-replication"
+	// VolumeInventoryExport is the feature flag for periodically exporting the inventory of the volumes
+	// to the CnsVolumeInventory instance and to an object store endpoint
+	VolumeInventoryExport = "volume-inventory-export"
+	// NamespaceStorageMetrics is the feature flag for exporting the provisioned and used capacity
+	// of the volumes aggregated per namespace
+	NamespaceStorageMetrics = "namespace-storage-metrics"
+	// PVCDiskAdoption is the feature flag for adopting the pre-created disk a PVC references
+	// with an annotation as its volume instead of creating one
+	PVCDiskAdoption = "pvc-disk-adoption"
+	// BlockVolumeSnapshot is the feature flag for the CreateSnapshot, DeleteSnapshot and ListSnapshots
+	// RPCs, taking snapshots of the FCDs of block volumes
+	BlockVolumeSnapshot = "block-volume-snapshot"
+	// VolumeClone is the feature flag for creating block volumes as clones of other block volumes,
+	// with the PVC data source of the volume
+	VolumeClone = "volume-clone"
+	// StorageCapacityTracking is the feature flag for the GetCapacity RPC, reporting the capacity
+	// available to block volumes for the CSIStorageCapacity objects of the external-provisioner
+	StorageCapacityTracking = "storage-capacity-tracking"
+	// VolumeCondition is the feature flag for the ControllerGetVolume RPC, reporting the condition
+	// of volumes derived from their CNS health status to the external-health-monitor
+	VolumeCondition = "volume-condition"
+	// NodeVolumeHealth is the feature flag for the node plugin checking that the volumes published
+	// on the node are still reachable, and reporting their condition in NodeGetVolumeStats
+	NodeVolumeHealth = "node-volume-health"
+	// FileVolumeExtend is the feature flag for expanding file volumes by resizing the quota of their
+	// vSAN file share
+	FileVolumeExtend = "file-volume-extend"
+	// NamespaceStorageQuota is the feature flag for enforcing the CnsStorageQuota instances of the
+	// namespaces, limiting the capacity of their volumes per storage policy and datastore
+	NamespaceStorageQuota = "namespace-storage-quota"
+	// OrphanVolumeCleanup is the feature flag for reporting, and deleting if enabled in the config,
+	// the CNS volumes of the cluster without a PV
+	OrphanVolumeCleanup = "orphan-volume-cleanup"
 )
@@ -0,0 +1,105 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/vmware/govmomi/vapi/tags"
+
+	"sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/vsphere"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
+)
+
+// DatastoreTag is a vSphere tag datastores of a StorageClass have to carry.
+type DatastoreTag struct {
+	// Category is the name of the tag category, or "" if the tag name is unique.
+	Category string
+	// Name is the name of the tag.
+	Name string
+}
+
+func (t DatastoreTag) String() string {
+	if t.Category == "" {
+		return t.Name
+	}
+	return t.Category + ":" + t.Name
+}
+
+// ParseDatastoreTags parses the value of the datastoretags StorageClass
+// parameter, a comma separated list of tags given as "<category>:<tag>" or
+// "<tag>".
+func ParseDatastoreTags(value string) ([]DatastoreTag, error) {
+	var datastoreTags []DatastoreTag
+	for _, tag := range strings.Split(value, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+		var datastoreTag DatastoreTag
+		if i := strings.Index(tag, ":"); i >= 0 {
+			datastoreTag.Category = strings.TrimSpace(tag[:i])
+			datastoreTag.Name = strings.TrimSpace(tag[i+1:])
+			if datastoreTag.Category == "" || datastoreTag.Name == "" {
+				return nil, fmt.Errorf("invalid datastore tag %q, expected <category>:<tag> or <tag>", tag)
+			}
+		} else {
+			datastoreTag.Name = tag
+		}
+		datastoreTags = append(datastoreTags, datastoreTag)
+	}
+	if len(datastoreTags) == 0 {
+		return nil, fmt.Errorf("no datastore tags in %q", value)
+	}
+	return datastoreTags, nil
+}
+
+// FilterDatastoresByTags returns the datastores carrying all the given tags.
+func FilterDatastoresByTags(ctx context.Context, tagManager *tags.Manager, datastores []*vsphere.DatastoreInfo,
+	datastoreTags []DatastoreTag) ([]*vsphere.DatastoreInfo, error) {
+	log := logger.GetLogger(ctx)
+	// Number of requested tags carried by each datastore, by datastore MoRef value.
+	tagCount := make(map[string]int)
+	for _, datastoreTag := range datastoreTags {
+		tag, err := tagManager.GetTagForCategory(ctx, datastoreTag.Name, datastoreTag.Category)
+		if err != nil {
+			log.Errorf("failed to get tag %q. err: %v", datastoreTag, err)
+			return nil, fmt.Errorf("failed to get tag %q: %v", datastoreTag, err)
+		}
+		objects, err := tagManager.ListAttachedObjects(ctx, tag.ID)
+		if err != nil {
+			log.Errorf("failed to list objects tagged with %q. err: %v", datastoreTag, err)
+			return nil, fmt.Errorf("failed to list objects tagged with %q: %v", datastoreTag, err)
+		}
+		for _, object := range objects {
+			if ref := object.Reference(); ref.Type == "Datastore" {
+				tagCount[ref.Value]++
+			}
+		}
+	}
+	var taggedDatastores []*vsphere.DatastoreInfo
+	for _, datastore := range datastores {
+		if tagCount[datastore.Reference().Value] == len(datastoreTags) {
+			taggedDatastores = append(taggedDatastores, datastore)
+		} else {
+			log.Debugf("filter out datastore %q without tags %v", datastore.Info.Url, datastoreTags)
+		}
+	}
+	return taggedDatastores, nil
+}
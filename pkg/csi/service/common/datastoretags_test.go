@@ -0,0 +1,127 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common
+
+import (
+	"context"
+	"testing"
+
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vapi/rest"
+	_ "github.com/vmware/govmomi/vapi/simulator"
+	"github.com/vmware/govmomi/vapi/tags"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/types"
+
+	"sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/vsphere"
+)
+
+func TestFilterDatastoresByTags(t *testing.T) {
+	model := simulator.VPX()
+	model.Datastore = 2
+	simulator.Test(func(ctx context.Context, c *vim25.Client) {
+		restClient := rest.NewClient(c)
+		if err := restClient.Login(ctx, simulator.DefaultLogin); err != nil {
+			t.Fatal(err)
+		}
+		tagManager := tags.NewManager(restClient)
+
+		objects, err := find.NewFinder(c).DatastoreList(ctx, "*")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(objects) < 2 {
+			t.Fatalf("expected at least 2 datastores, got %d", len(objects))
+		}
+		var datastores []*vsphere.DatastoreInfo
+		for _, object := range objects {
+			datastores = append(datastores, &vsphere.DatastoreInfo{
+				Datastore: &vsphere.Datastore{Datastore: object},
+				Info:      &types.DatastoreInfo{Url: object.InventoryPath},
+			})
+		}
+
+		createTag := func(category, name string) string {
+			categoryID, err := tagManager.GetCategory(ctx, category)
+			if err != nil {
+				id, err := tagManager.CreateCategory(ctx, &tags.Category{Name: category, Cardinality: "MULTIPLE"})
+				if err != nil {
+					t.Fatal(err)
+				}
+				categoryID = &tags.Category{ID: id}
+			}
+			id, err := tagManager.CreateTag(ctx, &tags.Tag{CategoryID: categoryID.ID, Name: name})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return id
+		}
+		gold := createTag("tier", "gold")
+		createTag("tier", "silver")
+		ssd := createTag("media", "ssd")
+		if err := tagManager.AttachTag(ctx, gold, objects[0]); err != nil {
+			t.Fatal(err)
+		}
+		if err := tagManager.AttachTag(ctx, gold, objects[1]); err != nil {
+			t.Fatal(err)
+		}
+		if err := tagManager.AttachTag(ctx, ssd, objects[1]); err != nil {
+			t.Fatal(err)
+		}
+
+		tests := []struct {
+			tags     []DatastoreTag
+			expected []string
+		}{
+			{
+				tags:     []DatastoreTag{{Category: "tier", Name: "gold"}},
+				expected: []string{objects[0].InventoryPath, objects[1].InventoryPath},
+			},
+			{
+				tags:     []DatastoreTag{{Category: "tier", Name: "gold"}, {Name: "ssd"}},
+				expected: []string{objects[1].InventoryPath},
+			},
+			{
+				tags: []DatastoreTag{{Category: "tier", Name: "silver"}},
+			},
+		}
+		for _, test := range tests {
+			filtered, err := FilterDatastoresByTags(ctx, tagManager, datastores, test.tags)
+			if err != nil {
+				t.Fatalf("failed to filter datastores by tags %v. err: %v", test.tags, err)
+			}
+			var urls []string
+			for _, datastore := range filtered {
+				urls = append(urls, datastore.Info.Url)
+			}
+			if len(urls) != len(test.expected) {
+				t.Fatalf("expected datastores %v for tags %v, got %v", test.expected, test.tags, urls)
+			}
+			for i := range urls {
+				if urls[i] != test.expected[i] {
+					t.Fatalf("expected datastores %v for tags %v, got %v", test.expected, test.tags, urls)
+				}
+			}
+		}
+
+		if _, err := FilterDatastoresByTags(ctx, tagManager, datastores,
+			[]DatastoreTag{{Category: "tier", Name: "bronze"}}); err == nil {
+			t.Errorf("error expected for an unknown tag but not received")
+		}
+	}, model)
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// ioSchedulerRegex matches the names of the I/O schedulers of the kernel,
+// such as "none", "mq-deadline" or "bfq".
+var ioSchedulerRegex = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// DeviceTuning is the tuning applied to the block device of a volume when it
+// is staged on the node. It is set with StorageClass parameters and passed to
+// the node in the volume context. Empty fields leave the device as is.
+type DeviceTuning struct {
+	// IOScheduler is the name of the I/O scheduler of the device.
+	IOScheduler string
+	// ReadAheadKB is the read-ahead of the device in KB.
+	ReadAheadKB string
+	// QueueDepth is the queue depth of the device.
+	QueueDepth string
+}
+
+// IsSet returns true if the device has to be tuned.
+func (t *DeviceTuning) IsSet() bool {
+	return t.IOScheduler != "" || t.ReadAheadKB != "" || t.QueueDepth != ""
+}
+
+// ParseDeviceTuning returns the tuning set in the volume context of a
+// volume.
+func ParseDeviceTuning(volumeContext map[string]string) (DeviceTuning, error) {
+	var tuning DeviceTuning
+	if err := parseVolumeContext(&tuning, volumeContext); err != nil {
+		return DeviceTuning{}, err
+	}
+	return tuning, nil
+}
+
+func (t *DeviceTuning) params() map[string]string {
+	return setParams(map[string]string{
+		AttributeIOScheduler: t.IOScheduler,
+		AttributeReadAheadKB: t.ReadAheadKB,
+		AttributeQueueDepth:  t.QueueDepth,
+	})
+}
+
+func (t *DeviceTuning) parseParam(param string, value string) (bool, error) {
+	switch param {
+	case AttributeIOScheduler:
+		if !ioSchedulerRegex.MatchString(value) {
+			return true, fmt.Errorf("invalid value %q for param %q", value, param)
+		}
+		t.IOScheduler = value
+	case AttributeReadAheadKB:
+		if n, err := strconv.Atoi(value); err != nil || n < 0 {
+			return true, fmt.Errorf("invalid value %q for param %q, expected a number of KB", value, param)
+		}
+		t.ReadAheadKB = value
+	case AttributeQueueDepth:
+		if n, err := strconv.Atoi(value); err != nil || n < 1 {
+			return true, fmt.Errorf("invalid value %q for param %q, expected a positive number", value, param)
+		}
+		t.QueueDepth = value
+	default:
+		return false, nil
+	}
+	return true, nil
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	cnstypes "github.com/vmware/govmomi/cns/types"
+
+	cnsvolume "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/volume"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/vsphere"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/common/utils"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
+)
+
+// DiskAdoptionError is returned when the pre-created disk a PVC references
+// with the AnnAdoptDisk annotation can't be the volume of the PVC.
+type DiskAdoptionError struct {
+	// Disk is the FCD ID or vmdk path of the disk.
+	Disk string
+	// Reason describes why the disk can't be adopted.
+	Reason string
+}
+
+func (e *DiskAdoptionError) Error() string {
+	return fmt.Sprintf("disk %q can't be adopted: %s", e.Disk, e.Reason)
+}
+
+// IsDiskURLPath returns true if the disk referenced by a PVC is the path of a
+// vmdk, such as "[vsanDatastore] volumes/disk.vmdk", instead of an FCD ID.
+func IsDiskURLPath(disk string) bool {
+	return strings.HasPrefix(disk, "[") && strings.HasSuffix(disk, ".vmdk")
+}
+
+// AdoptBlockVolumeUtil registers the pre-created FCD or vmdk as the CNS block
+// volume of the CreateVolumeSpec, unless it is already registered, and checks
+// that it can be the volume of the PVC: it has to be a block volume of at
+// least the requested capacity, on one of the datastores the volume could be
+// created on, and not in use by Kubernetes or another container cluster. A disk
+// registered by the request is unregistered again if it can't be adopted. It
+// returns the volume and its capacity in MB.
+func AdoptBlockVolumeUtil(ctx context.Context, clusterFlavor cnstypes.CnsClusterFlavor, manager *Manager,
+	spec *CreateVolumeSpec, disk string, sharedDatastores []*vsphere.DatastoreInfo) (
+	*cnsvolume.CnsVolumeInfo, int64, error) {
+	log := logger.GetLogger(ctx)
+	vc, err := GetVCenter(ctx, manager)
+	if err != nil {
+		log.Errorf("failed to get vCenter from Manager, err: %+v", err)
+		return nil, 0, err
+	}
+	containerCluster := vsphere.GetContainerCluster(manager.CnsConfig.Global.ClusterID,
+		manager.CnsConfig.VirtualCenter[vc.Config.Host].User, clusterFlavor, manager.CnsConfig.Global.ClusterDistribution)
+	createSpec := &cnstypes.CnsVolumeCreateSpec{
+		Name:       spec.Name,
+		VolumeType: spec.VolumeType,
+		Metadata: cnstypes.CnsVolumeMetadata{
+			ContainerCluster:      containerCluster,
+			ContainerClusterArray: []cnstypes.CnsContainerCluster{containerCluster},
+		},
+	}
+	if IsDiskURLPath(disk) {
+		createSpec.BackingObjectDetails = &cnstypes.CnsBlockBackingDetails{BackingDiskUrlPath: disk}
+	} else {
+		createSpec.BackingObjectDetails = &cnstypes.CnsBlockBackingDetails{BackingDiskId: disk}
+	}
+	// CNS returns the registered volume if the disk already is one, e.g. for
+	// a retry of the request.
+	volumeInfo, err := manager.VolumeManager.CreateVolume(ctx, createSpec)
+	if err != nil {
+		log.Errorf("failed to register disk %q as volume %s. err: %+v", disk, spec.Name, err)
+		return nil, 0, err
+	}
+	queryFilter := cnstypes.CnsQueryFilter{
+		VolumeIds: []cnstypes.CnsVolumeId{volumeInfo.VolumeID},
+	}
+	queryResult, err := utils.QueryVolumeUtil(ctx, manager.VolumeManager, queryFilter, utils.QuerySelection())
+	if err != nil {
+		log.Errorf("failed to query volume %q of disk %q. err: %+v", volumeInfo.VolumeID.Id, disk, err)
+		return nil, 0, err
+	}
+	if len(queryResult.Volumes) == 0 {
+		return nil, 0, fmt.Errorf("volume %q of disk %q not found in QueryVolume", volumeInfo.VolumeID.Id, disk)
+	}
+	volume := &queryResult.Volumes[0]
+	if err := validateAdoptedVolume(volume, spec, manager.CnsConfig.Global.ClusterID, sharedDatastores); err != nil {
+		// A volume named after the request was registered by it, or by an
+		// earlier try of it, so it is unregistered again, keeping the disk.
+		if volume.Name == spec.Name {
+			if deleteErr := manager.VolumeManager.DeleteVolume(ctx, volume.VolumeId.Id, false); deleteErr != nil {
+				log.Errorf("failed to unregister volume %q of disk %q. err: %+v", volume.VolumeId.Id, disk,
+					deleteErr)
+				return nil, 0, deleteErr
+			}
+			log.Infof("Unregistered volume %q of disk %q that can't be adopted", volume.VolumeId.Id, disk)
+		}
+		return nil, 0, &DiskAdoptionError{Disk: disk, Reason: err.Error()}
+	}
+	var capacityInMb int64
+	if volume.BackingObjectDetails != nil {
+		capacityInMb = volume.BackingObjectDetails.GetCnsBackingObjectDetails().CapacityInMb
+	}
+	log.Infof("Adopted disk %q as volume %q of %d MB on datastore %q", disk, volume.VolumeId.Id, capacityInMb,
+		volume.DatastoreUrl)
+	return &cnsvolume.CnsVolumeInfo{
+		DatastoreURL: volume.DatastoreUrl,
+		VolumeID:     volume.VolumeId,
+	}, capacityInMb, nil
+}
+
+// validateAdoptedVolume returns an error describing why the registered volume
+// of a pre-created disk can't be the volume of the CreateVolumeSpec.
+func validateAdoptedVolume(volume *cnstypes.CnsVolume, spec *CreateVolumeSpec, clusterID string,
+	sharedDatastores []*vsphere.DatastoreInfo) error {
+	if volume.VolumeType != spec.VolumeType {
+		return fmt.Errorf("it is a %s volume instead of a %s volume", volume.VolumeType, spec.VolumeType)
+	}
+	var capacityInMb int64
+	if volume.BackingObjectDetails != nil {
+		capacityInMb = volume.BackingObjectDetails.GetCnsBackingObjectDetails().CapacityInMb
+	}
+	if capacityInMb < spec.CapacityMB {
+		return fmt.Errorf("its capacity of %d MB is less than the requested %d MB", capacityInMb, spec.CapacityMB)
+	}
+	if spec.ScParams.DatastoreURL != "" && volume.DatastoreUrl != spec.ScParams.DatastoreURL {
+		return fmt.Errorf("it is on datastore %q instead of datastore %q of the StorageClass", volume.DatastoreUrl,
+			spec.ScParams.DatastoreURL)
+	}
+	isSharedDatastore := false
+	for _, sharedDatastore := range sharedDatastores {
+		if sharedDatastore.Info.Url == volume.DatastoreUrl {
+			isSharedDatastore = true
+			break
+		}
+	}
+	if !isSharedDatastore {
+		return fmt.Errorf("its datastore %q is not accessible to the nodes the volume can be used on",
+			volume.DatastoreUrl)
+	}
+	for _, containerCluster := range append([]cnstypes.CnsContainerCluster{volume.Metadata.ContainerCluster},
+		volume.Metadata.ContainerClusterArray...) {
+		if containerCluster.ClusterId != "" && containerCluster.ClusterId != clusterID {
+			return fmt.Errorf("it is a volume of container cluster %q", containerCluster.ClusterId)
+		}
+	}
+	for _, baseMetadata := range volume.Metadata.EntityMetadata {
+		metadata, ok := baseMetadata.(*cnstypes.CnsKubernetesEntityMetadata)
+		if !ok {
+			continue
+		}
+		if metadata.EntityType == string(cnstypes.CnsKubernetesEntityTypePVC) {
+			return fmt.Errorf("it is the volume of PVC %s/%s", metadata.Namespace, metadata.EntityName)
+		}
+		return fmt.Errorf("it is in use by %s %q", metadata.EntityType, metadata.EntityName)
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/mo"
+	vim25types "github.com/vmware/govmomi/vim25/types"
+
+	"sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/vsphere"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
+)
+
+const (
+	// DiskFormatThin is the format of thin provisioned disks.
+	DiskFormatThin = "thin"
+	// DiskFormatThick is the format of lazy zeroed thick provisioned disks.
+	DiskFormatThick = "thick"
+	// DiskFormatEagerZeroedThick is the format of eager zeroed thick provisioned disks.
+	DiskFormatEagerZeroedThick = "eagerzeroedthick"
+
+	// vmfsDatastoreType is the summary type of VMFS datastores.
+	vmfsDatastoreType = "VMFS"
+
+	// Namespace and capability of the VMFS volume allocation rule of SPBM policies.
+	volumeAllocationNamespace  = "com.vmware.storage.volumeallocation"
+	volumeAllocationCapability = "VolumeAllocationType"
+	// Namespace and capability of the vSAN object space reservation rule of SPBM policies.
+	vsanNamespace                      = "VSAN"
+	vsanProportionalCapacityCapability = "proportionalCapacity"
+	// Namespace of the tag based placement rules of SPBM policies.
+	tagNamespace = "com.vmware.storage.tag"
+)
+
+// DiskFormatError is returned when the disk format a storage policy provisions
+// is not supported by any of the datastores the volume could be placed on.
+type DiskFormatError struct {
+	// DiskFormat is the format of the disk the storage policy provisions.
+	DiskFormat string
+	// StoragePolicyID is the ID of the storage policy.
+	StoragePolicyID string
+	// SupportedTypes are the datastore types supporting the disk format.
+	SupportedTypes []string
+	// Datastores describes the URL and type of each candidate datastore.
+	Datastores []string
+}
+
+func (e *DiskFormatError) Error() string {
+	return fmt.Sprintf("storage policy %q provisions %s disks on %s datastores only, "+
+		"but the volume can only be placed on %s", e.StoragePolicyID, e.DiskFormat,
+		strings.Join(e.SupportedTypes, " or "), strings.Join(e.Datastores, ", "))
+}
+
+// policyDiskFormat returns the disk format the rules of a storage policy
+// provision and the datastore types supporting it, no types if all datastore
+// types do. The sub profiles of a policy are alternatives, so the types
+// supporting any of them are returned. It returns false if the rules of a
+// sub profile are not known, e.g. the rules of vVol storage providers, which
+// decide the disk format themselves.
+func policyDiskFormat(policy vsphere.SpbmPolicyContent) (string, []string, bool) {
+	var diskFormats, supportedTypes []string
+	for _, profile := range policy.Profiles {
+		diskFormat, types, ok := subProfileDiskFormat(profile.Rules)
+		if !ok {
+			return "", nil, false
+		}
+		if len(types) == 0 {
+			// The volume can be placed on any datastore with this sub profile.
+			return diskFormat, nil, true
+		}
+		diskFormats = appendUnique(diskFormats, diskFormat)
+		for _, dsType := range types {
+			supportedTypes = appendUnique(supportedTypes, dsType)
+		}
+	}
+	if len(diskFormats) == 0 {
+		return DiskFormatThin, nil, true
+	}
+	return strings.Join(diskFormats, " or "), supportedTypes, true
+}
+
+// subProfileDiskFormat returns the disk format the rules of a sub profile
+// provision and the datastore types supporting it, see policyDiskFormat.
+func subProfileDiskFormat(rules []vsphere.SpbmPolicyRule) (string, []string, bool) {
+	var (
+		vsanReservation bool
+		known           = true
+	)
+	for _, rule := range rules {
+		switch {
+		case rule.Ns == vsanNamespace:
+			// Thin disks are provisioned without object space reservation.
+			if rule.CapID == vsanProportionalCapacityCapability {
+				if reservation, err := strconv.Atoi(rule.Value); err == nil && reservation > 0 {
+					vsanReservation = true
+				}
+			}
+		case rule.Ns == volumeAllocationNamespace && rule.CapID == volumeAllocationCapability:
+			value := strings.ToLower(strings.NewReplacer(" ", "", "_", "").Replace(rule.Value))
+			switch value {
+			case "reservespace":
+				return DiskFormatThick, []string{vmfsDatastoreType}, true
+			case "fullyinitialized":
+				return DiskFormatEagerZeroedThick, []string{vmfsDatastoreType}, true
+			}
+			return DiskFormatThin, nil, true
+		case rule.Ns == tagNamespace:
+		default:
+			known = false
+		}
+	}
+	if vsanReservation {
+		// Object space reservation can only be satisfied by vSAN datastores.
+		return DiskFormatThick, []string{VsanDatastoreType}, true
+	}
+	return DiskFormatThin, nil, known
+}
+
+// appendUnique appends value to values unless it is already there.
+func appendUnique(values []string, value string) []string {
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
+
+// checkDiskFormat returns a DiskFormatError if none of the datastores, given
+// as a map of URL to type, supports a disk format supported on supportedTypes.
+func checkDiskFormat(storagePolicyID, diskFormat string, supportedTypes []string,
+	datastoreTypes map[string]string) error {
+	if len(supportedTypes) == 0 || len(datastoreTypes) == 0 {
+		return nil
+	}
+	var datastores []string
+	for url, dsType := range datastoreTypes {
+		for _, supportedType := range supportedTypes {
+			if strings.EqualFold(dsType, supportedType) {
+				return nil
+			}
+		}
+		datastores = append(datastores, fmt.Sprintf("%q (%s)", url, dsType))
+	}
+	sort.Strings(datastores)
+	return &DiskFormatError{
+		DiskFormat:      diskFormat,
+		StoragePolicyID: storagePolicyID,
+		SupportedTypes:  supportedTypes,
+		Datastores:      datastores,
+	}
+}
+
+// validateDiskFormat checks that the disk format of the storage policy is
+// supported by at least one of the candidate datastores, failing early with a
+// DiskFormatError instead of the CNS task failing to place the volume. When the
+// policy or the datastores can't be looked up the check is skipped, CNS still
+// reports the error if there is one.
+func validateDiskFormat(ctx context.Context, vc *vsphere.VirtualCenter, storagePolicyID string,
+	datastores []vim25types.ManagedObjectReference) error {
+	log := logger.GetLogger(ctx)
+	if storagePolicyID == "" || len(datastores) == 0 {
+		return nil
+	}
+	if err := vc.ConnectPbm(ctx); err != nil {
+		log.Warnf("Skipping disk format validation, failed to connect to PBM. err: %v", err)
+		return nil
+	}
+	policies, err := vc.PbmRetrieveContent(ctx, []string{storagePolicyID})
+	if err != nil || len(policies) == 0 {
+		log.Warnf("Skipping disk format validation, failed to retrieve content of storage policy %q. err: %v",
+			storagePolicyID, err)
+		return nil
+	}
+	diskFormat, supportedTypes, ok := policyDiskFormat(policies[0])
+	if !ok {
+		log.Infof("Skipping disk format validation, the rules of storage policy %q are not known", storagePolicyID)
+		return nil
+	}
+	if len(supportedTypes) == 0 {
+		return nil
+	}
+	var dsMos []mo.Datastore
+	pc := property.DefaultCollector(vc.Client.Client)
+	if err := pc.Retrieve(ctx, datastores, []string{"summary"}, &dsMos); err != nil {
+		log.Warnf("Skipping disk format validation, failed to retrieve types of datastores %v. err: %v",
+			datastores, err)
+		return nil
+	}
+	datastoreTypes := make(map[string]string)
+	for _, dsMo := range dsMos {
+		datastoreTypes[dsMo.Summary.Url] = dsMo.Summary.Type
+	}
+	if err := checkDiskFormat(storagePolicyID, diskFormat, supportedTypes, datastoreTypes); err != nil {
+		log.Errorf("disk format validation failed. err: %v", err)
+		return err
+	}
+	log.Debugf("Disk format %s of storage policy %q is supported by the candidate datastores",
+		diskFormat, storagePolicyID)
+	return nil
+}
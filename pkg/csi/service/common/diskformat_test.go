@@ -0,0 +1,172 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+
+	"sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/vsphere"
+)
+
+func policyWithRule(ns, capID, value string) vsphere.SpbmPolicyContent {
+	return vsphere.SpbmPolicyContent{
+		ID: "policy",
+		Profiles: []vsphere.SpbmPolicySubProfile{
+			{
+				Rules: []vsphere.SpbmPolicyRule{
+					{Ns: "VSAN", CapID: "hostFailuresToTolerate", PropID: "hostFailuresToTolerate", Value: "1"},
+					{Ns: ns, CapID: capID, PropID: capID, Value: value},
+				},
+			},
+		},
+	}
+}
+
+func policyWithSubProfiles(profiles ...vsphere.SpbmPolicyContent) vsphere.SpbmPolicyContent {
+	policy := vsphere.SpbmPolicyContent{ID: "policy"}
+	for _, p := range profiles {
+		policy.Profiles = append(policy.Profiles, p.Profiles...)
+	}
+	return policy
+}
+
+func TestPolicyDiskFormat(t *testing.T) {
+	tagRule := vsphere.SpbmPolicyContent{
+		Profiles: []vsphere.SpbmPolicySubProfile{
+			{Rules: []vsphere.SpbmPolicyRule{{Ns: tagNamespace, CapID: "gold", PropID: "com.vmware.storage.tag.gold.property", Value: "gold"}}},
+		},
+	}
+	vvolRule := vsphere.SpbmPolicyContent{
+		Profiles: []vsphere.SpbmPolicySubProfile{
+			{Rules: []vsphere.SpbmPolicyRule{{Ns: "com.example.vasa", CapID: "provisioning", PropID: "provisioning", Value: "thick"}}},
+		},
+	}
+	tests := []struct {
+		name           string
+		policy         vsphere.SpbmPolicyContent
+		diskFormat     string
+		supportedTypes []string
+		known          bool
+	}{
+		{
+			name:       "vSAN without allocation rule",
+			policy:     policyWithRule("VSAN", "stripeWidth", "1"),
+			diskFormat: DiskFormatThin,
+			known:      true,
+		},
+		{
+			name:       "VMFS thin",
+			policy:     policyWithRule(volumeAllocationNamespace, volumeAllocationCapability, "Conserve space when possible"),
+			diskFormat: DiskFormatThin,
+			known:      true,
+		},
+		{
+			name:           "VMFS thick",
+			policy:         policyWithRule(volumeAllocationNamespace, volumeAllocationCapability, "reserveSpace"),
+			diskFormat:     DiskFormatThick,
+			supportedTypes: []string{"VMFS"},
+			known:          true,
+		},
+		{
+			name:           "VMFS eager zeroed thick",
+			policy:         policyWithRule(volumeAllocationNamespace, volumeAllocationCapability, "Fully initialized"),
+			diskFormat:     DiskFormatEagerZeroedThick,
+			supportedTypes: []string{"VMFS"},
+			known:          true,
+		},
+		{
+			name:       "vSAN without space reservation",
+			policy:     policyWithRule("VSAN", "proportionalCapacity", "0"),
+			diskFormat: DiskFormatThin,
+			known:      true,
+		},
+		{
+			name:           "vSAN with space reservation",
+			policy:         policyWithRule("VSAN", "proportionalCapacity", "100"),
+			diskFormat:     DiskFormatThick,
+			supportedTypes: []string{"vsan"},
+			known:          true,
+		},
+		{
+			name:       "tag based placement",
+			policy:     tagRule,
+			diskFormat: DiskFormatThin,
+			known:      true,
+		},
+		{
+			name:   "vVol",
+			policy: vvolRule,
+		},
+		{
+			name: "vSAN or VMFS thick",
+			policy: policyWithSubProfiles(policyWithRule("VSAN", "proportionalCapacity", "100"),
+				policyWithRule(volumeAllocationNamespace, volumeAllocationCapability, "reserveSpace")),
+			diskFormat:     DiskFormatThick,
+			supportedTypes: []string{"vsan", "VMFS"},
+			known:          true,
+		},
+		{
+			name:       "vSAN or any datastore",
+			policy:     policyWithSubProfiles(policyWithRule("VSAN", "proportionalCapacity", "100"), tagRule),
+			diskFormat: DiskFormatThin,
+			known:      true,
+		},
+		{
+			name:   "vSAN or vVol",
+			policy: policyWithSubProfiles(policyWithRule("VSAN", "proportionalCapacity", "100"), vvolRule),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			diskFormat, supportedTypes, known := policyDiskFormat(test.policy)
+			if diskFormat != test.diskFormat || !reflect.DeepEqual(supportedTypes, test.supportedTypes) ||
+				known != test.known {
+				t.Errorf("expected %q on %v, known %t, got %q on %v, known %t", test.diskFormat,
+					test.supportedTypes, test.known, diskFormat, supportedTypes, known)
+			}
+		})
+	}
+}
+
+func TestCheckDiskFormat(t *testing.T) {
+	datastoreTypes := map[string]string{
+		"ds:///vmfs/volumes/nfs/":  "NFS",
+		"ds:///vmfs/volumes/vsan/": "vsan",
+	}
+	if err := checkDiskFormat("policy", DiskFormatThick, []string{"vsan"}, datastoreTypes); err != nil {
+		t.Errorf("expected thick disks to be supported by a vSAN datastore, got: %v", err)
+	}
+	if err := checkDiskFormat("policy", DiskFormatThin, nil, datastoreTypes); err != nil {
+		t.Errorf("expected thin disks to be supported by all datastores, got: %v", err)
+	}
+	err := checkDiskFormat("policy", DiskFormatEagerZeroedThick, []string{"VMFS"}, datastoreTypes)
+	var diskFormatErr *DiskFormatError
+	if !errors.As(err, &diskFormatErr) {
+		t.Fatalf("expected DiskFormatError, got: %v", err)
+	}
+	expected := []string{`"ds:///vmfs/volumes/nfs/" (NFS)`, `"ds:///vmfs/volumes/vsan/" (vsan)`}
+	if !reflect.DeepEqual(diskFormatErr.Datastores, expected) {
+		t.Errorf("expected datastores %v, got %v", expected, diskFormatErr.Datastores)
+	}
+	if code := CreateVolumeErrorCode(err); code != codes.InvalidArgument {
+		t.Errorf("expected code %v, got %v", codes.InvalidArgument, code)
+	}
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	vimtypes "github.com/vmware/govmomi/vim25/types"
+)
+
+// DiskIOAllocation is the Storage I/O Control allocation set on the virtual
+// disk of a volume when it is attached to a node VM, as FCDs have none until
+// they are attached. It is set with StorageClass parameters and passed to
+// ControllerPublishVolume in the volume context. Empty fields leave the
+// virtual disk as is.
+type DiskIOAllocation struct {
+	// Limit is the IOPS limit of the virtual disk.
+	Limit string
+	// Shares is the shares of the virtual disk, low, normal, high or a
+	// number of custom shares.
+	Shares string
+}
+
+// IsSet returns true if the allocation of the virtual disk has to be set.
+func (a *DiskIOAllocation) IsSet() bool {
+	return a.Limit != "" || a.Shares != ""
+}
+
+// StorageIOAllocationInfo returns the allocation to set on the virtual disk.
+func (a DiskIOAllocation) StorageIOAllocationInfo() *vimtypes.StorageIOAllocationInfo {
+	info := &vimtypes.StorageIOAllocationInfo{}
+	if a.Limit != "" {
+		limit, _ := strconv.ParseInt(a.Limit, 10, 64)
+		info.Limit = &limit
+	}
+	if a.Shares != "" {
+		info.Shares = &vimtypes.SharesInfo{}
+		if shares, err := strconv.ParseInt(a.Shares, 10, 32); err == nil {
+			info.Shares.Level = vimtypes.SharesLevelCustom
+			info.Shares.Shares = int32(shares)
+		} else {
+			info.Shares.Level = vimtypes.SharesLevel(strings.ToLower(a.Shares))
+		}
+	}
+	return info
+}
+
+// ParseDiskIOAllocation returns the allocation set in the volume context of a
+// volume.
+func ParseDiskIOAllocation(volumeContext map[string]string) (DiskIOAllocation, error) {
+	var allocation DiskIOAllocation
+	if err := parseVolumeContext(&allocation, volumeContext); err != nil {
+		return DiskIOAllocation{}, err
+	}
+	return allocation, nil
+}
+
+func (a *DiskIOAllocation) params() map[string]string {
+	return setParams(map[string]string{
+		AttributeIOPSLimit: a.Limit,
+		AttributeIOShares:  a.Shares,
+	})
+}
+
+func (a *DiskIOAllocation) parseParam(param string, value string) (bool, error) {
+	switch param {
+	case AttributeIOPSLimit:
+		if n, err := strconv.ParseInt(value, 10, 64); err != nil || n < 1 {
+			return true, fmt.Errorf("invalid value %q for param %q, expected a positive number of IOPS", value, param)
+		}
+		a.Limit = value
+	case AttributeIOShares:
+		switch vimtypes.SharesLevel(strings.ToLower(value)) {
+		case vimtypes.SharesLevelLow, vimtypes.SharesLevelNormal, vimtypes.SharesLevelHigh:
+		default:
+			if n, err := strconv.ParseInt(value, 10, 32); err != nil || n < 1 {
+				return true, fmt.Errorf("invalid value %q for param %q, expected low, normal, high or a positive number",
+					value, param)
+			}
+		}
+		a.Shares = value
+	default:
+		return false, nil
+	}
+	return true, nil
+}
@@ -0,0 +1,37 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common
+
+import (
+	"testing"
+
+	vimtypes "github.com/vmware/govmomi/vim25/types"
+)
+
+// TestStorageIOAllocationInfo checks the allocation set on the virtual disk
+// for limits and shares.
+func TestStorageIOAllocationInfo(t *testing.T) {
+	info := DiskIOAllocation{Limit: "1000", Shares: "2000"}.StorageIOAllocationInfo()
+	if info.Limit == nil || *info.Limit != 1000 || info.Shares == nil ||
+		info.Shares.Level != vimtypes.SharesLevelCustom || info.Shares.Shares != 2000 {
+		t.Fatalf("expected a limit of 1000 IOPS and 2000 custom shares, got %+v", info)
+	}
+	info = DiskIOAllocation{Shares: "High"}.StorageIOAllocationInfo()
+	if info.Shares == nil || info.Shares.Level != vimtypes.SharesLevelHigh || info.Limit != nil {
+		t.Fatalf("expected high shares without limit, got %+v", info)
+	}
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Types of the controllers volumes are attached to.
+const (
+	// DiskControllerPVSCSI attaches volumes to paravirtual SCSI controllers.
+	DiskControllerPVSCSI = "pvscsi"
+	// DiskControllerNVMe attaches volumes to NVMe controllers.
+	DiskControllerNVMe = "nvme"
+)
+
+// Policies distributing the volumes across the controllers of a node VM.
+const (
+	// DiskPlacementFill attaches volumes to the first controller with a free
+	// unit, adding a controller once all of them are full.
+	DiskPlacementFill = "fill"
+	// DiskPlacementSpread attaches volumes to the controller with the fewest
+	// disks, adding a controller while the VM supports more, so that volumes
+	// get their own controller queue.
+	DiskPlacementSpread = "spread"
+)
+
+// DiskPlacement is the type of the controllers the virtual disk of a volume
+// is attached to on a node VM and how disks are distributed across them. It
+// is set with StorageClass parameters, or defaults of the config, and passed
+// to ControllerPublishVolume in the volume context. Empty fields leave the
+// placement to CNS, which attaches volumes to paravirtual SCSI controllers.
+type DiskPlacement struct {
+	// ControllerType is the type of the controllers, pvscsi or nvme.
+	ControllerType string
+	// Policy is how disks are distributed across the controllers, fill or
+	// spread.
+	Policy string
+}
+
+// NewDiskPlacement returns the placement with the given controller type and
+// policy, which may be empty.
+func NewDiskPlacement(controllerType string, policy string) (DiskPlacement, error) {
+	var placement DiskPlacement
+	if controllerType != "" {
+		if _, err := placement.parseParam(AttributeDiskControllerType, controllerType); err != nil {
+			return DiskPlacement{}, err
+		}
+	}
+	if policy != "" {
+		if _, err := placement.parseParam(AttributeDiskPlacementPolicy, policy); err != nil {
+			return DiskPlacement{}, err
+		}
+	}
+	return placement, nil
+}
+
+// IsSet returns true if the placement of the virtual disk differs from the
+// one of CNS, filling paravirtual SCSI controllers.
+func (p *DiskPlacement) IsSet() bool {
+	return (p.ControllerType != "" && p.ControllerType != DiskControllerPVSCSI) ||
+		(p.Policy != "" && p.Policy != DiskPlacementFill)
+}
+
+// WithDefaults returns the placement with its empty fields set from defaults.
+func (p DiskPlacement) WithDefaults(defaults DiskPlacement) DiskPlacement {
+	if p.ControllerType == "" {
+		p.ControllerType = defaults.ControllerType
+	}
+	if p.Policy == "" {
+		p.Policy = defaults.Policy
+	}
+	return p
+}
+
+// ParseDiskPlacement returns the placement set in the volume context of a
+// volume.
+func ParseDiskPlacement(volumeContext map[string]string) (DiskPlacement, error) {
+	var placement DiskPlacement
+	if err := parseVolumeContext(&placement, volumeContext); err != nil {
+		return DiskPlacement{}, err
+	}
+	return placement, nil
+}
+
+func (p *DiskPlacement) params() map[string]string {
+	return setParams(map[string]string{
+		AttributeDiskControllerType:  p.ControllerType,
+		AttributeDiskPlacementPolicy: p.Policy,
+	})
+}
+
+func (p *DiskPlacement) parseParam(param string, value string) (bool, error) {
+	switch param {
+	case AttributeDiskControllerType:
+		switch value = strings.ToLower(value); value {
+		case DiskControllerPVSCSI, DiskControllerNVMe:
+		default:
+			return true, fmt.Errorf("invalid value %q for param %q, expected %s or %s", value, param,
+				DiskControllerPVSCSI, DiskControllerNVMe)
+		}
+		p.ControllerType = value
+	case AttributeDiskPlacementPolicy:
+		switch value = strings.ToLower(value); value {
+		case DiskPlacementFill, DiskPlacementSpread:
+		default:
+			return true, fmt.Errorf("invalid value %q for param %q, expected %s or %s", value, param,
+				DiskPlacementFill, DiskPlacementSpread)
+		}
+		p.Policy = value
+	default:
+		return false, nil
+	}
+	return true, nil
+}
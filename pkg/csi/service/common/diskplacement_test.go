@@ -0,0 +1,41 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common
+
+import (
+	"testing"
+)
+
+// TestDiskPlacementDefaults checks that the defaults fill the fields of the
+// placement left empty, and that the placement of CNS is unset.
+func TestDiskPlacementDefaults(t *testing.T) {
+	placement := DiskPlacement{ControllerType: DiskControllerNVMe}
+	defaults, err := NewDiskPlacement("", "spread")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if placement = placement.WithDefaults(defaults); placement.ControllerType != DiskControllerNVMe ||
+		placement.Policy != DiskPlacementSpread {
+		t.Fatalf("expected nvme controllers with spread policy, got %+v", placement)
+	}
+	if placement, _ = NewDiskPlacement("pvscsi", "fill"); placement.IsSet() {
+		t.Fatalf("expected the placement of CNS to be unset, got %+v", placement)
+	}
+	if _, err := NewDiskPlacement("lsilogic", ""); err == nil {
+		t.Fatal("expected an error for an unsupported controller type")
+	}
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common
+
+import (
+	"context"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+
+	cnsconfig "sigs.k8s.io/vsphere-csi-driver/pkg/common/config"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
+	k8s "sigs.k8s.io/vsphere-csi-driver/pkg/kubernetes"
+)
+
+const (
+	// controllerLeaseName is the name of the lease electing the replica of the
+	// controller running its background work.
+	controllerLeaseName = "vsphere-csi-controller"
+	// The lease timings are the defaults of the sidecars of the controller.
+	controllerLeaseDuration = 15 * time.Second
+	controllerRenewDeadline = 10 * time.Second
+	controllerRetryPeriod   = 5 * time.Second
+)
+
+// LeaderGate tells whether this replica of the controller is the leader.
+// CSI calls are served by every replica, as the sidecars only send them to
+// their leader, but the background work of the controller, such as force
+// detaching volumes from lost nodes or cleaning up stale operation details,
+// must only run on one replica.
+type LeaderGate struct {
+	leader int32
+}
+
+// IsLeader returns true if this replica currently holds the lease. It can be
+// called on a nil LeaderGate, which is always the leader.
+func (g *LeaderGate) IsLeader() bool {
+	return g == nil || atomic.LoadInt32(&g.leader) == 1
+}
+
+// StartLeaderElection campaigns for the controller lease in the namespace of
+// CSI_NAMESPACE, with the pod name as identity, and returns the LeaderGate
+// following its result. The replica campaigns again after losing the lease.
+func StartLeaderElection(ctx context.Context) (*LeaderGate, error) {
+	log := logger.GetLogger(ctx)
+	namespace := os.Getenv(cnsconfig.EnvCSINamespace)
+	if namespace == "" {
+		namespace = cnsconfig.DefaultCSINamespace
+	}
+	identity, err := os.Hostname()
+	if err != nil {
+		log.Errorf("failed to get hostname for the controller lease. Err: %v", err)
+		return nil, err
+	}
+	k8sClient, err := k8s.NewClient(ctx)
+	if err != nil {
+		log.Errorf("failed to create Kubernetes client. Err: %v", err)
+		return nil, err
+	}
+	lock, err := resourcelock.New(resourcelock.LeasesResourceLock, namespace, controllerLeaseName,
+		k8sClient.CoreV1(), k8sClient.CoordinationV1(), resourcelock.ResourceLockConfig{Identity: identity})
+	if err != nil {
+		log.Errorf("failed to create the controller lease lock. Err: %v", err)
+		return nil, err
+	}
+	g := &LeaderGate{}
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		LeaseDuration:   controllerLeaseDuration,
+		RenewDeadline:   controllerRenewDeadline,
+		RetryPeriod:     controllerRetryPeriod,
+		ReleaseOnCancel: true,
+		Name:            controllerLeaseName,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(context.Context) {
+				log.Infof("%s became the leader of lease %s/%s", identity, namespace, controllerLeaseName)
+				atomic.StoreInt32(&g.leader, 1)
+			},
+			OnStoppedLeading: func() {
+				log.Infof("%s stopped leading lease %s/%s", identity, namespace, controllerLeaseName)
+				atomic.StoreInt32(&g.leader, 0)
+			},
+		},
+	})
+	if err != nil {
+		log.Errorf("failed to create the controller leader elector. Err: %v", err)
+		return nil, err
+	}
+	go func() {
+		// Run returns when the lease is lost, campaign again.
+		for ctx.Err() == nil {
+			elector.Run(ctx)
+		}
+	}()
+	return g, nil
+}
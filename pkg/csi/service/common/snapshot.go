@@ -0,0 +1,249 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	cnstypes "github.com/vmware/govmomi/cns/types"
+	vim25types "github.com/vmware/govmomi/vim25/types"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	cnsvolume "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/volume"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/vsphere"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/common/utils"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
+)
+
+// snapshotIDSeparator separates the volume ID and the FCD snapshot ID in the
+// IDs of CSI snapshots. FCD snapshot IDs are only unique per FCD, and the
+// vCenter APIs deleting them take the FCD.
+const snapshotIDSeparator = "+"
+
+// NewSnapshotID returns the ID of the CSI snapshot of the FCD snapshot
+// snapshotID of the volume.
+func NewSnapshotID(volumeID string, snapshotID string) string {
+	return volumeID + snapshotIDSeparator + snapshotID
+}
+
+// ParseSnapshotID returns the volume ID and the FCD snapshot ID of the ID of a
+// CSI snapshot.
+func ParseSnapshotID(id string) (string, string, error) {
+	parts := strings.Split(id, snapshotIDSeparator)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid snapshot ID %q", id)
+	}
+	return parts[0], parts[1], nil
+}
+
+// ValidateCreateSnapshotRequest is the helper function to validate
+// CreateSnapshotRequest for all block controllers.
+// Function returns error if validation fails otherwise returns nil.
+func ValidateCreateSnapshotRequest(ctx context.Context, req *csi.CreateSnapshotRequest) error {
+	log := logger.GetLogger(ctx)
+	if len(req.GetName()) == 0 {
+		msg := "snapshot name is a required parameter"
+		log.Error(msg)
+		return status.Error(codes.InvalidArgument, msg)
+	}
+	if len(req.GetSourceVolumeId()) == 0 {
+		msg := "source volume id is a required parameter"
+		log.Error(msg)
+		return status.Error(codes.InvalidArgument, msg)
+	}
+	if strings.Contains(req.GetSourceVolumeId(), ".vmdk") {
+		msg := fmt.Sprintf("snapshots of in-tree volume %q are not supported", req.GetSourceVolumeId())
+		log.Error(msg)
+		return status.Error(codes.InvalidArgument, msg)
+	}
+	return nil
+}
+
+// ValidateDeleteSnapshotRequest is the helper function to validate
+// DeleteSnapshotRequest for all block controllers.
+// Function returns error if validation fails otherwise returns nil.
+func ValidateDeleteSnapshotRequest(ctx context.Context, req *csi.DeleteSnapshotRequest) error {
+	log := logger.GetLogger(ctx)
+	if len(req.GetSnapshotId()) == 0 {
+		msg := "snapshot id is a required parameter"
+		log.Error(msg)
+		return status.Error(codes.InvalidArgument, msg)
+	}
+	return nil
+}
+
+// SnapshotNotFoundError is returned when the snapshot a volume is restored
+// from doesn't exist.
+type SnapshotNotFoundError struct {
+	SnapshotID string
+}
+
+func (e *SnapshotNotFoundError) Error() string {
+	return fmt.Sprintf("snapshot %q not found", e.SnapshotID)
+}
+
+// SnapshotRestoreError is returned when a volume can't be restored from a
+// snapshot with the parameters of the request.
+type SnapshotRestoreError struct {
+	SnapshotID string
+	Reason     string
+}
+
+func (e *SnapshotRestoreError) Error() string {
+	return fmt.Sprintf("volume can't be restored from snapshot %q: %s", e.SnapshotID, e.Reason)
+}
+
+// SnapshotSizeError is returned when the requested size of a volume restored
+// from a snapshot is smaller than the snapshot, or its limit is.
+type SnapshotSizeError struct {
+	SnapshotID      string
+	SnapshotSizeMB  int64
+	RequestedSizeMB int64
+}
+
+func (e *SnapshotSizeError) Error() string {
+	return fmt.Sprintf("requested size %d Mb of the volume is smaller than the size %d Mb of snapshot %q",
+		e.RequestedSizeMB, e.SnapshotSizeMB, e.SnapshotID)
+}
+
+// RestoreBlockVolumeUtil creates the CNS block volume of the CreateVolumeSpec
+// from the snapshot with the given CSI snapshot ID. The volume has the size of
+// the snapshot if the spec has no capacity, and can't be smaller, nor can the
+// limit of its size in MB unless it is 0. It is
+// created on the datastore of the snapshot, which has to be one of the
+// datastores the volume could be created on. It returns the volume and its
+// capacity in MB.
+func RestoreBlockVolumeUtil(ctx context.Context, clusterFlavor cnstypes.CnsClusterFlavor, manager *Manager,
+	spec *CreateVolumeSpec, snapshotID string, limitMB int64, sharedDatastores []*vsphere.DatastoreInfo) (
+	*cnsvolume.CnsVolumeInfo, int64, error) {
+	log := logger.GetLogger(ctx)
+	sourceVolumeID, fcdSnapshotID, err := ParseSnapshotID(snapshotID)
+	if err != nil {
+		return nil, 0, &SnapshotNotFoundError{SnapshotID: snapshotID}
+	}
+	queryFilter := cnstypes.CnsQueryFilter{
+		VolumeIds: []cnstypes.CnsVolumeId{{Id: sourceVolumeID}},
+	}
+	queryResult, err := utils.QueryVolumeUtil(ctx, manager.VolumeManager, queryFilter, utils.QuerySelection())
+	if err != nil {
+		log.Errorf("failed to query volume %q of snapshot %q. err: %+v", sourceVolumeID, snapshotID, err)
+		return nil, 0, err
+	}
+	if len(queryResult.Volumes) == 0 || queryResult.Volumes[0].VolumeType != BlockVolumeType {
+		return nil, 0, &SnapshotNotFoundError{SnapshotID: snapshotID}
+	}
+	sourceVolume := queryResult.Volumes[0]
+	snapshots, err := manager.VolumeManager.QuerySnapshots(ctx, sourceVolumeID)
+	if err != nil {
+		log.Errorf("failed to query the snapshots of volume %q. err: %+v", sourceVolumeID, err)
+		return nil, 0, err
+	}
+	var snapshot *cnsvolume.CnsSnapshotInfo
+	for i := range snapshots {
+		if snapshots[i].SnapshotID == fcdSnapshotID {
+			snapshot = &snapshots[i]
+			break
+		}
+	}
+	if snapshot == nil {
+		return nil, 0, &SnapshotNotFoundError{SnapshotID: snapshotID}
+	}
+	snapshotSizeMB := snapshot.CapacityInMb
+	if snapshotSizeMB == 0 && spec.CapacityMB == 0 {
+		// vCenter doesn't report the capacity of the snapshot, the volume has
+		// the capacity of its source, which the snapshot isn't larger than.
+		if sourceVolume.BackingObjectDetails != nil {
+			spec.CapacityMB = sourceVolume.BackingObjectDetails.GetCnsBackingObjectDetails().CapacityInMb
+		}
+		log.Infof("Capacity of snapshot %q is not known, restoring a volume of %d MB", snapshotID,
+			spec.CapacityMB)
+	}
+	if limitMB != 0 && limitMB < snapshotSizeMB {
+		return nil, 0, &SnapshotSizeError{SnapshotID: snapshotID, SnapshotSizeMB: snapshotSizeMB,
+			RequestedSizeMB: limitMB}
+	}
+	if spec.CapacityMB == 0 {
+		spec.CapacityMB = snapshotSizeMB
+	} else if spec.CapacityMB < snapshotSizeMB {
+		return nil, 0, &SnapshotSizeError{SnapshotID: snapshotID, SnapshotSizeMB: snapshotSizeMB,
+			RequestedSizeMB: spec.CapacityMB}
+	}
+	if spec.ScParams.DatastoreURL != "" && sourceVolume.DatastoreUrl != spec.ScParams.DatastoreURL {
+		return nil, 0, &SnapshotRestoreError{SnapshotID: snapshotID, Reason: fmt.Sprintf(
+			"it is on datastore %q instead of datastore %q of the StorageClass", sourceVolume.DatastoreUrl,
+			spec.ScParams.DatastoreURL)}
+	}
+	isSharedDatastore := false
+	for _, sharedDatastore := range sharedDatastores {
+		if sharedDatastore.Info.Url == sourceVolume.DatastoreUrl {
+			isSharedDatastore = true
+			break
+		}
+	}
+	if !isSharedDatastore {
+		return nil, 0, &SnapshotRestoreError{SnapshotID: snapshotID, Reason: fmt.Sprintf(
+			"its datastore %q is not accessible to the nodes the volume can be used on", sourceVolume.DatastoreUrl)}
+	}
+	vc, err := GetVCenter(ctx, manager)
+	if err != nil {
+		log.Errorf("failed to get vCenter from Manager, err: %+v", err)
+		return nil, 0, err
+	}
+	if spec.ScParams.StoragePolicyName != "" {
+		spec.StoragePolicyID, err = vc.GetStoragePolicyIDByName(ctx, spec.ScParams.StoragePolicyName)
+		if err != nil {
+			log.Errorf("Error occurred while getting Profile Id from Profile Name: %s, err: %+v",
+				spec.ScParams.StoragePolicyName, err)
+			return nil, 0, err
+		}
+	}
+	containerCluster := vsphere.GetContainerCluster(manager.CnsConfig.Global.ClusterID,
+		manager.CnsConfig.VirtualCenter[vc.Config.Host].User, clusterFlavor, manager.CnsConfig.Global.ClusterDistribution)
+	createSpec := &cnstypes.CnsVolumeCreateSpec{
+		Name:       spec.Name,
+		VolumeType: spec.VolumeType,
+		BackingObjectDetails: &cnstypes.CnsBlockBackingDetails{
+			CnsBackingObjectDetails: cnstypes.CnsBackingObjectDetails{
+				CapacityInMb: spec.CapacityMB,
+			},
+		},
+		Metadata: cnstypes.CnsVolumeMetadata{
+			ContainerCluster:      containerCluster,
+			ContainerClusterArray: []cnstypes.CnsContainerCluster{containerCluster},
+		},
+	}
+	if spec.StoragePolicyID != "" {
+		createSpec.Profile = append(createSpec.Profile, &vim25types.VirtualMachineDefinedProfileSpec{
+			ProfileId: spec.StoragePolicyID,
+		})
+	}
+	volumeInfo, err := manager.VolumeManager.CreateVolumeFromSnapshot(ctx, createSpec, sourceVolumeID, fcdSnapshotID)
+	if err != nil {
+		log.Errorf("failed to create volume %s from snapshot %q. err: %+v", spec.Name, snapshotID, err)
+		invalidateStoragePolicyID(ctx, vc, spec, err)
+		return nil, 0, err
+	}
+	log.Infof("Restored volume %q of %d MB from snapshot %q", volumeInfo.VolumeID.Id, spec.CapacityMB, snapshotID)
+	return &cnsvolume.CnsVolumeInfo{
+		DatastoreURL: sourceVolume.DatastoreUrl,
+		VolumeID:     volumeInfo.VolumeID,
+	}, spec.CapacityMB, nil
+}
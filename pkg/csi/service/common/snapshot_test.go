@@ -0,0 +1,31 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common
+
+import "testing"
+
+func TestParseSnapshotID(t *testing.T) {
+	volumeID, snapshotID, err := ParseSnapshotID(NewSnapshotID("vol-1", "snap-1"))
+	if err != nil || volumeID != "vol-1" || snapshotID != "snap-1" {
+		t.Errorf("expected vol-1 and snap-1, got %q, %q, %v", volumeID, snapshotID, err)
+	}
+	for _, id := range []string{"", "vol-1", "vol-1+", "+snap-1", "vol-1+snap-1+snap-2"} {
+		if _, _, err := ParseSnapshotID(id); err == nil {
+			t.Errorf("expected snapshot ID %q to be invalid", id)
+		}
+	}
+}
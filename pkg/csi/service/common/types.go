@@ -77,8 +77,27 @@ type CreateVolumeSpec struct {
 
 // StorageClassParams represents the storage class parameterss
 type StorageClassParams struct {
-	DatastoreURL      string
-	StoragePolicyName string
-	CSIMigration      string
-	Datastore         string
+	DatastoreURL       string
+	StoragePolicyName  string
+	CSIMigration       string
+	Datastore          string
+	VolumeNameTemplate string
+	// OfflineExpansionOnly restricts expansion of volumes to when they are detached
+	OfflineExpansionOnly bool
+	// AllowDiskAdoption lets PVCs adopt pre-created disks with the AnnAdoptDisk annotation
+	AllowDiskAdoption bool
+	// DatastoreTags restricts the datastores volumes are placed on to those carrying all the tags
+	DatastoreTags []DatastoreTag
+	// VCenter is the host of the vCenter volumes are provisioned in, when several are configured
+	VCenter string
+	// DeviceTuning is applied to the block device of volumes on the node
+	DeviceTuning DeviceTuning
+	// DiskIOAllocation is set on the virtual disk of volumes when they are attached
+	DiskIOAllocation DiskIOAllocation
+	// DiskPlacement selects the controllers of the node VM volumes are attached to
+	DiskPlacement DiskPlacement
+	// PVC and PV metadata passed by the external-provisioner
+	PVCName      string
+	PVCNamespace string
+	PVName       string
 }
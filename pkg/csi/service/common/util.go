@@ -214,6 +214,32 @@ func ParseStorageClassParams(ctx context.Context, params map[string]string, csiM
 				scParams.StoragePolicyName = value
 			} else if param == AttributeFsType {
 				log.Warnf("param 'fstype' is deprecated, please use 'csi.storage.k8s.io/fstype' instead")
+			} else if param == AttributeOfflineExpansionOnly {
+				offlineExpansionOnly, err := strconv.ParseBool(value)
+				if err != nil {
+					return nil, fmt.Errorf("invalid value %q for param %q: %v", value, param, err)
+				}
+				scParams.OfflineExpansionOnly = offlineExpansionOnly
+			} else if param == AttributeAllowDiskAdoption {
+				allowDiskAdoption, err := strconv.ParseBool(value)
+				if err != nil {
+					return nil, fmt.Errorf("invalid value %q for param %q: %v", value, param, err)
+				}
+				scParams.AllowDiskAdoption = allowDiskAdoption
+			} else if param == AttributeDatastoreTags {
+				datastoreTags, err := ParseDatastoreTags(value)
+				if err != nil {
+					return nil, fmt.Errorf("invalid value %q for param %q: %v", value, param, err)
+				}
+				scParams.DatastoreTags = datastoreTags
+			} else if param == AttributeVCenter {
+				scParams.VCenter = value
+			} else if ok, err := parseVolumeContextParam(scParams, param, value); ok || err != nil {
+				if err != nil {
+					return nil, err
+				}
+			} else if parseVolumeNameParam(scParams, param, value) {
+				continue
 			} else {
 				return nil, fmt.Errorf("invalid param: %q and value: %q", param, value)
 			}
@@ -230,6 +256,32 @@ func ParseStorageClassParams(ctx context.Context, params map[string]string, csiM
 				log.Warnf("param 'fstype' is deprecated, please use 'csi.storage.k8s.io/fstype' instead")
 			} else if param == CSIMigrationParams {
 				scParams.CSIMigration = value
+			} else if param == AttributeOfflineExpansionOnly {
+				offlineExpansionOnly, err := strconv.ParseBool(value)
+				if err != nil {
+					return nil, fmt.Errorf("invalid value %q for param %q: %v", value, param, err)
+				}
+				scParams.OfflineExpansionOnly = offlineExpansionOnly
+			} else if param == AttributeAllowDiskAdoption {
+				allowDiskAdoption, err := strconv.ParseBool(value)
+				if err != nil {
+					return nil, fmt.Errorf("invalid value %q for param %q: %v", value, param, err)
+				}
+				scParams.AllowDiskAdoption = allowDiskAdoption
+			} else if param == AttributeDatastoreTags {
+				datastoreTags, err := ParseDatastoreTags(value)
+				if err != nil {
+					return nil, fmt.Errorf("invalid value %q for param %q: %v", value, param, err)
+				}
+				scParams.DatastoreTags = datastoreTags
+			} else if param == AttributeVCenter {
+				scParams.VCenter = value
+			} else if ok, err := parseVolumeContextParam(scParams, param, value); ok || err != nil {
+				if err != nil {
+					return nil, err
+				}
+			} else if parseVolumeNameParam(scParams, param, value) {
+				continue
 			} else {
 				otherParams[param] = value
 			}
@@ -257,9 +309,30 @@ func ParseStorageClassParams(ctx context.Context, params map[string]string, csiM
 			}
 		}
 	}
+	if len(scParams.DatastoreTags) != 0 && (scParams.DatastoreURL != "" || scParams.Datastore != "") {
+		return nil, fmt.Errorf("param %q can't be used with a datastore URL or name", AttributeDatastoreTags)
+	}
 	return scParams, nil
 }
 
+// parseVolumeNameParam sets the field of scParams for the volume name template
+// or PVC metadata param, and reports whether param is one of them.
+func parseVolumeNameParam(scParams *StorageClassParams, param string, value string) bool {
+	switch param {
+	case AttributeVolumeNameTemplate:
+		scParams.VolumeNameTemplate = value
+	case AttributePVCName:
+		scParams.PVCName = value
+	case AttributePVCNamespace:
+		scParams.PVCNamespace = value
+	case AttributePVName:
+		scParams.PVName = value
+	default:
+		return false
+	}
+	return true
+}
+
 // GetConfigPath returns ConfigPath depending on the environment variable specified and the cluster flavor set
 func GetConfigPath(ctx context.Context) string {
 	var cfgPath string
@@ -357,3 +430,28 @@ func ConvertVolumeHealthStatus(volHealthStatus string) (string, error) {
 		return VolHealthStatusInaccessible, nil
 	}
 }
+
+// GetVolumeCondition returns the CSI condition of a volume with the CNS
+// health status volHealthStatus. The volume is abnormal when it is
+// inaccessible, as for the health annotation of its PVC. vCenters that don't
+// report the health of volumes return an empty health status, treated as
+// unknown.
+func GetVolumeCondition(volHealthStatus string) *csi.VolumeCondition {
+	healthStatus, _ := ConvertVolumeHealthStatus(volHealthStatus)
+	switch healthStatus {
+	case VolHealthStatusAccessible:
+		return &csi.VolumeCondition{
+			Message: fmt.Sprintf("volume is accessible, its health status is %q", volHealthStatus),
+		}
+	case string(pbmtypes.PbmHealthStatusForEntityUnknown):
+		return &csi.VolumeCondition{Message: "health status of the volume is unknown"}
+	default:
+		if volHealthStatus == "" {
+			return &csi.VolumeCondition{Message: "health status of the volume is not reported"}
+		}
+		return &csi.VolumeCondition{
+			Abnormal: true,
+			Message:  fmt.Sprintf("volume is inaccessible, its health status is %q", volHealthStatus),
+		}
+	}
+}
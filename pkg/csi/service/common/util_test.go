@@ -18,6 +18,7 @@ package common
 
 import (
 	"context"
+	"reflect"
 	"testing"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
@@ -390,3 +391,100 @@ func TestParseStorageClassParamsWithMigrationDisabled(t *testing.T) {
 	}
 	t.Logf("expected err received. err: %v", err)
 }
+
+func TestParseStorageClassParamsWithVolumeNameTemplate(t *testing.T) {
+	params := map[string]string{
+		AttributeVolumeNameTemplate: "${pvc.namespace}-${pvc.name}",
+		AttributePVCName:            "pvc1",
+		AttributePVCNamespace:       "ns1",
+		AttributePVName:             "pvc-1",
+	}
+	for _, csiMigrationFeatureState := range []bool{false, true} {
+		scParams, err := ParseStorageClassParams(ctx, params, csiMigrationFeatureState)
+		if err != nil {
+			t.Fatalf("failed to parse params: %+v. err: %v", params, err)
+		}
+		if scParams.VolumeNameTemplate != params[AttributeVolumeNameTemplate] || scParams.PVCName != "pvc1" ||
+			scParams.PVCNamespace != "ns1" || scParams.PVName != "pvc-1" {
+			t.Errorf("unexpected scParams: %+v", scParams)
+		}
+	}
+}
+
+func TestParseStorageClassParamsWithOfflineExpansionOnly(t *testing.T) {
+	params := map[string]string{
+		AttributeOfflineExpansionOnly: "true",
+	}
+	scParams, err := ParseStorageClassParams(ctx, params, false)
+	if err != nil {
+		t.Fatalf("failed to parse params: %+v. err: %v", params, err)
+	}
+	if !scParams.OfflineExpansionOnly {
+		t.Errorf("expected OfflineExpansionOnly to be set, scParams: %+v", scParams)
+	}
+	params[AttributeOfflineExpansionOnly] = "sometimes"
+	if scParams, err = ParseStorageClassParams(ctx, params, true); err == nil {
+		t.Errorf("error expected but not received. scParams: %+v", scParams)
+	}
+}
+
+func TestParseStorageClassParamsWithAllowDiskAdoption(t *testing.T) {
+	params := map[string]string{
+		AttributeAllowDiskAdoption: "true",
+	}
+	for _, csiMigration := range []bool{false, true} {
+		scParams, err := ParseStorageClassParams(ctx, params, csiMigration)
+		if err != nil {
+			t.Fatalf("failed to parse params: %+v. err: %v", params, err)
+		}
+		if !scParams.AllowDiskAdoption {
+			t.Errorf("expected AllowDiskAdoption to be set, scParams: %+v", scParams)
+		}
+	}
+	params[AttributeAllowDiskAdoption] = "maybe"
+	if scParams, err := ParseStorageClassParams(ctx, params, false); err == nil {
+		t.Errorf("error expected but not received. scParams: %+v", scParams)
+	}
+}
+
+func TestParseStorageClassParamsWithDatastoreTags(t *testing.T) {
+	params := map[string]string{
+		AttributeDatastoreTags: "tier:gold, ssd",
+	}
+	scParams, err := ParseStorageClassParams(ctx, params, false)
+	if err != nil {
+		t.Fatalf("failed to parse params: %+v. err: %v", params, err)
+	}
+	expected := []DatastoreTag{{Category: "tier", Name: "gold"}, {Name: "ssd"}}
+	if !reflect.DeepEqual(scParams.DatastoreTags, expected) {
+		t.Errorf("expected DatastoreTags %v, got %v", expected, scParams.DatastoreTags)
+	}
+	for _, value := range []string{"", ",", "tier:", ":gold"} {
+		params[AttributeDatastoreTags] = value
+		if scParams, err = ParseStorageClassParams(ctx, params, false); err == nil {
+			t.Errorf("error expected for %q but not received. scParams: %+v", value, scParams)
+		}
+	}
+	params = map[string]string{
+		AttributeDatastoreTags: "tier:gold",
+		AttributeDatastoreURL:  "ds:///vmfs/volumes/vsan:52cdfa80721ff516-ea1e993113acfc77/",
+	}
+	if scParams, err = ParseStorageClassParams(ctx, params, true); err == nil {
+		t.Errorf("error expected but not received. scParams: %+v", scParams)
+	}
+}
+
+func TestParseStorageClassParamsWithVCenter(t *testing.T) {
+	params := map[string]string{
+		"VCenter": "vc2.example.com",
+	}
+	for _, csiMigrationFeatureState := range []bool{false, true} {
+		scParams, err := ParseStorageClassParams(ctx, params, csiMigrationFeatureState)
+		if err != nil {
+			t.Fatalf("failed to parse params: %+v. err: %v", params, err)
+		}
+		if scParams.VCenter != "vc2.example.com" {
+			t.Errorf("expected VCenter %q, got %q", "vc2.example.com", scParams.VCenter)
+		}
+	}
+}
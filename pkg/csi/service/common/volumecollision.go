@@ -0,0 +1,131 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	cnstypes "github.com/vmware/govmomi/cns/types"
+
+	cnsvolume "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/volume"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/common/utils"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
+)
+
+// VolumeNameCollisionError is returned when the name of a volume to create is
+// already used by CNS volumes of the cluster with a different backing, e.g.
+// created by another Kubernetes cluster configured with the same cluster-id.
+type VolumeNameCollisionError struct {
+	// Name is the name of the volume to create.
+	Name string
+	// Conflicts describes each existing volume and how it differs.
+	Conflicts []string
+}
+
+func (e *VolumeNameCollisionError) Error() string {
+	return fmt.Sprintf("CNS volume name %q is already used with a different backing: %s",
+		e.Name, strings.Join(e.Conflicts, "; "))
+}
+
+// findExistingVolume looks up the CNS volumes of the cluster with the name of
+// createSpec. It returns the volume a previous attempt of the same request
+// created, which is adopted instead of creating another one, or nil if there
+// is none. If volumes with the name exist but none of them matches the
+// request, a VolumeNameCollisionError is returned.
+func findExistingVolume(ctx context.Context, manager *Manager, createSpec *cnstypes.CnsVolumeCreateSpec,
+	spec *CreateVolumeSpec, datastoreURL string) (*cnsvolume.CnsVolumeInfo, error) {
+	log := logger.GetLogger(ctx)
+	// The volume manager truncates names CNS can't store the same way.
+	name := createSpec.Name
+	if len(name) > maxVolumeNameLength {
+		name = name[0 : maxVolumeNameLength-1]
+	}
+	queryFilter := cnstypes.CnsQueryFilter{
+		Names:               []string{name},
+		ContainerClusterIds: []string{createSpec.Metadata.ContainerCluster.ClusterId},
+	}
+	// The PVC of the volumes is compared too, which needs their metadata.
+	queryResult, err := utils.QueryVolumeUtil(ctx, manager.VolumeManager, queryFilter,
+		utils.VolumeMetadataQuerySelection())
+	if err != nil {
+		log.Errorf("failed to query volumes named %q. err: %v", name, err)
+		return nil, err
+	}
+	var conflicts []string
+	for i := range queryResult.Volumes {
+		volume := &queryResult.Volumes[i]
+		if volume.Name != name {
+			continue
+		}
+		mismatches := volumeMismatches(volume, createSpec, spec, datastoreURL)
+		if len(mismatches) == 0 {
+			log.Infof("Volume %q already exists with ID %q on datastore %q, reusing it",
+				name, volume.VolumeId.Id, volume.DatastoreUrl)
+			return &cnsvolume.CnsVolumeInfo{
+				DatastoreURL: volume.DatastoreUrl,
+				VolumeID:     volume.VolumeId,
+			}, nil
+		}
+		conflict := fmt.Sprintf("volume %q on datastore %q has %s", volume.VolumeId.Id, volume.DatastoreUrl,
+			strings.Join(mismatches, ", "))
+		log.Warnf("Volume name collision for %q: %s", name, conflict)
+		conflicts = append(conflicts, conflict)
+	}
+	if len(conflicts) != 0 {
+		return nil, &VolumeNameCollisionError{Name: name, Conflicts: conflicts}
+	}
+	return nil, nil
+}
+
+// volumeMismatches returns how an existing volume differs from the volume to
+// create, or nothing if the volume could have been created by the request.
+func volumeMismatches(volume *cnstypes.CnsVolume, createSpec *cnstypes.CnsVolumeCreateSpec,
+	spec *CreateVolumeSpec, datastoreURL string) []string {
+	var mismatches []string
+	if volume.VolumeType != createSpec.VolumeType {
+		mismatches = append(mismatches, fmt.Sprintf("volume type %q instead of %q", volume.VolumeType, createSpec.VolumeType))
+	}
+	if volume.BackingObjectDetails != nil {
+		if capacity := volume.BackingObjectDetails.GetCnsBackingObjectDetails().CapacityInMb; capacity != spec.CapacityMB {
+			mismatches = append(mismatches, fmt.Sprintf("capacity %d MB instead of %d MB", capacity, spec.CapacityMB))
+		}
+		if backing, ok := volume.BackingObjectDetails.(*cnstypes.CnsBlockBackingDetails); ok && backing.BackingDiskUrlPath != "" {
+			mismatches = append(mismatches, fmt.Sprintf("statically provisioned disk %q", backing.BackingDiskUrlPath))
+		}
+	}
+	if spec.StoragePolicyID != "" && volume.StoragePolicyId != "" && volume.StoragePolicyId != spec.StoragePolicyID {
+		mismatches = append(mismatches, fmt.Sprintf("storage policy %q instead of %q", volume.StoragePolicyId, spec.StoragePolicyID))
+	}
+	if datastoreURL != "" && volume.DatastoreUrl != "" && volume.DatastoreUrl != datastoreURL {
+		mismatches = append(mismatches, fmt.Sprintf("datastore %q instead of %q", volume.DatastoreUrl, datastoreURL))
+	}
+	if spec.ScParams != nil && spec.ScParams.PVCName != "" {
+		for _, baseMetadata := range volume.Metadata.EntityMetadata {
+			metadata, ok := baseMetadata.(*cnstypes.CnsKubernetesEntityMetadata)
+			if !ok || metadata.EntityType != string(cnstypes.CnsKubernetesEntityTypePVC) {
+				continue
+			}
+			if metadata.EntityName != spec.ScParams.PVCName || metadata.Namespace != spec.ScParams.PVCNamespace {
+				mismatches = append(mismatches, fmt.Sprintf("PVC %s/%s instead of %s/%s", metadata.Namespace,
+					metadata.EntityName, spec.ScParams.PVCNamespace, spec.ScParams.PVCName))
+			}
+		}
+	}
+	return mismatches
+}
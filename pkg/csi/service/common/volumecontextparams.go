@@ -0,0 +1,104 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// volumeContextParams is a group of StorageClass parameters of block volumes
+// passed in the volume context of the volumes, and parsed back from it on the
+// node or in ControllerPublishVolume, such as DeviceTuning.
+type volumeContextParams interface {
+	// IsSet returns true if the params of the group change how the volume is
+	// attached or staged.
+	IsSet() bool
+	// parseParam sets the field of the group for param, and reports whether
+	// param is in the group.
+	parseParam(param string, value string) (bool, error)
+	// params returns the params of the group set, with their value.
+	params() map[string]string
+}
+
+// volumeContextParams returns the groups of volume context params of
+// scParams.
+func (scParams *StorageClassParams) volumeContextParams() []volumeContextParams {
+	return []volumeContextParams{&scParams.DeviceTuning, &scParams.DiskIOAllocation, &scParams.DiskPlacement}
+}
+
+// parseVolumeContextParam sets the field of scParams for the volume context
+// param, and reports whether param is one of them.
+func parseVolumeContextParam(scParams *StorageClassParams, param string, value string) (bool, error) {
+	for _, group := range scParams.volumeContextParams() {
+		if ok, err := group.parseParam(param, value); ok || err != nil {
+			return true, err
+		}
+	}
+	return false, nil
+}
+
+// AddVolumeContextParams adds the volume context params set in scParams to
+// the volume context of a volume.
+func (scParams *StorageClassParams) AddVolumeContextParams(volumeContext map[string]string) {
+	for _, group := range scParams.volumeContextParams() {
+		for param, value := range group.params() {
+			volumeContext[param] = value
+		}
+	}
+}
+
+// ValidateFileVolumeParams returns an error if volume context params, which
+// only apply to block volumes, are set in scParams.
+func (scParams *StorageClassParams) ValidateFileVolumeParams() error {
+	var params []string
+	for _, group := range scParams.volumeContextParams() {
+		if !group.IsSet() {
+			continue
+		}
+		for param := range group.params() {
+			params = append(params, param)
+		}
+	}
+	if len(params) == 0 {
+		return nil
+	}
+	sort.Strings(params)
+	return fmt.Errorf("params %s are not supported for file volumes", strings.Join(params, ", "))
+}
+
+// parseVolumeContext sets the fields of group from the volume context of a
+// volume, ignoring the params of other groups.
+func parseVolumeContext(group volumeContextParams, volumeContext map[string]string) error {
+	for param, value := range volumeContext {
+		if _, err := group.parseParam(strings.ToLower(param), value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setParams returns the params of params with a value.
+func setParams(params map[string]string) map[string]string {
+	for param, value := range params {
+		if value == "" {
+			delete(params, param)
+		}
+	}
+	return params
+}
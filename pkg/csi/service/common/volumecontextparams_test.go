@@ -0,0 +1,109 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+// TestVolumeContextParams checks that the volume context params of the
+// StorageClass are passed in the volume context and parsed back from it, and
+// that invalid values are rejected.
+func TestVolumeContextParams(t *testing.T) {
+	tests := []struct {
+		name          string
+		params        map[string]string
+		volumeContext map[string]string
+		fileVolumeErr bool
+	}{
+		{
+			name:   "device tuning",
+			params: map[string]string{"IOScheduler": "mq-deadline", "ReadAheadKB": "0", "QueueDepth": "64"},
+			volumeContext: map[string]string{
+				AttributeIOScheduler: "mq-deadline", AttributeReadAheadKB: "0", AttributeQueueDepth: "64",
+			},
+			fileVolumeErr: true,
+		},
+		{
+			name:          "disk I/O allocation",
+			params:        map[string]string{"IOPSLimit": "1000", "IOShares": "high"},
+			volumeContext: map[string]string{AttributeIOPSLimit: "1000", AttributeIOShares: "high"},
+			fileVolumeErr: true,
+		},
+		{
+			name:          "disk placement",
+			params:        map[string]string{"DiskControllerType": "NVMe", "DiskPlacementPolicy": "spread"},
+			volumeContext: map[string]string{AttributeDiskControllerType: "nvme", AttributeDiskPlacementPolicy: "spread"},
+			fileVolumeErr: true,
+		},
+		{
+			name:          "disk placement of CNS",
+			params:        map[string]string{"DiskControllerType": "pvscsi"},
+			volumeContext: map[string]string{AttributeDiskControllerType: "pvscsi"},
+		},
+		{
+			name:          "none",
+			params:        map[string]string{"StoragePolicyName": "gold"},
+			volumeContext: map[string]string{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			scParams, err := ParseStorageClassParams(context.Background(), test.params, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			volumeContext := make(map[string]string)
+			scParams.AddVolumeContextParams(volumeContext)
+			if !reflect.DeepEqual(volumeContext, test.volumeContext) {
+				t.Fatalf("expected volume context %v, got %v", test.volumeContext, volumeContext)
+			}
+			if err := scParams.ValidateFileVolumeParams(); (err != nil) != test.fileVolumeErr {
+				t.Fatalf("expected file volume error %v, got %v", test.fileVolumeErr, err)
+			}
+			tuning, err := ParseDeviceTuning(volumeContext)
+			if err != nil || tuning != scParams.DeviceTuning {
+				t.Fatalf("expected device tuning %+v, got %+v, err %v", scParams.DeviceTuning, tuning, err)
+			}
+			allocation, err := ParseDiskIOAllocation(volumeContext)
+			if err != nil || allocation != scParams.DiskIOAllocation {
+				t.Fatalf("expected disk I/O allocation %+v, got %+v, err %v", scParams.DiskIOAllocation, allocation, err)
+			}
+			placement, err := ParseDiskPlacement(volumeContext)
+			if err != nil || placement != scParams.DiskPlacement {
+				t.Fatalf("expected disk placement %+v, got %+v, err %v", scParams.DiskPlacement, placement, err)
+			}
+		})
+	}
+
+	for _, params := range []map[string]string{
+		{"ioscheduler": "mq deadline"},
+		{"readaheadkb": "-1"},
+		{"queuedepth": "0"},
+		{"iopslimit": "0"},
+		{"ioshares": "highest"},
+		{"ioshares": "-1"},
+		{"diskcontrollertype": "lsilogic"},
+		{"diskplacementpolicy": "pack"},
+	} {
+		if _, err := ParseStorageClassParams(context.Background(), params, true); err == nil {
+			t.Errorf("expected error for params %v", params)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// maxVolumeNameLength is the maximum length of a CNS volume name.
+const maxVolumeNameLength = 80
+
+// volumeNameTemplateVar matches the variables of a volume name template.
+var volumeNameTemplateVar = regexp.MustCompile(`\$\{([^}]*)\}`)
+
+// VolumeNameMetadata holds the PVC metadata a volume name template can refer
+// to. It only holds the metadata the CO passes in the CreateVolumeRequest,
+// which doesn't change across its retries, so that they render the same name.
+type VolumeNameMetadata struct {
+	PVCName      string
+	PVCNamespace string
+	PVName       string
+}
+
+// ValidateVolumeNameTemplate checks that a volume name template only refers to
+// supported variables: ${pvc.name}, ${pvc.namespace} and ${pv.name}.
+func ValidateVolumeNameTemplate(template string) error {
+	for _, match := range volumeNameTemplateVar.FindAllStringSubmatch(template, -1) {
+		switch match[1] {
+		case "pvc.name", "pvc.namespace", "pv.name":
+		default:
+			return fmt.Errorf("unsupported variable %q in volume name template %q", match[0], template)
+		}
+	}
+	if strings.Count(template, "${") != len(volumeNameTemplateVar.FindAllString(template, -1)) {
+		return fmt.Errorf("unterminated variable in volume name template %q", template)
+	}
+	return nil
+}
+
+// RenderVolumeName returns the CNS volume name for the volume the CO requested
+// with reqName, expanding the variables of template with the PVC metadata.
+// The name ends with the PVC UID taken from reqName, keeping names unique and
+// the same across retries of CreateVolume, and is truncated to fit in CNS.
+func RenderVolumeName(template string, reqName string, metadata VolumeNameMetadata) (string, error) {
+	if err := ValidateVolumeNameTemplate(template); err != nil {
+		return "", err
+	}
+	if volumeNameTemplateVar.MatchString(template) && metadata.PVCName == "" {
+		return "", fmt.Errorf("volume name template %q requires the PVC metadata, "+
+			"run the external-provisioner with --extra-create-metadata", template)
+	}
+	rendered := volumeNameTemplateVar.ReplaceAllStringFunc(template, func(variable string) string {
+		switch variable[2 : len(variable)-1] {
+		case "pvc.name":
+			return metadata.PVCName
+		case "pvc.namespace":
+			return metadata.PVCNamespace
+		}
+		return metadata.PVName
+	})
+	rendered = strings.TrimSpace(rendered)
+	if rendered == "" {
+		return reqName, nil
+	}
+	suffix := strings.TrimPrefix(reqName, "pvc-")
+	if maxPrefix := maxVolumeNameLength - len(suffix) - 1; len(rendered) > maxPrefix {
+		if maxPrefix <= 0 {
+			return reqName, nil
+		}
+		rendered = rendered[:maxPrefix]
+	}
+	return rendered + "-" + suffix, nil
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common
+
+import (
+	"strings"
+	"testing"
+)
+
+const testVolumeReqName = "pvc-2d4f0ea3-8e3c-4e4e-9b4b-5d3f1d7c2a61"
+
+func TestValidateVolumeNameTemplate(t *testing.T) {
+	tests := []struct {
+		template string
+		valid    bool
+	}{
+		{template: "", valid: true},
+		{template: "static-name", valid: true},
+		{template: "${pvc.namespace}-${pvc.name}", valid: true},
+		{template: "${pv.name}", valid: true},
+		{template: "${pvc.uid}", valid: false},
+		// Labels can change between the retries of CreateVolume.
+		{template: "${pvc.labels['app']}", valid: false},
+		{template: "${pvc.name", valid: false},
+	}
+	for _, test := range tests {
+		err := ValidateVolumeNameTemplate(test.template)
+		if test.valid && err != nil {
+			t.Errorf("template %q: unexpected error: %v", test.template, err)
+		} else if !test.valid && err == nil {
+			t.Errorf("template %q: expected error but got none", test.template)
+		}
+	}
+}
+
+func TestRenderVolumeName(t *testing.T) {
+	metadata := VolumeNameMetadata{
+		PVCName:      "data-mysql-0",
+		PVCNamespace: "finance",
+		PVName:       testVolumeReqName,
+	}
+	suffix := strings.TrimPrefix(testVolumeReqName, "pvc-")
+	tests := []struct {
+		name     string
+		template string
+		metadata VolumeNameMetadata
+		expected string
+		err      bool
+	}{
+		{
+			name:     "namespace and name",
+			template: "${pvc.namespace}-${pvc.name}",
+			metadata: metadata,
+			expected: "finance-data-mysql-0-" + suffix,
+		},
+		{
+			name:     "PV name",
+			template: "${pv.name}",
+			metadata: metadata,
+			expected: testVolumeReqName + "-" + suffix,
+		},
+		{
+			name:     "long name",
+			template: strings.Repeat("a", 100),
+			metadata: metadata,
+			expected: strings.Repeat("a", maxVolumeNameLength-len(suffix)-1) + "-" + suffix,
+		},
+		{
+			name:     "no PVC metadata",
+			template: "${pvc.name}",
+			err:      true,
+		},
+		{
+			name:     "invalid template",
+			template: "${pvc.uid}",
+			metadata: metadata,
+			err:      true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			volumeName, err := RenderVolumeName(test.template, testVolumeReqName, test.metadata)
+			if test.err {
+				if err == nil {
+					t.Fatalf("expected error but got volume name %q", volumeName)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if volumeName != test.expected {
+				t.Fatalf("expected volume name %q, got %q", test.expected, volumeName)
+			}
+			if len(volumeName) > maxVolumeNameLength {
+				t.Fatalf("volume name %q is longer than %d characters", volumeName, maxVolumeNameLength)
+			}
+		})
+	}
+}
@@ -19,6 +19,7 @@ package common
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/davecgh/go-spew/spew"
 	cnstypes "github.com/vmware/govmomi/cns/types"
@@ -26,6 +27,7 @@ import (
 	vim25types "github.com/vmware/govmomi/vim25/types"
 	vsanfstypes "github.com/vmware/govmomi/vsan/vsanfs/types"
 	"golang.org/x/net/context"
+	"k8s.io/apimachinery/pkg/util/wait"
 	cnsvolume "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/volume"
 	"sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/vsphere"
 	"sigs.k8s.io/vsphere-csi-driver/pkg/common/utils"
@@ -132,6 +134,9 @@ func CreateBlockVolumeUtil(ctx context.Context, clusterFlavor cnstypes.CnsCluste
 			return nil, errors.New(errMsg)
 		}
 	}
+	if err := validateDiskFormat(ctx, vc, spec.StoragePolicyID, datastores); err != nil {
+		return nil, err
+	}
 	var containerClusterArray []cnstypes.CnsContainerCluster
 	containerCluster := vsphere.GetContainerCluster(manager.CnsConfig.Global.ClusterID, manager.CnsConfig.VirtualCenter[vc.Config.Host].User, clusterFlavor, manager.CnsConfig.Global.ClusterDistribution)
 	containerClusterArray = append(containerClusterArray, containerCluster)
@@ -167,10 +172,20 @@ func CreateBlockVolumeUtil(ctx context.Context, clusterFlavor cnstypes.CnsCluste
 		createSpec.Profile = append(createSpec.Profile, profileSpec)
 	}
 
+	datastoreURL := spec.ScParams.DatastoreURL
+	if datastoreURL == "" {
+		datastoreURL = spec.VsanDirectDatastoreURL
+	}
+	existingVolume, err := findExistingVolume(ctx, manager, createSpec, spec, datastoreURL)
+	if err != nil || existingVolume != nil {
+		return existingVolume, err
+	}
+
 	log.Debugf("vSphere CSI driver creating volume %s with create spec %+v", spec.Name, spew.Sdump(createSpec))
 	volumeInfo, err := manager.VolumeManager.CreateVolume(ctx, createSpec)
 	if err != nil {
 		log.Errorf("failed to create disk %s with error %+v", spec.Name, err)
+		invalidateStoragePolicyID(ctx, vc, spec, err)
 		return nil, err
 	}
 	return volumeInfo, nil
@@ -255,10 +270,19 @@ func CreateFileVolumeUtil(ctx context.Context, clusterFlavor cnstypes.CnsCluster
 		createSpec.Profile = append(createSpec.Profile, profileSpec)
 	}
 
+	existingVolume, err := findExistingVolume(ctx, manager, createSpec, spec, spec.ScParams.DatastoreURL)
+	if err != nil {
+		return "", err
+	}
+	if existingVolume != nil {
+		return existingVolume.VolumeID.Id, nil
+	}
+
 	log.Debugf("vSphere CSI driver creating volume %q with create spec %+v", spec.Name, spew.Sdump(createSpec))
 	volumeInfo, err := manager.VolumeManager.CreateVolume(ctx, createSpec)
 	if err != nil {
 		log.Errorf("failed to create file volume %q with error %+v", spec.Name, err)
+		invalidateStoragePolicyID(ctx, vc, spec, err)
 		return "", err
 	}
 	return volumeInfo.VolumeID.Id, nil
@@ -408,6 +432,7 @@ func CreateFileVolumeUtilOld(ctx context.Context, clusterFlavor cnstypes.CnsClus
 	volumeInfo, err := manager.VolumeManager.CreateVolume(ctx, createSpec)
 	if err != nil {
 		log.Errorf("failed to create file volume %q with error %+v", spec.Name, err)
+		invalidateStoragePolicyID(ctx, vc, spec, err)
 		return "", err
 	}
 	return volumeInfo.VolumeID.Id, nil
@@ -438,7 +463,12 @@ func AttachVolumeUtil(ctx context.Context, manager *Manager,
 	volumeID string) (string, error) {
 	log := logger.GetLogger(ctx)
 	log.Debugf("vSphere CSI driver is attaching volume: %q to vm: %q", volumeID, vm.String())
-	diskUUID, err := manager.VolumeManager.AttachVolume(ctx, vm, volumeID)
+	var diskUUID string
+	err := retryOnVMBusy(ctx, func() error {
+		var err error
+		diskUUID, err = manager.VolumeManager.AttachVolume(ctx, vm, volumeID)
+		return err
+	})
 	if err != nil {
 		log.Errorf("failed to attach disk %q with VM: %q. err: %+v", volumeID, vm.String(), err)
 		return "", err
@@ -453,7 +483,9 @@ func DetachVolumeUtil(ctx context.Context, manager *Manager,
 	volumeID string) error {
 	log := logger.GetLogger(ctx)
 	log.Debugf("vSphere CSI driver is detaching volume: %s from node vm: %s", volumeID, vm.InventoryPath)
-	err := manager.VolumeManager.DetachVolume(ctx, vm, volumeID)
+	err := retryOnVMBusy(ctx, func() error {
+		return manager.VolumeManager.DetachVolume(ctx, vm, volumeID)
+	})
 	if err != nil {
 		log.Errorf("failed to detach disk %s with err %+v", volumeID, err)
 		return err
@@ -462,6 +494,38 @@ func DetachVolumeUtil(ctx context.Context, manager *Manager,
 	return nil
 }
 
+// vmBusyRetryBackoff is the backoff of the retries of attach and detach
+// operations failing on a VM busy with another task, such as a vMotion. It
+// keeps the retries within the timeout of the external-attacher.
+var vmBusyRetryBackoff = wait.Backoff{
+	Duration: 5 * time.Second,
+	Factor:   2,
+	Jitter:   0.1,
+	Steps:    6,
+	Cap:      time.Minute,
+}
+
+// retryOnVMBusy calls operation, retrying it with backoff while it fails with
+// a VMBusyError, until the retries are exhausted or ctx is done.
+func retryOnVMBusy(ctx context.Context, operation func() error) error {
+	log := logger.GetLogger(ctx)
+	backoff := vmBusyRetryBackoff
+	for {
+		err := operation()
+		var vmBusyErr *cnsvolume.VMBusyError
+		if err == nil || !errors.As(err, &vmBusyErr) || backoff.Steps < 1 {
+			return err
+		}
+		delay := backoff.Step()
+		log.Infof("%v. Retrying in %v", err, delay)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
+
 // DeleteVolumeUtil is the helper function to delete CNS volume for given volumeId
 func DeleteVolumeUtil(ctx context.Context, volManager cnsvolume.Manager, volumeID string, deleteDisk bool) error {
 	log := logger.GetLogger(ctx)
@@ -477,12 +541,12 @@ func DeleteVolumeUtil(ctx context.Context, volManager cnsvolume.Manager, volumeI
 }
 
 // ExpandVolumeUtil is the helper function to extend CNS volume for given volumeId
-func ExpandVolumeUtil(ctx context.Context, manager *Manager, volumeID string, capacityInMb int64, useAsyncQueryVolume bool) error {
+func ExpandVolumeUtil(ctx context.Context, manager *Manager, volumeID string, capacityInMb int64) error {
 	var err error
 	log := logger.GetLogger(ctx)
 	log.Debugf("vSphere CSI driver expanding volume %q to new size %d Mb.", volumeID, capacityInMb)
 
-	expansionRequired, err := isExpansionRequired(ctx, volumeID, capacityInMb, manager, useAsyncQueryVolume)
+	expansionRequired, err := isExpansionRequired(ctx, volumeID, capacityInMb, manager)
 	if err != nil {
 		return err
 	}
@@ -507,7 +571,7 @@ func QueryVolumeByID(ctx context.Context, volManager cnsvolume.Manager, volumeID
 	queryFilter := cnstypes.CnsQueryFilter{
 		VolumeIds: []cnstypes.CnsVolumeId{{Id: volumeID}},
 	}
-	queryResult, err := volManager.QueryVolume(ctx, queryFilter)
+	queryResult, err := utils.QueryVolumeUtil(ctx, volManager, queryFilter, utils.QuerySelection())
 	if err != nil {
 		msg := fmt.Sprintf("QueryVolume failed for volumeID: %s with error %+v", volumeID, err)
 		log.Error(msg)
@@ -521,6 +585,27 @@ func QueryVolumeByID(ctx context.Context, volManager cnsvolume.Manager, volumeID
 	return &queryResult.Volumes[0], nil
 }
 
+// QueryVolumeFieldsByID queries the volume with the given volumeID returning
+// only its ID and the given fields. QueryVolumeByID returns all the fields of
+// the volume.
+func QueryVolumeFieldsByID(ctx context.Context, volManager cnsvolume.Manager, volumeID string,
+	fields ...cnstypes.QuerySelectionNameType) (*cnstypes.CnsVolume, error) {
+	log := logger.GetLogger(ctx)
+	queryFilter := cnstypes.CnsQueryFilter{
+		VolumeIds: []cnstypes.CnsVolumeId{{Id: volumeID}},
+	}
+	queryResult, err := utils.QueryVolumeUtil(ctx, volManager, queryFilter, utils.QuerySelection(fields...))
+	if err != nil {
+		log.Errorf("QueryVolume failed for volumeID: %s with error %+v", volumeID, err)
+		return nil, err
+	}
+	if len(queryResult.Volumes) == 0 {
+		log.Errorf("volumeID %q not found in QueryVolume", volumeID)
+		return nil, ErrNotFound
+	}
+	return &queryResult.Volumes[0], nil
+}
+
 // Helper function to get DatastoreMoRefs
 func getDatastoreMoRefs(datastores []*vsphere.DatastoreInfo) []vim25types.ManagedObjectReference {
 	var datastoreMoRefs []vim25types.ManagedObjectReference
@@ -553,20 +638,16 @@ func getDatastore(ctx context.Context, vc *vsphere.VirtualCenter, datastoreURL s
 }
 
 // isExpansionRequired verifies if the requested size to expand a volume is greater than the current size
-func isExpansionRequired(ctx context.Context, volumeID string, requestedSize int64, manager *Manager, useAsyncQueryVolume bool) (bool, error) {
+func isExpansionRequired(ctx context.Context, volumeID string, requestedSize int64, manager *Manager) (bool, error) {
 	log := logger.GetLogger(ctx)
 	volumeIds := []cnstypes.CnsVolumeId{{Id: volumeID}}
 	queryFilter := cnstypes.CnsQueryFilter{
 		VolumeIds: volumeIds,
 	}
 	// Select only the backing object details.
-	querySelection := cnstypes.CnsQuerySelection{
-		Names: []string{
-			string(cnstypes.QuerySelectionNameTypeBackingObjectDetails),
-		},
-	}
+	querySelection := utils.QuerySelection(cnstypes.QuerySelectionNameTypeBackingObjectDetails)
 	// Query only the backing object details.
-	queryResult, err := utils.QueryVolumeUtil(ctx, manager.VolumeManager, queryFilter, querySelection, useAsyncQueryVolume)
+	queryResult, err := utils.QueryVolumeUtil(ctx, manager.VolumeManager, queryFilter, querySelection)
 	if err != nil {
 		log.Errorf("QueryVolume failed with err=%+v", err.Error())
 		return false, err
@@ -581,5 +662,30 @@ func isExpansionRequired(ctx context.Context, volumeID string, requestedSize int
 		return false, err
 	}
 
+	if currentSize > requestedSize {
+		return false, &VolumeShrinkError{VolumeID: volumeID, CurrentSizeMB: currentSize, RequestedSizeMB: requestedSize}
+	}
 	return currentSize < requestedSize, nil
 }
+
+// VolumeShrinkError is returned when a volume is requested to be expanded to
+// a size smaller than its current size, which CNS doesn't support.
+type VolumeShrinkError struct {
+	VolumeID        string
+	CurrentSizeMB   int64
+	RequestedSizeMB int64
+}
+
+func (e *VolumeShrinkError) Error() string {
+	return fmt.Sprintf("requested size %d Mb of volume %q is smaller than its current size %d Mb, "+
+		"shrinking volumes is not supported", e.RequestedSizeMB, e.VolumeID, e.CurrentSizeMB)
+}
+
+// invalidateStoragePolicyID drops the cached ID of the storage policy of spec
+// when creating the volume failed with a NotFound fault, the policy may have
+// been deleted and created again with the same name.
+func invalidateStoragePolicyID(ctx context.Context, vc *vsphere.VirtualCenter, spec *CreateVolumeSpec, err error) {
+	if spec.ScParams.StoragePolicyName != "" && vsphere.IsCnsNotFoundError(err) {
+		vc.InvalidateStoragePolicyID(ctx, spec.ScParams.StoragePolicyName)
+	}
+}
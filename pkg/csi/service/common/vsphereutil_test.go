@@ -0,0 +1,68 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	cnsvolume "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/volume"
+)
+
+func TestRetryOnVMBusy(t *testing.T) {
+	defaultBackoff := vmBusyRetryBackoff
+	defer func() { vmBusyRetryBackoff = defaultBackoff }()
+	vmBusyRetryBackoff = wait.Backoff{Duration: time.Millisecond, Factor: 1, Steps: 3}
+
+	// Operations failing on a busy VM are retried until they succeed.
+	calls := 0
+	err := retryOnVMBusy(context.Background(), func() error {
+		calls++
+		if calls < 3 {
+			return &cnsvolume.VMBusyError{Operation: "attach", Volume: "vol1", VM: "vm1"}
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Fatalf("expected success after 3 calls, got err: %v after %d calls", err, calls)
+	}
+
+	// Until the retries are exhausted.
+	calls = 0
+	err = retryOnVMBusy(context.Background(), func() error {
+		calls++
+		return &cnsvolume.VMBusyError{Operation: "detach", Volume: "vol1", VM: "vm1"}
+	})
+	var vmBusyErr *cnsvolume.VMBusyError
+	if !errors.As(err, &vmBusyErr) || calls != 4 {
+		t.Fatalf("expected VMBusyError after 4 calls, got err: %v after %d calls", err, calls)
+	}
+
+	// Other errors aren't retried.
+	calls = 0
+	err = retryOnVMBusy(context.Background(), func() error {
+		calls++
+		return errors.New("failed")
+	})
+	if err == nil || calls != 1 {
+		t.Fatalf("expected error after 1 call, got err: %v after %d calls", err, calls)
+	}
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"golang.org/x/net/context"
+
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/common"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
+)
+
+// sysBlockDir is the directory in which the attributes of the block devices
+// are set.
+var sysBlockDir = "/sys/block"
+
+// tuneBlockDevice applies the tuning to the block device at devicePath, such
+// as /dev/sdb, through its attributes in sysfs.
+func tuneBlockDevice(ctx context.Context, devicePath string, tuning common.DeviceTuning) error {
+	log := logger.GetLogger(ctx)
+	deviceDir := filepath.Join(sysBlockDir, filepath.Base(devicePath))
+	for _, attribute := range []struct {
+		path  string
+		value string
+	}{
+		{path: "queue/scheduler", value: tuning.IOScheduler},
+		{path: "queue/read_ahead_kb", value: tuning.ReadAheadKB},
+		{path: "device/queue_depth", value: tuning.QueueDepth},
+	} {
+		if attribute.value == "" {
+			continue
+		}
+		path := filepath.Join(deviceDir, attribute.path)
+		if err := ioutil.WriteFile(path, []byte(attribute.value), 0644); err != nil {
+			return fmt.Errorf("failed to set %s to %q for device %s: %v", attribute.path, attribute.value, devicePath, err)
+		}
+		log.Infof("tuneBlockDevice: set %s to %q for device %s", attribute.path, attribute.value, devicePath)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/common"
+)
+
+func TestTuneBlockDevice(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sysblock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(dir string) { sysBlockDir = dir }(sysBlockDir)
+	sysBlockDir = dir
+	for _, subdir := range []string{"sdb/queue", "sdb/device"} {
+		if err := os.MkdirAll(filepath.Join(dir, subdir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tuning := common.DeviceTuning{IOScheduler: "none", QueueDepth: "32"}
+	if err := tuneBlockDevice(context.Background(), "/dev/sdb", tuning); err != nil {
+		t.Fatal(err)
+	}
+	for path, expected := range map[string]string{
+		"sdb/queue/scheduler":    "none",
+		"sdb/device/queue_depth": "32",
+	} {
+		value, err := ioutil.ReadFile(filepath.Join(dir, path))
+		if err != nil || string(value) != expected {
+			t.Errorf("expected %s to be %q, got %q, err %v", path, expected, value, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "sdb/queue/read_ahead_kb")); !os.IsNotExist(err) {
+		t.Errorf("expected read_ahead_kb to be left as is")
+	}
+}
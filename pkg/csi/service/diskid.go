@@ -0,0 +1,124 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// nvmeLinkPrefix is the prefix of the links udev creates in devDiskID for
+	// the namespaces of NVMe controllers, such as
+	// nvme-VMware_Virtual_NVMe_Disk_<serial>.
+	nvmeLinkPrefix = "nvme-"
+	// page83Header is the size of the header of the Device Identification VPD
+	// page, page 0x83, before its designation descriptors.
+	page83Header = 4
+	// page83CodeSetBinary is the code set of a designator made of binary
+	// bytes rather than ASCII or UTF-8 characters.
+	page83CodeSetBinary = 1
+)
+
+// isNVMeSerialLink returns true if the link name in devDiskID is the link udev
+// creates from the model and the serial number of an NVMe namespace, and the
+// serial number is the disk UUID id. The serial number of a disk attached to
+// an NVMe controller of a VM is its UUID, with or without hyphens.
+func isNVMeSerialLink(name string, id string) bool {
+	if !strings.HasPrefix(name, nvmeLinkPrefix) || strings.HasPrefix(name, nvmePrefix) {
+		return false
+	}
+	i := strings.LastIndex(name, "_")
+	if i < 0 {
+		return false
+	}
+	serial := strings.ToLower(strings.Replace(name[i+1:], "-", "", -1))
+	return serial == id
+}
+
+// getDiskPathFromSysfs returns the path in devDir of the disk with the UUID
+// id, found from the identifiers of the block devices in sysBlockDir, or ""
+// if no device has it. It finds disks udev didn't create a link in devDiskID
+// for, such as when the udev rules of the node lack the ones for NVMe
+// controllers: the identifier of an NVMe namespace is read from its wwid, and
+// the one of a SCSI disk from the NAA designator of its Device Identification
+// VPD page, page 0x83.
+func getDiskPathFromSysfs(id string) (string, error) {
+	devs, err := ioutil.ReadDir(sysBlockDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	for _, dev := range devs {
+		name := dev.Name()
+		var matched bool
+		if strings.HasPrefix(name, "nvme") {
+			wwid, err := ioutil.ReadFile(filepath.Join(sysBlockDir, name, "wwid"))
+			if err != nil {
+				continue
+			}
+			matched = matchWWID(strings.TrimSpace(string(wwid)), id)
+		} else {
+			page83, err := ioutil.ReadFile(filepath.Join(sysBlockDir, name, "device", "vpd_pg83"))
+			if err != nil {
+				continue
+			}
+			matched = matchPage83(page83, id)
+		}
+		if matched {
+			return filepath.Join(devDir, name), nil
+		}
+	}
+	return "", nil
+}
+
+// matchWWID returns true if the wwid of an NVMe namespace, its EUI-64 or
+// NGUID such as eui.6000c29a4fb3b4a5, or its UUID such as
+// uuid.6000c29a-4fb3-b4a5-4c3b-4a0f1e2d3c4b, is the disk UUID id.
+func matchWWID(wwid string, id string) bool {
+	for _, prefix := range []string{"eui.", "uuid."} {
+		if strings.HasPrefix(wwid, prefix) {
+			return strings.ToLower(strings.Replace(wwid[len(prefix):], "-", "", -1)) == id
+		}
+	}
+	return false
+}
+
+// matchPage83 returns true if a binary designator of the Device Identification
+// VPD page page83 is the disk UUID id, which is the case for the NAA
+// designator of the disks of a VM with disk.EnableUUID set to TRUE.
+func matchPage83(page83 []byte, id string) bool {
+	if len(page83) < page83Header {
+		return false
+	}
+	for i := page83Header; i+4 <= len(page83); {
+		length := int(page83[i+3])
+		if i+4+length > len(page83) {
+			return false
+		}
+		if page83[i]&0x0f == page83CodeSetBinary && hex.EncodeToString(page83[i+4:i+4+length]) == id {
+			return true
+		}
+		i += 4 + length
+	}
+	return false
+}
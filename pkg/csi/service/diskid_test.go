@@ -0,0 +1,94 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestGetDiskPathFromSysfs(t *testing.T) {
+	layout, _ := newFakeNode(t)
+	naa, err := hex.DecodeString(testDiskUUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A T10 vendor ID designator in ASCII followed by the NAA designator.
+	page83 := append([]byte{0x00, 0x83, 0x00, byte(8 + 4 + len(naa)),
+		0x02, 0x01, 0x00, 0x04, 'V', 'M', 'w', 'a',
+		0x01, 0x03, 0x00, byte(len(naa))}, naa...)
+	nvmeUUID := "6000c29a4fb3b4a54c3b4a0f1e2d3c4b"
+	for path, content := range map[string][]byte{
+		"sys/block/sda/device/vpd_pg83": {0x00, 0x83, 0x00, 0x00},
+		"sys/block/sdb/device/vpd_pg83": page83,
+		"sys/block/nvme0n1/wwid":        []byte("eui." + nvmeUUID + "\n"),
+		"sys/block/loop0/ro":            []byte("0\n"),
+	} {
+		path = filepath.Join(layout.root, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for id, expected := range map[string]string{
+		testDiskUUID:                       filepath.Join(layout.root, "sdb"),
+		nvmeUUID:                           filepath.Join(layout.root, "nvme0n1"),
+		"6000c29f00000000000000000000000f": "",
+	} {
+		path, err := getDiskPathFromSysfs(id)
+		if err != nil {
+			t.Fatalf("unexpected error for disk %q: %v", id, err)
+		}
+		if path != expected {
+			t.Errorf("expected path %q for disk %q, got %q", expected, id, path)
+		}
+	}
+
+	// The device of a disk without a link is found by verifyVolumeAttached.
+	if err := ioutil.WriteFile(filepath.Join(layout.root, "nvme0n1"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	path, err := verifyVolumeAttached(context.Background(), nvmeUUID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := filepath.Join(layout.root, "nvme0n1"); path != expected {
+		t.Errorf("expected path %q, got %q", expected, path)
+	}
+}
+
+func TestMatchWWID(t *testing.T) {
+	id := "6000c29a4fb3b4a54c3b4a0f1e2d3c4b"
+	for wwid, expected := range map[string]bool{
+		"eui.6000c29a4fb3b4a54c3b4a0f1e2d3c4b":      true,
+		"uuid.6000C29A-4FB3-B4A5-4C3B-4A0F1E2D3C4B": true,
+		"eui.6000c29a4fb3b4a5":                      false,
+		"nvme.15ad-564d77617265-00000001":           false,
+	} {
+		if matchWWID(wwid, id) != expected {
+			t.Errorf("expected match of wwid %q to be %v", wwid, expected)
+		}
+	}
+}
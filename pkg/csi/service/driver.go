@@ -19,6 +19,7 @@ package service
 import (
 	"context"
 	"net"
+	"net/url"
 	"os"
 	"strings"
 
@@ -27,6 +28,7 @@ import (
 	cnstypes "github.com/vmware/govmomi/cns/types"
 
 	cnsconfig "sigs.k8s.io/vsphere-csi-driver/pkg/common/config"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/common/tracing"
 	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/common"
 	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/common/commonco"
 	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
@@ -103,6 +105,15 @@ func (driver *vsphereCSIDriver) BeforeServe(
 	logger.SetLoggerLevel(logger.LogLevel(os.Getenv(logger.EnvLoggerLevel)))
 	ctx = logger.NewContextWithLogger(ctx)
 	log := logger.GetLogger(ctx)
+	if sp != nil {
+		// gocsi stops gracefully on SIGTERM, bound the time it waits.
+		go exitAfterShutdownTimeout(ctx, getShutdownTimeout(ctx))
+	}
+	defer func() {
+		if sp != nil && lis != nil && lis.Addr().Network() == "unix" {
+			driver.startSocketWatchdog(ctx, lis.Addr().String(), exitToRecreateDriverSocket)
+		}
+	}()
 	defer func() {
 		log.Infof("Configured: %q with clusterFlavor: %q and mode: %q",
 			csitypes.Name, clusterFlavor, driver.mode)
@@ -123,7 +134,23 @@ func (driver *vsphereCSIDriver) BeforeServe(
 
 	// Get the SP's operating mode.
 	driver.mode = os.Getenv(csitypes.EnvVarMode)
-	if !strings.EqualFold(driver.mode, "node") {
+	serviceName := "vsphere-csi-controller"
+	if strings.EqualFold(driver.mode, "node") {
+		serviceName = "vsphere-csi-node"
+	}
+	if err = tracing.Init(ctx, serviceName); err != nil {
+		log.Errorf("failed to initialize tracing. Error: %v", err)
+		return err
+	}
+	if strings.EqualFold(driver.mode, "node") {
+		// Don't let a hung NFS server or a slow mkfs block the kubelet.
+		nodeMounter = newRetryMounter(ctx, nodeMounter)
+		startNodeMetricsServer(ctx)
+		if commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.NodeVolumeHealth) {
+			nodeVolumeHealth = newNodeVolumeHealthChecker(os.Getenv("NODE_NAME"), getNodeVolumeHealthWriteProbe(ctx))
+			go nodeVolumeHealth.run(ctx, getNodeVolumeHealthInterval(ctx))
+		}
+	} else {
 		// Controller service is needed.
 		cfg, err = common.GetConfig(ctx)
 		if err != nil {
@@ -138,6 +165,18 @@ func (driver *vsphereCSIDriver) BeforeServe(
 	return nil
 }
 
+// startSocketWatchdog heals the CSI socket of the node plugin at the given
+// path with recreate, and the kubelet registration socket, when they become
+// stale.
+func (driver *vsphereCSIDriver) startSocketWatchdog(ctx context.Context, socket string, recreate func() error) {
+	// The CO utility is nil if BeforeServe failed to initialize it.
+	if !strings.EqualFold(driver.mode, "node") || commonco.ContainerOrchestratorUtility == nil ||
+		!commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.SocketSelfHealing) {
+		return
+	}
+	go newSocketWatchdog(socket, recreate).run(ctx)
+}
+
 // Run starts a gRPC server that serves requests at the specified endpoint.
 func (driver *vsphereCSIDriver) Run(ctx context.Context, endpoint string) {
 	log := logger.GetLogger(ctx)
@@ -149,7 +188,29 @@ func (driver *vsphereCSIDriver) Run(ctx context.Context, endpoint string) {
 		os.Exit(1)
 	}
 
+	// Stop accepting new RPCs on SIGTERM and wait for the in-flight ones,
+	// persisting the status of their CNS tasks, to finish.
+	shutdownTimeout := getShutdownTimeout(ctx)
+	sigCh := shutdownSignal()
+
 	//Start the nonblocking GRPC
-	grpc := NewNonBlockingGRPCServer()
-	grpc.Start(endpoint, driver, controllerServer, driver)
+	grpc := &nonBlockingGRPCServer{}
+	if u, err := url.Parse(endpoint); err == nil && u.Scheme == "unix" {
+		driver.startSocketWatchdog(ctx, u.Path, grpc.recreateSocket)
+	}
+	served := make(chan struct{})
+	go func() {
+		grpc.Start(endpoint, driver, controllerServer, driver)
+		close(served)
+	}()
+	select {
+	case <-served:
+	case sig := <-sigCh:
+		log.Infof("Received signal %v, waiting up to %v for the in-flight requests to finish", sig, shutdownTimeout)
+		if grpc.GracefulStopWithTimeout(shutdownTimeout) {
+			log.Info("In-flight requests finished, exiting")
+		}
+		<-served
+	}
+	tracing.Shutdown(ctx)
 }
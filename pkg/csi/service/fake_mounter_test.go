@@ -0,0 +1,193 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/akutz/gofsutil"
+	"golang.org/x/net/context"
+)
+
+// fakeMounter is an in-memory Mounter. Mounts are recorded in a table shaped
+// like the one gofsutil reads from /proc/self/mountinfo, nothing is mounted.
+type fakeMounter struct {
+	lock   sync.Mutex
+	mounts []gofsutil.Info
+	// formatted records the devices FormatAndMount was called for.
+	formatted []string
+	// err, if set, is returned by every call that changes the mounts.
+	err error
+}
+
+func (m *fakeMounter) GetMounts(ctx context.Context) ([]gofsutil.Info, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return append([]gofsutil.Info(nil), m.mounts...), nil
+}
+
+func (m *fakeMounter) GetDevMounts(ctx context.Context, dev string) ([]gofsutil.Info, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	var mnts []gofsutil.Info
+	for _, mnt := range m.mounts {
+		if mnt.Device == dev {
+			mnts = append(mnts, mnt)
+		}
+	}
+	return mnts, nil
+}
+
+func (m *fakeMounter) Mount(ctx context.Context, source, target, fsType string, opts ...string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	m.addMount(fakeRealDev(source), target, source, fsType, opts)
+	return nil
+}
+
+func (m *fakeMounter) FormatAndMount(ctx context.Context, source, target, fsType string, opts ...string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	m.formatted = append(m.formatted, source)
+	m.addMount(fakeRealDev(source), target, source, fsType, opts)
+	return nil
+}
+
+// BindMount records a bind mount of source. Binding a mount point reuses its
+// device, binding a device records it on devtmpfs like the kernel reports
+// raw block volumes.
+func (m *fakeMounter) BindMount(ctx context.Context, source, target string, opts ...string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	for _, mnt := range m.mounts {
+		if mnt.Path == source {
+			m.addMount(mnt.Device, target, source, mnt.Type, opts)
+			return nil
+		}
+	}
+	m.addMount("devtmpfs", target, fakeRealDev(source), "devtmpfs", opts)
+	return nil
+}
+
+func (m *fakeMounter) Unmount(ctx context.Context, target string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	for i, mnt := range m.mounts {
+		if mnt.Path == target {
+			m.mounts = append(m.mounts[:i], m.mounts[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("%s is not mounted", target)
+}
+
+func (m *fakeMounter) addMount(device, target, source, fsType string, opts []string) {
+	mntOpts := []string{"rw"}
+	if contains(opts, "ro") {
+		mntOpts = []string{"ro"}
+	}
+	m.mounts = append(m.mounts, gofsutil.Info{
+		Device: device,
+		Path:   target,
+		Source: source,
+		Type:   fsType,
+		Opts:   mntOpts,
+	})
+}
+
+func fakeRealDev(path string) string {
+	if d, err := filepath.EvalSymlinks(path); err == nil {
+		return d
+	}
+	return path
+}
+
+// fakeDevLayout is a temporary directory laid out like the parts of /dev the
+// node service reads: disk/by-id holds wwn-0x<disk UUID> links to device
+// files in the root.
+type fakeDevLayout struct {
+	root string
+}
+
+// newFakeNode points the node service at an empty fake /dev layout and a
+// fake mounter for the duration of the test.
+func newFakeNode(t *testing.T) (*fakeDevLayout, *fakeMounter) {
+	root, err := ioutil.TempDir("", "fake-dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	byID := filepath.Join(root, "disk", "by-id")
+	if err := os.MkdirAll(byID, 0755); err != nil {
+		t.Fatal(err)
+	}
+	mounter := &fakeMounter{}
+	origMounter, origDevDiskID, origDevDir, origIsBlockDevice := nodeMounter, devDiskID, devDir, isBlockDevice
+	origSysBlockDir, origSysFsDir := sysBlockDir, sysFsDir
+	nodeMounter, devDiskID, devDir = mounter, byID, root
+	sysBlockDir, sysFsDir = filepath.Join(root, "sys", "block"), filepath.Join(root, "sys", "fs")
+	// Device files are regular files, creating device nodes requires root.
+	isBlockDevice = func(fi os.FileInfo) bool {
+		return fi.Mode().IsRegular()
+	}
+	t.Cleanup(func() {
+		nodeMounter, devDiskID, devDir, isBlockDevice = origMounter, origDevDiskID, origDevDir, origIsBlockDevice
+		sysBlockDir, sysFsDir = origSysBlockDir, origSysFsDir
+		os.RemoveAll(root)
+	})
+	return &fakeDevLayout{root: root}, mounter
+}
+
+// attachDisk creates the device file devName and links the disk with the
+// given UUID to it, as udev does when a disk is attached. It returns the path
+// of the device file.
+func (l *fakeDevLayout) attachDisk(t *testing.T, diskUUID string, devName string) string {
+	dev := filepath.Join(l.root, devName)
+	if err := ioutil.WriteFile(dev, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(dev, filepath.Join(devDiskID, blockPrefix+diskUUID)); err != nil {
+		t.Fatal(err)
+	}
+	return dev
+}
+
+// mkdir creates a directory under the test's temporary directory, like the
+// CO creates staging and target directories.
+func (l *fakeDevLayout) mkdir(t *testing.T, name string) string {
+	dir := filepath.Join(l.root, name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
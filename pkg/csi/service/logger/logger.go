@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
@@ -53,9 +54,15 @@ func GetLogger(ctx context.Context) *zap.SugaredLogger {
 }
 
 // NewContextWithLogger returns a new child context with context UUID set
-// using key CtxId.
+// using key CtxId. The ID of the OpenTelemetry trace of ctx is used as UUID
+// if it has one, so that the logs of a traced request can be found by its
+// trace.
 func NewContextWithLogger(ctx context.Context) context.Context {
-	newCtx := withFields(ctx, zap.String(LogCtxIDKey, uuid.New().String()))
+	id := uuid.New().String()
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.HasTraceID() {
+		id = spanContext.TraceID().String()
+	}
+	newCtx := withFields(ctx, zap.String(LogCtxIDKey, id))
 	return newCtx
 }
 
@@ -0,0 +1,85 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+
+	"sigs.k8s.io/vsphere-csi-driver/pkg/common/prometheus"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
+	csitypes "sigs.k8s.io/vsphere-csi-driver/pkg/csi/types"
+)
+
+// defaultNodeMetricsAddress is the default address the node plugin serves
+// Prometheus metrics at. The controller serves them at ":2112".
+const defaultNodeMetricsAddress = ":2115"
+
+// MetricsInterceptor is a gRPC unary server interceptor counting the CSI
+// requests and observing their latency, by method and gRPC result code.
+func MetricsInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	method := path.Base(info.FullMethod)
+	code := status.Code(err).String()
+	prometheus.CsiGrpcRequestsTotal.WithLabelValues(method, code).Inc()
+	prometheus.CsiGrpcRequestsHistVec.WithLabelValues(method, code).Observe(time.Since(start).Seconds())
+	return resp, err
+}
+
+// getNodeMetricsAddress returns the address set with the env variable
+// X_CSI_NODE_METRICS_ADDRESS, or the default one if it isn't set.
+func getNodeMetricsAddress() string {
+	if addr, ok := os.LookupEnv(csitypes.EnvVarNodeMetricsAddress); ok {
+		return addr
+	}
+	return defaultNodeMetricsAddress
+}
+
+// startNodeMetricsServer serves the Prometheus metrics of the node plugin at
+// the address of getNodeMetricsAddress, restarting the http server if it
+// exits. It does nothing if the address is empty.
+func startNodeMetricsServer(ctx context.Context) {
+	log := logger.GetLogger(ctx)
+	addr := getNodeMetricsAddress()
+	if addr == "" {
+		log.Infof("%s is empty, not exposing Prometheus metrics", csitypes.EnvVarNodeMetricsAddress)
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	go func() {
+		prometheus.CsiInfo.WithLabelValues(Version).Set(1)
+		for {
+			log.Infof("Starting the http server to expose Prometheus metrics at %q..", addr)
+			err := http.ListenAndServe(addr, mux)
+			if err != nil {
+				log.Warnf("Http server that exposes the Prometheus exited with err: %+v", err)
+			}
+			log.Info("Restarting http server to expose Prometheus metrics..")
+			time.Sleep(time.Second)
+		}
+	}()
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"sigs.k8s.io/vsphere-csi-driver/pkg/common/prometheus"
+	csitypes "sigs.k8s.io/vsphere-csi-driver/pkg/csi/types"
+)
+
+func TestMetricsInterceptor(t *testing.T) {
+	ctx := context.Background()
+	info := &grpc.UnaryServerInfo{FullMethod: "/csi.v1.Node/NodeStageVolume"}
+	ok := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "staged", nil
+	}
+	failed := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.Internal, "mount failed")
+	}
+	okCount := testutil.ToFloat64(prometheus.CsiGrpcRequestsTotal.WithLabelValues("NodeStageVolume", "OK"))
+	failedCount := testutil.ToFloat64(prometheus.CsiGrpcRequestsTotal.WithLabelValues("NodeStageVolume", "Internal"))
+
+	resp, err := MetricsInterceptor(ctx, nil, info, ok)
+	if err != nil || resp != "staged" {
+		t.Fatalf("expected the response of the handler, got %v, %v", resp, err)
+	}
+	if _, err := MetricsInterceptor(ctx, nil, info, failed); status.Code(err) != codes.Internal {
+		t.Fatalf("expected the error of the handler, got %v", err)
+	}
+	if _, err := MetricsInterceptor(ctx, nil, info, failed); status.Code(err) != codes.Internal {
+		t.Fatalf("expected the error of the handler, got %v", err)
+	}
+
+	if v := testutil.ToFloat64(prometheus.CsiGrpcRequestsTotal.WithLabelValues("NodeStageVolume", "OK")); v-okCount != 1 {
+		t.Errorf("expected 1 successful request to be counted, got %v", v-okCount)
+	}
+	if v := testutil.ToFloat64(prometheus.CsiGrpcRequestsTotal.WithLabelValues("NodeStageVolume", "Internal")); v-
+		failedCount != 2 {
+		t.Errorf("expected 2 failed requests to be counted, got %v", v-failedCount)
+	}
+}
+
+func TestGetNodeMetricsAddress(t *testing.T) {
+	defer os.Unsetenv(csitypes.EnvVarNodeMetricsAddress)
+	os.Unsetenv(csitypes.EnvVarNodeMetricsAddress)
+	if addr := getNodeMetricsAddress(); addr != defaultNodeMetricsAddress {
+		t.Errorf("expected the default address %q, got %q", defaultNodeMetricsAddress, addr)
+	}
+	for _, addr := range []string{":9100", ""} {
+		os.Setenv(csitypes.EnvVarNodeMetricsAddress, addr)
+		if got := getNodeMetricsAddress(); got != addr {
+			t.Errorf("expected address %q, got %q", addr, got)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/akutz/gofsutil"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
+	csitypes "sigs.k8s.io/vsphere-csi-driver/pkg/csi/types"
+)
+
+const (
+	// defaultMountTimeout is the default time a mount, format or unmount
+	// operation can take before it is abandoned.
+	defaultMountTimeout = 5 * time.Minute
+	// defaultMountRetries is the default number of times a failed mount,
+	// format or unmount operation is retried.
+	defaultMountRetries = 2
+	// mountRetryInterval is the time between two attempts of an operation.
+	mountRetryInterval = 5 * time.Second
+)
+
+// errMountTimeout is returned when a mount, format or unmount operation
+// doesn't complete within the timeout, such as when the NFS server doesn't
+// respond. The operation is not retried as it may still complete.
+var errMountTimeout = errors.New("mount operation timed out")
+
+// errMountInProgress is returned when an operation is requested on a target
+// whose previous operation is still running, such as one that timed out, as
+// the commands run by the operations can't be cancelled.
+var errMountInProgress = errors.New("mount operation in progress")
+
+// Mounter lists, creates and removes the mounts of the node.
+type Mounter interface {
+	// GetMounts returns all the mounts of the node.
+	GetMounts(ctx context.Context) ([]gofsutil.Info, error)
+	// GetDevMounts returns the mounts of the given device.
+	GetDevMounts(ctx context.Context, dev string) ([]gofsutil.Info, error)
+	// Mount mounts source at target with the given file system type and
+	// options.
+	Mount(ctx context.Context, source, target, fsType string, opts ...string) error
+	// FormatAndMount formats source with fsType if it is not formatted yet and
+	// mounts it at target.
+	FormatAndMount(ctx context.Context, source, target, fsType string, opts ...string) error
+	// BindMount bind mounts source at target.
+	BindMount(ctx context.Context, source, target string, opts ...string) error
+	// Unmount unmounts target.
+	Unmount(ctx context.Context, target string) error
+}
+
+// gofsutilMounter is the Mounter of the node, implemented with gofsutil.
+type gofsutilMounter struct{}
+
+func (m *gofsutilMounter) GetMounts(ctx context.Context) ([]gofsutil.Info, error) {
+	return gofsutil.GetMounts(ctx)
+}
+
+func (m *gofsutilMounter) GetDevMounts(ctx context.Context, dev string) ([]gofsutil.Info, error) {
+	return gofsutil.GetDevMounts(ctx, dev)
+}
+
+func (m *gofsutilMounter) Mount(ctx context.Context, source, target, fsType string, opts ...string) error {
+	return gofsutil.Mount(ctx, source, target, fsType, opts...)
+}
+
+func (m *gofsutilMounter) FormatAndMount(ctx context.Context, source, target, fsType string, opts ...string) error {
+	return gofsutil.FormatAndMount(ctx, source, target, fsType, opts...)
+}
+
+func (m *gofsutilMounter) BindMount(ctx context.Context, source, target string, opts ...string) error {
+	return gofsutil.BindMount(ctx, source, target, opts...)
+}
+
+func (m *gofsutilMounter) Unmount(ctx context.Context, target string) error {
+	return gofsutil.Unmount(ctx, target)
+}
+
+var (
+	// nodeMounter is used by the node service for all mount operations.
+	nodeMounter Mounter = &gofsutilMounter{}
+	// devDiskID is the directory in which attached disks are looked up by
+	// their UUID.
+	devDiskID = "/dev/disk/by-id"
+	// devDir is the directory of the device files of the disks.
+	devDir = "/dev"
+	// isBlockDevice reports whether the file a disk path resolves to is a
+	// block device.
+	isBlockDevice = func(fi os.FileInfo) bool {
+		return fi.Mode()&os.ModeDevice != 0
+	}
+)
+
+// retryMounter is a Mounter bounding the time the mount, format and unmount
+// operations of the wrapped Mounter take, and retrying the ones that fail.
+type retryMounter struct {
+	Mounter
+	// timeout of an attempt of an operation.
+	timeout time.Duration
+	// retries is the number of times a failed operation is retried.
+	retries int
+	// retryInterval is the time between two attempts of an operation.
+	retryInterval time.Duration
+	// inFlightLock protects inFlight.
+	inFlightLock sync.Mutex
+	// inFlight has the targets with an operation running.
+	inFlight map[string]bool
+}
+
+// newRetryMounter wraps m with the timeout and retries set with the env
+// variables X_CSI_MOUNT_TIMEOUT and X_CSI_MOUNT_RETRIES, or the default ones.
+func newRetryMounter(ctx context.Context, m Mounter) *retryMounter {
+	log := logger.GetLogger(ctx)
+	r := &retryMounter{
+		Mounter:       m,
+		timeout:       defaultMountTimeout,
+		retries:       defaultMountRetries,
+		retryInterval: mountRetryInterval,
+	}
+	if v := os.Getenv(csitypes.EnvVarMountTimeout); v != "" {
+		if value, err := time.ParseDuration(v); err != nil || value <= 0 {
+			log.Warnf("Invalid value set for env variable %s: %v. Using default value.", csitypes.EnvVarMountTimeout, v)
+		} else {
+			r.timeout = value
+		}
+	}
+	if v := os.Getenv(csitypes.EnvVarMountRetries); v != "" {
+		if value, err := strconv.Atoi(v); err != nil || value < 0 {
+			log.Warnf("Invalid value set for env variable %s: %v. Using default value.", csitypes.EnvVarMountRetries, v)
+		} else {
+			r.retries = value
+		}
+	}
+	log.Infof("Setting mount timeout to %v and retries to %d.", r.timeout, r.retries)
+	return r
+}
+
+func (m *retryMounter) Mount(ctx context.Context, source, target, fsType string, opts ...string) error {
+	return m.do(ctx, target, "mount of "+source+" at "+target, func(ctx context.Context) error {
+		return m.Mounter.Mount(ctx, source, target, fsType, opts...)
+	})
+}
+
+func (m *retryMounter) FormatAndMount(ctx context.Context, source, target, fsType string, opts ...string) error {
+	return m.do(ctx, target, "format and mount of "+source+" at "+target, func(ctx context.Context) error {
+		return m.Mounter.FormatAndMount(ctx, source, target, fsType, opts...)
+	})
+}
+
+func (m *retryMounter) BindMount(ctx context.Context, source, target string, opts ...string) error {
+	return m.do(ctx, target, "bind mount of "+source+" at "+target, func(ctx context.Context) error {
+		return m.Mounter.BindMount(ctx, source, target, opts...)
+	})
+}
+
+func (m *retryMounter) Unmount(ctx context.Context, target string) error {
+	return m.do(ctx, target, "unmount of "+target, func(ctx context.Context) error {
+		return m.Mounter.Unmount(ctx, target)
+	})
+}
+
+// do runs the operation on target until it succeeds, times out or has been
+// retried m.retries times.
+func (m *retryMounter) do(ctx context.Context, target string, operation string,
+	f func(ctx context.Context) error) error {
+	log := logger.GetLogger(ctx)
+	var err error
+	for attempt := 0; attempt <= m.retries; attempt++ {
+		if attempt > 0 {
+			log.Infof("Retrying %s in %v, attempt %d of %d. Previous error: %v",
+				operation, m.retryInterval, attempt, m.retries, err)
+			select {
+			case <-ctx.Done():
+				return err
+			case <-time.After(m.retryInterval):
+			}
+		}
+		if err = m.doWithTimeout(ctx, target, operation, f); err == nil || errors.Is(err, errMountTimeout) ||
+			errors.Is(err, errMountInProgress) {
+			return err
+		}
+	}
+	return err
+}
+
+// doWithTimeout runs the operation on target, and returns errMountTimeout if
+// it didn't complete within m.timeout. The commands of the operation don't
+// honor the context, and are left running: target is kept in flight until
+// they complete, and the operations requested on it meanwhile fail with
+// errMountInProgress instead of running concurrently.
+func (m *retryMounter) doWithTimeout(ctx context.Context, target string, operation string,
+	f func(ctx context.Context) error) error {
+	m.inFlightLock.Lock()
+	if m.inFlight[target] {
+		m.inFlightLock.Unlock()
+		return fmt.Errorf("%w: an operation on %s is still running, not starting %s", errMountInProgress, target, operation)
+	}
+	if m.inFlight == nil {
+		m.inFlight = make(map[string]bool)
+	}
+	m.inFlight[target] = true
+	m.inFlightLock.Unlock()
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			m.inFlightLock.Lock()
+			delete(m.inFlight, target)
+			m.inFlightLock.Unlock()
+		}()
+		done <- f(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("%w: %s didn't complete within %v", errMountTimeout, operation, m.timeout)
+	}
+}
+
+// mountErrorCode returns the gRPC code of the error of a mount operation.
+func mountErrorCode(err error) codes.Code {
+	if errors.Is(err, errMountTimeout) {
+		return codes.DeadlineExceeded
+	}
+	if errors.Is(err, errMountInProgress) {
+		return codes.Aborted
+	}
+	return codes.Internal
+}
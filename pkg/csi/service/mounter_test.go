@@ -0,0 +1,86 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+)
+
+// flakyMounter fails the first failures mounts, and hangs on the mounts
+// until release is closed when it is set, ignoring the context like the
+// mount commands do.
+type flakyMounter struct {
+	fakeMounter
+	failures int
+	release  chan struct{}
+	calls    int32
+}
+
+func (m *flakyMounter) Mount(ctx context.Context, source, target, fsType string, opts ...string) error {
+	calls := atomic.AddInt32(&m.calls, 1)
+	if m.release != nil {
+		<-m.release
+		return nil
+	}
+	if int(calls) <= m.failures {
+		return errors.New("mount failed")
+	}
+	return nil
+}
+
+func TestRetryMounter(t *testing.T) {
+	ctx := context.Background()
+	flaky := &flakyMounter{failures: 2}
+	m := &retryMounter{Mounter: flaky, timeout: time.Second, retries: 2}
+	if err := m.Mount(ctx, "/dev/sdb", "/mnt/sdb", "ext4"); err != nil {
+		t.Fatalf("expected the mount to succeed on the last retry, got %v", err)
+	}
+
+	flaky = &flakyMounter{failures: 3}
+	m.Mounter = flaky
+	err := m.Mount(ctx, "/dev/sdb", "/mnt/sdb", "ext4")
+	if err == nil || mountErrorCode(err) != codes.Internal || atomic.LoadInt32(&flaky.calls) != 3 {
+		t.Fatalf("expected the mount to fail after 2 retries, got %v after %d calls", err, atomic.LoadInt32(&flaky.calls))
+	}
+
+	flaky = &flakyMounter{release: make(chan struct{})}
+	m = &retryMounter{Mounter: flaky, timeout: 10 * time.Millisecond, retries: 2}
+	err = m.Mount(ctx, "/dev/sdb", "/mnt/sdb", "ext4")
+	if mountErrorCode(err) != codes.DeadlineExceeded || atomic.LoadInt32(&flaky.calls) != 1 {
+		t.Fatalf("expected the hung mount to time out without retry, got %v after %d calls", err, atomic.LoadInt32(&flaky.calls))
+	}
+	// The target is busy until the hung mount completes.
+	err = m.Mount(ctx, "/dev/sdb", "/mnt/sdb", "ext4")
+	if mountErrorCode(err) != codes.Aborted || atomic.LoadInt32(&flaky.calls) != 1 {
+		t.Fatalf("expected the mount to abort while the hung mount runs, got %v after %d calls", err, atomic.LoadInt32(&flaky.calls))
+	}
+	close(flaky.release)
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		if err = m.Mount(ctx, "/dev/sdb", "/mnt/sdb", "ext4"); err == nil {
+			break
+		}
+		if time.Since(start) > 10*time.Second {
+			t.Fatalf("expected the mount to succeed once the hung mount completed, got %v", err)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// dmMultipathUUIDPrefix is the prefix of the UUID of the device-mapper devices
+// multipathd creates for the maps of the disks it claims.
+const dmMultipathUUIDPrefix = "mpath-"
+
+// Multipath holds details about the dm-multipath device of a disk.
+type Multipath struct {
+	// DMName is the name of the device-mapper device, such as dm-0.
+	DMName string
+	// MapName is the name of the multipath map, which is the name of the
+	// device in /dev/mapper, such as mpatha or the WWID of the disk.
+	MapName string
+	// Paths are the names of the devices of the paths of the map, such as sdb.
+	Paths []string
+}
+
+// getMultipath returns the dm-multipath device the block device name in
+// sysBlockDir, such as dm-0 or sdb, is, or is a path of, or nil if the device
+// isn't part of a multipath map.
+func getMultipath(name string) (*Multipath, error) {
+	if isMultipathDM(name) {
+		return readMultipath(name)
+	}
+	holders, err := ioutil.ReadDir(filepath.Join(sysBlockDir, name, "holders"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to list the holders of device %s: %v", name, err)
+	}
+	for _, holder := range holders {
+		if isMultipathDM(holder.Name()) {
+			return readMultipath(holder.Name())
+		}
+	}
+	return nil, nil
+}
+
+// isMultipathDM returns true if the block device name in sysBlockDir is a
+// device-mapper device created by multipathd.
+func isMultipathDM(name string) bool {
+	uuid, err := ioutil.ReadFile(filepath.Join(sysBlockDir, name, "dm", "uuid"))
+	return err == nil && strings.HasPrefix(strings.TrimSpace(string(uuid)), dmMultipathUUIDPrefix)
+}
+
+// readMultipath returns the details of the dm-multipath device dmName.
+func readMultipath(dmName string) (*Multipath, error) {
+	mapName, err := ioutil.ReadFile(filepath.Join(sysBlockDir, dmName, "dm", "name"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the name of multipath device %s: %v", dmName, err)
+	}
+	multipath := &Multipath{
+		DMName:  dmName,
+		MapName: strings.TrimSpace(string(mapName)),
+	}
+	slaves, err := ioutil.ReadDir(filepath.Join(sysBlockDir, dmName, "slaves"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to list the paths of multipath device %s: %v", dmName, err)
+	}
+	for _, slave := range slaves {
+		multipath.Paths = append(multipath.Paths, slave.Name())
+	}
+	return multipath, nil
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestGetDeviceMultipath(t *testing.T) {
+	ctx := context.Background()
+	layout, _ := newFakeNode(t)
+	diskPath := filepath.Join(devDiskID, blockPrefix+testDiskUUID)
+	layout.attachDisk(t, testDiskUUID, "sdb")
+	if err := ioutil.WriteFile(filepath.Join(layout.root, "dm-0"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for path, content := range map[string]string{
+		"sys/block/sdb/holders/dm-0":  "",
+		"sys/block/sdb/device/rescan": "",
+		"sys/block/sdc/holders/dm-0":  "",
+		"sys/block/sdc/device/rescan": "",
+		"sys/block/dm-0/dm/uuid":      "mpath-3" + testDiskUUID + "\n",
+		"sys/block/dm-0/dm/name":      "mpatha\n",
+		"sys/block/dm-0/slaves/sdb":   "",
+		"sys/block/dm-0/slaves/sdc":   "",
+		"sys/block/sdd/holders/dm-1":  "",
+		"sys/block/dm-1/dm/uuid":      "LVM-Wq2dYZ7Tx\n",
+		"sys/block/dm-1/dm/name":      "vg-lv\n",
+		"sys/block/dm-1/slaves/sdd":   "",
+	} {
+		path = filepath.Join(layout.root, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := &Device{
+		Name:     blockPrefix + testDiskUUID,
+		FullPath: filepath.Join(layout.root, "mapper", "mpatha"),
+		RealDev:  filepath.Join(layout.root, "mapper", "mpatha"),
+		Multipath: &Multipath{
+			DMName:  "dm-0",
+			MapName: "mpatha",
+			Paths:   []string{"sdb", "sdc"},
+		},
+	}
+	// The link of the disk resolves to a path device.
+	dev, err := getDevice(diskPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(dev, expected) {
+		t.Fatalf("expected device %+v, got %+v", expected, dev)
+	}
+	// The link of the disk resolves to the multipath device.
+	if err := os.Remove(diskPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(layout.root, "dm-0"), diskPath); err != nil {
+		t.Fatal(err)
+	}
+	dev, err = getDevice(diskPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(dev, expected) {
+		t.Fatalf("expected device %+v, got %+v", expected, dev)
+	}
+
+	// All the paths are rescanned before the map is resized.
+	mounter, ran := newFakeResizeMounter([]fakeCommand{{}})
+	if err := rescanDevice(ctx, mounter.Exec, dev); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, name := range []string{"sdb", "sdc"} {
+		content, err := ioutil.ReadFile(filepath.Join(layout.root, "sys", "block", name, "device", "rescan"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != "1" {
+			t.Errorf("expected device %s to be rescanned", name)
+		}
+	}
+	if expected := [][]string{{"multipathd", "resize", "map", "mpatha"}}; !reflect.DeepEqual(*ran, expected) {
+		t.Fatalf("expected commands %v, got %v", expected, *ran)
+	}
+
+	// A disk held by another device-mapper device isn't a multipath device.
+	if err := ioutil.WriteFile(filepath.Join(layout.root, "sdd"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	dev, err = getDevice(filepath.Join(layout.root, "sdd"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if dev.Multipath != nil || dev.RealDev != filepath.Join(layout.root, "sdd") {
+		t.Fatalf("expected device sdd not to be a multipath device, got %+v", dev)
+	}
+}
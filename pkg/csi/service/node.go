@@ -36,7 +36,6 @@ import (
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/kubernetes/pkg/util/resizefs"
 	k8svol "k8s.io/kubernetes/pkg/volume"
 	"k8s.io/kubernetes/pkg/volume/util/fs"
 	mount "k8s.io/mount-utils"
@@ -51,8 +50,8 @@ import (
 )
 
 const (
-	devDiskID                     = "/dev/disk/by-id"
 	blockPrefix                   = "wwn-0x"
+	nvmePrefix                    = "nvme-eui."
 	dmiDir                        = "/sys/class/dmi"
 	maxAllowedBlockVolumesPerNode = 59
 )
@@ -164,6 +163,22 @@ func nodeStageBlockVolume(
 	}
 	log.Debugf("nodeStageBlockVolume: getDevice %+v", *dev)
 
+	// Tune the block device as set in the StorageClass
+	tuning, err := common.ParseDeviceTuning(req.GetVolumeContext())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid device tuning of volume %q: %v", params.volID, err)
+	}
+	if tuning.IsSet() {
+		// The I/O to a multipath device is queued to its paths.
+		for _, name := range dev.diskNames() {
+			if err := tuneBlockDevice(ctx, filepath.Join(devDir, name), tuning); err != nil {
+				msg := fmt.Sprintf("failed to tune the block device of volume %q: %v", params.volID, err)
+				log.Error(msg)
+				return nil, status.Error(codes.Internal, msg)
+			}
+		}
+	}
+
 	// Check if this is a MountVolume or BlockVolume
 	if _, ok := req.GetVolumeCapability().GetAccessType().(*csi.VolumeCapability_Block); ok {
 		// Volume is a block volume, so skip the rest of the steps
@@ -174,7 +189,7 @@ func nodeStageBlockVolume(
 	// Mount Volume
 	// Fetch dev mounts to check if the device is already staged
 	log.Debugf("nodeStageBlockVolume: Fetching device mounts")
-	mnts, err := gofsutil.GetDevMounts(ctx, dev.RealDev)
+	mnts, err := nodeMounter.GetDevMounts(ctx, dev.RealDev)
 	if err != nil {
 		msg := fmt.Sprintf("could not reliably determine existing mount status. Parameters: %v err: %v", params, err)
 		log.Error(msg)
@@ -182,27 +197,47 @@ func nodeStageBlockVolume(
 	}
 
 	if len(mnts) == 0 {
-		// Device isn't mounted anywhere, stage the volume
+		// Device isn't mounted anywhere, clean up what a previous attach of
+		// the device left behind before staging the volume
+		if err := cleanupStaleDevice(ctx, utilexec.New(), dev, params.stagingTarget); err != nil {
+			msg := fmt.Sprintf("failed to clean up stale device of volume %q. Parameters: %v err: %v",
+				params.volID, params, err)
+			log.Error(msg)
+			if errors.Is(err, errDeviceInUse) {
+				return nil, status.Error(codes.FailedPrecondition, msg)
+			}
+			return nil, status.Error(codes.Internal, msg)
+		}
 		// If access mode is read-only, we don't allow formatting
 		if params.ro {
 			log.Debugf("nodeStageBlockVolume: Mounting %q at %q in read-only mode with mount flags %v",
 				dev.FullPath, params.stagingTarget, params.mntFlags)
 			params.mntFlags = append(params.mntFlags, "ro")
-			if err := gofsutil.Mount(ctx, dev.FullPath, params.stagingTarget, params.fsType, params.mntFlags...); err != nil {
+			if err := nodeMounter.Mount(ctx, dev.FullPath, params.stagingTarget, params.fsType, params.mntFlags...); err != nil {
 				msg := fmt.Sprintf("error mounting volume. Parameters: %v err: %v", params, err)
 				log.Error(msg)
-				return nil, status.Errorf(codes.Internal, msg)
+				return nil, status.Errorf(mountErrorCode(err), msg)
 			}
 			log.Infof("nodeStageBlockVolume: Device mounted successfully at %q", params.stagingTarget)
 			return &csi.NodeStageVolumeResponse{}, nil
 		}
+		// Volumes formatted by the in-tree vSphere volume plugin with ext2 or
+		// ext3 may not be resizable online, grow them before mounting.
+		safeMounter := &mount.SafeFormatAndMount{
+			Interface: mount.New(""),
+			Exec:      utilexec.New(),
+		}
+		if err := resizeFilesystemOffline(ctx, safeMounter, dev.RealDev); err != nil {
+			log.Warnf("nodeStageBlockVolume: failed to resize the filesystem of volume %q offline. err: %v",
+				params.volID, err)
+		}
 		// Format and mount the device
 		log.Debugf("nodeStageBlockVolume: Format and mount the device %q at %q with mount flags %v",
 			dev.FullPath, params.stagingTarget, params.mntFlags)
-		if err := gofsutil.FormatAndMount(ctx, dev.FullPath, params.stagingTarget, params.fsType, params.mntFlags...); err != nil {
+		if err := nodeMounter.FormatAndMount(ctx, dev.FullPath, params.stagingTarget, params.fsType, params.mntFlags...); err != nil {
 			msg := fmt.Sprintf("error in formating and mounting volume. Parameters: %v err: %v", params, err)
 			log.Error(msg)
-			return nil, status.Errorf(codes.Internal, msg)
+			return nil, status.Errorf(mountErrorCode(err), msg)
 		}
 	} else {
 		// If Device is already mounted. Need to ensure that it is already
@@ -243,7 +278,7 @@ func (driver *vsphereCSIDriver) NodeUnstageVolume(
 
 	stagingTarget := req.GetStagingTargetPath()
 	// Fetch all the mount points
-	mnts, err := gofsutil.GetMounts(ctx)
+	mnts, err := nodeMounter.GetMounts(ctx)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal,
 			"could not retrieve existing mount points: %v", err)
@@ -276,8 +311,8 @@ func (driver *vsphereCSIDriver) NodeUnstageVolume(
 	// Volume is still mounted. Unstage the volume
 	if isMounted {
 		log.Infof("Attempting to unmount target %q for volume %q", stagingTarget, volID)
-		if err := gofsutil.Unmount(ctx, stagingTarget); err != nil {
-			return nil, status.Errorf(codes.Internal,
+		if err := nodeMounter.Unmount(ctx, stagingTarget); err != nil {
+			return nil, status.Errorf(mountErrorCode(err),
 				"Error unmounting stagingTarget: %v", err)
 		}
 	}
@@ -317,7 +352,7 @@ func isBlockVolumeMounted(
 	log.Debugf("found device: volID: %q, path: %q, block: %q, target: %q", volID, dev.FullPath, dev.RealDev, stagingTargetPath)
 
 	// Get mounts for device
-	mnts, err := gofsutil.GetDevMounts(ctx, dev.RealDev)
+	mnts, err := nodeMounter.GetDevMounts(ctx, dev.RealDev)
 	if err != nil {
 		return false, status.Errorf(codes.Internal,
 			"isBlockVolumeMounted: could not reliably determine existing mount status: %s",
@@ -386,13 +421,27 @@ func (driver *vsphereCSIDriver) NodePublishVolume(
 		// check for Block vs Mount
 		if _, ok := volCap.GetAccessType().(*csi.VolumeCapability_Block); ok {
 			// bind mount device to target
-			return publishBlockVol(ctx, req, dev, params)
+			resp, err := publishBlockVol(ctx, req, dev, params)
+			return trackPublishedVolume(req, resp, err)
 		}
 		// Volume must be a mount volume
-		return publishMountVol(ctx, req, dev, params)
+		resp, err := publishMountVol(ctx, req, dev, params)
+		return trackPublishedVolume(req, resp, err)
 	}
 	// Volume must be a file share
-	return publishFileVol(ctx, req, params)
+	resp, err := publishFileVol(ctx, req, params)
+	return trackPublishedVolume(req, resp, err)
+}
+
+// trackPublishedVolume starts checking the health of the volume once it is
+// published, if the node-volume-health feature is enabled.
+func trackPublishedVolume(req *csi.NodePublishVolumeRequest, resp *csi.NodePublishVolumeResponse, err error) (
+	*csi.NodePublishVolumeResponse, error) {
+	if err == nil && nodeVolumeHealth != nil {
+		nodeVolumeHealth.track(req.GetVolumeId(), req.GetTargetPath(),
+			req.GetReadonly() || common.IsVolumeReadOnly(req.GetVolumeCapability()))
+	}
+	return resp, err
 }
 
 func (driver *vsphereCSIDriver) NodeUnpublishVolume(
@@ -405,6 +454,9 @@ func (driver *vsphereCSIDriver) NodeUnpublishVolume(
 
 	volID := req.GetVolumeId()
 	target := req.GetTargetPath()
+	if nodeVolumeHealth != nil {
+		nodeVolumeHealth.untrack(volID, target)
+	}
 
 	// Verify if the path exists
 	// NOTE: For raw block volumes, this path is a file. In all other cases, it is a directory
@@ -420,7 +472,7 @@ func (driver *vsphereCSIDriver) NodeUnpublishVolume(
 	}
 
 	// Fetch all the mount points
-	mnts, err := gofsutil.GetMounts(ctx)
+	mnts, err := nodeMounter.GetMounts(ctx)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal,
 			"could not retrieve existing mount points: %q",
@@ -448,10 +500,10 @@ func (driver *vsphereCSIDriver) NodeUnpublishVolume(
 
 	if isPublished {
 		log.Infof("NodeUnpublishVolume: Attempting to unmount target %q for volume %q", target, volID)
-		if err := gofsutil.Unmount(ctx, target); err != nil {
+		if err := nodeMounter.Unmount(ctx, target); err != nil {
 			msg := fmt.Sprintf("Error unmounting target %q for volume %q. %q", target, volID, err.Error())
 			log.Debug(msg)
-			return nil, status.Error(codes.Internal, msg)
+			return nil, status.Error(mountErrorCode(err), msg)
 		}
 		log.Debugf("Unmount successful for target %q for volume %q", target, volID)
 		// TODO Use a go routine here. The deletion of target path might not be a good reason to error out
@@ -509,6 +561,19 @@ func (driver *vsphereCSIDriver) NodeGetVolumeStats(
 		return nil, status.Errorf(codes.InvalidArgument, "received empty targetpath %q", targetPath)
 	}
 
+	var condition *csi.VolumeCondition
+	if nodeVolumeHealth != nil {
+		// Volumes published before the node plugin restarted are checked
+		// from their first stats request.
+		nodeVolumeHealth.trackMounted(ctx, req.GetVolumeId(), targetPath)
+		condition = nodeVolumeHealth.getCondition(req.GetVolumeId(), targetPath)
+		if condition != nil && condition.Abnormal {
+			// Getting the stats of an unreachable volume may hang or fail,
+			// report its condition only.
+			return &csi.NodeGetVolumeStatsResponse{VolumeCondition: condition}, nil
+		}
+	}
+
 	volMetrics, err := getMetrics(targetPath)
 	if err != nil {
 		return nil, status.Error(codes.Internal, err.Error())
@@ -555,6 +620,7 @@ func (driver *vsphereCSIDriver) NodeGetVolumeStats(
 				Unit:      csi.VolumeUsage_INODES,
 			},
 		},
+		VolumeCondition: condition,
 	}, nil
 }
 
@@ -583,7 +649,7 @@ func (driver *vsphereCSIDriver) NodeGetCapabilities(
 	req *csi.NodeGetCapabilitiesRequest) (
 	*csi.NodeGetCapabilitiesResponse, error) {
 
-	return &csi.NodeGetCapabilitiesResponse{
+	resp := &csi.NodeGetCapabilitiesResponse{
 		Capabilities: []*csi.NodeServiceCapability{
 			{
 				Type: &csi.NodeServiceCapability_Rpc{
@@ -607,7 +673,17 @@ func (driver *vsphereCSIDriver) NodeGetCapabilities(
 				},
 			},
 		},
-	}, nil
+	}
+	if nodeVolumeHealth != nil {
+		resp.Capabilities = append(resp.Capabilities, &csi.NodeServiceCapability{
+			Type: &csi.NodeServiceCapability_Rpc{
+				Rpc: &csi.NodeServiceCapability_RPC{
+					Type: csi.NodeServiceCapability_RPC_VOLUME_CONDITION,
+				},
+			},
+		})
+	}
+	return resp, nil
 }
 
 /*
@@ -686,52 +762,17 @@ func (driver *vsphereCSIDriver) NodeGetInfo(
 
 	if cfg.Labels.Zone != "" && cfg.Labels.Region != "" {
 		log.Infof("Config file provided to node daemonset with zones and regions. Assuming topology aware cluster.")
-		vcenterconfig, err := cnsvsphere.GetVirtualCenterConfig(ctx, cfg)
-		if err != nil {
-			log.Errorf("failed to get VirtualCenterConfig from cns config. err=%v", err)
-			return nil, status.Errorf(codes.Internal, err.Error())
-		}
 		vcManager := cnsvsphere.GetVirtualCenterManager(ctx)
-		vcenter, err := vcManager.RegisterVirtualCenter(ctx, vcenterconfig)
-		if err != nil {
-			log.Errorf("failed to register vcenter with virtualCenterManager.")
-			return nil, status.Errorf(codes.Internal, err.Error())
-		}
 		defer func() {
-			if vcManager != nil {
-				err = vcManager.UnregisterAllVirtualCenters(ctx)
-				if err != nil {
-					log.Errorf("UnregisterAllVirtualCenters failed. err: %v", err)
-				}
+			err = vcManager.UnregisterAllVirtualCenters(ctx)
+			if err != nil {
+				log.Errorf("UnregisterAllVirtualCenters failed. err: %v", err)
 			}
 		}()
-		//Connect to vCenter
-		err = vcenter.Connect(ctx)
-		if err != nil {
-			log.Errorf("failed to connect to vcenter host: %s. err=%v", vcenter.Config.Host, err)
-			return nil, status.Errorf(codes.Internal, err.Error())
-		}
-		// Get VM UUID
-		uuid, err := getSystemUUID(ctx)
+		vcenter, nodeVM, err := getNodeVM(ctx, cfg)
 		if err != nil {
-			log.Errorf("failed to get system uuid for node VM")
 			return nil, status.Errorf(codes.Internal, err.Error())
 		}
-		log.Debugf("Successfully retrieved uuid:%s  from the node: %s", uuid, nodeID)
-		nodeVM, err := cnsvsphere.GetVirtualMachineByUUID(ctx, uuid, false)
-		if err != nil || nodeVM == nil {
-			log.Errorf("failed to get nodeVM for uuid: %s. err: %+v", uuid, err)
-			uuid, err = convertUUID(uuid)
-			if err != nil {
-				log.Errorf("convertUUID failed with error: %v", err)
-				return nil, status.Errorf(codes.Internal, err.Error())
-			}
-			nodeVM, err = cnsvsphere.GetVirtualMachineByUUID(ctx, uuid, false)
-			if err != nil || nodeVM == nil {
-				log.Errorf("failed to get nodeVM for uuid: %s. err: %+v", uuid, err)
-				return nil, status.Errorf(codes.Internal, err.Error())
-			}
-		}
 		tagManager, err := cnsvsphere.GetTagManager(ctx, vcenter)
 		if err != nil {
 			log.Errorf("failed to create tagManager. Err: %v", err)
@@ -797,6 +838,18 @@ func (driver *vsphereCSIDriver) NodeExpandVolume(
 		return nil, status.Error(codes.InvalidArgument, "volume path must be provided to expand volume on node")
 	}
 
+	// File volumes are expanded by resizing the quota of their file share in
+	// ControllerExpandVolume, there is no filesystem to resize on the node.
+	isFileVolume, err := isFileVolumePath(ctx, req.GetVolumeCapability(), volumePath)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal,
+			"error checking the type of volume: %q, err: %v", volumeID, err)
+	}
+	if isFileVolume {
+		log.Infof("NodeExpandVolume: nothing to do on the node for file volume %q", volumeID)
+		return &csi.NodeExpandVolumeResponse{}, nil
+	}
+
 	// Look up block device mounted to staging target path
 	dev, err := getDevFromMount(volumePath)
 	if err != nil {
@@ -828,7 +881,7 @@ func (driver *vsphereCSIDriver) NodeExpandVolume(
 			// If a device is expanded while it is attached to a VM, we need to rescan
 			// the device on the guest OS in order to see the modified size on the Guest OS
 			// Refer to https://kb.vmware.com/s/article/1006371
-			err = rescanDevice(ctx, dev)
+			err = rescanDevice(ctx, realExec, dev)
 			if err != nil {
 				return nil, status.Error(codes.Internal, err.Error())
 			}
@@ -836,8 +889,12 @@ func (driver *vsphereCSIDriver) NodeExpandVolume(
 	}
 
 	// Resize file system
-	resizer := resizefs.NewResizeFs(mounter)
-	_, err = resizer.Resize(dev.RealDev, volumePath)
+	err = resizeFilesystem(ctx, mounter, dev.RealDev, volumePath)
+	if errors.Is(err, errOnlineResizeUnsupported) {
+		return nil, status.Errorf(codes.FailedPrecondition,
+			"error when resizing filesystem on volume %q on node: %v. The filesystem will be resized when the volume is staged again",
+			volumeID, err)
+	}
 	if err != nil {
 		return nil, status.Error(codes.Internal, fmt.Sprintf("error when resizing filesystem on volume %q on node: %v", volumeID, err))
 	}
@@ -948,10 +1005,10 @@ func publishMountVol(
 	}
 	log.Debugf("PublishMountVolume: Attempting to bind mount %q to %q with mount flags %v",
 		params.stagingTarget, params.target, mntFlags)
-	if err := gofsutil.BindMount(ctx, params.stagingTarget, params.target, mntFlags...); err != nil {
+	if err := nodeMounter.BindMount(ctx, params.stagingTarget, params.target, mntFlags...); err != nil {
 		msg := fmt.Sprintf("error mounting volume. Parameters: %v err: %v", params, err)
 		log.Error(msg)
-		return nil, status.Error(codes.Internal, msg)
+		return nil, status.Error(mountErrorCode(err), msg)
 	}
 	log.Infof("NodePublishVolume for %q successful to path %q", req.GetVolumeId(), params.target)
 	return &csi.NodePublishVolumeResponse{}, nil
@@ -999,10 +1056,10 @@ func publishBlockVol(
 		mntFlags := make([]string, 0)
 		log.Debugf("PublishBlockVolume: Attempting to bind mount %q to %q with mount flags %v",
 			dev.FullPath, params.target, mntFlags)
-		if err := gofsutil.BindMount(ctx, dev.FullPath, params.target, mntFlags...); err != nil {
+		if err := nodeMounter.BindMount(ctx, dev.FullPath, params.target, mntFlags...); err != nil {
 			msg := fmt.Sprintf("error mounting volume. Parameters: %v err: %v", params, err)
 			log.Error(msg)
-			return nil, status.Error(codes.Internal, msg)
+			return nil, status.Error(mountErrorCode(err), msg)
 		}
 		log.Debugf("PublishBlockVolume: Bind mount successful to path %q", params.target)
 	} else if len(devMnts) == 1 {
@@ -1044,7 +1101,7 @@ func publishFileVol(
 	log.Debugf("PublishFileVolume: Created target path %q", params.target)
 
 	// Check if target already mounted
-	mnts, err := gofsutil.GetMounts(ctx)
+	mnts, err := nodeMounter.GetMounts(ctx)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal,
 			"could not retrieve existing mount points: %q",
@@ -1086,8 +1143,8 @@ func publishFileVol(
 	// Directly mount the file share volume to the pod. No bind mount required.
 	log.Debugf("PublishFileVolume: Attempting to mount %q to %q with fstype %q and mountflags %v",
 		mntSrc, params.target, fsType, mntFlags)
-	if err := gofsutil.Mount(ctx, mntSrc, params.target, fsType, mntFlags...); err != nil {
-		return nil, status.Errorf(codes.Internal,
+	if err := nodeMounter.Mount(ctx, mntSrc, params.target, fsType, mntFlags...); err != nil {
+		return nil, status.Errorf(mountErrorCode(err),
 			"error publish volume to target path: %q",
 			err.Error())
 	}
@@ -1100,10 +1157,34 @@ type Device struct {
 	FullPath string
 	Name     string
 	RealDev  string
+	// Multipath is set when the disk is claimed by multipathd. FullPath and
+	// RealDev are then the path of its multipath device in /dev/mapper, as
+	// mounts report it, since its path devices are busy.
+	Multipath *Multipath
+}
+
+// sysfsName returns the name of the device in sysBlockDir, such as sdb, or
+// dm-0 for a multipath device.
+func (dev *Device) sysfsName() string {
+	if dev.Multipath != nil {
+		return dev.Multipath.DMName
+	}
+	return filepath.Base(dev.RealDev)
+}
+
+// diskNames returns the names in sysBlockDir of the disk devices of the
+// device: the paths of a multipath device, or the device itself.
+func (dev *Device) diskNames() []string {
+	if dev.Multipath != nil {
+		return dev.Multipath.Paths
+	}
+	return []string{filepath.Base(dev.RealDev)}
 }
 
 // getDevice returns a Device struct with info about the given device, or
-// an error if it doesn't exist or is not a block device
+// an error if it doesn't exist or is not a block device. A disk claimed by
+// multipathd, whether path resolves to its multipath device or to one of its
+// path devices, is returned as its multipath device.
 func getDevice(path string) (*Device, error) {
 
 	fi, err := os.Lstat(path)
@@ -1121,46 +1202,67 @@ func getDevice(path string) (*Device, error) {
 	if err != nil {
 		return nil, err
 	}
-	dm := ds.Mode()
-	if dm&os.ModeDevice == 0 {
+	if !isBlockDevice(ds) {
 		return nil, fmt.Errorf(
 			"%s is not a block device", path)
 	}
 
-	return &Device{
+	dev := &Device{
 		Name:     fi.Name(),
 		FullPath: path,
 		RealDev:  d,
-	}, nil
+	}
+	multipath, err := getMultipath(filepath.Base(d))
+	if err != nil {
+		return nil, err
+	}
+	if multipath != nil {
+		dev.Multipath = multipath
+		dev.RealDev = filepath.Join(devDir, "mapper", multipath.MapName)
+		dev.FullPath = dev.RealDev
+	}
+	return dev, nil
 }
 
-func rescanDevice(ctx context.Context, dev *Device) error {
+func rescanDevice(ctx context.Context, exec utilexec.Interface, dev *Device) error {
 	ctx = logger.NewContextWithLogger(ctx)
 	log := logger.GetLogger(ctx)
 
-	devRescanPath, err := getDeviceRescanPath(dev)
-	if err != nil {
-		return err
-	}
+	for _, name := range dev.diskNames() {
+		devRescanPath, err := getDeviceRescanPath(name)
+		if err != nil {
+			return err
+		}
 
-	err = ioutil.WriteFile(devRescanPath, []byte{'1'}, 0666)
-	if err != nil {
-		msg := fmt.Sprintf("error rescanning block device %q. %v", dev.RealDev, err)
-		log.Error(msg)
-		return fmt.Errorf(msg)
+		err = ioutil.WriteFile(devRescanPath, []byte{'1'}, 0666)
+		if err != nil {
+			msg := fmt.Sprintf("error rescanning block device %q. %v", name, err)
+			log.Error(msg)
+			return fmt.Errorf(msg)
+		}
+	}
+	if dev.Multipath != nil {
+		// The multipath map keeps its size until multipathd reloads it with
+		// the size of the rescanned paths.
+		output, err := exec.Command("multipathd", "resize", "map", dev.Multipath.MapName).CombinedOutput()
+		if err != nil {
+			msg := fmt.Sprintf("error resizing multipath device %q. %v. multipathd output: %s",
+				dev.RealDev, err, string(output))
+			log.Error(msg)
+			return fmt.Errorf(msg)
+		}
 	}
 	return nil
 }
 
-func getDeviceRescanPath(dev *Device) (string, error) {
-	// A typical dev.RealDev path looks like `/dev/sda`. To rescan a block
-	// device we need to write into `/sys/block/$DEVICE/device/rescan`
+func getDeviceRescanPath(name string) (string, error) {
+	// To rescan a block device such as `/dev/sda` we need to write into
+	// `/sys/block/$DEVICE/device/rescan`
 	// Refer to https://kb.vmware.com/s/article/1006371
-	parts := strings.Split(dev.RealDev, "/")
-	if len(parts) == 3 && strings.HasPrefix(parts[1], "dev") {
-		return filepath.EvalSymlinks(filepath.Join("/sys/block", parts[2], "device", "rescan"))
+	if name == "" || strings.Contains(name, "/") {
+		return "", fmt.Errorf("illegal name for device %q", name)
 	}
-	return "", fmt.Errorf("illegal path for device %q", dev.RealDev)
+	return filepath.EvalSymlinks(filepath.Join(sysBlockDir, name, "device", "rescan"))
 }
 
 // The files parameter is optional for testing purposes
@@ -1179,9 +1281,17 @@ func getDiskPath(id string, files []os.FileInfo) (string, error) {
 		devs = files
 	}
 	targetDisk := blockPrefix + id
+	// Disks attached to NVMe controllers are identified by their EUI instead.
+	targetNVMeDisk := nvmePrefix + id
 
 	for _, f := range devs {
-		if f.Name() == targetDisk {
+		if f.Name() == targetDisk || f.Name() == targetNVMeDisk {
+			return filepath.Join(devDiskID, f.Name()), nil
+		}
+	}
+	// Some NVMe namespaces have no EUI, they are matched by their serial.
+	for _, f := range devs {
+		if isNVMeSerialLink(f.Name(), id) {
 			return filepath.Join(devDiskID, f.Name()), nil
 		}
 	}
@@ -1207,14 +1317,136 @@ func verifyVolumeAttached(ctx context.Context, diskID string) (string, error) {
 			"Error trying to read attached disks: %v", err)
 	}
 	if volPath == "" {
-		return "", status.Errorf(codes.NotFound,
-			"disk: %s not attached to node", diskID)
+		volPath, err = getDiskPathFromSysfs(diskID)
+		if err != nil {
+			return "", status.Errorf(codes.Internal,
+				"Error trying to read the identifiers of block devices: %v", err)
+		}
+		if volPath == "" {
+			return "", diskNotFoundError(ctx, diskID)
+		}
+		log.Debugf("disk %q has no link in %s, found it from its identifier in %s", diskID, devDiskID, sysBlockDir)
 	}
 
 	log.Debugf("found disk: disk ID: %q, volume path: %q", diskID, volPath)
 	return volPath, nil
 }
 
+// diskNotFoundError returns the error for the disk diskID not found in
+// devDiskID. Unless disk.EnableUUID is TRUE on the node VM, the guest OS
+// doesn't see the UUIDs of the disks and no wwn-0x links are created, so the
+// setting is checked on vCenter if the node has the vCenter config, or guessed
+// from the missing links otherwise.
+func diskNotFoundError(ctx context.Context, diskID string) error {
+	log := logger.GetLogger(ctx)
+	enabled, err := isNodeDiskUUIDEnabled(ctx)
+	if err != nil {
+		log.Debugf("failed to check disk.EnableUUID on the node VM. err: %v", err)
+		if !hasWWNDisks() {
+			return status.Errorf(codes.NotFound, "disk: %s not attached to node. No disk of the node has "+
+				"a %s link in %s, check that disk.EnableUUID is set to TRUE on the node VM", diskID, blockPrefix,
+				devDiskID)
+		}
+	} else if !enabled {
+		return status.Errorf(codes.FailedPrecondition, "disk: %s can't be found on node because disk.EnableUUID "+
+			"isn't set to TRUE on the node VM. Power off the VM, set disk.EnableUUID to TRUE in its advanced "+
+			"configuration parameters and power it on", diskID)
+	}
+	return status.Errorf(codes.NotFound, "disk: %s not attached to node", diskID)
+}
+
+// hasWWNDisks returns true if a disk of the node has a wwn-0x link in devDiskID.
+func hasWWNDisks() bool {
+	devs, err := ioutil.ReadDir(devDiskID)
+	if err != nil {
+		return false
+	}
+	for _, dev := range devs {
+		if strings.HasPrefix(dev.Name(), blockPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isNodeDiskUUIDEnabled returns true if disk.EnableUUID is TRUE on the node VM,
+// which is checked on the vCenter of the config provided to the node.
+var isNodeDiskUUIDEnabled = func(ctx context.Context) (bool, error) {
+	log := logger.GetLogger(ctx)
+	cfgPath := os.Getenv(cnsconfig.EnvVSphereCSIConfig)
+	if cfgPath == "" {
+		cfgPath = cnsconfig.DefaultCloudConfigPath
+	}
+	cfg, err := cnsconfig.GetCnsconfig(ctx, cfgPath)
+	if err != nil {
+		return false, err
+	}
+	vcManager := cnsvsphere.GetVirtualCenterManager(ctx)
+	defer func() {
+		if err := vcManager.UnregisterAllVirtualCenters(ctx); err != nil {
+			log.Errorf("UnregisterAllVirtualCenters failed. err: %v", err)
+		}
+	}()
+	_, nodeVM, err := getNodeVM(ctx, cfg)
+	if err != nil {
+		return false, err
+	}
+	return nodeVM.IsDiskUUIDEnabled(ctx)
+}
+
+// getNodeVM connects to the vCenters in cfg and returns the VM of the node
+// with its vCenter. The caller is responsible for unregistering the vCenters.
+func getNodeVM(ctx context.Context, cfg *cnsconfig.Config) (*cnsvsphere.VirtualCenter,
+	*cnsvsphere.VirtualMachine, error) {
+	log := logger.GetLogger(ctx)
+	vcenterconfigs, err := cnsvsphere.GetVirtualCenterConfigs(ctx, cfg)
+	if err != nil {
+		log.Errorf("failed to get VirtualCenterConfigs from cns config. err=%v", err)
+		return nil, nil, err
+	}
+	vcManager := cnsvsphere.GetVirtualCenterManager(ctx)
+	for _, vcenterconfig := range vcenterconfigs {
+		vcenter, err := vcManager.RegisterVirtualCenter(ctx, vcenterconfig)
+		if err != nil {
+			log.Errorf("failed to register vcenter with virtualCenterManager.")
+			return nil, nil, err
+		}
+		//Connect to vCenter
+		err = vcenter.Connect(ctx)
+		if err != nil {
+			log.Errorf("failed to connect to vcenter host: %s. err=%v", vcenter.Config.Host, err)
+			return nil, nil, err
+		}
+	}
+	// Get VM UUID
+	uuid, err := getSystemUUID(ctx)
+	if err != nil {
+		log.Errorf("failed to get system uuid for node VM")
+		return nil, nil, err
+	}
+	log.Debugf("Successfully retrieved uuid:%s from the node", uuid)
+	nodeVM, err := cnsvsphere.GetVirtualMachineByUUID(ctx, uuid, false)
+	if err != nil || nodeVM == nil {
+		log.Errorf("failed to get nodeVM for uuid: %s. err: %+v", uuid, err)
+		uuid, err = convertUUID(uuid)
+		if err != nil {
+			log.Errorf("convertUUID failed with error: %v", err)
+			return nil, nil, err
+		}
+		nodeVM, err = cnsvsphere.GetVirtualMachineByUUID(ctx, uuid, false)
+		if err != nil || nodeVM == nil {
+			log.Errorf("failed to get nodeVM for uuid: %s. err: %+v", uuid, err)
+			return nil, nil, fmt.Errorf("failed to get the VM of the node with uuid %s. err: %v", uuid, err)
+		}
+	}
+	vcenter, err := vcManager.GetVirtualCenter(ctx, nodeVM.VirtualCenterHost)
+	if err != nil {
+		log.Errorf("failed to get vcenter %s of nodeVM: %v. err=%v", nodeVM.VirtualCenterHost, nodeVM, err)
+		return nil, nil, err
+	}
+	return vcenter, nodeVM, nil
+}
+
 // verifyTargetDir checks if the target path is not empty, exists and is a directory
 // if targetShouldExist is set to false, then verifyTargetDir returns (false, nil) if the path does not exist.
 // if targetShouldExist is set to true, then verifyTargetDir returns (false, err) if the path does not exist.
@@ -1322,13 +1554,13 @@ func ensureMountVol(ctx context.Context, volCap *csi.VolumeCapability) (string,
 	return fs, mntFlags, nil
 }
 
-// a wrapper around gofsutil.GetMounts that handles bind mounts
+// a wrapper around Mounter.GetMounts that handles bind mounts
 func getDevMounts(ctx context.Context,
 	sysDevice *Device) ([]gofsutil.Info, error) {
 
 	devMnts := make([]gofsutil.Info, 0)
 
-	mnts, err := gofsutil.GetMounts(ctx)
+	mnts, err := nodeMounter.GetMounts(ctx)
 	if err != nil {
 		return devMnts, err
 	}
@@ -1379,10 +1611,28 @@ func getDiskID(pubCtx map[string]string) (string, error) {
 	return diskID, nil
 }
 
+// isFileVolumePath returns whether the volume with the given capability,
+// mounted at target, is a file volume: its fstype is nfs or nfs4, or target is
+// an NFS mount.
+func isFileVolumePath(ctx context.Context, volCap *csi.VolumeCapability, target string) (bool, error) {
+	fsType := strings.ToLower(volCap.GetMount().GetFsType())
+	if fsType == common.NfsFsType || fsType == common.NfsV4FsType {
+		return true, nil
+	}
+	mnts, err := nodeMounter.GetMounts(ctx)
+	if err != nil {
+		return false, err
+	}
+	if !common.IsTargetInMounts(ctx, target, mnts) {
+		return false, nil
+	}
+	return common.IsFileVolumeMount(ctx, target, mnts)
+}
+
 func getDevFromMount(target string) (*Device, error) {
 
 	// Get list of all mounts on system
-	mnts, err := gofsutil.GetMounts(context.Background())
+	mnts, err := nodeMounter.GetMounts(context.Background())
 	if err != nil {
 		return nil, err
 	}
@@ -17,17 +17,30 @@ limitations under the License.
 package service
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/akutz/gofsutil"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/common"
 )
 
 func TestGetDisk(t *testing.T) {
 	tests := []struct {
-		devs  []os.FileInfo
-		volID string
-		match bool
+		devs   []os.FileInfo
+		volID  string
+		prefix string
+		link   string
+		match  bool
 	}{
 		{
 			devs: []os.FileInfo{
@@ -45,6 +58,24 @@ func TestGetDisk(t *testing.T) {
 			volID: "702438570234875",
 			match: false,
 		},
+		{
+			devs: []os.FileInfo{
+				&FakeFileInfo{name: "nvme-eui.6000c29a4fb3b4a54c3b4a0f1e2d3c4b"},
+				&FakeFileInfo{name: "wwn-0x702345804753484"},
+			},
+			volID:  "6000c29a4fb3b4a54c3b4a0f1e2d3c4b",
+			prefix: nvmePrefix,
+			match:  true,
+		},
+		{
+			devs: []os.FileInfo{
+				&FakeFileInfo{name: "nvme-VMware_Virtual_NVMe_Disk_6000C29A4FB3B4A54C3B4A0F1E2D3C4B-part1"},
+				&FakeFileInfo{name: "nvme-VMware_Virtual_NVMe_Disk_6000C29A4FB3B4A54C3B4A0F1E2D3C4B"},
+			},
+			volID: "6000c29a4fb3b4a54c3b4a0f1e2d3c4b",
+			link:  "nvme-VMware_Virtual_NVMe_Disk_6000C29A4FB3B4A54C3B4A0F1E2D3C4B",
+			match: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -56,7 +87,14 @@ func TestGetDisk(t *testing.T) {
 				t.Errorf("%v", e)
 			}
 
-			disk := filepath.Join(devDiskID, blockPrefix+tt.volID)
+			prefix := blockPrefix
+			if tt.prefix != "" {
+				prefix = tt.prefix
+			}
+			disk := filepath.Join(devDiskID, prefix+tt.volID)
+			if tt.link != "" {
+				disk = filepath.Join(devDiskID, tt.link)
+			}
 			if tt.match {
 				if d != disk {
 					t.Errorf("Expected disk: %s got: %s", disk, d)
@@ -97,3 +135,395 @@ func (fi *FakeFileInfo) IsDir() bool {
 func (fi *FakeFileInfo) Sys() interface{} {
 	return nil
 }
+
+const testDiskUUID = "6000c29a8b2a58d4e2b1e2c1a1f5b1f4"
+
+func mountCapability(mode csi.VolumeCapability_AccessMode_Mode) *csi.VolumeCapability {
+	return &csi.VolumeCapability{
+		AccessType: &csi.VolumeCapability_Mount{
+			Mount: &csi.VolumeCapability_MountVolume{FsType: "ext4"},
+		},
+		AccessMode: &csi.VolumeCapability_AccessMode{Mode: mode},
+	}
+}
+
+func blockCapability() *csi.VolumeCapability {
+	return &csi.VolumeCapability{
+		AccessType: &csi.VolumeCapability_Block{
+			Block: &csi.VolumeCapability_BlockVolume{},
+		},
+		AccessMode: &csi.VolumeCapability_AccessMode{
+			Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+		},
+	}
+}
+
+func publishContext() map[string]string {
+	return map[string]string{common.AttributeFirstClassDiskUUID: testDiskUUID}
+}
+
+func expectCode(t *testing.T, err error, code codes.Code) {
+	t.Helper()
+	if code == codes.OK {
+		if err != nil {
+			t.Fatalf("expected success, got %v", err)
+		}
+		return
+	}
+	if s, _ := status.FromError(err); err == nil || s.Code() != code {
+		t.Fatalf("expected error with code %s, got %v", code, err)
+	}
+}
+
+func TestNodeStageVolume(t *testing.T) {
+	driver := &vsphereCSIDriver{}
+	tests := []struct {
+		name string
+		// mounts are the existing mounts of the node, with the device path
+		// and staging directory filled in by the test.
+		mounts  func(dev, stagingTarget string) []gofsutil.Info
+		mode    csi.VolumeCapability_AccessMode_Mode
+		attach  bool
+		code    codes.Code
+		format  bool
+		wantOpt string
+	}{
+		{
+			name:    "formats and mounts an unmounted device",
+			mode:    csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+			attach:  true,
+			code:    codes.OK,
+			format:  true,
+			wantOpt: "rw",
+		},
+		{
+			name:    "mounts a read-only device without formatting it",
+			mode:    csi.VolumeCapability_AccessMode_SINGLE_NODE_READER_ONLY,
+			attach:  true,
+			code:    codes.OK,
+			wantOpt: "ro",
+		},
+		{
+			name: "succeeds when already staged with the same access mode",
+			mounts: func(dev, stagingTarget string) []gofsutil.Info {
+				return []gofsutil.Info{{Device: dev, Path: stagingTarget, Opts: []string{"rw"}}}
+			},
+			mode:    csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+			attach:  true,
+			code:    codes.OK,
+			wantOpt: "rw",
+		},
+		{
+			name: "fails when already staged with a different access mode",
+			mounts: func(dev, stagingTarget string) []gofsutil.Info {
+				return []gofsutil.Info{{Device: dev, Path: stagingTarget, Opts: []string{"ro"}}}
+			},
+			mode:   csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+			attach: true,
+			code:   codes.AlreadyExists,
+		},
+		{
+			name: "fails when the device is mounted elsewhere",
+			mounts: func(dev, stagingTarget string) []gofsutil.Info {
+				return []gofsutil.Info{{Device: dev, Path: "/elsewhere", Opts: []string{"rw"}}}
+			},
+			mode:   csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+			attach: true,
+			code:   codes.Internal,
+		},
+		{
+			name: "replaces a stale mount of a previous device at the staging target",
+			mounts: func(dev, stagingTarget string) []gofsutil.Info {
+				return []gofsutil.Info{{Device: "/dev/sdz", Path: stagingTarget, Opts: []string{"rw"}}}
+			},
+			mode:    csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+			attach:  true,
+			code:    codes.OK,
+			format:  true,
+			wantOpt: "rw",
+		},
+		{
+			name: "fails when the disk is not attached",
+			mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+			code: codes.NotFound,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			layout, mounter := newFakeNode(t)
+			stagingTarget := layout.mkdir(t, "globalmount")
+			var dev string
+			if tt.attach {
+				dev = layout.attachDisk(t, testDiskUUID, "sdb")
+			}
+			if tt.mounts != nil {
+				mounter.mounts = tt.mounts(dev, stagingTarget)
+			}
+
+			_, err := driver.NodeStageVolume(context.Background(), &csi.NodeStageVolumeRequest{
+				VolumeId:          "volume",
+				PublishContext:    publishContext(),
+				StagingTargetPath: stagingTarget,
+				VolumeCapability:  mountCapability(tt.mode),
+			})
+			expectCode(t, err, tt.code)
+			if tt.format != (len(mounter.formatted) > 0) {
+				t.Fatalf("expected format %v, formatted %v", tt.format, mounter.formatted)
+			}
+			if tt.code != codes.OK {
+				return
+			}
+			mnts, _ := mounter.GetDevMounts(context.Background(), dev)
+			if len(mnts) != 1 || mnts[0].Path != stagingTarget || !contains(mnts[0].Opts, tt.wantOpt) {
+				t.Fatalf("expected %s to be mounted %s at %s, got %+v", dev, tt.wantOpt, stagingTarget, mnts)
+			}
+		})
+	}
+}
+
+func TestNodeStageVolumeDiskUUIDDisabled(t *testing.T) {
+	driver := &vsphereCSIDriver{}
+	tests := []struct {
+		name string
+		// enabled and err are the result of the check of disk.EnableUUID on vCenter.
+		enabled bool
+		err     error
+		// otherDisk attaches another disk to the node.
+		otherDisk bool
+		code      codes.Code
+		hint      bool
+	}{
+		{
+			name: "reports disk.EnableUUID disabled on vCenter",
+			code: codes.FailedPrecondition,
+			hint: true,
+		},
+		{
+			name:    "reports a detached disk when disk.EnableUUID is enabled",
+			enabled: true,
+			code:    codes.NotFound,
+		},
+		{
+			name: "suggests disk.EnableUUID when no disk has a wwn link",
+			err:  errors.New("config not found"),
+			code: codes.NotFound,
+			hint: true,
+		},
+		{
+			name:      "reports a detached disk when other disks have wwn links",
+			err:       errors.New("config not found"),
+			otherDisk: true,
+			code:      codes.NotFound,
+		},
+	}
+	origIsNodeDiskUUIDEnabled := isNodeDiskUUIDEnabled
+	defer func() { isNodeDiskUUIDEnabled = origIsNodeDiskUUIDEnabled }()
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			layout, _ := newFakeNode(t)
+			stagingTarget := layout.mkdir(t, "globalmount")
+			if tt.otherDisk {
+				layout.attachDisk(t, "6000c2945a5e5f3e1b6a2c8d0e1f2a3b", "sdc")
+			}
+			isNodeDiskUUIDEnabled = func(ctx context.Context) (bool, error) {
+				return tt.enabled, tt.err
+			}
+
+			_, err := driver.NodeStageVolume(context.Background(), &csi.NodeStageVolumeRequest{
+				VolumeId:          "volume",
+				PublishContext:    publishContext(),
+				StagingTargetPath: stagingTarget,
+				VolumeCapability:  mountCapability(csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER),
+			})
+			expectCode(t, err, tt.code)
+			if hint := strings.Contains(err.Error(), "disk.EnableUUID"); hint != tt.hint {
+				t.Fatalf("expected disk.EnableUUID hint %v, got %v", tt.hint, err)
+			}
+		})
+	}
+}
+
+func TestNodePublishMountVolume(t *testing.T) {
+	driver := &vsphereCSIDriver{}
+	publish := func(t *testing.T, stagingTarget, target string, ro bool) error {
+		_, err := driver.NodePublishVolume(context.Background(), &csi.NodePublishVolumeRequest{
+			VolumeId:          "volume",
+			PublishContext:    publishContext(),
+			StagingTargetPath: stagingTarget,
+			TargetPath:        target,
+			VolumeCapability:  mountCapability(csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER),
+			Readonly:          ro,
+		})
+		return err
+	}
+	setup := func(t *testing.T, staged bool) (*fakeMounter, string, string) {
+		layout, mounter := newFakeNode(t)
+		dev := layout.attachDisk(t, testDiskUUID, "sdb")
+		stagingTarget := layout.mkdir(t, "globalmount")
+		if staged {
+			mounter.mounts = []gofsutil.Info{{Device: dev, Path: stagingTarget, Opts: []string{"rw"}}}
+		}
+		return mounter, stagingTarget, filepath.Join(layout.root, "mount")
+	}
+
+	t.Run("fails when the volume is not staged", func(t *testing.T) {
+		_, stagingTarget, target := setup(t, false)
+		expectCode(t, publish(t, stagingTarget, target, false), codes.FailedPrecondition)
+	})
+
+	for _, ro := range []bool{false, true} {
+		ro := ro
+		t.Run(fmt.Sprintf("bind mounts the staging target with readonly %v", ro), func(t *testing.T) {
+			mounter, stagingTarget, target := setup(t, true)
+			expectCode(t, publish(t, stagingTarget, target, ro), codes.OK)
+			wantOpt := "rw"
+			if ro {
+				wantOpt = "ro"
+			}
+			mnts, _ := mounter.GetMounts(context.Background())
+			if len(mnts) != 2 || mnts[1].Path != target || mnts[1].Source != stagingTarget ||
+				!contains(mnts[1].Opts, wantOpt) {
+				t.Fatalf("expected %s to be bind mounted %s at %s, got %+v", stagingTarget, wantOpt, target, mnts)
+			}
+			if fi, err := os.Stat(target); err != nil || !fi.IsDir() {
+				t.Fatalf("target directory %s was not created: %v", target, err)
+			}
+		})
+	}
+
+	t.Run("succeeds when already published", func(t *testing.T) {
+		mounter, stagingTarget, target := setup(t, true)
+		expectCode(t, publish(t, stagingTarget, target, false), codes.OK)
+		expectCode(t, publish(t, stagingTarget, target, false), codes.OK)
+		if mnts, _ := mounter.GetMounts(context.Background()); len(mnts) != 2 {
+			t.Fatalf("expected a single publish mount, got %+v", mnts)
+		}
+	})
+
+	t.Run("fails when already published with different options", func(t *testing.T) {
+		_, stagingTarget, target := setup(t, true)
+		expectCode(t, publish(t, stagingTarget, target, false), codes.OK)
+		expectCode(t, publish(t, stagingTarget, target, true), codes.AlreadyExists)
+	})
+}
+
+func TestNodePublishBlockVolume(t *testing.T) {
+	driver := &vsphereCSIDriver{}
+	for _, tt := range []struct {
+		name string
+		ro   bool
+		code codes.Code
+	}{
+		{name: "bind mounts the device", code: codes.OK},
+		{name: "fails when read-only", ro: true, code: codes.InvalidArgument},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			layout, mounter := newFakeNode(t)
+			dev := layout.attachDisk(t, testDiskUUID, "sdb")
+			target := filepath.Join(layout.root, "publish")
+			req := &csi.NodePublishVolumeRequest{
+				VolumeId:          "volume",
+				PublishContext:    publishContext(),
+				StagingTargetPath: layout.mkdir(t, "staging"),
+				TargetPath:        target,
+				VolumeCapability:  blockCapability(),
+				Readonly:          tt.ro,
+			}
+			_, err := driver.NodePublishVolume(context.Background(), req)
+			expectCode(t, err, tt.code)
+			if tt.code != codes.OK {
+				return
+			}
+			// Publishing again is a no-op.
+			_, err = driver.NodePublishVolume(context.Background(), req)
+			expectCode(t, err, codes.OK)
+			mnts, _ := mounter.GetMounts(context.Background())
+			if len(mnts) != 1 || mnts[0].Path != target || mnts[0].Source != dev {
+				t.Fatalf("expected %s to be bind mounted at %s, got %+v", dev, target, mnts)
+			}
+		})
+	}
+}
+
+func TestNodeUnpublishVolume(t *testing.T) {
+	driver := &vsphereCSIDriver{}
+	unpublish := func(target string) error {
+		_, err := driver.NodeUnpublishVolume(context.Background(), &csi.NodeUnpublishVolumeRequest{
+			VolumeId:   "volume",
+			TargetPath: target,
+		})
+		return err
+	}
+
+	t.Run("succeeds when the target does not exist", func(t *testing.T) {
+		layout, _ := newFakeNode(t)
+		expectCode(t, unpublish(filepath.Join(layout.root, "mount")), codes.OK)
+	})
+
+	t.Run("succeeds when the target is not mounted", func(t *testing.T) {
+		layout, _ := newFakeNode(t)
+		expectCode(t, unpublish(layout.mkdir(t, "mount")), codes.OK)
+	})
+
+	t.Run("unmounts and removes a published target", func(t *testing.T) {
+		layout, mounter := newFakeNode(t)
+		dev := layout.attachDisk(t, testDiskUUID, "sdb")
+		stagingTarget := layout.mkdir(t, "globalmount")
+		target := layout.mkdir(t, "mount")
+		mounter.mounts = []gofsutil.Info{
+			{Device: dev, Path: stagingTarget, Opts: []string{"rw"}},
+			{Device: dev, Path: target, Source: stagingTarget, Type: "ext4", Opts: []string{"rw"}},
+		}
+		expectCode(t, unpublish(target), codes.OK)
+		if mnts, _ := mounter.GetMounts(context.Background()); len(mnts) != 1 || mnts[0].Path != stagingTarget {
+			t.Fatalf("expected only the staging mount to remain, got %+v", mnts)
+		}
+		if _, err := os.Stat(target); !os.IsNotExist(err) {
+			t.Fatalf("target %s was not removed: %v", target, err)
+		}
+	})
+
+	t.Run("fails when unmount fails", func(t *testing.T) {
+		layout, mounter := newFakeNode(t)
+		dev := layout.attachDisk(t, testDiskUUID, "sdb")
+		target := layout.mkdir(t, "mount")
+		mounter.mounts = []gofsutil.Info{{Device: dev, Path: target, Type: "ext4", Opts: []string{"rw"}}}
+		mounter.err = errors.New("device busy")
+		expectCode(t, unpublish(target), codes.Internal)
+	})
+}
+
+func TestNodeExpandFileVolume(t *testing.T) {
+	driver := &vsphereCSIDriver{}
+	expand := func(target string, fsType string) error {
+		_, err := driver.NodeExpandVolume(context.Background(), &csi.NodeExpandVolumeRequest{
+			VolumeId:      "file:volume",
+			VolumePath:    target,
+			CapacityRange: &csi.CapacityRange{RequiredBytes: 2 * common.GbInBytes},
+			VolumeCapability: &csi.VolumeCapability{
+				AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{FsType: fsType}},
+			},
+		})
+		return err
+	}
+
+	t.Run("succeeds for an nfs4 mount", func(t *testing.T) {
+		layout, mounter := newFakeNode(t)
+		target := layout.mkdir(t, "mount")
+		mounter.addMount("nfs-server:/share", target, "nfs-server:/share", common.NfsV4FsType, nil)
+		expectCode(t, expand(target, ""), codes.OK)
+	})
+
+	t.Run("succeeds for an nfs fstype", func(t *testing.T) {
+		layout, _ := newFakeNode(t)
+		expectCode(t, expand(layout.mkdir(t, "mount"), common.NfsFsType), codes.OK)
+	})
+
+	t.Run("fails for an unmounted block volume", func(t *testing.T) {
+		layout, _ := newFakeNode(t)
+		expectCode(t, expand(layout.mkdir(t, "mount"), common.Ext4FsType), codes.Internal)
+	})
+}
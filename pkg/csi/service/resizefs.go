@@ -0,0 +1,159 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/context"
+	mount "k8s.io/mount-utils"
+
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
+)
+
+// errOnlineResizeUnsupported is returned when the filesystem can't be resized
+// while it is mounted, such as ext2 or ext3 volumes formatted by the in-tree
+// vSphere volume plugin without the resize_inode feature. These are resized
+// offline the next time the volume is staged, see resizeFilesystemOffline.
+var errOnlineResizeUnsupported = errors.New("online resize of the filesystem isn't supported")
+
+// resizeFilesystem grows the filesystem on devicePath, mounted at mountPath,
+// to the size of the device with the tool of the filesystem actually found on
+// the device, instead of the one the volume was requested with.
+func resizeFilesystem(ctx context.Context, mounter *mount.SafeFormatAndMount,
+	devicePath string, mountPath string) error {
+	log := logger.GetLogger(ctx)
+	format, err := mounter.GetDiskFormat(devicePath)
+	if err != nil {
+		return fmt.Errorf("error checking the filesystem of device %s: %v", devicePath, err)
+	}
+	log.Debugf("resizeFilesystem: found filesystem %q on device %s", format, devicePath)
+	switch format {
+	case "":
+		// Not formatted yet, mkfs will use the whole device.
+		return nil
+	case "ext2", "ext3", "ext4":
+		output, err := mounter.Exec.Command("resize2fs", devicePath).CombinedOutput()
+		if err != nil {
+			if isOnlineResizeUnsupported(string(output)) {
+				return fmt.Errorf("%w: %s filesystem on device %s mounted at %s, resize2fs output: %s",
+					errOnlineResizeUnsupported, format, devicePath, mountPath, string(output))
+			}
+			return fmt.Errorf("resize of %s filesystem on device %s failed: %v. resize2fs output: %s",
+				format, devicePath, err, string(output))
+		}
+	case "xfs":
+		output, err := mounter.Exec.Command("xfs_growfs", "-d", mountPath).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("resize of xfs filesystem mounted at %s failed: %v. xfs_growfs output: %s",
+				mountPath, err, string(output))
+		}
+	default:
+		return fmt.Errorf("resize of %s filesystem on device %s isn't supported", format, devicePath)
+	}
+	log.Infof("resizeFilesystem: resized %s filesystem on device %s", format, devicePath)
+	return nil
+}
+
+// isOnlineResizeUnsupported returns true if the output of resize2fs reports
+// that the mounted filesystem can't be resized.
+func isOnlineResizeUnsupported(output string) bool {
+	output = strings.ToLower(output)
+	return strings.Contains(output, "on-line resizing") || strings.Contains(output, "online resizing")
+}
+
+// resizeFilesystemOffline grows the unmounted ext2 or ext3 filesystem on
+// devicePath to the size of the device if it is smaller, as these
+// filesystems may not support being resized once mounted. Other filesystems
+// are resized online by NodeExpandVolume.
+func resizeFilesystemOffline(ctx context.Context, mounter *mount.SafeFormatAndMount, devicePath string) error {
+	log := logger.GetLogger(ctx)
+	format, err := mounter.GetDiskFormat(devicePath)
+	if err != nil {
+		return fmt.Errorf("error checking the filesystem of device %s: %v", devicePath, err)
+	}
+	if format != "ext2" && format != "ext3" {
+		return nil
+	}
+	fsSizeBytes, err := getExtFilesystemSizeBytes(mounter, devicePath)
+	if err != nil {
+		return err
+	}
+	deviceSizeBytes, err := getBlockSizeBytes(mounter, devicePath)
+	if err != nil {
+		return err
+	}
+	if fsSizeBytes >= deviceSizeBytes {
+		return nil
+	}
+	log.Infof("resizeFilesystemOffline: growing %s filesystem on device %s from %d to %d bytes",
+		format, devicePath, fsSizeBytes, deviceSizeBytes)
+	// resize2fs requires a freshly checked filesystem. e2fsck exits with 1
+	// when it fixed errors.
+	output, err := mounter.Exec.Command("e2fsck", "-f", "-p", devicePath).CombinedOutput()
+	if err != nil && !isExitStatus(err, 1) {
+		return fmt.Errorf("check of %s filesystem on device %s failed: %v. e2fsck output: %s",
+			format, devicePath, err, string(output))
+	}
+	output, err = mounter.Exec.Command("resize2fs", devicePath).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("offline resize of %s filesystem on device %s failed: %v. resize2fs output: %s",
+			format, devicePath, err, string(output))
+	}
+	log.Infof("resizeFilesystemOffline: resized %s filesystem on device %s", format, devicePath)
+	return nil
+}
+
+// getExtFilesystemSizeBytes returns the size of the ext filesystem on
+// devicePath from its superblock.
+func getExtFilesystemSizeBytes(mounter *mount.SafeFormatAndMount, devicePath string) (int64, error) {
+	output, err := mounter.Exec.Command("dumpe2fs", "-h", devicePath).CombinedOutput()
+	if err != nil {
+		return -1, fmt.Errorf("error reading the superblock of device %s: output: %s, err: %v",
+			devicePath, string(output), err)
+	}
+	var blockCount, blockSize int64
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.SplitN(line, ":", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		value := strings.TrimSpace(fields[1])
+		switch strings.TrimSpace(fields[0]) {
+		case "Block count":
+			blockCount, err = strconv.ParseInt(value, 10, 64)
+		case "Block size":
+			blockSize, err = strconv.ParseInt(value, 10, 64)
+		}
+		if err != nil {
+			return -1, fmt.Errorf("failed to parse %q of the superblock of device %s: %v", line, devicePath, err)
+		}
+	}
+	if blockCount == 0 || blockSize == 0 {
+		return -1, fmt.Errorf("block count or size not found in the superblock of device %s", devicePath)
+	}
+	return blockCount * blockSize, nil
+}
+
+// isExitStatus returns true if err is the exit of a command with the status.
+func isExitStatus(err error, exitStatus int) bool {
+	var exitErr interface{ ExitStatus() int }
+	return errors.As(err, &exitErr) && exitErr.ExitStatus() == exitStatus
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"golang.org/x/net/context"
+	mount "k8s.io/mount-utils"
+	utilexec "k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+// fakeCommand is the output of a command run by the fake mounter.
+type fakeCommand struct {
+	output string
+	err    error
+}
+
+// newFakeResizeMounter returns a mounter running the given commands in order,
+// and the commands it ran.
+func newFakeResizeMounter(commands []fakeCommand) (*mount.SafeFormatAndMount, *[][]string) {
+	var ran [][]string
+	fakeExec := &testingexec.FakeExec{}
+	for _, command := range commands {
+		command := command
+		fakeExec.CommandScript = append(fakeExec.CommandScript, func(cmd string, args ...string) utilexec.Cmd {
+			ran = append(ran, append([]string{cmd}, args...))
+			fakeCmd := &testingexec.FakeCmd{
+				CombinedOutputScript: []testingexec.FakeAction{
+					func() ([]byte, []byte, error) { return []byte(command.output), nil, command.err },
+				},
+			}
+			return testingexec.InitFakeCmd(fakeCmd, cmd, args...)
+		})
+	}
+	return &mount.SafeFormatAndMount{Interface: mount.NewFakeMounter(nil), Exec: fakeExec}, &ran
+}
+
+func TestResizeFilesystem(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name     string
+		commands []fakeCommand
+		tool     string
+		err      error
+	}{
+		{
+			name:     "ext3",
+			commands: []fakeCommand{{output: "TYPE=ext3\n"}, {}},
+			tool:     "resize2fs",
+		},
+		{
+			name:     "xfs",
+			commands: []fakeCommand{{output: "TYPE=xfs\n"}, {}},
+			tool:     "xfs_growfs",
+		},
+		{
+			name: "ext3 without online resize",
+			commands: []fakeCommand{{output: "TYPE=ext3\n"}, {
+				output: "resize2fs: Operation not supported While checking for on-line resizing support",
+				err:    testingexec.FakeExitError{Status: 1},
+			}},
+			tool: "resize2fs",
+			err:  errOnlineResizeUnsupported,
+		},
+	}
+	for _, test := range tests {
+		mounter, ran := newFakeResizeMounter(test.commands)
+		err := resizeFilesystem(ctx, mounter, "/dev/sdb", "/mnt/sdb")
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: expected error %v, got %v", test.name, test.err, err)
+		}
+		if len(*ran) != 2 || (*ran)[1][0] != test.tool {
+			t.Errorf("%s: expected the filesystem to be resized with %s, ran %v", test.name, test.tool, *ran)
+		}
+	}
+}
+
+func TestResizeFilesystemOffline(t *testing.T) {
+	ctx := context.Background()
+	superblock := "Block count:              262144\nBlock size:               4096\n"
+	mounter, ran := newFakeResizeMounter([]fakeCommand{
+		{output: "TYPE=ext3\n"},
+		{output: superblock},
+		{output: "2147483648\n"},
+		{err: testingexec.FakeExitError{Status: 1}},
+		{},
+	})
+	if err := resizeFilesystemOffline(ctx, mounter, "/dev/sdb"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := [][]string{
+		{"blkid", "-p", "-s", "TYPE", "-s", "PTTYPE", "-o", "export", "/dev/sdb"},
+		{"dumpe2fs", "-h", "/dev/sdb"},
+		{"blockdev", "--getsize64", "/dev/sdb"},
+		{"e2fsck", "-f", "-p", "/dev/sdb"},
+		{"resize2fs", "/dev/sdb"},
+	}
+	if !reflect.DeepEqual(*ran, expected) {
+		t.Fatalf("expected commands %v, got %v", expected, *ran)
+	}
+
+	// The filesystem already uses the whole device.
+	mounter, ran = newFakeResizeMounter([]fakeCommand{
+		{output: "TYPE=ext3\n"},
+		{output: superblock},
+		{output: "1073741824\n"},
+	})
+	if err := resizeFilesystemOffline(ctx, mounter, "/dev/sdb"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(*ran) != 3 {
+		t.Fatalf("expected the filesystem not to be resized, ran %v", *ran)
+	}
+}
@@ -24,8 +24,10 @@ import (
 	"os"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
+	gocsiutils "github.com/rexray/gocsi/utils"
 	"google.golang.org/grpc"
 	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
 
@@ -52,6 +54,11 @@ type NonBlockingGRPCServer interface {
 	// from accepting new connections and RPCs and blocks until all the
 	// pending RPCs are finished.
 	GracefulStop()
+
+	// GracefulStopWithTimeout stops the gRPC server gracefully, and stops it
+	// forcibly if the pending RPCs aren't finished within timeout. Returns
+	// false if the server had to be stopped forcibly.
+	GracefulStopWithTimeout(timeout time.Duration) bool
 }
 
 // NewNonBlockingGRPCServer returns an instance of nonBlockingGRPCServer.
@@ -61,7 +68,20 @@ func NewNonBlockingGRPCServer() NonBlockingGRPCServer {
 
 // nonBlockingGRPCServer implements the interface NonBlockingGRPCServer.
 type nonBlockingGRPCServer struct {
+	// lock protects server and addr, which the socket watchdog reads from its
+	// own goroutine.
+	lock   sync.Mutex
 	server *grpc.Server
+	// addr is the path of the unix socket the server listens on.
+	addr string
+}
+
+// getServer returns the gRPC server and the path of the unix socket it
+// listens on, or a nil server if it isn't serving yet.
+func (s *nonBlockingGRPCServer) getServer() (*grpc.Server, string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.server, s.addr
 }
 
 func (s *nonBlockingGRPCServer) Start(endpoint string, ids csi.IdentityServer, cs csi.ControllerServer, ns csi.NodeServer) {
@@ -74,23 +94,68 @@ func (s *nonBlockingGRPCServer) Start(endpoint string, ids csi.IdentityServer, c
 func (s *nonBlockingGRPCServer) GracefulStop() {
 	log := logger.GetLoggerWithNoContext()
 	stopOnce.Do(func() {
-		if s.server != nil {
-			s.server.GracefulStop()
+		if server, _ := s.getServer(); server != nil {
+			server.GracefulStop()
 		}
 		log.Info("gracefully stopped")
 	})
 }
 
+func (s *nonBlockingGRPCServer) GracefulStopWithTimeout(timeout time.Duration) bool {
+	log := logger.GetLoggerWithNoContext()
+	stopped := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return true
+	case <-time.After(timeout):
+		log.Warnf("pending RPCs didn't finish within %v, stopping forcibly", timeout)
+		if server, _ := s.getServer(); server != nil {
+			// Closes the connections GracefulStop is waiting for.
+			server.Stop()
+		}
+		<-stopped
+		return false
+	}
+}
+
 func (s *nonBlockingGRPCServer) Stop() {
 	log := logger.GetLoggerWithNoContext()
 	stopOnce.Do(func() {
-		if s.server != nil {
-			s.server.Stop()
+		if server, _ := s.getServer(); server != nil {
+			server.Stop()
 		}
 		log.Info("stopped")
 	})
 }
 
+// recreateSocket re-creates the unix socket the server listens on, and serves
+// the RPCs on it in addition to the stale one.
+func (s *nonBlockingGRPCServer) recreateSocket() error {
+	log := logger.GetLoggerWithNoContext()
+	server, addr := s.getServer()
+	if server == nil {
+		return errors.New("server isn't started")
+	}
+	if err := os.Remove(addr); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove %s. Err: %v", addr, err)
+	}
+	listener, err := net.Listen("unix", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen: %v", err)
+	}
+	go func() {
+		if err := server.Serve(listener); err != nil {
+			log.Errorf("failed to serve: %v", err)
+		}
+	}()
+	log.Infof("Listening for connections on re-created address: %s", listener.Addr())
+	return nil
+}
+
 func (s *nonBlockingGRPCServer) serve(endpoint string, ids csi.IdentityServer, cs csi.ControllerServer, ns csi.NodeServer) error {
 	log := logger.GetLoggerWithNoContext()
 	u, err := url.Parse(endpoint)
@@ -123,9 +188,7 @@ func (s *nonBlockingGRPCServer) serve(endpoint string, ids csi.IdentityServer, c
 		return fmt.Errorf(msg)
 	}
 
-	server := grpc.NewServer()
-	s.server = server
-
+	server := grpc.NewServer(grpc.UnaryInterceptor(gocsiutils.ChainUnaryServer(MetricsInterceptor, TracingInterceptor)))
 	// Register the CSI services.
 	// Always require the identity service.
 	if ids == nil {
@@ -137,7 +200,7 @@ func (s *nonBlockingGRPCServer) serve(endpoint string, ids csi.IdentityServer, c
 	}
 
 	// Always register the identity service.
-	csi.RegisterIdentityServer(s.server, ids)
+	csi.RegisterIdentityServer(server, ids)
 	log.Info("identity service registered")
 
 	// Determine which of the controller/node services to register
@@ -146,13 +209,13 @@ func (s *nonBlockingGRPCServer) serve(endpoint string, ids csi.IdentityServer, c
 		if cs == nil {
 			return errors.New("controller service required when running in controller mode")
 		}
-		csi.RegisterControllerServer(s.server, cs)
+		csi.RegisterControllerServer(server, cs)
 		log.Info("controller service registered")
 	} else if strings.EqualFold(mode, "node") {
 		if ns == nil {
 			return errors.New("node service required when running in node mode")
 		}
-		csi.RegisterNodeServer(s.server, ns)
+		csi.RegisterNodeServer(server, ns)
 		log.Info("node service registered")
 	} else {
 		msg := fmt.Sprintf("invalid value %q specified for %s. Expected values are 'node' or 'controller'", mode, csitypes.EnvVarMode)
@@ -160,6 +223,13 @@ func (s *nonBlockingGRPCServer) serve(endpoint string, ids csi.IdentityServer, c
 		return fmt.Errorf(msg)
 	}
 
+	// Publish the server only once its services are registered, since they
+	// can't be registered after it serves on the re-created socket.
+	s.lock.Lock()
+	s.server = server
+	s.addr = addr
+	s.lock.Unlock()
+
 	log.Infof("Listening for connections on address: %s", listener.Addr())
 	if err := server.Serve(listener); err != nil {
 		log.Errorf("failed to serve: %v", err)
@@ -0,0 +1,70 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
+	csitypes "sigs.k8s.io/vsphere-csi-driver/pkg/csi/types"
+)
+
+// defaultShutdownTimeout is the default duration the driver waits on SIGTERM
+// for the in-flight CSI RPCs to finish. It is below the default termination
+// grace period of 30 seconds of the pods, after which they are killed.
+const defaultShutdownTimeout = 25 * time.Second
+
+// getShutdownTimeout returns the duration set with the env variable
+// X_CSI_SHUTDOWN_TIMEOUT, or the default one.
+func getShutdownTimeout(ctx context.Context) time.Duration {
+	log := logger.GetLogger(ctx)
+	timeout := defaultShutdownTimeout
+	if v := os.Getenv(csitypes.EnvVarShutdownTimeout); v != "" {
+		if value, err := time.ParseDuration(v); err != nil || value < 0 {
+			log.Warnf("Invalid value set for env variable %s: %v. Using default value.",
+				csitypes.EnvVarShutdownTimeout, v)
+		} else {
+			timeout = value
+		}
+	}
+	return timeout
+}
+
+// shutdownSignal returns a channel receiving SIGTERM and SIGINT.
+func shutdownSignal() <-chan os.Signal {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGINT)
+	return sigCh
+}
+
+// exitAfterShutdownTimeout bounds the graceful stop gocsi does on SIGTERM,
+// which waits for the in-flight RPCs without a timeout, by exiting once the
+// timeout has elapsed. The CNS tasks of the RPCs still in flight are persisted
+// as in progress in the operation store, and are waited for instead of being
+// invoked again when the RPCs are retried after the restart.
+func exitAfterShutdownTimeout(ctx context.Context, timeout time.Duration) {
+	log := logger.GetLogger(ctx)
+	sig := <-shutdownSignal()
+	log.Infof("Received signal %v, waiting up to %v for the in-flight requests to finish", sig, timeout)
+	time.Sleep(timeout)
+	log.Warnf("In-flight requests didn't finish within %v, exiting", timeout)
+	os.Exit(1)
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"context"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	csitypes "sigs.k8s.io/vsphere-csi-driver/pkg/csi/types"
+)
+
+func TestGetShutdownTimeout(t *testing.T) {
+	ctx := context.Background()
+	defer os.Unsetenv(csitypes.EnvVarShutdownTimeout)
+	for value, expected := range map[string]time.Duration{
+		"":      defaultShutdownTimeout,
+		"1m":    time.Minute,
+		"0s":    0,
+		"-1s":   defaultShutdownTimeout,
+		"hello": defaultShutdownTimeout,
+	} {
+		os.Setenv(csitypes.EnvVarShutdownTimeout, value)
+		if timeout := getShutdownTimeout(ctx); timeout != expected {
+			t.Errorf("expected timeout %v for %q, got %v", expected, value, timeout)
+		}
+	}
+}
+
+// TestGracefulStopWithTimeout checks that the server is stopped forcibly when
+// an RPC is still pending after the timeout.
+func TestGracefulStopWithTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &nonBlockingGRPCServer{server: grpc.NewServer()}
+	healthpb.RegisterHealthServer(s.server, health.NewServer())
+	go func() {
+		_ = s.server.Serve(listener)
+	}()
+
+	conn, err := grpc.DialContext(ctx, listener.Addr().String(), grpc.WithInsecure(), grpc.WithBlock())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// Watch streams the status of the server until it is closed.
+	stream, err := healthpb.NewHealthClient(conn).Watch(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatal(err)
+	}
+
+	if s.GracefulStopWithTimeout(100 * time.Millisecond) {
+		t.Fatalf("expected the server to be stopped forcibly with a pending RPC")
+	}
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/common/commonco"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
+	csitypes "sigs.k8s.io/vsphere-csi-driver/pkg/csi/types"
+)
+
+const (
+	// socketCheckInterval is the interval between two checks of the sockets
+	// of the node plugin.
+	socketCheckInterval = 30 * time.Second
+	// socketDialTimeout is the timeout to connect to a socket before it is
+	// considered stale.
+	socketDialTimeout = 5 * time.Second
+	// socketEventFlushDelay is the time given to the node event to be sent
+	// before exiting to re-create the driver socket.
+	socketEventFlushDelay = 2 * time.Second
+	// kubeletPluginsRegistryDir is the directory the kubelet watches for the
+	// registration sockets of the plugins, created by node-driver-registrar.
+	kubeletPluginsRegistryDir = "/var/lib/kubelet/plugins_registry"
+)
+
+// socketWatchdog checks that the CSI socket of the node plugin and the
+// kubelet registration socket of node-driver-registrar are served, and heals
+// them when they become stale, such as after the socket files are removed by
+// a restart of the kubelet or a crash of node-driver-registrar.
+type socketWatchdog struct {
+	// driverSocket is the path of the socket the CSI RPCs are served on.
+	driverSocket string
+	// registrationSocket is the path of the kubelet registration socket.
+	registrationSocket string
+	// nodeName is the name of the node the events are recorded on.
+	nodeName string
+	// recreateDriverSocket re-creates the driver socket and serves the CSI
+	// RPCs on it.
+	recreateDriverSocket func() error
+}
+
+// newSocketWatchdog returns a socketWatchdog for the driver socket at the
+// given path.
+func newSocketWatchdog(driverSocket string, recreateDriverSocket func() error) *socketWatchdog {
+	return &socketWatchdog{
+		driverSocket:         driverSocket,
+		registrationSocket:   filepath.Join(kubeletPluginsRegistryDir, csitypes.Name+"-reg.sock"),
+		nodeName:             os.Getenv("NODE_NAME"),
+		recreateDriverSocket: recreateDriverSocket,
+	}
+}
+
+// run checks the sockets every socketCheckInterval until ctx is done.
+func (w *socketWatchdog) run(ctx context.Context) {
+	log := logger.GetLogger(ctx)
+	log.Infof("Watching the driver socket %s and the registration socket %s", w.driverSocket, w.registrationSocket)
+	ticker := time.NewTicker(socketCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.check(ctx)
+		}
+	}
+}
+
+// check re-creates the driver socket if it is stale, and removes the
+// registration socket if it is stale so that the liveness probe of
+// node-driver-registrar restarts it to register the driver again.
+func (w *socketWatchdog) check(ctx context.Context) {
+	log := logger.GetLogger(ctx)
+	if !isSocketServed(w.driverSocket) {
+		log.Warnf("driver socket %s is stale, re-creating it", w.driverSocket)
+		if err := w.recreateDriverSocket(); err != nil {
+			log.Errorf("failed to re-create the driver socket %s. Err: %v", w.driverSocket, err)
+			w.recordEvent(ctx, v1.EventTypeWarning, "DriverSocketRecreationFailed",
+				"Failed to re-create the stale CSI socket "+w.driverSocket+": "+err.Error())
+		} else {
+			w.recordEvent(ctx, v1.EventTypeNormal, "DriverSocketRecreated",
+				"Re-creating the stale CSI socket "+w.driverSocket)
+		}
+	}
+	// node-driver-registrar fails its liveness probe by itself when the
+	// registration socket is missing.
+	if _, err := os.Stat(w.registrationSocket); err == nil && !isSocketServed(w.registrationSocket) {
+		log.Warnf("registration socket %s is stale, removing it to register the driver again",
+			w.registrationSocket)
+		if err := os.Remove(w.registrationSocket); err != nil && !os.IsNotExist(err) {
+			log.Errorf("failed to remove the stale registration socket %s. Err: %v", w.registrationSocket, err)
+			return
+		}
+		w.recordEvent(ctx, v1.EventTypeNormal, "RegistrationSocketRemoved",
+			"Removed the stale kubelet registration socket "+w.registrationSocket+
+				" for node-driver-registrar to register the driver again")
+	}
+}
+
+// recordEvent records an event on the node, if its name is known.
+func (w *socketWatchdog) recordEvent(ctx context.Context, eventType string, reason string, message string) {
+	if w.nodeName == "" || commonco.ContainerOrchestratorUtility == nil {
+		return
+	}
+	commonco.ContainerOrchestratorUtility.RecordNodeEvent(ctx, w.nodeName, eventType, reason, message)
+}
+
+// isSocketServed returns true if the unix socket at the path accepts
+// connections.
+func isSocketServed(path string) bool {
+	conn, err := net.DialTimeout("unix", path, socketDialTimeout)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// exitToRecreateDriverSocket exits for the driver socket served by gocsi,
+// which can't be served on a new listener, to be re-created when the driver
+// container is restarted.
+func exitToRecreateDriverSocket() error {
+	log := logger.GetLoggerWithNoContext()
+	log.Warn("exiting to re-create the driver socket served by gocsi")
+	go func() {
+		time.Sleep(socketEventFlushDelay)
+		os.Exit(1)
+	}()
+	return nil
+}
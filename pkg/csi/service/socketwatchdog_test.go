@@ -0,0 +1,126 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/common/commonco"
+	csitypes "sigs.k8s.io/vsphere-csi-driver/pkg/csi/types"
+)
+
+// staleSocket creates a unix socket file at the path nothing listens on.
+func staleSocket(t *testing.T, path string) {
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener.SetUnlinkOnClose(false)
+	listener.Close()
+}
+
+// TestSocketWatchdogCheck checks that only the stale sockets are healed.
+func TestSocketWatchdogCheck(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "socketwatchdog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	recreated := 0
+	w := &socketWatchdog{
+		driverSocket:       filepath.Join(dir, "csi.sock"),
+		registrationSocket: filepath.Join(dir, "reg.sock"),
+		recreateDriverSocket: func() error {
+			recreated++
+			return nil
+		},
+	}
+	listener, err := net.Listen("unix", w.driverSocket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A missing registration socket is left to node-driver-registrar.
+	w.check(ctx)
+	if recreated != 0 {
+		t.Fatalf("expected the served driver socket to be left as is")
+	}
+
+	listener.Close()
+	staleSocket(t, w.registrationSocket)
+	w.check(ctx)
+	if recreated != 1 {
+		t.Fatalf("expected the stale driver socket to be re-created")
+	}
+	if _, err := os.Stat(w.registrationSocket); !os.IsNotExist(err) {
+		t.Fatalf("expected the stale registration socket to be removed, got err %v", err)
+	}
+}
+
+// TestStartSocketWatchdogWithoutCO checks that the watchdog isn't started,
+// without panicking, when the CO utility failed to initialize.
+func TestStartSocketWatchdogWithoutCO(t *testing.T) {
+	origCO := commonco.ContainerOrchestratorUtility
+	commonco.ContainerOrchestratorUtility = nil
+	defer func() {
+		commonco.ContainerOrchestratorUtility = origCO
+	}()
+	driver := &vsphereCSIDriver{mode: "node"}
+	driver.startSocketWatchdog(context.Background(), "csi.sock", func() error {
+		t.Fatal("expected the driver socket not to be re-created")
+		return nil
+	})
+}
+
+// TestRecreateSocketWhileServing checks that the socket is re-created, and
+// served, while the server is started.
+func TestRecreateSocketWhileServing(t *testing.T) {
+	dir, err := ioutil.TempDir("", "socketwatchdog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Setenv(csitypes.EnvVarMode, "node")
+	defer os.Unsetenv(csitypes.EnvVarMode)
+
+	socket := filepath.Join(dir, "csi.sock")
+	s := &nonBlockingGRPCServer{}
+	go s.Start("unix://"+socket, &vsphereCSIDriver{}, nil, &vsphereCSIDriver{})
+	// Stop doesn't stop the server again once stopped by another test.
+	defer func() {
+		if server, _ := s.getServer(); server != nil {
+			server.Stop()
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		if err := s.recreateSocket(); err == nil {
+			if !isSocketServed(socket) {
+				t.Fatalf("expected the re-created socket %s to be served", socket)
+			}
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatal("expected the server to be started")
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/net/context"
+	utilexec "k8s.io/utils/exec"
+
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
+)
+
+// sysFsDir is the directory in which the filesystems mounted by the kernel
+// register the devices they use.
+var sysFsDir = "/sys/fs"
+
+// errDeviceInUse is returned when the device of a volume is still used by a
+// previous mount that can't be cleaned up by the node plugin.
+var errDeviceInUse = errors.New("device is still in use")
+
+// cleanupStaleDevice removes what is left of a previous attach of the device
+// before it is staged again, such as after a crash of the node or a detach
+// without NodeUnstageVolume. Staging the device over these would mount a
+// filesystem of the wrong size or write to the disk through two paths.
+//
+// A mount of another device at the staging target is unmounted, and the
+// device-mapper devices built on top of the device are removed. A filesystem
+// still open on the device after a lazy unmount can't be cleaned up, and
+// errDeviceInUse is returned.
+func cleanupStaleDevice(ctx context.Context, exec utilexec.Interface, dev *Device, stagingTarget string) error {
+	log := logger.GetLogger(ctx)
+	mnts, err := nodeMounter.GetMounts(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get the mounts of the node: %v", err)
+	}
+	for _, m := range mnts {
+		if m.Path != stagingTarget || m.Device == dev.RealDev {
+			continue
+		}
+		log.Warnf("cleanupStaleDevice: unmounting stale mount of device %q at staging target %q",
+			m.Device, stagingTarget)
+		if err := nodeMounter.Unmount(ctx, stagingTarget); err != nil {
+			return fmt.Errorf("failed to unmount stale mount of device %q at %q: %v", m.Device, stagingTarget, err)
+		}
+	}
+
+	name := dev.sysfsName()
+	holders, err := ioutil.ReadDir(filepath.Join(sysBlockDir, name, "holders"))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to list the holders of device %s: %v", dev.RealDev, err)
+	}
+	for _, holder := range holders {
+		if !strings.HasPrefix(holder.Name(), "dm-") {
+			continue
+		}
+		dmName, err := ioutil.ReadFile(filepath.Join(sysBlockDir, holder.Name(), "dm", "name"))
+		if err != nil {
+			return fmt.Errorf("failed to get the name of device-mapper device %s holding device %s: %v",
+				holder.Name(), dev.RealDev, err)
+		}
+		log.Warnf("cleanupStaleDevice: removing stale device-mapper device %q holding device %s",
+			strings.TrimSpace(string(dmName)), dev.RealDev)
+		output, err := exec.Command("dmsetup", "remove", strings.TrimSpace(string(dmName))).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("%w: failed to remove device-mapper device %q holding device %s: %v. dmsetup output: %s",
+				errDeviceInUse, strings.TrimSpace(string(dmName)), dev.RealDev, err, string(output))
+		}
+	}
+
+	// A lazily unmounted filesystem is gone from the mounts of the node but
+	// stays registered by its driver until it is no longer used.
+	for _, fsType := range []string{"ext4", "xfs"} {
+		if _, err := os.Stat(filepath.Join(sysFsDir, fsType, name)); err == nil {
+			return fmt.Errorf("%w: %s filesystem on device %s is still mounted, likely lazily unmounted "+
+				"and held open by a process", errDeviceInUse, fsType, dev.RealDev)
+		}
+	}
+	return nil
+}
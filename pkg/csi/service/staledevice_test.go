@@ -0,0 +1,78 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"golang.org/x/net/context"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+func TestCleanupStaleDevice(t *testing.T) {
+	ctx := context.Background()
+	layout, _ := newFakeNode(t)
+	dev, err := getDevice(layout.attachDisk(t, testDiskUUID, "sdb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, content := range map[string]string{
+		"sys/block/sdb/holders/dm-0": "",
+		"sys/block/dm-0/dm/name":     "vg-lv\n",
+	} {
+		path = filepath.Join(layout.root, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mounter, ran := newFakeResizeMounter([]fakeCommand{{}})
+	if err := cleanupStaleDevice(ctx, mounter.Exec, dev, "/staging"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := [][]string{{"dmsetup", "remove", "vg-lv"}}; !reflect.DeepEqual(*ran, expected) {
+		t.Fatalf("expected commands %v, got %v", expected, *ran)
+	}
+
+	// The device-mapper device is still open.
+	mounter, _ = newFakeResizeMounter([]fakeCommand{{
+		output: "device-mapper: remove ioctl on vg-lv failed: Device or resource busy",
+		err:    testingexec.FakeExitError{Status: 1},
+	}})
+	if err := cleanupStaleDevice(ctx, mounter.Exec, dev, "/staging"); !errors.Is(err, errDeviceInUse) {
+		t.Fatalf("expected errDeviceInUse, got %v", err)
+	}
+
+	// The filesystem on the device was lazily unmounted.
+	if err := os.RemoveAll(filepath.Join(sysBlockDir, "sdb", "holders")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(sysFsDir, "ext4", "sdb"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := cleanupStaleDevice(ctx, mounter.Exec, dev, "/staging"); !errors.Is(err, errDeviceInUse) {
+		t.Fatalf("expected errDeviceInUse, got %v", err)
+	}
+}
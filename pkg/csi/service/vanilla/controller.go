@@ -23,7 +23,11 @@ import (
 	"math/rand"
 	"net/http"
 	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
@@ -34,8 +38,11 @@ import (
 	"github.com/vmware/govmomi/vapi/tags"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
 
 	"sigs.k8s.io/vsphere-csi-driver/pkg/apis/migration"
+	cnsnode "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/node"
 	cnsvolume "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/volume"
 	cnsvsphere "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/vsphere"
 	cnsconfig "sigs.k8s.io/vsphere-csi-driver/pkg/common/config"
@@ -52,20 +59,34 @@ import (
 type NodeManagerInterface interface {
 	Initialize(ctx context.Context) error
 	GetSharedDatastoresInK8SCluster(ctx context.Context) ([]*cnsvsphere.DatastoreInfo, error)
-	GetSharedDatastoresInTopology(ctx context.Context, topologyRequirement *csi.TopologyRequirement, tagManager *tags.Manager, zoneKey string, regionKey string) ([]*cnsvsphere.DatastoreInfo, map[string][]map[string]string, error)
+	GetSharedDatastoresInTopology(ctx context.Context, topologyRequirement *csi.TopologyRequirement, tagManagers map[string]*tags.Manager, zoneKey string, regionKey string) ([]*cnsvsphere.DatastoreInfo, map[string][]map[string]string, error)
 	GetNodeByName(ctx context.Context, nodeName string) (*cnsvsphere.VirtualMachine, error)
 	GetAllNodes(ctx context.Context) ([]*cnsvsphere.VirtualMachine, error)
+	GetAllNodesByName(ctx context.Context) (map[string]*cnsvsphere.VirtualMachine, error)
 }
 
 type controller struct {
 	manager *common.Manager
 	nodeMgr NodeManagerInterface
 	authMgr common.AuthorizationService
+	// nodeQueue serializes the attach and detach operations on each node VM.
+	nodeQueue *nodeOperationQueue
+	// vcenters has the managers of the vCenters configured in addition to the
+	// one of manager, it is nil if the controller isn't initialized with Init.
+	vcenters *vCenters
+	// leader tells whether this replica runs the background work of the
+	// controller, it is nil, always the leader, if the controller isn't
+	// initialized with Init.
+	leader *common.LeaderGate
 }
 
 // volumeMigrationService holds the pointer to VolumeMigration instance.
 var volumeMigrationService migration.VolumeMigrationService
 
+// configReloadLock serializes the reloads of the config from the config file
+// and from the config secret, and the reads of the config outside of them.
+var configReloadLock sync.Mutex
+
 // New creates a CNS controller.
 func New() csitypes.CnsController {
 	return &controller{}
@@ -98,6 +119,7 @@ func (c *controller) Init(config *cnsconfig.Config, version string) error {
 		VolumeManager:  cnsvolume.GetManager(ctx, vcenter),
 		VcenterManager: vcManager,
 	}
+	c.nodeQueue = newNodeOperationQueue()
 
 	vc, err := common.GetVCenter(ctx, c.manager)
 	if err != nil {
@@ -138,7 +160,21 @@ func (c *controller) Init(config *cnsconfig.Config, version string) error {
 		log.Errorf("checkAPI failed for vcenter API version: %s, err=%v", vc.Client.ServiceContent.About.ApiVersion, err)
 		return err
 	}
-	c.nodeMgr = &Nodes{}
+	// Register the other vCenters before the node manager looks up the VMs of
+	// the nodes in all the registered vCenters.
+	if err = c.registerVCenters(ctx, config); err != nil {
+		log.Errorf("failed to register vCenters. err=%v", err)
+		return err
+	}
+	// ctx is done once initialization completes, the election runs with its
+	// own context.
+	leaderCtx, _ := logger.GetNewContextWithLogger()
+	c.leader, err = common.StartLeaderElection(leaderCtx)
+	if err != nil {
+		log.Errorf("failed to start leader election. err=%v", err)
+		return err
+	}
+	c.nodeMgr = newNodes(c.getVolumeManagerForNode, c.leader.IsLeader, config)
 	err = c.nodeMgr.Initialize(ctx)
 	if err != nil {
 		log.Errorf("failed to initialize nodeMgr. err=%v", err)
@@ -146,6 +182,9 @@ func (c *controller) Init(config *cnsconfig.Config, version string) error {
 	}
 
 	go cnsvolume.ClearTaskInfoObjects()
+	// Every replica keeps its session ready, standby replicas take over
+	// without logging in to vCenter again.
+	go c.keepVCSessionAlive()
 	cfgPath := common.GetConfigPath(ctx)
 
 	if isAuthCheckFSSEnabled {
@@ -183,16 +222,8 @@ func (c *controller) Init(config *cnsconfig.Config, version string) error {
 					return
 				}
 				log.Debugf("fsnotify event: %q", event.String())
-				if event.Op&fsnotify.Remove == fsnotify.Remove {
-					for {
-						reloadConfigErr := c.ReloadConfiguration()
-						if reloadConfigErr == nil {
-							log.Infof("Successfully reloaded configuration from: %q", cfgPath)
-							break
-						}
-						log.Errorf("failed to reload configuration. will retry again in 5 seconds. err: %+v", reloadConfigErr)
-						time.Sleep(5 * time.Second)
-					}
+				if isConfigChangeEvent(event, cfgPath) {
+					common.ReloadConfigurationWithBackoff(ctx, cfgPath, c.ReloadConfiguration)
 				}
 			case err, ok := <-watcher.Errors:
 				if !ok {
@@ -210,6 +241,14 @@ func (c *controller) Init(config *cnsconfig.Config, version string) error {
 		log.Errorf("failed to watch on path: %q. err=%v", cfgDirPath, err)
 		return err
 	}
+	// The secret is updated before the kubelet updates the mounted config
+	// file, rotated vCenter credentials are used as soon as they are set.
+	err = common.WatchConfigSecret(ctx, func() *cnsconfig.Config { return c.manager.CnsConfig },
+		c.reloadConfiguration)
+	if err != nil {
+		log.Errorf("failed to watch the config secret. err=%v", err)
+		return err
+	}
 	if commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.CSIMigration) {
 		log.Info("CSI Migration Feature is Enabled. Loading Volume Migration Service")
 		volumeMigrationService, err = migration.GetVolumeMigrationService(ctx, &c.manager.VolumeManager, config, false)
@@ -220,12 +259,16 @@ func (c *controller) Init(config *cnsconfig.Config, version string) error {
 	}
 	if commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.CSIVolumeManagerIdempotency) {
 		log.Infof("CSI Volume manager idempotency handling feature flag is enabled.")
-		// TODO: Assign VolumeOperationRequest object to a variable.
-		_, err = cnsvolumeoperationrequest.InitVolumeOperationRequestInterface(ctx)
+		operationStore, err := cnsvolumeoperationrequest.InitVolumeOperationRequestInterface(ctx, config)
 		if err != nil {
 			log.Errorf("failed to initialize VolumeOperationRequestInterface with error: %v", err)
 			return err
 		}
+		for _, manager := range c.getAllManagers() {
+			manager.VolumeManager.SetOperationStore(operationStore)
+		}
+		cnsvolumeoperationrequest.StartCleanupRoutine(operationStore, c.cnsConfig, c.getVolumeIDs,
+			c.leader.IsLeader)
 	}
 	// Go module to keep the metrics http server running all the time.
 	go func() {
@@ -243,6 +286,48 @@ func (c *controller) Init(config *cnsconfig.Config, version string) error {
 	return nil
 }
 
+// keepVCSessionAlive checks the session with the current vCenter at the
+// interval of the current config, logging in again if it expired. The
+// interval is read again after each check, so that reloading the config
+// changes it.
+func (c *controller) keepVCSessionAlive() {
+	for {
+		interval := c.vcSessionKeepAliveInterval()
+		if interval <= 0 {
+			// Disabled, wait for a config enabling it.
+			time.Sleep(vcSessionKeepAliveDisabledPollInterval)
+			continue
+		}
+		time.Sleep(interval)
+		ctx, log := logger.GetNewContextWithLogger()
+		vc, err := common.GetVCenter(ctx, c.manager)
+		if err != nil {
+			log.Warnf("failed to get vCenter to keep its session alive. err=%v", err)
+			continue
+		}
+		if err := vc.KeepSessionAlive(ctx); err != nil {
+			log.Warnf("failed to keep the session with vCenter %q alive. err=%v", vc.Config.Host, err)
+		}
+	}
+}
+
+// vcSessionKeepAliveInterval returns the interval of the current config to
+// check the session with vCenter at. The config is read under
+// configReloadLock, as reloads replace it.
+func (c *controller) vcSessionKeepAliveInterval() time.Duration {
+	configReloadLock.Lock()
+	defer configReloadLock.Unlock()
+	return time.Duration(c.manager.CnsConfig.Global.VCSessionKeepAliveIntervalInMin) * time.Minute
+}
+
+// cnsConfig returns the current config. The config is read under
+// configReloadLock, as reloads replace it.
+func (c *controller) cnsConfig() *cnsconfig.Config {
+	configReloadLock.Lock()
+	defer configReloadLock.Unlock()
+	return c.manager.CnsConfig
+}
+
 // ReloadConfiguration reloads configuration from the secret, and update
 // controller's config cache and VolumeManager's VC Config cache.
 func (c *controller) ReloadConfiguration() error {
@@ -254,11 +339,28 @@ func (c *controller) ReloadConfiguration() error {
 		log.Error(msg)
 		return errors.New(msg)
 	}
+	return c.reloadConfiguration(ctx, cfg)
+}
+
+// reloadConfiguration updates controller's config cache and VolumeManager's
+// VC Config cache with cfg, logging in to the vCenters again if their
+// credentials changed.
+func (c *controller) reloadConfiguration(ctx context.Context, cfg *cnsconfig.Config) error {
+	log := logger.GetLogger(ctx)
+	configReloadLock.Lock()
+	defer configReloadLock.Unlock()
+	// GetVirtualCenterConfig sets the defaults of cfg, compare it after.
 	newVCConfig, err := cnsvsphere.GetVirtualCenterConfig(ctx, cfg)
 	if err != nil {
 		log.Errorf("failed to get VirtualCenterConfig. err=%v", err)
 		return err
 	}
+	// Writing the config file in place raises several events, the vCenters
+	// and nodes are set up again only when the config changed.
+	if reflect.DeepEqual(cfg, c.manager.CnsConfig) {
+		log.Info("Configuration is unchanged")
+		return nil
+	}
 	if newVCConfig != nil {
 		var vcenter *cnsvsphere.VirtualCenter
 		if c.manager.VcenterConfig.Host != newVCConfig.Host ||
@@ -273,6 +375,11 @@ func (c *controller) ReloadConfiguration() error {
 				log.Error(msg)
 				return errors.New(msg)
 			}
+			// The session of the verification isn't used further.
+			if err = newVC.Disconnect(ctx); err != nil {
+				log.Warnf("failed to logout of the session verifying the credentials of VirtualCenter host: %q, Err: %+v",
+					newVCConfig.Host, err)
+			}
 
 			// Reset vCenter singleton instance by passing reload flag as true.
 			log.Info("Obtaining new vCenterInstance using new credentials")
@@ -296,8 +403,14 @@ func (c *controller) ReloadConfiguration() error {
 		c.manager.VolumeManager.ResetManager(ctx, vcenter)
 		c.manager.VcenterConfig = newVCConfig
 		c.manager.VolumeManager = cnsvolume.GetManager(ctx, vcenter)
-		// Re-Initialize Node Manager to cache latest vCenter config.
-		c.nodeMgr = &Nodes{}
+		// Reinitializing the vCenter singleton unregisters the other vCenters.
+		if err = c.registerVCenters(ctx, cfg); err != nil {
+			log.Errorf("failed to register vCenters. err=%v", err)
+			return err
+		}
+		// Re-Initialize Node Manager to cache latest vCenter config and
+		// settings of the nodes.
+		c.nodeMgr = newNodes(c.getVolumeManagerForNode, c.leader.IsLeader, cfg)
 		err = c.nodeMgr.Initialize(ctx)
 		if err != nil {
 			log.Errorf("failed to re-initialize nodeMgr. err=%v", err)
@@ -331,6 +444,56 @@ func (c *controller) filterDatastores(ctx context.Context, sharedDatastores []*c
 	return filteredDatastores
 }
 
+// getSharedDatastores returns the datastores shared by the nodes matching the
+// topology requirement, with the topology segments of each datastore, or the
+// datastores shared by all the nodes if the requirement is nil.
+func (c *controller) getSharedDatastores(ctx context.Context, topologyRequirement *csi.TopologyRequirement) (
+	[]*cnsvsphere.DatastoreInfo, map[string][]map[string]string, error) {
+	log := logger.GetLogger(ctx)
+	datastoreTopologyMap := make(map[string][]map[string]string)
+	if topologyRequirement == nil {
+		sharedDatastores, err := c.nodeMgr.GetSharedDatastoresInK8SCluster(ctx)
+		if err != nil {
+			msg := fmt.Sprintf("failed to get shared datastores in kubernetes cluster. Error: %+v", err)
+			log.Error(msg)
+			return nil, nil, status.Errorf(codes.Internal, msg)
+		}
+		return sharedDatastores, datastoreTopologyMap, nil
+	}
+	// Get shared accessible datastores for matching topology requirement.
+	if c.manager.CnsConfig.Labels.Zone == "" || c.manager.CnsConfig.Labels.Region == "" {
+		// If zone and region label (vSphere category names) not specified in
+		// the config secret, then return NotFound error.
+		errMsg := "Zone/Region vsphere category names not specified in the vsphere config secret"
+		log.Errorf(errMsg)
+		return nil, nil, status.Error(codes.NotFound, errMsg)
+	}
+	// The node VMs are tagged in their own vCenter.
+	tagManagers := make(map[string]*tags.Manager)
+	for _, manager := range c.getAllManagers() {
+		vcenter, err := manager.VcenterManager.GetVirtualCenter(ctx, manager.VcenterConfig.Host)
+		if err != nil {
+			errMsg := fmt.Sprintf("Failed to get vCenter. Err: %v", err)
+			log.Errorf(errMsg)
+			return nil, nil, status.Error(codes.NotFound, errMsg)
+		}
+		tagManager, err := cnsvsphere.GetCachedTagManager(ctx, vcenter)
+		if err != nil {
+			errMsg := fmt.Sprintf("Failed to get tagManager. Err: %v", err)
+			log.Errorf(errMsg)
+			return nil, nil, status.Error(codes.NotFound, errMsg)
+		}
+		tagManagers[manager.VcenterConfig.Host] = tagManager
+	}
+	sharedDatastores, datastoreTopologyMap, err := c.nodeMgr.GetSharedDatastoresInTopology(ctx, topologyRequirement, tagManagers, c.manager.CnsConfig.Labels.Zone, c.manager.CnsConfig.Labels.Region)
+	if err != nil {
+		msg := fmt.Sprintf("failed to get shared datastores in topology: %+v. Error: %+v", topologyRequirement, err)
+		log.Error(msg)
+		return nil, nil, status.Error(codes.NotFound, msg)
+	}
+	return sharedDatastores, datastoreTopologyMap, nil
+}
+
 // createBlockVolume creates a block volume based on the CreateVolumeRequest.
 func (c *controller) createBlockVolume(ctx context.Context, req *csi.CreateVolumeRequest) (
 	*csi.CreateVolumeResponse, error) {
@@ -395,48 +558,45 @@ func (c *controller) createBlockVolume(ctx context.Context, req *csi.CreateVolum
 			}
 		}
 	}
+	volumeName, err := getVolumeName(ctx, req.Name, scParams)
+	if err != nil {
+		return nil, err
+	}
+	adoptedDisk, err := getAdoptedDisk(ctx, scParams)
+	if err != nil {
+		return nil, err
+	}
+	sourceSnapshotID, sourceVolumeID, err := getVolumeContentSource(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if sourceSnapshotID != "" || sourceVolumeID != "" {
+		if adoptedDisk != "" {
+			return nil, status.Errorf(codes.InvalidArgument,
+				"disk %q can't be adopted by a volume with a volume content source", adoptedDisk)
+		}
+		// A volume restored or cloned without a requested size has the size
+		// of its source.
+		if req.GetCapacityRange().GetRequiredBytes() == 0 {
+			volSizeMB = 0
+		}
+	}
 	var createVolumeSpec = common.CreateVolumeSpec{
 		CapacityMB: volSizeMB,
-		Name:       req.Name,
+		Name:       volumeName,
 		ScParams:   scParams,
 		VolumeType: common.BlockVolumeType,
 	}
 
-	var sharedDatastores []*cnsvsphere.DatastoreInfo
-	var datastoreTopologyMap = make(map[string][]map[string]string)
-
 	// Get accessibility.
 	topologyRequirement := req.GetAccessibilityRequirements()
+	sharedDatastores, datastoreTopologyMap, err := c.getSharedDatastores(ctx, topologyRequirement)
+	if err != nil {
+		return nil, err
+	}
 	if topologyRequirement != nil {
-		// Get shared accessible datastores for matching topology requirement.
-		if c.manager.CnsConfig.Labels.Zone == "" || c.manager.CnsConfig.Labels.Region == "" {
-			// If zone and region label (vSphere category names) not specified in
-			// the config secret, then return NotFound error.
-			errMsg := "Zone/Region vsphere category names not specified in the vsphere config secret"
-			log.Errorf(errMsg)
-			return nil, status.Error(codes.NotFound, errMsg)
-		}
-		vcenter, err := c.manager.VcenterManager.GetVirtualCenter(ctx, c.manager.VcenterConfig.Host)
-		if err != nil {
-			errMsg := fmt.Sprintf("Failed to get vCenter. Err: %v", err)
-			log.Errorf(errMsg)
-			return nil, status.Error(codes.NotFound, errMsg)
-		}
-		tagManager, err := cnsvsphere.GetTagManager(ctx, vcenter)
-		if err != nil {
-			errMsg := fmt.Sprintf("Failed to get tagManager. Err: %v", err)
-			log.Errorf(errMsg)
-			return nil, status.Error(codes.NotFound, errMsg)
-		}
-		defer func() {
-			err := tagManager.Logout(ctx)
-			if err != nil {
-				log.Errorf("failed to logout tagManager. err: %v", err)
-			}
-		}()
-		sharedDatastores, datastoreTopologyMap, err = c.nodeMgr.GetSharedDatastoresInTopology(ctx, topologyRequirement, tagManager, c.manager.CnsConfig.Labels.Zone, c.manager.CnsConfig.Labels.Region)
-		if err != nil || len(sharedDatastores) == 0 {
-			msg := fmt.Sprintf("failed to get shared datastores in topology: %+v. Error: %+v", topologyRequirement, err)
+		if len(sharedDatastores) == 0 {
+			msg := fmt.Sprintf("failed to get shared datastores in topology: %+v", topologyRequirement)
 			log.Error(msg)
 			return nil, status.Error(codes.NotFound, msg)
 		}
@@ -458,29 +618,71 @@ func (c *controller) createBlockVolume(ctx context.Context, req *csi.CreateVolum
 				return nil, status.Error(codes.InvalidArgument, errMsg)
 			}
 		}
+	} else if len(sharedDatastores) == 0 {
+		msg := "failed to get shared datastores in kubernetes cluster"
+		log.Error(msg)
+		return nil, status.Errorf(codes.Internal, msg)
+	}
 
-	} else {
-		sharedDatastores, err = c.nodeMgr.GetSharedDatastoresInK8SCluster(ctx)
-		if err != nil || len(sharedDatastores) == 0 {
-			msg := fmt.Sprintf("failed to get shared datastores in kubernetes cluster. Error: %+v", err)
-			log.Error(msg)
-			return nil, status.Errorf(codes.Internal, msg)
+	// A restored or cloned volume is created in the vCenter of its source.
+	routingVolumeID := sourceVolumeID
+	if sourceSnapshotID != "" {
+		if snapshotVolumeID, _, err := common.ParseSnapshotID(sourceSnapshotID); err == nil {
+			routingVolumeID = snapshotVolumeID
 		}
 	}
-
-	if commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.CSIAuthCheck) {
+	manager, sharedDatastores, err := c.getManagerForCreate(ctx, scParams, routingVolumeID, sharedDatastores)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	// The authorization service only knows the datastores of the vCenter of
+	// c.manager.
+	if commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.CSIAuthCheck) && manager == c.manager {
 		// Filter datastores which in datastoreMap from sharedDatastores.
 		sharedDatastores = c.filterDatastores(ctx, sharedDatastores)
 	}
-	volumeInfo, err := common.CreateBlockVolumeUtil(ctx, cnstypes.CnsClusterFlavorVanilla, c.manager, &createVolumeSpec, sharedDatastores)
+	if len(scParams.DatastoreTags) != 0 {
+		sharedDatastores, err = filterDatastoresByTags(ctx, manager, sharedDatastores, scParams.DatastoreTags)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var volumeInfo *cnsvolume.CnsVolumeInfo
+	if adoptedDisk != "" {
+		volumeInfo, volSizeMB, err = common.AdoptBlockVolumeUtil(ctx, cnstypes.CnsClusterFlavorVanilla, manager,
+			&createVolumeSpec, adoptedDisk, sharedDatastores)
+		if err == nil && req.GetCapacityRange().GetLimitBytes() != 0 &&
+			volSizeMB*common.MbInBytes > req.GetCapacityRange().GetLimitBytes() {
+			err = &common.DiskAdoptionError{Disk: adoptedDisk, Reason: fmt.Sprintf(
+				"its capacity of %d MB exceeds the limit of %d bytes", volSizeMB, req.GetCapacityRange().GetLimitBytes())}
+		}
+	} else if sourceSnapshotID != "" {
+		volumeInfo, volSizeMB, err = common.RestoreBlockVolumeUtil(ctx, cnstypes.CnsClusterFlavorVanilla, manager,
+			&createVolumeSpec, sourceSnapshotID, req.GetCapacityRange().GetLimitBytes()/common.MbInBytes,
+			sharedDatastores)
+	} else if sourceVolumeID != "" {
+		volumeInfo, volSizeMB, err = common.CloneBlockVolumeUtil(ctx, cnstypes.CnsClusterFlavorVanilla, manager,
+			&createVolumeSpec, sourceVolumeID, req.GetCapacityRange().GetLimitBytes()/common.MbInBytes,
+			sharedDatastores)
+	} else {
+		volumeInfo, err = common.CreateBlockVolumeUtil(ctx, cnstypes.CnsClusterFlavorVanilla, manager,
+			&createVolumeSpec, sharedDatastores)
+	}
 	if err != nil {
 		msg := fmt.Sprintf("failed to create volume. Error: %+v", err)
 		log.Error(msg)
-		return nil, status.Errorf(codes.Internal, msg)
+		if reason, message, ok := common.PVCEventForError(err); ok {
+			pvc := types.NamespacedName{Namespace: createVolumeSpec.ScParams.PVCNamespace, Name: createVolumeSpec.ScParams.PVCName}
+			commonco.ContainerOrchestratorUtility.RecordPVCEvent(ctx, "", pvc, v1.EventTypeWarning, reason, message)
+		}
+		return nil, status.Errorf(common.CreateVolumeErrorCode(err), msg)
 	}
+	c.volumeCreated(volumeInfo.VolumeID.Id, manager)
 
 	attributes := make(map[string]string)
 	attributes[common.AttributeDiskType] = common.DiskTypeBlockVolume
+	scParams.AddVolumeContextParams(attributes)
 	if csiMigrationFeatureState && scParams.CSIMigration == "true" {
 		// In case if feature state switch is enabled after controller is
 		// deployed, we need to initialize the volumeMigrationService.
@@ -503,6 +705,7 @@ func (c *controller) createBlockVolume(ctx context.Context, req *csi.CreateVolum
 			VolumeId:      volumeInfo.VolumeID.Id,
 			CapacityBytes: int64(units.FileSize(volSizeMB * common.MbInBytes)),
 			VolumeContext: attributes,
+			ContentSource: req.GetVolumeContentSource(),
 		},
 	}
 
@@ -519,7 +722,7 @@ func (c *controller) createBlockVolume(ctx context.Context, req *csi.CreateVolum
 			queryFilter := cnstypes.CnsQueryFilter{
 				VolumeIds: volumeIds,
 			}
-			queryResult, err := c.manager.VolumeManager.QueryVolume(ctx, queryFilter)
+			queryResult, err := utils.QueryVolumeUtil(ctx, manager.VolumeManager, queryFilter, utils.QuerySelection())
 			if err != nil {
 				log.Errorf("QueryVolume failed for volumeID: %s", volumeInfo.VolumeID.Id)
 				return nil, status.Error(codes.Internal, err.Error())
@@ -585,10 +788,32 @@ func (c *controller) createFileVolume(ctx context.Context, req *csi.CreateVolume
 		log.Error(msg)
 		return nil, status.Errorf(codes.InvalidArgument, msg)
 	}
+	if err := scParams.ValidateFileVolumeParams(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if scParams.VCenter != "" && scParams.VCenter != c.manager.VcenterConfig.Host {
+		return nil, status.Errorf(codes.InvalidArgument,
+			"file volumes can only be created in vCenter %q", c.manager.VcenterConfig.Host)
+	}
+	adoptedDisk, err := getAdoptedDisk(ctx, scParams)
+	if err != nil {
+		return nil, err
+	}
+	if adoptedDisk != "" {
+		return nil, status.Errorf(codes.InvalidArgument,
+			"disk %q can't be adopted: pre-created disks can only be adopted as single node volumes", adoptedDisk)
+	}
+	if req.GetVolumeContentSource() != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "file volumes can't be created from a volume content source")
+	}
 
+	volumeName, err := getVolumeName(ctx, req.Name, scParams)
+	if err != nil {
+		return nil, err
+	}
 	var createVolumeSpec = common.CreateVolumeSpec{
 		CapacityMB: volSizeMB,
-		Name:       req.Name,
+		Name:       volumeName,
 		ScParams:   scParams,
 		VolumeType: common.FileVolumeType,
 	}
@@ -606,14 +831,30 @@ func (c *controller) createFileVolume(ctx context.Context, req *csi.CreateVolume
 			log.Error(msg)
 			return nil, status.Errorf(codes.Internal, msg)
 		}
+		if len(scParams.DatastoreTags) != 0 {
+			filteredDatastores, err = filterDatastoresByTags(ctx, c.manager, filteredDatastores, scParams.DatastoreTags)
+			if err != nil {
+				return nil, err
+			}
+		}
 		volumeID, err = common.CreateFileVolumeUtil(ctx, cnstypes.CnsClusterFlavorVanilla,
 			c.manager, &createVolumeSpec, filteredDatastores)
 		if err != nil {
 			msg := fmt.Sprintf("failed to create volume. Error: %+v", err)
 			log.Error(msg)
-			return nil, status.Errorf(codes.Internal, msg)
+			if reason, message, ok := common.PVCEventForError(err); ok {
+				pvc := types.NamespacedName{Namespace: createVolumeSpec.ScParams.PVCNamespace, Name: createVolumeSpec.ScParams.PVCName}
+				commonco.ContainerOrchestratorUtility.RecordPVCEvent(ctx, "", pvc, v1.EventTypeWarning, reason, message)
+			}
+			return nil, status.Errorf(common.CreateVolumeErrorCode(err), msg)
 		}
 	} else {
+		if len(scParams.DatastoreTags) != 0 {
+			msg := fmt.Sprintf("param %q requires the %q feature for file volumes",
+				common.AttributeDatastoreTags, common.CSIAuthCheck)
+			log.Error(msg)
+			return nil, status.Error(codes.InvalidArgument, msg)
+		}
 		volumeID, err = common.CreateFileVolumeUtilOld(ctx, cnstypes.CnsClusterFlavorVanilla, c.manager, &createVolumeSpec)
 		if err != nil {
 			msg := fmt.Sprintf("failed to create volume. Error: %+v", err)
@@ -647,10 +888,10 @@ func (c *controller) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequ
 		ctx = logger.NewContextWithLogger(ctx)
 		log := logger.GetLogger(ctx)
 		log.Infof("CreateVolume: called with args %+v", *req)
-		volumeCapabilities := req.GetVolumeCapabilities()
-		if err := common.IsValidVolumeCapabilities(ctx, volumeCapabilities); err != nil {
-			return nil, status.Errorf(codes.InvalidArgument, "Volume capability not supported. Err: %+v", err)
+		if err := validateVanillaCreateVolumeRequest(ctx, req); err != nil {
+			return nil, err
 		}
+		volumeCapabilities := req.GetVolumeCapabilities()
 		if common.IsFileVolumeRequest(ctx, volumeCapabilities) {
 			volumeType = prometheus.PrometheusFileVolumeType
 			isvSANFileServicesSupported, err := c.manager.VcenterManager.IsvSANFileServicesSupported(ctx, c.manager.VcenterConfig.Host)
@@ -720,14 +961,26 @@ func (c *controller) DeleteVolume(ctx context.Context, req *csi.DeleteVolumeRequ
 				return nil, status.Errorf(codes.Internal, msg)
 			}
 		}
+		manager, err := c.getManagerForVolume(ctx, req.VolumeId)
+		if err == common.ErrNotFound {
+			log.Infof("DeleteVolume: volume %q not found in any vCenter, assuming it was deleted", req.VolumeId)
+			c.volumeDeleted(req.VolumeId)
+			return &csi.DeleteVolumeResponse{}, nil
+		}
+		if err != nil {
+			msg := fmt.Sprintf("failed to find the vCenter of volume: %q. Error: %+v", req.VolumeId, err)
+			log.Error(msg)
+			return nil, status.Errorf(codes.Internal, msg)
+		}
 		// TODO: Add code to determine the volume type and set volumeType for
 		// Prometheus metric accordingly.
-		err = common.DeleteVolumeUtil(ctx, c.manager.VolumeManager, req.VolumeId, true)
+		err = common.DeleteVolumeUtil(ctx, manager.VolumeManager, req.VolumeId, true)
 		if err != nil {
 			msg := fmt.Sprintf("failed to delete volume: %q. Error: %+v", req.VolumeId, err)
 			log.Error(msg)
 			return nil, status.Errorf(codes.Internal, msg)
 		}
+		c.volumeDeleted(req.VolumeId)
 		// Migration feature switch is enabled and volumePath is set.
 		if volumePath != "" {
 			// Delete VolumePath to VolumeID mapping.
@@ -766,9 +1019,8 @@ func (c *controller) ControllerPublishVolume(ctx context.Context, req *csi.Contr
 		log.Infof("ControllerPublishVolume: called with args %+v", *req)
 		err := validateVanillaControllerPublishVolumeRequest(ctx, req)
 		if err != nil {
-			msg := fmt.Sprintf("Validation for PublishVolume Request: %+v has failed. Error: %v", *req, err)
-			log.Error(msg)
-			return nil, status.Errorf(codes.Internal, msg)
+			log.Errorf("Validation for PublishVolume Request: %+v has failed. Error: %v", *req, err)
+			return nil, err
 		}
 		publishInfo := make(map[string]string)
 		// Check whether its a block or file volume.
@@ -778,13 +1030,9 @@ func (c *controller) ControllerPublishVolume(ctx context.Context, req *csi.Contr
 			queryFilter := cnstypes.CnsQueryFilter{
 				VolumeIds: []cnstypes.CnsVolumeId{{Id: req.VolumeId}},
 			}
-			querySelection := cnstypes.CnsQuerySelection{
-				Names: []string{
-					string(cnstypes.QuerySelectionNameTypeBackingObjectDetails),
-				},
-			}
 			// Select only the backing object details.
-			queryResult, err := utils.QueryVolumeUtil(ctx, c.manager.VolumeManager, queryFilter, querySelection, commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.AsyncQueryVolume))
+			querySelection := utils.QuerySelection(cnstypes.QuerySelectionNameTypeBackingObjectDetails)
+			queryResult, err := utils.QueryVolumeUtil(ctx, c.manager.VolumeManager, queryFilter, querySelection)
 			if err != nil {
 				msg := fmt.Sprintf("QueryVolume failed with err=%+v", err.Error())
 				log.Error(msg)
@@ -843,10 +1091,77 @@ func (c *controller) ControllerPublishVolume(ctx context.Context, req *csi.Contr
 			if err != nil {
 				msg := fmt.Sprintf("failed to find VirtualMachine for node:%q. Error: %v", req.NodeId, err)
 				log.Error(msg)
+				if err == cnsnode.ErrNodeNotFound {
+					return nil, status.Errorf(codes.NotFound, msg)
+				}
 				return nil, status.Errorf(codes.Internal, msg)
 			}
 			log.Debugf("Found VirtualMachine for node:%q.", req.NodeId)
-			diskUUID, err := common.AttachVolumeUtil(ctx, c.manager, node, req.VolumeId)
+			// The volume is attached through the CNS of the vCenter of the node.
+			manager := c.getManagerForNode(node)
+			ioAllocation, err := common.ParseDiskIOAllocation(req.VolumeContext)
+			if err != nil {
+				return nil, status.Errorf(codes.InvalidArgument,
+					"invalid storage I/O allocation of volume %q: %v", req.VolumeId, err)
+			}
+			placement, err := common.ParseDiskPlacement(req.VolumeContext)
+			if err != nil {
+				return nil, status.Errorf(codes.InvalidArgument,
+					"invalid disk placement of volume %q: %v", req.VolumeId, err)
+			}
+			defaultPlacement, err := common.NewDiskPlacement(c.manager.CnsConfig.Global.DiskControllerType,
+				c.manager.CnsConfig.Global.DiskPlacementPolicy)
+			if err != nil {
+				return nil, status.Errorf(codes.FailedPrecondition, "invalid default disk placement: %v", err)
+			}
+			placement = placement.WithDefaults(defaultPlacement).WithDefaults(common.DiskPlacement{
+				ControllerType: common.DiskControllerPVSCSI, Policy: common.DiskPlacementFill})
+			// The datastore of the volume is needed to check that the node VM can access it
+			// and, as CNS attaches volumes to paravirtual SCSI controllers of its choice, to
+			// attach the FCD to the selected controller directly.
+			queryFilter := cnstypes.CnsQueryFilter{
+				VolumeIds: []cnstypes.CnsVolumeId{{Id: req.VolumeId}},
+			}
+			queryResult, err := utils.QueryVolumeUtil(ctx, manager.VolumeManager, queryFilter, utils.QuerySelection())
+			if err != nil {
+				msg := fmt.Sprintf("QueryVolume failed with err=%+v", err.Error())
+				log.Error(msg)
+				return nil, status.Error(codes.Internal, msg)
+			}
+			if len(queryResult.Volumes) == 0 {
+				msg := fmt.Sprintf("volumeID %s not found in QueryVolume", req.VolumeId)
+				log.Error(msg)
+				return nil, status.Error(codes.NotFound, msg)
+			}
+			datastoreURL := queryResult.Volumes[0].DatastoreUrl
+			if err := checkDatastoreAccessibleToNode(ctx, node, datastoreURL); err != nil {
+				return nil, err
+			}
+			var diskUUID string
+			err = c.nodeQueue.run(ctx, req.NodeId, func() error {
+				var err error
+				if placement.IsSet() {
+					diskUUID, err = cnsvolume.AttachVolumeWithPlacement(ctx, node, req.VolumeId, datastoreURL,
+						placement.ControllerType, placement.Policy == common.DiskPlacementSpread)
+				} else {
+					diskUUID, err = common.AttachVolumeUtil(ctx, manager, node, req.VolumeId)
+				}
+				if err != nil && !placement.IsSet() {
+					// The attach may have failed for lack of a free unit on the SCSI controllers.
+					added, addErr := cnsvolume.AddSCSIControllerIfFull(ctx, node)
+					if addErr != nil {
+						log.Warnf("failed to add a SCSI controller to node %q. err: %v", req.NodeId, addErr)
+					}
+					if added {
+						diskUUID, err = common.AttachVolumeUtil(ctx, manager, node, req.VolumeId)
+					}
+				}
+				if err != nil || !ioAllocation.IsSet() {
+					return err
+				}
+				// FCDs have no storage I/O allocation until they are attached.
+				return cnsvolume.SetDiskIOAllocation(ctx, node, req.VolumeId, ioAllocation.StorageIOAllocationInfo())
+			})
 			if err != nil {
 				msg := fmt.Sprintf("failed to attach disk: %+q with node: %q err %+v", req.VolumeId, req.NodeId, err)
 				log.Error(msg)
@@ -885,22 +1200,22 @@ func (c *controller) ControllerUnpublishVolume(ctx context.Context, req *csi.Con
 		log.Infof("ControllerUnpublishVolume: called with args %+v", *req)
 		err := validateVanillaControllerUnpublishVolumeRequest(ctx, req)
 		if err != nil {
-			msg := fmt.Sprintf("Validation for UnpublishVolume Request: %+v has failed. Error: %v", *req, err)
-			log.Error(msg)
-			return nil, status.Errorf(codes.Internal, msg)
+			log.Errorf("Validation for UnpublishVolume Request: %+v has failed. Error: %v", *req, err)
+			return nil, err
 		}
 		if !strings.Contains(req.VolumeId, ".vmdk") {
 			// Check if volume is block or file, skip detach for file volume.
 			queryFilter := cnstypes.CnsQueryFilter{
 				VolumeIds: []cnstypes.CnsVolumeId{{Id: req.VolumeId}},
 			}
-			querySelection := cnstypes.CnsQuerySelection{
-				Names: []string{
-					string(cnstypes.QuerySelectionNameTypeVolumeType),
-				},
+			manager, err := c.getManagerForVolume(ctx, req.VolumeId)
+			if err != nil {
+				log.Errorf("failed to find the vCenter of volume %q. Error: %+v", req.VolumeId, err)
+				return nil, getManagerForVolumeError(req.VolumeId, err)
 			}
 			// Select only the volume type.
-			queryResult, err := utils.QueryVolumeUtil(ctx, c.manager.VolumeManager, queryFilter, querySelection, commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.AsyncQueryVolume))
+			querySelection := utils.QuerySelection(cnstypes.QuerySelectionNameTypeVolumeType)
+			queryResult, err := utils.QueryVolumeUtil(ctx, manager.VolumeManager, queryFilter, querySelection)
 			if err != nil {
 				msg := fmt.Sprintf("QueryVolume failed with err=%+v", err.Error())
 				log.Error(msg)
@@ -952,18 +1267,49 @@ func (c *controller) ControllerUnpublishVolume(ctx context.Context, req *csi.Con
 		}
 		// Block Volume.
 		volumeType = prometheus.PrometheusBlockVolumeType
+		if commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.DetachPodUsageCheck) {
+			if err := checkVolumeNotInUse(ctx, req.VolumeId, req.NodeId); err != nil {
+				// Error is already wrapped in CSI error code.
+				return nil, err
+			}
+		}
 		node, err := c.nodeMgr.GetNodeByName(ctx, req.NodeId)
+		if err == cnsvsphere.ErrVMNotFound {
+			// The Node VM was removed from the vCenter inventory, volumes are
+			// detached along with it.
+			log.Infof("VirtualMachine for node: %q is not present in the vCenter inventory. "+
+				"Marking ControllerUnpublishVolume for volume: %q successful", req.NodeId, req.VolumeId)
+			return &csi.ControllerUnpublishVolumeResponse{}, nil
+		}
+		if err == cnsnode.ErrNodeNotFound {
+			// The Node was deleted from the cluster, so the volume can't be used on
+			// it anymore. The volumes left on the VMs of deleted nodes are detached
+			// by the lost node detacher when it is enabled.
+			log.Infof("Node: %q is not registered. Marking ControllerUnpublishVolume for volume: %q successful",
+				req.NodeId, req.VolumeId)
+			return &csi.ControllerUnpublishVolumeResponse{}, nil
+		}
 		if err != nil {
 			msg := fmt.Sprintf("failed to find VirtualMachine for node:%q. Error: %v", req.NodeId, err)
 			log.Error(msg)
 			return nil, status.Error(codes.Internal, msg)
 		}
-		err = common.DetachVolumeUtil(ctx, c.manager, node, req.VolumeId)
-		if err != nil {
+		detach := func() error {
+			return c.nodeQueue.run(ctx, req.NodeId, func() error {
+				return common.DetachVolumeUtil(ctx, c.getManagerForNode(node), node, req.VolumeId)
+			})
+		}
+		if err = detach(); err != nil {
 			msg := fmt.Sprintf("failed to detach disk: %+q from node: %q err %+v", req.VolumeId, req.NodeId, err)
 			log.Error(msg)
 			return nil, status.Error(codes.Internal, msg)
 		}
+		err = waitForVolumeDetached(ctx, getDetachWaitConfig(c.manager.CnsConfig), req.VolumeId, req.NodeId, node,
+			detach)
+		if err != nil {
+			// Error is already wrapped in CSI error code.
+			return nil, err
+		}
 		log.Infof("ControllerUnpublishVolume successful for volume ID: %s", req.VolumeId)
 		return &csi.ControllerUnpublishVolumeResponse{}, nil
 	}
@@ -992,7 +1338,12 @@ func (c *controller) ControllerExpandVolume(ctx context.Context, req *csi.Contro
 		return nil, status.Errorf(codes.Unimplemented, msg)
 	}
 
-	isExtendSupported, err := c.manager.VcenterManager.IsExtendVolumeSupported(ctx, c.manager.VcenterConfig.Host)
+	manager, err := c.getManagerForVolume(ctx, req.VolumeId)
+	if err != nil {
+		log.Errorf("failed to find the vCenter of volume %q. Error: %+v", req.VolumeId, err)
+		return nil, getManagerForVolumeError(req.VolumeId, err)
+	}
+	isExtendSupported, err := manager.VcenterManager.IsExtendVolumeSupported(ctx, manager.VcenterConfig.Host)
 	if err != nil {
 		log.Errorf("failed to verify if extend volume is supported or not. Error: %+v", err)
 		return nil, status.Error(codes.Internal, err.Error())
@@ -1003,14 +1354,29 @@ func (c *controller) ControllerExpandVolume(ctx context.Context, req *csi.Contro
 		return nil, status.Error(codes.Internal, msg)
 	}
 
-	isOnlineExpansionSupported, err := c.manager.VcenterManager.IsOnlineExtendVolumeSupported(ctx, c.manager.VcenterConfig.Host)
+	isOnlineExpansionSupported, err := manager.VcenterManager.IsOnlineExtendVolumeSupported(ctx, manager.VcenterConfig.Host)
 	if err != nil {
 		msg := fmt.Sprintf("failed to check if online expansion is supported due to error: %v", err)
 		log.Error(msg)
 		return nil, status.Errorf(codes.Internal, msg)
 	}
 	isOnlineExpansionEnabled := commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.OnlineVolumeExtend)
-	err = validateVanillaControllerExpandVolumeRequest(ctx, req, isOnlineExpansionEnabled, isOnlineExpansionSupported)
+	isOfflineExpansionOnly, err := isOfflineExpansionOnly(ctx, req.GetVolumeId())
+	if err != nil {
+		return nil, err
+	}
+	isFileVolumeExtendSupported := false
+	if commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.FileVolumeExtend) {
+		isFileVolumeExtendSupported, err = manager.VcenterManager.IsFileVolumeExtendSupported(ctx,
+			manager.VcenterConfig.Host)
+		if err != nil {
+			msg := fmt.Sprintf("failed to check if file volume expansion is supported due to error: %v", err)
+			log.Error(msg)
+			return nil, status.Errorf(codes.Internal, msg)
+		}
+	}
+	err = validateVanillaControllerExpandVolumeRequest(ctx, req, isOnlineExpansionEnabled, isOnlineExpansionSupported,
+		isOfflineExpansionOnly, isFileVolumeExtendSupported)
 	if err != nil {
 		msg := fmt.Sprintf("validation for ExpandVolume Request: %+v has failed. Error: %v", *req, err)
 		log.Error(msg)
@@ -1021,11 +1387,22 @@ func (c *controller) ControllerExpandVolume(ctx context.Context, req *csi.Contro
 	volSizeBytes := int64(req.GetCapacityRange().GetRequiredBytes())
 	volSizeMB := int64(common.RoundUpSize(volSizeBytes, common.MbInBytes))
 
-	err = common.ExpandVolumeUtil(ctx, c.manager, volumeID, volSizeMB, commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.AsyncQueryVolume))
+	err = common.ExpandVolumeUtil(ctx, manager, volumeID, volSizeMB)
 	if err != nil {
 		msg := fmt.Sprintf("failed to expand volume: %q to size: %d with error: %+v", volumeID, volSizeMB, err)
 		log.Error(msg)
-		return nil, status.Errorf(codes.Internal, msg)
+		if reason, message, ok := common.PVCEventForError(err); ok {
+			commonco.ContainerOrchestratorUtility.RecordPVCEvent(ctx, volumeID, types.NamespacedName{},
+				v1.EventTypeWarning, reason, message)
+		}
+		code := common.ExpandVolumeErrorCode(err)
+		if code == codes.Internal {
+			// Disks of VMs with snapshots can't be expanded while attached.
+			if snapshotErr := checkExpansionBlockedBySnapshots(ctx, volumeID); snapshotErr != nil {
+				return nil, snapshotErr
+			}
+		}
+		return nil, status.Errorf(code, msg)
 	}
 
 	// Always set nodeExpansionRequired to true, even if requested size is equal
@@ -1039,6 +1416,11 @@ func (c *controller) ControllerExpandVolume(ctx context.Context, req *csi.Contro
 	if _, ok := req.GetVolumeCapability().GetAccessType().(*csi.VolumeCapability_Block); ok {
 		nodeExpansionRequired = false
 	}
+	// Node expansion is not required for file volumes either, resizing the
+	// quota of their file share is enough.
+	if common.IsFileVolumeRequest(ctx, []*csi.VolumeCapability{req.GetVolumeCapability()}) {
+		nodeExpansionRequired = false
+	}
 	resp := &csi.ControllerExpandVolumeResponse{
 		CapacityBytes:         int64(units.FileSize(volSizeMB * common.MbInBytes)),
 		NodeExpansionRequired: nodeExpansionRequired,
@@ -1051,8 +1433,31 @@ func (c *controller) ValidateVolumeCapabilities(ctx context.Context, req *csi.Va
 	*csi.ValidateVolumeCapabilitiesResponse, error) {
 	ctx = logger.NewContextWithLogger(ctx)
 	log := logger.GetLogger(ctx)
-	log.Infof("ControllerGetCapabilities: called with args %+v", *req)
+	log.Infof("ValidateVolumeCapabilities: called with args %+v", *req)
+	if req.GetVolumeId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "volume id is a required parameter")
+	}
 	volCaps := req.GetVolumeCapabilities()
+	if len(volCaps) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "volume capabilities is a required parameter")
+	}
+	manager, err := c.getManagerForVolume(ctx, req.GetVolumeId())
+	if err != nil {
+		log.Errorf("failed to find the vCenter of volume %q. Error: %+v", req.GetVolumeId(), err)
+		return nil, getManagerForVolumeError(req.GetVolumeId(), err)
+	}
+	queryFilter := cnstypes.CnsQueryFilter{
+		VolumeIds: []cnstypes.CnsVolumeId{{Id: req.GetVolumeId()}},
+	}
+	querySelection := utils.QuerySelection(cnstypes.QuerySelectionNameTypeVolumeType)
+	queryResult, err := utils.QueryVolumeUtil(ctx, manager.VolumeManager, queryFilter, querySelection)
+	if err != nil {
+		// Error is already wrapped in CSI error code.
+		return nil, err
+	}
+	if len(queryResult.Volumes) == 0 {
+		return nil, status.Errorf(codes.NotFound, "volume %q not found", req.GetVolumeId())
+	}
 	var confirmed *csi.ValidateVolumeCapabilitiesResponse_Confirmed
 	if err := common.IsValidVolumeCapabilities(ctx, volCaps); err == nil {
 		confirmed = &csi.ValidateVolumeCapabilitiesResponse_Confirmed{VolumeCapabilities: volCaps}
@@ -1067,7 +1472,133 @@ func (c *controller) ListVolumes(ctx context.Context, req *csi.ListVolumesReques
 	ctx = logger.NewContextWithLogger(ctx)
 	log := logger.GetLogger(ctx)
 	log.Infof("ListVolumes: called with args %+v", *req)
-	return nil, status.Error(codes.Unimplemented, "")
+	if !commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.ListVolumes) {
+		return nil, status.Error(codes.Unimplemented, "")
+	}
+	if req.MaxEntries < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid max entries %d", req.MaxEntries)
+	}
+	// The volumes of the vCenters are listed one after the other, in the
+	// order of getAllManagers.
+	managers := c.getAllManagers()
+	var index int
+	var offset int64
+	if req.StartingToken != "" {
+		var err error
+		index, offset, err = parseListVolumesToken(req.StartingToken, len(managers))
+		if err != nil {
+			return nil, status.Errorf(codes.Aborted, "invalid starting token %q: %v", req.StartingToken, err)
+		}
+	}
+	resp := &csi.ListVolumesResponse{}
+	var volumes []cnstypes.CnsVolume
+	for {
+		maxEntries := int64(req.MaxEntries)
+		if maxEntries > 0 {
+			maxEntries -= int64(len(volumes))
+		}
+		vcVolumes, nextOffset, err := queryBlockVolumes(ctx, managers[index].VolumeManager,
+			c.manager.CnsConfig.Global.ClusterID, offset, maxEntries)
+		if err != nil {
+			return nil, err
+		}
+		volumes = append(volumes, vcVolumes...)
+		if nextOffset != 0 {
+			resp.NextToken = formatListVolumesToken(index, nextOffset)
+			break
+		}
+		if index++; index == len(managers) {
+			break
+		}
+		offset = 0
+		if req.MaxEntries > 0 && int64(len(volumes)) >= int64(req.MaxEntries) {
+			resp.NextToken = formatListVolumesToken(index, offset)
+			break
+		}
+	}
+	publishedNodeIDs, err := getPublishedNodeIDs(ctx, c.nodeMgr)
+	if err != nil {
+		msg := fmt.Sprintf("failed to get the nodes volumes are published to. Error: %v", err)
+		log.Error(msg)
+		return nil, status.Error(codes.Internal, msg)
+	}
+	for _, volume := range volumes {
+		var capacityInMb int64
+		if volume.BackingObjectDetails != nil {
+			capacityInMb = volume.BackingObjectDetails.GetCnsBackingObjectDetails().CapacityInMb
+		}
+		resp.Entries = append(resp.Entries, &csi.ListVolumesResponse_Entry{
+			Volume: &csi.Volume{
+				VolumeId:      volume.VolumeId.Id,
+				CapacityBytes: capacityInMb * common.MbInBytes,
+			},
+			Status: &csi.ListVolumesResponse_VolumeStatus{
+				PublishedNodeIds: publishedNodeIDs[volume.VolumeId.Id],
+			},
+		})
+	}
+	return resp, nil
+}
+
+// ControllerGetVolume returns the volume with its condition, derived from the
+// health status of the volume in CNS, and the nodes it is published to.
+func (c *controller) ControllerGetVolume(ctx context.Context, req *csi.ControllerGetVolumeRequest) (
+	*csi.ControllerGetVolumeResponse, error) {
+	ctx = logger.NewContextWithLogger(ctx)
+	log := logger.GetLogger(ctx)
+	log.Infof("ControllerGetVolume: called with args %+v", *req)
+	if !commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.VolumeCondition) {
+		return nil, status.Error(codes.Unimplemented, "")
+	}
+	if req.GetVolumeId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "volume id is a required parameter")
+	}
+	queryFilter := cnstypes.CnsQueryFilter{
+		VolumeIds: []cnstypes.CnsVolumeId{{Id: req.GetVolumeId()}},
+	}
+	querySelection := utils.QuerySelection(cnstypes.QuerySelectionNameTypeVolumeType,
+		cnstypes.QuerySelectionNameTypeBackingObjectDetails, cnstypes.QuerySelectionNameTypeHealthStatus)
+	manager, err := c.getManagerForVolume(ctx, req.GetVolumeId())
+	if err != nil {
+		log.Errorf("failed to find the vCenter of volume %q. Error: %+v", req.GetVolumeId(), err)
+		return nil, getManagerForVolumeError(req.GetVolumeId(), err)
+	}
+	queryResult, err := utils.QueryVolumeUtil(ctx, manager.VolumeManager, queryFilter, querySelection)
+	if err != nil {
+		// Error is already wrapped in CSI error code.
+		return nil, err
+	}
+	if len(queryResult.Volumes) == 0 {
+		return nil, status.Errorf(codes.NotFound, "volume %q not found", req.GetVolumeId())
+	}
+	volume := queryResult.Volumes[0]
+	var capacityInMb int64
+	if volume.BackingObjectDetails != nil {
+		capacityInMb = volume.BackingObjectDetails.GetCnsBackingObjectDetails().CapacityInMb
+	}
+	resp := &csi.ControllerGetVolumeResponse{
+		Volume: &csi.Volume{
+			VolumeId:      volume.VolumeId.Id,
+			CapacityBytes: capacityInMb * common.MbInBytes,
+		},
+		Status: &csi.ControllerGetVolumeResponse_VolumeStatus{
+			VolumeCondition: common.GetVolumeCondition(volume.HealthStatus),
+		},
+	}
+	// File volumes aren't attached to node VMs. The nodes of block volumes
+	// are looked up in the devices of the node VMs, as in ListVolumes.
+	if volume.VolumeType == common.BlockVolumeType {
+		publishedNodeIDs, err := getPublishedNodeIDs(ctx, c.nodeMgr)
+		if err != nil {
+			msg := fmt.Sprintf("failed to get the nodes volume %q is published to. Error: %v", req.GetVolumeId(), err)
+			log.Error(msg)
+			return nil, status.Error(codes.Internal, msg)
+		}
+		resp.Status.PublishedNodeIds = publishedNodeIDs[req.GetVolumeId()]
+	}
+	log.Debugf("ControllerGetVolume: volume %q health status %q, condition %+v", req.GetVolumeId(),
+		volume.HealthStatus, resp.Status.VolumeCondition)
+	return resp, nil
 }
 
 func (c *controller) GetCapacity(ctx context.Context, req *csi.GetCapacityRequest) (
@@ -1075,7 +1606,57 @@ func (c *controller) GetCapacity(ctx context.Context, req *csi.GetCapacityReques
 	ctx = logger.NewContextWithLogger(ctx)
 	log := logger.GetLogger(ctx)
 	log.Infof("GetCapacity: called with args %+v", *req)
-	return nil, status.Error(codes.Unimplemented, "")
+	if !commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.StorageCapacityTracking) {
+		return nil, status.Error(codes.Unimplemented, "")
+	}
+	if len(req.GetVolumeCapabilities()) != 0 && common.IsFileVolumeRequest(ctx, req.GetVolumeCapabilities()) {
+		return nil, status.Error(codes.InvalidArgument, "GetCapacity is only supported for block volumes")
+	}
+	csiMigrationFeatureState := commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.CSIMigration)
+	scParams, err := common.ParseStorageClassParams(ctx, req.GetParameters(), csiMigrationFeatureState)
+	if err != nil {
+		msg := fmt.Sprintf("Parsing storage class parameters failed with error: %+v", err)
+		log.Error(msg)
+		return nil, status.Errorf(codes.InvalidArgument, msg)
+	}
+	// The capacity of a topology segment is the capacity of the datastores
+	// shared by its nodes.
+	var topologyRequirement *csi.TopologyRequirement
+	if req.GetAccessibleTopology() != nil {
+		topologyRequirement = &csi.TopologyRequirement{
+			Requisite: []*csi.Topology{req.GetAccessibleTopology()},
+		}
+	}
+	sharedDatastores, _, err := c.getSharedDatastores(ctx, topologyRequirement)
+	if err != nil {
+		return nil, err
+	}
+	manager, sharedDatastores, err := c.getManagerForCreate(ctx, scParams, "", sharedDatastores)
+	if status.Code(err) == codes.NotFound {
+		// Volumes of the StorageClass can't be created in the topology segment.
+		log.Debugf("GetCapacity: %v", err)
+		return &csi.GetCapacityResponse{AvailableCapacity: 0}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.CSIAuthCheck) && manager == c.manager {
+		sharedDatastores = c.filterDatastores(ctx, sharedDatastores)
+	}
+	if len(scParams.DatastoreTags) != 0 {
+		sharedDatastores, err = filterDatastoresByTags(ctx, manager, sharedDatastores, scParams.DatastoreTags)
+		if err != nil {
+			return nil, err
+		}
+	}
+	capacity, err := common.GetCapacityUtil(ctx, manager, scParams, sharedDatastores)
+	if err != nil {
+		msg := fmt.Sprintf("failed to get capacity. Error: %+v", err)
+		log.Error(msg)
+		return nil, status.Error(codes.Internal, msg)
+	}
+	log.Debugf("GetCapacity: %d bytes available on datastores %v", capacity, sharedDatastores)
+	return &csi.GetCapacityResponse{AvailableCapacity: capacity}, nil
 }
 
 // initVolumeMigrationService is a helper method to initialize
@@ -1109,6 +1690,24 @@ func (c *controller) ControllerGetCapabilities(ctx context.Context, req *csi.Con
 		csi.ControllerServiceCapability_RPC_PUBLISH_UNPUBLISH_VOLUME,
 		csi.ControllerServiceCapability_RPC_EXPAND_VOLUME,
 	}
+	if commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.ListVolumes) {
+		controllerCaps = append(controllerCaps, csi.ControllerServiceCapability_RPC_LIST_VOLUMES,
+			csi.ControllerServiceCapability_RPC_LIST_VOLUMES_PUBLISHED_NODES)
+	}
+	if commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.BlockVolumeSnapshot) {
+		controllerCaps = append(controllerCaps, csi.ControllerServiceCapability_RPC_CREATE_DELETE_SNAPSHOT,
+			csi.ControllerServiceCapability_RPC_LIST_SNAPSHOTS)
+	}
+	if commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.VolumeClone) {
+		controllerCaps = append(controllerCaps, csi.ControllerServiceCapability_RPC_CLONE_VOLUME)
+	}
+	if commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.StorageCapacityTracking) {
+		controllerCaps = append(controllerCaps, csi.ControllerServiceCapability_RPC_GET_CAPACITY)
+	}
+	if commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.VolumeCondition) {
+		controllerCaps = append(controllerCaps, csi.ControllerServiceCapability_RPC_GET_VOLUME,
+			csi.ControllerServiceCapability_RPC_VOLUME_CONDITION)
+	}
 
 	var caps []*csi.ControllerServiceCapability
 	for _, cap := range controllerCaps {
@@ -1124,26 +1723,228 @@ func (c *controller) ControllerGetCapabilities(ctx context.Context, req *csi.Con
 	return &csi.ControllerGetCapabilitiesResponse{Capabilities: caps}, nil
 }
 
+// CreateSnapshot creates a snapshot of the FCD of a block volume. The ID of
+// the snapshot is made of the volume ID and the FCD snapshot ID. A retried
+// request returns the snapshot already created for its name.
 func (c *controller) CreateSnapshot(ctx context.Context, req *csi.CreateSnapshotRequest) (
 	*csi.CreateSnapshotResponse, error) {
-	ctx = logger.NewContextWithLogger(ctx)
-	log := logger.GetLogger(ctx)
-	log.Infof("CreateSnapshot: called with args %+v", *req)
-	return nil, status.Error(codes.Unimplemented, "")
+	start := time.Now()
+	volumeType := prometheus.PrometheusUnknownVolumeType
+
+	createSnapshotInternal := func() (
+		*csi.CreateSnapshotResponse, error) {
+		ctx = logger.NewContextWithLogger(ctx)
+		log := logger.GetLogger(ctx)
+		log.Infof("CreateSnapshot: called with args %+v", *req)
+		if !commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.BlockVolumeSnapshot) {
+			return nil, status.Error(codes.Unimplemented, "")
+		}
+		if err := common.ValidateCreateSnapshotRequest(ctx, req); err != nil {
+			return nil, err
+		}
+		manager, err := c.getManagerForVolume(ctx, req.SourceVolumeId)
+		if err != nil {
+			log.Errorf("failed to find the vCenter of volume %q. Error: %+v", req.SourceVolumeId, err)
+			return nil, getManagerForVolumeError(req.SourceVolumeId, err)
+		}
+		volumes, err := querySnapshotVolumes(ctx, manager, []string{req.SourceVolumeId})
+		if err != nil {
+			// Error is already wrapped in CSI error code.
+			return nil, err
+		}
+		if len(volumes) == 0 {
+			return nil, status.Errorf(codes.NotFound, "source volume %q not found", req.SourceVolumeId)
+		}
+		volume := volumes[0]
+		if volume.VolumeType != common.BlockVolumeType {
+			volumeType = prometheus.PrometheusFileVolumeType
+			return nil, status.Errorf(codes.InvalidArgument, "snapshots of %s volume %q are not supported",
+				volume.VolumeType, req.SourceVolumeId)
+		}
+		volumeType = prometheus.PrometheusBlockVolumeType
+		snapshot, err := manager.VolumeManager.CreateSnapshot(ctx, req.SourceVolumeId, req.Name)
+		if err != nil {
+			msg := fmt.Sprintf("failed to create snapshot %q of volume %q. Error: %+v", req.Name,
+				req.SourceVolumeId, err)
+			log.Error(msg)
+			return nil, status.Error(codes.Internal, msg)
+		}
+		csiSnapshot, err := newCSISnapshot(volume, *snapshot)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		log.Infof("CreateSnapshot: created snapshot %q of volume %q for %q", csiSnapshot.SnapshotId,
+			req.SourceVolumeId, req.Name)
+		return &csi.CreateSnapshotResponse{Snapshot: csiSnapshot}, nil
+	}
+	resp, err := createSnapshotInternal()
+	if err != nil {
+		prometheus.CsiControlOpsHistVec.WithLabelValues(volumeType, prometheus.PrometheusCreateSnapshotOpType,
+			prometheus.PrometheusFailStatus).Observe(time.Since(start).Seconds())
+	} else {
+		prometheus.CsiControlOpsHistVec.WithLabelValues(volumeType, prometheus.PrometheusCreateSnapshotOpType,
+			prometheus.PrometheusPassStatus).Observe(time.Since(start).Seconds())
+	}
+	return resp, err
 }
 
+// DeleteSnapshot deletes a snapshot of the FCD of a block volume. Deleting a
+// snapshot which doesn't exist, or whose volume doesn't exist, succeeds.
 func (c *controller) DeleteSnapshot(ctx context.Context, req *csi.DeleteSnapshotRequest) (
 	*csi.DeleteSnapshotResponse, error) {
-	ctx = logger.NewContextWithLogger(ctx)
-	log := logger.GetLogger(ctx)
-	log.Infof("DeleteSnapshot: called with args %+v", *req)
-	return nil, status.Error(codes.Unimplemented, "")
+	start := time.Now()
+	volumeType := prometheus.PrometheusBlockVolumeType
+
+	deleteSnapshotInternal := func() (
+		*csi.DeleteSnapshotResponse, error) {
+		ctx = logger.NewContextWithLogger(ctx)
+		log := logger.GetLogger(ctx)
+		log.Infof("DeleteSnapshot: called with args %+v", *req)
+		if !commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.BlockVolumeSnapshot) {
+			return nil, status.Error(codes.Unimplemented, "")
+		}
+		if err := common.ValidateDeleteSnapshotRequest(ctx, req); err != nil {
+			return nil, err
+		}
+		volumeID, snapshotID, err := common.ParseSnapshotID(req.SnapshotId)
+		if err != nil {
+			// The snapshot can't have been created by the driver.
+			log.Infof("DeleteSnapshot: %v, assuming it doesn't exist", err)
+			return &csi.DeleteSnapshotResponse{}, nil
+		}
+		manager, err := c.getManagerForVolume(ctx, volumeID)
+		if err == common.ErrNotFound {
+			log.Infof("DeleteSnapshot: volume %q of snapshot %q not found in any vCenter, assuming the snapshot was deleted",
+				volumeID, req.SnapshotId)
+			return &csi.DeleteSnapshotResponse{}, nil
+		}
+		if err != nil {
+			msg := fmt.Sprintf("failed to find the vCenter of volume: %q. Error: %+v", volumeID, err)
+			log.Error(msg)
+			return nil, status.Error(codes.Internal, msg)
+		}
+		volumes, err := querySnapshotVolumes(ctx, manager, []string{volumeID})
+		if err != nil {
+			// Error is already wrapped in CSI error code.
+			return nil, err
+		}
+		if len(volumes) == 0 {
+			log.Infof("DeleteSnapshot: volume %q of snapshot %q not found, assuming the snapshot was deleted",
+				volumeID, req.SnapshotId)
+			return &csi.DeleteSnapshotResponse{}, nil
+		}
+		if err = manager.VolumeManager.DeleteSnapshot(ctx, volumeID, snapshotID); err != nil {
+			msg := fmt.Sprintf("failed to delete snapshot %q. Error: %+v", req.SnapshotId, err)
+			log.Error(msg)
+			return nil, status.Error(codes.Internal, msg)
+		}
+		return &csi.DeleteSnapshotResponse{}, nil
+	}
+	resp, err := deleteSnapshotInternal()
+	if err != nil {
+		prometheus.CsiControlOpsHistVec.WithLabelValues(volumeType, prometheus.PrometheusDeleteSnapshotOpType,
+			prometheus.PrometheusFailStatus).Observe(time.Since(start).Seconds())
+	} else {
+		prometheus.CsiControlOpsHistVec.WithLabelValues(volumeType, prometheus.PrometheusDeleteSnapshotOpType,
+			prometheus.PrometheusPassStatus).Observe(time.Since(start).Seconds())
+	}
+	return resp, err
 }
 
+// ListSnapshots returns the snapshot with the given ID, the snapshots of the
+// given source volume or the snapshots of all the block volumes of the
+// cluster.
 func (c *controller) ListSnapshots(ctx context.Context, req *csi.ListSnapshotsRequest) (
 	*csi.ListSnapshotsResponse, error) {
 	ctx = logger.NewContextWithLogger(ctx)
 	log := logger.GetLogger(ctx)
 	log.Infof("ListSnapshots: called with args %+v", *req)
-	return nil, status.Error(codes.Unimplemented, "")
+	if !commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.BlockVolumeSnapshot) {
+		return nil, status.Error(codes.Unimplemented, "")
+	}
+	if req.MaxEntries < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid max entries %d", req.MaxEntries)
+	}
+	start := 0
+	if req.StartingToken != "" {
+		var err error
+		start, err = strconv.Atoi(req.StartingToken)
+		if err != nil || start < 0 {
+			return nil, status.Errorf(codes.Aborted, "invalid starting token %q", req.StartingToken)
+		}
+	}
+	var volumeIDs []string
+	var snapshotID string
+	if req.SnapshotId != "" {
+		var volumeID string
+		var err error
+		volumeID, snapshotID, err = common.ParseSnapshotID(req.SnapshotId)
+		if err != nil || (req.SourceVolumeId != "" && req.SourceVolumeId != volumeID) {
+			return &csi.ListSnapshotsResponse{}, nil
+		}
+		volumeIDs = []string{volumeID}
+	} else if req.SourceVolumeId != "" {
+		volumeIDs = []string{req.SourceVolumeId}
+	}
+	// The snapshots of all the volumes are listed from all the vCenters.
+	managers := c.getAllManagers()
+	if len(volumeIDs) != 0 {
+		manager, err := c.getManagerForVolume(ctx, volumeIDs[0])
+		if err == common.ErrNotFound {
+			// A volume in no vCenter has no snapshots.
+			return &csi.ListSnapshotsResponse{}, nil
+		}
+		if err != nil {
+			msg := fmt.Sprintf("failed to find the vCenter of volume: %q. Error: %+v", volumeIDs[0], err)
+			log.Error(msg)
+			return nil, status.Error(codes.Internal, msg)
+		}
+		managers = []*common.Manager{manager}
+	}
+	var snapshots []*csi.Snapshot
+	for _, manager := range managers {
+		volumes, err := querySnapshotVolumes(ctx, manager, volumeIDs)
+		if err != nil {
+			// Error is already wrapped in CSI error code.
+			return nil, err
+		}
+		for _, volume := range volumes {
+			if volume.VolumeType != common.BlockVolumeType {
+				continue
+			}
+			volumeSnapshots, err := manager.VolumeManager.QuerySnapshots(ctx, volume.VolumeId.Id)
+			if err != nil {
+				msg := fmt.Sprintf("failed to query the snapshots of volume %q. Error: %+v", volume.VolumeId.Id, err)
+				log.Error(msg)
+				return nil, status.Error(codes.Internal, msg)
+			}
+			for _, snapshot := range volumeSnapshots {
+				if snapshotID != "" && snapshot.SnapshotID != snapshotID {
+					continue
+				}
+				csiSnapshot, err := newCSISnapshot(volume, snapshot)
+				if err != nil {
+					return nil, status.Error(codes.Internal, err.Error())
+				}
+				snapshots = append(snapshots, csiSnapshot)
+			}
+		}
+	}
+	// Snapshots are sorted by ID for the starting token to be an index into
+	// them.
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].SnapshotId < snapshots[j].SnapshotId })
+	if start > len(snapshots) {
+		return nil, status.Errorf(codes.Aborted, "starting token %q is greater than the number of snapshots %d",
+			req.StartingToken, len(snapshots))
+	}
+	end := len(snapshots)
+	resp := &csi.ListSnapshotsResponse{}
+	if req.MaxEntries > 0 && start+int(req.MaxEntries) < end {
+		end = start + int(req.MaxEntries)
+		resp.NextToken = strconv.Itoa(end)
+	}
+	for _, snapshot := range snapshots[start:end] {
+		resp.Entries = append(resp.Entries, &csi.ListSnapshotsResponse_Entry{Snapshot: snapshot})
+	}
+	return resp, nil
 }
@@ -19,16 +19,41 @@ package vanilla
 import (
 	"context"
 	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/fsnotify/fsnotify"
+	"github.com/golang/protobuf/ptypes"
+	cnstypes "github.com/vmware/govmomi/cns/types"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/mo"
+	vimtypes "github.com/vmware/govmomi/vim25/types"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
 
 	"sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/node"
+	cnsvolume "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/volume"
+	cnsvsphere "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/vsphere"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/common/utils"
 	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/common"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/common/commonco"
 	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
 )
 
+// validateVanillaCreateVolumeRequest is the helper function to validate
+// CreateVolumeRequest for Vanilla CSI driver.
+// Function returns error if validation fails otherwise returns nil.
+func validateVanillaCreateVolumeRequest(ctx context.Context, req *csi.CreateVolumeRequest) error {
+	return common.ValidateCreateVolumeRequest(ctx, req)
+}
+
 // validateVanillaDeleteVolumeRequest is the helper function to validate
 // DeleteVolumeRequest for Vanilla CSI driver.
 // Function returns error if validation fails otherwise returns nil.
@@ -53,14 +78,21 @@ func validateVanillaControllerUnpublishVolumeRequest(ctx context.Context, req *c
 // ExpandVolumeRequest for Vanilla CSI driver.
 // Function returns error if validation fails otherwise returns nil.
 func validateVanillaControllerExpandVolumeRequest(ctx context.Context, req *csi.ControllerExpandVolumeRequest,
-	isOnlineExpansionEnabled, isOnlineExpansionSupported bool) error {
+	isOnlineExpansionEnabled, isOnlineExpansionSupported, isOfflineExpansionOnly,
+	isFileVolumeExtendSupported bool) error {
 	log := logger.GetLogger(ctx)
-	if err := common.ValidateControllerExpandVolumeRequest(ctx, req); err != nil {
+	if err := common.ValidateControllerExpandVolumeRequest(ctx, req, isFileVolumeExtendSupported); err != nil {
 		return err
 	}
 
+	// File shares are not attached to the node VMs, their quota can be
+	// resized while they are mounted.
+	if common.IsFileVolumeRequest(ctx, []*csi.VolumeCapability{req.GetVolumeCapability()}) {
+		return nil
+	}
+
 	// Check online extend FSS and vCenter support
-	if isOnlineExpansionEnabled && isOnlineExpansionSupported {
+	if isOnlineExpansionEnabled && isOnlineExpansionSupported && !isOfflineExpansionOnly {
 		return nil
 	}
 
@@ -72,5 +104,503 @@ func validateVanillaControllerExpandVolumeRequest(ctx context.Context, req *csi.
 		log.Error(msg)
 		return status.Error(codes.Internal, msg)
 	}
+	if isOfflineExpansionOnly {
+		return checkOfflineExpansion(ctx, req.GetVolumeId(), nodes)
+	}
 	return common.IsOnlineExpansion(ctx, req.GetVolumeId(), nodes)
 }
+
+// isOfflineExpansionOnly returns whether the StorageClass of the volume only
+// allows it to be expanded while detached.
+func isOfflineExpansionOnly(ctx context.Context, volumeID string) (bool, error) {
+	log := logger.GetLogger(ctx)
+	params, err := commonco.ContainerOrchestratorUtility.GetVolumeStorageClassParams(ctx, volumeID)
+	if err != nil {
+		msg := fmt.Sprintf("failed to get StorageClass parameters of volume %q. Error: %+v", volumeID, err)
+		log.Error(msg)
+		return false, status.Error(codes.Internal, msg)
+	}
+	for param, value := range params {
+		if strings.ToLower(param) != common.AttributeOfflineExpansionOnly {
+			continue
+		}
+		offlineExpansionOnly, err := strconv.ParseBool(value)
+		if err != nil {
+			msg := fmt.Sprintf("invalid value %q for StorageClass parameter %q of volume %q", value, param, volumeID)
+			log.Error(msg)
+			return false, status.Error(codes.InvalidArgument, msg)
+		}
+		return offlineExpansionOnly, nil
+	}
+	return false, nil
+}
+
+// checkOfflineExpansion fails the expansion of a volume whose StorageClass
+// only allows offline expansion with FailedPrecondition while it is attached
+// to one of the nodes, and records an event explaining why on its PVC.
+func checkOfflineExpansion(ctx context.Context, volumeID string, nodes []*cnsvsphere.VirtualMachine) error {
+	log := logger.GetLogger(ctx)
+	diskUUID, err := cnsvolume.IsDiskAttachedToVMs(ctx, volumeID, nodes)
+	if err != nil {
+		msg := fmt.Sprintf("failed to check if volume %q is attached to any node with error: %+v", volumeID, err)
+		log.Error(msg)
+		return status.Errorf(codes.Internal, msg)
+	}
+	if diskUUID == "" {
+		return nil
+	}
+	msg := fmt.Sprintf("failed to expand volume: %q. Volume is attached to node and its StorageClass only allows "+
+		"offline expansion. Expansion will proceed once the volume is detached", volumeID)
+	log.Error(msg)
+	commonco.ContainerOrchestratorUtility.RecordPVCEvent(ctx, volumeID, types.NamespacedName{}, v1.EventTypeWarning,
+		common.EventReasonOfflineExpansionRequired, msg)
+	return status.Errorf(codes.FailedPrecondition, msg)
+}
+
+// checkExpansionBlockedBySnapshots fails the expansion of a volume attached to
+// a node VM with snapshots, or whose disk is in a snapshot chain, with
+// FailedPrecondition and records an event explaining why on its PVC. The
+// external-resizer retries the expansion with backoff, so it proceeds once the
+// snapshots are deleted. It returns nil if no snapshot blocks the expansion.
+func checkExpansionBlockedBySnapshots(ctx context.Context, volumeID string) error {
+	log := logger.GetLogger(ctx)
+	nodes, err := node.GetManager(ctx).GetAllNodes(ctx)
+	if err != nil {
+		log.Warnf("failed to get VirtualMachines of the nodes to check for snapshots of volume %q. Error: %v",
+			volumeID, err)
+		return nil
+	}
+	for _, vm := range nodes {
+		var vmMo mo.VirtualMachine
+		pc := property.DefaultCollector(vm.Client())
+		err := pc.RetrieveOne(ctx, vm.Reference(), []string{"snapshot", "config.hardware.device"}, &vmMo)
+		if err != nil {
+			log.Warnf("failed to get snapshots of VM %v to check for snapshots of volume %q. Error: %v",
+				vm, volumeID, err)
+			continue
+		}
+		attached, inSnapshot := isDiskInSnapshot(vmMo, volumeID)
+		if !attached {
+			continue
+		}
+		if !inSnapshot {
+			return nil
+		}
+		msg := fmt.Sprintf("failed to expand volume: %q. Node VM %v the volume is attached to has snapshots, or the "+
+			"disk is in a snapshot chain. Expansion will proceed once the snapshots are deleted", volumeID, vm)
+		log.Error(msg)
+		commonco.ContainerOrchestratorUtility.RecordPVCEvent(ctx, volumeID, types.NamespacedName{}, v1.EventTypeWarning,
+			common.EventReasonExpansionBlockedBySnapshots, msg)
+		return status.Error(codes.FailedPrecondition, msg)
+	}
+	return nil
+}
+
+// isDiskInSnapshot returns if the disk of the volume is attached to the VM,
+// and if so whether the VM has snapshots or the disk is a delta disk of a
+// snapshot chain.
+func isDiskInSnapshot(vmMo mo.VirtualMachine, volumeID string) (attached bool, inSnapshot bool) {
+	if vmMo.Config == nil {
+		return false, false
+	}
+	for _, device := range vmMo.Config.Hardware.Device {
+		disk, ok := device.(*vimtypes.VirtualDisk)
+		if !ok || disk.VDiskId == nil || disk.VDiskId.Id != volumeID {
+			continue
+		}
+		if vmMo.Snapshot != nil {
+			return true, true
+		}
+		switch backing := disk.Backing.(type) {
+		case *vimtypes.VirtualDiskFlatVer2BackingInfo:
+			return true, backing.Parent != nil
+		case *vimtypes.VirtualDiskSeSparseBackingInfo:
+			return true, backing.Parent != nil
+		case *vimtypes.VirtualDiskSparseVer2BackingInfo:
+			return true, backing.Parent != nil
+		}
+		return true, false
+	}
+	return false, false
+}
+
+// checkVolumeNotInUse fails the detach of a volume from a Ready node with
+// FailedPrecondition while pods on the node not terminated still use it,
+// covering races where the detach is requested before they are gone. Volumes
+// are detached from NotReady nodes anyway, as their kubelet can't report the
+// pods gone, and an event is recorded on the PVC of the volume. The check
+// fails closed: if the pods or the node can't be looked up, the detach fails
+// with Internal and is retried by the external-attacher.
+func checkVolumeNotInUse(ctx context.Context, volumeID string, nodeName string) error {
+	log := logger.GetLogger(ctx)
+	pods, err := commonco.ContainerOrchestratorUtility.GetPodsUsingVolumeOnNode(ctx, volumeID, nodeName)
+	if err != nil {
+		msg := fmt.Sprintf("failed to check if pods on node %q use volume %q before detaching it. Error: %v",
+			nodeName, volumeID, err)
+		log.Error(msg)
+		return status.Error(codes.Internal, msg)
+	}
+	if len(pods) == 0 {
+		return nil
+	}
+	ready, err := commonco.ContainerOrchestratorUtility.IsNodeReady(ctx, nodeName)
+	if err != nil {
+		msg := fmt.Sprintf("failed to check if node %q is Ready before detaching volume %q used by pods %v. Error: %v",
+			nodeName, volumeID, pods, err)
+		log.Error(msg)
+		return status.Error(codes.Internal, msg)
+	}
+	if ready {
+		msg := fmt.Sprintf("volume %q is still used by pods %v on node %q, not detaching it", volumeID, pods, nodeName)
+		log.Error(msg)
+		return status.Error(codes.FailedPrecondition, msg)
+	}
+	msg := fmt.Sprintf("Detaching volume %q from NotReady node %q although it is still used by pods %v",
+		volumeID, nodeName, pods)
+	log.Warn(msg)
+	commonco.ContainerOrchestratorUtility.RecordPVCEvent(ctx, volumeID, types.NamespacedName{}, v1.EventTypeWarning,
+		common.EventReasonForcedDetach, msg)
+	return nil
+}
+
+// checkDatastoreAccessibleToNode fails the attach of a volume on a datastore
+// that the host of the node VM can't access with FailedPrecondition, instead
+// of letting the attach task fail in vCenter. The datastores shared by the
+// node VMs are computed from their connected hosts only, so volumes can be
+// provisioned on datastores some hosts lost access to.
+func checkDatastoreAccessibleToNode(ctx context.Context, node *cnsvsphere.VirtualMachine, datastoreURL string) error {
+	log := logger.GetLogger(ctx)
+	datastores, err := node.GetAllAccessibleDatastores(ctx)
+	if err != nil {
+		msg := fmt.Sprintf("failed to get the datastores accessible to node VM %v. err: %v", node, err)
+		log.Error(msg)
+		return status.Error(codes.Internal, msg)
+	}
+	for _, ds := range datastores {
+		if ds.Info.Url == datastoreURL {
+			return nil
+		}
+	}
+	msg := fmt.Sprintf("datastore %q is not accessible to the host of node VM %v", datastoreURL, node)
+	log.Error(msg)
+	return status.Error(codes.FailedPrecondition, msg)
+}
+
+// vcSessionKeepAliveDisabledPollInterval is the interval at which the config
+// is checked for a session keep-alive interval while it is disabled.
+var vcSessionKeepAliveDisabledPollInterval = time.Minute
+
+// isConfigChangeEvent returns true if the fsnotify event on the directory of
+// the config file at cfgPath may have changed the config. Kubernetes updates a
+// mounted secret by swapping a symlink and removing the former data directory,
+// while a config file on a host path is written or created again in place.
+func isConfigChangeEvent(event fsnotify.Event, cfgPath string) bool {
+	if event.Op&fsnotify.Remove == fsnotify.Remove {
+		return true
+	}
+	return filepath.Clean(event.Name) == filepath.Clean(cfgPath) &&
+		event.Op&(fsnotify.Write|fsnotify.Create) != 0
+}
+
+// listVolumesQueryLimit is the largest number of volumes ListVolumes queries
+// from CNS at once.
+const listVolumesQueryLimit = int64(500)
+
+// parseListVolumesToken returns the index of the vCenter, in the order of
+// getAllManagers, and the CNS cursor offset of a ListVolumes token. The token
+// of a volume of the first vCenter is its offset, the token of a volume of
+// another vCenter is prefixed with the index of the vCenter and a colon.
+func parseListVolumesToken(token string, vCenterCount int) (int, int64, error) {
+	index := 0
+	offsetToken := token
+	if i := strings.Index(token, ":"); i >= 0 {
+		var err error
+		if index, err = strconv.Atoi(token[:i]); err != nil {
+			return 0, 0, err
+		}
+		if index <= 0 || index >= vCenterCount {
+			return 0, 0, fmt.Errorf("no vCenter with index %d", index)
+		}
+		offsetToken = token[i+1:]
+	}
+	offset, err := strconv.ParseInt(offsetToken, 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	if offset < 0 {
+		return 0, 0, fmt.Errorf("negative offset %d", offset)
+	}
+	return index, offset, nil
+}
+
+// formatListVolumesToken returns the ListVolumes token of the CNS cursor
+// offset in the vCenter with the given index, see parseListVolumesToken.
+func formatListVolumesToken(index int, offset int64) string {
+	if index == 0 {
+		return strconv.FormatInt(offset, 10)
+	}
+	return fmt.Sprintf("%d:%d", index, offset)
+}
+
+// queryBlockVolumes returns up to maxEntries block volumes of the cluster,
+// or all of them if maxEntries is 0, querying CNS in pages from the CNS
+// offset. It also returns the CNS offset following the last volume returned,
+// or 0 if no volume is left. The offset counts the file volumes CNS returns
+// too, which aren't listed. An offset past the volumes of the cluster fails
+// with codes.Aborted, the code of an invalid ListVolumes starting token.
+func queryBlockVolumes(ctx context.Context, manager cnsvolume.Manager, clusterID string, offset int64,
+	maxEntries int64) ([]cnstypes.CnsVolume, int64, error) {
+	log := logger.GetLogger(ctx)
+	querySelection := utils.QuerySelection(cnstypes.QuerySelectionNameTypeVolumeType,
+		cnstypes.QuerySelectionNameTypeBackingObjectDetails)
+	var volumes []cnstypes.CnsVolume
+	for first := true; ; first = false {
+		limit := listVolumesQueryLimit
+		if maxEntries > 0 && maxEntries-int64(len(volumes)) < limit {
+			limit = maxEntries - int64(len(volumes))
+		}
+		queryFilter := cnstypes.CnsQueryFilter{
+			ContainerClusterIds: []string{clusterID},
+			Cursor:              &cnstypes.CnsCursor{Offset: offset, Limit: limit},
+		}
+		log.Debugf("Query volumes with offset: %d and limit: %d", offset, limit)
+		queryResult, err := utils.QueryVolumeUtil(ctx, manager, queryFilter, querySelection)
+		if err != nil {
+			// Error is already wrapped in CSI error code.
+			return nil, 0, err
+		}
+		cursor := queryResult.Cursor
+		if first && len(queryResult.Volumes) == 0 && offset > cursor.TotalRecords {
+			return nil, 0, status.Errorf(codes.Aborted, "starting token %d is greater than the number of volumes %d",
+				offset, cursor.TotalRecords)
+		}
+		for _, volume := range queryResult.Volumes {
+			// File volumes aren't attached to node VMs, only block volumes
+			// are listed.
+			if volume.VolumeType == common.BlockVolumeType {
+				volumes = append(volumes, volume)
+			}
+		}
+		log.Debugf("%d more volumes to be queried", cursor.TotalRecords-cursor.Offset)
+		// CNS may return fewer volumes than the limit, the cursor it returns
+		// tells where the next page starts.
+		if cursor.Offset == cursor.TotalRecords || len(queryResult.Volumes) == 0 {
+			return volumes, 0, nil
+		}
+		offset = cursor.Offset
+		if maxEntries > 0 && int64(len(volumes)) >= maxEntries {
+			return volumes, offset, nil
+		}
+	}
+}
+
+// getPublishedNodeIDs returns the names of the nodes whose VMs the volumes
+// are attached to, keyed by volume ID. The devices of the node VMs of each
+// vCenter are retrieved in a single call.
+func getPublishedNodeIDs(ctx context.Context, nodeMgr NodeManagerInterface) (map[string][]string, error) {
+	nodeVMs, err := nodeMgr.GetAllNodesByName(ctx)
+	if err != nil {
+		return nil, err
+	}
+	nodeNamesByVM := make(map[vimtypes.ManagedObjectReference]string)
+	vmRefsByClient := make(map[*vim25.Client][]vimtypes.ManagedObjectReference)
+	for nodeName, vm := range nodeVMs {
+		nodeNamesByVM[vm.Reference()] = nodeName
+		vmRefsByClient[vm.Client()] = append(vmRefsByClient[vm.Client()], vm.Reference())
+	}
+	publishedNodeIDs := make(map[string][]string)
+	for client, vmRefs := range vmRefsByClient {
+		var vmMos []mo.VirtualMachine
+		err := property.DefaultCollector(client).Retrieve(ctx, vmRefs, []string{"config.hardware.device"}, &vmMos)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get devices of node VMs %v. Error: %v", vmRefs, err)
+		}
+		for _, vmMo := range vmMos {
+			if vmMo.Config == nil {
+				continue
+			}
+			nodeName := nodeNamesByVM[vmMo.Reference()]
+			for _, device := range vmMo.Config.Hardware.Device {
+				disk, ok := device.(*vimtypes.VirtualDisk)
+				if !ok || disk.VDiskId == nil || disk.VDiskId.Id == "" {
+					continue
+				}
+				publishedNodeIDs[disk.VDiskId.Id] = append(publishedNodeIDs[disk.VDiskId.Id], nodeName)
+			}
+		}
+	}
+	for _, nodeIDs := range publishedNodeIDs {
+		sort.Strings(nodeIDs)
+	}
+	return publishedNodeIDs, nil
+}
+
+// getVolumeName returns the name of the CNS volume to create for the
+// CreateVolumeRequest, rendered from the volume name template of the
+// StorageClass if it has one. The name is only rendered from the request, so
+// that its retries look up the volume an earlier attempt created by the same
+// name.
+func getVolumeName(ctx context.Context, reqName string, scParams *common.StorageClassParams) (string, error) {
+	log := logger.GetLogger(ctx)
+	if scParams.VolumeNameTemplate == "" {
+		return reqName, nil
+	}
+	metadata := common.VolumeNameMetadata{
+		PVCName:      scParams.PVCName,
+		PVCNamespace: scParams.PVCNamespace,
+		PVName:       scParams.PVName,
+	}
+	volumeName, err := common.RenderVolumeName(scParams.VolumeNameTemplate, reqName, metadata)
+	if err != nil {
+		msg := fmt.Sprintf("failed to render volume name. Error: %+v", err)
+		log.Error(msg)
+		return "", status.Error(codes.InvalidArgument, msg)
+	}
+	log.Infof("Rendered volume name %q for %q from template %q", volumeName, reqName, scParams.VolumeNameTemplate)
+	return volumeName, nil
+}
+
+// getAdoptedDisk returns the FCD ID or vmdk path of the pre-created disk the
+// PVC of the CreateVolumeRequest references with the AnnAdoptDisk annotation
+// to adopt as its volume, or an empty string if the PVC has none. Only
+// StorageClasses with the AttributeAllowDiskAdoption param allow it.
+func getAdoptedDisk(ctx context.Context, scParams *common.StorageClassParams) (string, error) {
+	log := logger.GetLogger(ctx)
+	if !commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.PVCDiskAdoption) || scParams.PVCName == "" {
+		return "", nil
+	}
+	annotations, err := commonco.ContainerOrchestratorUtility.GetPVCAnnotations(ctx, scParams.PVCNamespace,
+		scParams.PVCName)
+	if err != nil {
+		msg := fmt.Sprintf("failed to get annotations of PVC %s/%s. Error: %+v",
+			scParams.PVCNamespace, scParams.PVCName, err)
+		log.Error(msg)
+		return "", status.Error(codes.Internal, msg)
+	}
+	disk := strings.TrimSpace(annotations[common.AnnAdoptDisk])
+	if disk != "" && !scParams.AllowDiskAdoption {
+		// Adopting a disk hands its data to the PVC, so only StorageClasses
+		// an administrator created for it allow it.
+		msg := fmt.Sprintf("PVC %s/%s references disk %q to adopt, but its StorageClass doesn't set %q",
+			scParams.PVCNamespace, scParams.PVCName, disk, common.AttributeAllowDiskAdoption)
+		log.Error(msg)
+		return "", status.Error(codes.InvalidArgument, msg)
+	}
+	if disk != "" {
+		log.Infof("PVC %s/%s references disk %q to adopt", scParams.PVCNamespace, scParams.PVCName, disk)
+	}
+	return disk, nil
+}
+
+// getVolumeContentSource returns the ID of the snapshot the volume of the
+// CreateVolumeRequest is restored from, or the ID of the volume it is cloned
+// from, or empty strings if it has no content source.
+func getVolumeContentSource(ctx context.Context, req *csi.CreateVolumeRequest) (string, string, error) {
+	log := logger.GetLogger(ctx)
+	source := req.GetVolumeContentSource()
+	if source == nil {
+		return "", "", nil
+	}
+	if source.GetVolume() != nil {
+		if !commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.VolumeClone) {
+			msg := fmt.Sprintf("%s feature state switch is disabled, volumes can't be cloned", common.VolumeClone)
+			log.Error(msg)
+			return "", "", status.Error(codes.InvalidArgument, msg)
+		}
+		volumeID := source.GetVolume().GetVolumeId()
+		if volumeID == "" {
+			msg := "volume id of the volume content source is a required parameter"
+			log.Error(msg)
+			return "", "", status.Error(codes.InvalidArgument, msg)
+		}
+		return "", volumeID, nil
+	}
+	if source.GetSnapshot() == nil {
+		msg := "only snapshots and volumes are supported as volume content source"
+		log.Error(msg)
+		return "", "", status.Error(codes.InvalidArgument, msg)
+	}
+	if !commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.BlockVolumeSnapshot) {
+		msg := fmt.Sprintf("%s feature state switch is disabled, volumes can't be restored from snapshots",
+			common.BlockVolumeSnapshot)
+		log.Error(msg)
+		return "", "", status.Error(codes.InvalidArgument, msg)
+	}
+	snapshotID := source.GetSnapshot().GetSnapshotId()
+	if snapshotID == "" {
+		msg := "snapshot id of the volume content source is a required parameter"
+		log.Error(msg)
+		return "", "", status.Error(codes.InvalidArgument, msg)
+	}
+	return snapshotID, "", nil
+}
+
+// filterDatastoresByTags returns the datastores carrying all the tags of the
+// StorageClass, failing with NotFound if none of them does.
+func filterDatastoresByTags(ctx context.Context, manager *common.Manager, datastores []*cnsvsphere.DatastoreInfo,
+	datastoreTags []common.DatastoreTag) ([]*cnsvsphere.DatastoreInfo, error) {
+	log := logger.GetLogger(ctx)
+	vcenter, err := manager.VcenterManager.GetVirtualCenter(ctx, manager.VcenterConfig.Host)
+	if err != nil {
+		msg := fmt.Sprintf("failed to get vCenter. err: %v", err)
+		log.Error(msg)
+		return nil, status.Error(codes.Internal, msg)
+	}
+	// The REST session of the tagManager is kept across CreateVolume calls.
+	tagManager, err := cnsvsphere.GetCachedTagManager(ctx, vcenter)
+	if err != nil {
+		msg := fmt.Sprintf("failed to get tagManager. err: %v", err)
+		log.Error(msg)
+		return nil, status.Error(codes.Internal, msg)
+	}
+	taggedDatastores, err := common.FilterDatastoresByTags(ctx, tagManager, datastores, datastoreTags)
+	if err != nil {
+		msg := fmt.Sprintf("failed to filter datastores by tags %v. err: %v", datastoreTags, err)
+		log.Error(msg)
+		return nil, status.Error(codes.Internal, msg)
+	}
+	if len(taggedDatastores) == 0 {
+		msg := fmt.Sprintf("none of the datastores %v has tags %v", datastores, datastoreTags)
+		log.Error(msg)
+		return nil, status.Error(codes.NotFound, msg)
+	}
+	log.Debugf("Datastores %v have tags %v", taggedDatastores, datastoreTags)
+	return taggedDatastores, nil
+}
+
+// querySnapshotVolumes returns the volumes with the given IDs, or all the
+// volumes of the cluster if none are given, with their type.
+func querySnapshotVolumes(ctx context.Context, manager *common.Manager, volumeIDs []string) (
+	[]cnstypes.CnsVolume, error) {
+	var queryFilter cnstypes.CnsQueryFilter
+	if len(volumeIDs) == 0 {
+		queryFilter.ContainerClusterIds = []string{manager.CnsConfig.Global.ClusterID}
+	}
+	for _, volumeID := range volumeIDs {
+		queryFilter.VolumeIds = append(queryFilter.VolumeIds, cnstypes.CnsVolumeId{Id: volumeID})
+	}
+	querySelection := utils.QuerySelection(cnstypes.QuerySelectionNameTypeVolumeType)
+	queryResult, err := utils.QueryVolumeUtil(ctx, manager.VolumeManager, queryFilter, querySelection)
+	if err != nil {
+		return nil, err
+	}
+	return queryResult.Volumes, nil
+}
+
+// newCSISnapshot returns the CSI snapshot of the FCD snapshot of the volume,
+// whose size is the capacity of the volume when the snapshot was taken, 0 if
+// it isn't known.
+func newCSISnapshot(volume cnstypes.CnsVolume, snapshot cnsvolume.CnsSnapshotInfo) (*csi.Snapshot, error) {
+	creationTime, err := ptypes.TimestampProto(snapshot.CreationTime)
+	if err != nil {
+		return nil, fmt.Errorf("invalid creation time of snapshot %q of volume %q. err: %v",
+			snapshot.SnapshotID, volume.VolumeId.Id, err)
+	}
+	return &csi.Snapshot{
+		SnapshotId:     common.NewSnapshotID(volume.VolumeId.Id, snapshot.SnapshotID),
+		SourceVolumeId: volume.VolumeId.Id,
+		SizeBytes:      snapshot.CapacityInMb * common.MbInBytes,
+		CreationTime:   creationTime,
+		ReadyToUse:     true,
+	}, nil
+}
@@ -19,6 +19,7 @@ package vanilla
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -27,6 +28,7 @@ import (
 	"testing"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/fsnotify/fsnotify"
 	"github.com/google/uuid"
 	cnssim "github.com/vmware/govmomi/cns/simulator"
 	cnstypes "github.com/vmware/govmomi/cns/types"
@@ -40,9 +42,12 @@ import (
 	"github.com/vmware/govmomi/vim25"
 	"github.com/vmware/govmomi/vim25/mo"
 	"github.com/vmware/govmomi/vim25/types"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	clientset "k8s.io/client-go/kubernetes"
 	testclient "k8s.io/client-go/kubernetes/fake"
 
+	cnsnode "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/node"
 	cnsvolume "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/volume"
 	cnsvsphere "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/vsphere"
 	"sigs.k8s.io/vsphere-csi-driver/pkg/common/config"
@@ -226,7 +231,18 @@ func (f *FakeNodeManager) GetAllNodes(ctx context.Context) ([]*cnsvsphere.Virtua
 	return nil, nil
 }
 
-func (f *FakeNodeManager) GetSharedDatastoresInTopology(ctx context.Context, topologyRequirement *csi.TopologyRequirement, tagManager *tags.Manager, zoneKey string, regionKey string) ([]*cnsvsphere.DatastoreInfo, map[string][]map[string]string, error) {
+func (f *FakeNodeManager) GetAllNodesByName(ctx context.Context) (map[string]*cnsvsphere.VirtualMachine, error) {
+	if v := os.Getenv("VSPHERE_DATACENTER"); v != "" {
+		return nil, nil
+	}
+	// GetNodeByName returns this VM for any node, it is named after it.
+	obj := simulator.Map.Any("VirtualMachine").(*simulator.VirtualMachine)
+	return map[string]*cnsvsphere.VirtualMachine{
+		obj.Name: {VirtualMachine: object.NewVirtualMachine(f.client, obj.Reference())},
+	}, nil
+}
+
+func (f *FakeNodeManager) GetSharedDatastoresInTopology(ctx context.Context, topologyRequirement *csi.TopologyRequirement, tagManagers map[string]*tags.Manager, zoneKey string, regionKey string) ([]*cnsvsphere.DatastoreInfo, map[string][]map[string]string, error) {
 	return nil, nil, nil
 }
 
@@ -312,6 +328,7 @@ func getControllerTest(t *testing.T) *controllerTest {
 			authMgr: &FakeAuthManager{
 				vcenter: vcenter,
 			},
+			nodeQueue: newNodeOperationQueue(),
 		}
 		commonco.ContainerOrchestratorUtility, err = unittestcommon.GetFakeContainerOrchestratorInterface(common.Kubernetes)
 		if err != nil {
@@ -761,3 +778,1034 @@ func TestCompleteControllerFlow(t *testing.T) {
 		t.Fatalf("Volume should not exist after deletion with ID: %s", volID)
 	}
 }
+
+// fixedNodeManager resolves every node to the same VM, so that volumes are
+// attached to and detached from the same VM whichever node is given.
+type fixedNodeManager struct {
+	NodeManagerInterface
+	vm *cnsvsphere.VirtualMachine
+}
+
+func (f *fixedNodeManager) GetNodeByName(ctx context.Context, nodeName string) (*cnsvsphere.VirtualMachine, error) {
+	return f.vm, nil
+}
+
+// errNodeManager fails to resolve every node with err.
+type errNodeManager struct {
+	NodeManagerInterface
+	err error
+}
+
+func (e *errNodeManager) GetNodeByName(ctx context.Context, nodeName string) (*cnsvsphere.VirtualMachine, error) {
+	return nil, e.err
+}
+
+// getControllerWithFakeVolumeManager returns a copy of the controller under
+// test which uses an in-memory volume manager instead of CNS.
+func getControllerWithFakeVolumeManager(t *testing.T) (*controller, *unittestcommon.FakeVolumeManager) {
+	ct := getControllerTest(t)
+	volumeManager := unittestcommon.NewFakeVolumeManager()
+	manager := *ct.controller.manager
+	manager.VolumeManager = volumeManager
+	c := *ct.controller
+	c.manager = &manager
+	// FakeNodeManager returns any VM of the simulator for a node.
+	vm, err := c.nodeMgr.GetNodeByName(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.nodeMgr = &fixedNodeManager{NodeManagerInterface: c.nodeMgr, vm: vm}
+	// Volumes are created on a datastore accessible to the node VM.
+	datastores, err := vm.GetAllAccessibleDatastores(ctx)
+	if err != nil || len(datastores) == 0 {
+		t.Fatalf("failed to get the datastores accessible to VM %v: %v", vm, err)
+	}
+	volumeManager.DatastoreURL = datastores[0].Info.Url
+	return &c, volumeManager
+}
+
+func TestControllerVolumeManagerFailures(t *testing.T) {
+	c, volumeManager := getControllerWithFakeVolumeManager(t)
+	capability := &csi.VolumeCapability{
+		AccessMode: &csi.VolumeCapability_AccessMode{
+			Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+		},
+	}
+	params := make(map[string]string)
+	if v := os.Getenv("VSPHERE_DATASTORE_URL"); v != "" {
+		params[common.AttributeDatastoreURL] = v
+	}
+	createVolume := func() (*csi.CreateVolumeResponse, error) {
+		return c.CreateVolume(ctx, &csi.CreateVolumeRequest{
+			Name:               testVolumeName + "-" + uuid.New().String(),
+			CapacityRange:      &csi.CapacityRange{RequiredBytes: 1 * common.GbInBytes},
+			Parameters:         params,
+			VolumeCapabilities: []*csi.VolumeCapability{capability},
+		})
+	}
+	nodeID := simulator.Map.Any("VirtualMachine").(*simulator.VirtualMachine).Name
+	cnsErr := errors.New("injected CNS failure")
+
+	volumeManager.InjectError(unittestcommon.FakeOpCreateVolume, cnsErr)
+	if _, err := createVolume(); status.Code(err) != codes.Internal {
+		t.Fatalf("expected CreateVolume to fail with code Internal, got %v", err)
+	}
+	volumeManager.InjectError(unittestcommon.FakeOpCreateVolume, nil)
+
+	respCreate, err := createVolume()
+	if err != nil {
+		t.Fatal(err)
+	}
+	volID := respCreate.Volume.VolumeId
+
+	reqPublish := &csi.ControllerPublishVolumeRequest{
+		VolumeId:         volID,
+		NodeId:           nodeID,
+		VolumeCapability: capability,
+	}
+	volumeManager.InjectError(unittestcommon.FakeOpAttachVolume, cnsErr)
+	if _, err := c.ControllerPublishVolume(ctx, reqPublish); status.Code(err) != codes.Internal {
+		t.Fatalf("expected ControllerPublishVolume to fail with code Internal, got %v", err)
+	}
+	if vm := volumeManager.GetAttachedVM(volID); vm != "" {
+		t.Fatalf("volume %s is attached to %s after a failed attach", volID, vm)
+	}
+	volumeManager.InjectError(unittestcommon.FakeOpAttachVolume, nil)
+	if _, err := c.ControllerPublishVolume(ctx, reqPublish); err != nil {
+		t.Fatal(err)
+	}
+
+	// Volumes on datastores the node VM can't access are not attached.
+	datastoreURL := volumeManager.DatastoreURL
+	volumeManager.DatastoreURL = "ds:///vmfs/volumes/inaccessible/"
+	respInaccessible, err := createVolume()
+	volumeManager.DatastoreURL = datastoreURL
+	if err != nil {
+		t.Fatal(err)
+	}
+	reqInaccessible := &csi.ControllerPublishVolumeRequest{
+		VolumeId:         respInaccessible.Volume.VolumeId,
+		NodeId:           nodeID,
+		VolumeCapability: capability,
+	}
+	if _, err := c.ControllerPublishVolume(ctx, reqInaccessible); status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expected ControllerPublishVolume to fail with code FailedPrecondition, got %v", err)
+	}
+	if vm := volumeManager.GetAttachedVM(respInaccessible.Volume.VolumeId); vm != "" {
+		t.Fatalf("volume on an inaccessible datastore is attached to %s", vm)
+	}
+
+	reqDelete := &csi.DeleteVolumeRequest{VolumeId: volID}
+	if _, err := c.DeleteVolume(ctx, reqDelete); status.Code(err) != codes.Internal {
+		t.Fatalf("expected DeleteVolume of an attached volume to fail with code Internal, got %v", err)
+	}
+
+	reqUnpublish := &csi.ControllerUnpublishVolumeRequest{VolumeId: volID, NodeId: nodeID}
+	volumeManager.InjectError(unittestcommon.FakeOpQueryVolume, cnsErr)
+	if _, err := c.ControllerUnpublishVolume(ctx, reqUnpublish); status.Code(err) != codes.Internal {
+		t.Fatalf("expected ControllerUnpublishVolume to fail with code Internal, got %v", err)
+	}
+	volumeManager.InjectError(unittestcommon.FakeOpQueryVolume, nil)
+	volumeManager.InjectError(unittestcommon.FakeOpDetachVolume, cnsErr)
+	if _, err := c.ControllerUnpublishVolume(ctx, reqUnpublish); status.Code(err) != codes.Internal {
+		t.Fatalf("expected ControllerUnpublishVolume to fail with code Internal, got %v", err)
+	}
+	volumeManager.InjectError(unittestcommon.FakeOpDetachVolume, nil)
+
+	// Detaching fails when no datacenter is found to look for the node VM in,
+	// and succeeds without a detach when the node is not registered.
+	nodeMgr := c.nodeMgr
+	c.nodeMgr = &errNodeManager{NodeManagerInterface: nodeMgr, err: cnsvsphere.ErrDatacenterNotFound}
+	if _, err := c.ControllerUnpublishVolume(ctx, reqUnpublish); status.Code(err) != codes.Internal {
+		t.Fatalf("expected ControllerUnpublishVolume to fail with code Internal, got %v", err)
+	}
+	c.nodeMgr = &errNodeManager{NodeManagerInterface: nodeMgr, err: cnsnode.ErrNodeNotFound}
+	if _, err := c.ControllerUnpublishVolume(ctx, reqUnpublish); err != nil {
+		t.Fatalf("expected ControllerUnpublishVolume of an unregistered node to succeed, got %v", err)
+	}
+	c.nodeMgr = nodeMgr
+
+	if _, err := c.ControllerUnpublishVolume(ctx, reqUnpublish); err != nil {
+		t.Fatal(err)
+	}
+
+	volumeManager.InjectError(unittestcommon.FakeOpDeleteVolume, cnsErr)
+	if _, err := c.DeleteVolume(ctx, reqDelete); status.Code(err) != codes.Internal {
+		t.Fatalf("expected DeleteVolume to fail with code Internal, got %v", err)
+	}
+	volumeManager.InjectError(unittestcommon.FakeOpDeleteVolume, nil)
+	if _, err := c.DeleteVolume(ctx, reqDelete); err != nil {
+		t.Fatal(err)
+	}
+	if volumeManager.GetVolume(volID) != nil {
+		t.Fatalf("volume %s still exists after deletion", volID)
+	}
+}
+
+func TestCreateVolumeNameCollision(t *testing.T) {
+	c, volumeManager := getControllerWithFakeVolumeManager(t)
+	params := make(map[string]string)
+	if v := os.Getenv("VSPHERE_DATASTORE_URL"); v != "" {
+		params[common.AttributeDatastoreURL] = v
+	}
+	reqCreate := &csi.CreateVolumeRequest{
+		Name:          testVolumeName + "-" + uuid.New().String(),
+		CapacityRange: &csi.CapacityRange{RequiredBytes: 1 * common.GbInBytes},
+		Parameters:    params,
+		VolumeCapabilities: []*csi.VolumeCapability{
+			{
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+		},
+	}
+	respCreate, err := c.CreateVolume(ctx, reqCreate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	volID := respCreate.Volume.VolumeId
+
+	// A retry of the request adopts the volume it created.
+	respRetry, err := c.CreateVolume(ctx, reqCreate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if respRetry.Volume.VolumeId != volID {
+		t.Fatalf("expected retry of CreateVolume to return volume %s, got %s", volID, respRetry.Volume.VolumeId)
+	}
+
+	// The same name with a different backing is a collision.
+	reqCreate.CapacityRange.RequiredBytes = 2 * common.GbInBytes
+	if _, err := c.CreateVolume(ctx, reqCreate); status.Code(err) != codes.AlreadyExists {
+		t.Fatalf("expected CreateVolume of a volume with a different capacity to fail with code AlreadyExists, got %v", err)
+	}
+	reqCreate.CapacityRange.RequiredBytes = 1 * common.GbInBytes
+
+	// So is the same name used by the PVC of another cluster.
+	err = volumeManager.UpdateVolumeMetadata(ctx, &cnstypes.CnsVolumeMetadataUpdateSpec{
+		VolumeId: cnstypes.CnsVolumeId{Id: volID},
+		Metadata: cnstypes.CnsVolumeMetadata{
+			EntityMetadata: []cnstypes.BaseCnsEntityMetadata{
+				cnsvsphere.GetCnsKubernetesEntityMetaData("pvc1", nil, false,
+					string(cnstypes.CnsKubernetesEntityTypePVC), "ns1", c.manager.CnsConfig.Global.ClusterID, nil),
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reqCreate.Parameters = map[string]string{
+		common.AttributePVCName:      "pvc1",
+		common.AttributePVCNamespace: "ns2",
+	}
+	for param, value := range params {
+		reqCreate.Parameters[param] = value
+	}
+	if _, err := c.CreateVolume(ctx, reqCreate); status.Code(err) != codes.AlreadyExists {
+		t.Fatalf("expected CreateVolume of a volume bound to another PVC to fail with code AlreadyExists, got %v", err)
+	}
+}
+
+func TestCreateVolumeAdoptDisk(t *testing.T) {
+	c, volumeManager := getControllerWithFakeVolumeManager(t)
+	sharedDatastores, err := c.nodeMgr.GetSharedDatastoresInK8SCluster(ctx)
+	if err != nil || len(sharedDatastores) == 0 {
+		t.Fatalf("failed to get shared datastores. err: %v", err)
+	}
+	volumeManager.DatastoreURL = sharedDatastores[0].Info.Url
+	disk, err := volumeManager.CreateVolume(ctx, &cnstypes.CnsVolumeCreateSpec{
+		Name:       "pre-created-" + uuid.New().String(),
+		VolumeType: common.BlockVolumeType,
+		BackingObjectDetails: &cnstypes.CnsBlockBackingDetails{
+			CnsBackingObjectDetails: cnstypes.CnsBackingObjectDetails{CapacityInMb: 2048},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherClusterDisk, err := volumeManager.CreateVolume(ctx, &cnstypes.CnsVolumeCreateSpec{
+		Name:       "pre-created-" + uuid.New().String(),
+		VolumeType: common.BlockVolumeType,
+		Metadata: cnstypes.CnsVolumeMetadata{
+			ContainerCluster: cnstypes.CnsContainerCluster{ClusterId: "other-cluster"},
+		},
+		BackingObjectDetails: &cnstypes.CnsBlockBackingDetails{
+			CnsBackingObjectDetails: cnstypes.CnsBackingObjectDetails{CapacityInMb: 2048},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	co := commonco.ContainerOrchestratorUtility.(*unittestcommon.FakeK8SOrchestrator)
+	co.SetPVCAnnotations("ns1", "pvc1", map[string]string{common.AnnAdoptDisk: disk.VolumeID.Id})
+	co.SetPVCAnnotations("ns1", "pvc2", map[string]string{common.AnnAdoptDisk: disk.VolumeID.Id})
+	co.SetPVCAnnotations("ns1", "pvc3", map[string]string{common.AnnAdoptDisk: otherClusterDisk.VolumeID.Id})
+	co.SetPVCAnnotations("ns1", "pvc4", map[string]string{common.AnnAdoptDisk: "[vsanDatastore] volumes/empty.vmdk"})
+	allowDiskAdoption := "false"
+	createVolume := func(pvcName string, requiredBytes int64, mode csi.VolumeCapability_AccessMode_Mode) (
+		*csi.CreateVolumeResponse, error) {
+		return c.CreateVolume(ctx, &csi.CreateVolumeRequest{
+			Name:          testVolumeName + "-" + uuid.New().String(),
+			CapacityRange: &csi.CapacityRange{RequiredBytes: requiredBytes},
+			Parameters: map[string]string{
+				common.AttributePVCName:           pvcName,
+				common.AttributePVCNamespace:      "ns1",
+				common.AttributeAllowDiskAdoption: allowDiskAdoption,
+			},
+			VolumeCapabilities: []*csi.VolumeCapability{{
+				AccessMode: &csi.VolumeCapability_AccessMode{Mode: mode},
+			}},
+		})
+	}
+
+	// Only StorageClasses allowing it let PVCs adopt disks.
+	if _, err := createVolume("pvc1", 1*common.GbInBytes,
+		csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected adopting a disk without %q to fail with code InvalidArgument, got %v",
+			common.AttributeAllowDiskAdoption, err)
+	}
+	allowDiskAdoption = "true"
+
+	// The disk is adopted with its own capacity, also on a retry.
+	for i := 0; i < 2; i++ {
+		resp, err := createVolume("pvc1", 1*common.GbInBytes, csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Volume.VolumeId != disk.VolumeID.Id || resp.Volume.CapacityBytes != 2*common.GbInBytes {
+			t.Fatalf("expected volume %s of 2 GB, got %s of %d bytes", disk.VolumeID.Id, resp.Volume.VolumeId,
+				resp.Volume.CapacityBytes)
+		}
+	}
+
+	// Smaller disks, file volumes, disks of other container clusters and disks
+	// in use by Kubernetes can't be adopted.
+	if _, err := createVolume("pvc1", 4*common.GbInBytes,
+		csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected adopting a disk smaller than requested to fail with code InvalidArgument, got %v", err)
+	}
+	if _, err := createVolume("pvc1", 1*common.GbInBytes,
+		csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected adopting a disk as a file volume to fail with code InvalidArgument, got %v", err)
+	}
+	if _, err := createVolume("pvc3", 1*common.GbInBytes,
+		csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected adopting a disk of another container cluster to fail with code InvalidArgument, got %v", err)
+	}
+	if volumeManager.GetVolume(otherClusterDisk.VolumeID.Id) == nil {
+		t.Fatalf("expected volume %s of another container cluster to stay registered", otherClusterDisk.VolumeID.Id)
+	}
+	err = volumeManager.UpdateVolumeMetadata(ctx, &cnstypes.CnsVolumeMetadataUpdateSpec{
+		VolumeId: disk.VolumeID,
+		Metadata: cnstypes.CnsVolumeMetadata{
+			EntityMetadata: []cnstypes.BaseCnsEntityMetadata{
+				cnsvsphere.GetCnsKubernetesEntityMetaData("pvc1", nil, false,
+					string(cnstypes.CnsKubernetesEntityTypePVC), "ns1", c.manager.CnsConfig.Global.ClusterID, nil),
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := createVolume("pvc2", 1*common.GbInBytes,
+		csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected adopting the disk of another PVC to fail with code InvalidArgument, got %v", err)
+	}
+
+	// A disk registered to be adopted is unregistered again if it can't be.
+	volumes, err := volumeManager.QueryVolume(ctx, cnstypes.CnsQueryFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := createVolume("pvc4", 1*common.GbInBytes,
+		csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected adopting an empty disk to fail with code InvalidArgument, got %v", err)
+	}
+	volumesAfter, err := volumeManager.QueryVolume(ctx, cnstypes.CnsQueryFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(volumesAfter.Volumes) != len(volumes.Volumes) {
+		t.Fatalf("expected the disk that can't be adopted to be unregistered, got %d volumes instead of %d",
+			len(volumesAfter.Volumes), len(volumes.Volumes))
+	}
+}
+
+func TestSnapshots(t *testing.T) {
+	c, volumeManager := getControllerWithFakeVolumeManager(t)
+	params := make(map[string]string)
+	if v := os.Getenv("VSPHERE_DATASTORE_URL"); v != "" {
+		params[common.AttributeDatastoreURL] = v
+	}
+	respCreate, err := c.CreateVolume(ctx, &csi.CreateVolumeRequest{
+		Name:          testVolumeName + "-" + uuid.New().String(),
+		CapacityRange: &csi.CapacityRange{RequiredBytes: 1 * common.GbInBytes},
+		Parameters:    params,
+		VolumeCapabilities: []*csi.VolumeCapability{{
+			AccessMode: &csi.VolumeCapability_AccessMode{
+				Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+			},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	volID := respCreate.Volume.VolumeId
+
+	// A retry of the request returns the snapshot it created.
+	reqSnapshot := &csi.CreateSnapshotRequest{Name: "snapshot-" + uuid.New().String(), SourceVolumeId: volID}
+	respSnapshot, err := c.CreateSnapshot(ctx, reqSnapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshot := respSnapshot.Snapshot
+	if snapshot.SourceVolumeId != volID || snapshot.SizeBytes != 1*common.GbInBytes || !snapshot.ReadyToUse {
+		t.Fatalf("unexpected snapshot %+v of volume %s", snapshot, volID)
+	}
+	respRetry, err := c.CreateSnapshot(ctx, reqSnapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if respRetry.Snapshot.SnapshotId != snapshot.SnapshotId {
+		t.Fatalf("expected retry of CreateSnapshot to return snapshot %s, got %s", snapshot.SnapshotId,
+			respRetry.Snapshot.SnapshotId)
+	}
+	reqSnapshot.Name = "snapshot-" + uuid.New().String()
+	if _, err := c.CreateSnapshot(ctx, reqSnapshot); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.CreateSnapshot(ctx, &csi.CreateSnapshotRequest{Name: reqSnapshot.Name,
+		SourceVolumeId: uuid.New().String()}); status.Code(err) != codes.NotFound {
+		t.Fatalf("expected CreateSnapshot of an unknown volume to fail with code NotFound, got %v", err)
+	}
+
+	// The snapshots are listed a page at a time.
+	var snapshotIDs []string
+	reqList := &csi.ListSnapshotsRequest{SourceVolumeId: volID, MaxEntries: 1}
+	for {
+		respList, err := c.ListSnapshots(ctx, reqList)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, entry := range respList.Entries {
+			snapshotIDs = append(snapshotIDs, entry.Snapshot.SnapshotId)
+		}
+		if respList.NextToken == "" {
+			break
+		}
+		reqList.StartingToken = respList.NextToken
+	}
+	if len(snapshotIDs) != 2 {
+		t.Fatalf("expected 2 snapshots of volume %s, got %v", volID, snapshotIDs)
+	}
+
+	// The size of the snapshots is the capacity the volume had when they were
+	// taken.
+	if err := volumeManager.ExpandVolume(ctx, volID, 2*common.GbInBytes/common.MbInBytes); err != nil {
+		t.Fatal(err)
+	}
+	if respRetry, err = c.CreateSnapshot(ctx, &csi.CreateSnapshotRequest{Name: reqSnapshot.Name,
+		SourceVolumeId: volID}); err != nil {
+		t.Fatal(err)
+	}
+	if respRetry.Snapshot.SizeBytes != 1*common.GbInBytes {
+		t.Fatalf("expected retry of CreateSnapshot to return a snapshot of 1 GB, got %d bytes",
+			respRetry.Snapshot.SizeBytes)
+	}
+	respList, err := c.ListSnapshots(ctx, &csi.ListSnapshotsRequest{SnapshotId: snapshot.SnapshotId})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(respList.Entries) != 1 || respList.Entries[0].Snapshot.SnapshotId != snapshot.SnapshotId ||
+		respList.Entries[0].Snapshot.SizeBytes != 1*common.GbInBytes {
+		t.Fatalf("expected snapshot %s of 1 GB, got %+v", snapshot.SnapshotId, respList.Entries)
+	}
+
+	// Volumes with snapshots can't be deleted.
+	reqDelete := &csi.DeleteVolumeRequest{VolumeId: volID}
+	if _, err := c.DeleteVolume(ctx, reqDelete); status.Code(err) != codes.Internal {
+		t.Fatalf("expected DeleteVolume of a volume with snapshots to fail with code Internal, got %v", err)
+	}
+	for _, snapshotID := range append(snapshotIDs, snapshotIDs[0], "invalid") {
+		if _, err := c.DeleteSnapshot(ctx, &csi.DeleteSnapshotRequest{SnapshotId: snapshotID}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := c.DeleteVolume(ctx, reqDelete); err != nil {
+		t.Fatal(err)
+	}
+	if volumeManager.GetVolume(volID) != nil {
+		t.Fatalf("volume %s still exists after deletion", volID)
+	}
+	if _, err := c.DeleteSnapshot(ctx, &csi.DeleteSnapshotRequest{SnapshotId: snapshot.SnapshotId}); err != nil {
+		t.Fatalf("expected DeleteSnapshot of a deleted volume to succeed, got %v", err)
+	}
+}
+
+func TestCreateVolumeFromSnapshot(t *testing.T) {
+	c, volumeManager := getControllerWithFakeVolumeManager(t)
+	sharedDatastores, err := c.nodeMgr.GetSharedDatastoresInK8SCluster(ctx)
+	if err != nil || len(sharedDatastores) == 0 {
+		t.Fatalf("failed to get shared datastores. err: %v", err)
+	}
+	volumeManager.DatastoreURL = sharedDatastores[0].Info.Url
+	createVolume := func(name string, requiredBytes int64, mode csi.VolumeCapability_AccessMode_Mode,
+		source *csi.VolumeContentSource) (*csi.CreateVolumeResponse, error) {
+		return c.CreateVolume(ctx, &csi.CreateVolumeRequest{
+			Name:                name,
+			CapacityRange:       &csi.CapacityRange{RequiredBytes: requiredBytes},
+			VolumeContentSource: source,
+			VolumeCapabilities: []*csi.VolumeCapability{{
+				AccessMode: &csi.VolumeCapability_AccessMode{Mode: mode},
+			}},
+		})
+	}
+	respSource, err := createVolume(testVolumeName+"-"+uuid.New().String(), 1*common.GbInBytes,
+		csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	respSnapshot, err := c.CreateSnapshot(ctx, &csi.CreateSnapshotRequest{
+		Name:           "snapshot-" + uuid.New().String(),
+		SourceVolumeId: respSource.Volume.VolumeId,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshotSource := func(snapshotID string) *csi.VolumeContentSource {
+		return &csi.VolumeContentSource{
+			Type: &csi.VolumeContentSource_Snapshot{
+				Snapshot: &csi.VolumeContentSource_SnapshotSource{SnapshotId: snapshotID},
+			},
+		}
+	}
+	source := snapshotSource(respSnapshot.Snapshot.SnapshotId)
+	// The snapshot keeps its size when its source is expanded.
+	err = volumeManager.ExpandVolume(ctx, respSource.Volume.VolumeId, 2*common.GbInBytes/common.MbInBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The volume has the size of the snapshot, also on a retry.
+	name := testVolumeName + "-" + uuid.New().String()
+	var volID string
+	for i := 0; i < 2; i++ {
+		resp, err := createVolume(name, 0, csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER, source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Volume.CapacityBytes != 1*common.GbInBytes || resp.Volume.VolumeId == respSource.Volume.VolumeId ||
+			(volID != "" && resp.Volume.VolumeId != volID) {
+			t.Fatalf("unexpected volume %s of %d bytes restored from snapshot", resp.Volume.VolumeId,
+				resp.Volume.CapacityBytes)
+		}
+		volID = resp.Volume.VolumeId
+	}
+	for _, requiredBytes := range []int64{1 * common.GbInBytes, 2 * common.GbInBytes} {
+		resp, err := createVolume(testVolumeName+"-"+uuid.New().String(), requiredBytes,
+			csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER, source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Volume.CapacityBytes != requiredBytes {
+			t.Fatalf("expected volume of %d bytes restored from snapshot, got %d bytes", requiredBytes,
+				resp.Volume.CapacityBytes)
+		}
+	}
+
+	if _, err := createVolume(testVolumeName+"-"+uuid.New().String(), 512*common.MbInBytes,
+		csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER, source); status.Code(err) != codes.OutOfRange {
+		t.Fatalf("expected restoring a volume smaller than the snapshot to fail with code OutOfRange, got %v", err)
+	}
+	if _, err := createVolume(testVolumeName+"-"+uuid.New().String(), 1*common.GbInBytes,
+		csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+		snapshotSource(common.NewSnapshotID(respSource.Volume.VolumeId, uuid.New().String()))); status.Code(err) !=
+		codes.NotFound {
+		t.Fatalf("expected restoring a volume from an unknown snapshot to fail with code NotFound, got %v", err)
+	}
+	if _, err := createVolume(testVolumeName+"-"+uuid.New().String(), 1*common.GbInBytes,
+		csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER, source); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected restoring a file volume to fail with code InvalidArgument, got %v", err)
+	}
+}
+
+func TestCloneVolume(t *testing.T) {
+	c, volumeManager := getControllerWithFakeVolumeManager(t)
+	sharedDatastores, err := c.nodeMgr.GetSharedDatastoresInK8SCluster(ctx)
+	if err != nil || len(sharedDatastores) == 0 {
+		t.Fatalf("failed to get shared datastores. err: %v", err)
+	}
+	volumeManager.DatastoreURL = sharedDatastores[0].Info.Url
+	createVolume := func(name string, requiredBytes int64, mode csi.VolumeCapability_AccessMode_Mode,
+		params map[string]string, source *csi.VolumeContentSource) (*csi.CreateVolumeResponse, error) {
+		return c.CreateVolume(ctx, &csi.CreateVolumeRequest{
+			Name:                name,
+			CapacityRange:       &csi.CapacityRange{RequiredBytes: requiredBytes},
+			Parameters:          params,
+			VolumeContentSource: source,
+			VolumeCapabilities: []*csi.VolumeCapability{{
+				AccessMode: &csi.VolumeCapability_AccessMode{Mode: mode},
+			}},
+		})
+	}
+	respSource, err := createVolume(testVolumeName+"-"+uuid.New().String(), 1*common.GbInBytes,
+		csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	volumeSource := func(volumeID string) *csi.VolumeContentSource {
+		return &csi.VolumeContentSource{
+			Type: &csi.VolumeContentSource_Volume{
+				Volume: &csi.VolumeContentSource_VolumeSource{VolumeId: volumeID},
+			},
+		}
+	}
+	source := volumeSource(respSource.Volume.VolumeId)
+
+	// The clone has the size of the source, also on a retry.
+	name := testVolumeName + "-" + uuid.New().String()
+	var volID string
+	for i := 0; i < 2; i++ {
+		resp, err := createVolume(name, 0, csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER, nil, source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Volume.CapacityBytes != 1*common.GbInBytes || resp.Volume.VolumeId == respSource.Volume.VolumeId ||
+			(volID != "" && resp.Volume.VolumeId != volID) {
+			t.Fatalf("unexpected clone %s of %d bytes", resp.Volume.VolumeId, resp.Volume.CapacityBytes)
+		}
+		if resp.Volume.ContentSource.GetVolume().GetVolumeId() != respSource.Volume.VolumeId {
+			t.Fatalf("expected content source of the clone to be volume %s, got %+v", respSource.Volume.VolumeId,
+				resp.Volume.ContentSource)
+		}
+		volID = resp.Volume.VolumeId
+	}
+	resp, err := createVolume(testVolumeName+"-"+uuid.New().String(), 2*common.GbInBytes,
+		csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER, nil, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Volume.CapacityBytes != 2*common.GbInBytes {
+		t.Fatalf("expected clone of 2 GB, got %d bytes", resp.Volume.CapacityBytes)
+	}
+
+	if _, err := createVolume(testVolumeName+"-"+uuid.New().String(), 512*common.MbInBytes,
+		csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER, nil, source); status.Code(err) != codes.OutOfRange {
+		t.Fatalf("expected a clone smaller than its source to fail with code OutOfRange, got %v", err)
+	}
+	if _, err := createVolume(testVolumeName+"-"+uuid.New().String(), 1*common.GbInBytes,
+		csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER, nil, volumeSource(uuid.New().String())); status.Code(err) !=
+		codes.NotFound {
+		t.Fatalf("expected cloning an unknown volume to fail with code NotFound, got %v", err)
+	}
+	if _, err := createVolume(testVolumeName+"-"+uuid.New().String(), 1*common.GbInBytes,
+		csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER, nil, source); status.Code(err) !=
+		codes.InvalidArgument {
+		t.Fatalf("expected cloning to a file volume to fail with code InvalidArgument, got %v", err)
+	}
+	// The datastore of the StorageClass has to be accessible to the nodes.
+	if _, err := createVolume(testVolumeName+"-"+uuid.New().String(), 1*common.GbInBytes,
+		csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+		map[string]string{common.AttributeDatastoreURL: "ds:///vmfs/volumes/unknown/"}, source); status.Code(err) !=
+		codes.InvalidArgument {
+		t.Fatalf("expected cloning to an inaccessible datastore to fail with code InvalidArgument, got %v", err)
+	}
+
+	// Faults of the clone task are returned with the code of their cause.
+	for _, test := range []struct {
+		err  error
+		code codes.Code
+	}{
+		{&cnsvolume.VolumeCloneError{Busy: true, Fault: "busy"}, codes.Unavailable},
+		{&cnsvolume.VolumeCloneError{Fault: "failed"}, codes.Internal},
+		{&cnsvolume.InsufficientSpaceError{RequiredMB: 1024, FreeMB: -1}, codes.ResourceExhausted},
+	} {
+		volumeManager.InjectError(unittestcommon.FakeOpCloneVolume, test.err)
+		if _, err := createVolume(testVolumeName+"-"+uuid.New().String(), 1*common.GbInBytes,
+			csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER, nil, source); status.Code(err) != test.code {
+			t.Errorf("expected clone failing with %v to fail with code %v, got %v", test.err, test.code, err)
+		}
+	}
+	volumeManager.InjectError(unittestcommon.FakeOpCloneVolume, nil)
+}
+
+func TestGetCapacity(t *testing.T) {
+	c, _ := getControllerWithFakeVolumeManager(t)
+	sharedDatastores, err := c.nodeMgr.GetSharedDatastoresInK8SCluster(ctx)
+	if err != nil || len(sharedDatastores) == 0 {
+		t.Fatalf("failed to get shared datastores. err: %v", err)
+	}
+	resp, err := c.GetCapacity(ctx, &csi.GetCapacityRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.AvailableCapacity <= 0 {
+		t.Fatalf("expected capacity available on shared datastores, got %d bytes", resp.AvailableCapacity)
+	}
+	// The capacity is the free space of the largest datastore, not of all of
+	// them.
+	capacity := resp.AvailableCapacity
+	resp, err = c.GetCapacity(ctx, &csi.GetCapacityRequest{
+		Parameters: map[string]string{common.AttributeDatastoreURL: sharedDatastores[0].Info.Url},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.AvailableCapacity <= 0 || resp.AvailableCapacity > capacity {
+		t.Fatalf("expected capacity of at most %d bytes available on datastore %s, got %d bytes", capacity,
+			sharedDatastores[0].Info.Url, resp.AvailableCapacity)
+	}
+	resp, err = c.GetCapacity(ctx, &csi.GetCapacityRequest{
+		Parameters: map[string]string{common.AttributeDatastoreURL: "ds:///vmfs/volumes/unknown/"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.AvailableCapacity != 0 {
+		t.Fatalf("expected no capacity on an unknown datastore, got %d bytes", resp.AvailableCapacity)
+	}
+	if _, err := c.GetCapacity(ctx, &csi.GetCapacityRequest{
+		Parameters: map[string]string{"unknown": "value"},
+	}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected GetCapacity with an invalid parameter to fail with code InvalidArgument, got %v", err)
+	}
+	if _, err := c.GetCapacity(ctx, &csi.GetCapacityRequest{
+		VolumeCapabilities: []*csi.VolumeCapability{{
+			AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER},
+		}},
+	}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected GetCapacity of file volumes to fail with code InvalidArgument, got %v", err)
+	}
+}
+
+func TestListVolumesPaging(t *testing.T) {
+	c, volumeManager := getControllerWithFakeVolumeManager(t)
+	resp, err := c.ListVolumes(ctx, &csi.ListVolumesRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	listed := make(map[string]bool)
+	for _, entry := range resp.Entries {
+		listed[entry.Volume.VolumeId] = true
+	}
+	for i := 0; i < 3; i++ {
+		respCreate, err := c.CreateVolume(ctx, &csi.CreateVolumeRequest{
+			Name:          testVolumeName + "-" + uuid.New().String(),
+			CapacityRange: &csi.CapacityRange{RequiredBytes: 1 * common.GbInBytes},
+			VolumeCapabilities: []*csi.VolumeCapability{{
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		listed[respCreate.Volume.VolumeId] = true
+	}
+	// File volumes count in the CNS cursor but aren't listed.
+	if _, err := volumeManager.CreateVolume(ctx, &cnstypes.CnsVolumeCreateSpec{
+		Name:       "file-" + uuid.New().String(),
+		VolumeType: common.FileVolumeType,
+		Metadata: cnstypes.CnsVolumeMetadata{
+			ContainerCluster: cnstypes.CnsContainerCluster{ClusterId: c.manager.CnsConfig.Global.ClusterID},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Pages of at most 2 volumes list each block volume once.
+	seen := make(map[string]bool)
+	token := ""
+	for pages := 0; ; pages++ {
+		if pages > len(listed) {
+			t.Fatalf("ListVolumes didn't stop paging, listed %d volumes", len(seen))
+		}
+		page, err := c.ListVolumes(ctx, &csi.ListVolumesRequest{MaxEntries: 2, StartingToken: token})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Entries) > 2 {
+			t.Fatalf("expected at most 2 volumes in a page, got %d", len(page.Entries))
+		}
+		for _, entry := range page.Entries {
+			if seen[entry.Volume.VolumeId] || !listed[entry.Volume.VolumeId] {
+				t.Fatalf("unexpected volume %s in page %d", entry.Volume.VolumeId, pages)
+			}
+			seen[entry.Volume.VolumeId] = true
+		}
+		if token = page.NextToken; token == "" {
+			break
+		}
+	}
+	if len(seen) != len(listed) {
+		t.Fatalf("expected %d volumes to be listed, got %d", len(listed), len(seen))
+	}
+
+	// Pages of CNS smaller than the query limit are followed to the end.
+	volumeManager.QueryPageSize = 1
+	resp, err = c.ListVolumes(ctx, &csi.ListVolumesRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Entries) != len(listed) || resp.NextToken != "" {
+		t.Fatalf("expected %d volumes to be listed in pages of 1 volume, got %d with next token %q",
+			len(listed), len(resp.Entries), resp.NextToken)
+	}
+	volumeManager.QueryPageSize = 0
+
+	if _, err := c.ListVolumes(ctx, &csi.ListVolumesRequest{StartingToken: "1000"}); status.Code(err) !=
+		codes.Aborted {
+		t.Fatalf("expected a starting token past the volumes to fail with code Aborted, got %v", err)
+	}
+}
+
+func TestControllerGetVolume(t *testing.T) {
+	c, volumeManager := getControllerWithFakeVolumeManager(t)
+	respCreate, err := c.CreateVolume(ctx, &csi.CreateVolumeRequest{
+		Name:          testVolumeName + "-" + uuid.New().String(),
+		CapacityRange: &csi.CapacityRange{RequiredBytes: 1 * common.GbInBytes},
+		VolumeCapabilities: []*csi.VolumeCapability{{
+			AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	volID := respCreate.Volume.VolumeId
+	for _, test := range []struct {
+		healthStatus string
+		abnormal     bool
+	}{
+		{"green", false},
+		{"yellow", false},
+		{"unknown", false},
+		{"red", true},
+		// vCenters that don't report the health of volumes.
+		{"", false},
+	} {
+		volumeManager.SetHealthStatus(volID, test.healthStatus)
+		resp, err := c.ControllerGetVolume(ctx, &csi.ControllerGetVolumeRequest{VolumeId: volID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Volume.VolumeId != volID || resp.Volume.CapacityBytes != 1*common.GbInBytes {
+			t.Fatalf("unexpected volume %+v", resp.Volume)
+		}
+		if condition := resp.Status.VolumeCondition; condition.Abnormal != test.abnormal || condition.Message == "" {
+			t.Errorf("expected condition of health status %q to be abnormal %v, got %+v", test.healthStatus,
+				test.abnormal, condition)
+		}
+	}
+
+	// The volume is published to the nodes whose VMs have its disk, which
+	// the fake node manager names after the VM.
+	resp, err := c.ControllerGetVolume(ctx, &csi.ControllerGetVolumeRequest{VolumeId: volID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nodeIDs := resp.Status.PublishedNodeIds; len(nodeIDs) != 0 {
+		t.Errorf("expected volume %q to be published to no node, got %v", volID, nodeIDs)
+	}
+	vm := simulator.Map.Any("VirtualMachine").(*simulator.VirtualMachine)
+	devices := vm.Config.Hardware.Device
+	vm.Config.Hardware.Device = append(devices, &types.VirtualDisk{VDiskId: &types.ID{Id: volID}})
+	defer func() { vm.Config.Hardware.Device = devices }()
+	resp, err = c.ControllerGetVolume(ctx, &csi.ControllerGetVolumeRequest{VolumeId: volID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nodeIDs := resp.Status.PublishedNodeIds; len(nodeIDs) != 1 || nodeIDs[0] != vm.Name {
+		t.Errorf("expected volume %q to be published to node %q, got %v", volID, vm.Name, nodeIDs)
+	}
+
+	_, err = c.ControllerGetVolume(ctx, &csi.ControllerGetVolumeRequest{VolumeId: uuid.New().String()})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("expected ControllerGetVolume of an unknown volume to fail with code NotFound, got %v", err)
+	}
+	if _, err := c.ControllerGetVolume(ctx, &csi.ControllerGetVolumeRequest{}); status.Code(err) !=
+		codes.InvalidArgument {
+		t.Fatalf("expected ControllerGetVolume without volume ID to fail with code InvalidArgument, got %v", err)
+	}
+}
+
+func TestShrinkVolume(t *testing.T) {
+	c, _ := getControllerWithFakeVolumeManager(t)
+	params := make(map[string]string)
+	if v := os.Getenv("VSPHERE_DATASTORE_URL"); v != "" {
+		params[common.AttributeDatastoreURL] = v
+	}
+	capability := &csi.VolumeCapability{
+		AccessMode: &csi.VolumeCapability_AccessMode{
+			Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+		},
+	}
+	respCreate, err := c.CreateVolume(ctx, &csi.CreateVolumeRequest{
+		Name:               testVolumeName + "-" + uuid.New().String(),
+		CapacityRange:      &csi.CapacityRange{RequiredBytes: 2 * common.GbInBytes},
+		Parameters:         params,
+		VolumeCapabilities: []*csi.VolumeCapability{capability},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	volID := respCreate.Volume.VolumeId
+
+	reqExpand := &csi.ControllerExpandVolumeRequest{
+		VolumeId:         volID,
+		CapacityRange:    &csi.CapacityRange{RequiredBytes: 1 * common.GbInBytes},
+		VolumeCapability: capability,
+	}
+	if _, err := c.ControllerExpandVolume(ctx, reqExpand); status.Code(err) != codes.OutOfRange {
+		t.Fatalf("expected ControllerExpandVolume to a smaller size to fail with code OutOfRange, got %v", err)
+	}
+	co := commonco.ContainerOrchestratorUtility.(*unittestcommon.FakeK8SOrchestrator)
+	events := co.GetPVCEvents(volID)
+	if len(events) != 1 || events[0] != common.EventReasonVolumeShrinkNotSupported {
+		t.Fatalf("expected a %s event for volume %s, got %v", common.EventReasonVolumeShrinkNotSupported, volID, events)
+	}
+
+	// Expanding to the current size is still a no-op.
+	reqExpand.CapacityRange.RequiredBytes = 2 * common.GbInBytes
+	if _, err := c.ControllerExpandVolume(ctx, reqExpand); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOfflineExpansionOnly(t *testing.T) {
+	c, _ := getControllerWithFakeVolumeManager(t)
+	params := make(map[string]string)
+	if v := os.Getenv("VSPHERE_DATASTORE_URL"); v != "" {
+		params[common.AttributeDatastoreURL] = v
+	}
+	params[common.AttributeOfflineExpansionOnly] = "true"
+	capability := &csi.VolumeCapability{
+		AccessMode: &csi.VolumeCapability_AccessMode{
+			Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+		},
+	}
+	respCreate, err := c.CreateVolume(ctx, &csi.CreateVolumeRequest{
+		Name:               testVolumeName + "-" + uuid.New().String(),
+		CapacityRange:      &csi.CapacityRange{RequiredBytes: 1 * common.GbInBytes},
+		Parameters:         params,
+		VolumeCapabilities: []*csi.VolumeCapability{capability},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	volID := respCreate.Volume.VolumeId
+	co := commonco.ContainerOrchestratorUtility.(*unittestcommon.FakeK8SOrchestrator)
+	co.SetVolumeStorageClassParams(volID, params)
+	defer co.SetVolumeStorageClassParams(volID, nil)
+
+	// The volume isn't attached to any node, so it can be expanded.
+	reqExpand := &csi.ControllerExpandVolumeRequest{
+		VolumeId:         volID,
+		CapacityRange:    &csi.CapacityRange{RequiredBytes: 2 * common.GbInBytes},
+		VolumeCapability: capability,
+	}
+	if _, err := c.ControllerExpandVolume(ctx, reqExpand); err != nil {
+		t.Fatal(err)
+	}
+
+	co.SetVolumeStorageClassParams(volID, map[string]string{common.AttributeOfflineExpansionOnly: "sometimes"})
+	if _, err := c.ControllerExpandVolume(ctx, reqExpand); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected ControllerExpandVolume to fail with code InvalidArgument, got %v", err)
+	}
+}
+
+func TestIsDiskInSnapshot(t *testing.T) {
+	newVM := func(parent *types.VirtualDiskFlatVer2BackingInfo, snapshot *types.VirtualMachineSnapshotInfo) mo.VirtualMachine {
+		return mo.VirtualMachine{
+			Config: &types.VirtualMachineConfigInfo{
+				Hardware: types.VirtualHardware{
+					Device: []types.BaseVirtualDevice{
+						&types.VirtualDisk{
+							VirtualDevice: types.VirtualDevice{
+								Backing: &types.VirtualDiskFlatVer2BackingInfo{Parent: parent},
+							},
+							VDiskId: &types.ID{Id: "vol1"},
+						},
+					},
+				},
+			},
+			Snapshot: snapshot,
+		}
+	}
+	tests := []struct {
+		name               string
+		vm                 mo.VirtualMachine
+		volumeID           string
+		expectedAttached   bool
+		expectedInSnapshot bool
+	}{
+		{"detached", newVM(nil, nil), "vol2", false, false},
+		{"attached", newVM(nil, nil), "vol1", true, false},
+		{"vm with snapshots", newVM(nil, &types.VirtualMachineSnapshotInfo{}), "vol1", true, true},
+		{"delta disk", newVM(&types.VirtualDiskFlatVer2BackingInfo{}, nil), "vol1", true, true},
+	}
+	for _, test := range tests {
+		attached, inSnapshot := isDiskInSnapshot(test.vm, test.volumeID)
+		if attached != test.expectedAttached || inSnapshot != test.expectedInSnapshot {
+			t.Errorf("%s: expected attached %v and in snapshot %v, got %v and %v", test.name,
+				test.expectedAttached, test.expectedInSnapshot, attached, inSnapshot)
+		}
+	}
+}
+
+func TestCheckVolumeNotInUse(t *testing.T) {
+	getControllerTest(t)
+	co := commonco.ContainerOrchestratorUtility.(*unittestcommon.FakeK8SOrchestrator)
+	volID, nodeName := "check-volume-not-in-use", "node1"
+
+	// Volumes not used by pods on the node are detached.
+	if err := checkVolumeNotInUse(ctx, volID, nodeName); err != nil {
+		t.Fatalf("expected volume not used by pods to be detached, got %v", err)
+	}
+
+	// Volumes used by pods on a Ready node aren't.
+	co.SetPodsUsingVolumeOnNode(volID, nodeName, []string{"default/pod1"})
+	defer co.SetPodsUsingVolumeOnNode(volID, nodeName, nil)
+	if err := checkVolumeNotInUse(ctx, volID, nodeName); status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expected detach of volume used by pods to fail with code FailedPrecondition, got %v", err)
+	}
+
+	// Unless the node is NotReady, and an event is recorded then.
+	co.SetNodeReady(nodeName, false)
+	defer co.SetNodeReady(nodeName, true)
+	if err := checkVolumeNotInUse(ctx, volID, nodeName); err != nil {
+		t.Fatalf("expected volume used by pods on NotReady node to be detached, got %v", err)
+	}
+	events := co.GetPVCEvents(volID)
+	if len(events) != 1 || events[0] != common.EventReasonForcedDetach {
+		t.Fatalf("expected a %s event for volume %s, got %v", common.EventReasonForcedDetach, volID, events)
+	}
+
+	// Volumes aren't detached if the pods using them can't be looked up.
+	co.SetPodsUsingVolumeOnNodeError(errors.New("pods can't be listed"))
+	defer co.SetPodsUsingVolumeOnNodeError(nil)
+	if err := checkVolumeNotInUse(ctx, volID, nodeName); status.Code(err) != codes.Internal {
+		t.Fatalf("expected detach of volume whose pods can't be looked up to fail with code Internal, got %v", err)
+	}
+}
+
+func TestIsConfigChangeEvent(t *testing.T) {
+	cfgPath := "/etc/cloud/csi-vsphere.conf"
+	for _, test := range []struct {
+		event    fsnotify.Event
+		expected bool
+	}{
+		// Update of the mounted secret.
+		{fsnotify.Event{Name: "/etc/cloud/..2021_06_01_10_00_00.123456789", Op: fsnotify.Remove}, true},
+		// Config file written or created again in place.
+		{fsnotify.Event{Name: cfgPath, Op: fsnotify.Write}, true},
+		{fsnotify.Event{Name: cfgPath, Op: fsnotify.Create}, true},
+		{fsnotify.Event{Name: cfgPath, Op: fsnotify.Chmod}, false},
+		{fsnotify.Event{Name: "/etc/cloud/other.conf", Op: fsnotify.Write}, false},
+	} {
+		if actual := isConfigChangeEvent(test.event, cfgPath); actual != test.expected {
+			t.Errorf("expected event %v to change the config %t, got %t", test.event, test.expected, actual)
+		}
+	}
+}
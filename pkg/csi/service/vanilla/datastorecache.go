@@ -0,0 +1,160 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vanilla
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/view"
+	"github.com/vmware/govmomi/vim25/types"
+
+	cnsvsphere "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/vsphere"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
+)
+
+// sharedDatastoresCacheTTL is how long the datastores shared by all node VMs
+// are reused before they are computed again, even if no node or host change
+// was observed.
+var sharedDatastoresCacheTTL = 5 * time.Minute
+
+// hostListenerRetryInterval is the interval between attempts to restart the
+// listener for host changes after it failed.
+var hostListenerRetryInterval = time.Minute
+
+// sharedDatastoresCache caches the datastores accessible from all node VMs.
+// It is invalidated when nodes are added, updated or removed, and when hosts
+// enter or exit maintenance mode or their datastores change.
+type sharedDatastoresCache struct {
+	mutex sync.Mutex
+	// datastores are the cached shared datastores, nil if not computed.
+	datastores []*cnsvsphere.DatastoreInfo
+	// expirationTime is the time after which datastores are computed again.
+	expirationTime time.Time
+	// generation is incremented on each invalidation, so that datastores
+	// computed concurrently with an invalidation aren't cached.
+	generation uint64
+}
+
+// get returns the cached shared datastores and the current generation of the
+// cache. The datastores are nil if they have to be computed.
+func (c *sharedDatastoresCache) get() ([]*cnsvsphere.DatastoreInfo, uint64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.datastores == nil || time.Now().After(c.expirationTime) {
+		return nil, c.generation
+	}
+	datastores := make([]*cnsvsphere.DatastoreInfo, len(c.datastores))
+	copy(datastores, c.datastores)
+	return datastores, c.generation
+}
+
+// set caches the shared datastores computed at the given generation of the
+// cache, unless the cache was invalidated since.
+func (c *sharedDatastoresCache) set(datastores []*cnsvsphere.DatastoreInfo, generation uint64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if generation != c.generation {
+		return
+	}
+	c.datastores = make([]*cnsvsphere.DatastoreInfo, len(datastores))
+	copy(c.datastores, datastores)
+	c.expirationTime = time.Now().Add(sharedDatastoresCacheTTL)
+}
+
+// invalidate drops the cached shared datastores.
+func (c *sharedDatastoresCache) invalidate(ctx context.Context, reason string) {
+	log := logger.GetLogger(ctx)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.generation++
+	if c.datastores != nil {
+		log.Infof("Invalidating cached shared datastores: %s", reason)
+		c.datastores = nil
+	}
+}
+
+// listenForHostChanges invalidates the shared datastores cache whenever a host
+// of the vCenter enters or exits maintenance mode, or the datastores mounted
+// on a host change. It restarts the listener until ctx is done.
+func (c *sharedDatastoresCache) listenForHostChanges(ctx context.Context, vc *cnsvsphere.VirtualCenter) {
+	log := logger.GetLogger(ctx)
+	for {
+		err := c.waitForHostChanges(ctx, vc)
+		select {
+		case <-ctx.Done():
+			log.Infof("Stopped listening for host changes on vCenter %q", vc.Config.Host)
+			return
+		default:
+		}
+		log.Infof("Listener for host changes on vCenter %q needs to be restarted due to err: %v", vc.Config.Host, err)
+		// Changes may have been missed while the listener wasn't running.
+		c.invalidate(ctx, "listener for host changes restarted")
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(hostListenerRetryInterval):
+		}
+	}
+}
+
+// waitForHostChanges listens for changes of the maintenance mode and datastores
+// of all hosts of the vCenter, until an error occurs or ctx is done.
+func (c *sharedDatastoresCache) waitForHostChanges(ctx context.Context, vc *cnsvsphere.VirtualCenter) error {
+	log := logger.GetLogger(ctx)
+	if err := vc.Connect(ctx); err != nil {
+		log.Errorf("failed to connect to vCenter %q. err: %v", vc.Config.Host, err)
+		return err
+	}
+	client := vc.Client.Client
+	containerView, err := view.NewManager(client).CreateContainerView(ctx, client.ServiceContent.RootFolder,
+		[]string{"HostSystem"}, true)
+	if err != nil {
+		log.Errorf("failed to create container view for hosts on vCenter %q. err: %v", vc.Config.Host, err)
+		return err
+	}
+	defer func() {
+		// Use a new context, ctx may be done already.
+		if err := containerView.Destroy(context.Background()); err != nil {
+			log.Debugf("failed to destroy container view for hosts on vCenter %q. err: %v", vc.Config.Host, err)
+		}
+	}()
+	filter := new(property.WaitFilter)
+	filter.Add(containerView.Reference(), "HostSystem", []string{"datastore", "runtime.inMaintenanceMode"},
+		&types.TraversalSpec{
+			Type: "ContainerView",
+			Path: "view",
+			Skip: types.NewBool(false),
+		})
+	filter.Spec.ObjectSet[0].Skip = types.NewBool(true)
+	initialUpdate := true
+	log.Infof("Listening for host changes on vCenter %q", vc.Config.Host)
+	return property.WaitForUpdates(ctx, property.DefaultCollector(client), filter, func(updates []types.ObjectUpdate) bool {
+		// The first update reports the current state of all hosts.
+		if initialUpdate {
+			initialUpdate = false
+			return false
+		}
+		for _, update := range updates {
+			log.Debugf("Got update for host %v properties %v", update.Obj, update.ChangeSet)
+		}
+		c.invalidate(ctx, "host maintenance mode or datastores changed")
+		return false
+	})
+}
@@ -0,0 +1,135 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vanilla
+
+import (
+	"context"
+	"crypto/tls"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vim25/types"
+
+	cnsvsphere "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/vsphere"
+)
+
+func TestSharedDatastoresCache(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var cache sharedDatastoresCache
+	datastores := []*cnsvsphere.DatastoreInfo{{}}
+
+	cached, generation := cache.get()
+	if cached != nil {
+		t.Fatalf("expected empty cache, got %v", cached)
+	}
+	cache.set(datastores, generation)
+	if cached, _ = cache.get(); len(cached) != 1 {
+		t.Fatalf("expected cached datastores, got %v", cached)
+	}
+
+	// Datastores computed before an invalidation must not be cached.
+	_, generation = cache.get()
+	cache.invalidate(ctx, "test")
+	cache.set(datastores, generation)
+	if cached, _ = cache.get(); cached != nil {
+		t.Errorf("expected datastores computed before invalidation not to be cached, got %v", cached)
+	}
+
+	defaultTTL := sharedDatastoresCacheTTL
+	defer func() {
+		sharedDatastoresCacheTTL = defaultTTL
+	}()
+	sharedDatastoresCacheTTL = -time.Second
+	_, generation = cache.get()
+	cache.set(datastores, generation)
+	if cached, _ = cache.get(); cached != nil {
+		t.Errorf("expected cached datastores to expire, got %v", cached)
+	}
+}
+
+func TestSharedDatastoresCacheInvalidatedOnMaintenanceMode(t *testing.T) {
+	// Other tests of the package use the inventory of the global simulator
+	// registry, restore it once this test is done.
+	defer func(registry *simulator.Registry) {
+		simulator.Map = registry
+	}(simulator.Map)
+	model := simulator.VPX()
+	defer model.Remove()
+	if err := model.Create(); err != nil {
+		t.Fatal(err)
+	}
+	model.Service.TLS = new(tls.Config)
+	s := model.Service.NewServer()
+	defer s.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	port, err := strconv.Atoi(s.URL.Port())
+	if err != nil {
+		t.Fatal(err)
+	}
+	password, _ := s.URL.User.Password()
+	vc := &cnsvsphere.VirtualCenter{
+		Config: &cnsvsphere.VirtualCenterConfig{
+			Host:     s.URL.Hostname(),
+			Port:     port,
+			Username: s.URL.User.Username(),
+			Password: password,
+			Insecure: true,
+		},
+	}
+	if err := vc.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var cache sharedDatastoresCache
+	listenerDone := make(chan struct{})
+	go func() {
+		cache.listenForHostChanges(ctx, vc)
+		close(listenerDone)
+	}()
+	// Stop the listener before the server is closed.
+	defer func() {
+		cancel()
+		<-listenerDone
+	}()
+	// Wait for the listener to report the initial state of the hosts before
+	// caching datastores.
+	time.Sleep(time.Second)
+	_, generation := cache.get()
+	cache.set([]*cnsvsphere.DatastoreInfo{{}}, generation)
+
+	hosts, err := find.NewFinder(vc.Client.Client).HostSystemList(ctx, "*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The simulator doesn't report maintenance mode changes to property
+	// collectors, report the change as vCenter does.
+	host := simulator.Map.Get(hosts[0].Reference())
+	simulator.Map.Update(host, []types.PropertyChange{{Name: "runtime.inMaintenanceMode", Val: true}})
+	for i := 0; i < 50; i++ {
+		if cached, _ := cache.get(); cached == nil {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Errorf("expected cached datastores to be invalidated when a host enters maintenance mode")
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vanilla
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	cnsvolume "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/volume"
+	cnsvsphere "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/vsphere"
+	cnsconfig "sigs.k8s.io/vsphere-csi-driver/pkg/common/config"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/common/prometheus"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
+)
+
+// detachWaitConfig has the settings of waiting for detached volumes to be
+// removed from the node VMs.
+type detachWaitConfig struct {
+	// pollInterval is the interval at which the node VM is polled.
+	pollInterval time.Duration
+	// timeout is how long to wait, zero disables waiting.
+	timeout time.Duration
+	// force detaches the volume again once the timeout elapses, instead of
+	// failing the detach right away.
+	force bool
+}
+
+// getDetachWaitConfig returns the settings of waiting for detached volumes to
+// be removed from the node VMs in the config.
+func getDetachWaitConfig(cfg *cnsconfig.Config) detachWaitConfig {
+	waitConfig := detachWaitConfig{
+		pollInterval: time.Duration(cfg.Global.DetachPollIntervalInSec) * time.Second,
+		force:        cfg.Global.ForceDetachOnTimeout,
+	}
+	if waitConfig.pollInterval <= 0 {
+		waitConfig.pollInterval = cnsconfig.DefaultDetachPollIntervalInSec * time.Second
+	}
+	if cfg.Global.DetachTimeoutInSec > 0 {
+		waitConfig.timeout = time.Duration(cfg.Global.DetachTimeoutInSec) * time.Second
+	}
+	return waitConfig
+}
+
+// waitForVolumeDetached waits for the volume to be removed from the node VM
+// after the CNS detach task completed, detaching it again with detach if it
+// is still attached once the timeout elapses and waitConfig forces it.
+func waitForVolumeDetached(ctx context.Context, waitConfig detachWaitConfig, volumeID string, nodeName string,
+	vm *cnsvsphere.VirtualMachine, detach func() error) error {
+	return waitForDetach(ctx, waitConfig, volumeID, nodeName, func() (bool, error) {
+		diskUUID, err := cnsvolume.IsDiskAttached(ctx, vm, volumeID)
+		if err != nil {
+			if cnsvsphere.IsManagedObjectNotFound(err, vm.Reference()) {
+				// The volume is detached along with the deleted Node VM.
+				return true, nil
+			}
+			return false, err
+		}
+		return diskUUID == "", nil
+	}, detach)
+}
+
+// waitForDetach polls isDetached until the volume is removed from the node VM,
+// the timeout elapses or ctx is done. Failures to poll are logged and retried.
+// Once the timeout elapses, the volume is detached again with detach if
+// waitConfig forces it, and the volume is only reported as detached if a last
+// call to isDetached confirms it. The duration of the wait, and timeouts, are
+// recorded as metrics.
+func waitForDetach(ctx context.Context, waitConfig detachWaitConfig, volumeID string, nodeName string,
+	isDetached func() (bool, error), detach func() error) error {
+	log := logger.GetLogger(ctx)
+	if waitConfig.timeout == 0 {
+		return nil
+	}
+	start := time.Now()
+	timeoutCtx, cancel := context.WithTimeout(ctx, waitConfig.timeout)
+	defer cancel()
+	err := wait.PollImmediateUntil(waitConfig.pollInterval, func() (bool, error) {
+		detached, err := isDetached()
+		if err != nil {
+			log.Warnf("failed to check if volume %q is detached from node %q. err=%v", volumeID, nodeName, err)
+			return false, nil
+		}
+		return detached, nil
+	}, timeoutCtx.Done())
+	if err == nil {
+		prometheus.DetachConvergenceHistVec.WithLabelValues(prometheus.PrometheusPassStatus).
+			Observe(time.Since(start).Seconds())
+		return nil
+	}
+	prometheus.DetachConvergenceHistVec.WithLabelValues(prometheus.PrometheusFailStatus).
+		Observe(time.Since(start).Seconds())
+	if ctx.Err() != nil {
+		msg := fmt.Sprintf("stopped waiting for volume %q to be detached from node %q. err=%v", volumeID, nodeName,
+			ctx.Err())
+		log.Error(msg)
+		if ctx.Err() == context.DeadlineExceeded {
+			return status.Error(codes.DeadlineExceeded, msg)
+		}
+		return status.Error(codes.Canceled, msg)
+	}
+	prometheus.DetachConvergenceTimeouts.WithLabelValues(strconv.FormatBool(waitConfig.force)).Inc()
+	if waitConfig.force {
+		log.Warnf("Volume %q is still attached to node %q %v after the detach, detaching it again",
+			volumeID, nodeName, waitConfig.timeout)
+		if err := detach(); err != nil {
+			log.Errorf("failed to detach volume %q from node %q again. err=%v", volumeID, nodeName, err)
+		}
+	}
+	detached, err := isDetached()
+	if err == nil && detached {
+		log.Infof("Volume %q is detached from node %q after the timeout", volumeID, nodeName)
+		return nil
+	}
+	msg := fmt.Sprintf("volume %q is still attached to node %q %v after the detach", volumeID, nodeName,
+		waitConfig.timeout)
+	if err != nil {
+		msg = fmt.Sprintf("failed to check if volume %q is detached from node %q %v after the detach. err=%v",
+			volumeID, nodeName, waitConfig.timeout, err)
+	}
+	log.Error(msg)
+	return status.Error(codes.Internal, msg)
+}
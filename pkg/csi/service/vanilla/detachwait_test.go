@@ -0,0 +1,97 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vanilla
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestWaitForDetach(t *testing.T) {
+	ctx := context.Background()
+	waitConfig := detachWaitConfig{pollInterval: 10 * time.Millisecond, timeout: time.Second}
+	detaches := 0
+	detach := func() error {
+		detaches++
+		return nil
+	}
+
+	// Polling continues past failures until the volume is detached.
+	polls := 0
+	err := waitForDetach(ctx, waitConfig, "vol1", "node1", func() (bool, error) {
+		polls++
+		switch polls {
+		case 1:
+			return false, errors.New("transient failure")
+		case 2:
+			return false, nil
+		}
+		return true, nil
+	}, detach)
+	if err != nil || polls != 3 || detaches != 0 {
+		t.Fatalf("expected volume detached after 3 polls, got %d polls, %d detaches and err %v",
+			polls, detaches, err)
+	}
+
+	stillAttached := func() (bool, error) { return false, nil }
+	waitConfig.timeout = 50 * time.Millisecond
+	err = waitForDetach(ctx, waitConfig, "vol1", "node1", stillAttached, detach)
+	if status.Code(err) != codes.Internal || detaches != 0 {
+		t.Fatalf("expected Internal error for volume still attached after the timeout, got %d detaches and err %v",
+			detaches, err)
+	}
+
+	// Forcing the detach fails when the volume is still attached afterwards.
+	waitConfig.force = true
+	err = waitForDetach(ctx, waitConfig, "vol1", "node1", stillAttached, detach)
+	if status.Code(err) != codes.Internal || detaches != 1 {
+		t.Fatalf("expected Internal error for volume still attached after the forced detach, "+
+			"got %d detaches and err %v", detaches, err)
+	}
+
+	// Forcing the detach succeeds when it removes the volume.
+	detached := false
+	err = waitForDetach(ctx, waitConfig, "vol1", "node1", func() (bool, error) { return detached, nil },
+		func() error {
+			detached = true
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("expected volume detached by the forced detach, got %v", err)
+	}
+
+	// Waiting stops when the context is cancelled.
+	cancelledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	waitConfig.timeout = time.Minute
+	detaches = 0
+	err = waitForDetach(cancelledCtx, waitConfig, "vol1", "node1", stillAttached, detach)
+	if status.Code(err) != codes.Canceled || detaches != 0 {
+		t.Fatalf("expected Canceled error for cancelled context, got %d detaches and err %v", detaches, err)
+	}
+
+	// Waiting can be disabled.
+	waitConfig = detachWaitConfig{}
+	if err = waitForDetach(ctx, waitConfig, "vol1", "node1", stillAttached, detach); err != nil {
+		t.Fatalf("expected no wait for detach, got %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vanilla
+
+import (
+	"context"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+
+	cnsvsphere "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/vsphere"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/common"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/common/commonco"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
+)
+
+// remediateDiskUUID sets disk.EnableUUID to TRUE on the VM of the registered
+// node if it is missing, when enabled in the config. Without it, the guest OS
+// doesn't expose the UUIDs of the disks the node service finds volumes by.
+// Only the leader replica of the controller reconfigures the VMs.
+func (nodes *Nodes) remediateDiskUUID(ctx context.Context, nodeName string) {
+	log := logger.GetLogger(ctx)
+	if !nodes.enableDiskUUID || (nodes.isLeader != nil && !nodes.isLeader()) {
+		return
+	}
+	vm, err := nodes.GetNodeByName(ctx, nodeName)
+	if err != nil {
+		log.Warnf("failed to get VM of node %q to check disk.EnableUUID. err=%v", nodeName, err)
+		return
+	}
+	enableNodeDiskUUID(ctx, nodeName, vm)
+}
+
+// enableNodeDiskUUID reconfigures the VM of the node with disk.EnableUUID set
+// to TRUE if it isn't, and records the outcome as an event on the node.
+func enableNodeDiskUUID(ctx context.Context, nodeName string, vm *cnsvsphere.VirtualMachine) {
+	log := logger.GetLogger(ctx)
+	enabled, err := vm.IsDiskUUIDEnabled(ctx)
+	if err != nil {
+		log.Warnf("failed to check disk.EnableUUID on VM %v of node %q. err=%v", vm, nodeName, err)
+		return
+	}
+	if enabled {
+		return
+	}
+	log.Infof("disk.EnableUUID isn't set to TRUE on VM %v of node %q, reconfiguring the VM", vm, nodeName)
+	if err = vm.EnableDiskUUID(ctx); err != nil {
+		commonco.ContainerOrchestratorUtility.RecordNodeEvent(ctx, nodeName, v1.EventTypeWarning,
+			common.EventReasonDiskUUIDRemediationFailed,
+			fmt.Sprintf("disk.EnableUUID isn't set to TRUE on the node VM and failed to be set: %v", err))
+		return
+	}
+	commonco.ContainerOrchestratorUtility.RecordNodeEvent(ctx, nodeName, v1.EventTypeNormal,
+		common.EventReasonDiskUUIDEnabled,
+		"disk.EnableUUID was set to TRUE on the node VM, it takes effect the next time the VM is powered on")
+}
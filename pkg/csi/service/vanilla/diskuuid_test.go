@@ -0,0 +1,59 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vanilla
+
+import (
+	"os"
+	"testing"
+
+	"sigs.k8s.io/vsphere-csi-driver/pkg/common/unittestcommon"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/common"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/common/commonco"
+)
+
+func TestEnableNodeDiskUUID(t *testing.T) {
+	if v := os.Getenv("VSPHERE_DATACENTER"); v != "" {
+		t.Skip("reconfigures the node VM, only run against the simulator")
+	}
+	ct := getControllerTest(t)
+	// FakeNodeManager returns any VM of the simulator for a node.
+	vm, err := ct.controller.nodeMgr.GetNodeByName(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	co := commonco.ContainerOrchestratorUtility.(*unittestcommon.FakeK8SOrchestrator)
+	nodeName := "disk-uuid-node"
+
+	enableNodeDiskUUID(ctx, nodeName, vm)
+	enabled, err := vm.IsDiskUUIDEnabled(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !enabled {
+		t.Fatalf("expected disk.EnableUUID to be set on VM %v", vm)
+	}
+	events := co.GetNodeEvents(nodeName)
+	if len(events) != 1 || events[0] != common.EventReasonDiskUUIDEnabled {
+		t.Fatalf("expected a %s event, got %v", common.EventReasonDiskUUIDEnabled, events)
+	}
+
+	// The VM is left as is once disk.EnableUUID is set.
+	enableNodeDiskUUID(ctx, nodeName, vm)
+	if events = co.GetNodeEvents(nodeName); len(events) != 1 {
+		t.Fatalf("expected no new event, got %v", events)
+	}
+}
@@ -0,0 +1,234 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vanilla
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/mo"
+	vimtypes "github.com/vmware/govmomi/vim25/types"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+
+	cnsvolume "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/volume"
+	cnsvsphere "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/vsphere"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
+	csitypes "sigs.k8s.io/vsphere-csi-driver/pkg/csi/types"
+)
+
+// lostNodeDetacher force detaches the volumes attached to nodes that are
+// deleted, or NotReady for longer than the timeout, from their VMs once the
+// VMs are confirmed powered off, so that the volumes can attach to replacement
+// nodes instead of their pods being stuck in ContainerCreating. It is disabled
+// unless a timeout is configured.
+type lostNodeDetacher struct {
+	// volumeManager returns the volume manager of the vCenter of a VM.
+	volumeManager func(vm *cnsvsphere.VirtualMachine) cnsvolume.Manager
+	// attachedVolumes returns the IDs of the volumes with a VolumeAttachment
+	// for the node, only these volumes are force detached from its VM.
+	attachedVolumes func(ctx context.Context, nodeName string) (map[string]bool, error)
+	// notReadyTimeout is how long a node stays NotReady before its volumes are
+	// force detached, zero disables force detaching volumes.
+	notReadyTimeout time.Duration
+	// mutex protects notReadyTimers.
+	mutex sync.Mutex
+	// notReadyTimers has the timers force detaching the volumes of NotReady
+	// nodes once the timeout elapses, by node name.
+	notReadyTimers map[string]*time.Timer
+	// isLeader returns whether this replica of the controller force detaches
+	// volumes, all replicas observe the nodes. nil is always the leader.
+	isLeader func() bool
+}
+
+// newLostNodeDetacher returns a lostNodeDetacher detaching volumes with the
+// volume manager of the vCenter of each VM. A zero or negative
+// notReadyTimeoutInMin disables force detaching volumes.
+func newLostNodeDetacher(volumeManager func(vm *cnsvsphere.VirtualMachine) cnsvolume.Manager,
+	notReadyTimeoutInMin int) *lostNodeDetacher {
+	d := &lostNodeDetacher{
+		volumeManager:  volumeManager,
+		notReadyTimers: make(map[string]*time.Timer),
+	}
+	if notReadyTimeoutInMin > 0 {
+		d.notReadyTimeout = time.Duration(notReadyTimeoutInMin) * time.Minute
+	}
+	return d
+}
+
+// nodeNotReadySince returns if the node is NotReady and since when.
+func nodeNotReadySince(node *v1.Node) (bool, time.Time) {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == v1.NodeReady {
+			return condition.Status != v1.ConditionTrue, condition.LastTransitionTime.Time
+		}
+	}
+	return false, time.Time{}
+}
+
+// nodeObserved starts the timer force detaching the volumes of the node if it
+// is NotReady, or stops it if the node is Ready again. getNodeVM is called to
+// get the VM of the node when the timer fires.
+func (d *lostNodeDetacher) nodeObserved(ctx context.Context, node *v1.Node,
+	getNodeVM func(ctx context.Context, nodeName string) (*cnsvsphere.VirtualMachine, error)) {
+	log := logger.GetLogger(ctx)
+	if d.notReadyTimeout == 0 {
+		return
+	}
+	notReady, since := nodeNotReadySince(node)
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	timer, pending := d.notReadyTimers[node.Name]
+	if !notReady {
+		if pending {
+			log.Infof("Node %q is Ready again, cancelling force detach of its volumes", node.Name)
+			timer.Stop()
+			delete(d.notReadyTimers, node.Name)
+		}
+		return
+	}
+	if pending {
+		return
+	}
+	delay := d.notReadyTimeout - time.Since(since)
+	if delay < 0 {
+		delay = 0
+	}
+	nodeName := node.Name
+	log.Infof("Node %q is NotReady since %v, volumes will be force detached from its VM in %v if it is powered off",
+		nodeName, since, delay)
+	d.notReadyTimers[nodeName] = time.AfterFunc(delay, func() {
+		ctx, log := logger.GetNewContextWithLogger()
+		d.mutex.Lock()
+		delete(d.notReadyTimers, nodeName)
+		d.mutex.Unlock()
+		vm, err := getNodeVM(ctx, nodeName)
+		if err != nil {
+			log.Warnf("failed to get VM of NotReady node %q to force detach its volumes. err=%v", nodeName, err)
+			return
+		}
+		d.forceDetach(ctx, nodeName, vm)
+	})
+}
+
+// nodeDeleted stops the timer of the node and force detaches the volumes from
+// its VM if it is powered off. vm is nil if the VM of the node wasn't found.
+func (d *lostNodeDetacher) nodeDeleted(ctx context.Context, nodeName string, vm *cnsvsphere.VirtualMachine) {
+	log := logger.GetLogger(ctx)
+	if d.notReadyTimeout == 0 {
+		return
+	}
+	d.mutex.Lock()
+	if timer, pending := d.notReadyTimers[nodeName]; pending {
+		timer.Stop()
+		delete(d.notReadyTimers, nodeName)
+	}
+	d.mutex.Unlock()
+	if vm == nil {
+		log.Infof("VM of deleted node %q wasn't found, its volumes were detached with it", nodeName)
+		return
+	}
+	go d.forceDetach(ctx, nodeName, vm)
+}
+
+// forceDetach detaches the CNS volumes with a VolumeAttachment for the node
+// from its VM if the VM is powered off. Volumes are left attached to VMs still
+// powered on, as they may still be written to, and disks not attached by the
+// driver, such as the ones of other clusters, are never detached. Only the
+// leader replica detaches the volumes.
+func (d *lostNodeDetacher) forceDetach(ctx context.Context, nodeName string, vm *cnsvsphere.VirtualMachine) {
+	log := logger.GetLogger(ctx)
+	if d.isLeader != nil && !d.isLeader() {
+		log.Debugf("Not the leader, leaving force detach of the volumes of node %q to the leader", nodeName)
+		return
+	}
+	var vmMo mo.VirtualMachine
+	pc := property.DefaultCollector(vm.Client())
+	err := pc.RetrieveOne(ctx, vm.Reference(), []string{"runtime.powerState", "config.hardware.device"}, &vmMo)
+	if err != nil {
+		if cnsvsphere.IsManagedObjectNotFound(err, vm.Reference()) {
+			log.Infof("VM %v of node %q is gone, its volumes were detached with it", vm, nodeName)
+			return
+		}
+		log.Errorf("failed to get power state of VM %v of node %q to force detach its volumes. err=%v",
+			vm, nodeName, err)
+		return
+	}
+	if vmMo.Runtime.PowerState != vimtypes.VirtualMachinePowerStatePoweredOff {
+		log.Infof("VM %v of node %q is %s, not force detaching its volumes", vm, nodeName, vmMo.Runtime.PowerState)
+		return
+	}
+	if vmMo.Config == nil {
+		return
+	}
+	if d.attachedVolumes == nil {
+		log.Errorf("can't find the volumes attached to node %q, not force detaching its volumes", nodeName)
+		return
+	}
+	attachedVolumes, err := d.attachedVolumes(ctx, nodeName)
+	if err != nil {
+		log.Errorf("failed to find the volumes attached to node %q to force detach them. err=%v", nodeName, err)
+		return
+	}
+	for _, device := range vmMo.Config.Hardware.Device {
+		disk, ok := device.(*vimtypes.VirtualDisk)
+		if !ok || disk.VDiskId == nil || !attachedVolumes[disk.VDiskId.Id] {
+			continue
+		}
+		volumeID := disk.VDiskId.Id
+		log.Infof("Force detaching volume %q from powered off VM %v of node %q", volumeID, vm, nodeName)
+		if err := d.volumeManager(vm).DetachVolume(ctx, vm, volumeID); err != nil {
+			log.Errorf("failed to force detach volume %q from VM %v of node %q. err=%v", volumeID, vm, nodeName, err)
+			continue
+		}
+		log.Infof("Force detached volume %q from VM %v of node %q", volumeID, vm, nodeName)
+	}
+}
+
+// getAttachedVolumeIDs returns the IDs of the volumes of the driver with a
+// VolumeAttachment for the node, looked up in the volume handle of their PVs.
+func getAttachedVolumeIDs(ctx context.Context, k8sClient clientset.Interface,
+	nodeName string) (map[string]bool, error) {
+	volumeAttachments, err := k8sClient.StorageV1().VolumeAttachments().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	volumeIDs := make(map[string]bool)
+	for _, va := range volumeAttachments.Items {
+		if va.Spec.Attacher != csitypes.Name || va.Spec.NodeName != nodeName {
+			continue
+		}
+		if va.Spec.Source.PersistentVolumeName == nil {
+			continue
+		}
+		pv, err := k8sClient.CoreV1().PersistentVolumes().Get(ctx, *va.Spec.Source.PersistentVolumeName, metav1.GetOptions{})
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		if pv.Spec.CSI != nil && pv.Spec.CSI.Driver == csitypes.Name {
+			volumeIDs[pv.Spec.CSI.VolumeHandle] = true
+		}
+	}
+	return volumeIDs, nil
+}
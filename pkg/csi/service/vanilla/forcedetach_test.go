@@ -0,0 +1,125 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vanilla
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	cnsvsphere "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/vsphere"
+	csitypes "sigs.k8s.io/vsphere-csi-driver/pkg/csi/types"
+)
+
+func newTestNode(name string, ready v1.ConditionStatus, since time.Time) *v1.Node {
+	return &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: v1.NodeStatus{
+			Conditions: []v1.NodeCondition{
+				{Type: v1.NodeReady, Status: ready, LastTransitionTime: metav1.NewTime(since)},
+			},
+		},
+	}
+}
+
+func TestLostNodeDetacherNotReadyTimers(t *testing.T) {
+	d := newLostNodeDetacher(nil, 10)
+	fired := make(chan string, 1)
+	getNodeVM := func(ctx context.Context, nodeName string) (*cnsvsphere.VirtualMachine, error) {
+		fired <- nodeName
+		return nil, errors.New("not found")
+	}
+
+	// A node NotReady for less than the timeout waits for it.
+	d.nodeObserved(ctx, newTestNode("node1", v1.ConditionFalse, time.Now()), getNodeVM)
+	if _, pending := d.notReadyTimers["node1"]; !pending {
+		t.Fatalf("expected force detach of NotReady node1 to be pending")
+	}
+	// And is cancelled once the node is Ready again.
+	d.nodeObserved(ctx, newTestNode("node1", v1.ConditionTrue, time.Now()), getNodeVM)
+	if _, pending := d.notReadyTimers["node1"]; pending {
+		t.Fatalf("expected force detach of Ready node1 to be cancelled")
+	}
+
+	// A node NotReady for longer than the timeout is handled right away.
+	d.nodeObserved(ctx, newTestNode("node2", v1.ConditionUnknown, time.Now().Add(-time.Hour)), getNodeVM)
+	select {
+	case nodeName := <-fired:
+		if nodeName != "node2" {
+			t.Fatalf("expected force detach of node2, got %s", nodeName)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("expected force detach of node2 NotReady for longer than the timeout")
+	}
+
+	// Force detaching is disabled by default.
+	for _, timeout := range []int{0, -1} {
+		d = newLostNodeDetacher(nil, timeout)
+		d.nodeObserved(ctx, newTestNode("node1", v1.ConditionFalse, time.Now().Add(-time.Hour)), getNodeVM)
+		if len(d.notReadyTimers) != 0 {
+			t.Fatalf("expected no force detach with the NotReady timeout set to %d", timeout)
+		}
+	}
+}
+
+func TestGetAttachedVolumeIDs(t *testing.T) {
+	newPV := func(name, driver, volumeHandle string) *v1.PersistentVolume {
+		return &v1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: v1.PersistentVolumeSpec{
+				PersistentVolumeSource: v1.PersistentVolumeSource{
+					CSI: &v1.CSIPersistentVolumeSource{Driver: driver, VolumeHandle: volumeHandle},
+				},
+			},
+		}
+	}
+	newVA := func(name, attacher, nodeName, pvName string) *storagev1.VolumeAttachment {
+		return &storagev1.VolumeAttachment{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: storagev1.VolumeAttachmentSpec{
+				Attacher: attacher,
+				NodeName: nodeName,
+				Source:   storagev1.VolumeAttachmentSource{PersistentVolumeName: &pvName},
+			},
+		}
+	}
+	k8sClient := fake.NewSimpleClientset(
+		newPV("pv-1", csitypes.Name, "vol-1"),
+		newPV("pv-2", csitypes.Name, "vol-2"),
+		newPV("pv-3", "other.csi.driver", "vol-3"),
+		newVA("va-1", csitypes.Name, "node1", "pv-1"),
+		// Attached to another node.
+		newVA("va-2", csitypes.Name, "node2", "pv-2"),
+		// Attached by another driver.
+		newVA("va-3", "other.csi.driver", "node1", "pv-3"),
+		// PV already deleted.
+		newVA("va-4", csitypes.Name, "node1", "pv-4"),
+	)
+	volumeIDs, err := getAttachedVolumeIDs(ctx, k8sClient, "node1")
+	if err != nil {
+		t.Fatalf("failed to get attached volumes: %v", err)
+	}
+	if len(volumeIDs) != 1 || !volumeIDs["vol-1"] {
+		t.Fatalf("expected only vol-1 to be attached to node1, got %v", volumeIDs)
+	}
+}
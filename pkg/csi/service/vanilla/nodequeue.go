@@ -0,0 +1,82 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vanilla
+
+import (
+	"context"
+	"sync"
+)
+
+// nodeOperationQueue runs the attach and detach operations targeting the same
+// node VM one at a time, in the order they were queued, so that their
+// reconfigure tasks don't interleave and fail with concurrent access faults
+// on the VM. Operations on different nodes run in parallel.
+type nodeOperationQueue struct {
+	// mutex protects queues.
+	mutex sync.Mutex
+	// queues has the turns of the operations queued on each node, by node
+	// name. The operation of the first turn is running, and its turn closed.
+	queues map[string][]chan struct{}
+}
+
+// newNodeOperationQueue returns an empty nodeOperationQueue.
+func newNodeOperationQueue() *nodeOperationQueue {
+	return &nodeOperationQueue{queues: make(map[string][]chan struct{})}
+}
+
+// run queues operation on the node, waits for its turn and runs it. The
+// operation isn't run if ctx is done before its turn comes.
+func (q *nodeOperationQueue) run(ctx context.Context, nodeName string, operation func() error) error {
+	turn := make(chan struct{})
+	q.mutex.Lock()
+	if len(q.queues[nodeName]) == 0 {
+		close(turn)
+	}
+	q.queues[nodeName] = append(q.queues[nodeName], turn)
+	q.mutex.Unlock()
+	defer q.done(nodeName, turn)
+
+	select {
+	case <-turn:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return operation()
+}
+
+// done removes the turn from the queue of the node, and gives the next
+// operation queued its turn if the turn was the running one.
+func (q *nodeOperationQueue) done(nodeName string, turn chan struct{}) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	queue := q.queues[nodeName]
+	for i := range queue {
+		if queue[i] != turn {
+			continue
+		}
+		queue = append(queue[:i], queue[i+1:]...)
+		if i == 0 && len(queue) > 0 {
+			close(queue[0])
+		}
+		break
+	}
+	if len(queue) == 0 {
+		delete(q.queues, nodeName)
+		return
+	}
+	q.queues[nodeName] = queue
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vanilla
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNodeOperationQueueOrder(t *testing.T) {
+	q := newNodeOperationQueue()
+	var mutex sync.Mutex
+	var order []int
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+
+	// The first operation blocks the node until released.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_ = q.run(context.Background(), "node1", func() error {
+			<-release
+			mutex.Lock()
+			order = append(order, 0)
+			mutex.Unlock()
+			return nil
+		})
+	}()
+	waitForQueued := func(n int) {
+		for i := 0; i < 1000; i++ {
+			q.mutex.Lock()
+			queued := len(q.queues["node1"])
+			q.mutex.Unlock()
+			if queued == n {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+		t.Fatalf("expected %d operations queued on node1", n)
+	}
+	waitForQueued(1)
+
+	// Operations on other nodes aren't blocked.
+	if err := q.run(context.Background(), "node2", func() error { return nil }); err != nil {
+		t.Fatalf("expected operation on node2 to run, got err: %v", err)
+	}
+
+	// Operations queued on the node run in order once it's released.
+	for i := 1; i <= 3; i++ {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = q.run(context.Background(), "node1", func() error {
+				mutex.Lock()
+				order = append(order, i)
+				mutex.Unlock()
+				return nil
+			})
+		}()
+		waitForQueued(i + 1)
+	}
+
+	// Operations whose context is done give up their turn.
+	cancelledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := q.run(cancelledCtx, "node1", func() error {
+		t.Errorf("expected cancelled operation not to run")
+		return nil
+	}); err == nil {
+		t.Fatalf("expected cancelled operation to fail")
+	}
+
+	close(release)
+	wg.Wait()
+	for i, op := range order {
+		if op != i {
+			t.Fatalf("expected operations to run in order, got %v", order)
+		}
+	}
+	if len(order) != 4 || len(q.queues) != 0 {
+		t.Fatalf("expected all 4 operations to run and the queues to be empty, got %v and %v", order, q.queues)
+	}
+}
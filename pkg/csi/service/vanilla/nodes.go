@@ -20,36 +20,91 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/property"
 	"github.com/vmware/govmomi/vapi/tags"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
 
 	cnsnode "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/node"
+	cnsvolume "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/volume"
 	cnsvsphere "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/vsphere"
+	cnsconfig "sigs.k8s.io/vsphere-csi-driver/pkg/common/config"
 	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/internalapis/cnsnodevminfo"
 	k8s "sigs.k8s.io/vsphere-csi-driver/pkg/kubernetes"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
 )
 
 // Nodes comprises cns node manager and kubernetes informer.
 type Nodes struct {
 	cnsNodeManager cnsnode.Manager
 	informMgr      *k8s.InformerManager
+	// sharedDatastores caches the datastores accessible from all node VMs.
+	sharedDatastores sharedDatastoresCache
+	// lostNodes force detaches volumes from the VMs of deleted and NotReady
+	// nodes, it is nil if Nodes isn't created with newNodes.
+	lostNodes *lostNodeDetacher
+	// enableDiskUUID sets disk.EnableUUID on the VMs of the registered nodes
+	// missing it.
+	enableDiskUUID bool
+	// isLeader returns whether this replica of the controller runs the
+	// background work on the nodes, force detaching volumes and setting
+	// disk.EnableUUID. It is nil if Nodes isn't created with newNodes.
+	isLeader func() bool
+}
+
+// newNodes returns Nodes force detaching volumes from the powered off VMs of
+// deleted nodes, and of nodes NotReady for longer than the configured timeout
+// if one is set,
+// with the volume manager of the vCenter of each VM. Volumes are only force
+// detached, and disk.EnableUUID only set, while isLeader returns true.
+func newNodes(volumeManager func(vm *cnsvsphere.VirtualMachine) cnsvolume.Manager, isLeader func() bool,
+	config *cnsconfig.Config) *Nodes {
+	lostNodes := newLostNodeDetacher(volumeManager, config.Global.NodeNotReadyForceDetachTimeoutInMin)
+	lostNodes.isLeader = isLeader
+	return &Nodes{
+		lostNodes:      lostNodes,
+		enableDiskUUID: config.Global.EnableDiskUUIDRemediation,
+		isLeader:       isLeader,
+	}
 }
 
 // Initialize helps initialize node manager and node informer manager.
 func (nodes *Nodes) Initialize(ctx context.Context) error {
+	log := logger.GetLogger(ctx)
 	nodes.cnsNodeManager = cnsnode.GetManager(ctx)
 	k8sclient, err := k8s.NewClient(ctx)
 	if err != nil {
-		log := logger.GetLogger(ctx)
 		log.Errorf("Creating Kubernetes client failed. Err: %v", err)
 		return err
 	}
 	nodes.cnsNodeManager.SetKubernetesClient(k8sclient)
+	if nodes.lostNodes != nil {
+		nodes.lostNodes.attachedVolumes = func(ctx context.Context, nodeName string) (map[string]bool, error) {
+			return getAttachedVolumeIDs(ctx, k8sclient, nodeName)
+		}
+	}
+	// Node UUIDs mirrored in CnsNodeVMInfo instances only save vCenter searches,
+	// continue without them if the store can't be set up.
+	uuidStore, err := cnsnodevminfo.NewUUIDStore(ctx)
+	if err != nil {
+		log.Warnf("failed to create node UUID store. Err: %v", err)
+	} else if err = nodes.cnsNodeManager.SetUUIDStore(ctx, uuidStore); err != nil {
+		log.Warnf("failed to load node UUIDs from the store. Err: %v", err)
+	}
 	nodes.informMgr = k8s.NewInformer(k8sclient)
 	nodes.informMgr.AddNodeListener(nodes.nodeAdd, nodes.nodeUpdate, nodes.nodeDelete)
 	nodes.informMgr.Listen()
+	for _, vc := range cnsvsphere.GetVirtualCenterManager(ctx).GetAllVirtualCenters() {
+		// ctx is done once initialization completes, the listener runs with
+		// its own context.
+		listenerCtx, _ := logger.GetNewContextWithLogger()
+		go nodes.sharedDatastores.listenForHostChanges(listenerCtx, vc)
+	}
 	return nil
 }
 
@@ -60,9 +115,15 @@ func (nodes *Nodes) nodeAdd(obj interface{}) {
 		log.Warnf("nodeAdd: unrecognized object %+v", obj)
 		return
 	}
-	err := nodes.cnsNodeManager.RegisterNode(ctx, cnsvsphere.GetUUIDFromProviderID(node.Spec.ProviderID), node.Name)
+	nodes.sharedDatastores.invalidate(ctx, fmt.Sprintf("node %q added", node.Name))
+	err := nodes.cnsNodeManager.RegisterNode(ctx, k8s.GetNodeUUID(node), node.Name)
 	if err != nil {
 		log.Warnf("failed to register node:%q. err=%v", node.Name, err)
+	} else {
+		go nodes.remediateDiskUUID(ctx, node.Name)
+	}
+	if nodes.lostNodes != nil {
+		nodes.lostNodes.nodeObserved(ctx, node, nodes.GetNodeByName)
 	}
 }
 
@@ -78,23 +139,45 @@ func (nodes *Nodes) nodeUpdate(oldObj interface{}, newObj interface{}) {
 		log.Warnf("nodeUpdate: unrecognized object oldObj %[1]T%+[1]v", oldObj)
 		return
 	}
-	if oldNode.Spec.ProviderID != newNode.Spec.ProviderID {
-		log.Infof("nodeUpdate: Observed ProviderID change from %q to %q for the node: %q", oldNode.Spec.ProviderID, newNode.Spec.ProviderID, newNode.Name)
+	oldNodeUUID, newNodeUUID := k8s.GetNodeUUID(oldNode), k8s.GetNodeUUID(newNode)
+	if oldNodeUUID != newNodeUUID {
+		log.Infof("nodeUpdate: Observed node UUID change from %q to %q for the node: %q", oldNodeUUID, newNodeUUID, newNode.Name)
+		nodes.sharedDatastores.invalidate(ctx, fmt.Sprintf("node %q updated", newNode.Name))
 
-		err := nodes.cnsNodeManager.RegisterNode(ctx, cnsvsphere.GetUUIDFromProviderID(newNode.Spec.ProviderID), newNode.Name)
+		err := nodes.cnsNodeManager.RegisterNode(ctx, newNodeUUID, newNode.Name)
 		if err != nil {
 			log.Warnf("nodeUpdate: Failed to register node:%q. err=%v", newNode.Name, err)
+		} else {
+			go nodes.remediateDiskUUID(ctx, newNode.Name)
 		}
 	}
+	if nodes.lostNodes != nil {
+		nodes.lostNodes.nodeObserved(ctx, newNode, nodes.GetNodeByName)
+	}
 }
 
 func (nodes *Nodes) nodeDelete(obj interface{}) {
 	ctx, log := logger.GetNewContextWithLogger()
+	// The deletion of the node is still handled if the informer missed it and
+	// only knows the last state of the node.
+	if unknown, ok := obj.(cache.DeletedFinalStateUnknown); ok && unknown.Obj != nil {
+		obj = unknown.Obj
+	}
 	node, ok := obj.(*v1.Node)
 	if node == nil || !ok {
 		log.Warnf("nodeDelete: unrecognized object %+v", obj)
 		return
 	}
+	nodes.sharedDatastores.invalidate(ctx, fmt.Sprintf("node %q deleted", node.Name))
+	if nodes.lostNodes != nil {
+		// The VM of the node can't be found once the node is unregistered.
+		vm, err := nodes.cnsNodeManager.GetNodeByName(ctx, node.Name)
+		if err != nil {
+			log.Infof("failed to get VM of deleted node:%q. err=%v", node.Name, err)
+			vm = nil
+		}
+		nodes.lostNodes.nodeDeleted(ctx, node.Name, vm)
+	}
 	err := nodes.cnsNodeManager.UnregisterNode(ctx, node.Name)
 	if err != nil {
 		log.Warnf("failed to unregister node:%q. err=%v", node.Name, err)
@@ -115,6 +198,13 @@ func (nodes *Nodes) GetAllNodes(ctx context.Context) ([]*cnsvsphere.VirtualMachi
 	return nodes.cnsNodeManager.GetAllNodes(ctx)
 }
 
+// GetAllNodesByName returns VirtualMachine for all registered nodes, keyed by
+// node name. This is called by ListVolumes to report the nodes volumes are
+// published to.
+func (nodes *Nodes) GetAllNodesByName(ctx context.Context) (map[string]*cnsvsphere.VirtualMachine, error) {
+	return nodes.cnsNodeManager.GetAllNodesByName(ctx)
+}
+
 // GetSharedDatastoresInTopology returns shared accessible datastores for
 // specified topologyRequirement along with the map of datastore URL and
 // array of accessibleTopology map for each datastore returned from this
@@ -139,7 +229,10 @@ func (nodes *Nodes) GetAllNodes(ctx context.Context) ([]*cnsvsphere.VirtualMachi
 //      ds:///vmfs/volumes/vsan:524fae1aaca129a5-1ee55a87f26ae626/:
 //         [map[failure-domain.beta.kubernetes.io/region:k8s-region-us failure-domain.beta.kubernetes.io/zone:k8s-zone-us-west]
 //         map[failure-domain.beta.kubernetes.io/region:k8s-region-us failure-domain.beta.kubernetes.io/zone:k8s-zone-us-east]]]]
-func (nodes *Nodes) GetSharedDatastoresInTopology(ctx context.Context, topologyRequirement *csi.TopologyRequirement, tagManager *tags.Manager, zoneCategoryName string, regionCategoryName string) ([]*cnsvsphere.DatastoreInfo, map[string][]map[string]string, error) {
+//
+// The tags of the node VMs are read with the tag manager of their vCenter in
+// tagManagers, keyed by vCenter host.
+func (nodes *Nodes) GetSharedDatastoresInTopology(ctx context.Context, topologyRequirement *csi.TopologyRequirement, tagManagers map[string]*tags.Manager, zoneCategoryName string, regionCategoryName string) ([]*cnsvsphere.DatastoreInfo, map[string][]map[string]string, error) {
 	log := logger.GetLogger(ctx)
 	log.Debugf("GetSharedDatastoresInTopology: called with topologyRequirement: %+v, zoneCategoryName: %s, regionCategoryName: %s", topologyRequirement, zoneCategoryName, regionCategoryName)
 	allNodes, err := nodes.cnsNodeManager.GetAllNodes(ctx)
@@ -158,6 +251,11 @@ func (nodes *Nodes) GetSharedDatastoresInTopology(ctx context.Context, topologyR
 		log.Debugf("getNodesInZoneRegion: called with zoneValue: %s, regionValue: %s", zoneValue, regionValue)
 		var nodeVMsInZoneAndRegion []*cnsvsphere.VirtualMachine
 		for _, nodeVM := range allNodes {
+			tagManager, ok := tagManagers[nodeVM.VirtualCenterHost]
+			if !ok {
+				log.Warnf("No tag manager for vCenter %q of node VM: %v, skipping it", nodeVM.VirtualCenterHost, nodeVM)
+				continue
+			}
 			isNodeInZoneRegion, err := nodeVM.IsInZoneRegion(ctx, zoneCategoryName, regionCategoryName, zoneValue, regionValue, tagManager)
 			if err != nil {
 				log.Errorf("Error checking if node VM: %v belongs to zone [%s] and region [%s]. err: %+v", nodeVM, zoneValue, regionValue, err)
@@ -231,9 +329,15 @@ func (nodes *Nodes) GetSharedDatastoresInTopology(ctx context.Context, topologyR
 }
 
 // GetSharedDatastoresInK8SCluster returns list of DatastoreInfo objects for
-// datastores accessible to all kubernetes nodes in the cluster.
+// datastores accessible to all kubernetes nodes in the cluster. The datastores
+// are cached until nodes or hosts change.
 func (nodes *Nodes) GetSharedDatastoresInK8SCluster(ctx context.Context) ([]*cnsvsphere.DatastoreInfo, error) {
 	log := logger.GetLogger(ctx)
+	sharedDatastores, generation := nodes.sharedDatastores.get()
+	if sharedDatastores != nil {
+		log.Debugf("cached sharedDatastores : %+v", sharedDatastores)
+		return sharedDatastores, nil
+	}
 	nodeVMs, err := nodes.cnsNodeManager.GetAllNodes(ctx)
 	if err != nil {
 		log.Errorf("failed to get Nodes from nodeManager with err %+v", err)
@@ -244,42 +348,36 @@ func (nodes *Nodes) GetSharedDatastoresInK8SCluster(ctx context.Context) ([]*cns
 		log.Errorf(errMsg)
 		return make([]*cnsvsphere.DatastoreInfo, 0), fmt.Errorf(errMsg)
 	}
-	sharedDatastores, err := nodes.GetSharedDatastoresForVMs(ctx, nodeVMs)
+	sharedDatastores, err = nodes.GetSharedDatastoresForVMs(ctx, nodeVMs)
 	if err != nil {
 		log.Errorf("failed to get shared datastores for node VMs. Err: %+v", err)
 		return nil, err
 	}
+	nodes.sharedDatastores.set(sharedDatastores, generation)
 	log.Debugf("sharedDatastores : %+v", sharedDatastores)
 	return sharedDatastores, nil
 }
 
 // GetSharedDatastoresForVMs returns shared datastores accessible to specified
-// nodeVMs list.
+// nodeVMs list. The node VMs can be spread across compute clusters, and move
+// between the hosts of their cluster, so the datastores accessible to a node
+// VM are the ones accessible to all the hosts of its compute resource.
 func (nodes *Nodes) GetSharedDatastoresForVMs(ctx context.Context, nodeVMs []*cnsvsphere.VirtualMachine) ([]*cnsvsphere.DatastoreInfo, error) {
 	var sharedDatastores []*cnsvsphere.DatastoreInfo
 	log := logger.GetLogger(ctx)
-	for _, nodeVM := range nodeVMs {
+	// computeResourceDatastores has the datastores accessible to the compute
+	// resources already seen, by compute resource.
+	computeResourceDatastores := make(map[string][]*cnsvsphere.DatastoreInfo)
+	for i, nodeVM := range nodeVMs {
 		log.Debugf("Getting accessible datastores for node %s", nodeVM.VirtualMachine)
-		accessibleDatastores, err := nodeVM.GetAllAccessibleDatastores(ctx)
+		accessibleDatastores, err := getNodeVMAccessibleDatastores(ctx, nodeVM, computeResourceDatastores)
 		if err != nil {
 			return nil, err
 		}
-		if len(sharedDatastores) == 0 {
+		if i == 0 {
 			sharedDatastores = accessibleDatastores
 		} else {
-			var sharedAccessibleDatastores []*cnsvsphere.DatastoreInfo
-			for _, sharedDs := range sharedDatastores {
-				// Check if sharedDatastores is found in accessibleDatastores.
-				for _, accessibleDs := range accessibleDatastores {
-					// Intersection is performed based on the datastoreUrl as this
-					// uniquely identifies the datastore.
-					if sharedDs.Info.Url == accessibleDs.Info.Url {
-						sharedAccessibleDatastores = append(sharedAccessibleDatastores, sharedDs)
-						break
-					}
-				}
-			}
-			sharedDatastores = sharedAccessibleDatastores
+			sharedDatastores = intersectDatastores(sharedDatastores, accessibleDatastores)
 		}
 		if len(sharedDatastores) == 0 {
 			return nil, fmt.Errorf("no shared datastores found for nodeVm: %+v", nodeVM)
@@ -287,3 +385,111 @@ func (nodes *Nodes) GetSharedDatastoresForVMs(ctx context.Context, nodeVMs []*cn
 	}
 	return sharedDatastores, nil
 }
+
+// getNodeVMAccessibleDatastores returns the datastores accessible to all the
+// hosts of the compute resource of the node VM. computeResourceDatastores
+// caches the datastores of the compute resources across calls. The datastores
+// accessible to the host of the node VM are returned if its compute resource
+// can't be found.
+func getNodeVMAccessibleDatastores(ctx context.Context, nodeVM *cnsvsphere.VirtualMachine,
+	computeResourceDatastores map[string][]*cnsvsphere.DatastoreInfo) ([]*cnsvsphere.DatastoreInfo, error) {
+	log := logger.GetLogger(ctx)
+	computeResource, err := nodeVM.GetComputeResource(ctx)
+	if err != nil {
+		log.Warnf("failed to get compute resource of node %v, using the datastores of its host. err: %v", nodeVM, err)
+		return nodeVM.GetAllAccessibleDatastores(ctx)
+	}
+	key := computeResource.Reference().Value
+	if datastores, ok := computeResourceDatastores[key]; ok {
+		return datastores, nil
+	}
+	hosts, err := computeResource.Hosts(ctx)
+	if err != nil {
+		log.Errorf("failed to get hosts of compute resource %v of node %v. err: %v", computeResource.Reference(), nodeVM, err)
+		return nil, err
+	}
+	hosts, err = getUsableHosts(ctx, computeResource, hosts)
+	if err != nil {
+		log.Errorf("failed to get the state of the hosts of compute resource %v of node %v. err: %v",
+			computeResource.Reference(), nodeVM, err)
+		return nil, err
+	}
+	if len(hosts) == 0 {
+		log.Warnf("no connected hosts out of maintenance mode in compute resource %v of node %v, "+
+			"using the datastores of its host", computeResource.Reference(), nodeVM)
+		return nodeVM.GetAllAccessibleDatastores(ctx)
+	}
+	var datastores []*cnsvsphere.DatastoreInfo
+	for i, host := range hosts {
+		hostDatastores, err := (&cnsvsphere.HostSystem{HostSystem: host}).GetAllAccessibleDatastores(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			datastores = hostDatastores
+		} else {
+			datastores = intersectDatastores(datastores, hostDatastores)
+		}
+	}
+	log.Debugf("Datastores accessible to all hosts of compute resource %v: %+v", computeResource.Reference(), datastores)
+	computeResourceDatastores[key] = datastores
+	return datastores, nil
+}
+
+// getUsableHosts returns the hosts of the compute resource that are connected
+// and not in maintenance mode. The datastores of the other hosts are not known,
+// or no VM runs on them, so they are left out of the shared datastores.
+func getUsableHosts(ctx context.Context, computeResource *object.ComputeResource,
+	hosts []*object.HostSystem) ([]*object.HostSystem, error) {
+	log := logger.GetLogger(ctx)
+	if len(hosts) == 0 {
+		return nil, nil
+	}
+	var hostRefs []types.ManagedObjectReference
+	for _, host := range hosts {
+		hostRefs = append(hostRefs, host.Reference())
+	}
+	var hostMos []mo.HostSystem
+	pc := property.DefaultCollector(computeResource.Client())
+	if err := pc.Retrieve(ctx, hostRefs, []string{"runtime"}, &hostMos); err != nil {
+		return nil, err
+	}
+	usable := make(map[string]bool)
+	for _, hostMo := range hostMos {
+		if isHostUsable(hostMo.Runtime) {
+			usable[hostMo.Reference().Value] = true
+		} else {
+			log.Infof("Leaving host %v out of the shared datastores, connection state: %q, in maintenance mode: %t",
+				hostMo.Reference(), hostMo.Runtime.ConnectionState, hostMo.Runtime.InMaintenanceMode)
+		}
+	}
+	var usableHosts []*object.HostSystem
+	for _, host := range hosts {
+		if usable[host.Reference().Value] {
+			usableHosts = append(usableHosts, host)
+		}
+	}
+	return usableHosts, nil
+}
+
+// isHostUsable returns whether a host with the runtime info is connected and
+// not in maintenance mode.
+func isHostUsable(runtime types.HostRuntimeInfo) bool {
+	return runtime.ConnectionState == types.HostSystemConnectionStateConnected && !runtime.InMaintenanceMode
+}
+
+// intersectDatastores returns the datastores of a also in b. Intersection is
+// performed based on the datastoreUrl as this uniquely identifies the
+// datastore.
+func intersectDatastores(a []*cnsvsphere.DatastoreInfo, b []*cnsvsphere.DatastoreInfo) []*cnsvsphere.DatastoreInfo {
+	var intersection []*cnsvsphere.DatastoreInfo
+	for _, dsA := range a {
+		for _, dsB := range b {
+			if dsA.Info.Url == dsB.Info.Url {
+				intersection = append(intersection, dsA)
+				break
+			}
+		}
+	}
+	return intersection
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vanilla
+
+import (
+	"testing"
+
+	"github.com/vmware/govmomi/vim25/types"
+
+	cnsvsphere "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/vsphere"
+)
+
+func TestIntersectDatastores(t *testing.T) {
+	newDatastore := func(url string) *cnsvsphere.DatastoreInfo {
+		return &cnsvsphere.DatastoreInfo{Info: &types.DatastoreInfo{Url: url}}
+	}
+	// Datastores accessible to the hosts of two compute clusters.
+	cluster1 := []*cnsvsphere.DatastoreInfo{newDatastore("ds:///vmfs/volumes/shared/"),
+		newDatastore("ds:///vmfs/volumes/cluster1/")}
+	cluster2 := []*cnsvsphere.DatastoreInfo{newDatastore("ds:///vmfs/volumes/cluster2/"),
+		newDatastore("ds:///vmfs/volumes/shared/")}
+
+	shared := intersectDatastores(cluster1, cluster2)
+	if len(shared) != 1 || shared[0].Info.Url != "ds:///vmfs/volumes/shared/" {
+		t.Fatalf("expected only the datastore shared by both clusters, got %+v", shared)
+	}
+	if shared := intersectDatastores(cluster1, nil); len(shared) != 0 {
+		t.Fatalf("expected no shared datastores, got %+v", shared)
+	}
+}
+
+func TestIsHostUsable(t *testing.T) {
+	tests := []struct {
+		runtime types.HostRuntimeInfo
+		usable  bool
+	}{
+		{types.HostRuntimeInfo{ConnectionState: types.HostSystemConnectionStateConnected}, true},
+		{types.HostRuntimeInfo{ConnectionState: types.HostSystemConnectionStateDisconnected}, false},
+		{types.HostRuntimeInfo{ConnectionState: types.HostSystemConnectionStateNotResponding}, false},
+		{types.HostRuntimeInfo{ConnectionState: types.HostSystemConnectionStateConnected,
+			InMaintenanceMode: true}, false},
+	}
+	for _, test := range tests {
+		if usable := isHostUsable(test.runtime); usable != test.usable {
+			t.Errorf("expected host with connection state %q and in maintenance mode %t usable %t, got %t",
+				test.runtime.ConnectionState, test.runtime.InMaintenanceMode, test.usable, usable)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+//go:build sanity
+// +build sanity
+
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vanilla
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/kubernetes-csi/csi-test/v4/pkg/sanity"
+	ginkgoconfig "github.com/onsi/ginkgo/config"
+	"github.com/vmware/govmomi/simulator"
+	"google.golang.org/grpc"
+
+	cnsnode "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/node"
+	cnsvsphere "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/vsphere"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/common"
+	csitypes "sigs.k8s.io/vsphere-csi-driver/pkg/csi/types"
+)
+
+// sanityIdentityServer advertises the controller service so that csi-test
+// runs the Controller Service specs against the sanity socket.
+type sanityIdentityServer struct{}
+
+func (s *sanityIdentityServer) GetPluginInfo(ctx context.Context, req *csi.GetPluginInfoRequest) (
+	*csi.GetPluginInfoResponse, error) {
+	return &csi.GetPluginInfoResponse{Name: csitypes.Name, VendorVersion: "sanity"}, nil
+}
+
+func (s *sanityIdentityServer) GetPluginCapabilities(ctx context.Context, req *csi.GetPluginCapabilitiesRequest) (
+	*csi.GetPluginCapabilitiesResponse, error) {
+	return &csi.GetPluginCapabilitiesResponse{
+		Capabilities: []*csi.PluginCapability{
+			{
+				Type: &csi.PluginCapability_Service_{
+					Service: &csi.PluginCapability_Service{
+						Type: csi.PluginCapability_Service_CONTROLLER_SERVICE,
+					},
+				},
+			},
+		},
+	}, nil
+}
+
+func (s *sanityIdentityServer) Probe(ctx context.Context, req *csi.ProbeRequest) (*csi.ProbeResponse, error) {
+	return &csi.ProbeResponse{}, nil
+}
+
+// sanityNodeServer only answers NodeGetInfo, which csi-test calls to find the
+// node to publish volumes to. The node service itself needs a real node to
+// mount on and is not covered by the sanity run.
+type sanityNodeServer struct {
+	csi.UnimplementedNodeServer
+	nodeID string
+}
+
+func (s *sanityNodeServer) NodeGetInfo(ctx context.Context, req *csi.NodeGetInfoRequest) (
+	*csi.NodeGetInfoResponse, error) {
+	return &csi.NodeGetInfoResponse{NodeId: s.nodeID}, nil
+}
+
+func (s *sanityNodeServer) NodeGetCapabilities(ctx context.Context, req *csi.NodeGetCapabilitiesRequest) (
+	*csi.NodeGetCapabilitiesResponse, error) {
+	return &csi.NodeGetCapabilitiesResponse{}, nil
+}
+
+// NodeUnpublishVolume is called by csi-test when it cleans up the volumes of
+// a spec. Nothing is ever published on the sanity node.
+func (s *sanityNodeServer) NodeUnpublishVolume(ctx context.Context, req *csi.NodeUnpublishVolumeRequest) (
+	*csi.NodeUnpublishVolumeResponse, error) {
+	return &csi.NodeUnpublishVolumeResponse{}, nil
+}
+
+// sanityNodeManager only knows the sanity node, so that csi-test can check
+// that volumes are not published to other nodes.
+type sanityNodeManager struct {
+	NodeManagerInterface
+	nodeID string
+}
+
+func (s *sanityNodeManager) GetNodeByName(ctx context.Context, nodeName string) (*cnsvsphere.VirtualMachine, error) {
+	if nodeName != s.nodeID {
+		return nil, cnsnode.ErrNodeNotFound
+	}
+	return s.NodeManagerInterface.GetNodeByName(ctx, nodeName)
+}
+
+// sanitySkips lists the csi-test specs that are not run against vcsim.
+var sanitySkips = []string{
+	// The node service is not served on the sanity socket.
+	"Node Service",
+	// The CNS simulator does not report a NotFound fault for an unknown
+	// volume like vCenter does, and csi-test deletes the volume created twice
+	// by the idempotency spec twice.
+	"DeleteVolume.*should succeed when an invalid volume id is used",
+	"CreateVolume.*already existing name and same capacity",
+	// Snapshots are taken through the vslm endpoint, which vcsim does not
+	// serve.
+	"CreateSnapshot",
+	"ListSnapshots",
+	"DeleteSnapshot",
+	"should create volume from an existing source snapshot",
+	// csi-test gives the volumes of these specs the names of volumes deleted
+	// by earlier specs. The CreateVolume task of a volume name is reused for
+	// an hour, as CSI names of PVCs are never reused.
+	"should create volume from an existing source volume",
+	"volume lifecycle",
+}
+
+// startSanityServer serves the controller of ct on a unix socket in a
+// temporary directory and returns its endpoint. The server is stopped when
+// the test finishes.
+func startSanityServer(t *testing.T, ct *controllerTest, nodeID string) string {
+	dir, err := ioutil.TempDir("", "csi-sanity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	endpoint := filepath.Join(dir, "csi.sock")
+	listener, err := net.Listen("unix", endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := *ct.controller
+	c.nodeMgr = &sanityNodeManager{NodeManagerInterface: c.nodeMgr, nodeID: nodeID}
+	server := grpc.NewServer()
+	csi.RegisterIdentityServer(server, &sanityIdentityServer{})
+	csi.RegisterControllerServer(server, &c)
+	csi.RegisterNodeServer(server, &sanityNodeServer{nodeID: nodeID})
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(func() {
+		server.Stop()
+		os.RemoveAll(dir)
+	})
+	return "unix://" + endpoint
+}
+
+// TestSanity runs the kubernetes-csi sanity suite against the vanilla
+// controller served against the vcsim backed controllerTest instance, over
+// the gRPC socket the way the external sidecars call it.
+func TestSanity(t *testing.T) {
+	ct := getControllerTest(t)
+	nodeID := os.Getenv("VSPHERE_K8S_NODE")
+	if nodeID == "" {
+		nodeID = simulator.Map.Any("VirtualMachine").(*simulator.VirtualMachine).Name
+	}
+	config := sanity.NewTestConfig()
+	config.Address = startSanityServer(t, ct, nodeID)
+	config.TestVolumeSize = 1 * common.GbInBytes
+	config.TestVolumeParameters = make(map[string]string)
+	if v := os.Getenv("VSPHERE_DATASTORE_URL"); v != "" {
+		config.TestVolumeParameters[common.AttributeDatastoreURL] = v
+	}
+	ginkgoconfig.GinkgoConfig.SkipStrings = append(ginkgoconfig.GinkgoConfig.SkipStrings, sanitySkips...)
+	sanity.Test(t, config)
+}
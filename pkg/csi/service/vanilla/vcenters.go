@@ -0,0 +1,325 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vanilla
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	cnstypes "github.com/vmware/govmomi/cns/types"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	cnsvolume "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/volume"
+	cnsvsphere "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/vsphere"
+	cnsconfig "sigs.k8s.io/vsphere-csi-driver/pkg/common/config"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/common/utils"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/common"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
+)
+
+// vCenters holds the managers of the vCenters configured in addition to the
+// one of controller.manager, for Kubernetes clusters spanning several
+// vCenters. The vCenter of controller.manager is the first one of the config
+// secret, in the order of cnsvsphere.GetVcenterIPs.
+type vCenters struct {
+	// lock protects managers.
+	lock sync.RWMutex
+	// managers has the managers of the additional vCenters, by host.
+	managers map[string]*common.Manager
+	// volumeHosts caches the host of the vCenter of the volumes already
+	// looked up, by volume ID.
+	volumeHosts sync.Map
+}
+
+// registerVCenters registers and connects the vCenters of cfg other than the
+// one of c.manager, and unregisters the additional vCenters no longer in cfg.
+// The managers of the vCenters whose host and credentials didn't change are
+// kept.
+func (c *controller) registerVCenters(ctx context.Context, cfg *cnsconfig.Config) error {
+	log := logger.GetLogger(ctx)
+	vcConfigs, err := cnsvsphere.GetVirtualCenterConfigs(ctx, cfg)
+	if err != nil {
+		log.Errorf("failed to get VirtualCenterConfigs. err=%v", err)
+		return err
+	}
+	if c.vcenters == nil {
+		c.vcenters = &vCenters{}
+	}
+	c.vcenters.lock.RLock()
+	oldManagers := c.vcenters.managers
+	c.vcenters.lock.RUnlock()
+
+	managers := make(map[string]*common.Manager)
+	for _, vcConfig := range vcConfigs {
+		if vcConfig.Host == c.manager.VcenterConfig.Host {
+			continue
+		}
+		if manager, ok := oldManagers[vcConfig.Host]; ok &&
+			manager.VcenterConfig.Username == vcConfig.Username &&
+			manager.VcenterConfig.Password == vcConfig.Password {
+			vcenter, err := c.manager.VcenterManager.GetVirtualCenter(ctx, vcConfig.Host)
+			if err == nil {
+				vcenter.Config = vcConfig
+				managers[vcConfig.Host] = &common.Manager{
+					VcenterConfig:  vcConfig,
+					CnsConfig:      cfg,
+					VolumeManager:  manager.VolumeManager,
+					VcenterManager: c.manager.VcenterManager,
+				}
+				continue
+			}
+		}
+		// Drop the vCenter registered with former credentials, or by the
+		// reinitialization of the vCenter singleton.
+		if err := c.manager.VcenterManager.UnregisterVirtualCenter(ctx, vcConfig.Host); err != nil {
+			log.Errorf("failed to unregister vCenter %q. err=%v", vcConfig.Host, err)
+			return err
+		}
+		vcenter, err := c.manager.VcenterManager.RegisterVirtualCenter(ctx, vcConfig)
+		if err != nil {
+			log.Errorf("failed to register vCenter %q with virtualCenterManager. err=%v", vcConfig.Host, err)
+			return err
+		}
+		if err = vcenter.Connect(ctx); err != nil {
+			log.Errorf("failed to connect to vCenter %q. err=%v", vcConfig.Host, err)
+			return err
+		}
+		if err = common.CheckAPI(vcenter.Client.ServiceContent.About.ApiVersion); err != nil {
+			log.Errorf("checkAPI failed for vCenter %q API version: %s, err=%v", vcConfig.Host,
+				vcenter.Client.ServiceContent.About.ApiVersion, err)
+			return err
+		}
+		log.Infof("Registered additional vCenter %q", vcConfig.Host)
+		managers[vcConfig.Host] = &common.Manager{
+			VcenterConfig:  vcConfig,
+			CnsConfig:      cfg,
+			VolumeManager:  cnsvolume.NewManager(ctx, vcenter),
+			VcenterManager: c.manager.VcenterManager,
+		}
+	}
+	for host := range oldManagers {
+		if _, ok := managers[host]; ok || host == c.manager.VcenterConfig.Host {
+			continue
+		}
+		log.Infof("Unregistering vCenter %q removed from the config", host)
+		if err := c.manager.VcenterManager.UnregisterVirtualCenter(ctx, host); err != nil {
+			log.Warnf("failed to unregister vCenter %q. err=%v", host, err)
+		}
+	}
+	c.vcenters.lock.Lock()
+	c.vcenters.managers = managers
+	c.vcenters.lock.Unlock()
+	return nil
+}
+
+// getManagerForHost returns the manager of the vCenter with the given host,
+// or nil if it isn't configured.
+func (c *controller) getManagerForHost(host string) *common.Manager {
+	if host == c.manager.VcenterConfig.Host {
+		return c.manager
+	}
+	if c.vcenters == nil {
+		return nil
+	}
+	c.vcenters.lock.RLock()
+	defer c.vcenters.lock.RUnlock()
+	return c.vcenters.managers[host]
+}
+
+// getAllManagers returns c.manager followed by the managers of the additional
+// vCenters, sorted by host.
+func (c *controller) getAllManagers() []*common.Manager {
+	managers := []*common.Manager{c.manager}
+	if c.vcenters == nil {
+		return managers
+	}
+	c.vcenters.lock.RLock()
+	defer c.vcenters.lock.RUnlock()
+	hosts := make([]string, 0, len(c.vcenters.managers))
+	for host := range c.vcenters.managers {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		managers = append(managers, c.vcenters.managers[host])
+	}
+	return managers
+}
+
+// getManagerForNode returns the manager of the vCenter of the node VM,
+// c.manager if it isn't one of the additional vCenters.
+func (c *controller) getManagerForNode(vm *cnsvsphere.VirtualMachine) *common.Manager {
+	if manager := c.getManagerForHost(vm.VirtualCenterHost); manager != nil {
+		return manager
+	}
+	return c.manager
+}
+
+// getVolumeManagerForNode returns the volume manager of the vCenter of the
+// node VM.
+func (c *controller) getVolumeManagerForNode(vm *cnsvsphere.VirtualMachine) cnsvolume.Manager {
+	return c.getManagerForNode(vm).VolumeManager
+}
+
+// getManagerForVolume returns the manager of the vCenter whose CNS has the
+// volume, or common.ErrNotFound if no vCenter has it. c.manager is returned
+// without querying CNS if a single vCenter is configured.
+func (c *controller) getManagerForVolume(ctx context.Context, volumeID string) (*common.Manager, error) {
+	log := logger.GetLogger(ctx)
+	managers := c.getAllManagers()
+	if len(managers) == 1 {
+		return c.manager, nil
+	}
+	if host, ok := c.vcenters.volumeHosts.Load(volumeID); ok {
+		if manager := c.getManagerForHost(host.(string)); manager != nil {
+			return manager, nil
+		}
+		c.vcenters.volumeHosts.Delete(volumeID)
+	}
+	queryFilter := cnstypes.CnsQueryFilter{
+		VolumeIds: []cnstypes.CnsVolumeId{{Id: volumeID}},
+	}
+	querySelection := utils.QuerySelection(cnstypes.QuerySelectionNameTypeVolumeType)
+	for _, manager := range managers {
+		queryResult, err := utils.QueryVolumeUtil(ctx, manager.VolumeManager, queryFilter, querySelection)
+		if err != nil {
+			log.Errorf("failed to query volume %q in vCenter %q. err=%v", volumeID, manager.VcenterConfig.Host, err)
+			return nil, err
+		}
+		if len(queryResult.Volumes) > 0 {
+			log.Debugf("Volume %q is in vCenter %q", volumeID, manager.VcenterConfig.Host)
+			c.vcenters.volumeHosts.Store(volumeID, manager.VcenterConfig.Host)
+			return manager, nil
+		}
+	}
+	log.Debugf("Volume %q wasn't found in any vCenter", volumeID)
+	return nil, common.ErrNotFound
+}
+
+// getManagerForVolumeError returns the gRPC error of a getManagerForVolume
+// failure for the volume.
+func getManagerForVolumeError(volumeID string, err error) error {
+	if err == common.ErrNotFound {
+		return status.Errorf(codes.NotFound, "volume %q not found in any vCenter", volumeID)
+	}
+	return status.Errorf(codes.Internal, "failed to find the vCenter of volume %q. Error: %+v", volumeID, err)
+}
+
+// volumeCreated records the vCenter of a volume created through manager.
+func (c *controller) volumeCreated(volumeID string, manager *common.Manager) {
+	if c.vcenters != nil && manager != c.manager {
+		c.vcenters.volumeHosts.Store(volumeID, manager.VcenterConfig.Host)
+	}
+}
+
+// volumeDeleted forgets the vCenter of a deleted volume.
+func (c *controller) volumeDeleted(volumeID string) {
+	if c.vcenters != nil {
+		c.vcenters.volumeHosts.Delete(volumeID)
+	}
+}
+
+// getManagerForCreate returns the manager of the vCenter to create a block
+// volume in, and the datastores of sharedDatastores in that vCenter. The
+// vCenter of the source volume of a restored or cloned volume wins, then the
+// vCenter of the StorageClass, then the vCenter of the first shared
+// datastore, which is in the requested topology.
+func (c *controller) getManagerForCreate(ctx context.Context, scParams *common.StorageClassParams,
+	sourceVolumeID string, sharedDatastores []*cnsvsphere.DatastoreInfo) (
+	*common.Manager, []*cnsvsphere.DatastoreInfo, error) {
+	log := logger.GetLogger(ctx)
+	var manager *common.Manager
+	if sourceVolumeID != "" {
+		sourceManager, err := c.getManagerForVolume(ctx, sourceVolumeID)
+		if err != nil {
+			return nil, nil, getManagerForVolumeError(sourceVolumeID, err)
+		}
+		if scParams.VCenter != "" && scParams.VCenter != sourceManager.VcenterConfig.Host {
+			return nil, nil, status.Errorf(codes.InvalidArgument,
+				"volume %q is in vCenter %q, not in vCenter %q of the StorageClass",
+				sourceVolumeID, sourceManager.VcenterConfig.Host, scParams.VCenter)
+		}
+		manager = sourceManager
+	} else if scParams.VCenter != "" {
+		manager = c.getManagerForHost(scParams.VCenter)
+		if manager == nil {
+			return nil, nil, status.Errorf(codes.InvalidArgument,
+				"vCenter %q of the StorageClass isn't in the vsphere config secret", scParams.VCenter)
+		}
+	}
+	if len(c.getAllManagers()) == 1 {
+		return c.manager, sharedDatastores, nil
+	}
+	if manager == nil {
+		if len(sharedDatastores) == 0 {
+			return c.manager, sharedDatastores, nil
+		}
+		host := getDatastoreVCenterHost(sharedDatastores[0])
+		if manager = c.getManagerForHost(host); manager == nil {
+			return nil, nil, status.Errorf(codes.Internal,
+				"vCenter %q of datastore %q isn't in the vsphere config secret", host, sharedDatastores[0].Info.Url)
+		}
+	}
+	var datastores []*cnsvsphere.DatastoreInfo
+	for _, datastore := range sharedDatastores {
+		if getDatastoreVCenterHost(datastore) == manager.VcenterConfig.Host {
+			datastores = append(datastores, datastore)
+		}
+	}
+	if len(datastores) == 0 {
+		return nil, nil, status.Errorf(codes.NotFound,
+			"no shared datastores of vCenter %q found in the topology of the volume", manager.VcenterConfig.Host)
+	}
+	log.Debugf("Creating volume in vCenter %q on datastores %+v", manager.VcenterConfig.Host, datastores)
+	return manager, datastores, nil
+}
+
+// getDatastoreVCenterHost returns the host of the vCenter the datastore was
+// retrieved from, or an empty string if it isn't known.
+func getDatastoreVCenterHost(datastore *cnsvsphere.DatastoreInfo) string {
+	if datastore.Datacenter != nil {
+		return datastore.Datacenter.VirtualCenterHost
+	}
+	if datastore.Client() == nil {
+		return ""
+	}
+	return datastore.Client().URL().Hostname()
+}
+
+// getVolumeIDs returns the IDs of the volumes of the cluster in the CNS of all
+// the vCenters.
+func (c *controller) getVolumeIDs(ctx context.Context) (map[string]bool, error) {
+	log := logger.GetLogger(ctx)
+	volumeIDs := make(map[string]bool)
+	for _, manager := range c.getAllManagers() {
+		queryFilter := cnstypes.CnsQueryFilter{
+			ContainerClusterIds: []string{manager.CnsConfig.Global.ClusterID},
+		}
+		querySelection := utils.QuerySelection(cnstypes.QuerySelectionNameTypeVolumeType)
+		queryResult, err := utils.QueryVolumeUtil(ctx, manager.VolumeManager, queryFilter, querySelection)
+		if err != nil {
+			log.Errorf("failed to query the volumes in vCenter %q. err=%v", manager.VcenterConfig.Host, err)
+			return nil, err
+		}
+		for _, volume := range queryResult.Volumes {
+			volumeIDs[volume.VolumeId.Id] = true
+		}
+	}
+	return volumeIDs, nil
+}
@@ -0,0 +1,233 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vanilla
+
+import (
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/google/uuid"
+	cnstypes "github.com/vmware/govmomi/cns/types"
+	"github.com/vmware/govmomi/vim25/types"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	cnsvsphere "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/vsphere"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/common/unittestcommon"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/common"
+)
+
+const testSecondVCenterHost = "vc2.example.com"
+
+// getControllerWithTwoVCenters returns a controller with fake volume managers
+// for the vCenter of the simulator and for an additional vCenter.
+func getControllerWithTwoVCenters(t *testing.T) (*controller, *unittestcommon.FakeVolumeManager,
+	*unittestcommon.FakeVolumeManager) {
+	c, volumeManager := getControllerWithFakeVolumeManager(t)
+	secondVolumeManager := unittestcommon.NewFakeVolumeManager()
+	c.vcenters = &vCenters{
+		managers: map[string]*common.Manager{
+			testSecondVCenterHost: {
+				VcenterConfig:  &cnsvsphere.VirtualCenterConfig{Host: testSecondVCenterHost},
+				CnsConfig:      c.manager.CnsConfig,
+				VolumeManager:  secondVolumeManager,
+				VcenterManager: c.manager.VcenterManager,
+			},
+		},
+	}
+	return c, volumeManager, secondVolumeManager
+}
+
+// createFakeBlockVolume creates a block volume of the cluster of c with the
+// volume manager.
+func createFakeBlockVolume(t *testing.T, c *controller, volumeManager *unittestcommon.FakeVolumeManager) string {
+	volumeInfo, err := volumeManager.CreateVolume(ctx, &cnstypes.CnsVolumeCreateSpec{
+		Name:       testVolumeName + "-" + uuid.New().String(),
+		VolumeType: common.BlockVolumeType,
+		Metadata: cnstypes.CnsVolumeMetadata{
+			ContainerCluster: cnstypes.CnsContainerCluster{ClusterId: c.manager.CnsConfig.Global.ClusterID},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return volumeInfo.VolumeID.Id
+}
+
+func TestGetManagerForVolume(t *testing.T) {
+	c, volumeManager, secondVolumeManager := getControllerWithTwoVCenters(t)
+	firstVolumeID := createFakeBlockVolume(t, c, volumeManager)
+	secondVolumeID := createFakeBlockVolume(t, c, secondVolumeManager)
+
+	for volumeID, host := range map[string]string{
+		firstVolumeID:  c.manager.VcenterConfig.Host,
+		secondVolumeID: testSecondVCenterHost,
+	} {
+		manager, err := c.getManagerForVolume(ctx, volumeID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if manager.VcenterConfig.Host != host {
+			t.Errorf("expected volume %q in vCenter %q, got %q", volumeID, host, manager.VcenterConfig.Host)
+		}
+	}
+
+	// Volumes in no vCenter aren't looked up in the default vCenter.
+	if _, err := c.getManagerForVolume(ctx, "unknown"); err != common.ErrNotFound {
+		t.Errorf("expected an unknown volume to fail with %v, got %v", common.ErrNotFound, err)
+	}
+	_, err := c.ControllerExpandVolume(ctx, &csi.ControllerExpandVolumeRequest{
+		VolumeId:      "unknown",
+		CapacityRange: &csi.CapacityRange{RequiredBytes: common.GbInBytes},
+	})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("expected expanding an unknown volume to fail with code NotFound, got %v", err)
+	}
+
+	// Volumes are deleted in the CNS of their vCenter, and their vCenter is
+	// forgotten.
+	if _, err := c.DeleteVolume(ctx, &csi.DeleteVolumeRequest{VolumeId: secondVolumeID}); err != nil {
+		t.Fatal(err)
+	}
+	if secondVolumeManager.GetVolume(secondVolumeID) != nil {
+		t.Errorf("expected volume %q to be deleted from vCenter %q", secondVolumeID, testSecondVCenterHost)
+	}
+	if volumeManager.GetVolume(firstVolumeID) == nil {
+		t.Errorf("expected volume %q to be kept", firstVolumeID)
+	}
+	if _, ok := c.vcenters.volumeHosts.Load(secondVolumeID); ok {
+		t.Errorf("expected the vCenter of deleted volume %q to be forgotten", secondVolumeID)
+	}
+	if _, err := c.DeleteVolume(ctx, &csi.DeleteVolumeRequest{VolumeId: secondVolumeID}); err != nil {
+		t.Errorf("expected deleting a volume in no vCenter to succeed, got %v", err)
+	}
+}
+
+func TestGetManagerForNode(t *testing.T) {
+	c, _, secondVolumeManager := getControllerWithTwoVCenters(t)
+	vm := &cnsvsphere.VirtualMachine{VirtualCenterHost: testSecondVCenterHost}
+	if c.getVolumeManagerForNode(vm) != secondVolumeManager {
+		t.Errorf("expected the volume manager of vCenter %q for VM %v", testSecondVCenterHost, vm)
+	}
+	vm = &cnsvsphere.VirtualMachine{VirtualCenterHost: "unknown"}
+	if c.getManagerForNode(vm) != c.manager {
+		t.Errorf("expected the default manager for VM %v", vm)
+	}
+}
+
+func TestGetManagerForCreate(t *testing.T) {
+	c, _, secondVolumeManager := getControllerWithTwoVCenters(t)
+	newDatastore := func(host string, url string) *cnsvsphere.DatastoreInfo {
+		return &cnsvsphere.DatastoreInfo{
+			Datastore: &cnsvsphere.Datastore{Datacenter: &cnsvsphere.Datacenter{VirtualCenterHost: host}},
+			Info:      &types.DatastoreInfo{Url: url},
+		}
+	}
+	firstDatastore := newDatastore(c.manager.VcenterConfig.Host, "ds:///vmfs/volumes/first/")
+	secondDatastore := newDatastore(testSecondVCenterHost, "ds:///vmfs/volumes/second/")
+
+	// Volumes are created in the vCenter of the first shared datastore by default.
+	for _, test := range []struct {
+		scParams         *common.StorageClassParams
+		sharedDatastores []*cnsvsphere.DatastoreInfo
+		host             string
+		datastore        *cnsvsphere.DatastoreInfo
+	}{
+		{&common.StorageClassParams{}, []*cnsvsphere.DatastoreInfo{firstDatastore, secondDatastore},
+			c.manager.VcenterConfig.Host, firstDatastore},
+		{&common.StorageClassParams{}, []*cnsvsphere.DatastoreInfo{secondDatastore, firstDatastore},
+			testSecondVCenterHost, secondDatastore},
+		{&common.StorageClassParams{VCenter: testSecondVCenterHost},
+			[]*cnsvsphere.DatastoreInfo{firstDatastore, secondDatastore}, testSecondVCenterHost, secondDatastore},
+	} {
+		manager, datastores, err := c.getManagerForCreate(ctx, test.scParams, "", test.sharedDatastores)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if manager.VcenterConfig.Host != test.host || len(datastores) != 1 || datastores[0] != test.datastore {
+			t.Errorf("expected vCenter %q and datastore %s for %+v, got vCenter %q and datastores %v", test.host,
+				test.datastore.Info.Url, test.scParams, manager.VcenterConfig.Host, datastores)
+		}
+	}
+
+	_, _, err := c.getManagerForCreate(ctx, &common.StorageClassParams{VCenter: "unknown"}, "",
+		[]*cnsvsphere.DatastoreInfo{firstDatastore})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected an unknown vCenter to fail with code InvalidArgument, got %v", err)
+	}
+	_, _, err = c.getManagerForCreate(ctx, &common.StorageClassParams{VCenter: testSecondVCenterHost}, "",
+		[]*cnsvsphere.DatastoreInfo{firstDatastore})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("expected a vCenter without shared datastores to fail with code NotFound, got %v", err)
+	}
+
+	// Clones are created in the vCenter of their source volume.
+	sourceVolumeID := createFakeBlockVolume(t, c, secondVolumeManager)
+	_, _, err = c.getManagerForCreate(ctx, &common.StorageClassParams{VCenter: c.manager.VcenterConfig.Host},
+		sourceVolumeID, []*cnsvsphere.DatastoreInfo{firstDatastore, secondDatastore})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected a vCenter other than the one of the source volume to fail with code InvalidArgument, got %v",
+			err)
+	}
+}
+
+func TestListVolumesInTwoVCenters(t *testing.T) {
+	c, volumeManager, secondVolumeManager := getControllerWithTwoVCenters(t)
+	listed := map[string]bool{
+		createFakeBlockVolume(t, c, volumeManager):       true,
+		createFakeBlockVolume(t, c, secondVolumeManager): true,
+		createFakeBlockVolume(t, c, secondVolumeManager): true,
+	}
+	seen := make(map[string]bool)
+	token := ""
+	for pages := 0; ; pages++ {
+		if pages > len(listed) {
+			t.Fatalf("ListVolumes didn't stop paging, listed %d volumes", len(seen))
+		}
+		page, err := c.ListVolumes(ctx, &csi.ListVolumesRequest{MaxEntries: 1, StartingToken: token})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, entry := range page.Entries {
+			if seen[entry.Volume.VolumeId] || !listed[entry.Volume.VolumeId] {
+				t.Fatalf("unexpected volume %s in page %d", entry.Volume.VolumeId, pages)
+			}
+			seen[entry.Volume.VolumeId] = true
+		}
+		if token = page.NextToken; token == "" {
+			break
+		}
+	}
+	if len(seen) != len(listed) {
+		t.Fatalf("expected %d volumes to be listed, got %d", len(listed), len(seen))
+	}
+
+	resp, err := c.ListVolumes(ctx, &csi.ListVolumesRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Entries) != len(listed) || resp.NextToken != "" {
+		t.Errorf("expected %d volumes without a next token, got %d and token %q", len(listed), len(resp.Entries),
+			resp.NextToken)
+	}
+	for _, token := range []string{"2:0", "0:1", "-1", "1:x"} {
+		if _, err := c.ListVolumes(ctx, &csi.ListVolumesRequest{StartingToken: token}); status.Code(err) !=
+			codes.Aborted {
+			t.Errorf("expected starting token %q to fail with code Aborted, got %v", token, err)
+		}
+	}
+}
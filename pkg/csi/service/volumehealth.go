@@ -0,0 +1,356 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/akutz/gofsutil"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/kubernetes/pkg/volume/util/fs"
+
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/common"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/common/commonco"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
+	csitypes "sigs.k8s.io/vsphere-csi-driver/pkg/csi/types"
+)
+
+const (
+	// defaultNodeVolumeHealthInterval is the default interval between two
+	// checks of the volumes published on the node.
+	defaultNodeVolumeHealthInterval = time.Minute
+	// nodeVolumeHealthCheckTimeout is the time a check of a volume can take
+	// before the volume is reported as not responding, such as when its NFS
+	// server is down.
+	nodeVolumeHealthCheckTimeout = 10 * time.Second
+	// healthCheckFilePrefix is the prefix of the file created and removed in
+	// the volumes to check that their filesystem is writable, when the write
+	// probe is enabled.
+	healthCheckFilePrefix = ".vsphere-csi-health-check"
+)
+
+// nodeVolumeHealth checks the volumes published on the node, it is nil if the
+// node-volume-health feature is disabled.
+var nodeVolumeHealth *nodeVolumeHealthChecker
+
+// checkedVolumeKey identifies a publication of a volume on the node, a
+// volume can be published at several target paths, such as for pods sharing
+// a file volume.
+type checkedVolumeKey struct {
+	volumeID string
+	path     string
+}
+
+// checkedVolume is a volume published on the node checked by the
+// nodeVolumeHealthChecker.
+type checkedVolume struct {
+	// readOnly is set for the volumes published read-only, whose filesystem
+	// isn't checked to be writable.
+	readOnly bool
+	// condition is the result of the latest check, nil until the volume is
+	// checked.
+	condition *csi.VolumeCondition
+	// reportedAbnormal is set once an event is recorded on the node for the
+	// volume being abnormal, until one is recorded for its recovery.
+	reportedAbnormal bool
+	// checking is set while a check of the volume is running, a check stuck
+	// on an unresponsive filesystem isn't started again.
+	checking bool
+}
+
+// nodeVolumeHealthChecker periodically checks that the volumes published on
+// the node are still reachable: their path is mounted, their device is
+// present, their filesystem responds and, if the write probe is enabled, is
+// writable. The condition of the volumes is returned by NodeGetVolumeStats,
+// and events are recorded on the node when volumes become abnormal or
+// recover.
+type nodeVolumeHealthChecker struct {
+	// nodeName is the name of the node the events are recorded on.
+	nodeName string
+	// lock protects volumes.
+	lock sync.Mutex
+	// volumes has the volumes published on the node, by volume ID and path.
+	volumes map[checkedVolumeKey]*checkedVolume
+	// timeout is the time a check of a volume can take.
+	timeout time.Duration
+	// writeProbe is set to check that the filesystems of the volumes
+	// published read-write are writable.
+	writeProbe bool
+}
+
+// newNodeVolumeHealthChecker returns a nodeVolumeHealthChecker for the node
+// with the given name.
+func newNodeVolumeHealthChecker(nodeName string, writeProbe bool) *nodeVolumeHealthChecker {
+	return &nodeVolumeHealthChecker{
+		nodeName:   nodeName,
+		volumes:    make(map[checkedVolumeKey]*checkedVolume),
+		timeout:    nodeVolumeHealthCheckTimeout,
+		writeProbe: writeProbe,
+	}
+}
+
+// getNodeVolumeHealthInterval returns the duration set with the env variable
+// X_CSI_NODE_VOLUME_HEALTH_INTERVAL, or the default one.
+func getNodeVolumeHealthInterval(ctx context.Context) time.Duration {
+	log := logger.GetLogger(ctx)
+	interval := defaultNodeVolumeHealthInterval
+	if v := os.Getenv(csitypes.EnvVarNodeVolumeHealthInterval); v != "" {
+		if value, err := time.ParseDuration(v); err != nil || value <= 0 {
+			log.Warnf("Invalid value set for env variable %s: %v. Using default value.",
+				csitypes.EnvVarNodeVolumeHealthInterval, v)
+		} else {
+			interval = value
+		}
+	}
+	return interval
+}
+
+// getNodeVolumeHealthWriteProbe returns whether the env variable
+// X_CSI_NODE_VOLUME_HEALTH_WRITE_PROBE enables the write probe, disabled by
+// default.
+func getNodeVolumeHealthWriteProbe(ctx context.Context) bool {
+	log := logger.GetLogger(ctx)
+	v := os.Getenv(csitypes.EnvVarNodeVolumeHealthWriteProbe)
+	if v == "" {
+		return false
+	}
+	enabled, err := strconv.ParseBool(v)
+	if err != nil {
+		log.Warnf("Invalid value set for env variable %s: %v. Disabling the write probe.",
+			csitypes.EnvVarNodeVolumeHealthWriteProbe, v)
+		return false
+	}
+	return enabled
+}
+
+// run checks the volumes every interval until ctx is done.
+func (c *nodeVolumeHealthChecker) run(ctx context.Context, interval time.Duration) {
+	log := logger.GetLogger(ctx)
+	log.Infof("Checking the health of the volumes published on the node every %v", interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.checkAll(ctx)
+		}
+	}
+}
+
+// track starts checking the volume published at path, if it isn't checked
+// yet.
+func (c *nodeVolumeHealthChecker) track(volumeID string, path string, readOnly bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	key := checkedVolumeKey{volumeID: volumeID, path: path}
+	if _, ok := c.volumes[key]; ok {
+		return
+	}
+	c.volumes[key] = &checkedVolume{readOnly: readOnly}
+}
+
+// trackMounted starts checking the volume published at path, if it isn't
+// checked yet, as read-only if path is mounted read-only. It is used for the
+// volumes published before the node plugin restarted.
+func (c *nodeVolumeHealthChecker) trackMounted(ctx context.Context, volumeID string, path string) {
+	c.lock.Lock()
+	_, ok := c.volumes[checkedVolumeKey{volumeID: volumeID, path: path}]
+	c.lock.Unlock()
+	if ok {
+		return
+	}
+	mnts, err := nodeMounter.GetMounts(ctx)
+	if err != nil {
+		return
+	}
+	for _, m := range mnts {
+		if m.Path == path {
+			c.track(volumeID, path, contains(m.Opts, "ro"))
+			return
+		}
+	}
+}
+
+// untrack stops checking the volume published at path.
+func (c *nodeVolumeHealthChecker) untrack(volumeID string, path string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.volumes, checkedVolumeKey{volumeID: volumeID, path: path})
+}
+
+// getCondition returns the condition of the volume published at path from
+// its latest check, or nil if it isn't checked yet.
+func (c *nodeVolumeHealthChecker) getCondition(volumeID string, path string) *csi.VolumeCondition {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if vol, ok := c.volumes[checkedVolumeKey{volumeID: volumeID, path: path}]; ok {
+		return vol.condition
+	}
+	return nil
+}
+
+// checkAll checks the volumes in parallel, waiting up to the timeout for the
+// checks to finish, and records events on the node for the volumes whose
+// condition changed. The volumes whose check doesn't finish in time are not
+// responding.
+func (c *nodeVolumeHealthChecker) checkAll(ctx context.Context) {
+	log := logger.GetLogger(ctx)
+	mnts, err := nodeMounter.GetMounts(ctx)
+	if err != nil {
+		log.Errorf("failed to get the mounts of the node. Err: %v", err)
+		return
+	}
+	mounts := make(map[string]gofsutil.Info, len(mnts))
+	for _, m := range mnts {
+		mounts[m.Path] = m
+	}
+
+	var wg sync.WaitGroup
+	c.lock.Lock()
+	for key, vol := range c.volumes {
+		if vol.checking {
+			// Don't pile up checks stuck on an unresponsive filesystem.
+			continue
+		}
+		vol.checking = true
+		mnt, mounted := mounts[key.path]
+		wg.Add(1)
+		go func(key checkedVolumeKey, vol *checkedVolume) {
+			defer wg.Done()
+			condition, published := checkVolume(key.path, mnt, mounted, c.writeProbe && !vol.readOnly)
+			c.lock.Lock()
+			defer c.lock.Unlock()
+			vol.checking = false
+			vol.condition = condition
+			if !published && c.volumes[key] == vol {
+				// The volume was unpublished without NodeUnpublishVolume
+				// being called on this instance of the node plugin.
+				delete(c.volumes, key)
+			}
+		}(key, vol)
+	}
+	c.lock.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(c.timeout):
+	}
+	c.lock.Lock()
+	for key, vol := range c.volumes {
+		if vol.checking {
+			vol.condition = abnormalCondition("volume at %s is not responding", key.path)
+		}
+	}
+	c.lock.Unlock()
+	c.recordConditionChanges(ctx)
+}
+
+// recordConditionChanges records an event on the node for each volume that
+// became abnormal or recovered since the previous check.
+func (c *nodeVolumeHealthChecker) recordConditionChanges(ctx context.Context) {
+	log := logger.GetLogger(ctx)
+	type conditionChange struct {
+		eventType string
+		reason    string
+		message   string
+	}
+	var changes []conditionChange
+	c.lock.Lock()
+	for key, vol := range c.volumes {
+		if vol.condition == nil || vol.condition.Abnormal == vol.reportedAbnormal {
+			continue
+		}
+		vol.reportedAbnormal = vol.condition.Abnormal
+		if vol.condition.Abnormal {
+			log.Warnf("volume %q at %s is abnormal: %s", key.volumeID, key.path, vol.condition.Message)
+			changes = append(changes, conditionChange{v1.EventTypeWarning, common.EventReasonVolumeAbnormal,
+				fmt.Sprintf("Volume %s at %s is abnormal: %s", key.volumeID, key.path, vol.condition.Message)})
+		} else {
+			log.Infof("volume %q at %s recovered", key.volumeID, key.path)
+			changes = append(changes, conditionChange{v1.EventTypeNormal, common.EventReasonVolumeRecovered,
+				fmt.Sprintf("Volume %s at %s is healthy again", key.volumeID, key.path)})
+		}
+	}
+	c.lock.Unlock()
+	if c.nodeName == "" || commonco.ContainerOrchestratorUtility == nil {
+		return
+	}
+	for _, change := range changes {
+		commonco.ContainerOrchestratorUtility.RecordNodeEvent(ctx, c.nodeName, change.eventType, change.reason,
+			change.message)
+	}
+}
+
+// checkVolume returns the condition of the volume published at path, mounted
+// from mnt if mounted is set, and false if the volume isn't published anymore.
+// The filesystem is only checked to be writable if writeProbe is set, other
+// checks don't write to the volume.
+var checkVolume = func(path string, mnt gofsutil.Info, mounted bool, writeProbe bool) (*csi.VolumeCondition, bool) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil, false
+	}
+	if err != nil {
+		return abnormalCondition("failed to access volume at %s: %v", path, err), true
+	}
+	if !mounted {
+		return abnormalCondition("volume at %s is not mounted", path), true
+	}
+	if strings.HasPrefix(mnt.Device, devDir+"/") {
+		if _, err := os.Stat(mnt.Device); err != nil {
+			return abnormalCondition("device %s of volume at %s is missing: %v", mnt.Device, path, err), true
+		}
+	}
+	if !info.IsDir() {
+		// Raw block volume
+		return &csi.VolumeCondition{Message: "volume is healthy"}, true
+	}
+	if _, _, _, _, _, _, err := fs.FsInfo(path); err != nil {
+		return abnormalCondition("failed to get the filesystem stats of volume at %s: %v", path, err), true
+	}
+	if writeProbe {
+		file, err := ioutil.TempFile(path, healthCheckFilePrefix)
+		if err != nil {
+			return abnormalCondition("filesystem of volume at %s is not writable: %v", path, err), true
+		}
+		file.Close()
+		if err := os.Remove(file.Name()); err != nil {
+			return abnormalCondition("filesystem of volume at %s is not writable: %v", path, err), true
+		}
+	}
+	return &csi.VolumeCondition{Message: "volume is healthy"}, true
+}
+
+// abnormalCondition returns an abnormal condition with the formatted message.
+func abnormalCondition(format string, args ...interface{}) *csi.VolumeCondition {
+	return &csi.VolumeCondition{Abnormal: true, Message: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,207 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/akutz/gofsutil"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+
+	"sigs.k8s.io/vsphere-csi-driver/pkg/common/unittestcommon"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/common"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/common/commonco"
+)
+
+// TestNodeVolumeHealthCheckAll checks the conditions of the volumes, by
+// volume ID and path, and the events recorded on the node when they change.
+func TestNodeVolumeHealthCheckAll(t *testing.T) {
+	ctx := context.Background()
+	layout, mounter := newFakeNode(t)
+	fakeCO, err := unittestcommon.GetFakeContainerOrchestratorInterface(common.Kubernetes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	origCO := commonco.ContainerOrchestratorUtility
+	commonco.ContainerOrchestratorUtility = fakeCO
+	defer func() {
+		commonco.ContainerOrchestratorUtility = origCO
+	}()
+
+	healthyDev := layout.attachDisk(t, "1", "sdb")
+	missingDev := layout.attachDisk(t, "2", "sdc")
+	healthy := layout.mkdir(t, "healthy")
+	missing := layout.mkdir(t, "missing")
+	unmounted := layout.mkdir(t, "unmounted")
+	unpublished := layout.mkdir(t, "unpublished")
+	shared := layout.mkdir(t, "shared")
+	mounter.addMount(healthyDev, healthy, healthyDev, "ext4", nil)
+	mounter.addMount(missingDev, missing, missingDev, "ext4", nil)
+	mounter.addMount("nfs-server:/share", unpublished, "nfs-server:/share", "nfs4", nil)
+	if err := os.Remove(missingDev); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(unpublished); err != nil {
+		t.Fatal(err)
+	}
+
+	checker := newNodeVolumeHealthChecker("node1", true)
+	checker.track("healthy", healthy, false)
+	checker.track("missing", missing, false)
+	checker.track("unmounted", unmounted, false)
+	checker.track("unpublished", unpublished, false)
+	// The healthy volume is also published at a path that isn't mounted.
+	checker.track("healthy", shared, false)
+	if checker.getCondition("healthy", healthy) != nil {
+		t.Error("expected no condition before the volume is checked")
+	}
+	checker.checkAll(ctx)
+
+	for key, abnormal := range map[checkedVolumeKey]bool{
+		{volumeID: "healthy", path: healthy}:     false,
+		{volumeID: "healthy", path: shared}:      true,
+		{volumeID: "missing", path: missing}:     true,
+		{volumeID: "unmounted", path: unmounted}: true,
+	} {
+		condition := checker.getCondition(key.volumeID, key.path)
+		if condition == nil || condition.Abnormal != abnormal {
+			t.Errorf("expected volume %q at %s abnormal %v, got %v", key.volumeID, key.path, abnormal, condition)
+		}
+	}
+	if _, ok := checker.volumes[checkedVolumeKey{volumeID: "unpublished", path: unpublished}]; ok {
+		t.Error("expected the unpublished volume not to be checked anymore")
+	}
+	files, err := ioutil.ReadDir(healthy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Errorf("expected the health check file to be removed, got %v", files)
+	}
+	fake := fakeCO.(*unittestcommon.FakeK8SOrchestrator)
+	expectEvents := func(expected ...string) {
+		t.Helper()
+		events := fake.GetNodeEvents("node1")
+		counts := make(map[string]int)
+		for _, reason := range events {
+			counts[reason]++
+		}
+		expectedCounts := make(map[string]int)
+		for _, reason := range expected {
+			expectedCounts[reason]++
+		}
+		if len(events) != len(expected) || !reflect.DeepEqual(counts, expectedCounts) {
+			t.Errorf("expected node events %v, got %v", expected, events)
+		}
+	}
+	expectEvents(common.EventReasonVolumeAbnormal, common.EventReasonVolumeAbnormal,
+		common.EventReasonVolumeAbnormal)
+
+	// Events are only recorded when the condition of a volume changes.
+	checker.untrack("missing", missing)
+	checker.untrack("unmounted", unmounted)
+	checker.checkAll(ctx)
+	expectEvents(common.EventReasonVolumeAbnormal, common.EventReasonVolumeAbnormal,
+		common.EventReasonVolumeAbnormal)
+	mounter.addMount(healthyDev, shared, healthyDev, "ext4", nil)
+	checker.checkAll(ctx)
+	expectEvents(common.EventReasonVolumeAbnormal, common.EventReasonVolumeAbnormal,
+		common.EventReasonVolumeAbnormal, common.EventReasonVolumeRecovered)
+}
+
+// TestNodeVolumeHealthWriteProbe checks that the volumes are only written to
+// when the write probe is enabled, and never when published read-only.
+func TestNodeVolumeHealthWriteProbe(t *testing.T) {
+	ctx := context.Background()
+	var writeProbes []bool
+	origCheckVolume := checkVolume
+	checkVolume = func(path string, mnt gofsutil.Info, mounted bool, writeProbe bool) (*csi.VolumeCondition, bool) {
+		writeProbes = append(writeProbes, writeProbe)
+		return &csi.VolumeCondition{Message: "volume is healthy"}, true
+	}
+	defer func() {
+		checkVolume = origCheckVolume
+	}()
+	newFakeNode(t)
+
+	for _, test := range []struct {
+		writeProbe bool
+		readOnly   bool
+		expected   bool
+	}{
+		{writeProbe: false, readOnly: false, expected: false},
+		{writeProbe: true, readOnly: false, expected: true},
+		{writeProbe: true, readOnly: true, expected: false},
+	} {
+		writeProbes = nil
+		checker := newNodeVolumeHealthChecker("", test.writeProbe)
+		checker.track("volume", "/target", test.readOnly)
+		checker.checkAll(ctx)
+		if len(writeProbes) != 1 || writeProbes[0] != test.expected {
+			t.Errorf("expected write probe %v with write probe enabled %v and read-only %v, got %v",
+				test.expected, test.writeProbe, test.readOnly, writeProbes)
+		}
+	}
+}
+
+// TestNodeVolumeHealthNotResponding checks that a volume whose check doesn't
+// finish in time is abnormal, and isn't checked again until the check ends.
+func TestNodeVolumeHealthNotResponding(t *testing.T) {
+	ctx := context.Background()
+	layout, mounter := newFakeNode(t)
+	target := layout.mkdir(t, "nfs")
+	mounter.addMount("nfs-server:/share", target, "nfs-server:/share", "nfs4", nil)
+
+	release := make(chan struct{})
+	checks := 0
+	origCheckVolume := checkVolume
+	checkVolume = func(path string, mnt gofsutil.Info, mounted bool, writeProbe bool) (*csi.VolumeCondition, bool) {
+		checks++
+		<-release
+		return &csi.VolumeCondition{Message: "volume is healthy"}, true
+	}
+	defer func() {
+		checkVolume = origCheckVolume
+	}()
+
+	checker := newNodeVolumeHealthChecker("", false)
+	checker.timeout = 10 * time.Millisecond
+	checker.track("volume", target, false)
+	checker.checkAll(ctx)
+	if condition := checker.getCondition("volume", target); condition == nil || !condition.Abnormal {
+		t.Errorf("expected the volume not responding to be abnormal, got %v", condition)
+	}
+	checker.checkAll(ctx)
+	close(release)
+	for i := 0; i < 100; i++ {
+		if condition := checker.getCondition("volume", target); condition != nil && !condition.Abnormal {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if condition := checker.getCondition("volume", target); condition == nil || condition.Abnormal {
+		t.Errorf("expected the volume to be healthy once its check finished, got %v", condition)
+	}
+	if checks != 1 {
+		t.Errorf("expected the volume to be checked once while its check is stuck, got %d checks", checks)
+	}
+}
@@ -33,12 +33,14 @@ import (
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
 
 	"sigs.k8s.io/vsphere-csi-driver/pkg/common/prometheus"
 
 	cnsvolume "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/volume"
 	cnsvsphere "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/vsphere"
 	cnsconfig "sigs.k8s.io/vsphere-csi-driver/pkg/common/config"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/common/utils"
 	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/common"
 	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/common/commonco"
 	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
@@ -130,12 +132,22 @@ func (c *controller) Init(config *cnsconfig.Config, version string) error {
 	}
 	if commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.CSIVolumeManagerIdempotency) {
 		log.Infof("CSI Volume manager idempotency handling feature flag is enabled.")
-		// TODO: Assign VolumeOperationRequest object to a variable
-		_, err = cnsvolumeoperationrequest.InitVolumeOperationRequestInterface(ctx)
+		operationStore, err := cnsvolumeoperationrequest.InitVolumeOperationRequestInterface(ctx, config)
 		if err != nil {
 			log.Errorf("failed to initialize VolumeOperationRequestInterface with error: %v", err)
 			return err
 		}
+		c.manager.VolumeManager.SetOperationStore(operationStore)
+		// ctx is done once initialization completes, the election runs with
+		// its own context.
+		leaderCtx, _ := logger.GetNewContextWithLogger()
+		leader, err := common.StartLeaderElection(leaderCtx)
+		if err != nil {
+			log.Errorf("failed to start leader election. err=%v", err)
+			return err
+		}
+		cnsvolumeoperationrequest.StartCleanupRoutine(operationStore,
+			func() *cnsconfig.Config { return c.manager.CnsConfig }, c.getVolumeIDs, leader.IsLeader)
 	}
 	go func() {
 		for {
@@ -283,6 +295,25 @@ func (c *controller) ReloadConfiguration(reconnectToVCFromNewConfig bool) error
 	return nil
 }
 
+// getVolumeIDs returns the IDs of the volumes of the cluster in CNS.
+func (c *controller) getVolumeIDs(ctx context.Context) (map[string]bool, error) {
+	log := logger.GetLogger(ctx)
+	queryFilter := cnstypes.CnsQueryFilter{
+		ContainerClusterIds: []string{c.manager.CnsConfig.Global.ClusterID},
+	}
+	querySelection := utils.QuerySelection(cnstypes.QuerySelectionNameTypeVolumeType)
+	queryResult, err := c.manager.VolumeManager.QueryAllVolume(ctx, queryFilter, querySelection)
+	if err != nil {
+		log.Errorf("failed to query the volumes of the cluster. err=%v", err)
+		return nil, err
+	}
+	volumeIDs := make(map[string]bool)
+	for _, volume := range queryResult.Volumes {
+		volumeIDs[volume.VolumeId.Id] = true
+	}
+	return volumeIDs, nil
+}
+
 // createBlockVolume creates a block volume based on the CreateVolumeRequest.
 func (c *controller) createBlockVolume(ctx context.Context, req *csi.CreateVolumeRequest) (
 	*csi.CreateVolumeResponse, error) {
@@ -380,7 +411,11 @@ func (c *controller) createBlockVolume(ctx context.Context, req *csi.CreateVolum
 	if err != nil {
 		msg := fmt.Sprintf("failed to create volume. Error: %+v", err)
 		log.Error(msg)
-		return nil, status.Errorf(codes.Internal, msg)
+		if reason, message, ok := common.PVCEventForError(err); ok {
+			pvc := types.NamespacedName{Namespace: createVolumeSpec.ScParams.PVCNamespace, Name: createVolumeSpec.ScParams.PVCName}
+			commonco.ContainerOrchestratorUtility.RecordPVCEvent(ctx, "", pvc, v1.EventTypeWarning, reason, message)
+		}
+		return nil, status.Errorf(common.CreateVolumeErrorCode(err), msg)
 	}
 
 	attributes := make(map[string]string)
@@ -469,7 +504,11 @@ func (c *controller) createFileVolume(ctx context.Context, req *csi.CreateVolume
 	if err != nil {
 		msg := fmt.Sprintf("failed to create volume. Error: %+v", err)
 		log.Error(msg)
-		return nil, status.Errorf(codes.Internal, msg)
+		if reason, message, ok := common.PVCEventForError(err); ok {
+			pvc := types.NamespacedName{Namespace: createVolumeSpec.ScParams.PVCNamespace, Name: createVolumeSpec.ScParams.PVCName}
+			commonco.ContainerOrchestratorUtility.RecordPVCEvent(ctx, "", pvc, v1.EventTypeWarning, reason, message)
+		}
+		return nil, status.Errorf(common.CreateVolumeErrorCode(err), msg)
 	}
 
 	attributes := make(map[string]string)
@@ -817,6 +856,15 @@ func (c *controller) ListSnapshots(ctx context.Context, req *csi.ListSnapshotsRe
 	return nil, status.Error(codes.Unimplemented, "")
 }
 
+func (c *controller) ControllerGetVolume(ctx context.Context, req *csi.ControllerGetVolumeRequest) (
+	*csi.ControllerGetVolumeResponse, error) {
+
+	ctx = logger.NewContextWithLogger(ctx)
+	log := logger.GetLogger(ctx)
+	log.Infof("ControllerGetVolume: called with args %+v", *req)
+	return nil, status.Error(codes.Unimplemented, "")
+}
+
 // ControllerExpandVolume expands a volume.
 func (c *controller) ControllerExpandVolume(ctx context.Context, req *csi.ControllerExpandVolumeRequest) (
 	*csi.ControllerExpandVolumeResponse, error) {
@@ -844,11 +892,15 @@ func (c *controller) ControllerExpandVolume(ctx context.Context, req *csi.Contro
 		volSizeBytes := int64(req.GetCapacityRange().GetRequiredBytes())
 		volSizeMB := int64(common.RoundUpSize(volSizeBytes, common.MbInBytes))
 
-		err = common.ExpandVolumeUtil(ctx, c.manager, volumeID, volSizeMB, commonco.ContainerOrchestratorUtility.IsFSSEnabled(ctx, common.AsyncQueryVolume))
+		err = common.ExpandVolumeUtil(ctx, c.manager, volumeID, volSizeMB)
 		if err != nil {
 			msg := fmt.Sprintf("failed to expand volume: %+q to size: %d err %+v", volumeID, volSizeMB, err)
 			log.Error(msg)
-			return nil, status.Errorf(codes.Internal, msg)
+			if reason, message, ok := common.PVCEventForError(err); ok {
+				commonco.ContainerOrchestratorUtility.RecordPVCEvent(ctx, volumeID, types.NamespacedName{},
+					v1.EventTypeWarning, reason, message)
+			}
+			return nil, status.Errorf(common.ExpandVolumeErrorCode(err), msg)
 		}
 
 		// Always set nodeExpansionRequired to true, even if requested size is equal to current size.
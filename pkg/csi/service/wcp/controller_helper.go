@@ -113,7 +113,7 @@ func validateWCPControllerUnpublishVolumeRequest(ctx context.Context, req *csi.C
 func validateWCPControllerExpandVolumeRequest(ctx context.Context, req *csi.ControllerExpandVolumeRequest,
 	manager *common.Manager, isOnlineExpansionEnabled bool) error {
 	log := logger.GetLogger(ctx)
-	if err := common.ValidateControllerExpandVolumeRequest(ctx, req); err != nil {
+	if err := common.ValidateControllerExpandVolumeRequest(ctx, req, false); err != nil {
 		return err
 	}
 
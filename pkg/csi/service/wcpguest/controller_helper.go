@@ -101,7 +101,7 @@ func validateGuestClusterControllerUnpublishVolumeRequest(ctx context.Context, r
 }
 
 func validateGuestClusterControllerExpandVolumeRequest(ctx context.Context, req *csi.ControllerExpandVolumeRequest) error {
-	return common.ValidateControllerExpandVolumeRequest(ctx, req)
+	return common.ValidateControllerExpandVolumeRequest(ctx, req, false)
 }
 
 // checkForSupervisorPVCCondition returns nil if the PVC condition is set as required in the supervisor cluster before timeout, otherwise returns error
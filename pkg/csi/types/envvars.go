@@ -35,6 +35,32 @@ const (
 	// EnvVarEndpoint specifies the CSI endpoint for CSI driver.
 	EnvVarEndpoint = "CSI_ENDPOINT"
 
+	// EnvVarShutdownTimeout is the duration, such as "30s", the driver waits
+	// on SIGTERM for the in-flight CSI RPCs to finish before exiting.
+	EnvVarShutdownTimeout = "X_CSI_SHUTDOWN_TIMEOUT"
+
+	// EnvVarMountTimeout is the duration, such as "5m", a mount, format or
+	// unmount operation of the node plugin can take before it is abandoned.
+	EnvVarMountTimeout = "X_CSI_MOUNT_TIMEOUT"
+
+	// EnvVarMountRetries is the number of times a failed mount, format or
+	// unmount operation of the node plugin is retried.
+	EnvVarMountRetries = "X_CSI_MOUNT_RETRIES"
+
+	// EnvVarNodeMetricsAddress is the address, such as ":2115", the node
+	// plugin serves Prometheus metrics at. Metrics aren't served by the node
+	// plugin if it is set to an empty value.
+	EnvVarNodeMetricsAddress = "X_CSI_NODE_METRICS_ADDRESS"
+
+	// EnvVarNodeVolumeHealthInterval is the duration, such as "1m", between
+	// two checks of the volumes published on the node by the node plugin.
+	EnvVarNodeVolumeHealthInterval = "X_CSI_NODE_VOLUME_HEALTH_INTERVAL"
+
+	// EnvVarNodeVolumeHealthWriteProbe enables, when set to "true", the
+	// check that the filesystems of the volumes published read-write on the
+	// node are writable, by creating and removing a file in them.
+	EnvVarNodeVolumeHealthWriteProbe = "X_CSI_NODE_VOLUME_HEALTH_WRITE_PROBE"
+
 	// EnvVarMode is the name of the environment variable used to specify
 	// the service mode of the plugin. Valid values are:
 	// * controller
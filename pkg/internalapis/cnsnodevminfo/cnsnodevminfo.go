@@ -0,0 +1,139 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cnsnodevminfo
+
+import (
+	"context"
+	"reflect"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/node"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
+	cnsnodevminfov1alpha1 "sigs.k8s.io/vsphere-csi-driver/pkg/internalapis/cnsnodevminfo/v1alpha1"
+	k8s "sigs.k8s.io/vsphere-csi-driver/pkg/kubernetes"
+)
+
+const (
+	// crdName represent the name of cnsnodevminfo CRD
+	crdName = "cnsnodevminfos.cns.vmware.com"
+	// crdSingular represent the singular name of cnsnodevminfo CRD
+	crdSingular = "cnsnodevminfo"
+	// crdPlural represent the plural name of cnsnodevminfo CRD
+	crdPlural = "cnsnodevminfos"
+)
+
+// nodeVMInfoStore implements the node.UUIDStore interface. It mirrors the
+// UUIDs of node VMs in CnsNodeVMInfo instances on the API server, one per node,
+// named after the node.
+type nodeVMInfoStore struct {
+	k8sclient client.Client
+}
+
+// NewUUIDStore creates the CnsNodeVMInfo definition on the API server and
+// returns a node.UUIDStore persisting node UUIDs in CnsNodeVMInfo instances.
+func NewUUIDStore(ctx context.Context) (node.UUIDStore, error) {
+	log := logger.GetLogger(ctx)
+	log.Info("Creating cnsnodevminfo definition on API server")
+	err := k8s.CreateCustomResourceDefinitionFromSpec(ctx, crdName, crdSingular, crdPlural,
+		reflect.TypeOf(cnsnodevminfov1alpha1.CnsNodeVMInfo{}).Name(), cnsnodevminfov1alpha1.SchemeGroupVersion.Group,
+		cnsnodevminfov1alpha1.SchemeGroupVersion.Version, apiextensionsv1.ClusterScoped)
+	if err != nil {
+		log.Errorf("failed to create cnsnodevminfo CRD with error: %v", err)
+		return nil, err
+	}
+	config, err := k8s.GetKubeConfig(ctx)
+	if err != nil {
+		log.Errorf("failed to get kubeconfig with error: %v", err)
+		return nil, err
+	}
+	k8sclient, err := k8s.NewClientForGroup(ctx, config, cnsnodevminfov1alpha1.SchemeGroupVersion.Group)
+	if err != nil {
+		log.Errorf("failed to create k8sClient with error: %v", err)
+		return nil, err
+	}
+	return &nodeVMInfoStore{k8sclient: k8sclient}, nil
+}
+
+// Load returns the node UUIDs of all CnsNodeVMInfo instances, keyed by node name.
+func (s *nodeVMInfoStore) Load(ctx context.Context) (map[string]string, error) {
+	log := logger.GetLogger(ctx)
+	list := &cnsnodevminfov1alpha1.CnsNodeVMInfoList{}
+	if err := s.k8sclient.List(ctx, list); err != nil {
+		log.Errorf("failed to list CnsNodeVMInfo instances with error: %v", err)
+		return nil, err
+	}
+	nodeUUIDs := make(map[string]string)
+	for _, instance := range list.Items {
+		if instance.Spec.NodeUUID != "" {
+			nodeUUIDs[instance.Spec.NodeName] = instance.Spec.NodeUUID
+		}
+	}
+	return nodeUUIDs, nil
+}
+
+// Store creates or updates the CnsNodeVMInfo instance of the node.
+func (s *nodeVMInfoStore) Store(ctx context.Context, nodeName string, nodeUUID string) error {
+	log := logger.GetLogger(ctx)
+	instance := &cnsnodevminfov1alpha1.CnsNodeVMInfo{}
+	err := s.k8sclient.Get(ctx, client.ObjectKey{Name: nodeName}, instance)
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			log.Errorf("failed to get CnsNodeVMInfo instance %s with error: %v", nodeName, err)
+			return err
+		}
+		newInstance := &cnsnodevminfov1alpha1.CnsNodeVMInfo{
+			ObjectMeta: metav1.ObjectMeta{Name: nodeName},
+			Spec: cnsnodevminfov1alpha1.CnsNodeVMInfoSpec{
+				NodeName: nodeName,
+				NodeUUID: nodeUUID,
+			},
+		}
+		if err = s.k8sclient.Create(ctx, newInstance); err != nil {
+			log.Errorf("failed to create CnsNodeVMInfo instance %s with error: %v", nodeName, err)
+			return err
+		}
+		log.Debugf("Created CnsNodeVMInfo instance %s with nodeUUID %s", nodeName, nodeUUID)
+		return nil
+	}
+	if instance.Spec.NodeUUID == nodeUUID {
+		return nil
+	}
+	updatedInstance := instance.DeepCopy()
+	updatedInstance.Spec.NodeUUID = nodeUUID
+	if err = s.k8sclient.Update(ctx, updatedInstance); err != nil {
+		log.Errorf("failed to update CnsNodeVMInfo instance %s with error: %v", nodeName, err)
+		return err
+	}
+	log.Debugf("Updated CnsNodeVMInfo instance %s with nodeUUID %s", nodeName, nodeUUID)
+	return nil
+}
+
+// Delete deletes the CnsNodeVMInfo instance of the node, if it exists.
+func (s *nodeVMInfoStore) Delete(ctx context.Context, nodeName string) error {
+	log := logger.GetLogger(ctx)
+	instance := &cnsnodevminfov1alpha1.CnsNodeVMInfo{ObjectMeta: metav1.ObjectMeta{Name: nodeName}}
+	if err := s.k8sclient.Delete(ctx, instance); err != nil && !apierrors.IsNotFound(err) {
+		log.Errorf("failed to delete CnsNodeVMInfo instance %s with error: %v", nodeName, err)
+		return err
+	}
+	log.Debugf("Deleted CnsNodeVMInfo instance %s", nodeName)
+	return nil
+}
@@ -0,0 +1,50 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CnsNodeVMInfoSpec defines the desired state of CnsNodeVMInfo
+type CnsNodeVMInfoSpec struct {
+	// NodeName is the name of the Kubernetes node.
+	NodeName string `json:"nodeName"`
+	// NodeUUID is the UUID of the node VM found on vCenter.
+	NodeUUID string `json:"nodeUUID"`
+}
+
+//+kubebuilder:object:root=true
+
+// CnsNodeVMInfo is the Schema for the cnsnodevminfos API. It mirrors the UUID
+// of the VM discovered for a node, so that the node can be found again without
+// searching vCenter when the driver restarts.
+type CnsNodeVMInfo struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec CnsNodeVMInfoSpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// CnsNodeVMInfoList contains a list of CnsNodeVMInfo
+type CnsNodeVMInfoList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CnsNodeVMInfo `json:"items"`
+}
@@ -24,12 +24,48 @@ import (
 // created to trigger full sync on demand.
 const TriggerCsiFullSyncCRName = "csifullsync"
 
+// MaxDriftReportVolumeIDs is the maximum number of volume IDs listed by kind
+// of divergence in a DriftReport, so that the instance stays small.
+const MaxDriftReportVolumeIDs = 100
+
 // TriggerCsiFullSyncSpec is the spec for TriggerCsiFullSync
 type TriggerCsiFullSyncSpec struct {
 	// TriggerSyncID gives an option to trigger full sync on demand.
 	// Initial value will be 0. In order to trigger a full sync, user
 	// has to set a number that is 1 greater than the previous one.
 	TriggerSyncID uint64 `json:"triggerSyncID"`
+
+	// DryRun indicates whether the full sync triggered by TriggerSyncID only
+	// reports the divergences between the volumes in Kubernetes and CNS in
+	// Status.DriftReport, without creating, updating or deleting volumes.
+	DryRun bool `json:"dryRun,omitempty"`
+}
+
+// DriftReport contains the divergences between the volumes in Kubernetes and
+// CNS found by a dry run full sync.
+type DriftReport struct {
+	// GeneratedTimeStamp indicates when the dry run full sync completed.
+	GeneratedTimeStamp *metav1.Time `json:"generatedTimeStamp,omitempty"`
+
+	// MissingVolumes indicates the number of volumes of PVs that are not in CNS.
+	MissingVolumes int64 `json:"missingVolumes"`
+
+	// StaleVolumes indicates the number of volumes whose metadata in CNS
+	// differs from the metadata of their PV, PVC and pods in Kubernetes.
+	StaleVolumes int64 `json:"staleVolumes"`
+
+	// OrphanedVolumes indicates the number of volumes in CNS of the cluster
+	// whose PV is not in Kubernetes.
+	OrphanedVolumes int64 `json:"orphanedVolumes"`
+
+	// MissingVolumeIDs has the IDs of up to MaxDriftReportVolumeIDs missing volumes.
+	MissingVolumeIDs []string `json:"missingVolumeIDs,omitempty"`
+
+	// StaleVolumeIDs has the IDs of up to MaxDriftReportVolumeIDs stale volumes.
+	StaleVolumeIDs []string `json:"staleVolumeIDs,omitempty"`
+
+	// OrphanedVolumeIDs has the IDs of up to MaxDriftReportVolumeIDs orphaned volumes.
+	OrphanedVolumeIDs []string `json:"orphanedVolumeIDs,omitempty"`
 }
 
 // TriggerCsiFullSyncStatus contains the status for a TriggerCsiFullSync
@@ -55,6 +91,23 @@ type TriggerCsiFullSyncStatus struct {
 	// This timestamp can be either the successful or failed full sync end timestamp.
 	LastRunEndTimeStamp *metav1.Time `json:"lastRunEndTimeStamp,omitempty"`
 
+	// LastRunVolumesCreated indicates the number of volumes created in CNS by the last run full sync.
+	LastRunVolumesCreated int64 `json:"lastRunVolumesCreated,omitempty"`
+
+	// LastRunVolumesUpdated indicates the number of volumes whose metadata was updated in CNS
+	// by the last run full sync.
+	LastRunVolumesUpdated int64 `json:"lastRunVolumesUpdated,omitempty"`
+
+	// LastRunVolumesDeleted indicates the number of volumes deleted from CNS by the last run full sync.
+	LastRunVolumesDeleted int64 `json:"lastRunVolumesDeleted,omitempty"`
+
+	// LastRunVolumesFailed indicates the number of volumes the last run full sync failed to
+	// create, update or delete in CNS.
+	LastRunVolumesFailed int64 `json:"lastRunVolumesFailed,omitempty"`
+
+	// DriftReport is the report of the last successful dry run full sync.
+	DriftReport *DriftReport `json:"driftReport,omitempty"`
+
 	// The last error encountered during CSI full sync operation, if any.
 	// Previous error will be cleared when a new full sync is in progress.
 	Error string `json:"error,omitempty"`
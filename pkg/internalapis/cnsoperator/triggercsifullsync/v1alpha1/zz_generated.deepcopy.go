@@ -22,13 +22,48 @@ import (
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DriftReport) DeepCopyInto(out *DriftReport) {
+	*out = *in
+	if in.GeneratedTimeStamp != nil {
+		in, out := &in.GeneratedTimeStamp, &out.GeneratedTimeStamp
+		*out = (*in).DeepCopy()
+	}
+	if in.MissingVolumeIDs != nil {
+		in, out := &in.MissingVolumeIDs, &out.MissingVolumeIDs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.StaleVolumeIDs != nil {
+		in, out := &in.StaleVolumeIDs, &out.StaleVolumeIDs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.OrphanedVolumeIDs != nil {
+		in, out := &in.OrphanedVolumeIDs, &out.OrphanedVolumeIDs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DriftReport.
+func (in *DriftReport) DeepCopy() *DriftReport {
+	if in == nil {
+		return nil
+	}
+	out := new(DriftReport)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TriggerCsiFullSync) DeepCopyInto(out *TriggerCsiFullSync) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	out.Spec = in.Spec
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 	return
 }
 
@@ -102,6 +137,11 @@ func (in *TriggerCsiFullSyncSpec) DeepCopy() *TriggerCsiFullSyncSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TriggerCsiFullSyncStatus) DeepCopyInto(out *TriggerCsiFullSyncStatus) {
 	*out = *in
+	if in.DriftReport != nil {
+		in, out := &in.DriftReport, &out.DriftReport
+		*out = new(DriftReport)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
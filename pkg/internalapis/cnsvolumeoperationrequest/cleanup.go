@@ -0,0 +1,254 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cnsvolumeoperationrequest
+
+import (
+	"context"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	csiconfig "sigs.k8s.io/vsphere-csi-driver/pkg/common/config"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
+	cnsvolumeoperationrequestv1alpha1 "sigs.k8s.io/vsphere-csi-driver/pkg/internalapis/cnsvolumeoperationrequest/v1alpha1"
+)
+
+// staleCleaner is implemented by the VolumeOperationRequest implementations
+// deleting the details of stale operations.
+type staleCleaner interface {
+	// cleanupStale deletes the details of the operations whose latest
+	// operation is older than ttl, or is done on a volume not returned by
+	// getVolumeIDs. A negative ttl only deletes the details of deleted
+	// volumes.
+	cleanupStale(ctx context.Context, ttl time.Duration,
+		getVolumeIDs func(ctx context.Context) (map[string]bool, error)) error
+}
+
+// volumeDetailsDeleter is implemented by the VolumeOperationRequest
+// implementations deleting the details of the operations of a volume.
+type volumeDetailsDeleter interface {
+	// deleteVolumeDetails deletes the details of the operations done on the
+	// volume, keeping the ones in progress.
+	deleteVolumeDetails(ctx context.Context, volumeID string) error
+}
+
+// DeleteVolumeRequestDetails deletes the details of the operations done on
+// the volume from the store, once the volume is deleted, so that the create
+// operation of the volume isn't mistaken for a volume that still exists. The
+// operations in progress are kept. The details are left to the cleanup
+// routine with stores not supporting it.
+func DeleteVolumeRequestDetails(ctx context.Context, store VolumeOperationRequest, volumeID string) error {
+	deleter, ok := store.(volumeDetailsDeleter)
+	if !ok {
+		return nil
+	}
+	return deleter.deleteVolumeDetails(ctx, volumeID)
+}
+
+// StartCleanupRoutine periodically deletes the details of the stale operations
+// of the store, every VolumeOperationRequestCleanupIntervalInMin minutes of the
+// config returned by getConfig. Operations are stale when their latest task is
+// older than VolumeOperationRequestTTLInMin minutes, or when it is done and
+// their volume isn't in the volume IDs returned by getVolumeIDs anymore.
+// The config is read on each run so that reloaded settings take effect. The
+// cleanup is skipped while isLeader returns false, so that only the leader
+// replica of the controller deletes the details.
+func StartCleanupRoutine(store VolumeOperationRequest, getConfig func() *csiconfig.Config,
+	getVolumeIDs func(ctx context.Context) (map[string]bool, error), isLeader func() bool) {
+	cleaner, ok := store.(staleCleaner)
+	if !ok {
+		return
+	}
+	go func() {
+		for {
+			interval := getConfig().Global.VolumeOperationRequestCleanupIntervalInMin
+			if interval < 0 {
+				// Check again later whether the cleanup got enabled.
+				interval = csiconfig.DefaultVolumeOperationRequestCleanupIntervalInMin
+			}
+			time.Sleep(time.Duration(interval) * time.Minute)
+			cfg := getConfig()
+			if cfg.Global.VolumeOperationRequestCleanupIntervalInMin < 0 || !isLeader() {
+				continue
+			}
+			ctx, log := logger.GetNewContextWithLogger()
+			ttl := time.Duration(cfg.Global.VolumeOperationRequestTTLInMin) * time.Minute
+			if err := cleaner.cleanupStale(ctx, ttl, getVolumeIDs); err != nil {
+				log.Warnf("failed to clean up the details of stale volume operations. err: %v", err)
+			}
+		}
+	}()
+}
+
+// deleteVolumeDetails deletes the CnsVolumeOperationRequest instances of the
+// volume whose latest operation is done. Only the instances labeled with the
+// volume ID are listed, the ones stored before the label was set are left to
+// the cleanup routine.
+func (or *operationRequestStore) deleteVolumeDetails(ctx context.Context, volumeID string) error {
+	log := logger.GetLogger(ctx)
+	instanceList := &cnsvolumeoperationrequestv1alpha1.CnsVolumeOperationRequestList{}
+	err := or.k8sclient.List(ctx, instanceList, client.InNamespace(csiconfig.DefaultCSINamespace),
+		client.MatchingLabels{volumeIDLabel: volumeIDLabelValue(volumeID)})
+	if err != nil {
+		return err
+	}
+	for i := range instanceList.Items {
+		instance := &instanceList.Items[i]
+		n := len(instance.Status.LatestOperationDetails)
+		if instance.Status.VolumeID != volumeID ||
+			(n > 0 && instance.Status.LatestOperationDetails[n-1].TaskStatus == taskInvocationStatusInProgress) {
+			continue
+		}
+		log.Debugf("Deleting CnsVolumeOperationRequest instance %s/%s of deleted volume %q",
+			instance.Namespace, instance.Name, volumeID)
+		if err := or.k8sclient.Delete(ctx, instance); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteVolumeDetails deletes the details of the operations of the volume
+// whose latest task is done from their ConfigMaps.
+func (cs *configMapStore) deleteVolumeDetails(ctx context.Context, volumeID string) error {
+	operations, err := cs.listRequestDetails(ctx)
+	if err != nil {
+		return err
+	}
+	isVolumeDetails := func(details *VolumeOperationRequestDetails) bool {
+		return details.VolumeID == volumeID && details.OperationDetails.TaskStatus != taskInvocationStatusInProgress
+	}
+	var names []string
+	for name, details := range operations {
+		if isVolumeDetails(details) {
+			names = append(names, name)
+		}
+	}
+	return cs.deleteRequestDetails(ctx, names, func(details *VolumeOperationRequestDetails) bool {
+		return !isVolumeDetails(details)
+	})
+}
+
+// cleanupStale deletes the stale CnsVolumeOperationRequest instances.
+func (or *operationRequestStore) cleanupStale(ctx context.Context, ttl time.Duration,
+	getVolumeIDs func(ctx context.Context) (map[string]bool, error)) error {
+	return cleanupStaleInstances(ctx, or.k8sclient, ttl, getVolumeIDs)
+}
+
+// cleanupStale deletes the details of the stale operations from their
+// ConfigMaps.
+func (cs *configMapStore) cleanupStale(ctx context.Context, ttl time.Duration,
+	getVolumeIDs func(ctx context.Context) (map[string]bool, error)) error {
+	log := logger.GetLogger(ctx)
+	log.Infof("Triggering cleanup of the details of the volume operations in ConfigMaps")
+	// The operations are listed before querying the volumes, so that the
+	// volume of a listed operation done creating it is always found.
+	operations, err := cs.listRequestDetails(ctx)
+	if err != nil {
+		log.Errorf("failed to list the details of the volume operations with error: %v", err)
+		return err
+	}
+	if len(operations) == 0 {
+		return nil
+	}
+	volumeIDs, err := getVolumeIDs(ctx)
+	if err != nil {
+		log.Errorf("failed to get the IDs of the volumes with error: %v", err)
+		return err
+	}
+	isStaleDetails := func(details *VolumeOperationRequestDetails) bool {
+		return isStale(details.VolumeID, details.OperationDetails.TaskInvocationTimestamp.Time,
+			details.OperationDetails.TaskStatus, ttl, volumeIDs)
+	}
+	var staleNames []string
+	for name, details := range operations {
+		if isStaleDetails(details) {
+			log.Debugf("Deleting the details of stale operation %q of volume %q", name, details.VolumeID)
+			staleNames = append(staleNames, name)
+		}
+	}
+	err = cs.deleteRequestDetails(ctx, staleNames, func(details *VolumeOperationRequestDetails) bool {
+		return !isStaleDetails(details)
+	})
+	if err != nil {
+		log.Errorf("failed to delete the details of stale volume operations with error: %v", err)
+		return err
+	}
+	log.Infof("Completed cleanup of the details of the volume operations, deleted %d of %d operations",
+		len(staleNames), len(operations))
+	return nil
+}
+
+// cleanupStaleInstances deletes the CnsVolumeOperationRequest instances whose
+// latest operation is older than ttl, or is done on a volume not returned by
+// getVolumeIDs. A negative ttl only deletes the instances of deleted volumes.
+func cleanupStaleInstances(ctx context.Context, k8sclient client.Client, ttl time.Duration,
+	getVolumeIDs func(ctx context.Context) (map[string]bool, error)) error {
+	log := logger.GetLogger(ctx)
+	log.Infof("Triggering CnsVolumeOperationRequest cleanup routine")
+	// Instances are listed before querying the volumes, so that the volume of
+	// a listed operation done creating it is always found.
+	instanceList := &cnsvolumeoperationrequestv1alpha1.CnsVolumeOperationRequestList{}
+	if err := k8sclient.List(ctx, instanceList, client.InNamespace(csiconfig.DefaultCSINamespace)); err != nil {
+		log.Errorf("failed to list CnsVolumeOperationRequest instances with error: %v", err)
+		return err
+	}
+	if len(instanceList.Items) == 0 {
+		return nil
+	}
+	volumeIDs, err := getVolumeIDs(ctx)
+	if err != nil {
+		log.Errorf("failed to get the IDs of the volumes with error: %v", err)
+		return err
+	}
+	deleted := 0
+	for i := range instanceList.Items {
+		instance := &instanceList.Items[i]
+		lastUpdated := instance.CreationTimestamp.Time
+		status := ""
+		if n := len(instance.Status.LatestOperationDetails); n > 0 {
+			latest := instance.Status.LatestOperationDetails[n-1]
+			lastUpdated = latest.TaskInvocationTimestamp.Time
+			status = latest.TaskStatus
+		}
+		if !isStale(instance.Status.VolumeID, lastUpdated, status, ttl, volumeIDs) {
+			continue
+		}
+		log.Debugf("Deleting stale CnsVolumeOperationRequest instance %s/%s of volume %q",
+			instance.Namespace, instance.Name, instance.Status.VolumeID)
+		if err := k8sclient.Delete(ctx, instance); err != nil && !apierrors.IsNotFound(err) {
+			log.Warnf("failed to delete CnsVolumeOperationRequest instance %s/%s with error: %v",
+				instance.Namespace, instance.Name, err)
+			continue
+		}
+		deleted++
+	}
+	log.Infof("Completed CnsVolumeOperationRequest cleanup, deleted %d of %d instances",
+		deleted, len(instanceList.Items))
+	return nil
+}
+
+// isStale returns whether the latest operation, on volumeID and updated at
+// lastUpdated, is older than ttl, or is done on a volume not in volumeIDs.
+func isStale(volumeID string, lastUpdated time.Time, status string, ttl time.Duration,
+	volumeIDs map[string]bool) bool {
+	if ttl >= 0 && time.Since(lastUpdated) > ttl {
+		return true
+	}
+	return status != taskInvocationStatusInProgress && volumeID != "" && !volumeIDs[volumeID]
+}
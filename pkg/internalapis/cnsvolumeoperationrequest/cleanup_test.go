@@ -0,0 +1,129 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cnsvolumeoperationrequest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	csiconfig "sigs.k8s.io/vsphere-csi-driver/pkg/common/config"
+	cnsvolumeoperationrequestv1alpha1 "sigs.k8s.io/vsphere-csi-driver/pkg/internalapis/cnsvolumeoperationrequest/v1alpha1"
+)
+
+func newInstance(name string, volumeID string, status string,
+	invokedAt time.Time) *cnsvolumeoperationrequestv1alpha1.CnsVolumeOperationRequest {
+	details := cnsvolumeoperationrequestv1alpha1.OperationDetails{
+		TaskInvocationTimestamp: metav1.NewTime(invokedAt),
+		TaskID:                  "task-" + name,
+		TaskStatus:              status,
+	}
+	return &cnsvolumeoperationrequestv1alpha1.CnsVolumeOperationRequest{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: csiconfig.DefaultCSINamespace},
+		Spec:       cnsvolumeoperationrequestv1alpha1.CnsVolumeOperationRequestSpec{Name: name},
+		Status: cnsvolumeoperationrequestv1alpha1.CnsVolumeOperationRequestStatus{
+			VolumeID:               volumeID,
+			FirstOperationDetails:  details,
+			LatestOperationDetails: []cnsvolumeoperationrequestv1alpha1.OperationDetails{details},
+		},
+	}
+}
+
+// TestCleanupStaleInstances checks that only the instances of deleted volumes
+// and the ones older than the TTL are deleted.
+func TestCleanupStaleInstances(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	if err := cnsvolumeoperationrequestv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	ttl := time.Hour
+	k8sclient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		newInstance("existing", "volume-1", "Successful", now),
+		newInstance("deleted-volume", "volume-2", "Successful", now),
+		newInstance("deleted-volume-in-progress", "volume-3", taskInvocationStatusInProgress, now),
+		newInstance("failed", "", "Failed", now),
+		newInstance("expired", "volume-1", "Successful", now.Add(-2*ttl)),
+		newInstance("expired-in-progress", "", taskInvocationStatusInProgress, now.Add(-2*ttl)),
+	).Build()
+	getVolumeIDs := func(ctx context.Context) (map[string]bool, error) {
+		return map[string]bool{"volume-1": true}, nil
+	}
+
+	// Nothing is deleted if the volumes can't be queried.
+	err := cleanupStaleInstances(ctx, k8sclient, ttl, func(ctx context.Context) (map[string]bool, error) {
+		return nil, errors.New("query failed")
+	})
+	if err == nil {
+		t.Fatal("expected the cleanup to fail when the volumes can't be queried")
+	}
+
+	inProgress, err := listInProgressInstances(ctx, k8sclient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inProgress) != 2 {
+		t.Errorf("expected 2 operations in progress, got %d", len(inProgress))
+	}
+	for _, details := range inProgress {
+		if details.Name != "deleted-volume-in-progress" && details.Name != "expired-in-progress" {
+			t.Errorf("unexpected operation in progress %q", details.Name)
+		}
+	}
+
+	if err = cleanupStaleInstances(ctx, k8sclient, ttl, getVolumeIDs); err != nil {
+		t.Fatal(err)
+	}
+	for name, kept := range map[string]bool{
+		"existing":                   true,
+		"deleted-volume":             false,
+		"deleted-volume-in-progress": true,
+		"failed":                     true,
+		"expired":                    false,
+		"expired-in-progress":        false,
+	} {
+		instance := &cnsvolumeoperationrequestv1alpha1.CnsVolumeOperationRequest{}
+		err := k8sclient.Get(ctx, client.ObjectKey{Name: name, Namespace: csiconfig.DefaultCSINamespace}, instance)
+		if kept && err != nil {
+			t.Errorf("expected instance %q to be kept, got %v", name, err)
+		}
+		if !kept && !apierrors.IsNotFound(err) {
+			t.Errorf("expected instance %q to be deleted, got %v", name, err)
+		}
+	}
+
+	// A negative TTL keeps the instances of existing volumes.
+	if err = k8sclient.Create(ctx, newInstance("old", "volume-1", "Successful", now.Add(-2*ttl))); err != nil {
+		t.Fatal(err)
+	}
+	if err = cleanupStaleInstances(ctx, k8sclient, -1, getVolumeIDs); err != nil {
+		t.Fatal(err)
+	}
+	instance := &cnsvolumeoperationrequestv1alpha1.CnsVolumeOperationRequest{}
+	if err = k8sclient.Get(ctx, client.ObjectKey{Name: "old", Namespace: csiconfig.DefaultCSINamespace},
+		instance); err != nil {
+		t.Errorf("expected instance %q to be kept with a negative TTL, got %v", "old", err)
+	}
+}
@@ -19,13 +19,13 @@ package cnsvolumeoperationrequest
 import (
 	"context"
 	"fmt"
-	"reflect"
+	"sync"
 
 	"github.com/davecgh/go-spew/spew"
 	"github.com/pkg/errors"
-	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	csiconfig "sigs.k8s.io/vsphere-csi-driver/pkg/common/config"
@@ -52,25 +52,47 @@ type VolumeOperationRequest interface {
 
 // operationRequestStore implements the VolumeOperationsRequest interface.
 // This implementation persists the operation information on etcd via a client
-// to the API server. Reads are also done directly on etcd; there is no caching
-// layer involved.
+// to the API server. GetRequestDetails reads from an informer cache of the
+// instances, kept up to date by a watch on the API server, so that idempotency
+// checks don't hit the API server. StoreRequestDetails reads directly on etcd
+// to update the latest version of the instances. Instances written by the
+// store are read from the API server until the cache has observed the write,
+// so that idempotency checks never see an older version than the one stored.
 type operationRequestStore struct {
 	k8sclient client.Client
+	// cacheReader serves the reads of GetRequestDetails.
+	cacheReader client.Reader
+	// writtenLock protects written.
+	writtenLock sync.Mutex
+	// written has the resource versions of the instances stored by this store
+	// which the cache may not have observed yet, by name.
+	written map[string]string
 }
 
-// InitVolumeOperationRequestInterface creates the CnsVolumeOperationRequest
-// definition on the API server and returns an implementation of
-// VolumeOperationRequest interface. Clients are unaware of the implementation
-// details to read and persist volume operation details.
+// InitVolumeOperationRequestInterface returns an implementation of
+// VolumeOperationRequest interface, persisting the operations in the backend
+// set by volumeoperationrequest-backend in the config. Clients are unaware of
+// the implementation details to read and persist volume operation details.
 // This function is not thread safe. Multiple serial calls to this function will
 // return multiple new instances of the VolumeOperationRequest interface.
 // TODO: Make this thread-safe and a singleton.
-func InitVolumeOperationRequestInterface(ctx context.Context) (VolumeOperationRequest, error) {
+func InitVolumeOperationRequestInterface(ctx context.Context, cfg *csiconfig.Config) (VolumeOperationRequest, error) {
+	log := logger.GetLogger(ctx)
+	if cfg.Global.VolumeOperationRequestBackend == csiconfig.VolumeOperationRequestBackendConfigMap {
+		log.Info("Persisting the details of the volume operations in ConfigMaps")
+		return initConfigMapStore(ctx)
+	}
+	return initOperationRequestStore(ctx)
+}
+
+// initOperationRequestStore creates the CnsVolumeOperationRequest definition
+// on the API server and returns an operationRequestStore. Reads are served
+// from an informer cache that is synced before returning.
+func initOperationRequestStore(ctx context.Context) (VolumeOperationRequest, error) {
 	log := logger.GetLogger(ctx)
 	// Create CnsVolumeOperationRequest definition on API server
 	log.Info("Creating cnsvolumeoperationrequest definition on API server")
-	err := k8s.CreateCustomResourceDefinitionFromSpec(ctx, crdName, crdSingular, crdPlural,
-		reflect.TypeOf(cnsvolumeoperationrequestv1alpha1.CnsVolumeOperationRequest{}).Name(), cnsvolumeoperationrequestv1alpha1.SchemeGroupVersion.Group, cnsvolumeoperationrequestv1alpha1.SchemeGroupVersion.Version, apiextensionsv1beta1.NamespaceScoped)
+	err := k8s.CreateCustomResourceDefinition(ctx, getCustomResourceDefinition())
 	if err != nil {
 		log.Errorf("failed to create cnsvolumeoperationrequest CRD with error: %v", err)
 	}
@@ -89,23 +111,53 @@ func InitVolumeOperationRequestInterface(ctx context.Context) (VolumeOperationRe
 		return nil, err
 	}
 
+	// Create an informer cache of the instances in the CSI namespace and wait
+	// for it to be synced with the API server.
+	informerCache, err := cache.New(config, cache.Options{
+		Scheme:    k8sclient.Scheme(),
+		Namespace: csiconfig.DefaultCSINamespace,
+	})
+	if err != nil {
+		log.Errorf("failed to create informer cache with error: %v", err)
+		return nil, err
+	}
+	_, err = informerCache.GetInformer(ctx, &cnsvolumeoperationrequestv1alpha1.CnsVolumeOperationRequest{})
+	if err != nil {
+		log.Errorf("failed to get informer for cnsvolumeoperationrequest instances with error: %v", err)
+		return nil, err
+	}
+	// The cache outlives the context of the caller.
+	go func() {
+		cacheCtx, cacheLog := logger.GetNewContextWithLogger()
+		if err := informerCache.Start(cacheCtx); err != nil {
+			cacheLog.Errorf("informer cache of cnsvolumeoperationrequest instances stopped with error: %v", err)
+		}
+	}()
+	if !informerCache.WaitForCacheSync(ctx) {
+		msg := "failed to sync informer cache of cnsvolumeoperationrequest instances"
+		log.Error(msg)
+		return nil, errors.New(msg)
+	}
+
 	// Initialize the operationRequestStore implementation of VolumeOperationRequest
 	// interface.
 	// NOTE: Currently there is only a single implementation of this interface.
 	// Future implementations will need modify this step.
 	operationRequestStore := &operationRequestStore{
-		k8sclient: k8sclient,
+		k8sclient:   k8sclient,
+		cacheReader: informerCache,
+		written:     make(map[string]string),
 	}
 
 	return operationRequestStore, nil
 }
 
 // GetRequestDetails returns the details of the operation on the volume
-// that is persisted by the VolumeOperationRequest interface, by querying
-// API server for a CnsVolumeOperationRequest instance with the given
-// name.
+// that is persisted by the VolumeOperationRequest interface, by looking up
+// the CnsVolumeOperationRequest instance with the given name in the informer
+// cache.
 // Returns an error if any error is encountered while attempting to
-// read the previously persisted information from the API server.
+// read the previously persisted information.
 // Callers need to differentiate NotFound errors if required.
 func (or *operationRequestStore) GetRequestDetails(ctx context.Context, name string) (*VolumeOperationRequestDetails, error) {
 	log := logger.GetLogger(ctx)
@@ -113,7 +165,17 @@ func (or *operationRequestStore) GetRequestDetails(ctx context.Context, name str
 	log.Debugf("Getting CnsVolumeOperationRequest instance with name %s/%s", instanceKey.Namespace, instanceKey.Name)
 
 	instance := &cnsvolumeoperationrequestv1alpha1.CnsVolumeOperationRequest{}
-	err := or.k8sclient.Get(ctx, instanceKey, instance)
+	err := or.cacheReader.Get(ctx, instanceKey, instance)
+	if or.isCacheBehind(name, instance, err) {
+		log.Debugf("Cache hasn't observed the latest write of CnsVolumeOperationRequest instance %s/%s, reading it from the API server",
+			instanceKey.Namespace, instanceKey.Name)
+		cached := instance.ResourceVersion
+		instance = &cnsvolumeoperationrequestv1alpha1.CnsVolumeOperationRequest{}
+		err = or.k8sclient.Get(ctx, instanceKey, instance)
+		if apierrors.IsNotFound(err) || (err == nil && instance.ResourceVersion == cached) {
+			or.forgetWrite(name)
+		}
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -132,6 +194,43 @@ func (or *operationRequestStore) GetRequestDetails(ctx context.Context, name str
 		nil
 }
 
+// isCacheBehind returns whether the instance with the given name was stored
+// by this store in a version the cache returned with err hasn't observed yet.
+// The write is forgotten once the cache has observed it.
+func (or *operationRequestStore) isCacheBehind(name string,
+	cached *cnsvolumeoperationrequestv1alpha1.CnsVolumeOperationRequest, err error) bool {
+	or.writtenLock.Lock()
+	defer or.writtenLock.Unlock()
+	resourceVersion, ok := or.written[name]
+	if !ok {
+		return false
+	}
+	if err == nil && cached.ResourceVersion == resourceVersion {
+		delete(or.written, name)
+		return false
+	}
+	return true
+}
+
+// recordWrite records the resource version of the instance stored with the
+// given name.
+func (or *operationRequestStore) recordWrite(name string, resourceVersion string) {
+	or.writtenLock.Lock()
+	defer or.writtenLock.Unlock()
+	if or.written == nil {
+		or.written = make(map[string]string)
+	}
+	or.written[name] = resourceVersion
+}
+
+// forgetWrite forgets the write of the instance with the given name, once
+// the cache is known to be up to date with the API server.
+func (or *operationRequestStore) forgetWrite(name string) {
+	or.writtenLock.Lock()
+	defer or.writtenLock.Unlock()
+	delete(or.written, name)
+}
+
 // StoreRequestDetails persists the details of the operation taking
 // place on the volume by storing it on the API server.
 // Returns an error if any error is encountered. Clients must assume
@@ -156,6 +255,7 @@ func (or *operationRequestStore) StoreRequestDetails(ctx context.Context, operat
 				ObjectMeta: metav1.ObjectMeta{
 					Name:      instanceKey.Name,
 					Namespace: instanceKey.Namespace,
+					Labels:    map[string]string{volumeIDLabel: volumeIDLabelValue(operationToStore.VolumeID)},
 				},
 				Spec: cnsvolumeoperationrequestv1alpha1.CnsVolumeOperationRequestSpec{
 					Name: instanceKey.Name,
@@ -170,11 +270,21 @@ func (or *operationRequestStore) StoreRequestDetails(ctx context.Context, operat
 					},
 				},
 			}
+			// The status of the instance is stored through the status
+			// subresource, once the instance is created.
+			status := newInstance.Status
 			err = or.k8sclient.Create(ctx, newInstance)
 			if err != nil {
 				log.Errorf("failed to create CnsVolumeOperationRequest instance %s/%s with error: %v", instanceKey.Namespace, instanceKey.Name, err)
 				return err
 			}
+			newInstance.Status = status
+			err = or.k8sclient.Status().Update(ctx, newInstance)
+			if err != nil {
+				log.Errorf("failed to update status of CnsVolumeOperationRequest instance %s/%s with error: %v", instanceKey.Namespace, instanceKey.Name, err)
+				return err
+			}
+			or.recordWrite(instanceKey.Name, newInstance.ResourceVersion)
 			log.Debugf("Created CnsVolumeOperationRequest instance %s/%s with latest information for task with ID: %s", instanceKey.Namespace, instanceKey.Name, operationDetailsToStore.TaskID)
 			return nil
 		}
@@ -215,12 +325,29 @@ func (or *operationRequestStore) StoreRequestDetails(ctx context.Context, operat
 		}
 	}
 
-	// Store the local instance on the API server.
-	err := or.k8sclient.Update(ctx, updatedInstance)
+	// Label the instance with the volume ID once the operation has created
+	// the volume. The status of the instance is restored after the update,
+	// as it is stored through the status subresource.
+	if value := volumeIDLabelValue(operationToStore.VolumeID); updatedInstance.Labels[volumeIDLabel] != value {
+		if updatedInstance.Labels == nil {
+			updatedInstance.Labels = make(map[string]string)
+		}
+		updatedInstance.Labels[volumeIDLabel] = value
+		status := updatedInstance.Status
+		if err := or.k8sclient.Update(ctx, updatedInstance); err != nil {
+			log.Errorf("failed to label CnsVolumeOperationRequest instance %s/%s with error: %v", instanceKey.Namespace, instanceKey.Name, err)
+			return err
+		}
+		updatedInstance.Status = status
+	}
+
+	// Store the status of the local instance on the API server.
+	err := or.k8sclient.Status().Update(ctx, updatedInstance)
 	if err != nil {
 		log.Errorf("failed to update CnsVolumeOperationRequest instance %s/%s with error: %v", instanceKey.Namespace, instanceKey.Name, err)
 		return err
 	}
+	or.recordWrite(instanceKey.Name, updatedInstance.ResourceVersion)
 	log.Debugf("Updated CnsVolumeOperationRequest instance %s/%s with latest information for task with ID: %s", instanceKey.Namespace, instanceKey.Name, operationDetailsToStore.TaskID)
 	return nil
 }
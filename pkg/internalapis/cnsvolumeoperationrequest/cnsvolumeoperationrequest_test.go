@@ -0,0 +1,137 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cnsvolumeoperationrequest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	csiconfig "sigs.k8s.io/vsphere-csi-driver/pkg/common/config"
+	cnsvolumeoperationrequestv1alpha1 "sigs.k8s.io/vsphere-csi-driver/pkg/internalapis/cnsvolumeoperationrequest/v1alpha1"
+)
+
+// TestGetRequestDetailsFromCache checks that GetRequestDetails reads from the
+// cache, except the instances stored by the store that the cache hasn't
+// observed yet, and StoreRequestDetails updates the instances on the API
+// server.
+func TestGetRequestDetailsFromCache(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	if err := cnsvolumeoperationrequestv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	k8sclient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		newInstance("pvc-1", "volume-1", taskInvocationStatusInProgress, now)).Build()
+	cacheReader := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		newInstance("pvc-2", "volume-2", "Successful", now)).Build()
+	store := &operationRequestStore{k8sclient: k8sclient, cacheReader: cacheReader}
+
+	details, err := store.GetRequestDetails(ctx, "pvc-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if details.VolumeID != "volume-2" || details.OperationDetails.TaskStatus != "Successful" {
+		t.Errorf("unexpected details of the cached instance: %+v", details)
+	}
+	if _, err = store.GetRequestDetails(ctx, "pvc-1"); !apierrors.IsNotFound(err) {
+		t.Errorf("expected an instance missing from the cache not to be found, got %v", err)
+	}
+
+	// Updates read the instance on the API server, not in the cache.
+	err = store.StoreRequestDetails(ctx, CreateVolumeOperationRequestDetails("pvc-1", "volume-1", "", 0,
+		details.OperationDetails.TaskInvocationTimestamp, "task-pvc-1", "", "Successful", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The stored instance is read from the API server until the cache has
+	// observed the write.
+	details, err = store.GetRequestDetails(ctx, "pvc-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if details.OperationDetails.TaskStatus != "Successful" {
+		t.Errorf("expected the stored status %q, got %q", "Successful", details.OperationDetails.TaskStatus)
+	}
+	store.cacheReader = k8sclient
+	details, err = store.GetRequestDetails(ctx, "pvc-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if details.OperationDetails.TaskStatus != "Successful" {
+		t.Errorf("expected the stored status %q, got %q", "Successful", details.OperationDetails.TaskStatus)
+	}
+	if _, ok := store.written["pvc-1"]; ok {
+		t.Errorf("expected the write of pvc-1 to be forgotten once the cache observed it")
+	}
+}
+
+// TestDeleteVolumeDetails checks that the stored instances are labeled with
+// their volume ID once known, and that only the done instances of the volume
+// are deleted.
+func TestDeleteVolumeDetails(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	if err := cnsvolumeoperationrequestv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	k8sclient := fake.NewClientBuilder().WithScheme(scheme).Build()
+	store := &operationRequestStore{k8sclient: k8sclient, cacheReader: k8sclient}
+	now := metav1.NewTime(time.Now())
+	for _, details := range []*VolumeOperationRequestDetails{
+		CreateVolumeOperationRequestDetails("pvc-1", "", "", 0, now, "task-pvc-1", "", taskInvocationStatusInProgress, ""),
+		CreateVolumeOperationRequestDetails("pvc-1", "file:volume-1", "", 0, now, "task-pvc-1", "", "Successful", ""),
+		CreateVolumeOperationRequestDetails("pvc-2", "file:volume-1", "", 0, now, "task-pvc-2", "",
+			taskInvocationStatusInProgress, ""),
+		CreateVolumeOperationRequestDetails("pvc-3", "volume-3", "", 0, now, "task-pvc-3", "", "Successful", ""),
+	} {
+		if err := store.StoreRequestDetails(ctx, details); err != nil {
+			t.Fatal(err)
+		}
+	}
+	instance := &cnsvolumeoperationrequestv1alpha1.CnsVolumeOperationRequest{}
+	key := client.ObjectKey{Name: "pvc-1", Namespace: csiconfig.DefaultCSINamespace}
+	if err := k8sclient.Get(ctx, key, instance); err != nil {
+		t.Fatal(err)
+	}
+	if value := instance.Labels[volumeIDLabel]; value != "file-volume-1" {
+		t.Errorf("expected instance pvc-1 to be labeled with %q, got %q", "file-volume-1", value)
+	}
+	if instance.Status.VolumeID != "file:volume-1" {
+		t.Errorf("expected the status of instance pvc-1 to be kept when labeling it, got %+v", instance.Status)
+	}
+
+	if err := store.deleteVolumeDetails(ctx, "file:volume-1"); err != nil {
+		t.Fatal(err)
+	}
+	for name, exists := range map[string]bool{"pvc-1": false, "pvc-2": true, "pvc-3": true} {
+		key := client.ObjectKey{Name: name, Namespace: csiconfig.DefaultCSINamespace}
+		err := k8sclient.Get(ctx, key, &cnsvolumeoperationrequestv1alpha1.CnsVolumeOperationRequest{})
+		if exists && err != nil {
+			t.Errorf("expected instance %s to be kept, got %v", name, err)
+		} else if !exists && !apierrors.IsNotFound(err) {
+			t.Errorf("expected instance %s to be deleted, got %v", name, err)
+		}
+	}
+}
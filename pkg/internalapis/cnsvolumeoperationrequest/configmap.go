@@ -0,0 +1,232 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cnsvolumeoperationrequest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+
+	csiconfig "sigs.k8s.io/vsphere-csi-driver/pkg/common/config"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
+	k8s "sigs.k8s.io/vsphere-csi-driver/pkg/kubernetes"
+)
+
+const (
+	// configMapPrefix is the prefix of the names of the ConfigMaps of the
+	// configmap backend, followed by the index of the shard.
+	configMapPrefix = "cnsvolumeoperationrequests-"
+	// configMapShards is the number of ConfigMaps the details of the
+	// operations are spread across, by hash of their name, so that each
+	// ConfigMap stays under the size limit of the objects.
+	configMapShards = 16
+)
+
+// configMapStore implements the VolumeOperationRequest interface for
+// clusters where the driver can't create CRDs. The details of the operations
+// are kept in ConfigMaps in the namespace of the driver, one key per
+// operation. Each read gets the ConfigMap of the operation from the API
+// server, and each write updates the key of the operation in it, retrying on
+// conflicts, so that the details are persisted before the CNS task is invoked
+// and writers never overwrite each other's operations.
+type configMapStore struct {
+	k8sclient clientset.Interface
+}
+
+// initConfigMapStore returns a configMapStore writing to the ConfigMaps of
+// the namespace of the driver.
+func initConfigMapStore(ctx context.Context) (VolumeOperationRequest, error) {
+	log := logger.GetLogger(ctx)
+	k8sclient, err := k8s.NewClient(ctx)
+	if err != nil {
+		log.Errorf("failed to create k8sClient with error: %v", err)
+		return nil, err
+	}
+	return newConfigMapStore(k8sclient), nil
+}
+
+// newConfigMapStore returns a configMapStore using k8sclient.
+func newConfigMapStore(k8sclient clientset.Interface) *configMapStore {
+	return &configMapStore{k8sclient: k8sclient}
+}
+
+// getShard returns the index of the ConfigMap the operation is written to.
+func getShard(name string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(name))
+	return int(h.Sum32() % configMapShards)
+}
+
+// getShardName returns the name of the ConfigMap of the shard.
+func getShardName(shard int) string {
+	return configMapPrefix + fmt.Sprint(shard)
+}
+
+// GetRequestDetails returns the details of the operation with the given name
+// read from its ConfigMap, or a NotFound error.
+func (cs *configMapStore) GetRequestDetails(ctx context.Context, name string) (*VolumeOperationRequestDetails, error) {
+	configMap, err := cs.k8sclient.CoreV1().ConfigMaps(csiconfig.DefaultCSINamespace).Get(ctx,
+		getShardName(getShard(name)), metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+	value, ok := "", false
+	if err == nil {
+		value, ok = configMap.Data[name]
+	}
+	if !ok {
+		return nil, apierrors.NewNotFound(schema.GroupResource{Resource: "configmaps"}, name)
+	}
+	details := &VolumeOperationRequestDetails{}
+	if err := json.Unmarshal([]byte(value), details); err != nil || details.OperationDetails == nil {
+		return nil, fmt.Errorf("invalid details of operation %q in ConfigMap %s/%s. err: %v",
+			name, csiconfig.DefaultCSINamespace, configMap.Name, err)
+	}
+	return details, nil
+}
+
+// StoreRequestDetails writes the details of the operation to its ConfigMap.
+func (cs *configMapStore) StoreRequestDetails(ctx context.Context, operationToStore *VolumeOperationRequestDetails) error {
+	log := logger.GetLogger(ctx)
+	if operationToStore == nil || operationToStore.OperationDetails == nil {
+		msg := "cannot store empty operation"
+		log.Error(msg)
+		return errors.New(msg)
+	}
+	value, err := json.Marshal(operationToStore)
+	if err != nil {
+		return err
+	}
+	err = cs.updateConfigMap(ctx, getShard(operationToStore.Name), func(data map[string]string) bool {
+		data[operationToStore.Name] = string(value)
+		return true
+	})
+	if err != nil {
+		log.Errorf("failed to store the details of operation %q with error: %v", operationToStore.Name, err)
+	}
+	return err
+}
+
+// deleteRequestDetails removes the details of the operations from their
+// ConfigMaps if keep returns false for them. keep is called with the details
+// read in the latest version of the ConfigMaps, so that an operation updated
+// since it was found stale is kept.
+func (cs *configMapStore) deleteRequestDetails(ctx context.Context, names []string,
+	keep func(details *VolumeOperationRequestDetails) bool) error {
+	shards := make(map[int][]string)
+	for _, name := range names {
+		shard := getShard(name)
+		shards[shard] = append(shards[shard], name)
+	}
+	for shard, shardNames := range shards {
+		err := cs.updateConfigMap(ctx, shard, func(data map[string]string) bool {
+			changed := false
+			for _, name := range shardNames {
+				value, ok := data[name]
+				if !ok {
+					continue
+				}
+				details := &VolumeOperationRequestDetails{}
+				if err := json.Unmarshal([]byte(value), details); err == nil && details.OperationDetails != nil &&
+					keep(details) {
+					continue
+				}
+				delete(data, name)
+				changed = true
+			}
+			return changed
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listRequestDetails returns the details of all the operations in the
+// ConfigMaps, by name.
+func (cs *configMapStore) listRequestDetails(ctx context.Context) (map[string]*VolumeOperationRequestDetails, error) {
+	log := logger.GetLogger(ctx)
+	operations := make(map[string]*VolumeOperationRequestDetails)
+	for shard := 0; shard < configMapShards; shard++ {
+		configMap, err := cs.k8sclient.CoreV1().ConfigMaps(csiconfig.DefaultCSINamespace).Get(ctx,
+			getShardName(shard), metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range configMap.Data {
+			details := &VolumeOperationRequestDetails{}
+			if err := json.Unmarshal([]byte(value), details); err != nil || details.OperationDetails == nil {
+				log.Warnf("ignoring invalid details of operation %q in ConfigMap %s/%s. err: %v",
+					key, csiconfig.DefaultCSINamespace, configMap.Name, err)
+				continue
+			}
+			operations[key] = details
+		}
+	}
+	return operations, nil
+}
+
+// updateConfigMap calls update with the data of the latest version of the
+// ConfigMap of the shard, and writes it back if update returns true. The
+// ConfigMap is created if it doesn't exist. The update is retried on
+// conflicts with other writers.
+func (cs *configMapStore) updateConfigMap(ctx context.Context, shard int, update func(data map[string]string) bool) error {
+	configMaps := cs.k8sclient.CoreV1().ConfigMaps(csiconfig.DefaultCSINamespace)
+	name := getShardName(shard)
+	return retry.OnError(retry.DefaultRetry, func(err error) bool {
+		return apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err)
+	}, func() error {
+		configMap, err := configMaps.Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			data := make(map[string]string)
+			if !update(data) {
+				return nil
+			}
+			_, err = configMaps.Create(ctx, &v1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: csiconfig.DefaultCSINamespace},
+				Data:       data,
+			}, metav1.CreateOptions{})
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		if configMap.Data == nil {
+			configMap.Data = make(map[string]string)
+		}
+		if !update(configMap.Data) {
+			return nil
+		}
+		// The update fails with a conflict if the ConfigMap changed since it
+		// was read.
+		_, err = configMaps.Update(ctx, configMap, metav1.UpdateOptions{})
+		return err
+	})
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cnsvolumeoperationrequest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	csiconfig "sigs.k8s.io/vsphere-csi-driver/pkg/common/config"
+)
+
+// TestConfigMapStore checks that the operations are written to the ConfigMaps
+// when they are stored, and that stores sharing the ConfigMaps don't
+// overwrite each other's operations.
+func TestConfigMapStore(t *testing.T) {
+	ctx := context.Background()
+	k8sclient := fake.NewSimpleClientset()
+	store := newConfigMapStore(k8sclient)
+	// Another replica of the controller writing to the same ConfigMaps.
+	other := newConfigMapStore(k8sclient)
+	now := metav1.NewTime(time.Now().Truncate(time.Second))
+	for i := 0; i < 3; i++ {
+		name := fmt.Sprintf("pvc-%d", i)
+		err := store.StoreRequestDetails(ctx, CreateVolumeOperationRequestDetails(name, "volume-"+name, "", 0, now,
+			"task-"+name, "", "Successful", ""))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := other.StoreRequestDetails(ctx, CreateVolumeOperationRequestDetails("pvc-3", "volume-pvc-3", "", 0, now,
+		"task-pvc-3", "", taskInvocationStatusInProgress, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []*configMapStore{store, other} {
+		for i := 0; i < 4; i++ {
+			name := fmt.Sprintf("pvc-%d", i)
+			details, err := s.GetRequestDetails(ctx, name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if details.VolumeID != "volume-"+name || details.OperationDetails.TaskID != "task-"+name ||
+				!details.OperationDetails.TaskInvocationTimestamp.Equal(&now) {
+				t.Errorf("unexpected details of %s: %+v", name, details.OperationDetails)
+			}
+		}
+	}
+	if _, err = store.GetRequestDetails(ctx, "pvc-4"); !apierrors.IsNotFound(err) {
+		t.Errorf("expected pvc-4 not to be found, got %v", err)
+	}
+	configMaps, err := k8sclient.CoreV1().ConfigMaps(csiconfig.DefaultCSINamespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(configMaps.Items) == 0 || len(configMaps.Items) > configMapShards {
+		t.Errorf("expected between 1 and %d ConfigMaps, got %d", configMapShards, len(configMaps.Items))
+	}
+
+	inProgress, err := store.listInProgress(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inProgress) != 1 || inProgress[0].Name != "pvc-3" {
+		t.Errorf("expected pvc-3 to be the only operation in progress, got %+v", inProgress)
+	}
+
+	// The operations of a deleted volume are deleted, unless they are in progress.
+	err = store.StoreRequestDetails(ctx, CreateVolumeOperationRequestDetails("delete-volume-pvc-0", "volume-pvc-0",
+		"", 0, now, "task-delete", "", "Successful", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = DeleteVolumeRequestDetails(ctx, other, "volume-pvc-0"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"pvc-0", "delete-volume-pvc-0"} {
+		if _, err = store.GetRequestDetails(ctx, name); !apierrors.IsNotFound(err) {
+			t.Errorf("expected %s of the deleted volume to be deleted, got %v", name, err)
+		}
+	}
+	if err = DeleteVolumeRequestDetails(ctx, other, "volume-pvc-3"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = store.GetRequestDetails(ctx, "pvc-3"); err != nil {
+		t.Errorf("expected pvc-3 in progress to be kept, got %v", err)
+	}
+
+	// Operations of deleted volumes are cleaned up, unless they are in progress.
+	err = other.cleanupStale(ctx, -1, func(ctx context.Context) (map[string]bool, error) {
+		return map[string]bool{"volume-pvc-2": true}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"pvc-0", "pvc-1"} {
+		if _, err = store.GetRequestDetails(ctx, name); !apierrors.IsNotFound(err) {
+			t.Errorf("expected %s of a deleted volume to be cleaned up, got %v", name, err)
+		}
+	}
+	for _, name := range []string{"pvc-2", "pvc-3"} {
+		if _, err = store.GetRequestDetails(ctx, name); err != nil {
+			t.Errorf("expected %s to be kept, got %v", name, err)
+		}
+	}
+}
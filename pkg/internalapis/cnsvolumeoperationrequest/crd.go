@@ -0,0 +1,126 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cnsvolumeoperationrequest
+
+import (
+	"reflect"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	cnsvolumeoperationrequestv1alpha1 "sigs.k8s.io/vsphere-csi-driver/pkg/internalapis/cnsvolumeoperationrequest/v1alpha1"
+)
+
+// operationDetailsSchema is the schema of the OperationDetails of the
+// CnsVolumeOperationRequest instances.
+var operationDetailsSchema = apiextensionsv1.JSONSchemaProps{
+	Type:     "object",
+	Required: []string{"taskInvocationTimestamp", "taskId"},
+	Properties: map[string]apiextensionsv1.JSONSchemaProps{
+		"taskInvocationTimestamp": {Type: "string", Format: "date-time"},
+		"taskId":                  {Type: "string"},
+		"opId":                    {Type: "string"},
+		"taskStatus":              {Type: "string"},
+		"error":                   {Type: "string"},
+	},
+}
+
+// getCustomResourceDefinition returns the apiextensions/v1 definition of the
+// CnsVolumeOperationRequest CRD, with the structural schema of the instances,
+// the status subresource and printer columns for the latest operation.
+func getCustomResourceDefinition() *apiextensionsv1.CustomResourceDefinition {
+	return &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: crdName,
+		},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Group: cnsvolumeoperationrequestv1alpha1.SchemeGroupVersion.Group,
+			Names: apiextensionsv1.CustomResourceDefinitionNames{
+				Plural:   crdPlural,
+				Singular: crdSingular,
+				Kind:     reflect.TypeOf(cnsvolumeoperationrequestv1alpha1.CnsVolumeOperationRequest{}).Name(),
+				ListKind: reflect.TypeOf(cnsvolumeoperationrequestv1alpha1.CnsVolumeOperationRequestList{}).Name(),
+			},
+			Scope: apiextensionsv1.NamespaceScoped,
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+				{
+					Name:    cnsvolumeoperationrequestv1alpha1.SchemeGroupVersion.Version,
+					Served:  true,
+					Storage: true,
+					Schema: &apiextensionsv1.CustomResourceValidation{
+						OpenAPIV3Schema: &apiextensionsv1.JSONSchemaProps{
+							Type: "object",
+							Properties: map[string]apiextensionsv1.JSONSchemaProps{
+								"apiVersion": {Type: "string"},
+								"kind":       {Type: "string"},
+								"metadata":   {Type: "object"},
+								"spec": {
+									Type:     "object",
+									Required: []string{"name"},
+									Properties: map[string]apiextensionsv1.JSONSchemaProps{
+										"name": {Type: "string"},
+									},
+								},
+								"status": {
+									Type: "object",
+									Properties: map[string]apiextensionsv1.JSONSchemaProps{
+										"volumeID":              {Type: "string"},
+										"snapshotID":            {Type: "string"},
+										"capacity":              {Type: "integer", Format: "int64"},
+										"errorCount":            {Type: "integer"},
+										"firstOperationDetails": operationDetailsSchema,
+										"latestOperationDetails": {
+											Type:  "array",
+											Items: &apiextensionsv1.JSONSchemaPropsOrArray{Schema: &operationDetailsSchema},
+										},
+									},
+								},
+							},
+						},
+					},
+					Subresources: &apiextensionsv1.CustomResourceSubresources{
+						Status: &apiextensionsv1.CustomResourceSubresourceStatus{},
+					},
+					AdditionalPrinterColumns: []apiextensionsv1.CustomResourceColumnDefinition{
+						{
+							Name:     "VolumeID",
+							Type:     "string",
+							JSONPath: ".status.volumeID",
+						},
+						{
+							Name:        "TaskID",
+							Type:        "string",
+							Description: "ID of the task of the latest operation",
+							JSONPath:    ".status.latestOperationDetails[-1:].taskId",
+						},
+						{
+							Name:        "TaskStatus",
+							Type:        "string",
+							Description: "Status of the task of the latest operation",
+							JSONPath:    ".status.latestOperationDetails[-1:].taskStatus",
+						},
+						{
+							Name:     "Age",
+							Type:     "date",
+							JSONPath: ".metadata.creationTimestamp",
+						},
+					},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cnsvolumeoperationrequest
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	structuralschema "k8s.io/apiextensions-apiserver/pkg/apiserver/schema"
+
+	cnsvolumeoperationrequestv1alpha1 "sigs.k8s.io/vsphere-csi-driver/pkg/internalapis/cnsvolumeoperationrequest/v1alpha1"
+)
+
+// checkProperties checks that the schema has a property for each JSON field of
+// the type.
+func checkProperties(t *testing.T, schema apiextensionsv1.JSONSchemaProps, typ reflect.Type) {
+	for i := 0; i < typ.NumField(); i++ {
+		name := strings.Split(typ.Field(i).Tag.Get("json"), ",")[0]
+		if _, ok := schema.Properties[name]; !ok {
+			t.Errorf("field %s.%s is missing from the schema", typ.Name(), name)
+		}
+	}
+}
+
+// TestCustomResourceDefinition checks that the schema of the CRD is
+// structural and has all the fields of the instances.
+func TestCustomResourceDefinition(t *testing.T) {
+	crd := getCustomResourceDefinition()
+	version := crd.Spec.Versions[0]
+	internal := &apiextensions.JSONSchemaProps{}
+	err := apiextensionsv1.Convert_v1_JSONSchemaProps_To_apiextensions_JSONSchemaProps(
+		version.Schema.OpenAPIV3Schema, internal, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	structural, err := structuralschema.NewStructural(internal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := structuralschema.ValidateStructural(nil, structural); len(errs) > 0 {
+		t.Errorf("expected a structural schema, got %v", errs.ToAggregate())
+	}
+
+	schema := version.Schema.OpenAPIV3Schema
+	checkProperties(t, schema.Properties["spec"],
+		reflect.TypeOf(cnsvolumeoperationrequestv1alpha1.CnsVolumeOperationRequestSpec{}))
+	checkProperties(t, schema.Properties["status"],
+		reflect.TypeOf(cnsvolumeoperationrequestv1alpha1.CnsVolumeOperationRequestStatus{}))
+	checkProperties(t, operationDetailsSchema, reflect.TypeOf(cnsvolumeoperationrequestv1alpha1.OperationDetails{}))
+	if version.Subresources == nil || version.Subresources.Status == nil {
+		t.Error("expected the status subresource to be enabled")
+	}
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cnsvolumeoperationrequest
+
+import (
+	"context"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	csiconfig "sigs.k8s.io/vsphere-csi-driver/pkg/common/config"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
+	cnsvolumeoperationrequestv1alpha1 "sigs.k8s.io/vsphere-csi-driver/pkg/internalapis/cnsvolumeoperationrequest/v1alpha1"
+	k8s "sigs.k8s.io/vsphere-csi-driver/pkg/kubernetes"
+)
+
+// ListInProgressOperations returns the details of the operations whose latest
+// task is in progress, read from the API server in the backend set by
+// volumeoperationrequest-backend in the config. It lets the components not
+// invoking the operations, such as the syncer, leave alone the volumes the
+// controller is working on. The VolumeID of the operations creating a volume
+// is empty until their task completes.
+func ListInProgressOperations(ctx context.Context, cfg *csiconfig.Config) ([]*VolumeOperationRequestDetails, error) {
+	log := logger.GetLogger(ctx)
+	if cfg.Global.VolumeOperationRequestBackend == csiconfig.VolumeOperationRequestBackendConfigMap {
+		k8sclient, err := k8s.NewClient(ctx)
+		if err != nil {
+			log.Errorf("failed to create k8sClient with error: %v", err)
+			return nil, err
+		}
+		return newConfigMapStore(k8sclient).listInProgress(ctx)
+	}
+	config, err := k8s.GetKubeConfig(ctx)
+	if err != nil {
+		log.Errorf("failed to get kubeconfig with error: %v", err)
+		return nil, err
+	}
+	k8sclient, err := k8s.NewClientForGroup(ctx, config, cnsvolumeoperationrequestv1alpha1.SchemeGroupVersion.Group)
+	if err != nil {
+		log.Errorf("failed to create k8sClient with error: %v", err)
+		return nil, err
+	}
+	return listInProgressInstances(ctx, k8sclient)
+}
+
+// listInProgress returns the details of the operations in progress in the
+// ConfigMaps.
+func (cs *configMapStore) listInProgress(ctx context.Context) ([]*VolumeOperationRequestDetails, error) {
+	operations, err := cs.listRequestDetails(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var inProgress []*VolumeOperationRequestDetails
+	for _, details := range operations {
+		if details.OperationDetails.TaskStatus == taskInvocationStatusInProgress {
+			inProgress = append(inProgress, details)
+		}
+	}
+	return inProgress, nil
+}
+
+// listInProgressInstances returns the details of the operations in progress
+// of the CnsVolumeOperationRequest instances.
+func listInProgressInstances(ctx context.Context, k8sclient client.Client) ([]*VolumeOperationRequestDetails, error) {
+	instanceList := &cnsvolumeoperationrequestv1alpha1.CnsVolumeOperationRequestList{}
+	if err := k8sclient.List(ctx, instanceList, client.InNamespace(csiconfig.DefaultCSINamespace)); err != nil {
+		return nil, err
+	}
+	var inProgress []*VolumeOperationRequestDetails
+	for _, instance := range instanceList.Items {
+		n := len(instance.Status.LatestOperationDetails)
+		if n == 0 || instance.Status.LatestOperationDetails[n-1].TaskStatus != taskInvocationStatusInProgress {
+			continue
+		}
+		latest := instance.Status.LatestOperationDetails[n-1]
+		inProgress = append(inProgress, CreateVolumeOperationRequestDetails(instance.Spec.Name,
+			instance.Status.VolumeID, instance.Status.SnapshotID, instance.Status.Capacity,
+			latest.TaskInvocationTimestamp, latest.TaskID, latest.OpID, latest.TaskStatus, latest.Error))
+	}
+	return inProgress, nil
+}
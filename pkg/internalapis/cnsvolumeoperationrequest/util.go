@@ -17,6 +17,8 @@ limitations under the License.
 package cnsvolumeoperationrequest
 
 import (
+	"strings"
+
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	cnsvolumeoperationrequestv1alpha1 "sigs.k8s.io/vsphere-csi-driver/pkg/internalapis/cnsvolumeoperationrequest/v1alpha1"
 )
@@ -31,8 +33,34 @@ const (
 	// maxEntriesInLatestOperationDetails specifies the maximum length of
 	// the LatestOperationDetails allowed in a cnsvolumeoperationrequest instance
 	maxEntriesInLatestOperationDetails = 10
+	// taskInvocationStatusInProgress is the status of an operation whose
+	// task is running on vCenter
+	taskInvocationStatusInProgress = "In Progress"
+	// volumeIDLabel is the label of the cnsvolumeoperationrequest instances
+	// set to the volume ID of the operation, see volumeIDLabelValue
+	volumeIDLabel = "cns.vmware.com/volume-id"
+	// maxLabelValueLength is the maximum length of a label value
+	maxLabelValueLength = 63
 )
 
+// volumeIDLabelValue returns the value of volumeIDLabel for volumeID. The
+// characters not allowed in label values, like the colon of file volume IDs,
+// are replaced by dashes, so values may be shared by several volumes and
+// the volume ID of the instances must still be checked.
+func volumeIDLabelValue(volumeID string) string {
+	value := []byte(volumeID)
+	if len(value) > maxLabelValueLength {
+		value = value[:maxLabelValueLength]
+	}
+	for i, c := range value {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+			c == '-' || c == '_' || c == '.') {
+			value[i] = '-'
+		}
+	}
+	return strings.Trim(string(value), "-_.")
+}
+
 // VolumeOperationRequestDetails stores details about a single operation
 // on the given volume. These details are persisted by
 // VolumeOperationRequestInterface and the persisted details will be
@@ -21,10 +21,14 @@ import (
 	"sync"
 	"time"
 
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/client-go/informers"
 	v1 "k8s.io/client-go/informers/core/v1"
 	clientset "k8s.io/client-go/kubernetes"
 	corelisters "k8s.io/client-go/listers/core/v1"
+	storagelisters "k8s.io/client-go/listers/storage/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/sample-controller/pkg/signals"
 )
@@ -39,6 +43,10 @@ const (
 	// as part of NewFilteredConfigMapInformer(). Since we do not anticipate
 	// frequent changes to the configmaps, the resync interval is set to 30 min.
 	resyncPeriodConfigMapInformer = 30 * time.Minute
+	// resyncPeriodSecretInformer is the time interval between each resync
+	// operation for the secret informer, for the same reason as
+	// resyncPeriodConfigMapInformer.
+	resyncPeriodSecretInformer = 30 * time.Minute
 )
 
 var (
@@ -103,6 +111,36 @@ func (im *InformerManager) AddPVListener(add func(obj interface{}), update func(
 	})
 }
 
+// PVVolumeHandleIndex is the name of the index of the PV informer added by
+// AddPVVolumeHandleIndex.
+const PVVolumeHandleIndex = "volumeHandle"
+
+// PVVolumeHandleIndexFunc returns an index function indexing the CSI PVs of
+// the given driver by volume handle.
+func PVVolumeHandleIndexFunc(driver string) cache.IndexFunc {
+	return func(obj interface{}) ([]string, error) {
+		pv, ok := obj.(*corev1.PersistentVolume)
+		if !ok || pv.Spec.CSI == nil || pv.Spec.CSI.Driver != driver {
+			return nil, nil
+		}
+		return []string{pv.Spec.CSI.VolumeHandle}, nil
+	}
+}
+
+// AddPVVolumeHandleIndex indexes the PVs of the given CSI driver by volume
+// handle under PVVolumeHandleIndex, and returns the PV informer. The index
+// can't be added once the PV informer has started, the informer is returned
+// with the error then.
+func (im *InformerManager) AddPVVolumeHandleIndex(driver string) (cache.SharedIndexInformer, error) {
+	informer := im.informerFactory.Core().V1().PersistentVolumes().Informer()
+	if im.pvInformer == nil {
+		im.pvInformer = informer
+	}
+	im.pvSynced = informer.HasSynced
+	err := informer.AddIndexers(cache.Indexers{PVVolumeHandleIndex: PVVolumeHandleIndexFunc(driver)})
+	return informer, err
+}
+
 // AddNamespaceListener hooks up add, update, delete callbacks.
 func (im *InformerManager) AddNamespaceListener(add func(obj interface{}), update func(oldObj, newObj interface{}), remove func(obj interface{})) {
 	if im.namespaceInformer == nil {
@@ -135,6 +173,29 @@ func (im *InformerManager) AddConfigMapListener(ctx context.Context, client clie
 	go im.configMapInformer.Run(stopCh)
 }
 
+// AddSecretListener hooks up add, update, delete callbacks for the secret
+// with the given name and namespace.
+func (im *InformerManager) AddSecretListener(ctx context.Context, client clientset.Interface, namespace string,
+	name string, add func(obj interface{}), update func(oldObj, newObj interface{}), remove func(obj interface{})) {
+	if im.secretInformer == nil {
+		im.secretInformer = v1.NewFilteredSecretInformer(client, namespace, resyncPeriodSecretInformer,
+			cache.Indexers{}, func(options *metav1.ListOptions) {
+				options.FieldSelector = fields.OneTermEqualSelector("metadata.name", name).String()
+			})
+	}
+	im.secretSynced = im.secretInformer.HasSynced
+
+	im.secretInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    add,
+		UpdateFunc: update,
+		DeleteFunc: remove,
+	})
+	stopCh := make(chan struct{})
+	// Since NewFilteredSecretInformer is not part of the informer factory,
+	// we need to invoke the Run() explicitly to start the shared informer.
+	go im.secretInformer.Run(stopCh)
+}
+
 // AddPodListener hooks up add, update, delete callbacks.
 func (im *InformerManager) AddPodListener(add func(obj interface{}), update func(oldObj, newObj interface{}), remove func(obj interface{})) {
 	if im.podInformer == nil {
@@ -169,6 +230,21 @@ func (im *InformerManager) GetPodLister() corelisters.PodLister {
 	return im.informerFactory.Core().V1().Pods().Lister()
 }
 
+// GetNodeLister returns Node Lister for the calling informer manager.
+func (im *InformerManager) GetNodeLister() corelisters.NodeLister {
+	return im.informerFactory.Core().V1().Nodes().Lister()
+}
+
+// GetVolumeAttachmentLister returns VolumeAttachment Lister for the calling informer manager.
+func (im *InformerManager) GetVolumeAttachmentLister() storagelisters.VolumeAttachmentLister {
+	return im.informerFactory.Storage().V1().VolumeAttachments().Lister()
+}
+
+// GetStorageClassLister returns StorageClass Lister for the calling informer manager.
+func (im *InformerManager) GetStorageClassLister() storagelisters.StorageClassLister {
+	return im.informerFactory.Storage().V1().StorageClasses().Lister()
+}
+
 // Listen starts the Informers.
 func (im *InformerManager) Listen() (stopCh <-chan struct{}) {
 	go im.informerFactory.Start(im.stopCh)
@@ -24,9 +24,12 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	vmoperatorv1alpha1 "github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
+	v1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
 	apiextensionsclientset "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
@@ -53,6 +56,7 @@ import (
 	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
 	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/types"
 	internalapis "sigs.k8s.io/vsphere-csi-driver/pkg/internalapis"
+	cnsnodevminfov1alpha1 "sigs.k8s.io/vsphere-csi-driver/pkg/internalapis/cnsnodevminfo/v1alpha1"
 	cnsvolumeoperationrequestv1alpha1 "sigs.k8s.io/vsphere-csi-driver/pkg/internalapis/cnsvolumeoperationrequest/v1alpha1"
 )
 
@@ -179,6 +183,11 @@ func NewClientForGroup(ctx context.Context, config *restclient.Config, groupName
 			log.Errorf("failed to add to scheme with err: %+v", err)
 			return nil, err
 		}
+		err = cnsnodevminfov1alpha1.AddToScheme(scheme)
+		if err != nil {
+			log.Errorf("failed to add to scheme with err: %+v", err)
+			return nil, err
+		}
 	}
 	client, err := client.New(config, client.Options{
 		Scheme: scheme,
@@ -264,11 +273,21 @@ func GetNodeVMUUID(ctx context.Context, k8sclient clientset.Interface, nodeName
 		log.Errorf("failed to get kubernetes node with the name: %q. Err: %v", nodeName, err)
 		return "", err
 	}
-	k8sNodeUUID := cnsvsphere.GetUUIDFromProviderID(node.Spec.ProviderID)
+	k8sNodeUUID := GetNodeUUID(node)
 	log.Infof("Retrieved node UUID: %q for the node: %q", k8sNodeUUID, nodeName)
 	return k8sNodeUUID, nil
 }
 
+// GetNodeUUID returns the vSphere VM UUID of the Kubernetes Node. The UUID is
+// taken from the providerID set by CCM, or from the system UUID reported by
+// the kubelet if the providerID isn't set yet.
+func GetNodeUUID(node *v1.Node) string {
+	if node.Spec.ProviderID != "" {
+		return cnsvsphere.GetUUIDFromProviderID(node.Spec.ProviderID)
+	}
+	return strings.ToLower(node.Status.NodeInfo.SystemUUID)
+}
+
 // getClientThroughput returns the QPS and Burst for the API server client.
 // QPS and Burst default to 50.
 // The maximum accepted value for QPS or Burst is set to 1000.
@@ -306,30 +325,86 @@ func getClientThroughput(ctx context.Context, isSupervisorClient bool) (float32,
 }
 
 // CreateCustomResourceDefinitionFromSpec creates the custom resource definition
-// from given spec. If there is error, function will do the clean up.
+// from given spec. The schema of the CRD preserves unknown fields, so that the
+// instances are stored as they are.
 func CreateCustomResourceDefinitionFromSpec(ctx context.Context, crdName string, crdSingular string, crdPlural string,
-	crdKind string, crdGroup string, crdVersion string, crdScope apiextensionsv1beta1.ResourceScope) error {
-	crdSpec := &apiextensionsv1beta1.CustomResourceDefinition{
+	crdKind string, crdGroup string, crdVersion string, crdScope apiextensionsv1.ResourceScope) error {
+	preserveUnknownFields := true
+	crdSpec := &apiextensionsv1.CustomResourceDefinition{
 		ObjectMeta: metav1.ObjectMeta{
 			Name: crdName,
 		},
-		Spec: apiextensionsv1beta1.CustomResourceDefinitionSpec{
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
 			Group: crdGroup,
-			Versions: []apiextensionsv1beta1.CustomResourceDefinitionVersion{
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
 				{
 					Name:    crdVersion,
 					Served:  true,
 					Storage: true,
+					Schema: &apiextensionsv1.CustomResourceValidation{
+						OpenAPIV3Schema: &apiextensionsv1.JSONSchemaProps{
+							Type:                   "object",
+							XPreserveUnknownFields: &preserveUnknownFields,
+						},
+					},
 				}},
 			Scope: crdScope,
-			Names: apiextensionsv1beta1.CustomResourceDefinitionNames{
+			Names: apiextensionsv1.CustomResourceDefinitionNames{
 				Plural:   crdPlural,
 				Singular: crdSingular,
 				Kind:     crdKind,
 			},
 		},
 	}
-	return createCustomResourceDefinition(ctx, crdSpec)
+	return CreateCustomResourceDefinition(ctx, crdSpec)
+}
+
+// CreateCustomResourceDefinition creates the given apiextensions/v1 custom
+// resource definition on the API server, or updates it if it already exists.
+func CreateCustomResourceDefinition(ctx context.Context, newCrd *apiextensionsv1.CustomResourceDefinition) error {
+	log := logger.GetLogger(ctx)
+	// Get a config to talk to the apiserver.
+	cfg, err := GetKubeConfig(ctx)
+	if err != nil {
+		log.Errorf("failed to get Kubernetes config. Err: %+v", err)
+		return err
+	}
+	apiextensionsClientSet, err := apiextensionsclientset.NewForConfig(cfg)
+	if err != nil {
+		log.Errorf("failed to create Kubernetes client using config. Err: %+v", err)
+		return err
+	}
+
+	crdName := newCrd.ObjectMeta.Name
+	crd, err := apiextensionsClientSet.ApiextensionsV1().CustomResourceDefinitions().Get(ctx, crdName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = apiextensionsClientSet.ApiextensionsV1().CustomResourceDefinitions().Create(ctx, newCrd, metav1.CreateOptions{})
+		if err != nil {
+			log.Errorf("Failed to create %q CRD with err: %+v", crdName, err)
+			return err
+		}
+		log.Infof("%q CRD created successfully", crdName)
+	} else if err != nil {
+		log.Errorf("Failed to get %q CRD with err: %+v", crdName, err)
+		return err
+	} else {
+		// Update the existing CRD with new CRD, which also converts the CRDs
+		// created with apiextensions/v1beta1.
+		crd.Spec = newCrd.Spec
+		_, err = apiextensionsClientSet.ApiextensionsV1().CustomResourceDefinitions().Update(ctx, crd, metav1.UpdateOptions{})
+		if err != nil {
+			log.Errorf("Failed to update %q CRD with err: %+v", crdName, err)
+			return err
+		}
+		log.Infof("%q CRD updated successfully", crdName)
+		return nil
+	}
+
+	err = waitForCustomResourceToBeEstablished(ctx, apiextensionsClientSet, crdName)
+	if err != nil {
+		log.Errorf("CRD %q created but failed to establish. Err: %+v", crdName, err)
+	}
+	return err
 }
 
 // CreateCustomResourceDefinitionFromManifest creates custom resource definition
@@ -395,19 +470,19 @@ func waitForCustomResourceToBeEstablished(ctx context.Context,
 	clientSet apiextensionsclientset.Interface, crdName string) error {
 	log := logger.GetLogger(ctx)
 	err := wait.Poll(pollTime, timeout, func() (bool, error) {
-		crd, err := clientSet.ApiextensionsV1beta1().CustomResourceDefinitions().Get(ctx, crdName, metav1.GetOptions{})
+		crd, err := clientSet.ApiextensionsV1().CustomResourceDefinitions().Get(ctx, crdName, metav1.GetOptions{})
 		if err != nil {
 			log.Errorf("Failed to get %q CRD with err: %+v", crdName, err)
 			return false, err
 		}
 		for _, cond := range crd.Status.Conditions {
 			switch cond.Type {
-			case apiextensionsv1beta1.Established:
-				if cond.Status == apiextensionsv1beta1.ConditionTrue {
+			case apiextensionsv1.Established:
+				if cond.Status == apiextensionsv1.ConditionTrue {
 					return true, err
 				}
-			case apiextensionsv1beta1.NamesAccepted:
-				if cond.Status == apiextensionsv1beta1.ConditionFalse {
+			case apiextensionsv1.NamesAccepted:
+				if cond.Status == apiextensionsv1.ConditionFalse {
 					log.Debugf("Name conflict while waiting for %q CRD creation", cond.Reason)
 				}
 			}
@@ -418,7 +493,7 @@ func waitForCustomResourceToBeEstablished(ctx context.Context,
 	// If there is an error, delete the object to keep it clean.
 	if err != nil {
 		log.Infof("Cleanup %q CRD because the CRD created was not successfully established. Err: %+v", crdName, err)
-		deleteErr := clientSet.ApiextensionsV1beta1().CustomResourceDefinitions().Delete(ctx, crdName, *metav1.NewDeleteOptions(0))
+		deleteErr := clientSet.ApiextensionsV1().CustomResourceDefinitions().Delete(ctx, crdName, *metav1.NewDeleteOptions(0))
 		if deleteErr != nil {
 			log.Errorf("Failed to delete %q CRD with err: %+v", crdName, deleteErr)
 		}
@@ -59,6 +59,11 @@ type InformerManager struct {
 	// Function to determine if configMapInformer has been synced
 	configMapSynced cache.InformerSynced
 
+	// Secret informer
+	secretInformer cache.SharedInformer
+	// Function to determine if secretInformer has been synced
+	secretSynced cache.InformerSynced
+
 	// PV informer
 	pvInformer cache.SharedInformer
 	// Function to determine if pvInformer has been synced
@@ -55,6 +55,15 @@ var (
 	// CO agnostic orchestrator in the admission handler package
 	COInitParams                 *interface{}
 	containerOrchestratorUtility commonco.COCommonInterface
+	// webhookFeatures are the features validated by the webhook
+	webhookFeatures = []string{
+		common.CSIMigration,
+		common.StorageClassParamsValidation,
+		common.PVCModeValidation,
+		common.VolumeDefaultsMutation,
+		common.BlockInTreeVolumeCreation,
+		common.NamespaceStorageQuota,
+	}
 )
 
 // watchConfigChange watches on the webhook configuration directory for changes like cert, key etc.
@@ -139,7 +148,10 @@ func StartWebhookServer(ctx context.Context) error {
 			return err
 		}
 	}
-	if containerOrchestratorUtility.IsFSSEnabled(ctx, common.CSIMigration) {
+	if containerOrchestratorUtility.IsFSSEnabled(ctx, common.StorageClassParamsValidation) && inventory == nil {
+		inventory = vcStorageInventory{}
+	}
+	if isWebhookRequired(ctx) {
 		certs, err := tls.LoadX509KeyPair(cfg.WebHookConfig.CertFile, cfg.WebHookConfig.KeyFile)
 		if err != nil {
 			log.Errorf("failed to load key pair. certFile: %q, keyFile: %q err: %v", cfg.WebHookConfig.CertFile, cfg.WebHookConfig.KeyFile, err)
@@ -155,6 +167,7 @@ func StartWebhookServer(ctx context.Context) error {
 		// define http server and server handler
 		mux := http.NewServeMux()
 		mux.HandleFunc("/validate", validationHandler)
+		mux.HandleFunc("/mutate", mutationHandler)
 		server.Handler = mux
 
 		// start webhook server
@@ -176,6 +189,17 @@ func StartWebhookServer(ctx context.Context) error {
 	return errors.New("can't start webhook. no features are enabled which requires webhook")
 }
 
+// isWebhookRequired reports whether any of the features validated by the
+// webhook is enabled
+func isWebhookRequired(ctx context.Context) bool {
+	for _, feature := range webhookFeatures {
+		if containerOrchestratorUtility.IsFSSEnabled(ctx, feature) {
+			return true
+		}
+	}
+	return false
+}
+
 // restartWebhookServer stops the webhook server and start webhook using updated config
 func restartWebhookServer(ctx context.Context) error {
 	log := logger.GetLogger(ctx)
@@ -194,9 +218,41 @@ func restartWebhookServer(ctx context.Context) error {
 	return StartWebhookServer(ctx)
 }
 
+// admitFunc admits the object of an AdmissionReview request
+type admitFunc func(ctx context.Context, ar *admissionv1.AdmissionReview) *admissionv1.AdmissionResponse
+
 // validationHandler is the handler for webhook http multiplexer to help validate resources
 // depending on the URL validation of AdmissionReview will be redirected to appropriate validation function
 func validationHandler(w http.ResponseWriter, r *http.Request) {
+	serveAdmissionReview(w, r, validate)
+}
+
+// mutationHandler is the handler for webhook http multiplexer to help mutate resources
+func mutationHandler(w http.ResponseWriter, r *http.Request) {
+	serveAdmissionReview(w, r, mutate)
+}
+
+// validate redirects AdmissionReview requests to the validation function of the resource
+func validate(ctx context.Context, ar *admissionv1.AdmissionReview) *admissionv1.AdmissionResponse {
+	log := logger.GetLogger(ctx)
+	switch ar.Request.Kind.Kind {
+	case "StorageClass":
+		return validateStorageClass(ctx, ar)
+	case "PersistentVolumeClaim":
+		return validatePVC(ctx, ar)
+	case "PersistentVolume":
+		return validatePV(ctx, ar)
+	default:
+		log.Infof("Skipping validation for resource type: %q", ar.Request.Kind.Kind)
+		return &admissionv1.AdmissionResponse{
+			Allowed: true,
+		}
+	}
+}
+
+// serveAdmissionReview decodes the AdmissionReview in the request, admits its object with admit
+// and writes the AdmissionReview holding the response
+func serveAdmissionReview(w http.ResponseWriter, r *http.Request, admit admitFunc) {
 	var body []byte
 	ctx, log := logger.GetNewContextWithLogger()
 	if r.Body != nil {
@@ -230,20 +286,10 @@ func validationHandler(w http.ResponseWriter, r *http.Request) {
 			},
 		}
 	} else {
-		if r.URL.Path == "/validate" {
-			log.Debugf("request URL path is /validate")
-			log.Debugf("admissionReview: %+v", ar)
-			switch ar.Request.Kind.Kind {
-			case "StorageClass":
-				admissionResponse = validateStorageClass(ctx, &ar)
-			default:
-				log.Infof("Skipping validation for resource type: %q", ar.Request.Kind.Kind)
-				admissionResponse = &admissionv1.AdmissionResponse{
-					Allowed: true,
-				}
-			}
-			log.Debugf("admissionResponse: %+v", admissionResponse)
-		}
+		log.Debugf("request URL path is %s", r.URL.Path)
+		log.Debugf("admissionReview: %+v", ar)
+		admissionResponse = admit(ctx, &ar)
+		log.Debugf("admissionResponse: %+v", admissionResponse)
 	}
 	admissionReview := admissionv1.AdmissionReview{}
 	admissionReview.APIVersion = "admission.k8s.io/v1"
@@ -45,6 +45,9 @@ type webHookConfig struct {
 	KeyFile string `gcfg:"key-file"`
 	// Port is the webhook port on which http server should be started
 	Port string `gcfg:"port"`
+	// DefaultFsType is the filesystem type set on StorageClasses and PersistentVolumes of the
+	// vSphere CSI driver which don't specify one, when the mutating webhook is enabled
+	DefaultFsType string `gcfg:"default-fstype"`
 }
 
 // getWebHookConfig returns webhook config
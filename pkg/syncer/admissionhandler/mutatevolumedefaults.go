@@ -0,0 +1,239 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admissionhandler
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	v1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/common"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
+)
+
+var (
+	// unsafeMountOptions are the mount options stripped from StorageClasses and
+	// PersistentVolumes. They trade data integrity for performance or keep a
+	// corrupted filesystem in use, and are behind many failures to stage volumes.
+	unsafeMountOptions = parameterSet{
+		"nobarrier":       struct{}{},
+		"barrier=0":       struct{}{},
+		"data=writeback":  struct{}{},
+		"errors=continue": struct{}{},
+		"noload":          struct{}{},
+		"norecovery":      struct{}{},
+	}
+)
+
+// patchOperation is a JSON patch operation
+type patchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// mutate redirects AdmissionReview requests to the mutation function of the resource
+func mutate(ctx context.Context, ar *admissionv1.AdmissionReview) *admissionv1.AdmissionResponse {
+	log := logger.GetLogger(ctx)
+	if containerOrchestratorUtility != nil && !containerOrchestratorUtility.IsFSSEnabled(ctx, common.VolumeDefaultsMutation) {
+		return &admissionv1.AdmissionResponse{
+			Allowed: true,
+		}
+	}
+	req := ar.Request
+	if req.Operation != admissionv1.Create {
+		// The parameters of StorageClasses and the sources of PersistentVolumes can't be changed.
+		return &admissionv1.AdmissionResponse{
+			Allowed: true,
+		}
+	}
+	var patch []patchOperation
+	var err error
+	switch req.Kind.Kind {
+	case "StorageClass":
+		patch, err = mutateStorageClass(ctx, req.Object.Raw)
+	case "PersistentVolume":
+		patch, err = mutatePV(ctx, req.Object.Raw)
+	default:
+		log.Infof("Skipping mutation for resource type: %q", req.Kind.Kind)
+	}
+	if err != nil {
+		return &admissionv1.AdmissionResponse{
+			Result: &metav1.Status{
+				Message: err.Error(),
+			},
+		}
+	}
+	if len(patch) == 0 {
+		return &admissionv1.AdmissionResponse{
+			Allowed: true,
+		}
+	}
+	patchBytes, err := json.Marshal(patch)
+	if err != nil {
+		log.Errorf("Can't encode patch: %v", err)
+		return &admissionv1.AdmissionResponse{
+			Result: &metav1.Status{
+				Message: err.Error(),
+			},
+		}
+	}
+	log.Debugf("patch: %s", string(patchBytes))
+	patchType := admissionv1.PatchTypeJSONPatch
+	return &admissionv1.AdmissionResponse{
+		Allowed:   true,
+		Patch:     patchBytes,
+		PatchType: &patchType,
+	}
+}
+
+// mutateStorageClass returns the patch defaulting the filesystem type and
+// stripping unsafe mount options of a StorageClass using the vSphere CSI
+// provisioner.
+func mutateStorageClass(ctx context.Context, raw []byte) ([]patchOperation, error) {
+	log := logger.GetLogger(ctx)
+	sc := storagev1.StorageClass{}
+	if err := json.Unmarshal(raw, &sc); err != nil {
+		log.Error("error deserializing storage class")
+		return nil, err
+	}
+	if sc.Provisioner != csiProvisioner {
+		return nil, nil
+	}
+	var patch []patchOperation
+	if fsType := defaultFsType(); fsType != "" && !hasFsTypeParam(sc.Parameters) {
+		log.Infof("Defaulting filesystem type of StorageClass %q to %q", sc.Name, fsType)
+		if sc.Parameters == nil {
+			patch = append(patch, patchOperation{
+				Op:    "add",
+				Path:  "/parameters",
+				Value: map[string]string{csiFsTypeParam: fsType},
+			})
+		} else {
+			patch = append(patch, patchOperation{
+				Op:    "add",
+				Path:  "/parameters/" + escapeJSONPointer(csiFsTypeParam),
+				Value: fsType,
+			})
+		}
+	}
+	if op := stripUnsafeMountOptions(ctx, "/mountOptions", sc.MountOptions); op != nil {
+		log.Infof("Stripping unsafe mount options of StorageClass %q", sc.Name)
+		patch = append(patch, *op)
+	}
+	return patch, nil
+}
+
+// mutatePV returns the patch defaulting the filesystem type and stripping
+// unsafe mount options of a statically provisioned PersistentVolume of the
+// vSphere CSI driver.
+func mutatePV(ctx context.Context, raw []byte) ([]patchOperation, error) {
+	log := logger.GetLogger(ctx)
+	pv := v1.PersistentVolume{}
+	if err := json.Unmarshal(raw, &pv); err != nil {
+		log.Error("error deserializing persistent volume")
+		return nil, err
+	}
+	if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != csiProvisioner {
+		return nil, nil
+	}
+	var patch []patchOperation
+	// File volumes are mounted over NFS and raw block volumes aren't mounted,
+	// the filesystem type only applies to mounted block volumes.
+	isBlockVolume := pv.Spec.VolumeMode != nil && *pv.Spec.VolumeMode == v1.PersistentVolumeBlock
+	if fsType := defaultFsType(); fsType != "" && pv.Spec.CSI.FSType == "" && !isBlockVolume && !isFileVolume(pv.Spec.AccessModes) {
+		log.Infof("Defaulting filesystem type of PersistentVolume %q to %q", pv.Name, fsType)
+		patch = append(patch, patchOperation{
+			Op:    "add",
+			Path:  "/spec/csi/fsType",
+			Value: fsType,
+		})
+	}
+	if op := stripUnsafeMountOptions(ctx, "/spec/mountOptions", pv.Spec.MountOptions); op != nil {
+		log.Infof("Stripping unsafe mount options of PersistentVolume %q", pv.Name)
+		patch = append(patch, *op)
+	}
+	return patch, nil
+}
+
+// defaultFsType returns the filesystem type configured for the webhook, or "" if none is.
+func defaultFsType() string {
+	if cfg == nil {
+		return ""
+	}
+	return cfg.WebHookConfig.DefaultFsType
+}
+
+// hasFsTypeParam reports whether the StorageClass parameters specify a filesystem type.
+func hasFsTypeParam(params map[string]string) bool {
+	for param := range params {
+		if param == csiFsTypeParam || strings.ToLower(param) == common.AttributeFsType {
+			return true
+		}
+	}
+	return false
+}
+
+// isFileVolume reports whether a volume with the given access modes is a file volume.
+func isFileVolume(accessModes []v1.PersistentVolumeAccessMode) bool {
+	for _, mode := range accessModes {
+		if mode == v1.ReadWriteMany || mode == v1.ReadOnlyMany {
+			return true
+		}
+	}
+	return false
+}
+
+// stripUnsafeMountOptions returns the operation replacing the mount options at
+// path with the safe ones, or nil if none of them is unsafe.
+func stripUnsafeMountOptions(ctx context.Context, path string, mountOptions []string) *patchOperation {
+	log := logger.GetLogger(ctx)
+	var safe []string
+	stripped := false
+	for _, option := range mountOptions {
+		// An entry may hold several comma separated options.
+		var safeOpts []string
+		for _, opt := range strings.Split(option, ",") {
+			if unsafeMountOptions.Has(strings.ToLower(strings.TrimSpace(opt))) {
+				log.Infof("Stripping unsafe mount option %q", opt)
+				stripped = true
+				continue
+			}
+			safeOpts = append(safeOpts, opt)
+		}
+		if len(safeOpts) != 0 {
+			safe = append(safe, strings.Join(safeOpts, ","))
+		}
+	}
+	if !stripped {
+		return nil
+	}
+	if len(safe) == 0 {
+		return &patchOperation{Op: "remove", Path: path}
+	}
+	return &patchOperation{Op: "replace", Path: path, Value: safe}
+}
+
+// escapeJSONPointer escapes a key for use in a JSON pointer as defined in RFC 6901.
+func escapeJSONPointer(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
@@ -0,0 +1,215 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admissionhandler
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	v1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// mutateObject runs the mutating webhook on the creation of obj and returns the patch it responds with.
+func mutateObject(ctx context.Context, t *testing.T, kind string, obj interface{}) []patchOperation {
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ar := admissionv1.AdmissionReview{
+		Request: &admissionv1.AdmissionRequest{
+			Kind:      metav1.GroupVersionKind{Kind: kind},
+			Operation: admissionv1.Create,
+			Object:    runtime.RawExtension{Raw: raw},
+		},
+	}
+	admissionResponse := mutate(ctx, &ar)
+	if !admissionResponse.Allowed {
+		t.Fatalf("%s rejected. admissionResponse: %v", kind, admissionResponse)
+	}
+	if admissionResponse.Patch == nil {
+		return nil
+	}
+	if admissionResponse.PatchType == nil || *admissionResponse.PatchType != admissionv1.PatchTypeJSONPatch {
+		t.Fatalf("unexpected patch type. admissionResponse: %v", admissionResponse)
+	}
+	var patch []patchOperation
+	if err := json.Unmarshal(admissionResponse.Patch, &patch); err != nil {
+		t.Fatal(err)
+	}
+	return patch
+}
+
+// TestMutateStorageClass is the unit test for mutating StorageClasses using the vSphere CSI provisioner
+func TestMutateStorageClass(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cfg = &config{WebHookConfig: webHookConfig{DefaultFsType: "xfs"}}
+	defer func() {
+		cfg = nil
+	}()
+
+	tests := []struct {
+		name         string
+		provisioner  string
+		params       map[string]string
+		mountOptions []string
+		patch        []patchOperation
+	}{
+		{
+			name:        "no parameters",
+			provisioner: "csi.vsphere.vmware.com",
+			patch: []patchOperation{
+				{Op: "add", Path: "/parameters", Value: map[string]interface{}{"csi.storage.k8s.io/fstype": "xfs"}},
+			},
+		},
+		{
+			name:        "parameters without fstype",
+			provisioner: "csi.vsphere.vmware.com",
+			params:      map[string]string{"storagepolicyname": "vSAN Default Storage Policy"},
+			patch: []patchOperation{
+				{Op: "add", Path: "/parameters/csi.storage.k8s.io~1fstype", Value: "xfs"},
+			},
+		},
+		{
+			name:         "fstype and safe mount options",
+			provisioner:  "csi.vsphere.vmware.com",
+			params:       map[string]string{"csi.storage.k8s.io/fstype": "ext4"},
+			mountOptions: []string{"noatime"},
+		},
+		{
+			name:         "unsafe mount options",
+			provisioner:  "csi.vsphere.vmware.com",
+			params:       map[string]string{"fstype": "ext4"},
+			mountOptions: []string{"noatime,nobarrier", "data=writeback"},
+			patch: []patchOperation{
+				{Op: "replace", Path: "/mountOptions", Value: []interface{}{"noatime"}},
+			},
+		},
+		{
+			name:         "only unsafe mount options",
+			provisioner:  "csi.vsphere.vmware.com",
+			params:       map[string]string{"fstype": "ext4"},
+			mountOptions: []string{"errors=continue"},
+			patch: []patchOperation{
+				{Op: "remove", Path: "/mountOptions"},
+			},
+		},
+		{
+			name:         "other provisioner",
+			provisioner:  "example.com/other",
+			mountOptions: []string{"nobarrier"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			patch := mutateObject(ctx, t, "StorageClass", storagev1.StorageClass{
+				TypeMeta:     metav1.TypeMeta{Kind: "StorageClass", APIVersion: "storage.k8s.io/v1"},
+				ObjectMeta:   metav1.ObjectMeta{Name: "sc"},
+				Provisioner:  test.provisioner,
+				Parameters:   test.params,
+				MountOptions: test.mountOptions,
+			})
+			if !reflect.DeepEqual(patch, test.patch) {
+				t.Fatalf("expected patch %+v, got %+v", test.patch, patch)
+			}
+		})
+	}
+}
+
+// TestMutatePV is the unit test for mutating statically provisioned PersistentVolumes of the vSphere CSI driver
+func TestMutatePV(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cfg = &config{WebHookConfig: webHookConfig{DefaultFsType: "xfs"}}
+	defer func() {
+		cfg = nil
+	}()
+	block := v1.PersistentVolumeBlock
+
+	tests := []struct {
+		name         string
+		driver       string
+		fsType       string
+		accessModes  []v1.PersistentVolumeAccessMode
+		volumeMode   *v1.PersistentVolumeMode
+		mountOptions []string
+		patch        []patchOperation
+	}{
+		{
+			name:         "block volume without fstype",
+			driver:       "csi.vsphere.vmware.com",
+			accessModes:  []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce},
+			mountOptions: []string{"nobarrier"},
+			patch: []patchOperation{
+				{Op: "add", Path: "/spec/csi/fsType", Value: "xfs"},
+				{Op: "remove", Path: "/spec/mountOptions"},
+			},
+		},
+		{
+			name:        "block volume with fstype",
+			driver:      "csi.vsphere.vmware.com",
+			fsType:      "ext4",
+			accessModes: []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce},
+		},
+		{
+			name:        "raw block volume",
+			driver:      "csi.vsphere.vmware.com",
+			accessModes: []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce},
+			volumeMode:  &block,
+		},
+		{
+			name:        "file volume",
+			driver:      "csi.vsphere.vmware.com",
+			accessModes: []v1.PersistentVolumeAccessMode{v1.ReadWriteMany},
+		},
+		{
+			name:         "other driver",
+			driver:       "example.com/other",
+			accessModes:  []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce},
+			mountOptions: []string{"nobarrier"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			patch := mutateObject(ctx, t, "PersistentVolume", v1.PersistentVolume{
+				TypeMeta:   metav1.TypeMeta{Kind: "PersistentVolume", APIVersion: "v1"},
+				ObjectMeta: metav1.ObjectMeta{Name: "pv"},
+				Spec: v1.PersistentVolumeSpec{
+					PersistentVolumeSource: v1.PersistentVolumeSource{
+						CSI: &v1.CSIPersistentVolumeSource{
+							Driver:       test.driver,
+							VolumeHandle: "e4073a6d-642e-4dff-8f4a-b4e3a47c4bbd",
+							FSType:       test.fsType,
+						},
+					},
+					AccessModes:  test.accessModes,
+					VolumeMode:   test.volumeMode,
+					MountOptions: test.mountOptions,
+				},
+			})
+			if !reflect.DeepEqual(patch, test.patch) {
+				t.Fatalf("expected patch %+v, got %+v", test.patch, patch)
+			}
+		})
+	}
+}
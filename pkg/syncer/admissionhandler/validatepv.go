@@ -0,0 +1,98 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admissionhandler
+
+import (
+	"context"
+	"encoding/json"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/common"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
+)
+
+const (
+	csiProvisioner    = "csi.vsphere.vmware.com"
+	inTreeProvisioner = "kubernetes.io/vsphere-volume"
+
+	inTreeStorageClassErrorMessage = "CSI migration is enabled, new StorageClasses can not use the in-tree vSphere " +
+		"provisioner kubernetes.io/vsphere-volume. Use csi.vsphere.vmware.com instead"
+	inTreePVCErrorMessage = "CSI migration is enabled, new volumes can not be provisioned with StorageClasses of the " +
+		"in-tree vSphere provisioner kubernetes.io/vsphere-volume. Use a StorageClass of csi.vsphere.vmware.com instead"
+	inTreePVErrorMessage = "CSI migration is enabled, new PersistentVolumes can not use the in-tree vsphereVolume " +
+		"source. Use a csi source with driver csi.vsphere.vmware.com instead"
+)
+
+// isInTreeVolumeCreationBlocked reports whether the creation of new in-tree
+// vSphere volumes is rejected, so that clusters migrated to CSI don't keep
+// accumulating them.
+func isInTreeVolumeCreationBlocked(ctx context.Context) bool {
+	return containerOrchestratorUtility != nil &&
+		containerOrchestratorUtility.IsFSSEnabled(ctx, common.CSIMigration) &&
+		containerOrchestratorUtility.IsFSSEnabled(ctx, common.BlockInTreeVolumeCreation)
+}
+
+// validatePV helps validate AdmissionReview requests for PersistentVolumes,
+// rejecting new PersistentVolumes with an in-tree vsphereVolume source once
+// CSI migration is enabled.
+func validatePV(ctx context.Context, ar *admissionv1.AdmissionReview) *admissionv1.AdmissionResponse {
+	if !isInTreeVolumeCreationBlocked(ctx) {
+		return &admissionv1.AdmissionResponse{
+			Allowed: true,
+		}
+	}
+	log := logger.GetLogger(ctx)
+	req := ar.Request
+	if req.Kind.Kind != "PersistentVolume" {
+		log.Errorf("Can't validate resource kind: %q using validatePV function", req.Kind.Kind)
+		return &admissionv1.AdmissionResponse{
+			Allowed: false,
+		}
+	}
+	if req.Operation != admissionv1.Create {
+		// Existing in-tree PersistentVolumes keep working through CSI migration.
+		return &admissionv1.AdmissionResponse{
+			Allowed: true,
+		}
+	}
+	pv := v1.PersistentVolume{}
+	if err := json.Unmarshal(req.Object.Raw, &pv); err != nil {
+		log.Error("error deserializing PersistentVolume")
+		return &admissionv1.AdmissionResponse{
+			Result: &metav1.Status{
+				Message: err.Error(),
+			},
+		}
+	}
+	log.Infof("Validating PersistentVolume: %q", pv.Name)
+	if pv.Spec.VsphereVolume != nil {
+		log.Errorf("validation of PersistentVolume: %q Failed", pv.Name)
+		return &admissionv1.AdmissionResponse{
+			Allowed: false,
+			Result: &metav1.Status{
+				Reason: inTreePVErrorMessage,
+			},
+		}
+	}
+	log.Infof("Validation of PersistentVolume: %q Passed", pv.Name)
+	return &admissionv1.AdmissionResponse{
+		Allowed: true,
+	}
+}
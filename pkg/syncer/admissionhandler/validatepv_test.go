@@ -0,0 +1,154 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admissionhandler
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	v1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"sigs.k8s.io/vsphere-csi-driver/pkg/common/unittestcommon"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/common"
+)
+
+// newAdmissionReview returns an AdmissionReview for the given operation on obj.
+func newAdmissionReview(t *testing.T, kind string, operation admissionv1.Operation, obj interface{}) *admissionv1.AdmissionReview {
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &admissionv1.AdmissionReview{
+		Request: &admissionv1.AdmissionRequest{
+			Kind:      metav1.GroupVersionKind{Kind: kind},
+			Operation: operation,
+			Namespace: "default",
+			Object:    runtime.RawExtension{Raw: raw},
+		},
+	}
+}
+
+// TestBlockInTreeVolumeCreation is the unit test for rejecting new in-tree vSphere StorageClasses,
+// PVCs and PersistentVolumes once CSI migration is enabled
+func TestBlockInTreeVolumeCreation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	co, err := unittestcommon.GetFakeContainerOrchestratorInterface(common.Kubernetes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	containerOrchestratorUtility = co
+	k8sClient = fake.NewSimpleClientset(
+		&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "vsphere"}, Provisioner: csiProvisioner},
+		&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "in-tree"}, Provisioner: inTreeProvisioner},
+	)
+	defer func() {
+		containerOrchestratorUtility = nil
+		k8sClient = nil
+	}()
+
+	inTreeSC := storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "in-tree"}, Provisioner: inTreeProvisioner}
+	inTreeSource := v1.PersistentVolumeSource{
+		VsphereVolume: &v1.VsphereVirtualDiskVolumeSource{VolumePath: "[vsanDatastore] kubevols/disk.vmdk"},
+	}
+	csiSource := v1.PersistentVolumeSource{
+		CSI: &v1.CSIPersistentVolumeSource{Driver: csiProvisioner, VolumeHandle: "e4073a6d-642e-4dff-8f4a-b4e3a47c4bbd"},
+	}
+	pvc := func(storageClass string) v1.PersistentVolumeClaim {
+		return v1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: "pvc", Namespace: "default"},
+			Spec: v1.PersistentVolumeClaimSpec{
+				StorageClassName: &storageClass,
+				AccessModes:      []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce},
+			},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		ar     *admissionv1.AdmissionReview
+		admit  admitFunc
+		reason string
+	}{
+		{
+			name:   "create in-tree StorageClass",
+			ar:     newAdmissionReview(t, "StorageClass", admissionv1.Create, inTreeSC),
+			admit:  validateStorageClass,
+			reason: inTreeStorageClassErrorMessage,
+		},
+		{
+			name:  "update in-tree StorageClass",
+			ar:    newAdmissionReview(t, "StorageClass", admissionv1.Update, inTreeSC),
+			admit: validateStorageClass,
+		},
+		{
+			name:   "create PVC of in-tree StorageClass",
+			ar:     newAdmissionReview(t, "PersistentVolumeClaim", admissionv1.Create, pvc("in-tree")),
+			admit:  validatePVC,
+			reason: inTreePVCErrorMessage,
+		},
+		{
+			name:  "create PVC of CSI StorageClass",
+			ar:    newAdmissionReview(t, "PersistentVolumeClaim", admissionv1.Create, pvc("vsphere")),
+			admit: validatePVC,
+		},
+		{
+			name: "create in-tree PV",
+			ar: newAdmissionReview(t, "PersistentVolume", admissionv1.Create, v1.PersistentVolume{
+				ObjectMeta: metav1.ObjectMeta{Name: "pv"},
+				Spec:       v1.PersistentVolumeSpec{PersistentVolumeSource: inTreeSource},
+			}),
+			admit:  validatePV,
+			reason: inTreePVErrorMessage,
+		},
+		{
+			name: "update in-tree PV",
+			ar: newAdmissionReview(t, "PersistentVolume", admissionv1.Update, v1.PersistentVolume{
+				ObjectMeta: metav1.ObjectMeta{Name: "pv"},
+				Spec:       v1.PersistentVolumeSpec{PersistentVolumeSource: inTreeSource},
+			}),
+			admit: validatePV,
+		},
+		{
+			name: "create CSI PV",
+			ar: newAdmissionReview(t, "PersistentVolume", admissionv1.Create, v1.PersistentVolume{
+				ObjectMeta: metav1.ObjectMeta{Name: "pv"},
+				Spec:       v1.PersistentVolumeSpec{PersistentVolumeSource: csiSource},
+			}),
+			admit: validatePV,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			admissionResponse := test.admit(ctx, test.ar)
+			if test.reason == "" {
+				if !admissionResponse.Allowed {
+					t.Fatalf("request rejected. admissionResponse: %v", admissionResponse)
+				}
+			} else if admissionResponse.Allowed || admissionResponse.Result == nil ||
+				string(admissionResponse.Result.Reason) != test.reason {
+				t.Fatalf("expected request to be rejected with %q. admissionResponse: %v", test.reason, admissionResponse)
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admissionhandler
+
+import (
+	"context"
+	"encoding/json"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	v1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/common"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
+	k8s "sigs.k8s.io/vsphere-csi-driver/pkg/kubernetes"
+)
+
+const (
+	blockVolumeAccessModeErrorMessage = "Raw block volumes provisioned by vSphere CSI driver can only be used with " +
+		"ReadWriteOnce access mode, multi-writer block volumes are not supported"
+	readOnlyManyProvisioningErrorMessage = "vSphere CSI driver can not dynamically provision volumes with " +
+		"ReadOnlyMany access mode only, they would be empty. Add ReadWriteMany access mode or bind the PVC to an existing PV"
+)
+
+// k8sClient is the client StorageClasses and PVCs are looked up with.
+var k8sClient clientset.Interface
+
+// validatePVC helps validate AdmissionReview requests for PersistentVolumeClaims
+// to be provisioned by the vSphere CSI driver, rejecting access mode and volume
+// mode combinations the driver can't serve instead of leaving the PVCs Pending,
+// and PVCs created or expanded beyond the storage quota of their namespace.
+func validatePVC(ctx context.Context, ar *admissionv1.AdmissionReview) *admissionv1.AdmissionResponse {
+	modeValidationEnabled := containerOrchestratorUtility == nil ||
+		containerOrchestratorUtility.IsFSSEnabled(ctx, common.PVCModeValidation)
+	inTreeCreationBlocked := isInTreeVolumeCreationBlocked(ctx)
+	quotaEnabled := isStorageQuotaEnabled(ctx)
+	if !modeValidationEnabled && !inTreeCreationBlocked && !quotaEnabled {
+		return &admissionv1.AdmissionResponse{
+			Allowed: true,
+		}
+	}
+	log := logger.GetLogger(ctx)
+	req := ar.Request
+	if req.Kind.Kind != "PersistentVolumeClaim" {
+		log.Errorf("Can't validate resource kind: %q using validatePVC function", req.Kind.Kind)
+		return &admissionv1.AdmissionResponse{
+			Allowed: false,
+		}
+	}
+	if req.Operation != admissionv1.Create && (req.Operation != admissionv1.Update || !quotaEnabled) {
+		// The access modes and volume mode of a PVC can't be changed, only
+		// its requested capacity is checked against the quota on update.
+		return &admissionv1.AdmissionResponse{
+			Allowed: true,
+		}
+	}
+	pvc := v1.PersistentVolumeClaim{}
+	if err := json.Unmarshal(req.Object.Raw, &pvc); err != nil {
+		log.Error("error deserializing PersistentVolumeClaim")
+		return &admissionv1.AdmissionResponse{
+			Result: &metav1.Status{
+				Message: err.Error(),
+			},
+		}
+	}
+	var oldPVC *v1.PersistentVolumeClaim
+	if req.Operation == admissionv1.Update {
+		oldPVC = &v1.PersistentVolumeClaim{}
+		if err := json.Unmarshal(req.OldObject.Raw, oldPVC); err != nil {
+			log.Error("error deserializing PersistentVolumeClaim")
+			return &admissionv1.AdmissionResponse{
+				Result: &metav1.Status{
+					Message: err.Error(),
+				},
+			}
+		}
+		if getPVCExpansionInMb(oldPVC, &pvc) <= 0 {
+			return &admissionv1.AdmissionResponse{
+				Allowed: true,
+			}
+		}
+	}
+	log.Infof("Validating PersistentVolumeClaim: %s/%s", req.Namespace, pvc.Name)
+	if (oldPVC == nil && pvc.Spec.VolumeName != "") || pvc.Spec.StorageClassName == nil ||
+		*pvc.Spec.StorageClassName == "" {
+		// Statically provisioned, the PV decides what the volume supports.
+		return &admissionv1.AdmissionResponse{
+			Allowed: true,
+		}
+	}
+	sc, err := getStorageClass(ctx, *pvc.Spec.StorageClassName)
+	if err != nil {
+		// Don't hold up PVCs while the API server has trouble, the
+		// provisioner reports the error if there is one.
+		log.Errorf("failed to get StorageClass %q of PersistentVolumeClaim %s/%s. err: %v",
+			*pvc.Spec.StorageClassName, req.Namespace, pvc.Name, err)
+		return &admissionv1.AdmissionResponse{
+			Allowed: true,
+		}
+	}
+	provisioner := ""
+	if sc != nil {
+		provisioner = sc.Provisioner
+	}
+	if oldPVC == nil && provisioner == inTreeProvisioner && inTreeCreationBlocked {
+		log.Errorf("validation of PersistentVolumeClaim: %s/%s Failed", req.Namespace, pvc.Name)
+		return &admissionv1.AdmissionResponse{
+			Allowed: false,
+			Result: &metav1.Status{
+				Reason: inTreePVCErrorMessage,
+			},
+		}
+	}
+	if !isProvisionedByCSI(ctx, provisioner) {
+		return &admissionv1.AdmissionResponse{
+			Allowed: true,
+		}
+	}
+	reason := ""
+	if oldPVC == nil && modeValidationEnabled {
+		reason = validatePVCModes(&pvc)
+	}
+	if reason == "" && quotaEnabled {
+		reason, err = validatePVCStorageQuota(ctx, req.Namespace, &pvc, oldPVC, sc.Parameters)
+		if err != nil {
+			// Don't hold up PVCs while the API server has trouble, the
+			// usage of the quotas is checked again for the next PVCs.
+			log.Errorf("failed to check the storage quota of PersistentVolumeClaim %s/%s. err: %v",
+				req.Namespace, pvc.Name, err)
+		}
+	}
+	if reason != "" {
+		log.Errorf("validation of PersistentVolumeClaim: %s/%s Failed", req.Namespace, pvc.Name)
+		return &admissionv1.AdmissionResponse{
+			Allowed: false,
+			Result: &metav1.Status{
+				Reason: metav1.StatusReason(reason),
+			},
+		}
+	}
+	log.Infof("Validation of PersistentVolumeClaim: %s/%s Passed", req.Namespace, pvc.Name)
+	return &admissionv1.AdmissionResponse{
+		Allowed: true,
+	}
+}
+
+// isProvisionedByCSI returns whether the volumes of the StorageClasses with the
+// given provisioner are provisioned by the vSphere CSI driver, directly or
+// through CSI migration.
+func isProvisionedByCSI(ctx context.Context, provisioner string) bool {
+	return provisioner == csiProvisioner || (provisioner == inTreeProvisioner &&
+		(containerOrchestratorUtility == nil || containerOrchestratorUtility.IsFSSEnabled(ctx, common.CSIMigration)))
+}
+
+// getK8sClient returns the client StorageClasses and PVCs are looked up with,
+// creating it on first use.
+func getK8sClient(ctx context.Context) (clientset.Interface, error) {
+	if k8sClient == nil {
+		client, err := k8s.NewClient(ctx)
+		if err != nil {
+			return nil, err
+		}
+		k8sClient = client
+	}
+	return k8sClient, nil
+}
+
+// getStorageClass returns the given StorageClass, or nil if it doesn't exist
+// yet, in which case the PVC stays Pending until it is created.
+func getStorageClass(ctx context.Context, storageClassName string) (*storagev1.StorageClass, error) {
+	client, err := getK8sClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sc, err := client.StorageV1().StorageClasses().Get(ctx, storageClassName, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return sc, nil
+}
+
+// validatePVCModes returns the reason to reject a PVC to be dynamically
+// provisioned by the vSphere CSI driver with, or "" if the driver can serve
+// its access modes and volume mode.
+func validatePVCModes(pvc *v1.PersistentVolumeClaim) string {
+	var readOnlyMany, readWriteMany bool
+	for _, mode := range pvc.Spec.AccessModes {
+		switch mode {
+		case v1.ReadOnlyMany:
+			readOnlyMany = true
+		case v1.ReadWriteMany:
+			readWriteMany = true
+		}
+	}
+	if pvc.Spec.VolumeMode != nil && *pvc.Spec.VolumeMode == v1.PersistentVolumeBlock && (readOnlyMany || readWriteMany) {
+		return blockVolumeAccessModeErrorMessage
+	}
+	if readOnlyMany && !readWriteMany && pvc.Spec.DataSource == nil {
+		return readOnlyManyProvisioningErrorMessage
+	}
+	return ""
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admissionhandler
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	v1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// TestValidatePVC is the unit test for validating admissionReview requests containing
+// PersistentVolumeClaims with different access modes and volume modes
+func TestValidatePVC(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	k8sClient = fake.NewSimpleClientset(
+		&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "vsphere"}, Provisioner: "csi.vsphere.vmware.com"},
+		&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "in-tree"}, Provisioner: "kubernetes.io/vsphere-volume"},
+		&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "other"}, Provisioner: "example.com/other"},
+	)
+	defer func() {
+		k8sClient = nil
+	}()
+	block := v1.PersistentVolumeBlock
+	filesystem := v1.PersistentVolumeFilesystem
+
+	tests := []struct {
+		name         string
+		storageClass string
+		accessModes  []v1.PersistentVolumeAccessMode
+		volumeMode   *v1.PersistentVolumeMode
+		volumeName   string
+		dataSource   *v1.TypedLocalObjectReference
+		// reason is the reason the PVC is rejected with, or "" if it is allowed.
+		reason string
+	}{
+		{
+			name:         "RWO block",
+			storageClass: "vsphere",
+			accessModes:  []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce},
+			volumeMode:   &block,
+		},
+		{
+			name:         "RWX filesystem",
+			storageClass: "vsphere",
+			accessModes:  []v1.PersistentVolumeAccessMode{v1.ReadWriteMany},
+			volumeMode:   &filesystem,
+		},
+		{
+			name:         "RWX block",
+			storageClass: "vsphere",
+			accessModes:  []v1.PersistentVolumeAccessMode{v1.ReadWriteMany},
+			volumeMode:   &block,
+			reason:       blockVolumeAccessModeErrorMessage,
+		},
+		{
+			name:         "RWX block with migrated in-tree StorageClass",
+			storageClass: "in-tree",
+			accessModes:  []v1.PersistentVolumeAccessMode{v1.ReadWriteMany},
+			volumeMode:   &block,
+			reason:       blockVolumeAccessModeErrorMessage,
+		},
+		{
+			name:         "ROX dynamically provisioned",
+			storageClass: "vsphere",
+			accessModes:  []v1.PersistentVolumeAccessMode{v1.ReadOnlyMany},
+			reason:       readOnlyManyProvisioningErrorMessage,
+		},
+		{
+			name:         "ROX and RWX dynamically provisioned",
+			storageClass: "vsphere",
+			accessModes:  []v1.PersistentVolumeAccessMode{v1.ReadOnlyMany, v1.ReadWriteMany},
+		},
+		{
+			name:         "ROX with data source",
+			storageClass: "vsphere",
+			accessModes:  []v1.PersistentVolumeAccessMode{v1.ReadOnlyMany},
+			dataSource:   &v1.TypedLocalObjectReference{Kind: "PersistentVolumeClaim", Name: "source"},
+		},
+		{
+			name:         "ROX statically provisioned",
+			storageClass: "vsphere",
+			accessModes:  []v1.PersistentVolumeAccessMode{v1.ReadOnlyMany},
+			volumeName:   "pv",
+		},
+		{
+			name:         "other provisioner",
+			storageClass: "other",
+			accessModes:  []v1.PersistentVolumeAccessMode{v1.ReadWriteMany},
+			volumeMode:   &block,
+		},
+		{
+			name:         "missing StorageClass",
+			storageClass: "missing",
+			accessModes:  []v1.PersistentVolumeAccessMode{v1.ReadOnlyMany},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			raw, err := json.Marshal(v1.PersistentVolumeClaim{
+				TypeMeta:   metav1.TypeMeta{Kind: "PersistentVolumeClaim", APIVersion: "v1"},
+				ObjectMeta: metav1.ObjectMeta{Name: "pvc", Namespace: "default"},
+				Spec: v1.PersistentVolumeClaimSpec{
+					StorageClassName: &test.storageClass,
+					AccessModes:      test.accessModes,
+					VolumeMode:       test.volumeMode,
+					VolumeName:       test.volumeName,
+					DataSource:       test.dataSource,
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ar := admissionv1.AdmissionReview{
+				Request: &admissionv1.AdmissionRequest{
+					Kind:      metav1.GroupVersionKind{Kind: "PersistentVolumeClaim"},
+					Operation: admissionv1.Create,
+					Namespace: "default",
+					Object:    runtime.RawExtension{Raw: raw},
+				},
+			}
+			admissionResponse := validatePVC(ctx, &ar)
+			if test.reason == "" {
+				if !admissionResponse.Allowed {
+					t.Fatalf("PVC rejected. admissionResponse: %v", admissionResponse)
+				}
+			} else if admissionResponse.Allowed || admissionResponse.Result == nil ||
+				string(admissionResponse.Result.Reason) != test.reason {
+				t.Fatalf("expected PVC to be rejected with %q. admissionResponse: %v", test.reason, admissionResponse)
+			}
+		})
+	}
+}
@@ -48,9 +48,13 @@ const (
 
 // validateStorageClass helps validate AdmissionReview requests for StroageClass
 func validateStorageClass(ctx context.Context, ar *admissionv1.AdmissionReview) *admissionv1.AdmissionResponse {
-	if containerOrchestratorUtility != nil && !containerOrchestratorUtility.IsFSSEnabled(ctx, common.CSIMigration) {
-		// if CSI migration is disabled and webhook is running
-		// skip validation for StorageClass
+	migrationEnabled := containerOrchestratorUtility == nil ||
+		containerOrchestratorUtility.IsFSSEnabled(ctx, common.CSIMigration)
+	paramsValidationEnabled := containerOrchestratorUtility != nil &&
+		containerOrchestratorUtility.IsFSSEnabled(ctx, common.StorageClassParamsValidation)
+	if !migrationEnabled && !paramsValidationEnabled {
+		// if neither CSI migration nor StorageClass parameter validation is
+		// enabled and webhook is running skip validation for StorageClass
 		return &admissionv1.AdmissionResponse{
 			Allowed: true,
 		}
@@ -58,6 +62,7 @@ func validateStorageClass(ctx context.Context, ar *admissionv1.AdmissionReview)
 	log := logger.GetLogger(ctx)
 	req := ar.Request
 	var result *metav1.Status
+	var warnings []string
 	allowed := true
 
 	switch req.Kind.Kind {
@@ -74,22 +79,39 @@ func validateStorageClass(ctx context.Context, ar *admissionv1.AdmissionReview)
 		}
 		log.Infof("Validating StorageClass: %q", sc.Name)
 		// AllowVolumeExpansion check for kubernetes.io/vsphere-volume provisioner
-		if sc.Provisioner == "kubernetes.io/vsphere-volume" {
-			if sc.AllowVolumeExpansion != nil && *sc.AllowVolumeExpansion {
+		if sc.Provisioner == inTreeProvisioner {
+			if req.Operation == admissionv1.Create && isInTreeVolumeCreationBlocked(ctx) {
+				allowed = false
+				result = &metav1.Status{
+					Reason: inTreeStorageClassErrorMessage,
+				}
+			} else if migrationEnabled && sc.AllowVolumeExpansion != nil && *sc.AllowVolumeExpansion {
 				allowed = false
 				result = &metav1.Status{
 					Reason: volumeExpansionErrorMessage,
 				}
 			}
-		} else if sc.Provisioner == "csi.vsphere.vmware.com" {
+		} else if sc.Provisioner == csiProvisioner {
 			// Migration parameters check for csi.vsphere.vmware.com provisioner
-			for param := range sc.Parameters {
-				if unSupportedParameters.Has(param) {
+			if migrationEnabled {
+				for param := range sc.Parameters {
+					if unSupportedParameters.Has(param) {
+						allowed = false
+						result = &metav1.Status{
+							Reason: migrationParamErrorMessage,
+						}
+						break
+					}
+				}
+			}
+			if allowed && paramsValidationEnabled {
+				var reason string
+				reason, warnings = validateStorageClassParams(ctx, sc.Parameters)
+				if reason != "" {
 					allowed = false
 					result = &metav1.Status{
-						Reason: migrationParamErrorMessage,
+						Reason: metav1.StatusReason(reason),
 					}
-					break
 				}
 			}
 		}
@@ -104,7 +126,8 @@ func validateStorageClass(ctx context.Context, ar *admissionv1.AdmissionReview)
 	}
 	// return AdmissionResponse result
 	return &admissionv1.AdmissionResponse{
-		Allowed: allowed,
-		Result:  result,
+		Allowed:  allowed,
+		Result:   result,
+		Warnings: warnings,
 	}
 }
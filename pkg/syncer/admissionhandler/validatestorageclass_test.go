@@ -18,12 +18,19 @@ package admissionhandler
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"strings"
 	"testing"
 
+	vimtypes "github.com/vmware/govmomi/vim25/types"
 	v1 "k8s.io/api/admission/v1"
+	storagev1 "k8s.io/api/storage/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+
+	"sigs.k8s.io/vsphere-csi-driver/pkg/common/unittestcommon"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/common"
 )
 
 var admissionReview = v1.AdmissionReview{
@@ -78,3 +85,226 @@ func TestValidateStorageClassForValidStorageClass(t *testing.T) {
 	}
 	t.Log("TestValidateStorageClassForValidStorageClass Passed")
 }
+
+// fakeStorageInventory is a storageInventory holding datastores by URL and
+// storage policy IDs by name.
+type fakeStorageInventory struct {
+	datastores map[string]vimtypes.ManagedObjectReference
+	policies   map[string]string
+	// compatible lists the IDs of the policies each datastore satisfies.
+	compatible map[string][]string
+	// vcenters has the inventories of the vCenters other than the first, by
+	// host.
+	vcenters map[string]*fakeStorageInventory
+	// err, if set, is returned by every lookup.
+	err error
+}
+
+// forVCenter returns the inventory of the vCenter with the given host, or of
+// the first vCenter if vcenter is "".
+func (inv *fakeStorageInventory) forVCenter(vcenter string) *fakeStorageInventory {
+	if vcenter == "" {
+		return inv
+	}
+	return inv.vcenters[vcenter]
+}
+
+func (inv *fakeStorageInventory) hasVCenter(ctx context.Context, vcenter string) (bool, error) {
+	if inv.err != nil {
+		return false, inv.err
+	}
+	return inv.forVCenter(vcenter) != nil, nil
+}
+
+func (inv *fakeStorageInventory) getDatastore(ctx context.Context, vcenter string, datastoreURL string) (
+	*vimtypes.ManagedObjectReference, error) {
+	if inv.err != nil {
+		return nil, inv.err
+	}
+	if ds, ok := inv.forVCenter(vcenter).datastores[datastoreURL]; ok {
+		return &ds, nil
+	}
+	return nil, nil
+}
+
+func (inv *fakeStorageInventory) getStoragePolicyID(ctx context.Context, vcenter string, storagePolicyName string) (
+	string, error) {
+	if inv.err != nil {
+		return "", inv.err
+	}
+	return inv.forVCenter(vcenter).policies[storagePolicyName], nil
+}
+
+func (inv *fakeStorageInventory) isCompatible(ctx context.Context, vcenter string,
+	datastore vimtypes.ManagedObjectReference, storagePolicyID string) (bool, error) {
+	if inv.err != nil {
+		return false, inv.err
+	}
+	for _, id := range inv.forVCenter(vcenter).compatible[datastore.Value] {
+		if id == storagePolicyID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// TestValidateStorageClassParams is the unit test for validating admissionReview requests containing
+// StorageClasses using the vSphere CSI provisioner with StorageClass parameter validation enabled
+func TestValidateStorageClassParams(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	co, err := unittestcommon.GetFakeContainerOrchestratorInterface(common.Kubernetes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	containerOrchestratorUtility = co
+	fakeInventory := &fakeStorageInventory{
+		datastores: map[string]vimtypes.ManagedObjectReference{
+			"ds:///vmfs/volumes/vsan:1/": {Type: "Datastore", Value: "datastore-1"},
+			"ds:///vmfs/volumes/nfs:2/":  {Type: "Datastore", Value: "datastore-2"},
+		},
+		policies: map[string]string{
+			"vSAN Default Storage Policy": "policy-1",
+		},
+		compatible: map[string][]string{
+			"datastore-1": {"policy-1"},
+		},
+		vcenters: map[string]*fakeStorageInventory{
+			"vc2.example.com": {
+				datastores: map[string]vimtypes.ManagedObjectReference{
+					"ds:///vmfs/volumes/vsan:3/": {Type: "Datastore", Value: "datastore-3"},
+				},
+				policies: map[string]string{
+					"Gold": "policy-2",
+				},
+				compatible: map[string][]string{
+					"datastore-3": {"policy-2"},
+				},
+			},
+		},
+	}
+	inventory = fakeInventory
+	defer func() {
+		containerOrchestratorUtility = nil
+		inventory = nil
+	}()
+
+	tests := []struct {
+		name   string
+		params map[string]string
+		// lookupErr is returned by every lookup of the inventory.
+		lookupErr error
+		// reason is a substring of the reason the StorageClass is rejected
+		// with, or "" if it is allowed.
+		reason   string
+		warnings int
+	}{
+		{
+			name: "valid",
+			params: map[string]string{
+				"datastoreurl":              "ds:///vmfs/volumes/vsan:1/",
+				"storagepolicyname":         "vSAN Default Storage Policy",
+				"csi.storage.k8s.io/fstype": "ext4",
+			},
+		},
+		{
+			name:   "unknown parameter",
+			params: map[string]string{"storagepolicynmae": "vSAN Default Storage Policy"},
+			reason: "storagepolicynmae",
+		},
+		{
+			name:   "conflicting filesystem types",
+			params: map[string]string{"fstype": "ext4", "csi.storage.k8s.io/fstype": "xfs"},
+			reason: "different filesystem types",
+		},
+		{
+			name:   "volume name template",
+			params: map[string]string{"volumenametemplate": "${pvc.namespace}-${pvc.name}"},
+		},
+		{
+			name:   "volume name template with PVC labels",
+			params: map[string]string{"volumenametemplate": "${pvc.namespace}-${pvc.labels['app']}"},
+			reason: "unsupported variable",
+		},
+		{
+			name:   "unsupported volume name template variable",
+			params: map[string]string{"volumenametemplate": "${pvc.uid}"},
+			reason: "unsupported variable",
+		},
+		{
+			name:   "datastore not found",
+			params: map[string]string{"datastoreurl": "ds:///vmfs/volumes/vsan:3/"},
+			reason: "Datastore \"ds:///vmfs/volumes/vsan:3/\" not found",
+		},
+		{
+			name:   "storage policy not found",
+			params: map[string]string{"storagepolicyname": "Gold"},
+			reason: "Storage policy \"Gold\" not found",
+		},
+		{
+			name: "incompatible datastore",
+			params: map[string]string{
+				"datastoreurl":      "ds:///vmfs/volumes/nfs:2/",
+				"storagepolicyname": "vSAN Default Storage Policy",
+			},
+			reason: "is not compatible with storage policy",
+		},
+		{
+			name: "datastore and storage policy of another vCenter",
+			params: map[string]string{
+				"vcenter":           "vc2.example.com",
+				"datastoreurl":      "ds:///vmfs/volumes/vsan:3/",
+				"storagepolicyname": "Gold",
+			},
+		},
+		{
+			name: "datastore of the first vCenter in another vCenter",
+			params: map[string]string{
+				"vcenter":      "vc2.example.com",
+				"datastoreurl": "ds:///vmfs/volumes/vsan:1/",
+			},
+			reason: "Datastore \"ds:///vmfs/volumes/vsan:1/\" not found",
+		},
+		{
+			name:   "vCenter not in the config secret",
+			params: map[string]string{"vcenter": "vc3.example.com", "storagepolicyname": "Gold"},
+			reason: "vCenter \"vc3.example.com\" isn't in the vsphere config secret",
+		},
+		{
+			name: "vCenter unreachable",
+			params: map[string]string{
+				"datastoreurl":      "ds:///vmfs/volumes/vsan:1/",
+				"storagepolicyname": "vSAN Default Storage Policy",
+			},
+			lookupErr: errors.New("connection refused"),
+			warnings:  2,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fakeInventory.err = test.lookupErr
+			raw, err := json.Marshal(storagev1.StorageClass{
+				TypeMeta:    metav1.TypeMeta{Kind: "StorageClass", APIVersion: "storage.k8s.io/v1"},
+				ObjectMeta:  metav1.ObjectMeta{Name: "sc"},
+				Provisioner: "csi.vsphere.vmware.com",
+				Parameters:  test.params,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			admissionReview.Request.Object = runtime.RawExtension{Raw: raw}
+			admissionResponse := validateStorageClass(ctx, &admissionReview)
+			if test.reason == "" {
+				if !admissionResponse.Allowed {
+					t.Fatalf("StorageClass rejected. admissionResponse: %v", admissionResponse)
+				}
+			} else if admissionResponse.Allowed || admissionResponse.Result == nil ||
+				!strings.Contains(string(admissionResponse.Result.Reason), test.reason) {
+				t.Fatalf("expected StorageClass to be rejected with %q. admissionResponse: %v", test.reason, admissionResponse)
+			}
+			if len(admissionResponse.Warnings) != test.warnings {
+				t.Fatalf("expected %d warnings, got %v", test.warnings, admissionResponse.Warnings)
+			}
+		})
+	}
+}
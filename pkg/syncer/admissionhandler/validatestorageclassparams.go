@@ -0,0 +1,280 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admissionhandler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	vimtypes "github.com/vmware/govmomi/vim25/types"
+
+	cnsvsphere "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/vsphere"
+	cnsconfig "sigs.k8s.io/vsphere-csi-driver/pkg/common/config"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/common"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
+)
+
+const (
+	// csiParamPrefix is the prefix of the StorageClass parameters consumed by the
+	// external-provisioner. They are never passed to the driver.
+	csiParamPrefix = "csi.storage.k8s.io/"
+	// csiFsTypeParam is the StorageClass parameter the external-provisioner
+	// takes the filesystem type of the volume from.
+	csiFsTypeParam = csiParamPrefix + "fstype"
+	// pbmProfileNotFoundMessage is the message the PBM client fails with when
+	// no storage policy has the requested name.
+	pbmProfileNotFoundMessage = "no pbm profile found with name"
+)
+
+// storageInventory looks up the vCenter objects the parameters of a
+// StorageClass refer to. The vcenter argument is the host of the vCenter the
+// objects are looked up in, or "" for the first vCenter of the config secret.
+type storageInventory interface {
+	// hasVCenter reports whether the config secret has a vCenter with the
+	// given host.
+	hasVCenter(ctx context.Context, vcenter string) (bool, error)
+	// getDatastore returns the datastore with the given URL, or nil if no
+	// datacenter of the vCenter has one.
+	getDatastore(ctx context.Context, vcenter string, datastoreURL string) (*vimtypes.ManagedObjectReference, error)
+	// getStoragePolicyID returns the ID of the storage policy with the given
+	// name, or "" if there is none.
+	getStoragePolicyID(ctx context.Context, vcenter string, storagePolicyName string) (string, error)
+	// isCompatible reports whether the datastore satisfies the storage policy.
+	isCompatible(ctx context.Context, vcenter string, datastore vimtypes.ManagedObjectReference,
+		storagePolicyID string) (bool, error)
+}
+
+// inventory is the storageInventory StorageClass parameters are validated
+// against. It is nil until the webhook server starts with
+// StorageClassParamsValidation enabled.
+var inventory storageInventory
+
+// vcStorageInventory is the storageInventory of the vCenters the driver is
+// configured with.
+type vcStorageInventory struct{}
+
+// vcenterConfig returns the config of the vCenter of the config secret with
+// the given host, or nil if there is none.
+func (vcStorageInventory) vcenterConfig(ctx context.Context, configInfo *cnsconfig.ConfigurationInfo,
+	vcenter string) (*cnsvsphere.VirtualCenterConfig, error) {
+	vcConfigs, err := cnsvsphere.GetVirtualCenterConfigs(ctx, configInfo.Cfg)
+	if err != nil {
+		return nil, err
+	}
+	for _, vcConfig := range vcConfigs {
+		if vcConfig.Host == vcenter {
+			return vcConfig, nil
+		}
+	}
+	return nil, nil
+}
+
+// virtualCenter returns the connected instance of the vCenter with the given
+// host, or of the first vCenter of the config secret if vcenter is "". The
+// other vCenters are registered if they aren't yet.
+func (inv vcStorageInventory) virtualCenter(ctx context.Context, vcenter string) (*cnsvsphere.VirtualCenter, error) {
+	configInfo, err := common.InitConfigInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	vc, err := cnsvsphere.GetVirtualCenterInstance(ctx, configInfo, false)
+	if err != nil {
+		return nil, err
+	}
+	if vcenter != "" && vcenter != vc.Config.Host {
+		vcConfig, err := inv.vcenterConfig(ctx, configInfo, vcenter)
+		if err != nil {
+			return nil, err
+		}
+		if vcConfig == nil {
+			return nil, fmt.Errorf("vCenter %q isn't in the vsphere config secret", vcenter)
+		}
+		vcenterManager := cnsvsphere.GetVirtualCenterManager(ctx)
+		vc, err = vcenterManager.GetVirtualCenter(ctx, vcenter)
+		if err == cnsvsphere.ErrVCNotFound {
+			vc, err = vcenterManager.RegisterVirtualCenter(ctx, vcConfig)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err = vc.Connect(ctx); err != nil {
+		return nil, err
+	}
+	return vc, nil
+}
+
+func (inv vcStorageInventory) hasVCenter(ctx context.Context, vcenter string) (bool, error) {
+	configInfo, err := common.InitConfigInfo(ctx)
+	if err != nil {
+		return false, err
+	}
+	vcConfig, err := inv.vcenterConfig(ctx, configInfo, vcenter)
+	if err != nil {
+		return false, err
+	}
+	return vcConfig != nil, nil
+}
+
+func (inv vcStorageInventory) getDatastore(ctx context.Context, vcenter string, datastoreURL string) (
+	*vimtypes.ManagedObjectReference, error) {
+	vc, err := inv.virtualCenter(ctx, vcenter)
+	if err != nil {
+		return nil, err
+	}
+	datacenters, err := vc.GetDatacenters(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, dc := range datacenters {
+		datastores, err := dc.GetAllDatastores(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if dsInfo, ok := datastores[datastoreURL]; ok {
+			ref := dsInfo.Datastore.Reference()
+			return &ref, nil
+		}
+	}
+	return nil, nil
+}
+
+func (inv vcStorageInventory) getStoragePolicyID(ctx context.Context, vcenter string, storagePolicyName string) (
+	string, error) {
+	vc, err := inv.virtualCenter(ctx, vcenter)
+	if err != nil {
+		return "", err
+	}
+	storagePolicyID, err := vc.GetStoragePolicyIDByName(ctx, storagePolicyName)
+	if err != nil {
+		if strings.Contains(err.Error(), pbmProfileNotFoundMessage) {
+			return "", nil
+		}
+		return "", err
+	}
+	return storagePolicyID, nil
+}
+
+func (inv vcStorageInventory) isCompatible(ctx context.Context, vcenter string, datastore vimtypes.ManagedObjectReference,
+	storagePolicyID string) (bool, error) {
+	vc, err := inv.virtualCenter(ctx, vcenter)
+	if err != nil {
+		return false, err
+	}
+	if err = vc.ConnectPbm(ctx); err != nil {
+		return false, err
+	}
+	result, err := vc.PbmCheckCompatibility(ctx, []vimtypes.ManagedObjectReference{datastore}, storagePolicyID)
+	if err != nil {
+		return false, err
+	}
+	return len(result.CompatibleDatastores()) != 0, nil
+}
+
+// validateStorageClassParams validates the parameters of a StorageClass using
+// the vSphere CSI provisioner the way CreateVolume will parse them, so that
+// typos and dangling references are reported when the StorageClass is
+// created rather than when the first PVC using it fails to provision.
+// It returns the reason to reject the StorageClass with, or "" if the
+// parameters are valid, along with warnings for the checks that couldn't be
+// performed.
+func validateStorageClassParams(ctx context.Context, params map[string]string) (string, []string) {
+	log := logger.GetLogger(ctx)
+	driverParams := make(map[string]string)
+	for param, value := range params {
+		if !strings.HasPrefix(param, csiParamPrefix) {
+			driverParams[param] = value
+		}
+	}
+	csiMigrationEnabled := containerOrchestratorUtility != nil &&
+		containerOrchestratorUtility.IsFSSEnabled(ctx, common.CSIMigration)
+	scParams, err := common.ParseStorageClassParams(ctx, driverParams, csiMigrationEnabled)
+	if err != nil {
+		return fmt.Sprintf("Invalid StorageClass Parameters. %v", err), nil
+	}
+	if err = common.ValidateVolumeNameTemplate(scParams.VolumeNameTemplate); err != nil {
+		return fmt.Sprintf("Invalid StorageClass Parameters. %v", err), nil
+	}
+
+	// Incompatible combinations.
+	var fsType string
+	for param, value := range driverParams {
+		if strings.ToLower(param) == common.AttributeFsType {
+			fsType = value
+		}
+	}
+	if csiFsType, ok := params[csiFsTypeParam]; ok && fsType != "" && !strings.EqualFold(fsType, csiFsType) {
+		return fmt.Sprintf("Invalid StorageClass Parameters. %q and %q specify different filesystem types: %q and %q",
+			common.AttributeFsType, csiFsTypeParam, fsType, csiFsType), nil
+	}
+
+	if inventory == nil {
+		return "", nil
+	}
+	// Existence of the vCenter, and of the datastore and storage policy in
+	// it. Failing to look them up doesn't reject the StorageClass, CreateVolume
+	// will retry the lookups.
+	var warnings []string
+	if scParams.VCenter != "" {
+		found, err := inventory.hasVCenter(ctx, scParams.VCenter)
+		if err != nil {
+			log.Errorf("failed to look up vCenter %q. err: %v", scParams.VCenter, err)
+			return "", []string{fmt.Sprintf("could not verify that vCenter %q exists: %v", scParams.VCenter, err)}
+		}
+		if !found {
+			return fmt.Sprintf("Invalid StorageClass Parameters. vCenter %q isn't in the vsphere config secret",
+				scParams.VCenter), nil
+		}
+	}
+	if scParams.DatastoreURL == "" && scParams.StoragePolicyName == "" {
+		return "", nil
+	}
+	var datastore *vimtypes.ManagedObjectReference
+	if scParams.DatastoreURL != "" {
+		datastore, err = inventory.getDatastore(ctx, scParams.VCenter, scParams.DatastoreURL)
+		if err != nil {
+			log.Errorf("failed to look up datastore %q. err: %v", scParams.DatastoreURL, err)
+			warnings = append(warnings, fmt.Sprintf("could not verify that datastore %q exists: %v", scParams.DatastoreURL, err))
+		} else if datastore == nil {
+			return fmt.Sprintf("Invalid StorageClass Parameters. Datastore %q not found", scParams.DatastoreURL), nil
+		}
+	}
+	var storagePolicyID string
+	if scParams.StoragePolicyName != "" {
+		storagePolicyID, err = inventory.getStoragePolicyID(ctx, scParams.VCenter, scParams.StoragePolicyName)
+		if err != nil {
+			log.Errorf("failed to look up storage policy %q. err: %v", scParams.StoragePolicyName, err)
+			warnings = append(warnings, fmt.Sprintf("could not verify that storage policy %q exists: %v", scParams.StoragePolicyName, err))
+		} else if storagePolicyID == "" {
+			return fmt.Sprintf("Invalid StorageClass Parameters. Storage policy %q not found", scParams.StoragePolicyName), nil
+		}
+	}
+	if datastore != nil && storagePolicyID != "" {
+		compatible, err := inventory.isCompatible(ctx, scParams.VCenter, *datastore, storagePolicyID)
+		if err != nil {
+			log.Errorf("failed to check compatibility of datastore %q with storage policy %q. err: %v",
+				scParams.DatastoreURL, scParams.StoragePolicyName, err)
+			warnings = append(warnings, fmt.Sprintf("could not verify that datastore %q is compatible with storage policy %q: %v",
+				scParams.DatastoreURL, scParams.StoragePolicyName, err))
+		} else if !compatible {
+			return fmt.Sprintf("Invalid StorageClass Parameters. Datastore %q is not compatible with storage policy %q",
+				scParams.DatastoreURL, scParams.StoragePolicyName), nil
+		}
+	}
+	return "", warnings
+}
@@ -0,0 +1,237 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admissionhandler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	clientconfig "sigs.k8s.io/controller-runtime/pkg/client/config"
+
+	cnsoperatorv1alpha1 "sigs.k8s.io/vsphere-csi-driver/pkg/apis/cnsoperator"
+	cnsstoragequotav1alpha1 "sigs.k8s.io/vsphere-csi-driver/pkg/apis/cnsoperator/cnsstoragequota/v1alpha1"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/common"
+	k8s "sigs.k8s.io/vsphere-csi-driver/pkg/kubernetes"
+)
+
+// cnsOperatorClient is the client the CnsStorageQuota instances are listed with.
+var cnsOperatorClient client.Client
+
+// quotaClaim is a PVC of the namespace whose capacity may not be counted in
+// the usage of the CnsStorageQuota instances yet.
+type quotaClaim struct {
+	storagePolicyName string
+	datastoreURL      string
+	requestedInMb     int64
+	pending           bool
+	created           metav1.Time
+}
+
+// isStorageQuotaEnabled reports whether the PVCs exceeding the storage quota
+// of their namespace are rejected.
+func isStorageQuotaEnabled(ctx context.Context) bool {
+	return containerOrchestratorUtility != nil &&
+		containerOrchestratorUtility.IsFSSEnabled(ctx, common.NamespaceStorageQuota)
+}
+
+// getCnsOperatorClient returns the client the CnsStorageQuota instances are
+// listed with, creating it on first use.
+func getCnsOperatorClient(ctx context.Context) (client.Client, error) {
+	if cnsOperatorClient == nil {
+		restConfig, err := clientconfig.GetConfig()
+		if err != nil {
+			return nil, err
+		}
+		c, err := k8s.NewClientForGroup(ctx, restConfig, cnsoperatorv1alpha1.GroupName)
+		if err != nil {
+			return nil, err
+		}
+		cnsOperatorClient = c
+	}
+	return cnsOperatorClient, nil
+}
+
+// getQuotaParams returns the storage policy name and the datastore URL of the
+// volumes provisioned with the given StorageClass parameters.
+func getQuotaParams(params map[string]string) (string, string) {
+	var storagePolicyName, datastoreURL string
+	for param, value := range params {
+		switch strings.ToLower(param) {
+		case common.AttributeStoragePolicyName:
+			storagePolicyName = value
+		case common.AttributeDatastoreURL:
+			datastoreURL = value
+		}
+	}
+	return storagePolicyName, datastoreURL
+}
+
+// validatePVCStorageQuota returns the reason to reject a PVC to be created in
+// namespace with the StorageClass parameters params, or to be expanded from
+// oldPVC if not nil, or "" if its requested capacity, or the one it is
+// expanded by, fits in the limits of the CnsStorageQuota instances of the
+// namespace. The capacity used for a limit is the one computed by the syncer,
+// plus the capacity requested by the PVCs still pending or created since.
+//
+// The quota is best effort: nothing is reserved until the syncer computes the
+// usage again, so PVCs created or expanded concurrently are each checked
+// against the same usage and may together exceed the limits.
+func validatePVCStorageQuota(ctx context.Context, namespace string, pvc *v1.PersistentVolumeClaim,
+	oldPVC *v1.PersistentVolumeClaim, params map[string]string) (string, error) {
+	c, err := getCnsOperatorClient(ctx)
+	if err != nil {
+		return "", err
+	}
+	quotaList := &cnsstoragequotav1alpha1.CnsStorageQuotaList{}
+	if err := c.List(ctx, quotaList, client.InNamespace(namespace)); err != nil {
+		return "", err
+	}
+	if len(quotaList.Items) == 0 {
+		return "", nil
+	}
+	// The capacity of an expanded PVC is already counted like the one of the
+	// other PVCs, only the capacity it is expanded by is requested.
+	excludedPVC := pvc.Name
+	requested := pvc.Spec.Resources.Requests[v1.ResourceStorage]
+	requestedInMb := common.RoundUpSize(requested.Value(), common.MbInBytes)
+	if oldPVC != nil {
+		excludedPVC = ""
+		requestedInMb = getPVCExpansionInMb(oldPVC, pvc)
+	}
+	claims, err := getQuotaClaims(ctx, namespace, excludedPVC)
+	if err != nil {
+		return "", err
+	}
+	storagePolicyName, datastoreURL := getQuotaParams(params)
+	for i := range quotaList.Items {
+		quota := &quotaList.Items[i]
+		for _, limit := range quota.Spec.Limits {
+			if !limit.Matches(storagePolicyName, datastoreURL) {
+				continue
+			}
+			used := getQuotaUsedInMb(quota, limit, claims)
+			if used+requestedInMb > limit.LimitInMb {
+				return fmt.Sprintf("PersistentVolumeClaim exceeds CnsStorageQuota %s/%s for %s: "+
+					"%d Mb requested, %d Mb of %d Mb used", quota.Namespace, quota.Name, describeQuotaLimit(limit),
+					requestedInMb, used, limit.LimitInMb), nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// getPVCExpansionInMb returns the capacity in Mb the requested capacity of the
+// PVC is increased by from oldPVC, or a negative or zero value if it isn't.
+func getPVCExpansionInMb(oldPVC *v1.PersistentVolumeClaim, pvc *v1.PersistentVolumeClaim) int64 {
+	oldRequested := oldPVC.Spec.Resources.Requests[v1.ResourceStorage]
+	requested := pvc.Spec.Resources.Requests[v1.ResourceStorage]
+	return common.RoundUpSize(requested.Value(), common.MbInBytes) -
+		common.RoundUpSize(oldRequested.Value(), common.MbInBytes)
+}
+
+// getQuotaClaims returns the PVCs of the namespace, other than the one named
+// name, to be provisioned by the vSphere CSI driver.
+func getQuotaClaims(ctx context.Context, namespace string, name string) ([]quotaClaim, error) {
+	k8sclient, err := getK8sClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pvcList, err := k8sclient.CoreV1().PersistentVolumeClaims(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	params := make(map[string]map[string]string)
+	var claims []quotaClaim
+	for _, pvc := range pvcList.Items {
+		if pvc.Name == name || pvc.Spec.StorageClassName == nil || *pvc.Spec.StorageClassName == "" {
+			continue
+		}
+		scName := *pvc.Spec.StorageClassName
+		scParams, ok := params[scName]
+		if !ok {
+			sc, err := getStorageClass(ctx, scName)
+			if err != nil {
+				return nil, err
+			}
+			if sc != nil && isProvisionedByCSI(ctx, sc.Provisioner) {
+				scParams = sc.Parameters
+				if scParams == nil {
+					scParams = make(map[string]string)
+				}
+			}
+			params[scName] = scParams
+		}
+		if scParams == nil {
+			// Not provisioned by the vSphere CSI driver.
+			continue
+		}
+		storagePolicyName, datastoreURL := getQuotaParams(scParams)
+		requested := pvc.Spec.Resources.Requests[v1.ResourceStorage]
+		claims = append(claims, quotaClaim{
+			storagePolicyName: storagePolicyName,
+			datastoreURL:      datastoreURL,
+			requestedInMb:     common.RoundUpSize(requested.Value(), common.MbInBytes),
+			pending:           pvc.Status.Phase == v1.ClaimPending,
+			created:           pvc.CreationTimestamp,
+		})
+	}
+	return claims, nil
+}
+
+// getQuotaUsedInMb returns the capacity used for the limit of the quota: the
+// usage computed by the syncer, plus the capacity requested by the claims the
+// limit applies to which are pending or were created after the usage was
+// computed. The capacity requested by all the claims is used if the usage was
+// never computed.
+func getQuotaUsedInMb(quota *cnsstoragequotav1alpha1.CnsStorageQuota,
+	limit cnsstoragequotav1alpha1.CnsStorageQuotaLimit, claims []quotaClaim) int64 {
+	var used int64
+	for _, usage := range quota.Status.Usage {
+		if usage.StoragePolicyName == limit.StoragePolicyName && usage.DatastoreURL == limit.DatastoreURL {
+			used = usage.UsedInMb
+			break
+		}
+	}
+	lastSyncTime := quota.Status.LastSyncTime
+	for _, claim := range claims {
+		if !limit.Matches(claim.storagePolicyName, claim.datastoreURL) {
+			continue
+		}
+		if claim.pending || lastSyncTime == nil || lastSyncTime.Before(&claim.created) {
+			used += claim.requestedInMb
+		}
+	}
+	return used
+}
+
+// describeQuotaLimit returns the volumes the limit applies to, for the reason
+// PVCs are rejected with.
+func describeQuotaLimit(limit cnsstoragequotav1alpha1.CnsStorageQuotaLimit) string {
+	storagePolicy := "all storage policies"
+	if limit.StoragePolicyName != "" {
+		storagePolicy = fmt.Sprintf("storage policy %q", limit.StoragePolicyName)
+	}
+	datastore := "all datastores"
+	if limit.DatastoreURL != "" {
+		datastore = fmt.Sprintf("datastore %q", limit.DatastoreURL)
+	}
+	return storagePolicy + " on " + datastore
+}
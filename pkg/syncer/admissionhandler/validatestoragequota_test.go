@@ -0,0 +1,198 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admissionhandler
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	v1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	crfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	apis "sigs.k8s.io/vsphere-csi-driver/pkg/apis/cnsoperator"
+	cnsstoragequotav1alpha1 "sigs.k8s.io/vsphere-csi-driver/pkg/apis/cnsoperator/cnsstoragequota/v1alpha1"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/common/unittestcommon"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/common"
+)
+
+func newQuotaPVC(name string, storageClass string, size string, phase v1.PersistentVolumeClaimPhase,
+	created time.Time) *v1.PersistentVolumeClaim {
+	return &v1.PersistentVolumeClaim{
+		TypeMeta:   metav1.TypeMeta{Kind: "PersistentVolumeClaim", APIVersion: "v1"},
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", CreationTimestamp: metav1.NewTime(created)},
+		Spec: v1.PersistentVolumeClaimSpec{
+			StorageClassName: &storageClass,
+			AccessModes:      []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce},
+			Resources: v1.ResourceRequirements{
+				Requests: v1.ResourceList{v1.ResourceStorage: resource.MustParse(size)},
+			},
+		},
+		Status: v1.PersistentVolumeClaimStatus{Phase: phase},
+	}
+}
+
+// TestValidatePVCStorageQuota checks that the PVCs whose requested capacity
+// doesn't fit in the limits of the CnsStorageQuota instances of their
+// namespace are rejected.
+func TestValidatePVCStorageQuota(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	co, err := unittestcommon.GetFakeContainerOrchestratorInterface(common.Kubernetes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lastSyncTime := time.Now().Add(-time.Hour)
+	containerOrchestratorUtility = co
+	k8sClient = fake.NewSimpleClientset(
+		&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "gold"}, Provisioner: csiProvisioner,
+			Parameters: map[string]string{"storagePolicyName": "gold"}},
+		&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "silver"}, Provisioner: csiProvisioner,
+			Parameters: map[string]string{"storagepolicyname": "silver"}},
+		&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "other"}, Provisioner: "example.com/other"},
+		// Counted in the usage of the quota.
+		newQuotaPVC("bound", "gold", "4Gi", v1.ClaimBound, lastSyncTime.Add(-time.Hour)),
+		// Not counted in the usage of the quota yet.
+		newQuotaPVC("pending", "gold", "2Gi", v1.ClaimPending, lastSyncTime.Add(-time.Hour)),
+		newQuotaPVC("new", "gold", "1Gi", v1.ClaimBound, lastSyncTime.Add(time.Minute)),
+		// Not provisioned by the vSphere CSI driver.
+		newQuotaPVC("other", "other", "100Gi", v1.ClaimPending, lastSyncTime),
+	)
+	scheme := runtime.NewScheme()
+	if err := apis.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	syncTime := metav1.NewTime(lastSyncTime)
+	cnsOperatorClient = crfake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&cnsstoragequotav1alpha1.CnsStorageQuota{
+			ObjectMeta: metav1.ObjectMeta{Name: "quota", Namespace: "default"},
+			Spec: cnsstoragequotav1alpha1.CnsStorageQuotaSpec{
+				Limits: []cnsstoragequotav1alpha1.CnsStorageQuotaLimit{
+					{StoragePolicyName: "gold", LimitInMb: 10 * 1024},
+				},
+			},
+			Status: cnsstoragequotav1alpha1.CnsStorageQuotaStatus{
+				LastSyncTime: &syncTime,
+				Usage: []cnsstoragequotav1alpha1.CnsStorageQuotaUsage{
+					{StoragePolicyName: "gold", UsedInMb: 4 * 1024},
+				},
+			},
+		},
+	).Build()
+	defer func() {
+		containerOrchestratorUtility = nil
+		k8sClient = nil
+		cnsOperatorClient = nil
+	}()
+
+	tests := []struct {
+		name         string
+		storageClass string
+		size         string
+		allowed      bool
+	}{
+		{
+			// 4Gi used, 3Gi pending or created since the last sync.
+			name:         "fits in the limit",
+			storageClass: "gold",
+			size:         "3Gi",
+			allowed:      true,
+		},
+		{
+			name:         "exceeds the limit",
+			storageClass: "gold",
+			size:         "3073Mi",
+		},
+		{
+			name:         "storage policy without limit",
+			storageClass: "silver",
+			size:         "100Gi",
+			allowed:      true,
+		},
+		{
+			name:         "other provisioner",
+			storageClass: "other",
+			size:         "100Gi",
+			allowed:      true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pvc := newQuotaPVC("pvc", test.storageClass, test.size, "", time.Now())
+			admissionResponse := validatePVC(ctx, newAdmissionReview(t, "PersistentVolumeClaim", admissionv1.Create, pvc))
+			checkQuotaAdmissionResponse(t, admissionResponse, test.allowed)
+		})
+	}
+
+	expansionTests := []struct {
+		name    string
+		size    string
+		allowed bool
+	}{
+		{
+			// 4Gi used, 3Gi pending or created since the last sync.
+			name:    "expansion fits in the limit",
+			size:    "7Gi",
+			allowed: true,
+		},
+		{
+			name: "expansion exceeds the limit",
+			size: "7169Mi",
+		},
+		{
+			name:    "unchanged capacity",
+			size:    "4Gi",
+			allowed: true,
+		},
+	}
+	for _, test := range expansionTests {
+		t.Run(test.name, func(t *testing.T) {
+			oldPVC := newQuotaPVC("bound", "gold", "4Gi", v1.ClaimBound, lastSyncTime.Add(-time.Hour))
+			oldPVC.Spec.VolumeName = "pv-bound"
+			pvc := oldPVC.DeepCopy()
+			pvc.Spec.Resources.Requests[v1.ResourceStorage] = resource.MustParse(test.size)
+			ar := newAdmissionReview(t, "PersistentVolumeClaim", admissionv1.Update, pvc)
+			oldRaw, err := json.Marshal(oldPVC)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ar.Request.OldObject = runtime.RawExtension{Raw: oldRaw}
+			checkQuotaAdmissionResponse(t, validatePVC(ctx, ar), test.allowed)
+		})
+	}
+}
+
+// checkQuotaAdmissionResponse checks that the PVC is allowed, or rejected by
+// the storage quota.
+func checkQuotaAdmissionResponse(t *testing.T, admissionResponse *admissionv1.AdmissionResponse, allowed bool) {
+	if allowed {
+		if !admissionResponse.Allowed {
+			t.Fatalf("PVC rejected. admissionResponse: %v", admissionResponse)
+		}
+	} else if admissionResponse.Allowed || admissionResponse.Result == nil ||
+		!strings.Contains(string(admissionResponse.Result.Reason), "CnsStorageQuota default/quota") {
+		t.Fatalf("expected PVC to be rejected by the storage quota. admissionResponse: %v", admissionResponse)
+	}
+}
@@ -315,7 +315,8 @@ func (r *ReconcileCnsFileAccessConfig) Reconcile(ctx context.Context, request re
 		// Query volume
 		log.Debugf("Querying volume: %s for CnsFileAccessConfig request with name: %q on namespace: %q",
 			volumeID, instance.Name, instance.Namespace)
-		volume, err := common.QueryVolumeByID(ctx, r.volumeManager, volumeID)
+		volume, err := common.QueryVolumeFieldsByID(ctx, r.volumeManager, volumeID,
+			cnstypes.QuerySelectionNameTypeBackingObjectDetails)
 		if err != nil {
 			if err.Error() == common.ErrNotFound.Error() {
 				msg := fmt.Sprintf("CNS Volume: %s not found", volumeID)
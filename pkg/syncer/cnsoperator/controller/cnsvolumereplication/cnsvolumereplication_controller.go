@@ -0,0 +1,414 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cnsvolumereplication
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	cnstypes "github.com/vmware/govmomi/cns/types"
+	vimtypes "github.com/vmware/govmomi/vim25/types"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+	apis "sigs.k8s.io/vsphere-csi-driver/pkg/apis/cnsoperator"
+	cnsvolumereplicationv1alpha1 "sigs.k8s.io/vsphere-csi-driver/pkg/apis/cnsoperator/cnsvolumereplication/v1alpha1"
+	volumes "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/volume"
+	commonconfig "sigs.k8s.io/vsphere-csi-driver/pkg/common/config"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/common"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/common/commonco"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
+	k8s "sigs.k8s.io/vsphere-csi-driver/pkg/kubernetes"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/syncer"
+)
+
+const defaultMaxWorkerThreadsForVolumeReplication = 10
+
+// backOffDuration is a map of cnsvolumereplication namespaced names to the time after which
+// a request for this instance will be requeued.
+// Initialized to 1 second for new instances and for instances whose latest reconcile
+// operation succeeded.
+// If the reconcile fails, backoff is incremented exponentially.
+var (
+	backOffDuration         map[types.NamespacedName]time.Duration
+	backOffDurationMapMutex = sync.Mutex{}
+)
+
+// Add creates a new CnsVolumeReplication Controller and adds it to the Manager, ConfigurationInfo
+// and VirtualCenterTypes. The Manager will set fields on the Controller
+// and Start it when the Manager is Started.
+func Add(mgr manager.Manager, clusterFlavor cnstypes.CnsClusterFlavor,
+	configInfo *commonconfig.ConfigurationInfo, volumeManager volumes.Manager) error {
+	ctx, log := logger.GetNewContextWithLogger()
+	if clusterFlavor != cnstypes.CnsClusterFlavorVanilla {
+		log.Debug("Not initializing the CnsVolumeReplication Controller as its a non-Vanilla CSI deployment")
+		return nil
+	}
+	coCommonInterface, err := commonco.GetContainerOrchestratorInterface(ctx, common.Kubernetes, clusterFlavor, &syncer.COInitParams)
+	if err != nil {
+		log.Errorf("failed to create CO agnostic interface. Err: %v", err)
+		return err
+	}
+	if !coCommonInterface.IsFSSEnabled(ctx, common.VolumeReplication) {
+		log.Infof("Not initializing the CnsVolumeReplication Controller as VolumeReplication feature is disabled on the cluster")
+		return nil
+	}
+
+	// Initializes kubernetes client
+	k8sclient, err := k8s.NewClient(ctx)
+	if err != nil {
+		log.Errorf("Creating Kubernetes client failed. Err: %v", err)
+		return err
+	}
+
+	// eventBroadcaster broadcasts events on cnsvolumereplication instances to the event sink
+	eventBroadcaster := record.NewBroadcaster()
+	eventBroadcaster.StartRecordingToSink(
+		&typedcorev1.EventSinkImpl{
+			Interface: k8sclient.CoreV1().Events(""),
+		},
+	)
+	recorder := eventBroadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: apis.GroupName})
+	replicator := &vcenterReplicator{configInfo: configInfo, volumeManager: volumeManager}
+	return add(mgr, newReconciler(mgr, replicator, recorder))
+}
+
+// newReconciler returns a new reconcile.Reconciler
+func newReconciler(mgr manager.Manager, replicator volumeReplicator, recorder record.EventRecorder) reconcile.Reconciler {
+	return &ReconcileCnsVolumeReplication{client: mgr.GetClient(), replicator: replicator, recorder: recorder}
+}
+
+// add adds a new Controller to mgr with r as the reconcile.Reconciler
+func add(mgr manager.Manager, r reconcile.Reconciler) error {
+	_, log := logger.GetNewContextWithLogger()
+
+	// Create a new controller
+	c, err := controller.New("cnsvolumereplication-controller", mgr,
+		controller.Options{Reconciler: r, MaxConcurrentReconciles: defaultMaxWorkerThreadsForVolumeReplication})
+	if err != nil {
+		log.Errorf("Failed to create new CnsVolumeReplication controller with error: %+v", err)
+		return err
+	}
+
+	backOffDuration = make(map[types.NamespacedName]time.Duration)
+
+	// Watch for changes to primary resource CnsVolumeReplication
+	err = c.Watch(&source.Kind{Type: &cnsvolumereplicationv1alpha1.CnsVolumeReplication{}}, &handler.EnqueueRequestForObject{})
+	if err != nil {
+		log.Errorf("Failed to watch for changes to CnsVolumeReplication resource with error: %+v", err)
+		return err
+	}
+	return nil
+}
+
+// blank assignment to verify that ReconcileCnsVolumeReplication implements reconcile.Reconciler
+var _ reconcile.Reconciler = &ReconcileCnsVolumeReplication{}
+
+// ReconcileCnsVolumeReplication reconciles a CnsVolumeReplication object
+type ReconcileCnsVolumeReplication struct {
+	// This client, initialized using mgr.Client() above, is a split client
+	// that reads objects from the cache and writes to the apiserver
+	client     client.Client
+	replicator volumeReplicator
+	recorder   record.EventRecorder
+}
+
+// Reconcile adds the volume of the PVC of a CnsVolumeReplication object to the replication group
+// of its spec, and reports whether the volume is in the replication group and whether the
+// replication group reported a fault in the status conditions. The replication state is
+// checked again every RPO.
+// Note:
+// The Controller will requeue the Request to be processed again if the returned error is non-nil or
+// Result.Requeue is true, otherwise upon completion it will remove the work from the queue.
+func (r *ReconcileCnsVolumeReplication) Reconcile(ctx context.Context, request reconcile.Request) (reconcile.Result, error) {
+	log := logger.GetLogger(ctx)
+	instance := &cnsvolumereplicationv1alpha1.CnsVolumeReplication{}
+	err := r.client.Get(ctx, request.NamespacedName, instance)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			log.Infof("CnsVolumeReplication resource not found. Ignoring since object must be deleted.")
+			backOffDurationMapMutex.Lock()
+			delete(backOffDuration, request.NamespacedName)
+			backOffDurationMapMutex.Unlock()
+			return reconcile.Result{}, nil
+		}
+		log.Errorf("Error reading the CnsVolumeReplication with name: %q on namespace: %q. Err: %+v",
+			request.Name, request.Namespace, err)
+		return reconcile.Result{}, err
+	}
+	if instance.DeletionTimestamp != nil {
+		return reconcile.Result{}, nil
+	}
+	// Initialize backOffDuration for the instance, if required.
+	backOffDurationMapMutex.Lock()
+	if _, exists := backOffDuration[request.NamespacedName]; !exists {
+		backOffDuration[request.NamespacedName] = time.Second
+	}
+	timeout := backOffDuration[request.NamespacedName]
+	backOffDurationMapMutex.Unlock()
+
+	log.Infof("Reconciling CnsVolumeReplication with instance: %q from namespace: %q. timeout %q seconds",
+		instance.Name, request.Namespace, timeout)
+	if err = validateCnsVolumeReplicationSpec(instance); err != nil {
+		setInstanceError(ctx, r, instance, err.Error())
+		return reconcile.Result{RequeueAfter: timeout}, nil
+	}
+	groupID := getReplicationGroupID(instance.Spec)
+	if getDesiredReplicationState(instance.Spec) == cnsvolumereplicationv1alpha1.ReplicationStateSecondary {
+		if instance.Status.ReplicationState != cnsvolumereplicationv1alpha1.ReplicationStateSecondary {
+			if err = r.demote(ctx, instance, groupID); err != nil {
+				setInstanceError(ctx, r, instance, err.Error())
+				return reconcile.Result{RequeueAfter: timeout}, nil
+			}
+		}
+		backOffDurationMapMutex.Lock()
+		backOffDuration[request.NamespacedName] = time.Second
+		backOffDurationMapMutex.Unlock()
+		// Secondary volumes are replicated by the source site, which checks their replication state.
+		return reconcile.Result{}, nil
+	}
+	if instance.Status.ReplicationState == cnsvolumereplicationv1alpha1.ReplicationStateSecondary {
+		if err = r.promote(ctx, instance, groupID); err != nil {
+			setInstanceError(ctx, r, instance, err.Error())
+			return reconcile.Result{RequeueAfter: timeout}, nil
+		}
+	}
+
+	volumeID, err := getVolumeID(ctx, r.client, instance.Namespace, instance.Spec.PvcName)
+	if err != nil {
+		setInstanceError(ctx, r, instance, err.Error())
+		return reconcile.Result{RequeueAfter: timeout}, nil
+	}
+	instance.Status.VolumeID = volumeID
+
+	current, fault, err := r.replicator.GetReplicationGroup(ctx, volumeID)
+	if err != nil {
+		setInstanceError(ctx, r, instance, fmt.Sprintf("Failed to query the replication group of volume: %q. Err: %v",
+			volumeID, err))
+		return reconcile.Result{RequeueAfter: timeout}, nil
+	}
+	if !isInReplicationGroup(current, groupID) {
+		log.Infof("Adding volume: %q to replication group: %q of fault domain: %q", volumeID,
+			groupID.DeviceGroupId.Id, groupID.FaultDomainId.Id)
+		err = r.replicator.SetReplication(ctx, volumeID, instance.Spec.StoragePolicyName, groupID)
+		if err != nil {
+			setInstanceError(ctx, r, instance, fmt.Sprintf("Failed to add volume: %q to replication group: %q. Err: %v",
+				volumeID, groupID.DeviceGroupId.Id, err))
+			return reconcile.Result{RequeueAfter: timeout}, nil
+		}
+		current, fault, err = r.replicator.GetReplicationGroup(ctx, volumeID)
+		if err != nil {
+			setInstanceError(ctx, r, instance, fmt.Sprintf("Failed to query the replication group of volume: %q. Err: %v",
+				volumeID, err))
+			return reconcile.Result{RequeueAfter: timeout}, nil
+		}
+		recordEvent(ctx, r, instance, v1.EventTypeNormal, fmt.Sprintf("Added volume: %q to replication group: %q",
+			volumeID, groupID.DeviceGroupId.Id))
+	}
+
+	setReplicationConditions(instance, isInReplicationGroup(current, groupID), fault)
+	instance.Status.ReplicationState = cnsvolumereplicationv1alpha1.ReplicationStatePrimary
+	now := metav1.Now()
+	instance.Status.LastSyncCheckTime = &now
+	if err = updateCnsVolumeReplication(ctx, r.client, instance); err != nil {
+		recordEvent(ctx, r, instance, v1.EventTypeWarning, fmt.Sprintf("Failed to update status. Err: %v", err))
+		return reconcile.Result{RequeueAfter: timeout}, nil
+	}
+	backOffDurationMapMutex.Lock()
+	backOffDuration[request.NamespacedName] = time.Second
+	backOffDurationMapMutex.Unlock()
+	// Check the replication state again within the RPO.
+	return reconcile.Result{RequeueAfter: time.Duration(instance.Spec.RPOMinutes) * time.Minute}, nil
+}
+
+// demote marks the volume of the instance Secondary. If the volume was Primary at this site, its
+// replication group is prepared for a planned failover first: the writes since the last
+// replication are synchronized to the target site and the volume becomes read-only.
+func (r *ReconcileCnsVolumeReplication) demote(ctx context.Context,
+	instance *cnsvolumereplicationv1alpha1.CnsVolumeReplication, groupID vimtypes.ReplicationGroupId) error {
+	if instance.Status.VolumeID != "" {
+		if err := r.replicator.PrepareFailover(ctx, groupID); err != nil {
+			return fmt.Errorf("failed to prepare replication group: %q for failover. Err: %v",
+				groupID.DeviceGroupId.Id, err)
+		}
+		recordEvent(ctx, r, instance, v1.EventTypeNormal, fmt.Sprintf(
+			"Demoted volume: %q, replication group: %q is prepared for failover", instance.Status.VolumeID,
+			groupID.DeviceGroupId.Id))
+	}
+	instance.Status.ReplicationState = cnsvolumereplicationv1alpha1.ReplicationStateSecondary
+	return updateCnsVolumeReplication(ctx, r.client, instance)
+}
+
+// promote fails over the replication group of the Secondary volume of the instance to this site
+// and binds the recovered disk to the PVC. Nothing is failed over if the PVC is still bound at
+// this site, e.g. when a demoted volume is promoted back at the source site.
+func (r *ReconcileCnsVolumeReplication) promote(ctx context.Context,
+	instance *cnsvolumereplicationv1alpha1.CnsVolumeReplication, groupID vimtypes.ReplicationGroupId) error {
+	log := logger.GetLogger(ctx)
+	pvc := &v1.PersistentVolumeClaim{}
+	err := r.client.Get(ctx, types.NamespacedName{Namespace: instance.Namespace, Name: instance.Spec.PvcName}, pvc)
+	if err != nil {
+		return fmt.Errorf("failed to get PVC: %q on namespace: %q. Err: %v", instance.Spec.PvcName,
+			instance.Namespace, err)
+	}
+	if pvc.Status.Phase == v1.ClaimBound {
+		log.Infof("PVC: %q on namespace: %q is bound, not failing over replication group: %q",
+			pvc.Name, pvc.Namespace, groupID.DeviceGroupId.Id)
+		return nil
+	}
+	if instance.Status.VolumeID == "" {
+		// A previous promote may have failed over the replication group, but
+		// failed to save the recovered volume.
+		name := "pvc-" + string(pvc.UID)
+		volumeID, err := r.replicator.GetRecoveredVolume(ctx, name)
+		if err != nil {
+			return fmt.Errorf("failed to look up recovered volume: %q. Err: %v", name, err)
+		}
+		if volumeID != "" {
+			log.Infof("Replication group: %q was already failed over to volume: %q", groupID.DeviceGroupId.Id, volumeID)
+		} else {
+			volumeID, err = r.replicator.Failover(ctx, groupID, name)
+			if err != nil {
+				return fmt.Errorf("failed to fail over replication group: %q. Err: %v", groupID.DeviceGroupId.Id, err)
+			}
+		}
+		// Save the recovered volume, the replication group can't be failed over again on retries.
+		instance.Status.VolumeID = volumeID
+		if err = updateCnsVolumeReplication(ctx, r.client, instance); err != nil {
+			return err
+		}
+	}
+	pv := getRecoveredPersistentVolume(instance.Status.VolumeID, pvc)
+	if err = r.client.Create(ctx, pv); err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create PV: %q for recovered volume: %q. Err: %v", pv.Name,
+			instance.Status.VolumeID, err)
+	}
+	recordEvent(ctx, r, instance, v1.EventTypeNormal, fmt.Sprintf("Promoted volume: %q, bound PV: %q to PVC: %q",
+		instance.Status.VolumeID, pv.Name, pvc.Name))
+	return nil
+}
+
+// setReplicationConditions sets the Replicating and Synced conditions of the instance.
+func setReplicationConditions(instance *cnsvolumereplicationv1alpha1.CnsVolumeReplication, replicating bool,
+	fault *vimtypes.LocalizedMethodFault) {
+	if replicating {
+		meta.SetStatusCondition(&instance.Status.Conditions, metav1.Condition{
+			Type:    cnsvolumereplicationv1alpha1.ConditionReplicating,
+			Status:  metav1.ConditionTrue,
+			Reason:  "InReplicationGroup",
+			Message: fmt.Sprintf("Volume is in replication group %q", instance.Spec.ReplicationGroupID),
+		})
+	} else {
+		meta.SetStatusCondition(&instance.Status.Conditions, metav1.Condition{
+			Type:    cnsvolumereplicationv1alpha1.ConditionReplicating,
+			Status:  metav1.ConditionFalse,
+			Reason:  "NotInReplicationGroup",
+			Message: fmt.Sprintf("Volume is not in replication group %q", instance.Spec.ReplicationGroupID),
+		})
+	}
+	switch {
+	case fault != nil:
+		meta.SetStatusCondition(&instance.Status.Conditions, metav1.Condition{
+			Type:    cnsvolumereplicationv1alpha1.ConditionSynced,
+			Status:  metav1.ConditionFalse,
+			Reason:  "ReplicationFault",
+			Message: fault.LocalizedMessage,
+		})
+	case !replicating:
+		meta.SetStatusCondition(&instance.Status.Conditions, metav1.Condition{
+			Type:    cnsvolumereplicationv1alpha1.ConditionSynced,
+			Status:  metav1.ConditionFalse,
+			Reason:  "NotReplicating",
+			Message: "Volume is not replicated",
+		})
+	default:
+		meta.SetStatusCondition(&instance.Status.Conditions, metav1.Condition{
+			Type:    cnsvolumereplicationv1alpha1.ConditionSynced,
+			Status:  metav1.ConditionTrue,
+			Reason:  "NoFault",
+			Message: "Replication group reported no fault",
+		})
+	}
+}
+
+// setInstanceError sets the Synced condition of the instance to Unknown with the error
+// and records an event on the CnsVolumeReplication instance
+func setInstanceError(ctx context.Context, r *ReconcileCnsVolumeReplication,
+	instance *cnsvolumereplicationv1alpha1.CnsVolumeReplication, errMsg string) {
+	log := logger.GetLogger(ctx)
+	meta.SetStatusCondition(&instance.Status.Conditions, metav1.Condition{
+		Type:    cnsvolumereplicationv1alpha1.ConditionSynced,
+		Status:  metav1.ConditionUnknown,
+		Reason:  "SyncCheckFailed",
+		Message: errMsg,
+	})
+	err := updateCnsVolumeReplication(ctx, r.client, instance)
+	if err != nil {
+		log.Errorf("updateCnsVolumeReplication failed. err: %v", err)
+	}
+	recordEvent(ctx, r, instance, v1.EventTypeWarning, errMsg)
+}
+
+// recordEvent records the event, sets the backOffDuration for the instance appropriately
+// and logs the message.
+// backOffDuration is reset to 1 second on success and doubled on failure.
+func recordEvent(ctx context.Context, r *ReconcileCnsVolumeReplication,
+	instance *cnsvolumereplicationv1alpha1.CnsVolumeReplication, eventtype string, msg string) {
+	log := logger.GetLogger(ctx)
+	name := types.NamespacedName{Namespace: instance.Namespace, Name: instance.Name}
+	switch eventtype {
+	case v1.EventTypeWarning:
+		log.Error(msg)
+		// Double backOff duration
+		backOffDurationMapMutex.Lock()
+		backOffDuration[name] = backOffDuration[name] * 2
+		r.recorder.Event(instance, v1.EventTypeWarning, "CnsVolumeReplicationFailed", msg)
+		backOffDurationMapMutex.Unlock()
+	case v1.EventTypeNormal:
+		log.Info(msg)
+		// Reset backOff duration to one second
+		backOffDurationMapMutex.Lock()
+		backOffDuration[name] = time.Second
+		r.recorder.Event(instance, v1.EventTypeNormal, "CnsVolumeReplicationSucceeded", msg)
+		backOffDurationMapMutex.Unlock()
+	}
+}
+
+// updateCnsVolumeReplication updates the CnsVolumeReplication instance in K8S
+func updateCnsVolumeReplication(ctx context.Context, client client.Client,
+	instance *cnsvolumereplicationv1alpha1.CnsVolumeReplication) error {
+	log := logger.GetLogger(ctx)
+	err := client.Update(ctx, instance)
+	if err != nil {
+		log.Errorf("Failed to update CnsVolumeReplication instance: %q on namespace: %q. Error: %+v",
+			instance.Name, instance.Namespace, err)
+	}
+	return err
+}
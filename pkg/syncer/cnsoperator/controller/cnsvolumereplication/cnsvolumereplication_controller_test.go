@@ -0,0 +1,306 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cnsvolumereplication
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	vimtypes "github.com/vmware/govmomi/vim25/types"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	apis "sigs.k8s.io/vsphere-csi-driver/pkg/apis/cnsoperator"
+	cnsvolumereplicationv1alpha1 "sigs.k8s.io/vsphere-csi-driver/pkg/apis/cnsoperator/cnsvolumereplication/v1alpha1"
+	cnsoperatortypes "sigs.k8s.io/vsphere-csi-driver/pkg/syncer/cnsoperator/types"
+)
+
+type fakeReplicator struct {
+	groups map[string]vimtypes.ReplicationGroupId
+	fault  *vimtypes.LocalizedMethodFault
+	err    error
+	// prepared and failedOver are the replication groups prepared for
+	// failover and failed over.
+	prepared   []string
+	failedOver []string
+	// recovered has the IDs of the FCDs registered by failovers, by name.
+	recovered map[string]string
+}
+
+func (f *fakeReplicator) GetReplicationGroup(ctx context.Context, volumeID string) (*vimtypes.ReplicationGroupId,
+	*vimtypes.LocalizedMethodFault, error) {
+	group, ok := f.groups[volumeID]
+	if !ok {
+		return nil, nil, nil
+	}
+	return &group, f.fault, nil
+}
+
+func (f *fakeReplicator) SetReplication(ctx context.Context, volumeID string, storagePolicyName string,
+	groupID vimtypes.ReplicationGroupId) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.groups[volumeID] = groupID
+	return nil
+}
+
+func (f *fakeReplicator) PrepareFailover(ctx context.Context, groupID vimtypes.ReplicationGroupId) error {
+	f.prepared = append(f.prepared, groupID.DeviceGroupId.Id)
+	return nil
+}
+
+func (f *fakeReplicator) Failover(ctx context.Context, groupID vimtypes.ReplicationGroupId, name string) (
+	string, error) {
+	f.failedOver = append(f.failedOver, groupID.DeviceGroupId.Id)
+	if f.recovered == nil {
+		f.recovered = make(map[string]string)
+	}
+	f.recovered[name] = "fcd-recovered"
+	return "fcd-recovered", nil
+}
+
+func (f *fakeReplicator) GetRecoveredVolume(ctx context.Context, name string) (string, error) {
+	return f.recovered[name], nil
+}
+
+func newTestReconciler(t *testing.T, replicator volumeReplicator) *ReconcileCnsVolumeReplication {
+	s := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := apis.AddToSchemes.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	pvc := &v1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "data", Namespace: "db"},
+		Spec:       v1.PersistentVolumeClaimSpec{VolumeName: "pvc-1"},
+		Status:     v1.PersistentVolumeClaimStatus{Phase: v1.ClaimBound},
+	}
+	pv := &v1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "pvc-1"},
+		Spec: v1.PersistentVolumeSpec{
+			PersistentVolumeSource: v1.PersistentVolumeSource{
+				CSI: &v1.CSIPersistentVolumeSource{
+					Driver:       cnsoperatortypes.VSphereCSIDriverName,
+					VolumeHandle: "fcd-1",
+				},
+			},
+		},
+	}
+	instance := &cnsvolumereplicationv1alpha1.CnsVolumeReplication{
+		ObjectMeta: metav1.ObjectMeta{Name: "data", Namespace: "db"},
+		Spec: cnsvolumereplicationv1alpha1.CnsVolumeReplicationSpec{
+			PvcName:            "data",
+			StoragePolicyName:  "replicated",
+			TargetSite:         "site-b",
+			ReplicationGroupID: "rg-1",
+			RPOMinutes:         15,
+		},
+	}
+	backOffDuration = make(map[types.NamespacedName]time.Duration)
+	return &ReconcileCnsVolumeReplication{
+		client:     fake.NewFakeClientWithScheme(s, pvc, pv, instance),
+		replicator: replicator,
+		recorder:   record.NewFakeRecorder(10),
+	}
+}
+
+func reconcileAndGet(t *testing.T, r *ReconcileCnsVolumeReplication) (reconcile.Result,
+	*cnsvolumereplicationv1alpha1.CnsVolumeReplication) {
+	ctx := context.Background()
+	name := types.NamespacedName{Namespace: "db", Name: "data"}
+	result, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	instance := &cnsvolumereplicationv1alpha1.CnsVolumeReplication{}
+	if err := r.client.Get(ctx, name, instance); err != nil {
+		t.Fatal(err)
+	}
+	return result, instance
+}
+
+func TestReconcileAddsVolumeToReplicationGroup(t *testing.T) {
+	replicator := &fakeReplicator{groups: map[string]vimtypes.ReplicationGroupId{}}
+	result, instance := reconcileAndGet(t, newTestReconciler(t, replicator))
+
+	if result.RequeueAfter != 15*time.Minute {
+		t.Errorf("expected requeue after the RPO, got %v", result.RequeueAfter)
+	}
+	if instance.Status.VolumeID != "fcd-1" || instance.Status.LastSyncCheckTime == nil {
+		t.Errorf("unexpected status %+v", instance.Status)
+	}
+	if group := replicator.groups["fcd-1"]; group.DeviceGroupId.Id != "rg-1" || group.FaultDomainId.Id != "site-b" {
+		t.Errorf("volume wasn't added to the replication group, got %+v", group)
+	}
+	if !meta.IsStatusConditionTrue(instance.Status.Conditions, cnsvolumereplicationv1alpha1.ConditionReplicating) ||
+		!meta.IsStatusConditionTrue(instance.Status.Conditions, cnsvolumereplicationv1alpha1.ConditionSynced) {
+		t.Errorf("expected Replicating and Synced conditions, got %+v", instance.Status.Conditions)
+	}
+}
+
+func TestReconcileReportsReplicationFault(t *testing.T) {
+	replicator := &fakeReplicator{
+		groups: map[string]vimtypes.ReplicationGroupId{"fcd-1": {
+			FaultDomainId: vimtypes.FaultDomainId{Id: "site-b"},
+			DeviceGroupId: vimtypes.DeviceGroupId{Id: "rg-1"},
+		}},
+		fault: &vimtypes.LocalizedMethodFault{LocalizedMessage: "target site unreachable"},
+		err:   errors.New("unexpected SetReplication"),
+	}
+	_, instance := reconcileAndGet(t, newTestReconciler(t, replicator))
+
+	synced := meta.FindStatusCondition(instance.Status.Conditions, cnsvolumereplicationv1alpha1.ConditionSynced)
+	if synced == nil || synced.Status != metav1.ConditionFalse || synced.Message != "target site unreachable" {
+		t.Errorf("expected a False Synced condition with the fault, got %+v", synced)
+	}
+}
+
+func TestReconcileFailure(t *testing.T) {
+	replicator := &fakeReplicator{
+		groups: map[string]vimtypes.ReplicationGroupId{},
+		err:    errors.New("policy not found"),
+	}
+	result, instance := reconcileAndGet(t, newTestReconciler(t, replicator))
+
+	if result.RequeueAfter != time.Second {
+		t.Errorf("expected requeue after the backoff, got %v", result.RequeueAfter)
+	}
+	synced := meta.FindStatusCondition(instance.Status.Conditions, cnsvolumereplicationv1alpha1.ConditionSynced)
+	if synced == nil || synced.Status != metav1.ConditionUnknown {
+		t.Errorf("expected an Unknown Synced condition, got %+v", synced)
+	}
+	if backOffDuration[types.NamespacedName{Namespace: "db", Name: "data"}] != 2*time.Second {
+		t.Errorf("expected the backoff to be doubled")
+	}
+}
+
+func TestReconcileDemote(t *testing.T) {
+	replicator := &fakeReplicator{groups: map[string]vimtypes.ReplicationGroupId{}}
+	r := newTestReconciler(t, replicator)
+	_, instance := reconcileAndGet(t, r)
+	if instance.Status.ReplicationState != cnsvolumereplicationv1alpha1.ReplicationStatePrimary {
+		t.Fatalf("expected a Primary volume, got %q", instance.Status.ReplicationState)
+	}
+
+	instance.Spec.ReplicationState = cnsvolumereplicationv1alpha1.ReplicationStateSecondary
+	if err := r.client.Update(context.Background(), instance); err != nil {
+		t.Fatal(err)
+	}
+	_, instance = reconcileAndGet(t, r)
+	if instance.Status.ReplicationState != cnsvolumereplicationv1alpha1.ReplicationStateSecondary {
+		t.Errorf("expected a Secondary volume, got %q", instance.Status.ReplicationState)
+	}
+	if len(replicator.prepared) != 1 || replicator.prepared[0] != "rg-1" {
+		t.Errorf("expected rg-1 to be prepared for failover, got %v", replicator.prepared)
+	}
+}
+
+// setUpPromote makes the PVC of the reconciler pending and its volume
+// Secondary, as at the recovery site, and returns the PVC.
+func setUpPromote(t *testing.T, r *ReconcileCnsVolumeReplication) *v1.PersistentVolumeClaim {
+	ctx := context.Background()
+	pvc := &v1.PersistentVolumeClaim{}
+	if err := r.client.Get(ctx, types.NamespacedName{Namespace: "db", Name: "data"}, pvc); err != nil {
+		t.Fatal(err)
+	}
+	// The PVC is pending at the recovery site.
+	pvc.UID = "uid-1"
+	pvc.Spec.VolumeName = ""
+	pvc.Status.Phase = v1.ClaimPending
+	if err := r.client.Update(ctx, pvc); err != nil {
+		t.Fatal(err)
+	}
+	instance := &cnsvolumereplicationv1alpha1.CnsVolumeReplication{}
+	if err := r.client.Get(ctx, types.NamespacedName{Namespace: "db", Name: "data"}, instance); err != nil {
+		t.Fatal(err)
+	}
+	instance.Status.ReplicationState = cnsvolumereplicationv1alpha1.ReplicationStateSecondary
+	if err := r.client.Update(ctx, instance); err != nil {
+		t.Fatal(err)
+	}
+	return pvc
+}
+
+func TestReconcilePromote(t *testing.T) {
+	ctx := context.Background()
+	replicator := &fakeReplicator{groups: map[string]vimtypes.ReplicationGroupId{}}
+	r := newTestReconciler(t, replicator)
+	pvc := setUpPromote(t, r)
+
+	_, instance := reconcileAndGet(t, r)
+	if instance.Status.VolumeID != "fcd-recovered" {
+		t.Errorf("expected the recovered volume, got %q", instance.Status.VolumeID)
+	}
+	pv := &v1.PersistentVolume{}
+	if err := r.client.Get(ctx, types.NamespacedName{Name: "pvc-uid-1"}, pv); err != nil {
+		t.Fatal(err)
+	}
+	if pv.Spec.CSI.VolumeHandle != "fcd-recovered" || pv.Spec.ClaimRef.Name != "data" {
+		t.Errorf("unexpected PV %+v", pv.Spec)
+	}
+
+	// The PVC is bound to the PV, the volume becomes Primary without another failover.
+	pvc.Spec.VolumeName = pv.Name
+	pvc.Status.Phase = v1.ClaimBound
+	if err := r.client.Update(ctx, pvc); err != nil {
+		t.Fatal(err)
+	}
+	_, instance = reconcileAndGet(t, r)
+	if instance.Status.ReplicationState != cnsvolumereplicationv1alpha1.ReplicationStatePrimary {
+		t.Errorf("expected a Primary volume, got %q", instance.Status.ReplicationState)
+	}
+	if len(replicator.failedOver) != 1 {
+		t.Errorf("expected one failover, got %v", replicator.failedOver)
+	}
+}
+
+func TestReconcilePromoteAlreadyFailedOver(t *testing.T) {
+	ctx := context.Background()
+	// A previous promote failed over the replication group, but failed to
+	// save the recovered volume.
+	replicator := &fakeReplicator{
+		groups:    map[string]vimtypes.ReplicationGroupId{},
+		recovered: map[string]string{"pvc-uid-1": "fcd-recovered"},
+	}
+	r := newTestReconciler(t, replicator)
+	setUpPromote(t, r)
+
+	_, instance := reconcileAndGet(t, r)
+	if instance.Status.VolumeID != "fcd-recovered" {
+		t.Errorf("expected the recovered volume, got %q", instance.Status.VolumeID)
+	}
+	if len(replicator.failedOver) != 0 {
+		t.Errorf("expected no failover, got %v", replicator.failedOver)
+	}
+	pv := &v1.PersistentVolume{}
+	if err := r.client.Get(ctx, types.NamespacedName{Name: "pvc-uid-1"}, pv); err != nil {
+		t.Fatal(err)
+	}
+	if pv.Spec.CSI.VolumeHandle != "fcd-recovered" {
+		t.Errorf("expected a PV of the recovered volume, got %+v", pv.Spec)
+	}
+}
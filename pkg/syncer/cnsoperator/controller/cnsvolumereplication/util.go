@@ -0,0 +1,295 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cnsvolumereplication
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	vimtypes "github.com/vmware/govmomi/vim25/types"
+	"github.com/vmware/govmomi/vslm"
+	vslmtypes "github.com/vmware/govmomi/vslm/types"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	cnsvolumereplicationv1alpha1 "sigs.k8s.io/vsphere-csi-driver/pkg/apis/cnsoperator/cnsvolumereplication/v1alpha1"
+	volumes "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/volume"
+	cnsvsphere "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/vsphere"
+	commonconfig "sigs.k8s.io/vsphere-csi-driver/pkg/common/config"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/common"
+	cnsoperatortypes "sigs.k8s.io/vsphere-csi-driver/pkg/syncer/cnsoperator/types"
+)
+
+const (
+	minRPOMinutes = 5
+	maxRPOMinutes = 1440
+)
+
+// volumeReplicator adds volumes to replication groups and reports the
+// replication groups of volumes.
+type volumeReplicator interface {
+	// GetReplicationGroup returns the replication group of the volume, nil if it
+	// isn't replicated, and the fault reported for the replication group, if any.
+	GetReplicationGroup(ctx context.Context, volumeID string) (*vimtypes.ReplicationGroupId,
+		*vimtypes.LocalizedMethodFault, error)
+	// SetReplication applies the storage policy to the volume, adding it to the
+	// replication group groupID.
+	SetReplication(ctx context.Context, volumeID string, storagePolicyName string,
+		groupID vimtypes.ReplicationGroupId) error
+	// PrepareFailover prepares the replication group groupID, whose source is on
+	// this site, for a planned failover.
+	PrepareFailover(ctx context.Context, groupID vimtypes.ReplicationGroupId) error
+	// Failover fails over the replication group groupID to this site, registers
+	// the recovered disk as an FCD named name and returns the ID of the FCD.
+	Failover(ctx context.Context, groupID vimtypes.ReplicationGroupId, name string) (string, error)
+	// GetRecoveredVolume returns the ID of the FCD named name registered by a
+	// previous failover, or "" if there is none.
+	GetRecoveredVolume(ctx context.Context, name string) (string, error)
+}
+
+// vcenterReplicator replicates volumes with the replication groups of SPBM.
+type vcenterReplicator struct {
+	configInfo    *commonconfig.ConfigurationInfo
+	volumeManager volumes.Manager
+}
+
+func (v *vcenterReplicator) GetReplicationGroup(ctx context.Context, volumeID string) (
+	*vimtypes.ReplicationGroupId, *vimtypes.LocalizedMethodFault, error) {
+	vc, err := cnsvsphere.GetVirtualCenterInstance(ctx, v.configInfo, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	return vc.PbmQueryReplicationGroup(ctx, volumeID)
+}
+
+func (v *vcenterReplicator) SetReplication(ctx context.Context, volumeID string, storagePolicyName string,
+	groupID vimtypes.ReplicationGroupId) error {
+	vc, err := cnsvsphere.GetVirtualCenterInstance(ctx, v.configInfo, false)
+	if err != nil {
+		return err
+	}
+	profileID, err := vc.GetStoragePolicyIDByName(ctx, storagePolicyName)
+	if err != nil {
+		return err
+	}
+	vStorageObject, err := v.volumeManager.RetrieveVStorageObject(ctx, volumeID)
+	if err != nil {
+		return err
+	}
+	ds := vStorageObject.Config.Backing.GetBaseConfigInfoBackingInfo().Datastore
+	return volumes.SetVolumeReplication(ctx, vc.Client.Client, ds, volumeID, profileID, groupID)
+}
+
+func (v *vcenterReplicator) PrepareFailover(ctx context.Context, groupID vimtypes.ReplicationGroupId) error {
+	vc, err := cnsvsphere.GetVirtualCenterInstance(ctx, v.configInfo, false)
+	if err != nil {
+		return err
+	}
+	return vc.PrepareFailoverReplicationGroup(ctx, groupID)
+}
+
+func (v *vcenterReplicator) Failover(ctx context.Context, groupID vimtypes.ReplicationGroupId, name string) (
+	string, error) {
+	vc, err := cnsvsphere.GetVirtualCenterInstance(ctx, v.configInfo, false)
+	if err != nil {
+		return "", err
+	}
+	disks, err := vc.FailoverReplicationGroup(ctx, groupID, true)
+	if err != nil {
+		return "", err
+	}
+	if len(disks) != 1 {
+		return "", fmt.Errorf("failover of replication group %q recovered %d disks, expected one disk per group",
+			groupID.DeviceGroupId.Id, len(disks))
+	}
+	diskURL, err := getRecoveredDiskURL(ctx, vc, disks[0])
+	if err != nil {
+		return "", err
+	}
+	return v.volumeManager.RegisterDisk(ctx, diskURL, name)
+}
+
+func (v *vcenterReplicator) GetRecoveredVolume(ctx context.Context, name string) (string, error) {
+	vc, err := cnsvsphere.GetVirtualCenterInstance(ctx, v.configInfo, false)
+	if err != nil {
+		return "", err
+	}
+	if err = vc.ConnectVslm(ctx); err != nil {
+		return "", err
+	}
+	query := []vslmtypes.VslmVsoVStorageObjectQuerySpec{
+		{
+			QueryField:    string(vslmtypes.VslmVsoVStorageObjectQuerySpecQueryFieldEnumName),
+			QueryOperator: string(vslmtypes.VslmVsoVStorageObjectQuerySpecQueryOperatorEnumEquals),
+			QueryValue:    []string{name},
+		},
+	}
+	result, err := vslm.NewGlobalObjectManager(vc.VslmClient).ListObjectsForSpec(ctx, query, 1)
+	if err != nil {
+		return "", err
+	}
+	if result == nil || len(result.Id) == 0 {
+		return "", nil
+	}
+	return result.Id[0].Id, nil
+}
+
+// getRecoveredDiskURL returns the path of the recovered disk in the format
+// https://<vc_ip>/folder/<vmdk_path>?dcPath=<datacenterName>&dsName=<datastoreName>
+// expected to register it as an FCD.
+func getRecoveredDiskURL(ctx context.Context, vc *cnsvsphere.VirtualCenter, disk cnsvsphere.RecoveredDisk) (
+	string, error) {
+	datacenters, err := vc.GetDatacenters(ctx)
+	if err != nil {
+		return "", err
+	}
+	for _, dc := range datacenters {
+		ds, err := dc.GetDatastoreByURL(ctx, disk.DatastoreURL)
+		if err != nil {
+			continue
+		}
+		dsName, err := ds.ObjectName(ctx)
+		if err != nil {
+			return "", err
+		}
+		// The disk path may be a datastore path of the form "[datastore] path".
+		diskPath := disk.Path
+		if i := strings.Index(diskPath, "] "); strings.HasPrefix(diskPath, "[") && i > 0 {
+			diskPath = diskPath[i+2:]
+		}
+		query := url.Values{}
+		query.Set("dcPath", strings.TrimPrefix(dc.InventoryPath, "/"))
+		query.Set("dsName", dsName)
+		u := url.URL{
+			Scheme:   "https",
+			Host:     vc.Config.Host,
+			Path:     "/folder/" + diskPath,
+			RawQuery: query.Encode(),
+		}
+		return u.String(), nil
+	}
+	return "", fmt.Errorf("couldn't find datastore %q of recovered disk %q", disk.DatastoreURL, disk.Path)
+}
+
+// validateCnsVolumeReplicationSpec validates the input params of CnsVolumeReplication instance
+func validateCnsVolumeReplicationSpec(instance *cnsvolumereplicationv1alpha1.CnsVolumeReplication) error {
+	spec := instance.Spec
+	if spec.PvcName == "" || spec.StoragePolicyName == "" || spec.TargetSite == "" || spec.ReplicationGroupID == "" {
+		return errors.New("pvcName, storagePolicyName, targetSite and replicationGroupID must be specified")
+	}
+	if spec.RPOMinutes < minRPOMinutes || spec.RPOMinutes > maxRPOMinutes {
+		return fmt.Errorf("rpoMinutes: %d is not between %d and %d", spec.RPOMinutes, minRPOMinutes, maxRPOMinutes)
+	}
+	if spec.ReplicationState != "" && spec.ReplicationState != cnsvolumereplicationv1alpha1.ReplicationStatePrimary &&
+		spec.ReplicationState != cnsvolumereplicationv1alpha1.ReplicationStateSecondary {
+		return fmt.Errorf("replicationState: %q is neither %s nor %s", spec.ReplicationState,
+			cnsvolumereplicationv1alpha1.ReplicationStatePrimary, cnsvolumereplicationv1alpha1.ReplicationStateSecondary)
+	}
+	return nil
+}
+
+// getReplicationGroupID returns the replication group of the spec.
+func getReplicationGroupID(spec cnsvolumereplicationv1alpha1.CnsVolumeReplicationSpec) vimtypes.ReplicationGroupId {
+	return vimtypes.ReplicationGroupId{
+		FaultDomainId: vimtypes.FaultDomainId{Id: spec.TargetSite},
+		DeviceGroupId: vimtypes.DeviceGroupId{Id: spec.ReplicationGroupID},
+	}
+}
+
+// isInReplicationGroup returns true if the replication group current is groupID.
+func isInReplicationGroup(current *vimtypes.ReplicationGroupId, groupID vimtypes.ReplicationGroupId) bool {
+	return current != nil && current.FaultDomainId.Id == groupID.FaultDomainId.Id &&
+		current.DeviceGroupId.Id == groupID.DeviceGroupId.Id
+}
+
+// getDesiredReplicationState returns the replication state of the spec, Primary by default.
+func getDesiredReplicationState(spec cnsvolumereplicationv1alpha1.CnsVolumeReplicationSpec) string {
+	if spec.ReplicationState == "" {
+		return cnsvolumereplicationv1alpha1.ReplicationStatePrimary
+	}
+	return spec.ReplicationState
+}
+
+// getRecoveredPersistentVolume returns the PV of the FCD volumeID recovered at this site,
+// pre-bound to the PVC. Recovered volumes are retained when the PVC is deleted.
+func getRecoveredPersistentVolume(volumeID string, pvc *v1.PersistentVolumeClaim) *v1.PersistentVolume {
+	storageClassName := ""
+	if pvc.Spec.StorageClassName != nil {
+		storageClassName = *pvc.Spec.StorageClassName
+	}
+	return &v1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "pvc-" + string(pvc.UID),
+			Annotations: map[string]string{
+				"pv.kubernetes.io/provisioned-by": cnsoperatortypes.VSphereCSIDriverName,
+			},
+		},
+		Spec: v1.PersistentVolumeSpec{
+			PersistentVolumeReclaimPolicy: v1.PersistentVolumeReclaimRetain,
+			Capacity: v1.ResourceList{
+				v1.ResourceStorage: pvc.Spec.Resources.Requests[v1.ResourceStorage],
+			},
+			PersistentVolumeSource: v1.PersistentVolumeSource{
+				CSI: &v1.CSIPersistentVolumeSource{
+					Driver:       cnsoperatortypes.VSphereCSIDriverName,
+					VolumeHandle: volumeID,
+					VolumeAttributes: map[string]string{
+						common.AttributeDiskType: common.DiskTypeBlockVolume,
+					},
+				},
+			},
+			AccessModes: pvc.Spec.AccessModes,
+			VolumeMode:  pvc.Spec.VolumeMode,
+			ClaimRef: &v1.ObjectReference{
+				Kind:       "PersistentVolumeClaim",
+				APIVersion: "v1",
+				Namespace:  pvc.Namespace,
+				Name:       pvc.Name,
+				UID:        pvc.UID,
+			},
+			StorageClassName: storageClassName,
+		},
+	}
+}
+
+// getVolumeID returns the ID of the FCD of the bound PVC pvcName in namespace.
+func getVolumeID(ctx context.Context, c client.Reader, namespace string, pvcName string) (string, error) {
+	pvc := &v1.PersistentVolumeClaim{}
+	if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: pvcName}, pvc); err != nil {
+		return "", fmt.Errorf("failed to get PVC: %q on namespace: %q. Err: %v", pvcName, namespace, err)
+	}
+	if pvc.Status.Phase != v1.ClaimBound || pvc.Spec.VolumeName == "" {
+		return "", fmt.Errorf("PVC: %q on namespace: %q is not bound", pvcName, namespace)
+	}
+	pv := &v1.PersistentVolume{}
+	if err := c.Get(ctx, types.NamespacedName{Name: pvc.Spec.VolumeName}, pv); err != nil {
+		return "", fmt.Errorf("failed to get PV: %q. Err: %v", pvc.Spec.VolumeName, err)
+	}
+	if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != cnsoperatortypes.VSphereCSIDriverName {
+		return "", fmt.Errorf("PV: %q of PVC: %q on namespace: %q is not provisioned by %s",
+			pv.Name, pvcName, namespace, cnsoperatortypes.VSphereCSIDriverName)
+	}
+	if pv.Spec.CSI.VolumeAttributes[common.AttributeDiskType] == common.DiskTypeFileVolume {
+		return "", fmt.Errorf("PV: %q of PVC: %q on namespace: %q is a file volume, which can't be replicated",
+			pv.Name, pvcName, namespace)
+	}
+	return pv.Spec.CSI.VolumeHandle, nil
+}
@@ -222,9 +222,13 @@ func (r *ReconcileTriggerCsiFullSync) Reconcile(ctx context.Context, request rec
 		return reconcile.Result{}, nil
 	}
 
-	log.Infof("Reconciling trigger full sync with triggerSyncID: %d", instance.Spec.TriggerSyncID)
+	log.Infof("Reconciling trigger full sync with triggerSyncID: %d, dryRun: %t", instance.Spec.TriggerSyncID, instance.Spec.DryRun)
+	startTime := time.Now()
 	instance.Status.LastTriggerSyncID = instance.Spec.TriggerSyncID
 	instance.Status.InProgress = true
+	instance.Status.LastRunStartTimeStamp = &metav1.Time{Time: startTime}
+	instance.Status.LastRunEndTimeStamp = nil
+	instance.Status.Error = ""
 	err = updateTriggerCsiFullSync(ctx, r.client, instance)
 	if err != nil {
 		recordEvent(ctx, r, instance, v1.EventTypeWarning,
@@ -232,24 +236,31 @@ func (r *ReconcileTriggerCsiFullSync) Reconcile(ctx context.Context, request rec
 		return reconcile.Result{RequeueAfter: timeout}, nil
 	}
 
-	startTime := time.Now()
 	triggerSyncID := instance.Spec.TriggerSyncID
+	if instance.Spec.DryRun {
+		return r.reconcileDryRun(ctx, request, instance, startTime)
+	}
 	var fullSyncErr error
+	// The volumes reconciled are only counted by the full sync of vanilla
+	// and supervisor clusters.
+	var result syncer.FullSyncResult
 	if r.clusterFlavor == cnstypes.CnsClusterFlavorGuest {
 		fullSyncErr = syncer.PvcsiFullSync(ctx, syncer.MetadataSyncer)
 	} else {
-		fullSyncErr = syncer.CsiFullSync(ctx, syncer.MetadataSyncer)
+		result, fullSyncErr = syncer.CsiFullSyncWithResult(ctx, syncer.MetadataSyncer)
 	}
 	err = r.client.Get(ctx, request.NamespacedName, instance)
 	if err != nil {
 		return reconcile.Result{}, nil
 	}
+	setInstanceResult(instance, result)
 	if fullSyncErr != nil {
 		msg := fmt.Sprintf("Full sync failed for triggerSyncID: %d with error: %+v", triggerSyncID, fullSyncErr)
 		log.Error(msg)
 		setInstanceError(ctx, r, instance, msg, startTime)
 	} else {
-		msg := fmt.Sprintf("Full sync successful with triggerSyncID: %d", triggerSyncID)
+		msg := fmt.Sprintf("Full sync successful with triggerSyncID: %d. Volumes created: %d, updated: %d, deleted: %d, failed: %d",
+			triggerSyncID, result.VolumesCreated, result.VolumesUpdated, result.VolumesDeleted, result.VolumesFailed)
 		log.Info(msg)
 		setInstanceSuccess(ctx, r, instance, msg, startTime)
 	}
@@ -259,6 +270,80 @@ func (r *ReconcileTriggerCsiFullSync) Reconcile(ctx context.Context, request rec
 	return reconcile.Result{}, nil
 }
 
+// reconcileDryRun runs a dry run full sync for the TriggerSyncID of the instance,
+// and sets the drift report it returns on the instance
+func (r *ReconcileTriggerCsiFullSync) reconcileDryRun(ctx context.Context, request reconcile.Request,
+	instance *triggercsifullsyncv1alpha1.TriggerCsiFullSync, startTime time.Time) (reconcile.Result, error) {
+	log := logger.GetLogger(ctx)
+	triggerSyncID := instance.Spec.TriggerSyncID
+	var report syncer.DriftReport
+	var dryRunErr error
+	if r.clusterFlavor == cnstypes.CnsClusterFlavorGuest {
+		dryRunErr = fmt.Errorf("dry run full sync is not supported in %s clusters", r.clusterFlavor)
+	} else {
+		report, dryRunErr = syncer.CsiFullSyncDryRun(ctx, syncer.MetadataSyncer)
+	}
+	err := r.client.Get(ctx, request.NamespacedName, instance)
+	if err != nil {
+		return reconcile.Result{}, nil
+	}
+	// A dry run doesn't reconcile any volume.
+	setInstanceResult(instance, syncer.FullSyncResult{})
+	if dryRunErr != nil {
+		msg := fmt.Sprintf("Dry run full sync failed for triggerSyncID: %d with error: %+v", triggerSyncID, dryRunErr)
+		log.Error(msg)
+		setInstanceError(ctx, r, instance, msg, startTime)
+	} else {
+		instance.Status.DriftReport = newDriftReport(report, time.Now())
+		msg := fmt.Sprintf("Dry run full sync successful with triggerSyncID: %d. Missing volumes: %d, stale volumes: %d, orphaned volumes: %d",
+			triggerSyncID, len(report.MissingVolumeIDs), len(report.StaleVolumeIDs), len(report.OrphanedVolumeIDs))
+		log.Info(msg)
+		instance.Status.LastRunStartTimeStamp = &metav1.Time{Time: startTime}
+		instance.Status.LastRunEndTimeStamp = &metav1.Time{Time: time.Now()}
+		instance.Status.InProgress = false
+		instance.Status.Error = ""
+		if err := updateTriggerCsiFullSync(ctx, r.client, instance); err != nil {
+			log.Errorf("updateTriggerCsiFullSync failed. err: %v", err)
+		}
+		recordEvent(ctx, r, instance, v1.EventTypeNormal, msg)
+	}
+	backOffDurationMapMutex.Lock()
+	delete(backOffDuration, instance.Name)
+	backOffDurationMapMutex.Unlock()
+	return reconcile.Result{}, nil
+}
+
+// newDriftReport returns the DriftReport of the TriggerCsiFullSync instance for the
+// report of a dry run full sync completed at generated
+func newDriftReport(report syncer.DriftReport, generated time.Time) *triggercsifullsyncv1alpha1.DriftReport {
+	return &triggercsifullsyncv1alpha1.DriftReport{
+		GeneratedTimeStamp: &metav1.Time{Time: generated},
+		MissingVolumes:     int64(len(report.MissingVolumeIDs)),
+		StaleVolumes:       int64(len(report.StaleVolumeIDs)),
+		OrphanedVolumes:    int64(len(report.OrphanedVolumeIDs)),
+		MissingVolumeIDs:   truncateVolumeIDs(report.MissingVolumeIDs),
+		StaleVolumeIDs:     truncateVolumeIDs(report.StaleVolumeIDs),
+		OrphanedVolumeIDs:  truncateVolumeIDs(report.OrphanedVolumeIDs),
+	}
+}
+
+// truncateVolumeIDs returns the first MaxDriftReportVolumeIDs volume IDs
+func truncateVolumeIDs(volumeIDs []string) []string {
+	if len(volumeIDs) > triggercsifullsyncv1alpha1.MaxDriftReportVolumeIDs {
+		return volumeIDs[:triggercsifullsyncv1alpha1.MaxDriftReportVolumeIDs]
+	}
+	return volumeIDs
+}
+
+// setInstanceResult sets the number of volumes reconciled by the last run full sync
+// on the TriggerCsiFullSync instance
+func setInstanceResult(instance *triggercsifullsyncv1alpha1.TriggerCsiFullSync, result syncer.FullSyncResult) {
+	instance.Status.LastRunVolumesCreated = result.VolumesCreated
+	instance.Status.LastRunVolumesUpdated = result.VolumesUpdated
+	instance.Status.LastRunVolumesDeleted = result.VolumesDeleted
+	instance.Status.LastRunVolumesFailed = result.VolumesFailed
+}
+
 // setInstanceError sets error and records an event on the TriggerCsiFullSync instance
 func setInstanceError(ctx context.Context, r *ReconcileTriggerCsiFullSync,
 	instance *triggercsifullsyncv1alpha1.TriggerCsiFullSync, errMsg string, startTime time.Time) {
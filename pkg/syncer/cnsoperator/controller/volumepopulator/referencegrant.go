@@ -0,0 +1,138 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volumepopulator
+
+import (
+	"context"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	cnsvolumesourcev1alpha1 "sigs.k8s.io/vsphere-csi-driver/pkg/apis/cnsoperator/cnsvolumesource/v1alpha1"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/common"
+	cnsoperatortypes "sigs.k8s.io/vsphere-csi-driver/pkg/syncer/cnsoperator/types"
+)
+
+// referenceGrantListGVK is the list kind of the ReferenceGrants of the Gateway
+// API. A ReferenceGrant allows the objects of the kinds and namespaces in its
+// spec.from to refer to the objects of the kinds, and names, in its spec.to in
+// the namespace of the ReferenceGrant.
+var referenceGrantListGVK = schema.GroupVersionKind{
+	Group:   "gateway.networking.k8s.io",
+	Version: "v1beta1",
+	Kind:    "ReferenceGrantList",
+}
+
+// pvcKind is the kind of PVCs in the spec of ReferenceGrants, PVCs are in the
+// core API group "".
+const pvcKind = "PersistentVolumeClaim"
+
+// isReferenceGranted returns true if the PVCs of namespace fromNamespace are
+// allowed to refer to the PVC name in namespace toNamespace, i.e. if the
+// namespaces are the same or a ReferenceGrant in toNamespace allows it.
+func isReferenceGranted(ctx context.Context, c client.Reader, fromNamespace string,
+	toNamespace string, name string) (bool, error) {
+	if fromNamespace == toNamespace {
+		return true, nil
+	}
+	grants := &unstructured.UnstructuredList{}
+	grants.SetGroupVersionKind(referenceGrantListGVK)
+	if err := c.List(ctx, grants, client.InNamespace(toNamespace)); err != nil {
+		if meta.IsNoMatchError(err) {
+			// The ReferenceGrant CRD isn't installed, nothing is granted.
+			return false, nil
+		}
+		return false, err
+	}
+	for _, grant := range grants.Items {
+		if grantsReference(grant.Object, fromNamespace, name) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// grantsReference returns true if the ReferenceGrant grant allows the PVCs of
+// namespace fromNamespace to refer to the PVC name.
+func grantsReference(grant map[string]interface{}, fromNamespace string, name string) bool {
+	from, _, _ := unstructured.NestedSlice(grant, "spec", "from")
+	to, _, _ := unstructured.NestedSlice(grant, "spec", "to")
+	fromGranted := false
+	for _, f := range from {
+		ref, ok := f.(map[string]interface{})
+		if ok && ref["group"] == "" && ref["kind"] == pvcKind && ref["namespace"] == fromNamespace {
+			fromGranted = true
+			break
+		}
+	}
+	if !fromGranted {
+		return false
+	}
+	for _, t := range to {
+		ref, ok := t.(map[string]interface{})
+		if !ok || ref["group"] != "" || ref["kind"] != pvcKind {
+			continue
+		}
+		if toName, _ := ref["name"].(string); toName == "" || toName == name {
+			return true
+		}
+	}
+	return false
+}
+
+// getClaimVolumeID returns the ID of the FCD of the PVC the CnsVolumeSource
+// refers to, after checking that pvc is allowed to refer to it.
+func getClaimVolumeID(ctx context.Context, c client.Reader, pvc *v1.PersistentVolumeClaim,
+	source *cnsvolumesourcev1alpha1.CnsVolumeSource) (string, error) {
+	ref := source.Spec.PersistentVolumeClaim
+	namespace := ref.Namespace
+	if namespace == "" {
+		namespace = source.Namespace
+	}
+	granted, err := isReferenceGranted(ctx, c, pvc.Namespace, namespace, ref.Name)
+	if err != nil {
+		return "", fmt.Errorf("failed to list ReferenceGrants on namespace: %q. Err: %v", namespace, err)
+	}
+	if !granted {
+		return "", fmt.Errorf("no ReferenceGrant on namespace: %q allows PVCs of namespace: %q to refer to PVC: %q",
+			namespace, pvc.Namespace, ref.Name)
+	}
+	sourcePVC := &v1.PersistentVolumeClaim{}
+	if err = c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: ref.Name}, sourcePVC); err != nil {
+		return "", fmt.Errorf("failed to get PVC: %q on namespace: %q. Err: %v", ref.Name, namespace, err)
+	}
+	if sourcePVC.Status.Phase != v1.ClaimBound || sourcePVC.Spec.VolumeName == "" {
+		return "", fmt.Errorf("PVC: %q on namespace: %q is not bound", ref.Name, namespace)
+	}
+	pv := &v1.PersistentVolume{}
+	if err = c.Get(ctx, types.NamespacedName{Name: sourcePVC.Spec.VolumeName}, pv); err != nil {
+		return "", fmt.Errorf("failed to get PV: %q. Err: %v", sourcePVC.Spec.VolumeName, err)
+	}
+	if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != cnsoperatortypes.VSphereCSIDriverName {
+		return "", fmt.Errorf("PV: %q of PVC: %q on namespace: %q is not provisioned by %s",
+			pv.Name, ref.Name, namespace, cnsoperatortypes.VSphereCSIDriverName)
+	}
+	if pv.Spec.CSI.VolumeAttributes[common.AttributeDiskType] == common.DiskTypeFileVolume {
+		return "", fmt.Errorf("PV: %q of PVC: %q on namespace: %q is a file volume, which can't be cloned",
+			pv.Name, ref.Name, namespace)
+	}
+	return pv.Spec.CSI.VolumeHandle, nil
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volumepopulator
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	cnsvolumesourcev1alpha1 "sigs.k8s.io/vsphere-csi-driver/pkg/apis/cnsoperator/cnsvolumesource/v1alpha1"
+	cnsoperatortypes "sigs.k8s.io/vsphere-csi-driver/pkg/syncer/cnsoperator/types"
+)
+
+func newReferenceGrant(namespace string, fromNamespace string, toName string) *unstructured.Unstructured {
+	grant := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"from": []interface{}{
+				map[string]interface{}{"group": "", "kind": "PersistentVolumeClaim", "namespace": fromNamespace},
+			},
+			"to": []interface{}{
+				map[string]interface{}{"group": "", "kind": "PersistentVolumeClaim", "name": toName},
+			},
+		},
+	}}
+	grant.SetGroupVersionKind(referenceGrantListGVK.GroupVersion().WithKind("ReferenceGrant"))
+	grant.SetNamespace(namespace)
+	grant.SetName("grant-" + fromNamespace)
+	return grant
+}
+
+// newReferenceGrantScheme returns the scheme of a fake client listing
+// ReferenceGrants, the fake client only lists the kinds registered in its
+// scheme.
+func newReferenceGrantScheme(t *testing.T) *runtime.Scheme {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	scheme.AddKnownTypeWithName(referenceGrantListGVK.GroupVersion().WithKind("ReferenceGrant"), &unstructured.Unstructured{})
+	scheme.AddKnownTypeWithName(referenceGrantListGVK, &unstructured.UnstructuredList{})
+	return scheme
+}
+
+func TestGetClaimVolumeID(t *testing.T) {
+	ctx := context.Background()
+	goldenPVC := &v1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "golden", Namespace: "images"},
+		Spec:       v1.PersistentVolumeClaimSpec{VolumeName: "pvc-golden"},
+		Status:     v1.PersistentVolumeClaimStatus{Phase: v1.ClaimBound},
+	}
+	goldenPV := &v1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "pvc-golden"},
+		Spec: v1.PersistentVolumeSpec{
+			PersistentVolumeSource: v1.PersistentVolumeSource{
+				CSI: &v1.CSIPersistentVolumeSource{
+					Driver:       cnsoperatortypes.VSphereCSIDriverName,
+					VolumeHandle: "b1a2f5a5-4a4c-4c4f-9a4d-0a9a4b3c2d1e",
+				},
+			},
+		},
+	}
+	source := &cnsvolumesourcev1alpha1.CnsVolumeSource{
+		ObjectMeta: metav1.ObjectMeta{Name: "golden-image", Namespace: "team-a"},
+		Spec: cnsvolumesourcev1alpha1.CnsVolumeSourceSpec{
+			PersistentVolumeClaim: &cnsvolumesourcev1alpha1.CnsVolumeSourcePVCReference{
+				Name:      "golden",
+				Namespace: "images",
+			},
+		},
+	}
+	pvc := &v1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "vm-disk", Namespace: "team-a"}}
+
+	scheme := newReferenceGrantScheme(t)
+	for _, test := range []struct {
+		name    string
+		objects []runtime.Object
+		granted bool
+	}{
+		{"no ReferenceGrant", nil, false},
+		{"ReferenceGrant for another namespace", []runtime.Object{newReferenceGrant("images", "team-b", "")}, false},
+		{"ReferenceGrant for another PVC", []runtime.Object{newReferenceGrant("images", "team-a", "other")}, false},
+		{"ReferenceGrant for the PVC", []runtime.Object{newReferenceGrant("images", "team-a", "golden")}, true},
+		{"ReferenceGrant for all PVCs", []runtime.Object{newReferenceGrant("images", "team-a", "")}, true},
+	} {
+		c := fake.NewFakeClientWithScheme(scheme, append(test.objects, goldenPVC, goldenPV)...)
+		volumeID, err := getClaimVolumeID(ctx, c, pvc, source)
+		if !test.granted {
+			if err == nil || !strings.Contains(err.Error(), "no ReferenceGrant") {
+				t.Errorf("%s: expected the reference not to be granted, got volume %q, err: %v", test.name, volumeID, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		} else if volumeID != goldenPV.Spec.CSI.VolumeHandle {
+			t.Errorf("%s: expected volume %q, got %q", test.name, goldenPV.Spec.CSI.VolumeHandle, volumeID)
+		}
+	}
+}
@@ -0,0 +1,317 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volumepopulator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	cnstypes "github.com/vmware/govmomi/cns/types"
+	v1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	apis "sigs.k8s.io/vsphere-csi-driver/pkg/apis/cnsoperator"
+	cnsvolumesourcev1alpha1 "sigs.k8s.io/vsphere-csi-driver/pkg/apis/cnsoperator/cnsvolumesource/v1alpha1"
+	volumes "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/volume"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/vsphere"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/common/utils"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/common"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
+	cnsoperatortypes "sigs.k8s.io/vsphere-csi-driver/pkg/syncer/cnsoperator/types"
+)
+
+const (
+	defaultMaxWorkerThreadsForVolumePopulator = 10
+	// populatedVolumeIDAnnotation is set on the PVC to the ID of the volume
+	// populated for it, so that the data source is cloned only once.
+	populatedVolumeIDAnnotation = "cns.vmware.com/populated-volume-id"
+	// populatedVolumeNameAnnotation is set on the PVC to the name of the
+	// volume cloned for it before the clone starts, along with the
+	// CNSFinalizer, so that the clone is deleted if the PVC is deleted before
+	// its PV is created.
+	populatedVolumeNameAnnotation = "cns.vmware.com/populated-volume-name"
+	// csiParameterPrefix is the prefix of the StorageClass parameters of the
+	// external-provisioner, which aren't passed to the CSI driver.
+	csiParameterPrefix = "csi.storage.k8s.io/"
+	// csiFsTypeParameter is the StorageClass parameter of the filesystem of
+	// the volumes, as passed by the external-provisioner.
+	csiFsTypeParameter = csiParameterPrefix + "fstype"
+	defaultFsType      = "ext4"
+)
+
+// isCnsVolumeSourceClaim returns true if the dataSource of the PVC is a
+// CnsVolumeSource.
+func isCnsVolumeSourceClaim(pvc *v1.PersistentVolumeClaim) bool {
+	dataSource := pvc.Spec.DataSource
+	return dataSource != nil && dataSource.APIGroup != nil && *dataSource.APIGroup == apis.GroupName &&
+		dataSource.Kind == apis.CnsVolumeSourceKind
+}
+
+// validateVolumeSource validates the CnsVolumeSource referenced by the PVC
+// and the access modes of the PVC.
+func validateVolumeSource(pvc *v1.PersistentVolumeClaim, source *cnsvolumesourcev1alpha1.CnsVolumeSource) error {
+	specified := 0
+	if source.Spec.VolumeID != "" {
+		specified++
+	}
+	if source.Spec.DiskURLPath != "" {
+		specified++
+	}
+	if source.Spec.PersistentVolumeClaim != nil {
+		if source.Spec.PersistentVolumeClaim.Name == "" {
+			return errors.New("PersistentVolumeClaim must specify a name")
+		}
+		specified++
+	}
+	if specified != 1 {
+		return errors.New("exactly one of VolumeID, DiskURLPath and PersistentVolumeClaim must be specified")
+	}
+	if source.Spec.DiskURLPath != "" {
+		// A virtual disk has no owner to check the PVC is allowed to read it.
+		return errors.New("DiskURLPath is not supported, register the disk as the volume of a PVC and " +
+			"refer to the PVC instead")
+	}
+	for _, accessMode := range pvc.Spec.AccessModes {
+		if accessMode != v1.ReadWriteOnce {
+			return fmt.Errorf("AccessMode: %s is not supported", accessMode)
+		}
+	}
+	return nil
+}
+
+// getVolumeClaim returns the PVC bound to the PV of the CNS volume volumeID.
+// The volumes of PVs not bound to a PVC have no owner and can't be cloned.
+func getVolumeClaim(ctx context.Context, c client.Reader, volumeID string) (*v1.ObjectReference, error) {
+	pvs := &v1.PersistentVolumeList{}
+	if err := c.List(ctx, pvs); err != nil {
+		return nil, fmt.Errorf("failed to list PVs. Err: %v", err)
+	}
+	for _, pv := range pvs.Items {
+		if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != cnsoperatortypes.VSphereCSIDriverName ||
+			pv.Spec.CSI.VolumeHandle != volumeID {
+			continue
+		}
+		if pv.Spec.ClaimRef == nil || pv.Status.Phase != v1.VolumeBound {
+			return nil, fmt.Errorf("PV: %q of volume: %q is not bound to a PVC", pv.Name, volumeID)
+		}
+		return pv.Spec.ClaimRef, nil
+	}
+	return nil, fmt.Errorf("volume: %q is not the volume of a PV provisioned by %s", volumeID,
+		cnsoperatortypes.VSphereCSIDriverName)
+}
+
+// getSourceVolumeID returns the ID of the CNS volume the CnsVolumeSource
+// refers to, after checking that pvc is allowed to refer to it. A VolumeID
+// must be the volume of a PVC pvc is allowed to refer to, like the PVCs the
+// CnsVolumeSource refers to by name.
+func getSourceVolumeID(ctx context.Context, c client.Reader, pvc *v1.PersistentVolumeClaim,
+	source *cnsvolumesourcev1alpha1.CnsVolumeSource) (string, error) {
+	if source.Spec.PersistentVolumeClaim != nil {
+		return getClaimVolumeID(ctx, c, pvc, source)
+	}
+	claim, err := getVolumeClaim(ctx, c, source.Spec.VolumeID)
+	if err != nil {
+		return "", err
+	}
+	granted, err := isReferenceGranted(ctx, c, pvc.Namespace, claim.Namespace, claim.Name)
+	if err != nil {
+		return "", fmt.Errorf("failed to list ReferenceGrants on namespace: %q. Err: %v", claim.Namespace, err)
+	}
+	if !granted {
+		return "", fmt.Errorf("no ReferenceGrant on namespace: %q allows PVCs of namespace: %q to refer to PVC: %q "+
+			"of volume: %q", claim.Namespace, pvc.Namespace, claim.Name, source.Spec.VolumeID)
+	}
+	return source.Spec.VolumeID, nil
+}
+
+// getStorageClassParams returns the parameters of the StorageClass the
+// CSI driver parses, the csi.storage.k8s.io parameters are removed like the
+// external-provisioner does.
+func getStorageClassParams(ctx context.Context, sc *storagev1.StorageClass, csiMigrationEnabled bool) (
+	*common.StorageClassParams, error) {
+	params := make(map[string]string)
+	for param, value := range sc.Parameters {
+		if !strings.HasPrefix(strings.ToLower(param), csiParameterPrefix) {
+			params[param] = value
+		}
+	}
+	return common.ParseStorageClassParams(ctx, params, csiMigrationEnabled)
+}
+
+// cloneVolume clones the CNS volume sourceVolumeID to the CNS volume name of
+// at least capacityInMb, placed with the datastore and the storage policy of
+// the StorageClass, and returns its ID and capacity. The clone is persisted
+// under name, so that a retry with the same name returns the volume already
+// cloned.
+func cloneVolume(ctx context.Context, manager *common.Manager, vc *vsphere.VirtualCenter,
+	sourceVolumeID string, name string, capacityInMb int64, scParams *common.StorageClassParams) (string, int64, error) {
+	datastores, err := getCloneDatastores(ctx, manager.VolumeManager, vc, sourceVolumeID, scParams)
+	if err != nil {
+		return "", 0, err
+	}
+	spec := &common.CreateVolumeSpec{
+		Name:       name,
+		ScParams:   scParams,
+		CapacityMB: capacityInMb,
+		VolumeType: common.BlockVolumeType,
+	}
+	volumeInfo, capacityInMb, err := common.CloneBlockVolumeUtil(ctx, cnstypes.CnsClusterFlavorVanilla, manager,
+		spec, sourceVolumeID, 0, datastores)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to clone volume: %q. Err: %v", sourceVolumeID, err)
+	}
+	return volumeInfo.VolumeID.Id, capacityInMb, nil
+}
+
+// getCloneDatastores returns the datastores the volume sourceVolumeID can be
+// cloned to: the datastore of the StorageClass if it has one, or else the
+// datastore of the source volume, which the nodes using the source volume
+// access.
+func getCloneDatastores(ctx context.Context, volumeManager volumes.Manager, vc *vsphere.VirtualCenter,
+	sourceVolumeID string, scParams *common.StorageClassParams) ([]*vsphere.DatastoreInfo, error) {
+	datastoreURL := scParams.DatastoreURL
+	if datastoreURL == "" {
+		queryFilter := cnstypes.CnsQueryFilter{
+			VolumeIds: []cnstypes.CnsVolumeId{{Id: sourceVolumeID}},
+		}
+		queryResult, err := utils.QueryVolumeUtil(ctx, volumeManager, queryFilter, utils.QuerySelection())
+		if err != nil {
+			return nil, fmt.Errorf("failed to query volume: %q. Err: %v", sourceVolumeID, err)
+		}
+		if len(queryResult.Volumes) == 0 {
+			return nil, fmt.Errorf("volume: %q not found", sourceVolumeID)
+		}
+		datastoreURL = queryResult.Volumes[0].DatastoreUrl
+	}
+	datacenters, err := vc.GetDatacenters(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get datacenters. Err: %v", err)
+	}
+	for _, dc := range datacenters {
+		datastores, err := dc.GetAllDatastores(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the datastores of datacenter: %v. Err: %v", dc, err)
+		}
+		if datastore, ok := datastores[datastoreURL]; ok {
+			return []*vsphere.DatastoreInfo{datastore}, nil
+		}
+	}
+	return nil, fmt.Errorf("datastore: %q not found", datastoreURL)
+}
+
+// deleteClone deletes the CNS volume cloned for a PVC deleted before its PV
+// was created: the volume volumeID if it is known, or else the volume named
+// name registered by this cluster.
+func deleteClone(ctx context.Context, volumeManager volumes.Manager, clusterID string, volumeID string,
+	name string) error {
+	log := logger.GetLogger(ctx)
+	if volumeID == "" {
+		queryFilter := cnstypes.CnsQueryFilter{
+			Names:               []string{name},
+			ContainerClusterIds: []string{clusterID},
+		}
+		queryResult, err := utils.QueryVolumeUtil(ctx, volumeManager, queryFilter, utils.QuerySelection())
+		if err != nil {
+			return fmt.Errorf("failed to query volume: %q. Err: %v", name, err)
+		}
+		if len(queryResult.Volumes) == 0 {
+			log.Infof("Volume: %q was not cloned, nothing to delete", name)
+			return nil
+		}
+		volumeID = queryResult.Volumes[0].VolumeId.Id
+	}
+	log.Infof("Deleting volume: %q cloned for a deleted PVC", volumeID)
+	if err := volumeManager.DeleteVolume(ctx, volumeID, true); err != nil {
+		return fmt.Errorf("failed to delete volume: %q. Err: %v", volumeID, err)
+	}
+	return nil
+}
+
+// getPersistentVolumeSpec returns the spec of the PV bound to the PVC for the
+// populated volume volumeID.
+func getPersistentVolumeSpec(pvName string, volumeID string, capacityInMb int64,
+	pvc *v1.PersistentVolumeClaim, sc *storagev1.StorageClass) *v1.PersistentVolume {
+	fsType := defaultFsType
+	for param, value := range sc.Parameters {
+		if strings.EqualFold(param, csiFsTypeParameter) || strings.EqualFold(param, common.AttributeFsType) {
+			fsType = value
+		}
+	}
+	reclaimPolicy := v1.PersistentVolumeReclaimDelete
+	if sc.ReclaimPolicy != nil {
+		reclaimPolicy = *sc.ReclaimPolicy
+	}
+	return &v1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: pvName,
+			Annotations: map[string]string{
+				"pv.kubernetes.io/provisioned-by": cnsoperatortypes.VSphereCSIDriverName,
+			},
+		},
+		Spec: v1.PersistentVolumeSpec{
+			PersistentVolumeReclaimPolicy: reclaimPolicy,
+			Capacity: v1.ResourceList{
+				v1.ResourceStorage: resource.MustParse(strconv.FormatInt(capacityInMb, 10) + "Mi"),
+			},
+			PersistentVolumeSource: v1.PersistentVolumeSource{
+				CSI: &v1.CSIPersistentVolumeSource{
+					Driver:       cnsoperatortypes.VSphereCSIDriverName,
+					VolumeHandle: volumeID,
+					FSType:       fsType,
+					VolumeAttributes: map[string]string{
+						common.AttributeDiskType: common.DiskTypeBlockVolume,
+					},
+				},
+			},
+			AccessModes: pvc.Spec.AccessModes,
+			VolumeMode:  pvc.Spec.VolumeMode,
+			ClaimRef: &v1.ObjectReference{
+				Kind:       "PersistentVolumeClaim",
+				APIVersion: "v1",
+				Namespace:  pvc.Namespace,
+				Name:       pvc.Name,
+				UID:        pvc.UID,
+			},
+			StorageClassName: sc.Name,
+			MountOptions:     sc.MountOptions,
+		},
+	}
+}
+
+// getMaxWorkerThreadsToReconcileVolumePopulator returns the maximum number of
+// worker threads which can be run to populate PVCs.
+// If environment variable WORKER_THREADS_VOLUME_POPULATOR is set and valid,
+// return the value read from environment variable otherwise, use the default value
+func getMaxWorkerThreadsToReconcileVolumePopulator(ctx context.Context) int {
+	log := logger.GetLogger(ctx)
+	workerThreads := defaultMaxWorkerThreadsForVolumePopulator
+	if v := os.Getenv("WORKER_THREADS_VOLUME_POPULATOR"); v != "" {
+		if value, err := strconv.Atoi(v); err == nil && value > 0 {
+			workerThreads = value
+			log.Debugf("Maximum number of worker threads to run to populate volumes is set to %d", workerThreads)
+		} else {
+			log.Warnf("Maximum number of worker threads to run set in env variable WORKER_THREADS_VOLUME_POPULATOR %s is invalid, will use the default value %d", v, defaultMaxWorkerThreadsForVolumePopulator)
+		}
+	}
+	return workerThreads
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volumepopulator
+
+import (
+	"context"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	apis "sigs.k8s.io/vsphere-csi-driver/pkg/apis/cnsoperator"
+	cnsvolumesourcev1alpha1 "sigs.k8s.io/vsphere-csi-driver/pkg/apis/cnsoperator/cnsvolumesource/v1alpha1"
+	cnsoperatortypes "sigs.k8s.io/vsphere-csi-driver/pkg/syncer/cnsoperator/types"
+)
+
+func TestValidateVolumeSource(t *testing.T) {
+	pvc := &v1.PersistentVolumeClaim{Spec: v1.PersistentVolumeClaimSpec{
+		AccessModes: []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce},
+	}}
+	for _, test := range []struct {
+		name  string
+		spec  cnsvolumesourcev1alpha1.CnsVolumeSourceSpec
+		valid bool
+	}{
+		{"volume ID", cnsvolumesourcev1alpha1.CnsVolumeSourceSpec{VolumeID: "vol-1"}, true},
+		{"PVC", cnsvolumesourcev1alpha1.CnsVolumeSourceSpec{
+			PersistentVolumeClaim: &cnsvolumesourcev1alpha1.CnsVolumeSourcePVCReference{Name: "golden"}}, true},
+		{"disk URL path", cnsvolumesourcev1alpha1.CnsVolumeSourceSpec{
+			DiskURLPath: "https://10.192.255.221/folder/images/ubuntu-disk1.vmdk?dcPath=Datacenter-1&dsName=vsanDatastore"},
+			false},
+		{"no source", cnsvolumesourcev1alpha1.CnsVolumeSourceSpec{}, false},
+	} {
+		err := validateVolumeSource(pvc, &cnsvolumesourcev1alpha1.CnsVolumeSource{Spec: test.spec})
+		if (err == nil) != test.valid {
+			t.Errorf("%s: expected valid %v, got err: %v", test.name, test.valid, err)
+		}
+	}
+}
+
+func TestGetSourceVolumeID(t *testing.T) {
+	ctx := context.Background()
+	newPV := func(name string, volumeID string, claimNamespace string) *v1.PersistentVolume {
+		pv := &v1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: v1.PersistentVolumeSpec{
+				PersistentVolumeSource: v1.PersistentVolumeSource{
+					CSI: &v1.CSIPersistentVolumeSource{
+						Driver:       cnsoperatortypes.VSphereCSIDriverName,
+						VolumeHandle: volumeID,
+					},
+				},
+			},
+			Status: v1.PersistentVolumeStatus{Phase: v1.VolumeAvailable},
+		}
+		if claimNamespace != "" {
+			pv.Spec.ClaimRef = &v1.ObjectReference{Namespace: claimNamespace, Name: "disk"}
+			pv.Status.Phase = v1.VolumeBound
+		}
+		return pv
+	}
+	c := fake.NewFakeClientWithScheme(newReferenceGrantScheme(t),
+		newPV("pv-1", "vol-1", "team-a"),
+		newPV("pv-2", "vol-2", "team-b"),
+		newPV("pv-3", "vol-3", ""),
+		newPV("pv-5", "vol-5", "images"),
+		newReferenceGrant("images", "team-a", "disk"))
+	pvc := &v1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "vm-disk", Namespace: "team-a"}}
+
+	for _, test := range []struct {
+		volumeID string
+		allowed  bool
+	}{
+		// Volume of a PVC in the namespace of the PVC.
+		{"vol-1", true},
+		// Volume of a PVC in another namespace.
+		{"vol-2", false},
+		// Volume of a PVC in another namespace allowed by a ReferenceGrant.
+		{"vol-5", true},
+		// Volume of a PV not bound to a PVC.
+		{"vol-3", false},
+		// Volume without PV.
+		{"vol-4", false},
+	} {
+		source := &cnsvolumesourcev1alpha1.CnsVolumeSource{
+			Spec: cnsvolumesourcev1alpha1.CnsVolumeSourceSpec{VolumeID: test.volumeID},
+		}
+		volumeID, err := getSourceVolumeID(ctx, c, pvc, source)
+		if test.allowed && (err != nil || volumeID != test.volumeID) {
+			t.Errorf("expected volume %q to be allowed, got %q, err: %v", test.volumeID, volumeID, err)
+		} else if !test.allowed && err == nil {
+			t.Errorf("expected volume %q not to be allowed", test.volumeID)
+		}
+	}
+}
+
+func TestGetStorageClassParams(t *testing.T) {
+	sc := &storagev1.StorageClass{Parameters: map[string]string{
+		"storagePolicyName": "gold",
+		"datastoreURL":      "ds:///vmfs/volumes/vsan:1/",
+		csiFsTypeParameter:  "xfs",
+		"csi.storage.k8s.io/provisioner-secret-name": "secret",
+	}}
+	scParams, err := getStorageClassParams(context.Background(), sc, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if scParams.StoragePolicyName != "gold" || scParams.DatastoreURL != "ds:///vmfs/volumes/vsan:1/" {
+		t.Errorf("expected the storage policy and datastore of the StorageClass, got %+v", scParams)
+	}
+}
+
+func TestIsCnsVolumeSourceClaim(t *testing.T) {
+	group := apis.GroupName
+	for _, test := range []struct {
+		dataSource *v1.TypedLocalObjectReference
+		expected   bool
+	}{
+		{nil, false},
+		{&v1.TypedLocalObjectReference{Kind: "PersistentVolumeClaim", Name: "pvc"}, false},
+		{&v1.TypedLocalObjectReference{APIGroup: &group, Kind: apis.CnsVolumeSourceKind, Name: "src"}, true},
+	} {
+		pvc := &v1.PersistentVolumeClaim{Spec: v1.PersistentVolumeClaimSpec{DataSource: test.dataSource}}
+		if actual := isCnsVolumeSourceClaim(pvc); actual != test.expected {
+			t.Errorf("dataSource %+v: expected %v, got %v", test.dataSource, test.expected, actual)
+		}
+	}
+}
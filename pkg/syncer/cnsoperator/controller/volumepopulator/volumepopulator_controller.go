@@ -0,0 +1,371 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volumepopulator
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	cnstypes "github.com/vmware/govmomi/cns/types"
+	v1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+	apis "sigs.k8s.io/vsphere-csi-driver/pkg/apis/cnsoperator"
+	cnsvolumesourcev1alpha1 "sigs.k8s.io/vsphere-csi-driver/pkg/apis/cnsoperator/cnsvolumesource/v1alpha1"
+	volumes "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/volume"
+	cnsvsphere "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/vsphere"
+	commonconfig "sigs.k8s.io/vsphere-csi-driver/pkg/common/config"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/common"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/common/commonco"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
+	k8s "sigs.k8s.io/vsphere-csi-driver/pkg/kubernetes"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/syncer"
+	cnsoperatortypes "sigs.k8s.io/vsphere-csi-driver/pkg/syncer/cnsoperator/types"
+)
+
+// backOffDuration is a map of PVC namespaced names to the time after which a request
+// for this PVC will be requeued.
+// Initialized to 1 second for new PVCs and for PVCs whose latest reconcile
+// operation succeeded.
+// If the reconcile fails, backoff is incremented exponentially.
+var (
+	backOffDuration         map[types.NamespacedName]time.Duration
+	backOffDurationMapMutex = sync.Mutex{}
+)
+
+// Add creates a new VolumePopulator Controller and adds it to the Manager, ConfigurationInfo
+// and VirtualCenterTypes. The Manager will set fields on the Controller
+// and Start it when the Manager is Started.
+// The VolumePopulator Controller populates the volumes of the PVCs whose dataSource is
+// a CnsVolumeSource. The external-provisioner ignores such PVCs.
+func Add(mgr manager.Manager, clusterFlavor cnstypes.CnsClusterFlavor,
+	configInfo *commonconfig.ConfigurationInfo, volumeManager volumes.Manager) error {
+	ctx, log := logger.GetNewContextWithLogger()
+	if clusterFlavor != cnstypes.CnsClusterFlavorVanilla {
+		log.Debug("Not initializing the VolumePopulator Controller as its a non-Vanilla CSI deployment")
+		return nil
+	}
+	coCommonInterface, err := commonco.GetContainerOrchestratorInterface(ctx, common.Kubernetes, clusterFlavor, &syncer.COInitParams)
+	if err != nil {
+		log.Errorf("failed to create CO agnostic interface. Err: %v", err)
+		return err
+	}
+	if !coCommonInterface.IsFSSEnabled(ctx, common.VolumePopulator) {
+		log.Infof("Not initializing the VolumePopulator Controller as VolumePopulator feature is disabled on the cluster")
+		return nil
+	}
+
+	// Initializes kubernetes client
+	k8sclient, err := k8s.NewClient(ctx)
+	if err != nil {
+		log.Errorf("Creating Kubernetes client failed. Err: %v", err)
+		return err
+	}
+
+	// eventBroadcaster broadcasts events on PVCs to the event sink
+	eventBroadcaster := record.NewBroadcaster()
+	eventBroadcaster.StartRecordingToSink(
+		&typedcorev1.EventSinkImpl{
+			Interface: k8sclient.CoreV1().Events(""),
+		},
+	)
+	recorder := eventBroadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: apis.GroupName})
+	return add(mgr, newReconciler(mgr, configInfo, volumeManager, coCommonInterface, recorder))
+}
+
+// newReconciler returns a new reconcile.Reconciler
+func newReconciler(mgr manager.Manager, configInfo *commonconfig.ConfigurationInfo, volumeManager volumes.Manager,
+	coCommonInterface commonco.COCommonInterface, recorder record.EventRecorder) reconcile.Reconciler {
+	return &ReconcileVolumePopulator{client: mgr.GetClient(), configInfo: configInfo, volumeManager: volumeManager,
+		coCommonInterface: coCommonInterface, recorder: recorder}
+}
+
+// add adds a new Controller to mgr with r as the reconcile.Reconciler
+func add(mgr manager.Manager, r reconcile.Reconciler) error {
+	ctx, log := logger.GetNewContextWithLogger()
+
+	maxWorkerThreads := getMaxWorkerThreadsToReconcileVolumePopulator(ctx)
+	// Create a new controller
+	c, err := controller.New("volumepopulator-controller", mgr, controller.Options{Reconciler: r, MaxConcurrentReconciles: maxWorkerThreads})
+	if err != nil {
+		log.Errorf("Failed to create new VolumePopulator controller with error: %+v", err)
+		return err
+	}
+
+	backOffDuration = make(map[types.NamespacedName]time.Duration)
+
+	// Watch for changes to PVCs
+	err = c.Watch(&source.Kind{Type: &v1.PersistentVolumeClaim{}}, &handler.EnqueueRequestForObject{})
+	if err != nil {
+		log.Errorf("Failed to watch for changes to PersistentVolumeClaim resource with error: %+v", err)
+		return err
+	}
+	return nil
+}
+
+// blank assignment to verify that ReconcileVolumePopulator implements reconcile.Reconciler
+var _ reconcile.Reconciler = &ReconcileVolumePopulator{}
+
+// ReconcileVolumePopulator reconciles the PVCs whose dataSource is a CnsVolumeSource
+type ReconcileVolumePopulator struct {
+	// This client, initialized using mgr.Client() above, is a split client
+	// that reads objects from the cache and writes to the apiserver
+	client            client.Client
+	configInfo        *commonconfig.ConfigurationInfo
+	volumeManager     volumes.Manager
+	coCommonInterface commonco.COCommonInterface
+	recorder          record.EventRecorder
+}
+
+// Reconcile populates the volume of a pending PVC whose dataSource is a CnsVolumeSource:
+// the volume of the PVC the CnsVolumeSource refers to is cloned to a new volume, placed
+// with the StorageClass of the PVC, expanded to the requested size and bound to the PVC
+// with a new PV. A PVC deleted before its PV is created has its clone deleted.
+// Note:
+// The Controller will requeue the Request to be processed again if the returned error is non-nil or
+// Result.Requeue is true, otherwise upon completion it will remove the work from the queue.
+func (r *ReconcileVolumePopulator) Reconcile(ctx context.Context, request reconcile.Request) (reconcile.Result, error) {
+	log := logger.GetLogger(ctx)
+	pvc := &v1.PersistentVolumeClaim{}
+	err := r.client.Get(ctx, request.NamespacedName, pvc)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			backOffDurationMapMutex.Lock()
+			delete(backOffDuration, request.NamespacedName)
+			backOffDurationMapMutex.Unlock()
+			return reconcile.Result{}, nil
+		}
+		log.Errorf("Error reading the PVC with name: %q on namespace: %q. Err: %+v",
+			request.Name, request.Namespace, err)
+		return reconcile.Result{}, err
+	}
+	if !isCnsVolumeSourceClaim(pvc) {
+		backOffDurationMapMutex.Lock()
+		delete(backOffDuration, request.NamespacedName)
+		backOffDurationMapMutex.Unlock()
+		return reconcile.Result{}, nil
+	}
+	// The PV is named like the ones the external-provisioner creates.
+	pvName := "pvc-" + string(pvc.UID)
+	if pvc.Spec.VolumeName != "" || pvc.DeletionTimestamp != nil {
+		return r.finalize(ctx, request, pvc, pvName)
+	}
+	// Initialize backOffDuration for the PVC, if required.
+	backOffDurationMapMutex.Lock()
+	if _, exists := backOffDuration[request.NamespacedName]; !exists {
+		backOffDuration[request.NamespacedName] = time.Second
+	}
+	timeout := backOffDuration[request.NamespacedName]
+	backOffDurationMapMutex.Unlock()
+	log.Infof("Populating PVC: %q on namespace: %q from CnsVolumeSource: %q. timeout %q seconds",
+		pvc.Name, pvc.Namespace, pvc.Spec.DataSource.Name, timeout)
+
+	source := &cnsvolumesourcev1alpha1.CnsVolumeSource{}
+	err = r.client.Get(ctx, types.NamespacedName{Namespace: pvc.Namespace, Name: pvc.Spec.DataSource.Name}, source)
+	if err != nil {
+		recordEvent(ctx, r, pvc, v1.EventTypeWarning, fmt.Sprintf("Failed to get CnsVolumeSource: %q. Err: %v",
+			pvc.Spec.DataSource.Name, err))
+		return reconcile.Result{RequeueAfter: timeout}, nil
+	}
+	if err = validateVolumeSource(pvc, source); err != nil {
+		recordEvent(ctx, r, pvc, v1.EventTypeWarning, err.Error())
+		return reconcile.Result{RequeueAfter: timeout}, nil
+	}
+	if pvc.Spec.StorageClassName == nil || *pvc.Spec.StorageClassName == "" {
+		recordEvent(ctx, r, pvc, v1.EventTypeWarning, "PVC populated from a CnsVolumeSource must specify a StorageClass")
+		return reconcile.Result{RequeueAfter: timeout}, nil
+	}
+	sc := &storagev1.StorageClass{}
+	err = r.client.Get(ctx, types.NamespacedName{Name: *pvc.Spec.StorageClassName}, sc)
+	if err != nil {
+		recordEvent(ctx, r, pvc, v1.EventTypeWarning, fmt.Sprintf("Failed to get StorageClass: %q. Err: %v",
+			*pvc.Spec.StorageClassName, err))
+		return reconcile.Result{RequeueAfter: timeout}, nil
+	}
+	if sc.Provisioner != cnsoperatortypes.VSphereCSIDriverName {
+		log.Debugf("StorageClass: %q of PVC: %q on namespace: %q is not provisioned by %s. Ignoring",
+			sc.Name, pvc.Name, pvc.Namespace, cnsoperatortypes.VSphereCSIDriverName)
+		return reconcile.Result{}, nil
+	}
+
+	scParams, err := getStorageClassParams(ctx, sc, r.coCommonInterface.IsFSSEnabled(ctx, common.CSIMigration))
+	if err != nil {
+		recordEvent(ctx, r, pvc, v1.EventTypeWarning, fmt.Sprintf("Failed to parse parameters of StorageClass: %q. Err: %v",
+			sc.Name, err))
+		return reconcile.Result{RequeueAfter: timeout}, nil
+	}
+	sourceVolumeID, err := getSourceVolumeID(ctx, r.client, pvc, source)
+	if err != nil {
+		recordEvent(ctx, r, pvc, v1.EventTypeWarning, err.Error())
+		return reconcile.Result{RequeueAfter: timeout}, nil
+	}
+
+	vc, err := cnsvsphere.GetVirtualCenterInstance(ctx, r.configInfo, false)
+	if err != nil {
+		recordEvent(ctx, r, pvc, v1.EventTypeWarning, fmt.Sprintf("Failed to get virtual center instance. Err: %v", err))
+		return reconcile.Result{RequeueAfter: timeout}, nil
+	}
+	// Record the name of the clone on the PVC before cloning, along with a finalizer,
+	// so that the clone is deleted if the PVC is deleted before its PV is created.
+	if pvc.Annotations[populatedVolumeNameAnnotation] != pvName || !hasFinalizer(pvc) {
+		patch := client.MergeFrom(pvc.DeepCopy())
+		if pvc.Annotations == nil {
+			pvc.Annotations = make(map[string]string)
+		}
+		pvc.Annotations[populatedVolumeNameAnnotation] = pvName
+		if !hasFinalizer(pvc) {
+			pvc.Finalizers = append(pvc.Finalizers, cnsoperatortypes.CNSFinalizer)
+		}
+		if err = r.client.Patch(ctx, pvc, patch); err != nil {
+			recordEvent(ctx, r, pvc, v1.EventTypeWarning, fmt.Sprintf("Failed to record volume: %q on PVC. Err: %v",
+				pvName, err))
+			return reconcile.Result{RequeueAfter: timeout}, nil
+		}
+	}
+	// The clone is persisted under its name, a retry returns the volume already cloned.
+	manager := &common.Manager{
+		VcenterConfig:  vc.Config,
+		CnsConfig:      r.configInfo.Cfg,
+		VolumeManager:  r.volumeManager,
+		VcenterManager: cnsvsphere.GetVirtualCenterManager(ctx),
+	}
+	requestedSize := pvc.Spec.Resources.Requests[v1.ResourceStorage]
+	volumeID, capacityInMb, err := cloneVolume(ctx, manager, vc, sourceVolumeID, pvName,
+		common.RoundUpSize(requestedSize.Value(), common.MbInBytes), scParams)
+	if err != nil {
+		recordEvent(ctx, r, pvc, v1.EventTypeWarning, err.Error())
+		return reconcile.Result{RequeueAfter: timeout}, nil
+	}
+	if pvc.Annotations[populatedVolumeIDAnnotation] != volumeID {
+		patch := client.MergeFrom(pvc.DeepCopy())
+		pvc.Annotations[populatedVolumeIDAnnotation] = volumeID
+		if err = r.client.Patch(ctx, pvc, patch); err != nil {
+			recordEvent(ctx, r, pvc, v1.EventTypeWarning, fmt.Sprintf("Failed to record populated volume: %q on PVC. Err: %v",
+				volumeID, err))
+			return reconcile.Result{RequeueAfter: timeout}, nil
+		}
+		log.Infof("Populated volume: %q for PVC: %q on namespace: %q", volumeID, pvc.Name, pvc.Namespace)
+	}
+
+	// Create the PV bound to the PVC
+	pv := getPersistentVolumeSpec(pvName, volumeID, capacityInMb, pvc, sc)
+	if err = r.client.Create(ctx, pv); err != nil && !apierrors.IsAlreadyExists(err) {
+		recordEvent(ctx, r, pvc, v1.EventTypeWarning, fmt.Sprintf("Failed to create PV: %q. Err: %v", pvName, err))
+		return reconcile.Result{RequeueAfter: timeout}, nil
+	}
+	recordEvent(ctx, r, pvc, v1.EventTypeNormal, fmt.Sprintf("Populated volume: %q from CnsVolumeSource: %q",
+		volumeID, source.Name))
+	return r.finalize(ctx, request, pvc, pvName)
+}
+
+// finalize removes the finalizer of a PVC whose PV is created, or which is
+// deleted, after deleting the volume cloned for it if its PV wasn't created.
+func (r *ReconcileVolumePopulator) finalize(ctx context.Context, request reconcile.Request,
+	pvc *v1.PersistentVolumeClaim, pvName string) (reconcile.Result, error) {
+	log := logger.GetLogger(ctx)
+	if !hasFinalizer(pvc) {
+		backOffDurationMapMutex.Lock()
+		delete(backOffDuration, request.NamespacedName)
+		backOffDurationMapMutex.Unlock()
+		return reconcile.Result{}, nil
+	}
+	backOffDurationMapMutex.Lock()
+	if _, exists := backOffDuration[request.NamespacedName]; !exists {
+		backOffDuration[request.NamespacedName] = time.Second
+	}
+	timeout := backOffDuration[request.NamespacedName]
+	backOffDurationMapMutex.Unlock()
+	// The volume belongs to the PV once it is created.
+	err := r.client.Get(ctx, types.NamespacedName{Name: pvName}, &v1.PersistentVolume{})
+	if apierrors.IsNotFound(err) {
+		if pvc.DeletionTimestamp == nil {
+			// The PV is bound to the PVC but not observed yet.
+			return reconcile.Result{RequeueAfter: timeout}, nil
+		}
+		if err = deleteClone(ctx, r.volumeManager, r.configInfo.Cfg.Global.ClusterID,
+			pvc.Annotations[populatedVolumeIDAnnotation], pvc.Annotations[populatedVolumeNameAnnotation]); err != nil {
+			recordEvent(ctx, r, pvc, v1.EventTypeWarning, err.Error())
+			return reconcile.Result{RequeueAfter: timeout}, nil
+		}
+	} else if err != nil {
+		log.Errorf("failed to get PV: %q. Err: %v", pvName, err)
+		return reconcile.Result{RequeueAfter: timeout}, nil
+	}
+	patch := client.MergeFrom(pvc.DeepCopy())
+	var finalizers []string
+	for _, finalizer := range pvc.Finalizers {
+		if finalizer != cnsoperatortypes.CNSFinalizer {
+			finalizers = append(finalizers, finalizer)
+		}
+	}
+	pvc.Finalizers = finalizers
+	if err = r.client.Patch(ctx, pvc, patch); err != nil && !apierrors.IsNotFound(err) {
+		log.Errorf("failed to remove finalizer %q from PVC: %q on namespace: %q. Err: %v",
+			cnsoperatortypes.CNSFinalizer, pvc.Name, pvc.Namespace, err)
+		return reconcile.Result{RequeueAfter: timeout}, nil
+	}
+	backOffDurationMapMutex.Lock()
+	delete(backOffDuration, request.NamespacedName)
+	backOffDurationMapMutex.Unlock()
+	return reconcile.Result{}, nil
+}
+
+// hasFinalizer returns true if the CNSFinalizer is set on the PVC.
+func hasFinalizer(pvc *v1.PersistentVolumeClaim) bool {
+	for _, finalizer := range pvc.Finalizers {
+		if finalizer == cnsoperatortypes.CNSFinalizer {
+			return true
+		}
+	}
+	return false
+}
+
+// recordEvent records the event on the PVC, sets the backOffDuration for the PVC appropriately
+// and logs the message.
+// backOffDuration is reset to 1 second on success and doubled on failure.
+func recordEvent(ctx context.Context, r *ReconcileVolumePopulator, pvc *v1.PersistentVolumeClaim, eventtype string, msg string) {
+	log := logger.GetLogger(ctx)
+	name := types.NamespacedName{Namespace: pvc.Namespace, Name: pvc.Name}
+	switch eventtype {
+	case v1.EventTypeWarning:
+		log.Errorf("PVC: %q on namespace: %q: %s", pvc.Name, pvc.Namespace, msg)
+		// Double backOff duration
+		backOffDurationMapMutex.Lock()
+		backOffDuration[name] = backOffDuration[name] * 2
+		r.recorder.Event(pvc, v1.EventTypeWarning, "VolumePopulationFailed", msg)
+		backOffDurationMapMutex.Unlock()
+	case v1.EventTypeNormal:
+		log.Infof("PVC: %q on namespace: %q: %s", pvc.Name, pvc.Namespace, msg)
+		// Reset backOff duration to one second
+		backOffDurationMapMutex.Lock()
+		backOffDuration[name] = time.Second
+		r.recorder.Event(pvc, v1.EventTypeNormal, "VolumePopulationSucceeded", msg)
+		backOffDurationMapMutex.Unlock()
+	}
+}
@@ -25,7 +25,7 @@ import (
 
 	"github.com/fsnotify/fsnotify"
 	cnstypes "github.com/vmware/govmomi/cns/types"
-	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/manager/signals"
@@ -86,6 +86,46 @@ func InitCnsOperator(ctx context.Context, clusterFlavor cnstypes.CnsClusterFlavo
 		return err
 	}
 
+	if clusterFlavor == cnstypes.CnsClusterFlavorVanilla {
+		cnsOperator.coCommonInterface, err = commonco.GetContainerOrchestratorInterface(ctx, common.Kubernetes, cnstypes.CnsClusterFlavorVanilla, coInitParams)
+		if err != nil {
+			log.Errorf("failed to create CO agnostic interface. Err: %v", err)
+			return err
+		}
+		if cnsOperator.coCommonInterface.IsFSSEnabled(ctx, common.VolumePopulator) {
+			// Create CnsVolumeSource CRD from manifest if volume populator feature is enabled
+			err = k8s.CreateCustomResourceDefinitionFromManifest(ctx, "cnsvolumesource_crd.yaml")
+			if err != nil {
+				log.Errorf("Failed to create %q CRD. Err: %+v", cnsoperatorv1alpha1.CnsVolumeSourcePlural, err)
+				return err
+			}
+		}
+		if cnsOperator.coCommonInterface.IsFSSEnabled(ctx, common.VolumeReplication) {
+			// Create CnsVolumeReplication CRD from manifest if volume replication feature is enabled
+			err = k8s.CreateCustomResourceDefinitionFromManifest(ctx, "cnsvolumereplication_crd.yaml")
+			if err != nil {
+				log.Errorf("Failed to create %q CRD. Err: %+v", cnsoperatorv1alpha1.CnsVolumeReplicationPlural, err)
+				return err
+			}
+		}
+		if cnsOperator.coCommonInterface.IsFSSEnabled(ctx, common.VolumeInventoryExport) {
+			// Create CnsVolumeInventory CRD from manifest if volume inventory export feature is enabled
+			err = k8s.CreateCustomResourceDefinitionFromManifest(ctx, "cnsvolumeinventory_crd.yaml")
+			if err != nil {
+				log.Errorf("Failed to create %q CRD. Err: %+v", cnsoperatorv1alpha1.CnsVolumeInventoryPlural, err)
+				return err
+			}
+		}
+		if cnsOperator.coCommonInterface.IsFSSEnabled(ctx, common.NamespaceStorageQuota) {
+			// Create CnsStorageQuota CRD from manifest if namespace storage quota feature is enabled
+			err = k8s.CreateCustomResourceDefinitionFromManifest(ctx, "cnsstoragequota_crd.yaml")
+			if err != nil {
+				log.Errorf("Failed to create %q CRD. Err: %+v", cnsoperatorv1alpha1.CnsStorageQuotaPlural, err)
+				return err
+			}
+		}
+	}
+
 	// TODO: Verify leader election for CNS Operator in multi-master mode
 	// Create CRD's for WCP flavor
 	if clusterFlavor == cnstypes.CnsClusterFlavorWorkload {
@@ -93,7 +133,7 @@ func InitCnsOperator(ctx context.Context, clusterFlavor cnstypes.CnsClusterFlavo
 		crdKindNodeVMAttachment := reflect.TypeOf(cnsnodevmattachmentv1alpha1.CnsNodeVmAttachment{}).Name()
 		crdNameNodeVMAttachment := cnsoperatorv1alpha1.CnsNodeVMAttachmentPlural + "." + cnsoperatorv1alpha1.SchemeGroupVersion.Group
 		err = k8s.CreateCustomResourceDefinitionFromSpec(ctx, crdNameNodeVMAttachment, cnsoperatorv1alpha1.CnsNodeVMAttachmentSingular, cnsoperatorv1alpha1.CnsNodeVMAttachmentPlural,
-			crdKindNodeVMAttachment, cnsoperatorv1alpha1.SchemeGroupVersion.Group, cnsoperatorv1alpha1.SchemeGroupVersion.Version, apiextensionsv1beta1.NamespaceScoped)
+			crdKindNodeVMAttachment, cnsoperatorv1alpha1.SchemeGroupVersion.Group, cnsoperatorv1alpha1.SchemeGroupVersion.Version, apiextensionsv1.NamespaceScoped)
 		if err != nil {
 			log.Errorf("failed to create %q CRD. Err: %+v", crdNameNodeVMAttachment, err)
 			return err
@@ -104,7 +144,7 @@ func InitCnsOperator(ctx context.Context, clusterFlavor cnstypes.CnsClusterFlavo
 		crdNameVolumeMetadata := cnsoperatorv1alpha1.CnsVolumeMetadataPlural + "." + cnsoperatorv1alpha1.SchemeGroupVersion.Group
 
 		err = k8s.CreateCustomResourceDefinitionFromSpec(ctx, crdNameVolumeMetadata, cnsoperatorv1alpha1.CnsVolumeMetadataSingular, cnsoperatorv1alpha1.CnsVolumeMetadataPlural,
-			crdKindVolumeMetadata, cnsoperatorv1alpha1.SchemeGroupVersion.Group, cnsoperatorv1alpha1.SchemeGroupVersion.Version, apiextensionsv1beta1.NamespaceScoped)
+			crdKindVolumeMetadata, cnsoperatorv1alpha1.SchemeGroupVersion.Group, cnsoperatorv1alpha1.SchemeGroupVersion.Version, apiextensionsv1.NamespaceScoped)
 		if err != nil {
 			log.Errorf("failed to create %q CRD. Err: %+v", crdKindVolumeMetadata, err)
 			return err
@@ -0,0 +1,233 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	cnstypes "github.com/vmware/govmomi/cns/types"
+	"github.com/vmware/govmomi/units"
+	vim25types "github.com/vmware/govmomi/vim25/types"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+
+	cnsvsphere "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/vsphere"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/common/prometheus"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/common/utils"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
+)
+
+// datastoreSpaceLevel is how low the free space of a datastore is.
+type datastoreSpaceLevel int
+
+const (
+	datastoreSpaceOK datastoreSpaceLevel = iota
+	datastoreSpaceLow
+	datastoreSpaceCritical
+)
+
+const (
+	// reasonDatastoreSpaceLow is the reason of the events emitted on the PVs
+	// of a datastore whose free space dropped below the low space threshold.
+	reasonDatastoreSpaceLow = "DatastoreSpaceLow"
+	// reasonDatastoreSpaceCritical is the reason of the events emitted on the
+	// PVs of a datastore whose free space dropped below the critical threshold.
+	reasonDatastoreSpaceCritical = "DatastoreSpaceCritical"
+	// reasonDatastoreSpaceRecovered is the reason of the events emitted on the
+	// PVs of a datastore whose free space is above the thresholds again.
+	reasonDatastoreSpaceRecovered = "DatastoreSpaceRecovered"
+)
+
+// pvSpaceLevels has the last level of the free space of the datastore of each
+// PV by PV UID, events are only emitted on a PV when its level changes.
+var pvSpaceLevels = make(map[types.UID]datastoreSpaceLevel)
+
+// getDatastoreCapacityIntervalInMin returns the interval the capacity of the datastores is checked at
+// If environment variable DATASTORE_CAPACITY_INTERVAL_MINUTES is set and valid,
+// return the interval value read from environment variable
+// otherwise, use the default value 10 minutes
+func getDatastoreCapacityIntervalInMin(ctx context.Context) int {
+	log := logger.GetLogger(ctx)
+	datastoreCapacityIntervalInMin := defaultDatastoreCapacityIntervalInMin
+	if v := os.Getenv("DATASTORE_CAPACITY_INTERVAL_MINUTES"); v != "" {
+		if value, err := strconv.Atoi(v); err == nil && value > 0 {
+			datastoreCapacityIntervalInMin = value
+			log.Infof("DatastoreCapacity: datastore capacity interval is set to %d minutes", datastoreCapacityIntervalInMin)
+		} else {
+			log.Warnf("DatastoreCapacity: datastore capacity interval set in env variable DATASTORE_CAPACITY_INTERVAL_MINUTES %s is invalid, will use the default interval", v)
+		}
+	}
+	return datastoreCapacityIntervalInMin
+}
+
+// getDatastoreSpaceThresholds returns the percentages of free space below which the free space of a datastore is
+// low and critical. The defaults are overridden by the environment variables DATASTORE_LOW_SPACE_PERCENT and
+// DATASTORE_CRITICAL_SPACE_PERCENT when they are set and valid.
+func getDatastoreSpaceThresholds(ctx context.Context) (float64, float64) {
+	log := logger.GetLogger(ctx)
+	getPercent := func(name string, defaultValue float64) float64 {
+		v := os.Getenv(name)
+		if v == "" {
+			return defaultValue
+		}
+		value, err := strconv.ParseFloat(v, 64)
+		if err != nil || value < 0 || value > 100 {
+			log.Warnf("DatastoreCapacity: percentage set in env variable %s %s is invalid, will use the default %v%%", name, v, defaultValue)
+			return defaultValue
+		}
+		return value
+	}
+	low := getPercent("DATASTORE_LOW_SPACE_PERCENT", defaultDatastoreLowSpacePercent)
+	critical := getPercent("DATASTORE_CRITICAL_SPACE_PERCENT", defaultDatastoreCriticalSpacePercent)
+	if critical > low {
+		log.Warnf("DatastoreCapacity: critical space percentage %v%% is above the low space percentage %v%%, will use the defaults", critical, low)
+		return defaultDatastoreLowSpacePercent, defaultDatastoreCriticalSpacePercent
+	}
+	return low, critical
+}
+
+// csiCheckDatastoreCapacity exports the capacity and free space of the datastores holding volumes of the cluster
+// as metrics and emits events on the PVs of the datastores whose free space drops below the thresholds.
+func csiCheckDatastoreCapacity(ctx context.Context, metadataSyncer *metadataSyncInformer, recorder record.EventRecorder) {
+	log := logger.GetLogger(ctx)
+	// Call CNS QueryAll to get container volumes by cluster ID
+	queryFilter := cnstypes.CnsQueryFilter{
+		ContainerClusterIds: []string{
+			metadataSyncer.configInfo.Cfg.Global.ClusterID,
+		},
+	}
+	queryResult, err := utils.CachedQueryVolumeUtil(ctx, metadataSyncer.volumeManager, queryFilter, utils.QuerySelection())
+	if err != nil {
+		log.Errorf("DatastoreCapacity: QueryVolume failed with err=%+v", err.Error())
+		return
+	}
+	k8sPVs, err := getPVsInBoundAvailableOrReleased(ctx, metadataSyncer)
+	if err != nil {
+		log.Errorf("DatastoreCapacity: failed to get PVs from kubernetes. Err: %+v", err)
+		return
+	}
+	pvsByVolumeID := make(map[string]*v1.PersistentVolume, len(k8sPVs))
+	for _, pv := range k8sPVs {
+		if pv.Spec.CSI != nil {
+			pvsByVolumeID[pv.Spec.CSI.VolumeHandle] = pv
+		}
+	}
+	pvsByDatastoreURL := make(map[string][]*v1.PersistentVolume)
+	for _, volume := range queryResult.Volumes {
+		if volume.DatastoreUrl == "" {
+			continue
+		}
+		pvsByDatastoreURL[volume.DatastoreUrl] = append(pvsByDatastoreURL[volume.DatastoreUrl], pvsByVolumeID[volume.VolumeId.Id])
+	}
+
+	vcenter, err := cnsvsphere.GetVirtualCenterInstance(ctx, metadataSyncer.configInfo, false)
+	if err != nil {
+		log.Errorf("DatastoreCapacity: failed to get vcenter with error %+v", err)
+		return
+	}
+	datacenters, err := vcenter.GetDatacenters(ctx)
+	if err != nil {
+		log.Errorf("DatastoreCapacity: failed to get datacenters with error %+v", err)
+		return
+	}
+	summaries := make(map[string]vim25types.DatastoreSummary)
+	for _, datacenter := range datacenters {
+		dcSummaries, err := datacenter.GetAllDatastoreSummaries(ctx)
+		if err != nil {
+			log.Errorf("DatastoreCapacity: failed to get datastores of %s with error %+v", datacenter, err)
+			return
+		}
+		for url, summary := range dcSummaries {
+			summaries[url] = summary
+		}
+	}
+	low, critical := getDatastoreSpaceThresholds(ctx)
+	checkDatastoreSpace(ctx, recorder, summaries, pvsByDatastoreURL, low, critical)
+}
+
+// checkDatastoreSpace exports the capacity and free space of the datastores in pvsByDatastoreURL, and emits events
+// on the PVs whose datastore free space level changed since the previous check.
+func checkDatastoreSpace(ctx context.Context, recorder record.EventRecorder, summaries map[string]vim25types.DatastoreSummary,
+	pvsByDatastoreURL map[string][]*v1.PersistentVolume, lowPercent float64, criticalPercent float64) {
+	log := logger.GetLogger(ctx)
+	checkedPVs := make(map[types.UID]bool)
+	for url, pvs := range pvsByDatastoreURL {
+		summary, ok := summaries[url]
+		if !ok || summary.Capacity <= 0 {
+			log.Debugf("DatastoreCapacity: capacity of datastore %q isn't known", url)
+			// Keep the last level of the PVs until the capacity is known again.
+			for _, pv := range pvs {
+				if pv != nil {
+					checkedPVs[pv.UID] = true
+				}
+			}
+			continue
+		}
+		prometheus.DatastoreCapacityBytes.WithLabelValues(summary.Name, url).Set(float64(summary.Capacity))
+		prometheus.DatastoreFreeSpaceBytes.WithLabelValues(summary.Name, url).Set(float64(summary.FreeSpace))
+
+		freePercent := float64(summary.FreeSpace) * 100 / float64(summary.Capacity)
+		level := datastoreSpaceOK
+		if freePercent < criticalPercent {
+			level = datastoreSpaceCritical
+		} else if freePercent < lowPercent {
+			level = datastoreSpaceLow
+		}
+		eventType, reason := v1.EventTypeWarning, reasonDatastoreSpaceLow
+		switch level {
+		case datastoreSpaceCritical:
+			reason = reasonDatastoreSpaceCritical
+		case datastoreSpaceOK:
+			eventType, reason = v1.EventTypeNormal, reasonDatastoreSpaceRecovered
+		}
+		msg := fmt.Sprintf("Datastore %q (%s) has %s free of %s (%.1f%%)", summary.Name, url,
+			units.ByteSize(summary.FreeSpace), units.ByteSize(summary.Capacity), freePercent)
+
+		changed := 0
+		for _, pv := range pvs {
+			if pv == nil {
+				continue
+			}
+			checkedPVs[pv.UID] = true
+			// PVs not seen before are at the OK level, so that no recovery
+			// event is emitted on new PVs.
+			if level == pvSpaceLevels[pv.UID] {
+				continue
+			}
+			pvSpaceLevels[pv.UID] = level
+			recorder.Event(pv, eventType, reason, msg)
+			changed++
+		}
+		if changed == 0 {
+			continue
+		}
+		if eventType == v1.EventTypeWarning {
+			log.Warnf("DatastoreCapacity: %s, emitted events on %d PVs", msg, changed)
+		} else {
+			log.Infof("DatastoreCapacity: %s, emitted events on %d PVs", msg, changed)
+		}
+	}
+	for uid := range pvSpaceLevels {
+		if !checkedPVs[uid] {
+			delete(pvSpaceLevels, uid)
+		}
+	}
+}
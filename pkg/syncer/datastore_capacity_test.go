@@ -0,0 +1,80 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	vim25types "github.com/vmware/govmomi/vim25/types"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+)
+
+// TestCheckDatastoreSpace checks that events are emitted on a PV only when
+// the level of the free space of its datastore changes.
+func TestCheckDatastoreSpace(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer func() { pvSpaceLevels = make(map[types.UID]datastoreSpaceLevel) }()
+
+	const url = "ds:///vmfs/volumes/ds-1/"
+	newPV := func(name string) *v1.PersistentVolume {
+		return &v1.PersistentVolume{ObjectMeta: metav1.ObjectMeta{Name: name, UID: types.UID(name)}}
+	}
+	pv1, pv2, pv3 := newPV("pv-1"), newPV("pv-2"), newPV("pv-3")
+	tests := []struct {
+		name      string
+		freeSpace int64
+		// Volumes without PV are nil.
+		pvs    []*v1.PersistentVolume
+		reason string
+		events int
+	}{
+		{"plenty of space", 50, []*v1.PersistentVolume{pv1, pv2, nil}, "", 0},
+		{"low space", 15, []*v1.PersistentVolume{pv1, pv2, nil}, reasonDatastoreSpaceLow, 2},
+		{"still low space", 12, []*v1.PersistentVolume{pv1, pv2, nil}, "", 0},
+		{"new PV on low space", 12, []*v1.PersistentVolume{pv1, pv2, pv3}, reasonDatastoreSpaceLow, 1},
+		{"critical space", 5, []*v1.PersistentVolume{pv1, pv2, pv3}, reasonDatastoreSpaceCritical, 3},
+		{"recovered", 30, []*v1.PersistentVolume{pv1, pv2, pv3}, reasonDatastoreSpaceRecovered, 3},
+		{"new PV on recovered", 30, []*v1.PersistentVolume{pv1, pv2, pv3, newPV("pv-4")}, "", 0},
+	}
+	for _, test := range tests {
+		recorder := record.NewFakeRecorder(10)
+		summaries := map[string]vim25types.DatastoreSummary{
+			url: {Name: "ds-1", Url: url, Capacity: 100, FreeSpace: test.freeSpace},
+		}
+		checkDatastoreSpace(ctx, recorder, summaries, map[string][]*v1.PersistentVolume{url: test.pvs}, 20, 10)
+		close(recorder.Events)
+		var events []string
+		for event := range recorder.Events {
+			events = append(events, event)
+		}
+		if len(events) != test.events {
+			t.Errorf("%s: expected %d events, got %v", test.name, test.events, events)
+			continue
+		}
+		for _, event := range events {
+			if !strings.Contains(event, test.reason) || !strings.Contains(event, "ds-1") {
+				t.Errorf("%s: expected a %s event naming the datastore, got %q", test.name, test.reason, event)
+			}
+		}
+	}
+}
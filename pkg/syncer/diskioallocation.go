@@ -0,0 +1,130 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+
+	cnstypes "github.com/vmware/govmomi/cns/types"
+	vimtypes "github.com/vmware/govmomi/vim25/types"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+
+	volumes "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/volume"
+	cnsvsphere "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/vsphere"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/common"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
+	csitypes "sigs.k8s.io/vsphere-csi-driver/pkg/csi/types"
+	k8s "sigs.k8s.io/vsphere-csi-driver/pkg/kubernetes"
+)
+
+// getDiskIOAllocation returns the storage I/O allocation of the virtual disk
+// of the volume of the PV: the one of its StorageClass, or of its volume
+// context if the StorageClass was deleted. The limit and shares of the volume
+// context no longer in the StorageClass are reset to unlimited and normal. It
+// returns nil if neither sets an allocation.
+func getDiskIOAllocation(ctx context.Context, pv *v1.PersistentVolume,
+	metadataSyncer *metadataSyncInformer) *vimtypes.StorageIOAllocationInfo {
+	log := logger.GetLogger(ctx)
+	provisioned, err := common.ParseDiskIOAllocation(pv.Spec.CSI.VolumeAttributes)
+	if err != nil {
+		log.Warnf("FullSync: Invalid storage I/O allocation of PV %q. err=%v", pv.Name, err)
+		return nil
+	}
+	allocation := provisioned
+	if pv.Spec.StorageClassName != "" {
+		sc, err := metadataSyncer.storageClassLister.Get(pv.Spec.StorageClassName)
+		if err == nil {
+			if allocation, err = common.ParseDiskIOAllocation(sc.Parameters); err != nil {
+				log.Warnf("FullSync: Invalid storage I/O allocation of StorageClass %q. err=%v", sc.Name, err)
+				return nil
+			}
+		} else if !apierrors.IsNotFound(err) {
+			log.Warnf("FullSync: Failed to get StorageClass %q of PV %q. err=%v", pv.Spec.StorageClassName,
+				pv.Name, err)
+			return nil
+		}
+	}
+	if !allocation.IsSet() && !provisioned.IsSet() {
+		return nil
+	}
+	info := allocation.StorageIOAllocationInfo()
+	if info.Limit == nil && provisioned.Limit != "" {
+		unlimited := int64(-1)
+		info.Limit = &unlimited
+	}
+	if info.Shares == nil && provisioned.Shares != "" {
+		info.Shares = &vimtypes.SharesInfo{Level: vimtypes.SharesLevelNormal}
+	}
+	return info
+}
+
+// fullSyncDiskIOAllocation sets the storage I/O allocation of the attached
+// volumes on their virtual disks. ControllerPublishVolume only sets it when
+// the volumes are attached, so the allocation of the volumes attached before
+// their StorageClass changed, or changed on the vCenter, is reconciled here.
+func fullSyncDiskIOAllocation(ctx context.Context, k8sPVs []*v1.PersistentVolume,
+	metadataSyncer *metadataSyncInformer) {
+	log := logger.GetLogger(ctx)
+	if metadataSyncer.clusterFlavor != cnstypes.CnsClusterFlavorVanilla {
+		return
+	}
+	pvs := make(map[string]*v1.PersistentVolume)
+	for _, pv := range k8sPVs {
+		if pv.Spec.CSI != nil && pv.Spec.CSI.Driver == csitypes.Name && !IsMultiAttachAllowed(pv) {
+			pvs[pv.Name] = pv
+		}
+	}
+	volumeAttachments, err := metadataSyncer.volumeAttachmentLister.List(labels.Everything())
+	if err != nil {
+		log.Warnf("FullSync: Failed to list volume attachments. err=%v", err)
+		return
+	}
+	vms := make(map[string]*cnsvsphere.VirtualMachine)
+	for _, va := range volumeAttachments {
+		if va.Spec.Attacher != csitypes.Name || !va.Status.Attached || va.Spec.Source.PersistentVolumeName == nil {
+			continue
+		}
+		pv, ok := pvs[*va.Spec.Source.PersistentVolumeName]
+		if !ok {
+			continue
+		}
+		allocation := getDiskIOAllocation(ctx, pv, metadataSyncer)
+		if allocation == nil {
+			continue
+		}
+		vm, ok := vms[va.Spec.NodeName]
+		if !ok {
+			node, err := metadataSyncer.nodeLister.Get(va.Spec.NodeName)
+			if err != nil {
+				log.Warnf("FullSync: Failed to get node %q. err=%v", va.Spec.NodeName, err)
+				continue
+			}
+			vm, err = cnsvsphere.GetVirtualMachineByUUID(ctx, k8s.GetNodeUUID(node), false)
+			if err != nil {
+				log.Warnf("FullSync: Failed to get VM of node %q. err=%v", node.Name, err)
+				continue
+			}
+			vms[va.Spec.NodeName] = vm
+		}
+		if err := volumes.SetDiskIOAllocation(ctx, vm, pv.Spec.CSI.VolumeHandle, allocation); err != nil {
+			log.Warnf("FullSync: Failed to set the storage I/O allocation of volume %q on node %q. err=%v",
+				pv.Spec.CSI.VolumeHandle, va.Spec.NodeName, err)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	vimtypes "github.com/vmware/govmomi/vim25/types"
+	v1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	storagelisters "k8s.io/client-go/listers/storage/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/common"
+	csitypes "sigs.k8s.io/vsphere-csi-driver/pkg/csi/types"
+)
+
+func TestGetDiskIOAllocation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for name, params := range map[string]map[string]string{
+		"sc-limit":  {common.AttributeIOPSLimit: "500"},
+		"sc-shares": {common.AttributeIOShares: "high"},
+		"sc-none":   {},
+	} {
+		if err := indexer.Add(&storagev1.StorageClass{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Parameters: params,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	metadataSyncer := &metadataSyncInformer{storageClassLister: storagelisters.NewStorageClassLister(indexer)}
+	newPV := func(storageClassName string, volumeAttributes map[string]string) *v1.PersistentVolume {
+		return &v1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: "pv"},
+			Spec: v1.PersistentVolumeSpec{
+				StorageClassName: storageClassName,
+				PersistentVolumeSource: v1.PersistentVolumeSource{
+					CSI: &v1.CSIPersistentVolumeSource{
+						Driver:           csitypes.Name,
+						VolumeHandle:     "volume",
+						VolumeAttributes: volumeAttributes,
+					},
+				},
+			},
+		}
+	}
+	limit := func(limit int64) *int64 { return &limit }
+	tests := []struct {
+		name     string
+		pv       *v1.PersistentVolume
+		expected *vimtypes.StorageIOAllocationInfo
+	}{
+		{
+			name:     "StorageClass changed",
+			pv:       newPV("sc-limit", map[string]string{common.AttributeIOPSLimit: "1000"}),
+			expected: &vimtypes.StorageIOAllocationInfo{Limit: limit(500)},
+		},
+		{
+			name:     "StorageClass deleted",
+			pv:       newPV("sc-deleted", map[string]string{common.AttributeIOPSLimit: "1000"}),
+			expected: &vimtypes.StorageIOAllocationInfo{Limit: limit(1000)},
+		},
+		{
+			name: "Limit removed from the StorageClass",
+			pv:   newPV("sc-shares", map[string]string{common.AttributeIOPSLimit: "1000"}),
+			expected: &vimtypes.StorageIOAllocationInfo{
+				Limit:  limit(-1),
+				Shares: &vimtypes.SharesInfo{Level: vimtypes.SharesLevelHigh},
+			},
+		},
+		{
+			name:     "Shares removed from the StorageClass",
+			pv:       newPV("sc-none", map[string]string{common.AttributeIOShares: "low"}),
+			expected: &vimtypes.StorageIOAllocationInfo{Shares: &vimtypes.SharesInfo{Level: vimtypes.SharesLevelNormal}},
+		},
+		{
+			name: "No allocation",
+			pv:   newPV("sc-none", nil),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			allocation := getDiskIOAllocation(ctx, test.pv, metadataSyncer)
+			if !reflect.DeepEqual(allocation, test.expected) {
+				t.Errorf("Expected storage I/O allocation %+v, got %+v", test.expected, allocation)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"sort"
+
+	cnstypes "github.com/vmware/govmomi/cns/types"
+
+	"sigs.k8s.io/vsphere-csi-driver/pkg/common/prometheus"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
+)
+
+// DriftReport has the divergences between the volumes in Kubernetes and CNS
+// found by CsiFullSyncDryRun, as sorted lists of volume IDs.
+type DriftReport struct {
+	// MissingVolumeIDs has the volumes of CSI PVs that are not in CNS, which
+	// full sync creates in CNS.
+	MissingVolumeIDs []string
+	// StaleVolumeIDs has the volumes whose metadata in CNS differs from the
+	// metadata of their PV, PVC and pods, which full sync updates in CNS.
+	StaleVolumeIDs []string
+	// OrphanedVolumeIDs has the volumes in CNS of the cluster whose PV is not
+	// in Kubernetes, which full sync deletes from CNS unless other clusters
+	// use them.
+	OrphanedVolumeIDs []string
+}
+
+// CsiFullSyncDryRun computes the divergences between the volume metadata on
+// a vanilla k8s cluster and the volume metadata on CNS that CsiFullSync would
+// reconcile, with the same computeFullSyncPlan step, without creating,
+// updating or deleting volumes in CNS. Unlike CsiFullSync, divergences are
+// reported on the first cycle they are found, and the volumes of in-tree
+// vSphere PVs are only used to tell whether the volumes in CNS are orphaned,
+// as registering them in CNS would be a mutation.
+func CsiFullSyncDryRun(ctx context.Context, metadataSyncer *metadataSyncInformer) (DriftReport, error) {
+	log := logger.GetLogger(ctx)
+	log.Infof("FullSync: dry run start")
+	var report DriftReport
+	for _, vcSyncer := range getVCenterSyncers(metadataSyncer) {
+		plan, err := computeFullSyncPlan(ctx, vcSyncer, false)
+		if err != nil {
+			log.Errorf("FullSync: dry run failed for vCenter %q. Err: %v", vcSyncer.host, err)
+			return report, err
+		}
+		if err := addFullSyncPlanToDriftReport(ctx, vcSyncer, plan, &report); err != nil {
+			return report, err
+		}
+	}
+
+	sort.Strings(report.MissingVolumeIDs)
+	sort.Strings(report.StaleVolumeIDs)
+	sort.Strings(report.OrphanedVolumeIDs)
+	prometheus.FullSyncDriftVolumes.WithLabelValues(prometheus.PrometheusMissingDriftType).Set(float64(len(report.MissingVolumeIDs)))
+	prometheus.FullSyncDriftVolumes.WithLabelValues(prometheus.PrometheusStaleDriftType).Set(float64(len(report.StaleVolumeIDs)))
+	prometheus.FullSyncDriftVolumes.WithLabelValues(prometheus.PrometheusOrphanedDriftType).Set(float64(len(report.OrphanedVolumeIDs)))
+	log.Infof("FullSync: dry run end. Missing volumes: %d, stale volumes: %d, orphaned volumes: %d",
+		len(report.MissingVolumeIDs), len(report.StaleVolumeIDs), len(report.OrphanedVolumeIDs))
+	return report, nil
+}
+
+// addFullSyncPlanToDriftReport adds the volumes the full sync plan of the
+// vCenter of metadataSyncer creates, updates and deletes in CNS to the report.
+// The volumes of in-tree vSphere PVs are not in the plan, so the volumes in CNS
+// with the metadata of one of the PVs of the cluster are not orphaned.
+func addFullSyncPlanToDriftReport(ctx context.Context, metadataSyncer *metadataSyncInformer, plan *fullSyncPlan,
+	report *DriftReport) error {
+	log := logger.GetLogger(ctx)
+	for _, createSpec := range plan.createSpecs {
+		volumeID := getCreateSpecVolumeID(createSpec)
+		log.Infof("FullSync: dry run found volume %q of PV %q missing in CNS", volumeID, createSpec.Name)
+		report.MissingVolumeIDs = append(report.MissingVolumeIDs, volumeID)
+	}
+	// Block volumes with pods have one update spec per pod.
+	staleVolumeIDs := make(map[string]bool)
+	for _, updateSpec := range plan.updateSpecs {
+		if !staleVolumeIDs[updateSpec.VolumeId.Id] {
+			staleVolumeIDs[updateSpec.VolumeId.Id] = true
+			log.Infof("FullSync: dry run found stale metadata in CNS for volume %q", updateSpec.VolumeId.Id)
+			report.StaleVolumeIDs = append(report.StaleVolumeIDs, updateSpec.VolumeId.Id)
+		}
+	}
+	if len(plan.orphanedVolumeIDs) == 0 {
+		return nil
+	}
+	clusterID := metadataSyncer.configInfo.Cfg.Global.ClusterID
+	k8sPVNames := make(map[string]bool)
+	for _, pv := range plan.k8sPVs {
+		k8sPVNames[pv.Name] = true
+	}
+	allQueryResults, err := fullSyncGetQueryResults(ctx, plan.orphanedVolumeIDs, clusterID, metadataSyncer.volumeManager, metadataSyncer)
+	if err != nil {
+		log.Errorf("FullSync: fullSyncGetQueryResults failed to query volume metadata from vc. Err: %v", err)
+		return err
+	}
+	for _, queryResult := range allQueryResults {
+		for _, volume := range queryResult.Volumes {
+			if !hasK8sPV(volume, clusterID, k8sPVNames) {
+				log.Infof("FullSync: dry run found orphaned volume %q in CNS", volume.VolumeId.Id)
+				report.OrphanedVolumeIDs = append(report.OrphanedVolumeIDs, volume.VolumeId.Id)
+			}
+		}
+	}
+	return nil
+}
+
+// hasK8sPV returns true if the metadata of the cluster of the volume in CNS
+// has a PV in k8sPVNames, such as the PV of a migrated in-tree vSphere volume.
+func hasK8sPV(volume cnstypes.CnsVolume, clusterID string, k8sPVNames map[string]bool) bool {
+	for _, metadata := range volume.Metadata.EntityMetadata {
+		entityMetadata, ok := metadata.(*cnstypes.CnsKubernetesEntityMetadata)
+		if !ok || entityMetadata.ClusterID != clusterID {
+			continue
+		}
+		if entityMetadata.EntityType == string(cnstypes.CnsKubernetesEntityTypePV) && k8sPVNames[entityMetadata.EntityName] {
+			return true
+		}
+	}
+	return false
+}
@@ -19,6 +19,8 @@ package syncer
 import (
 	"context"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/davecgh/go-spew/spew"
 	"github.com/vmware/govmomi/cns"
@@ -28,14 +30,78 @@ import (
 
 	"sigs.k8s.io/vsphere-csi-driver/pkg/apis/migration"
 	cnsvsphere "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/vsphere"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/common/prometheus"
 	"sigs.k8s.io/vsphere-csi-driver/pkg/common/utils"
 	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/common"
 	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
 )
 
+// FullSyncResult has the number of volumes a full sync reconciled with CNS.
+type FullSyncResult struct {
+	// VolumesCreated is the number of volumes created in CNS.
+	VolumesCreated int64
+	// VolumesUpdated is the number of volumes whose metadata was updated in CNS.
+	VolumesUpdated int64
+	// VolumesDeleted is the number of volumes deleted from CNS.
+	VolumesDeleted int64
+	// VolumesFailed is the number of volumes that failed to be created,
+	// updated or deleted in CNS.
+	VolumesFailed int64
+}
+
 // CsiFullSync reconciles volume metadata on a vanilla k8s cluster
 // with volume metadata on CNS
 func CsiFullSync(ctx context.Context, metadataSyncer *metadataSyncInformer) error {
+	_, err := CsiFullSyncWithResult(ctx, metadataSyncer)
+	return err
+}
+
+// CsiFullSyncWithResult runs CsiFullSync and returns the number of volumes it
+// reconciled, including the ones reconciled before it failed. The CNS of each
+// vCenter is synced in turn, a failure in one vCenter doesn't stop the sync
+// of the others.
+func CsiFullSyncWithResult(ctx context.Context, metadataSyncer *metadataSyncInformer) (FullSyncResult, error) {
+	log := logger.GetLogger(ctx)
+	start := time.Now()
+	result := &FullSyncResult{}
+	var err error
+	for _, vcSyncer := range getVCenterSyncers(metadataSyncer) {
+		if vcErr := csiFullSync(ctx, vcSyncer, result); vcErr != nil {
+			log.Errorf("FullSync: failed for vCenter %q. Err: %v", vcSyncer.host, vcErr)
+			err = vcErr
+		}
+	}
+	status := prometheus.PrometheusPassStatus
+	if err != nil {
+		status = prometheus.PrometheusFailStatus
+	}
+	prometheus.FullSyncHistVec.WithLabelValues(status).Observe(time.Since(start).Seconds())
+	return *result, err
+}
+
+// fullSyncPlan has the differences between the volumes of the PVs in
+// Kubernetes and the volumes in the CNS of a vCenter computed by
+// computeFullSyncPlan, as the changes reconciling them in CNS.
+type fullSyncPlan struct {
+	// migrationFeatureState is the state of the CSI migration feature the plan
+	// is computed with.
+	migrationFeatureState bool
+	// k8sPVs has the PVs of the vCenter.
+	k8sPVs []*v1.PersistentVolume
+	// k8sPVMap has the volume IDs of the PVs of all the vCenters.
+	k8sPVMap map[string]string
+	// createSpecs creates the volumes of the PVs missing in CNS.
+	createSpecs []cnstypes.CnsVolumeCreateSpec
+	// updateSpecs updates the volumes whose metadata in CNS is stale.
+	updateSpecs []cnstypes.CnsVolumeMetadataUpdateSpec
+	// orphanedVolumeIDs has the volumes in CNS whose PV is not in Kubernetes,
+	// and which full sync deletes.
+	orphanedVolumeIDs []cnstypes.CnsVolumeId
+}
+
+// csiFullSync runs a full sync for CsiFullSync, counting the volumes it
+// reconciles in result.
+func csiFullSync(ctx context.Context, metadataSyncer *metadataSyncInformer, result *FullSyncResult) error {
 	log := logger.GetLogger(ctx)
 	log.Infof("FullSync: start")
 
@@ -44,11 +110,27 @@ func CsiFullSync(ctx context.Context, metadataSyncer *metadataSyncInformer) erro
 	if metadataSyncer.clusterFlavor == cnstypes.CnsClusterFlavorVanilla {
 		migrationFeatureStateForFullSync = metadataSyncer.coCommonInterface.IsFSSEnabled(ctx, common.CSIMigration)
 	}
+	plan, err := computeFullSyncPlan(ctx, metadataSyncer, migrationFeatureStateForFullSync)
+	if err != nil {
+		return err
+	}
+	applyFullSyncPlan(ctx, metadataSyncer, plan, result)
+	log.Infof("FullSync: end")
+	return nil
+}
+
+// computeFullSyncPlan computes the changes a full sync makes in the CNS of the
+// vCenter of metadataSyncer, without making them. The volumes of migrated
+// in-tree vSphere PVs are only reconciled if migrationFeatureStateForFullSync
+// is set.
+func computeFullSyncPlan(ctx context.Context, metadataSyncer *metadataSyncInformer,
+	migrationFeatureStateForFullSync bool) (*fullSyncPlan, error) {
+	log := logger.GetLogger(ctx)
 	// Get K8s PVs in State "Bound", "Available" or "Released"
 	k8sPVs, err := getPVsInBoundAvailableOrReleased(ctx, metadataSyncer)
 	if err != nil {
 		log.Errorf("FullSync: Failed to get PVs from kubernetes. Err: %v", err)
-		return err
+		return nil, err
 	}
 
 	// k8sPVMap is useful for clean and quicker look up.
@@ -58,7 +140,7 @@ func CsiFullSync(ctx context.Context, metadataSyncer *metadataSyncInformer) erro
 		// In case if feature state switch is enabled after syncer is deployed, we need to initialize the volumeMigrationService
 		if err := initVolumeMigrationService(ctx, metadataSyncer); err != nil {
 			log.Errorf("FullSync: Failed to get migration service. Err: %v", err)
-			return err
+			return nil, err
 		}
 	}
 
@@ -74,7 +156,7 @@ func CsiFullSync(ctx context.Context, metadataSyncer *metadataSyncInformer) erro
 			volumeHandle, err := volumeMigrationService.GetVolumeID(ctx, migrationVolumeSpec)
 			if err != nil {
 				log.Errorf("FullSync: Failed to get VolumeID from volumeMigrationService for migration VolumeSpec: %v with error %+v", migrationVolumeSpec, err)
-				return err
+				return nil, err
 			}
 			k8sPVMap[volumeHandle] = ""
 		}
@@ -84,7 +166,7 @@ func CsiFullSync(ctx context.Context, metadataSyncer *metadataSyncInformer) erro
 	pvToPVCMap, pvcToPodMap, err := buildPVCMapPodMap(ctx, k8sPVs, metadataSyncer)
 	if err != nil {
 		log.Errorf("FullSync: Failed to build PVCMap and PodMap. Err: %v", err)
-		return err
+		return nil, err
 	}
 	log.Debugf("FullSync: pvToPVCMap %v", pvToPVCMap)
 	log.Debugf("FullSync: pvcToPodMap %v", pvcToPodMap)
@@ -95,55 +177,160 @@ func CsiFullSync(ctx context.Context, metadataSyncer *metadataSyncInformer) erro
 			metadataSyncer.configInfo.Cfg.Global.ClusterID,
 		},
 	}
-	queryResult, err := utils.QueryVolumeUtil(ctx, metadataSyncer.volumeManager, queryFilter, cnstypes.CnsQuerySelection{}, metadataSyncer.coCommonInterface.IsFSSEnabled(ctx, common.AsyncQueryVolume))
+	// Only the volume IDs are needed, the metadata of the volumes to sync is
+	// queried by fullSyncConstructVolumeMaps.
+	queryResult, err := utils.CachedQueryVolumeUtil(ctx, metadataSyncer.volumeManager, queryFilter,
+		utils.QuerySelection(cnstypes.QuerySelectionNameTypeVolumeType))
 	if err != nil {
 		log.Errorf("PVCUpdated: QueryVolume failed with err=%+v", err.Error())
-		return err
+		return nil, err
+	}
+	// k8sPVMap keeps all the PVs, so that the volumes of the other vCenters
+	// are neither deleted nor dropped from the CNS maps.
+	k8sPVs, err = getPVsOfVCenter(ctx, metadataSyncer, k8sPVs, queryResult.Volumes)
+	if err != nil {
+		log.Errorf("FullSync: failed to get the PVs of vCenter %q. Err: %v", metadataSyncer.host, err)
+		return nil, err
 	}
 
 	volumeToCnsEntityMetadataMap, volumeToK8sEntityMetadataMap, volumeClusterDistributionMap, err := fullSyncConstructVolumeMaps(ctx, k8sPVs, queryResult.Volumes, pvToPVCMap, pvcToPodMap, metadataSyncer, migrationFeatureStateForFullSync)
 	if err != nil {
 		log.Errorf("FullSync: fullSyncGetEntityMetadata failed with err %+v", err)
-		return err
+		return nil, err
 	}
 	log.Debugf("FullSync: pvToCnsEntityMetadataMap %+v \n pvToK8sEntityMetadataMap: %+v \n", spew.Sdump(volumeToCnsEntityMetadataMap), spew.Sdump(volumeToK8sEntityMetadataMap))
 	log.Debugf("FullSync: volumes where clusterDistribution is set: %+v", volumeClusterDistributionMap)
 
-	vcenter, err := cnsvsphere.GetVirtualCenterInstance(ctx, metadataSyncer.configInfo, false)
+	vcenter, err := getSyncerVCenter(ctx, metadataSyncer)
 	if err != nil {
 		log.Errorf("FullSync: failed to get vcenter with error %+v", err)
-		return err
+		return nil, err
 	}
 	// Get specs for create and update volume calls
-	containerCluster := cnsvsphere.GetContainerCluster(metadataSyncer.configInfo.Cfg.Global.ClusterID, metadataSyncer.configInfo.Cfg.VirtualCenter[metadataSyncer.host].User, metadataSyncer.clusterFlavor, metadataSyncer.configInfo.Cfg.Global.ClusterDistribution)
+	containerCluster := getContainerCluster(metadataSyncer)
 	createSpecArray, updateSpecArray := fullSyncGetVolumeSpecs(ctx, vcenter.Client.Version, k8sPVs, volumeToCnsEntityMetadataMap, volumeToK8sEntityMetadataMap, volumeClusterDistributionMap, containerCluster, metadataSyncer, migrationFeatureStateForFullSync)
-	volToBeDeleted, err := getVolumesToBeDeleted(ctx, queryResult.Volumes, k8sPVMap, metadataSyncer, migrationFeatureStateForFullSync)
+	orphanedVolumes, err := getOrphanedVolumes(ctx, queryResult.Volumes, k8sPVMap, metadataSyncer, migrationFeatureStateForFullSync)
 	if err != nil {
 		log.Errorf("FullSync: failed to get list of volumes to be deleted with err %+v", err)
-		return err
-	}
+		return nil, err
+	}
+	if isOrphanVolumeDeletionEnabled(ctx, metadataSyncer) && len(orphanedVolumes) != 0 {
+		// The orphan volume cleanup deletes the volumes missing in K8s without
+		// K8s metadata with their FCDs, the others are only removed from CNS.
+		log.Debugf("FullSync: leaving the volumes missing in K8s without K8s metadata to the orphan volume cleanup")
+		allQueryResults, err := fullSyncGetQueryResults(ctx, orphanedVolumes, "", metadataSyncer.volumeManager,
+			metadataSyncer)
+		if err != nil {
+			log.Errorf("FullSync: failed to query the metadata of the volumes missing in K8s with err %+v", err)
+			return nil, err
+		}
+		var orphanedCnsVolumes []cnstypes.CnsVolume
+		for _, queryResult := range allQueryResults {
+			orphanedCnsVolumes = append(orphanedCnsVolumes, queryResult.Volumes...)
+		}
+		orphanedVolumes = getVolumesWithKubernetesMetadata(orphanedCnsVolumes, orphanedVolumes)
+	}
+	return &fullSyncPlan{
+		migrationFeatureState: migrationFeatureStateForFullSync,
+		k8sPVs:                k8sPVs,
+		k8sPVMap:              k8sPVMap,
+		createSpecs:           createSpecArray,
+		updateSpecs:           updateSpecArray,
+		orphanedVolumeIDs:     orphanedVolumes,
+	}, nil
+}
+
+// applyFullSyncPlan makes the changes of the plan in CNS, counting the volumes
+// it reconciles in result. Volumes are only created, or deleted, once they are
+// missing in CNS, or in K8s, across two full sync cycles. The volumes to
+// create, update and delete in CNS are reconciled by up to getFullSyncWorkers
+// workers each.
+func applyFullSyncPlan(ctx context.Context, metadataSyncer *metadataSyncInformer, plan *fullSyncPlan,
+	result *FullSyncResult) {
+	log := logger.GetLogger(ctx)
+	createSpecArray := confirmFullSyncCreates(ctx, plan.createSpecs)
+	volToBeDeleted := confirmFullSyncDeletes(ctx, plan.orphanedVolumeIDs)
 
+	workers := getFullSyncWorkers(ctx)
 	wg := sync.WaitGroup{}
 	wg.Add(3)
 	// Perform operations
-	go fullSyncCreateVolumes(ctx, createSpecArray, metadataSyncer, &wg, migrationFeatureStateForFullSync)
-	go fullSyncUpdateVolumes(ctx, updateSpecArray, metadataSyncer, &wg)
-	go fullSyncDeleteVolumes(ctx, volToBeDeleted, metadataSyncer, &wg, migrationFeatureStateForFullSync)
+	go fullSyncCreateVolumes(ctx, createSpecArray, metadataSyncer, &wg, plan.migrationFeatureState, workers, result)
+	go fullSyncUpdateVolumes(ctx, plan.updateSpecs, metadataSyncer, &wg, workers, result)
+	go fullSyncDeleteVolumes(ctx, volToBeDeleted, metadataSyncer, &wg, plan.migrationFeatureState, workers, result)
 	wg.Wait()
 
-	cleanupCnsMaps(k8sPVMap)
+	fullSyncDetachStaleAttachments(ctx, plan.k8sPVs, metadataSyncer)
+	fullSyncDiskIOAllocation(ctx, plan.k8sPVs, metadataSyncer)
+	if isDefaultVCenterSyncer(metadataSyncer) {
+		// Repair the tags of the volumes whose sync failed or was missed.
+		for _, pv := range plan.k8sPVs {
+			enqueueVolumeTags(metadataSyncer, pv)
+		}
+	}
+
+	cleanupCnsMaps(plan.k8sPVMap)
 	log.Debugf("FullSync: cnsDeletionMap at end of cycle: %v", cnsDeletionMap)
 	log.Debugf("FullSync: cnsCreationMap at end of cycle: %v", cnsCreationMap)
-	log.Infof("FullSync: end")
-	return nil
 }
 
-// fullSyncCreateVolumes create volumes with given array of createSpec
+// confirmFullSyncCreates returns the create specs of the volumes that were
+// already missing in CNS in the previous full sync cycle, per cnsCreationMap,
+// and adds the others to cnsCreationMap.
+func confirmFullSyncCreates(ctx context.Context, createSpecs []cnstypes.CnsVolumeCreateSpec) []cnstypes.CnsVolumeCreateSpec {
+	log := logger.GetLogger(ctx)
+	var createSpecArray []cnstypes.CnsVolumeCreateSpec
+	for _, createSpec := range createSpecs {
+		volumeHandle := getCreateSpecVolumeID(createSpec)
+		if _, existsInCnsCreationMap := cnsCreationMap[volumeHandle]; existsInCnsCreationMap {
+			log.Infof("FullSync: create is required for volume: %q, as volume was present in cnsCreationMap across two full-sync cycles", volumeHandle)
+			createSpecArray = append(createSpecArray, createSpec)
+		} else {
+			log.Infof("FullSync: Volume with id: %q and name: %q is added to cnsCreationMap", volumeHandle, createSpec.Name)
+			cnsCreationMap[volumeHandle] = true
+		}
+	}
+	return createSpecArray
+}
+
+// confirmFullSyncDeletes returns the volumes that were already missing in K8s
+// in the previous full sync cycle, per cnsDeletionMap, and adds the others to
+// cnsDeletionMap.
+func confirmFullSyncDeletes(ctx context.Context, volumeIDs []cnstypes.CnsVolumeId) []cnstypes.CnsVolumeId {
+	log := logger.GetLogger(ctx)
+	var volToBeDeleted []cnstypes.CnsVolumeId
+	for _, volumeID := range volumeIDs {
+		if _, existsInCnsDeletionMap := cnsDeletionMap[volumeID.Id]; existsInCnsDeletionMap {
+			// Volume does not exist in K8s across two fullsync cycles - add to delete list
+			log.Debugf("FullSync: Volume with id %s added to delete list as it was present in cnsDeletionMap across two fullsync cycles", volumeID.Id)
+			volToBeDeleted = append(volToBeDeleted, volumeID)
+		} else {
+			log.Infof("FullSync: Volume with id %q added to cnsDeletionMap", volumeID.Id)
+			cnsDeletionMap[volumeID.Id] = true
+		}
+	}
+	return volToBeDeleted
+}
+
+// getCreateSpecVolumeID returns the ID of the volume the create spec registers
+// in CNS.
+func getCreateSpecVolumeID(createSpec cnstypes.CnsVolumeCreateSpec) string {
+	switch details := createSpec.BackingObjectDetails.(type) {
+	case *cnstypes.CnsBlockBackingDetails:
+		return details.BackingDiskId
+	case *cnstypes.CnsVsanFileShareBackingDetails:
+		return details.BackingFileId
+	}
+	return ""
+}
+
+// fullSyncCreateVolumes create volumes with given array of createSpec, from up to workers goroutines, counting them in result
 // Before creating a volume, all current K8s volumes are retrieved
 // If the volume is successfully created, it is removed from cnsCreationMap
-func fullSyncCreateVolumes(ctx context.Context, createSpecArray []cnstypes.CnsVolumeCreateSpec, metadataSyncer *metadataSyncInformer, wg *sync.WaitGroup, migrationFeatureStateForFullSync bool) {
+func fullSyncCreateVolumes(ctx context.Context, createSpecArray []cnstypes.CnsVolumeCreateSpec, metadataSyncer *metadataSyncInformer, wg *sync.WaitGroup, migrationFeatureStateForFullSync bool, workers int, result *FullSyncResult) {
 	log := logger.GetLogger(ctx)
 	defer wg.Done()
+	defer observeFullSyncPhase(prometheus.PrometheusFullSyncCreatePhase, time.Now())
 	currentK8sPVMap := make(map[string]bool)
 	volumeOperationsLock.Lock()
 	defer volumeOperationsLock.Unlock()
@@ -168,7 +355,10 @@ func fullSyncCreateVolumes(ctx context.Context, createSpecArray []cnstypes.CnsVo
 			currentK8sPVMap[volumeHandle] = true
 		}
 	}
-	for _, createSpec := range createSpecArray {
+	// createdVolumeIDs has the IDs of the volumes to remove from cnsCreationMap, by index of their createSpec
+	createdVolumeIDs := make([]string, len(createSpecArray))
+	runWorkerPool(workers, len(createSpecArray), func(i int) {
+		createSpec := createSpecArray[i]
 		// Create volume if present in currentK8sPVMap
 		var volumeID string
 		if createSpec.VolumeType == common.BlockVolumeType && createSpec.BackingObjectDetails != nil && createSpec.BackingObjectDetails.(*cnstypes.CnsBlockBackingDetails) != nil {
@@ -177,28 +367,37 @@ func fullSyncCreateVolumes(ctx context.Context, createSpecArray []cnstypes.CnsVo
 			volumeID = createSpec.BackingObjectDetails.(*cnstypes.CnsVsanFileShareBackingDetails).BackingFileId
 		} else {
 			log.Warnf("Skipping createSpec: %+v as VolumeType is not known or BackingObjectDetails is either nil or not typecastable  ", spew.Sdump(createSpec))
-			continue
+			return
 		}
 		if _, existsInK8s := currentK8sPVMap[volumeID]; existsInK8s {
 			log.Debugf("FullSync: Calling CreateVolume for volume id: %q with createSpec %+v", volumeID, spew.Sdump(createSpec))
+			unlock := lockVolume(volumeID)
 			_, err := metadataSyncer.volumeManager.CreateVolume(ctx, &createSpec)
+			unlock()
 			if err != nil {
 				log.Warnf("FullSync: Failed to create volume with the spec: %+v. Err: %+v", spew.Sdump(createSpec), err)
-				continue
+				countFullSyncVolume(result, prometheus.PrometheusFullSyncCreatePhase, false)
+				return
 			}
+			countFullSyncVolume(result, prometheus.PrometheusFullSyncCreatePhase, true)
 		} else {
 			log.Debugf("FullSync: volumeID %s does not exist in Kubernetes, no need to create volume in CNS", volumeID)
 		}
-		delete(cnsCreationMap, volumeID)
+		createdVolumeIDs[i] = volumeID
+	})
+	for _, volumeID := range createdVolumeIDs {
+		if volumeID != "" {
+			delete(cnsCreationMap, volumeID)
+		}
 	}
-
 }
 
-// fullSyncDeleteVolumes delete volumes with given array of volumeId
+// fullSyncDeleteVolumes delete volumes with given array of volumeId, from up to workers goroutines, counting them in result
 // Before deleting a volume, all current K8s volumes are retrieved
 // If the volume is successfully deleted, it is removed from cnsDeletionMap
-func fullSyncDeleteVolumes(ctx context.Context, volumeIDDeleteArray []cnstypes.CnsVolumeId, metadataSyncer *metadataSyncInformer, wg *sync.WaitGroup, migrationFeatureStateForFullSync bool) {
+func fullSyncDeleteVolumes(ctx context.Context, volumeIDDeleteArray []cnstypes.CnsVolumeId, metadataSyncer *metadataSyncInformer, wg *sync.WaitGroup, migrationFeatureStateForFullSync bool, workers int, result *FullSyncResult) {
 	defer wg.Done()
+	defer observeFullSyncPhase(prometheus.PrometheusFullSyncDeletePhase, time.Now())
 	log := logger.GetLogger(ctx)
 	deleteDisk := false
 	currentK8sPVMap := make(map[string]bool)
@@ -244,50 +443,152 @@ func fullSyncDeleteVolumes(ctx context.Context, volumeIDDeleteArray []cnstypes.C
 		log.Errorf("FullSync: fullSyncGetQueryResults failed to query volume metadata from vc. Err: %v", err)
 		return
 	}
-	// Verify if Volume is not in use by any other Cluster before removing CNS tag
+	var volumes []cnstypes.CnsVolume
 	for _, queryResult := range allQueryResults {
-		for _, volume := range queryResult.Volumes {
-			inUsebyOtherK8SCluster := false
-			for _, metadata := range volume.Metadata.EntityMetadata {
-				if metadata.(*cnstypes.CnsKubernetesEntityMetadata).ClusterID != metadataSyncer.configInfo.Cfg.Global.ClusterID {
-					inUsebyOtherK8SCluster = true
-					log.Debugf("FullSync: fullSyncDeleteVolumes: Volume: %q is in use by other cluster.", volume.VolumeId.Id)
-					break
-				}
+		volumes = append(volumes, queryResult.Volumes...)
+	}
+	// deletedVolumeIDs has the IDs of the volumes to remove from cnsDeletionMap, by index of the volume
+	deletedVolumeIDs := make([]string, len(volumes))
+	runWorkerPool(workers, len(volumes), func(i int) {
+		volume := volumes[i]
+		// Verify if Volume is not in use by any other Cluster before removing CNS tag
+		inUsebyOtherK8SCluster := false
+		for _, metadata := range volume.Metadata.EntityMetadata {
+			if metadata.(*cnstypes.CnsKubernetesEntityMetadata).ClusterID != metadataSyncer.configInfo.Cfg.Global.ClusterID {
+				inUsebyOtherK8SCluster = true
+				log.Debugf("FullSync: fullSyncDeleteVolumes: Volume: %q is in use by other cluster.", volume.VolumeId.Id)
+				break
 			}
-			if !inUsebyOtherK8SCluster {
-				log.Infof("FullSync: fullSyncDeleteVolumes: Calling DeleteVolume for volume %v with delete disk %v", volume.VolumeId.Id, deleteDisk)
-				err := metadataSyncer.volumeManager.DeleteVolume(ctx, volume.VolumeId.Id, deleteDisk)
+		}
+		if !inUsebyOtherK8SCluster {
+			log.Infof("FullSync: fullSyncDeleteVolumes: Calling DeleteVolume for volume %v with delete disk %v", volume.VolumeId.Id, deleteDisk)
+			unlock := lockVolume(volume.VolumeId.Id)
+			err := metadataSyncer.volumeManager.DeleteVolume(ctx, volume.VolumeId.Id, deleteDisk)
+			unlock()
+			if err != nil {
+				log.Warnf("FullSync: fullSyncDeleteVolumes: Failed to delete volume %s with error %+v", volume.VolumeId.Id, err)
+				countFullSyncVolume(result, prometheus.PrometheusFullSyncDeletePhase, false)
+				return
+			}
+			countFullSyncVolume(result, prometheus.PrometheusFullSyncDeletePhase, true)
+			if migrationFeatureStateForFullSync {
+				err = volumeMigrationService.DeleteVolumeInfo(ctx, volume.VolumeId.Id)
+				// For non-migrated volumes DeleteVolumeInfo will not return error and
+				// So, the volume id will be deleted from cnsDeletionMap
 				if err != nil {
-					log.Warnf("FullSync: fullSyncDeleteVolumes: Failed to delete volume %s with error %+v", volume.VolumeId.Id, err)
-					continue
-				}
-				if migrationFeatureStateForFullSync {
-					err = volumeMigrationService.DeleteVolumeInfo(ctx, volume.VolumeId.Id)
-					// For non-migrated volumes DeleteVolumeInfo will not return error and
-					// So, the volume id will be deleted from cnsDeletionMap
-					if err != nil {
-						log.Warnf("FullSync: fullSyncDeleteVolumes: Failed to delete volume mapping CR for %s with error %+v", volume.VolumeId.Id, err)
-						continue
-					}
+					log.Warnf("FullSync: fullSyncDeleteVolumes: Failed to delete volume mapping CR for %s with error %+v", volume.VolumeId.Id, err)
+					return
 				}
 			}
+		}
+		deletedVolumeIDs[i] = volume.VolumeId.Id
+	})
+	for _, volumeID := range deletedVolumeIDs {
+		if volumeID != "" {
 			// delete volume from cnsDeletionMap which is successfully deleted from CNS
-			delete(cnsDeletionMap, volume.VolumeId.Id)
+			delete(cnsDeletionMap, volumeID)
 		}
 	}
 }
 
-// fullSyncUpdateVolumes update metadata for volumes with given array of createSpec
-func fullSyncUpdateVolumes(ctx context.Context, updateSpecArray []cnstypes.CnsVolumeMetadataUpdateSpec, metadataSyncer *metadataSyncInformer, wg *sync.WaitGroup) {
+// fullSyncUpdateVolumes update metadata for volumes with given array of updateSpec, from up to workers goroutines, counting them in result
+// The updateSpecs of a volume are applied in order by the same worker
+func fullSyncUpdateVolumes(ctx context.Context, updateSpecArray []cnstypes.CnsVolumeMetadataUpdateSpec, metadataSyncer *metadataSyncInformer, wg *sync.WaitGroup, workers int, result *FullSyncResult) {
 	defer wg.Done()
+	defer observeFullSyncPhase(prometheus.PrometheusFullSyncUpdatePhase, time.Now())
 	log := logger.GetLogger(ctx)
+	var volumeIDs []string
+	volumeToUpdateSpecsMap := make(map[string][]cnstypes.CnsVolumeMetadataUpdateSpec)
 	for _, updateSpec := range updateSpecArray {
-		log.Debugf("FullSync: Calling UpdateVolumeMetadata for volume %s with updateSpec: %+v", updateSpec.VolumeId.Id, spew.Sdump(updateSpec))
-		if err := metadataSyncer.volumeManager.UpdateVolumeMetadata(ctx, &updateSpec); err != nil {
-			log.Warnf("FullSync:UpdateVolumeMetadata failed with err %v", err)
+		if _, ok := volumeToUpdateSpecsMap[updateSpec.VolumeId.Id]; !ok {
+			volumeIDs = append(volumeIDs, updateSpec.VolumeId.Id)
+		}
+		volumeToUpdateSpecsMap[updateSpec.VolumeId.Id] = append(volumeToUpdateSpecsMap[updateSpec.VolumeId.Id], updateSpec)
+	}
+	runWorkerPool(workers, len(volumeIDs), func(i int) {
+		succeeded := true
+		for _, updateSpec := range volumeToUpdateSpecsMap[volumeIDs[i]] {
+			updateSpec := updateSpec
+			log.Debugf("FullSync: Calling UpdateVolumeMetadata for volume %s with updateSpec: %+v", updateSpec.VolumeId.Id, spew.Sdump(updateSpec))
+			if err := updateVolumeMetadata(ctx, metadataSyncer, &updateSpec); err != nil {
+				log.Warnf("FullSync:UpdateVolumeMetadata failed with err %v", err)
+				succeeded = false
+			}
 		}
+		countFullSyncVolume(result, prometheus.PrometheusFullSyncUpdatePhase, succeeded)
+	})
+}
+
+// updateVolumeMetadata calls UpdateVolumeMetadata for the volume of the updateSpec
+// in the CNS of the vCenter of the volume, holding the lock of the volume
+func updateVolumeMetadata(ctx context.Context, metadataSyncer *metadataSyncInformer, updateSpec *cnstypes.CnsVolumeMetadataUpdateSpec) error {
+	vcSyncer, err := getVCenterSyncerForVolume(ctx, metadataSyncer, updateSpec.VolumeId.Id)
+	if err != nil {
+		return err
 	}
+	if vcSyncer.host != metadataSyncer.host {
+		// The container cluster has the user of the vCenter of the volume
+		containerCluster := getContainerCluster(vcSyncer)
+		updateSpec.Metadata.ContainerCluster = containerCluster
+		updateSpec.Metadata.ContainerClusterArray = []cnstypes.CnsContainerCluster{containerCluster}
+	}
+	unlock := lockVolume(updateSpec.VolumeId.Id)
+	defer unlock()
+	return vcSyncer.volumeManager.UpdateVolumeMetadata(ctx, updateSpec)
+}
+
+// lockVolume locks the mutex of the volume with the given ID in volumeLocks,
+// and returns the function unlocking it
+func lockVolume(volumeID string) func() {
+	lock, _ := volumeLocks.LoadOrStore(volumeID, &sync.Mutex{})
+	mutex := lock.(*sync.Mutex)
+	mutex.Lock()
+	return mutex.Unlock
+}
+
+// runWorkerPool calls work with the indices from 0 to n-1 from up to workers
+// goroutines, and returns once all the calls have returned
+func runWorkerPool(workers int, n int, work func(i int)) {
+	indices := make(chan int)
+	wg := sync.WaitGroup{}
+	for w := 0; w < workers && w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				work(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+}
+
+// countFullSyncVolume counts the volume reconciled by the full sync phase in result
+// and in the metrics
+func countFullSyncVolume(result *FullSyncResult, phase string, succeeded bool) {
+	if !succeeded {
+		atomic.AddInt64(&result.VolumesFailed, 1)
+		prometheus.FullSyncVolumesTotal.WithLabelValues(phase, prometheus.PrometheusFailStatus).Inc()
+		return
+	}
+	switch phase {
+	case prometheus.PrometheusFullSyncCreatePhase:
+		atomic.AddInt64(&result.VolumesCreated, 1)
+	case prometheus.PrometheusFullSyncUpdatePhase:
+		atomic.AddInt64(&result.VolumesUpdated, 1)
+	case prometheus.PrometheusFullSyncDeletePhase:
+		atomic.AddInt64(&result.VolumesDeleted, 1)
+	}
+	prometheus.FullSyncVolumesTotal.WithLabelValues(phase, prometheus.PrometheusPassStatus).Inc()
+}
+
+// observeFullSyncPhase observes the time taken by the full sync phase started at start
+func observeFullSyncPhase(phase string, start time.Time) {
+	prometheus.FullSyncPhaseHistVec.WithLabelValues(phase).Observe(time.Since(start).Seconds())
 }
 
 // buildCnsMetadataList build metadata list for given PV
@@ -423,13 +724,8 @@ func fullSyncGetVolumeSpecs(ctx context.Context, vCenterVersion string, pvList [
 		}
 		if !presentInCNS {
 			// PV exist in K8S but not in CNS cache, need to create
-			if _, existsInCnsCreationMap := cnsCreationMap[volumeHandle]; existsInCnsCreationMap {
-				log.Infof("FullSync: create is required for volume: %q, as volume was present in cnsCreationMap across two full-sync cycles", volumeHandle)
-				operationType = "createVolume"
-			} else {
-				log.Infof("FullSync: Volume with id: %q and name: %q is added to cnsCreationMap", volumeHandle, pv.Name)
-				cnsCreationMap[volumeHandle] = true
-			}
+			log.Infof("FullSync: Volume with id: %q and name: %q is missing in CNS", volumeHandle, pv.Name)
+			operationType = "createVolume"
 		} else {
 			// volume exist in K8S and CNS, Check if update is required.
 			if isUpdateRequired(ctx, vCenterVersion, volumeToK8sEntityMetadata, volumeToCnsEntityMetadata, volumeClusterDistributionSet) {
@@ -551,11 +847,11 @@ func fullSyncGetVolumeSpecs(ctx context.Context, vCenterVersion string, pvList [
 	return createSpecArray, updateSpecArray
 }
 
-// getVolumesToBeDeleted return list of volumeIds that need to be deleted
-// A volumeId is added to this list only if it was present in cnsDeletionMap across two cycles of full sync
-func getVolumesToBeDeleted(ctx context.Context, cnsVolumeList []cnstypes.CnsVolume, k8sPVMap map[string]string, metadataSyncer *metadataSyncInformer, migrationFeatureStateForFullSync bool) ([]cnstypes.CnsVolumeId, error) {
+// getOrphanedVolumes returns the volumes in cnsVolumeList missing in K8s,
+// except the inline migrated volumes used by pods.
+func getOrphanedVolumes(ctx context.Context, cnsVolumeList []cnstypes.CnsVolume, k8sPVMap map[string]string, metadataSyncer *metadataSyncInformer, migrationFeatureStateForFullSync bool) ([]cnstypes.CnsVolumeId, error) {
 	log := logger.GetLogger(ctx)
-	var volToBeDeleted []cnstypes.CnsVolumeId
+	var orphanedVolumes []cnstypes.CnsVolumeId
 	// inlineVolumeMap holds the volume path information for migrated volumes which are used by Pods
 	inlineVolumeMap := make(map[string]string)
 	var err error
@@ -563,33 +859,39 @@ func getVolumesToBeDeleted(ctx context.Context, cnsVolumeList []cnstypes.CnsVolu
 		inlineVolumeMap, err = fullSyncGetInlineMigratedVolumesInfo(ctx, metadataSyncer, migrationFeatureStateForFullSync)
 		if err != nil {
 			log.Errorf("FullSync: Failed to get inline migrated volumes. Err: %v", err)
-			return volToBeDeleted, err
+			return orphanedVolumes, err
 		}
 	}
 	for _, vol := range cnsVolumeList {
-		if _, existsInK8s := k8sPVMap[vol.VolumeId.Id]; !existsInK8s {
-			if _, existsInCnsDeletionMap := cnsDeletionMap[vol.VolumeId.Id]; existsInCnsDeletionMap {
-				// Volume does not exist in K8s across two fullsync cycles - add to delete list
-				log.Debugf("FullSync: Volume with id %s added to delete list as it was present in cnsDeletionMap across two fullsync cycles", vol.VolumeId.Id)
-				volToBeDeleted = append(volToBeDeleted, vol.VolumeId)
-			} else {
-				// Add to cnsDeletionMap
-				if migrationFeatureStateForFullSync {
-					// If migration is ON, verify if the volume is present in inlineVolumeMap
-					if _, existsInInlineVolumeMap := inlineVolumeMap[vol.VolumeId.Id]; !existsInInlineVolumeMap {
-						log.Infof("FullSync: Volume with id %q added to cnsDeletionMap", vol.VolumeId.Id)
-						cnsDeletionMap[vol.VolumeId.Id] = true
-					} else {
-						log.Debugf("FullSync: Inline migrated volume with id %s is in use. Skipping for deletion", vol.VolumeId.Id)
-					}
-				} else {
-					log.Debugf("FullSync: Volume with id %s added to cnsDeletionMap", vol.VolumeId.Id)
-					cnsDeletionMap[vol.VolumeId.Id] = true
-				}
-			}
+		if _, existsInK8s := k8sPVMap[vol.VolumeId.Id]; existsInK8s {
+			continue
+		}
+		// If migration is ON, verify if the volume is present in inlineVolumeMap
+		if _, existsInInlineVolumeMap := inlineVolumeMap[vol.VolumeId.Id]; existsInInlineVolumeMap {
+			log.Debugf("FullSync: Inline migrated volume with id %s is in use. Skipping for deletion", vol.VolumeId.Id)
+			continue
+		}
+		orphanedVolumes = append(orphanedVolumes, vol.VolumeId)
+	}
+	return orphanedVolumes, nil
+}
+
+// getVolumesWithKubernetesMetadata returns the IDs of volumeIDs whose volume in
+// volumes has Kubernetes metadata.
+func getVolumesWithKubernetesMetadata(volumes []cnstypes.CnsVolume, volumeIDs []cnstypes.CnsVolumeId) []cnstypes.CnsVolumeId {
+	withMetadata := make(map[string]bool)
+	for _, volume := range volumes {
+		if hasKubernetesMetadata(volume) {
+			withMetadata[volume.VolumeId.Id] = true
+		}
+	}
+	var result []cnstypes.CnsVolumeId
+	for _, volumeID := range volumeIDs {
+		if withMetadata[volumeID.Id] {
+			result = append(result, volumeID)
 		}
 	}
-	return volToBeDeleted, nil
+	return result
 }
 
 // buildPVCMapPodMap build two maps to help
@@ -0,0 +1,152 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	cnstypes "github.com/vmware/govmomi/cns/types"
+
+	"sigs.k8s.io/vsphere-csi-driver/pkg/common/prometheus"
+)
+
+func TestRunWorkerPool(t *testing.T) {
+	const workers, n = 4, 100
+	var running, maxRunning int32
+	calls := make([]int32, n)
+	runWorkerPool(workers, n, func(i int) {
+		current := atomic.AddInt32(&running, 1)
+		for {
+			max := atomic.LoadInt32(&maxRunning)
+			if current <= max || atomic.CompareAndSwapInt32(&maxRunning, max, current) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		atomic.AddInt32(&calls[i], 1)
+		atomic.AddInt32(&running, -1)
+	})
+	for i, count := range calls {
+		if count != 1 {
+			t.Errorf("expected index %d to be worked on once, got %d", i, count)
+		}
+	}
+	if maxRunning > workers {
+		t.Errorf("expected at most %d concurrent workers, got %d", workers, maxRunning)
+	}
+
+	// No work doesn't block.
+	runWorkerPool(workers, 0, func(i int) {
+		t.Errorf("unexpected call with index %d", i)
+	})
+}
+
+func TestLockVolume(t *testing.T) {
+	var counts = map[string]int{}
+	var countsLock sync.Mutex
+	wg := sync.WaitGroup{}
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(volumeID string) {
+			defer wg.Done()
+			unlock := lockVolume(volumeID)
+			defer unlock()
+			countsLock.Lock()
+			counts[volumeID]++
+			if counts[volumeID] > 1 {
+				t.Errorf("volume %q is locked more than once", volumeID)
+			}
+			countsLock.Unlock()
+			time.Sleep(time.Millisecond)
+			countsLock.Lock()
+			counts[volumeID]--
+			countsLock.Unlock()
+		}([]string{"volume-1", "volume-2"}[i%2])
+	}
+	wg.Wait()
+}
+
+func TestGetFullSyncWorkers(t *testing.T) {
+	ctx := context.Background()
+	defer os.Unsetenv("FULL_SYNC_WORKER_THREADS")
+	for value, expected := range map[string]int{
+		"":        defaultFullSyncWorkers,
+		"25":      25,
+		"0":       defaultFullSyncWorkers,
+		"1000":    defaultFullSyncWorkers,
+		"invalid": defaultFullSyncWorkers,
+	} {
+		os.Setenv("FULL_SYNC_WORKER_THREADS", value)
+		if workers := getFullSyncWorkers(ctx); workers != expected {
+			t.Errorf("expected %d workers for %q, got %d", expected, value, workers)
+		}
+	}
+}
+
+func TestCountFullSyncVolume(t *testing.T) {
+	result := &FullSyncResult{}
+	runWorkerPool(defaultFullSyncWorkers, 30, func(i int) {
+		switch i % 3 {
+		case 0:
+			countFullSyncVolume(result, prometheus.PrometheusFullSyncCreatePhase, true)
+		case 1:
+			countFullSyncVolume(result, prometheus.PrometheusFullSyncUpdatePhase, i%2 == 0)
+		case 2:
+			countFullSyncVolume(result, prometheus.PrometheusFullSyncDeletePhase, true)
+		}
+	})
+	expected := FullSyncResult{VolumesCreated: 10, VolumesUpdated: 5, VolumesDeleted: 10, VolumesFailed: 5}
+	if *result != expected {
+		t.Errorf("expected result %+v, got %+v", expected, *result)
+	}
+}
+
+func TestConfirmFullSyncChanges(t *testing.T) {
+	ctx := context.Background()
+	savedCreationMap, savedDeletionMap := cnsCreationMap, cnsDeletionMap
+	defer func() {
+		cnsCreationMap, cnsDeletionMap = savedCreationMap, savedDeletionMap
+	}()
+	cnsCreationMap = map[string]bool{"missing-twice": true}
+	cnsDeletionMap = map[string]bool{"orphaned-twice": true}
+
+	createSpecs := []cnstypes.CnsVolumeCreateSpec{
+		{Name: "pv1", BackingObjectDetails: &cnstypes.CnsBlockBackingDetails{BackingDiskId: "missing-twice"}},
+		{Name: "pv2", BackingObjectDetails: &cnstypes.CnsVsanFileShareBackingDetails{
+			CnsFileBackingDetails: cnstypes.CnsFileBackingDetails{BackingFileId: "missing-once"}}},
+	}
+	confirmedCreates := confirmFullSyncCreates(ctx, createSpecs)
+	if len(confirmedCreates) != 1 || getCreateSpecVolumeID(confirmedCreates[0]) != "missing-twice" {
+		t.Errorf("expected only the volume missing across two cycles to be created, got %+v", confirmedCreates)
+	}
+	if !cnsCreationMap["missing-once"] {
+		t.Errorf("expected the volume missing once to be added to cnsCreationMap, got %v", cnsCreationMap)
+	}
+
+	confirmedDeletes := confirmFullSyncDeletes(ctx, []cnstypes.CnsVolumeId{{Id: "orphaned-twice"}, {Id: "orphaned-once"}})
+	if len(confirmedDeletes) != 1 || confirmedDeletes[0].Id != "orphaned-twice" {
+		t.Errorf("expected only the volume orphaned across two cycles to be deleted, got %+v", confirmedDeletes)
+	}
+	if !cnsDeletionMap["orphaned-once"] {
+		t.Errorf("expected the volume orphaned once to be added to cnsDeletionMap, got %v", cnsDeletionMap)
+	}
+}
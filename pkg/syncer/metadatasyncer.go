@@ -23,6 +23,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/davecgh/go-spew/spew"
@@ -35,11 +36,15 @@ import (
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/informers"
 	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
 
 	k8stypes "k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
 
 	"sigs.k8s.io/vsphere-csi-driver/pkg/apis/migration"
 	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/common/commonco/k8sorchestrator"
@@ -68,6 +73,10 @@ var (
 
 	// MetadataSyncer instance for the syncer container
 	MetadataSyncer *metadataSyncInformer
+
+	// configReloadLock serializes the reloads of the config from the config
+	// file and from the config secret
+	configReloadLock sync.Mutex
 )
 
 // newInformer returns uninitialized metadataSyncInformer
@@ -99,13 +108,43 @@ func getFullSyncIntervalInMin(ctx context.Context) int {
 	return fullSyncIntervalInMin
 }
 
+// getFullSyncWorkers returns the number of workers concurrently reconciling
+// volumes with CNS during full sync.
+// If environment variable FULL_SYNC_WORKER_THREADS is set and valid,
+// return the value read from environment variable
+// otherwise, use the default value 10
+func getFullSyncWorkers(ctx context.Context) int {
+	log := logger.GetLogger(ctx)
+	workers := defaultFullSyncWorkers
+	if v := os.Getenv("FULL_SYNC_WORKER_THREADS"); v != "" {
+		if value, err := strconv.Atoi(v); err == nil {
+			if value <= 0 {
+				log.Warnf("FullSync: number of workers set in env variable FULL_SYNC_WORKER_THREADS %s is less than 1, will use the default value %d", v, defaultFullSyncWorkers)
+			} else if value > maxFullSyncWorkers {
+				log.Warnf("FullSync: number of workers set in env variable FULL_SYNC_WORKER_THREADS %s is greater than %d, will use the default value %d", v, maxFullSyncWorkers, defaultFullSyncWorkers)
+			} else {
+				workers = value
+				log.Debugf("FullSync: number of workers is set to %d", workers)
+			}
+		} else {
+			log.Warnf("FullSync: number of workers set in env variable FULL_SYNC_WORKER_THREADS %s is invalid, will use the default value %d", v, defaultFullSyncWorkers)
+		}
+	}
+	return workers
+}
+
 // getVolumeHealthIntervalInMin returns the VolumeHealthInterval
+// If volume-health-intervalinmin is set in the config, return it
 // If environment variable VOLUME_HEALTH_STATUS_INTERVAL_MINUTES is set and valid,
 // return the interval value read from environment variable
 // otherwise, use the default value 5 minutes
-func getVolumeHealthIntervalInMin(ctx context.Context) int {
+func getVolumeHealthIntervalInMin(ctx context.Context, cfg *cnsconfig.Config) int {
 	log := logger.GetLogger(ctx)
 	volumeHealthIntervalInMin := defaultVolumeHealthIntervalInMin
+	if cfg.Global.VolumeHealthIntervalInMin > 0 {
+		log.Infof("VolumeHealth: VolumeHealth interval is set to %d minutes in the config", cfg.Global.VolumeHealthIntervalInMin)
+		return cfg.Global.VolumeHealthIntervalInMin
+	}
 	if v := os.Getenv("VOLUME_HEALTH_INTERVAL_MINUTES"); v != "" {
 		if value, err := strconv.Atoi(v); err == nil {
 			if value <= 0 {
@@ -121,14 +160,27 @@ func getVolumeHealthIntervalInMin(ctx context.Context) int {
 	return volumeHealthIntervalInMin
 }
 
-// InitMetadataSyncer initializes the Metadata Sync Informer
-func InitMetadataSyncer(ctx context.Context, clusterFlavor cnstypes.CnsClusterFlavor, configInfo *cnsconfig.ConfigurationInfo) error {
+// InitMetadataSyncer initializes the Metadata Sync Informer and adds the
+// periodic reconcilers of the syncer to the manager. It blocks until ctx is done.
+// The metadata and health of the volumes in the shard are synced.
+func InitMetadataSyncer(ctx context.Context, clusterFlavor cnstypes.CnsClusterFlavor, configInfo *cnsconfig.ConfigurationInfo,
+	mgr manager.Manager, shard VolumeShard) error {
 	log := logger.GetLogger(ctx)
 	var err error
 	log.Infof("Initializing MetadataSyncer")
+	if err = shard.Validate(); err != nil {
+		return err
+	}
+	if shard.Sharded() {
+		if clusterFlavor == cnstypes.CnsClusterFlavorGuest {
+			return errors.New("sharding volumes across syncer replicas is not supported on guest clusters")
+		}
+		log.Infof("Syncing the metadata and health of the volumes in shard %d of %d", shard.Index, shard.Count)
+	}
 	metadataSyncer := newInformer()
 	MetadataSyncer = metadataSyncer
 	metadataSyncer.configInfo = configInfo
+	metadataSyncer.shard = shard
 
 	// Create the kubernetes client from config
 	k8sClient, err := k8s.NewClient(ctx)
@@ -169,6 +221,9 @@ func InitMetadataSyncer(ctx context.Context, clusterFlavor cnstypes.CnsClusterFl
 		}
 		metadataSyncer.host = vCenter.Config.Host
 		metadataSyncer.volumeManager = volumes.GetManager(ctx, vCenter)
+		if err := registerSyncerVCenters(ctx, metadataSyncer, configInfo.Cfg); err != nil {
+			return err
+		}
 	}
 
 	if metadataSyncer.clusterFlavor == cnstypes.CnsClusterFlavorWorkload {
@@ -190,6 +245,8 @@ func InitMetadataSyncer(ctx context.Context, clusterFlavor cnstypes.CnsClusterFl
 	cnsDeletionMap = make(map[string]bool)
 	// Initialize cnsCreationMap used by Full Sync
 	cnsCreationMap = make(map[string]bool)
+	// Initialize staleAttachmentMap used by Full Sync
+	staleAttachmentMap = make(map[string]map[string]bool)
 
 	cfgPath := common.GetConfigPath(ctx)
 	watcher, err := fsnotify.NewWatcher()
@@ -207,15 +264,9 @@ func InitMetadataSyncer(ctx context.Context, clusterFlavor cnstypes.CnsClusterFl
 				}
 				log.Debugf("fsnotify event: %q", event.String())
 				if event.Op&fsnotify.Remove == fsnotify.Remove {
-					for {
-						reloadConfigErr := ReloadConfiguration(metadataSyncer, false)
-						if reloadConfigErr == nil {
-							log.Infof("Successfully reloaded configuration from: %q", cfgPath)
-							break
-						}
-						log.Errorf("failed to reload configuration will retry again in 5 seconds. err: %+v", reloadConfigErr)
-						time.Sleep(5 * time.Second)
-					}
+					common.ReloadConfigurationWithBackoff(ctx, cfgPath, func() error {
+						return ReloadConfiguration(metadataSyncer, false)
+					})
 				}
 				// Handling create event for reconnecting to VC when ca file is rotated
 				// In Supervisor cluster, ca file gets rotated at the path /etc/vmware/wcp/tls/vmca.pem
@@ -250,6 +301,18 @@ func InitMetadataSyncer(ctx context.Context, clusterFlavor cnstypes.CnsClusterFl
 		log.Errorf("failed to watch on path: %q. err=%v", cfgDirPath, err)
 		return err
 	}
+	if metadataSyncer.clusterFlavor == cnstypes.CnsClusterFlavorVanilla {
+		// Use rotated vCenter credentials as soon as they are set in the
+		// secret, before the kubelet updates the mounted config file
+		err = common.WatchConfigSecret(ctx, func() *cnsconfig.Config { return metadataSyncer.configInfo.Cfg },
+			func(ctx context.Context, cfg *cnsconfig.Config) error {
+				return reloadConfiguration(ctx, metadataSyncer, cfg, false)
+			})
+		if err != nil {
+			log.Errorf("failed to watch the config secret. err=%v", err)
+			return err
+		}
+	}
 	if metadataSyncer.clusterFlavor == cnstypes.CnsClusterFlavorWorkload {
 		caFileDirPath := filepath.Dir(cnsconfig.SupervisorCAFilePath)
 		log.Infof("Adding watch on path: %q", caFileDirPath)
@@ -298,16 +361,28 @@ func InitMetadataSyncer(ctx context.Context, clusterFlavor cnstypes.CnsClusterFl
 	metadataSyncer.pvLister = metadataSyncer.k8sInformerManager.GetPVLister()
 	metadataSyncer.pvcLister = metadataSyncer.k8sInformerManager.GetPVCLister()
 	metadataSyncer.podLister = metadataSyncer.k8sInformerManager.GetPodLister()
+	if metadataSyncer.clusterFlavor == cnstypes.CnsClusterFlavorVanilla {
+		metadataSyncer.nodeLister = metadataSyncer.k8sInformerManager.GetNodeLister()
+		metadataSyncer.volumeAttachmentLister = metadataSyncer.k8sInformerManager.GetVolumeAttachmentLister()
+		metadataSyncer.storageClassLister = metadataSyncer.k8sInformerManager.GetStorageClassLister()
+	}
 	stopCh := metadataSyncer.k8sInformerManager.Listen()
 	if stopCh == nil {
 		msg := "Failed to sync informer caches"
 		log.Error(msg)
 		return errors.New(msg)
 	}
+	if metadataSyncer.clusterFlavor != cnstypes.CnsClusterFlavorGuest {
+		// The tags of the volumes are synced by workers, off the informer
+		// event handlers.
+		metadataSyncer.volumeTagsQueue = workqueue.NewNamedRateLimitingQueue(
+			workqueue.NewItemExponentialFailureRateLimiter(volumeTagsRetryIntervalStart, volumeTagsRetryIntervalMax),
+			"volume-tags")
+		go runVolumeTagsWorkers(ctx, metadataSyncer)
+	}
 	log.Infof("Initialized metadata syncer")
 
-	fullSyncTicker := time.NewTicker(time.Duration(getFullSyncIntervalInMin(ctx)) * time.Minute)
-	defer fullSyncTicker.Stop()
+	fullSyncInterval := time.Duration(getFullSyncIntervalInMin(ctx)) * time.Minute
 	// Trigger full sync
 	// If TriggerCsiFullSync feature gate is enabled, use TriggerCsiFullSync to trigger
 	// full sync. If not, directly invoke full sync methods.
@@ -326,38 +401,42 @@ func InitMetadataSyncer(ctx context.Context, clusterFlavor cnstypes.CnsClusterFl
 			log.Errorf("Failed to create CnsOperator client. Err: %+v", err)
 			return err
 		}
-		go func() {
-			for ; true; <-fullSyncTicker.C {
-				ctx, log = logger.GetNewContextWithLogger()
+		err = mgr.Add(&periodicReconciler{
+			name:     "full sync",
+			interval: fullSyncInterval,
+			reconcile: func(ctx context.Context) {
+				log := logger.GetLogger(ctx)
 				log.Infof("periodic fullSync is triggered")
 				triggerCsiFullSyncInstance, err := getTriggerCsiFullSyncInstance(ctx, cnsOperatorClient)
 				if err != nil {
 					log.Warnf("Unable to get the trigger full sync instance. Err: %+v", err)
-					continue
+					return
 				}
 
 				// Update TriggerCsiFullSync instance if full sync is not already in progress
 				if triggerCsiFullSyncInstance.Status.InProgress {
 					log.Infof("There is a full sync already in progress. Ignoring this current cycle of periodic full sync")
+					return
+				}
+				triggerCsiFullSyncInstance.Spec.TriggerSyncID = triggerCsiFullSyncInstance.Spec.TriggerSyncID + 1
+				err = updateTriggerCsiFullSyncInstance(ctx, cnsOperatorClient, triggerCsiFullSyncInstance)
+				if err != nil {
+					log.Errorf("Failed to update TriggerCsiFullSync instance: %+v to increment the TriggerFullSyncId. Error: %v",
+						triggerCsiFullSyncInstance, err)
 				} else {
-					triggerCsiFullSyncInstance.Spec.TriggerSyncID = triggerCsiFullSyncInstance.Spec.TriggerSyncID + 1
-					err = updateTriggerCsiFullSyncInstance(ctx, cnsOperatorClient, triggerCsiFullSyncInstance)
-					if err != nil {
-						log.Errorf("Failed to update TriggerCsiFullSync instance: %+v to increment the TriggerFullSyncId. Error: %v",
-							triggerCsiFullSyncInstance, err)
-					} else {
-						log.Infof("Incremented TriggerSyncID from %d to %d as part of periodic run to trigger full sync",
-							triggerCsiFullSyncInstance.Spec.TriggerSyncID-1, triggerCsiFullSyncInstance.Spec.TriggerSyncID)
-					}
+					log.Infof("Incremented TriggerSyncID from %d to %d as part of periodic run to trigger full sync",
+						triggerCsiFullSyncInstance.Spec.TriggerSyncID-1, triggerCsiFullSyncInstance.Spec.TriggerSyncID)
 				}
-			}
-		}()
+			},
+		})
 	} else {
 		log.Infof("%q feature flag is not enabled. Using the traditional way to directly invoke full sync",
 			common.TriggerCsiFullSync)
-
-		go func() {
-			for ; true; <-fullSyncTicker.C {
+		err = mgr.Add(&periodicReconciler{
+			name:     "full sync",
+			interval: fullSyncInterval,
+			reconcile: func(ctx context.Context) {
+				log := logger.GetLogger(ctx)
 				log.Infof("fullSync is triggered")
 				if metadataSyncer.clusterFlavor == cnstypes.CnsClusterFlavorGuest {
 					err := PvcsiFullSync(ctx, metadataSyncer)
@@ -370,66 +449,216 @@ func InitMetadataSyncer(ctx context.Context, clusterFlavor cnstypes.CnsClusterFl
 						log.Infof("CSI full sync failed with error: %+v", err)
 					}
 				}
-			}
-		}()
+			},
+		})
+	}
+	if err != nil {
+		log.Errorf("failed to add full sync reconciler to the manager. Err: %+v", err)
+		return err
 	}
 
-	volumeHealthTicker := time.NewTicker(time.Duration(getVolumeHealthIntervalInMin(ctx)) * time.Minute)
-	defer volumeHealthTicker.Stop()
+	var recorder record.EventRecorder
+	if metadataSyncer.clusterFlavor != cnstypes.CnsClusterFlavorGuest {
+		// eventBroadcaster broadcasts the low space events of datastores and the
+		// volume health events on PVs and PVCs to the event sink
+		eventBroadcaster := record.NewBroadcaster()
+		eventBroadcaster.StartRecordingToSink(
+			&typedcorev1.EventSinkImpl{
+				Interface: k8sClient.CoreV1().Events(""),
+			},
+		)
+		recorder = eventBroadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: csitypes.Name})
+	}
 
 	// Trigger get volume health status
 	if metadataSyncer.clusterFlavor == cnstypes.CnsClusterFlavorWorkload {
-		go func() {
-			for ; true; <-volumeHealthTicker.C {
-				ctx, log = logger.GetNewContextWithLogger()
+		err = mgr.Add(&periodicReconciler{
+			name:     "volume health",
+			interval: time.Duration(getVolumeHealthIntervalInMin(ctx, metadataSyncer.configInfo.Cfg)) * time.Minute,
+			// Every replica syncs the health of the volumes of its shard.
+			allReplicas: shard.Sharded(),
+			reconcile: func(ctx context.Context) {
+				log := logger.GetLogger(ctx)
 				if !metadataSyncer.coCommonInterface.IsFSSEnabled(ctx, common.VolumeHealth) {
 					log.Warnf("VolumeHealth feature is disabled on the cluster")
-				} else {
-					log.Infof("getVolumeHealthStatus is triggered")
-					csiGetVolumeHealthStatus(ctx, k8sClient, metadataSyncer)
+					return
+				}
+				// The config is checked on each run so that the sync can be disabled
+				// without restarting the syncer.
+				if metadataSyncer.configInfo.Cfg.Global.VolumeHealthIntervalInMin < 0 {
+					log.Debugf("VolumeHealth sync is disabled in the config")
+					return
+				}
+				log.Infof("getVolumeHealthStatus is triggered")
+				csiGetVolumeHealthStatus(ctx, k8sClient, metadataSyncer, recorder)
+			},
+		})
+		if err != nil {
+			log.Errorf("failed to add volume health reconciler to the manager. Err: %+v", err)
+			return err
+		}
+	}
+	if metadataSyncer.clusterFlavor != cnstypes.CnsClusterFlavorGuest {
+		// Trigger datastore capacity check
+		err = mgr.Add(&periodicReconciler{
+			name:     "datastore capacity",
+			interval: time.Duration(getDatastoreCapacityIntervalInMin(ctx)) * time.Minute,
+			reconcile: func(ctx context.Context) {
+				log := logger.GetLogger(ctx)
+				log.Infof("csiCheckDatastoreCapacity is triggered")
+				csiCheckDatastoreCapacity(ctx, metadataSyncer, recorder)
+			},
+		})
+		if err != nil {
+			log.Errorf("failed to add datastore capacity reconciler to the manager. Err: %+v", err)
+			return err
+		}
+	}
+	if metadataSyncer.clusterFlavor == cnstypes.CnsClusterFlavorVanilla {
+		// Trigger collection of the performance stats of the volumes
+		err = mgr.Add(&periodicReconciler{
+			name:     "volume performance",
+			interval: time.Duration(getVolumePerfIntervalInMin(ctx)) * time.Minute,
+			reconcile: func(ctx context.Context) {
+				log := logger.GetLogger(ctx)
+				if !metadataSyncer.coCommonInterface.IsFSSEnabled(ctx, common.VolumePerfMetrics) {
+					log.Debugf("VolumePerfMetrics feature is disabled on the cluster")
+					return
 				}
+				log.Infof("csiCollectVolumePerf is triggered")
+				csiCollectVolumePerf(ctx, metadataSyncer)
+			},
+		})
+		if err != nil {
+			log.Errorf("failed to add volume performance reconciler to the manager. Err: %+v", err)
+			return err
+		}
+		// Trigger collection of the storage consumption of the namespaces
+		err = mgr.Add(&periodicReconciler{
+			name:     "namespace usage",
+			interval: time.Duration(getNamespaceUsageIntervalInMin(ctx)) * time.Minute,
+			reconcile: func(ctx context.Context) {
+				log := logger.GetLogger(ctx)
+				if !metadataSyncer.coCommonInterface.IsFSSEnabled(ctx, common.NamespaceStorageMetrics) {
+					log.Debugf("NamespaceStorageMetrics feature is disabled on the cluster")
+					return
+				}
+				log.Infof("csiCollectNamespaceUsage is triggered")
+				csiCollectNamespaceUsage(ctx, k8sClient, metadataSyncer)
+			},
+		})
+		if err != nil {
+			log.Errorf("failed to add namespace usage reconciler to the manager. Err: %+v", err)
+			return err
+		}
+		if metadataSyncer.coCommonInterface.IsFSSEnabled(ctx, common.VolumeInventoryExport) {
+			restConfig, err := config.GetConfig()
+			if err != nil {
+				log.Errorf("failed to get Kubernetes config. Err: %+v", err)
+				return err
+			}
+			cnsOperatorClient, err := k8s.NewClientForGroup(ctx, restConfig, cnsoperatorv1alpha1.GroupName)
+			if err != nil {
+				log.Errorf("Failed to create CnsOperator client. Err: %+v", err)
+				return err
+			}
+			// Trigger export of the inventory of the volumes
+			err = mgr.Add(&periodicReconciler{
+				name:     "volume inventory",
+				interval: time.Duration(getVolumeInventoryIntervalInMin(ctx)) * time.Minute,
+				reconcile: func(ctx context.Context) {
+					log := logger.GetLogger(ctx)
+					log.Infof("csiExportVolumeInventory is triggered")
+					csiExportVolumeInventory(ctx, metadataSyncer, cnsOperatorClient)
+				},
+			})
+			if err != nil {
+				log.Errorf("failed to add volume inventory reconciler to the manager. Err: %+v", err)
+				return err
+			}
+		}
+		if metadataSyncer.coCommonInterface.IsFSSEnabled(ctx, common.NamespaceStorageQuota) {
+			restConfig, err := config.GetConfig()
+			if err != nil {
+				log.Errorf("failed to get Kubernetes config. Err: %+v", err)
+				return err
 			}
-		}()
+			cnsOperatorClient, err := k8s.NewClientForGroup(ctx, restConfig, cnsoperatorv1alpha1.GroupName)
+			if err != nil {
+				log.Errorf("Failed to create CnsOperator client. Err: %+v", err)
+				return err
+			}
+			// Trigger sync of the usage of the storage quotas of the namespaces
+			err = mgr.Add(&periodicReconciler{
+				name:     "storage quota",
+				interval: time.Duration(getStorageQuotaIntervalInMin(ctx)) * time.Minute,
+				reconcile: func(ctx context.Context) {
+					log := logger.GetLogger(ctx)
+					log.Infof("csiSyncStorageQuotaUsage is triggered")
+					csiSyncStorageQuotaUsage(ctx, metadataSyncer, cnsOperatorClient)
+				},
+			})
+			if err != nil {
+				log.Errorf("failed to add storage quota reconciler to the manager. Err: %+v", err)
+				return err
+			}
+		}
+		// Trigger the cleanup of the CNS volumes without a PV
+		err = mgr.Add(&periodicReconciler{
+			name:     "orphan volume",
+			interval: time.Duration(getOrphanVolumeIntervalInMin(ctx)) * time.Minute,
+			reconcile: func(ctx context.Context) {
+				log := logger.GetLogger(ctx)
+				if !metadataSyncer.coCommonInterface.IsFSSEnabled(ctx, common.OrphanVolumeCleanup) {
+					log.Debugf("OrphanVolumeCleanup feature is disabled on the cluster")
+					return
+				}
+				log.Infof("csiCleanupOrphanVolumes is triggered")
+				csiCleanupOrphanVolumes(ctx, metadataSyncer)
+			},
+		})
+		if err != nil {
+			log.Errorf("failed to add orphan volume reconciler to the manager. Err: %+v", err)
+			return err
+		}
 	}
 	if metadataSyncer.clusterFlavor == cnstypes.CnsClusterFlavorGuest {
-		volumeHealthEnablementTicker := time.NewTicker(common.DefaultFeatureEnablementCheckInterval)
-		defer volumeHealthEnablementTicker.Stop()
 		// Trigger volume health reconciler
-		go func() {
-			for ; true; <-volumeHealthEnablementTicker.C {
-				ctx, log = logger.GetNewContextWithLogger()
-				if !metadataSyncer.coCommonInterface.IsFSSEnabled(ctx, common.VolumeHealth) {
-					log.Debugf("VolumeHealth feature is disabled on the cluster")
-				} else {
-					if err := initVolumeHealthReconciler(ctx, k8sClient, metadataSyncer.supervisorClient); err != nil {
-						log.Warnf("Error while initializing volume health reconciler. Err:%+v. Retry will be triggered at %v", err, time.Now().Add(common.DefaultFeatureEnablementCheckInterval))
-						continue
-					}
-					break
-				}
-			}
-		}()
-
-		volumeResizeEnablementTicker := time.NewTicker(common.DefaultFeatureEnablementCheckInterval)
-		defer volumeResizeEnablementTicker.Stop()
+		err = mgr.Add(&featureGatedReconciler{
+			name:     "volume health",
+			interval: common.DefaultFeatureEnablementCheckInterval,
+			isEnabled: func(ctx context.Context) bool {
+				return metadataSyncer.coCommonInterface.IsFSSEnabled(ctx, common.VolumeHealth)
+			},
+			run: func(ctx context.Context) error {
+				return initVolumeHealthReconciler(ctx, k8sClient, metadataSyncer.supervisorClient)
+			},
+		})
+		if err != nil {
+			log.Errorf("failed to add volume health reconciler to the manager. Err: %+v", err)
+			return err
+		}
 		// Trigger resize reconciler
-		go func() {
-			for ; true; <-volumeResizeEnablementTicker.C {
-				ctx, log = logger.GetNewContextWithLogger()
-				if !metadataSyncer.coCommonInterface.IsFSSEnabled(ctx, common.VolumeExtend) {
-					log.Debugf("ExpandVolume feature is disabled on the cluster")
-				} else {
-					if err := initResizeReconciler(ctx, k8sClient, metadataSyncer.supervisorClient); err != nil {
-						log.Warnf("Error while initializing volume resize reconciler. Err:%+v. Retry will be triggered at %v", err, time.Now().Add(common.DefaultFeatureEnablementCheckInterval))
-						continue
-					}
-					break
-				}
-			}
-		}()
+		err = mgr.Add(&featureGatedReconciler{
+			name:     "volume resize",
+			interval: common.DefaultFeatureEnablementCheckInterval,
+			isEnabled: func(ctx context.Context) bool {
+				return metadataSyncer.coCommonInterface.IsFSSEnabled(ctx, common.VolumeExtend)
+			},
+			run: func(ctx context.Context) error {
+				return initResizeReconciler(ctx, k8sClient, metadataSyncer.supervisorClient)
+			},
+		})
+		if err != nil {
+			log.Errorf("failed to add volume resize reconciler to the manager. Err: %+v", err)
+			return err
+		}
 	}
 
-	<-stopCh
+	select {
+	case <-stopCh:
+	case <-ctx.Done():
+	}
 	return nil
 }
 
@@ -466,6 +695,16 @@ func ReloadConfiguration(metadataSyncer *metadataSyncInformer, reconnectToVCFrom
 		log.Error(msg)
 		return errors.New(msg)
 	}
+	return reloadConfiguration(ctx, metadataSyncer, cfg, reconnectToVCFromNewConfig)
+}
+
+// reloadConfiguration updates the cached configs of metadataSyncer with cfg,
+// see ReloadConfiguration.
+func reloadConfiguration(ctx context.Context, metadataSyncer *metadataSyncInformer, cfg *cnsconfig.Config,
+	reconnectToVCFromNewConfig bool) error {
+	log := logger.GetLogger(ctx)
+	configReloadLock.Lock()
+	defer configReloadLock.Unlock()
 	if metadataSyncer.clusterFlavor == cnstypes.CnsClusterFlavorGuest {
 		var err error
 		restClientConfig := k8s.GetRestClientConfigForSupervisor(ctx, cfg.GC.Endpoint, metadataSyncer.configInfo.Cfg.GC.Port)
@@ -503,6 +742,11 @@ func ReloadConfiguration(metadataSyncer *metadataSyncInformer, reconnectToVCFrom
 					log.Error(msg)
 					return errors.New(msg)
 				}
+				// The session of the verification isn't used further
+				if err = newVC.Disconnect(ctx); err != nil {
+					log.Warnf("failed to logout of the session verifying the credentials of VirtualCenter host: %s, Err: %+v",
+						newVCConfig.Host, err)
+				}
 
 				// Reset virtual center singleton instance by passing reload flag as true
 				log.Info("Obtaining new vCenterInstance using new credentials")
@@ -533,6 +777,11 @@ func ReloadConfiguration(metadataSyncer *metadataSyncInformer, reconnectToVCFrom
 		if cfg != nil {
 			metadataSyncer.configInfo = &cnsconfig.ConfigurationInfo{Cfg: cfg}
 			log.Infof("updated metadataSyncer.configInfo")
+			if err := registerSyncerVCenters(ctx, metadataSyncer, cfg); err != nil {
+				msg := fmt.Sprintf("failed to register the additional vCenters. err=%v", err)
+				log.Error(msg)
+				return errors.New(msg)
+			}
 		}
 	}
 	return nil
@@ -581,6 +830,10 @@ func pvcUpdated(oldObj, newObj interface{}, metadataSyncer *metadataSyncInformer
 		}
 		log.Debugf("PVCUpdated: Found Persistent Volume %s from API server", newPvc.Spec.VolumeName)
 	}
+	if !metadataSyncer.shard.ownsPV(pv) {
+		log.Debugf("PVCUpdated: PV %s is not in the volume shard of this syncer", pv.Name)
+		return
+	}
 	migrationEnabled := metadataSyncer.coCommonInterface.IsFSSEnabled(ctx, common.CSIMigration)
 	// Verify if csi migration is ON and check if there is any label update or migrated-to annotation was received for the PVC
 	if migrationEnabled && pv.Spec.VsphereVolume != nil {
@@ -653,6 +906,10 @@ func pvcDeleted(obj interface{}, metadataSyncer *metadataSyncInformer) {
 		log.Errorf("PVCDeleted: Error getting Persistent Volume for pvc %s in namespace %s with err: %v", pvc.Name, pvc.Namespace, err)
 		return
 	}
+	if !metadataSyncer.shard.ownsPV(pv) {
+		log.Debugf("PVCDeleted: PV %s is not in the volume shard of this syncer", pv.Name)
+		return
+	}
 	migrationEnabled := metadataSyncer.coCommonInterface.IsFSSEnabled(ctx, common.CSIMigration)
 	if migrationEnabled && pv.Spec.VsphereVolume != nil {
 		if !isValidvSphereVolumeClaim(ctx, pvc.ObjectMeta) {
@@ -753,6 +1010,10 @@ func pvUpdated(oldObj, newObj interface{}, metadataSyncer *metadataSyncInformer)
 		log.Debugf("PVUpdated: PV already deleted")
 		return
 	}
+	if !metadataSyncer.shard.ownsPV(newPv) {
+		log.Debugf("PVUpdated: PV %s is not in the volume shard of this syncer", newPv.Name)
+		return
+	}
 	if metadataSyncer.clusterFlavor == cnstypes.CnsClusterFlavorGuest {
 		// Invoke volume updated method for pvCSI
 		pvcsiVolumeUpdated(ctx, newPv, newPv.Spec.CSI.VolumeHandle, metadataSyncer)
@@ -774,6 +1035,10 @@ func pvDeleted(obj interface{}, metadataSyncer *metadataSyncInformer) {
 		return
 	}
 	log.Debugf("PVDeleted: PV: %+v", pv)
+	if !metadataSyncer.shard.ownsPV(pv) {
+		log.Debugf("PVDeleted: PV %s is not in the volume shard of this syncer", pv.Name)
+		return
+	}
 
 	migrationEnabled := metadataSyncer.coCommonInterface.IsFSSEnabled(ctx, common.CSIMigration)
 	if migrationEnabled && pv.Spec.VsphereVolume != nil {
@@ -798,6 +1063,9 @@ func pvDeleted(obj interface{}, metadataSyncer *metadataSyncInformer) {
 		pvcsiVolumeDeleted(ctx, string(pv.GetUID()), metadataSyncer)
 	} else {
 		csiPVDeleted(ctx, pv, metadataSyncer)
+		if pv.Spec.CSI != nil {
+			forgetVolumeVCenter(metadataSyncer, pv.Spec.CSI.VolumeHandle)
+		}
 	}
 }
 
@@ -878,6 +1146,11 @@ func csiPVCUpdated(ctx context.Context, pvc *v1.PersistentVolumeClaim, pv *v1.Pe
 	} else {
 		volumeFound := false
 		volumeHandle = pv.Spec.CSI.VolumeHandle
+		metadataSyncer, err = getVCenterSyncerForVolume(ctx, metadataSyncer, volumeHandle)
+		if err != nil {
+			log.Errorf("PVCUpdated: failed to find the vCenter of volume %q. err: %+v", volumeHandle, err)
+			return
+		}
 		// Following wait poll is required to avoid race condition between pvcUpdated and pvUpdated
 		// This helps avoid race condition between pvUpdated and pvcUpdated handlers when static PV and PVC is created almost
 		// at the same time using single YAML file.
@@ -885,8 +1158,9 @@ func csiPVCUpdated(ctx context.Context, pvc *v1.PersistentVolumeClaim, pv *v1.Pe
 			queryFilter := cnstypes.CnsQueryFilter{
 				VolumeIds: []cnstypes.CnsVolumeId{{Id: volumeHandle}},
 			}
-			// Query with empty selection. CNS returns only the volume ID from it's cache.
-			queryResult, err := utils.QueryVolumeUtil(ctx, metadataSyncer.volumeManager, queryFilter, cnstypes.CnsQuerySelection{}, metadataSyncer.coCommonInterface.IsFSSEnabled(ctx, common.AsyncQueryVolume))
+			// Only the volume ID is needed, select the volume type, the smallest field.
+			queryResult, err := utils.QueryVolumeUtil(ctx, metadataSyncer.volumeManager, queryFilter,
+				utils.QuerySelection(cnstypes.QuerySelectionNameTypeVolumeType))
 			if err != nil {
 				log.Errorf("PVCUpdated: QueryVolume failed with err=%+v", err.Error())
 				return false, err
@@ -929,9 +1203,11 @@ func csiPVCUpdated(ctx context.Context, pvc *v1.PersistentVolumeClaim, pv *v1.Pe
 	}
 
 	log.Debugf("PVCUpdated: Calling UpdateVolumeMetadata with updateSpec: %+v", spew.Sdump(updateSpec))
-	if err := metadataSyncer.volumeManager.UpdateVolumeMetadata(ctx, updateSpec); err != nil {
+	if err := updateVolumeMetadata(ctx, metadataSyncer, updateSpec); err != nil {
 		log.Errorf("PVCUpdated: UpdateVolumeMetadata failed with err %v", err)
+		return
 	}
+	enqueueVolumeTags(metadataSyncer, pv)
 }
 
 // csiPVCDeleted deletes volume metadata on VC when volume has been deleted on Vanilla k8s and supervisor cluster
@@ -978,7 +1254,7 @@ func csiPVCDeleted(ctx context.Context, pvc *v1.PersistentVolumeClaim, pv *v1.Pe
 	}
 
 	log.Debugf("PVCDeleted: Calling UpdateVolumeMetadata for volume %s with updateSpec: %+v", updateSpec.VolumeId.Id, spew.Sdump(updateSpec))
-	if err := metadataSyncer.volumeManager.UpdateVolumeMetadata(ctx, updateSpec); err != nil {
+	if err := updateVolumeMetadata(ctx, metadataSyncer, updateSpec); err != nil {
 		log.Errorf("PVCDeleted: UpdateVolumeMetadata failed with err %v", err)
 	}
 }
@@ -991,7 +1267,6 @@ func csiPVUpdated(ctx context.Context, newPv *v1.PersistentVolume, oldPv *v1.Per
 	metadataList = append(metadataList, cnstypes.BaseCnsEntityMetadata(pvMetadata))
 	var volumeHandle string
 	var err error
-	containerCluster := cnsvsphere.GetContainerCluster(metadataSyncer.configInfo.Cfg.Global.ClusterID, metadataSyncer.configInfo.Cfg.VirtualCenter[metadataSyncer.host].User, metadataSyncer.clusterFlavor, metadataSyncer.configInfo.Cfg.Global.ClusterDistribution)
 	if metadataSyncer.coCommonInterface.IsFSSEnabled(ctx, common.CSIMigration) && newPv.Spec.VsphereVolume != nil {
 		// In case if feature state switch is enabled after syncer is deployed, we need to initialize the volumeMigrationService
 		if err = initVolumeMigrationService(ctx, metadataSyncer); err != nil {
@@ -1005,7 +1280,13 @@ func csiPVUpdated(ctx context.Context, newPv *v1.PersistentVolume, oldPv *v1.Per
 		}
 	} else {
 		volumeHandle = newPv.Spec.CSI.VolumeHandle
+		metadataSyncer, err = getVCenterSyncerForVolume(ctx, metadataSyncer, volumeHandle)
+		if err != nil {
+			log.Errorf("PVUpdated: failed to find the vCenter of volume %q. err: %+v", volumeHandle, err)
+			return
+		}
 	}
+	containerCluster := getContainerCluster(metadataSyncer)
 
 	// TODO: Revisit the logic for static PV update once we have a specific return code from CNS
 	// for UpdateVolumeMetadata if the volume is not registered as CNS volume.
@@ -1028,8 +1309,9 @@ func csiPVUpdated(ctx context.Context, newPv *v1.PersistentVolume, oldPv *v1.Per
 		}
 		volumeOperationsLock.Lock()
 		defer volumeOperationsLock.Unlock()
-		// QueryAll with no selection will return only the volume ID.
-		queryResult, err := utils.QueryVolumeUtil(ctx, metadataSyncer.volumeManager, queryFilter, cnstypes.CnsQuerySelection{}, metadataSyncer.coCommonInterface.IsFSSEnabled(ctx, common.AsyncQueryVolume))
+		// Only the volume ID is needed, select the volume type, the smallest field.
+		queryResult, err := utils.QueryVolumeUtil(ctx, metadataSyncer.volumeManager, queryFilter,
+			utils.QuerySelection(cnstypes.QuerySelectionNameTypeVolumeType))
 		if err != nil {
 			log.Errorf("PVUpdated: QueryVolume failed with err=%+v", err.Error())
 			return
@@ -1090,11 +1372,12 @@ func csiPVUpdated(ctx context.Context, newPv *v1.PersistentVolume, oldPv *v1.Per
 	}
 
 	log.Debugf("PVUpdated: Calling UpdateVolumeMetadata for volume %q with updateSpec: %+v", updateSpec.VolumeId.Id, spew.Sdump(updateSpec))
-	if err := metadataSyncer.volumeManager.UpdateVolumeMetadata(ctx, updateSpec); err != nil {
+	if err := updateVolumeMetadata(ctx, metadataSyncer, updateSpec); err != nil {
 		log.Errorf("PVUpdated: UpdateVolumeMetadata failed with err %v", err)
 		return
 	}
 	log.Debugf("PVUpdated: UpdateVolumeMetadata succeed for the volume %q with updateSpec: %+v", updateSpec.VolumeId.Id, spew.Sdump(updateSpec))
+	enqueueVolumeTags(metadataSyncer, newPv)
 }
 
 // csiPVDeleted deletes volume metadata on VC when volume has been deleted on Vanills k8s and supervisor cluster
@@ -1127,7 +1410,7 @@ func csiPVDeleted(ctx context.Context, pv *v1.PersistentVolume, metadataSyncer *
 		}
 
 		log.Debugf("PVDeleted: Calling UpdateVolumeMetadata for volume %s with updateSpec: %+v", updateSpec.VolumeId.Id, spew.Sdump(updateSpec))
-		if err := metadataSyncer.volumeManager.UpdateVolumeMetadata(ctx, updateSpec); err != nil {
+		if err := updateVolumeMetadata(ctx, metadataSyncer, updateSpec); err != nil {
 			log.Errorf("PVDeleted: UpdateVolumeMetadata failed with err %v", err)
 			return
 		}
@@ -1138,7 +1421,8 @@ func csiPVDeleted(ctx context.Context, pv *v1.PersistentVolume, metadataSyncer *
 				},
 			},
 		}
-		queryResult, err := utils.QueryVolumeUtil(ctx, metadataSyncer.volumeManager, queryFilter, cnstypes.CnsQuerySelection{}, metadataSyncer.coCommonInterface.IsFSSEnabled(ctx, common.AsyncQueryVolume))
+		queryResult, err := utils.CachedQueryVolumeUtil(ctx, metadataSyncer.volumeManager, queryFilter,
+			utils.VolumeMetadataQuerySelection())
 		if err != nil {
 			log.Error("PVDeleted: QueryVolume failed with err=%+v", err.Error())
 			return
@@ -1171,6 +1455,11 @@ func csiPVDeleted(ctx context.Context, pv *v1.PersistentVolume, metadataSyncer *
 			}
 		} else {
 			volumeHandle = pv.Spec.CSI.VolumeHandle
+			metadataSyncer, err = getVCenterSyncerForVolume(ctx, metadataSyncer, volumeHandle)
+			if err != nil {
+				log.Errorf("PVDeleted: failed to find the vCenter of volume %q. err: %+v", volumeHandle, err)
+				return
+			}
 		}
 
 		log.Debugf("PVDeleted: vSphere CSI Driver is deleting volume %v", pv)
@@ -1200,6 +1489,10 @@ func csiUpdatePod(ctx context.Context, pod *v1.Pod, metadataSyncer *metadataSync
 		if volume.PersistentVolumeClaim != nil {
 			valid, pv, pvc := IsValidVolume(ctx, volume, pod, metadataSyncer)
 			if valid {
+				if !metadataSyncer.shard.ownsPV(pv) {
+					log.Debugf("PV %s of the pod %q is not in the volume shard of this syncer", pv.Name, pod.Name)
+					continue
+				}
 				if !deleteFlag {
 					// We need to update metadata for pods having corresponding PVC as an entity reference
 					entityReference := cnsvsphere.CreateCnsKuberenetesEntityReference(string(cnstypes.CnsKubernetesEntityTypePVC), pvc.Name, pvc.Namespace, metadataSyncer.configInfo.Cfg.Global.ClusterID)
@@ -1237,6 +1530,10 @@ func csiUpdatePod(ctx context.Context, pod *v1.Pod, metadataSyncer *metadataSync
 			// Inline migrated volumes with no PVC
 			if metadataSyncer.coCommonInterface.IsFSSEnabled(ctx, common.CSIMigration) {
 				if volume.VsphereVolume != nil {
+					if !metadataSyncer.shard.Owns(volume.VsphereVolume.VolumePath) {
+						log.Debugf("Volume %q of the pod %q is not in the volume shard of this syncer", volume.Name, pod.Name)
+						continue
+					}
 					// No entity reference is supplied for inline volumes
 					podMetadata = cnsvsphere.GetCnsKubernetesEntityMetaData(pod.Name, nil, deleteFlag, string(cnstypes.CnsKubernetesEntityTypePOD), pod.Namespace, metadataSyncer.configInfo.Cfg.Global.ClusterID, nil)
 					metadataList = append(metadataList, cnstypes.BaseCnsEntityMetadata(podMetadata))
@@ -1280,7 +1577,7 @@ func csiUpdatePod(ctx context.Context, pod *v1.Pod, metadataSyncer *metadataSync
 		}
 
 		log.Debugf("Calling UpdateVolumeMetadata for volume %s with updateSpec: %+v", updateSpec.VolumeId.Id, spew.Sdump(updateSpec))
-		if err := metadataSyncer.volumeManager.UpdateVolumeMetadata(ctx, updateSpec); err != nil {
+		if err := updateVolumeMetadata(ctx, metadataSyncer, updateSpec); err != nil {
 			log.Errorf("UpdateVolumeMetadata failed for volume %s with err: %v", volume.Name, err)
 		}
 
@@ -0,0 +1,199 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strconv"
+
+	cnstypes "github.com/vmware/govmomi/cns/types"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	clientset "k8s.io/client-go/kubernetes"
+
+	"sigs.k8s.io/vsphere-csi-driver/pkg/common/prometheus"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/common/utils"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
+	csitypes "sigs.k8s.io/vsphere-csi-driver/pkg/csi/types"
+)
+
+// defaultNamespaceUsageIntervalInMin is the default interval the storage
+// consumption of the namespaces is collected at.
+const defaultNamespaceUsageIntervalInMin = 5
+
+// namespaceUsageKey identifies the volumes of a type in a namespace.
+type namespaceUsageKey struct {
+	namespace  string
+	volumeType string
+}
+
+// kubeletStatsSummary is the part of the stats summary of a kubelet holding
+// the stats of the volumes of the pods, as reported by NodeGetVolumeStats.
+type kubeletStatsSummary struct {
+	Pods []struct {
+		Volumes []struct {
+			UsedBytes *uint64 `json:"usedBytes,omitempty"`
+			PVCRef    *struct {
+				Name      string `json:"name"`
+				Namespace string `json:"namespace"`
+			} `json:"pvcRef,omitempty"`
+		} `json:"volume,omitempty"`
+	} `json:"pods"`
+}
+
+// getNamespaceUsageIntervalInMin returns the interval the storage consumption of the namespaces is collected at.
+// If environment variable NAMESPACE_USAGE_INTERVAL_MINUTES is set and valid,
+// return the interval value read from environment variable
+// otherwise, use the default value 5 minutes
+func getNamespaceUsageIntervalInMin(ctx context.Context) int {
+	log := logger.GetLogger(ctx)
+	namespaceUsageIntervalInMin := defaultNamespaceUsageIntervalInMin
+	if v := os.Getenv("NAMESPACE_USAGE_INTERVAL_MINUTES"); v != "" {
+		if value, err := strconv.Atoi(v); err == nil && value > 0 {
+			namespaceUsageIntervalInMin = value
+			log.Infof("NamespaceUsage: namespace usage interval is set to %d minutes", namespaceUsageIntervalInMin)
+		} else {
+			log.Warnf("NamespaceUsage: namespace usage interval set in env variable NAMESPACE_USAGE_INTERVAL_MINUTES %s is invalid, will use the default interval", v)
+		}
+	}
+	return namespaceUsageIntervalInMin
+}
+
+// csiCollectNamespaceUsage exports the capacity of the volumes bound to PVCs,
+// queried from CNS, and the space used on the mounted volumes, read from the
+// stats summary of the kubelets, aggregated per namespace.
+func csiCollectNamespaceUsage(ctx context.Context, k8sClient clientset.Interface,
+	metadataSyncer *metadataSyncInformer) {
+	log := logger.GetLogger(ctx)
+	pvs, err := metadataSyncer.pvLister.List(labels.Everything())
+	if err != nil {
+		log.Errorf("NamespaceUsage: failed to list PVs. Err: %+v", err)
+		return
+	}
+	pvcsByVolumeID := make(map[string]*v1.ObjectReference)
+	for _, pv := range pvs {
+		if pv.Spec.CSI != nil && pv.Spec.CSI.Driver == csitypes.Name && pv.Spec.ClaimRef != nil {
+			pvcsByVolumeID[pv.Spec.CSI.VolumeHandle] = pv.Spec.ClaimRef
+		}
+	}
+	queryFilter := cnstypes.CnsQueryFilter{
+		ContainerClusterIds: []string{
+			metadataSyncer.configInfo.Cfg.Global.ClusterID,
+		},
+	}
+	querySelection := utils.QuerySelection(cnstypes.QuerySelectionNameTypeVolumeType,
+		cnstypes.QuerySelectionNameTypeBackingObjectDetails)
+	queryResult, err := utils.CachedQueryVolumeUtil(ctx, metadataSyncer.volumeManager, queryFilter, querySelection)
+	if err != nil {
+		log.Errorf("NamespaceUsage: QueryVolume failed. Err: %+v", err)
+		return
+	}
+	provisionedBytes, volumeTypes := getNamespaceProvisionedBytes(queryResult.Volumes, pvcsByVolumeID)
+
+	nodes, err := metadataSyncer.nodeLister.List(labels.Everything())
+	if err != nil {
+		log.Errorf("NamespaceUsage: failed to list nodes. Err: %+v", err)
+		return
+	}
+	usedBytesByPVC := make(map[k8stypes.NamespacedName]uint64)
+	for _, node := range nodes {
+		summary, err := k8sClient.CoreV1().RESTClient().Get().Resource("nodes").Name(node.Name).
+			SubResource("proxy").Suffix("stats/summary").DoRaw(ctx)
+		if err != nil {
+			log.Warnf("NamespaceUsage: failed to get stats summary of node %q. err=%v", node.Name, err)
+			continue
+		}
+		if err = getVolumeUsedBytes(summary, volumeTypes, usedBytesByPVC); err != nil {
+			log.Warnf("NamespaceUsage: failed to read stats summary of node %q. err=%v", node.Name, err)
+		}
+	}
+	setNamespaceUsageMetrics(provisionedBytes, usedBytesByPVC, volumeTypes)
+}
+
+// getNamespaceProvisionedBytes returns the capacity of the CNS volumes bound
+// to the PVCs in pvcsByVolumeID per namespace and volume type, and the volume
+// type of each of these PVCs.
+func getNamespaceProvisionedBytes(volumes []cnstypes.CnsVolume, pvcsByVolumeID map[string]*v1.ObjectReference) (
+	map[namespaceUsageKey]int64, map[k8stypes.NamespacedName]string) {
+	provisionedBytes := make(map[namespaceUsageKey]int64)
+	volumeTypes := make(map[k8stypes.NamespacedName]string)
+	for _, volume := range volumes {
+		pvc, ok := pvcsByVolumeID[volume.VolumeId.Id]
+		if !ok {
+			continue
+		}
+		volumeType := prometheus.PrometheusUnknownVolumeType
+		switch volume.VolumeType {
+		case string(cnstypes.CnsVolumeTypeBlock):
+			volumeType = prometheus.PrometheusBlockVolumeType
+		case string(cnstypes.CnsVolumeTypeFile):
+			volumeType = prometheus.PrometheusFileVolumeType
+		}
+		volumeTypes[k8stypes.NamespacedName{Namespace: pvc.Namespace, Name: pvc.Name}] = volumeType
+		var capacityInMb int64
+		if volume.BackingObjectDetails != nil {
+			capacityInMb = volume.BackingObjectDetails.GetCnsBackingObjectDetails().CapacityInMb
+		}
+		provisionedBytes[namespaceUsageKey{namespace: pvc.Namespace, volumeType: volumeType}] += capacityInMb * 1024 * 1024
+	}
+	return provisionedBytes, volumeTypes
+}
+
+// getVolumeUsedBytes records in usedBytesByPVC the space used on the volumes
+// of the PVCs in volumeTypes from the stats summary of a kubelet. A volume
+// mounted by several pods, such as a file volume, is only counted once.
+func getVolumeUsedBytes(summary []byte, volumeTypes map[k8stypes.NamespacedName]string,
+	usedBytesByPVC map[k8stypes.NamespacedName]uint64) error {
+	var stats kubeletStatsSummary
+	if err := json.Unmarshal(summary, &stats); err != nil {
+		return err
+	}
+	for _, pod := range stats.Pods {
+		for _, volume := range pod.Volumes {
+			if volume.PVCRef == nil || volume.UsedBytes == nil {
+				continue
+			}
+			pvc := k8stypes.NamespacedName{Namespace: volume.PVCRef.Namespace, Name: volume.PVCRef.Name}
+			if _, ok := volumeTypes[pvc]; !ok {
+				continue
+			}
+			if *volume.UsedBytes > usedBytesByPVC[pvc] {
+				usedBytesByPVC[pvc] = *volume.UsedBytes
+			}
+		}
+	}
+	return nil
+}
+
+// setNamespaceUsageMetrics exports the provisioned and used capacity of the
+// volumes per namespace and volume type.
+func setNamespaceUsageMetrics(provisionedBytes map[namespaceUsageKey]int64,
+	usedBytesByPVC map[k8stypes.NamespacedName]uint64, volumeTypes map[k8stypes.NamespacedName]string) {
+	usedBytes := make(map[namespaceUsageKey]uint64)
+	for pvc, used := range usedBytesByPVC {
+		usedBytes[namespaceUsageKey{namespace: pvc.Namespace, volumeType: volumeTypes[pvc]}] += used
+	}
+	prometheus.NamespaceProvisionedBytes.Reset()
+	prometheus.NamespaceUsedBytes.Reset()
+	for key, provisioned := range provisionedBytes {
+		prometheus.NamespaceProvisionedBytes.WithLabelValues(key.namespace, key.volumeType).Set(float64(provisioned))
+		prometheus.NamespaceUsedBytes.WithLabelValues(key.namespace, key.volumeType).Set(float64(usedBytes[key]))
+	}
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	cnstypes "github.com/vmware/govmomi/cns/types"
+	v1 "k8s.io/api/core/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+
+	"sigs.k8s.io/vsphere-csi-driver/pkg/common/prometheus"
+)
+
+// TestNamespaceUsageMetrics checks that the provisioned capacity from CNS and
+// the used space from the kubelets are exported per namespace.
+func TestNamespaceUsageMetrics(t *testing.T) {
+	defer prometheus.NamespaceProvisionedBytes.Reset()
+	defer prometheus.NamespaceUsedBytes.Reset()
+
+	capacity := func(mb int64) *cnstypes.CnsBlockBackingDetails {
+		return &cnstypes.CnsBlockBackingDetails{
+			CnsBackingObjectDetails: cnstypes.CnsBackingObjectDetails{CapacityInMb: mb},
+		}
+	}
+	volumes := []cnstypes.CnsVolume{
+		{VolumeId: cnstypes.CnsVolumeId{Id: "vol-1"}, VolumeType: "BLOCK", BackingObjectDetails: capacity(1024)},
+		{VolumeId: cnstypes.CnsVolumeId{Id: "vol-2"}, VolumeType: "BLOCK", BackingObjectDetails: capacity(2048)},
+		{VolumeId: cnstypes.CnsVolumeId{Id: "vol-3"}, VolumeType: "FILE", BackingObjectDetails: capacity(1024)},
+		// Volume without a PVC.
+		{VolumeId: cnstypes.CnsVolumeId{Id: "vol-4"}, VolumeType: "BLOCK", BackingObjectDetails: capacity(4096)},
+	}
+	pvcsByVolumeID := map[string]*v1.ObjectReference{
+		"vol-1": {Namespace: "ns-1", Name: "pvc-1"},
+		"vol-2": {Namespace: "ns-1", Name: "pvc-2"},
+		"vol-3": {Namespace: "ns-2", Name: "pvc-3"},
+	}
+	provisionedBytes, volumeTypes := getNamespaceProvisionedBytes(volumes, pvcsByVolumeID)
+
+	// pvc-3 is mounted by two pods, pvc-4 is not a volume of the driver.
+	summaries := []string{
+		`{"pods": [{"volume": [{"usedBytes": 100, "pvcRef": {"namespace": "ns-1", "name": "pvc-1"}},
+			{"usedBytes": 10, "name": "config"}]},
+			{"volume": [{"usedBytes": 300, "pvcRef": {"namespace": "ns-2", "name": "pvc-3"}}]}]}`,
+		`{"pods": [{"volume": [{"usedBytes": 200, "pvcRef": {"namespace": "ns-1", "name": "pvc-2"}},
+			{"usedBytes": 400, "pvcRef": {"namespace": "ns-1", "name": "pvc-4"}}]},
+			{"volume": [{"usedBytes": 300, "pvcRef": {"namespace": "ns-2", "name": "pvc-3"}}]}]}`,
+	}
+	usedBytesByPVC := make(map[k8stypes.NamespacedName]uint64)
+	for _, summary := range summaries {
+		if err := getVolumeUsedBytes([]byte(summary), volumeTypes, usedBytesByPVC); err != nil {
+			t.Fatal(err)
+		}
+	}
+	setNamespaceUsageMetrics(provisionedBytes, usedBytesByPVC, volumeTypes)
+
+	expected := []struct {
+		namespace, volumeType string
+		provisioned, used     float64
+	}{
+		{"ns-1", prometheus.PrometheusBlockVolumeType, 3 * 1024 * 1024 * 1024, 300},
+		{"ns-2", prometheus.PrometheusFileVolumeType, 1024 * 1024 * 1024, 300},
+	}
+	for _, e := range expected {
+		if value := testutil.ToFloat64(
+			prometheus.NamespaceProvisionedBytes.WithLabelValues(e.namespace, e.volumeType)); value != e.provisioned {
+			t.Errorf("expected %v provisioned bytes in namespace %q, got %v", e.provisioned, e.namespace, value)
+		}
+		if value := testutil.ToFloat64(
+			prometheus.NamespaceUsedBytes.WithLabelValues(e.namespace, e.volumeType)); value != e.used {
+			t.Errorf("expected %v used bytes in namespace %q, got %v", e.used, e.namespace, value)
+		}
+	}
+	if count := testutil.CollectAndCount(prometheus.NamespaceProvisionedBytes); count != len(expected) {
+		t.Errorf("expected %d series, got %d", len(expected), count)
+	}
+}
@@ -0,0 +1,363 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	cnstypes "github.com/vmware/govmomi/cns/types"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"sigs.k8s.io/vsphere-csi-driver/pkg/common/prometheus"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/common/utils"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/common"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/internalapis/cnsvolumeoperationrequest"
+)
+
+// defaultOrphanVolumeIntervalInMin is the default interval the orphan volumes
+// are looked for at.
+const defaultOrphanVolumeIntervalInMin = 60
+
+// orphanVolumeMap tracks the CNS volumes of the cluster found without a PV,
+// with the time they were first found. If a volume exists in this map across
+// two runs of the orphan volume cleanup, it is reported. It is deleted if
+// delete-orphan-volumes is set in the config, once it has been in this map for
+// orphan-volume-min-age-inmin minutes.
+var orphanVolumeMap = make(map[string]time.Time)
+
+// getOrphanVolumeIntervalInMin returns the interval the orphan volumes are looked for at.
+// If environment variable ORPHAN_VOLUME_INTERVAL_MINUTES is set and valid,
+// return the interval value read from environment variable
+// otherwise, use the default value 60 minutes
+func getOrphanVolumeIntervalInMin(ctx context.Context) int {
+	log := logger.GetLogger(ctx)
+	orphanVolumeIntervalInMin := defaultOrphanVolumeIntervalInMin
+	if v := os.Getenv("ORPHAN_VOLUME_INTERVAL_MINUTES"); v != "" {
+		if value, err := strconv.Atoi(v); err == nil && value > 0 {
+			orphanVolumeIntervalInMin = value
+			log.Infof("OrphanVolume: orphan volume interval is set to %d minutes", orphanVolumeIntervalInMin)
+		} else {
+			log.Warnf("OrphanVolume: orphan volume interval set in env variable ORPHAN_VOLUME_INTERVAL_MINUTES %s is invalid, will use the default interval", v)
+		}
+	}
+	return orphanVolumeIntervalInMin
+}
+
+// isOrphanVolumeDeletionEnabled returns whether the orphan volume cleanup
+// deletes the orphan volumes. Full sync leaves the volumes without a PV and
+// without Kubernetes metadata to the cleanup in this case, as it only removes
+// them from CNS, leaking their FCDs.
+func isOrphanVolumeDeletionEnabled(ctx context.Context, metadataSyncer *metadataSyncInformer) bool {
+	return metadataSyncer.clusterFlavor == cnstypes.CnsClusterFlavorVanilla &&
+		metadataSyncer.coCommonInterface.IsFSSEnabled(ctx, common.OrphanVolumeCleanup) &&
+		metadataSyncer.configInfo.Cfg.Global.DeleteOrphanVolumes
+}
+
+// csiCleanupOrphanVolumes looks for the CNS volumes tagged with the ID of the
+// cluster which have no PV, such as the volumes left behind by a failed
+// provisioning. The volumes of PVs deleted with their reclaim policy set to
+// Retain are removed from CNS by the syncer and aren't found, their FCDs are
+// kept on purpose. The volumes found in two consecutive runs are reported,
+// and deleted with their FCDs if delete-orphan-volumes is set in the config,
+// see deleteOrphanVolumes.
+func csiCleanupOrphanVolumes(ctx context.Context, metadataSyncer *metadataSyncInformer) {
+	log := logger.GetLogger(ctx)
+	log.Infof("OrphanVolume: start")
+	pvs, err := metadataSyncer.pvLister.List(labels.Everything())
+	if err != nil {
+		log.Errorf("OrphanVolume: failed to list PVs. Err: %v", err)
+		return
+	}
+	migrationFeatureState := metadataSyncer.coCommonInterface.IsFSSEnabled(ctx, common.CSIMigration)
+	inlineVolumes, err := fullSyncGetInlineMigratedVolumesInfo(ctx, metadataSyncer, migrationFeatureState)
+	if err != nil {
+		log.Errorf("OrphanVolume: failed to get inline migrated volumes. Err: %v", err)
+		return
+	}
+	// The orphan volumes of all the vCenters are tracked together, and each
+	// is deleted in the CNS of its vCenter.
+	var orphanVolumes []cnstypes.CnsVolume
+	volumeSyncers := make(map[string]*metadataSyncInformer)
+	for _, vcSyncer := range getVCenterSyncers(metadataSyncer) {
+		vcOrphanVolumes, err := getOrphanVolumesOfVCenter(ctx, vcSyncer, pvs, inlineVolumes)
+		if err != nil {
+			log.Errorf("OrphanVolume: failed to get the orphan volumes of vCenter %q. Err: %v", vcSyncer.host, err)
+			return
+		}
+		for _, volume := range vcOrphanVolumes {
+			volumeSyncers[volume.VolumeId.Id] = vcSyncer
+		}
+		orphanVolumes = append(orphanVolumes, vcOrphanVolumes...)
+	}
+	orphanVolumes = trackOrphanVolumes(orphanVolumes, time.Now())
+	prometheus.OrphanVolumes.Set(float64(len(orphanVolumes)))
+	for _, volume := range orphanVolumes {
+		log.Warnf("OrphanVolume: volume %q of type %s on datastore %q has had no PV since %v",
+			volume.VolumeId.Id, volume.VolumeType, volume.DatastoreUrl, orphanVolumeMap[volume.VolumeId.Id])
+	}
+	if len(orphanVolumes) > 0 && isOrphanVolumeDeletionEnabled(ctx, metadataSyncer) {
+		for _, vcSyncer := range getVCenterSyncers(metadataSyncer) {
+			var vcOrphanVolumes []cnstypes.CnsVolume
+			for _, volume := range orphanVolumes {
+				if volumeSyncers[volume.VolumeId.Id].host == vcSyncer.host {
+					vcOrphanVolumes = append(vcOrphanVolumes, volume)
+				}
+			}
+			if len(vcOrphanVolumes) > 0 {
+				deleteOrphanVolumes(ctx, vcSyncer, vcOrphanVolumes)
+			}
+		}
+	}
+	log.Infof("OrphanVolume: end. Orphan volumes: %d", len(orphanVolumes))
+}
+
+// getOrphanVolumesOfVCenter returns the orphan volumes of the cluster in the
+// CNS of the vCenter of metadataSyncer, see getOrphanVolumes.
+func getOrphanVolumesOfVCenter(ctx context.Context, metadataSyncer *metadataSyncInformer, pvs []*v1.PersistentVolume,
+	inlineVolumes map[string]string) ([]cnstypes.CnsVolume, error) {
+	clusterID := metadataSyncer.configInfo.Cfg.Global.ClusterID
+	queryFilter := cnstypes.CnsQueryFilter{
+		ContainerClusterIds: []string{clusterID},
+	}
+	queryResult, err := utils.CachedQueryVolumeUtil(ctx, metadataSyncer.volumeManager, queryFilter, utils.QuerySelection())
+	if err != nil {
+		return nil, err
+	}
+	volumeHandles := make(map[string]bool)
+	for _, pv := range pvs {
+		if pv.Spec.CSI != nil {
+			volumeHandles[pv.Spec.CSI.VolumeHandle] = true
+		}
+	}
+	var queryVolumeIds []cnstypes.CnsVolumeId
+	for _, volume := range queryResult.Volumes {
+		if !volumeHandles[volume.VolumeId.Id] {
+			queryVolumeIds = append(queryVolumeIds, volume.VolumeId)
+		}
+	}
+	if len(queryVolumeIds) == 0 {
+		return nil, nil
+	}
+	// The metadata of the volumes of all the clusters is needed to find the
+	// PVs of migrated in-tree vSphere volumes, and the volumes shared with
+	// other clusters.
+	allQueryResults, err := fullSyncGetQueryResults(ctx, queryVolumeIds, "", metadataSyncer.volumeManager, metadataSyncer)
+	if err != nil {
+		return nil, err
+	}
+	var volumes []cnstypes.CnsVolume
+	for _, result := range allQueryResults {
+		volumes = append(volumes, result.Volumes...)
+	}
+	return getOrphanVolumes(volumes, clusterID, pvs, inlineVolumes), nil
+}
+
+// getOrphanVolumes returns the volumes which have neither a CSI PV with their
+// ID as volume handle, nor a PV of the cluster in their metadata, and are not
+// used as inline migrated volumes by pods.
+func getOrphanVolumes(volumes []cnstypes.CnsVolume, clusterID string, pvs []*v1.PersistentVolume,
+	inlineVolumes map[string]string) []cnstypes.CnsVolume {
+	volumeHandles := make(map[string]bool)
+	pvNames := make(map[string]bool)
+	for _, pv := range pvs {
+		if pv.Spec.CSI != nil {
+			volumeHandles[pv.Spec.CSI.VolumeHandle] = true
+		}
+		pvNames[pv.Name] = true
+	}
+	var orphanVolumes []cnstypes.CnsVolume
+	for _, volume := range volumes {
+		if volumeHandles[volume.VolumeId.Id] || hasK8sPV(volume, clusterID, pvNames) {
+			continue
+		}
+		if _, ok := inlineVolumes[volume.VolumeId.Id]; ok {
+			continue
+		}
+		orphanVolumes = append(orphanVolumes, volume)
+	}
+	return orphanVolumes
+}
+
+// trackOrphanVolumes records the orphan volumes found at now in
+// orphanVolumeMap, forgetting the ones which are not orphan anymore, and
+// returns the volumes which were already orphan in the previous run, sorted
+// by ID. This leaves time to the volumes being provisioned to get their PV.
+func trackOrphanVolumes(volumes []cnstypes.CnsVolume, now time.Time) []cnstypes.CnsVolume {
+	found := make(map[string]bool)
+	var orphanVolumes []cnstypes.CnsVolume
+	for _, volume := range volumes {
+		found[volume.VolumeId.Id] = true
+		if _, ok := orphanVolumeMap[volume.VolumeId.Id]; ok {
+			orphanVolumes = append(orphanVolumes, volume)
+		} else {
+			orphanVolumeMap[volume.VolumeId.Id] = now
+		}
+	}
+	for volumeID := range orphanVolumeMap {
+		if !found[volumeID] {
+			delete(orphanVolumeMap, volumeID)
+		}
+	}
+	sort.Slice(orphanVolumes, func(i, j int) bool {
+		return orphanVolumes[i].VolumeId.Id < orphanVolumes[j].VolumeId.Id
+	})
+	return orphanVolumes
+}
+
+// hasKubernetesMetadata returns true if the volume has Kubernetes metadata of
+// any cluster in CNS, such as the PV name of a retained volume whose PV was
+// deleted while the syncer wasn't watching.
+func hasKubernetesMetadata(volume cnstypes.CnsVolume) bool {
+	for _, metadata := range volume.Metadata.EntityMetadata {
+		if _, ok := metadata.(*cnstypes.CnsKubernetesEntityMetadata); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// getDeletableOrphanVolumes returns the orphan volumes which can be deleted at
+// now: the ones without Kubernetes metadata, found without a PV since at least
+// minAge and without an operation in progress in the controller.
+func getDeletableOrphanVolumes(ctx context.Context, volumes []cnstypes.CnsVolume, now time.Time, minAge time.Duration,
+	inProgressVolumeIDs map[string]bool) []cnstypes.CnsVolume {
+	log := logger.GetLogger(ctx)
+	var deletableVolumes []cnstypes.CnsVolume
+	for _, volume := range volumes {
+		volumeID := volume.VolumeId.Id
+		switch {
+		case hasKubernetesMetadata(volume):
+			log.Infof("OrphanVolume: volume %q has Kubernetes metadata, not deleting it", volumeID)
+		case now.Sub(orphanVolumeMap[volumeID]) < minAge:
+			log.Debugf("OrphanVolume: volume %q is orphan since %v, not deleting it before %v",
+				volumeID, orphanVolumeMap[volumeID], minAge)
+		case inProgressVolumeIDs[volumeID]:
+			log.Infof("OrphanVolume: volume %q has an operation in progress, not deleting it", volumeID)
+		default:
+			deletableVolumes = append(deletableVolumes, volume)
+		}
+	}
+	return deletableVolumes
+}
+
+// getInProgressVolumeIDs returns the IDs of the volumes with an operation in
+// progress in the controller, and whether a volume is being created, as the
+// ID of the volume being created isn't known until the operation completes.
+func getInProgressVolumeIDs(ctx context.Context, metadataSyncer *metadataSyncInformer) (map[string]bool, bool, error) {
+	volumeIDs := make(map[string]bool)
+	if !metadataSyncer.coCommonInterface.IsFSSEnabled(ctx, common.CSIVolumeManagerIdempotency) {
+		return volumeIDs, false, nil
+	}
+	operations, err := cnsvolumeoperationrequest.ListInProgressOperations(ctx, metadataSyncer.configInfo.Cfg)
+	if err != nil {
+		return nil, false, err
+	}
+	creating := false
+	for _, operation := range operations {
+		if operation.VolumeID == "" {
+			creating = true
+			continue
+		}
+		volumeIDs[operation.VolumeID] = true
+	}
+	return volumeIDs, creating, nil
+}
+
+// deleteOrphanVolumes deletes the orphan volumes from CNS with their FCDs,
+// skipping the ones which got a PV since they were found and the ones
+// getDeletableOrphanVolumes doesn't return. Volumes are never deleted while
+// a volume is being created, as it may be one of them. The volumes and their
+// metadata are queried again from CNS, bypassing the query cache, so that
+// changes made by the controller since they were found are taken into account.
+func deleteOrphanVolumes(ctx context.Context, metadataSyncer *metadataSyncInformer, volumes []cnstypes.CnsVolume) {
+	log := logger.GetLogger(ctx)
+	clusterID := metadataSyncer.configInfo.Cfg.Global.ClusterID
+	minAge := time.Duration(metadataSyncer.configInfo.Cfg.Global.OrphanVolumeMinAgeInMin) * time.Minute
+	volumeOperationsLock.Lock()
+	defer volumeOperationsLock.Unlock()
+	inProgressVolumeIDs, creating, err := getInProgressVolumeIDs(ctx, metadataSyncer)
+	if err != nil {
+		log.Errorf("OrphanVolume: failed to list the volume operations in progress. Err: %v", err)
+		return
+	}
+	if creating {
+		log.Infof("OrphanVolume: a volume is being created, not deleting orphan volumes in this run")
+		return
+	}
+	volumes, err = queryVolumesUncached(ctx, metadataSyncer, volumes)
+	if err != nil {
+		log.Errorf("OrphanVolume: failed to query orphan volumes from CNS. Err: %v", err)
+		return
+	}
+	pvs, err := metadataSyncer.pvLister.List(labels.Everything())
+	if err != nil {
+		log.Errorf("OrphanVolume: failed to list PVs. Err: %v", err)
+		return
+	}
+	volumes = getOrphanVolumes(volumes, clusterID, pvs, nil)
+	migrationFeatureState := metadataSyncer.coCommonInterface.IsFSSEnabled(ctx, common.CSIMigration)
+	for _, volume := range getDeletableOrphanVolumes(ctx, volumes, time.Now(), minAge, inProgressVolumeIDs) {
+		log.Infof("OrphanVolume: deleting orphan volume %q with its disk", volume.VolumeId.Id)
+		unlock := lockVolume(volume.VolumeId.Id)
+		err := metadataSyncer.volumeManager.DeleteVolume(ctx, volume.VolumeId.Id, true)
+		unlock()
+		if err != nil {
+			log.Errorf("OrphanVolume: failed to delete volume %q. Err: %v", volume.VolumeId.Id, err)
+			prometheus.OrphanVolumesDeletedTotal.WithLabelValues(prometheus.PrometheusFailStatus).Inc()
+			continue
+		}
+		prometheus.OrphanVolumesDeletedTotal.WithLabelValues(prometheus.PrometheusPassStatus).Inc()
+		delete(orphanVolumeMap, volume.VolumeId.Id)
+		if migrationFeatureState && volumeMigrationService != nil {
+			if err := volumeMigrationService.DeleteVolumeInfo(ctx, volume.VolumeId.Id); err != nil {
+				log.Warnf("OrphanVolume: failed to delete volume mapping CR for %s with error %+v", volume.VolumeId.Id, err)
+			}
+		}
+	}
+}
+
+// queryVolumesUncached returns the latest state of the volumes in CNS, with
+// their metadata of all the clusters, without reading through the query
+// cache. Volumes which don't exist anymore aren't returned.
+func queryVolumesUncached(ctx context.Context, metadataSyncer *metadataSyncInformer,
+	volumes []cnstypes.CnsVolume) ([]cnstypes.CnsVolume, error) {
+	var latestVolumes []cnstypes.CnsVolume
+	for start := 0; start < len(volumes); start += int(queryVolumeLimit) {
+		end := start + int(queryVolumeLimit)
+		if end > len(volumes) {
+			end = len(volumes)
+		}
+		queryFilter := cnstypes.CnsQueryFilter{
+			Cursor: &cnstypes.CnsCursor{Limit: queryVolumeLimit},
+		}
+		for _, volume := range volumes[start:end] {
+			queryFilter.VolumeIds = append(queryFilter.VolumeIds, volume.VolumeId)
+		}
+		queryResult, err := utils.QueryVolumeUtil(ctx, metadataSyncer.volumeManager, queryFilter, utils.QuerySelection())
+		if err != nil {
+			return nil, err
+		}
+		latestVolumes = append(latestVolumes, queryResult.Volumes...)
+	}
+	return latestVolumes, nil
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	cnstypes "github.com/vmware/govmomi/cns/types"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	csitypes "sigs.k8s.io/vsphere-csi-driver/pkg/csi/types"
+)
+
+// TestGetOrphanVolumes checks that the volumes with a PV, either by volume
+// handle or in their CNS metadata, and the inline migrated volumes are not
+// orphan, that orphan volumes are only returned from their second run, and
+// that only the ones without Kubernetes metadata are deleted.
+func TestGetOrphanVolumes(t *testing.T) {
+	const clusterID = "cluster-1"
+	ctx := context.Background()
+	newVolume := func(id string, metadata ...cnstypes.BaseCnsEntityMetadata) cnstypes.CnsVolume {
+		return cnstypes.CnsVolume{
+			VolumeId: cnstypes.CnsVolumeId{Id: id},
+			Metadata: cnstypes.CnsVolumeMetadata{EntityMetadata: metadata},
+		}
+	}
+	newPVMetadata := func(pvName string, clusterID string) *cnstypes.CnsKubernetesEntityMetadata {
+		return &cnstypes.CnsKubernetesEntityMetadata{
+			CnsEntityMetadata: cnstypes.CnsEntityMetadata{EntityName: pvName, ClusterID: clusterID},
+			EntityType:        string(cnstypes.CnsKubernetesEntityTypePV),
+		}
+	}
+	volumes := []cnstypes.CnsVolume{
+		// CSI volume with a PV.
+		newVolume("vol-1"),
+		// Migrated in-tree vSphere volume with a PV.
+		newVolume("vol-2", newPVMetadata("pv-2", clusterID)),
+		// Inline migrated volume.
+		newVolume("vol-3"),
+		// Volume left behind by a failed provisioning.
+		newVolume("vol-4"),
+		// Volume whose PV was deleted, still used by another cluster.
+		newVolume("vol-5", newPVMetadata("pv-5", clusterID), newPVMetadata("pv-2", "cluster-2")),
+	}
+	pvs := []*v1.PersistentVolume{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "pv-1"},
+			Spec: v1.PersistentVolumeSpec{
+				PersistentVolumeSource: v1.PersistentVolumeSource{
+					CSI: &v1.CSIPersistentVolumeSource{Driver: csitypes.Name, VolumeHandle: "vol-1"},
+				},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "pv-2"},
+			Spec: v1.PersistentVolumeSpec{
+				PersistentVolumeSource: v1.PersistentVolumeSource{
+					VsphereVolume: &v1.VsphereVirtualDiskVolumeSource{VolumePath: "[ds] kubevols/vol-2.vmdk"},
+				},
+			},
+		},
+	}
+	inlineVolumes := map[string]string{"vol-3": "[ds] kubevols/vol-3.vmdk"}
+
+	orphanVolumes := getOrphanVolumes(volumes, clusterID, pvs, inlineVolumes)
+	if len(orphanVolumes) != 2 || orphanVolumes[0].VolumeId.Id != "vol-4" || orphanVolumes[1].VolumeId.Id != "vol-5" {
+		t.Fatalf("expected vol-4 and vol-5 to be orphan, got %+v", orphanVolumes)
+	}
+	if !hasKubernetesMetadata(orphanVolumes[1]) || hasKubernetesMetadata(orphanVolumes[0]) {
+		t.Errorf("expected only vol-5 to have Kubernetes metadata")
+	}
+
+	orphanVolumeMap = make(map[string]time.Time)
+	defer func() {
+		orphanVolumeMap = make(map[string]time.Time)
+	}()
+	firstRun := time.Now()
+	if tracked := trackOrphanVolumes(orphanVolumes, firstRun); len(tracked) != 0 {
+		t.Fatalf("expected no orphan volume in the first run, got %+v", tracked)
+	}
+	// vol-5 got a PV between the two runs.
+	tracked := trackOrphanVolumes(orphanVolumes[:1], firstRun.Add(time.Hour))
+	if len(tracked) != 1 || tracked[0].VolumeId.Id != "vol-4" {
+		t.Fatalf("expected vol-4 to be orphan in the second run, got %+v", tracked)
+	}
+	if !orphanVolumeMap["vol-4"].Equal(firstRun) {
+		t.Errorf("expected vol-4 to be orphan since %v, got %v", firstRun, orphanVolumeMap["vol-4"])
+	}
+	if _, ok := orphanVolumeMap["vol-5"]; ok {
+		t.Errorf("expected vol-5 to be forgotten once it has a PV")
+	}
+
+	// Orphan volumes are only deleted once they reach the minimum age, and
+	// never while they have an operation in progress or Kubernetes metadata.
+	orphanVolumeMap["vol-5"] = firstRun
+	minAge := 24 * time.Hour
+	if deletable := getDeletableOrphanVolumes(ctx, orphanVolumes, firstRun.Add(time.Hour), minAge, nil); len(deletable) != 0 {
+		t.Errorf("expected no volume to be deleted before the minimum age, got %+v", deletable)
+	}
+	deletable := getDeletableOrphanVolumes(ctx, orphanVolumes, firstRun.Add(minAge), minAge, nil)
+	if len(deletable) != 1 || deletable[0].VolumeId.Id != "vol-4" {
+		t.Errorf("expected only vol-4 to be deleted once it reaches the minimum age, got %+v", deletable)
+	}
+	deletable = getDeletableOrphanVolumes(ctx, orphanVolumes, firstRun.Add(minAge), minAge, map[string]bool{"vol-4": true})
+	if len(deletable) != 0 {
+		t.Errorf("expected no volume to be deleted while vol-4 has an operation in progress, got %+v", deletable)
+	}
+}
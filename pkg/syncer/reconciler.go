@@ -0,0 +1,110 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
+)
+
+// periodicReconciler is a manager.Runnable calling reconcile right away and
+// then every interval, until the manager is stopped. It only runs on the
+// leader instance of the syncer, unless allReplicas is set.
+type periodicReconciler struct {
+	// name of the reconciler, used in logs.
+	name string
+	// interval between two calls of reconcile.
+	interval time.Duration
+	// reconcile is called with a new context with logger for every run.
+	reconcile func(ctx context.Context)
+	// allReplicas runs the reconciler on all the replicas of the syncer.
+	allReplicas bool
+}
+
+var _ manager.Runnable = &periodicReconciler{}
+var _ manager.LeaderElectionRunnable = &periodicReconciler{}
+
+// Start calls reconcile every interval until ctx is done.
+func (r *periodicReconciler) Start(ctx context.Context) error {
+	log := logger.GetLogger(ctx)
+	log.Infof("Starting %s reconciler with interval %v", r.name, r.interval)
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		reconcileCtx, _ := logger.GetNewContextWithLogger()
+		r.reconcile(reconcileCtx)
+		select {
+		case <-ctx.Done():
+			log.Infof("Stopping %s reconciler", r.name)
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// NeedLeaderElection returns true if the reconciler only runs on the leader.
+func (r *periodicReconciler) NeedLeaderElection() bool {
+	return !r.allReplicas
+}
+
+// featureGatedReconciler is a manager.Runnable checking every interval whether
+// its feature is enabled, and then calling run, which runs the reconciler
+// until ctx is done. It only runs on the leader instance of the syncer. run is
+// called again after interval if it fails.
+type featureGatedReconciler struct {
+	// name of the reconciler, used in logs.
+	name string
+	// interval between two checks of the feature, or retries of run.
+	interval time.Duration
+	// isEnabled returns whether the feature of the reconciler is enabled.
+	isEnabled func(ctx context.Context) bool
+	// run runs the reconciler until ctx is done.
+	run func(ctx context.Context) error
+}
+
+var _ manager.Runnable = &featureGatedReconciler{}
+
+// Start calls run once the feature is enabled, until it succeeds or ctx is
+// done.
+func (r *featureGatedReconciler) Start(ctx context.Context) error {
+	log := logger.GetLogger(ctx)
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		if !r.isEnabled(ctx) {
+			log.Debugf("Feature of %s reconciler is disabled on the cluster", r.name)
+		} else {
+			log.Infof("Starting %s reconciler", r.name)
+			err := r.run(logger.NewContextWithLogger(ctx))
+			if err == nil {
+				log.Infof("Stopped %s reconciler", r.name)
+				return nil
+			}
+			log.Warnf("Error while running %s reconciler. Err: %+v. Retry will be triggered at %v",
+				r.name, err, time.Now().Add(r.interval))
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
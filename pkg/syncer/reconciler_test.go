@@ -0,0 +1,94 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPeriodicReconciler(t *testing.T) {
+	runs := make(chan struct{}, 10)
+	r := &periodicReconciler{
+		name:     "test",
+		interval: 10 * time.Millisecond,
+		reconcile: func(ctx context.Context) {
+			runs <- struct{}{}
+		},
+	}
+	if !r.NeedLeaderElection() {
+		t.Fatalf("expected reconciler to run on the leader only")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- r.Start(ctx)
+	}()
+	// The reconciler runs right away and then every interval.
+	for i := 0; i < 2; i++ {
+		select {
+		case <-runs:
+		case <-time.After(10 * time.Second):
+			t.Fatalf("expected reconcile run %d", i+1)
+		}
+	}
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("expected reconciler to stop without error, got %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("expected reconciler to stop once the context is done")
+	}
+}
+
+func TestFeatureGatedReconciler(t *testing.T) {
+	checks, runs := 0, 0
+	r := &featureGatedReconciler{
+		name:     "test",
+		interval: 10 * time.Millisecond,
+		isEnabled: func(ctx context.Context) bool {
+			checks++
+			return checks > 1
+		},
+		run: func(ctx context.Context) error {
+			runs++
+			if runs == 1 {
+				return errors.New("injected failure")
+			}
+			return nil
+		},
+	}
+	// The reconciler runs once the feature is enabled, until it succeeds.
+	if err := r.Start(context.Background()); err != nil {
+		t.Fatalf("expected reconciler to stop without error, got %v", err)
+	}
+	if checks != 3 || runs != 2 {
+		t.Fatalf("expected 3 feature checks and 2 runs, got %d checks and %d runs", checks, runs)
+	}
+
+	// The reconciler stops waiting for the feature once the context is done.
+	r.isEnabled = func(ctx context.Context) bool { return false }
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := r.Start(ctx); err != nil {
+		t.Fatalf("expected reconciler to stop without error, got %v", err)
+	}
+}
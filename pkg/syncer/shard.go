@@ -0,0 +1,207 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"time"
+
+	cnstypes "github.com/vmware/govmomi/cns/types"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+
+	cnsconfig "sigs.k8s.io/vsphere-csi-driver/pkg/common/config"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
+	k8s "sigs.k8s.io/vsphere-csi-driver/pkg/kubernetes"
+)
+
+// volumeShardLeasePrefix is the prefix of the names of the leases the
+// replicas of the syncer acquire their volume shard with.
+const volumeShardLeasePrefix = "vsphere-syncer-volume-shard"
+
+// VolumeShard identifies the volumes whose metadata and health a replica of
+// the syncer syncs, by the hash of their volume ID. Full sync isn't sharded,
+// it runs on the leader replica for all the volumes. A Count of 0 or 1 owns
+// all the volumes.
+type VolumeShard struct {
+	// Index of the shard of the replica, from 0 to Count-1.
+	Index int
+	// Count of shards, one per replica of the syncer.
+	Count int
+}
+
+// Sharded returns true if the volumes are split across several replicas.
+func (s VolumeShard) Sharded() bool {
+	return s.Count > 1
+}
+
+// Validate returns an error if the index isn't within the count of shards.
+func (s VolumeShard) Validate() error {
+	if s.Count < 0 {
+		return fmt.Errorf("invalid volume shard count %d", s.Count)
+	}
+	if s.Sharded() && (s.Index < 0 || s.Index >= s.Count) {
+		return fmt.Errorf("volume shard index %d is not within the %d shards", s.Index, s.Count)
+	}
+	return nil
+}
+
+// Owns returns true if the volume with the ID is in the shard. In-tree
+// vSphere volumes are identified by their volume path.
+func (s VolumeShard) Owns(volumeID string) bool {
+	if !s.Sharded() {
+		return true
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(volumeID))
+	return int(h.Sum32()%uint32(s.Count)) == s.Index
+}
+
+// ownsPV returns true if the volume of the PV is in the shard.
+func (s VolumeShard) ownsPV(pv *v1.PersistentVolume) bool {
+	if pv.Spec.CSI != nil {
+		return s.Owns(pv.Spec.CSI.VolumeHandle)
+	}
+	if pv.Spec.VsphereVolume != nil {
+		return s.Owns(pv.Spec.VsphereVolume.VolumePath)
+	}
+	return true
+}
+
+// getShardQueryFilters returns the CNS query filters of the volumes of the PVs
+// in the shard of the syncer, by batches of queryVolumeLimit volumes, so that
+// each replica only queries the volumes of its shard. No filter is returned if
+// the shard has no PV.
+func getShardQueryFilters(metadataSyncer *metadataSyncInformer, pvs []*v1.PersistentVolume) []cnstypes.CnsQueryFilter {
+	var queryFilters []cnstypes.CnsQueryFilter
+	var volumeIDs []cnstypes.CnsVolumeId
+	for _, pv := range pvs {
+		if pv.Spec.CSI == nil || !metadataSyncer.shard.ownsPV(pv) {
+			continue
+		}
+		volumeIDs = append(volumeIDs, cnstypes.CnsVolumeId{Id: pv.Spec.CSI.VolumeHandle})
+		if int64(len(volumeIDs)) == queryVolumeLimit {
+			queryFilters = append(queryFilters, newShardQueryFilter(metadataSyncer, volumeIDs))
+			volumeIDs = nil
+		}
+	}
+	if len(volumeIDs) != 0 {
+		queryFilters = append(queryFilters, newShardQueryFilter(metadataSyncer, volumeIDs))
+	}
+	return queryFilters
+}
+
+// newShardQueryFilter returns the CNS query filter of the volumes of the
+// cluster with the given IDs.
+func newShardQueryFilter(metadataSyncer *metadataSyncInformer,
+	volumeIDs []cnstypes.CnsVolumeId) cnstypes.CnsQueryFilter {
+	return cnstypes.CnsQueryFilter{
+		VolumeIds:           volumeIDs,
+		ContainerClusterIds: []string{metadataSyncer.configInfo.Cfg.Global.ClusterID},
+	}
+}
+
+// AcquireVolumeShardIndex campaigns for the leases of the count shards in
+// the namespace of CSI_NAMESPACE, with the pod name as identity, and returns
+// the index of the first shard whose lease it acquires. The replicas of a
+// Deployment have no stable ordinal, the leases give each replica its own
+// shard. The process exits if the lease of the shard is lost, for the replica
+// to be restarted and acquire a free shard again.
+func AcquireVolumeShardIndex(ctx context.Context, count int, leaseDuration time.Duration,
+	renewDeadline time.Duration, retryPeriod time.Duration) (int, error) {
+	log := logger.GetLogger(ctx)
+	namespace := os.Getenv(cnsconfig.EnvCSINamespace)
+	if namespace == "" {
+		namespace = cnsconfig.DefaultCSINamespace
+	}
+	identity, err := os.Hostname()
+	if err != nil {
+		log.Errorf("failed to get hostname for the volume shard leases. Err: %v", err)
+		return 0, err
+	}
+	k8sClient, err := k8s.NewClient(ctx)
+	if err != nil {
+		log.Errorf("failed to create Kubernetes client. Err: %v", err)
+		return 0, err
+	}
+	acquired := make(chan int, count)
+	cancels := make([]context.CancelFunc, count)
+	cancelAll := func(except int) {
+		for i, cancel := range cancels {
+			if i != except && cancel != nil {
+				cancel()
+			}
+		}
+	}
+	for i := 0; i < count; i++ {
+		index := i
+		leaseName := volumeShardLeaseName(index)
+		lock, err := resourcelock.New(resourcelock.LeasesResourceLock, namespace, leaseName,
+			k8sClient.CoreV1(), k8sClient.CoordinationV1(), resourcelock.ResourceLockConfig{Identity: identity})
+		if err != nil {
+			cancelAll(-1)
+			log.Errorf("failed to create the lease lock of volume shard %d. Err: %v", index, err)
+			return 0, err
+		}
+		electorCtx, cancel := context.WithCancel(ctx)
+		cancels[index] = cancel
+		elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+			Lock:            lock,
+			LeaseDuration:   leaseDuration,
+			RenewDeadline:   renewDeadline,
+			RetryPeriod:     retryPeriod,
+			ReleaseOnCancel: true,
+			Name:            leaseName,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(context.Context) {
+					acquired <- index
+				},
+				OnStoppedLeading: func() {
+					// The leases of the other shards are released on purpose.
+					if electorCtx.Err() == nil {
+						log.Fatalf("%s lost the lease %s/%s of volume shard %d", identity, namespace, leaseName, index)
+					}
+				},
+			},
+		})
+		if err != nil {
+			cancelAll(-1)
+			log.Errorf("failed to create the leader elector of volume shard %d. Err: %v", index, err)
+			return 0, err
+		}
+		go elector.Run(electorCtx)
+	}
+	select {
+	case index := <-acquired:
+		cancelAll(index)
+		log.Infof("%s acquired the lease %s/%s of volume shard %d", identity, namespace, volumeShardLeaseName(index),
+			index)
+		return index, nil
+	case <-ctx.Done():
+		cancelAll(-1)
+		return 0, ctx.Err()
+	}
+}
+
+// volumeShardLeaseName returns the name of the lease of the shard.
+func volumeShardLeaseName(index int) string {
+	return fmt.Sprintf("%s-%d", volumeShardLeasePrefix, index)
+}
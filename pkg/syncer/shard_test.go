@@ -0,0 +1,91 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"fmt"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+
+	cnsconfig "sigs.k8s.io/vsphere-csi-driver/pkg/common/config"
+)
+
+func TestVolumeShard(t *testing.T) {
+	if !(VolumeShard{}).Owns("vol1") {
+		t.Fatalf("expected unsharded syncer to own all the volumes")
+	}
+	shards := []VolumeShard{{Index: 0, Count: 3}, {Index: 1, Count: 3}, {Index: 2, Count: 3}}
+	for i := 0; i < 100; i++ {
+		volumeID := fmt.Sprintf("vol%d", i)
+		owners := 0
+		for _, shard := range shards {
+			if shard.Owns(volumeID) {
+				owners++
+			}
+		}
+		if owners != 1 {
+			t.Fatalf("expected volume %s to be owned by exactly one shard, got %d", volumeID, owners)
+		}
+	}
+
+	for _, shard := range []VolumeShard{{Index: 3, Count: 3}, {Index: -1, Count: 2}, {Count: -1}} {
+		if err := shard.Validate(); err == nil {
+			t.Errorf("expected invalid shard %+v", shard)
+		}
+	}
+}
+
+func TestGetShardQueryFilters(t *testing.T) {
+	metadataSyncer := &metadataSyncInformer{
+		configInfo: &cnsconfig.ConfigurationInfo{Cfg: &cnsconfig.Config{}},
+		shard:      VolumeShard{Index: 1, Count: 2},
+	}
+	metadataSyncer.configInfo.Cfg.Global.ClusterID = "cluster-1"
+	var pvs []*v1.PersistentVolume
+	owned := 0
+	for i := 0; i < int(queryVolumeLimit)*2; i++ {
+		volumeID := fmt.Sprintf("vol%d", i)
+		if metadataSyncer.shard.Owns(volumeID) {
+			owned++
+		}
+		pvs = append(pvs, &v1.PersistentVolume{
+			Spec: v1.PersistentVolumeSpec{
+				PersistentVolumeSource: v1.PersistentVolumeSource{
+					CSI: &v1.CSIPersistentVolumeSource{VolumeHandle: volumeID},
+				},
+			},
+		})
+	}
+	queried := 0
+	for _, queryFilter := range getShardQueryFilters(metadataSyncer, pvs) {
+		if int64(len(queryFilter.VolumeIds)) > queryVolumeLimit || len(queryFilter.ContainerClusterIds) != 1 ||
+			queryFilter.ContainerClusterIds[0] != "cluster-1" {
+			t.Fatalf("unexpected query filter of %d volumes of clusters %v", len(queryFilter.VolumeIds),
+				queryFilter.ContainerClusterIds)
+		}
+		for _, volumeID := range queryFilter.VolumeIds {
+			if !metadataSyncer.shard.Owns(volumeID.Id) {
+				t.Fatalf("volume %q is not in the shard", volumeID.Id)
+			}
+			queried++
+		}
+	}
+	if queried != owned {
+		t.Fatalf("expected the %d volumes of the shard to be queried, got %d", owned, queried)
+	}
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+
+	cnstypes "github.com/vmware/govmomi/cns/types"
+	vimtypes "github.com/vmware/govmomi/vim25/types"
+	v1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	cnsvsphere "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/vsphere"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/common"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
+	csitypes "sigs.k8s.io/vsphere-csi-driver/pkg/csi/types"
+	k8s "sigs.k8s.io/vsphere-csi-driver/pkg/kubernetes"
+)
+
+// attachmentKey returns the key of the attachment of the volume to the node.
+func attachmentKey(volumeID string, nodeName string) string {
+	return volumeID + "/" + nodeName
+}
+
+// getAttachmentsInUse returns the keys of the attachments of volumes to nodes
+// that a VolumeAttachment of the driver, or a pod running on the node, uses.
+// pvToVolumeID maps PV names to volume IDs, pvcToVolumeID maps PVC
+// namespace/name to volume IDs.
+func getAttachmentsInUse(volumeAttachments []*storagev1.VolumeAttachment, pods []*v1.Pod,
+	pvToVolumeID map[string]string, pvcToVolumeID map[string]string) map[string]bool {
+	inUse := make(map[string]bool)
+	for _, va := range volumeAttachments {
+		if va.Spec.Attacher != csitypes.Name || va.Spec.Source.PersistentVolumeName == nil {
+			continue
+		}
+		if volumeID, ok := pvToVolumeID[*va.Spec.Source.PersistentVolumeName]; ok {
+			inUse[attachmentKey(volumeID, va.Spec.NodeName)] = true
+		}
+	}
+	for _, pod := range pods {
+		if pod.Spec.NodeName == "" || pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+			continue
+		}
+		for _, volume := range pod.Spec.Volumes {
+			if volume.PersistentVolumeClaim == nil {
+				continue
+			}
+			if volumeID, ok := pvcToVolumeID[pod.Namespace+"/"+volume.PersistentVolumeClaim.ClaimName]; ok {
+				inUse[attachmentKey(volumeID, pod.Spec.NodeName)] = true
+			}
+		}
+	}
+	return inUse
+}
+
+// fullSyncDetachStaleAttachments detaches the volumes of the cluster from the
+// node VMs on which neither a VolumeAttachment nor a pod has used them for two
+// full sync cycles, healing drift caused by missed detach calls. Only the node
+// VMs of the vCenter of metadataSyncer are checked, so that their volumes are
+// detached through the CNS of their vCenter.
+func fullSyncDetachStaleAttachments(ctx context.Context, k8sPVs []*v1.PersistentVolume,
+	metadataSyncer *metadataSyncInformer) {
+	log := logger.GetLogger(ctx)
+	if metadataSyncer.clusterFlavor != cnstypes.CnsClusterFlavorVanilla ||
+		!metadataSyncer.coCommonInterface.IsFSSEnabled(ctx, common.StaleAttachmentReconciliation) {
+		return
+	}
+	pvToVolumeID := make(map[string]string)
+	pvcToVolumeID := make(map[string]string)
+	for _, pv := range k8sPVs {
+		if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != csitypes.Name {
+			continue
+		}
+		pvToVolumeID[pv.Name] = pv.Spec.CSI.VolumeHandle
+		if pv.Spec.ClaimRef != nil {
+			pvcToVolumeID[pv.Spec.ClaimRef.Namespace+"/"+pv.Spec.ClaimRef.Name] = pv.Spec.CSI.VolumeHandle
+		}
+	}
+	volumeIDs := make(map[string]bool)
+	for _, volumeID := range pvToVolumeID {
+		volumeIDs[volumeID] = true
+	}
+	volumeAttachments, err := metadataSyncer.volumeAttachmentLister.List(labels.Everything())
+	if err != nil {
+		log.Warnf("FullSync: Failed to list volume attachments. err=%v", err)
+		return
+	}
+	pods, err := metadataSyncer.podLister.Pods(v1.NamespaceAll).List(labels.Everything())
+	if err != nil {
+		log.Warnf("FullSync: Failed to get pods in all namespaces. err=%v", err)
+		return
+	}
+	nodes, err := metadataSyncer.nodeLister.List(labels.Everything())
+	if err != nil {
+		log.Warnf("FullSync: Failed to list nodes. err=%v", err)
+		return
+	}
+	inUse := getAttachmentsInUse(volumeAttachments, pods, pvToVolumeID, pvcToVolumeID)
+
+	staleAttachments := make(map[string]bool)
+	for _, node := range nodes {
+		vm, err := cnsvsphere.GetVirtualMachineByUUID(ctx, k8s.GetNodeUUID(node), false)
+		if err != nil {
+			log.Warnf("FullSync: Failed to get VM of node %q to check its attached volumes. err=%v", node.Name, err)
+			continue
+		}
+		if vm.VirtualCenterHost != metadataSyncer.host {
+			continue
+		}
+		devices, err := vm.Device(ctx)
+		if err != nil {
+			log.Warnf("FullSync: Failed to get devices of VM %v of node %q. err=%v", vm, node.Name, err)
+			continue
+		}
+		for _, device := range devices {
+			disk, ok := device.(*vimtypes.VirtualDisk)
+			if !ok || disk.VDiskId == nil || !volumeIDs[disk.VDiskId.Id] {
+				continue
+			}
+			volumeID := disk.VDiskId.Id
+			key := attachmentKey(volumeID, node.Name)
+			if inUse[key] {
+				continue
+			}
+			if !staleAttachmentMap[metadataSyncer.host][key] {
+				log.Infof("FullSync: Volume %q is attached to node %q without a VolumeAttachment or pod using it",
+					volumeID, node.Name)
+				staleAttachments[key] = true
+				continue
+			}
+			log.Infof("FullSync: Detaching volume %q from node %q, it wasn't used there for two full sync cycles",
+				volumeID, node.Name)
+			if err := metadataSyncer.volumeManager.DetachVolume(ctx, vm, volumeID); err != nil {
+				log.Warnf("FullSync: Failed to detach stale attachment of volume %q from node %q. err=%v",
+					volumeID, node.Name, err)
+				staleAttachments[key] = true
+			}
+		}
+	}
+	// Attachments used again, or not attached anymore, are dropped from the map.
+	staleAttachmentMap[metadataSyncer.host] = staleAttachments
+}
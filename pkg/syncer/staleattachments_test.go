@@ -0,0 +1,82 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	csitypes "sigs.k8s.io/vsphere-csi-driver/pkg/csi/types"
+)
+
+func TestGetAttachmentsInUse(t *testing.T) {
+	pv1, pv2 := "pv1", "pv2"
+	volumeAttachments := []*storagev1.VolumeAttachment{
+		{
+			Spec: storagev1.VolumeAttachmentSpec{
+				Attacher: csitypes.Name,
+				NodeName: "node1",
+				Source:   storagev1.VolumeAttachmentSource{PersistentVolumeName: &pv1},
+			},
+		},
+		{
+			// Attachments of other drivers are ignored.
+			Spec: storagev1.VolumeAttachmentSpec{
+				Attacher: "other.csi.driver",
+				NodeName: "node2",
+				Source:   storagev1.VolumeAttachmentSource{PersistentVolumeName: &pv2},
+			},
+		},
+	}
+	newPod := func(nodeName string, phase v1.PodPhase) *v1.Pod {
+		return &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "pod-" + nodeName},
+			Spec: v1.PodSpec{
+				NodeName: nodeName,
+				Volumes: []v1.Volume{
+					{
+						Name: "data",
+						VolumeSource: v1.VolumeSource{
+							PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: "pvc2"},
+						},
+					},
+				},
+			},
+			Status: v1.PodStatus{Phase: phase},
+		}
+	}
+	pods := []*v1.Pod{newPod("node3", v1.PodRunning), newPod("node4", v1.PodSucceeded)}
+	pvToVolumeID := map[string]string{"pv1": "vol1", "pv2": "vol2"}
+	pvcToVolumeID := map[string]string{"ns/pvc2": "vol2"}
+
+	inUse := getAttachmentsInUse(volumeAttachments, pods, pvToVolumeID, pvcToVolumeID)
+	expected := map[string]bool{
+		attachmentKey("vol1", "node1"): true,
+		attachmentKey("vol2", "node3"): true,
+	}
+	if len(inUse) != len(expected) {
+		t.Fatalf("expected attachments in use %v, got %v", expected, inUse)
+	}
+	for key := range expected {
+		if !inUse[key] {
+			t.Errorf("expected attachment %s to be in use, got %v", key, inUse)
+		}
+	}
+}
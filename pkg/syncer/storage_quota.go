@@ -0,0 +1,193 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	cnstypes "github.com/vmware/govmomi/cns/types"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cnsstoragequotav1alpha1 "sigs.k8s.io/vsphere-csi-driver/pkg/apis/cnsoperator/cnsstoragequota/v1alpha1"
+	cnsvsphere "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/vsphere"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/common/utils"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
+	csitypes "sigs.k8s.io/vsphere-csi-driver/pkg/csi/types"
+)
+
+// defaultStorageQuotaIntervalInMin is the default interval the usage of the
+// CnsStorageQuota instances is computed at.
+const defaultStorageQuotaIntervalInMin = 5
+
+// quotaVolume is a CNS volume bound to a PVC, counted in the usage of the
+// CnsStorageQuota instances of its namespace.
+type quotaVolume struct {
+	storagePolicyName string
+	datastoreURL      string
+	capacityInMb      int64
+}
+
+// getStorageQuotaIntervalInMin returns the interval the usage of the CnsStorageQuota instances is computed at.
+// If environment variable STORAGE_QUOTA_INTERVAL_MINUTES is set and valid,
+// return the interval value read from environment variable
+// otherwise, use the default value 5 minutes
+func getStorageQuotaIntervalInMin(ctx context.Context) int {
+	log := logger.GetLogger(ctx)
+	storageQuotaIntervalInMin := defaultStorageQuotaIntervalInMin
+	if v := os.Getenv("STORAGE_QUOTA_INTERVAL_MINUTES"); v != "" {
+		if value, err := strconv.Atoi(v); err == nil && value > 0 {
+			storageQuotaIntervalInMin = value
+			log.Infof("StorageQuota: storage quota interval is set to %d minutes", storageQuotaIntervalInMin)
+		} else {
+			log.Warnf("StorageQuota: storage quota interval set in env variable STORAGE_QUOTA_INTERVAL_MINUTES %s is invalid, will use the default interval", v)
+		}
+	}
+	return storageQuotaIntervalInMin
+}
+
+// csiSyncStorageQuotaUsage computes the capacity of the CNS volumes bound to
+// the PVCs of the namespaces with CnsStorageQuota instances, and saves it for
+// each of their limits in the status of the instances. The admission webhook
+// rejects the PVCs exceeding the limits based on this usage.
+func csiSyncStorageQuotaUsage(ctx context.Context, metadataSyncer *metadataSyncInformer,
+	cnsOperatorClient client.Client) {
+	log := logger.GetLogger(ctx)
+	quotaList := &cnsstoragequotav1alpha1.CnsStorageQuotaList{}
+	if err := cnsOperatorClient.List(ctx, quotaList); err != nil {
+		log.Errorf("StorageQuota: failed to list CnsStorageQuota instances. Err: %v", err)
+		return
+	}
+	if len(quotaList.Items) == 0 {
+		return
+	}
+	// The time is taken before querying the volumes, so that the webhook
+	// counts the PVCs created during the sync.
+	syncTime := metav1.Now()
+	volumes, syncErr := getQuotaVolumes(ctx, metadataSyncer)
+	if syncErr != nil {
+		log.Errorf("StorageQuota: failed to compute the usage of the storage quotas. Err: %v", syncErr)
+	}
+	for i := range quotaList.Items {
+		quota := &quotaList.Items[i]
+		quota.Status.Error = ""
+		if syncErr != nil {
+			// The previous usage is kept until it can be computed again.
+			quota.Status.Error = syncErr.Error()
+		} else {
+			quota.Status.LastSyncTime = &syncTime
+			quota.Status.Usage = getStorageQuotaUsage(quota.Spec.Limits, volumes[quota.Namespace])
+		}
+		if err := cnsOperatorClient.Update(ctx, quota); err != nil {
+			log.Errorf("StorageQuota: failed to update CnsStorageQuota instance %s/%s. Err: %v",
+				quota.Namespace, quota.Name, err)
+		}
+	}
+	log.Infof("StorageQuota: synced the usage of %d storage quotas", len(quotaList.Items))
+}
+
+// getQuotaVolumes returns the CNS volumes of the cluster bound to PVCs, by
+// namespace.
+func getQuotaVolumes(ctx context.Context, metadataSyncer *metadataSyncInformer) (map[string][]quotaVolume, error) {
+	queryFilter := cnstypes.CnsQueryFilter{
+		ContainerClusterIds: []string{
+			metadataSyncer.configInfo.Cfg.Global.ClusterID,
+		},
+	}
+	queryResult, err := utils.CachedQueryVolumeUtil(ctx, metadataSyncer.volumeManager, queryFilter, utils.QuerySelection())
+	if err != nil {
+		return nil, fmt.Errorf("QueryVolume failed. Err: %v", err)
+	}
+	pvs, err := metadataSyncer.pvLister.List(labels.Everything())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list PVs. Err: %v", err)
+	}
+	policyIDs := make(map[string]bool)
+	for _, volume := range queryResult.Volumes {
+		if volume.StoragePolicyId != "" {
+			policyIDs[volume.StoragePolicyId] = true
+		}
+	}
+	policyNames := make(map[string]string)
+	if len(policyIDs) > 0 {
+		vc, err := cnsvsphere.GetVirtualCenterInstance(ctx, metadataSyncer.configInfo, false)
+		if err != nil {
+			return nil, err
+		}
+		var ids []string
+		for id := range policyIDs {
+			ids = append(ids, id)
+		}
+		if policyNames, err = vc.PbmRetrievePolicyNames(ctx, ids); err != nil {
+			return nil, fmt.Errorf("failed to retrieve the names of the storage policies. Err: %v", err)
+		}
+	}
+	return buildQuotaVolumes(queryResult.Volumes, pvs, policyNames), nil
+}
+
+// buildQuotaVolumes returns the CNS volumes bound to the PVCs of the given PVs,
+// by namespace of their PVC, with the names of their storage policies.
+func buildQuotaVolumes(volumes []cnstypes.CnsVolume, pvs []*v1.PersistentVolume,
+	policyNames map[string]string) map[string][]quotaVolume {
+	namespaces := make(map[string]string)
+	for _, pv := range pvs {
+		if pv.Spec.CSI != nil && pv.Spec.CSI.Driver == csitypes.Name && pv.Spec.ClaimRef != nil {
+			namespaces[pv.Spec.CSI.VolumeHandle] = pv.Spec.ClaimRef.Namespace
+		}
+	}
+	quotaVolumes := make(map[string][]quotaVolume)
+	for _, volume := range volumes {
+		namespace, ok := namespaces[volume.VolumeId.Id]
+		if !ok {
+			continue
+		}
+		quotaVol := quotaVolume{
+			storagePolicyName: policyNames[volume.StoragePolicyId],
+			datastoreURL:      volume.DatastoreUrl,
+		}
+		if volume.BackingObjectDetails != nil {
+			quotaVol.capacityInMb = volume.BackingObjectDetails.GetCnsBackingObjectDetails().CapacityInMb
+		}
+		quotaVolumes[namespace] = append(quotaVolumes[namespace], quotaVol)
+	}
+	return quotaVolumes
+}
+
+// getStorageQuotaUsage returns the capacity of the volumes each of the limits
+// applies to, in the order of the limits.
+func getStorageQuotaUsage(limits []cnsstoragequotav1alpha1.CnsStorageQuotaLimit,
+	volumes []quotaVolume) []cnsstoragequotav1alpha1.CnsStorageQuotaUsage {
+	usage := make([]cnsstoragequotav1alpha1.CnsStorageQuotaUsage, 0, len(limits))
+	for _, limit := range limits {
+		used := cnsstoragequotav1alpha1.CnsStorageQuotaUsage{
+			StoragePolicyName: limit.StoragePolicyName,
+			DatastoreURL:      limit.DatastoreURL,
+		}
+		for _, volume := range volumes {
+			if limit.Matches(volume.storagePolicyName, volume.datastoreURL) {
+				used.UsedInMb += volume.capacityInMb
+			}
+		}
+		usage = append(usage, used)
+	}
+	return usage
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"testing"
+
+	cnstypes "github.com/vmware/govmomi/cns/types"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	cnsstoragequotav1alpha1 "sigs.k8s.io/vsphere-csi-driver/pkg/apis/cnsoperator/cnsstoragequota/v1alpha1"
+	csitypes "sigs.k8s.io/vsphere-csi-driver/pkg/csi/types"
+)
+
+// TestGetStorageQuotaUsage checks that the capacity of the volumes bound to
+// the PVCs of a namespace is counted in the limits applying to them.
+func TestGetStorageQuotaUsage(t *testing.T) {
+	newVolume := func(id string, policyID string, datastoreURL string, capacityInMb int64) cnstypes.CnsVolume {
+		return cnstypes.CnsVolume{
+			VolumeId:        cnstypes.CnsVolumeId{Id: id},
+			DatastoreUrl:    datastoreURL,
+			StoragePolicyId: policyID,
+			BackingObjectDetails: &cnstypes.CnsBlockBackingDetails{
+				CnsBackingObjectDetails: cnstypes.CnsBackingObjectDetails{CapacityInMb: capacityInMb},
+			},
+		}
+	}
+	newPV := func(volumeID string, namespace string) *v1.PersistentVolume {
+		return &v1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: "pv-" + volumeID},
+			Spec: v1.PersistentVolumeSpec{
+				PersistentVolumeSource: v1.PersistentVolumeSource{
+					CSI: &v1.CSIPersistentVolumeSource{Driver: csitypes.Name, VolumeHandle: volumeID},
+				},
+				ClaimRef: &v1.ObjectReference{Namespace: namespace, Name: "pvc-" + volumeID},
+			},
+		}
+	}
+	volumes := []cnstypes.CnsVolume{
+		newVolume("vol-1", "policy-gold", "ds-1", 1024),
+		newVolume("vol-2", "policy-gold", "ds-2", 2048),
+		newVolume("vol-3", "policy-silver", "ds-1", 4096),
+		// Volume of another namespace.
+		newVolume("vol-4", "policy-gold", "ds-1", 8192),
+		// Volume without a PV.
+		newVolume("vol-5", "policy-gold", "ds-1", 16384),
+	}
+	pvs := []*v1.PersistentVolume{
+		newPV("vol-1", "ns-1"), newPV("vol-2", "ns-1"), newPV("vol-3", "ns-1"), newPV("vol-4", "ns-2"),
+	}
+	quotaVolumes := buildQuotaVolumes(volumes, pvs,
+		map[string]string{"policy-gold": "gold", "policy-silver": "silver"})
+
+	limits := []cnsstoragequotav1alpha1.CnsStorageQuotaLimit{
+		{LimitInMb: 10240},
+		{StoragePolicyName: "gold", LimitInMb: 10240},
+		{StoragePolicyName: "gold", DatastoreURL: "ds-1", LimitInMb: 10240},
+		{DatastoreURL: "ds-1", LimitInMb: 10240},
+		{StoragePolicyName: "bronze", LimitInMb: 10240},
+	}
+	usage := getStorageQuotaUsage(limits, quotaVolumes["ns-1"])
+	expected := []cnsstoragequotav1alpha1.CnsStorageQuotaUsage{
+		{UsedInMb: 7168},
+		{StoragePolicyName: "gold", UsedInMb: 3072},
+		{StoragePolicyName: "gold", DatastoreURL: "ds-1", UsedInMb: 1024},
+		{DatastoreURL: "ds-1", UsedInMb: 5120},
+		{StoragePolicyName: "bronze", UsedInMb: 0},
+	}
+	if len(usage) != len(expected) {
+		t.Fatalf("expected %d usages, got %+v", len(expected), usage)
+	}
+	for i := range expected {
+		if usage[i] != expected[i] {
+			t.Errorf("expected %+v, got %+v", expected[i], usage[i])
+		}
+	}
+	if usage := getStorageQuotaUsage(limits[:1], quotaVolumes["ns-2"]); usage[0].UsedInMb != 8192 {
+		t.Errorf("expected 8192 Mb used in ns-2, got %+v", usage)
+	}
+}
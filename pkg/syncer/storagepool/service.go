@@ -23,7 +23,7 @@ import (
 	"time"
 
 	cnstypes "github.com/vmware/govmomi/cns/types"
-	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
 
 	spv1alpha1 "sigs.k8s.io/vsphere-csi-driver/pkg/apis/storagepool/cns/v1alpha1"
@@ -67,7 +67,7 @@ func InitStoragePoolService(ctx context.Context, configInfo *commonconfig.Config
 	crdPlural := "storagepools"
 	crdName := crdPlural + "." + spv1alpha1.SchemeGroupVersion.Group
 	err = k8s.CreateCustomResourceDefinitionFromSpec(ctx, crdName, crdSingular, crdPlural,
-		crdKind, spv1alpha1.SchemeGroupVersion.Group, spv1alpha1.SchemeGroupVersion.Version, apiextensionsv1beta1.ClusterScoped)
+		crdKind, spv1alpha1.SchemeGroupVersion.Group, spv1alpha1.SchemeGroupVersion.Version, apiextensionsv1.ClusterScoped)
 	if err != nil {
 		log.Errorf("Failed to create %q CRD. Err: %+v", crdKind, err)
 		return err
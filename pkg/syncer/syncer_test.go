@@ -652,6 +652,17 @@ func runTestFullSyncWorkflows(t *testing.T) {
 	// PV does not exist in K8S, but volume exist in CNS cache
 	// FullSync should delete this volume from CNS cache after two cycles
 	waitForListerSync()
+	// A dry run should report the volume as orphaned, without counting as a cycle
+	report, err := CsiFullSyncDryRun(ctx, metadataSyncer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.OrphanedVolumeIDs) != 1 || report.OrphanedVolumeIDs[0] != volumeInfo.VolumeID.Id {
+		t.Fatalf("expected dry run to report volume %q as orphaned, got %+v", volumeInfo.VolumeID.Id, report)
+	}
+	if len(cnsDeletionMap) != 0 {
+		t.Fatalf("expected dry run not to add volumes to cnsDeletionMap, got %v", cnsDeletionMap)
+	}
 	err = CsiFullSync(ctx, metadataSyncer)
 	if err != nil {
 		t.Fatal(err)
@@ -699,6 +710,16 @@ func runTestFullSyncWorkflows(t *testing.T) {
 		t.Fatal(err)
 	}
 	waitForListerSync()
+	// A dry run should report the volume as missing, without counting as a cycle
+	if report, err = CsiFullSyncDryRun(ctx, metadataSyncer); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.MissingVolumeIDs) != 1 || report.MissingVolumeIDs[0] != volumeInfo.VolumeID.Id {
+		t.Fatalf("expected dry run to report volume %q as missing, got %+v", volumeInfo.VolumeID.Id, report)
+	}
+	if len(cnsCreationMap) != 0 {
+		t.Fatalf("expected dry run not to add volumes to cnsCreationMap, got %v", cnsCreationMap)
+	}
 	err = CsiFullSync(ctx, metadataSyncer)
 	if err != nil {
 		t.Fatal(err)
@@ -731,6 +752,19 @@ func runTestFullSyncWorkflows(t *testing.T) {
 		t.Fatal(err)
 	}
 	waitForListerSync()
+	// A dry run should report the metadata of the volume as stale, without updating it
+	if report, err = CsiFullSyncDryRun(ctx, metadataSyncer); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.StaleVolumeIDs) != 1 || report.StaleVolumeIDs[0] != volumeInfo.VolumeID.Id {
+		t.Fatalf("expected dry run to report volume %q as stale, got %+v", volumeInfo.VolumeID.Id, report)
+	}
+	if queryResult, err = virtualCenter.CnsClient.QueryVolume(ctx, queryFilter); err != nil {
+		t.Fatal(err)
+	}
+	if err = verifyUpdateOperation(queryResult, volumeInfo.VolumeID.Id, PV, pv.Name, testPVLabelValue); err != nil {
+		t.Fatal(err)
+	}
 	err = CsiFullSync(ctx, metadataSyncer)
 	if err != nil {
 		t.Fatal(err)
@@ -24,6 +24,8 @@ import (
 	v1 "k8s.io/api/core/v1"
 	clientset "k8s.io/client-go/kubernetes"
 	corelisters "k8s.io/client-go/listers/core/v1"
+	storagelisters "k8s.io/client-go/listers/storage/v1"
+	"k8s.io/client-go/util/workqueue"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	volumes "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/volume"
 	"sigs.k8s.io/vsphere-csi-driver/pkg/common/config"
@@ -37,6 +39,10 @@ var Version string
 const (
 	// default interval for csi full sync, used unless overridden by user in csi-controller YAML
 	defaultFullSyncIntervalInMin = 30
+	// default number of workers concurrently calling CNS to reconcile volumes during full sync
+	defaultFullSyncWorkers = 10
+	// max number of workers concurrently calling CNS to reconcile volumes during full sync
+	maxFullSyncWorkers = 50
 
 	// queryVolumeLimit is the page size, which should be set in the cursor when syncer container need to
 	// query many volumes using QueryVolume API
@@ -51,6 +57,13 @@ const (
 	// default interval for csi volume health
 	defaultVolumeHealthIntervalInMin = 5
 
+	// default interval for checking the capacity of the datastores holding volumes
+	defaultDatastoreCapacityIntervalInMin = 10
+	// default percentage of free space below which the free space of a datastore is low
+	defaultDatastoreLowSpacePercent = 20
+	// default percentage of free space below which the free space of a datastore is critical
+	defaultDatastoreCriticalSpacePercent = 10
+
 	// default resync period for volume health reconciler
 	volumeHealthResyncPeriod = 10 * time.Minute
 	// default retry start interval time for volume health reconciler
@@ -74,10 +87,22 @@ var (
 	// the volume is created in CNS
 	cnsCreationMap map[string]bool
 
+	// staleAttachmentMap tracks the volumes attached to node VMs while neither
+	// a VolumeAttachment nor a pod on the node uses them, keyed by the vCenter
+	// host of the node VM, then by volume ID and node name. If an attachment
+	// exists in this map across two fullsync cycles, the volume is detached
+	// from the node VM
+	staleAttachmentMap map[string]map[string]bool
+
 	// Metadata syncer and full sync share a global lock
 	// to mitigate race conditions related to
 	// static provisioning of volumes
 	volumeOperationsLock sync.Mutex
+
+	// volumeLocks has a *sync.Mutex per volume ID, held while the metadata
+	// of the volume is updated in CNS, so that the full sync workers and the
+	// metadata syncer don't update the same volume concurrently
+	volumeLocks sync.Map
 )
 
 type (
@@ -101,6 +126,18 @@ type metadataSyncInformer struct {
 	pvcLister          corelisters.PersistentVolumeClaimLister
 	podLister          corelisters.PodLister
 	coCommonInterface  commonco.COCommonInterface
+	// nodeLister, volumeAttachmentLister and storageClassLister are only set
+	// on vanilla clusters
+	nodeLister             corelisters.NodeLister
+	volumeAttachmentLister storagelisters.VolumeAttachmentLister
+	storageClassLister     storagelisters.StorageClassLister
+	// shard has the volumes whose metadata and health this replica syncs
+	shard VolumeShard
+	// vcenters has the volume managers of the vCenters configured in addition
+	// to the one of volumeManager, shared by the copies of getVCenterSyncers
+	vcenters *syncerVCenters
+	// volumeTagsQueue has the names of the PVs whose tags are to be synced
+	volumeTagsQueue workqueue.RateLimitingInterface
 }
 
 const (
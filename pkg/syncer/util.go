@@ -151,7 +151,8 @@ func fullSyncGetQueryResults(ctx context.Context, volumeIds []cnstypes.CnsVolume
 	var allQueryResults []*cnstypes.CnsQueryResult
 	for {
 		log.Debugf("Query volumes with offset: %v and limit: %v", queryFilter.Cursor.Offset, queryFilter.Cursor.Limit)
-		queryResult, err := utils.QueryVolumeUtil(ctx, volumeManager, queryFilter, cnstypes.CnsQuerySelection{}, metadataSyncer.coCommonInterface.IsFSSEnabled(ctx, common.AsyncQueryVolume))
+		queryResult, err := utils.CachedQueryVolumeUtil(ctx, volumeManager, queryFilter,
+			utils.VolumeMetadataQuerySelection())
 		if err != nil {
 			msg := fmt.Sprintf("QueryVolume failed with err=%+v", err.Error())
 			log.Error(msg)
@@ -2,14 +2,20 @@ package syncer
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"reflect"
 	"testing"
 
 	"github.com/google/uuid"
+	cnstypes "github.com/vmware/govmomi/cns/types"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
+	"sigs.k8s.io/vsphere-csi-driver/pkg/common/unittestcommon"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/common"
 	"sigs.k8s.io/vsphere-csi-driver/pkg/syncer/k8scloudoperator"
 )
 
@@ -159,3 +165,47 @@ func TestGetSCNameFromPVC(t *testing.T) {
 	}
 	t.Log("testGetSCNameFromPVC: end")
 }
+
+func TestFullSyncGetQueryResults(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	coCommonInterface, err := unittestcommon.GetFakeContainerOrchestratorInterface(common.Kubernetes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadataSyncer := &metadataSyncInformer{coCommonInterface: coCommonInterface}
+	volumeManager := unittestcommon.NewFakeVolumeManager()
+	clusterID := "test-cluster"
+	for i := 0; i < 3; i++ {
+		createSpec := cnstypes.CnsVolumeCreateSpec{
+			Name:       fmt.Sprintf("volume-%d", i),
+			VolumeType: common.BlockVolumeType,
+			Metadata: cnstypes.CnsVolumeMetadata{
+				ContainerCluster: cnstypes.CnsContainerCluster{ClusterId: clusterID},
+			},
+		}
+		if i == 2 {
+			createSpec.Metadata.ContainerCluster.ClusterId = "other-cluster"
+		}
+		if _, err := volumeManager.CreateVolume(ctx, &createSpec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	queryResults, err := fullSyncGetQueryResults(ctx, nil, clusterID, volumeManager, metadataSyncer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var volumes []cnstypes.CnsVolume
+	for _, queryResult := range queryResults {
+		volumes = append(volumes, queryResult.Volumes...)
+	}
+	if len(volumes) != 2 {
+		t.Fatalf("expected 2 volumes of cluster %s, got %+v", clusterID, volumes)
+	}
+
+	volumeManager.InjectError(unittestcommon.FakeOpQueryVolume, errors.New("injected CNS failure"))
+	if _, err = fullSyncGetQueryResults(ctx, nil, clusterID, volumeManager, metadataSyncer); status.Code(err) != codes.Internal {
+		t.Fatalf("expected fullSyncGetQueryResults to fail with code Internal, got %v", err)
+	}
+}
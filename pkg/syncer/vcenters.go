@@ -0,0 +1,273 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	cnstypes "github.com/vmware/govmomi/cns/types"
+	v1 "k8s.io/api/core/v1"
+
+	volumes "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/volume"
+	cnsvsphere "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/vsphere"
+	cnsconfig "sigs.k8s.io/vsphere-csi-driver/pkg/common/config"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/common/utils"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
+)
+
+// syncerVCenters holds the volume managers of the vCenters configured in
+// addition to the one of metadataSyncInformer.volumeManager, for vanilla
+// clusters spanning several vCenters. The vCenter of
+// metadataSyncInformer.volumeManager is the default one, the first of the
+// config secret.
+type syncerVCenters struct {
+	// defaultSyncer is the syncer of the default vCenter, the copies of
+	// getVCenterSyncers are made from.
+	defaultSyncer *metadataSyncInformer
+	// lock protects volumeManagers and vcConfigs.
+	lock sync.RWMutex
+	// volumeManagers has the volume managers of the additional vCenters, by host.
+	volumeManagers map[string]volumes.Manager
+	// vcConfigs has the configs of the additional vCenters, by host.
+	vcConfigs map[string]*cnsvsphere.VirtualCenterConfig
+	// volumeHosts caches the host of the vCenter of the volumes already
+	// looked up, by volume ID.
+	volumeHosts sync.Map
+}
+
+// registerSyncerVCenters registers and connects the vCenters of cfg other than
+// the one of metadataSyncer, and drops the additional vCenters no longer in
+// cfg. The volume managers of the vCenters whose host and credentials didn't
+// change are kept.
+func registerSyncerVCenters(ctx context.Context, metadataSyncer *metadataSyncInformer, cfg *cnsconfig.Config) error {
+	log := logger.GetLogger(ctx)
+	if metadataSyncer.clusterFlavor != cnstypes.CnsClusterFlavorVanilla {
+		return nil
+	}
+	vcConfigs, err := cnsvsphere.GetVirtualCenterConfigs(ctx, cfg)
+	if err != nil {
+		log.Errorf("failed to get VirtualCenterConfigs. err=%v", err)
+		return err
+	}
+	if metadataSyncer.vcenters == nil {
+		metadataSyncer.vcenters = &syncerVCenters{defaultSyncer: metadataSyncer}
+	}
+	metadataSyncer.vcenters.lock.RLock()
+	oldVolumeManagers := metadataSyncer.vcenters.volumeManagers
+	oldVCConfigs := metadataSyncer.vcenters.vcConfigs
+	metadataSyncer.vcenters.lock.RUnlock()
+
+	vcenterManager := cnsvsphere.GetVirtualCenterManager(ctx)
+	volumeManagers := make(map[string]volumes.Manager)
+	newVCConfigs := make(map[string]*cnsvsphere.VirtualCenterConfig)
+	for _, vcConfig := range vcConfigs {
+		if vcConfig.Host == metadataSyncer.host {
+			continue
+		}
+		if oldVCConfig, ok := oldVCConfigs[vcConfig.Host]; ok && oldVCConfig.Username == vcConfig.Username &&
+			oldVCConfig.Password == vcConfig.Password {
+			// The vCenter is gone if the default vCenter was reinitialized.
+			if vcenter, err := vcenterManager.GetVirtualCenter(ctx, vcConfig.Host); err == nil {
+				vcenter.Config = vcConfig
+				volumeManagers[vcConfig.Host] = oldVolumeManagers[vcConfig.Host]
+				newVCConfigs[vcConfig.Host] = vcConfig
+				continue
+			}
+		}
+		if err := vcenterManager.UnregisterVirtualCenter(ctx, vcConfig.Host); err != nil {
+			log.Errorf("failed to unregister vCenter %q. err=%v", vcConfig.Host, err)
+			return err
+		}
+		vcenter, err := vcenterManager.RegisterVirtualCenter(ctx, vcConfig)
+		if err != nil {
+			log.Errorf("failed to register vCenter %q with virtualCenterManager. err=%v", vcConfig.Host, err)
+			return err
+		}
+		if err = vcenter.Connect(ctx); err != nil {
+			log.Errorf("failed to connect to vCenter %q. err=%v", vcConfig.Host, err)
+			return err
+		}
+		log.Infof("Registered additional vCenter %q", vcConfig.Host)
+		volumeManagers[vcConfig.Host] = volumes.NewManager(ctx, vcenter)
+		newVCConfigs[vcConfig.Host] = vcConfig
+	}
+	for host := range oldVolumeManagers {
+		if _, ok := volumeManagers[host]; ok || host == metadataSyncer.host {
+			continue
+		}
+		log.Infof("Unregistering vCenter %q removed from the config", host)
+		if err := vcenterManager.UnregisterVirtualCenter(ctx, host); err != nil {
+			log.Warnf("failed to unregister vCenter %q. err=%v", host, err)
+		}
+	}
+	metadataSyncer.vcenters.lock.Lock()
+	metadataSyncer.vcenters.volumeManagers = volumeManagers
+	metadataSyncer.vcenters.vcConfigs = newVCConfigs
+	metadataSyncer.vcenters.lock.Unlock()
+	return nil
+}
+
+// getVCenterSyncers returns the syncer of the default vCenter, followed by
+// copies of it syncing the additional vCenters, sorted by host.
+func getVCenterSyncers(metadataSyncer *metadataSyncInformer) []*metadataSyncInformer {
+	if metadataSyncer.vcenters == nil {
+		return []*metadataSyncInformer{metadataSyncer}
+	}
+	defaultSyncer := metadataSyncer.vcenters.defaultSyncer
+	syncers := []*metadataSyncInformer{defaultSyncer}
+	metadataSyncer.vcenters.lock.RLock()
+	defer metadataSyncer.vcenters.lock.RUnlock()
+	hosts := make([]string, 0, len(metadataSyncer.vcenters.volumeManagers))
+	for host := range metadataSyncer.vcenters.volumeManagers {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		vcSyncer := *defaultSyncer
+		vcSyncer.host = host
+		vcSyncer.volumeManager = metadataSyncer.vcenters.volumeManagers[host]
+		syncers = append(syncers, &vcSyncer)
+	}
+	return syncers
+}
+
+// isDefaultVCenterSyncer returns true if metadataSyncer syncs the default
+// vCenter.
+func isDefaultVCenterSyncer(metadataSyncer *metadataSyncInformer) bool {
+	if metadataSyncer.vcenters == nil {
+		return true
+	}
+	metadataSyncer.vcenters.lock.RLock()
+	defer metadataSyncer.vcenters.lock.RUnlock()
+	_, ok := metadataSyncer.vcenters.volumeManagers[metadataSyncer.host]
+	return !ok
+}
+
+// getVCenterSyncerForVolume returns the syncer of getVCenterSyncers whose
+// vCenter has the volume in its CNS. The volumes not registered in any
+// vCenter, such as the ones of static PVs, are synced with the default vCenter.
+func getVCenterSyncerForVolume(ctx context.Context, metadataSyncer *metadataSyncInformer, volumeID string) (
+	*metadataSyncInformer, error) {
+	log := logger.GetLogger(ctx)
+	syncers := getVCenterSyncers(metadataSyncer)
+	if len(syncers) == 1 {
+		return syncers[0], nil
+	}
+	if host, ok := metadataSyncer.vcenters.volumeHosts.Load(volumeID); ok {
+		for _, vcSyncer := range syncers {
+			if vcSyncer.host == host.(string) {
+				return vcSyncer, nil
+			}
+		}
+		metadataSyncer.vcenters.volumeHosts.Delete(volumeID)
+	}
+	queryFilter := cnstypes.CnsQueryFilter{
+		VolumeIds: []cnstypes.CnsVolumeId{{Id: volumeID}},
+	}
+	querySelection := utils.QuerySelection(cnstypes.QuerySelectionNameTypeVolumeType)
+	for _, vcSyncer := range syncers {
+		queryResult, err := utils.QueryVolumeUtil(ctx, vcSyncer.volumeManager, queryFilter, querySelection)
+		if err != nil {
+			log.Errorf("failed to query volume %q in vCenter %q. err=%v", volumeID, vcSyncer.host, err)
+			return nil, err
+		}
+		if len(queryResult.Volumes) > 0 {
+			log.Debugf("Volume %q is in vCenter %q", volumeID, vcSyncer.host)
+			metadataSyncer.vcenters.volumeHosts.Store(volumeID, vcSyncer.host)
+			return vcSyncer, nil
+		}
+	}
+	log.Debugf("Volume %q wasn't found in any vCenter, syncing it with the default vCenter", volumeID)
+	return syncers[0], nil
+}
+
+// forgetVolumeVCenter forgets the vCenter of a deleted volume.
+func forgetVolumeVCenter(metadataSyncer *metadataSyncInformer, volumeID string) {
+	if metadataSyncer.vcenters != nil {
+		metadataSyncer.vcenters.volumeHosts.Delete(volumeID)
+	}
+}
+
+// getSyncerVCenter returns the vCenter metadataSyncer syncs.
+func getSyncerVCenter(ctx context.Context, metadataSyncer *metadataSyncInformer) (*cnsvsphere.VirtualCenter, error) {
+	if isDefaultVCenterSyncer(metadataSyncer) {
+		return cnsvsphere.GetVirtualCenterInstance(ctx, metadataSyncer.configInfo, false)
+	}
+	return cnsvsphere.GetVirtualCenterManager(ctx).GetVirtualCenter(ctx, metadataSyncer.host)
+}
+
+// getContainerCluster returns the container cluster of the volumes of the
+// vCenter metadataSyncer syncs.
+func getContainerCluster(metadataSyncer *metadataSyncInformer) cnstypes.CnsContainerCluster {
+	cfg := metadataSyncer.configInfo.Cfg
+	return cnsvsphere.GetContainerCluster(cfg.Global.ClusterID, cfg.VirtualCenter[metadataSyncer.host].User,
+		metadataSyncer.clusterFlavor, cfg.Global.ClusterDistribution)
+}
+
+// getPVsOfVCenter returns the PVs of pvs to sync with the CNS of the vCenter
+// of metadataSyncer, which has the given volumes: the PVs of its volumes, and
+// for the default vCenter also the PVs whose volumes are in no other vCenter,
+// such as static PVs to register and migrated in-tree vSphere volumes.
+func getPVsOfVCenter(ctx context.Context, metadataSyncer *metadataSyncInformer, pvs []*v1.PersistentVolume,
+	vcVolumes []cnstypes.CnsVolume) ([]*v1.PersistentVolume, error) {
+	log := logger.GetLogger(ctx)
+	syncers := getVCenterSyncers(metadataSyncer)
+	if len(syncers) == 1 {
+		return pvs, nil
+	}
+	volumeIDs := make(map[string]bool)
+	for _, volume := range vcVolumes {
+		volumeIDs[volume.VolumeId.Id] = true
+		metadataSyncer.vcenters.volumeHosts.Store(volume.VolumeId.Id, metadataSyncer.host)
+	}
+	isDefault := isDefaultVCenterSyncer(metadataSyncer)
+	otherVolumeIDs := make(map[string]bool)
+	if isDefault {
+		queryFilter := cnstypes.CnsQueryFilter{
+			ContainerClusterIds: []string{metadataSyncer.configInfo.Cfg.Global.ClusterID},
+		}
+		querySelection := utils.QuerySelection(cnstypes.QuerySelectionNameTypeVolumeType)
+		for _, vcSyncer := range syncers[1:] {
+			queryResult, err := utils.CachedQueryVolumeUtil(ctx, vcSyncer.volumeManager, queryFilter, querySelection)
+			if err != nil {
+				log.Errorf("failed to query the volumes in vCenter %q. err=%v", vcSyncer.host, err)
+				return nil, err
+			}
+			for _, volume := range queryResult.Volumes {
+				otherVolumeIDs[volume.VolumeId.Id] = true
+			}
+		}
+	}
+	var vcPVs []*v1.PersistentVolume
+	for _, pv := range pvs {
+		if pv.Spec.CSI == nil {
+			// Migrated in-tree vSphere volumes are only in the default vCenter.
+			if isDefault {
+				vcPVs = append(vcPVs, pv)
+			}
+			continue
+		}
+		volumeHandle := pv.Spec.CSI.VolumeHandle
+		if volumeIDs[volumeHandle] || (isDefault && !otherVolumeIDs[volumeHandle]) {
+			vcPVs = append(vcPVs, pv)
+		}
+	}
+	log.Debugf("%d of %d PVs are synced with vCenter %q", len(vcPVs), len(pvs), metadataSyncer.host)
+	return vcPVs, nil
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"testing"
+
+	cnstypes "github.com/vmware/govmomi/cns/types"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	volumes "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/volume"
+	cnsvsphere "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/vsphere"
+	cnsconfig "sigs.k8s.io/vsphere-csi-driver/pkg/common/config"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/common/unittestcommon"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/common"
+)
+
+// TestVCenterSyncers checks that the volumes of a cluster spanning two
+// vCenters are synced with the CNS of their vCenter, and that the default
+// vCenter syncs the PVs of the volumes in no vCenter.
+func TestVCenterSyncers(t *testing.T) {
+	const clusterID = "cluster-1"
+	ctx := context.Background()
+	firstVolumeManager := unittestcommon.NewFakeVolumeManager()
+	secondVolumeManager := unittestcommon.NewFakeVolumeManager()
+	cfg := &cnsconfig.Config{
+		VirtualCenter: map[string]*cnsconfig.VirtualCenterConfig{
+			"vc1.example.com": {User: "user-1"},
+			"vc2.example.com": {User: "user-2"},
+		},
+	}
+	cfg.Global.ClusterID = clusterID
+	metadataSyncer := &metadataSyncInformer{
+		clusterFlavor: cnstypes.CnsClusterFlavorVanilla,
+		host:          "vc1.example.com",
+		volumeManager: firstVolumeManager,
+		configInfo:    &cnsconfig.ConfigurationInfo{Cfg: cfg},
+	}
+	metadataSyncer.vcenters = &syncerVCenters{
+		defaultSyncer:  metadataSyncer,
+		volumeManagers: map[string]volumes.Manager{"vc2.example.com": secondVolumeManager},
+	}
+	createVolume := func(volumeManager *unittestcommon.FakeVolumeManager, name string) string {
+		volumeInfo, err := volumeManager.CreateVolume(ctx, &cnstypes.CnsVolumeCreateSpec{
+			Name:       name,
+			VolumeType: common.BlockVolumeType,
+			Metadata: cnstypes.CnsVolumeMetadata{
+				ContainerCluster: cnstypes.CnsContainerCluster{ClusterId: clusterID},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return volumeInfo.VolumeID.Id
+	}
+	firstVolumeID := createVolume(firstVolumeManager, "volume-1")
+	secondVolumeID := createVolume(secondVolumeManager, "volume-2")
+
+	syncers := getVCenterSyncers(metadataSyncer)
+	if len(syncers) != 2 || syncers[0] != metadataSyncer || syncers[1].host != "vc2.example.com" ||
+		syncers[1].volumeManager != secondVolumeManager {
+		t.Fatalf("expected the syncers of vc1.example.com and vc2.example.com, got %+v", syncers)
+	}
+	// The copies of the syncer find the same vCenters.
+	for _, syncer := range syncers {
+		for volumeID, host := range map[string]string{
+			firstVolumeID:  "vc1.example.com",
+			secondVolumeID: "vc2.example.com",
+			"static":       "vc1.example.com",
+		} {
+			vcSyncer, err := getVCenterSyncerForVolume(ctx, syncer, volumeID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if vcSyncer.host != host {
+				t.Errorf("expected volume %q in vCenter %q, got %q", volumeID, host, vcSyncer.host)
+			}
+		}
+	}
+
+	// Metadata is updated in the CNS of the volume, with the user of its vCenter.
+	pvMetadata := cnsvsphere.GetCnsKubernetesEntityMetaData("pv-2", nil, false,
+		string(cnstypes.CnsKubernetesEntityTypePV), "", clusterID, nil)
+	containerCluster := getContainerCluster(metadataSyncer)
+	updateSpec := &cnstypes.CnsVolumeMetadataUpdateSpec{
+		VolumeId: cnstypes.CnsVolumeId{Id: secondVolumeID},
+		Metadata: cnstypes.CnsVolumeMetadata{
+			ContainerCluster: containerCluster,
+			EntityMetadata:   []cnstypes.BaseCnsEntityMetadata{pvMetadata},
+		},
+	}
+	if err := updateVolumeMetadata(ctx, metadataSyncer, updateSpec); err != nil {
+		t.Fatal(err)
+	}
+	if volume := secondVolumeManager.GetVolume(secondVolumeID); len(volume.Metadata.EntityMetadata) != 1 {
+		t.Errorf("expected the metadata of volume %q to be updated in vc2.example.com, got %+v", secondVolumeID,
+			volume.Metadata)
+	}
+	if updateSpec.Metadata.ContainerCluster.VSphereUser != "user-2" {
+		t.Errorf("expected the container cluster of user-2, got %+v", updateSpec.Metadata.ContainerCluster)
+	}
+
+	// Each vCenter syncs the PVs of its volumes, the default one also the
+	// PVs of the volumes in no vCenter.
+	newPV := func(volumeHandle string) *v1.PersistentVolume {
+		return &v1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: "pv-" + volumeHandle},
+			Spec: v1.PersistentVolumeSpec{
+				PersistentVolumeSource: v1.PersistentVolumeSource{
+					CSI: &v1.CSIPersistentVolumeSource{VolumeHandle: volumeHandle},
+				},
+			},
+		}
+	}
+	pvs := []*v1.PersistentVolume{newPV(firstVolumeID), newPV(secondVolumeID), newPV("static")}
+	for i, vcVolumeIDs := range [][]string{{firstVolumeID, "static"}, {secondVolumeID}} {
+		vcVolumeManager := syncers[i].volumeManager.(*unittestcommon.FakeVolumeManager)
+		var vcVolumes []cnstypes.CnsVolume
+		for _, volumeID := range vcVolumeIDs {
+			if volume := vcVolumeManager.GetVolume(volumeID); volume != nil {
+				vcVolumes = append(vcVolumes, *volume)
+			}
+		}
+		vcPVs, err := getPVsOfVCenter(ctx, syncers[i], pvs, vcVolumes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(vcPVs) != len(vcVolumeIDs) {
+			t.Fatalf("expected %d PVs in vCenter %q, got %d", len(vcVolumeIDs), syncers[i].host, len(vcPVs))
+		}
+		for j, pv := range vcPVs {
+			if pv.Spec.CSI.VolumeHandle != vcVolumeIDs[j] {
+				t.Errorf("expected PV of volume %q in vCenter %q, got %q", vcVolumeIDs[j], syncers[i].host,
+					pv.Spec.CSI.VolumeHandle)
+			}
+		}
+	}
+}
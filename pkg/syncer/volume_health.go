@@ -18,6 +18,9 @@ package syncer
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
 	"time"
 
 	cnstypes "github.com/vmware/govmomi/cns/types"
@@ -25,43 +28,72 @@ import (
 	v1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
 	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
+	cnsconfig "sigs.k8s.io/vsphere-csi-driver/pkg/common/config"
 	"sigs.k8s.io/vsphere-csi-driver/pkg/common/utils"
 	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/common"
 	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
 )
 
-func csiGetVolumeHealthStatus(ctx context.Context, k8sclient clientset.Interface, metadataSyncer *metadataSyncInformer) {
+const (
+	// reasonVolumeInaccessible is the reason of the events emitted on the PV
+	// and PVC of a volume whose CNS health status turned red.
+	reasonVolumeInaccessible = "VolumeInaccessible"
+	// reasonVolumeDegraded is the reason of the events emitted on the PV and
+	// PVC of a volume whose CNS health status turned yellow.
+	reasonVolumeDegraded = "VolumeDegraded"
+	// reasonVolumeHealthy is the reason of the events emitted on the PV and
+	// PVC of a volume whose CNS health status turned green again.
+	reasonVolumeHealthy = "VolumeHealthy"
+)
+
+// volumeHealthStatuses has the last CNS health status of the volumes by ID,
+// events are only emitted when the health status of a volume changes.
+var volumeHealthStatuses = make(map[string]string)
+
+func csiGetVolumeHealthStatus(ctx context.Context, k8sclient clientset.Interface, metadataSyncer *metadataSyncInformer,
+	recorder record.EventRecorder) {
 	log := logger.GetLogger(ctx)
 	log.Infof("csiGetVolumeHealthStatus: start")
 
+	// Get K8s PVs in State "Bound"
+	k8sPVs, err := getBoundPVs(ctx, metadataSyncer)
+	if err != nil {
+		log.Errorf("csiGetVolumeHealthStatus: Failed to get PVs from kubernetes. Err: %+v", err)
+		return
+	}
+
 	//Call CNS QueryAll to get container volumes by cluster ID
-	queryFilter := cnstypes.CnsQueryFilter{
+	queryFilters := []cnstypes.CnsQueryFilter{{
 		ContainerClusterIds: []string{
 			metadataSyncer.configInfo.Cfg.Global.ClusterID,
 		},
+	}}
+	if metadataSyncer.shard.Sharded() {
+		// Only query the volumes of the PVs in the shard.
+		queryFilters = getShardQueryFilters(metadataSyncer, k8sPVs)
 	}
 
-	querySelection := cnstypes.CnsQuerySelection{
-		Names: []string{
-			string(cnstypes.QuerySelectionNameTypeHealthStatus),
-		},
-	}
-	queryResult, err := utils.QueryVolumeUtil(ctx, metadataSyncer.volumeManager, queryFilter, querySelection, metadataSyncer.coCommonInterface.IsFSSEnabled(ctx, common.AsyncQueryVolume))
-	if err != nil {
-		log.Error("csiGetVolumeHealthStatus: QueryVolume failed with err=%+v", err.Error())
-		return
-	}
-
-	// Get K8s PVs in State "Bound"
-	k8sPVs, err := getBoundPVs(ctx, metadataSyncer)
-	if err != nil {
-		log.Errorf("csiGetVolumeHealthStatus: Failed to get PVs from kubernetes. Err: %+v", err)
-		return
+	querySelection := utils.QuerySelection(cnstypes.QuerySelectionNameTypeHealthStatus)
+	var volumes []cnstypes.CnsVolume
+	for _, vcSyncer := range getVCenterSyncers(metadataSyncer) {
+		for _, queryFilter := range queryFilters {
+			queryResult, err := utils.CachedQueryVolumeUtil(ctx, vcSyncer.volumeManager, queryFilter, querySelection)
+			if err != nil {
+				log.Errorf("csiGetVolumeHealthStatus: QueryVolume failed in vCenter %q with err=%+v", vcSyncer.host,
+					err.Error())
+				return
+			}
+			volumes = append(volumes, queryResult.Volumes...)
+		}
 	}
 
 	// volumeHandleToPvcMap maps pv.Spec.CSI.VolumeHandle to the pvc object which bounded to the pv
 	volumeHandleToPvcMap := make(volumeHandlePVCMap, len(k8sPVs))
+	// volumeHandleToPVMap maps pv.Spec.CSI.VolumeHandle to the pv
+	volumeHandleToPVMap := make(map[string]*v1.PersistentVolume, len(k8sPVs))
 
 	for _, pv := range k8sPVs {
 		if pv.Spec.ClaimRef != nil && pv.Status.Phase == v1.VolumeBound {
@@ -71,13 +103,21 @@ func csiGetVolumeHealthStatus(ctx context.Context, k8sclient clientset.Interface
 					pv.Spec.ClaimRef.Namespace, pv.Spec.ClaimRef.Name, err)
 				continue
 			}
+			if !isVolumeHealthSyncedForNamespace(metadataSyncer.configInfo.Cfg, pvc.Namespace) {
+				log.Debugf("csiGetVolumeHealthStatus: skipping pvc %s/%s, its namespace is excluded from the volume health sync",
+					pvc.Namespace, pvc.Name)
+				continue
+			}
 			volumeHandleToPvcMap[pv.Spec.CSI.VolumeHandle] = pvc
+			volumeHandleToPVMap[pv.Spec.CSI.VolumeHandle] = pv
 			log.Debugf("csiGetVolumeHealthStatus: pvc %s/%s is backed by pv %s volumeHandle %s",
 				pvc.Namespace, pvc.Name, pv.Name, pv.Spec.CSI.VolumeHandle)
 		}
 	}
 
-	for _, vol := range queryResult.Volumes {
+	var patches []volumeHealthPatch
+	seenVolumeIDs := make(map[string]bool)
+	for _, vol := range volumes {
 		log.Debugf("Volume %q Health Status %q", vol.VolumeId.Id, vol.HealthStatus)
 
 		if pvc, ok := volumeHandleToPvcMap[vol.VolumeId.Id]; ok {
@@ -85,6 +125,9 @@ func csiGetVolumeHealthStatus(ctx context.Context, k8sclient clientset.Interface
 
 			// only update PVC health annotation if the HealthStatus of volume is not "unknown"
 			if vol.HealthStatus != string(pbmtypes.PbmHealthStatusForEntityUnknown) {
+				seenVolumeIDs[vol.VolumeId.Id] = true
+				recordVolumeHealthEvent(ctx, recorder, vol.VolumeId.Id, vol.HealthStatus,
+					volumeHandleToPVMap[vol.VolumeId.Id], pvc)
 				volHealthStatus, err := common.ConvertVolumeHealthStatus(vol.HealthStatus)
 				if err != nil {
 					log.Errorf("csiGetVolumeHealthStatus: invalid health status %q for volume %q", vol.HealthStatus, vol.VolumeId.Id)
@@ -95,40 +138,135 @@ func csiGetVolumeHealthStatus(ctx context.Context, k8sclient clientset.Interface
 					// VolumeHealth annotation on pvc is changed, set it to new value
 					log.Debugf("csiGetVolumeHealthStatus: update volume health annotation for pvc %s/%s from old value %s to new value %s",
 						pvc.Namespace, pvc.Name, val, volHealthStatus)
-					metav1.SetMetaDataAnnotation(&pvc.ObjectMeta, annVolumeHealth, volHealthStatus)
-					metav1.SetMetaDataAnnotation(&pvc.ObjectMeta, annVolumeHealthTS, time.Now().Format(time.UnixDate))
-					log.Infof("csiGetVolumeHealthStatus: set annotation for health to %s at time %s for pvc %s/%s", volHealthStatus, time.Now().Format(time.UnixDate), pvc.Namespace, pvc.Name)
-					_, err := k8sclient.CoreV1().PersistentVolumeClaims(pvc.Namespace).Update(ctx, pvc, metav1.UpdateOptions{})
-					if err != nil {
-						if apierrors.IsConflict(err) {
-							log.Debugf("csiGetVolumeHealthStatus: Failed to update pvc %s/%s with err:%+v, will retry the update",
-								pvc.Namespace, pvc.Name, err)
-							// pvc get from pvcLister may be stale, try to get updated pvc which bound to pv from API server
-							newPvc, err := k8sclient.CoreV1().PersistentVolumeClaims(pvc.Namespace).Get(ctx, pvc.Name, metav1.GetOptions{})
-							if err == nil {
-								log.Infof("csiGetVolumeHealthStatus: updating volume health annotation for pvc %s/%s which "+
-									"get from API server from old value %s to new value %s at time %s",
-									newPvc.Namespace, newPvc.Name, val, volHealthStatus, time.Now().Format(time.UnixDate))
-								metav1.SetMetaDataAnnotation(&newPvc.ObjectMeta, annVolumeHealth, volHealthStatus)
-								metav1.SetMetaDataAnnotation(&newPvc.ObjectMeta, annVolumeHealthTS, time.Now().Format(time.UnixDate))
-								_, err := k8sclient.CoreV1().PersistentVolumeClaims(newPvc.Namespace).Update(ctx, newPvc, metav1.UpdateOptions{})
-								if err != nil {
-									log.Errorf("csiGetVolumeHealthStatus: Failed to update pvc %s/%s with err:%+v",
-										newPvc.Namespace, newPvc.Name, err)
-								}
-							} else {
-								log.Errorf("csiGetVolumeHealthStatus: volume health annotation for pvc %s/%s is not updated because "+
-									"failed to get pvc from API server. err=%+v",
-									pvc.Namespace, pvc.Name, err)
-							}
-						} else {
-							log.Errorf("csiGetVolumeHealthStatus: Failed to update pvc %s/%s with err:%+v",
-								pvc.Namespace, pvc.Name, err)
-						}
-					}
+					patches = append(patches, volumeHealthPatch{namespace: pvc.Namespace, name: pvc.Name, health: volHealthStatus})
 				}
 			}
 		}
 	}
+	for volumeID := range volumeHealthStatuses {
+		if !seenVolumeIDs[volumeID] {
+			delete(volumeHealthStatuses, volumeID)
+		}
+	}
+	patchVolumeHealthAnnotations(ctx, k8sclient, patches)
 	log.Infof("GetVolumeHealthStatus: end")
 }
+
+// isVolumeHealthSyncedForNamespace returns whether the health of the volumes
+// of the PVCs in namespace is synced, from volume-health-include-namespaces and
+// volume-health-exclude-namespaces in the vSphere configuration.
+func isVolumeHealthSyncedForNamespace(cfg *cnsconfig.Config, namespace string) bool {
+	for _, excluded := range strings.Split(cfg.Global.VolumeHealthExcludeNamespaces, ",") {
+		if strings.TrimSpace(excluded) == namespace {
+			return false
+		}
+	}
+	included := false
+	for _, ns := range strings.Split(cfg.Global.VolumeHealthIncludeNamespaces, ",") {
+		if ns = strings.TrimSpace(ns); ns != "" {
+			if ns == namespace {
+				return true
+			}
+			included = true
+		}
+	}
+	return !included
+}
+
+// recordVolumeHealthEvent emits an event on the PV and PVC of the volume when
+// its CNS health status changes from the last one in volumeHealthStatuses.
+// When the syncer starts, the last health status is derived from the health
+// annotation of the PVC, so that volumes already annotated as inaccessible
+// don't emit events again.
+func recordVolumeHealthEvent(ctx context.Context, recorder record.EventRecorder, volumeID string, healthStatus string,
+	pv *v1.PersistentVolume, pvc *v1.PersistentVolumeClaim) {
+	log := logger.GetLogger(ctx)
+	lastHealthStatus, ok := volumeHealthStatuses[volumeID]
+	if !ok {
+		lastHealthStatus = string(pbmtypes.PbmHealthStatusForEntityGreen)
+		if pvc.Annotations[annVolumeHealth] == common.VolHealthStatusInaccessible {
+			lastHealthStatus = string(pbmtypes.PbmHealthStatusForEntityRed)
+		}
+	}
+	volumeHealthStatuses[volumeID] = healthStatus
+	if healthStatus == lastHealthStatus {
+		return
+	}
+	eventType, reason := v1.EventTypeWarning, reasonVolumeInaccessible
+	msg := fmt.Sprintf("Volume %q is inaccessible, CNS health status is %q", volumeID, healthStatus)
+	switch healthStatus {
+	case string(pbmtypes.PbmHealthStatusForEntityGreen):
+		eventType, reason = v1.EventTypeNormal, reasonVolumeHealthy
+		msg = fmt.Sprintf("Volume %q is healthy again, CNS health status is %q", volumeID, healthStatus)
+	case string(pbmtypes.PbmHealthStatusForEntityYellow):
+		reason = reasonVolumeDegraded
+		msg = fmt.Sprintf("Volume %q is degraded, CNS health status is %q", volumeID, healthStatus)
+	case "":
+		// The health status isn't set by SPBM when the volume doesn't exist anymore.
+		msg = fmt.Sprintf("Volume %q is inaccessible, CNS doesn't report its health status", volumeID)
+	}
+	if eventType == v1.EventTypeWarning {
+		log.Warnf("csiGetVolumeHealthStatus: %s", msg)
+	} else {
+		log.Infof("csiGetVolumeHealthStatus: %s", msg)
+	}
+	recorder.Event(pvc, eventType, reason, msg)
+	if pv != nil {
+		recorder.Event(pv, eventType, reason, msg)
+	}
+}
+
+// volumeHealthPatch is the volume health to set on the annotations of a PVC.
+type volumeHealthPatch struct {
+	namespace string
+	name      string
+	health    string
+}
+
+// patchVolumeHealthAnnotations sets the volume health annotations of the PVCs
+// with JSON merge patches, from up to volumeHealthWorkers goroutines. Patches
+// don't conflict with other updates of the PVCs, so the PVCs of the lister
+// are neither modified nor read again from the API server.
+func patchVolumeHealthAnnotations(ctx context.Context, k8sclient clientset.Interface, patches []volumeHealthPatch) {
+	log := logger.GetLogger(ctx)
+	if len(patches) == 0 {
+		return
+	}
+	timestamp := time.Now().Format(time.UnixDate)
+	runWorkerPool(volumeHealthWorkers, len(patches), func(i int) {
+		patch := patches[i]
+		if err := patchVolumeHealth(ctx, k8sclient, patch.namespace, patch.name, patch.health, timestamp); err != nil {
+			if apierrors.IsNotFound(err) {
+				log.Debugf("csiGetVolumeHealthStatus: pvc %s/%s is deleted, skipping volume health annotation update",
+					patch.namespace, patch.name)
+				return
+			}
+			log.Errorf("csiGetVolumeHealthStatus: Failed to patch pvc %s/%s with err:%+v", patch.namespace, patch.name, err)
+			return
+		}
+		log.Infof("csiGetVolumeHealthStatus: set annotation for health to %s at time %s for pvc %s/%s",
+			patch.health, timestamp, patch.namespace, patch.name)
+	})
+	log.Infof("csiGetVolumeHealthStatus: patched volume health annotations of %d pvcs", len(patches))
+}
+
+// patchVolumeHealth sets the volume health annotations of the PVC to health
+// and timestamp with a JSON merge patch.
+func patchVolumeHealth(ctx context.Context, k8sclient clientset.Interface, namespace string, name string,
+	health string, timestamp string) error {
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				annVolumeHealth:   health,
+				annVolumeHealthTS: timestamp,
+			},
+		},
+	}
+	patchBytes, err := json.Marshal(patch)
+	if err != nil {
+		return err
+	}
+	_, err = k8sclient.CoreV1().PersistentVolumeClaims(namespace).Patch(ctx, name, k8stypes.MergePatchType,
+		patchBytes, metav1.PatchOptions{})
+	return err
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	pbmtypes "github.com/vmware/govmomi/pbm/types"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+
+	cnsconfig "sigs.k8s.io/vsphere-csi-driver/pkg/common/config"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/common"
+)
+
+func TestPatchVolumeHealthAnnotations(t *testing.T) {
+	ctx := context.Background()
+	k8sclient := fake.NewSimpleClientset(
+		&v1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "ns",
+				Name:        "pvc1",
+				Annotations: map[string]string{"other": "value", annVolumeHealth: common.VolHealthStatusAccessible},
+			},
+		},
+		&v1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "pvc2"},
+		},
+	)
+	patchVolumeHealthAnnotations(ctx, k8sclient, []volumeHealthPatch{
+		{namespace: "ns", name: "pvc1", health: common.VolHealthStatusInaccessible},
+		// A deleted PVC doesn't prevent the other PVCs from being patched.
+		{namespace: "ns", name: "deleted", health: common.VolHealthStatusAccessible},
+		{namespace: "ns", name: "pvc2", health: common.VolHealthStatusAccessible},
+	})
+	for name, health := range map[string]string{
+		"pvc1": common.VolHealthStatusInaccessible,
+		"pvc2": common.VolHealthStatusAccessible,
+	} {
+		pvc, err := k8sclient.CoreV1().PersistentVolumeClaims("ns").Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pvc.Annotations[annVolumeHealth] != health {
+			t.Errorf("expected health annotation %q on pvc %s, got %q", health, name, pvc.Annotations[annVolumeHealth])
+		}
+		if pvc.Annotations[annVolumeHealthTS] == "" {
+			t.Errorf("expected health timestamp annotation on pvc %s", name)
+		}
+	}
+	pvc, err := k8sclient.CoreV1().PersistentVolumeClaims("ns").Get(ctx, "pvc1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pvc.Annotations["other"] != "value" {
+		t.Errorf("expected the other annotations of pvc1 to be kept, got %v", pvc.Annotations)
+	}
+}
+
+func TestRecordVolumeHealthEvent(t *testing.T) {
+	ctx := context.Background()
+	volumeHealthStatuses = make(map[string]string)
+	defer func() {
+		volumeHealthStatuses = make(map[string]string)
+	}()
+	pv := &v1.PersistentVolume{ObjectMeta: metav1.ObjectMeta{Name: "pv1"}}
+	pvc := &v1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "pvc1"}}
+	green := string(pbmtypes.PbmHealthStatusForEntityGreen)
+	yellow := string(pbmtypes.PbmHealthStatusForEntityYellow)
+	red := string(pbmtypes.PbmHealthStatusForEntityRed)
+	recorder := record.NewFakeRecorder(20)
+	for _, healthStatus := range []string{green, green, yellow, red, red, "", green} {
+		recordVolumeHealthEvent(ctx, recorder, "volume-1", healthStatus, pv, pvc)
+	}
+	// A PVC annotated as inaccessible when the syncer starts doesn't emit
+	// events again while the volume stays red.
+	inaccessiblePVC := &v1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{
+		Namespace:   "ns",
+		Name:        "pvc2",
+		Annotations: map[string]string{annVolumeHealth: common.VolHealthStatusInaccessible},
+	}}
+	recordVolumeHealthEvent(ctx, recorder, "volume-2", red, nil, inaccessiblePVC)
+	close(recorder.Events)
+
+	expected := []string{
+		v1.EventTypeWarning + " " + reasonVolumeDegraded,
+		v1.EventTypeWarning + " " + reasonVolumeInaccessible,
+		v1.EventTypeWarning + " " + reasonVolumeInaccessible,
+		v1.EventTypeNormal + " " + reasonVolumeHealthy,
+	}
+	var events []string
+	for event := range recorder.Events {
+		events = append(events, event)
+	}
+	// Each event is emitted on both the PVC and the PV.
+	if len(events) != 2*len(expected) {
+		t.Fatalf("expected %d events, got %v", 2*len(expected), events)
+	}
+	for i, prefix := range expected {
+		for _, event := range events[2*i : 2*i+2] {
+			if !strings.HasPrefix(event, prefix) || !strings.Contains(event, "volume-1") {
+				t.Errorf("expected event %q to start with %q", event, prefix)
+			}
+		}
+	}
+}
+
+func TestIsVolumeHealthSyncedForNamespace(t *testing.T) {
+	tests := []struct {
+		include   string
+		exclude   string
+		namespace string
+		synced    bool
+	}{
+		{namespace: "ns1", synced: true},
+		{include: "ns1, ns2", namespace: "ns2", synced: true},
+		{include: "ns1, ns2", namespace: "ns3", synced: false},
+		{exclude: "ns1, ns2", namespace: "ns2", synced: false},
+		{exclude: "ns1", namespace: "ns3", synced: true},
+		{include: "ns1", exclude: "ns1", namespace: "ns1", synced: false},
+		{include: " , ", namespace: "ns1", synced: true},
+	}
+	for _, test := range tests {
+		cfg := &cnsconfig.Config{}
+		cfg.Global.VolumeHealthIncludeNamespaces = test.include
+		cfg.Global.VolumeHealthExcludeNamespaces = test.exclude
+		if synced := isVolumeHealthSyncedForNamespace(cfg, test.namespace); synced != test.synced {
+			t.Errorf("expected namespace %q synced %v with include %q and exclude %q, got %v",
+				test.namespace, test.synced, test.include, test.exclude, synced)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	cnstypes "github.com/vmware/govmomi/cns/types"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cnsvolumeinventoryv1alpha1 "sigs.k8s.io/vsphere-csi-driver/pkg/apis/cnsoperator/cnsvolumeinventory/v1alpha1"
+	cnsvsphere "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/vsphere"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/common/utils"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/common"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
+	csitypes "sigs.k8s.io/vsphere-csi-driver/pkg/csi/types"
+)
+
+// defaultVolumeInventoryIntervalInMin is the default interval the inventory of
+// the volumes is exported at.
+const defaultVolumeInventoryIntervalInMin = 60
+
+// volumeInventoryUploadTimeout is the timeout of the upload of the inventory to
+// the object store endpoint.
+const volumeInventoryUploadTimeout = time.Minute
+
+// Formats the inventory is uploaded to the object store endpoint in.
+const (
+	volumeInventoryFormatJSON = "json"
+	volumeInventoryFormatCSV  = "csv"
+)
+
+// volumeInventoryCSVHeader is the header of the inventory in the CSV format.
+var volumeInventoryCSVHeader = []string{
+	"namespace", "pvcName", "pvName", "volumeID", "volumeType", "capacityInMb",
+	"datastoreURL", "storagePolicyID", "storagePolicyName", "healthStatus",
+}
+
+// getVolumeInventoryIntervalInMin returns the interval the inventory of the volumes is exported at.
+// If environment variable VOLUME_INVENTORY_INTERVAL_MINUTES is set and valid,
+// return the interval value read from environment variable
+// otherwise, use the default value 60 minutes
+func getVolumeInventoryIntervalInMin(ctx context.Context) int {
+	log := logger.GetLogger(ctx)
+	volumeInventoryIntervalInMin := defaultVolumeInventoryIntervalInMin
+	if v := os.Getenv("VOLUME_INVENTORY_INTERVAL_MINUTES"); v != "" {
+		if value, err := strconv.Atoi(v); err == nil && value > 0 {
+			volumeInventoryIntervalInMin = value
+			log.Infof("VolumeInventory: volume inventory interval is set to %d minutes", volumeInventoryIntervalInMin)
+		} else {
+			log.Warnf("VolumeInventory: volume inventory interval set in env variable VOLUME_INVENTORY_INTERVAL_MINUTES %s is invalid, will use the default interval", v)
+		}
+	}
+	return volumeInventoryIntervalInMin
+}
+
+// getVolumeInventoryFormat returns the format the inventory is uploaded to the object store endpoint in,
+// set by the environment variable VOLUME_INVENTORY_EXPORT_FORMAT, json by default.
+func getVolumeInventoryFormat(ctx context.Context) string {
+	log := logger.GetLogger(ctx)
+	switch v := os.Getenv("VOLUME_INVENTORY_EXPORT_FORMAT"); v {
+	case "", volumeInventoryFormatJSON:
+		return volumeInventoryFormatJSON
+	case volumeInventoryFormatCSV:
+		return volumeInventoryFormatCSV
+	default:
+		log.Warnf("VolumeInventory: format set in env variable VOLUME_INVENTORY_EXPORT_FORMAT %s is invalid, will use %s",
+			v, volumeInventoryFormatJSON)
+		return volumeInventoryFormatJSON
+	}
+}
+
+// csiExportVolumeInventory exports the inventory of the volumes of the cluster to the CnsVolumeInventory
+// instance and, if the environment variable VOLUME_INVENTORY_EXPORT_URL is set, uploads it to this object
+// store endpoint, such as a pre-signed URL of a bucket.
+func csiExportVolumeInventory(ctx context.Context, metadataSyncer *metadataSyncInformer, cnsOperatorClient client.Client) {
+	log := logger.GetLogger(ctx)
+	volumes, exportErr := getVolumeInventory(ctx, metadataSyncer)
+	if exportErr == nil {
+		if endpoint := os.Getenv("VOLUME_INVENTORY_EXPORT_URL"); endpoint != "" {
+			exportErr = uploadVolumeInventory(ctx, endpoint, getVolumeInventoryFormat(ctx), volumes)
+		}
+	}
+	if exportErr != nil {
+		log.Errorf("VolumeInventory: failed to export the volume inventory. Err: %v", exportErr)
+	}
+	if err := updateVolumeInventoryInstance(ctx, cnsOperatorClient, volumes, exportErr); err != nil {
+		log.Errorf("VolumeInventory: failed to update CnsVolumeInventory instance %q. Err: %v",
+			cnsvolumeinventoryv1alpha1.CnsVolumeInventoryCRName, err)
+		return
+	}
+	log.Infof("VolumeInventory: exported %d volumes", len(volumes))
+}
+
+// getVolumeInventory returns the inventory of the CNS volumes of the cluster.
+func getVolumeInventory(ctx context.Context, metadataSyncer *metadataSyncInformer) (
+	[]cnsvolumeinventoryv1alpha1.CnsVolumeInventoryEntry, error) {
+	queryFilter := cnstypes.CnsQueryFilter{
+		ContainerClusterIds: []string{
+			metadataSyncer.configInfo.Cfg.Global.ClusterID,
+		},
+	}
+	queryResult, err := utils.CachedQueryVolumeUtil(ctx, metadataSyncer.volumeManager, queryFilter, utils.QuerySelection())
+	if err != nil {
+		return nil, fmt.Errorf("QueryVolume failed. Err: %v", err)
+	}
+	pvs, err := metadataSyncer.pvLister.List(labels.Everything())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list PVs. Err: %v", err)
+	}
+	policyIDs := make(map[string]bool)
+	for _, volume := range queryResult.Volumes {
+		if volume.StoragePolicyId != "" {
+			policyIDs[volume.StoragePolicyId] = true
+		}
+	}
+	policyNames := make(map[string]string)
+	if len(policyIDs) > 0 {
+		vc, err := cnsvsphere.GetVirtualCenterInstance(ctx, metadataSyncer.configInfo, false)
+		if err != nil {
+			return nil, err
+		}
+		var ids []string
+		for id := range policyIDs {
+			ids = append(ids, id)
+		}
+		if policyNames, err = vc.PbmRetrievePolicyNames(ctx, ids); err != nil {
+			return nil, fmt.Errorf("failed to retrieve the names of the storage policies. Err: %v", err)
+		}
+	}
+	return buildVolumeInventory(ctx, queryResult.Volumes, pvs, policyNames), nil
+}
+
+// buildVolumeInventory returns the inventory of the CNS volumes, with the PVs and the PVCs of the volumes
+// and the names of their storage policies, sorted by namespace, PVC and volume ID.
+func buildVolumeInventory(ctx context.Context, volumes []cnstypes.CnsVolume, pvs []*v1.PersistentVolume,
+	policyNames map[string]string) []cnsvolumeinventoryv1alpha1.CnsVolumeInventoryEntry {
+	log := logger.GetLogger(ctx)
+	pvsByVolumeID := make(map[string]*v1.PersistentVolume)
+	for _, pv := range pvs {
+		if pv.Spec.CSI != nil && pv.Spec.CSI.Driver == csitypes.Name {
+			pvsByVolumeID[pv.Spec.CSI.VolumeHandle] = pv
+		}
+	}
+	entries := make([]cnsvolumeinventoryv1alpha1.CnsVolumeInventoryEntry, 0, len(volumes))
+	for _, volume := range volumes {
+		entry := cnsvolumeinventoryv1alpha1.CnsVolumeInventoryEntry{
+			VolumeID:          volume.VolumeId.Id,
+			VolumeType:        volume.VolumeType,
+			DatastoreURL:      volume.DatastoreUrl,
+			StoragePolicyID:   volume.StoragePolicyId,
+			StoragePolicyName: policyNames[volume.StoragePolicyId],
+		}
+		if volume.BackingObjectDetails != nil {
+			entry.CapacityInMb = volume.BackingObjectDetails.GetCnsBackingObjectDetails().CapacityInMb
+		}
+		if volume.HealthStatus != "" {
+			healthStatus, err := common.ConvertVolumeHealthStatus(volume.HealthStatus)
+			if err != nil {
+				log.Warnf("VolumeInventory: invalid health status %q for volume %q", volume.HealthStatus, volume.VolumeId.Id)
+			}
+			entry.HealthStatus = healthStatus
+		}
+		if pv, ok := pvsByVolumeID[volume.VolumeId.Id]; ok {
+			entry.PVName = pv.Name
+			if pv.Spec.ClaimRef != nil {
+				entry.Namespace = pv.Spec.ClaimRef.Namespace
+				entry.PVCName = pv.Spec.ClaimRef.Name
+			}
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Namespace != entries[j].Namespace {
+			return entries[i].Namespace < entries[j].Namespace
+		}
+		if entries[i].PVCName != entries[j].PVCName {
+			return entries[i].PVCName < entries[j].PVCName
+		}
+		return entries[i].VolumeID < entries[j].VolumeID
+	})
+	return entries
+}
+
+// formatVolumeInventory returns the inventory in the given format and its content type.
+func formatVolumeInventory(volumes []cnsvolumeinventoryv1alpha1.CnsVolumeInventoryEntry, format string) (
+	[]byte, string, error) {
+	if format != volumeInventoryFormatCSV {
+		data, err := json.Marshal(volumes)
+		return data, "application/json", err
+	}
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write(volumeInventoryCSVHeader); err != nil {
+		return nil, "", err
+	}
+	for _, volume := range volumes {
+		record := []string{
+			volume.Namespace, volume.PVCName, volume.PVName, volume.VolumeID, volume.VolumeType,
+			strconv.FormatInt(volume.CapacityInMb, 10), volume.DatastoreURL, volume.StoragePolicyID,
+			volume.StoragePolicyName, volume.HealthStatus,
+		}
+		if err := w.Write(record); err != nil {
+			return nil, "", err
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), "text/csv", w.Error()
+}
+
+// uploadVolumeInventory uploads the inventory in the given format to the object store endpoint with a PUT request.
+func uploadVolumeInventory(ctx context.Context, endpoint string, format string,
+	volumes []cnsvolumeinventoryv1alpha1.CnsVolumeInventoryEntry) error {
+	data, contentType, err := formatVolumeInventory(volumes, format)
+	if err != nil {
+		return fmt.Errorf("failed to format the volume inventory as %s. Err: %v", format, err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, volumeInventoryUploadTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to upload the volume inventory. Err: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("failed to upload the volume inventory, the endpoint returned %s", resp.Status)
+	}
+	return nil
+}
+
+// updateVolumeInventoryInstance saves the inventory and the error of the export, if any, in the
+// CnsVolumeInventory instance, creating it if it doesn't exist. The volumes of the instance are
+// kept when the inventory couldn't be built.
+func updateVolumeInventoryInstance(ctx context.Context, cnsOperatorClient client.Client,
+	volumes []cnsvolumeinventoryv1alpha1.CnsVolumeInventoryEntry, exportErr error) error {
+	instance := &cnsvolumeinventoryv1alpha1.CnsVolumeInventory{}
+	key := k8stypes.NamespacedName{Name: cnsvolumeinventoryv1alpha1.CnsVolumeInventoryCRName}
+	err := cnsOperatorClient.Get(ctx, key, instance)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	notFound := err != nil
+	instance.Name = cnsvolumeinventoryv1alpha1.CnsVolumeInventoryCRName
+	instance.Status.Error = ""
+	if exportErr != nil {
+		instance.Status.Error = exportErr.Error()
+	}
+	if volumes != nil {
+		now := metav1.Now()
+		instance.Status.LastExportTime = &now
+		instance.Status.Volumes = volumes
+	}
+	if notFound {
+		return cnsOperatorClient.Create(ctx, instance)
+	}
+	return cnsOperatorClient.Update(ctx, instance)
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	cnstypes "github.com/vmware/govmomi/cns/types"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	apis "sigs.k8s.io/vsphere-csi-driver/pkg/apis/cnsoperator"
+	cnsvolumeinventoryv1alpha1 "sigs.k8s.io/vsphere-csi-driver/pkg/apis/cnsoperator/cnsvolumeinventory/v1alpha1"
+	csitypes "sigs.k8s.io/vsphere-csi-driver/pkg/csi/types"
+)
+
+// TestBuildVolumeInventory checks that the volumes are exported with their PVCs and policy names.
+func TestBuildVolumeInventory(t *testing.T) {
+	ctx := context.Background()
+	volumes := []cnstypes.CnsVolume{
+		{
+			VolumeId:        cnstypes.CnsVolumeId{Id: "vol-2"},
+			VolumeType:      "BLOCK",
+			DatastoreUrl:    "ds:///vmfs/volumes/ds-1/",
+			StoragePolicyId: "policy-1",
+			HealthStatus:    "green",
+			BackingObjectDetails: &cnstypes.CnsBlockBackingDetails{
+				CnsBackingObjectDetails: cnstypes.CnsBackingObjectDetails{CapacityInMb: 1024},
+			},
+		},
+		// Volume without a PV.
+		{VolumeId: cnstypes.CnsVolumeId{Id: "vol-1"}, VolumeType: "FILE"},
+	}
+	pvs := []*v1.PersistentVolume{{
+		ObjectMeta: metav1.ObjectMeta{Name: "pv-2"},
+		Spec: v1.PersistentVolumeSpec{
+			PersistentVolumeSource: v1.PersistentVolumeSource{
+				CSI: &v1.CSIPersistentVolumeSource{Driver: csitypes.Name, VolumeHandle: "vol-2"},
+			},
+			ClaimRef: &v1.ObjectReference{Namespace: "ns-1", Name: "pvc-2"},
+		},
+	}}
+	entries := buildVolumeInventory(ctx, volumes, pvs, map[string]string{"policy-1": "gold"})
+	expected := []cnsvolumeinventoryv1alpha1.CnsVolumeInventoryEntry{
+		{VolumeID: "vol-1", VolumeType: "FILE"},
+		{
+			VolumeID:          "vol-2",
+			VolumeType:        "BLOCK",
+			PVName:            "pv-2",
+			Namespace:         "ns-1",
+			PVCName:           "pvc-2",
+			CapacityInMb:      1024,
+			DatastoreURL:      "ds:///vmfs/volumes/ds-1/",
+			StoragePolicyID:   "policy-1",
+			StoragePolicyName: "gold",
+			HealthStatus:      "accessible",
+		},
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("expected %d volumes, got %+v", len(expected), entries)
+	}
+	for i := range expected {
+		if entries[i] != expected[i] {
+			t.Errorf("expected %+v, got %+v", expected[i], entries[i])
+		}
+	}
+}
+
+// TestUploadVolumeInventory checks that the inventory is uploaded as CSV to the endpoint.
+func TestUploadVolumeInventory(t *testing.T) {
+	var body, contentType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		data, _ := ioutil.ReadAll(r.Body)
+		body, contentType = string(data), r.Header.Get("Content-Type")
+	}))
+	defer server.Close()
+
+	volumes := []cnsvolumeinventoryv1alpha1.CnsVolumeInventoryEntry{
+		{VolumeID: "vol-1", VolumeType: "BLOCK", Namespace: "ns-1", PVCName: "pvc-1", CapacityInMb: 10},
+	}
+	if err := uploadVolumeInventory(context.Background(), server.URL, volumeInventoryFormatCSV, volumes); err != nil {
+		t.Fatal(err)
+	}
+	expected := "namespace,pvcName,pvName,volumeID,volumeType,capacityInMb,datastoreURL,storagePolicyID," +
+		"storagePolicyName,healthStatus\nns-1,pvc-1,,vol-1,BLOCK,10,,,,\n"
+	if body != expected || contentType != "text/csv" {
+		t.Errorf("expected CSV %q, got %q of type %q", expected, body, contentType)
+	}
+}
+
+// TestUpdateVolumeInventoryInstance checks that the CnsVolumeInventory instance is created, and that its
+// volumes are kept when the inventory couldn't be built.
+func TestUpdateVolumeInventoryInstance(t *testing.T) {
+	ctx := context.Background()
+	s := runtime.NewScheme()
+	if err := apis.AddToSchemes.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	c := fake.NewFakeClientWithScheme(s)
+	key := k8stypes.NamespacedName{Name: cnsvolumeinventoryv1alpha1.CnsVolumeInventoryCRName}
+	volumes := []cnsvolumeinventoryv1alpha1.CnsVolumeInventoryEntry{{VolumeID: "vol-1", VolumeType: "BLOCK"}}
+	if err := updateVolumeInventoryInstance(ctx, c, volumes, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := updateVolumeInventoryInstance(ctx, c, nil, errors.New("QueryVolume failed")); err != nil {
+		t.Fatal(err)
+	}
+	instance := &cnsvolumeinventoryv1alpha1.CnsVolumeInventory{}
+	if err := c.Get(ctx, key, instance); err != nil {
+		t.Fatal(err)
+	}
+	if len(instance.Status.Volumes) != 1 || instance.Status.LastExportTime == nil ||
+		instance.Status.Error != "QueryVolume failed" {
+		t.Errorf("unexpected status %+v", instance.Status)
+	}
+}
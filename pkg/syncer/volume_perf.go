@@ -0,0 +1,265 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/performance"
+	vim25types "github.com/vmware/govmomi/vim25/types"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	cnsvsphere "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/vsphere"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/common/prometheus"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
+	csitypes "sigs.k8s.io/vsphere-csi-driver/pkg/csi/types"
+	k8s "sigs.k8s.io/vsphere-csi-driver/pkg/kubernetes"
+)
+
+// defaultVolumePerfIntervalInMin is the default interval the performance
+// stats of the volumes are collected at.
+const defaultVolumePerfIntervalInMin = 1
+
+// realtimePerfInterval is the interval in seconds of the realtime
+// performance stats of vCenter.
+const realtimePerfInterval = 20
+
+// Performance counters of the virtual disks of a VM, by instance such as
+// "scsi0:1". Rates are averaged over the sample interval, in KB for the
+// throughput.
+const (
+	perfCounterReadIOPS        = "virtualDisk.numberReadAveraged.average"
+	perfCounterWriteIOPS       = "virtualDisk.numberWriteAveraged.average"
+	perfCounterReadThroughput  = "virtualDisk.read.average"
+	perfCounterWriteThroughput = "virtualDisk.write.average"
+)
+
+// volumePerfCounters are the performance counters collected for the volumes.
+var volumePerfCounters = []string{
+	perfCounterReadIOPS, perfCounterWriteIOPS, perfCounterReadThroughput, perfCounterWriteThroughput,
+}
+
+// getVolumePerfIntervalInMin returns the interval the performance stats of the volumes are collected at.
+// If environment variable VOLUME_PERF_INTERVAL_MINUTES is set and valid,
+// return the interval value read from environment variable
+// otherwise, use the default value 1 minute
+func getVolumePerfIntervalInMin(ctx context.Context) int {
+	log := logger.GetLogger(ctx)
+	volumePerfIntervalInMin := defaultVolumePerfIntervalInMin
+	if v := os.Getenv("VOLUME_PERF_INTERVAL_MINUTES"); v != "" {
+		if value, err := strconv.Atoi(v); err == nil && value > 0 {
+			volumePerfIntervalInMin = value
+			log.Infof("VolumePerf: volume performance interval is set to %d minutes", volumePerfIntervalInMin)
+		} else {
+			log.Warnf("VolumePerf: volume performance interval set in env variable VOLUME_PERF_INTERVAL_MINUTES %s is invalid, will use the default interval", v)
+		}
+	}
+	return volumePerfIntervalInMin
+}
+
+// csiCollectVolumePerf exports the IOPS and throughput of the volumes bound
+// to PVCs and attached to the node VMs, from the realtime performance stats
+// of the virtual disks of the VMs in each vCenter.
+func csiCollectVolumePerf(ctx context.Context, metadataSyncer *metadataSyncInformer) {
+	log := logger.GetLogger(ctx)
+	pvs, err := metadataSyncer.pvLister.List(labels.Everything())
+	if err != nil {
+		log.Errorf("VolumePerf: failed to list PVs. Err: %+v", err)
+		return
+	}
+	pvcsByVolumeID := make(map[string]*v1.ObjectReference)
+	for _, pv := range pvs {
+		if pv.Spec.CSI != nil && pv.Spec.CSI.Driver == csitypes.Name && pv.Spec.ClaimRef != nil {
+			pvcsByVolumeID[pv.Spec.CSI.VolumeHandle] = pv.Spec.ClaimRef
+		}
+	}
+	nodes, err := metadataSyncer.nodeLister.List(labels.Everything())
+	if err != nil {
+		log.Errorf("VolumePerf: failed to list nodes. Err: %+v", err)
+		return
+	}
+
+	// The VMs of each vCenter are queried for their performance stats at once.
+	vmRefsByHost := make(map[string][]vim25types.ManagedObjectReference)
+	volumeIDsByVM := make(map[string]map[string]string)
+	for _, node := range nodes {
+		vm, err := cnsvsphere.GetVirtualMachineByUUID(ctx, k8s.GetNodeUUID(node), false)
+		if err != nil {
+			log.Warnf("VolumePerf: failed to get VM of node %q. err=%v", node.Name, err)
+			continue
+		}
+		devices, err := vm.Device(ctx)
+		if err != nil {
+			log.Warnf("VolumePerf: failed to get devices of VM %v of node %q. err=%v", vm, node.Name, err)
+			continue
+		}
+		volumeIDsByInstance := getVolumeDiskInstances(devices, pvcsByVolumeID)
+		if len(volumeIDsByInstance) == 0 {
+			continue
+		}
+		vmRefsByHost[vm.VirtualCenterHost] = append(vmRefsByHost[vm.VirtualCenterHost], vm.Reference())
+		volumeIDsByVM[vm.VirtualCenterHost+"/"+vm.Reference().Value] = volumeIDsByInstance
+	}
+	values := make(map[volumePerfKey]float64)
+	for _, vcSyncer := range getVCenterSyncers(metadataSyncer) {
+		vmRefs := vmRefsByHost[vcSyncer.host]
+		if len(vmRefs) == 0 {
+			continue
+		}
+		// The metrics of the volumes of a vCenter failing to return the
+		// stats are deleted, the other vCenters are still collected.
+		err := getVCenterVolumePerfValues(ctx, vcSyncer, vmRefs, volumeIDsByVM, pvcsByVolumeID, values)
+		if err != nil {
+			log.Errorf("VolumePerf: failed to get performance stats of the node VMs of vCenter %q. err=%v",
+				vcSyncer.host, err)
+		}
+	}
+	exportVolumePerfMetrics(values)
+}
+
+// getVCenterVolumePerfValues adds the latest sample of the performance stats
+// of the virtual disks of the volumes of the node VMs vmRefs, in the vCenter
+// of metadataSyncer, to values. volumeIDsByVM has the volume IDs by instance
+// of the VMs, keyed by vCenter host and VM reference.
+func getVCenterVolumePerfValues(ctx context.Context, metadataSyncer *metadataSyncInformer,
+	vmRefs []vim25types.ManagedObjectReference, volumeIDsByVM map[string]map[string]string,
+	pvcsByVolumeID map[string]*v1.ObjectReference, values map[volumePerfKey]float64) error {
+	vcenter, err := getSyncerVCenter(ctx, metadataSyncer)
+	if err != nil {
+		return err
+	}
+	perfManager := performance.NewManager(vcenter.Client.Client)
+	spec := vim25types.PerfQuerySpec{
+		MaxSample:  1,
+		IntervalId: realtimePerfInterval,
+		MetricId:   []vim25types.PerfMetricId{{Instance: "*"}},
+	}
+	samples, err := perfManager.SampleByName(ctx, spec, volumePerfCounters, vmRefs)
+	if err != nil {
+		return err
+	}
+	entityMetrics, err := perfManager.ToMetricSeries(ctx, samples)
+	if err != nil {
+		return err
+	}
+	for _, entityMetric := range entityMetrics {
+		volumeIDsByInstance, ok := volumeIDsByVM[metadataSyncer.host+"/"+entityMetric.Entity.Value]
+		if !ok {
+			continue
+		}
+		getVolumePerfValues(entityMetric.Value, volumeIDsByInstance, pvcsByVolumeID, values)
+	}
+	return nil
+}
+
+// getVolumeDiskInstances returns the IDs of the volumes in pvcsByVolumeID
+// among the virtual disks of a VM, by the instance name of the virtual disks
+// in the performance stats, such as "scsi0:1" or "nvme0:1".
+func getVolumeDiskInstances(devices object.VirtualDeviceList,
+	pvcsByVolumeID map[string]*v1.ObjectReference) map[string]string {
+	volumeIDsByInstance := make(map[string]string)
+	for _, device := range devices {
+		disk, ok := device.(*vim25types.VirtualDisk)
+		if !ok || disk.VDiskId == nil || pvcsByVolumeID[disk.VDiskId.Id] == nil || disk.UnitNumber == nil {
+			continue
+		}
+		var instance string
+		switch controller := devices.FindByKey(disk.ControllerKey).(type) {
+		case vim25types.BaseVirtualSCSIController:
+			instance = fmt.Sprintf("scsi%d:%d", controller.GetVirtualSCSIController().BusNumber, *disk.UnitNumber)
+		case *vim25types.VirtualNVMEController:
+			instance = fmt.Sprintf("nvme%d:%d", controller.BusNumber, *disk.UnitNumber)
+		default:
+			continue
+		}
+		volumeIDsByInstance[instance] = disk.VDiskId.Id
+	}
+	return volumeIDsByInstance
+}
+
+// volumePerfKey identifies a performance metric of a volume.
+type volumePerfKey struct {
+	// counter is the performance counter of the metric.
+	counter   string
+	namespace string
+	pvc       string
+	volumeID  string
+}
+
+// exportedVolumePerfKeys has the performance metrics of the volumes exported
+// by the last collection.
+var exportedVolumePerfKeys = make(map[volumePerfKey]bool)
+
+// getVolumePerfValues adds the latest sample of the performance stats of the
+// virtual disks of the volumes to values.
+func getVolumePerfValues(series []performance.MetricSeries, volumeIDsByInstance map[string]string,
+	pvcsByVolumeID map[string]*v1.ObjectReference, values map[volumePerfKey]float64) {
+	for _, s := range series {
+		volumeID, ok := volumeIDsByInstance[s.Instance]
+		if !ok || len(s.Value) == 0 {
+			continue
+		}
+		pvc := pvcsByVolumeID[volumeID]
+		key := volumePerfKey{counter: s.Name, namespace: pvc.Namespace, pvc: pvc.Name, volumeID: volumeID}
+		values[key] = float64(s.Value[len(s.Value)-1])
+	}
+}
+
+// exportVolumePerfMetrics replaces the exported performance metrics of the
+// volumes with values. The metrics of the volumes in values are updated in
+// place, and the metrics of the other volumes are deleted afterwards, so that
+// scrapes during a collection see the metrics of the last collection.
+func exportVolumePerfMetrics(values map[volumePerfKey]float64) {
+	exported := make(map[volumePerfKey]bool)
+	for key, value := range values {
+		gauge, operation, scale := getVolumePerfGauge(key.counter)
+		if gauge == nil {
+			continue
+		}
+		gauge.WithLabelValues(key.namespace, key.pvc, key.volumeID, operation).Set(value * scale)
+		exported[key] = true
+	}
+	for key := range exportedVolumePerfKeys {
+		if !exported[key] {
+			gauge, operation, _ := getVolumePerfGauge(key.counter)
+			gauge.DeleteLabelValues(key.namespace, key.pvc, key.volumeID, operation)
+		}
+	}
+	exportedVolumePerfKeys = exported
+}
+
+// getVolumePerfGauge returns the gauge, the operation label and the scale to
+// bytes of the performance counter, or nil if it isn't exported.
+func getVolumePerfGauge(counter string) (*prom.GaugeVec, string, float64) {
+	switch counter {
+	case perfCounterReadIOPS:
+		return prometheus.VolumeIOPS, "read", 1
+	case perfCounterWriteIOPS:
+		return prometheus.VolumeIOPS, "write", 1
+	case perfCounterReadThroughput:
+		return prometheus.VolumeThroughputBytes, "read", 1024
+	case perfCounterWriteThroughput:
+		return prometheus.VolumeThroughputBytes, "write", 1024
+	}
+	return nil, "", 0
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/performance"
+	vim25types "github.com/vmware/govmomi/vim25/types"
+	v1 "k8s.io/api/core/v1"
+
+	"sigs.k8s.io/vsphere-csi-driver/pkg/common/prometheus"
+)
+
+// TestVolumePerfMetrics checks that the performance stats of the virtual disks
+// of the volumes are exported with the PVCs of the volumes.
+func TestVolumePerfMetrics(t *testing.T) {
+	defer prometheus.VolumeIOPS.Reset()
+	defer prometheus.VolumeThroughputBytes.Reset()
+	defer func() { exportedVolumePerfKeys = make(map[volumePerfKey]bool) }()
+
+	unit := func(n int32) *int32 { return &n }
+	controller := &vim25types.ParaVirtualSCSIController{}
+	controller.Key = 1000
+	controller.BusNumber = 1
+	nvmeController := &vim25types.VirtualNVMEController{}
+	nvmeController.Key = 31000
+	nvmeController.BusNumber = 0
+	devices := object.VirtualDeviceList{
+		controller,
+		nvmeController,
+		// Volume bound to a PVC.
+		&vim25types.VirtualDisk{
+			VirtualDevice: vim25types.VirtualDevice{ControllerKey: 1000, UnitNumber: unit(2)},
+			VDiskId:       &vim25types.ID{Id: "vol-1"},
+		},
+		// Volume bound to a PVC on an NVMe controller.
+		&vim25types.VirtualDisk{
+			VirtualDevice: vim25types.VirtualDevice{ControllerKey: 31000, UnitNumber: unit(1)},
+			VDiskId:       &vim25types.ID{Id: "vol-2"},
+		},
+		// Boot disk of the VM.
+		&vim25types.VirtualDisk{
+			VirtualDevice: vim25types.VirtualDevice{ControllerKey: 1000, UnitNumber: unit(0)},
+		},
+	}
+	pvcsByVolumeID := map[string]*v1.ObjectReference{
+		"vol-1": {Namespace: "ns-1", Name: "pvc-1"},
+		"vol-2": {Namespace: "ns-1", Name: "pvc-2"},
+	}
+	volumeIDsByInstance := getVolumeDiskInstances(devices, pvcsByVolumeID)
+	if len(volumeIDsByInstance) != 2 || volumeIDsByInstance["scsi1:2"] != "vol-1" ||
+		volumeIDsByInstance["nvme0:1"] != "vol-2" {
+		t.Fatalf("expected vol-1 on instance scsi1:2 and vol-2 on instance nvme0:1, got %v", volumeIDsByInstance)
+	}
+
+	values := make(map[volumePerfKey]float64)
+	getVolumePerfValues([]performance.MetricSeries{
+		{Name: perfCounterReadIOPS, Instance: "scsi1:2", Value: []int64{10, 20}},
+		{Name: perfCounterWriteThroughput, Instance: "scsi1:2", Value: []int64{4}},
+		{Name: perfCounterReadIOPS, Instance: "nvme0:1", Value: []int64{5}},
+		{Name: perfCounterReadIOPS, Instance: "scsi1:0", Value: []int64{100}},
+	}, volumeIDsByInstance, pvcsByVolumeID, values)
+	exportVolumePerfMetrics(values)
+	if value := testutil.ToFloat64(prometheus.VolumeIOPS.WithLabelValues("ns-1", "pvc-1", "vol-1", "read")); value != 20 {
+		t.Errorf("expected 20 read IOPS from the latest sample, got %v", value)
+	}
+	if value := testutil.ToFloat64(
+		prometheus.VolumeThroughputBytes.WithLabelValues("ns-1", "pvc-1", "vol-1", "write")); value != 4096 {
+		t.Errorf("expected a write throughput of 4096 bytes per second, got %v", value)
+	}
+	if value := testutil.ToFloat64(prometheus.VolumeIOPS.WithLabelValues("ns-1", "pvc-2", "vol-2", "read")); value != 5 {
+		t.Errorf("expected 5 read IOPS of the NVMe disk, got %v", value)
+	}
+	if count := testutil.CollectAndCount(prometheus.VolumeIOPS); count != 2 {
+		t.Errorf("expected IOPS of the volumes only, got %d series", count)
+	}
+
+	// The metrics of the volumes missing in the next collection are deleted.
+	values = make(map[volumePerfKey]float64)
+	getVolumePerfValues([]performance.MetricSeries{
+		{Name: perfCounterReadIOPS, Instance: "scsi1:2", Value: []int64{30}},
+	}, volumeIDsByInstance, pvcsByVolumeID, values)
+	exportVolumePerfMetrics(values)
+	if value := testutil.ToFloat64(prometheus.VolumeIOPS.WithLabelValues("ns-1", "pvc-1", "vol-1", "read")); value != 30 {
+		t.Errorf("expected 30 read IOPS from the next collection, got %v", value)
+	}
+	if count := testutil.CollectAndCount(prometheus.VolumeIOPS); count != 1 {
+		t.Errorf("expected IOPS of vol-1 only, got %d series", count)
+	}
+	if count := testutil.CollectAndCount(prometheus.VolumeThroughputBytes); count != 0 {
+		t.Errorf("expected no throughput series, got %d series", count)
+	}
+}
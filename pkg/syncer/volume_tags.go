@@ -0,0 +1,166 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	volumes "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/volume"
+	cnsvsphere "sigs.k8s.io/vsphere-csi-driver/pkg/common/cns-lib/vsphere"
+	"sigs.k8s.io/vsphere-csi-driver/pkg/csi/service/logger"
+)
+
+const (
+	// volumeTagsRetryIntervalStart is the first retry interval of the tags of
+	// a volume.
+	volumeTagsRetryIntervalStart = time.Second
+	// volumeTagsRetryIntervalMax is the max retry interval of the tags of a
+	// volume.
+	volumeTagsRetryIntervalMax = 5 * time.Minute
+	// volumeTagsWorkers is the number of workers syncing the volume tags.
+	volumeTagsWorkers = 4
+)
+
+// getVolumeTagCategories returns the label keys mirrored as vSphere tags on
+// the FCDs, set with volume-tag-labels in the vSphere configuration.
+func getVolumeTagCategories(metadataSyncer *metadataSyncInformer) []string {
+	var categories []string
+	for _, key := range strings.Split(metadataSyncer.configInfo.Cfg.Global.VolumeTagLabels, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			categories = append(categories, key)
+		}
+	}
+	return categories
+}
+
+// getVolumeTags returns the tag of each category to attach to the FCD of the
+// PV bound to the PVC, from the labels of the PV and of the PVC, if any.
+func getVolumeTags(categories []string, pv *v1.PersistentVolume, pvc *v1.PersistentVolumeClaim) map[string]string {
+	volumeTags := make(map[string]string)
+	for _, category := range categories {
+		if value, ok := pv.Labels[category]; ok && value != "" {
+			volumeTags[category] = value
+		}
+		if pvc == nil {
+			continue
+		}
+		if value, ok := pvc.Labels[category]; ok && value != "" {
+			volumeTags[category] = value
+		}
+	}
+	return volumeTags
+}
+
+// enqueueVolumeTags queues the PV for its labels, and the ones of the PVC
+// bound to it, to be mirrored as vSphere tags on the FCD of the volume, if
+// volume-tag-labels is set. File volumes aren't backed by FCDs and are skipped.
+func enqueueVolumeTags(metadataSyncer *metadataSyncInformer, pv *v1.PersistentVolume) {
+	if metadataSyncer.volumeTagsQueue == nil || len(getVolumeTagCategories(metadataSyncer)) == 0 ||
+		pv.Spec.CSI == nil || IsMultiAttachAllowed(pv) {
+		return
+	}
+	metadataSyncer.volumeTagsQueue.Add(pv.Name)
+}
+
+// runVolumeTagsWorkers syncs the tags of the PVs of volumeTagsQueue with
+// volumeTagsWorkers workers, retrying the ones that failed with backoff, until
+// ctx is done.
+func runVolumeTagsWorkers(ctx context.Context, metadataSyncer *metadataSyncInformer) {
+	log := logger.GetLogger(ctx)
+	defer metadataSyncer.volumeTagsQueue.ShutDown()
+	log.Infof("Starting %d volume tags workers", volumeTagsWorkers)
+	for i := 0; i < volumeTagsWorkers; i++ {
+		go wait.Until(func() {
+			for processNextVolumeTags(ctx, metadataSyncer) {
+			}
+		}, time.Second, ctx.Done())
+	}
+	<-ctx.Done()
+	log.Infof("Stopping volume tags workers")
+}
+
+// processNextVolumeTags syncs the tags of the next PV of volumeTagsQueue, and
+// returns false once the queue is shut down.
+func processNextVolumeTags(ctx context.Context, metadataSyncer *metadataSyncInformer) bool {
+	key, quit := metadataSyncer.volumeTagsQueue.Get()
+	if quit {
+		return false
+	}
+	defer metadataSyncer.volumeTagsQueue.Done(key)
+	if err := syncVolumeTags(ctx, key.(string), metadataSyncer); err != nil {
+		logger.GetLogger(ctx).Errorf("VolumeTags: failed to sync the tags of PV %s, will retry. Err: %v", key, err)
+		metadataSyncer.volumeTagsQueue.AddRateLimited(key)
+		return true
+	}
+	metadataSyncer.volumeTagsQueue.Forget(key)
+	return true
+}
+
+// syncVolumeTags mirrors the labels of the PV and of the PVC bound to it as
+// vSphere tags on the FCD of the volume. The tagging API is called with the
+// cached REST session of the vCenter.
+func syncVolumeTags(ctx context.Context, pvName string, metadataSyncer *metadataSyncInformer) error {
+	log := logger.GetLogger(ctx)
+	categories := getVolumeTagCategories(metadataSyncer)
+	if len(categories) == 0 {
+		return nil
+	}
+	pv, err := metadataSyncer.pvLister.Get(pvName)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			log.Debugf("VolumeTags: PV %s not found, skipping", pvName)
+			return nil
+		}
+		return err
+	}
+	if pv.Spec.CSI == nil || IsMultiAttachAllowed(pv) {
+		return nil
+	}
+	var pvc *v1.PersistentVolumeClaim
+	if pv.Spec.ClaimRef != nil {
+		pvc, err = metadataSyncer.pvcLister.PersistentVolumeClaims(pv.Spec.ClaimRef.Namespace).Get(pv.Spec.ClaimRef.Name)
+		if err != nil {
+			if !apierrors.IsNotFound(err) {
+				return err
+			}
+			log.Debugf("VolumeTags: PVC %s/%s of PV %s not found", pv.Spec.ClaimRef.Namespace, pv.Spec.ClaimRef.Name,
+				pv.Name)
+			pvc = nil
+		}
+	}
+	vcenter, err := cnsvsphere.GetVirtualCenterInstance(ctx, metadataSyncer.configInfo, false)
+	if err != nil {
+		return fmt.Errorf("failed to get vcenter. err: %v", err)
+	}
+	tagManager, err := cnsvsphere.GetCachedTagManager(ctx, vcenter)
+	if err != nil {
+		return fmt.Errorf("failed to get tagManager. err: %v", err)
+	}
+	volumeTags := getVolumeTags(categories, pv, pvc)
+	if err := volumes.SetVolumeTags(ctx, vcenter.Client.Client, tagManager, pv.Spec.CSI.VolumeHandle, categories,
+		volumeTags); err != nil {
+		return fmt.Errorf("failed to set tags %v on volume %q. err: %v", volumeTags, pv.Spec.CSI.VolumeHandle, err)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/workqueue"
+
+	cnsconfig "sigs.k8s.io/vsphere-csi-driver/pkg/common/config"
+)
+
+// TestGetVolumeTags checks that only the allowed labels are mirrored as tags,
+// the ones of the PVC taking precedence over the ones of the PV.
+func TestGetVolumeTags(t *testing.T) {
+	cfg := &cnsconfig.Config{}
+	cfg.Global.VolumeTagLabels = " app, team,,cost-center "
+	categories := getVolumeTagCategories(&metadataSyncInformer{configInfo: &cnsconfig.ConfigurationInfo{Cfg: cfg}})
+	if expected := []string{"app", "team", "cost-center"}; !reflect.DeepEqual(categories, expected) {
+		t.Fatalf("expected categories %v, got %v", expected, categories)
+	}
+
+	pv := &v1.PersistentVolume{ObjectMeta: metav1.ObjectMeta{
+		Labels: map[string]string{"app": "db", "team": "storage", "tier": "gold"},
+	}}
+	pvc := &v1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{
+		Labels: map[string]string{"app": "web", "cost-center": ""},
+	}}
+	if volumeTags, expected := getVolumeTags(categories, pv, pvc),
+		map[string]string{"app": "web", "team": "storage"}; !reflect.DeepEqual(volumeTags, expected) {
+		t.Fatalf("expected tags %v, got %v", expected, volumeTags)
+	}
+	if volumeTags, expected := getVolumeTags(categories, pv, nil),
+		map[string]string{"app": "db", "team": "storage"}; !reflect.DeepEqual(volumeTags, expected) {
+		t.Fatalf("expected tags %v, got %v", expected, volumeTags)
+	}
+}
+
+// TestEnqueueVolumeTags checks that only the CSI block volumes are queued for
+// their tags to be synced, and only if volume-tag-labels is set.
+func TestEnqueueVolumeTags(t *testing.T) {
+	cfg := &cnsconfig.Config{}
+	metadataSyncer := &metadataSyncInformer{
+		configInfo:      &cnsconfig.ConfigurationInfo{Cfg: cfg},
+		volumeTagsQueue: workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "volume-tags"),
+	}
+	defer metadataSyncer.volumeTagsQueue.ShutDown()
+	blockPV := &v1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "block-pv"},
+		Spec: v1.PersistentVolumeSpec{
+			AccessModes: []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce},
+			PersistentVolumeSource: v1.PersistentVolumeSource{
+				CSI: &v1.CSIPersistentVolumeSource{VolumeHandle: "vol-1"},
+			},
+		},
+	}
+	filePV := blockPV.DeepCopy()
+	filePV.Name = "file-pv"
+	filePV.Spec.AccessModes = []v1.PersistentVolumeAccessMode{v1.ReadWriteMany}
+	inTreePV := blockPV.DeepCopy()
+	inTreePV.Name = "in-tree-pv"
+	inTreePV.Spec.CSI = nil
+
+	enqueueVolumeTags(metadataSyncer, blockPV)
+	if n := metadataSyncer.volumeTagsQueue.Len(); n != 0 {
+		t.Fatalf("expected no PV queued without volume-tag-labels, got %d", n)
+	}
+
+	cfg.Global.VolumeTagLabels = "app"
+	for _, pv := range []*v1.PersistentVolume{blockPV, filePV, inTreePV, blockPV} {
+		enqueueVolumeTags(metadataSyncer, pv)
+	}
+	if n := metadataSyncer.volumeTagsQueue.Len(); n != 1 {
+		t.Fatalf("expected only the block PV queued once, got %d PVs", n)
+	}
+	if key, _ := metadataSyncer.volumeTagsQueue.Get(); key != blockPV.Name {
+		t.Fatalf("expected PV %s queued, got %v", blockPV.Name, key)
+	}
+}
@@ -15,6 +15,7 @@ import (
 )
 
 var _ bool = ginkgo.Describe("[csi-supervisor] config-change-test", func() {
+	ginkgo.BeforeEach(withLabels(labelBlock, labelSupervisor, labelSerial, labelDisruptive))
 	f := framework.NewDefaultFramework("e2e-config-change-test")
 	var (
 		client            clientset.Interface
@@ -78,7 +79,7 @@ var _ bool = ginkgo.Describe("[csi-supervisor] config-change-test", func() {
 		}()
 
 		ginkgo.By(fmt.Sprintf("Waiting for claim %s to be in bound phase", pvc.Name))
-		pvs, err := fpv.WaitForPVClaimBoundPhase(client, []*v1.PersistentVolumeClaim{pvc}, framework.ClaimProvisionTimeout)
+		pvs, err := waitForPVClaimBoundPhase(client, []*v1.PersistentVolumeClaim{pvc}, framework.ClaimProvisionTimeout)
 		gomega.Expect(err).NotTo(gomega.HaveOccurred())
 		gomega.Expect(pvs).NotTo(gomega.BeEmpty())
 		pv := pvs[0]
@@ -96,7 +97,7 @@ var _ bool = ginkgo.Describe("[csi-supervisor] config-change-test", func() {
 		gomega.Expect(err).NotTo(gomega.HaveOccurred())
 
 		ginkgo.By(fmt.Sprintln("Changing password on the vCenter host"))
-		vcAddress := e2eVSphere.Config.Global.VCenterHostname + ":" + sshdPort
+		vcAddress := vcSSHAddress()
 		username := vsphereCfg.Global.User
 		currentPassword := vsphereCfg.Global.Password
 		newPassword := e2eTestPassword
@@ -19,8 +19,6 @@ package e2e
 import (
 	"context"
 	"fmt"
-	"os"
-	"strconv"
 	"time"
 
 	"github.com/onsi/ginkgo"
@@ -35,6 +33,7 @@ import (
 )
 
 var _ = ginkgo.Describe("[csi-block-vanilla] [csi-file-vanilla] CNS-CSI Cluster Distribution Telemetry", func() {
+	ginkgo.BeforeEach(withLabels(labelBlock, labelFile, labelVanilla, labelSerial))
 	f := framework.NewDefaultFramework("csi-cns-telemetry")
 	var (
 		client       clientset.Interface
@@ -93,11 +92,8 @@ var _ = ginkgo.Describe("[csi-block-vanilla] [csi-file-vanilla] CNS-CSI Cluster
 		var err error
 
 		// Read full-sync value
-		if os.Getenv(envFullSyncWaitTime) != "" {
-			fullSyncWaitTime, err = strconv.Atoi(os.Getenv(envFullSyncWaitTime))
-			framework.Logf("Full-Sync interval time value is = %v", fullSyncWaitTime)
-			gomega.Expect(err).NotTo(gomega.HaveOccurred())
-		}
+		fullSyncWaitTime = e2eEnv.FullSyncWaitTime
+		framework.Logf("Full-Sync interval time value is = %v", fullSyncWaitTime)
 
 		ginkgo.By("Creating a PVC")
 		scParameters[scParamDatastoreURL] = datastoreURL
@@ -110,7 +106,7 @@ var _ = ginkgo.Describe("[csi-block-vanilla] [csi-file-vanilla] CNS-CSI Cluster
 		}()
 
 		ginkgo.By("Expect claim to provision volume successfully")
-		persistentvolumes1, err := fpv.WaitForPVClaimBoundPhase(client, []*v1.PersistentVolumeClaim{pvclaim1}, framework.ClaimProvisionTimeout)
+		persistentvolumes1, err := waitForPVClaimBoundPhase(client, []*v1.PersistentVolumeClaim{pvclaim1}, framework.ClaimProvisionTimeout)
 		gomega.Expect(err).NotTo(gomega.HaveOccurred(), "Failed to provision volume")
 		volHandle1 := persistentvolumes1[0].Spec.CSI.VolumeHandle
 		gomega.Expect(volHandle1).NotTo(gomega.BeEmpty())
@@ -149,7 +145,7 @@ var _ = ginkgo.Describe("[csi-block-vanilla] [csi-file-vanilla] CNS-CSI Cluster
 		}()
 
 		ginkgo.By("Expect claim to provision volume successfully")
-		persistentvolumes2, err := fpv.WaitForPVClaimBoundPhase(client, []*v1.PersistentVolumeClaim{pvclaim2}, framework.ClaimProvisionTimeout)
+		persistentvolumes2, err := waitForPVClaimBoundPhase(client, []*v1.PersistentVolumeClaim{pvclaim2}, framework.ClaimProvisionTimeout)
 		gomega.Expect(err).NotTo(gomega.HaveOccurred(), "Failed to provision Second volume")
 		volHandle2 := persistentvolumes2[0].Spec.CSI.VolumeHandle
 		gomega.Expect(volHandle2).NotTo(gomega.BeEmpty())
@@ -172,7 +168,7 @@ var _ = ginkgo.Describe("[csi-block-vanilla] [csi-file-vanilla] CNS-CSI Cluster
 
 		// For Old PVCs to reflect the latest Cluster-Distribution Value, wait for full sync
 		framework.Logf("Sleeping full-sync interval for all the volumes Metadata to reflect the cluster-distribution value to = Empty")
-		time.Sleep(time.Duration(fullSyncWaitTime) * time.Second)
+		waitForFullSync(fullSyncWaitTime)
 
 		//Add additional safe wait time for cluster-distribution to reflect on metadata
 		framework.Logf("Sleeping for additional safe one min for volumes Metadata to reflect the cluster-distribution value to = Empty")
@@ -191,7 +187,7 @@ var _ = ginkgo.Describe("[csi-block-vanilla] [csi-file-vanilla] CNS-CSI Cluster
 
 		// For Old PVCs to reflect the latest Cluster-Distribution Value, wait for full sync
 		framework.Logf("Sleeping full-sync interval for all the volumes Metadata to reflect the cluster-distribution value to = %s", vanillaClusterDistributionWithSpecialChar)
-		time.Sleep(time.Duration(fullSyncWaitTime) * time.Second)
+		waitForFullSync(fullSyncWaitTime)
 
 		//Add additional safe wait time for cluster-distribution to reflect on metadata
 		framework.Logf("Sleeping for additional safe one min for volumes Metadata to reflect the cluster-distribution value to = %s", vanillaClusterDistributionWithSpecialChar)
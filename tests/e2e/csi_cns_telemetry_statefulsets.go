@@ -44,6 +44,7 @@ import (
 */
 
 var _ = ginkgo.Describe("[csi-block-vanilla] [csi-file-vanilla] [csi-supervisor] [csi-guest] CNS-CSI Cluster Distribution for StatefulSets", func() {
+	ginkgo.BeforeEach(withLabels(labelBlock, labelFile, labelVanilla, labelSupervisor, labelGuest, labelSerial))
 	f := framework.NewDefaultFramework("csi-cns-telemetry")
 	var (
 		namespace         string
@@ -19,8 +19,6 @@ package e2e
 import (
 	"context"
 	"fmt"
-	"os"
-	"strconv"
 	"time"
 
 	"github.com/onsi/ginkgo"
@@ -36,6 +34,7 @@ import (
 )
 
 var _ bool = ginkgo.Describe("[csi-block-vanilla] [csi-file-vanilla] CNS-CSI Cluster Distribution Operations during VC reboot", func() {
+	ginkgo.BeforeEach(withLabels(labelBlock, labelFile, labelVanilla, labelSerial, labelDisruptive))
 	f := framework.NewDefaultFramework("csi-cns-telemetry")
 	var (
 		client           clientset.Interface
@@ -54,12 +53,7 @@ var _ bool = ginkgo.Describe("[csi-block-vanilla] [csi-file-vanilla] CNS-CSI Clu
 			framework.Failf("Unable to find ready and schedulable Node")
 		}
 
-		if os.Getenv(envVCRebootWaitTime) != "" {
-			vcRebootWaitTime, err = strconv.Atoi(os.Getenv(envVCRebootWaitTime))
-			gomega.Expect(err).NotTo(gomega.HaveOccurred())
-		} else {
-			vcRebootWaitTime = defaultVCRebootWaitTime
-		}
+		vcRebootWaitTime = e2eEnv.VCRebootWaitTime
 
 		if vanillaCluster {
 			//Reset the cluster distribution value to default value "CSI-Vanilla"
@@ -104,11 +98,8 @@ var _ bool = ginkgo.Describe("[csi-block-vanilla] [csi-file-vanilla] CNS-CSI Clu
 		var err error
 
 		// Read full-sync value
-		if os.Getenv(envFullSyncWaitTime) != "" {
-			fullSyncWaitTime, err = strconv.Atoi(os.Getenv(envFullSyncWaitTime))
-			framework.Logf("Full-Sync interval time value is = %v", fullSyncWaitTime)
-			gomega.Expect(err).NotTo(gomega.HaveOccurred())
-		}
+		fullSyncWaitTime = e2eEnv.FullSyncWaitTime
+		framework.Logf("Full-Sync interval time value is = %v", fullSyncWaitTime)
 
 		ginkgo.By("Creating Storage Class and PVC")
 		// decide which test setup is available to run
@@ -129,7 +120,7 @@ var _ bool = ginkgo.Describe("[csi-block-vanilla] [csi-file-vanilla] CNS-CSI Clu
 		}()
 
 		ginkgo.By("Waiting for claim to be in bound phase")
-		pvc, err := fpv.WaitForPVClaimBoundPhase(client, []*v1.PersistentVolumeClaim{pvclaim}, framework.ClaimProvisionTimeout)
+		pvc, err := waitForPVClaimBoundPhase(client, []*v1.PersistentVolumeClaim{pvclaim}, framework.ClaimProvisionTimeout)
 		gomega.Expect(err).NotTo(gomega.HaveOccurred())
 		gomega.Expect(pvc).NotTo(gomega.BeEmpty())
 		pv := getPvFromClaim(client, pvclaim.Namespace, pvclaim.Name)
@@ -153,7 +144,7 @@ var _ bool = ginkgo.Describe("[csi-block-vanilla] [csi-file-vanilla] CNS-CSI Clu
 		gomega.Expect(isDiskAttached).To(gomega.BeTrue(), "Volume is not attached to the node")
 
 		ginkgo.By("Rebooting VC")
-		vcAddress := e2eVSphere.Config.Global.VCenterHostname + ":" + sshdPort
+		vcAddress := vcSSHAddress()
 		err = invokeVCenterReboot(vcAddress)
 		gomega.Expect(err).NotTo(gomega.HaveOccurred())
 
@@ -201,7 +192,7 @@ var _ bool = ginkgo.Describe("[csi-block-vanilla] [csi-file-vanilla] CNS-CSI Clu
 		bootstrap()
 
 		ginkgo.By("Waiting for PVC2 claim to be in bound phase")
-		pvc2, err := fpv.WaitForPVClaimBoundPhase(client, []*v1.PersistentVolumeClaim{pvclaim2}, framework.ClaimProvisionTimeout)
+		pvc2, err := waitForPVClaimBoundPhase(client, []*v1.PersistentVolumeClaim{pvclaim2}, framework.ClaimProvisionTimeout)
 		gomega.Expect(err).NotTo(gomega.HaveOccurred())
 		gomega.Expect(pvc2).NotTo(gomega.BeEmpty())
 		pv2 := getPvFromClaim(client, pvclaim2.Namespace, pvclaim2.Name)
@@ -278,14 +269,11 @@ var _ bool = ginkgo.Describe("[csi-block-vanilla] [csi-file-vanilla] CNS-CSI Clu
 		var err error
 
 		// Read full-sync value
-		if os.Getenv(envFullSyncWaitTime) != "" {
-			fullSyncWaitTime, err = strconv.Atoi(os.Getenv(envFullSyncWaitTime))
-			framework.Logf("Full-Sync interval time value is = %v", fullSyncWaitTime)
-			gomega.Expect(err).NotTo(gomega.HaveOccurred())
-		}
+		fullSyncWaitTime = e2eEnv.FullSyncWaitTime
+		framework.Logf("Full-Sync interval time value is = %v", fullSyncWaitTime)
 
 		ginkgo.By("Rebooting VC")
-		vcAddress := e2eVSphere.Config.Global.VCenterHostname + ":" + sshdPort
+		vcAddress := vcSSHAddress()
 		err = invokeVCenterReboot(vcAddress)
 		gomega.Expect(err).NotTo(gomega.HaveOccurred())
 		err = waitForHostToBeUp(e2eVSphere.Config.Global.VCenterHostname)
@@ -323,7 +311,7 @@ var _ bool = ginkgo.Describe("[csi-block-vanilla] [csi-file-vanilla] CNS-CSI Clu
 		}()
 
 		ginkgo.By("Waiting for claim to be in bound phase")
-		pvc, err := fpv.WaitForPVClaimBoundPhase(client, []*v1.PersistentVolumeClaim{pvclaim}, framework.ClaimProvisionTimeout)
+		pvc, err := waitForPVClaimBoundPhase(client, []*v1.PersistentVolumeClaim{pvclaim}, framework.ClaimProvisionTimeout)
 		gomega.Expect(err).NotTo(gomega.HaveOccurred())
 		gomega.Expect(pvc).NotTo(gomega.BeEmpty())
 		pv := getPvFromClaim(client, pvclaim.Namespace, pvclaim.Name)
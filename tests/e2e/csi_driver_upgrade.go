@@ -0,0 +1,199 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/kubernetes/test/e2e/framework"
+	fdep "k8s.io/kubernetes/test/e2e/framework/deployment"
+	fpod "k8s.io/kubernetes/test/e2e/framework/pod"
+)
+
+const (
+	// envUpgradeFromManifest is the path of the driver manifest of the
+	// previous release (N-1) the upgrade starts from.
+	envUpgradeFromManifest = "UPGRADE_FROM_MANIFEST"
+	// envUpgradeToManifest is the path of the driver manifest of the build
+	// under test.
+	envUpgradeToManifest       = "UPGRADE_TO_MANIFEST"
+	vSphereCSINodeDaemonSet    = "vsphere-csi-node"
+	csiDriverRolloutTimeout    = 10 * time.Minute
+	upgradeInFlightVolumeCount = 5
+)
+
+var _ = ginkgo.Describe("[csi-upgrade-vanilla] CSI Driver In-place Upgrade Test", func() {
+	ginkgo.BeforeEach(withLabels(labelBlock, labelVanilla, labelSerial, labelDisruptive))
+	f := framework.NewDefaultFramework("csi-driver-upgrade")
+	var (
+		client       clientset.Interface
+		namespace    string
+		csiNamespace string
+		fromManifest string
+		toManifest   string
+		storageclass *storagev1.StorageClass
+	)
+
+	ginkgo.BeforeEach(func() {
+		client = f.ClientSet
+		namespace = f.Namespace.Name
+		bootstrap()
+		csiNamespace = GetAndExpectStringEnvVar(envCSINamespace)
+		fromManifest = GetAndExpectStringEnvVar(envUpgradeFromManifest)
+		toManifest = GetAndExpectStringEnvVar(envUpgradeToManifest)
+		storagePolicyName := GetAndExpectStringEnvVar(envStoragePolicyNameForSharedDatastores)
+		scParameters := map[string]string{scParamStoragePolicyName: storagePolicyName}
+		var err error
+		storageclass, err = createStorageClass(client, scParameters, nil, "", "", true, "")
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	})
+
+	ginkgo.AfterEach(func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		if storageclass != nil {
+			err := client.StorageV1().StorageClasses().Delete(ctx, storageclass.Name, *metav1.NewDeleteOptions(0))
+			if !apierrors.IsNotFound(err) {
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			}
+			storageclass = nil
+		}
+	})
+
+	// Test to verify volumes keep working across an in-place upgrade of the
+	// driver and that operations issued while the upgrade rolls out complete.
+
+	// Steps
+	// 1. Deploy the previous release of the driver and wait for it to be ready.
+	// 2. Create a PVC and a pod using it with the previous release.
+	// 3. Create more PVCs and pods without waiting for them.
+	// 4. Upgrade the driver to the build under test while those are in flight.
+	// 5. Wait for the upgraded controller and node plugins to be ready.
+	// 6. Verify the in-flight PVCs are bound and their pods are running.
+	// 7. Expand the PVC created in step 2 and verify the filesystem is resized.
+	// 8. Recreate the pod of step 2 and verify the existing volume attaches.
+	// 9. Delete all pods and PVCs.
+	ginkgo.It("Upgrade the driver in place with operations in flight", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		ginkgo.By(fmt.Sprintf("Deploying the previous release of the driver from %s", fromManifest))
+		err := applyCSIDriverManifest(ctx, client, csiNamespace, fromManifest)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		pvclaim, pv := createBoundPVC(client, namespace, storageclass, diskSize)
+		defer deletePVCAndWaitForCNSVolumeDeletion(client, pvclaim, pv)
+		pod, err := createPod(client, namespace, nil, []*v1.PersistentVolumeClaim{pvclaim}, false, "")
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		originalFsSize, err := getFSSizeMbForOS(namespace, pod.Name, nodeOSLinux, getVolumeMountPathForOS(nodeOSLinux, 1))
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		ginkgo.By(fmt.Sprintf("Creating %d PVCs and pods without waiting for them", upgradeInFlightVolumeCount))
+		var inFlightClaims []*v1.PersistentVolumeClaim
+		var inFlightPods []*v1.Pod
+		for i := 0; i < upgradeInFlightVolumeCount; i++ {
+			claim, err := createPVC(client, namespace, nil, diskSize, storageclass, "")
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			inFlightClaims = append(inFlightClaims, claim)
+			inFlightPod := fpod.MakePod(namespace, nil, []*v1.PersistentVolumeClaim{claim}, false, "")
+			inFlightPod.Spec.Containers[0].Image = busyBoxImageOnGcr
+			inFlightPod, err = client.CoreV1().Pods(namespace).Create(ctx, inFlightPod, metav1.CreateOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			inFlightPods = append(inFlightPods, inFlightPod)
+		}
+
+		ginkgo.By(fmt.Sprintf("Upgrading the driver to the build under test from %s", toManifest))
+		err = applyCSIDriverManifest(ctx, client, csiNamespace, toManifest)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		ginkgo.By("Verifying the in-flight PVCs are bound and their pods are running")
+		inFlightPVs, err := waitForPVClaimBoundPhase(client, inFlightClaims, framework.ClaimProvisionTimeout)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		for i, inFlightPod := range inFlightPods {
+			err = fpod.WaitForPodNameRunningInNamespace(client, inFlightPod.Name, namespace)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			inFlightPod, err = client.CoreV1().Pods(namespace).Get(ctx, inFlightPod.Name, metav1.GetOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			defer deletePVCAndWaitForCNSVolumeDeletion(client, inFlightClaims[i], inFlightPVs[i])
+			defer deletePodAndWaitForDetach(client, inFlightPod, inFlightPVs[i].Spec.CSI.VolumeHandle)
+		}
+
+		ginkgo.By("Expanding the volume created before the upgrade")
+		expandPVCAndWaitForPvResize(client, pvclaim)
+		_, err = waitForFSResize(pvclaim, client)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		fsSize, err := getFSSizeMbForOS(namespace, pod.Name, nodeOSLinux, getVolumeMountPathForOS(nodeOSLinux, 1))
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(fsSize).To(gomega.BeNumerically(">", originalFsSize),
+			fmt.Sprintf("filesystem size %d MB is not larger than %d MB", fsSize, originalFsSize))
+
+		ginkgo.By("Recreating the pod to verify the volume created before the upgrade attaches")
+		deletePodAndWaitForDetach(client, pod, pv.Spec.CSI.VolumeHandle)
+		pod, err = createPod(client, namespace, nil, []*v1.PersistentVolumeClaim{pvclaim}, false, "")
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		defer deletePodAndWaitForDetach(client, pod, pv.Spec.CSI.VolumeHandle)
+		vmUUID := getNodeUUID(client, pod.Spec.NodeName)
+		isDiskAttached, err := e2eVSphere.isVolumeAttachedToVM(client, pv.Spec.CSI.VolumeHandle, vmUUID)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(isDiskAttached).To(gomega.BeTrue(), "Volume is not attached to the node")
+	})
+})
+
+// applyCSIDriverManifest applies the driver manifest at the given path and
+// waits for the controller deployment and the node daemonset to be rolled out.
+func applyCSIDriverManifest(ctx context.Context, client clientset.Interface, csiNamespace string,
+	manifestPath string) error {
+	if _, err := framework.RunKubectl(csiNamespace, "apply", "-f", manifestPath); err != nil {
+		return err
+	}
+	// Give the controllers a moment to observe the new generation.
+	time.Sleep(poll)
+	deployment, err := client.AppsV1().Deployments(csiNamespace).Get(ctx, vSphereCSIControllerPodNamePrefix,
+		metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if err = fdep.WaitForDeploymentComplete(client, deployment); err != nil {
+		return fmt.Errorf("deployment %s is not rolled out: %v", deployment.Name, err)
+	}
+	return waitForDaemonSetRollout(ctx, client, csiNamespace, vSphereCSINodeDaemonSet)
+}
+
+// waitForDaemonSetRollout waits until every pod of the daemonset runs the
+// latest template and is ready.
+func waitForDaemonSetRollout(ctx context.Context, client clientset.Interface, namespace string, name string) error {
+	return wait.PollImmediate(poll, csiDriverRolloutTimeout, func() (bool, error) {
+		ds, err := client.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		status := ds.Status
+		return status.ObservedGeneration >= ds.Generation &&
+			status.UpdatedNumberScheduled == status.DesiredNumberScheduled &&
+			status.NumberReady == status.DesiredNumberScheduled, nil
+	})
+}
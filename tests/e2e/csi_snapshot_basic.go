@@ -0,0 +1,459 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/kubernetes/test/e2e/framework"
+	fpod "k8s.io/kubernetes/test/e2e/framework/pod"
+	fpv "k8s.io/kubernetes/test/e2e/framework/pv"
+)
+
+const (
+	// blockVolumeSnapshotFSS is the feature state gating snapshot support in the driver.
+	blockVolumeSnapshotFSS    = "block-volume-snapshot"
+	snapshotGroup             = "snapshot.storage.k8s.io"
+	snapshotVersion           = "v1"
+	snapshotReadyTimeout      = 10 * time.Minute
+	snapshotPollInterval      = 5 * time.Second
+	snapshotDeleteTimeout     = 5 * time.Minute
+	snapshotDataFilePath      = "/mnt/volume1/snapshot-data"
+	snapshotDataFileContent   = "vsphere-csi-snapshot"
+	snapshotRestoreLargerSize = "4Gi"
+)
+
+var (
+	volumeSnapshotGVR        = schema.GroupVersionResource{Group: snapshotGroup, Version: snapshotVersion, Resource: "volumesnapshots"}
+	volumeSnapshotClassGVR   = schema.GroupVersionResource{Group: snapshotGroup, Version: snapshotVersion, Resource: "volumesnapshotclasses"}
+	volumeSnapshotContentGVR = schema.GroupVersionResource{Group: snapshotGroup, Version: snapshotVersion, Resource: "volumesnapshotcontents"}
+)
+
+var _ = ginkgo.Describe("[csi-block-vanilla] [block-vanilla-snapshot] Volume Snapshot Basic Test", func() {
+	ginkgo.BeforeEach(withLabels(labelBlock, labelSnapshot, labelVanilla, labelSerial, labelDisruptive))
+	f := framework.NewDefaultFramework("volume-snapshot")
+	var (
+		client            clientset.Interface
+		dynamicClient     dynamic.Interface
+		namespace         string
+		csiNamespace      string
+		storagePolicyName string
+		storageclass      *storagev1.StorageClass
+		snapshotClassName string
+		isControllerDown  bool
+	)
+
+	ginkgo.BeforeEach(func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		client = f.ClientSet
+		namespace = f.Namespace.Name
+		bootstrap()
+		csiNamespace = GetAndExpectStringEnvVar(envCSINamespace)
+		if !isCsiFssEnabled(ctx, client, csiNamespace, blockVolumeSnapshotFSS) {
+			ginkgo.Skip(fmt.Sprintf("%s feature state is not enabled", blockVolumeSnapshotFSS))
+		}
+		var err error
+		dynamicClient, err = dynamic.NewForConfig(f.ClientConfig())
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		isControllerDown = false
+
+		storagePolicyName = GetAndExpectStringEnvVar(envStoragePolicyNameForSharedDatastores)
+		scParameters := map[string]string{scParamStoragePolicyName: storagePolicyName}
+		storageclass, err = createStorageClass(client, scParameters, nil, "", "", true, "")
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		ginkgo.By("Creating VolumeSnapshotClass")
+		snapshotClassName, err = createVolumeSnapshotClass(ctx, dynamicClient)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	})
+
+	ginkgo.AfterEach(func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		if isControllerDown {
+			bringUpCsiController(client, csiNamespace)
+		}
+		if snapshotClassName != "" {
+			err := dynamicClient.Resource(volumeSnapshotClassGVR).Delete(ctx, snapshotClassName, metav1.DeleteOptions{})
+			if !apierrors.IsNotFound(err) {
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			}
+			snapshotClassName = ""
+		}
+		if storageclass != nil {
+			err := client.StorageV1().StorageClasses().Delete(ctx, storageclass.Name, *metav1.NewDeleteOptions(0))
+			if !apierrors.IsNotFound(err) {
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			}
+			storageclass = nil
+		}
+	})
+
+	// Test to verify a snapshot can be created from a volume, restored to a
+	// new volume and deleted.
+
+	// Steps
+	// 1. Create a PVC and wait for it to be bound.
+	// 2. Create a VolumeSnapshot of the PVC and wait for it to be ready.
+	// 3. Create a PVC from the snapshot and wait for it to be bound.
+	// 4. Verify the restored volume is registered with CNS.
+	// 5. Delete the restored PVC, the snapshot and the source PVC.
+	// 6. Verify the VolumeSnapshotContent and the volumes are deleted.
+	ginkgo.It("Create, restore and delete a volume snapshot", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		pvclaim, pv := createBoundPVC(client, namespace, storageclass, diskSize)
+		defer deletePVCAndWaitForCNSVolumeDeletion(client, pvclaim, pv)
+
+		snapshotName, contentName := createVolumeSnapshotAndWaitForReady(ctx, dynamicClient, namespace,
+			pvclaim.Name, snapshotClassName)
+		snapshotDeleted := false
+		defer func() {
+			if !snapshotDeleted {
+				deleteVolumeSnapshotAndWaitForContentDeletion(ctx, dynamicClient, namespace, snapshotName, contentName)
+			}
+		}()
+
+		restoredClaim, restoredPV := createBoundPVCFromSnapshot(client, namespace, storageclass, diskSize, snapshotName)
+		ginkgo.By("Verifying the restored volume is registered with CNS")
+		err := e2eVSphere.waitForCNSVolumeToBeCreated(restoredPV.Spec.CSI.VolumeHandle)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		deletePVCAndWaitForCNSVolumeDeletion(client, restoredClaim, restoredPV)
+
+		deleteVolumeSnapshotAndWaitForContentDeletion(ctx, dynamicClient, namespace, snapshotName, contentName)
+		snapshotDeleted = true
+	})
+
+	// Test to verify a snapshot can be restored to a volume larger than the
+	// source volume.
+
+	// Steps
+	// 1. Create a PVC and wait for it to be bound.
+	// 2. Create a VolumeSnapshot of the PVC and wait for it to be ready.
+	// 3. Create a PVC from the snapshot requesting a larger size.
+	// 4. Verify the restored PV has the requested capacity.
+	// 5. Delete the restored PVC, the snapshot and the source PVC.
+	ginkgo.It("Restore a volume snapshot to a larger volume", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		pvclaim, pv := createBoundPVC(client, namespace, storageclass, diskSize)
+		defer deletePVCAndWaitForCNSVolumeDeletion(client, pvclaim, pv)
+
+		snapshotName, contentName := createVolumeSnapshotAndWaitForReady(ctx, dynamicClient, namespace,
+			pvclaim.Name, snapshotClassName)
+		defer deleteVolumeSnapshotAndWaitForContentDeletion(ctx, dynamicClient, namespace, snapshotName, contentName)
+
+		restoredClaim, restoredPV := createBoundPVCFromSnapshot(client, namespace, storageclass,
+			snapshotRestoreLargerSize, snapshotName)
+		defer deletePVCAndWaitForCNSVolumeDeletion(client, restoredClaim, restoredPV)
+
+		ginkgo.By("Verifying the restored volume has the requested size")
+		expectedSize := resource.MustParse(snapshotRestoreLargerSize)
+		actualSize := restoredPV.Spec.Capacity[v1.ResourceStorage]
+		gomega.Expect(actualSize.Cmp(expectedSize)).To(gomega.BeNumerically(">=", 0),
+			fmt.Sprintf("restored PV %s has capacity %s, expected at least %s",
+				restoredPV.Name, actualSize.String(), expectedSize.String()))
+	})
+
+	// Test to verify a snapshot of a volume attached to a running pod captures
+	// the data written to it.
+
+	// Steps
+	// 1. Create a PVC and a pod using it, write data to the volume.
+	// 2. Create a VolumeSnapshot of the PVC while the pod is running.
+	// 3. Create a PVC from the snapshot and a pod using it.
+	// 4. Verify the data written in step 1 is present on the restored volume.
+	// 5. Delete the pods, PVCs and the snapshot.
+	ginkgo.It("Snapshot a volume attached to a running pod", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		pvclaim, pv := createBoundPVC(client, namespace, storageclass, diskSize)
+		defer deletePVCAndWaitForCNSVolumeDeletion(client, pvclaim, pv)
+
+		ginkgo.By("Creating pod and writing data to the volume")
+		pod, err := createPod(client, namespace, nil, []*v1.PersistentVolumeClaim{pvclaim}, false, "")
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		defer deletePodAndWaitForDetach(client, pod, pv.Spec.CSI.VolumeHandle)
+		writeDataOnFileFromPod(namespace, pod.Name, snapshotDataFilePath, snapshotDataFileContent)
+		_, err = framework.RunKubectl(namespace, "exec", fmt.Sprintf("--namespace=%s", namespace), pod.Name,
+			"--", "/bin/sh", "-c", "sync")
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		snapshotName, contentName := createVolumeSnapshotAndWaitForReady(ctx, dynamicClient, namespace,
+			pvclaim.Name, snapshotClassName)
+		defer deleteVolumeSnapshotAndWaitForContentDeletion(ctx, dynamicClient, namespace, snapshotName, contentName)
+
+		restoredClaim, restoredPV := createBoundPVCFromSnapshot(client, namespace, storageclass, diskSize, snapshotName)
+		defer deletePVCAndWaitForCNSVolumeDeletion(client, restoredClaim, restoredPV)
+
+		ginkgo.By("Creating pod using the restored volume and verifying its data")
+		restoredPod, err := createPod(client, namespace, nil, []*v1.PersistentVolumeClaim{restoredClaim}, false, "")
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		defer deletePodAndWaitForDetach(client, restoredPod, restoredPV.Spec.CSI.VolumeHandle)
+		output := readFileFromPod(namespace, restoredPod.Name, snapshotDataFilePath)
+		gomega.Expect(output).To(gomega.ContainSubstring(snapshotDataFileContent))
+	})
+
+	// Test to verify snapshot create and delete complete when the CSI
+	// controller restarts while the requests are pending.
+
+	// Steps
+	// 1. Create a PVC and wait for it to be bound.
+	// 2. Bring down the CSI controller and create a VolumeSnapshot.
+	// 3. Bring up the CSI controller and verify the snapshot becomes ready.
+	// 4. Bring down the CSI controller and delete the VolumeSnapshot.
+	// 5. Bring up the CSI controller and verify the VolumeSnapshotContent is
+	//    deleted.
+	ginkgo.It("Create and delete a volume snapshot across CSI controller restarts", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		pvclaim, pv := createBoundPVC(client, namespace, storageclass, diskSize)
+		defer deletePVCAndWaitForCNSVolumeDeletion(client, pvclaim, pv)
+
+		ginkgo.By("Bringing down the CSI controller and creating VolumeSnapshot")
+		bringDownCsiController(client, csiNamespace)
+		isControllerDown = true
+		snapshotName, err := createVolumeSnapshot(ctx, dynamicClient, namespace, pvclaim.Name, snapshotClassName)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		ginkgo.By("Bringing up the CSI controller and waiting for the VolumeSnapshot to be ready")
+		bringUpCsiController(client, csiNamespace)
+		isControllerDown = false
+		contentName, err := waitForVolumeSnapshotReadyToUse(ctx, dynamicClient, namespace, snapshotName)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		ginkgo.By("Bringing down the CSI controller and deleting VolumeSnapshot")
+		bringDownCsiController(client, csiNamespace)
+		isControllerDown = true
+		err = dynamicClient.Resource(volumeSnapshotGVR).Namespace(namespace).Delete(ctx, snapshotName,
+			metav1.DeleteOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		ginkgo.By("Bringing up the CSI controller and waiting for the VolumeSnapshotContent to be deleted")
+		bringUpCsiController(client, csiNamespace)
+		isControllerDown = false
+		err = waitForVolumeSnapshotContentToBeDeleted(ctx, dynamicClient, contentName)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	})
+})
+
+// isCsiFssEnabled returns whether the given feature state is enabled in the
+// CSI feature states ConfigMap of the given namespace.
+func isCsiFssEnabled(ctx context.Context, client clientset.Interface, namespace string, fss string) bool {
+	fssCM, err := client.CoreV1().ConfigMaps(namespace).Get(ctx, csiFssConfigMap, metav1.GetOptions{})
+	gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	enabled, err := strconv.ParseBool(fssCM.Data[fss])
+	if err != nil {
+		framework.Logf("feature state %q has invalid value %q in %s", fss, fssCM.Data[fss], csiFssConfigMap)
+		return false
+	}
+	return enabled
+}
+
+// createBoundPVC creates a PVC of the given size and waits for it to be bound.
+func createBoundPVC(client clientset.Interface, namespace string, storageclass *storagev1.StorageClass,
+	size string) (*v1.PersistentVolumeClaim, *v1.PersistentVolume) {
+	pvclaim, err := createPVC(client, namespace, nil, size, storageclass, "")
+	gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	return waitForClaimBound(client, pvclaim)
+}
+
+// createBoundPVCFromSnapshot creates a PVC of the given size with the given
+// snapshot as its data source and waits for it to be bound.
+func createBoundPVCFromSnapshot(client clientset.Interface, namespace string, storageclass *storagev1.StorageClass,
+	size string, snapshotName string) (*v1.PersistentVolumeClaim, *v1.PersistentVolume) {
+	ginkgo.By(fmt.Sprintf("Creating PVC of size %s from VolumeSnapshot %s", size, snapshotName))
+	apiGroup := snapshotGroup
+	pvcSpec := getPersistentVolumeClaimSpecWithStorageClass(namespace, size, storageclass, nil, "")
+	pvcSpec.Spec.DataSource = &v1.TypedLocalObjectReference{
+		APIGroup: &apiGroup,
+		Kind:     "VolumeSnapshot",
+		Name:     snapshotName,
+	}
+	pvclaim, err := fpv.CreatePVC(client, namespace, pvcSpec)
+	gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	return waitForClaimBound(client, pvclaim)
+}
+
+func waitForClaimBound(client clientset.Interface,
+	pvclaim *v1.PersistentVolumeClaim) (*v1.PersistentVolumeClaim, *v1.PersistentVolume) {
+	ginkgo.By(fmt.Sprintf("Waiting for PVC %s to be bound", pvclaim.Name))
+	pvs, err := waitForPVClaimBoundPhase(client, []*v1.PersistentVolumeClaim{pvclaim}, framework.ClaimProvisionTimeout)
+	gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	pvclaim, err = client.CoreV1().PersistentVolumeClaims(pvclaim.Namespace).Get(context.TODO(), pvclaim.Name,
+		metav1.GetOptions{})
+	gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	return pvclaim, pvs[0]
+}
+
+// deletePVCAndWaitForCNSVolumeDeletion deletes the PVC and waits for its
+// volume to be removed from CNS.
+func deletePVCAndWaitForCNSVolumeDeletion(client clientset.Interface, pvclaim *v1.PersistentVolumeClaim,
+	pv *v1.PersistentVolume) {
+	ginkgo.By(fmt.Sprintf("Deleting PVC %s", pvclaim.Name))
+	err := fpv.DeletePersistentVolumeClaim(client, pvclaim.Name, pvclaim.Namespace)
+	gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	err = fpv.WaitForPersistentVolumeDeleted(client, pv.Name, poll, pollTimeout)
+	gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	err = e2eVSphere.waitForCNSVolumeToBeDeleted(pv.Spec.CSI.VolumeHandle)
+	gomega.Expect(err).NotTo(gomega.HaveOccurred())
+}
+
+// deletePodAndWaitForDetach deletes the pod and waits for the volume to be
+// detached from the node it was running on.
+func deletePodAndWaitForDetach(client clientset.Interface, pod *v1.Pod, volumeID string) {
+	ginkgo.By(fmt.Sprintf("Deleting pod %s", pod.Name))
+	err := fpod.DeletePodWithWait(client, pod)
+	gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	isDiskDetached, err := e2eVSphere.waitForVolumeDetachedFromNode(client, volumeID, pod.Spec.NodeName)
+	gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	gomega.Expect(isDiskDetached).To(gomega.BeTrue(),
+		fmt.Sprintf("Volume %q is not detached from the node %q", volumeID, pod.Spec.NodeName))
+}
+
+// createVolumeSnapshotClass creates a VolumeSnapshotClass for the driver and
+// returns its name.
+func createVolumeSnapshotClass(ctx context.Context, dynamicClient dynamic.Interface) (string, error) {
+	snapshotClass := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": snapshotGroup + "/" + snapshotVersion,
+			"kind":       "VolumeSnapshotClass",
+			"metadata": map[string]interface{}{
+				"generateName": "e2e-snapshotclass-",
+			},
+			"driver":         e2evSphereCSIDriverName,
+			"deletionPolicy": "Delete",
+		},
+	}
+	snapshotClass, err := dynamicClient.Resource(volumeSnapshotClassGVR).Create(ctx, snapshotClass,
+		metav1.CreateOptions{})
+	if err != nil {
+		return "", err
+	}
+	return snapshotClass.GetName(), nil
+}
+
+// createVolumeSnapshot creates a VolumeSnapshot of the given PVC and returns
+// its name.
+func createVolumeSnapshot(ctx context.Context, dynamicClient dynamic.Interface, namespace string,
+	pvcName string, snapshotClassName string) (string, error) {
+	ginkgo.By(fmt.Sprintf("Creating VolumeSnapshot of PVC %s", pvcName))
+	snapshot := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": snapshotGroup + "/" + snapshotVersion,
+			"kind":       "VolumeSnapshot",
+			"metadata": map[string]interface{}{
+				"generateName": "e2e-snapshot-",
+				"namespace":    namespace,
+			},
+			"spec": map[string]interface{}{
+				"volumeSnapshotClassName": snapshotClassName,
+				"source": map[string]interface{}{
+					"persistentVolumeClaimName": pvcName,
+				},
+			},
+		},
+	}
+	snapshot, err := dynamicClient.Resource(volumeSnapshotGVR).Namespace(namespace).Create(ctx, snapshot,
+		metav1.CreateOptions{})
+	if err != nil {
+		return "", err
+	}
+	return snapshot.GetName(), nil
+}
+
+// createVolumeSnapshotAndWaitForReady creates a VolumeSnapshot of the given
+// PVC, waits for it to be ready to use and returns the names of the snapshot
+// and its bound VolumeSnapshotContent.
+func createVolumeSnapshotAndWaitForReady(ctx context.Context, dynamicClient dynamic.Interface, namespace string,
+	pvcName string, snapshotClassName string) (string, string) {
+	snapshotName, err := createVolumeSnapshot(ctx, dynamicClient, namespace, pvcName, snapshotClassName)
+	gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	contentName, err := waitForVolumeSnapshotReadyToUse(ctx, dynamicClient, namespace, snapshotName)
+	gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	return snapshotName, contentName
+}
+
+// waitForVolumeSnapshotReadyToUse waits for the VolumeSnapshot to be ready to
+// use and returns the name of its bound VolumeSnapshotContent.
+func waitForVolumeSnapshotReadyToUse(ctx context.Context, dynamicClient dynamic.Interface, namespace string,
+	snapshotName string) (string, error) {
+	ginkgo.By(fmt.Sprintf("Waiting for VolumeSnapshot %s to be ready to use", snapshotName))
+	var contentName string
+	err := wait.PollImmediate(snapshotPollInterval, snapshotReadyTimeout, func() (bool, error) {
+		snapshot, err := dynamicClient.Resource(volumeSnapshotGVR).Namespace(namespace).Get(ctx, snapshotName,
+			metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		if message, found, _ := unstructured.NestedString(snapshot.Object, "status", "error", "message"); found {
+			framework.Logf("VolumeSnapshot %s reported error: %s", snapshotName, message)
+		}
+		ready, _, _ := unstructured.NestedBool(snapshot.Object, "status", "readyToUse")
+		contentName, _, _ = unstructured.NestedString(snapshot.Object, "status", "boundVolumeSnapshotContentName")
+		return ready && contentName != "", nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("VolumeSnapshot %s is not ready to use within %v: %v", snapshotName,
+			snapshotReadyTimeout, err)
+	}
+	return contentName, nil
+}
+
+// deleteVolumeSnapshotAndWaitForContentDeletion deletes the VolumeSnapshot and
+// waits for its VolumeSnapshotContent to be removed.
+func deleteVolumeSnapshotAndWaitForContentDeletion(ctx context.Context, dynamicClient dynamic.Interface,
+	namespace string, snapshotName string, contentName string) {
+	ginkgo.By(fmt.Sprintf("Deleting VolumeSnapshot %s", snapshotName))
+	err := dynamicClient.Resource(volumeSnapshotGVR).Namespace(namespace).Delete(ctx, snapshotName,
+		metav1.DeleteOptions{})
+	if !apierrors.IsNotFound(err) {
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	}
+	err = waitForVolumeSnapshotContentToBeDeleted(ctx, dynamicClient, contentName)
+	gomega.Expect(err).NotTo(gomega.HaveOccurred())
+}
+
+// waitForVolumeSnapshotContentToBeDeleted waits for the VolumeSnapshotContent
+// to be removed, which happens once the driver deleted the snapshot.
+func waitForVolumeSnapshotContentToBeDeleted(ctx context.Context, dynamicClient dynamic.Interface,
+	contentName string) error {
+	ginkgo.By(fmt.Sprintf("Waiting for VolumeSnapshotContent %s to be deleted", contentName))
+	return wait.PollImmediate(snapshotPollInterval, snapshotDeleteTimeout, func() (bool, error) {
+		_, err := dynamicClient.Resource(volumeSnapshotContentGVR).Get(ctx, contentName, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	})
+}
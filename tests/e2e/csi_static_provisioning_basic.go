@@ -20,7 +20,6 @@ import (
 	"context"
 	"fmt"
 	"math/rand"
-	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -50,6 +49,7 @@ import (
 )
 
 var _ = ginkgo.Describe("Basic Static Provisioning", func() {
+	ginkgo.BeforeEach(withLabels(labelBlock, labelVanilla, labelSupervisor, labelGuest, labelSerial, labelDisruptive))
 	f := framework.NewDefaultFramework("e2e-csistaticprovision")
 
 	var (
@@ -85,12 +85,7 @@ var _ = ginkgo.Describe("Basic Static Provisioning", func() {
 			framework.Failf("Unable to find ready and schedulable Node")
 		}
 
-		if os.Getenv(envPandoraSyncWaitTime) != "" {
-			pandoraSyncWaitTime, err = strconv.Atoi(os.Getenv(envPandoraSyncWaitTime))
-			gomega.Expect(err).NotTo(gomega.HaveOccurred())
-		} else {
-			pandoraSyncWaitTime = defaultPandoraSyncWaitTime
-		}
+		pandoraSyncWaitTime = e2eEnv.PandoraSyncWaitTime
 		deleteFCDRequired = false
 		isVsanhealthServiceStopped = false
 		isSPSserviceStopped = false
@@ -126,7 +121,7 @@ var _ = ginkgo.Describe("Basic Static Provisioning", func() {
 	})
 
 	ginkgo.AfterEach(func() {
-		vcAddress := e2eVSphere.Config.Global.VCenterHostname + ":" + sshdPort
+		vcAddress := vcSSHAddress()
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
 		ginkgo.By("Performing test cleanup")
@@ -1133,7 +1128,7 @@ var _ = ginkgo.Describe("Basic Static Provisioning", func() {
 
 		ginkgo.By(fmt.Sprintln("Stopping vsan-health on the vCenter host"))
 		isVsanhealthServiceStopped = true
-		vcAddress := e2eVSphere.Config.Global.VCenterHostname + ":" + sshdPort
+		vcAddress := vcSSHAddress()
 		err = invokeVCenterServiceControl("stop", vsanhealthServiceName, vcAddress)
 		gomega.Expect(err).NotTo(gomega.HaveOccurred())
 		ginkgo.By(fmt.Sprintf("Sleeping for %v seconds to allow vsan-health to completely shutdown", vsanHealthServiceWaitTime))
@@ -1222,7 +1217,7 @@ var _ = ginkgo.Describe("Basic Static Provisioning", func() {
 
 		ginkgo.By(fmt.Sprintln("Stopping sps on the vCenter host"))
 		isSPSserviceStopped = true
-		vcAddress := e2eVSphere.Config.Global.VCenterHostname + ":" + sshdPort
+		vcAddress := vcSSHAddress()
 		err = invokeVCenterServiceControl("stop", "sps", vcAddress)
 		gomega.Expect(err).NotTo(gomega.HaveOccurred())
 		ginkgo.By(fmt.Sprintf("Sleeping for %v seconds to allow sps to completely shutdown", vsanHealthServiceWaitTime))
@@ -43,6 +43,7 @@ import (
 )
 
 var _ = ginkgo.Describe("[csi-file-vanilla] Basic File Volume Static Provisioning", func() {
+	ginkgo.BeforeEach(withLabels(labelFile, labelVanilla))
 	f := framework.NewDefaultFramework("e2e-csifilestaticprovision")
 
 	var (
@@ -35,6 +35,7 @@ const (
 	crdGroup                                   = "cns.vmware.com"
 	crdVersion                                 = "v1alpha1"
 	csiSystemNamespace                         = "vmware-system-csi"
+	csiFssConfigMap                            = "internal-feature-states.csi.vsphere.vmware.com"
 	defaultFullSyncIntervalInMin               = "30"
 	defaultFullSyncWaitTime                    = 1800
 	defaultPandoraSyncWaitTime                 = 90
@@ -71,6 +72,7 @@ const (
 	envVolumeOperationsScale                   = "VOLUME_OPS_SCALE"
 	envComputeClusterName                      = "COMPUTE_CLUSTER_NAME"
 	esxPassword                                = "ca$hc0w"
+	k8sNodePassword                            = "ca$hc0w"
 	execCommand                                = "/bin/df -T /mnt/volume1 | /bin/awk 'FNR == 2 {print $2}' > /mnt/volume1/fstype && while true ; do sleep 2 ; done"
 	ext3FSType                                 = "ext3"
 	ext4FSType                                 = "ext4"
@@ -85,6 +87,8 @@ const (
 	k8sPodTerminationTimeOut                   = 7 * time.Minute
 	k8sPodTerminationTimeOutLong               = 10 * time.Minute
 	kcmManifest                                = "/etc/kubernetes/manifests/kube-controller-manager.yaml"
+	kcmName                                    = "kube-controller-manager"
+	kubeadmPatchesDir                          = "/etc/kubernetes/patches"
 	kubeAPIPath                                = "/etc/kubernetes/manifests/"
 	kubeAPIfile                                = "kube-apiserver.yaml"
 	kubeAPIRecoveryTime                        = 1 * time.Minute
@@ -113,7 +117,7 @@ const (
 	scParamStoragePolicyName                   = "StoragePolicyName"
 	sleepTimeOut                               = 30
 	spsServiceName                             = "sps"
-	sshdPort                                   = "22"
+	defaultSSHPort                             = 22
 	startOperation                             = "start"
 	stopOperation                              = "stop"
 	supervisorClusterOperationsTimeout         = 3 * time.Minute
@@ -130,6 +134,7 @@ const (
 	vsanDefaultStoragePolicyName               = "vSAN Default Storage Policy"
 	vsanHealthServiceWaitTime                  = 15
 	vsanhealthServiceName                      = "vsan-health"
+	volumeExpansionDelta                       = "1Gi"
 	vsphereCloudProviderConfiguration          = "vsphere-cloud-provider.conf"
 	vsphereControllerManager                   = "vmware-system-tkg-controller-manager"
 	vSphereCSIConf                             = "csi-vsphere.conf"
@@ -150,6 +155,7 @@ var (
 // For VCP to CSI migration tests
 var (
 	envSharedDatastoreName          = "SHARED_VSPHERE_DATASTORE_NAME"
+	envKubeadmPatchesDir            = "KUBEADM_PATCHES_DIR"
 	vcpProvisionerName              = "kubernetes.io/vsphere-volume"
 	vcpScParamDatastoreName         = "datastore"
 	vcpScParamPolicyName            = "storagePolicyName"
@@ -162,9 +168,14 @@ var (
 	nodeMapper                      = &NodeMapper{}
 )
 
-// GetAndExpectStringEnvVar parses a string from env variable
+// GetAndExpectStringEnvVar returns the setting of the test environment read
+// from env variable varName, falling back to the env variable itself for
+// settings e2eEnvConfig does not describe.
 func GetAndExpectStringEnvVar(varName string) string {
-	varValue := os.Getenv(varName)
+	varValue, ok := e2eEnv.lookup(varName)
+	if !ok {
+		varValue = os.Getenv(varName)
+	}
 	gomega.Expect(varValue).NotTo(gomega.BeEmpty(), "ENV "+varName+" is not set")
 	return varValue
 }
@@ -0,0 +1,243 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"reflect"
+	"strconv"
+
+	"sigs.k8s.io/yaml"
+)
+
+// envE2EEnvConfigFile is the ENV variable specifying the path of the YAML
+// file describing the test environment.
+const envE2EEnvConfigFile = "E2E_ENV_CONFIG_FILE"
+
+// e2eEnvConfig describes the testbed the e2e tests run against. Each field is
+// read from the YAML file given by E2E_ENV_CONFIG_FILE under its json key,
+// and can be overridden by the ENV variable named by its env tag.
+type e2eEnvConfig struct {
+	// Namespace the CSI driver is deployed in.
+	CSINamespace string `json:"csiNamespace" env:"CSI_NAMESPACE"`
+	// Name of the compute cluster the nodes run in.
+	ComputeClusterName string `json:"computeClusterName" env:"COMPUTE_CLUSTER_NAME"`
+	// IP address of an ESX host of the cluster.
+	EsxHostIP string `json:"esxHostIP" env:"ESX_TEST_HOST_IP"`
+
+	// URL of a datastore accessible from all nodes.
+	SharedDatastoreURL string `json:"sharedDatastoreURL" env:"SHARED_VSPHERE_DATASTORE_URL"`
+	// Name of the datastore given by SharedDatastoreURL.
+	SharedDatastoreName string `json:"sharedDatastoreName" env:"SHARED_VSPHERE_DATASTORE_NAME"`
+	// URL of a datastore accessible from some nodes only.
+	NonSharedDatastoreURL string `json:"nonSharedDatastoreURL" env:"NONSHARED_VSPHERE_DATASTORE_URL"`
+	// URLs of shared datastores of a given type, tests needing one are
+	// skipped when it is not set.
+	SharedVVOLDatastoreURL string `json:"sharedVVOLDatastoreURL" env:"SHARED_VVOL_DATASTORE_URL"`
+	SharedNFSDatastoreURL  string `json:"sharedNFSDatastoreURL" env:"SHARED_NFS_DATASTORE_URL"`
+	SharedVMFSDatastoreURL string `json:"sharedVMFSDatastoreURL" env:"SHARED_VMFS_DATASTORE_URL"`
+	// URL of a shared datastore of a vSAN cluster with file services
+	// disabled.
+	FileServiceDisabledSharedDatastoreURL string `json:"fileServiceDisabledSharedDatastoreURL" env:"FILE_SERVICE_DISABLED_SHARED_VSPHERE_DATASTORE_URL"`
+	// URL of the datastore volumes are relocated to.
+	DestinationDatastoreURL string `json:"destinationDatastoreURL" env:"DESTINATION_VSPHERE_DATASTORE_URL"`
+	// URL of a datastore outside of the zones of the nodes.
+	InaccessibleZoneDatastoreURL string `json:"inaccessibleZoneDatastoreURL" env:"INACCESSIBLE_ZONE_VSPHERE_DATASTORE_URL"`
+	// Path of a vmdk used to create static volumes.
+	VmdkDiskURL string `json:"vmdkDiskURL" env:"DISK_URL_PATH"`
+
+	// Storage policies compatible with the corresponding datastores.
+	StoragePolicyForSharedDatastores    string `json:"storagePolicyForSharedDatastores" env:"STORAGE_POLICY_FOR_SHARED_DATASTORES"`
+	StoragePolicyForNonSharedDatastores string `json:"storagePolicyForNonSharedDatastores" env:"STORAGE_POLICY_FOR_NONSHARED_DATASTORES"`
+	StoragePolicyFromInaccessibleZone   string `json:"storagePolicyFromInaccessibleZone" env:"STORAGE_POLICY_FROM_INACCESSIBLE_ZONE"`
+	StoragePolicyWithThickProvisioning  string `json:"storagePolicyWithThickProvisioning" env:"STORAGE_POLICY_WITH_THICK_PROVISIONING"`
+	// Name of a RAID 0 storage policy, tests needing one are skipped when it
+	// is not set.
+	Raid0StoragePolicy string `json:"raid0StoragePolicy" env:"RAID_0_STORAGE_POLICY"`
+
+	// Topology of the nodes, as region:zone values.
+	TopologyWithSharedDatastore   string `json:"topologyWithSharedDatastore" env:"TOPOLOGY_WITH_SHARED_DATASTORE"`
+	TopologyWithNoSharedDatastore string `json:"topologyWithNoSharedDatastore" env:"TOPOLOGY_WITH_NO_SHARED_DATASTORE"`
+	TopologyWithOnlyOneNode       string `json:"topologyWithOnlyOneNode" env:"TOPOLOGY_WITH_ONLY_ONE_NODE"`
+
+	// Supervisor cluster namespaces used by WCP and GC tests.
+	SupervisorNamespace         string `json:"supervisorNamespace" env:"SVC_NAMESPACE"`
+	SupervisorNamespaceToDelete string `json:"supervisorNamespaceToDelete" env:"SVC_NAMESPACE_TO_DELETE"`
+	// Kubeconfig of the guest cluster created by GC tests.
+	NewGuestClusterKubeconfig string `json:"newGuestClusterKubeconfig" env:"NEW_GUEST_CLUSTER_KUBE_CONFIG"`
+
+	// Directory of the kubeadm patches of the control plane nodes.
+	KubeadmPatchesDir string `json:"kubeadmPatchesDir" env:"KUBEADM_PATCHES_DIR"`
+	// Driver manifests the upgrade test upgrades from and to.
+	UpgradeFromManifest string `json:"upgradeFromManifest" env:"UPGRADE_FROM_MANIFEST"`
+	UpgradeToManifest   string `json:"upgradeToManifest" env:"UPGRADE_TO_MANIFEST"`
+
+	// Seconds to wait for a full sync of the syncer.
+	FullSyncWaitTime int `json:"fullSyncWaitTime" env:"FULL_SYNC_WAIT_TIME"`
+	// Seconds to wait for the vSphere inventory to be synced to CNS.
+	PandoraSyncWaitTime int `json:"pandoraSyncWaitTime" env:"PANDORA_SYNC_WAIT_TIME"`
+	// Seconds to wait for vCenter to come back after a reboot.
+	VCRebootWaitTime int `json:"vcRebootWaitTime" env:"VC_REBOOT_WAIT_TIME"`
+	// Number of volumes created by the operation storm tests, the default
+	// depends on the cluster flavor.
+	VolumeOpsScale int `json:"volumeOpsScale" env:"VOLUME_OPS_SCALE"`
+	// Number of PVC/pod pairs created by the scale harness, and how many of
+	// them are created in parallel.
+	ScaleVolumeCount int `json:"scaleVolumeCount" env:"SCALE_VOLUME_COUNT"`
+	ScaleConcurrency int `json:"scaleConcurrency" env:"SCALE_CONCURRENCY"`
+
+	// Jump host, as host:port, all SSH connections go through when set.
+	SSHBastion string `json:"sshBastion" env:"E2E_SSH_BASTION"`
+	// User and private key file to log in to the jump host with, defaulting
+	// to the ones of the e2e framework (KUBE_SSH_USER and KUBE_SSH_KEY_PATH).
+	SSHBastionUser    string `json:"sshBastionUser" env:"E2E_SSH_BASTION_USER"`
+	SSHBastionKeyPath string `json:"sshBastionKeyPath" env:"E2E_SSH_BASTION_KEY_PATH"`
+	// Port of sshd on vCenter. The user and key are the ones of the e2e
+	// framework.
+	VCenterSSHPort int `json:"vCenterSSHPort" env:"VCENTER_SSH_PORT"`
+	// Port of sshd on ESX hosts and the credentials to log in with.
+	ESXSSHPort     int    `json:"esxSSHPort" env:"ESX_SSH_PORT"`
+	ESXSSHUser     string `json:"esxSSHUser" env:"ESX_SSH_USER"`
+	ESXSSHPassword string `json:"esxSSHPassword" env:"ESX_SSH_PASSWORD"`
+	// Port of sshd on k8s nodes and the credentials to log in with.
+	NodeSSHPort     int    `json:"nodeSSHPort" env:"K8S_NODE_SSH_PORT"`
+	NodeSSHUser     string `json:"nodeSSHUser" env:"K8S_NODE_SSH_USER"`
+	NodeSSHPassword string `json:"nodeSSHPassword" env:"K8S_NODE_SSH_PASSWORD"`
+}
+
+// e2eEnv is the environment of this run, loaded when the suite starts.
+var e2eEnv = defaultEnvConfig()
+
+// defaultEnvConfig returns the environment with the defaults of the optional
+// settings.
+func defaultEnvConfig() *e2eEnvConfig {
+	return &e2eEnvConfig{
+		FullSyncWaitTime:    defaultFullSyncWaitTime,
+		PandoraSyncWaitTime: defaultPandoraSyncWaitTime,
+		VCRebootWaitTime:    defaultVCRebootWaitTime,
+		ScaleVolumeCount:    defaultScaleVolumeCount,
+		ScaleConcurrency:    defaultScaleConcurrency,
+		VCenterSSHPort:      defaultSSHPort,
+		ESXSSHPort:          defaultSSHPort,
+		ESXSSHUser:          "root",
+		ESXSSHPassword:      esxPassword,
+		NodeSSHPort:         defaultSSHPort,
+		NodeSSHUser:         "root",
+		NodeSSHPassword:     k8sNodePassword,
+	}
+}
+
+// initEnvConfig loads the environment of this run from the file given by
+// E2E_ENV_CONFIG_FILE, if any, and the ENV variables.
+func initEnvConfig() error {
+	cfg, err := loadEnvConfig(os.Getenv(envE2EEnvConfigFile), os.LookupEnv)
+	if err != nil {
+		return err
+	}
+	e2eEnv = cfg
+	return nil
+}
+
+// loadEnvConfig returns the defaults, overridden by the YAML file at path
+// when it is not empty, overridden by the variables returned by lookupEnv.
+func loadEnvConfig(path string, lookupEnv func(string) (string, bool)) (*e2eEnvConfig, error) {
+	cfg := defaultEnvConfig()
+	if path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+		}
+	}
+
+	v := reflect.ValueOf(cfg).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		name := v.Type().Field(i).Tag.Get("env")
+		value, ok := lookupEnv(name)
+		if !ok || value == "" {
+			continue
+		}
+		switch field := v.Field(i); field.Kind() {
+		case reflect.String:
+			field.SetString(value)
+		case reflect.Int:
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse ENV %s: %v", name, err)
+			}
+			field.SetInt(int64(n))
+		}
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (c *e2eEnvConfig) validate() error {
+	if c.FullSyncWaitTime <= 0 || c.FullSyncWaitTime > defaultFullSyncWaitTime {
+		return fmt.Errorf("fullSyncWaitTime %d is not within (0, %d]", c.FullSyncWaitTime, defaultFullSyncWaitTime)
+	}
+	for name, value := range map[string]int{
+		"pandoraSyncWaitTime": c.PandoraSyncWaitTime,
+		"vcRebootWaitTime":    c.VCRebootWaitTime,
+		"scaleVolumeCount":    c.ScaleVolumeCount,
+		"scaleConcurrency":    c.ScaleConcurrency,
+		"vCenterSSHPort":      c.VCenterSSHPort,
+		"esxSSHPort":          c.ESXSSHPort,
+		"nodeSSHPort":         c.NodeSSHPort,
+	} {
+		if value <= 0 {
+			return fmt.Errorf("%s %d must be positive", name, value)
+		}
+	}
+	if c.SSHBastion != "" {
+		if _, _, err := net.SplitHostPort(c.SSHBastion); err != nil {
+			return fmt.Errorf("sshBastion %q is not a host:port address: %v", c.SSHBastion, err)
+		}
+	}
+	if c.VolumeOpsScale < 0 {
+		return fmt.Errorf("volumeOpsScale %d must not be negative", c.VolumeOpsScale)
+	}
+	return nil
+}
+
+// lookup returns the value of the setting read from the ENV variable
+// varName, and false if no setting is read from it.
+func (c *e2eEnvConfig) lookup(varName string) (string, bool) {
+	v := reflect.ValueOf(c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if v.Type().Field(i).Tag.Get("env") != varName {
+			continue
+		}
+		switch field := v.Field(i); field.Kind() {
+		case reflect.Int:
+			if field.Int() == 0 {
+				return "", true
+			}
+			return strconv.FormatInt(field.Int(), 10), true
+		default:
+			return field.String(), true
+		}
+	}
+	return "", false
+}
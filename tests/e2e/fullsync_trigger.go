@@ -0,0 +1,158 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/kubernetes/test/e2e/framework"
+
+	triggercsifullsyncv1alpha1 "sigs.k8s.io/vsphere-csi-driver/pkg/internalapis/cnsoperator/triggercsifullsync/v1alpha1"
+)
+
+const (
+	crdTriggerCsiFullSync = "triggercsifullsyncs"
+	fullSyncPollInterval  = 5 * time.Second
+)
+
+// errFullSyncTriggerUnavailable is returned when the TriggerCsiFullSync
+// instance does not exist, i.e. the trigger-csi-fullsync feature is disabled.
+var errFullSyncTriggerUnavailable = fmt.Errorf("%s instance %q not found",
+	crdTriggerCsiFullSync, triggercsifullsyncv1alpha1.TriggerCsiFullSyncCRName)
+
+// waitForFullSync makes sure a full sync cycle has completed after this call.
+// It triggers a full sync through the TriggerCsiFullSync instance and polls
+// until the syncer reports the run as finished, waiting at most the given
+// number of seconds. When the trigger is not available on the cluster it
+// falls back to sleeping for the full duration, which is how long a periodic
+// full sync may take to kick in.
+func waitForFullSync(seconds int) {
+	start := time.Now()
+	defer func() {
+		recordTiming(metricFullSyncWait, time.Since(start))
+	}()
+	timeout := time.Duration(seconds) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	err := triggerFullSyncAndWait(ctx, timeout)
+	if err == nil {
+		return
+	}
+	framework.Logf("Could not trigger full sync on demand: %v", err)
+	if remaining := timeout - time.Since(start); remaining > 0 {
+		framework.Logf("Sleeping for the remaining %v to allow periodic full sync to finish", remaining)
+		time.Sleep(remaining)
+	}
+}
+
+// triggerFullSyncAndWait triggers a full sync and waits until a full sync
+// which started after the trigger has completed.
+func triggerFullSyncAndWait(ctx context.Context, timeout time.Duration) error {
+	restConfig, err := framework.LoadConfig()
+	if err != nil {
+		return err
+	}
+	dynamicClient, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return err
+	}
+	gvr := schema.GroupVersionResource{Group: crdGroup, Version: crdVersion, Resource: crdTriggerCsiFullSync}
+	resourceClient := dynamicClient.Resource(gvr)
+
+	return wait.PollImmediate(fullSyncPollInterval, timeout, func() (bool, error) {
+		// Second granularity of the status timestamps.
+		triggerTime := time.Now().Truncate(time.Second)
+		triggerSyncID, err := triggerFullSync(ctx, resourceClient)
+		if err != nil {
+			return false, err
+		}
+		framework.Logf("Triggered full sync with triggerSyncID: %d", triggerSyncID)
+		var instance *triggercsifullsyncv1alpha1.TriggerCsiFullSync
+		err = wait.PollImmediate(fullSyncPollInterval, timeout, func() (bool, error) {
+			instance, err = getTriggerCsiFullSync(ctx, resourceClient)
+			if err != nil {
+				return false, err
+			}
+			return instance.Status.LastTriggerSyncID >= triggerSyncID && !instance.Status.InProgress, nil
+		})
+		if err != nil {
+			return false, err
+		}
+		// The syncer ignores a trigger received while a full sync is already
+		// running; trigger again in that case so that the run observed below
+		// started after this call.
+		if instance.Status.LastRunStartTimeStamp == nil ||
+			instance.Status.LastRunStartTimeStamp.Time.Before(triggerTime) {
+			framework.Logf("Full sync with triggerSyncID: %d was skipped as another full sync was in progress", triggerSyncID)
+			return false, nil
+		}
+		if instance.Status.Error != "" {
+			framework.Logf("Full sync with triggerSyncID: %d finished with error: %s", triggerSyncID, instance.Status.Error)
+		} else {
+			framework.Logf("Full sync with triggerSyncID: %d finished successfully", triggerSyncID)
+		}
+		return true, nil
+	})
+}
+
+// triggerFullSync bumps the TriggerSyncID of the TriggerCsiFullSync instance
+// and returns the new value.
+func triggerFullSync(ctx context.Context, resourceClient dynamic.NamespaceableResourceInterface) (uint64, error) {
+	var triggerSyncID uint64
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		instance, err := getTriggerCsiFullSync(ctx, resourceClient)
+		if err != nil {
+			return err
+		}
+		triggerSyncID = instance.Status.LastTriggerSyncID + 1
+		instance.Spec.TriggerSyncID = triggerSyncID
+		obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(instance)
+		if err != nil {
+			return err
+		}
+		_, err = resourceClient.Update(ctx, &unstructured.Unstructured{Object: obj}, metav1.UpdateOptions{})
+		return err
+	})
+	return triggerSyncID, err
+}
+
+// getTriggerCsiFullSync returns the TriggerCsiFullSync instance.
+func getTriggerCsiFullSync(ctx context.Context,
+	resourceClient dynamic.NamespaceableResourceInterface) (*triggercsifullsyncv1alpha1.TriggerCsiFullSync, error) {
+	obj, err := resourceClient.Get(ctx, triggercsifullsyncv1alpha1.TriggerCsiFullSyncCRName, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, errFullSyncTriggerUnavailable
+		}
+		return nil, err
+	}
+	instance := &triggercsifullsyncv1alpha1.TriggerCsiFullSync{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, instance); err != nil {
+		return nil, err
+	}
+	return instance, nil
+}
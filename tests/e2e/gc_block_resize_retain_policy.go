@@ -19,7 +19,6 @@ package e2e
 import (
 	"context"
 	"fmt"
-	"os"
 	"strings"
 
 	"github.com/onsi/ginkgo"
@@ -39,6 +38,7 @@ import (
 )
 
 var _ = ginkgo.Describe("[csi-guest] Volume Expansion Tests with reclaimation policy retain", func() {
+	ginkgo.BeforeEach(withLabels(labelBlock, labelGuest))
 	f := framework.NewDefaultFramework("gc-resize-reclaim-policy-retain")
 	var (
 		client            clientset.Interface
@@ -91,7 +91,7 @@ var _ = ginkgo.Describe("[csi-guest] Volume Expansion Tests with reclaimation po
 		var pvclaims []*v1.PersistentVolumeClaim
 		pvclaims = append(pvclaims, pvclaim)
 		ginkgo.By("Waiting for all claims to be in bound state")
-		persistentvolumes, err := fpv.WaitForPVClaimBoundPhase(client, pvclaims, framework.ClaimProvisionTimeout)
+		persistentvolumes, err := waitForPVClaimBoundPhase(client, pvclaims, framework.ClaimProvisionTimeout)
 		gomega.Expect(err).NotTo(gomega.HaveOccurred())
 		pv = persistentvolumes[0]
 		volHandle = getVolumeIDFromSupervisorCluster(pv.Spec.CSI.VolumeHandle)
@@ -350,7 +350,7 @@ var _ = ginkgo.Describe("[csi-guest] Volume Expansion Tests with reclaimation po
 	ginkgo.It("PV with reclaim policy retain can be resized when used in a fresh GC", func() {
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
-		newGcKubconfigPath := os.Getenv("NEW_GUEST_CLUSTER_KUBE_CONFIG")
+		newGcKubconfigPath := e2eEnv.NewGuestClusterKubeconfig
 		if newGcKubconfigPath == "" {
 			ginkgo.Skip("Env NEW_GUEST_CLUSTER_KUBE_CONFIG is missing")
 		}
@@ -396,7 +396,7 @@ var _ = ginkgo.Describe("[csi-guest] Volume Expansion Tests with reclaimation po
 		var pvcs []*v1.PersistentVolumeClaim
 		pvcs = append(pvcs, pvc)
 		ginkgo.By("Waiting for all claims to be in bound state")
-		pvs, err := fpv.WaitForPVClaimBoundPhase(clientNewGc, pvcs, framework.ClaimProvisionTimeout)
+		pvs, err := waitForPVClaimBoundPhase(clientNewGc, pvcs, framework.ClaimProvisionTimeout)
 		gomega.Expect(err).NotTo(gomega.HaveOccurred())
 		pvtemp := pvs[0]
 
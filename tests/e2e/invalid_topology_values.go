@@ -39,6 +39,7 @@ const (
 )
 
 var _ = ginkgo.Describe("[csi-topology-vanilla] Topology-Aware-Provisioning-With-Invalid-Zone-And-Region", func() {
+	ginkgo.BeforeEach(withLabels(labelBlock, labelTopology, labelVanilla))
 	f := framework.NewDefaultFramework("e2e-vsphere-topology-aware-provisioning")
 	var (
 		client            clientset.Interface
@@ -0,0 +1,271 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	pkgtypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/kubernetes/test/e2e/framework"
+	fssh "k8s.io/kubernetes/test/e2e/framework/ssh"
+)
+
+const (
+	csiMigrationFeatureGates = "CSIMigration=true,CSIMigrationvSphere=true"
+	// kcmMigrationPatchFile is the kubeadm patch carrying the migration feature
+	// gates so that "kubeadm upgrade" does not revert the manifest edits.
+	kcmMigrationPatchFile = kcmName + "0+json.json"
+)
+
+// controlPlaneNode is a control plane node reachable over SSH.
+type controlPlaneNode struct {
+	name string
+	ip   string
+}
+
+// getK8sMasterNodes returns every control plane node of a vanilla setup along
+// with its external IP.
+func getK8sMasterNodes(ctx context.Context, client clientset.Interface) ([]controlPlaneNode, error) {
+	nodes, err := client.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	var masters []controlPlaneNode
+	for _, node := range nodes.Items {
+		if !strings.Contains(node.Name, "master") && !strings.Contains(node.Name, "control") {
+			continue
+		}
+		for _, addr := range node.Status.Addresses {
+			if addr.Type == v1.NodeExternalIP && (net.ParseIP(addr.Address)).To4() != nil {
+				masters = append(masters, controlPlaneNode{name: node.Name, ip: addr.Address})
+				break
+			}
+		}
+	}
+	if len(masters) == 0 {
+		return nil, fmt.Errorf("unable to find k8s control plane IP")
+	}
+	return masters, nil
+}
+
+// toggleCSIMigrationFeatureGatesOnKubeControllerManager adds/removes CSIMigration
+// and CSIMigrationvSphere feature gates to/from kube-controller-manager.
+// On multi-master clusters the static pod manifest of every control plane node
+// is edited in turn, waiting for the local kube-controller-manager to come
+// back before moving on to the next node, and finally for a restarted
+// instance to acquire the leader lease. When the node has a kubeadm patches
+// directory the feature gates are also recorded there.
+func toggleCSIMigrationFeatureGatesOnKubeControllerManager(ctx context.Context, client clientset.Interface, add bool) error {
+	if !vanillaCluster {
+		return fmt.Errorf("'toggleCSIMigrationFeatureGatesToKubeControllerManager' is implemented for vanilla cluster alone")
+	}
+	masters, err := getK8sMasterNodes(ctx, client)
+	if err != nil {
+		return err
+	}
+	sshClientConfig := nodeSSHClientConfig()
+	oldLeader, err := getKubeControllerManagerLeader(ctx, client)
+	if err != nil {
+		return err
+	}
+	start := time.Now().Truncate(time.Second)
+	restarted := false
+	for _, master := range masters {
+		oldUID, err := getKubeControllerManagerPodUID(ctx, client, master.name)
+		if err != nil {
+			return err
+		}
+		changed, err := toggleCSIMigrationFeatureGatesOnHost(sshClientConfig, master.ip, add)
+		if err != nil {
+			return err
+		}
+		if !changed {
+			continue
+		}
+		restarted = true
+		framework.Logf("Waiting for 'kube-controller-manager' controller pod on node %s to come up within %v",
+			master.name, pollTimeout)
+		err = waitForKubeControllerManagerPodRestart(ctx, client, master.name, oldUID)
+		if err != nil {
+			return err
+		}
+		framework.Logf("'kube-controller-manager' controller pod on node %s is up and ready", master.name)
+	}
+	if !restarted || oldLeader == "" {
+		return nil
+	}
+	framework.Logf("Waiting for 'kube-controller-manager' leader re-election within %v", pollTimeout)
+	return waitForKubeControllerManagerLeader(ctx, client, oldLeader, start)
+}
+
+// toggleCSIMigrationFeatureGatesOnHost edits the kube-controller-manager
+// manifest and kubeadm patches on the given control plane host. It returns
+// whether the manifest was modified.
+func toggleCSIMigrationFeatureGatesOnHost(sshClientConfig *ssh.ClientConfig, host string, add bool) (bool, error) {
+	if err := toggleCSIMigrationKubeadmPatch(sshClientConfig, host, add); err != nil {
+		return false, err
+	}
+	sshCmd := ""
+	if add {
+		sshCmd = "sed -i -e 's/CSIMigration=false,CSIMigrationvSphere=false/" + csiMigrationFeatureGates + "/g' " + kcmManifest
+	} else {
+		sshCmd = "sed -i '/CSIMigration/d' " + kcmManifest
+	}
+	grepCmd := "grep CSIMigration " + kcmManifest
+	framework.Logf("Invoking command '%v' on host %v", grepCmd, host)
+	result, err := sshExec(sshClientConfig, host, grepCmd)
+	if err != nil {
+		fssh.LogResult(result)
+		return false, fmt.Errorf("command failed/couldn't execute command: %s on host: %v , error: %s", grepCmd, host, err)
+	}
+	if result.Code != 0 {
+		if add {
+			sshCmd = "gawk -i inplace '/--bind-addres/ { print; print \"    - --feature-gates=" +
+				csiMigrationFeatureGates + "\"; next }1' " + kcmManifest
+		} else {
+			return false, nil
+		}
+	} else if add && strings.Contains(result.Stdout, csiMigrationFeatureGates) {
+		return false, nil
+	}
+	framework.Logf("Invoking command %v on host %v", sshCmd, host)
+	result, err = sshExec(sshClientConfig, host, sshCmd)
+	if err != nil || result.Code != 0 {
+		fssh.LogResult(result)
+		return false, fmt.Errorf("couldn't execute command: %s on host: %v , error: %s", sshCmd, host, err)
+	}
+	return true, nil
+}
+
+// toggleCSIMigrationKubeadmPatch adds/removes a kubeadm JSON patch setting the
+// migration feature gates on kube-controller-manager. Hosts without a kubeadm
+// patches directory are left untouched. The directory defaults to
+// /etc/kubernetes/patches and can be overridden with KUBEADM_PATCHES_DIR.
+func toggleCSIMigrationKubeadmPatch(sshClientConfig *ssh.ClientConfig, host string, add bool) error {
+	patchesDir := e2eEnv.KubeadmPatchesDir
+	if patchesDir == "" {
+		patchesDir = kubeadmPatchesDir
+	}
+	testCmd := "test -d " + patchesDir
+	result, err := sshExec(sshClientConfig, host, testCmd)
+	if err != nil {
+		fssh.LogResult(result)
+		return fmt.Errorf("couldn't execute command: %s on host: %v , error: %s", testCmd, host, err)
+	}
+	if result.Code != 0 {
+		return nil
+	}
+	patchFile := filepath.Join(patchesDir, kcmMigrationPatchFile)
+	sshCmd := "rm -f " + patchFile
+	if add {
+		sshCmd = "echo '[{\"op\": \"add\", \"path\": \"/spec/containers/0/command/-\", " +
+			"\"value\": \"--feature-gates=" + csiMigrationFeatureGates + "\"}]' > " + patchFile
+	}
+	framework.Logf("Invoking command %v on host %v", sshCmd, host)
+	result, err = sshExec(sshClientConfig, host, sshCmd)
+	if err != nil || result.Code != 0 {
+		fssh.LogResult(result)
+		return fmt.Errorf("couldn't execute command: %s on host: %v , error: %s", sshCmd, host, err)
+	}
+	return nil
+}
+
+// getKubeControllerManagerPodUID returns the UID of the kube-controller-manager
+// mirror pod running on the given node, or an empty UID if there is none.
+func getKubeControllerManagerPodUID(ctx context.Context, client clientset.Interface,
+	nodeName string) (pkgtypes.UID, error) {
+	pod, err := client.CoreV1().Pods(kubeSystemNamespace).Get(ctx, kcmName+"-"+nodeName, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	return pod.UID, nil
+}
+
+// waitForKubeControllerManagerPodRestart waits until the kube-controller-manager
+// mirror pod on the given node has been recreated and is ready.
+func waitForKubeControllerManagerPodRestart(ctx context.Context, client clientset.Interface,
+	nodeName string, oldUID pkgtypes.UID) error {
+	podName := kcmName + "-" + nodeName
+	return wait.PollImmediate(poll, pollTimeout, func() (bool, error) {
+		pod, err := client.CoreV1().Pods(kubeSystemNamespace).Get(ctx, podName, metav1.GetOptions{})
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				return false, nil
+			}
+			return false, err
+		}
+		if pod.UID == oldUID || pod.Status.Phase != v1.PodRunning {
+			return false, nil
+		}
+		for _, condition := range pod.Status.Conditions {
+			if condition.Type == v1.PodReady {
+				return condition.Status == v1.ConditionTrue, nil
+			}
+		}
+		return false, nil
+	})
+}
+
+// getKubeControllerManagerLeader returns the holder of the kube-controller-manager
+// leader lease, or an empty string if leader election is not in use.
+func getKubeControllerManagerLeader(ctx context.Context, client clientset.Interface) (string, error) {
+	lease, err := client.CoordinationV1().Leases(kubeSystemNamespace).Get(ctx, kcmName, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	if lease.Spec.HolderIdentity == nil {
+		return "", nil
+	}
+	return *lease.Spec.HolderIdentity, nil
+}
+
+// waitForKubeControllerManagerLeader waits until the kube-controller-manager
+// leader lease is held by an instance other than oldLeader and has been
+// renewed after the given time. Every instance gets a new identity when it
+// restarts, so this is satisfied once a restarted instance took over.
+func waitForKubeControllerManagerLeader(ctx context.Context, client clientset.Interface,
+	oldLeader string, after time.Time) error {
+	return wait.PollImmediate(poll, pollTimeout, func() (bool, error) {
+		lease, err := client.CoordinationV1().Leases(kubeSystemNamespace).Get(ctx, kcmName, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity == oldLeader ||
+			lease.Spec.RenewTime == nil || lease.Spec.RenewTime.Time.Before(after) {
+			return false, nil
+		}
+		framework.Logf("'kube-controller-manager' leader lease is held by %s", *lease.Spec.HolderIdentity)
+		return true, nil
+	})
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package labelfilter evaluates the label filter expressions e2e specs are
+// selected with. The syntax is the one of the --label-filter of ginkgo v2, so
+// that CI jobs don't need to change once the suite moves to it.
+package labelfilter
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Match evaluates filter against the given labels. It accepts &&, || (or ,),
+// ! and parentheses, with ! binding tighter than &&, which binds tighter than
+// || and ,. Label comparison is case-insensitive.
+func Match(filter string, labels []string) (bool, error) {
+	set := make(map[string]bool, len(labels))
+	for _, label := range labels {
+		set[strings.ToLower(label)] = true
+	}
+	p := &parser{tokens: tokenize(filter)}
+	result, err := p.parseOr(set)
+	if err != nil {
+		return false, err
+	}
+	if p.pos != len(p.tokens) {
+		return false, fmt.Errorf("unexpected token %q", p.tokens[p.pos])
+	}
+	return result, nil
+}
+
+// tokenize splits a filter expression into operators and labels.
+func tokenize(filter string) []string {
+	var tokens []string
+	var current strings.Builder
+	flush := func() {
+		if current.Len() > 0 {
+			tokens = append(tokens, strings.ToLower(current.String()))
+			current.Reset()
+		}
+	}
+	for i := 0; i < len(filter); i++ {
+		c := filter[i]
+		switch {
+		case unicode.IsSpace(rune(c)):
+			flush()
+		case c == '(' || c == ')' || c == '!' || c == ',':
+			flush()
+			tokens = append(tokens, string(c))
+		case (c == '&' || c == '|') && i+1 < len(filter) && filter[i+1] == c:
+			flush()
+			tokens = append(tokens, string([]byte{c, c}))
+			i++
+		default:
+			current.WriteByte(c)
+		}
+	}
+	flush()
+	return tokens
+}
+
+// parser is a recursive descent parser for label filters with the
+// usual precedence: ! binds tighter than &&, which binds tighter than || and ','.
+type parser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *parser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *parser) parseOr(labels map[string]bool) (bool, error) {
+	result, err := p.parseAnd(labels)
+	if err != nil {
+		return false, err
+	}
+	for p.peek() == "||" || p.peek() == "," {
+		p.pos++
+		rhs, err := p.parseAnd(labels)
+		if err != nil {
+			return false, err
+		}
+		result = result || rhs
+	}
+	return result, nil
+}
+
+func (p *parser) parseAnd(labels map[string]bool) (bool, error) {
+	result, err := p.parseUnary(labels)
+	if err != nil {
+		return false, err
+	}
+	for p.peek() == "&&" {
+		p.pos++
+		rhs, err := p.parseUnary(labels)
+		if err != nil {
+			return false, err
+		}
+		result = result && rhs
+	}
+	return result, nil
+}
+
+func (p *parser) parseUnary(labels map[string]bool) (bool, error) {
+	switch token := p.peek(); token {
+	case "":
+		return false, fmt.Errorf("unexpected end of expression")
+	case "!":
+		p.pos++
+		result, err := p.parseUnary(labels)
+		return !result, err
+	case "(":
+		p.pos++
+		result, err := p.parseOr(labels)
+		if err != nil {
+			return false, err
+		}
+		if p.peek() != ")" {
+			return false, fmt.Errorf("missing closing parenthesis")
+		}
+		p.pos++
+		return result, nil
+	case ")", "&&", "||", ",":
+		return false, fmt.Errorf("unexpected token %q", token)
+	default:
+		p.pos++
+		return labels[token], nil
+	}
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package labelfilter
+
+import "testing"
+
+func TestMatch(t *testing.T) {
+	labels := []string{"block", "vanilla", "Disruptive"}
+	tests := []struct {
+		filter   string
+		expected bool
+		err      bool
+	}{
+		{filter: "block", expected: true},
+		{filter: "file", expected: false},
+		// Labels are compared case-insensitively.
+		{filter: "BLOCK && disruptive", expected: true},
+		{filter: "block && !disruptive", expected: false},
+		{filter: "file || vanilla", expected: true},
+		{filter: "file,migration", expected: false},
+		{filter: "!!block", expected: true},
+		// ! binds tighter than &&, which binds tighter than || and ,.
+		{filter: "file && block || vanilla", expected: true},
+		{filter: "file && (block || vanilla)", expected: false},
+		{filter: "file, block && !topology", expected: true},
+		{filter: "!file && block", expected: true},
+		{filter: "!(file || block)", expected: false},
+		{filter: "  block&&vanilla  ", expected: true},
+		{filter: "", err: true},
+		{filter: "block &&", err: true},
+		{filter: "(block", err: true},
+		{filter: "block)", err: true},
+		{filter: "block vanilla", err: true},
+		{filter: "|| block", err: true},
+	}
+	for _, test := range tests {
+		match, err := Match(test.filter, labels)
+		if test.err {
+			if err == nil {
+				t.Errorf("filter %q: expected error, got match %t", test.filter, match)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("filter %q: unexpected error: %v", test.filter, err)
+		} else if match != test.expected {
+			t.Errorf("filter %q: expected match %t, got %t", test.filter, test.expected, match)
+		}
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	tokens := tokenize("(Block&&!file)||snapshot, multi-master")
+	expected := []string{"(", "block", "&&", "!", "file", ")", "||", "snapshot", ",", "multi-master"}
+	if len(tokens) != len(expected) {
+		t.Fatalf("expected tokens %q, got %q", expected, tokens)
+	}
+	for i := range tokens {
+		if tokens[i] != expected[i] {
+			t.Fatalf("expected tokens %q, got %q", expected, tokens)
+		}
+	}
+}
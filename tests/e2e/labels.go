@@ -0,0 +1,82 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/onsi/ginkgo"
+
+	"sigs.k8s.io/vsphere-csi-driver/tests/e2e/labelfilter"
+)
+
+// Labels used to classify e2e specs. Every top-level Describe registers its
+// labels through withLabels so that a run can be narrowed down with
+// -label-filter instead of regex matching on the Describe text.
+//
+// The k8s.io/kubernetes e2e framework vendored by this repo (v1.20) is built
+// against ginkgo v1, which has no native label support, so the suite can't move
+// to ginkgo v2 before the framework does. Until then the filter is evaluated by
+// the labelfilter package, compatible with ginkgo v2's --label-filter.
+//
+// TODO: Migrate the suite to github.com/onsi/ginkgo/v2 once the module moves to
+// a v1.25 or later framework, replacing withLabels with the ginkgo.Label
+// decorator and -label-filter with ginkgo's --label-filter.
+const (
+	labelBlock       = "block"
+	labelFile        = "file"
+	labelSnapshot    = "snapshot"
+	labelMigration   = "migration"
+	labelTopology    = "topology"
+	labelVanilla     = "vanilla"
+	labelSupervisor  = "supervisor"
+	labelGuest       = "guest"
+	labelWindows     = "windows"
+	labelMultiMaster = "multi-master"
+	labelSerial      = "serial"
+	labelDisruptive  = "disruptive"
+)
+
+// labelFilter holds the value of the -label-filter flag.
+var labelFilter string
+
+// registerLabelFlags registers flags used to select specs by label.
+func registerLabelFlags(flags *flag.FlagSet) {
+	flags.StringVar(&labelFilter, "label-filter", "",
+		"Run only specs whose labels match the given expression, e.g. "+
+			"\"block && !disruptive\" or \"file,migration\". Supports &&, ||, ',', ! and parentheses.")
+}
+
+// withLabels returns a BeforeEach body which skips the current spec when its
+// labels do not satisfy the -label-filter expression. It must be registered
+// before framework.NewDefaultFramework so that no namespace is created for
+// specs which are filtered out.
+func withLabels(labels ...string) func() {
+	return func() {
+		if labelFilter == "" {
+			return
+		}
+		match, err := labelfilter.Match(labelFilter, labels)
+		if err != nil {
+			ginkgo.Fail(fmt.Sprintf("invalid -label-filter %q: %v", labelFilter, err))
+		}
+		if !match {
+			ginkgo.Skip(fmt.Sprintf("labels %v do not match -label-filter %q", labels, labelFilter))
+		}
+	}
+}
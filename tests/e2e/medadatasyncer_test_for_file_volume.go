@@ -35,6 +35,7 @@ import (
 )
 
 var _ bool = ginkgo.Describe("[csi-file-vanilla] label-updates for file volumes", func() {
+	ginkgo.BeforeEach(withLabels(labelFile, labelVanilla))
 	f := framework.NewDefaultFramework("e2e-file-volume-label-updates")
 	var (
 		client       clientset.Interface
@@ -99,7 +100,7 @@ var _ bool = ginkgo.Describe("[csi-file-vanilla] label-updates for file volumes"
 		gomega.Expect(err).NotTo(gomega.HaveOccurred())
 
 		ginkgo.By(fmt.Sprintf("Waiting for claim %s to be in bound phase", pvc.Name))
-		pvs, err := fpv.WaitForPVClaimBoundPhase(client, []*v1.PersistentVolumeClaim{pvc}, framework.ClaimProvisionTimeout)
+		pvs, err := waitForPVClaimBoundPhase(client, []*v1.PersistentVolumeClaim{pvc}, framework.ClaimProvisionTimeout)
 		gomega.Expect(err).NotTo(gomega.HaveOccurred())
 		gomega.Expect(pvs).NotTo(gomega.BeEmpty())
 		pv := pvs[0]
@@ -0,0 +1,201 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/kubernetes/test/e2e/framework"
+	fpod "k8s.io/kubernetes/test/e2e/framework/pod"
+)
+
+// Operating systems of the worker nodes, as reported by the kubernetes.io/os
+// node label.
+const (
+	nodeOSLabel   = "kubernetes.io/os"
+	nodeOSLinux   = "linux"
+	nodeOSWindows = "windows"
+)
+
+const (
+	ntfsFSType             = "ntfs"
+	windowsImage           = "mcr.microsoft.com/windows/servercore:ltsc2019"
+	windowsIdleCommand     = "while ($true) { Start-Sleep -Seconds 1 }"
+	windowsPodStartTimeout = 10 * time.Minute
+	windowsVolumeMountPath = "C:\\mnt\\volume%v"
+)
+
+// getNodesForOS returns the ready nodes running the given operating system.
+func getNodesForOS(ctx context.Context, client clientset.Interface, nodeOS string) ([]v1.Node, error) {
+	nodes, err := client.CoreV1().Nodes().List(ctx, metav1.ListOptions{
+		LabelSelector: nodeOSLabel + "=" + nodeOS,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var ready []v1.Node
+	for _, node := range nodes.Items {
+		for _, condition := range node.Status.Conditions {
+			if condition.Type == v1.NodeReady && condition.Status == v1.ConditionTrue {
+				ready = append(ready, node)
+				break
+			}
+		}
+	}
+	return ready, nil
+}
+
+// getVolumeMountPathForOS returns the path at which makePodForOS mounts the
+// index-th (1 based) claim.
+func getVolumeMountPathForOS(nodeOS string, index int) string {
+	if nodeOS == nodeOSWindows {
+		return fmt.Sprintf(windowsVolumeMountPath, index)
+	}
+	return fmt.Sprintf("/mnt/volume%v", index)
+}
+
+// makePodForOS returns a pod definition mounting the given claims which is
+// scheduled on a node running nodeOS. An empty command keeps the pod idle.
+// Windows pods run PowerShell on a servercore image and are never privileged.
+func makePodForOS(namespace string, nodeOS string, nodeSelector map[string]string,
+	pvclaims []*v1.PersistentVolumeClaim, command string) *v1.Pod {
+	if nodeOS != nodeOSWindows {
+		pod := fpod.MakePod(namespace, nodeSelector, pvclaims, false, command)
+		pod.Spec.Containers[0].Image = busyBoxImageOnGcr
+		if pod.Spec.NodeSelector == nil {
+			pod.Spec.NodeSelector = map[string]string{}
+		}
+		pod.Spec.NodeSelector[nodeOSLabel] = nodeOSLinux
+		return pod
+	}
+	if command == "" {
+		command = windowsIdleCommand
+	}
+	pod := fpod.MakePod(namespace, nodeSelector, pvclaims, false, command)
+	container := &pod.Spec.Containers[0]
+	container.Image = windowsImage
+	container.Command = []string{"powershell.exe", "-Command"}
+	container.Args = []string{command}
+	container.SecurityContext = nil
+	for i := range container.VolumeMounts {
+		container.VolumeMounts[i].MountPath = getVolumeMountPathForOS(nodeOSWindows, i+1)
+	}
+	if pod.Spec.NodeSelector == nil {
+		pod.Spec.NodeSelector = map[string]string{}
+	}
+	pod.Spec.NodeSelector[nodeOSLabel] = nodeOSWindows
+	return pod
+}
+
+// createPodForOS creates a pod built by makePodForOS and waits for it to be
+// running. Windows images are large, so the wait is longer than for Linux.
+func createPodForOS(client clientset.Interface, namespace string, nodeOS string, nodeSelector map[string]string,
+	pvclaims []*v1.PersistentVolumeClaim, command string) (*v1.Pod, error) {
+	pod := makePodForOS(namespace, nodeOS, nodeSelector, pvclaims, command)
+	start := time.Now()
+	pod, err := client.CoreV1().Pods(namespace).Create(context.TODO(), pod, metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("pod Create API error: %v", err)
+	}
+	timeout := framework.PodStartTimeout
+	if nodeOS == nodeOSWindows {
+		timeout = windowsPodStartTimeout
+	}
+	err = fpod.WaitTimeoutForPodRunningInNamespace(client, pod.Name, namespace, timeout)
+	if err != nil {
+		return pod, fmt.Errorf("pod %q is not Running: %v", pod.Name, err)
+	}
+	if len(pvclaims) > 0 {
+		recordTiming(metricAttachLatency, time.Since(start))
+	}
+	pod, err = client.CoreV1().Pods(namespace).Get(context.TODO(), pod.Name, metav1.GetOptions{})
+	if err != nil {
+		return pod, fmt.Errorf("pod Get API error: %v", err)
+	}
+	return pod, nil
+}
+
+// execInPodForOS runs command in the first container of the pod through the
+// shell of the given operating system and returns its output.
+func execInPodForOS(namespace string, podName string, nodeOS string, command string) (string, error) {
+	shell := []string{"/bin/sh", "-c"}
+	if nodeOS == nodeOSWindows {
+		shell = []string{"powershell.exe", "-Command"}
+	}
+	args := append([]string{"exec", fmt.Sprintf("--namespace=%s", namespace), podName, "--"}, shell...)
+	args = append(args, command)
+	output, err := framework.RunKubectl(namespace, args...)
+	return strings.TrimSpace(output), err
+}
+
+// getFSTypeForOS returns the filesystem type of the volume mounted at
+// mountPath in the pod, in lower case.
+func getFSTypeForOS(namespace string, podName string, nodeOS string, mountPath string) (string, error) {
+	command := fmt.Sprintf("stat -f -c %%T %s", mountPath)
+	if nodeOS == nodeOSWindows {
+		command = fmt.Sprintf("(Get-Volume -FilePath %s).FileSystemType", mountPath)
+	}
+	output, err := execInPodForOS(namespace, podName, nodeOS, command)
+	if err != nil {
+		return "", err
+	}
+	return strings.ToLower(output), nil
+}
+
+// getFSSizeMbForOS returns the size in MB of the filesystem mounted at
+// mountPath in the pod.
+func getFSSizeMbForOS(namespace string, podName string, nodeOS string, mountPath string) (int64, error) {
+	command := fmt.Sprintf("df -m %s | tail -1 | awk '{print $2}'", mountPath)
+	if nodeOS == nodeOSWindows {
+		command = fmt.Sprintf("[math]::Floor((Get-Volume -FilePath %s).Size / 1MB)", mountPath)
+	}
+	output, err := execInPodForOS(namespace, podName, nodeOS, command)
+	if err != nil {
+		return -1, err
+	}
+	size, err := strconv.ParseInt(output, 10, 64)
+	if err != nil {
+		return -1, fmt.Errorf("failed to parse filesystem size %q of %s: %v", output, mountPath, err)
+	}
+	return size, nil
+}
+
+// writeDataOnFileForOS writes data to filePath from the given pod.
+func writeDataOnFileForOS(namespace string, podName string, nodeOS string, filePath string, data string) error {
+	command := fmt.Sprintf("echo %s > %s && sync", data, filePath)
+	if nodeOS == nodeOSWindows {
+		command = fmt.Sprintf("Set-Content -Path %s -Value %s", filePath, data)
+	}
+	_, err := execInPodForOS(namespace, podName, nodeOS, command)
+	return err
+}
+
+// readFileForOS returns the contents of filePath read from the given pod.
+func readFileForOS(namespace string, podName string, nodeOS string, filePath string) (string, error) {
+	command := fmt.Sprintf("cat %s", filePath)
+	if nodeOS == nodeOSWindows {
+		command = fmt.Sprintf("Get-Content -Path %s", filePath)
+	}
+	return execInPodForOS(namespace, podName, nodeOS, command)
+}
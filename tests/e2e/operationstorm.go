@@ -19,9 +19,7 @@ package e2e
 import (
 	"context"
 	"fmt"
-	"os"
 	"path/filepath"
-	"strconv"
 	"time"
 
 	"github.com/onsi/ginkgo"
@@ -55,6 +53,7 @@ import (
 */
 
 var _ = utils.SIGDescribe("[csi-block-vanilla] Volume Operations Storm", func() {
+	ginkgo.BeforeEach(withLabels(labelBlock, labelVanilla, labelSerial))
 	// TODO: Enable this test for WCP after it provides consistent results
 	f := framework.NewDefaultFramework("volume-ops-storm")
 	const defaultVolumeOpsScale = 30
@@ -79,9 +78,8 @@ var _ = utils.SIGDescribe("[csi-block-vanilla] Volume Operations Storm", func()
 			framework.Failf("Unable to find ready and schedulable Node")
 		}
 		bootstrap()
-		if os.Getenv("VOLUME_OPS_SCALE") != "" {
-			volumeOpsScale, err = strconv.Atoi(os.Getenv(envVolumeOperationsScale))
-			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		if e2eEnv.VolumeOpsScale != 0 {
+			volumeOpsScale = e2eEnv.VolumeOpsScale
 		} else {
 			if vanillaCluster {
 				volumeOpsScale = defaultVolumeOpsScale
@@ -147,7 +145,7 @@ var _ = utils.SIGDescribe("[csi-block-vanilla] Volume Operations Storm", func()
 		}
 
 		ginkgo.By("Waiting for all claims to be in bound state")
-		persistentvolumes, err = fpv.WaitForPVClaimBoundPhase(client, pvclaims, framework.ClaimProvisionTimeout)
+		persistentvolumes, err = waitForPVClaimBoundPhase(client, pvclaims, framework.ClaimProvisionTimeout)
 		gomega.Expect(err).NotTo(gomega.HaveOccurred())
 
 		ginkgo.By("Creating pod to attach PVs to the node")
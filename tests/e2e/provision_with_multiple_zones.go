@@ -35,6 +35,7 @@ import (
 )
 
 var _ = ginkgo.Describe("[csi-topology-vanilla] Topology-Aware-Provisioning-With-Multiple-Zones", func() {
+	ginkgo.BeforeEach(withLabels(labelBlock, labelTopology, labelVanilla))
 	f := framework.NewDefaultFramework("e2e-vsphere-topology-aware-provisioning")
 	var (
 		client               clientset.Interface
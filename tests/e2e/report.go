@@ -0,0 +1,265 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/onsi/ginkgo/config"
+	"github.com/onsi/ginkgo/types"
+	v1 "k8s.io/api/core/v1"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/kubernetes/test/e2e/framework"
+	fpv "k8s.io/kubernetes/test/e2e/framework/pv"
+)
+
+// Names of the timing metrics recorded by the suite.
+const (
+	metricProvisionLatency = "provision-latency"
+	metricAttachLatency    = "attach-latency"
+	metricFullSyncWait     = "full-sync-wait"
+)
+
+const (
+	junitReportFileName  = "junit.xml"
+	timingReportFileName = "timing-report.json"
+)
+
+// reportDir holds the value of the -report-dir flag.
+var reportDir string
+
+// registerReportFlags registers flags controlling where reports are written.
+func registerReportFlags(flags *flag.FlagSet) {
+	flags.StringVar(&reportDir, "report-dir", ".",
+		"Directory in which the JUnit ("+junitReportFileName+") and timing ("+timingReportFileName+") reports are written.")
+}
+
+// timingSample is a single measurement taken while a spec was running.
+type timingSample struct {
+	Metric  string  `json:"metric"`
+	Seconds float64 `json:"seconds"`
+}
+
+// specTiming captures the outcome and measurements of a single spec.
+type specTiming struct {
+	Name    string         `json:"name"`
+	State   string         `json:"state"`
+	Seconds float64        `json:"seconds"`
+	Samples []timingSample `json:"samples,omitempty"`
+}
+
+// metricSummary is the distribution of one metric across the whole run.
+type metricSummary struct {
+	Count int     `json:"count"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Mean  float64 `json:"mean"`
+	P50   float64 `json:"p50"`
+	P90   float64 `json:"p90"`
+	P99   float64 `json:"p99"`
+}
+
+// timingReport is the machine readable document written at the end of a run.
+type timingReport struct {
+	Suite     string                   `json:"suite"`
+	StartTime time.Time                `json:"startTime"`
+	Seconds   float64                  `json:"seconds"`
+	Specs     []specTiming             `json:"specs"`
+	Summary   map[string]metricSummary `json:"summary"`
+}
+
+// timingReporter is a ginkgo reporter collecting per spec durations along with
+// the samples recorded through recordTiming, and writing them as JSON once
+// the suite ends.
+type timingReporter struct {
+	lock    sync.Mutex
+	path    string
+	report  timingReport
+	current []timingSample
+}
+
+// timings is the reporter registered with the suite. recordTiming attaches
+// samples to the spec currently running on it.
+var timings *timingReporter
+
+// newTimingReporter returns a reporter writing its report to path.
+func newTimingReporter(path string) *timingReporter {
+	return &timingReporter{path: path}
+}
+
+// recordTiming records a measurement for the spec currently running.
+func recordTiming(metric string, d time.Duration) {
+	if timings == nil {
+		return
+	}
+	timings.lock.Lock()
+	defer timings.lock.Unlock()
+	timings.current = append(timings.current, timingSample{Metric: metric, Seconds: d.Seconds()})
+}
+
+// SpecSuiteWillBegin is called before any spec runs.
+func (r *timingReporter) SpecSuiteWillBegin(cfg config.GinkgoConfigType, summary *types.SuiteSummary) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.report.Suite = summary.SuiteDescription
+	r.report.StartTime = time.Now()
+}
+
+// BeforeSuiteDidRun is called after the BeforeSuite node ran.
+func (r *timingReporter) BeforeSuiteDidRun(setupSummary *types.SetupSummary) {}
+
+// SpecWillRun resets the samples collected for the previous spec.
+func (r *timingReporter) SpecWillRun(specSummary *types.SpecSummary) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.current = nil
+}
+
+// SpecDidComplete stores the outcome of a spec together with its samples.
+func (r *timingReporter) SpecDidComplete(specSummary *types.SpecSummary) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if specSummary.Skipped() {
+		r.current = nil
+		return
+	}
+	r.report.Specs = append(r.report.Specs, specTiming{
+		Name:    joinComponentTexts(specSummary.ComponentTexts),
+		State:   specStateString(specSummary.State),
+		Seconds: specSummary.RunTime.Seconds(),
+		Samples: r.current,
+	})
+	r.current = nil
+}
+
+// AfterSuiteDidRun is called after the AfterSuite node ran.
+func (r *timingReporter) AfterSuiteDidRun(setupSummary *types.SetupSummary) {}
+
+// SpecSuiteDidEnd writes the timing report.
+func (r *timingReporter) SpecSuiteDidEnd(summary *types.SuiteSummary) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.report.Seconds = summary.RunTime.Seconds()
+	r.report.Summary = summarizeTimings(r.report.Specs)
+	data, err := json.MarshalIndent(r.report, "", "  ")
+	if err != nil {
+		framework.Logf("failed to marshal timing report: %v", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		framework.Logf("failed to create directory for timing report %q: %v", r.path, err)
+		return
+	}
+	if err := ioutil.WriteFile(r.path, data, 0644); err != nil {
+		framework.Logf("failed to write timing report %q: %v", r.path, err)
+	}
+}
+
+// summarizeTimings computes the distribution of every metric over all specs.
+func summarizeTimings(specs []specTiming) map[string]metricSummary {
+	values := make(map[string][]float64)
+	for _, spec := range specs {
+		for _, sample := range spec.Samples {
+			values[sample.Metric] = append(values[sample.Metric], sample.Seconds)
+		}
+	}
+	summaries := make(map[string]metricSummary)
+	for metric, samples := range values {
+		summaries[metric] = summarizeSamples(samples)
+	}
+	return summaries
+}
+
+// summarizeSamples computes the distribution of a non-empty set of samples.
+// The slice is sorted in place.
+func summarizeSamples(samples []float64) metricSummary {
+	sort.Float64s(samples)
+	var total float64
+	for _, v := range samples {
+		total += v
+	}
+	return metricSummary{
+		Count: len(samples),
+		Min:   samples[0],
+		Max:   samples[len(samples)-1],
+		Mean:  total / float64(len(samples)),
+		P50:   percentile(samples, 50),
+		P90:   percentile(samples, 90),
+		P99:   percentile(samples, 99),
+	}
+}
+
+// percentile returns the nearest-rank percentile p of the sorted samples.
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func joinComponentTexts(texts []string) string {
+	name := ""
+	for _, text := range texts {
+		if text == "" {
+			continue
+		}
+		if name != "" {
+			name += " "
+		}
+		name += text
+	}
+	return name
+}
+
+func specStateString(state types.SpecState) string {
+	switch state {
+	case types.SpecStatePassed:
+		return "passed"
+	case types.SpecStateFailed:
+		return "failed"
+	case types.SpecStatePanicked:
+		return "panicked"
+	case types.SpecStateTimedOut:
+		return "timedout"
+	case types.SpecStateSkipped:
+		return "skipped"
+	case types.SpecStatePending:
+		return "pending"
+	}
+	return "invalid"
+}
+
+// waitForPVClaimBoundPhase waits until all claims are bound, recording the
+// time it took as provision latency.
+func waitForPVClaimBoundPhase(client clientset.Interface, pvclaims []*v1.PersistentVolumeClaim,
+	timeout time.Duration) ([]*v1.PersistentVolume, error) {
+	start := time.Now()
+	pvs, err := fpv.WaitForPVClaimBoundPhase(client, pvclaims, timeout)
+	if err == nil {
+		recordTiming(metricProvisionLatency, time.Since(start))
+	}
+	return pvs, err
+}
@@ -0,0 +1,47 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"os"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/kubernetes/test/e2e/framework"
+
+	"sigs.k8s.io/vsphere-csi-driver/tests/e2e/runid"
+)
+
+// initRunID sets the ID of this run from E2E_RUN_ID when it is given, so that
+// CI can pass the same ID to the cleanup tool after an aborted run. The
+// framework labels every test namespace with it.
+func initRunID() {
+	if id := os.Getenv(runid.EnvRunID); id != "" {
+		framework.RunID = types.UID(id)
+	}
+	framework.Logf("e2e run ID: %s", framework.RunID)
+}
+
+// e2eRunLabels returns the labels identifying objects created by this run.
+func e2eRunLabels() map[string]string {
+	return map[string]string{runid.Label: string(framework.RunID)}
+}
+
+// e2eRunScopedName returns name tagged with the ID of this run, for vSphere
+// objects which cannot carry labels.
+func e2eRunScopedName(name string) string {
+	return runid.ScopedName(name, string(framework.RunID))
+}
@@ -0,0 +1,52 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package runid defines how objects created by an e2e run are tagged with the
+// ID of that run, so that leftovers of aborted runs can be found and removed.
+package runid
+
+import "strings"
+
+const (
+	// Label is the label key carrying the run ID on Kubernetes objects. It is
+	// the key the Kubernetes e2e framework uses to label test namespaces.
+	Label = "e2e-run"
+	// EnvRunID overrides the randomly generated ID of a run.
+	EnvRunID = "E2E_RUN_ID"
+
+	tagPrefix = "e2e-"
+	tagLength = 8
+)
+
+// Tag returns the short form of the run ID appended to the names of vSphere
+// objects, such as FCDs and vmdk files, which do not support labels.
+func Tag(runID string) string {
+	id := strings.ToLower(strings.ReplaceAll(runID, "-", ""))
+	if len(id) > tagLength {
+		id = id[:tagLength]
+	}
+	return tagPrefix + id
+}
+
+// ScopedName returns name suffixed with the tag of the given run.
+func ScopedName(name string, runID string) string {
+	return name + "-" + Tag(runID)
+}
+
+// HasTag returns whether name was produced by ScopedName for the given run.
+func HasTag(name string, runID string) bool {
+	return strings.HasSuffix(strings.TrimSuffix(name, ".vmdk"), "-"+Tag(runID))
+}
@@ -0,0 +1,305 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"github.com/vmware/govmomi/vim25/methods"
+	vim25types "github.com/vmware/govmomi/vim25/types"
+	v1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/kubernetes/test/e2e/framework"
+	fpod "k8s.io/kubernetes/test/e2e/framework/pod"
+	fpv "k8s.io/kubernetes/test/e2e/framework/pv"
+)
+
+const (
+	defaultScaleVolumeCount = 300
+	defaultScaleConcurrency = 20
+	scaleReportFileName     = "scale-report.json"
+	vcTaskPageSize          = 100
+)
+
+// scaleReport is the machine readable result of a scale run.
+type scaleReport struct {
+	VolumeCount   int                      `json:"volumeCount"`
+	Concurrency   int                      `json:"concurrency"`
+	Failures      int                      `json:"failures"`
+	StartTime     time.Time                `json:"startTime"`
+	Seconds       float64                  `json:"seconds"`
+	VolumesPerMin float64                  `json:"volumesPerMinute"`
+	Latency       map[string]metricSummary `json:"latency"`
+	VCTasks       map[string]int           `json:"vcTasks"`
+	Errors        []string                 `json:"errors,omitempty"`
+}
+
+// scaleWorkload is a PVC and the pod using it.
+type scaleWorkload struct {
+	pvclaim *v1.PersistentVolumeClaim
+	pv      *v1.PersistentVolume
+	pod     *v1.Pod
+}
+
+var _ = ginkgo.Describe("[csi-scale-vanilla] Provisioning Throughput Scale Test", func() {
+	ginkgo.BeforeEach(withLabels(labelBlock, labelVanilla, labelSerial))
+	f := framework.NewDefaultFramework("scale")
+	var (
+		client       clientset.Interface
+		namespace    string
+		volumeCount  int
+		concurrency  int
+		storageclass *storagev1.StorageClass
+	)
+
+	ginkgo.BeforeEach(func() {
+		client = f.ClientSet
+		namespace = f.Namespace.Name
+		bootstrap()
+		volumeCount = e2eEnv.ScaleVolumeCount
+		concurrency = e2eEnv.ScaleConcurrency
+
+		storagePolicyName := GetAndExpectStringEnvVar(envStoragePolicyNameForSharedDatastores)
+		scParameters := map[string]string{scParamStoragePolicyName: storagePolicyName}
+		var err error
+		storageclass, err = createStorageClass(client, scParameters, nil, "", "", false, "")
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	})
+
+	ginkgo.AfterEach(func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		if storageclass != nil {
+			err := client.StorageV1().StorageClasses().Delete(ctx, storageclass.Name, *metav1.NewDeleteOptions(0))
+			if !apierrors.IsNotFound(err) {
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			}
+			storageclass = nil
+		}
+	})
+
+	// Test to measure provisioning and attach throughput of the driver.
+
+	// Steps
+	// 1. Create SCALE_VOLUME_COUNT PVCs, each used by its own pod, with at
+	//    most SCALE_CONCURRENCY of them in flight at any time.
+	// 2. Record the time each PVC took to be bound and each pod to be running.
+	// 3. Delete all pods and PVCs with the same concurrency.
+	// 4. Count the vCenter tasks issued during the run.
+	// 5. Write scale-report.json to the report directory and fail if any
+	//    PVC or pod did not come up.
+	ginkgo.It("Create PVCs and pods at scale and report latencies", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		report := scaleReport{
+			VolumeCount: volumeCount,
+			Concurrency: concurrency,
+			StartTime:   time.Now(),
+			Latency:     make(map[string]metricSummary),
+		}
+		var (
+			lock      sync.Mutex
+			workloads []*scaleWorkload
+			latencies = make(map[string][]float64)
+		)
+		recordFailure := func(err error) {
+			lock.Lock()
+			defer lock.Unlock()
+			framework.Logf("scale workload failed: %v", err)
+			report.Errors = append(report.Errors, err.Error())
+		}
+		recordLatency := func(metric string, d time.Duration) {
+			recordTiming(metric, d)
+			lock.Lock()
+			defer lock.Unlock()
+			latencies[metric] = append(latencies[metric], d.Seconds())
+		}
+
+		ginkgo.By(fmt.Sprintf("Creating %d PVCs and pods with concurrency %d", volumeCount, concurrency))
+		runConcurrently(volumeCount, concurrency, func(int) {
+			workload, err := createScaleWorkload(ctx, client, namespace, storageclass, recordLatency)
+			if workload != nil {
+				lock.Lock()
+				workloads = append(workloads, workload)
+				lock.Unlock()
+			}
+			if err != nil {
+				recordFailure(err)
+			}
+		})
+
+		ginkgo.By(fmt.Sprintf("Deleting %d pods and PVCs with concurrency %d", len(workloads), concurrency))
+		runConcurrently(len(workloads), concurrency, func(i int) {
+			if err := deleteScaleWorkload(ctx, client, workloads[i]); err != nil {
+				recordFailure(err)
+			}
+		})
+
+		report.Seconds = time.Since(report.StartTime).Seconds()
+		report.VolumesPerMin = float64(volumeCount) / report.Seconds * 60
+		report.Failures = len(report.Errors)
+		for metric, samples := range latencies {
+			report.Latency[metric] = summarizeSamples(samples)
+		}
+		vcTasks, err := countVCTasks(ctx, report.StartTime, time.Now())
+		if err != nil {
+			framework.Logf("failed to count vCenter tasks: %v", err)
+		}
+		report.VCTasks = vcTasks
+
+		err = writeScaleReport(&report)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(report.Errors).To(gomega.BeEmpty(), "some workloads failed")
+	})
+})
+
+// runConcurrently calls fn for 0..count-1 with at most concurrency calls in
+// flight and returns once all of them returned.
+func runConcurrently(count int, concurrency int, fn func(i int)) {
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer ginkgo.GinkgoRecover()
+			defer wg.Done()
+			defer func() { <-sem }()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
+
+// createScaleWorkload creates a PVC and a pod using it, waiting for both to
+// be ready and reporting the time each took. It does not use gomega
+// assertions so that it can run on several goroutines.
+func createScaleWorkload(ctx context.Context, client clientset.Interface, namespace string,
+	storageclass *storagev1.StorageClass, recordLatency func(string, time.Duration)) (*scaleWorkload, error) {
+	pvcSpec := getPersistentVolumeClaimSpecWithStorageClass(namespace, diskSize, storageclass, nil, "")
+	start := time.Now()
+	pvclaim, err := fpv.CreatePVC(client, namespace, pvcSpec)
+	if err != nil {
+		return nil, err
+	}
+	workload := &scaleWorkload{pvclaim: pvclaim}
+	pvs, err := fpv.WaitForPVClaimBoundPhase(client, []*v1.PersistentVolumeClaim{pvclaim}, framework.ClaimProvisionTimeout)
+	if err != nil {
+		return workload, fmt.Errorf("PVC %s is not bound: %v", pvclaim.Name, err)
+	}
+	recordLatency(metricProvisionLatency, time.Since(start))
+	workload.pv = pvs[0]
+
+	pod := fpod.MakePod(namespace, nil, []*v1.PersistentVolumeClaim{pvclaim}, false, "")
+	pod.Spec.Containers[0].Image = busyBoxImageOnGcr
+	start = time.Now()
+	pod, err = client.CoreV1().Pods(namespace).Create(ctx, pod, metav1.CreateOptions{})
+	if err != nil {
+		return workload, err
+	}
+	workload.pod = pod
+	if err = fpod.WaitForPodNameRunningInNamespace(client, pod.Name, namespace); err != nil {
+		return workload, fmt.Errorf("pod %s is not running: %v", pod.Name, err)
+	}
+	recordLatency(metricAttachLatency, time.Since(start))
+	return workload, nil
+}
+
+// deleteScaleWorkload deletes the pod and PVC of a workload and waits for the
+// PV to be deleted.
+func deleteScaleWorkload(ctx context.Context, client clientset.Interface, workload *scaleWorkload) error {
+	if workload.pod != nil {
+		if err := fpod.DeletePodWithWait(client, workload.pod); err != nil {
+			return err
+		}
+	}
+	err := client.CoreV1().PersistentVolumeClaims(workload.pvclaim.Namespace).Delete(ctx, workload.pvclaim.Name,
+		metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	if workload.pv != nil {
+		return fpv.WaitForPersistentVolumeDeleted(client, workload.pv.Name, poll, pollTimeout)
+	}
+	return nil
+}
+
+// countVCTasks returns the number of vCenter tasks started in the given time
+// range, keyed by task description id.
+func countVCTasks(ctx context.Context, begin time.Time, end time.Time) (map[string]int, error) {
+	c := e2eVSphere.Client.Client
+	filter := vim25types.TaskFilterSpec{
+		Time: &vim25types.TaskFilterSpecByTime{
+			TimeType:  vim25types.TaskFilterSpecTimeOptionStartedTime,
+			BeginTime: &begin,
+			EndTime:   &end,
+		},
+	}
+	res, err := methods.CreateCollectorForTasks(ctx, c, &vim25types.CreateCollectorForTasks{
+		This:   *c.ServiceContent.TaskManager,
+		Filter: filter,
+	})
+	if err != nil {
+		return nil, err
+	}
+	collector := res.Returnval
+	defer func() {
+		_, _ = methods.DestroyCollector(ctx, c, &vim25types.DestroyCollector{This: collector})
+	}()
+	counts := make(map[string]int)
+	for {
+		page, err := methods.ReadNextTasks(ctx, c, &vim25types.ReadNextTasks{
+			This:     collector,
+			MaxCount: vcTaskPageSize,
+		})
+		if err != nil {
+			return counts, err
+		}
+		if len(page.Returnval) == 0 {
+			return counts, nil
+		}
+		for _, info := range page.Returnval {
+			counts[info.DescriptionId]++
+		}
+	}
+}
+
+// writeScaleReport writes the report as JSON to the report directory.
+func writeScaleReport(report *scaleReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(reportDir, 0755); err != nil {
+		return err
+	}
+	path := filepath.Join(reportDir, scaleReportFileName)
+	framework.Logf("Writing scale report to %s", path)
+	return ioutil.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,203 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"k8s.io/kubernetes/test/e2e/framework"
+	fssh "k8s.io/kubernetes/test/e2e/framework/ssh"
+)
+
+// envKubeSSHBastion is the ENV variable the e2e framework reads the jump
+// host for its SSH commands from.
+const envKubeSSHBastion = "KUBE_SSH_BASTION"
+
+// initSSHBastion makes the SSH commands run through the e2e framework, which
+// are the vCenter ones, use the jump host of the test environment too.
+func initSSHBastion() {
+	if e2eEnv.SSHBastion != "" && os.Getenv(envKubeSSHBastion) == "" {
+		os.Setenv(envKubeSSHBastion, e2eEnv.SSHBastion)
+	}
+}
+
+// vcSSHAddress returns the address sshd of vCenter listens on.
+func vcSSHAddress() string {
+	return net.JoinHostPort(e2eVSphere.Config.Global.VCenterHostname, strconv.Itoa(e2eEnv.VCenterSSHPort))
+}
+
+// nodeSSHAddress returns the address sshd of the k8s node with the given IP
+// listens on.
+func nodeSSHAddress(ip string) string {
+	return net.JoinHostPort(ip, strconv.Itoa(e2eEnv.NodeSSHPort))
+}
+
+// esxSSHAddress returns the address sshd of the ESX host with the given IP
+// listens on.
+func esxSSHAddress(ip string) string {
+	return net.JoinHostPort(ip, strconv.Itoa(e2eEnv.ESXSSHPort))
+}
+
+// nodeSSHClientConfig returns the client config to log in to k8s nodes with.
+func nodeSSHClientConfig() *ssh.ClientConfig {
+	return &ssh.ClientConfig{
+		User: e2eEnv.NodeSSHUser,
+		Auth: []ssh.AuthMethod{
+			ssh.Password(e2eEnv.NodeSSHPassword),
+		},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	}
+}
+
+// esxSSHClientConfig returns the client config to log in to ESX hosts with.
+func esxSSHClientConfig() *ssh.ClientConfig {
+	return &ssh.ClientConfig{
+		User:            e2eEnv.ESXSSHUser,
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Auth: []ssh.AuthMethod{
+			ssh.KeyboardInteractive(func(user, instruction string, questions []string, echos []bool) ([]string, error) {
+				answers := make([]string, len(questions))
+				for n := range questions {
+					answers[n] = e2eEnv.ESXSSHPassword
+				}
+				return answers, nil
+			}),
+		},
+	}
+}
+
+// bastionSSHClientConfig returns the client config to log in to the jump host
+// with. Unless a user and key are configured for it, the user and key of the
+// e2e framework are used.
+func bastionSSHClientConfig() (*ssh.ClientConfig, error) {
+	user := e2eEnv.SSHBastionUser
+	if user == "" {
+		user = os.Getenv("KUBE_SSH_USER")
+	}
+	if user == "" {
+		user = os.Getenv("USER")
+	}
+	var signer ssh.Signer
+	var err error
+	if e2eEnv.SSHBastionKeyPath != "" {
+		var key []byte
+		key, err = ioutil.ReadFile(e2eEnv.SSHBastionKeyPath)
+		if err != nil {
+			return nil, err
+		}
+		signer, err = ssh.ParsePrivateKey(key)
+	} else {
+		signer, err = fssh.GetSigner(framework.TestContext.Provider)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the key for the SSH bastion: %v", err)
+	}
+	return &ssh.ClientConfig{
+		User:            user,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         30 * time.Second,
+	}, nil
+}
+
+// dialBastion connects to the jump host of the test environment.
+func dialBastion() (*ssh.Client, error) {
+	config, err := bastionSSHClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	client, err := ssh.Dial("tcp", e2eEnv.SSHBastion, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to SSH bastion %s: %v", e2eEnv.SSHBastion, err)
+	}
+	return client, nil
+}
+
+// sshDial connects to sshd at addr, through the jump host when the test
+// environment has one.
+func sshDial(addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	if e2eEnv.SSHBastion == "" {
+		return ssh.Dial("tcp", addr, config)
+	}
+	bastion, err := dialBastion()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := bastion.Dial("tcp", addr)
+	if err != nil {
+		bastion.Close()
+		return nil, fmt.Errorf("failed to dial %s from SSH bastion %s: %v", addr, e2eEnv.SSHBastion, err)
+	}
+	ncc, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		bastion.Close()
+		return nil, err
+	}
+	client := ssh.NewClient(ncc, chans, reqs)
+	// Close the bastion connection along with the tunneled one.
+	go func() {
+		_ = client.Wait()
+		bastion.Close()
+	}()
+	return client, nil
+}
+
+// isSSHReachable reports whether sshd at addr accepts connections, through
+// the jump host when the test environment has one.
+func isSSHReachable(addr string, timeout time.Duration) bool {
+	if e2eEnv.SSHBastion == "" {
+		conn, err := net.DialTimeout("tcp", addr, timeout)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	}
+	bastion, err := dialBastion()
+	if err != nil {
+		framework.Logf("failed to check whether %s is reachable: %v", addr, err)
+		return false
+	}
+	defer bastion.Close()
+	conn, err := bastion.Dial("tcp", addr)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// sshCLIOptions returns the options making the ssh CLI connect to vCenter
+// the way the tests do.
+func sshCLIOptions() string {
+	opts := fmt.Sprintf("-p %d", e2eEnv.VCenterSSHPort)
+	if e2eEnv.SSHBastion != "" {
+		bastion := e2eEnv.SSHBastion
+		if e2eEnv.SSHBastionUser != "" {
+			bastion = e2eEnv.SSHBastionUser + "@" + bastion
+		}
+		opts += " -J " + bastion
+	}
+	return opts
+}
@@ -32,6 +32,7 @@ import (
 )
 
 var _ = ginkgo.Describe("[csi-topology-vanilla] Topology-Aware-Provisioning-With-Statefulset", func() {
+	ginkgo.BeforeEach(withLabels(labelBlock, labelTopology, labelVanilla))
 	f := framework.NewDefaultFramework("e2e-vsphere-topology-aware-provisioning")
 	var (
 		client            clientset.Interface
@@ -54,6 +54,7 @@ const (
 */
 
 var _ = ginkgo.Describe("[csi-block-vanilla] [csi-supervisor] statefulset", func() {
+	ginkgo.BeforeEach(withLabels(labelBlock, labelVanilla, labelSupervisor))
 	f := framework.NewDefaultFramework("e2e-vsphere-statefulset")
 	var (
 		namespace         string
@@ -49,6 +49,7 @@ import (
 */
 
 var _ = ginkgo.Describe("[csi-block-vanilla] Storage Policy Based Volume Provisioning", func() {
+	ginkgo.BeforeEach(withLabels(labelBlock, labelVanilla))
 	f := framework.NewDefaultFramework("e2e-spbm-policy")
 	var (
 		client    clientset.Interface
@@ -47,14 +47,22 @@ func init() {
 
 func TestE2E(t *testing.T) {
 	handleFlags()
+	if err := initEnvConfig(); err != nil {
+		t.Fatalf("failed to load the test environment: %v", err)
+	}
+	initSSHBastion()
 	RegisterFailHandler(Fail)
-	junitReporter := reporters.NewJUnitReporter("junit.xml")
-	RunSpecsWithDefaultAndCustomReporters(t, "CNS CSI Driver End-to-End Tests", []Reporter{junitReporter})
+	junitReporter := reporters.NewJUnitReporter(filepath.Join(reportDir, junitReportFileName))
+	timings = newTimingReporter(filepath.Join(reportDir, timingReportFileName))
+	RunSpecsWithDefaultAndCustomReporters(t, "CNS CSI Driver End-to-End Tests", []Reporter{junitReporter, timings})
 }
 
 func handleFlags() {
 	config.CopyFlags(config.Flags, flag.CommandLine)
 	framework.RegisterCommonFlags(flag.CommandLine)
 	framework.RegisterClusterFlags(flag.CommandLine)
+	registerLabelFlags(flag.CommandLine)
+	registerReportFlags(flag.CommandLine)
 	flag.Parse()
+	initRunID()
 }
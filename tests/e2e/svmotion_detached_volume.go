@@ -46,6 +46,7 @@ import (
 */
 
 var _ = ginkgo.Describe("[csi-block-vanilla] Relocate detached volume ", func() {
+	ginkgo.BeforeEach(withLabels(labelBlock, labelVanilla))
 	f := framework.NewDefaultFramework("svmotion-detached-disk")
 	var (
 		client          clientset.Interface
@@ -118,7 +119,7 @@ var _ = ginkgo.Describe("[csi-block-vanilla] Relocate detached volume ", func()
 
 		pvclaims = append(pvclaims, pvclaim)
 
-		persistentvolumes, err := fpv.WaitForPVClaimBoundPhase(client, pvclaims, framework.ClaimProvisionTimeout)
+		persistentvolumes, err := waitForPVClaimBoundPhase(client, pvclaims, framework.ClaimProvisionTimeout)
 		gomega.Expect(err).NotTo(gomega.HaveOccurred())
 
 		fcdID = persistentvolumes[0].Spec.CSI.VolumeHandle
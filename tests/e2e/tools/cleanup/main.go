@@ -0,0 +1,354 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Command cleanup removes the objects left behind by an aborted e2e run:
+// test namespaces and the CRs in them, StorageClasses, PVs, CNS volumes, FCDs
+// and vmdk files under the e2e folder of the given datastores. Objects are
+// matched by the run ID the e2e framework tags them with.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/cns"
+	cnstypes "github.com/vmware/govmomi/cns/types"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/task"
+	"github.com/vmware/govmomi/vim25/types"
+	"github.com/vmware/govmomi/vslm"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"sigs.k8s.io/vsphere-csi-driver/tests/e2e/runid"
+)
+
+// e2eFolder is the datastore folder under which tests place vmdk files.
+const e2eFolder = "e2e"
+
+var (
+	runID      = flag.String("run-id", os.Getenv(runid.EnvRunID), "ID of the e2e run to clean up (alternatively use E2E_RUN_ID env variable)")
+	kubeconfig = flag.String("kubeconfig", os.Getenv("KUBECONFIG"), "kubeconfig of the cluster under test")
+	vcHost     = flag.String("host", "", "vCenter host")
+	vcPort     = flag.String("port", "443", "vCenter port")
+	vcUser     = flag.String("user", "", "vCenter user")
+	vcPassword = flag.String("password", "", "vCenter password")
+	datacenter = flag.String("datacenter", "", "datacenter name")
+	datastores = flag.String("datastores", "", "comma-separated names of the datastores to look for FCDs and vmdk files")
+	dryRun     = flag.Bool("dry-run", false, "only print the objects which would be deleted")
+)
+
+// cleaner deletes the leftovers of a single run, remembering the first error
+// so that one failure does not prevent the remaining objects from being
+// cleaned up.
+type cleaner struct {
+	err error
+}
+
+func (c *cleaner) delete(kind string, name string, fn func() error) {
+	if *dryRun {
+		fmt.Printf("would delete %s %s\n", kind, name)
+		return
+	}
+	if err := fn(); err != nil {
+		fmt.Printf("failed to delete %s %s: %v\n", kind, name, err)
+		if c.err == nil {
+			c.err = err
+		}
+		return
+	}
+	fmt.Printf("deleted %s %s\n", kind, name)
+}
+
+func main() {
+	flag.Parse()
+	if *runID == "" {
+		fmt.Println("error: run-id flag or E2E_RUN_ID env variable must be set")
+		os.Exit(1)
+	}
+	ctx := context.Background()
+	c := &cleaner{}
+
+	k8sClient, err := newK8sClient()
+	if err != nil {
+		fmt.Printf("error: failed to create kubernetes client: %v\n", err)
+		os.Exit(1)
+	}
+	namespaces, pvs, err := findK8sLeftovers(ctx, k8sClient)
+	if err != nil {
+		fmt.Printf("error: failed to list kubernetes objects: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *vcHost != "" {
+		if err := cleanupVSphere(ctx, c, namespaces, pvs); err != nil {
+			fmt.Printf("error: failed to clean up vSphere objects: %v\n", err)
+			os.Exit(1)
+		}
+	} else {
+		fmt.Println("host flag not set, skipping CNS volumes, FCDs and vmdk files")
+	}
+	cleanupK8s(ctx, c, k8sClient, namespaces, pvs)
+
+	if c.err != nil {
+		os.Exit(1)
+	}
+}
+
+func newK8sClient() (kubernetes.Interface, error) {
+	config, err := clientcmd.BuildConfigFromFlags("", *kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	return kubernetes.NewForConfig(config)
+}
+
+// findK8sLeftovers returns the names of the namespaces of the run and the PVs
+// bound to claims in them.
+func findK8sLeftovers(ctx context.Context, client kubernetes.Interface) (map[string]bool, []v1.PersistentVolume, error) {
+	nsList, err := client.CoreV1().Namespaces().List(ctx, metav1.ListOptions{
+		LabelSelector: runid.Label + "=" + *runID,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	namespaces := make(map[string]bool)
+	for _, ns := range nsList.Items {
+		namespaces[ns.Name] = true
+	}
+	pvList, err := client.CoreV1().PersistentVolumes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+	var pvs []v1.PersistentVolume
+	for _, pv := range pvList.Items {
+		if pv.Spec.ClaimRef != nil && namespaces[pv.Spec.ClaimRef.Namespace] {
+			pvs = append(pvs, pv)
+		}
+	}
+	return namespaces, pvs, nil
+}
+
+// cleanupK8s deletes the PVs, namespaces and StorageClasses of the run.
+// Namespaced CRs are removed along with their namespace.
+func cleanupK8s(ctx context.Context, c *cleaner, client kubernetes.Interface, namespaces map[string]bool,
+	pvs []v1.PersistentVolume) {
+	for _, pv := range pvs {
+		name := pv.Name
+		c.delete("PersistentVolume", name, func() error {
+			return client.CoreV1().PersistentVolumes().Delete(ctx, name, metav1.DeleteOptions{})
+		})
+	}
+	for name := range namespaces {
+		name := name
+		c.delete("Namespace", name, func() error {
+			return client.CoreV1().Namespaces().Delete(ctx, name, metav1.DeleteOptions{})
+		})
+	}
+	scList, err := client.StorageV1().StorageClasses().List(ctx, metav1.ListOptions{
+		LabelSelector: runid.Label + "=" + *runID,
+	})
+	if err != nil {
+		fmt.Printf("failed to list StorageClasses: %v\n", err)
+		c.err = err
+		return
+	}
+	for _, sc := range scList.Items {
+		name := sc.Name
+		c.delete("StorageClass", name, func() error {
+			return client.StorageV1().StorageClasses().Delete(ctx, name, metav1.DeleteOptions{})
+		})
+	}
+}
+
+// cleanupVSphere deletes the CNS volumes used in the namespaces of the run,
+// then FCDs and vmdk files tagged with the run ID on the given datastores.
+func cleanupVSphere(ctx context.Context, c *cleaner, namespaces map[string]bool, pvs []v1.PersistentVolume) error {
+	u, err := url.Parse("https://" + *vcHost + ":" + *vcPort + "/sdk")
+	if err != nil {
+		return err
+	}
+	u.User = url.UserPassword(*vcUser, *vcPassword)
+	client, err := govmomi.NewClient(ctx, u, true)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = client.Logout(ctx)
+	}()
+	cnsClient, err := cns.NewClient(ctx, client.Client)
+	if err != nil {
+		return err
+	}
+
+	volumeIDs := make(map[string]bool)
+	for _, pv := range pvs {
+		if pv.Spec.CSI != nil {
+			volumeIDs[pv.Spec.CSI.VolumeHandle] = true
+		}
+	}
+	if err := cleanupCNSVolumes(ctx, c, cnsClient, namespaces, volumeIDs); err != nil {
+		return err
+	}
+
+	if *datastores == "" {
+		fmt.Println("datastores flag not set, skipping FCDs and vmdk files")
+		return nil
+	}
+	finder := find.NewFinder(client.Client, false)
+	dc, err := finder.Datacenter(ctx, *datacenter)
+	if err != nil {
+		return err
+	}
+	finder.SetDatacenter(dc)
+	for _, dsName := range strings.Split(*datastores, ",") {
+		ds, err := finder.Datastore(ctx, strings.TrimSpace(dsName))
+		if err != nil {
+			return err
+		}
+		if err := cleanupFCDs(ctx, c, client, ds); err != nil {
+			return err
+		}
+		if err := cleanupVmdks(ctx, c, client, dc, ds); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cleanupCNSVolumes deletes the CNS volumes whose Kubernetes metadata belongs
+// to one of the namespaces of the run, or which back one of its PVs.
+func cleanupCNSVolumes(ctx context.Context, c *cleaner, cnsClient *cns.Client, namespaces map[string]bool,
+	volumeIDs map[string]bool) error {
+	if len(namespaces) == 0 && len(volumeIDs) == 0 {
+		return nil
+	}
+	filter := cnstypes.CnsQueryFilter{}
+	for {
+		res, err := cnsClient.QueryVolume(ctx, filter)
+		if err != nil {
+			return err
+		}
+		for _, volume := range res.Volumes {
+			if volumeIDs[volume.VolumeId.Id] || usedInNamespaces(volume, namespaces) {
+				volumeID := volume.VolumeId
+				c.delete("CNS volume", volumeID.Id, func() error {
+					task, err := cnsClient.DeleteVolume(ctx, []cnstypes.CnsVolumeId{volumeID}, true)
+					if err != nil {
+						return err
+					}
+					return task.Wait(ctx)
+				})
+			}
+		}
+		if res.Cursor.Offset >= res.Cursor.TotalRecords || len(res.Volumes) == 0 {
+			return nil
+		}
+		filter.Cursor = &res.Cursor
+	}
+}
+
+func usedInNamespaces(volume cnstypes.CnsVolume, namespaces map[string]bool) bool {
+	for _, metadata := range volume.Metadata.EntityMetadata {
+		if k8sMetadata, ok := metadata.(*cnstypes.CnsKubernetesEntityMetadata); ok && namespaces[k8sMetadata.Namespace] {
+			return true
+		}
+	}
+	return false
+}
+
+// cleanupFCDs deletes the FCDs on the datastore whose name carries the run tag.
+func cleanupFCDs(ctx context.Context, c *cleaner, client *govmomi.Client, ds *object.Datastore) error {
+	m := vslm.NewObjectManager(client.Client)
+	ids, err := m.List(ctx, ds)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		fcd, err := m.Retrieve(ctx, ds, id.Id)
+		if err != nil {
+			// The FCD may have been deleted along with its CNS volume.
+			continue
+		}
+		if !runid.HasTag(fcd.Config.Name, *runID) {
+			continue
+		}
+		fcdID := id.Id
+		c.delete("FCD", fcd.Config.Name+" ("+fcdID+")", func() error {
+			task, err := m.Delete(ctx, ds, fcdID)
+			if err != nil {
+				return err
+			}
+			return task.Wait(ctx)
+		})
+	}
+	return nil
+}
+
+// cleanupVmdks deletes the vmdk files under the e2e folder of the datastore
+// whose name carries the run tag.
+func cleanupVmdks(ctx context.Context, c *cleaner, client *govmomi.Client, dc *object.Datacenter,
+	ds *object.Datastore) error {
+	browser, err := ds.Browser(ctx)
+	if err != nil {
+		return err
+	}
+	spec := &types.HostDatastoreBrowserSearchSpec{
+		MatchPattern: []string{"*-" + runid.Tag(*runID) + ".vmdk"},
+		Query:        []types.BaseFileQuery{&types.VmDiskFileQuery{}},
+	}
+	searchTask, err := browser.SearchDatastoreSubFolders(ctx, ds.Path(e2eFolder), spec)
+	if err != nil {
+		return err
+	}
+	info, err := searchTask.WaitForResult(ctx, nil)
+	if err != nil {
+		if taskErr, ok := err.(task.Error); ok {
+			if _, ok := taskErr.Fault().(*types.FileNotFound); ok {
+				// The e2e folder does not exist on this datastore.
+				return nil
+			}
+		}
+		return err
+	}
+	results, ok := info.Result.(types.ArrayOfHostDatastoreBrowserSearchResults)
+	if !ok {
+		return nil
+	}
+	diskManager := object.NewVirtualDiskManager(client.Client)
+	for _, result := range results.HostDatastoreBrowserSearchResults {
+		for _, file := range result.File {
+			diskPath := path.Join(result.FolderPath, file.GetFileInfo().Path)
+			c.delete("vmdk", diskPath, func() error {
+				deleteTask, err := diskManager.DeleteVirtualDisk(ctx, diskPath, dc)
+				if err != nil {
+					return err
+				}
+				return deleteTask.Wait(ctx)
+			})
+		}
+	}
+	return nil
+}
@@ -46,7 +46,6 @@ import (
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	pkgtypes "k8s.io/apimachinery/pkg/types"
@@ -92,6 +91,7 @@ func getVSphereStorageClassSpec(scName string, scParameters map[string]string, a
 		},
 		ObjectMeta: metav1.ObjectMeta{
 			GenerateName: "sc-",
+			Labels:       e2eRunLabels(),
 		},
 		Provisioner:          e2evSphereCSIDriverName,
 		VolumeBindingMode:    &bindingMode,
@@ -638,14 +638,14 @@ func invokeVCenterChangePassword(user, adminPassword, newPassword, host string)
 		gomega.Expect(err).NotTo(gomega.HaveOccurred())
 	}()
 	// remote copy this input file to VC
-	copyCmd := fmt.Sprintf("/bin/cat %s | /usr/bin/ssh root@%s '/usr/bin/cat >> input_copy.txt'", path, e2eVSphere.Config.Global.VCenterHostname)
+	copyCmd := fmt.Sprintf("/bin/cat %s | /usr/bin/ssh %s root@%s '/usr/bin/cat >> input_copy.txt'", path, sshCLIOptions(), e2eVSphere.Config.Global.VCenterHostname)
 	fmt.Printf("Executing the command: %s\n", copyCmd)
 	_, err = exec.Command("/bin/sh", "-c", copyCmd).Output()
 	gomega.Expect(err).NotTo(gomega.HaveOccurred())
 
 	defer func() {
 		// remove the input_copy.txt file from VC
-		removeCmd := fmt.Sprintf("/usr/bin/ssh root@%s '/usr/bin/rm input_copy.txt'", e2eVSphere.Config.Global.VCenterHostname)
+		removeCmd := fmt.Sprintf("/usr/bin/ssh %s root@%s '/usr/bin/rm input_copy.txt'", sshCLIOptions(), e2eVSphere.Config.Global.VCenterHostname)
 		_, err = exec.Command("/bin/sh", "-c", removeCmd).Output()
 		gomega.Expect(err).NotTo(gomega.HaveOccurred())
 	}()
@@ -1681,7 +1681,7 @@ func findIP(input string) string {
 func getHosts(ctx context.Context, clusterComputeResource []*object.ClusterComputeResource) []*object.HostSystem {
 	var err error
 	if hosts == nil {
-		computeCluster := os.Getenv(envComputeClusterName)
+		computeCluster := e2eEnv.ComputeClusterName
 		if computeCluster == "" {
 			if guestCluster {
 				computeCluster = "compute-cluster"
@@ -1733,13 +1733,13 @@ func psodHostWithPv(ctx context.Context, vs *vSphere, pvName string) string {
 
 	ginkgo.By("PSOD")
 	sshCmd := fmt.Sprintf("vsish -e set /config/Misc/intOpts/BlueScreenTimeout %s", psodTime)
-	op, err := connectESX("root", hostIP, sshCmd)
+	op, err := connectESX(hostIP, sshCmd)
 	framework.Logf(op)
 	gomega.Expect(err).NotTo(gomega.HaveOccurred())
 
 	ginkgo.By("Injecting PSOD ")
 	psodCmd := "vsish -e set /reliability/crashMe/Panic 1"
-	op, err = connectESX("root", hostIP, psodCmd)
+	op, err = connectESX(hostIP, psodCmd)
 	framework.Logf(op)
 	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
 
@@ -1749,7 +1749,7 @@ func psodHostWithPv(ctx context.Context, vs *vSphere, pvName string) string {
 //VsanObjIndentities returns the vsanObjectsUUID
 func VsanObjIndentities(ctx context.Context, vs *vSphere, pvName string) string {
 	var vsanObjUUID string
-	computeCluster := os.Getenv(envComputeClusterName)
+	computeCluster := e2eEnv.ComputeClusterName
 	if computeCluster == "" {
 		if guestCluster {
 			computeCluster = "compute-cluster"
@@ -1796,27 +1796,10 @@ func queryVsanObj(ctx context.Context, vs *vSphere, vsanObjuuid string) string {
 	return result
 }
 
-//hostLogin methods sets the ESX host password
-func hostLogin(user, instruction string, questions []string, echos []bool) (answers []string, err error) {
-	answers = make([]string, len(questions))
-	for n := range questions {
-		answers[n] = esxPassword
-	}
-	return answers, nil
-}
-
 //connectESX executes ssh commands on the give ESX host and returns the bash result
-func connectESX(username string, addr string, cmd string) (string, error) {
-	// Authentication
-	config := &ssh.ClientConfig{
-		User:            username,
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		Auth: []ssh.AuthMethod{
-			ssh.KeyboardInteractive(hostLogin),
-		},
-	}
+func connectESX(addr string, cmd string) (string, error) {
 	// Connect
-	client, err := ssh.Dial("tcp", net.JoinHostPort(addr, sshdPort), config)
+	client, err := sshDial(esxSSHAddress(addr), esxSSHClientConfig())
 	if err != nil {
 		framework.Logf("connection failed due to %v", err)
 		return "", err
@@ -2006,9 +1989,8 @@ func waitForHostToBeUp(ip string) error {
 	timeout := 1 * time.Second
 	waitErr := wait.Poll(timeout, healthStatusPollTimeout, func() (bool, error) {
 		framework.Logf("wait until %v seconds", vsanHealthServiceWaitTime)
-		_, err := net.DialTimeout("tcp", ip+":22", timeout)
-		if err != nil {
-			framework.Logf("host unreachable, error: ", err)
+		if !isSSHReachable(esxSSHAddress(ip), timeout) {
+			framework.Logf("host unreachable")
 			return false, nil
 		}
 		framework.Logf("host reachable")
@@ -2092,62 +2074,10 @@ func getK8sMasterIP(ctx context.Context, client clientset.Interface) string {
 	return k8sMasterIP
 }
 
-// toggleCSIMigrationFeatureGatesOnKubeControllerManager adds/removes CSIMigration and CSIMigrationvSphere feature gates to/from kube-controller-manager
-func toggleCSIMigrationFeatureGatesOnKubeControllerManager(ctx context.Context, client clientset.Interface, add bool) error {
-	var err error
-	sshCmd := ""
-	if !vanillaCluster {
-		return fmt.Errorf("'toggleCSIMigrationFeatureGatesToKubeControllerManager' is implemented for vanilla cluster alone")
-	}
-	if add {
-		sshCmd = "sed -i -e 's/CSIMigration=false,CSIMigrationvSphere=false/CSIMigration=true,CSIMigrationvSphere=true/g' " + kcmManifest
-	} else {
-		sshCmd = "sed -i '/CSIMigration/d' " + kcmManifest
-	}
-	grepCmd := "grep CSIMigration " + kcmManifest
-	k8sMasterIP := getK8sMasterIP(ctx, client)
-	framework.Logf("Invoking command '%v' on host %v", grepCmd, k8sMasterIP)
-	sshClientConfig := &ssh.ClientConfig{
-		User: "root",
-		Auth: []ssh.AuthMethod{
-			ssh.Password("ca$hc0w"),
-		},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-	}
-	result, err := sshExec(sshClientConfig, k8sMasterIP, grepCmd)
-	if err != nil {
-		return err
-	}
-	if err != nil {
-		fssh.LogResult(result)
-		return fmt.Errorf("command failed/couldn't execute command: %s on host: %v , error: %s", grepCmd, k8sMasterIP, err)
-	}
-	if result.Code != 0 {
-		if add {
-			sshCmd = "gawk -i inplace '/--bind-addres/ { print; print \"    - --feature-gates=CSIMigration=true,CSIMigrationvSphere=true\"; next }1' " + kcmManifest
-		} else {
-			return nil
-		}
-	}
-	framework.Logf("Invoking command %v on host %v", sshCmd, k8sMasterIP)
-	result, err = sshExec(sshClientConfig, k8sMasterIP, sshCmd)
-	if err != nil || result.Code != 0 {
-		fssh.LogResult(result)
-		return fmt.Errorf("couldn't execute command: %s on host: %v , error: %s", sshCmd, k8sMasterIP, err)
-	}
-	// sleeping for two seconds so that the change made to manifest file is recognised
-	time.Sleep(2 * time.Second)
-	framework.Logf("Waiting for 'kube-controller-manager' controller pod to come up within %v seconds", pollTimeout)
-	label := labels.SelectorFromSet(labels.Set(map[string]string{"component": "kube-controller-manager"}))
-	_, err = fpod.WaitForPodsWithLabelRunningReady(client, kubeSystemNamespace, label, 1, pollTimeout)
-	framework.Logf("'kube-controller-manager' controller pod is up and ready within %v seconds", pollTimeout)
-	return err
-}
-
 //sshExec runs a command on the host via ssh
 func sshExec(sshClientConfig *ssh.ClientConfig, host string, cmd string) (fssh.Result, error) {
 	result := fssh.Result{Host: host, Cmd: cmd}
-	sshClient, err := ssh.Dial("tcp", host+":22", sshClientConfig)
+	sshClient, err := sshDial(nodeSSHAddress(host), sshClientConfig)
 	if err != nil {
 		result.Stdout = ""
 		result.Stderr = ""
@@ -2188,6 +2118,7 @@ func sshExec(sshClientConfig *ssh.ClientConfig, host string, cmd string) (fssh.R
 func createPod(client clientset.Interface, namespace string, nodeSelector map[string]string, pvclaims []*v1.PersistentVolumeClaim, isPrivileged bool, command string) (*v1.Pod, error) {
 	pod := fpod.MakePod(namespace, nodeSelector, pvclaims, isPrivileged, command)
 	pod.Spec.Containers[0].Image = busyBoxImageOnGcr
+	start := time.Now()
 	pod, err := client.CoreV1().Pods(namespace).Create(context.TODO(), pod, metav1.CreateOptions{})
 	if err != nil {
 		return nil, fmt.Errorf("pod Create API error: %v", err)
@@ -2197,6 +2128,10 @@ func createPod(client clientset.Interface, namespace string, nodeSelector map[st
 	if err != nil {
 		return pod, fmt.Errorf("pod %q is not Running: %v", pod.Name, err)
 	}
+	// Time to running is dominated by attach and mount of the claims.
+	if len(pvclaims) > 0 {
+		recordTiming(metricAttachLatency, time.Since(start))
+	}
 	// get fresh pod info
 	pod, err = client.CoreV1().Pods(namespace).Get(context.TODO(), pod.Name, metav1.GetOptions{})
 	if err != nil {
@@ -2483,13 +2418,7 @@ func waitForCSIMigrationFeatureGatesToggleOnkublet(ctx context.Context, client c
 func toggleCSIMigrationFeatureGatesOnkublet(ctx context.Context, client clientset.Interface, nodeIP string, shouldAdd bool) {
 	grepCmd := "grep CSIMigration " + kubeletConfigYaml
 	framework.Logf("Invoking command '%v' on host %v", grepCmd, nodeIP)
-	sshClientConfig := &ssh.ClientConfig{
-		User: "root",
-		Auth: []ssh.AuthMethod{
-			ssh.Password("ca$hc0w"),
-		},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-	}
+	sshClientConfig := nodeSSHClientConfig()
 
 	result, err := sshExec(sshClientConfig, nodeIP, grepCmd)
 	if err != nil {
@@ -19,8 +19,6 @@ package e2e
 import (
 	"context"
 	"fmt"
-	"os"
-	"strconv"
 	"time"
 
 	"github.com/onsi/ginkgo"
@@ -37,6 +35,7 @@ import (
 )
 
 var _ bool = ginkgo.Describe("Verify volume life_cycle operations works fine after VC Reboots", func() {
+	ginkgo.BeforeEach(withLabels(labelBlock, labelFile, labelVanilla, labelSupervisor, labelGuest, labelSerial, labelDisruptive))
 	f := framework.NewDefaultFramework("e2e-volume-life-cycle")
 	var (
 		client            clientset.Interface
@@ -58,12 +57,7 @@ var _ bool = ginkgo.Describe("Verify volume life_cycle operations works fine aft
 		scParameters = make(map[string]string)
 		storagePolicyName = GetAndExpectStringEnvVar(envStoragePolicyNameForSharedDatastores)
 
-		if os.Getenv(envVCRebootWaitTime) != "" {
-			VCRebootWaitTime, err = strconv.Atoi(os.Getenv(envVCRebootWaitTime))
-			gomega.Expect(err).NotTo(gomega.HaveOccurred())
-		} else {
-			VCRebootWaitTime = defaultVCRebootWaitTime
-		}
+		VCRebootWaitTime = e2eEnv.VCRebootWaitTime
 		if guestCluster {
 			svcClient, svNamespace := getSvcClientAndNamespace()
 			setResourceQuota(svcClient, svNamespace, rqLimit)
@@ -132,7 +126,7 @@ var _ bool = ginkgo.Describe("Verify volume life_cycle operations works fine aft
 		}()
 
 		ginkgo.By("Waiting for claim to be in bound phase")
-		pvc, err := fpv.WaitForPVClaimBoundPhase(client, []*v1.PersistentVolumeClaim{pvclaim}, framework.ClaimProvisionTimeout)
+		pvc, err := waitForPVClaimBoundPhase(client, []*v1.PersistentVolumeClaim{pvclaim}, framework.ClaimProvisionTimeout)
 		gomega.Expect(err).NotTo(gomega.HaveOccurred())
 		gomega.Expect(pvc).NotTo(gomega.BeEmpty())
 		pv := getPvFromClaim(client, pvclaim.Namespace, pvclaim.Name)
@@ -173,7 +167,7 @@ var _ bool = ginkgo.Describe("Verify volume life_cycle operations works fine aft
 		gomega.Expect(isDiskAttached).To(gomega.BeTrue(), "Volume is not attached to the node")
 
 		ginkgo.By("Rebooting VC")
-		vcAddress := e2eVSphere.Config.Global.VCenterHostname + ":" + sshdPort
+		vcAddress := vcSSHAddress()
 		err = invokeVCenterReboot(vcAddress)
 		gomega.Expect(err).NotTo(gomega.HaveOccurred())
 		err = waitForHostToBeUp(e2eVSphere.Config.Global.VCenterHostname)
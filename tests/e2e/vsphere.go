@@ -408,11 +408,11 @@ func (vs *vSphere) waitForCNSVolumeToBeCreated(volumeID string) error {
 	return err
 }
 
-// createFCD creates an FCD disk
+// createFCD creates an FCD disk, tagging its name with the ID of the run
 func (vs *vSphere) createFCD(ctx context.Context, fcdname string, diskCapacityInMB int64, dsRef vim25types.ManagedObjectReference) (string, error) {
 	KeepAfterDeleteVM := false
 	spec := vim25types.VslmCreateSpec{
-		Name:              fcdname,
+		Name:              e2eRunScopedName(fcdname),
 		CapacityInMB:      diskCapacityInMB,
 		KeepAfterDeleteVm: &KeepAfterDeleteVM,
 		BackingSpec: &vim25types.VslmCreateSpecDiskFileBackingSpec{
@@ -439,11 +439,11 @@ func (vs *vSphere) createFCD(ctx context.Context, fcdname string, diskCapacityIn
 	return fcdID, nil
 }
 
-// createFCD with valid storage policy
+// createFCD with valid storage policy, tagging its name with the ID of the run
 func (vs *vSphere) createFCDwithValidProfileID(ctx context.Context, fcdname string, profileID string, diskCapacityInMB int64, dsRef vim25types.ManagedObjectReference) (string, error) {
 	KeepAfterDeleteVM := false
 	spec := vim25types.VslmCreateSpec{
-		Name:              fcdname,
+		Name:              e2eRunScopedName(fcdname),
 		CapacityInMB:      diskCapacityInMB,
 		KeepAfterDeleteVm: &KeepAfterDeleteVM,
 		BackingSpec: &vim25types.VslmCreateSpecDiskFileBackingSpec{
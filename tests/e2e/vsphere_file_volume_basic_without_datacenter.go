@@ -29,6 +29,7 @@ import (
 )
 
 var _ = ginkgo.Describe("[csi-file-vanilla] Basic Testing without datacenter", func() {
+	ginkgo.BeforeEach(withLabels(labelFile, labelVanilla))
 	f := framework.NewDefaultFramework("file-volume-basic")
 	var (
 		client                 clientset.Interface
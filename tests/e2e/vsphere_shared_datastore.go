@@ -47,6 +47,7 @@ import (
 */
 
 var _ = ginkgo.Describe("[csi-block-vanilla] Datastore Based Volume Provisioning With No Storage Policy", func() {
+	ginkgo.BeforeEach(withLabels(labelBlock, labelVanilla))
 	f := framework.NewDefaultFramework("e2e-vsphere-volume-provisioning-no-storage-policy")
 	var (
 		client                clientset.Interface
@@ -44,6 +44,7 @@ import (
 */
 
 var _ = ginkgo.Describe("[csi-block-vanilla] [csi-file-vanilla] [csi-supervisor] [csi-guest] Volume Disk Size ", func() {
+	ginkgo.BeforeEach(withLabels(labelBlock, labelFile, labelVanilla, labelSupervisor, labelGuest))
 	f := framework.NewDefaultFramework("volume-disksize")
 	var (
 		client            clientset.Interface
@@ -120,7 +121,7 @@ var _ = ginkgo.Describe("[csi-block-vanilla] [csi-file-vanilla] [csi-supervisor]
 
 		pvclaims = append(pvclaims, pvclaim)
 
-		persistentvolumes, err := fpv.WaitForPVClaimBoundPhase(client, pvclaims, framework.ClaimProvisionTimeout)
+		persistentvolumes, err := waitForPVClaimBoundPhase(client, pvclaims, framework.ClaimProvisionTimeout)
 		gomega.Expect(err).NotTo(gomega.HaveOccurred())
 		volHandle := persistentvolumes[0].Spec.CSI.VolumeHandle
 		if guestCluster {
@@ -19,7 +19,6 @@ package e2e
 import (
 	"context"
 	"fmt"
-	"os"
 	"strconv"
 	"strings"
 	"sync"
@@ -50,6 +49,7 @@ import (
 )
 
 var _ = ginkgo.Describe("Volume Expansion Test", func() {
+	ginkgo.BeforeEach(withLabels(labelBlock, labelVanilla, labelSupervisor, labelGuest, labelSerial, labelDisruptive))
 	f := framework.NewDefaultFramework("volume-expansion")
 	var (
 		client                     clientset.Interface
@@ -80,12 +80,7 @@ var _ = ginkgo.Describe("Volume Expansion Test", func() {
 			framework.Failf("Unable to find ready and schedulable Node")
 		}
 
-		if os.Getenv(envPandoraSyncWaitTime) != "" {
-			pandoraSyncWaitTime, err = strconv.Atoi(os.Getenv(envPandoraSyncWaitTime))
-			gomega.Expect(err).NotTo(gomega.HaveOccurred())
-		} else {
-			pandoraSyncWaitTime = defaultPandoraSyncWaitTime
-		}
+		pandoraSyncWaitTime = e2eEnv.PandoraSyncWaitTime
 		gomega.Expect(err).NotTo(gomega.HaveOccurred())
 
 		defaultDatastore = getDefaultDatastore(ctx)
@@ -101,7 +96,7 @@ var _ = ginkgo.Describe("Volume Expansion Test", func() {
 	ginkgo.AfterEach(func() {
 		var err error
 
-		vcAddress := e2eVSphere.Config.Global.VCenterHostname + ":" + sshdPort
+		vcAddress := vcSSHAddress()
 
 		if isSPSServiceStopped {
 			framework.Logf("Bringing sps up before terminating the test")
@@ -530,7 +525,7 @@ var _ = ginkgo.Describe("Volume Expansion Test", func() {
 
 		ginkgo.By("Bring down Vsan-health service")
 		isVsanhealthServiceStopped = true
-		vcAddress := e2eVSphere.Config.Global.VCenterHostname + ":" + sshdPort
+		vcAddress := vcSSHAddress()
 		err = invokeVCenterServiceControl(stopOperation, vsanhealthServiceName, vcAddress)
 		gomega.Expect(err).NotTo(gomega.HaveOccurred())
 
@@ -641,7 +636,7 @@ var _ = ginkgo.Describe("Volume Expansion Test", func() {
 
 		ginkgo.By("Bring down SPS service")
 		isSPSServiceStopped = true
-		vcAddress := e2eVSphere.Config.Global.VCenterHostname + ":" + sshdPort
+		vcAddress := vcSSHAddress()
 		err = invokeVCenterServiceControl(stopOperation, spsServiceName, vcAddress)
 		gomega.Expect(err).NotTo(gomega.HaveOccurred())
 
@@ -820,7 +815,7 @@ var _ = ginkgo.Describe("Volume Expansion Test", func() {
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
 
-		sharedVVOLdatastoreURL := os.Getenv(envSharedVVOLDatastoreURL)
+		sharedVVOLdatastoreURL := e2eEnv.SharedVVOLDatastoreURL
 		if sharedVVOLdatastoreURL == "" {
 			ginkgo.Skip("Skipping the test because SHARED_VVOL_DATASTORE_URL is not set. This may be due to testbed is not having shared VVOL datastore.")
 		}
@@ -873,7 +868,7 @@ var _ = ginkgo.Describe("Volume Expansion Test", func() {
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
 
-		sharedNFSdatastoreURL := os.Getenv(envSharedNFSDatastoreURL)
+		sharedNFSdatastoreURL := e2eEnv.SharedNFSDatastoreURL
 		if sharedNFSdatastoreURL == "" {
 			ginkgo.Skip("Skipping the test because SHARED_NFS_DATASTORE_URL is not set. This may be due to testbed is not having shared NFS datastore.")
 		}
@@ -927,7 +922,7 @@ var _ = ginkgo.Describe("Volume Expansion Test", func() {
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
 
-		sharedVMFSdatastoreURL := os.Getenv(envSharedVMFSDatastoreURL)
+		sharedVMFSdatastoreURL := e2eEnv.SharedVMFSDatastoreURL
 		if sharedVMFSdatastoreURL == "" {
 			ginkgo.Skip("Skipping the test because SHARED_VMFS_DATASTORE_URL is not set. This may be due to testbed is not having shared VNFS datastore.")
 		}
@@ -1253,7 +1248,7 @@ var _ = ginkgo.Describe("Volume Expansion Test", func() {
 
 		ginkgo.By("Bring down SPS service")
 		isSPSServiceStopped = true
-		vcAddress := e2eVSphere.Config.Global.VCenterHostname + ":" + sshdPort
+		vcAddress := vcSSHAddress()
 		err = invokeVCenterServiceControl(stopOperation, spsServiceName, vcAddress)
 		gomega.Expect(err).NotTo(gomega.HaveOccurred())
 
@@ -1402,7 +1397,7 @@ var _ = ginkgo.Describe("Volume Expansion Test", func() {
 
 		ginkgo.By("Bring down Vsan-health service")
 		isVsanhealthServiceStopped = true
-		vcAddress := e2eVSphere.Config.Global.VCenterHostname + ":" + sshdPort
+		vcAddress := vcSSHAddress()
 		err = invokeVCenterServiceControl(stopOperation, vsanhealthServiceName, vcAddress)
 		gomega.Expect(err).NotTo(gomega.HaveOccurred())
 
@@ -1678,7 +1673,7 @@ func createSCwithVolumeExpansionTrueAndDynamicPVC(f *framework.Framework, client
 	var pvclaims []*v1.PersistentVolumeClaim
 	pvclaims = append(pvclaims, pvclaim)
 	ginkgo.By("Waiting for all claims to be in bound state")
-	persistentvolumes, err := fpv.WaitForPVClaimBoundPhase(client, pvclaims, framework.ClaimProvisionTimeout)
+	persistentvolumes, err := waitForPVClaimBoundPhase(client, pvclaims, framework.ClaimProvisionTimeout)
 	gomega.Expect(err).NotTo(gomega.HaveOccurred())
 	pv := persistentvolumes[0]
 	volHandle := pv.Spec.CSI.VolumeHandle
@@ -1802,7 +1797,7 @@ func invokeTestForVolumeExpansion(f *framework.Framework, client clientset.Inter
 	var pvclaims []*v1.PersistentVolumeClaim
 	pvclaims = append(pvclaims, pvclaim)
 	ginkgo.By("Waiting for all claims to be in bound state")
-	persistentvolumes, err := fpv.WaitForPVClaimBoundPhase(client, pvclaims, framework.ClaimProvisionTimeout)
+	persistentvolumes, err := waitForPVClaimBoundPhase(client, pvclaims, framework.ClaimProvisionTimeout)
 	gomega.Expect(err).NotTo(gomega.HaveOccurred())
 	pv := persistentvolumes[0]
 	volHandle := pv.Spec.CSI.VolumeHandle
@@ -1987,7 +1982,7 @@ func invokeTestForVolumeExpansionWithFilesystem(f *framework.Framework, client c
 	var pvclaims []*v1.PersistentVolumeClaim
 	pvclaims = append(pvclaims, pvclaim)
 	ginkgo.By("Waiting for all claims to be in bound state")
-	persistentvolumes, err := fpv.WaitForPVClaimBoundPhase(client, pvclaims, framework.ClaimProvisionTimeout)
+	persistentvolumes, err := waitForPVClaimBoundPhase(client, pvclaims, framework.ClaimProvisionTimeout)
 	gomega.Expect(err).NotTo(gomega.HaveOccurred())
 	pv := persistentvolumes[0]
 	volHandle := pv.Spec.CSI.VolumeHandle
@@ -2179,7 +2174,7 @@ func invokeTestForInvalidVolumeExpansion(f *framework.Framework, client clientse
 	var pvclaims []*v1.PersistentVolumeClaim
 	pvclaims = append(pvclaims, pvclaim)
 	ginkgo.By("Waiting for all claims to be in bound state")
-	_, err = fpv.WaitForPVClaimBoundPhase(client, pvclaims, framework.ClaimProvisionTimeout)
+	_, err = waitForPVClaimBoundPhase(client, pvclaims, framework.ClaimProvisionTimeout)
 	gomega.Expect(err).NotTo(gomega.HaveOccurred())
 
 	// Modify PVC spec to trigger volume expansion
@@ -2236,7 +2231,7 @@ func invokeTestForInvalidVolumeShrink(f *framework.Framework, client clientset.I
 	var pvclaims []*v1.PersistentVolumeClaim
 	pvclaims = append(pvclaims, pvclaim)
 	ginkgo.By("Waiting for all claims to be in bound state")
-	persistentvolumes, err := fpv.WaitForPVClaimBoundPhase(client, pvclaims, framework.ClaimProvisionTimeout)
+	persistentvolumes, err := waitForPVClaimBoundPhase(client, pvclaims, framework.ClaimProvisionTimeout)
 	gomega.Expect(err).NotTo(gomega.HaveOccurred())
 	pv := persistentvolumes[0]
 	defer func() {
@@ -2273,12 +2268,7 @@ func invokeTestForInvalidVolumeExpansionStaticProvision(f *framework.Framework,
 	)
 
 	// Set up FCD
-	if os.Getenv(envPandoraSyncWaitTime) != "" {
-		pandoraSyncWaitTime, err = strconv.Atoi(os.Getenv(envPandoraSyncWaitTime))
-		gomega.Expect(err).NotTo(gomega.HaveOccurred())
-	} else {
-		pandoraSyncWaitTime = defaultPandoraSyncWaitTime
-	}
+	pandoraSyncWaitTime = e2eEnv.PandoraSyncWaitTime
 	deleteFCDRequired = false
 	var datacenters []string
 	datastoreURL = GetAndExpectStringEnvVar(envSharedDatastoreURL)
@@ -2419,7 +2409,7 @@ func invokeTestForExpandVolumeMultipleTimes(f *framework.Framework, client clien
 	var pvclaims []*v1.PersistentVolumeClaim
 	pvclaims = append(pvclaims, pvclaim)
 	ginkgo.By("Waiting for all claims to be in bound state")
-	persistentvolumes, err := fpv.WaitForPVClaimBoundPhase(client, pvclaims, framework.ClaimProvisionTimeout)
+	persistentvolumes, err := waitForPVClaimBoundPhase(client, pvclaims, framework.ClaimProvisionTimeout)
 	gomega.Expect(err).NotTo(gomega.HaveOccurred())
 	pv := persistentvolumes[0]
 	volHandle := pv.Spec.CSI.VolumeHandle
@@ -2605,7 +2595,7 @@ func invokeTestForUnsupportedFileVolumeExpansion(f *framework.Framework, client
 	pvclaims = append(pvclaims, pvclaim)
 	ginkgo.By("Waiting for all claims to be in bound state")
 	//persistentvolumes
-	_, err = fpv.WaitForPVClaimBoundPhase(client, pvclaims, framework.ClaimProvisionTimeout)
+	_, err = waitForPVClaimBoundPhase(client, pvclaims, framework.ClaimProvisionTimeout)
 	gomega.Expect(err).NotTo(gomega.HaveOccurred())
 
 	// Modify PVC spec to trigger volume expansion
@@ -2656,6 +2646,19 @@ func expandPVCSize(origPVC *v1.PersistentVolumeClaim, size resource.Quantity, c
 	return updatedPVC, waitErr
 }
 
+// expandPVCAndWaitForPvResize grows the claim by volumeExpansionDelta and
+// waits for the controller side resize to finish. It returns the new size.
+func expandPVCAndWaitForPvResize(client clientset.Interface, pvclaim *v1.PersistentVolumeClaim) resource.Quantity {
+	newSize := pvclaim.Spec.Resources.Requests[v1.ResourceStorage]
+	newSize.Add(resource.MustParse(volumeExpansionDelta))
+	ginkgo.By(fmt.Sprintf("Expanding PVC %s to %s", pvclaim.Name, newSize.String()))
+	pvclaim, err := expandPVCSize(pvclaim, newSize, client)
+	gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	err = waitForPvResizeForGivenPvc(pvclaim, client, totalResizeWaitPeriod)
+	gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	return newSize
+}
+
 // waitForPvResizeForGivenPvc waits for the controller resize to be finished
 func waitForPvResizeForGivenPvc(pvc *v1.PersistentVolumeClaim, c clientset.Interface, duration time.Duration) error {
 	ctx, cancel := context.WithCancel(context.Background())
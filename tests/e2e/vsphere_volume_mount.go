@@ -35,6 +35,7 @@ import (
 )
 
 var _ = ginkgo.Describe("[csi-file-vanilla] File Volume Attach Test", func() {
+	ginkgo.BeforeEach(withLabels(labelFile, labelVanilla))
 	f := framework.NewDefaultFramework("file-volume-attach-basic")
 	var (
 		client    clientset.Interface
@@ -107,7 +108,7 @@ func createFileVolumeAndMount(f *framework.Framework, client clientset.Interface
 	var pvclaims []*v1.PersistentVolumeClaim
 	pvclaims = append(pvclaims, pvclaim)
 	ginkgo.By("Waiting for all claims to be in bound state")
-	persistentvolumes, err := fpv.WaitForPVClaimBoundPhase(client, pvclaims, framework.ClaimProvisionTimeout)
+	persistentvolumes, err := waitForPVClaimBoundPhase(client, pvclaims, framework.ClaimProvisionTimeout)
 	gomega.Expect(err).NotTo(gomega.HaveOccurred())
 	volHandle := persistentvolumes[0].Spec.CSI.VolumeHandle
 
@@ -0,0 +1,232 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/kubernetes/test/e2e/framework"
+	e2ekubelet "k8s.io/kubernetes/test/e2e/framework/kubelet"
+)
+
+const (
+	windowsDataFileName = "windows-data.txt"
+	windowsDataContent  = "vsphere-csi-windows"
+	windowsStatsTimeout = 5 * time.Minute
+)
+
+var _ = ginkgo.Describe("[csi-windows-vanilla] Windows Block Volume Test", func() {
+	ginkgo.BeforeEach(withLabels(labelBlock, labelVanilla, labelWindows))
+	f := framework.NewDefaultFramework("windows-block-volume")
+	var (
+		client       clientset.Interface
+		namespace    string
+		storageclass *storagev1.StorageClass
+	)
+
+	ginkgo.BeforeEach(func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		client = f.ClientSet
+		namespace = f.Namespace.Name
+		bootstrap()
+		windowsNodes, err := getNodesForOS(ctx, client, nodeOSWindows)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		if len(windowsNodes) == 0 {
+			ginkgo.Skip("No ready Windows worker nodes found")
+		}
+		storagePolicyName := GetAndExpectStringEnvVar(envStoragePolicyNameForSharedDatastores)
+		scParameters := map[string]string{
+			scParamStoragePolicyName: storagePolicyName,
+			scParamFsType:            ntfsFSType,
+		}
+		storageclass, err = createStorageClass(client, scParameters, nil, "", "", true, "")
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	})
+
+	ginkgo.AfterEach(func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		if storageclass != nil {
+			err := client.StorageV1().StorageClasses().Delete(ctx, storageclass.Name, *metav1.NewDeleteOptions(0))
+			if !apierrors.IsNotFound(err) {
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			}
+			storageclass = nil
+		}
+	})
+
+	// Test to verify a block volume is provisioned, attached to a Windows node
+	// and formatted with NTFS.
+
+	// Steps
+	// 1. Create a StorageClass with fstype ntfs and a PVC using it.
+	// 2. Create a pod on a Windows node using the PVC.
+	// 3. Verify the volume is attached to the node VM.
+	// 4. Verify the volume is formatted with NTFS and data can be written and read.
+	// 5. Delete the pod and verify the volume is detached.
+	// 6. Delete the PVC and verify the volume is deleted from CNS.
+	ginkgo.It("Provision, attach and format a volume with NTFS on a Windows node", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		pvclaim, pv := createBoundPVC(client, namespace, storageclass, diskSize)
+		defer deletePVCAndWaitForCNSVolumeDeletion(client, pvclaim, pv)
+
+		pod := createWindowsPodAndVerifyAttach(ctx, client, namespace, pvclaim, pv)
+		defer deletePodAndWaitForDetach(client, pod, pv.Spec.CSI.VolumeHandle)
+
+		mountPath := getVolumeMountPathForOS(nodeOSWindows, 1)
+		ginkgo.By(fmt.Sprintf("Verifying the volume mounted at %s is formatted with NTFS", mountPath))
+		fsType, err := getFSTypeForOS(namespace, pod.Name, nodeOSWindows, mountPath)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(fsType).To(gomega.Equal(ntfsFSType))
+
+		ginkgo.By("Writing and reading data on the volume")
+		filePath := mountPath + "\\" + windowsDataFileName
+		err = writeDataOnFileForOS(namespace, pod.Name, nodeOSWindows, filePath, windowsDataContent)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		output, err := readFileForOS(namespace, pod.Name, nodeOSWindows, filePath)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(output).To(gomega.ContainSubstring(windowsDataContent))
+	})
+
+	// Test to verify offline expansion of a volume used on a Windows node.
+
+	// Steps
+	// 1. Create a PVC and wait for it to be bound.
+	// 2. Expand the PVC while it is not attached and wait for the PV to be resized.
+	// 3. Create a pod on a Windows node using the PVC.
+	// 4. Verify the filesystem is resized to the new size.
+	ginkgo.It("Expand an offline volume used on a Windows node", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		pvclaim, pv := createBoundPVC(client, namespace, storageclass, diskSize)
+		defer deletePVCAndWaitForCNSVolumeDeletion(client, pvclaim, pv)
+
+		newSize := expandPVCAndWaitForPvResize(client, pvclaim)
+
+		pod := createWindowsPodAndVerifyAttach(ctx, client, namespace, pvclaim, pv)
+		defer deletePodAndWaitForDetach(client, pod, pv.Spec.CSI.VolumeHandle)
+		verifyWindowsFSResize(client, pvclaim, pod, newSize)
+	})
+
+	// Test to verify online expansion of a volume attached to a Windows node.
+
+	// Steps
+	// 1. Create a PVC and a pod on a Windows node using it.
+	// 2. Expand the PVC and wait for the PV to be resized.
+	// 3. Verify the filesystem is resized to the new size without restarting the pod.
+	ginkgo.It("Expand an online volume attached to a Windows node", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		pvclaim, pv := createBoundPVC(client, namespace, storageclass, diskSize)
+		defer deletePVCAndWaitForCNSVolumeDeletion(client, pvclaim, pv)
+
+		pod := createWindowsPodAndVerifyAttach(ctx, client, namespace, pvclaim, pv)
+		defer deletePodAndWaitForDetach(client, pod, pv.Spec.CSI.VolumeHandle)
+
+		newSize := expandPVCAndWaitForPvResize(client, pvclaim)
+		verifyWindowsFSResize(client, pvclaim, pod, newSize)
+	})
+
+	// Test to verify volume stats are reported for a volume attached to a
+	// Windows node.
+
+	// Steps
+	// 1. Create a PVC and a pod on a Windows node using it.
+	// 2. Verify the kubelet stats summary of the node reports capacity and
+	//    usage for the PVC.
+	ginkgo.It("Report volume stats for a volume attached to a Windows node", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		pvclaim, pv := createBoundPVC(client, namespace, storageclass, diskSize)
+		defer deletePVCAndWaitForCNSVolumeDeletion(client, pvclaim, pv)
+
+		pod := createWindowsPodAndVerifyAttach(ctx, client, namespace, pvclaim, pv)
+		defer deletePodAndWaitForDetach(client, pod, pv.Spec.CSI.VolumeHandle)
+
+		ginkgo.By(fmt.Sprintf("Waiting for node %s to report stats for PVC %s", pod.Spec.NodeName, pvclaim.Name))
+		var capacityBytes, usedBytes uint64
+		err := wait.PollImmediate(healthStatusPollInterval, windowsStatsTimeout, func() (bool, error) {
+			summary, err := e2ekubelet.GetStatsSummary(client, pod.Spec.NodeName)
+			if err != nil {
+				framework.Logf("failed to get stats summary of node %s: %v", pod.Spec.NodeName, err)
+				return false, nil
+			}
+			for _, podStats := range summary.Pods {
+				if podStats.PodRef.Name != pod.Name || podStats.PodRef.Namespace != namespace {
+					continue
+				}
+				for _, volumeStats := range podStats.VolumeStats {
+					if volumeStats.PVCRef == nil || volumeStats.PVCRef.Name != pvclaim.Name ||
+						volumeStats.CapacityBytes == nil || volumeStats.UsedBytes == nil {
+						continue
+					}
+					capacityBytes, usedBytes = *volumeStats.CapacityBytes, *volumeStats.UsedBytes
+					return true, nil
+				}
+			}
+			return false, nil
+		})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		framework.Logf("PVC %s reports capacity %d bytes, used %d bytes", pvclaim.Name, capacityBytes, usedBytes)
+		gomega.Expect(capacityBytes).To(gomega.BeNumerically(">", 0))
+		gomega.Expect(usedBytes).To(gomega.BeNumerically("<=", capacityBytes))
+	})
+})
+
+// createWindowsPodAndVerifyAttach creates an idle pod on a Windows node using
+// the given claim and verifies the volume is attached to the node VM.
+func createWindowsPodAndVerifyAttach(ctx context.Context, client clientset.Interface, namespace string,
+	pvclaim *v1.PersistentVolumeClaim, pv *v1.PersistentVolume) *v1.Pod {
+	ginkgo.By(fmt.Sprintf("Creating pod on a Windows node using PVC %s", pvclaim.Name))
+	pod, err := createPodForOS(client, namespace, nodeOSWindows, nil, []*v1.PersistentVolumeClaim{pvclaim}, "")
+	gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+	ginkgo.By(fmt.Sprintf("Verifying volume %s is attached to node %s", pv.Spec.CSI.VolumeHandle, pod.Spec.NodeName))
+	vmUUID := getNodeUUID(client, pod.Spec.NodeName)
+	isDiskAttached, err := e2eVSphere.isVolumeAttachedToVM(client, pv.Spec.CSI.VolumeHandle, vmUUID)
+	gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	gomega.Expect(isDiskAttached).To(gomega.BeTrue(), "Volume is not attached to the node")
+	return pod
+}
+
+// verifyWindowsFSResize waits for the node side resize of the claim to finish
+// and verifies the NTFS volume in the pod has grown to at least newSize.
+func verifyWindowsFSResize(client clientset.Interface, pvclaim *v1.PersistentVolumeClaim, pod *v1.Pod,
+	newSize resource.Quantity) {
+	ginkgo.By("Waiting for file system resize to finish")
+	_, err := waitForFSResize(pvclaim, client)
+	gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	mountPath := getVolumeMountPathForOS(nodeOSWindows, 1)
+	fsSize, err := getFSSizeMbForOS(pod.Namespace, pod.Name, nodeOSWindows, mountPath)
+	gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	// NTFS metadata takes up a small part of the volume.
+	gomega.Expect(fsSize).To(gomega.BeNumerically(">", sizeInMb(newSize)-sizeInMb(resource.MustParse(volumeExpansionDelta))),
+		fmt.Sprintf("filesystem size %d MB did not grow towards %s", fsSize, newSize.String()))
+}